@@ -1,374 +1,234 @@
 package handler
 
 import (
-	"crypto/sha256"
-	"encoding/hex"
-	"encoding/json"
-	"fmt"
+	"log"
 	"net/http"
+	"os"
+	"path"
+	"strconv"
 	"strings"
-	"sync"
-	"time"
 
-	"emojiscript-backend/pkg/transpiler"
+	"emojiscript-backend/pkg/apikey"
+	"emojiscript-backend/pkg/canary"
+	"emojiscript-backend/pkg/chaos"
+	"emojiscript-backend/pkg/cors"
+	"emojiscript-backend/pkg/dialect"
+	"emojiscript-backend/pkg/emojiscriptapi"
+	"emojiscript-backend/pkg/kvcache"
+	"emojiscript-backend/pkg/scan"
+	"emojiscript-backend/pkg/servicetoken"
+	"emojiscript-backend/pkg/source"
+	"emojiscript-backend/pkg/storage"
+	"emojiscript-backend/pkg/usage"
+
+	// the PostgreSQL driver for STORAGE_URL=postgres://... (see openStorage)
+	_ "github.com/jackc/pgx/v5/stdlib"
 )
 
-const (
-	MaxCodeLength = 100000
-	MaxCacheSize  = 1000
-	CacheTTL      = time.Hour
-)
-
-type TranspileCache struct {
-	mu    sync.RWMutex
-	cache map[string]*CacheEntry
+var api = emojiscriptapi.NewHandler(emojiscriptapi.Options{
+	Prefix:             emojiscriptapi.DefaultPrefix,
+	AllowedOrigins:     cors.ParseOrigins(os.Getenv("ALLOWED_ORIGINS")),
+	Dialects:           loadDialects(),
+	AdminToken:         os.Getenv("ADMIN_TOKEN"),
+	ServiceTokens:      servicetoken.Parse(os.Getenv("SERVICE_TOKENS")),
+	APIKeys:            loadAPIKeys(),
+	NormalizeCacheKeys: os.Getenv("NORMALIZE_CACHE_KEYS") == "true",
+	CacheMaxBytes:      cacheMaxBytes(),
+	MaxCodeLength:      maxCodeLength(),
+	MaxCodeCharacters:  maxCodeCharacters(),
+	MaxOutputLength:    outputLimit(),
+	ComplexityBudget:   complexityBudget(),
+	RemoteCache:        remoteCache(),
+	Storage:            openStorage(),
+	AsyncThreshold:     asyncThreshold(),
+	GitHubAPIURL:       os.Getenv("GITHUB_API_URL"),
+	SourceHosts:        source.ParseHosts(os.Getenv("SOURCE_URL_HOSTS")),
+	Privacy:            os.Getenv("PRIVACY_MODE"),
+	SnippetRateLimit:   snippetRateLimit(),
+	SnippetScans:       snippetScans(),
+	// leaderboards live as long as the function instance, there being no
+	// file system to keep them in
+	SubmissionRateLimit: submissionRateLimit(),
+	WebhookRateLimit:    webhookRateLimit(),
+	Usage:               usageEmitter(),
+	Chaos:               chaosInjector(),
+	Canary:              canaryRouter(),
+	// SANDBOX_DISABLED=true turns off the routes that run programs
+	DisableSandbox: os.Getenv("SANDBOX_DISABLED") == "true",
+	// Vercel builds the function without git metadata, but tells it the
+	// commit it deploys
+	Commit: os.Getenv("VERCEL_GIT_COMMIT_SHA"),
+	// Vercel's proxy sets X-Real-IP and X-Forwarded-For for every request
+	TrustProxy: true,
+})
+
+// cacheMaxBytes reads CACHE_MAX_BYTES; zero picks the handler's default
+func cacheMaxBytes() int {
+	n, _ := strconv.Atoi(os.Getenv("CACHE_MAX_BYTES"))
+	return n
 }
 
-type CacheEntry struct {
-	result    *TranspileResponse
-	timestamp time.Time
+// maxCodeLength reads MAX_CODE_LENGTH, the longest program accepted in
+// bytes; zero picks the handler's default
+func maxCodeLength() int {
+	n, _ := strconv.Atoi(os.Getenv("MAX_CODE_LENGTH"))
+	return n
 }
 
-var cache = &TranspileCache{cache: make(map[string]*CacheEntry)}
-
-func (tc *TranspileCache) Get(key string) (*TranspileResponse, bool) {
-	tc.mu.RLock()
-	defer tc.mu.RUnlock()
-
-	if entry, exists := tc.cache[key]; exists && time.Since(entry.timestamp) < CacheTTL {
-		return entry.result, true
-	}
-	return nil, false
+// maxCodeCharacters reads MAX_CODE_CHARACTERS, the longest program
+// accepted in characters; zero picks the handler's default
+func maxCodeCharacters() int {
+	n, _ := strconv.Atoi(os.Getenv("MAX_CODE_CHARACTERS"))
+	return n
 }
 
-func (tc *TranspileCache) Set(key string, result *TranspileResponse) {
-	tc.mu.Lock()
-	defer tc.mu.Unlock()
-
-	if len(tc.cache) >= MaxCacheSize {
-		now := time.Now()
-		cutoff := now.Add(-CacheTTL)
-		deleted := 0
-		for k, v := range tc.cache {
-			if v.timestamp.Before(cutoff) {
-				delete(tc.cache, k)
-				deleted++
-				if deleted >= MaxCacheSize/4 {
-					break
-				}
-			}
-		}
-		if len(tc.cache) >= MaxCacheSize {
-			for k := range tc.cache {
-				delete(tc.cache, k)
-				break
-			}
-		}
-	}
-
-	tc.cache[key] = &CacheEntry{result: result, timestamp: time.Now()}
+// outputLimit reads OUTPUT_LIMIT, the bytes one transpile may generate;
+// zero picks the handler's default
+func outputLimit() int {
+	n, _ := strconv.Atoi(os.Getenv("OUTPUT_LIMIT"))
+	return n
 }
 
-type TranspileRequest struct {
-	Code           string `json:"code"`
-	TargetLanguage string `json:"targetLanguage,omitempty"`
-	UseMarkup      bool   `json:"useMarkup,omitempty"`
+// complexityBudget reads COMPLEXITY_BUDGET, the most a program may cost
+// to parse; zero picks the handler's default
+func complexityBudget() int {
+	n, _ := strconv.Atoi(os.Getenv("COMPLEXITY_BUDGET"))
+	return n
 }
 
-type TranspileResponse struct {
-	Success        bool                   `json:"success"`
-	Output         string                 `json:"output"`
-	TargetLanguage string                 `json:"targetLanguage"`
-	Errors         []string               `json:"errors,omitempty"`
-	Warnings       []string               `json:"warnings,omitempty"`
-	Metadata       map[string]interface{} `json:"metadata,omitempty"`
-	UsedMarkup     bool                   `json:"usedMarkup,omitempty"`
+// remoteCache connects to Vercel KV, Upstash or Redis when their
+// environment variables are set (see kvcache.FromEnv), so cached results
+// survive cold starts; without them the cache lasts as long as the
+// function instance
+func remoteCache() kvcache.Store {
+	store, err := kvcache.FromEnv(os.Getenv)
+	if err != nil {
+		log.Printf("remote cache: %v; using the in-memory cache", err)
+		return nil
+	}
+	return store
 }
 
-type Example struct {
-	Title          string `json:"title"`
-	Description    string `json:"description"`
-	Code           string `json:"code"`
-	Category       string `json:"category"`
-	Syntax         string `json:"syntax"`
-	TargetLanguage string `json:"targetLanguage,omitempty"`
+// openStorage opens the store STORAGE_URL names (see storage.Open). A
+// function has no disk to keep a SQLite file on, so only the postgres
+// driver is linked in, by the blank import above; without a store,
+// snippets and jobs last as long as the remote cache or the instance.
+func openStorage() storage.Store {
+	store, err := storage.FromEnv(os.Getenv)
+	if err != nil {
+		log.Printf("%v; keeping records in memory", err)
+		return nil
+	}
+	return store
 }
 
-func Handler(w http.ResponseWriter, r *http.Request) {
-	origin := r.Header.Get("Origin")
-	if origin == "https://emoji-script.vercel.app" || origin == "http://localhost:3000" || origin == "http://localhost:3001" {
-		w.Header().Set("Access-Control-Allow-Origin", origin)
-	} else {
-		w.Header().Set("Access-Control-Allow-Origin", "*")
-	}
-	w.Header().Set("Access-Control-Allow-Methods", "GET, POST, OPTIONS")
-	w.Header().Set("Access-Control-Allow-Headers", "Content-Type")
-	w.Header().Set("Content-Type", "application/json")
-
-	if r.Method == "OPTIONS" {
-		w.WriteHeader(http.StatusOK)
-		return
-	}
-
-	path := r.URL.Path
-
-	if strings.HasSuffix(path, "/api/v1/health") || strings.HasSuffix(path, "/health") {
-		json.NewEncoder(w).Encode(map[string]string{"status": "healthy", "version": "1.0.0"})
-		return
-	}
-
-	if strings.HasSuffix(path, "/api/v1/examples") || strings.HasSuffix(path, "/examples") {
-		json.NewEncoder(w).Encode(map[string]interface{}{"examples": getExamples()})
-		return
-	}
-
-	if r.Method != "POST" || (!strings.HasSuffix(path, "/api/v1/transpile") && !strings.HasSuffix(path, "/transpile")) {
-		http.Error(w, "Not found", http.StatusNotFound)
-		return
-	}
-
-	var req TranspileRequest
-	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-		json.NewEncoder(w).Encode(TranspileResponse{
-			Success: false,
-			Errors:  []string{"Invalid request"},
-		})
-		return
-	}
-
-	if err := validateInput(req.Code); err != nil {
-		json.NewEncoder(w).Encode(TranspileResponse{
-			Success: false,
-			Errors:  []string{err.Error()},
-		})
-		return
-	}
-
-	targetLang := strings.ToLower(req.TargetLanguage)
-	if targetLang == "" {
-		targetLang = "javascript"
-	}
-
-	if targetLang != "javascript" {
-		json.NewEncoder(w).Encode(TranspileResponse{
-			Success: false,
-			Errors:  []string{"Only JavaScript is supported"},
-		})
-		return
-	}
-
-	useMarkup := req.UseMarkup || detectMarkupSyntax(req.Code)
-	cacheKey := generateCacheKey(req.Code, targetLang, useMarkup)
-
-	if cached, found := cache.Get(cacheKey); found {
-		if cached.Metadata == nil {
-			cached.Metadata = make(map[string]interface{})
-		}
-		cached.Metadata["cached"] = true
-		json.NewEncoder(w).Encode(cached)
-		return
-	}
+// snippetRateLimit reads SNIPPET_RATE_LIMIT; zero picks the handler's
+// default
+func snippetRateLimit() int {
+	n, _ := strconv.Atoi(os.Getenv("SNIPPET_RATE_LIMIT"))
+	return n
+}
 
-	var output string
-	var errors, warnings []string
-	var err error
+// submissionRateLimit reads SUBMISSION_RATE_LIMIT; zero picks the
+// handler's default
+func submissionRateLimit() int {
+	n, _ := strconv.Atoi(os.Getenv("SUBMISSION_RATE_LIMIT"))
+	return n
+}
 
-	if useMarkup {
-		output, errors, warnings, err = transpileWithMarkup(req.Code, targetLang)
-		if err != nil || len(errors) > 0 {
-			allErrors := errors
-			if err != nil {
-				allErrors = append(allErrors, err.Error())
-			}
-			response := TranspileResponse{
-				Success:        false,
-				TargetLanguage: targetLang,
-				Errors:         allErrors,
-				Warnings:       warnings,
-				UsedMarkup:     useMarkup,
-			}
-			json.NewEncoder(w).Encode(response)
-			return
-		}
-	} else {
-		output, err = transpileToLanguage(req.Code, targetLang)
-		if err != nil {
-			response := TranspileResponse{
-				Success:        false,
-				TargetLanguage: targetLang,
-				Errors:         []string{err.Error()},
-				UsedMarkup:     useMarkup,
-			}
-			json.NewEncoder(w).Encode(response)
-			return
-		}
-	}
+// webhookRateLimit reads WEBHOOK_RATE_LIMIT; zero picks the handler's
+// default
+func webhookRateLimit() int {
+	n, _ := strconv.Atoi(os.Getenv("WEBHOOK_RATE_LIMIT"))
+	return n
+}
 
-	if strings.TrimSpace(output) == "" {
-		json.NewEncoder(w).Encode(TranspileResponse{
-			Success: false,
-			Errors:  []string{"Empty output"},
-		})
-		return
+// usageEmitter streams usage events to USAGE_SINK (see usage.FromEnv).
+// Each event is sent on its own rather than batched, as a function
+// instance may be frozen, or never woken again, before a batch fills.
+func usageEmitter() *usage.Emitter {
+	sink, err := usage.FromEnv(os.Getenv)
+	if err != nil {
+		log.Printf("usage events: %v; usage isn't metered", err)
+		return nil
 	}
-
-	response := TranspileResponse{
-		Success:        true,
-		Output:         output,
-		TargetLanguage: targetLang,
-		Warnings:       warnings,
-		UsedMarkup:     useMarkup,
-		Metadata: map[string]interface{}{
-			"cached": false,
-		},
+	if sink == nil {
+		return nil
 	}
-
-	cache.Set(cacheKey, &response)
-	json.NewEncoder(w).Encode(response)
+	return usage.NewEmitter(sink, 1, 0)
 }
 
-func validateInput(code string) error {
-	if len(code) == 0 {
-		return fmt.Errorf("code cannot be empty")
-	}
-	if len(code) > MaxCodeLength {
-		return fmt.Errorf("code exceeds maximum length")
+// chaosInjector reads CHAOS_MODE and its rates (see chaos.FromEnv); a
+// broken setting injects nothing
+func chaosInjector() *chaos.Injector {
+	injector, err := chaos.FromEnv(os.Getenv)
+	if err != nil {
+		log.Printf("chaos mode: %v; no faults are injected", err)
 	}
+	return injector
+}
 
-	dangerousPatterns := []string{"eval(", "exec(", "__import__", "subprocess", "os.system"}
-	lower := strings.ToLower(code)
-	for _, pattern := range dangerousPatterns {
-		if strings.Contains(lower, pattern) {
-			return fmt.Errorf("unsafe pattern detected")
-		}
+// canaryRouter reads CANARY_PERCENT, CANARY_ROUTES and CANARY_KEYS (see
+// canary.FromEnv); a broken setting sends everything to the syntax tree
+func canaryRouter() *canary.Router {
+	router, err := canary.FromEnv(os.Getenv)
+	if err != nil {
+		log.Printf("canary: %v; every transpile takes the syntax tree", err)
 	}
-	return nil
+	return router
 }
 
-func generateCacheKey(code, lang string, markup bool) string {
-	hash := sha256.Sum256([]byte(fmt.Sprintf("%s:%s:%t", code, lang, markup)))
-	return hex.EncodeToString(hash[:])
+// asyncThreshold reads ASYNC_THRESHOLD; zero keeps every request
+// synchronous
+func asyncThreshold() int {
+	n, _ := strconv.Atoi(os.Getenv("ASYNC_THRESHOLD"))
+	return n
 }
 
-func detectMarkupSyntax(code string) bool {
-	tags := []string{"<print", "<var", "<let", "<const", "<function", "<loop", "<if", "<class"}
-	lower := strings.ToLower(code)
-	for _, tag := range tags {
-		if strings.Contains(lower, tag) {
-			return true
-		}
+// loadAPIKeys reads API_KEYS (see apikey.Parse). A list that can't be
+// read configures no keys, so requests sending one are rejected rather
+// than let through unmetered.
+func loadAPIKeys() *apikey.Store {
+	keys, err := apikey.Parse(os.Getenv("API_KEYS"))
+	if err != nil {
+		log.Printf("API keys: %v; no keys are accepted", err)
+		keys, _ = apikey.Parse("")
 	}
-	return false
+	return keys
 }
 
-func transpileWithMarkup(code, targetLang string) (string, []string, []string, error) {
-	parser := transpiler.NewMarkupParser(code, targetLang)
-	output, err := parser.Parse()
-	return output, parser.GetErrors(), parser.GetWarnings(), err
-}
-
-func transpileToLanguage(code, targetLang string) (string, error) {
-	emojiMap := map[string]string{
-		"📦": "const", "🔢": "let", "🎯": "function", "➡️": "=>", "🔁": "for", "❓": "if",
-		"❌": "else", "✅": "true", "⛔": "false", "🔙": "return", "📝": "console.log",
-		"➕": "+", "➖": "-", "✖️": "*", "➗": "/", "🟰": "===", "❗": "!==",
-		"⬆️": ">", "⬇️": "<", "📈": ">=", "📉": "<=", "🔗": "&&", "🔀": "||",
-		"🚫": "!", "📥": "import", "📤": "export", "🔄": "while", "⚡": "async",
-		"⏳": "await", "🎁": "new", "🗑️": "delete", "📊": "typeof", "🔍": "in",
-		"🎪": "switch", "🔘": "case", "🏁": "break", "⏭️": "continue", "💥": "throw",
-		"🛡️": "try", "🚨": "catch", "🏆": "finally", "🔐": "class", "🎨": "extends",
-		"🌟": "static", "🔧": "constructor", "🎭": "this", "📍": "null", "❔": "undefined",
+// loadDialects opens the DIALECT_STORE file, falling back to an in-memory
+// store (which lasts as long as the function instance) when it can't be read
+func loadDialects() *dialect.Store {
+	store, err := dialect.NewStore(os.Getenv("DIALECT_STORE"))
+	if err != nil {
+		log.Printf("dialect store: %v; using in-memory packs", err)
+		store, _ = dialect.NewStore("")
 	}
+	return store
+}
 
-	result := code
-	for emoji, keyword := range emojiMap {
-		result = strings.ReplaceAll(result, emoji, keyword)
+// snippetScans reads the snippet scanning rules (see scan.FromEnv); a
+// broken setting leaves the default URL scanning
+func snippetScans() []scan.Rule {
+	rules, err := scan.FromEnv(os.Getenv)
+	if err != nil {
+		log.Printf("snippet scanning: %v; scanning URLs only", err)
+		rules, _ = scan.FromEnv(func(string) string { return "" })
 	}
-
-	return result, nil
+	return rules
 }
 
-func getExamples() []Example {
-	return []Example{
-		{
-			Title:          "Hello World",
-			Description:    "Classic greeting",
-			Code:           "👋🌍",
-			Category:       "basics",
-			Syntax:         "emoji",
-			TargetLanguage: "javascript",
-		},
-		{
-			Title:          "Variables",
-			Description:    "Declare and use variables",
-			Code:           "📦 x = 5\n📦 y = 10\n➕ x y",
-			Category:       "basics",
-			Syntax:         "emoji",
-			TargetLanguage: "javascript",
-		},
-		{
-			Title:          "Conditions",
-			Description:    "If-else statement",
-			Code:           "❓ x > 5 {\n  📢 \"Greater\"\n} ❌ {\n  📢 \"Smaller\"\n}",
-			Category:       "control-flow",
-			Syntax:         "emoji",
-			TargetLanguage: "javascript",
-		},
-		{
-			Title:          "Loop",
-			Description:    "For loop example",
-			Code:           "🔄 i = 0; i < 10; i++ {\n  📢 i\n}",
-			Category:       "control-flow",
-			Syntax:         "emoji",
-			TargetLanguage: "javascript",
-		},
-		{
-			Title:          "Function",
-			Description:    "Define and call a function",
-			Code:           "🎯 greet(name) {\n  ↩️ \"Hello \" + name\n}\n📢 greet(\"World\")",
-			Category:       "functions",
-			Syntax:         "emoji",
-			TargetLanguage: "javascript",
-		},
-		{
-			Title:          "Array Operations",
-			Description:    "Work with arrays",
-			Code:           "📋 arr = [1, 2, 3, 4, 5]\n📢 arr[0]\n📏 arr",
-			Category:       "data-structures",
-			Syntax:         "emoji",
-			TargetLanguage: "javascript",
-		},
-		{
-			Title:          "Object Creation",
-			Description:    "Create and use objects",
-			Code:           "🎁 person = {\n  name: \"Alice\",\n  age: 30\n}\n📢 person.name",
-			Category:       "data-structures",
-			Syntax:         "emoji",
-			TargetLanguage: "javascript",
-		},
-		{
-			Title:          "Math Operations",
-			Description:    "Perform calculations",
-			Code:           "📦 result = (10 ➕ 5) ➖ 3 ✖️ 2\n📢 result",
-			Category:       "basics",
-			Syntax:         "emoji",
-			TargetLanguage: "javascript",
-		},
-		{
-			Title:          "String Manipulation",
-			Description:    "Work with strings",
-			Code:           "📦 str = \"Hello\"\n📦 upper = str.toUpperCase()\n📢 upper",
-			Category:       "basics",
-			Syntax:         "emoji",
-			TargetLanguage: "javascript",
-		},
-		{
-			Title:          "Error Handling",
-			Description:    "Try-catch example",
-			Code:           "🛡️ {\n  📦 x = riskyOperation()\n  📢 x\n} 🚫 (err) {\n  📢 \"Error: \" + err\n}",
-			Category:       "advanced",
-			Syntax:         "emoji",
-			TargetLanguage: "javascript",
-		},
+// Handler is the Vercel entry point. vercel.json rewrites every
+// /api/v1/* route here, and the short /embed/:id viewer URL; requests to
+// the function's own path (/api/transpile) are mapped onto the matching
+// versioned route.
+func Handler(w http.ResponseWriter, r *http.Request) {
+	switch {
+	case strings.HasPrefix(r.URL.Path, "/embed/"):
+		r.URL.Path = emojiscriptapi.DefaultPrefix + r.URL.Path
+	case !strings.HasPrefix(r.URL.Path, emojiscriptapi.DefaultPrefix+"/"):
+		r.URL.Path = emojiscriptapi.DefaultPrefix + "/" + path.Base(r.URL.Path)
 	}
+	api.ServeHTTP(w, r)
 }
@@ -0,0 +1,56 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+
+	"emojiscript-backend/pkg/astviz"
+	"emojiscript-backend/pkg/sandbox"
+)
+
+func runAST(args []string) error {
+	flags := flag.NewFlagSet("ast", flag.ExitOnError)
+	dot := flags.Bool("dot", false, "print a Graphviz DOT graph")
+	mermaid := flags.Bool("mermaid", false, "print a Mermaid flowchart")
+	markup := flags.Bool("markup", false, "treat the file as markup syntax")
+	flags.Usage = func() {
+		fmt.Fprintln(os.Stderr, "Usage: emojic ast [flags] <file>")
+		fmt.Fprintln(os.Stderr, "Prints the syntax tree of the transpiled program, as JSON unless a format is chosen.")
+		fmt.Fprintln(os.Stderr, "Render DOT with e.g.: emojic ast -dot program.emoji | dot -Tsvg > ast.svg")
+		flags.PrintDefaults()
+	}
+	flags.Parse(args)
+	if flags.NArg() != 1 || (*dot && *mermaid) {
+		flags.Usage()
+		os.Exit(2)
+	}
+
+	source, err := os.ReadFile(flags.Arg(0))
+	if err != nil {
+		return err
+	}
+	output, errors, _ := transpileSource(string(source), "javascript", *markup)
+	if len(errors) > 0 {
+		return fmt.Errorf("%s", strings.Join(errors, "; "))
+	}
+	tree, err := sandbox.Tree(output)
+	if err != nil {
+		return fmt.Errorf("parsing transpiled output: %v", err)
+	}
+
+	switch {
+	case *dot:
+		fmt.Print(astviz.DOT(tree))
+	case *mermaid:
+		fmt.Print(astviz.Mermaid(tree))
+	default:
+		encoder := json.NewEncoder(os.Stdout)
+		encoder.SetEscapeHTML(false)
+		encoder.SetIndent("", "  ")
+		return encoder.Encode(tree)
+	}
+	return nil
+}
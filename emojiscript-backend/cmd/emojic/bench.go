@@ -0,0 +1,79 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+	"testing"
+
+	"emojiscript-backend/pkg/golden"
+	"emojiscript-backend/pkg/transpiler"
+)
+
+func runBench(args []string) error {
+	flags := flag.NewFlagSet("bench", flag.ExitOnError)
+	size := flags.Int("size", 64<<10, "approximate input size in bytes")
+	flags.Usage = func() {
+		fmt.Fprintln(os.Stderr, "Usage: emojic bench [flags]")
+		fmt.Fprintln(os.Stderr, "Compares keyword emoji substitution through the lexer and parser against one ReplaceAll pass")
+		fmt.Fprintln(os.Stderr, "per emoji, on the golden corpus's emoji programs repeated to the given size.")
+		flags.PrintDefaults()
+	}
+	flags.Parse(args)
+	if *size <= 0 {
+		return fmt.Errorf("size must be positive")
+	}
+
+	input := benchInput(*size)
+	var pairs []string
+	for _, emoji := range transpiler.Reference() {
+		for e, keyword := range emoji {
+			pairs = append(pairs, e, keyword)
+		}
+	}
+	replaceAll := func(code string) string {
+		for i := 0; i < len(pairs); i += 2 {
+			code = strings.ReplaceAll(code, pairs[i], pairs[i+1])
+		}
+		return code
+	}
+	// the corpus has no emoji in strings or comments, which only the
+	// lexer leaves alone, so the two must agree on it
+	if replaceAll(input) != transpiler.ReplaceKeywordEmoji(input) {
+		return fmt.Errorf("the two substitutions disagree on the benchmark input")
+	}
+
+	bench := func(replace func(string) string) testing.BenchmarkResult {
+		return testing.Benchmark(func(b *testing.B) {
+			b.SetBytes(int64(len(input)))
+			b.ReportAllocs()
+			for i := 0; i < b.N; i++ {
+				replace(input)
+			}
+		})
+	}
+	perEmoji := bench(replaceAll)
+	parsed := bench(transpiler.ReplaceKeywordEmoji)
+
+	fmt.Printf("input: %d bytes, %d keyword emoji\n", len(input), len(pairs)/2)
+	fmt.Printf("%-12s %s %s\n", "replace-all", perEmoji, perEmoji.MemString())
+	fmt.Printf("%-12s %s %s\n", "parsed", parsed, parsed.MemString())
+	if parsed.NsPerOp() > 0 {
+		fmt.Printf("speedup: %.1fx\n", float64(perEmoji.NsPerOp())/float64(parsed.NsPerOp()))
+	}
+	return nil
+}
+
+// benchInput repeats the corpus's emoji programs, canonicalized and with
+// records, switch expressions and getters expanded as they are before
+// substitution, until they fill about size bytes
+func benchInput(size int) string {
+	var programs []string
+	for _, fixture := range golden.Fixtures("", "emoji") {
+		code := transpiler.ExpandRecords(transpiler.CanonicalizeEmoji(fixture.Input), "javascript")
+		programs = append(programs, transpiler.ExpandGetters(transpiler.ExpandSwitchExpressions(code, "javascript")))
+	}
+	corpus := strings.Join(programs, "\n") + "\n"
+	return strings.Repeat(corpus, max(size/len(corpus), 1))
+}
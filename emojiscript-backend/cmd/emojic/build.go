@@ -0,0 +1,352 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"maps"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+
+	"emojiscript-backend/pkg/codegen"
+	"emojiscript-backend/pkg/project"
+	"emojiscript-backend/pkg/transpiler"
+)
+
+// stdinName is how diagnostics name source read from stdin
+const stdinName = "<stdin>"
+
+type builder struct {
+	target string
+	markup bool
+	out    string
+	// idiomatic runs the target's idiom passes over each output
+	idiomatic bool
+	// outDir is set when out names a directory for several outputs
+	outDir bool
+	// several is set for more than one input, whose outputs can't all
+	// go to stdout
+	several bool
+	// markupFiles are the sources a project's configuration says to read
+	// as markup
+	markupFiles map[string]bool
+}
+
+func runBuild(args []string) error {
+	flags := flag.NewFlagSet("build", flag.ExitOnError)
+	target := flags.String("target", "javascript", "target language: "+strings.Join(slices.Sorted(maps.Keys(project.Extensions)), ", "))
+	markup := flags.Bool("markup", false, "treat the input as markup syntax")
+	out := flags.String("out", "", "output file, or directory when there are several inputs (default stdout for one input)")
+	watch := flags.Bool("watch", false, "rebuild the files whenever they change")
+	idiomatic := flags.Bool("idiomatic", false, "rewrite the output the way the target is written by hand, e.g. print with f-strings in Python")
+	format := flags.Bool("fmt", false, "format the sources in place instead of transpiling them (stdin to stdout)")
+	flags.Usage = func() {
+		fmt.Fprintln(os.Stderr, "Usage: emojic build [flags] [file|glob|project]...")
+		fmt.Fprintln(os.Stderr, "Transpiles source files, or stdin when no file (or '-') is given.")
+		fmt.Fprintln(os.Stderr, "Without -out, several inputs are written next to their sources with the target's extension.")
+		fmt.Fprintf(os.Stderr, "A directory with an %s is built as a project, into the directory it names.\n", project.ConfigFile)
+		flags.PrintDefaults()
+	}
+	flags.Parse(args)
+	if *format {
+		if *watch || *out != "" {
+			return fmt.Errorf("-fmt rewrites the sources; it can't be combined with -out or -watch")
+		}
+		return formatSources(flags.Args(), *markup)
+	}
+	dir, config, isProject, err := projectArg(flags.Args())
+	if err != nil {
+		return err
+	}
+	targetSet := false
+	flags.Visit(func(f *flag.Flag) { targetSet = targetSet || f.Name == "target" })
+	if isProject && !targetSet {
+		*target = config.Target
+	}
+	if *target, err = buildTarget(*target); err != nil {
+		return err
+	}
+
+	b := &builder{target: *target, markup: *markup, out: *out, idiomatic: *idiomatic}
+	if isProject {
+		return b.buildProject(dir, config, *watch)
+	}
+	if flags.NArg() == 0 || (flags.NArg() == 1 && flags.Arg(0) == "-") {
+		if *watch {
+			return fmt.Errorf("-watch needs files, not stdin")
+		}
+		source, err := io.ReadAll(os.Stdin)
+		if err != nil {
+			return err
+		}
+		return b.result(b.build(stdinName, string(source)))
+	}
+
+	files, err := expandGlobs(flags.Args())
+	if err != nil {
+		return err
+	}
+	b.several = len(files) > 1
+	if b.several && b.out != "" {
+		b.outDir = true
+	} else if info, err := os.Stat(b.out); err == nil && info.IsDir() {
+		b.outDir = true
+	}
+	if b.outDir {
+		if err := os.MkdirAll(b.out, 0o755); err != nil {
+			return err
+		}
+	}
+
+	failed := 0
+	for _, file := range files {
+		failed += b.buildFile(file)
+	}
+	if *watch {
+		b.watch(files)
+	}
+	return b.result(failed)
+}
+
+// buildTarget resolves the name of a target emojic builds
+func buildTarget(name string) (string, error) {
+	resolved, _ := transpiler.ResolveTarget(name)
+	if _, ok := project.Extensions[resolved]; !ok {
+		return "", fmt.Errorf("unknown target %q; valid values: %s", name, transpiler.DescribeTargets(slices.Sorted(maps.Keys(project.Extensions))))
+	}
+	return resolved, nil
+}
+
+// projectArg reports whether the only argument is a project's directory,
+// returning its configuration; a directory without one is an error
+func projectArg(args []string) (dir string, config project.Config, found bool, err error) {
+	if len(args) != 1 {
+		return "", config, false, nil
+	}
+	if info, err := os.Stat(args[0]); err != nil || !info.IsDir() {
+		return "", config, false, nil
+	}
+	config, found, err = project.Load(args[0])
+	if err == nil && !found {
+		err = fmt.Errorf("%s has no %s", args[0], project.ConfigFile)
+	}
+	return args[0], config, found, err
+}
+
+// buildProject builds every .emoji file in the project's source
+// directory into its output directory, or into -out when it's given
+func (b *builder) buildProject(dir string, config project.Config, watch bool) error {
+	files, err := config.Sources(dir)
+	if err != nil {
+		return err
+	}
+	if len(files) == 0 {
+		return fmt.Errorf("no .emoji files in %s", filepath.Join(dir, config.Src))
+	}
+	if b.out == "" {
+		b.out = filepath.Join(dir, config.Out)
+	}
+	b.several, b.outDir = true, true
+	if err := os.MkdirAll(b.out, 0o755); err != nil {
+		return err
+	}
+	b.markupFiles = map[string]bool{}
+	for _, file := range files {
+		b.markupFiles[file] = config.IsMarkup(dir, file)
+	}
+
+	failed := 0
+	for _, file := range files {
+		failed += b.buildFile(file)
+	}
+	if watch {
+		b.watch(files)
+	}
+	return b.result(failed)
+}
+
+// expandGlobs expands the patterns the shell left alone (e.g. quoted
+// ones), keeping plain paths as given so a missing file is reported
+func expandGlobs(patterns []string) ([]string, error) {
+	var files []string
+	seen := map[string]bool{}
+	for _, pattern := range patterns {
+		matches := []string{pattern}
+		if strings.ContainsAny(pattern, "*?[") {
+			var err error
+			if matches, err = filepath.Glob(pattern); err != nil {
+				return nil, fmt.Errorf("bad pattern %q: %v", pattern, err)
+			}
+			if len(matches) == 0 {
+				return nil, fmt.Errorf("no files match %q", pattern)
+			}
+		}
+		for _, match := range matches {
+			if !seen[match] {
+				seen[match] = true
+				files = append(files, match)
+			}
+		}
+	}
+	return files, nil
+}
+
+func (b *builder) result(failed int) error {
+	if failed > 0 {
+		return fmt.Errorf("%d error(s)", failed)
+	}
+	return nil
+}
+
+// buildFile transpiles one file to its output, returning how many errors
+// it had
+func (b *builder) buildFile(file string) int {
+	source, err := os.ReadFile(file)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%s: error: %v\n", file, err)
+		return 1
+	}
+	return b.build(file, string(source))
+}
+
+// build transpiles source named name, printing its diagnostics and
+// writing the output unless there were errors
+func (b *builder) build(name, source string) int {
+	output, diagnostics := b.transpile(source, b.markup || b.markupFiles[name])
+
+	failed := 0
+	for _, d := range diagnostics {
+		if d.Severity == transpiler.SeverityError {
+			failed++
+		}
+		if d.Line > 0 {
+			fmt.Fprintf(os.Stderr, "%s:%d:%d: %s: %s\n", name, d.Line, d.Column, d.Severity, d.Message)
+		} else {
+			fmt.Fprintf(os.Stderr, "%s: %s: %s\n", name, d.Severity, d.Message)
+		}
+	}
+	if failed > 0 {
+		return failed
+	}
+	if b.idiomatic {
+		output = transpiler.Idiomatic(output, b.target)
+	}
+
+	path := b.outputPath(name)
+	if path == "" {
+		fmt.Print(output)
+		return 0
+	}
+	if err := os.WriteFile(path, []byte(output), 0o644); err != nil {
+		fmt.Fprintf(os.Stderr, "%s: error: %v\n", name, err)
+		return 1
+	}
+	return 0
+}
+
+// transpile runs source through the markup transpiler when markup is set
+// or it looks like markup, and through the emoji one otherwise. Markup
+// errors the parser couldn't position are reported without one. Targets
+// codegen generates are transpiled to JavaScript, which codegen writes
+// the target from, its warnings reported without a position.
+func (b *builder) transpile(source string, markup bool) (string, []transpiler.Diagnostic) {
+	output, diagnostics := b.transpileTo(b.transpilerTarget(), source, markup)
+	if !codegen.Generates(b.target) || hasErrors(diagnostics) {
+		return output, diagnostics
+	}
+	generated, warnings, err := codegen.Generate(b.target, output)
+	if err != nil {
+		return "", append(diagnostics, transpiler.Diagnostic{Message: err.Error(), Severity: transpiler.SeverityError})
+	}
+	for _, warning := range warnings {
+		diagnostics = append(diagnostics, transpiler.Diagnostic{Message: warning, Severity: transpiler.SeverityWarning})
+	}
+	return generated, diagnostics
+}
+
+// transpilerTarget is the language the transpiler writes for the target
+func (b *builder) transpilerTarget() string {
+	if codegen.Generates(b.target) {
+		return "javascript"
+	}
+	return b.target
+}
+
+func (b *builder) transpileTo(target, source string, markup bool) (string, []transpiler.Diagnostic) {
+	t := transpiler.New(transpiler.Options{TargetLanguage: target})
+	if markup || looksLikeMarkup(source) {
+		result, err := t.TranspileMarkup(source, transpiler.MarkupOptions{})
+		diagnostics := result.Diagnostics
+		if err != nil && !hasErrors(diagnostics) {
+			diagnostics = append(diagnostics, transpiler.Diagnostic{Message: err.Error(), Severity: transpiler.SeverityError})
+		}
+		return result.Output, diagnostics
+	}
+	diagnostics := t.DiagnoseEmoji(source)
+	if hasErrors(diagnostics) {
+		return "", diagnostics
+	}
+	return t.TranspileEmoji(source), diagnostics
+}
+
+func hasErrors(diagnostics []transpiler.Diagnostic) bool {
+	for _, d := range diagnostics {
+		if d.Severity == transpiler.SeverityError {
+			return true
+		}
+	}
+	return false
+}
+
+// outputPath is where name's output goes, or "" for stdout
+func (b *builder) outputPath(name string) string {
+	ext := project.Extensions[b.target]
+	switch {
+	case name == stdinName:
+		return b.out
+	case b.outDir:
+		return filepath.Join(b.out, strings.TrimSuffix(filepath.Base(name), filepath.Ext(name))+ext)
+	case b.out != "":
+		return b.out
+	case b.several:
+		return strings.TrimSuffix(name, filepath.Ext(name)) + ext
+	}
+	return ""
+}
+
+// watch polls the files' modification times and sizes, rebuilding each
+// one that changes; it never returns
+func (b *builder) watch(files []string) {
+	type stamp struct {
+		mod  time.Time
+		size int64
+	}
+	stamps := make(map[string]stamp, len(files))
+	for _, file := range files {
+		if info, err := os.Stat(file); err == nil {
+			stamps[file] = stamp{info.ModTime(), info.Size()}
+		}
+	}
+
+	log.Printf("👀 Watching %d file(s)\n", len(files))
+	for range time.Tick(WatchInterval) {
+		for _, file := range files {
+			info, err := os.Stat(file)
+			if err != nil {
+				continue
+			}
+			last := stamps[file]
+			if info.ModTime().Equal(last.mod) && info.Size() == last.size {
+				continue
+			}
+			stamps[file] = stamp{info.ModTime(), info.Size()}
+			if b.buildFile(file) == 0 {
+				log.Printf("♻️  Rebuilt %s\n", file)
+			}
+		}
+	}
+}
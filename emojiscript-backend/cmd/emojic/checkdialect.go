@@ -0,0 +1,115 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"emojiscript-backend/pkg/dialect"
+)
+
+// dialectReport is the -json output of check-dialect
+type dialectReport struct {
+	Problems  map[string][]string `json:"problems"`
+	Conflicts []dialect.Conflict  `json:"conflicts"`
+}
+
+func runCheckDialect(args []string) error {
+	flags := flag.NewFlagSet("check-dialect", flag.ExitOnError)
+	asJSON := flags.Bool("json", false, "print the report as JSON")
+	flags.Usage = func() {
+		fmt.Fprintln(os.Stderr, "Usage: emojic check-dialect [flags] <pack.json>...")
+		fmt.Fprintln(os.Stderr, "Checks each pack, then all packs together as if they were active at once.")
+		flags.PrintDefaults()
+	}
+	flags.Parse(args)
+	if flags.NArg() == 0 {
+		flags.Usage()
+		os.Exit(2)
+	}
+
+	packs := []dialect.Pack{}
+	for _, file := range flags.Args() {
+		loaded, err := loadPacks(file)
+		if err != nil {
+			return fmt.Errorf("%s: %v", file, err)
+		}
+		packs = append(packs, loaded...)
+	}
+
+	report := dialectReport{Problems: map[string][]string{}, Conflicts: []dialect.Conflict{}}
+	count := 0
+	for _, pack := range packs {
+		var invalid *dialect.ValidationError
+		if err := pack.Validate(); errors.As(err, &invalid) {
+			report.Problems[pack.Name] = invalid.Problems
+			count += len(invalid.Problems)
+		}
+	}
+	if len(packs) > 1 {
+		for _, conflict := range dialect.Check(packs...) {
+			if len(conflict.Packs) > 1 && conflict.Packs[0] != conflict.Packs[1] && conflict.Packs[1] != dialect.Builtin {
+				report.Conflicts = append(report.Conflicts, conflict)
+			}
+		}
+		count += len(report.Conflicts)
+	}
+
+	if *asJSON {
+		encoder := json.NewEncoder(os.Stdout)
+		encoder.SetEscapeHTML(false)
+		encoder.SetIndent("", "  ")
+		encoder.Encode(report)
+	} else {
+		for _, pack := range packs {
+			for _, problem := range report.Problems[pack.Name] {
+				fmt.Printf("%s: %s\n", pack.Name, problem)
+			}
+		}
+		for _, conflict := range report.Conflicts {
+			fmt.Printf("%s: %s\n", strings.Join(conflict.Packs, "+"), conflict.Message)
+		}
+	}
+
+	if count > 0 {
+		return fmt.Errorf("%d problem(s) in %d pack(s)", count, len(packs))
+	}
+	if !*asJSON {
+		fmt.Printf("✅ %d pack(s) OK\n", len(packs))
+	}
+	return nil
+}
+
+// loadPacks reads a single pack object or a list of packs (the format the
+// server's DIALECT_STORE file uses). A pack without a name is named after
+// its file.
+func loadPacks(file string) ([]dialect.Pack, error) {
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+
+	var packs []dialect.Pack
+	if trimmed := bytes.TrimSpace(data); len(trimmed) > 0 && trimmed[0] == '[' {
+		err = json.Unmarshal(data, &packs)
+	} else {
+		var pack dialect.Pack
+		err = json.Unmarshal(data, &pack)
+		packs = []dialect.Pack{pack}
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	for i := range packs {
+		if packs[i].Name == "" {
+			packs[i].Name = strings.TrimSuffix(filepath.Base(file), filepath.Ext(file))
+		}
+	}
+	return packs, nil
+}
@@ -0,0 +1,46 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+
+	"emojiscript-backend/pkg/transpiler"
+)
+
+// formatSources formats the files in place, or stdin to stdout when no
+// file (or '-') is given, naming each file it changed
+func formatSources(paths []string, markup bool) error {
+	if len(paths) == 0 || (len(paths) == 1 && paths[0] == "-") {
+		source, err := io.ReadAll(os.Stdin)
+		if err != nil {
+			return err
+		}
+		fmt.Print(formatSource(string(source), markup))
+		return nil
+	}
+
+	files, err := expandGlobs(paths)
+	if err != nil {
+		return err
+	}
+	for _, file := range files {
+		source, err := os.ReadFile(file)
+		if err != nil {
+			return err
+		}
+		formatted := formatSource(string(source), markup)
+		if formatted == string(source) {
+			continue
+		}
+		if err := os.WriteFile(file, []byte(formatted), 0o644); err != nil {
+			return err
+		}
+		fmt.Fprintf(os.Stderr, "%s: formatted\n", file)
+	}
+	return nil
+}
+
+func formatSource(code string, markup bool) string {
+	return transpiler.Format(code, transpiler.FormatOptions{Layout: true, Markup: markup || looksLikeMarkup(code)})
+}
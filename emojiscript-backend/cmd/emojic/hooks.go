@@ -0,0 +1,263 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"emojiscript-backend/pkg/project"
+)
+
+// hookMarker is in every hook emojic writes, so install can tell its own
+// hooks from ones it mustn't replace
+const hookMarker = "# Written by emojic hooks install."
+
+// hookNames are the Git hooks emojic writes
+var hookNames = []string{"pre-commit", "pre-push"}
+
+// hookChecks are the checks the configuration gives the named hook
+func hookChecks(hooks project.Hooks, name string) []string {
+	if name == "pre-push" {
+		return hooks.PrePush
+	}
+	return hooks.PreCommit
+}
+
+func runHooks(args []string) error {
+	if len(args) > 0 {
+		switch args[0] {
+		case "install":
+			return runHooksInstall(args[1:])
+		case "run":
+			return runHook(args[1:])
+		}
+	}
+	fmt.Fprintln(os.Stderr, "Usage: emojic hooks install [flags] [project]")
+	fmt.Fprintln(os.Stderr, "       emojic hooks run <hook> [project]")
+	os.Exit(2)
+	return nil
+}
+
+// runHooksInstall writes the pre-commit and pre-push hooks of the Git
+// repository the project is in. Each hook runs `emojic hooks run`, which
+// reads the checks from the project's configuration, so changing them
+// doesn't need a reinstall unless a hook gains its first check.
+func runHooksInstall(args []string) error {
+	flags := flag.NewFlagSet("hooks install", flag.ExitOnError)
+	force := flags.Bool("force", false, "replace hooks emojic didn't write")
+	command := flags.String("emojic", "emojic", "the command the hooks run emojic with, e.g. a path to it")
+	flags.Usage = func() {
+		fmt.Fprintln(os.Stderr, "Usage: emojic hooks install [flags] [project]")
+		fmt.Fprintf(os.Stderr, "Writes Git hooks that check the project (default .) with the checks \"hooks\" in its %s sets:\n", project.ConfigFile)
+		fmt.Fprintf(os.Stderr, "%s before a commit and %s before a push by default.\n",
+			strings.Join(project.DefaultHooks.PreCommit, " and "), strings.Join(project.DefaultHooks.PrePush, " and "))
+		flags.PrintDefaults()
+	}
+	flags.Parse(args)
+	dir := "."
+	if flags.NArg() > 0 {
+		dir = flags.Arg(0)
+	}
+	config, found, err := project.Load(dir)
+	if err != nil {
+		return err
+	}
+	if !found {
+		return fmt.Errorf("%s has no %s", dir, project.ConfigFile)
+	}
+
+	top, err := git(dir, "rev-parse", "--show-toplevel")
+	if err != nil {
+		return err
+	}
+	hooksDir, err := git(dir, "rev-parse", "--git-path", "hooks")
+	if err != nil {
+		return err
+	}
+	if !filepath.IsAbs(hooksDir) {
+		hooksDir = filepath.Join(dir, hooksDir)
+	}
+	root, err := filepath.Abs(dir)
+	if err == nil {
+		root, err = filepath.EvalSymlinks(root)
+	}
+	if err != nil {
+		return err
+	}
+	// hooks run at the top of the work tree
+	rel, err := filepath.Rel(top, root)
+	if err != nil {
+		return err
+	}
+
+	ours := map[string]bool{}
+	for _, name := range hookNames {
+		path := filepath.Join(hooksDir, name)
+		existing, err := os.ReadFile(path)
+		if err != nil {
+			continue
+		}
+		ours[name] = strings.Contains(string(existing), hookMarker)
+		if !ours[name] && !*force && len(hookChecks(*config.Hooks, name)) > 0 {
+			return fmt.Errorf("%s already exists and wasn't written by emojic; use -force to replace it", path)
+		}
+	}
+	if err := os.MkdirAll(hooksDir, 0o755); err != nil {
+		return err
+	}
+	for _, name := range hookNames {
+		path := filepath.Join(hooksDir, name)
+		checks := hookChecks(*config.Hooks, name)
+		if len(checks) == 0 {
+			if ours[name] {
+				if err := os.Remove(path); err != nil {
+					return err
+				}
+				fmt.Printf("removed %s\n", path)
+			}
+			continue
+		}
+		script := fmt.Sprintf("#!/bin/sh\n%s The checks it runs are set by \"hooks\"\n# in %s.\nexec %s hooks run %s %s\n",
+			hookMarker, filepath.ToSlash(filepath.Join(rel, project.ConfigFile)), *command, name, shellQuote(filepath.ToSlash(rel)))
+		if err := os.WriteFile(path, []byte(script), 0o755); err != nil {
+			return err
+		}
+		fmt.Printf("installed %s: %s\n", path, strings.Join(checks, ", "))
+	}
+	return nil
+}
+
+// runHook runs the checks the project's configuration gives a hook,
+// reporting every problem before failing
+func runHook(args []string) error {
+	if len(args) == 0 || !slices.Contains(hookNames, args[0]) {
+		return fmt.Errorf("hooks run: name a hook, one of %s", strings.Join(hookNames, ", "))
+	}
+	name, dir := args[0], "."
+	if len(args) > 1 {
+		dir = args[1]
+	}
+	config, found, err := project.Load(dir)
+	if err != nil {
+		return err
+	}
+	if !found {
+		return fmt.Errorf("%s has no %s", dir, project.ConfigFile)
+	}
+	files, err := config.Sources(dir)
+	if err != nil {
+		return err
+	}
+
+	var failed []string
+	for _, check := range hookChecks(*config.Hooks, name) {
+		ok := true
+		switch check {
+		case project.CheckFormat:
+			ok = checkFormat(dir, config, files)
+		case project.CheckLint:
+			ok = checkLint(dir, config, files)
+		case project.CheckBuild:
+			if ok, err = checkBuild(dir, config); err != nil {
+				return err
+			}
+		}
+		if !ok {
+			failed = append(failed, check)
+		}
+	}
+	if len(failed) > 0 {
+		return fmt.Errorf("%s: %s failed", name, strings.Join(failed, ", "))
+	}
+	return nil
+}
+
+// checkFormat names each source that formatting would change
+func checkFormat(dir string, config project.Config, files []string) bool {
+	ok := true
+	for _, file := range files {
+		source, err := os.ReadFile(file)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "%s: error: %v\n", file, err)
+			ok = false
+			continue
+		}
+		if formatSource(string(source), config.IsMarkup(dir, file)) != string(source) {
+			fmt.Printf("%s: not formatted; run emojic build -fmt on it\n", file)
+			ok = false
+		}
+	}
+	return ok
+}
+
+// checkLint reports the problems lint finds in each source
+func checkLint(dir string, config project.Config, files []string) bool {
+	ok := true
+	for _, file := range files {
+		source, err := os.ReadFile(file)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "%s: error: %v\n", file, err)
+			ok = false
+			continue
+		}
+		found := lintSource(string(source), config.IsMarkup(dir, file))
+		printHints(file, found)
+		ok = ok && len(found) == 0
+	}
+	return ok
+}
+
+// checkBuild builds the project, then reports the outputs that differ
+// from the ones in the index or aren't in it. Outputs Git ignores aren't
+// checked, for a project that doesn't commit them.
+func checkBuild(dir string, config project.Config) (bool, error) {
+	target, err := buildTarget(config.Target)
+	if err != nil {
+		return false, err
+	}
+	b := &builder{target: target}
+	if err := b.buildProject(dir, config, false); err != nil {
+		fmt.Fprintf(os.Stderr, "build: %v\n", err)
+		return false, nil
+	}
+	status, err := git(dir, "status", "--porcelain", "--", config.Out)
+	if err != nil {
+		return false, err
+	}
+	ok := true
+	for _, line := range strings.Split(status, "\n") {
+		// the second column is the work tree's change, which the commit
+		// would leave out
+		if len(line) > 3 && line[1] != ' ' {
+			fmt.Printf("%s: out of date; add the rebuilt output to the commit\n", line[3:])
+			ok = false
+		}
+	}
+	return ok, nil
+}
+
+// git runs a git command in dir, returning its output without the final
+// newline
+func git(dir string, args ...string) (string, error) {
+	cmd := exec.Command("git", args...)
+	cmd.Dir = dir
+	out, err := cmd.Output()
+	if err != nil {
+		var exitErr *exec.ExitError
+		if errors.As(err, &exitErr) && len(exitErr.Stderr) > 0 {
+			return "", fmt.Errorf("git %s: %s", args[0], strings.TrimSpace(string(exitErr.Stderr)))
+		}
+		return "", err
+	}
+	return strings.TrimSuffix(string(out), "\n"), nil
+}
+
+// shellQuote quotes s as one word for sh
+func shellQuote(s string) string {
+	return "'" + strings.ReplaceAll(s, "'", `'\''`) + "'"
+}
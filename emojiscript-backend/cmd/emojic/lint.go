@@ -0,0 +1,116 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+
+	"emojiscript-backend/pkg/hints"
+	"emojiscript-backend/pkg/refactor"
+	"emojiscript-backend/pkg/sandbox"
+)
+
+// maxFixPasses bounds how often lint -fix re-checks a file; the parser
+// stops at the first syntax error, so each pass may uncover another
+const maxFixPasses = 20
+
+func runLint(args []string) error {
+	flags := flag.NewFlagSet("lint", flag.ExitOnError)
+	fix := flags.Bool("fix", false, "apply the suggested fixes and rewrite the files")
+	markup := flags.Bool("markup", false, "treat the files as markup syntax")
+	flags.Usage = func() {
+		fmt.Fprintln(os.Stderr, "Usage: emojic lint [flags] <file>...")
+		fmt.Fprintln(os.Stderr, "Reports errors in source files, with a hint and a fix where one is known.")
+		flags.PrintDefaults()
+	}
+	flags.Parse(args)
+	if flags.NArg() == 0 {
+		flags.Usage()
+		os.Exit(2)
+	}
+
+	failed := 0
+	for _, path := range flags.Args() {
+		source, err := os.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		code := string(source)
+
+		found := lintSource(code, *markup)
+		if *fix {
+			fixed := 0
+			for pass := 0; pass < maxFixPasses; pass++ {
+				var edits []refactor.Edit
+				for _, hint := range found {
+					if hint.Fix != nil {
+						edits = append(edits, hint.Fix.Edits...)
+						fixed++
+						// later fixes may overlap this one; they are
+						// found again on the next pass
+						break
+					}
+				}
+				if len(edits) == 0 {
+					break
+				}
+				code = refactor.Apply(code, edits)
+				found = lintSource(code, *markup)
+			}
+			if fixed > 0 {
+				if err := os.WriteFile(path, []byte(code), 0o644); err != nil {
+					return err
+				}
+				fmt.Fprintf(os.Stderr, "%s: applied %d fix(es)\n", path, fixed)
+			}
+		}
+
+		printHints(path, found)
+		failed += len(found)
+	}
+	if failed > 0 {
+		return fmt.Errorf("%d problem(s) found", failed)
+	}
+	return nil
+}
+
+// printHints reports the problems lintSource found in the file at path
+func printHints(path string, found []hints.Hint) {
+	for _, hint := range found {
+		if hint.Line > 0 {
+			fmt.Printf("%s:%d:%d: %s\n", path, hint.Line, hint.Column, hint.Diagnostic)
+		} else {
+			fmt.Printf("%s: %s\n", path, hint.Diagnostic)
+		}
+		if hint.Message != "" {
+			fmt.Printf("  hint: %s\n", hint.Message)
+		}
+		if hint.Fix != nil {
+			fmt.Printf("  fix: %s (run with -fix to apply)\n", hint.Fix.Title)
+		}
+	}
+}
+
+// lintSource returns a hint for each diagnostic in code, whether or not a
+// rule recognizes it
+func lintSource(code string, markup bool) []hints.Hint {
+	output, errors, _ := transpileSource(code, "javascript", markup)
+	if len(errors) == 0 {
+		if err := sandbox.Check(output); err != nil {
+			errors = []string{err.Error()}
+		}
+	}
+
+	found := hints.For(errors, code)
+	known := map[string]bool{}
+	for _, hint := range found {
+		known[hint.Diagnostic] = true
+	}
+	for _, diagnostic := range errors {
+		if !known[diagnostic] {
+			known[diagnostic] = true
+			found = append(found, hints.Hint{Diagnostic: diagnostic})
+		}
+	}
+	return found
+}
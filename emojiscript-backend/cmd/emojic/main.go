@@ -0,0 +1,111 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"strings"
+
+	"emojiscript-backend/pkg/codegen"
+	"emojiscript-backend/pkg/transpiler"
+)
+
+const usage = `emojic - EmojiScript command line tool
+
+Usage:
+  emojic build [flags] [file|glob]...      transpile files, or stdin, to JavaScript, TypeScript, Python, Rust or GDScript
+  emojic build [flags] <project>           build a project with an emoji.config.json
+  emojic build -fmt [file|glob]...         format source files in place, or stdin to stdout
+  emojic serve [flags] <file>              serve a live-reloading page for a source file
+  emojic check-dialect [flags] <pack>...   check dialect packs for ambiguous mappings
+  emojic ast [flags] <file>                print the syntax tree as JSON, DOT or Mermaid
+  emojic lint [flags] <file>...            report errors in source files and fix what can be fixed
+  emojic bench [flags]                     benchmark emoji substitution
+  emojic precedence [flags]                print the operator precedence table, or check it
+  emojic spec [flags]                      run the conformance suite against this or another transpiler
+  emojic hooks install [flags] [project]   write Git hooks that check and build the project
+
+Run 'emojic <command> -h' for command flags.
+`
+
+func main() {
+	if len(os.Args) < 2 {
+		fmt.Fprint(os.Stderr, usage)
+		os.Exit(2)
+	}
+
+	var err error
+	switch os.Args[1] {
+	case "build":
+		err = runBuild(os.Args[2:])
+	case "serve":
+		err = runServe(os.Args[2:])
+	case "check-dialect":
+		err = runCheckDialect(os.Args[2:])
+	case "ast":
+		err = runAST(os.Args[2:])
+	case "lint":
+		err = runLint(os.Args[2:])
+	case "bench":
+		err = runBench(os.Args[2:])
+	case "precedence":
+		err = runPrecedence(os.Args[2:])
+	case "spec":
+		err = runSpec(os.Args[2:])
+	case "hooks":
+		err = runHooks(os.Args[2:])
+	case "-h", "--help", "help":
+		fmt.Print(usage)
+		return
+	default:
+		fmt.Fprintf(os.Stderr, "emojic: unknown command %q\n\n%s", os.Args[1], usage)
+		os.Exit(2)
+	}
+
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "emojic: %v\n", err)
+		os.Exit(1)
+	}
+}
+
+// transpileSource runs a source file through the markup or emoji
+// transpiler, returning the output with any diagnostics. Targets codegen
+// generates are transpiled to JavaScript and generated from that.
+func transpileSource(code, targetLang string, markup bool) (string, []string, []string) {
+	lang := targetLang
+	if codegen.Generates(targetLang) {
+		lang = "javascript"
+	}
+	var output string
+	var errors, warnings []string
+	if markup || looksLikeMarkup(code) {
+		parser := transpiler.NewMarkupParser(code, lang)
+		var err error
+		output, err = parser.Parse()
+		errors, warnings = parser.GetErrors(), parser.GetWarnings()
+		if err != nil && len(errors) == 0 {
+			errors = []string{err.Error()}
+		}
+	} else {
+		output = transpiler.TranspileEmoji(code, lang)
+	}
+	output = transpiler.AddStdlib(output, lang)
+	if lang == targetLang || len(errors) > 0 {
+		return output, errors, warnings
+	}
+	generated, generatedWarnings, err := codegen.Generate(targetLang, output)
+	if err != nil {
+		return "", []string{err.Error()}, warnings
+	}
+	return generated, nil, append(warnings, generatedWarnings...)
+}
+
+func looksLikeMarkup(code string) bool {
+	tags := []string{"<print", "<var", "<let", "<const", "<function", "<loop", "<if", "<class", "<record"}
+	lower := strings.ToLower(code)
+	for _, tag := range tags {
+		if strings.Contains(lower, tag) {
+			return true
+		}
+	}
+	return false
+}
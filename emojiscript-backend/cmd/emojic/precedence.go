@@ -0,0 +1,101 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"math/rand"
+	"os"
+	"strconv"
+	"strings"
+
+	"emojiscript-backend/pkg/sandbox"
+	"emojiscript-backend/pkg/transpiler"
+)
+
+func runPrecedence(args []string) error {
+	flags := flag.NewFlagSet("precedence", flag.ExitOnError)
+	check := flags.Int("check", 0, "check this many random expressions")
+	seed := flags.Int64("seed", 1, "seed for the random expressions")
+	flags.Usage = func() {
+		fmt.Fprintln(os.Stderr, "Usage: emojic precedence [flags]")
+		fmt.Fprintln(os.Stderr, "Prints the emoji operator precedence table. With -check, generates random expressions over")
+		fmt.Fprintln(os.Stderr, "the operators and checks that the JavaScript each transpiles to groups the same way and,")
+		fmt.Fprintln(os.Stderr, "run in the sandbox, evaluates to the same value as the expression fully parenthesized.")
+		flags.PrintDefaults()
+	}
+	flags.Parse(args)
+
+	operators := transpiler.BuildGrammar().Operators
+	if *check <= 0 {
+		for _, operator := range operators {
+			kind := operator.Associativity + "-associative"
+			if operator.Unary {
+				kind = "unary"
+			}
+			fmt.Printf("%2d  %s\t%s\t%s\n", operator.Precedence, operator.Emoji, operator.Keyword, kind)
+		}
+		return nil
+	}
+
+	// the operators that combine numbers and booleans; assignments,
+	// arrows and 'in' need operands of their own kind
+	var binary, prefix []string
+	for _, operator := range operators {
+		switch {
+		case operator.Keyword == "!" || operator.Keyword == "-":
+			prefix = append(prefix, operator.Emoji)
+		}
+		if !operator.Unary && operator.Precedence > 2 && operator.Keyword != "in" {
+			binary = append(binary, operator.Emoji)
+		}
+	}
+
+	rng := rand.New(rand.NewSource(*seed))
+	var generate func(depth int) string
+	generate = func(depth int) string {
+		switch n := rng.Intn(10); {
+		case depth == 0 || n < 3:
+			return strconv.Itoa(rng.Intn(9) + 1)
+		case n == 3:
+			// spaced, so two minuses don't make ➖➖, a decrement
+			return prefix[rng.Intn(len(prefix))] + " " + generate(depth-1)
+		case n == 4:
+			return "(" + generate(depth-1) + ")"
+		}
+		return generate(depth-1) + " " + binary[rng.Intn(len(binary))] + " " + generate(depth-1)
+	}
+
+	checked, failed := 0, 0
+	for i := 0; i < *check; i++ {
+		code := generate(4)
+		intended, err := transpiler.ParseExpression(code)
+		if err != nil {
+			// such as a unary operand of **, which JavaScript rejects too
+			continue
+		}
+		checked++
+		problem := ""
+		if err := transpiler.CheckPrecedence(code); err != nil {
+			problem = err.Error()
+		} else {
+			output := transpiler.TranspileEmoji(code, "javascript")
+			result := sandbox.Run(fmt.Sprintf("console.log(String(%s))\nconsole.log(String(%s))", output, intended), sandbox.Options{})
+			switch {
+			case result.Error != "":
+				problem = fmt.Sprintf("%s: %s", code, result.Error)
+			case len(result.Stdout) != 2 || result.Stdout[0] != result.Stdout[1]:
+				problem = fmt.Sprintf("%s: %s evaluates to %s, %s to %s", code, output, strings.Join(result.Stdout[:min(1, len(result.Stdout))], ""), intended, strings.Join(result.Stdout[min(1, len(result.Stdout)):], ""))
+			}
+		}
+		if problem != "" {
+			failed++
+			fmt.Println(problem)
+		}
+	}
+
+	if failed > 0 {
+		return fmt.Errorf("%d of %d expression(s) grouped or evaluated differently", failed, checked)
+	}
+	fmt.Printf("✅ %d expression(s) group and evaluate as the precedence table says\n", checked)
+	return nil
+}
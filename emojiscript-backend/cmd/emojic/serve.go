@@ -0,0 +1,257 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"html/template"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"emojiscript-backend/pkg/transpiler"
+	"emojiscript-backend/pkg/websocket"
+)
+
+// WatchInterval is how often the served file is checked for changes
+const WatchInterval = 300 * time.Millisecond
+
+// buildResult is the latest transpile of the watched file, pushed to every
+// connected browser
+type buildResult struct {
+	Version  int      `json:"version"`
+	File     string   `json:"file"`
+	Output   string   `json:"output"`
+	Errors   []string `json:"errors,omitempty"`
+	Warnings []string `json:"warnings,omitempty"`
+}
+
+type devServer struct {
+	file   string
+	target string
+	markup bool
+
+	mu      sync.Mutex
+	build   buildResult
+	clients map[*websocket.Conn]bool
+}
+
+func runServe(args []string) error {
+	flags := flag.NewFlagSet("serve", flag.ExitOnError)
+	addr := flags.String("addr", "localhost:8787", "address to listen on")
+	target := flags.String("target", "javascript", "target language")
+	markup := flags.Bool("markup", false, "treat the file as markup syntax")
+	flags.Usage = func() {
+		fmt.Fprintln(os.Stderr, "Usage: emojic serve [flags] <file>")
+		flags.PrintDefaults()
+	}
+	flags.Parse(args)
+	if flags.NArg() != 1 {
+		flags.Usage()
+		os.Exit(2)
+	}
+	if resolved, ok := transpiler.ResolveTarget(*target); ok {
+		*target = resolved
+	}
+
+	s := &devServer{
+		file:    flags.Arg(0),
+		target:  *target,
+		markup:  *markup,
+		clients: make(map[*websocket.Conn]bool),
+	}
+	if err := s.rebuild(); err != nil {
+		return err
+	}
+	go s.watch()
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/", s.handlePage)
+	mux.HandleFunc("/bundle.js", s.handleBundle)
+	mux.HandleFunc("/ws", s.handleSocket)
+
+	log.Printf("🚀 Serving %s on http://%s\n", s.file, *addr)
+	return http.ListenAndServe(*addr, mux)
+}
+
+// rebuild re-transpiles the watched file and pushes the result to clients
+func (s *devServer) rebuild() error {
+	source, err := os.ReadFile(s.file)
+	if err != nil {
+		return err
+	}
+	output, errors, warnings := transpileSource(string(source), s.target, s.markup)
+
+	s.mu.Lock()
+	s.build = buildResult{
+		Version:  s.build.Version + 1,
+		File:     filepath.Base(s.file),
+		Output:   output,
+		Errors:   errors,
+		Warnings: warnings,
+	}
+	message, _ := json.Marshal(s.build)
+	clients := make([]*websocket.Conn, 0, len(s.clients))
+	for client := range s.clients {
+		clients = append(clients, client)
+	}
+	s.mu.Unlock()
+
+	for _, client := range clients {
+		if err := client.WriteText(string(message)); err != nil {
+			s.drop(client)
+		}
+	}
+	return nil
+}
+
+// watch polls the file's modification time and size, rebuilding on change
+func (s *devServer) watch() {
+	var lastMod time.Time
+	var lastSize int64 = -1
+	for range time.Tick(WatchInterval) {
+		info, err := os.Stat(s.file)
+		if err != nil {
+			continue
+		}
+		if info.ModTime().Equal(lastMod) && info.Size() == lastSize {
+			continue
+		}
+		first := lastSize < 0
+		lastMod, lastSize = info.ModTime(), info.Size()
+		if first {
+			continue
+		}
+		if err := s.rebuild(); err != nil {
+			log.Printf("rebuild failed: %v\n", err)
+			continue
+		}
+		log.Printf("♻️  Rebuilt %s\n", s.file)
+	}
+}
+
+func (s *devServer) current() buildResult {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.build
+}
+
+func (s *devServer) drop(client *websocket.Conn) {
+	s.mu.Lock()
+	delete(s.clients, client)
+	s.mu.Unlock()
+	client.Close()
+}
+
+func (s *devServer) handlePage(w http.ResponseWriter, r *http.Request) {
+	if r.URL.Path != "/" {
+		http.NotFound(w, r)
+		return
+	}
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	devPage.Execute(w, s.current())
+}
+
+func (s *devServer) handleBundle(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/javascript; charset=utf-8")
+	w.Header().Set("Cache-Control", "no-store")
+	w.Write([]byte(s.current().Output))
+}
+
+func (s *devServer) handleSocket(w http.ResponseWriter, r *http.Request) {
+	client, err := websocket.Upgrade(w, r)
+	if err != nil {
+		return
+	}
+
+	s.mu.Lock()
+	s.clients[client] = true
+	message, _ := json.Marshal(s.build)
+	s.mu.Unlock()
+
+	if err := client.WriteText(string(message)); err != nil {
+		s.drop(client)
+		return
+	}
+	// Browsers only send pings and close frames; read until the peer leaves
+	for {
+		if _, err := client.ReadMessage(); err != nil {
+			s.drop(client)
+			return
+		}
+	}
+}
+
+var devPage = template.Must(template.New("dev").Parse(`<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>{{.File}} · emojic serve</title>
+<style>
+  body { font-family: system-ui, sans-serif; margin: 0; display: grid; grid-template-columns: 1fr 1fr; height: 100vh; }
+  section { overflow: auto; padding: 1rem; border-right: 1px solid #ddd; }
+  pre { font-family: ui-monospace, monospace; font-size: 13px; white-space: pre-wrap; }
+  .error { color: #b00020; }
+  #status { font-size: 12px; color: #666; }
+</style>
+</head>
+<body>
+<section>
+  <h3>{{.File}} <span id="status">connecting…</span></h3>
+  <pre id="diagnostics" class="error"></pre>
+  <pre id="output"></pre>
+</section>
+<section>
+  <h3>Console</h3>
+  <pre id="console"></pre>
+</section>
+<script>
+  const $ = (id) => document.getElementById(id);
+  let frame;
+
+  window.addEventListener("message", (event) => {
+    if (event.source !== (frame && frame.contentWindow)) return;
+    const line = document.createElement("div");
+    line.textContent = event.data.text;
+    if (event.data.level === "error") line.className = "error";
+    $("console").appendChild(line);
+  });
+
+  function run(build) {
+    $("status").textContent = "build #" + build.version;
+    $("output").textContent = build.output;
+    $("diagnostics").textContent = (build.errors || []).concat(build.warnings || []).join("\n");
+    $("console").textContent = "";
+    if (frame) frame.remove();
+    if (build.errors && build.errors.length) return;
+
+    // Each build runs in a fresh sandboxed frame so state doesn't leak
+    frame = document.createElement("iframe");
+    frame.sandbox = "allow-scripts";
+    frame.style.display = "none";
+    const bridge = "<script>" +
+      "const send = (level) => (...args) => parent.postMessage({ level, text: args.map(String).join(' ') }, '*');" +
+      "console.log = send('log'); console.error = send('error');" +
+      "window.onerror = (message) => send('error')(message);" +
+      "<\/script>";
+    const code = build.output.replace(/<\/script/gi, "<\\/script");
+    frame.srcdoc = bridge + "<script type=\"module\">" + code + "<\/script>";
+    document.body.appendChild(frame);
+  }
+
+  function connect() {
+    const socket = new WebSocket((location.protocol === "https:" ? "wss://" : "ws://") + location.host + "/ws");
+    socket.onmessage = (event) => run(JSON.parse(event.data));
+    socket.onclose = () => {
+      $("status").textContent = "disconnected, retrying…";
+      setTimeout(connect, 1000);
+    };
+  }
+  connect();
+</script>
+</body>
+</html>
+`))
@@ -0,0 +1,78 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+
+	"emojiscript-backend/pkg/spec"
+	"emojiscript-backend/pkg/transpiler"
+)
+
+func runSpec(args []string) error {
+	flags := flag.NewFlagSet("spec", flag.ExitOnError)
+	command := flags.String("exec", "", "run this command as the implementation under test, once per case (see spec.Command)")
+	targets := flags.String("target", "", "comma-separated target languages to run the cases of (default all)")
+	asJSON := flags.Bool("json", false, "print the report as JSON")
+	verbose := flags.Bool("v", false, "list every case, not just the failures")
+	flags.Usage = func() {
+		fmt.Fprintln(os.Stderr, "Usage: emojic spec [flags]")
+		fmt.Fprintln(os.Stderr, "Runs the conformance suite against this transpiler or, with -exec, another implementation.")
+		fmt.Fprintln(os.Stderr, "The command reads a case as JSON on stdin, {\"input\", \"syntax\", \"targetLanguage\"}, writes the")
+		fmt.Fprintln(os.Stderr, "output to stdout, and exits non-zero to reject the program.")
+		flags.PrintDefaults()
+	}
+	flags.Parse(args)
+
+	impl := spec.Implementation(spec.Func(referenceTranspile))
+	if *command != "" {
+		fields := strings.Fields(*command)
+		impl = spec.Command(fields[0], fields[1:]...)
+	}
+	var only []string
+	if *targets != "" {
+		only = strings.Split(*targets, ",")
+	}
+	report := spec.Run(impl, only...)
+
+	if *asJSON {
+		out, err := json.MarshalIndent(report, "", "  ")
+		if err != nil {
+			return err
+		}
+		fmt.Println(string(out))
+	} else {
+		for _, result := range report.Results {
+			if *verbose || result.Status == spec.Fail {
+				fmt.Printf("%-10s %s (%s)", strings.ToUpper(result.Status), result.Case, result.Feature)
+				if result.Message != "" {
+					fmt.Printf(": %s", result.Message)
+				}
+				fmt.Println()
+			}
+		}
+		fmt.Printf("spec: %d passed, %d equivalent, %d failed, %d skipped (%d%%)\n",
+			report.Counts[spec.Pass], report.Counts[spec.Equivalent], report.Counts[spec.Fail], report.Counts[spec.Skip], int(report.Score*100))
+	}
+	if !report.Passed {
+		return fmt.Errorf("%d conformance case(s) failed", report.Counts[spec.Fail])
+	}
+	return nil
+}
+
+// referenceTranspile is this transpiler as a spec implementation,
+// rejecting programs with syntax errors
+func referenceTranspile(input, syntax, targetLanguage string) (string, error) {
+	t := transpiler.New(transpiler.Options{TargetLanguage: targetLanguage})
+	if syntax == "markup" {
+		result, err := t.TranspileMarkup(input, transpiler.MarkupOptions{})
+		return result.Output, err
+	}
+	output, errors, _ := t.CompileEmoji(input, nil)
+	if len(errors) > 0 {
+		return "", fmt.Errorf("%s", strings.Join(errors, "; "))
+	}
+	return output, nil
+}
@@ -0,0 +1,117 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+	"strings"
+	"time"
+
+	"emojiscript-backend/pkg/apikey"
+	"emojiscript-backend/pkg/usage"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/gofiber/fiber/v2/middleware/limiter"
+)
+
+// checkAPIKey answers 401 for a request sent with an unknown API key and
+// 429 once a key's daily quota is used up. It mirrors
+// apikey.Store.Middleware for the Fiber app; requests unmetered returns
+// true for aren't counted. With an emitter, each request sent with a key
+// is metered like the shared handler meters its own (see
+// emojiscriptapi.Options.Usage).
+func checkAPIKey(keys *apikey.Store, unmetered func(*fiber.Ctx) bool, emitter *usage.Emitter) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		if unmetered(c) {
+			return c.Next()
+		}
+		header := http.Header{}
+		key, ok, err := keys.Check(header, c.Get(apikey.Header))
+		for key, values := range header {
+			for _, value := range values {
+				c.Response().Header.Add(key, value)
+			}
+		}
+		if err != nil {
+			return c.Status(apikey.Status(err)).JSON(apikey.Rejection(header, err))
+		}
+		if ok && emitter != nil {
+			return meterUsage(c, key, emitter)
+		}
+		return c.Next()
+	}
+}
+
+// meterUsage serves a request sent with key, counting what it uses and
+// emitting it as a usage event. The Meter is kept as a request value
+// under usage.ContextKey, which the shared handler's requests see in
+// their context.
+func meterUsage(c *fiber.Ctx, key apikey.Key, emitter *usage.Emitter) error {
+	meter := &usage.Meter{}
+	c.Locals(usage.ContextKey, meter)
+	err := c.Next()
+
+	status := c.Response().StatusCode()
+	var fiberErr *fiber.Error
+	switch {
+	case errors.As(err, &fiberErr):
+		status = fiberErr.Code
+	case err != nil:
+		status = fiber.StatusInternalServerError
+	}
+	requestID, _ := c.Locals("requestid").(string)
+	// the event is emitted after the request, whose buffers fasthttp
+	// reuses, so the method is copied
+	event := usage.Event{
+		Time:          time.Now().UTC(),
+		RequestID:     requestID,
+		Key:           key.Name,
+		Tier:          key.Tier.Name,
+		Method:        strings.Clone(c.Method()),
+		Endpoint:      routeLabel(c.Route().Path),
+		Status:        status,
+		RequestBytes:  int64(len(c.Body())),
+		ResponseBytes: int64(len(c.Response().Body())),
+	}
+	meter.Fill(&event)
+	emitter.Emit(event)
+	return err
+}
+
+// rateLimits limits each client a minute at its tier's rate: clients
+// with an API key per key, and anonymous ones per address. A limiter's
+// Max is fixed, so there is one per tier, each skipping the requests of
+// the others.
+func rateLimits(keys *apikey.Store, unmetered func(*fiber.Ctx) bool) []fiber.Handler {
+	tierOf := func(c *fiber.Ctx) (apikey.Key, apikey.Tier) {
+		if key, ok := keys.Match(c.Get(apikey.Header)); ok {
+			return key, key.Tier
+		}
+		return apikey.Key{}, apikey.Anonymous
+	}
+
+	var handlers []fiber.Handler
+	for _, tier := range append([]apikey.Tier{apikey.Anonymous}, apikey.Tiers...) {
+		handlers = append(handlers, limiter.New(limiter.Config{
+			Max:                    tier.PerMinute,
+			Expiration:             time.Minute,
+			SkipFailedRequests:     true,
+			SkipSuccessfulRequests: false,
+			KeyGenerator: func(c *fiber.Ctx) string {
+				if key, _ := tierOf(c); key.Name != "" {
+					return "key:" + key.Name
+				}
+				return c.IP()
+			},
+			LimitReached: func(c *fiber.Ctx) error {
+				return c.Status(fiber.StatusTooManyRequests).JSON(fiber.Map{
+					"error": "Rate limit exceeded. Please try again later.",
+				})
+			},
+			Next: func(c *fiber.Ctx) bool {
+				_, requestTier := tierOf(c)
+				return unmetered(c) || requestTier.Name != tier.Name
+			},
+		}))
+	}
+	return handlers
+}
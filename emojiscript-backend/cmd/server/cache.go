@@ -0,0 +1,40 @@
+package main
+
+import (
+	"log"
+	"os"
+
+	"emojiscript-backend/pkg/kvcache"
+	"emojiscript-backend/pkg/storage"
+)
+
+// remoteCache connects to Vercel KV, Upstash or Redis when their
+// environment variables are set (see kvcache.FromEnv), so the server and
+// the serverless functions can share cached results; without them the
+// cache is in memory only
+func remoteCache() kvcache.Store {
+	store, err := kvcache.FromEnv(os.Getenv)
+	if err != nil {
+		log.Printf("remote cache: %v; using the in-memory cache", err)
+		return nil
+	}
+	if store != nil {
+		log.Printf("remote cache: %s", store.Name())
+	}
+	return store
+}
+
+// openStorage opens the store STORAGE_URL names (see storage.Open), where
+// snippets, job results and imported API keys are kept; without it they
+// live in memory and any remote cache. A store that can't be opened stops
+// the server, as it would otherwise lose what it's asked to keep.
+func openStorage() storage.Store {
+	store, err := storage.FromEnv(os.Getenv)
+	if err != nil {
+		log.Fatal(err)
+	}
+	if store != nil {
+		log.Printf("storage: %s", store.Driver())
+	}
+	return store
+}
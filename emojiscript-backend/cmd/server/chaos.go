@@ -0,0 +1,21 @@
+package main
+
+import (
+	"time"
+
+	"emojiscript-backend/pkg/chaos"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// delayed holds up requests at the injector's latency rate. It mirrors
+// chaos.Injector.Middleware for the Fiber app.
+func delayed(injector *chaos.Injector) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		if delay := injector.Delay(); delay > 0 {
+			c.Append(chaos.Header, "latency="+delay.Round(time.Millisecond).String())
+			time.Sleep(delay)
+		}
+		return c.Next()
+	}
+}
@@ -0,0 +1,25 @@
+package main
+
+import (
+	"strings"
+
+	"emojiscript-backend/pkg/collab"
+	"emojiscript-backend/pkg/cors"
+	"emojiscript-backend/pkg/websocket"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// collabRelay upgrades to a room of the collaboration relay
+func collabRelay(relay *collab.Relay, policy *cors.Policy) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		// the name outlives the request, whose buffers fasthttp reuses
+		room := strings.Clone(c.Params("room"))
+		if !collab.ValidRoom(room) {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Invalid room name"})
+		}
+		return upgrade(c, policy, func(conn *websocket.Conn) {
+			relay.ServeConn(room, conn)
+		})
+	}
+}
@@ -0,0 +1,53 @@
+package main
+
+import (
+	"net"
+	"net/http"
+	"time"
+
+	"emojiscript-backend/pkg/cors"
+	"emojiscript-backend/pkg/live"
+	"emojiscript-backend/pkg/websocket"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// liveTranspile upgrades to the playground's live-transpile channel
+func liveTranspile(server *live.Server, policy *cors.Policy) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		return upgrade(c, policy, server.ServeConn)
+	}
+}
+
+// upgrade answers a WebSocket upgrade and hands the connection to serve.
+// fasthttp can't hand a connection to net/http, so the handshake is
+// answered here and the connection taken over once the 101 is written.
+// Browsers don't apply CORS to WebSockets, so the origin is checked
+// against the policy here instead.
+func upgrade(c *fiber.Ctx, policy *cors.Policy, serve func(*websocket.Conn)) error {
+	if origin := c.Get(fiber.HeaderOrigin); origin != "" {
+		if allowed, _ := policy.Allowed(origin); !allowed {
+			return c.Status(fiber.StatusForbidden).JSON(fiber.Map{"error": "origin not allowed"})
+		}
+	}
+	header := http.Header{}
+	for _, name := range []string{"Connection", "Upgrade", "Sec-WebSocket-Key", "Sec-WebSocket-Version"} {
+		header.Set(name, c.Get(name))
+	}
+	accept, err := websocket.Handshake(header)
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Expected WebSocket upgrade"})
+	}
+
+	c.Set(fiber.HeaderUpgrade, "websocket")
+	c.Set(fiber.HeaderConnection, "Upgrade")
+	c.Set("Sec-WebSocket-Accept", accept)
+	c.Status(fiber.StatusSwitchingProtocols)
+	c.Context().Hijack(func(conn net.Conn) {
+		// drop the read and write timeouts fasthttp set for the
+		// upgrade request; the session has its own idle timeout
+		conn.SetDeadline(time.Time{})
+		serve(websocket.NewConn(conn, nil))
+	})
+	return nil
+}
@@ -1,164 +1,53 @@
 package main
 
 import (
-	"crypto/sha256"
+	"emojiscript-backend/pkg/apikey"
+	"emojiscript-backend/pkg/canary"
+	"emojiscript-backend/pkg/chaos"
+	"emojiscript-backend/pkg/collab"
+	"emojiscript-backend/pkg/cors"
+	"emojiscript-backend/pkg/coverage"
+	"emojiscript-backend/pkg/dialect"
+	"emojiscript-backend/pkg/emojiscriptapi"
+	"emojiscript-backend/pkg/leaderboard"
+	"emojiscript-backend/pkg/live"
+	"emojiscript-backend/pkg/metrics"
+	"emojiscript-backend/pkg/requestid"
+	"emojiscript-backend/pkg/scan"
+	"emojiscript-backend/pkg/service"
+	"emojiscript-backend/pkg/servicetoken"
+	"emojiscript-backend/pkg/source"
 	"emojiscript-backend/pkg/transpiler"
-	"encoding/hex"
-	"fmt"
+	"emojiscript-backend/pkg/usage"
+	"emojiscript-backend/pkg/workpool"
 	"log"
+	"net/http"
 	"os"
-	"strings"
-	"sync"
+	"strconv"
 	"time"
 
 	"github.com/gofiber/fiber/v2"
-	"github.com/gofiber/fiber/v2/middleware/cors"
+	"github.com/gofiber/fiber/v2/middleware/adaptor"
 	"github.com/gofiber/fiber/v2/middleware/helmet"
-	"github.com/gofiber/fiber/v2/middleware/limiter"
 	"github.com/gofiber/fiber/v2/middleware/logger"
 	"github.com/gofiber/fiber/v2/middleware/recover"
 	"github.com/joho/godotenv"
 )
 
-const (
-	MaxCodeLength = 100000
-	MaxCacheSize  = 1000
-	CacheTTL      = time.Hour
-)
-
-type TranspileCache struct {
-	mu    sync.RWMutex
-	cache map[string]*CacheEntry
-}
-
-type CacheEntry struct {
-	result    *TranspileResponse
-	timestamp time.Time
-}
-
-var cache = &TranspileCache{cache: make(map[string]*CacheEntry)}
-
-func (tc *TranspileCache) Get(key string) (*TranspileResponse, bool) {
-	tc.mu.RLock()
-	defer tc.mu.RUnlock()
-
-	if entry, exists := tc.cache[key]; exists && time.Since(entry.timestamp) < CacheTTL {
-		return entry.result, true
-	}
-	return nil, false
-}
-
-func (tc *TranspileCache) Set(key string, result *TranspileResponse) {
-	tc.mu.Lock()
-	defer tc.mu.Unlock()
-
-	if len(tc.cache) >= MaxCacheSize {
-		var oldestKey string
-		var oldestTime time.Time
-		for k, v := range tc.cache {
-			if oldestKey == "" || v.timestamp.Before(oldestTime) {
-				oldestKey, oldestTime = k, v.timestamp
-			}
-		}
-		delete(tc.cache, oldestKey)
-	}
-
-	tc.cache[key] = &CacheEntry{result: result, timestamp: time.Now()}
-}
-
-type TranspileRequest struct {
-	Code           string `json:"code"`
-	TargetLanguage string `json:"targetLanguage,omitempty"`
-	UseMarkup      bool   `json:"useMarkup,omitempty"`
-}
-
-type TranspileResponse struct {
-	Success        bool                   `json:"success"`
-	JavaScript     string                 `json:"javascript,omitempty"`
-	TypeScript     string                 `json:"typescript,omitempty"`
-	Python         string                 `json:"python,omitempty"`
-	Rust           string                 `json:"rust,omitempty"`
-	GDScript       string                 `json:"gdscript,omitempty"`
-	TargetLanguage string                 `json:"targetLanguage"`
-	Output         string                 `json:"output"`
-	Errors         []string               `json:"errors,omitempty"`
-	Warnings       []string               `json:"warnings,omitempty"`
-	Metadata       map[string]interface{} `json:"metadata,omitempty"`
-	UsedMarkup     bool                   `json:"usedMarkup,omitempty"`
-}
-
-type ValidateResponse struct {
-	Valid  bool     `json:"valid"`
-	Errors []string `json:"errors,omitempty"`
-}
-
 type HealthResponse struct {
 	Status  string `json:"status"`
 	Version string `json:"version"`
 }
 
-func validateInput(code string) error {
-	if len(code) == 0 {
-		return fmt.Errorf("code cannot be empty")
-	}
-	if len(code) > MaxCodeLength {
-		return fmt.Errorf("code exceeds maximum length")
-	}
-
-	dangerousPatterns := []string{"eval(", "exec(", "__import__", "subprocess", "os.system"}
-	lower := strings.ToLower(code)
-	for _, pattern := range dangerousPatterns {
-		if strings.Contains(lower, pattern) {
-			return fmt.Errorf("unsafe pattern detected")
-		}
-	}
-	return nil
-}
-
-func generateCacheKey(code, lang string, markup bool) string {
-	hash := sha256.Sum256([]byte(fmt.Sprintf("%s:%s:%t", code, lang, markup)))
-	return hex.EncodeToString(hash[:])
-}
-
-func detectMarkupSyntax(code string) bool {
-	tags := []string{"<print", "<var", "<let", "<const", "<function", "<loop", "<if", "<class"}
-	lower := strings.ToLower(code)
-	for _, tag := range tags {
-		if strings.Contains(lower, tag) {
-			return true
-		}
-	}
-	return false
-}
-
-func transpileWithMarkup(code, targetLang string) (string, []string, []string, error) {
-	parser := transpiler.NewMarkupParser(code, targetLang)
-	output, err := parser.Parse()
-	return output, parser.GetErrors(), parser.GetWarnings(), err
-}
-
-func transpileToLanguage(code, targetLang string) (string, error) {
-	emojiMap := map[string]string{
-		"📦": "const", "🔢": "let", "🎯": "function", "➡️": "=>", "🔁": "for", "❓": "if",
-		"❌": "else", "✅": "true", "⛔": "false", "🔙": "return", "📝": "console.log",
-		"➕": "+", "➖": "-", "✖️": "*", "➗": "/", "🟰": "===", "❗": "!==",
-		"⬆️": ">", "⬇️": "<", "📈": ">=", "📉": "<=", "🔗": "&&", "🔀": "||",
-		"🚫": "!", "📥": "import", "📤": "export", "🔄": "while", "⚡": "async",
-		"⏳": "await", "🎁": "new", "🗑️": "delete", "📊": "typeof", "🔍": "in",
-		"🎪": "switch", "🔘": "case", "🏁": "break", "⏭️": "continue", "💥": "throw",
-		"🛡️": "try", "🚨": "catch", "🏆": "finally", "🔐": "class", "🎨": "extends",
-		"🌟": "static", "🔧": "constructor", "🎭": "this", "📍": "null", "❔": "undefined",
+func main() {
+	// `server selfcheck` checks the examples instead of serving
+	if len(os.Args) > 1 && os.Args[1] == "selfcheck" {
+		os.Exit(selfCheck())
 	}
-
-	result := code
-	for emoji, keyword := range emojiMap {
-		result = strings.ReplaceAll(result, emoji, keyword)
+	// `server --selftest` runs the golden corpus through every backend
+	if len(os.Args) > 1 && os.Args[1] == "--selftest" {
+		os.Exit(selfTest())
 	}
-
-	return result, nil
-}
-
-func main() {
 	godotenv.Load()
 
 	port := os.Getenv("PORT")
@@ -177,219 +66,296 @@ func main() {
 			if e, ok := err.(*fiber.Error); ok {
 				code = e.Code
 			}
-			return c.Status(code).JSON(fiber.Map{"error": err.Error()})
+			if err := c.Status(code).JSON(fiber.Map{"error": err.Error()}); err != nil {
+				return err
+			}
+			// a route's error gets here after observed is done with the
+			// response, so the traceId is added here
+			if id, ok := c.Locals("requestid").(string); ok {
+				c.Response().SetBody(requestid.AddTraceID(c.Response().Body(), id))
+			}
+			return nil
 		},
 	})
 
+	serviceTokens := servicetoken.Parse(os.Getenv("SERVICE_TOKENS"))
+	adminToken := os.Getenv("ADMIN_TOKEN")
+	// API_KEYS gives third-party clients limits of their own, by tier
+	// (see apikey.Parse)
+	apiKeys, err := apikey.Parse(os.Getenv("API_KEYS"))
+	if err != nil {
+		log.Fatalf("Failed to load API keys: %v\n", err)
+	}
+	// USAGE_SINK streams a usage event for each request sent with an API
+	// key, for billing (see usage.FromEnv)
+	usageSink, err := usage.FromEnv(os.Getenv)
+	if err != nil {
+		log.Fatalf("Failed to configure usage events: %v\n", err)
+	}
+	var usageEmitter *usage.Emitter
+	if usageSink != nil {
+		usageEmitter = usage.NewEmitter(usageSink, 0, 0)
+		log.Printf("usage events: %s", usageSink.Name())
+	}
+	// CHAOS_MODE injects latency, parse errors and cache failures, for
+	// testing clients against a misbehaving server (see chaos.FromEnv)
+	injector, err := chaos.FromEnv(os.Getenv)
+	if err != nil {
+		log.Fatalf("Failed to configure chaos mode: %v\n", err)
+	}
+	if injector != nil {
+		log.Printf("chaos mode: %s", injector)
+	}
+	// CANARY_PERCENT, CANARY_ROUTES and CANARY_KEYS send part of the
+	// plain emoji traffic to the previous release's replacer (see
+	// canary.FromEnv)
+	router, err := canary.FromEnv(os.Getenv)
+	if err != nil {
+		log.Fatalf("Failed to configure the canary: %v\n", err)
+	}
+	if router != nil {
+		log.Printf("canary: %s", router)
+	}
+	pool := workpool.New(envInt(os.Getenv("WORKERS")), envInt(os.Getenv("QUEUE_SIZE")), 0)
+	coverageStats := coverage.New()
+	registry := metrics.New()
+
 	app.Use(recover.New())
+	app.Use(observed(registry))
 	app.Use(helmet.New())
-	app.Use(limiter.New(limiter.Config{
-		Max:        100,
-		Expiration: time.Minute,
-		SkipFailedRequests: true,
-		SkipSuccessfulRequests: false,
-		LimitReached: func(c *fiber.Ctx) error {
-			return c.Status(fiber.StatusTooManyRequests).JSON(fiber.Map{
-				"error": "Rate limit exceeded. Please try again later.",
-			})
-		},
-		Next: func(c *fiber.Ctx) bool {
-			return c.Path() == "/api/v1/health"
-		},
-	}))
+	if injector != nil {
+		app.Use(delayed(injector))
+	}
+	// service tokens, health checks and metrics scrapes aren't limited,
+	// and /usage doesn't count against the quota it reports
+	unmetered := func(c *fiber.Ctx) bool {
+		if _, isService := serviceTokens.Match(c.Get(servicetoken.Header)); isService {
+			return true
+		}
+		return c.Path() == "/api/v1/health" || c.Path() == "/api/v1/metrics" || c.Path() == "/api/v1/usage"
+	}
+	app.Use(checkAPIKey(apiKeys, unmetered, usageEmitter))
+	for _, limit := range rateLimits(apiKeys, unmetered) {
+		app.Use(limit)
+	}
 	app.Use(logger.New(logger.Config{
-		Format:     "${time} | ${status} | ${latency} | ${method} ${path}\n",
+		Format:     "${time} | ${locals:requestid} | ${status} | ${latency} | ${method} ${path}\n",
 		TimeFormat: "15:04:05",
 	}))
 
-	origins := os.Getenv("ALLOWED_ORIGINS")
-	if origins == "" {
-		origins = "http://localhost:3000,http://localhost:3001,https://emoji-script.vercel.app"
+	dialects, err := dialect.NewStore(os.Getenv("DIALECT_STORE"))
+	if err != nil {
+		log.Fatalf("Failed to load dialect packs: %v\n", err)
+	}
+	leaderboards, err := leaderboard.NewStore(os.Getenv("LEADERBOARD_STORE"))
+	if err != nil {
+		log.Fatalf("Failed to load leaderboards: %v\n", err)
+	}
+	snippetScans, err := scan.FromEnv(os.Getenv)
+	if err != nil {
+		log.Fatalf("Failed to configure snippet scanning: %v\n", err)
 	}
 
-	app.Use(cors.New(cors.Config{
-		AllowOrigins:     origins,
-		AllowHeaders:     "Origin,Content-Type,Accept",
-		AllowMethods:     "GET,POST,OPTIONS",
-		AllowCredentials: true,
-		MaxAge:           3600,
-	}))
-
-	api := app.Group("/api/v1")
-
-	api.Get("/health", func(c *fiber.Ctx) error {
-		return c.JSON(HealthResponse{Status: "healthy", Version: "1.0.0"})
+	// the shared handler below is given the same service, so native and
+	// shared routes see one cache and one history
+	remote := remoteCache()
+	store := openStorage()
+	svc := service.New(service.Options{
+		CacheMaxBytes: envInt(os.Getenv("CACHE_MAX_BYTES")),
+		// MAX_CODE_LENGTH bounds a program in bytes and
+		// MAX_CODE_CHARACTERS in characters
+		MaxCodeLength:     envInt(os.Getenv("MAX_CODE_LENGTH")),
+		MaxCodeCharacters: envInt(os.Getenv("MAX_CODE_CHARACTERS")),
+		// OUTPUT_LIMIT bounds the bytes one transpile may generate
+		MaxOutputLength: envInt(os.Getenv("OUTPUT_LIMIT")),
+		// COMPLEXITY_BUDGET bounds what a program may cost to parse
+		ComplexityBudget: envInt(os.Getenv("COMPLEXITY_BUDGET")),
+		RemoteCache:      remote,
+		// NORMALIZE_CACHE_KEYS lets programs differing only in layout or
+		// comments share transpile cache entries
+		NormalizeCacheKeys: os.Getenv("NORMALIZE_CACHE_KEYS") == "true",
+		Dialects:           dialects,
+		Coverage:           coverageStats,
+		Metrics:            registry,
+		// SOURCE_URL_HOSTS replaces the hosts sourceUrl may fetch from
+		SourceHosts: source.ParseHosts(os.Getenv("SOURCE_URL_HOSTS")),
+		// PRIVACY_MODE=strict keeps every request out of the cache,
+		// history and statistics
+		Privacy: os.Getenv("PRIVACY_MODE"),
+		Chaos:   injector,
 	})
 
-	api.Post("/transpile", func(c *fiber.Ctx) error {
-		start := time.Now()
-
-		var req TranspileRequest
-		if err := c.BodyParser(&req); err != nil {
-			return c.Status(400).JSON(TranspileResponse{
-				Success: false,
-				Errors:  []string{"Invalid request"},
-			})
-		}
-
-		if err := validateInput(req.Code); err != nil {
-			return c.Status(400).JSON(TranspileResponse{
-				Success: false,
-				Errors:  []string{err.Error()},
-			})
-		}
-
-		targetLang := strings.ToLower(req.TargetLanguage)
-		if targetLang == "" {
-			targetLang = "javascript"
-		}
-
-		if targetLang != "javascript" {
-			return c.Status(400).JSON(TranspileResponse{
-				Success: false,
-				Errors:  []string{"Invalid target language. Only 'javascript' is supported."},
-			})
-		}
-
-		useMarkup := req.UseMarkup || detectMarkupSyntax(req.Code)
-
-		cacheKey := generateCacheKey(req.Code, targetLang, useMarkup)
-		if cached, found := cache.Get(cacheKey); found {
-			cached.Metadata["cached"] = true
-			return c.JSON(cached)
-		}
-
-		var output string
-		var errors, warnings []string
-		var err error
-
-		if useMarkup {
-			output, errors, warnings, err = transpileWithMarkup(req.Code, targetLang)
-			if err != nil || len(errors) > 0 {
-				allErrors := errors
-				if err != nil {
-					allErrors = append(allErrors, err.Error())
-				}
-				return c.Status(400).JSON(TranspileResponse{
-					Success:        false,
-					TargetLanguage: targetLang,
-					Errors:         allErrors,
-					Warnings:       warnings,
-					UsedMarkup:     useMarkup,
-				})
-			}
-		} else {
-			output, err = transpileToLanguage(req.Code, targetLang)
-			if err != nil {
-				return c.Status(400).JSON(TranspileResponse{
-					Success:        false,
-					TargetLanguage: targetLang,
-					Errors:         []string{err.Error()},
-					UsedMarkup:     useMarkup,
-				})
+	corsPolicy := cors.New(cors.ParseOrigins(os.Getenv("ALLOWED_ORIGINS")), true)
+	app.Use(func(c *fiber.Ctx) error {
+		header := http.Header{}
+		preflight := corsPolicy.Apply(header, c.Get("Origin"), c.Method(), c.Path(), c.Get("Access-Control-Request-Method"))
+		for key, values := range header {
+			for _, value := range values {
+				c.Response().Header.Add(key, value)
 			}
 		}
-
-		if strings.TrimSpace(output) == "" {
-			return c.Status(500).JSON(TranspileResponse{
-				Success: false,
-				Errors:  []string{"Empty output"},
-			})
+		if preflight {
+			return c.SendStatus(fiber.StatusNoContent)
 		}
-
-		response := TranspileResponse{
-			Success:        true,
-			Output:         output,
-			TargetLanguage: targetLang,
-			UsedMarkup:     useMarkup,
-			Warnings:       warnings,
-			Metadata: map[string]interface{}{
-				"transpileTime": time.Since(start).Milliseconds(),
-				"cached":        false,
-			},
+		err := c.Next()
+		// set after the route, replacing the shared handler's own
+		if degraded := svc.Health().Header(); degraded != "" {
+			c.Set("X-Degraded", degraded)
 		}
-
-		response.JavaScript = output
-
-		cache.Set(cacheKey, &response)
-		return c.JSON(response)
+		return err
 	})
 
-	api.Post("/validate", func(c *fiber.Ctx) error {
-		var req TranspileRequest
-		if err := c.BodyParser(&req); err != nil {
-			return c.Status(400).JSON(ValidateResponse{Valid: false, Errors: []string{"Invalid request"}})
-		}
-
-		errors := []string{}
-		if req.Code == "" {
-			errors = append(errors, "Code cannot be empty")
-		}
-
-		braceCount, parenCount := 0, 0
-		for _, char := range req.Code {
-			switch char {
-			case '{':
-				braceCount++
-			case '}':
-				braceCount--
-			case '(':
-				parenCount++
-			case ')':
-				parenCount--
-			}
-		}
-
-		if braceCount != 0 {
-			errors = append(errors, "Unbalanced braces")
-		}
-		if parenCount != 0 {
-			errors = append(errors, "Unbalanced parentheses")
-		}
+	api := app.Group("/api/v1")
 
-		return c.JSON(ValidateResponse{Valid: len(errors) == 0, Errors: errors})
+	api.Get("/health", func(c *fiber.Ctx) error {
+		return c.JSON(HealthResponse{Status: "healthy", Version: transpiler.Version})
 	})
 
-	api.Get("/examples", func(c *fiber.Ctx) error {
-		syntax := c.Query("syntax", "emoji")
-		examples := []fiber.Map{}
+	asyncThreshold := envInt(os.Getenv("ASYNC_THRESHOLD"))
+	// every route but health and the WebSocket channels is served by the
+	// shared net/http handler; CORS is already applied by the middleware above
+	sharedHandler := emojiscriptapi.NewHandler(emojiscriptapi.Options{
+		Prefix:         emojiscriptapi.DefaultPrefix,
+		DisableCORS:    true,
+		Service:        svc,
+		AdminToken:     adminToken,
+		ServiceTokens:  serviceTokens,
+		APIKeys:        apiKeys,
+		Pool:           pool,
+		Coverage:       coverageStats,
+		Metrics:        registry,
+		AsyncThreshold: asyncThreshold,
+		GitHubAPIURL:   os.Getenv("GITHUB_API_URL"),
+		RemoteCache:    remote,
+		Storage:        store,
+		// SNIPPET_RATE_LIMIT is how many snippets one client may save a
+		// minute, on top of the limit above
+		SnippetRateLimit: envInt(os.Getenv("SNIPPET_RATE_LIMIT")),
+		SnippetScans:     snippetScans,
+		Leaderboard:      leaderboards,
+		// SUBMISSION_RATE_LIMIT is how many challenge submissions one
+		// client may make a minute, on top of the limit above
+		SubmissionRateLimit: envInt(os.Getenv("SUBMISSION_RATE_LIMIT")),
+		// WEBHOOK_RATE_LIMIT is how many forum bot replies one client may
+		// ask for a minute, on top of the limit above
+		WebhookRateLimit: envInt(os.Getenv("WEBHOOK_RATE_LIMIT")),
+		// requests are timed by the observed middleware above, and their
+		// API keys checked by checkAPIKey
+		DisableRequestMetrics: true,
+		DisableAPIKeyCheck:    true,
+		// SANDBOX_DISABLED=true turns off the routes that run programs,
+		// leaving transpiling and validating up
+		DisableSandbox: os.Getenv("SANDBOX_DISABLED") == "true",
+		Canary:         router,
+	})
+	sharedAPI := adaptor.HTTPHandler(sharedHandler)
+
+	api.Post("/transpile", sharedAPI)
+	api.Post("/transcribe", sharedAPI)
+	api.Post("/format", sharedAPI)
+	api.Get("/history", sharedAPI)
+	api.Get("/history/:id", sharedAPI)
+	api.Delete("/history", sharedAPI)
+	api.Get("/meta", sharedAPI)
+
+	api.Get("/fixtures", sharedAPI)
+
+	// the playground's live-transpile channel; one upgrade counts against
+	// the rate limit however many edits the session then sends
+	api.Get("/ws", liveTranspile(live.New(svc, live.Options{Pool: pool}), corsPolicy))
+	// the collaboration relay is opt-in: it holds a connection per peer
+	// and relays what they send without reading it
+	if os.Getenv("COLLAB_RELAY") == "true" {
+		api.Get("/collab/:room", collabRelay(collab.New(collab.Options{}), corsPolicy))
+	}
 
-		if syntax == "markup" {
-			examples = []fiber.Map{
-				{"title": "Hello World", "description": "Basic console output", "code": "<print>\"Hello, World!\"</print>", "syntax": "markup", "category": "basics"},
-				{"title": "Variables", "description": "Declare variables and constants", "code": "<const name=\"user\" value=\"'Alice'\"/>\n<let name=\"age\" value=\"25\"/>\n<let name=\"active\" value=\"true\"/>", "syntax": "markup", "category": "basics"},
-				{"title": "Function", "description": "Function with parameters", "code": "<function name=\"greet\" params=\"name\">\n  <return>\"Hello, \" + name</return>\n</function>\n<print>greet(\"World\")</print>", "syntax": "markup", "category": "functions"},
-				{"title": "Arrow Function", "description": "Arrow function syntax", "code": "<const name=\"add\" value=\"(a, b) => a + b\"/>\n<print>add(5, 3)</print>", "syntax": "markup", "category": "functions"},
-				{"title": "If/Else", "description": "Conditional logic", "code": "<let name=\"age\" value=\"20\"/>\n<if condition=\"age >= 18\">\n  <print>\"Adult\"</print>\n</if>\n<else>\n  <print>\"Minor\"</print>\n</else>", "syntax": "markup", "category": "control"},
-				{"title": "For Loop", "description": "Loop from 0 to 5", "code": "<loop var=\"i\" from=\"0\" to=\"5\">\n  <print>i</print>\n</loop>", "syntax": "markup", "category": "loops"},
-				{"title": "ForEach Loop", "description": "Iterate over array", "code": "<const name=\"items\" value=\"['apple', 'banana', 'orange']\"/>\n<loop var=\"item\" in=\"items\">\n  <print>item</print>\n</loop>", "syntax": "markup", "category": "loops"},
-				{"title": "While Loop", "description": "Loop while condition is true", "code": "<let name=\"count\" value=\"0\"/>\n<while condition=\"count < 3\">\n  <print>count</print>\n  count++\n</while>", "syntax": "markup", "category": "loops"},
-				{"title": "Class", "description": "Create a class with methods", "code": "<class name=\"Person\">\n  <method name=\"constructor\" params=\"name\">\n    this.name = name\n  </method>\n  <method name=\"greet\">\n    <return>\"Hi, \" + this.name</return>\n  </method>\n</class>\n<const name=\"p\" value=\"new Person('Alice')\"/>\n<print>p.greet()</print>", "syntax": "markup", "category": "classes"},
-				{"title": "Array Map", "description": "Transform array with map", "code": "<const name=\"nums\" value=\"[1, 2, 3, 4, 5]\"/>\n<const name=\"doubled\" value=\"nums.map(n => n * 2)\"/>\n<print>doubled</print>", "syntax": "markup", "category": "arrays"},
-				{"title": "Array Filter", "description": "Filter array elements", "code": "<const name=\"nums\" value=\"[1, 2, 3, 4, 5]\"/>\n<const name=\"evens\" value=\"nums.filter(n => n % 2 === 0)\"/>\n<print>evens</print>", "syntax": "markup", "category": "arrays"},
-				{"title": "Async Function", "description": "Async/await pattern", "code": "<function name=\"fetchData\" params=\"url\" async=\"true\">\n  <const name=\"response\" value=\"await fetch(url)\"/>\n  <return>await response.json()</return>\n</function>", "syntax": "markup", "category": "async"},
-			}
-		} else {
-			examples = []fiber.Map{
-				{"title": "Hello World", "description": "Print to console", "code": "📝(\"Hello, World!\")", "syntax": "emoji", "category": "basics"},
-				{"title": "Variables", "description": "Declare variables", "code": "📦 name 🟰 \"EmojiScript\"\n🔢 age 🟰 25\n🔢 active 🟰 ✅", "syntax": "emoji", "category": "basics"},
-				{"title": "Function", "description": "Function with return", "code": "🎯 greet(name) {\n  🔙 \"Hello, \" ➕ name\n}\n📝(greet(\"World\"))", "syntax": "emoji", "category": "functions"},
-				{"title": "Arrow Function", "description": "Arrow function", "code": "📦 add 🟰 (a, b) ➡️ a ➕ b\n📝(add(5, 3))", "syntax": "emoji", "category": "functions"},
-				{"title": "If/Else", "description": "Conditional statement", "code": "📦 age 🟰 20\n❓ (age ⬆️🟰 18) {\n  📝(\"Adult\")\n} ❌ {\n  📝(\"Minor\")\n}", "syntax": "emoji", "category": "control"},
-				{"title": "For Loop", "description": "Loop through numbers", "code": "🔁 (🔢 i 🟰 0; i ⬇️ 5; i➕➕) {\n  📝(i)\n}", "syntax": "emoji", "category": "loops"},
-				{"title": "While Loop", "description": "Loop with condition", "code": "🔢 count 🟰 0\n🔄 (count ⬇️ 3) {\n  📝(count)\n  count➕➕\n}", "syntax": "emoji", "category": "loops"},
-				{"title": "Class", "description": "Create a class", "code": "🔐 Person {\n  🔧(name) {\n    🎭.name 🟰 name\n  }\n  greet() {\n    🔙 \"Hi, \" ➕ 🎭.name\n  }\n}\n📦 p 🟰 🎁 Person(\"Alice\")\n📝(p.greet())", "syntax": "emoji", "category": "classes"},
-				{"title": "Array Map", "description": "Map over array", "code": "📦 nums 🟰 [1, 2, 3, 4, 5]\n📦 doubled 🟰 nums.map(n ➡️ n ✖️ 2)\n📝(doubled)", "syntax": "emoji", "category": "arrays"},
-				{"title": "Array Filter", "description": "Filter array", "code": "📦 nums 🟰 [1, 2, 3, 4, 5]\n📦 evens 🟰 nums.filter(n ➡️ n % 2 🟰🟰 0)\n📝(evens)", "syntax": "emoji", "category": "arrays"},
-				{"title": "Async Function", "description": "Async operation", "code": "⚡ 🎯 fetchData(url) {\n  📦 response 🟰 ⏳ fetch(url)\n  🔙 ⏳ response.json()\n}", "syntax": "emoji", "category": "async"},
-			}
-		}
+	api.Post("/transpile/project", sharedAPI)
+	api.Post("/validate", sharedAPI)
+	api.Get("/jobs/:id", sharedAPI)
+	api.Get("/examples", sharedAPI)
+	api.Get("/examples/path", sharedAPI)
+	api.Get("/reference", sharedAPI)
+	api.Get("/conformance", sharedAPI)
+	api.Get("/conformance/badge", sharedAPI)
+	api.Get("/lessons", sharedAPI)
+	api.Get("/lessons/:id", sharedAPI)
+	api.Get("/quiz", sharedAPI)
+	api.Get("/dialects", sharedAPI)
+	api.Get("/dialects/:name", sharedAPI)
+	api.Get("/mappings", sharedAPI)
+	api.Get("/mappings/:name", sharedAPI)
+	api.Get("/admin/dialects", sharedAPI)
+	api.Put("/admin/dialects/:name", sharedAPI)
+	api.Delete("/admin/dialects/:name", sharedAPI)
+	api.Post("/trace", sharedAPI)
+	api.Post("/run", sharedAPI)
+	api.Delete("/run", sharedAPI)
+	api.Post("/evaluate", sharedAPI)
+	api.Post("/ast", sharedAPI)
+	api.Post("/tokenize", sharedAPI)
+	api.Post("/symbols", sharedAPI)
+	api.Post("/outline", sharedAPI)
+	api.Post("/refactor/rename", sharedAPI)
+	api.Post("/refactor/extract", sharedAPI)
+	api.Post("/refactor/imports", sharedAPI)
+	api.Post("/grade", sharedAPI)
+	api.Get("/challenge/today", sharedAPI)
+	api.Post("/challenge/:id/grade", sharedAPI)
+	api.Post("/challenge/:id/submit", sharedAPI)
+	api.Get("/challenge/:id/leaderboard", sharedAPI)
+	api.Get("/badge", sharedAPI)
+	api.Post("/badge", sharedAPI)
+	api.Get("/metrics", sharedAPI)
+	api.Get("/usage", sharedAPI)
+	api.Get("/grammar", sharedAPI)
+	api.Get("/changelog", sharedAPI)
+	api.Post("/snippets", sharedAPI)
+	api.Get("/snippets/export", sharedAPI)
+	api.Get("/snippets/:id", sharedAPI)
+	api.Get("/snippets/:id/preview", sharedAPI)
+	api.Post("/snippets/:id/flag", sharedAPI)
+	api.Get("/admin/snippets/flagged", sharedAPI)
+	api.Delete("/admin/snippets/:id/flags", sharedAPI)
+	api.Delete("/admin/snippets/:id", sharedAPI)
+	api.Get("/admin/snippet-bans", sharedAPI)
+	api.Delete("/admin/snippet-bans/:hash", sharedAPI)
+	api.Get("/admin/selftest", sharedAPI)
+	api.Get("/admin/export", sharedAPI)
+	api.Post("/admin/import", sharedAPI)
+	api.Post("/snippets/:id/gist", sharedAPI)
+	api.Get("/embed/:id", sharedAPI)
+	api.Post("/webhooks/bot", sharedAPI)
+	api.Post("/notebooks", sharedAPI)
+	api.Get("/notebooks/:id", sharedAPI)
+	api.Put("/notebooks/:id", sharedAPI)
+	api.Delete("/notebooks/:id", sharedAPI)
+	api.Post("/notebooks/:id/restart", sharedAPI)
+	api.Post("/notebooks/:id/cells/:cell/transpile", sharedAPI)
+	api.Post("/notebooks/:id/cells/:cell/run", sharedAPI)
+	// the short embed URL for iframes, e.g. /embed/3f2a9c0d41be; the
+	// adaptor forwards the original request URI, so the versioned path is
+	// set on the net/http request, as the Vercel handler does
+	app.Get("/embed/:id", adaptor.HTTPHandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		r.URL.Path = emojiscriptapi.DefaultPrefix + r.URL.Path
+		sharedHandler.ServeHTTP(w, r)
+	}))
 
-		return c.JSON(fiber.Map{"examples": examples})
-	})
+	for _, route := range app.GetRoutes(true) {
+		corsPolicy.AllowRoute(route.Path, route.Method)
+	}
 
 	log.Printf("🚀 EmojiScript API running on port %s\n", port)
 	if err := app.Listen(":" + port); err != nil {
 		log.Fatalf("Failed to start: %v\n", err)
 	}
 }
+
+// envInt reads a positive integer setting, falling back to zero (the
+// package default) when it is unset or invalid
+func envInt(value string) int {
+	n, err := strconv.Atoi(value)
+	if err != nil || n < 0 {
+		return 0
+	}
+	return n
+}
@@ -0,0 +1,67 @@
+package main
+
+import (
+	"errors"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"emojiscript-backend/pkg/metrics"
+	"emojiscript-backend/pkg/requestid"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// observed gives each request an ID, kept from X-Request-ID when valid or
+// taken from its traceparent, and times it by route for /metrics, logging
+// server errors with their ID. It mirrors requestid.Middleware and
+// metrics.Registry.Middleware for the whole Fiber app; the shared handler
+// reads the ID from the request header. The response header and a JSON
+// body's traceId are set after the handlers, replacing the shared
+// handler's header rather than adding a second, and leaving a body it
+// already gave a traceId as it is.
+func observed(registry *metrics.Registry) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		id := requestid.FromHeader(func(key string) string { return c.Get(key) })
+		c.Request().Header.Set(requestid.Header, id)
+		c.Locals("requestid", id)
+		c.SetUserContext(requestid.WithID(c.UserContext(), id))
+
+		start := time.Now()
+		err := c.Next()
+		took := time.Since(start)
+
+		status := c.Response().StatusCode()
+		var fiberErr *fiber.Error
+		switch {
+		case errors.As(err, &fiberErr):
+			status = fiberErr.Code
+		case err != nil:
+			status = fiber.StatusInternalServerError
+		}
+		// the registry keeps the method, whose buffer fasthttp reuses
+		registry.ObserveRequest(strings.Clone(c.Method()), routeLabel(c.Route().Path), status, took)
+		if status >= fiber.StatusInternalServerError {
+			log.Printf("[%s] %s %s: %d %s after %s", id, c.Method(), c.Path(), status, http.StatusText(status), took.Round(time.Millisecond))
+		}
+		c.Set(requestid.Header, id)
+		if strings.HasPrefix(string(c.Response().Header.ContentType()), fiber.MIMEApplicationJSON) {
+			c.Response().SetBody(requestid.AddTraceID(c.Response().Body(), id))
+		}
+		return err
+	}
+}
+
+// routeLabel spells a Fiber route's parameters the way the shared
+// handler's patterns do, /snippets/:id as /snippets/{id}, so both servers
+// label a route alike
+func routeLabel(path string) string {
+	segments := strings.Split(path, "/")
+	for i, segment := range segments {
+		if name, ok := strings.CutPrefix(segment, ":"); ok {
+			segments[i] = "{" + name + "}"
+		}
+	}
+	return strings.Join(segments, "/")
+}
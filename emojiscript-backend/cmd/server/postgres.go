@@ -0,0 +1,7 @@
+//go:build postgres
+
+package main
+
+// Building with -tags postgres links a PostgreSQL driver, for
+// STORAGE_URL=postgres://...
+import _ "github.com/jackc/pgx/v5/stdlib"
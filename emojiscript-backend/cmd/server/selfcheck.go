@@ -0,0 +1,52 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"strings"
+
+	"emojiscript-backend/pkg/emojiscriptapi"
+	"emojiscript-backend/pkg/service"
+)
+
+// selfCheck transpiles the examples and runs the runnable ones in the
+// sandbox, along with each daily challenge's solution against its tests, so a deploy can refuse a build whose examples no longer print
+// what the playground says they do. It returns the exit status.
+func selfCheck() int {
+	problems := append(emojiscriptapi.CheckExamples(), emojiscriptapi.CheckChallenges()...)
+	for _, problem := range problems {
+		fmt.Fprintln(os.Stderr, problem)
+	}
+	if len(problems) > 0 {
+		fmt.Fprintf(os.Stderr, "selfcheck: %d problem(s)\n", len(problems))
+		return 1
+	}
+	fmt.Println("selfcheck: every example transpiles, prints its expected output and is on the learning path, and every challenge's solution passes")
+	return 0
+}
+
+// selfTest puts the golden corpus through every backend and the sandbox
+// (see emojiscriptapi.SelfTest), printing a line per feature and the
+// checks that failed, so a deployment can be verified before it takes
+// traffic. It returns the exit status.
+func selfTest() int {
+	report := emojiscriptapi.SelfTest(service.New(service.Options{}))
+	for _, feature := range report.Features {
+		status := "PASS"
+		if !feature.Passed {
+			status = "FAIL"
+		}
+		fmt.Printf("%s %s\n", status, feature.Feature)
+		for _, check := range feature.Checks {
+			if check.Status == emojiscriptapi.SelfTestFail {
+				fmt.Printf("  %s (%s): %s\n", check.Fixture, check.Check, check.Message)
+			}
+		}
+	}
+	if !report.Passed {
+		fmt.Fprintf(os.Stderr, "selftest: %d check(s) failed\n", report.Failures)
+		return 1
+	}
+	fmt.Printf("selftest: every feature passes on %s\n", strings.Join(report.Targets, ", "))
+	return 0
+}
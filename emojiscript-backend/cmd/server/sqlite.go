@@ -0,0 +1,8 @@
+//go:build sqlite
+
+package main
+
+// Building with -tags sqlite links a SQLite driver, for
+// STORAGE_URL=sqlite:<path>. The driver uses cgo, so the build needs
+// CGO_ENABLED=1 and a C compiler.
+import _ "github.com/mattn/go-sqlite3"
@@ -0,0 +1,292 @@
+// Package apikey authenticates third-party clients, such as classrooms
+// sharing one address behind NAT, by the key they send in X-API-Key. Each
+// key is on a tier, which sets how many requests it may send a minute and
+// a day; clients without a key are limited by address instead. Keys are
+// configured by the operator, and their usage is counted per UTC day in
+// memory. Keys added at run time last until the process exits, unless the
+// Store is given a storage.Store to keep them in.
+package apikey
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"emojiscript-backend/pkg/storage"
+)
+
+// Header carries an API key on requests
+const Header = "X-API-Key"
+
+// Tier is a level of access: the requests a client may send a minute and
+// a day, with no daily quota when PerDay is zero
+type Tier struct {
+	Name      string `json:"name"`
+	PerMinute int    `json:"perMinute"`
+	PerDay    int    `json:"perDay,omitempty"`
+}
+
+var (
+	// Anonymous is the tier of clients without a key, limited per
+	// address
+	Anonymous = Tier{Name: "anonymous", PerMinute: 100}
+	// Tiers are the tiers a key may be on, the first being the default
+	Tiers = []Tier{
+		{Name: "free", PerMinute: 300, PerDay: 10000},
+		{Name: "classroom", PerMinute: 1000, PerDay: 50000},
+		{Name: "partner", PerMinute: 5000},
+	}
+)
+
+// Errors Check rejects a request with
+var (
+	ErrInvalidKey    = errors.New("Invalid API key")
+	ErrQuotaExceeded = errors.New("Daily quota exceeded. Please try again tomorrow.")
+)
+
+// Key is a configured key, without its value
+type Key struct {
+	Name string
+	Tier Tier
+	// Quota is how many requests the key may send a day, its tier's
+	// PerDay unless the key sets its own; zero is unlimited
+	Quota int
+}
+
+// Usage is a key's use of its quota on one UTC day
+type Usage struct {
+	Key   string `json:"key"`
+	Tier  string `json:"tier"`
+	Day   string `json:"day"`
+	Used  int    `json:"used"`
+	Quota int    `json:"quota,omitempty"`
+	// Remaining is omitted for keys without a quota
+	Remaining *int `json:"remaining,omitempty"`
+	// Resets is when the day, and with it the count, ends
+	Resets time.Time `json:"resets"`
+}
+
+// Store holds the configured keys and counts their daily use. It is safe
+// for concurrent use.
+type Store struct {
+	keysMu sync.RWMutex
+	keys   []key
+	// storage keeps the keys Add adds, when set
+	storage storage.Store
+
+	mu    sync.Mutex
+	usage map[string]*usage
+}
+
+type key struct {
+	Key
+	value []byte
+}
+
+type usage struct {
+	day   string
+	count int
+}
+
+// Parse reads a comma-separated list such as the API_KEYS environment
+// variable. Entries are "name:key", "name:key:tier" or
+// "name:key:tier:quota", where quota replaces the tier's daily quota and
+// 0 lifts it.
+func Parse(list string) (*Store, error) {
+	s := &Store{usage: map[string]*usage{}}
+	seen := map[string]bool{}
+	for _, entry := range strings.Split(list, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		fields := strings.Split(entry, ":")
+		if len(fields) < 2 || len(fields) > 4 {
+			return nil, fmt.Errorf("API key entry %q isn't name:key[:tier[:quota]]", entry)
+		}
+		name, value := strings.TrimSpace(fields[0]), strings.TrimSpace(fields[1])
+		if name == "" || value == "" {
+			return nil, fmt.Errorf("API key entry %q needs a name and a key", entry)
+		}
+		if seen[name] {
+			return nil, fmt.Errorf("API key %q is configured twice", name)
+		}
+		seen[name] = true
+
+		tier := Tiers[0]
+		if len(fields) > 2 {
+			var found bool
+			if tier, found = TierNamed(strings.TrimSpace(fields[2])); !found {
+				return nil, fmt.Errorf("API key %q: unknown tier %q", name, fields[2])
+			}
+		}
+		quota := tier.PerDay
+		if len(fields) > 3 {
+			n, err := strconv.Atoi(strings.TrimSpace(fields[3]))
+			if err != nil || n < 0 {
+				return nil, fmt.Errorf("API key %q: quota %q isn't a whole number", name, fields[3])
+			}
+			quota = n
+		}
+		s.keys = append(s.keys, key{Key: Key{Name: name, Tier: tier, Quota: quota}, value: []byte(value)})
+	}
+	return s, nil
+}
+
+// TierNamed returns the key tier called name
+func TierNamed(name string) (Tier, bool) {
+	for _, tier := range Tiers {
+		if tier.Name == name {
+			return tier, true
+		}
+	}
+	return Tier{}, false
+}
+
+// Empty reports whether no keys are configured
+func (s *Store) Empty() bool {
+	if s == nil {
+		return true
+	}
+	s.keysMu.RLock()
+	defer s.keysMu.RUnlock()
+	return len(s.keys) == 0
+}
+
+// Match returns the key whose value is value. Every key is compared in
+// constant time so timing doesn't reveal which one is close.
+func (s *Store) Match(value string) (Key, bool) {
+	var match Key
+	ok := false
+	if s == nil || value == "" {
+		return match, false
+	}
+	s.keysMu.RLock()
+	defer s.keysMu.RUnlock()
+	for _, k := range s.keys {
+		if subtle.ConstantTimeCompare([]byte(value), k.value) == 1 && !ok {
+			match, ok = k.Key, true
+		}
+	}
+	return match, ok
+}
+
+// FromRequest returns the key r was sent with, if its X-API-Key header
+// holds a configured one
+func (s *Store) FromRequest(r *http.Request) (Key, bool) {
+	return s.Match(r.Header.Get(Header))
+}
+
+// Check finds the key a request was sent with and counts the request
+// against the key's daily quota. ok is false for a request without a key,
+// which is left to the anonymous limits; err is ErrInvalidKey for a key
+// that isn't configured and ErrQuotaExceeded once the day's quota is used
+// up. The quota is reported on header as X-Quota-Limit and
+// X-Quota-Remaining, with Retry-After when it's used up.
+func (s *Store) Check(header http.Header, value string) (k Key, ok bool, err error) {
+	if value == "" {
+		return Key{}, false, nil
+	}
+	if k, ok = s.Match(value); !ok {
+		return Key{}, false, ErrInvalidKey
+	}
+	usage, allowed := s.use(k, time.Now())
+	if k.Quota > 0 {
+		header.Set("X-Quota-Limit", strconv.Itoa(k.Quota))
+		header.Set("X-Quota-Remaining", strconv.Itoa(*usage.Remaining))
+	}
+	if !allowed {
+		header.Set("Retry-After", strconv.Itoa(retryAfter(usage.Resets)))
+		return k, true, ErrQuotaExceeded
+	}
+	return k, true, nil
+}
+
+// Status is the HTTP status to reject a request with for an error from
+// Check
+func Status(err error) int {
+	if errors.Is(err, ErrInvalidKey) {
+		return http.StatusUnauthorized
+	}
+	return http.StatusTooManyRequests
+}
+
+// RejectionBody is the JSON reply to a request Check rejects
+type RejectionBody struct {
+	Success    bool   `json:"success"`
+	Error      string `json:"error"`
+	RetryAfter int    `json:"retryAfter,omitempty"`
+}
+
+// Rejection is the reply to a request Check rejected with err, after it
+// set header
+func Rejection(header http.Header, err error) RejectionBody {
+	seconds, _ := strconv.Atoi(header.Get("Retry-After"))
+	return RejectionBody{Error: err.Error(), RetryAfter: seconds}
+}
+
+// use counts a request by k on now's day, reporting whether it was
+// within the key's quota. Requests over the quota aren't counted.
+func (s *Store) use(k Key, now time.Time) (Usage, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	day := now.UTC().Format(time.DateOnly)
+	u, ok := s.usage[k.Name]
+	if !ok || u.day != day {
+		u = &usage{day: day}
+		s.usage[k.Name] = u
+	}
+	allowed := k.Quota == 0 || u.count < k.Quota
+	if allowed {
+		u.count++
+	}
+	return usageOf(k, u, now), allowed
+}
+
+// Usage returns k's use of its quota today
+func (s *Store) Usage(k Key) Usage {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	now := time.Now()
+	u, ok := s.usage[k.Name]
+	if !ok || u.day != now.UTC().Format(time.DateOnly) {
+		u = &usage{day: now.UTC().Format(time.DateOnly)}
+	}
+	return usageOf(k, u, now)
+}
+
+func usageOf(k Key, u *usage, now time.Time) Usage {
+	day := now.UTC().Truncate(24 * time.Hour)
+	report := Usage{Key: k.Name, Tier: k.Tier.Name, Day: u.day, Used: u.count, Quota: k.Quota, Resets: day.Add(24 * time.Hour)}
+	if k.Quota > 0 {
+		remaining := max(k.Quota-u.count, 0)
+		report.Remaining = &remaining
+	}
+	return report
+}
+
+// retryAfter is the whole seconds until resets, rounded up
+func retryAfter(resets time.Time) int {
+	return int((time.Until(resets) + time.Second - 1) / time.Second)
+}
+
+// Middleware checks the key each request is sent with, answering 401 for
+// an unknown key and 429 with Retry-After once a key's daily quota is used
+// up. Requests without a key pass through to the anonymous limits.
+func (s *Store) Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if _, _, err := s.Check(w.Header(), r.Header.Get(Header)); err != nil {
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(Status(err))
+			json.NewEncoder(w).Encode(Rejection(w.Header(), err))
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
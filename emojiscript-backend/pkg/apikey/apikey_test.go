@@ -0,0 +1,148 @@
+package apikey
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// TestParse checks that entries take the default tier and its quota
+// unless they name their own, and that malformed lists are refused
+func TestParse(t *testing.T) {
+	s, err := Parse(" alice:a1 , school:s1:classroom, lab:l1:free:0,,big:b1:partner:5")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, tt := range []struct {
+		value, name, tier string
+		quota             int
+	}{
+		{"a1", "alice", "free", 10000},
+		{"s1", "school", "classroom", 50000},
+		{"l1", "lab", "free", 0},
+		{"b1", "big", "partner", 5},
+	} {
+		k, ok := s.Match(tt.value)
+		if !ok || k.Name != tt.name || k.Tier.Name != tt.tier || k.Quota != tt.quota {
+			t.Errorf("Match(%q) = %+v, %v, want %s on %s with quota %d", tt.value, k, ok, tt.name, tt.tier, tt.quota)
+		}
+	}
+	if _, ok := s.Match("alice"); ok {
+		t.Error("a key matched by its name")
+	}
+
+	for _, list := range []string{"alice", "alice:", ":a1", "a:b:c:d:e", "alice:a1:gold", "alice:a1:free:-1", "alice:a1:free:x", "alice:a1,alice:a2"} {
+		if _, err := Parse(list); err == nil {
+			t.Errorf("Parse(%q) accepted it", list)
+		}
+	}
+	if s, err := Parse(""); err != nil || !s.Empty() {
+		t.Errorf("Parse(\"\") = %v, %v, want an empty store", s, err)
+	}
+}
+
+// TestCheck checks that requests count against a key's quota until it's
+// used up, with the quota reported on the response
+func TestCheck(t *testing.T) {
+	s, _ := Parse("alice:a1:free:2,lab:l1:free:0")
+	for i, tt := range []struct {
+		value     string
+		err       error
+		remaining string
+	}{
+		{"", nil, ""},
+		{"nope", ErrInvalidKey, ""},
+		{"a1", nil, "1"},
+		{"a1", nil, "0"},
+		{"a1", ErrQuotaExceeded, "0"},
+		{"l1", nil, ""},
+	} {
+		header := http.Header{}
+		_, ok, err := s.Check(header, tt.value)
+		if !errors.Is(err, tt.err) || ok != (tt.value != "" && tt.err != ErrInvalidKey) {
+			t.Errorf("%d: Check(%q) = %v, %v, want %v", i, tt.value, ok, err, tt.err)
+		}
+		if got := header.Get("X-Quota-Remaining"); got != tt.remaining {
+			t.Errorf("%d: Check(%q) left %q remaining, want %q", i, tt.value, got, tt.remaining)
+		}
+		if retry := header.Get("Retry-After"); (retry != "") != (tt.err == ErrQuotaExceeded) {
+			t.Errorf("%d: Check(%q) set Retry-After %q", i, tt.value, retry)
+		}
+	}
+
+	alice, _ := s.Match("a1")
+	if u := s.Usage(alice); u.Used != 2 || u.Quota != 2 || u.Remaining == nil || *u.Remaining != 0 {
+		t.Errorf("Usage = %+v, want 2 of 2 used", u)
+	}
+	if Status(ErrInvalidKey) != http.StatusUnauthorized || Status(ErrQuotaExceeded) != http.StatusTooManyRequests {
+		t.Error("Status doesn't tell an invalid key from an exceeded quota")
+	}
+}
+
+// TestMiddleware checks that only unknown keys and used-up quotas are
+// turned away
+func TestMiddleware(t *testing.T) {
+	s, _ := Parse("alice:a1:free:1")
+	h := s.Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	for _, tt := range []struct {
+		value string
+		want  int
+	}{
+		{"", http.StatusOK},
+		{"nope", http.StatusUnauthorized},
+		{"a1", http.StatusOK},
+		{"a1", http.StatusTooManyRequests},
+	} {
+		req := httptest.NewRequest("GET", "/", nil)
+		req.Header.Set(Header, tt.value)
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, req)
+		if rec.Code != tt.want {
+			t.Errorf("key %q: got %d, want %d", tt.value, rec.Code, tt.want)
+		}
+		if tt.want != http.StatusOK && !strings.Contains(rec.Body.String(), `"error"`) {
+			t.Errorf("key %q: got body %s, want an error", tt.value, rec.Body)
+		}
+	}
+}
+
+// TestAdd checks that added keys are matched and exported as Parse reads
+// them, and that a key of the same name is kept unless replaced
+func TestAdd(t *testing.T) {
+	s, _ := Parse("alice:a1")
+	for _, tt := range []struct {
+		entry   Entry
+		replace bool
+		added   bool
+		invalid bool
+	}{
+		{Entry{Name: "bob", Key: "b1", Tier: "classroom", Quota: 5}, false, true, false},
+		{Entry{Name: "alice", Key: "a2", Tier: "free"}, false, false, false},
+		{Entry{Name: "alice", Key: "a2", Tier: "partner"}, true, true, false},
+		{Entry{Name: "carol", Key: "c:1", Tier: "free"}, false, false, true},
+		{Entry{Name: "carol", Key: "c1", Tier: "gold"}, false, false, true},
+		{Entry{Name: "carol", Key: "c1", Tier: "free", Quota: -1}, false, false, true},
+		{Entry{Name: "", Key: "c1", Tier: "free"}, false, false, true},
+	} {
+		added, err := s.Add(tt.entry, tt.replace)
+		if added != tt.added || (err != nil) != tt.invalid {
+			t.Errorf("Add(%+v, %v) = %v, %v", tt.entry, tt.replace, added, err)
+		}
+	}
+	if _, ok := s.Match("a1"); ok {
+		t.Error("the replaced key still matches")
+	}
+
+	var list []string
+	for _, e := range s.Export() {
+		list = append(list, e.String())
+	}
+	if got := strings.Join(list, ","); got != "alice:a2:partner:0,bob:b1:classroom:5" {
+		t.Errorf("Export = %s", got)
+	}
+	if again, err := Parse(strings.Join(list, ",")); err != nil || len(again.Export()) != 2 {
+		t.Errorf("Parse didn't read the export back: %v", err)
+	}
+}
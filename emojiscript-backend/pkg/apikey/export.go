@@ -0,0 +1,114 @@
+package apikey
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"emojiscript-backend/pkg/storage"
+)
+
+// Entry is a key with its value, as exported to move keys to another
+// deployment
+type Entry struct {
+	Name  string `json:"name"`
+	Key   string `json:"key"`
+	Tier  string `json:"tier"`
+	Quota int    `json:"quota"`
+}
+
+// String formats the entry as Parse reads it
+func (e Entry) String() string {
+	return fmt.Sprintf("%s:%s:%s:%d", e.Name, e.Key, e.Tier, e.Quota)
+}
+
+// Export returns the configured keys with their values, in the order they
+// were configured
+func (s *Store) Export() []Entry {
+	entries := []Entry{}
+	if s == nil {
+		return entries
+	}
+	s.keysMu.RLock()
+	defer s.keysMu.RUnlock()
+	for _, k := range s.keys {
+		entries = append(entries, Entry{Name: k.Name, Key: string(k.value), Tier: k.Tier.Name, Quota: k.Quota})
+	}
+	return entries
+}
+
+// Add configures a key, as Parse would have from its entry, until the
+// process exits or, once Persist has been called, for good. A key of the
+// same name is replaced when replace is set and kept otherwise; Add
+// reports whether it added the key.
+func (s *Store) Add(e Entry, replace bool) (bool, error) {
+	added, err := s.add(e, replace)
+	s.keysMu.RLock()
+	store := s.storage
+	s.keysMu.RUnlock()
+	if err != nil || !added || store == nil {
+		return added, err
+	}
+	value, _ := json.Marshal(e)
+	ctx, cancel := context.WithTimeout(context.Background(), storage.Timeout)
+	defer cancel()
+	if err := store.Put(ctx, storage.APIKeys, e.Name, value, 0); err != nil {
+		return true, fmt.Errorf("API key %q is added until the server restarts, but couldn't be stored: %v", e.Name, err)
+	}
+	return true, nil
+}
+
+// Persist adds the keys kept in store, then keeps the ones Add adds there
+// too. A stored key doesn't replace one configured under the same name, as
+// the operator's configuration wins.
+func (s *Store) Persist(ctx context.Context, store storage.Store) error {
+	records, err := store.List(ctx, storage.APIKeys)
+	if err != nil {
+		return err
+	}
+	for _, record := range records {
+		var e Entry
+		if err := json.Unmarshal(record.Value, &e); err != nil {
+			return fmt.Errorf("stored API key %q: %v", record.Key, err)
+		}
+		if _, err := s.add(e, false); err != nil {
+			return fmt.Errorf("stored %v", err)
+		}
+	}
+	s.keysMu.Lock()
+	s.storage = store
+	s.keysMu.Unlock()
+	return nil
+}
+
+func (s *Store) add(e Entry, replace bool) (bool, error) {
+	if e.Name == "" || e.Key == "" {
+		return false, fmt.Errorf("API key entry needs a name and a key")
+	}
+	if strings.ContainsAny(e.Name+e.Key, ":,") || strings.TrimSpace(e.Name) != e.Name || strings.TrimSpace(e.Key) != e.Key {
+		return false, fmt.Errorf("API key %q: names and keys can't contain ':', ',' or surrounding spaces", e.Name)
+	}
+	tier, found := TierNamed(e.Tier)
+	if !found {
+		return false, fmt.Errorf("API key %q: unknown tier %q", e.Name, e.Tier)
+	}
+	if e.Quota < 0 {
+		return false, fmt.Errorf("API key %q: quota can't be negative", e.Name)
+	}
+
+	s.keysMu.Lock()
+	defer s.keysMu.Unlock()
+	added := key{Key: Key{Name: e.Name, Tier: tier, Quota: e.Quota}, value: []byte(e.Key)}
+	for i, k := range s.keys {
+		if k.Name == e.Name {
+			if !replace {
+				return false, nil
+			}
+			s.keys[i] = added
+			return true, nil
+		}
+	}
+	s.keys = append(s.keys, added)
+	return true, nil
+}
@@ -0,0 +1,123 @@
+// Package astviz renders syntax trees as Graphviz DOT or Mermaid
+// flowcharts, so learners and maintainers can see a program's structure.
+package astviz
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"emojiscript-backend/pkg/sandbox"
+)
+
+// Output formats
+const (
+	FormatDOT     = "dot"
+	FormatMermaid = "mermaid"
+)
+
+// maxLabel caps how much of a literal a node shows
+const maxLabel = 40
+
+// ErrFormat is returned by Render for an unknown format
+var ErrFormat = errors.New("format must be dot or mermaid")
+
+// Render draws the tree in the given format
+func Render(format string, root *sandbox.Node) (string, error) {
+	switch format {
+	case FormatDOT:
+		return DOT(root), nil
+	case FormatMermaid:
+		return Mermaid(root), nil
+	}
+	return "", ErrFormat
+}
+
+// DOT draws the tree as a Graphviz digraph; edges are labeled with each
+// child's role
+func DOT(root *sandbox.Node) string {
+	b := &strings.Builder{}
+	b.WriteString("digraph AST {\n")
+	b.WriteString("  node [shape=box, fontname=\"Helvetica\"];\n")
+	b.WriteString("  edge [fontname=\"Helvetica\", fontsize=10];\n")
+	walk(root, func(id int, n *sandbox.Node) {
+		fmt.Fprintf(b, "  n%d [label=\"%s\"];\n", id, dotEscape(strings.Join(lines(n), "\n")))
+	}, func(parent, child int, role string) {
+		if role == "" {
+			fmt.Fprintf(b, "  n%d -> n%d;\n", parent, child)
+			return
+		}
+		fmt.Fprintf(b, "  n%d -> n%d [label=\"%s\"];\n", parent, child, dotEscape(role))
+	})
+	b.WriteString("}\n")
+	return b.String()
+}
+
+// Mermaid draws the tree as a top-down Mermaid flowchart
+func Mermaid(root *sandbox.Node) string {
+	b := &strings.Builder{}
+	b.WriteString("flowchart TD\n")
+	walk(root, func(id int, n *sandbox.Node) {
+		parts := lines(n)
+		for i, part := range parts {
+			parts[i] = mermaidEscape(part)
+		}
+		fmt.Fprintf(b, "  n%d[\"%s\"]\n", id, strings.Join(parts, "<br/>"))
+	}, func(parent, child int, role string) {
+		if role == "" {
+			fmt.Fprintf(b, "  n%d --> n%d\n", parent, child)
+			return
+		}
+		fmt.Fprintf(b, "  n%d -->|%s| n%d\n", parent, mermaidEscape(role), child)
+	})
+	return b.String()
+}
+
+// walk numbers the nodes depth first, calling node for each and edge for
+// each parent-child link
+func walk(root *sandbox.Node, node func(id int, n *sandbox.Node), edge func(parent, child int, role string)) {
+	next := 0
+	var visit func(n *sandbox.Node) int
+	visit = func(n *sandbox.Node) int {
+		id := next
+		next++
+		node(id, n)
+		for _, c := range n.Children {
+			edge(id, visit(c), c.Role)
+		}
+		return id
+	}
+	if root != nil {
+		visit(root)
+	}
+}
+
+// lines are the text of a node: its kind, label and source line
+func lines(n *sandbox.Node) []string {
+	result := []string{n.Kind}
+	if n.Label != "" {
+		label := []rune(n.Label)
+		if len(label) > maxLabel {
+			label = append(label[:maxLabel-1], '…')
+		}
+		result = append(result, string(label))
+	}
+	if n.Line > 0 {
+		result = append(result, fmt.Sprintf("line %d", n.Line))
+	}
+	return result
+}
+
+var dotReplacer = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+func dotEscape(s string) string {
+	return dotReplacer.Replace(s)
+}
+
+// mermaidReplacer swaps characters Mermaid would read as markup for its
+// entity codes
+var mermaidReplacer = strings.NewReplacer(`"`, "#quot;", "<", "#lt;", ">", "#gt;", "|", "#124;", "\n", " ")
+
+func mermaidEscape(s string) string {
+	return mermaidReplacer.Replace(s)
+}
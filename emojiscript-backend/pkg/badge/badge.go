@@ -0,0 +1,123 @@
+// Package badge renders shields.io-style SVG status badges.
+package badge
+
+import (
+	"fmt"
+	"html"
+	"regexp"
+	"strings"
+)
+
+// Styles are the supported badge styles; the first is the default
+var Styles = []string{"flat", "flat-square", "for-the-badge"}
+
+// colors are the shields.io named colors
+var colors = map[string]string{
+	"brightgreen": "#4c1", "green": "#97ca00", "yellowgreen": "#a4a61d", "yellow": "#dfb317",
+	"orange": "#fe7d37", "red": "#e05d44", "blue": "#007ec6", "lightgrey": "#9f9f9f",
+	"grey": "#555", "purple": "#9f5fbf",
+}
+
+var hexColor = regexp.MustCompile(`^#?([0-9a-fA-F]{3}|[0-9a-fA-F]{6})$`)
+
+// Color resolves a named or hex color, falling back to lightgrey
+func Color(name string) string {
+	if c, ok := colors[name]; ok {
+		return c
+	}
+	if hexColor.MatchString(name) {
+		return "#" + strings.TrimPrefix(name, "#")
+	}
+	return colors["lightgrey"]
+}
+
+// textWidth approximates the rendered width of s in 11px Verdana
+func textWidth(s string, bold bool) int {
+	width := 0.0
+	for _, r := range s {
+		switch {
+		case strings.ContainsRune("il.,:;|!'`", r):
+			width += 3.5
+		case strings.ContainsRune("fjrt()[]{} -", r):
+			width += 4.5
+		case r >= 'A' && r <= 'Z', strings.ContainsRune("mw@%", r):
+			width += 8
+		case r < 128:
+			width += 6.5
+		default:
+			width += 13
+		}
+	}
+	if bold {
+		width *= 1.15
+	}
+	return int(width + 0.5)
+}
+
+// Render draws a badge with a grey label on the left and the message on
+// a colored background on the right. Unknown styles render as flat.
+func Render(label, message, color, style string) string {
+	color = Color(color)
+	height, padding, radius, fontSize := 20, 6, 3, 110
+	gradient := true
+	switch style {
+	case "flat-square":
+		radius, gradient = 0, false
+	case "for-the-badge":
+		height, padding, radius, fontSize, gradient = 28, 9, 0, 100, false
+		label, message = strings.ToUpper(label), strings.ToUpper(message)
+	}
+	bold := style == "for-the-badge"
+	labelWidth := textWidth(label, bold) + 2*padding
+	messageWidth := textWidth(message, bold) + 2*padding
+	if label == "" {
+		labelWidth = 0
+	}
+	total := labelWidth + messageWidth
+	title := html.EscapeString(strings.TrimSpace(label + ": " + message))
+	if label == "" {
+		title = html.EscapeString(message)
+	}
+
+	var b strings.Builder
+	fmt.Fprintf(&b, `<svg xmlns="http://www.w3.org/2000/svg" width="%d" height="%d" role="img" aria-label="%s">`, total, height, title)
+	fmt.Fprintf(&b, `<title>%s</title>`, title)
+	if gradient {
+		b.WriteString(`<linearGradient id="s" x2="0" y2="100%"><stop offset="0" stop-color="#bbb" stop-opacity=".1"/><stop offset="1" stop-opacity=".1"/></linearGradient>`)
+	}
+	fmt.Fprintf(&b, `<clipPath id="r"><rect width="%d" height="%d" rx="%d" fill="#fff"/></clipPath>`, total, height, radius)
+	b.WriteString(`<g clip-path="url(#r)">`)
+	fmt.Fprintf(&b, `<rect width="%d" height="%d" fill="#555"/>`, labelWidth, height)
+	fmt.Fprintf(&b, `<rect x="%d" width="%d" height="%d" fill="%s"/>`, labelWidth, messageWidth, height, color)
+	if gradient {
+		fmt.Fprintf(&b, `<rect width="%d" height="%d" fill="url(#s)"/>`, total, height)
+	}
+	b.WriteString(`</g>`)
+
+	weight := ""
+	if bold {
+		weight = ` font-weight="bold"`
+	}
+	fmt.Fprintf(&b, `<g fill="#fff" text-anchor="middle" font-family="Verdana,Geneva,DejaVu Sans,sans-serif" text-rendering="geometricPrecision" font-size="%d"%s>`, fontSize, weight)
+	// text is drawn at 10x and scaled down for crisper rendering
+	baseline := (height*10)/2 + 35
+	for _, part := range []struct {
+		text     string
+		x, width int
+		show     bool
+	}{
+		{label, labelWidth / 2, labelWidth - 2*padding, label != ""},
+		{message, labelWidth + messageWidth/2, messageWidth - 2*padding, true},
+	} {
+		if !part.show {
+			continue
+		}
+		text := html.EscapeString(part.text)
+		if gradient {
+			fmt.Fprintf(&b, `<text aria-hidden="true" x="%d" y="%d" fill="#010101" fill-opacity=".3" transform="scale(.1)" textLength="%d">%s</text>`, part.x*10, baseline+10, part.width*10, text)
+		}
+		fmt.Fprintf(&b, `<text x="%d" y="%d" transform="scale(.1)" textLength="%d">%s</text>`, part.x*10, baseline, part.width*10, text)
+	}
+	b.WriteString(`</g></svg>`)
+	return b.String()
+}
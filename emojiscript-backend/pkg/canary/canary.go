@@ -0,0 +1,150 @@
+// Package canary routes plain emoji transpiles between two pipelines: the
+// syntax tree, which lexes and parses a program before writing it, and
+// the keyword replacer of the release before it. A configured percentage
+// of the traffic, per route or per API key, takes the tree and the rest
+// the replacer, so the tree can be rolled out, or rolled back, without a
+// deploy. A transpile the tree fails with an internal error falls back to
+// the replacer (see service.Caller).
+package canary
+
+import (
+	"fmt"
+	"math/rand/v2"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// The pipelines a transpile can take
+const (
+	Tree     = "tree"
+	Replacer = "replacer"
+)
+
+// Config sets the percentage of transpiles, from 0 to 100, that take the
+// tree pipeline
+type Config struct {
+	Percent float64
+	// Routes overrides Percent for a route, such as "/api/v1/transpile"
+	Routes map[string]float64
+	// Keys overrides Percent and Routes for the requests sent with an API
+	// key, by the key's name
+	Keys map[string]float64
+}
+
+// Router picks the pipeline for each transpile. A nil Router sends every
+// transpile to the tree, so callers needn't check whether a canary is
+// configured. It is safe for concurrent use.
+type Router struct {
+	config Config
+}
+
+// New creates a router, rejecting percentages outside 0 to 100
+func New(config Config) (*Router, error) {
+	check := func(name string, percent float64) error {
+		if percent < 0 || percent > 100 {
+			return fmt.Errorf("canary: %spercentage %v must be from 0 to 100", name, percent)
+		}
+		return nil
+	}
+	if err := check("", config.Percent); err != nil {
+		return nil, err
+	}
+	for route, percent := range config.Routes {
+		if err := check(route+" ", percent); err != nil {
+			return nil, err
+		}
+	}
+	for key, percent := range config.Keys {
+		if err := check("key "+key+" ", percent); err != nil {
+			return nil, err
+		}
+	}
+	return &Router{config: config}, nil
+}
+
+// FromEnv configures a router from the environment, read with getenv:
+// CANARY_PERCENT is the percentage of transpiles the tree takes, 100 when
+// unset, and CANARY_ROUTES and CANARY_KEYS override it per route and per
+// API key name as comma-separated name=percent pairs, e.g.
+// "/api/v1/transpile=10,/api/v1/notebooks/{id}/cells/{cell}/transpile=0".
+// It returns nil when none is set, sending everything to the tree.
+func FromEnv(getenv func(string) string) (*Router, error) {
+	percent, routes, keys := getenv("CANARY_PERCENT"), getenv("CANARY_ROUTES"), getenv("CANARY_KEYS")
+	if percent == "" && routes == "" && keys == "" {
+		return nil, nil
+	}
+	config := Config{Percent: 100}
+	var err error
+	if percent != "" {
+		if config.Percent, err = strconv.ParseFloat(percent, 64); err != nil {
+			return nil, fmt.Errorf("CANARY_PERCENT: %q isn't a number", percent)
+		}
+	}
+	if config.Routes, err = parsePercentages("CANARY_ROUTES", routes); err != nil {
+		return nil, err
+	}
+	if config.Keys, err = parsePercentages("CANARY_KEYS", keys); err != nil {
+		return nil, err
+	}
+	return New(config)
+}
+
+// parsePercentages reads comma-separated name=percent pairs
+func parsePercentages(variable, value string) (map[string]float64, error) {
+	percentages := map[string]float64{}
+	for _, pair := range strings.Split(value, ",") {
+		if pair = strings.TrimSpace(pair); pair == "" {
+			continue
+		}
+		name, percent, ok := strings.Cut(pair, "=")
+		if !ok || name == "" {
+			return nil, fmt.Errorf("%s: %q isn't name=percent", variable, pair)
+		}
+		p, err := strconv.ParseFloat(percent, 64)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %q isn't a number", variable, percent)
+		}
+		percentages[name] = p
+	}
+	return percentages, nil
+}
+
+// String describes the configuration, for logs
+func (r *Router) String() string {
+	describe := func(percentages map[string]float64) string {
+		pairs := make([]string, 0, len(percentages))
+		for name, percent := range percentages {
+			pairs = append(pairs, fmt.Sprintf("%s=%v%%", name, percent))
+		}
+		sort.Strings(pairs)
+		return strings.Join(pairs, " ")
+	}
+	s := fmt.Sprintf("%v%% of transpiles on the syntax tree", r.config.Percent)
+	if len(r.config.Routes) > 0 {
+		s += ", by route " + describe(r.config.Routes)
+	}
+	if len(r.config.Keys) > 0 {
+		s += ", by key " + describe(r.config.Keys)
+	}
+	return s
+}
+
+// Pipeline picks the pipeline for a transpile requested from route, with
+// the API key named key or "" without one
+func (r *Router) Pipeline(route, key string) string {
+	if r == nil {
+		return Tree
+	}
+	percent := r.config.Percent
+	if p, ok := r.config.Routes[route]; ok {
+		percent = p
+	}
+	if p, ok := r.config.Keys[key]; ok && key != "" {
+		percent = p
+	}
+	if percent >= 100 || (percent > 0 && rand.Float64()*100 < percent) {
+		return Tree
+	}
+	return Replacer
+}
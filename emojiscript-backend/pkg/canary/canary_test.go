@@ -0,0 +1,69 @@
+package canary
+
+import "testing"
+
+// TestPipeline checks that a key's percentage overrides its route's,
+// which overrides the default
+func TestPipeline(t *testing.T) {
+	r, err := New(Config{Percent: 0, Routes: map[string]float64{"/tree": 100}, Keys: map[string]float64{"alice": 100, "bob": 0}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, tt := range []struct {
+		route, key, want string
+	}{
+		{"/other", "", Replacer},
+		{"/tree", "", Tree},
+		{"/other", "alice", Tree},
+		{"/tree", "bob", Replacer},
+		{"/tree", "carol", Tree},
+	} {
+		if got := r.Pipeline(tt.route, tt.key); got != tt.want {
+			t.Errorf("Pipeline(%q, %q) = %s, want %s", tt.route, tt.key, got, tt.want)
+		}
+	}
+	if got := (*Router)(nil).Pipeline("/other", ""); got != Tree {
+		t.Errorf("nil router picked %s, want %s", got, Tree)
+	}
+
+	half, _ := New(Config{Percent: 50})
+	trees := 0
+	for i := 0; i < 1000; i++ {
+		if half.Pipeline("/other", "") == Tree {
+			trees++
+		}
+	}
+	if trees < 350 || trees > 650 {
+		t.Errorf("50%% sent %d of 1000 transpiles to the tree", trees)
+	}
+}
+
+// TestFromEnv checks the environment's settings and that bad ones are
+// refused
+func TestFromEnv(t *testing.T) {
+	env := func(vars map[string]string) func(string) string {
+		return func(name string) string { return vars[name] }
+	}
+	if r, err := FromEnv(env(nil)); r != nil || err != nil {
+		t.Errorf("no settings: got %v, %v, want no router", r, err)
+	}
+	r, err := FromEnv(env(map[string]string{"CANARY_ROUTES": " /a=10, /b/{id}=0 ,", "CANARY_KEYS": "alice=100"}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := "100% of transpiles on the syntax tree, by route /a=10% /b/{id}=0%, by key alice=100%"; r.String() != want {
+		t.Errorf("got %q, want %q", r, want)
+	}
+	for _, vars := range []map[string]string{
+		{"CANARY_PERCENT": "half"},
+		{"CANARY_PERCENT": "101"},
+		{"CANARY_ROUTES": "/a"},
+		{"CANARY_ROUTES": "=10"},
+		{"CANARY_ROUTES": "/a=-1"},
+		{"CANARY_KEYS": "alice=x"},
+	} {
+		if _, err := FromEnv(env(vars)); err == nil {
+			t.Errorf("%v: got no error", vars)
+		}
+	}
+}
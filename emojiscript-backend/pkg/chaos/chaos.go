@@ -0,0 +1,130 @@
+// Package chaos injects faults into a server for resilience testing: it
+// delays requests, fails transpiles with a parse error and makes the
+// transpile cache fail, each at a configured rate, so a client's retries
+// and back-off can be tried against a real server. It is for test
+// deployments only; a production server must never set CHAOS_MODE.
+package chaos
+
+import (
+	"fmt"
+	"math/rand/v2"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// Header names the faults injected into a response, e.g. "latency", so
+// a client under test can tell them from real ones
+const Header = "X-Chaos-Injected"
+
+// ParseErrorMessage is the error an injected parse failure reports
+const ParseErrorMessage = "chaos: injected parse error"
+
+// Config sets how often each fault is injected; a rate is a probability
+// from 0 to 1
+type Config struct {
+	// Latency is the most a delayed request waits; each waits a random
+	// time up to it
+	Latency        time.Duration
+	LatencyRate    float64
+	ParseErrorRate float64
+	// CacheFailureRate fails transpile cache lookups and stores, which
+	// then behave as if the cache were unreachable
+	CacheFailureRate float64
+}
+
+// Injector decides which faults to inject. Its methods inject nothing on
+// a nil Injector, so callers needn't check whether chaos mode is on. It
+// is safe for concurrent use.
+type Injector struct {
+	config Config
+}
+
+// New creates an injector, rejecting rates outside 0 to 1
+func New(config Config) (*Injector, error) {
+	rates := []struct {
+		name string
+		rate float64
+	}{{"latency", config.LatencyRate}, {"parse error", config.ParseErrorRate}, {"cache failure", config.CacheFailureRate}}
+	for _, r := range rates {
+		if r.rate < 0 || r.rate > 1 {
+			return nil, fmt.Errorf("chaos: %s rate %v must be from 0 to 1", r.name, r.rate)
+		}
+	}
+	if config.Latency < 0 {
+		return nil, fmt.Errorf("chaos: latency %s can't be negative", config.Latency)
+	}
+	return &Injector{config: config}, nil
+}
+
+// FromEnv configures an injector from the environment, read with getenv,
+// when CHAOS_MODE is "true": CHAOS_LATENCY (a duration such as "2s") with
+// CHAOS_LATENCY_RATE, CHAOS_PARSE_ERROR_RATE and CHAOS_CACHE_FAILURE_RATE.
+// It returns nil when CHAOS_MODE isn't set, injecting nothing.
+func FromEnv(getenv func(string) string) (*Injector, error) {
+	if getenv("CHAOS_MODE") != "true" {
+		return nil, nil
+	}
+	var config Config
+	var err error
+	if latency := getenv("CHAOS_LATENCY"); latency != "" {
+		if config.Latency, err = time.ParseDuration(latency); err != nil {
+			return nil, fmt.Errorf("CHAOS_LATENCY: %v", err)
+		}
+	}
+	rates := []struct {
+		name string
+		rate *float64
+	}{{"CHAOS_LATENCY_RATE", &config.LatencyRate}, {"CHAOS_PARSE_ERROR_RATE", &config.ParseErrorRate}, {"CHAOS_CACHE_FAILURE_RATE", &config.CacheFailureRate}}
+	for _, r := range rates {
+		if value := getenv(r.name); value != "" {
+			if *r.rate, err = strconv.ParseFloat(value, 64); err != nil {
+				return nil, fmt.Errorf("%s: %q isn't a number", r.name, value)
+			}
+		}
+	}
+	return New(config)
+}
+
+// String describes the configuration, for logs
+func (i *Injector) String() string {
+	return fmt.Sprintf("up to %s latency at %v, parse errors at %v, cache failures at %v",
+		i.config.Latency, i.config.LatencyRate, i.config.ParseErrorRate, i.config.CacheFailureRate)
+}
+
+// Delay returns how long to hold up a request, zero for most
+func (i *Injector) Delay() time.Duration {
+	if i == nil || i.config.Latency <= 0 || !happens(i.config.LatencyRate) {
+		return 0
+	}
+	return rand.N(i.config.Latency) + 1
+}
+
+// ParseError reports whether to fail a transpile with ParseErrorMessage
+func (i *Injector) ParseError() bool {
+	return i != nil && happens(i.config.ParseErrorRate)
+}
+
+// CacheFailure reports whether to fail a transpile cache operation
+func (i *Injector) CacheFailure() bool {
+	return i != nil && happens(i.config.CacheFailureRate)
+}
+
+// Middleware delays requests at the latency rate, naming the delay in
+// Header
+func (i *Injector) Middleware(next http.Handler) http.Handler {
+	if i == nil {
+		return next
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if delay := i.Delay(); delay > 0 {
+			w.Header().Add(Header, "latency="+delay.Round(time.Millisecond).String())
+			time.Sleep(delay)
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+func happens(rate float64) bool {
+	return rate > 0 && rand.Float64() < rate
+}
@@ -0,0 +1,1388 @@
+// Package codegen writes programs in the targets whose syntax isn't the
+// transpiler's JavaScript: Rust, GDScript, Python and ES5, the JavaScript
+// of engines from before ES2015. It works from the syntax tree of the
+// transpiler's JavaScript output (see sandbox.Tree), so each target
+// covers whatever the emoji and markup syntaxes can say. Types come from
+// what the program shows: literals, default values, the arguments
+// functions are called with and how parameters are used. A construct a
+// target has no direct equivalent for is written as closely as the
+// target allows, with a warning that names it and its line.
+package codegen
+
+import (
+	"fmt"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+
+	"emojiscript-backend/pkg/sandbox"
+	"emojiscript-backend/pkg/transpiler"
+)
+
+// Targets are the languages Generate writes
+var Targets = []string{"rust", "gdscript", "python", "es5"}
+
+// Generates reports whether target is one of Targets
+func Generates(target string) bool {
+	return slices.Contains(Targets, target)
+}
+
+// Program is the transpiler's JavaScript output for a program, parsed
+// once so that every target is generated from the same syntax tree
+type Program struct {
+	tree *node
+	// imports are the program's import statements, which the sandbox
+	// doesn't parse
+	imports []jsImport
+}
+
+// jsImport is an import statement as the transpiler writes one
+type jsImport struct {
+	line                                       int
+	module, specifiers, defaultName, namespace string
+}
+
+// importPattern matches an import statement as the transpiler writes
+// one: a default name, a namespace and named imports, each optional, and
+// then the module
+var importPattern = regexp.MustCompile(`^import\s+(?:(\w+)\s*,?\s*)?(?:\*\s*as\s+(\w+)\s*,?\s*)?(?:\{([^}]*)\}\s*)?(?:from\s+)?'([^']*)';?\s*$`)
+
+// Parse parses javascript, the transpiler's output for a program. Its
+// import statements are set aside, leaving blank lines so the rest keep
+// their lines, for the sandbox doesn't parse modules.
+func Parse(javascript string) (*Program, error) {
+	p := &Program{}
+	lines := strings.Split(javascript, "\n")
+	for i, line := range lines {
+		match := importPattern.FindStringSubmatch(line)
+		if match == nil {
+			continue
+		}
+		specifiers := strings.Join(strings.Fields(strings.ReplaceAll(match[3], ",", ", ")), " ")
+		p.imports = append(p.imports, jsImport{line: i + 1, module: match[4], specifiers: strings.TrimSuffix(specifiers, ","), defaultName: match[1], namespace: match[2]})
+		lines[i] = ""
+	}
+	tree, err := sandbox.Tree(strings.Join(lines, "\n"))
+	if err != nil {
+		return nil, err
+	}
+	p.tree = tree
+	return p, nil
+}
+
+// Generate writes javascript, the transpiler's output for a program, in
+// target. The warnings name each construct target has no direct
+// equivalent for, with its line in javascript; one that can't be written
+// in target without changing what it does, such as >>>=, is an error.
+func Generate(target, javascript string) (string, []string, error) {
+	p, err := Parse(javascript)
+	if err != nil {
+		return "", nil, fmt.Errorf("%s: %v", target, err)
+	}
+	return p.Generate(target)
+}
+
+// Generate writes the program in target, as the package's Generate does
+func (p *Program) Generate(target string) (string, []string, error) {
+	if len(p.imports) > 0 && target != "python" {
+		return "", nil, fmt.Errorf("%s: line %d: importing modules isn't supported", target, p.imports[0].line)
+	}
+	switch target {
+	case "rust":
+		g := &rustGen{generator: newGenerator("Rust", "    ", p.tree), uses: map[string]bool{}, this: "self", assigned: map[string][]*node{}, defaulted: map[string]bool{}}
+		g.indexLength = true
+		uses, code := g.program(p.tree)
+		if err := g.err(); err != nil {
+			return "", nil, err
+		}
+		return join(uses, transpiler.AddStdlib(code, target)), g.warnings, nil
+	case "gdscript":
+		// extends has to be the script's first statement
+		g := &gdGen{generator: newGenerator("GDScript", "\t", p.tree)}
+		code := g.program(p.tree)
+		if err := g.err(); err != nil {
+			return "", nil, err
+		}
+		return join("extends Node\n", transpiler.AddStdlib(code, target)), g.warnings, nil
+	case "python":
+		imports, err := pyImports(p.imports)
+		if err != nil {
+			return "", nil, fmt.Errorf("%s: %v", target, err)
+		}
+		// the names Python reserves are renamed in a copy, leaving the
+		// tree as the other targets see it
+		tree := clone(p.tree)
+		pyRename(tree)
+		g := &pyGen{generator: newGenerator("Python", "    ", tree), imports: map[string]bool{}, sets: map[string]bool{}}
+		modules, code := g.program(tree)
+		if err := g.err(); err != nil {
+			return "", nil, err
+		}
+		return join(modules+strings.Join(imports, "\n"), transpiler.AddStdlib(code, target)), g.warnings, nil
+	case "es5":
+		g := &es5Gen{generator: newGenerator("ES5", "  ", p.tree), used: map[string]bool{}, free: map[string]bool{}, defined: map[string]bool{}, helpers: map[string]bool{}}
+		helpers, code := g.program(p.tree)
+		if err := g.err(); err != nil {
+			return "", nil, err
+		}
+		return join(helpers, transpiler.AddStdlib(code, target)), g.warnings, nil
+	}
+	return "", nil, fmt.Errorf("unknown target '%s'", target)
+}
+
+// clone copies a syntax tree
+func clone(n *node) *node {
+	copied := *n
+	copied.Children = make([]*node, len(n.Children))
+	for i, c := range n.Children {
+		copied.Children[i] = clone(c)
+	}
+	return &copied
+}
+
+// join puts a header ahead of code, a blank line apart
+func join(header, code string) string {
+	switch {
+	case header == "":
+		return code
+	case code == "":
+		return strings.TrimRight(header, "\n") + "\n"
+	}
+	return strings.TrimRight(header, "\n") + "\n\n" + code
+}
+
+// node is a syntax tree node of the JavaScript being rewritten
+type node = sandbox.Node
+
+// Kinds are what the generators know of a value's type
+const (
+	kindInt    = "int"
+	kindFloat  = "float"
+	kindString = "string"
+	kindBool   = "bool"
+	kindObject = "object"
+	kindFunc   = "func"
+	// kindArray is followed by ":" and the element kind when it's known
+	kindArray = "array"
+	// kindClass is followed by the class name
+	kindClass = "class:"
+	// kindIndex is a Rust range loop's counter, the one integer Rust
+	// code has; every other number is an f64
+	kindIndex = "index"
+	// kindOption is followed by the kind of the value a Rust Option
+	// holds, which is the variable's kind where it's read
+	kindOption = "option:"
+)
+
+func isNumber(kind string) bool {
+	return kind == kindInt || kind == kindFloat || kind == kindIndex
+}
+
+func isArray(kind string) bool {
+	return kind == kindArray || strings.HasPrefix(kind, kindArray+":")
+}
+
+// elemKind is the kind of an array's elements, or of a string's
+// characters
+func elemKind(kind string) string {
+	if kind == kindString {
+		return kindString
+	}
+	return strings.TrimPrefix(strings.TrimPrefix(kind, kindArray), ":")
+}
+
+// numeric is the kind of arithmetic on l and r
+func numeric(l, r string) string {
+	switch {
+	case l == kindIndex && (r == kindIndex || r == kindInt), r == kindIndex && l == kindInt:
+		return kindIndex
+	case l == kindInt && r == kindInt:
+		return kindInt
+	}
+	return kindFloat
+}
+
+// field is a class field: declared in the class body, with its
+// initializer as value, or assigned to this in the constructor
+type field struct {
+	name, kind string
+	value      *node
+}
+
+// generator holds what both targets share: the output being written,
+// the warnings and what is known of the program's types
+type generator struct {
+	language string
+	indent   string
+	out      *strings.Builder
+	depth    int
+	// line is the line of the statement being written, for warnings
+	line     int
+	warnings []string
+	warned   map[string]bool
+	// errors are the constructs that can't be written in the target at
+	// all, which fail the program
+	errors []string
+
+	scopes []map[string]string
+	// funcs are the top-level functions by name: declarations and
+	// consts bound to a function
+	funcs   map[string]*node
+	classes map[string]*node
+	// records are the classes the transpiler writes for records, which
+	// the targets write as their own value types
+	records map[string]bool
+	fields  map[string][]field
+	// calls holds the argument kinds of each call of a function, class
+	// or "Class.method", which is how parameters get their types
+	calls   map[string][][]string
+	results map[*node]string
+	// shared are the names top-level functions and classes read, which
+	// top-level declarations can't keep to the program's entry point
+	shared map[string]bool
+
+	// class and result describe the class and function being written
+	class  string
+	result string
+	// label is a statement label waiting for the loop it names
+	label string
+	// indexLength makes .length an index rather than a number
+	indexLength bool
+}
+
+func newGenerator(language, indent string, root *node) *generator {
+	g := &generator{
+		language: language,
+		indent:   indent,
+		out:      &strings.Builder{},
+		warned:   map[string]bool{},
+		funcs:    map[string]*node{},
+		classes:  map[string]*node{},
+		records:  map[string]bool{},
+		fields:   map[string][]field{},
+		calls:    map[string][][]string{},
+		results:  map[*node]string{},
+		shared:   map[string]bool{},
+	}
+	for _, s := range root.Children {
+		switch s.Kind {
+		case "FunctionDeclaration":
+			g.funcs[funcName(s)] = s
+		case "ClassDeclaration":
+			g.classes[s.Label] = s
+			g.records[s.Label] = isRecord(s)
+		case "VariableDeclaration":
+			if name, fn, ok := functionConst(s); ok {
+				g.funcs[name] = fn
+			}
+		}
+	}
+	g.push()
+	for _, s := range root.Children {
+		if s.Kind == "VariableDeclaration" {
+			g.declareAll(s)
+		}
+		if s.Kind == "FunctionDeclaration" || s.Kind == "ClassDeclaration" || isFunctionConst(s) {
+			walk(s, func(n *node) bool {
+				if n.Kind == "Identifier" {
+					g.shared[n.Label] = true
+				}
+				return true
+			})
+		}
+	}
+	g.collectCalls(root)
+	return g
+}
+
+func isFunctionConst(s *node) bool {
+	_, _, ok := functionConst(s)
+	return ok
+}
+
+// emit writes a line at the current depth
+func (g *generator) emit(line string) {
+	if line != "" {
+		g.out.WriteString(strings.Repeat(g.indent, g.depth))
+	}
+	g.out.WriteString(line)
+	g.out.WriteByte('\n')
+}
+
+// capture returns what write emits instead of adding it to the output
+func (g *generator) capture(write func()) string {
+	saved := g.out
+	g.out = &strings.Builder{}
+	write()
+	captured := g.out.String()
+	g.out = saved
+	return captured
+}
+
+// warn records a construct the target has no direct equivalent for,
+// once per message
+func (g *generator) warn(format string, args ...any) {
+	message := fmt.Sprintf(format, args...)
+	if g.warned[message] {
+		return
+	}
+	g.warned[message] = true
+	if g.line > 0 {
+		message = fmt.Sprintf("Line %d: %s", g.line, message)
+	}
+	g.warnings = append(g.warnings, message)
+}
+
+// fail records a construct the target can't be written without changing
+// what the program does
+func (g *generator) fail(format string, args ...any) {
+	message := fmt.Sprintf(format, args...)
+	if g.line > 0 {
+		message = fmt.Sprintf("Line %d: %s", g.line, message)
+	}
+	g.errors = append(g.errors, message)
+}
+
+// err is the error Generate returns for the program, nil unless
+// something failed
+func (g *generator) err() error {
+	if len(g.errors) == 0 {
+		return nil
+	}
+	return fmt.Errorf("%s: %s", strings.ToLower(g.language), strings.Join(g.errors, "; "))
+}
+
+// unsupported warns that the target has no equivalent for what
+func (g *generator) unsupported(what string) {
+	g.warn("%s has no %s equivalent", what, g.language)
+}
+
+func (g *generator) push() {
+	g.scopes = append(g.scopes, map[string]string{})
+}
+
+func (g *generator) pop() {
+	g.scopes = g.scopes[:len(g.scopes)-1]
+}
+
+func (g *generator) declare(name, kind string) {
+	g.scopes[len(g.scopes)-1][name] = kind
+}
+
+func (g *generator) lookup(name string) string {
+	for i := len(g.scopes) - 1; i >= 0; i-- {
+		if kind, ok := g.scopes[i][name]; ok {
+			return kind
+		}
+	}
+	return ""
+}
+
+// declareAll declares the names a variable declaration binds
+func (g *generator) declareAll(s *node) {
+	for _, d := range childrenOf(s, "declarations") {
+		if id := child(d, "id"); id != nil && id.Kind == "Identifier" {
+			g.declare(id.Label, g.kindOf(child(d, "init")))
+		}
+	}
+}
+
+// kindOf is what is known of the type of n's value, "" when nothing is
+func (g *generator) kindOf(n *node) string {
+	if n == nil {
+		return ""
+	}
+	switch n.Kind {
+	case "Literal":
+		switch {
+		case n.Label == "true" || n.Label == "false":
+			return kindBool
+		case n.Label == "null":
+			return ""
+		case isQuoted(n.Label):
+			return kindString
+		case strings.ContainsAny(n.Label, ".eE"):
+			return kindFloat
+		}
+		return kindInt
+	case "TemplateLiteral":
+		return kindString
+	case "Identifier":
+		if g.funcs[n.Label] != nil {
+			return kindFunc
+		}
+		return strings.TrimPrefix(g.lookup(n.Label), kindOption)
+	case "ArrayExpression":
+		if elems := childrenOf(n, "elements"); len(elems) > 0 {
+			if kind := g.kindOf(elems[0]); kind != "" && kind != kindIndex {
+				return kindArray + ":" + kind
+			}
+		}
+		return kindArray
+	case "ObjectExpression":
+		return kindObject
+	case "ArrowFunctionExpression", "FunctionExpression":
+		return kindFunc
+	case "NewExpression":
+		if callee := child(n, "callee"); callee.Kind == "Identifier" {
+			switch {
+			case g.classes[callee.Label] != nil:
+				return kindClass + callee.Label
+			case callee.Label == "Map" || callee.Label == "Set" || callee.Label == "Object":
+				return kindObject
+			case callee.Label == "Array":
+				return kindArray
+			}
+		}
+	case "BinaryExpression":
+		l, r := g.kindOf(child(n, "left")), g.kindOf(child(n, "right"))
+		switch n.Label {
+		case "+":
+			if l == kindString || r == kindString {
+				return kindString
+			}
+			if isNumber(l) && isNumber(r) {
+				return numeric(l, r)
+			}
+			return ""
+		case "-", "*", "%", "**":
+			return numeric(l, r)
+		case "/":
+			return kindFloat
+		case "&", "|", "^", "<<", ">>", ">>>":
+			return kindInt
+		}
+		return kindBool
+	case "LogicalExpression":
+		l, r := g.kindOf(child(n, "left")), g.kindOf(child(n, "right"))
+		if l == kindBool && r == kindBool || l == "" {
+			return r
+		}
+		return l
+	case "UnaryExpression":
+		switch n.Label {
+		case "!", "delete":
+			return kindBool
+		case "typeof":
+			return kindString
+		case "void":
+			return ""
+		case "~":
+			return kindInt
+		}
+		if kind := g.kindOf(child(n, "argument")); isNumber(kind) {
+			return kind
+		}
+		return kindFloat
+	case "UpdateExpression":
+		if kind := g.kindOf(child(n, "argument")); isNumber(kind) {
+			return kind
+		}
+		return kindFloat
+	case "ConditionalExpression":
+		if kind := g.kindOf(child(n, "consequent")); kind != "" {
+			return kind
+		}
+		return g.kindOf(child(n, "alternate"))
+	case "AssignmentExpression":
+		return g.kindOf(child(n, "right"))
+	case "AwaitExpression":
+		return g.kindOf(child(n, "argument"))
+	case "CallExpression":
+		return g.callKind(n)
+	case "MemberExpression":
+		return g.memberKind(n)
+	}
+	return ""
+}
+
+func (g *generator) memberKind(n *node) string {
+	object, prop, ok := member(n)
+	if !ok {
+		return elemKind(g.kindOf(child(n, "object")))
+	}
+	switch {
+	case prop == "length" && g.indexLength:
+		return kindIndex
+	case prop == "length":
+		return kindInt
+	case object.Kind == "ThisExpression":
+		return g.fieldKind(g.class, prop)
+	case object.Kind == "Identifier" && object.Label == "Math":
+		return kindFloat
+	}
+	if kind := g.kindOf(object); strings.HasPrefix(kind, kindClass) {
+		return g.fieldKind(strings.TrimPrefix(kind, kindClass), prop)
+	}
+	return ""
+}
+
+func (g *generator) callKind(n *node) string {
+	callee, args := child(n, "callee"), childrenOf(n, "arguments")
+	if callee.Kind == "Identifier" {
+		switch callee.Label {
+		case "String", "prompt":
+			return kindString
+		case "Number", "parseFloat":
+			return kindFloat
+		case "parseInt":
+			return kindInt
+		case "Boolean", "isNaN":
+			return kindBool
+		}
+		if transpiler.IsStdlib(callee.Label) {
+			return stdlibKinds[callee.Label]
+		}
+		if fn := g.funcs[callee.Label]; fn != nil {
+			return g.resultKind(callee.Label, fn)
+		}
+		return ""
+	}
+	object, prop, ok := member(callee)
+	if !ok {
+		return ""
+	}
+	if object.Kind == "Identifier" && object.Label == "Math" {
+		return kindFloat
+	}
+	switch prop {
+	case "toUpperCase", "toLowerCase", "trim", "join", "toString", "toFixed", "padStart", "padEnd", "repeat", "replace", "charAt", "substring":
+		return kindString
+	case "includes", "startsWith", "endsWith", "some", "every", "has":
+		return kindBool
+	case "indexOf", "findIndex", "push":
+		return kindInt
+	case "map":
+		return kindArray
+	case "filter", "slice", "sort", "reverse", "concat":
+		return g.kindOf(object)
+	case "split":
+		return kindArray + ":" + kindString
+	case "reduce":
+		if len(args) > 1 {
+			return g.kindOf(args[1])
+		}
+	}
+	if object.Kind == "Identifier" && transpiler.IsStdlib(object.Label) {
+		return stdlibKinds[object.Label+"."+prop]
+	}
+	class := g.class
+	if object.Kind != "ThisExpression" {
+		class = ""
+		if kind := g.kindOf(object); strings.HasPrefix(kind, kindClass) {
+			class = strings.TrimPrefix(kind, kindClass)
+		} else if object.Kind == "Identifier" && g.classes[object.Label] != nil {
+			class = object.Label
+		}
+	}
+	if fn := g.method(class, prop); fn != nil {
+		saved := g.class
+		g.class = class
+		defer func() { g.class = saved }()
+		return g.resultKind(class+"."+prop, fn)
+	}
+	return ""
+}
+
+// stdlibKinds are the kinds of what the builtins' functions return
+var stdlibKinds = map[string]string{
+	"EmojiTime.now":    kindFloat,
+	"EmojiTime.format": kindString,
+	"EmojiTime.diff":   kindFloat,
+	"EmojiInput":       kindString,
+	"EmojiReadFile":    kindString,
+	"JSON.stringify":   kindString,
+}
+
+// method returns the function of a class's method, static or not
+func (g *generator) method(class, name string) *node {
+	cls := g.classes[class]
+	if cls == nil {
+		return nil
+	}
+	for _, m := range childrenOf(cls, "body") {
+		if m.Kind == "MethodDefinition" && (m.Label == name || m.Label == "static "+name || m.Label == "get "+name) {
+			return child(m, "value")
+		}
+	}
+	return nil
+}
+
+// accessor reports whether prop of object is a getter or setter of its
+// class, as accessor is "get" or "set", which Rust and GDScript write as
+// methods called where the property is read or assigned
+func (g *generator) accessor(object *node, prop, accessor string) bool {
+	class := strings.TrimPrefix(g.kindOf(object), kindClass)
+	if object.Kind == "ThisExpression" {
+		class = g.class
+	}
+	cls := g.classes[class]
+	if cls == nil {
+		return false
+	}
+	for _, m := range childrenOf(cls, "body") {
+		if m.Kind == "MethodDefinition" && m.Label == accessor+" "+prop {
+			return true
+		}
+	}
+	return false
+}
+
+// resultKind is the kind of value fn returns, key naming it in calls
+func (g *generator) resultKind(key string, fn *node) string {
+	if kind, ok := g.results[fn]; ok {
+		return kind
+	}
+	// a recursive call's result isn't known while this one is found
+	g.results[fn] = ""
+	params, body, expr := function(fn)
+	g.push()
+	for i, p := range params {
+		name, _ := param(p)
+		g.declare(name, g.paramKind(key, i, p, body, expr))
+	}
+	kind := ""
+	if expr != nil {
+		kind = g.kindOf(expr)
+	} else {
+		kind = g.returnKind(body)
+	}
+	g.pop()
+	g.results[fn] = kind
+	return kind
+}
+
+// returnKind is the kind of the first value body returns whose kind is
+// known, declaring the variables it passes on the way
+func (g *generator) returnKind(body []*node) string {
+	kind := ""
+	for _, s := range body {
+		walk(s, func(n *node) bool {
+			switch n.Kind {
+			case "FunctionDeclaration", "FunctionExpression", "ArrowFunctionExpression", "ClassDeclaration", "ClassExpression":
+				return false
+			case "VariableDeclaration":
+				g.declareAll(n)
+			case "ReturnStatement":
+				if kind == "" {
+					kind = g.kindOf(child(n, "argument"))
+				}
+			}
+			return true
+		})
+	}
+	return kind
+}
+
+// hasReturnValue reports whether body returns a value, leaving out
+// nested functions
+func hasReturnValue(body []*node) bool {
+	found := false
+	for _, s := range body {
+		walk(s, func(n *node) bool {
+			switch n.Kind {
+			case "FunctionDeclaration", "FunctionExpression", "ArrowFunctionExpression", "ClassDeclaration", "ClassExpression":
+				return false
+			case "ReturnStatement":
+				found = found || child(n, "argument") != nil
+			}
+			return !found
+		})
+	}
+	return found
+}
+
+// paramKind is the kind of the i-th parameter of the function key
+// names: its default value's, the kind every call passes, or what the
+// body does with it
+func (g *generator) paramKind(key string, i int, p *node, body []*node, expr *node) string {
+	name, def := param(p)
+	switch {
+	case p.Kind == "RestElement":
+		return kindArray
+	case def != nil:
+		return g.kindOf(def)
+	}
+	kind := ""
+	for _, args := range g.calls[key] {
+		if i >= len(args) || args[i] == "" {
+			continue
+		}
+		arg := args[i]
+		if arg == kindIndex {
+			arg = kindFloat
+		}
+		switch {
+		case kind == "" || kind == arg:
+			kind = arg
+		case isNumber(kind) && isNumber(arg):
+			kind = kindFloat
+		default:
+			return ""
+		}
+	}
+	if kind != "" {
+		return kind
+	}
+	if expr != nil {
+		body = []*node{expr}
+	}
+	return g.usageKind(name, body)
+}
+
+// usageKind is the kind body's use of name implies: arithmetic makes it
+// a number, adding it to a string a string and array methods an array
+func (g *generator) usageKind(name string, body []*node) string {
+	kind := ""
+	for _, s := range body {
+		walk(s, func(n *node) bool {
+			switch n.Kind {
+			case "BinaryExpression":
+				l, r := child(n, "left"), child(n, "right")
+				other := r
+				if !isIdent(l, name) {
+					if !isIdent(r, name) {
+						return true
+					}
+					other = l
+				}
+				switch n.Label {
+				case "-", "*", "/", "%", "**", "<", ">", "<=", ">=":
+					kind = kindFloat
+				case "+":
+					if g.kindOf(other) == kindString {
+						kind = kindString
+					} else if isNumber(g.kindOf(other)) {
+						kind = kindFloat
+					}
+				}
+			case "MemberExpression":
+				object, prop, ok := member(n)
+				if !ok || !isIdent(object, name) {
+					return true
+				}
+				switch prop {
+				case "toUpperCase", "toLowerCase", "trim", "startsWith", "endsWith", "padStart", "padEnd", "charAt", "substring", "repeat":
+					kind = kindString
+				case "push", "pop", "map", "filter", "forEach", "reduce", "join", "some", "every":
+					kind = kindArray
+				}
+			}
+			return kind == ""
+		})
+		if kind != "" {
+			break
+		}
+	}
+	return kind
+}
+
+// collectCalls records the argument kinds of each call of a function,
+// class constructor or method
+func (g *generator) collectCalls(root *node) {
+	walk(root, func(n *node) bool {
+		if n.Kind == "AssignmentExpression" && n.Label == "=" {
+			// assigning a setter calls it, as set_name in Rust and
+			// GDScript
+			object, prop, ok := member(child(n, "left"))
+			if kind := g.kindOf(object); ok && strings.HasPrefix(kind, kindClass) && g.accessor(object, prop, "set") {
+				key := strings.TrimPrefix(kind, kindClass) + ".set_" + prop
+				g.calls[key] = append(g.calls[key], []string{g.kindOf(child(n, "right"))})
+			}
+		}
+		if n.Kind != "CallExpression" && n.Kind != "NewExpression" {
+			return true
+		}
+		key, callee := "", child(n, "callee")
+		if callee.Kind == "Identifier" {
+			key = callee.Label
+		} else if object, prop, ok := member(callee); ok {
+			if kind := g.kindOf(object); strings.HasPrefix(kind, kindClass) {
+				key = strings.TrimPrefix(kind, kindClass) + "." + prop
+			} else if object.Kind == "Identifier" && g.classes[object.Label] != nil {
+				key = object.Label + "." + prop
+			}
+		}
+		if key != "" {
+			var kinds []string
+			for _, arg := range childrenOf(n, "arguments") {
+				kinds = append(kinds, g.kindOf(arg))
+			}
+			g.calls[key] = append(g.calls[key], kinds)
+		}
+		return true
+	})
+}
+
+// classFields returns a class's fields in the order they're first
+// declared or assigned
+func (g *generator) classFields(class string) []field {
+	if fields, ok := g.fields[class]; ok {
+		return fields
+	}
+	g.fields[class] = nil
+	cls := g.classes[class]
+	if cls == nil {
+		return nil
+	}
+	var fields []field
+	add := func(name, kind string, value *node) {
+		for i := range fields {
+			if fields[i].name == name {
+				if fields[i].kind == "" {
+					fields[i].kind = kind
+				}
+				return
+			}
+		}
+		fields = append(fields, field{name: name, kind: kind, value: value})
+	}
+	for _, m := range childrenOf(cls, "body") {
+		if m.Kind == "PropertyDefinition" && !strings.HasPrefix(m.Label, "static ") {
+			value := child(m, "value")
+			add(m.Label, g.kindOf(value), value)
+		}
+	}
+	if ctor := g.method(class, "constructor"); ctor != nil {
+		params, body, _ := function(ctor)
+		g.push()
+		for i, p := range params {
+			name, _ := param(p)
+			g.declare(name, g.paramKind(class, i, p, body, nil))
+		}
+		for _, s := range body {
+			if name, value, ok := thisAssignment(s); ok {
+				add(name, g.kindOf(value), nil)
+			}
+		}
+		g.pop()
+	}
+	g.fields[class] = fields
+	return fields
+}
+
+func (g *generator) fieldKind(class, name string) string {
+	for _, f := range g.classFields(class) {
+		if f.name == name {
+			return f.kind
+		}
+	}
+	return ""
+}
+
+// precedence orders operators the way JavaScript does, for deciding
+// where the rewritten expressions need parentheses
+func precedence(n *node) int {
+	switch n.Kind {
+	case "AssignmentExpression":
+		return 10
+	case "ConditionalExpression":
+		return 20
+	case "BinaryExpression", "LogicalExpression":
+		switch n.Label {
+		case "??", "||":
+			return 30
+		case "&&":
+			return 40
+		case "|":
+			return 50
+		case "^":
+			return 60
+		case "&":
+			return 70
+		case "==", "!=", "===", "!==":
+			return 80
+		case "<", ">", "<=", ">=", "instanceof", "in":
+			return 90
+		case "<<", ">>", ">>>":
+			return 100
+		case "+", "-":
+			return 110
+		case "*", "/", "%":
+			return 120
+		}
+		return 130
+	case "UnaryExpression", "AwaitExpression", "UpdateExpression":
+		return 140
+	}
+	return 200
+}
+
+// counting is a for loop over a range of integers
+type counting struct {
+	name       string
+	start, end *node
+	// step is nil for steps of one
+	step      *node
+	inclusive bool
+	down      bool
+}
+
+// countingLoop matches for (let i = start; i < end; i++) and its
+// variants: <= ends inclusive, i += step takes bigger steps, and i-- or
+// i -= step with > or >= counts down. The body mustn't change i.
+func countingLoop(s *node) (counting, bool) {
+	var c counting
+	init, test, update := child(s, "init"), child(s, "test"), child(s, "update")
+	if init == nil || init.Kind != "VariableDeclaration" || len(init.Children) != 1 || test == nil || update == nil {
+		return c, false
+	}
+	id := child(init.Children[0], "id")
+	c.start = child(init.Children[0], "init")
+	if id == nil || id.Kind != "Identifier" || c.start == nil {
+		return c, false
+	}
+	c.name = id.Label
+	if test.Kind != "BinaryExpression" || !isIdent(child(test, "left"), c.name) {
+		return c, false
+	}
+	c.end = child(test, "right")
+	switch test.Label {
+	case "<=", ">=":
+		c.inclusive = true
+	case "<", ">":
+	default:
+		return c, false
+	}
+	c.down = test.Label[0] == '>'
+	switch {
+	case update.Kind == "UpdateExpression" && isIdent(child(update, "argument"), c.name):
+		if strings.HasPrefix(update.Label, "--") != c.down {
+			return c, false
+		}
+	case update.Kind == "AssignmentExpression" && isIdent(child(update, "left"), c.name):
+		if update.Label != "+=" && update.Label != "-=" || (update.Label == "-=") != c.down {
+			return c, false
+		}
+		c.step = child(update, "right")
+		if v, ok := integer(c.step); !ok || v < 1 {
+			return c, false
+		} else if v == 1 {
+			c.step = nil
+		}
+	default:
+		return c, false
+	}
+	changed := false
+	walk(child(s, "body"), func(n *node) bool {
+		if (n.Kind == "AssignmentExpression" && isIdent(child(n, "left"), c.name)) || (n.Kind == "UpdateExpression" && isIdent(child(n, "argument"), c.name)) {
+			changed = true
+		}
+		return !changed
+	})
+	return c, !changed
+}
+
+// forEachLoop matches array.forEach(x => ...) called as a statement,
+// which both targets write as a for loop
+func forEachLoop(x *node) (array, item *node, body []*node, ok bool) {
+	if x.Kind != "CallExpression" {
+		return nil, nil, nil, false
+	}
+	object, prop, isMember := member(child(x, "callee"))
+	args := childrenOf(x, "arguments")
+	if !isMember || prop != "forEach" || len(args) != 1 || !isFunction(args[0]) || isAsync(args[0]) {
+		return nil, nil, nil, false
+	}
+	params, body, expr := function(args[0])
+	if len(params) != 1 || params[0].Kind != "Identifier" {
+		return nil, nil, nil, false
+	}
+	if expr != nil {
+		body = []*node{{Kind: "ExpressionStatement", Children: []*node{{Kind: expr.Kind, Label: expr.Label, Role: "expression", Children: expr.Children}}}}
+	}
+	return object, params[0], body, true
+}
+
+// switchExpression matches a switch expression, which the transpiler
+// writes as a function called where it's defined, its body a switch that
+// returns a value from every case. It returns the switch.
+func switchExpression(x *node) (*node, bool) {
+	if x == nil || x.Kind != "CallExpression" || len(childrenOf(x, "arguments")) > 0 {
+		return nil, false
+	}
+	fn := child(x, "callee")
+	if !isFunction(fn) || isAsync(fn) {
+		return nil, false
+	}
+	params, body, _ := function(fn)
+	if len(params) > 0 || len(body) != 1 || body[0].Kind != "SwitchStatement" {
+		return nil, false
+	}
+	s := body[0]
+	for _, c := range childrenOf(s, "cases") {
+		if caseValue(c) == nil {
+			return nil, false
+		}
+	}
+	return s, true
+}
+
+// caseValue is the value a switch expression's case returns, or nil when
+// the case does anything else
+func caseValue(c *node) *node {
+	body := childrenOf(c, "consequent")
+	if len(body) != 1 || body[0].Kind != "ReturnStatement" {
+		return nil
+	}
+	return child(body[0], "argument")
+}
+
+// assigningSwitch rewrites a switch expression's switch as one whose
+// cases assign their value to target and break, for targets whose match
+// is a statement. Without a default case the switch expression is
+// undefined, which a default case assigns.
+func assigningSwitch(s, target *node) *node {
+	rewritten := &node{Kind: s.Kind, Line: s.Line}
+	assign := func(test, value *node) *node {
+		c := &node{Kind: "SwitchCase", Role: "cases", Line: value.Line}
+		if test != nil {
+			c.Children = append(c.Children, test)
+		}
+		x := &node{Kind: "AssignmentExpression", Label: "=", Role: "expression", Line: value.Line, Children: []*node{
+			{Kind: target.Kind, Label: target.Label, Role: "left", Children: target.Children},
+			{Kind: value.Kind, Label: value.Label, Role: "right", Line: value.Line, Children: value.Children},
+		}}
+		c.Children = append(c.Children,
+			&node{Kind: "ExpressionStatement", Role: "consequent", Line: value.Line, Children: []*node{x}},
+			&node{Kind: "BreakStatement", Role: "consequent", Line: value.Line})
+		return c
+	}
+	hasDefault := false
+	for _, c := range s.Children {
+		if c.Role != "cases" {
+			rewritten.Children = append(rewritten.Children, c)
+			continue
+		}
+		test := child(c, "test")
+		hasDefault = hasDefault || test == nil
+		rewritten.Children = append(rewritten.Children, assign(test, caseValue(c)))
+	}
+	if !hasDefault {
+		rewritten.Children = append(rewritten.Children, assign(nil, &node{Kind: "Identifier", Label: "undefined", Line: s.Line}))
+	}
+	return rewritten
+}
+
+// endsAbruptly reports whether control can't run past the end of body
+func endsAbruptly(body []*node) bool {
+	if len(body) == 0 {
+		return false
+	}
+	switch last := body[len(body)-1]; last.Kind {
+	case "BreakStatement", "ContinueStatement", "ReturnStatement", "ThrowStatement":
+		return true
+	case "BlockStatement":
+		return endsAbruptly(last.Children)
+	}
+	return false
+}
+
+// caseBody is a switch case's statements without the break that ends it
+func caseBody(c *node) []*node {
+	body := childrenOf(c, "consequent")
+	if len(body) == 1 && body[0].Kind == "BlockStatement" {
+		body = body[0].Children
+	}
+	if n := len(body); n > 0 && body[n-1].Kind == "BreakStatement" && body[n-1].Label == "" {
+		body = body[:n-1]
+	}
+	return body
+}
+
+// isStdlibDefinition reports whether s defines a builtin the transpiler
+// adds to programs that use it, which each target defines its own way
+func isStdlibDefinition(s *node) bool {
+	if s.Kind != "VariableDeclaration" || len(s.Children) != 1 {
+		return false
+	}
+	id := child(s.Children[0], "id")
+	return id != nil && id.Kind == "Identifier" && transpiler.IsStdlib(id.Label)
+}
+
+// functionConst matches const name = a function, which the targets
+// write as a named function
+func functionConst(s *node) (string, *node, bool) {
+	if s.Kind != "VariableDeclaration" || s.Label != "const" || len(s.Children) != 1 {
+		return "", nil, false
+	}
+	id, init := child(s.Children[0], "id"), child(s.Children[0], "init")
+	if id == nil || id.Kind != "Identifier" || !isFunction(init) {
+		return "", nil, false
+	}
+	return id.Label, init, true
+}
+
+// isRecord reports whether cls is the class the transpiler writes for a
+// record (see transpiler.RenderRecord): a constructor that only assigns
+// each parameter to the field of its name, and an equals method that
+// compares every field
+func isRecord(cls *node) bool {
+	if child(cls, "superClass") != nil {
+		return false
+	}
+	members := childrenOf(cls, "body")
+	if len(members) != 2 || members[0].Label != "constructor" || members[1].Label != "equals" {
+		return false
+	}
+	params, body, _ := function(child(members[0], "value"))
+	if len(params) != len(body) {
+		return false
+	}
+	for i, s := range body {
+		name, value, ok := thisAssignment(s)
+		if !ok || !isIdent(params[i], name) || !isIdent(value, name) {
+			return false
+		}
+	}
+	others, body, _ := function(child(members[1], "value"))
+	return len(others) == 1 && len(body) == 1 && body[0].Kind == "ReturnStatement"
+}
+
+// recordEquals matches a.equals(b) on a record, which the targets write
+// as a comparison of the values
+func (g *generator) recordEquals(x *node) (a, b *node, ok bool) {
+	object, prop, isMember := member(child(x, "callee"))
+	args := childrenOf(x, "arguments")
+	if !isMember || prop != "equals" || len(args) != 1 {
+		return nil, nil, false
+	}
+	kind := g.kindOf(object)
+	if !strings.HasPrefix(kind, kindClass) || !g.records[strings.TrimPrefix(kind, kindClass)] {
+		return nil, nil, false
+	}
+	return object, args[0], true
+}
+
+// thisAssignment matches this.name = value as a statement
+func thisAssignment(s *node) (string, *node, bool) {
+	if s.Kind != "ExpressionStatement" {
+		return "", nil, false
+	}
+	x := child(s, "expression")
+	if x.Kind != "AssignmentExpression" || x.Label != "=" {
+		return "", nil, false
+	}
+	object, prop, ok := member(child(x, "left"))
+	if !ok || object.Kind != "ThisExpression" {
+		return "", nil, false
+	}
+	return prop, child(x, "right"), true
+}
+
+// mutatesThis reports whether a method's body assigns to a field
+func mutatesThis(body []*node) bool {
+	found := false
+	for _, s := range body {
+		walk(s, func(n *node) bool {
+			var target *node
+			switch n.Kind {
+			case "AssignmentExpression":
+				target = child(n, "left")
+			case "UpdateExpression":
+				target = child(n, "argument")
+			case "CallExpression":
+				if object, prop, ok := member(child(n, "callee")); ok && (prop == "push" || prop == "pop") {
+					target = object
+				}
+			}
+			for target != nil && target.Kind == "MemberExpression" {
+				target = child(target, "object")
+			}
+			found = found || target != nil && target.Kind == "ThisExpression"
+			return !found
+		})
+	}
+	return found
+}
+
+func child(n *node, role string) *node {
+	if n == nil {
+		return nil
+	}
+	for _, c := range n.Children {
+		if c.Role == role {
+			return c
+		}
+	}
+	return nil
+}
+
+func childrenOf(n *node, role string) []*node {
+	var children []*node
+	for _, c := range n.Children {
+		if c.Role == role {
+			children = append(children, c)
+		}
+	}
+	return children
+}
+
+// walk visits n and, while visit returns true, its descendants
+func walk(n *node, visit func(*node) bool) {
+	if n == nil || !visit(n) {
+		return
+	}
+	for _, c := range n.Children {
+		walk(c, visit)
+	}
+}
+
+func isStatement(n *node) bool {
+	return strings.HasSuffix(n.Kind, "Statement") || strings.HasSuffix(n.Kind, "Declaration")
+}
+
+func isFunction(n *node) bool {
+	return n != nil && (n.Kind == "ArrowFunctionExpression" || n.Kind == "FunctionExpression")
+}
+
+func isIdent(n *node, name string) bool {
+	return n != nil && n.Kind == "Identifier" && n.Label == name
+}
+
+// function splits a function into its parameters and body; expr is set
+// instead of body for an arrow function with an expression body
+func function(fn *node) (params, body []*node, expr *node) {
+	for _, c := range fn.Children {
+		switch {
+		case c.Role == "params":
+			params = append(params, c)
+		case c.Role == "body" && isStatement(c):
+			body = append(body, c)
+		case c.Role == "body":
+			expr = c
+		}
+	}
+	return params, body, expr
+}
+
+func isAsync(fn *node) bool {
+	return fn.Label == "async" || strings.HasPrefix(fn.Label, "async ")
+}
+
+func funcName(fn *node) string {
+	if isAsync(fn) {
+		return strings.TrimSpace(strings.TrimPrefix(fn.Label, "async"))
+	}
+	return fn.Label
+}
+
+// param returns a parameter's name and default value; name is "" for a
+// destructuring parameter
+func param(p *node) (string, *node) {
+	switch p.Kind {
+	case "Identifier":
+		return p.Label, nil
+	case "AssignmentPattern":
+		name, _ := param(child(p, "left"))
+		return name, child(p, "right")
+	case "RestElement":
+		return param(child(p, "argument"))
+	}
+	return "", nil
+}
+
+// member splits a.prop into a and prop; ok is false for a[computed]
+func member(n *node) (*node, string, bool) {
+	if n == nil || n.Kind != "MemberExpression" {
+		return nil, "", false
+	}
+	label := strings.TrimPrefix(n.Label, "?")
+	if !strings.HasPrefix(label, ".") {
+		return nil, "", false
+	}
+	return child(n, "object"), label[1:], true
+}
+
+func isQuoted(label string) bool {
+	return len(label) >= 2 && (label[0] == '\'' || label[0] == '"')
+}
+
+// stringValue returns the text of a string literal
+func stringValue(n *node) (string, bool) {
+	if n == nil || n.Kind != "Literal" || !isQuoted(n.Label) {
+		return "", false
+	}
+	inner := n.Label[1 : len(n.Label)-1]
+	var b strings.Builder
+	for i := 0; i < len(inner); i++ {
+		if inner[i] == '\\' && i+1 < len(inner) {
+			i++
+			switch inner[i] {
+			case 'n':
+				b.WriteByte('\n')
+			case 't':
+				b.WriteByte('\t')
+			default:
+				b.WriteByte(inner[i])
+			}
+			continue
+		}
+		b.WriteByte(inner[i])
+	}
+	return b.String(), true
+}
+
+func numberValue(n *node) (float64, bool) {
+	if n == nil || n.Kind != "Literal" {
+		return 0, false
+	}
+	v, err := strconv.ParseFloat(n.Label, 64)
+	return v, err == nil
+}
+
+// integer returns a number literal's value when it's a whole number
+func integer(n *node) (int64, bool) {
+	v, ok := numberValue(n)
+	if !ok || v != float64(int64(v)) {
+		return 0, false
+	}
+	return int64(v), true
+}
+
+// templateParts returns the text around a template literal's
+// expressions
+func templateParts(n *node) []string {
+	return strings.Split(strings.Trim(n.Label, "`"), "${…}")
+}
+
+// quote writes s as a double-quoted string literal as GDScript and
+// Python read it
+func quote(s string) string {
+	return quoteWith(s, `\u%04x`)
+}
+
+// rustQuote writes s as a double-quoted Rust string literal, whose
+// unicode escapes are braced
+func rustQuote(s string) string {
+	return quoteWith(s, `\u{%x}`)
+}
+
+// quoteWith writes s as a double-quoted string literal, escaping the
+// control characters without an escape of their own with escape, a
+// format for the code point. Every target reads the other escapes the
+// same way.
+func quoteWith(s, escape string) string {
+	b := &strings.Builder{}
+	b.WriteByte('"')
+	for _, r := range s {
+		switch {
+		case r == '\\' || r == '"':
+			b.WriteByte('\\')
+			b.WriteRune(r)
+		case r == '\n':
+			b.WriteString(`\n`)
+		case r == '\t':
+			b.WriteString(`\t`)
+		case r == '\r':
+			b.WriteString(`\r`)
+		case r < 0x20 || r == 0x7f:
+			fmt.Fprintf(b, escape, r)
+		default:
+			b.WriteRune(r)
+		}
+	}
+	b.WriteByte('"')
+	return b.String()
+}
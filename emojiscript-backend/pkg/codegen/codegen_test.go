@@ -0,0 +1,141 @@
+package codegen
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestQuote(t *testing.T) {
+	tests := []struct {
+		name string
+		s    string
+		want string
+		rust string
+	}{
+		{"plain", "hello", `"hello"`, `"hello"`},
+		{"quotes", `She said "hi"`, `"She said \"hi\""`, `"She said \"hi\""`},
+		{"single quotes", `it's`, `"it's"`, `"it's"`},
+		{"backslashes", `C:\temp\new`, `"C:\\temp\\new"`, `"C:\\temp\\new"`},
+		{"newline, tab and carriage return", "a\nb\tc\rd", `"a\nb\tc\rd"`, `"a\nb\tc\rd"`},
+		{"control characters", "a\x00b\x07c\x7f", `"a\u0000b\u0007c\u007f"`, `"a\u{0}b\u{7}c\u{7f}"`},
+		{"unicode", "héllo 👋 日本", `"héllo 👋 日本"`, `"héllo 👋 日本"`},
+		{"line separator", "a\u2028b", "\"a\u2028b\"", "\"a\u2028b\""},
+		{"empty", "", `""`, `""`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := quote(tt.s); got != tt.want {
+				t.Errorf("quote(%q) = %s, want %s", tt.s, got, tt.want)
+			}
+			if got := rustQuote(tt.s); got != tt.rust {
+				t.Errorf("rustQuote(%q) = %s, want %s", tt.s, got, tt.rust)
+			}
+		})
+	}
+}
+
+// TestGeneratedStrings checks that string literals keep their escapes
+// through the JavaScript syntax tree into each target
+func TestGeneratedStrings(t *testing.T) {
+	tests := []struct {
+		name       string
+		javascript string
+		want       map[string]string
+	}{
+		{
+			"quotes and backslashes",
+			`console.log("She said \"hi\" to C:\\temp")`,
+			map[string]string{
+				"rust":     `println!("She said \"hi\" to C:\\temp");`,
+				"gdscript": `print("She said \"hi\" to C:\\temp")`,
+				"python":   `print("She said \"hi\" to C:\\temp")`,
+				"es5":      `console.log("She said \"hi\" to C:\\temp");`,
+			},
+		},
+		{
+			"single-quoted",
+			`console.log('it\'s "quoted"')`,
+			map[string]string{
+				"rust":     `println!("it's \"quoted\"");`,
+				"gdscript": `print("it's \"quoted\"")`,
+				"python":   `print("it's \"quoted\"")`,
+				"es5":      `console.log("it's \"quoted\"");`,
+			},
+		},
+		{
+			"escapes",
+			`console.log("one\ntwo\tthree\x00")`,
+			map[string]string{
+				"rust":     `println!("one\ntwo\tthree\u{0}");`,
+				"gdscript": `print("one\ntwo\tthree\u0000")`,
+				"python":   `print("one\ntwo\tthree\u0000")`,
+				"es5":      `console.log("one\ntwo\tthree\u0000");`,
+			},
+		},
+		{
+			"unicode",
+			`console.log("héllo 👋 \u00e9")`,
+			map[string]string{
+				"rust":     `println!("héllo 👋 é");`,
+				"gdscript": `print("héllo 👋 é")`,
+				"python":   `print("héllo 👋 é")`,
+				"es5":      `console.log("héllo 👋 é");`,
+			},
+		},
+		{
+			// ES5 reads a line separator in a string as the end of a line
+			"line separator",
+			`console.log("a\u2028b")`,
+			map[string]string{
+				"es5": `console.log("a\u2028b");`,
+			},
+		},
+		{
+			"braces in a Rust format string",
+			`console.log("{x}")`,
+			map[string]string{
+				"rust": `println!("{{x}}");`,
+			},
+		},
+	}
+	for _, tt := range tests {
+		for target, want := range tt.want {
+			t.Run(tt.name+"/"+target, func(t *testing.T) {
+				got, _, err := Generate(target, tt.javascript)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if !strings.Contains(got, want) {
+					t.Errorf("got\n%s\nwant it to contain\n%s", got, want)
+				}
+			})
+		}
+	}
+}
+
+// TestRustOption checks that a variable that can be null is a Rust Option,
+// assigned Some value and unwrapped where it's read, so that Rust compiles
+// what ??= and ?? are written as
+func TestRustOption(t *testing.T) {
+	got, _, err := Generate("rust", `let x = null
+x ??= 5
+console.log(x)
+let name
+name ??= "guest"
+console.log(name ?? "nobody", x === null)`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{
+		"let mut x: Option<f64> = None;",
+		"if x.is_none() { x = Some(5.0); }",
+		`println!("{}", x.unwrap());`,
+		"let mut name: Option<String> = None;",
+		`if name.is_none() { name = Some("guest".to_string()); }`,
+		`println!("{} {}", name.clone().unwrap_or("nobody".to_string()), x.is_none());`,
+	} {
+		if !strings.Contains(got, want) {
+			t.Errorf("got\n%s\nwant it to contain\n%s", got, want)
+		}
+	}
+}
@@ -0,0 +1,2070 @@
+package codegen
+
+import (
+	"fmt"
+	"regexp"
+	"slices"
+	"sort"
+	"strings"
+)
+
+// es5Gen writes a program as ES5, the JavaScript engines ran before
+// ES2015. let and const become var, renamed where a block's name would
+// clash with another in its function; arrow functions become function
+// expressions that read this from the function around them; classes
+// become constructor functions with their methods on the prototype.
+// Templates, spreads, destructuring, default and rest parameters,
+// for...of, ?., ?? and the logical assignments are spelled out, ** calls
+// Math.pow, and an async function chains its awaits as promise
+// callbacks. What ES2015 added to the library is kept, with a warning
+// that ES5 engines need a polyfill for it.
+type es5Gen struct {
+	*generator
+	// frames are the functions being written, innermost last
+	frames []*es5Frame
+	// blocks map the names each block being written declares to the
+	// names they're written as, innermost last
+	blocks []map[string]string
+	// used are the names the program uses, which renamed variables and
+	// temporaries keep clear of; free are the ones it never declares,
+	// and defined the property names it gives its own objects
+	used, free, defined map[string]bool
+	// temps are the temporaries the statement being written assigns,
+	// declared ahead of it
+	temps []string
+	// helpers are the helper functions the program calls
+	helpers map[string]bool
+	// superClass is how the class being written refers to its
+	// superclass, and static is set while its static members are
+	superClass string
+	static     bool
+	// temp counts the temporaries named so far
+	temp int
+}
+
+// es5Frame is a function being written
+type es5Frame struct {
+	// live are the variable names its blocks in scope hold
+	live map[string]bool
+	// this is how the function refers to this, and arrowThis how the
+	// arrow functions in it do: the variable alias copies this into
+	this, arrowThis string
+	alias           bool
+	// nested counts the blocks around the statement being written, and
+	// loops the loops
+	nested, loops int
+	// assigned are the declarations an async function's callbacks share,
+	// which it declares at its top for them to assign
+	assigned map[*node]bool
+}
+
+// es5Helpers are the functions the ES5 a program is written as may call,
+// in the order they're defined
+var es5Helpers = []struct{ name, definition string }{
+	// __extends makes child's prototype inherit from parent's, and copies
+	// parent's static members onto child
+	{"__extends", `var __extends = function (child, parent) {
+  for (var key in parent) {
+    if (Object.prototype.hasOwnProperty.call(parent, key)) {
+      child[key] = parent[key];
+    }
+  }
+  child.prototype = Object.create(parent.prototype);
+  child.prototype.constructor = child;
+};`},
+	// __assign copies the properties of each source after target onto
+	// it, for object spread
+	{"__assign", `var __assign = function (target) {
+  for (var i = 1; i < arguments.length; i++) {
+    var source = arguments[i];
+    for (var key in source) {
+      if (Object.prototype.hasOwnProperty.call(source, key)) {
+        target[key] = source[key];
+      }
+    }
+  }
+  return target;
+};`},
+	// __rest copies the properties of source but those excluded, for a
+	// rest element in an object pattern
+	{"__rest", `var __rest = function (source, excluded) {
+  var target = {};
+  for (var key in source) {
+    if (Object.prototype.hasOwnProperty.call(source, key) && excluded.indexOf(key) < 0) {
+      target[key] = source[key];
+    }
+  }
+  return target;
+};`},
+	// __values lists what for...of and spread iterate: an array's
+	// elements, a string's characters, rather than its UTF-16 code
+	// units, a Map's entries and a Set's values
+	{"__values", `var __values = function (value) {
+  if (Array.isArray(value)) {
+    return value;
+  }
+  var values = [];
+  if (typeof value === "string") {
+    for (var i = 0; i < value.length; i++) {
+      var code = value.charCodeAt(i);
+      values.push(code >= 55296 && code < 56320 && i + 1 < value.length ? value.charAt(i) + value.charAt(++i) : value.charAt(i));
+    }
+  } else if (typeof Map !== "undefined" && value instanceof Map) {
+    value.forEach(function (item, key) {
+      values.push([key, item]);
+    });
+  } else if (value && typeof value.forEach === "function") {
+    value.forEach(function (item) {
+      values.push(item);
+    });
+  } else {
+    for (var j = 0; j < value.length; j++) {
+      values.push(value[j]);
+    }
+  }
+  return values;
+};`},
+}
+
+// es5Globals are the globals ES2015 and later added
+var es5Globals = map[string]bool{
+	"Map": true, "Set": true, "WeakMap": true, "WeakSet": true, "Promise": true,
+	"Symbol": true, "Proxy": true, "Reflect": true, "BigInt": true, "globalThis": true,
+}
+
+// es5Statics are the static functions and constants ES2015 and later
+// added to the globals ES5 has
+var es5Statics = map[string]bool{
+	"Object.assign": true, "Object.entries": true, "Object.values": true, "Object.fromEntries": true,
+	"Object.is": true, "Object.setPrototypeOf": true, "Object.getOwnPropertySymbols": true,
+	"Array.from": true, "Array.of": true,
+	"Number.isInteger": true, "Number.isNaN": true, "Number.isFinite": true, "Number.isSafeInteger": true,
+	"Number.parseFloat": true, "Number.parseInt": true, "Number.EPSILON": true,
+	"Number.MAX_SAFE_INTEGER": true, "Number.MIN_SAFE_INTEGER": true,
+	"Math.trunc": true, "Math.sign": true, "Math.cbrt": true, "Math.log2": true, "Math.log10": true,
+	"Math.hypot": true, "Math.expm1": true, "Math.log1p": true, "Math.fround": true, "Math.clz32": true,
+	"String.fromCodePoint": true, "String.raw": true,
+}
+
+// es5Methods are the methods ES2015 and later added to strings and
+// arrays, which a program's own objects may define as well
+var es5Methods = map[string]bool{
+	"includes": true, "find": true, "findIndex": true, "findLast": true, "findLastIndex": true,
+	"fill": true, "flat": true, "flatMap": true, "at": true, "copyWithin": true,
+	"startsWith": true, "endsWith": true, "padStart": true, "padEnd": true, "repeat": true,
+	"trimStart": true, "trimEnd": true, "codePointAt": true, "normalize": true, "replaceAll": true,
+	"entries": true, "keys": true, "values": true,
+}
+
+// es5Subclassed are the builtins whose constructors ignore the this a
+// subclass calls them with, so ES5 can't extend them
+var es5Subclassed = map[string]bool{
+	"Error": true, "TypeError": true, "RangeError": true, "Array": true, "Map": true, "Set": true, "Date": true, "Promise": true,
+}
+
+// es5Identifier matches a name a property can be written with after a
+// dot, or as a key without quotes
+var es5Identifier = regexp.MustCompile(`^[A-Za-z_$][A-Za-z0-9_$]*$`)
+
+// es5Index matches a key written as a number
+var es5Index = regexp.MustCompile(`^(0|[1-9][0-9]*)$`)
+
+// program writes the program, returning the helper functions it calls
+// apart, as they go ahead of any builtin definitions
+func (g *es5Gen) program(root *node) (string, string) {
+	g.scan(root)
+	f := g.enter(nil, nil, root.Children)
+	if f.alias {
+		g.emit("var " + f.arrowThis + " = this;")
+	}
+	g.bind(root.Children, true)
+	for _, s := range root.Children {
+		if !isStdlibDefinition(s) {
+			g.stmt(s)
+		}
+	}
+	g.exit()
+
+	var helpers []string
+	for _, h := range es5Helpers {
+		if g.helpers[h.name] {
+			helpers = append(helpers, h.definition)
+		}
+	}
+	code := strings.TrimRight(g.out.String(), "\n")
+	if code != "" {
+		code += "\n"
+	}
+	return strings.Join(helpers, "\n\n"), code
+}
+
+// scan notes the names the program uses and declares, and the property
+// names it defines
+func (g *es5Gen) scan(root *node) {
+	declared := map[string]bool{}
+	declare := func(pattern *node) {
+		for _, name := range boundNames(pattern) {
+			declared[name] = true
+		}
+	}
+	walk(root, func(n *node) bool {
+		switch n.Kind {
+		case "Identifier":
+			g.used[n.Label] = true
+		case "FunctionDeclaration", "FunctionExpression", "ArrowFunctionExpression":
+			if name := funcName(n); name != "" {
+				g.used[name], declared[name] = true, true
+			}
+			for _, p := range childrenOf(n, "params") {
+				declare(p)
+			}
+		case "ClassDeclaration", "ClassExpression":
+			if n.Label != "" {
+				g.used[n.Label], declared[n.Label] = true, true
+			}
+		case "VariableDeclarator":
+			declare(child(n, "id"))
+		case "ForInStatement", "ForOfStatement":
+			if n.Label != "" {
+				declare(child(n, "left"))
+			}
+		case "CatchClause":
+			declare(child(n, "param"))
+		case "MethodDefinition", "PropertyDefinition":
+			_, _, key := memberLabel(n.Label)
+			g.defined[key] = true
+		case "Property":
+			_, _, key := memberLabel(n.Label)
+			g.defined[key] = true
+		}
+		return true
+	})
+	for name := range g.used {
+		if !declared[name] {
+			g.free[name] = true
+		}
+	}
+}
+
+// boundNames are the names a declaration's target binds
+func boundNames(pattern *node) []string {
+	if pattern == nil {
+		return nil
+	}
+	switch pattern.Kind {
+	case "Identifier":
+		return []string{pattern.Label}
+	case "AssignmentPattern":
+		return boundNames(child(pattern, "left"))
+	case "RestElement":
+		return boundNames(child(pattern, "argument"))
+	case "ArrayPattern":
+		var names []string
+		for _, e := range childrenOf(pattern, "elements") {
+			names = append(names, boundNames(e)...)
+		}
+		return names
+	case "ObjectPattern":
+		var names []string
+		for _, p := range childrenOf(pattern, "properties") {
+			if p.Kind == "RestElement" {
+				names = append(names, boundNames(p)...)
+			} else {
+				names = append(names, boundNames(child(p, "value"))...)
+			}
+		}
+		return names
+	}
+	return nil
+}
+
+// blockNames are the names s declares in its block: let, const, class
+// and function declarations, for var belongs to the function
+func blockNames(s *node) []string {
+	switch s.Kind {
+	case "VariableDeclaration":
+		if s.Label == "var" {
+			return nil
+		}
+		var names []string
+		for _, d := range childrenOf(s, "declarations") {
+			names = append(names, boundNames(child(d, "id"))...)
+		}
+		return names
+	case "ClassDeclaration":
+		return []string{s.Label}
+	case "FunctionDeclaration":
+		return []string{funcName(s)}
+	}
+	return nil
+}
+
+// varNames are the names declared with var in body, leaving out the
+// functions in it
+func varNames(body []*node) []string {
+	var names []string
+	for _, s := range body {
+		walk(s, func(n *node) bool {
+			switch n.Kind {
+			case "FunctionDeclaration", "FunctionExpression", "ArrowFunctionExpression", "ClassDeclaration", "ClassExpression":
+				return false
+			case "VariableDeclaration":
+				if n.Label == "var" {
+					for _, d := range childrenOf(n, "declarations") {
+						names = append(names, boundNames(child(d, "id"))...)
+					}
+				}
+			case "ForInStatement", "ForOfStatement":
+				if n.Label == "var" {
+					names = append(names, boundNames(child(n, "left"))...)
+				}
+			}
+			return true
+		})
+	}
+	return names
+}
+
+// arrowThis reports whether the arrow functions in nodes, or with
+// direct the nodes themselves, use this or super, which an ES5 function
+// reads from a variable its enclosing function copies this into
+func arrowThis(nodes []*node, direct bool) bool {
+	found := false
+	var visit func(n *node, arrow bool)
+	visit = func(n *node, arrow bool) {
+		if n == nil || found {
+			return
+		}
+		switch n.Kind {
+		case "FunctionExpression", "FunctionDeclaration", "ClassDeclaration", "ClassExpression":
+			return
+		case "ArrowFunctionExpression":
+			arrow = true
+		case "ThisExpression", "Super":
+			found = arrow || direct
+			return
+		}
+		for _, c := range n.Children {
+			visit(c, arrow)
+		}
+	}
+	for _, n := range nodes {
+		visit(n, false)
+	}
+	return found
+}
+
+// captured reports whether a function in nodes refers to name, and so
+// keeps the variable past its block
+func captured(nodes []*node, name string) bool {
+	found := false
+	var visit func(n *node, inner bool)
+	visit = func(n *node, inner bool) {
+		if n == nil || found {
+			return
+		}
+		switch n.Kind {
+		case "FunctionDeclaration", "FunctionExpression", "ArrowFunctionExpression", "ClassDeclaration", "ClassExpression":
+			inner = true
+		case "Identifier":
+			found = inner && n.Label == name
+			return
+		}
+		for _, c := range n.Children {
+			visit(c, inner)
+		}
+	}
+	for _, n := range nodes {
+		visit(n, false)
+	}
+	return found
+}
+
+func (g *es5Gen) frame() *es5Frame {
+	return g.frames[len(g.frames)-1]
+}
+
+// enter starts writing a function, fn, or the program when fn is nil:
+// its parameters and the names it declares with var are its own, and
+// this is its own unless it's an arrow function
+func (g *es5Gen) enter(fn *node, params, body []*node) *es5Frame {
+	f := &es5Frame{live: map[string]bool{}, this: "this", arrowThis: "this", assigned: map[*node]bool{}}
+	if fn != nil && fn.Kind == "ArrowFunctionExpression" {
+		f.this = g.frame().arrowThis
+		f.arrowThis = f.this
+	} else if arrowThis(append(slices.Clone(params), body...), fn != nil && isAsync(fn)) {
+		f.alias = true
+		f.arrowThis = g.fresh("_this")
+	}
+	g.frames = append(g.frames, f)
+	names := map[string]string{}
+	for _, p := range params {
+		for _, name := range boundNames(p) {
+			names[name], f.live[name] = name, true
+		}
+	}
+	for _, name := range varNames(body) {
+		names[name], f.live[name] = name, true
+	}
+	g.blocks = append(g.blocks, names)
+	g.push()
+	return f
+}
+
+func (g *es5Gen) exit() {
+	g.pop()
+	g.blocks = g.blocks[:len(g.blocks)-1]
+	g.frames = g.frames[:len(g.frames)-1]
+}
+
+// bind declares the names body declares in the innermost block. The
+// names of a function's own block keep theirs, as var would declare
+// them, and a nested block's are renamed where the var they become
+// would take a name its function or an enclosing one uses.
+func (g *es5Gen) bind(body []*node, top bool) {
+	f, names := g.frame(), g.blocks[len(g.blocks)-1]
+	for _, s := range body {
+		for _, name := range blockNames(s) {
+			if top {
+				names[name], f.live[name] = name, true
+			} else {
+				names[name] = g.pick(name)
+			}
+		}
+	}
+}
+
+// pick names a nested block's variable: its own name, unless the
+// function holds a variable of that name, an enclosing scope declares it
+// or the program reads a global of that name, in which case a numbered
+// one
+func (g *es5Gen) pick(name string) string {
+	f := g.frame()
+	taken := func(candidate string) bool {
+		if f.live[candidate] {
+			return true
+		}
+		if candidate == name {
+			_, bound := g.lookupName(name)
+			return bound || g.free[name]
+		}
+		return g.used[candidate]
+	}
+	candidate := name
+	for i := 1; taken(candidate); i++ {
+		candidate = fmt.Sprintf("%s_%d", name, i)
+	}
+	f.live[candidate], g.used[candidate] = true, true
+	return candidate
+}
+
+// open starts a nested block declaring what body declares, and close
+// ends it. A name no function in the block keeps is free for the blocks
+// after it. One a function keeps while shared is set, as the block is a
+// loop's, or in one, is a single var for every pass where let would be
+// one per pass, which close warns of.
+func (g *es5Gen) open(body []*node) {
+	g.blocks = append(g.blocks, map[string]string{})
+	g.frame().nested++
+	g.bind(body, false)
+}
+
+func (g *es5Gen) close(body []*node, shared bool) {
+	f, names := g.frame(), g.blocks[len(g.blocks)-1]
+	g.blocks = g.blocks[:len(g.blocks)-1]
+	f.nested--
+	sorted := make([]string, 0, len(names))
+	for name := range names {
+		sorted = append(sorted, name)
+	}
+	sort.Strings(sorted)
+	for _, name := range sorted {
+		if !captured(body, name) {
+			delete(f.live, names[name])
+			continue
+		}
+		if shared {
+			g.warn("the functions made in a loop share one %s in ES5, whose var isn't per pass", name)
+		}
+	}
+}
+
+// lookupName returns what a declared name is written as
+func (g *es5Gen) lookupName(name string) (string, bool) {
+	for i := len(g.blocks) - 1; i >= 0; i-- {
+		if renamed, ok := g.blocks[i][name]; ok {
+			return renamed, true
+		}
+	}
+	return name, false
+}
+
+func (g *es5Gen) rename(name string) string {
+	renamed, _ := g.lookupName(name)
+	return renamed
+}
+
+// fresh returns a name the program doesn't use, base or base numbered
+func (g *es5Gen) fresh(base string) string {
+	name := base
+	for i := 2; g.used[name]; i++ {
+		name = fmt.Sprintf("%s%d", base, i)
+	}
+	g.used[name] = true
+	return name
+}
+
+// newTemp names a temporary, _a, _b and so on
+func (g *es5Gen) newTemp() string {
+	for {
+		name := "_" + string(rune('a'+g.temp%26))
+		if g.temp >= 26 {
+			name += fmt.Sprint(g.temp / 26)
+		}
+		g.temp++
+		if !g.used[name] {
+			g.used[name] = true
+			return name
+		}
+	}
+}
+
+// tempVar names a temporary the statement being written declares
+func (g *es5Gen) tempVar() string {
+	t := g.newTemp()
+	g.temps = append(g.temps, t)
+	return t
+}
+
+// stmt writes a statement, declaring the temporaries it assigns ahead
+// of it
+func (g *es5Gen) stmt(s *node) {
+	if s.Line > 0 {
+		g.line = s.Line
+	}
+	saved := g.temps
+	g.temps = nil
+	code := g.capture(func() { g.statement(s) })
+	if len(g.temps) > 0 {
+		g.emit("var " + strings.Join(g.temps, ", ") + ";")
+	}
+	g.out.WriteString(code)
+	g.temps = saved
+}
+
+// lines writes statements built by build, declaring the temporaries it
+// assigns ahead of them
+func (g *es5Gen) lines(build func() []string) {
+	saved := g.temps
+	g.temps = nil
+	lines := build()
+	if len(g.temps) > 0 {
+		g.emit("var " + strings.Join(g.temps, ", ") + ";")
+	}
+	for _, line := range lines {
+		g.emit(line + ";")
+	}
+	g.temps = saved
+}
+
+func (g *es5Gen) statement(s *node) {
+	f := g.frame()
+	switch s.Kind {
+	case "VariableDeclaration":
+		g.variables(s)
+	case "FunctionDeclaration":
+		name := g.rename(funcName(s))
+		if f.nested > 0 {
+			g.emit("var " + name + " = " + g.function(s, "function") + ";")
+		} else {
+			g.emit(g.function(s, "function "+name))
+		}
+	case "ClassDeclaration":
+		name := g.rename(s.Label)
+		if f.assigned[s] {
+			g.emit(name + " = " + g.classExpression(s, name) + ";")
+		} else {
+			g.class(s, name)
+		}
+	case "ExpressionStatement":
+		g.expression(child(s, "expression"))
+	case "IfStatement":
+		g.emit("if (" + g.expr(child(s, "test")) + ") {")
+		g.nested(child(s, "consequent"))
+		for alt := child(s, "alternate"); alt != nil; {
+			if alt.Kind != "IfStatement" {
+				g.emit("} else {")
+				g.nested(alt)
+				break
+			}
+			g.emit("} else if (" + g.expr(child(alt, "test")) + ") {")
+			g.nested(child(alt, "consequent"))
+			alt = child(alt, "alternate")
+		}
+		g.emit("}")
+	case "ForStatement":
+		g.forLoop(s)
+	case "ForInStatement", "ForOfStatement":
+		g.forIn(s)
+	case "WhileStatement":
+		g.emit("while (" + g.expr(child(s, "test")) + ") {")
+		g.depth++
+		g.loopBody(nil, nil, child(s, "body"))
+		g.depth--
+		g.emit("}")
+	case "DoWhileStatement":
+		g.emit("do {")
+		g.depth++
+		g.loopBody(nil, nil, child(s, "body"))
+		g.depth--
+		g.emit("} while (" + g.expr(child(s, "test")) + ");")
+	case "BlockStatement":
+		g.emit("{")
+		g.depth++
+		g.block(s.Children)
+		g.depth--
+		g.emit("}")
+	case "ReturnStatement":
+		if x := child(s, "argument"); x != nil {
+			g.emit("return " + g.expr(x) + ";")
+		} else {
+			g.emit("return;")
+		}
+	case "BreakStatement", "ContinueStatement":
+		keyword := strings.ToLower(strings.TrimSuffix(s.Kind, "Statement"))
+		if s.Label != "" {
+			keyword += " " + s.Label
+		}
+		g.emit(keyword + ";")
+	case "ThrowStatement":
+		g.emit("throw " + g.expr(child(s, "argument")) + ";")
+	case "TryStatement":
+		g.try(s)
+	case "SwitchStatement":
+		g.switchStatement(s)
+	case "LabeledStatement":
+		// the label goes straight ahead of its statement, after any
+		// temporaries the statement declares
+		g.emit(s.Label + ":")
+		g.statement(child(s, "body"))
+	case "EmptyStatement":
+		g.emit(";")
+	default:
+		g.fail("%s has no ES5 equivalent", s.Kind)
+	}
+}
+
+// nested writes the body of an if or a loop as a block
+func (g *es5Gen) nested(body *node) {
+	g.depth++
+	if body.Kind == "BlockStatement" {
+		g.block(body.Children)
+	} else {
+		g.block([]*node{body})
+	}
+	g.depth--
+}
+
+// block writes a nested block's statements, its functions first, as
+// they're hoisted to the top of it
+func (g *es5Gen) block(body []*node) {
+	g.open(body)
+	for _, s := range body {
+		if s.Kind == "FunctionDeclaration" {
+			g.stmt(s)
+		}
+	}
+	for _, s := range body {
+		if s.Kind != "FunctionDeclaration" {
+			g.stmt(s)
+		}
+	}
+	g.close(body, g.frame().loops > 0)
+}
+
+// variables writes a declaration with var. An uninitialized let in a
+// loop is set to undefined, as each pass declares it afresh.
+func (g *es5Gen) variables(s *node) {
+	f := g.frame()
+	if f.assigned[s] {
+		g.lines(func() []string {
+			var assignments []string
+			for _, d := range childrenOf(s, "declarations") {
+				if init := child(d, "init"); init != nil {
+					assignments = append(assignments, g.destructure(child(d, "id"), g.operand(init, 10), false)...)
+				}
+			}
+			return assignments
+		})
+		return
+	}
+	g.emit("var " + strings.Join(g.declarators(s), ", ") + ";")
+}
+
+// declarators writes a declaration's declarators as var's
+func (g *es5Gen) declarators(s *node) []string {
+	var list []string
+	for _, d := range childrenOf(s, "declarations") {
+		id, init := child(d, "id"), child(d, "init")
+		switch {
+		case init == nil && id.Kind == "Identifier" && s.Label != "var" && g.frame().loops > 0:
+			list = append(list, g.rename(id.Label)+" = void 0")
+		case init == nil:
+			for _, name := range boundNames(id) {
+				list = append(list, g.rename(name))
+			}
+		default:
+			list = append(list, g.destructure(id, g.operand(init, 10), true)...)
+		}
+		if id.Kind == "Identifier" {
+			g.declare(id.Label, g.kindOf(init))
+		}
+	}
+	return list
+}
+
+// destructure spells out assigning value, an expression's code, to
+// target: a name, a member or a pattern taken apart into names. Each
+// assignment is target = value, the first ones to the temporaries
+// holding what's taken apart; declare is set for a declaration, whose
+// var declares them, rather than an assignment, whose statement does.
+func (g *es5Gen) destructure(target *node, value string, declare bool) []string {
+	var out []string
+	// hold keeps value in a temporary, unless it's a name
+	hold := func() {
+		if es5Identifier.MatchString(value) {
+			return
+		}
+		t := g.newTemp()
+		if !declare {
+			g.temps = append(g.temps, t)
+		}
+		out = append(out, t+" = "+value)
+		value = t
+	}
+	switch target.Kind {
+	case "Identifier":
+		return []string{g.rename(target.Label) + " = " + value}
+	case "AssignmentPattern":
+		hold()
+		def := g.operand(child(target, "right"), 10)
+		return append(out, g.destructure(child(target, "left"), value+" === void 0 ? "+def+" : "+value, declare)...)
+	case "ObjectPattern":
+		hold()
+		var keys []string
+		for _, p := range childrenOf(target, "properties") {
+			if p.Kind == "RestElement" {
+				g.helpers["__rest"] = true
+				out = append(out, g.destructure(child(p, "argument"), "__rest("+value+", ["+strings.Join(keys, ", ")+"])", declare)...)
+				continue
+			}
+			var access string
+			if key := child(p, "key"); key != nil {
+				k := g.expr(key)
+				keys = append(keys, k)
+				access = value + "[" + k + "]"
+			} else {
+				keys = append(keys, es5Quote(p.Label))
+				access = es5Property(value, p.Label)
+			}
+			out = append(out, g.destructure(child(p, "value"), access, declare)...)
+		}
+		return out
+	case "ArrayPattern":
+		hold()
+		for i, e := range childrenOf(target, "elements") {
+			if e.Kind == "Elision" {
+				continue
+			}
+			if e.Kind == "RestElement" {
+				out = append(out, g.destructure(child(e, "argument"), fmt.Sprintf("%s.slice(%d)", value, i), declare)...)
+				continue
+			}
+			out = append(out, g.destructure(e, fmt.Sprintf("%s[%d]", value, i), declare)...)
+		}
+		return out
+	}
+	return []string{g.expr(target) + " = " + value}
+}
+
+// expression writes an expression statement. ??=, ||= and &&= are an
+// if, and destructuring assignments each assignment of their own.
+func (g *es5Gen) expression(x *node) {
+	if x.Kind == "AssignmentExpression" {
+		left, right := child(x, "left"), child(x, "right")
+		switch x.Label {
+		case "=":
+			if left.Kind == "ArrayPattern" || left.Kind == "ObjectPattern" {
+				g.lines(func() []string { return g.destructure(left, g.operand(right, 10), false) })
+				return
+			}
+		case "??=", "||=", "&&=":
+			var ref, test string
+			g.lines(func() []string {
+				var setup []string
+				setup, ref = g.reference(left)
+				return setup
+			})
+			switch x.Label {
+			case "??=":
+				test = ref + " == null"
+			case "||=":
+				test = "!" + ref
+			default:
+				test = ref
+			}
+			g.emit("if (" + test + ") {")
+			g.depth++
+			g.emit(ref + " = " + g.operand(right, 10) + ";")
+			g.depth--
+			g.emit("}")
+			return
+		}
+	}
+	code := g.expr(x)
+	if strings.HasPrefix(code, "function") || strings.HasPrefix(code, "{") {
+		code = "(" + code + ")"
+	}
+	g.emit(code + ";")
+}
+
+// reference is an assignment's target written to be read and assigned
+// without evaluating its object or computed key twice: setup assigns
+// them to temporaries when they aren't names
+func (g *es5Gen) reference(target *node) (setup []string, ref string) {
+	if target.Kind != "MemberExpression" {
+		return nil, g.expr(target)
+	}
+	object := g.operand(child(target, "object"), 200)
+	if !es5Identifier.MatchString(object) {
+		t := g.tempVar()
+		setup = append(setup, t+" = "+object)
+		object = t
+	}
+	if _, prop, ok := member(target); ok {
+		return setup, object + "." + prop
+	}
+	key := child(target, "property")
+	k := g.expr(key)
+	if key.Kind != "Literal" && !es5Identifier.MatchString(k) {
+		t := g.tempVar()
+		setup = append(setup, t+" = "+k)
+		k = t
+	}
+	return setup, object + "[" + k + "]"
+}
+
+// forLoop writes a for loop, its let and const declared in a block
+// around it
+func (g *es5Gen) forLoop(s *node) {
+	init := child(s, "init")
+	head := []*node{}
+	if init != nil {
+		head = append(head, init)
+	}
+	g.open(head)
+	first := ""
+	if init != nil && init.Kind == "VariableDeclaration" {
+		first = "var " + strings.Join(g.declarators(init), ", ")
+	} else if init != nil {
+		first = g.expr(init)
+	}
+	line := "for (" + first + ";"
+	if test := child(s, "test"); test != nil {
+		line += " " + g.expr(test)
+	}
+	line += ";"
+	if update := child(s, "update"); update != nil {
+		line += " " + g.expr(update)
+	}
+	g.emit(line + ") {")
+	var names []string
+	if init != nil {
+		names = blockNames(init)
+	}
+	g.depth++
+	wrapped := g.loopBody(names, nil, child(s, "body"))
+	g.depth--
+	g.emit("}")
+	g.close(s.Children, !wrapped)
+}
+
+// loopBody writes the body of a loop declaring names, after the
+// statements bind writes, if any. ES5's var is one variable for every
+// pass where let is one per pass, so a body whose functions keep a name
+// the loop or the body declares runs in a function called each pass with
+// the loop's names. It isn't when the body has a break, continue, return
+// or this, which such a function can't pass on, assigns the loop's names
+// or declares a var, and the functions share the names instead.
+func (g *es5Gen) loopBody(names []string, bind func() []string, body *node) (wrapped bool) {
+	f := g.frame()
+	statements := []*node{body}
+	if body.Kind == "BlockStatement" {
+		statements = body.Children
+	}
+	if bind != nil {
+		g.emit("var " + strings.Join(bind(), ", ") + ";")
+	}
+	kept := slices.ContainsFunc(names, func(name string) bool { return captured(statements, name) })
+	for _, s := range statements {
+		kept = kept || slices.ContainsFunc(blockNames(s), func(name string) bool { return captured(statements, name) })
+	}
+	if !kept || !perPass(statements, names) {
+		f.loops++
+		g.block(statements)
+		f.loops--
+		return false
+	}
+	params := make([]string, len(names))
+	for i, name := range names {
+		params[i] = g.rename(name)
+	}
+	list := strings.Join(params, ", ")
+	g.emit("(function (" + list + ") {")
+	g.depth++
+	loops := f.loops
+	f.loops = 0
+	g.block(statements)
+	f.loops = loops
+	g.depth--
+	g.emit("})(" + list + ");")
+	return true
+}
+
+// perPass reports whether a loop's body, declaring names, can run in a
+// function of its own
+func perPass(body []*node, names []string) bool {
+	ok := true
+	var visit func(n *node, loop bool)
+	visit = func(n *node, loop bool) {
+		if n == nil || !ok {
+			return
+		}
+		switch n.Kind {
+		case "FunctionDeclaration", "FunctionExpression", "ArrowFunctionExpression", "ClassDeclaration", "ClassExpression":
+			return
+		case "ReturnStatement", "ThisExpression", "Super", "AwaitExpression":
+			ok = false
+		case "BreakStatement", "ContinueStatement":
+			ok = loop && n.Label == ""
+		case "Identifier":
+			ok = n.Label != "arguments"
+		case "VariableDeclaration", "ForInStatement", "ForOfStatement":
+			ok = n.Label != "var"
+		case "AssignmentExpression", "UpdateExpression":
+			target := n.Children[0]
+			ok = !slices.ContainsFunc(boundNames(target), func(name string) bool { return slices.Contains(names, name) })
+		case "ForStatement", "WhileStatement", "DoWhileStatement", "SwitchStatement":
+			loop = true
+		}
+		if n.Kind == "ForInStatement" || n.Kind == "ForOfStatement" {
+			loop = true
+		}
+		for _, c := range n.Children {
+			visit(c, loop)
+		}
+	}
+	for _, s := range body {
+		visit(s, false)
+	}
+	return ok
+}
+
+// forIn writes for...in as it is, and for...of as a loop over an index:
+// an array's directly, and anything else's through __values
+func (g *es5Gen) forIn(s *node) {
+	f := g.frame()
+	left, right, body := child(s, "left"), child(s, "right"), child(s, "body")
+	declared := s.Label != ""
+	var names []string
+	if declared {
+		names = boundNames(left)
+	}
+	g.blocks = append(g.blocks, map[string]string{})
+	f.nested++
+	for _, name := range names {
+		if s.Label == "var" {
+			g.blocks[len(g.blocks)-1][name] = g.rename(name)
+		} else {
+			g.blocks[len(g.blocks)-1][name] = g.pick(name)
+		}
+	}
+
+	// bind assigns the item to the loop's target at the top of its body
+	var bind func() []string
+	if s.Kind == "ForInStatement" {
+		if left.Kind == "Identifier" || left.Kind == "MemberExpression" {
+			target := g.expr(left)
+			if declared {
+				target = "var " + target
+			}
+			g.emit("for (" + target + " in " + g.expr(right) + ") {")
+		} else {
+			key := g.newTemp()
+			g.emit("for (var " + key + " in " + g.expr(right) + ") {")
+			bind = func() []string { return g.destructure(left, key, declared) }
+		}
+	} else {
+		i := g.fresh("_i")
+		items := g.operand(right, 200)
+		switch {
+		case isArray(g.kindOf(right)) && es5Identifier.MatchString(items):
+			g.emit(fmt.Sprintf("for (var %s = 0; %s < %s.length; %s++) {", i, i, items, i))
+		default:
+			list := g.newTemp()
+			if !isArray(g.kindOf(right)) {
+				g.helpers["__values"] = true
+				items = "__values(" + g.expr(right) + ")"
+			}
+			g.emit(fmt.Sprintf("for (var %s = 0, %s = %s; %s < %s.length; %s++) {", i, list, items, i, list, i))
+			items = list
+		}
+		item := items + "[" + i + "]"
+		bind = func() []string { return g.destructure(left, item, declared) }
+	}
+
+	g.depth++
+	if bind != nil && !declared {
+		g.lines(bind)
+		bind = nil
+	}
+	if s.Label == "var" {
+		names = nil
+	}
+	wrapped := g.loopBody(names, bind, body)
+	g.depth--
+	g.emit("}")
+	g.close([]*node{body}, !wrapped)
+}
+
+// try writes a try statement. A catch without a parameter, or with a
+// pattern, is given a temporary.
+func (g *es5Gen) try(s *node) {
+	g.emit("try {")
+	g.nested(child(s, "block"))
+	if handler := child(s, "handler"); handler != nil {
+		param := child(handler, "param")
+		name := ""
+		var pattern *node
+		switch {
+		case param == nil:
+			name = g.newTemp()
+		case param.Kind == "Identifier":
+			name = param.Label
+		default:
+			name, pattern = g.newTemp(), param
+		}
+		g.emit("} catch (" + name + ") {")
+		g.depth++
+		scope := map[string]string{}
+		if pattern == nil && param != nil {
+			scope[name] = name
+		}
+		g.blocks = append(g.blocks, scope)
+		g.frame().nested++
+		if pattern != nil {
+			for _, n := range boundNames(pattern) {
+				scope[n] = g.pick(n)
+			}
+			g.emit("var " + strings.Join(g.destructure(pattern, name, true), ", ") + ";")
+		}
+		body := child(handler, "body")
+		g.block(body.Children)
+		g.frame().nested--
+		g.blocks = g.blocks[:len(g.blocks)-1]
+		g.depth--
+	}
+	if finalizer := child(s, "finalizer"); finalizer != nil {
+		g.emit("} finally {")
+		g.nested(finalizer)
+	}
+	g.emit("}")
+}
+
+// switchStatement writes a switch, whose cases share one block
+func (g *es5Gen) switchStatement(s *node) {
+	g.emit("switch (" + g.expr(child(s, "discriminant")) + ") {")
+	var body []*node
+	for _, c := range childrenOf(s, "cases") {
+		body = append(body, childrenOf(c, "consequent")...)
+	}
+	g.open(body)
+	g.depth++
+	for _, c := range childrenOf(s, "cases") {
+		if test := child(c, "test"); test != nil {
+			g.emit("case " + g.expr(test) + ":")
+		} else {
+			g.emit("default:")
+		}
+		g.depth++
+		for _, s := range childrenOf(c, "consequent") {
+			g.stmt(s)
+		}
+		g.depth--
+	}
+	g.depth--
+	g.close(body, g.frame().loops > 0)
+	g.emit("}")
+}
+
+// function writes fn as a function expression whose head is head:
+// "function", "function name" or an accessor's "get name". An arrow
+// function whose body is an expression is written on one line when it
+// fits there.
+func (g *es5Gen) function(fn *node, head string) string {
+	params, body, expr := function(fn)
+	if expr != nil {
+		ret := *expr
+		ret.Role = "argument"
+		body = []*node{{Kind: "ReturnStatement", Role: "body", Line: fn.Line, Children: []*node{&ret}}}
+	}
+	savedLine := g.line
+	f := g.enter(fn, params, body)
+	var list []string
+	code := g.capture(func() {
+		g.depth++
+		list = g.params(params)
+		if f.alias {
+			g.emit("var " + f.arrowThis + " = this;")
+		}
+		if isAsync(fn) {
+			g.async(body)
+		} else {
+			g.bind(body, true)
+			for _, s := range body {
+				g.stmt(s)
+			}
+		}
+		g.depth--
+	})
+	g.exit()
+	g.line = savedLine
+
+	if head == "function" {
+		head += " "
+	}
+	signature := head + "(" + strings.Join(list, ", ") + ") {"
+	switch {
+	case code == "":
+		return signature + "}"
+	case expr != nil && strings.Count(code, "\n") == 1:
+		return signature + " " + strings.TrimSpace(code) + " }"
+	}
+	return signature + "\n" + code + strings.Repeat(g.indent, g.depth) + "}"
+}
+
+// params writes a function's parameter list, and the statements at the
+// top of its body giving a default value to the parameters that have
+// one, taking apart the ones that are patterns and collecting the rest
+// parameter from arguments
+func (g *es5Gen) params(params []*node) []string {
+	var list []string
+	for i, p := range params {
+		switch p.Kind {
+		case "Identifier":
+			list = append(list, g.rename(p.Label))
+			g.declare(p.Label, "")
+		case "AssignmentPattern":
+			left, def := child(p, "left"), child(p, "right")
+			name := g.newTemp()
+			if left.Kind == "Identifier" {
+				name = g.rename(left.Label)
+				g.declare(left.Label, g.kindOf(def))
+			}
+			list = append(list, name)
+			g.emit("if (" + name + " === void 0) {")
+			g.depth++
+			g.emit(name + " = " + g.operand(def, 10) + ";")
+			g.depth--
+			g.emit("}")
+			if left.Kind != "Identifier" {
+				g.emit("var " + strings.Join(g.destructure(left, name, true), ", ") + ";")
+			}
+		case "RestElement":
+			rest := fmt.Sprintf("Array.prototype.slice.call(arguments, %d)", i)
+			g.emit("var " + strings.Join(g.destructure(child(p, "argument"), rest, true), ", ") + ";")
+			if name, _ := param(p); name != "" {
+				g.declare(name, kindArray)
+			}
+		default:
+			name := g.newTemp()
+			list = append(list, name)
+			g.emit("var " + strings.Join(g.destructure(p, name, true), ", ") + ";")
+		}
+	}
+	return list
+}
+
+// awaitStatement is a statement of an async function's body that starts
+// with an await, which ES5 writes as the end of one promise callback
+// and, unless it returns, the start of the next, which binds the awaited
+// value to target
+type awaitStatement struct {
+	value, target *node
+	returns       bool
+}
+
+// matchAwait matches an awaitStatement: await x, target = await x,
+// a declaration of one name or pattern as await x, and return await x
+func matchAwait(s *node) (awaitStatement, bool) {
+	isAwait := func(x *node) bool { return x != nil && x.Kind == "AwaitExpression" }
+	switch s.Kind {
+	case "ExpressionStatement":
+		x := child(s, "expression")
+		if isAwait(x) {
+			return awaitStatement{value: child(x, "argument")}, true
+		}
+		if x.Kind == "AssignmentExpression" && x.Label == "=" && isAwait(child(x, "right")) {
+			return awaitStatement{value: child(child(x, "right"), "argument"), target: child(x, "left")}, true
+		}
+	case "VariableDeclaration":
+		if d := childrenOf(s, "declarations"); len(d) == 1 && isAwait(child(d[0], "init")) {
+			return awaitStatement{value: child(child(d[0], "init"), "argument"), target: child(d[0], "id")}, true
+		}
+	case "ReturnStatement":
+		if x := child(s, "argument"); isAwait(x) {
+			return awaitStatement{value: child(x, "argument"), returns: true}, true
+		}
+	}
+	return awaitStatement{}, false
+}
+
+// async writes an async function's body as a promise: the statements
+// up to the first await run in its executor, which resolves with the
+// awaited value, and those up to each next await in a then callback,
+// which returns the next awaited value. The variables the body declares
+// are declared ahead of the promise, for each callback to assign. Only
+// an await that starts a statement of the body can be written so.
+func (g *es5Gen) async(body []*node) {
+	f := g.frame()
+	g.warn("ES5 has no Promise, which an async function is written with; ES5 engines need a polyfill for it")
+	g.bind(body, true)
+	var segments [][]*node
+	var awaits []awaitStatement
+	var segment []*node
+	returned := false
+	for _, s := range body {
+		a, ok := matchAwait(s)
+		if !ok {
+			segment = append(segment, s)
+			continue
+		}
+		segments, awaits, segment = append(segments, segment), append(awaits, a), nil
+		if a.returns {
+			returned = true
+			break
+		}
+	}
+	if !returned {
+		segments = append(segments, segment)
+	}
+
+	thisName := f.this
+	f.this = f.arrowThis
+	defer func() { f.this = thisName }()
+	if len(awaits) == 0 {
+		g.emit("return new Promise(function (resolve) {")
+		g.depth++
+		g.emit("resolve(function () {")
+		g.depth++
+		for _, s := range body {
+			g.stmt(s)
+		}
+		g.depth--
+		g.emit("}());")
+		g.depth--
+		g.emit("});")
+		return
+	}
+
+	// the declarations and functions of the body are shared by its
+	// callbacks
+	var names []string
+	for _, s := range body {
+		switch s.Kind {
+		case "VariableDeclaration", "ClassDeclaration":
+			f.assigned[s] = true
+			for _, name := range blockNames(s) {
+				names = append(names, g.rename(name))
+			}
+			if s.Label == "var" {
+				for _, d := range childrenOf(s, "declarations") {
+					for _, name := range boundNames(child(d, "id")) {
+						names = append(names, g.rename(name))
+					}
+				}
+			}
+		}
+	}
+	if len(names) > 0 {
+		g.emit("var " + strings.Join(names, ", ") + ";")
+	}
+	for _, s := range body {
+		if s.Kind == "FunctionDeclaration" {
+			g.stmt(s)
+		}
+	}
+
+	write := func(segment []*node, last bool) {
+		for _, s := range segment {
+			if !last {
+				walk(s, func(n *node) bool {
+					switch n.Kind {
+					case "FunctionDeclaration", "FunctionExpression", "ArrowFunctionExpression", "ClassDeclaration", "ClassExpression":
+						return false
+					case "ReturnStatement":
+						g.line = s.Line
+						g.fail("a return ahead of an async function's last await has no ES5 equivalent")
+					}
+					return true
+				})
+			}
+			if s.Kind != "FunctionDeclaration" {
+				g.stmt(s)
+			}
+		}
+	}
+	g.emit("return new Promise(function (resolve) {")
+	g.depth++
+	write(segments[0], len(segments) == 1)
+	g.emit("resolve(" + g.operand(awaits[0].value, 10) + ");")
+	g.depth--
+	for i := 1; i < len(segments); i++ {
+		a := awaits[i-1]
+		value := ""
+		if a.target != nil {
+			value = g.newTemp()
+		}
+		g.emit("}).then(function (" + value + ") {")
+		g.depth++
+		if a.target != nil {
+			g.lines(func() []string { return g.destructure(a.target, value, false) })
+		}
+		last := i == len(segments)-1
+		write(segments[i], last)
+		if i < len(awaits) {
+			g.emit("return " + g.expr(awaits[i].value) + ";")
+		}
+		g.depth--
+	}
+	g.emit("});")
+}
+
+// class writes cls, declaring it as name: a constructor function, which
+// sets the fields the class declares, with the methods on its prototype,
+// its accessors defined there with Object.defineProperty and its static
+// members on the function itself. A subclass's prototype inherits from
+// its superclass's, and it starts with a copy of the superclass's static
+// members, where ES2015 has it inherit them.
+func (g *es5Gen) class(cls *node, name string) {
+	superClass := ""
+	if sup := child(cls, "superClass"); sup != nil {
+		if sup.Kind == "Identifier" {
+			superClass = g.expr(sup)
+		} else {
+			superClass = g.fresh("_super")
+			g.emit("var " + superClass + " = " + g.operand(sup, 10) + ";")
+		}
+		if es5Subclassed[superClass] && g.free[superClass] {
+			g.unsupported("Extending " + superClass)
+		}
+	}
+	savedSuper, savedStatic := g.superClass, g.static
+	g.superClass, g.static = superClass, false
+	defer func() { g.superClass, g.static = savedSuper, savedStatic }()
+
+	members := childrenOf(cls, "body")
+	var ctor *node
+	var fields []*node
+	for _, m := range members {
+		switch {
+		case m.Kind == "MethodDefinition" && m.Label == "constructor":
+			ctor = child(m, "value")
+		case m.Kind == "PropertyDefinition" && !strings.HasPrefix(m.Label, "static "):
+			fields = append(fields, m)
+		}
+	}
+	g.emit(g.function(constructor(ctor, fields, superClass), "function "+name))
+	if superClass != "" {
+		g.helpers["__extends"] = true
+		g.emit("__extends(" + name + ", " + superClass + ");")
+	}
+
+	written := map[*node]bool{}
+	for _, m := range members {
+		if m.Kind == "MethodDefinition" && m.Label == "constructor" || written[m] {
+			continue
+		}
+		if m.Line > 0 {
+			g.line = m.Line
+		}
+		static, kind, key := memberLabel(m.Label)
+		g.static = static
+		target := name
+		if !static {
+			target += ".prototype"
+		}
+		keyNode := child(m, "key")
+		switch {
+		case m.Kind == "PropertyDefinition":
+			if !static {
+				continue
+			}
+			value := "void 0"
+			if v := child(m, "value"); v != nil {
+				value = g.operand(v, 10)
+			}
+			g.emit(g.memberOn(target, key, keyNode) + " = " + value + ";")
+		case kind == "get" || kind == "set":
+			// a getter and setter of the same name are defined together
+			accessors := []*node{m}
+			for _, other := range members {
+				s, k, name := memberLabel(other.Label)
+				if other != m && other.Kind == "MethodDefinition" && s == static && name == key && keyNode == nil && child(other, "key") == nil && (k == "get" || k == "set") {
+					accessors = append(accessors, other)
+					written[other] = true
+				}
+			}
+			property := es5Quote(key)
+			if keyNode != nil {
+				property = g.expr(keyNode)
+			}
+			g.emit("Object.defineProperty(" + target + ", " + property + ", {")
+			g.depth++
+			for _, a := range accessors {
+				_, kind, _ := memberLabel(a.Label)
+				g.emit(kind + ": " + g.function(child(a, "value"), "function") + ",")
+			}
+			g.emit("configurable: true")
+			g.depth--
+			g.emit("});")
+		default:
+			g.emit(g.memberOn(target, key, keyNode) + " = " + g.function(child(m, "value"), "function") + ";")
+		}
+	}
+}
+
+// constructor is the function a class is written as: its constructor,
+// or one that passes its arguments on to the superclass's, with the
+// class's fields set at its top or, in a subclass, after super() returns
+func constructor(ctor *node, fields []*node, superClass string) *node {
+	fn := &node{Kind: "FunctionExpression"}
+	var params, body []*node
+	switch {
+	case ctor != nil:
+		params, body, _ = function(ctor)
+		fn.Line = ctor.Line
+	case superClass != "":
+		body = []*node{{Kind: "ExpressionStatement", Role: "body", Children: []*node{
+			{Kind: "Code", Label: superClass + ".apply(this, arguments)", Role: "expression"},
+		}}}
+	}
+	var assignments []*node
+	for _, f := range fields {
+		_, _, key := memberLabel(f.Label)
+		target := &node{Kind: "MemberExpression", Label: "." + key, Role: "left", Children: []*node{{Kind: "ThisExpression", Role: "object"}}}
+		if k := child(f, "key"); k != nil {
+			computed := *k
+			computed.Role = "property"
+			target.Label = "[ ]"
+			target.Children = append(target.Children, &computed)
+		}
+		value := &node{Kind: "Code", Label: "void 0", Role: "right"}
+		if v := child(f, "value"); v != nil {
+			copied := *v
+			copied.Role = "right"
+			value = &copied
+		}
+		assignments = append(assignments, &node{Kind: "ExpressionStatement", Role: "body", Children: []*node{
+			{Kind: "AssignmentExpression", Label: "=", Role: "expression", Children: []*node{target, value}},
+		}})
+	}
+	at := 0
+	if superClass != "" {
+		at = len(body)
+		for i, s := range body {
+			if callsSuper(s) {
+				at = i + 1
+				break
+			}
+		}
+		if ctor == nil {
+			at = 1
+		}
+	}
+	body = slices.Concat(body[:at], assignments, body[at:])
+	fn.Children = append(slices.Clone(params), body...)
+	return fn
+}
+
+// callsSuper reports whether s calls the superclass's constructor
+func callsSuper(s *node) bool {
+	found := false
+	walk(s, func(n *node) bool {
+		switch n.Kind {
+		case "FunctionDeclaration", "FunctionExpression", "ClassDeclaration", "ClassExpression":
+			return false
+		case "CallExpression":
+			found = found || child(n, "callee").Kind == "Super"
+		}
+		return !found
+	})
+	return found
+}
+
+// classExpression writes a class as a function called where it's
+// defined, which returns the class
+func (g *es5Gen) classExpression(cls *node, name string) string {
+	if name == "" {
+		name = g.fresh("_class")
+	}
+	code := g.capture(func() {
+		g.depth++
+		g.class(cls, name)
+		g.emit("return " + name + ";")
+		g.depth--
+	})
+	return "(function () {\n" + code + strings.Repeat(g.indent, g.depth) + "}())"
+}
+
+// memberLabel splits the label of a class member or object property
+// into whether it's static, its kind, "get", "set" or "", and its key
+func memberLabel(label string) (static bool, kind, key string) {
+	if rest, ok := strings.CutPrefix(label, "static "); ok {
+		static, label = true, rest
+	}
+	for _, k := range []string{"get", "set"} {
+		if rest, ok := strings.CutPrefix(label, k+" "); ok {
+			return static, k, rest
+		}
+	}
+	return static, "", label
+}
+
+// memberOn is property key of object, computed when keyNode is set
+func (g *es5Gen) memberOn(object, key string, keyNode *node) string {
+	if keyNode != nil {
+		return object + "[" + g.expr(keyNode) + "]"
+	}
+	return es5Property(object, key)
+}
+
+// es5Property is object's property key
+func es5Property(object, key string) string {
+	if es5Identifier.MatchString(key) {
+		return object + "." + key
+	}
+	return object + "[" + es5Quote(key) + "]"
+}
+
+// es5Key writes a property's key in an object literal
+func es5Key(key string) string {
+	if es5Identifier.MatchString(key) || es5Index.MatchString(key) {
+		return key
+	}
+	return es5Quote(key)
+}
+
+// es5Quote writes s as a string literal. ES5 reads a line or paragraph
+// separator as the end of a line, so they're escaped too.
+func es5Quote(s string) string {
+	return strings.NewReplacer("\u2028", `\u2028`, "\u2029", `\u2029`).Replace(quote(s))
+}
+
+// prec is how tightly n's ES5 binds, as precedence orders JavaScript's:
+// what ES5 spells out as a call is one, and as a conditional one
+func (g *es5Gen) prec(n *node) int {
+	switch n.Kind {
+	case "SequenceExpression":
+		return 5
+	case "BinaryExpression":
+		if n.Label == "**" {
+			return 200
+		}
+	case "LogicalExpression":
+		if n.Label == "??" {
+			return 20
+		}
+	case "TemplateLiteral":
+		if len(childrenOf(n, "expressions")) > 0 {
+			return 110
+		}
+		return 200
+	case "MemberExpression", "CallExpression":
+		for x := n; x != nil && (x.Kind == "MemberExpression" || x.Kind == "CallExpression"); x = chainChild(x) {
+			if isOptional(x) {
+				return 20
+			}
+		}
+		return 200
+	}
+	return precedence(n)
+}
+
+// operand writes n, in parentheses when it binds less tightly than min
+func (g *es5Gen) operand(n *node, min int) string {
+	code := g.expr(n)
+	if g.prec(n) < min {
+		return "(" + code + ")"
+	}
+	return code
+}
+
+// object writes n as what a property is read from or a function
+// called: parenthesized when it's a function, a class, a number literal
+// or binds less tightly than a member
+func (g *es5Gen) object(n *node) string {
+	code := g.operand(n, 200)
+	switch {
+	case n.Kind == "FunctionExpression" || n.Kind == "ArrowFunctionExpression" || n.Kind == "ClassExpression":
+		return "(" + code + ")"
+	case n.Kind == "Literal" && es5Index.MatchString(code):
+		return "(" + code + ")"
+	}
+	return code
+}
+
+func (g *es5Gen) expr(n *node) string {
+	switch n.Kind {
+	case "Literal":
+		if s, ok := stringValue(n); ok {
+			return es5Quote(s)
+		}
+		return n.Label
+	case "Code":
+		return n.Label
+	case "Identifier":
+		if g.free[n.Label] && es5Globals[n.Label] {
+			g.warn("ES5 has no %s; ES5 engines need a polyfill for it", n.Label)
+		}
+		return g.rename(n.Label)
+	case "ThisExpression":
+		return g.frame().this
+	case "TemplateLiteral":
+		return g.template(n)
+	case "ArrayExpression":
+		return g.array(childrenOf(n, "elements"))
+	case "ObjectExpression":
+		return g.objectLiteral(n)
+	case "FunctionExpression", "ArrowFunctionExpression":
+		head := "function"
+		if name := funcName(n); name != "" {
+			head += " " + name
+		}
+		return g.function(n, head)
+	case "ClassExpression":
+		return g.classExpression(n, n.Label)
+	case "UnaryExpression":
+		arg := g.operand(child(n, "argument"), 140)
+		switch {
+		case n.Label == "typeof" || n.Label == "void" || n.Label == "delete":
+			return n.Label + " " + arg
+		case (n.Label == "-" || n.Label == "+") && strings.HasPrefix(arg, n.Label):
+			// - -x rather than --x
+			return n.Label + " " + arg
+		}
+		return n.Label + arg
+	case "UpdateExpression":
+		op, fix, _ := strings.Cut(n.Label, " ")
+		arg := g.operand(child(n, "argument"), 140)
+		if fix == "(prefix)" {
+			return op + arg
+		}
+		return arg + op
+	case "BinaryExpression", "LogicalExpression":
+		left, right := child(n, "left"), child(n, "right")
+		switch n.Label {
+		case "**":
+			return "Math.pow(" + g.operand(left, 10) + ", " + g.operand(right, 10) + ")"
+		case "??":
+			value := g.operand(left, 200)
+			test := value
+			if !es5Identifier.MatchString(value) {
+				t := g.tempVar()
+				test, value = "("+t+" = "+g.operand(left, 10)+")", t
+			}
+			return test + " != null ? " + value + " : " + g.operand(right, 10)
+		}
+		p := precedence(n)
+		return g.operand(left, p) + " " + n.Label + " " + g.operand(right, p+1)
+	case "ConditionalExpression":
+		return g.operand(child(n, "test"), 30) + " ? " + g.operand(child(n, "consequent"), 10) + " : " + g.operand(child(n, "alternate"), 10)
+	case "AssignmentExpression":
+		return g.assignment(n)
+	case "MemberExpression", "CallExpression":
+		if code, ok := g.optional(n); ok {
+			return code
+		}
+		if n.Kind == "CallExpression" {
+			return g.call(n)
+		}
+		return g.member(n)
+	case "NewExpression":
+		callee, args := child(n, "callee"), childrenOf(n, "arguments")
+		c := g.object(callee)
+		for x := callee; x != nil && !strings.HasPrefix(c, "("); x = chainChild(x) {
+			if x.Kind == "CallExpression" {
+				c = "(" + c + ")"
+			}
+		}
+		if hasSpread(args) {
+			return "new (Function.prototype.bind.apply(" + c + ", " + g.array(append([]*node{{Kind: "Code", Label: "null"}}, args...)) + "))()"
+		}
+		return "new " + c + "(" + g.args(args) + ")"
+	case "SequenceExpression":
+		var list []string
+		for _, x := range childrenOf(n, "expressions") {
+			list = append(list, g.operand(x, 10))
+		}
+		return strings.Join(list, ", ")
+	case "AwaitExpression":
+		g.fail("await has no ES5 equivalent unless it starts a statement of an async function's body")
+		return g.expr(child(n, "argument"))
+	case "Super":
+		g.fail("super has no ES5 equivalent outside a class")
+		return "super"
+	}
+	g.fail("%s has no ES5 equivalent", n.Kind)
+	return ""
+}
+
+// template writes a template literal as a concatenation, which starts
+// with a string so that every value is converted to one
+func (g *es5Gen) template(n *node) string {
+	parts, exprs := templateParts(n), childrenOf(n, "expressions")
+	var terms []string
+	for i, x := range exprs {
+		if parts[i] != "" || i == 0 && (len(parts) < 2 || parts[1] == "") {
+			terms = append(terms, es5Quote(parts[i]))
+		}
+		terms = append(terms, g.operand(x, 111))
+	}
+	if last := parts[len(exprs)]; last != "" || len(exprs) == 0 {
+		terms = append(terms, es5Quote(last))
+	}
+	return strings.Join(terms, " + ")
+}
+
+func hasSpread(nodes []*node) bool {
+	return slices.ContainsFunc(nodes, func(n *node) bool { return n.Kind == "SpreadElement" })
+}
+
+func (g *es5Gen) args(args []*node) string {
+	list := make([]string, len(args))
+	for i, a := range args {
+		list[i] = g.operand(a, 10)
+	}
+	return strings.Join(list, ", ")
+}
+
+// array writes an array literal. With spread elements it's the runs of
+// the other elements concatenated with what's spread, an array as it is
+// and anything else through __values.
+func (g *es5Gen) array(elems []*node) string {
+	if !hasSpread(elems) {
+		return "[" + g.args(elems) + "]"
+	}
+	var parts, run []string
+	flush := func() {
+		if len(run) > 0 {
+			parts = append(parts, "["+strings.Join(run, ", ")+"]")
+			run = nil
+		}
+	}
+	for _, e := range elems {
+		if e.Kind != "SpreadElement" {
+			run = append(run, g.operand(e, 10))
+			continue
+		}
+		flush()
+		x := child(e, "argument")
+		if isArray(g.kindOf(x)) {
+			parts = append(parts, g.operand(x, 10))
+		} else {
+			g.helpers["__values"] = true
+			parts = append(parts, "__values("+g.operand(x, 10)+")")
+		}
+	}
+	flush()
+	if strings.HasPrefix(parts[0], "[") && elems[0].Kind != "SpreadElement" {
+		if len(parts) == 1 {
+			return parts[0]
+		}
+		return parts[0] + ".concat(" + strings.Join(parts[1:], ", ") + ")"
+	}
+	return "[].concat(" + strings.Join(parts, ", ") + ")"
+}
+
+// objectLiteral writes an object literal. ES5 has getters and setters in
+// object literals, but no computed keys or spread: an object with either
+// is built in a temporary, its properties assigned in order, those it
+// spreads copied with __assign and its accessors defined.
+func (g *es5Gen) objectLiteral(n *node) string {
+	props := childrenOf(n, "properties")
+	lowered := slices.ContainsFunc(props, func(p *node) bool { return p.Kind == "SpreadElement" || child(p, "key") != nil })
+	if !lowered {
+		return g.properties(props)
+	}
+	t := g.tempVar()
+	first := 0
+	for first < len(props) && props[first].Kind != "SpreadElement" && child(props[first], "key") == nil {
+		first++
+	}
+	steps := []string{t + " = " + g.properties(props[:first])}
+	for _, p := range props[first:] {
+		if p.Kind == "SpreadElement" {
+			g.helpers["__assign"] = true
+			steps = append(steps, "__assign("+t+", "+g.operand(child(p, "argument"), 10)+")")
+			continue
+		}
+		_, kind, key := memberLabel(p.Label)
+		keyNode := child(p, "key")
+		if kind == "" {
+			steps = append(steps, g.memberOn(t, key, keyNode)+" = "+g.value(key, child(p, "value")))
+			continue
+		}
+		property := es5Quote(key)
+		if keyNode != nil {
+			property = g.expr(keyNode)
+		}
+		steps = append(steps, "Object.defineProperty("+t+", "+property+", { "+kind+": "+g.function(child(p, "value"), "function")+", enumerable: true, configurable: true })")
+	}
+	return "(" + strings.Join(append(steps, t), ", ") + ")"
+}
+
+// properties writes an object literal of plain properties, one to a
+// line when any of them takes more than one
+func (g *es5Gen) properties(props []*node) string {
+	if len(props) == 0 {
+		return "{}"
+	}
+	g.depth++
+	entries := make([]string, len(props))
+	multiline := false
+	for i, p := range props {
+		_, kind, key := memberLabel(p.Label)
+		value := child(p, "value")
+		if kind != "" {
+			entries[i] = g.function(value, kind+" "+es5Key(key))
+		} else {
+			entries[i] = es5Key(key) + ": " + g.value(key, value)
+		}
+		multiline = multiline || strings.Contains(entries[i], "\n")
+	}
+	g.depth--
+	if !multiline {
+		return "{ " + strings.Join(entries, ", ") + " }"
+	}
+	indent := strings.Repeat(g.indent, g.depth)
+	return "{\n" + indent + g.indent + strings.Join(entries, ",\n"+indent+g.indent) + "\n" + indent + "}"
+}
+
+// value writes the value of an object's property key. A method is a
+// function whose name its body doesn't see, as a named function
+// expression's does.
+func (g *es5Gen) value(key string, value *node) string {
+	if value.Kind == "FunctionExpression" && funcName(value) == key {
+		return g.function(value, "function")
+	}
+	return g.operand(value, 10)
+}
+
+// assignment writes an assignment expression: a destructuring one as a
+// sequence of assignments whose value is what was taken apart, ??=, ||=
+// and &&= as the logical expression that assigns, and **= with Math.pow
+func (g *es5Gen) assignment(n *node) string {
+	left, right := child(n, "left"), child(n, "right")
+	switch {
+	case left.Kind == "ArrayPattern" || left.Kind == "ObjectPattern":
+		t := g.tempVar()
+		steps := append([]string{t + " = " + g.operand(right, 10)}, g.destructure(left, t, false)...)
+		return "(" + strings.Join(append(steps, t), ", ") + ")"
+	case n.Label == "??=" || n.Label == "||=" || n.Label == "&&=" || n.Label == "**=":
+		setup, ref := g.reference(left)
+		value := g.operand(right, 10)
+		var x string
+		switch n.Label {
+		case "??=":
+			x = ref + " != null ? " + ref + " : (" + ref + " = " + value + ")"
+		case "||=":
+			x = ref + " || (" + ref + " = " + value + ")"
+		case "&&=":
+			x = ref + " && (" + ref + " = " + value + ")"
+		default:
+			x = ref + " = Math.pow(" + ref + ", " + value + ")"
+		}
+		if len(setup) > 0 {
+			return "(" + strings.Join(append(setup, x), ", ") + ")"
+		}
+		return x
+	}
+	return g.expr(left) + " " + n.Label + " " + g.operand(right, 10)
+}
+
+// chainChild is the link below n in an optional chain
+func chainChild(n *node) *node {
+	switch n.Kind {
+	case "MemberExpression":
+		return child(n, "object")
+	case "CallExpression":
+		return child(n, "callee")
+	}
+	return nil
+}
+
+func isOptional(n *node) bool {
+	return n.Kind == "MemberExpression" && strings.HasPrefix(n.Label, "?") || n.Kind == "CallExpression" && n.Label == "?."
+}
+
+// optional writes a chain of members and calls with an optional link,
+// the innermost one, as a test of what it's read from, or the function
+// it calls, for null: the chain is undefined if it's null, and otherwise
+// read with the link made a plain one. The links above it are written
+// the same way in turn.
+func (g *es5Gen) optional(n *node) (string, bool) {
+	var link *node
+	for x := n; x != nil && (x.Kind == "MemberExpression" || x.Kind == "CallExpression"); x = chainChild(x) {
+		if isOptional(x) {
+			link = x
+		}
+	}
+	if link == nil {
+		return "", false
+	}
+	// hold keeps the code of x in a temporary, unless it's a name
+	hold := func(code string) (test, value string) {
+		if es5Identifier.MatchString(code) {
+			return code, code
+		}
+		t := g.tempVar()
+		return "(" + t + " = " + code + ")", t
+	}
+	var test string
+	plain := &node{Kind: link.Kind, Role: link.Role}
+	if link.Kind == "MemberExpression" {
+		object := child(link, "object")
+		var value string
+		test, value = hold(g.object(object))
+		plain.Label = strings.TrimPrefix(link.Label, "?")
+		plain.Children = []*node{{Kind: "Code", Label: value, Role: "object"}}
+		if property := child(link, "property"); property != nil {
+			plain.Children = append(plain.Children, property)
+		}
+	} else {
+		callee, args := child(link, "callee"), childrenOf(link, "arguments")
+		if callee.Kind == "MemberExpression" && child(callee, "object").Kind != "Super" {
+			// the function is called on what it's read from
+			object, value := g.object(child(callee, "object")), ""
+			if !es5Identifier.MatchString(object) {
+				value = g.tempVar()
+				object = "(" + value + " = " + object + ")"
+			} else {
+				value = object
+			}
+			fn := g.tempVar()
+			_, prop, ok := member(callee)
+			read := object + "." + prop
+			if !ok {
+				read = object + "[" + g.expr(child(callee, "property")) + "]"
+			}
+			test = "(" + fn + " = " + read + ")"
+			plain = &node{Kind: "Code", Label: g.invoke(fn, value, args), Role: link.Role}
+		} else {
+			var value string
+			test, value = hold(g.object(callee))
+			plain.Children = append([]*node{{Kind: "Code", Label: value, Role: "callee"}}, args...)
+		}
+	}
+	rest := replaceLink(n, link, plain)
+	return test + " == null ? void 0 : " + g.operand(rest, 10), true
+}
+
+// replaceLink copies the chain n with its link old replaced by with
+func replaceLink(n, old, with *node) *node {
+	if n == old {
+		return with
+	}
+	copied := *n
+	copied.Children = slices.Clone(n.Children)
+	below := chainChild(n)
+	for i, c := range copied.Children {
+		if c == below {
+			copied.Children[i] = replaceLink(c, old, with)
+		}
+	}
+	return &copied
+}
+
+// member writes a property read, warning of the ES2015 library
+func (g *es5Gen) member(n *node) string {
+	object := child(n, "object")
+	if object.Kind == "Super" {
+		return g.superMember(n)
+	}
+	if _, prop, ok := member(n); ok {
+		static := object.Kind == "Identifier" && g.free[object.Label]
+		switch {
+		case static && es5Statics[object.Label+"."+prop]:
+			g.warn("ES5 has no %s.%s; ES5 engines need a polyfill for it", object.Label, prop)
+		case !static && es5Methods[prop] && !g.defined[prop]:
+			g.warn("ES5 has no .%s(); ES5 engines need a polyfill for it", prop)
+		}
+		return g.object(object) + "." + prop
+	}
+	return g.object(object) + "[" + g.expr(child(n, "property")) + "]"
+}
+
+// superMember is a property of the superclass's prototype, or of the
+// superclass itself in a static member
+func (g *es5Gen) superMember(n *node) string {
+	if g.superClass == "" {
+		g.fail("super has no ES5 equivalent outside a class")
+	}
+	base := g.superClass
+	if !g.static {
+		base += ".prototype"
+	}
+	if _, prop, ok := member(n); ok {
+		return base + "." + prop
+	}
+	return base + "[" + g.expr(child(n, "property")) + "]"
+}
+
+// call writes a call. A call with a spread argument passes its arguments
+// as an array to apply, and super's constructor and methods are called
+// on this.
+func (g *es5Gen) call(n *node) string {
+	callee, args := child(n, "callee"), childrenOf(n, "arguments")
+	switch {
+	case callee.Kind == "Super":
+		if g.superClass == "" {
+			g.fail("super has no ES5 equivalent outside a class")
+		}
+		return g.invoke(g.superClass, g.frame().this, args)
+	case callee.Kind == "MemberExpression" && child(callee, "object").Kind == "Super":
+		return g.invoke(g.superMember(callee), g.frame().this, args)
+	case hasSpread(args) && callee.Kind == "MemberExpression":
+		object := g.object(child(callee, "object"))
+		value := object
+		if !es5Identifier.MatchString(object) {
+			value = g.tempVar()
+			object = "(" + value + " = " + object + ")"
+		}
+		fn := g.memberOn(object, strings.TrimPrefix(callee.Label, "."), child(callee, "property"))
+		return fn + ".apply(" + value + ", " + g.array(args) + ")"
+	case hasSpread(args):
+		return g.object(callee) + ".apply(void 0, " + g.array(args) + ")"
+	}
+	return g.object(callee) + "(" + g.args(args) + ")"
+}
+
+// invoke calls fn with this as its this
+func (g *es5Gen) invoke(fn, this string, args []*node) string {
+	if hasSpread(args) {
+		return fn + ".apply(" + this + ", " + g.array(args) + ")"
+	}
+	if len(args) == 0 {
+		return fn + ".call(" + this + ")"
+	}
+	return fn + ".call(" + this + ", " + g.args(args) + ")"
+}
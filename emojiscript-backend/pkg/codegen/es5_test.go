@@ -0,0 +1,154 @@
+package codegen
+
+import (
+	"slices"
+	"strings"
+	"testing"
+
+	"emojiscript-backend/pkg/sandbox"
+)
+
+// es2015 are the kinds of syntax tree node ES5 doesn't have
+var es2015 = []string{
+	"ArrowFunctionExpression", "ClassDeclaration", "ClassExpression", "TemplateLiteral", "SpreadElement",
+	"ForOfStatement", "ArrayPattern", "ObjectPattern", "AssignmentPattern", "RestElement", "AwaitExpression", "Super",
+}
+
+// checkES5 fails t if code has syntax ES5 doesn't
+func checkES5(t *testing.T, code string) {
+	t.Helper()
+	tree, err := sandbox.Tree(code)
+	if err != nil {
+		t.Fatalf("%v in\n%s", err, code)
+	}
+	walk(tree, func(n *node) bool {
+		switch {
+		case slices.Contains(es2015, n.Kind):
+			t.Errorf("%s in\n%s", n.Kind, code)
+		case n.Kind == "VariableDeclaration" && n.Label != "var":
+			t.Errorf("%s in\n%s", n.Label, code)
+		case (n.Kind == "ForInStatement" || n.Kind == "ForOfStatement") && n.Label != "" && n.Label != "var":
+			t.Errorf("%s in\n%s", n.Label, code)
+		case strings.HasPrefix(n.Label, "async"):
+			t.Errorf("async function in\n%s", code)
+		case strings.HasPrefix(n.Label, "?.") || n.Label == "?[ ]":
+			t.Errorf("optional chain in\n%s", code)
+		case slices.Contains([]string{"**", "??", "**=", "??=", "||=", "&&="}, n.Label):
+			t.Errorf("%s in\n%s", n.Label, code)
+		}
+		return true
+	})
+}
+
+// TestES5 checks that programs written as ES5 have only ES5's syntax and
+// print what they did
+func TestES5(t *testing.T) {
+	tests := []struct {
+		name, javascript string
+	}{
+		{"let and const in blocks", `const x = 1
+function f() {
+  const x = 2
+  if (x > 1) { const x = 3; console.log(x) }
+  { let x = 4; { let x = 5; console.log(x) } console.log(x) }
+  if (true) { function g() { return x } console.log(g()) }
+  console.log(x)
+}
+f()
+console.log(x)`},
+		{"arrow functions and this", `const counter = {
+  count: 1,
+  times(n) { return [1, 2, 3].map(i => this.count * i * n) }
+}
+console.log(counter.times(2))
+const add = (a, b = 10) => a + b
+console.log(add(1), add(1, 2))`},
+		{"classes", `class Animal {
+  legs = 4
+  static count = 0
+  constructor(name) { this.name = name; Animal.count++ }
+  speak() { return ` + "`${this.name} makes a sound`" + ` }
+  get label() { return "animal " + this.name }
+  set label(v) { this.name = v }
+  static create(name) { return new this(name) }
+}
+class Dog extends Animal {
+  tricks = []
+  constructor(name, ...tricks) { super(name); this.tricks.push(...tricks) }
+  speak() { return super.speak() + " (woof)" }
+}
+const d = new Dog("Rex", "sit", "roll")
+console.log(d.speak(), d.label, d.legs, d.tricks.length, Animal.count)
+d.label = "Max"
+console.log(d.label, d instanceof Animal, Dog.create("Bo").name)`},
+		{"destructuring", `const { x, y: [p, , q = 9, ...more], ...others } = { x: 1, y: [2, 0, undefined, 4, 5], z: 6 }
+console.log(x, p, q, more, others.z)
+let a = 1, b = 2
+;[a, b] = [b, a]
+console.log(a, b)
+function point({ x = 0, y = 0 } = {}) { return x + y }
+console.log(point(), point({ x: 2, y: 3 }))`},
+		{"spread and templates", `const xs = [1, 2, 3]
+console.log([0, ...xs, 4], Math.max(...xs))
+const o = { a: 1, ["b" + 1]: 2, ...{ c: 3 } }
+console.log(o.a, o.b1, o.c, ` + "`sum ${xs[0] + xs[1]}!`" + `)`},
+		{"loops", `for (const ch of "h😀i") console.log(ch)
+for (const [k, v] of [["a", 1], ["b", 2]]) console.log(k, v)
+const fns = []
+for (let i = 0; i < 3; i++) { const j = i * 2; fns.push(() => j) }
+console.log(fns.map(f => f()))`},
+		{"nullish and optional chains", `const empty = null, deep = { f: { g: () => 5 } }
+console.log(empty?.x, deep?.f.g(), deep.f?.h?.(), empty ?? "default", 0 ?? 1)
+let n = null
+n ??= 7
+let t = 0
+t ||= 3
+let u = 1
+u &&= 8
+const options = {}
+options.retries ??= 3
+console.log(n, t, u, options.retries, 2 ** 10)`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			code, _, err := Generate("es5", tt.javascript)
+			if err != nil {
+				t.Fatal(err)
+			}
+			checkES5(t, code)
+			want, got := sandbox.Run(tt.javascript, sandbox.Options{}), sandbox.Run(code, sandbox.Options{})
+			if want.Error != "" || got.Error != "" {
+				t.Fatalf("errors %q and %q running\n%s", want.Error, got.Error, code)
+			}
+			if !slices.Equal(got.Stdout, want.Stdout) {
+				t.Errorf("printed %q, want %q, running\n%s", got.Stdout, want.Stdout, code)
+			}
+		})
+	}
+}
+
+// TestES5Async checks that an async function's awaits are written as a
+// chain of promise callbacks, and that an await ES5 can't write so is an
+// error
+func TestES5Async(t *testing.T) {
+	code, warnings, err := Generate("es5", `async function load(url) {
+  const response = await fetch(url)
+  return await response.json()
+}`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkES5(t, code)
+	for _, want := range []string{"var response;", "resolve(fetch(url));", "}).then(function (_a) {", "return response.json();"} {
+		if !strings.Contains(code, want) {
+			t.Errorf("got\n%s\nwant it to contain\n%s", code, want)
+		}
+	}
+	if len(warnings) == 0 || !strings.Contains(warnings[0], "Promise") {
+		t.Errorf("warnings %q don't say Promise needs a polyfill", warnings)
+	}
+
+	if _, _, err := Generate("es5", `async function total(a, b) { return (await a) + (await b) }`); err == nil {
+		t.Error("an await inside an expression was written")
+	}
+}
@@ -0,0 +1,958 @@
+package codegen
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// gdGen writes a program as a Godot 4 script extending Node: functions
+// are the script's functions, classes are inner classes, and the other
+// top-level statements run in _ready. Top-level variables that functions
+// read become the script's member variables. Variables and parameters
+// are typed where their type is known and left dynamic otherwise.
+type gdGen struct {
+	*generator
+	// destructured counts the values destructuring has had to name, as
+	// GDScript won't declare a name twice in one function
+	destructured int
+}
+
+func (g *gdGen) program(root *node) string {
+	var ready []*node
+	for _, s := range root.Children {
+		g.line = s.Line
+		switch {
+		case isStdlibDefinition(s):
+		case s.Kind == "FunctionDeclaration":
+			g.function(funcName(s), s, "")
+			g.emit("")
+			g.emit("")
+		case s.Kind == "ClassDeclaration":
+			g.classDeclaration(s)
+			g.emit("")
+			g.emit("")
+		case isFunctionConst(s):
+			name, fn, _ := functionConst(s)
+			g.function(name, fn, "")
+			g.emit("")
+			g.emit("")
+		case g.member(s):
+			g.emit("")
+		default:
+			ready = append(ready, s)
+		}
+	}
+	g.emit("func _ready() -> void:")
+	g.body(&node{Kind: "BlockStatement", Children: ready})
+	return g.out.String()
+}
+
+// member writes a top-level declaration that functions read as the
+// script's member variables, which they can see, unlike _ready's
+func (g *gdGen) member(s *node) bool {
+	if s.Kind != "VariableDeclaration" {
+		return false
+	}
+	for _, d := range childrenOf(s, "declarations") {
+		if id := child(d, "id"); id.Kind != "Identifier" || !g.shared[id.Label] {
+			return false
+		}
+	}
+	g.declaration(s)
+	return true
+}
+
+// function writes fn as a func; key names it in calls, "Class.method"
+// for a method, and prefix is "static " for a static one. Functions that
+// await become coroutines, so async itself needs nothing.
+func (g *gdGen) function(key string, fn *node, prefix string) {
+	name := key[strings.LastIndex(key, ".")+1:]
+	if key == g.class {
+		name = "_init"
+	}
+	params, body, expr := function(fn)
+	result := ""
+	if expr != nil || hasReturnValue(body) {
+		result = g.resultKind(key, fn)
+	}
+	g.push()
+	defer g.pop()
+	list := g.params(key, params, body, expr)
+	signature := fmt.Sprintf("%sfunc %s(%s)", prefix, name, strings.Join(list, ", "))
+	if t := g.typeName(result); t != "" {
+		signature += " -> " + t
+	}
+	g.emit(signature + ":")
+	g.depth++
+	if expr != nil {
+		g.emit("return " + g.expr(expr))
+	} else {
+		g.block(body)
+		if len(body) == 0 {
+			g.emit("pass")
+		}
+	}
+	g.depth--
+}
+
+// params declares and writes a function's parameters
+func (g *gdGen) params(key string, params, body []*node, expr *node) []string {
+	list := make([]string, 0, len(params))
+	for i, p := range params {
+		name, def := param(p)
+		if name == "" {
+			g.unsupported("A destructuring parameter")
+			name = fmt.Sprintf("arg%d", i)
+		}
+		if p.Kind == "RestElement" {
+			g.unsupported("A rest parameter")
+		}
+		// a lambda's parameters are left dynamic, as the elements of
+		// the array it's usually given may be any type
+		kind := ""
+		if key != "" {
+			kind = g.paramKind(key, i, p, body, expr)
+		}
+		g.declare(name, kind)
+		code := name
+		if t := g.typeName(kind); t != "" {
+			code += ": " + t
+		}
+		if def != nil {
+			code += " = " + g.expr(def)
+		}
+		list = append(list, code)
+	}
+	return list
+}
+
+// classDeclaration writes a class as an inner class, with its constructor as _init
+func (g *gdGen) classDeclaration(cls *node) {
+	name := cls.Label
+	head := "class " + name
+	if super := child(cls, "superClass"); super != nil {
+		head += " extends " + g.expr(super)
+	}
+	saved := g.class
+	g.class = name
+	defer func() { g.class = saved }()
+
+	g.emit(head + ":")
+	g.depth++
+	defer func() { g.depth-- }()
+	fields := g.classFields(name)
+	for _, f := range fields {
+		code := "var " + f.name
+		if t := g.typeName(f.kind); t != "" {
+			code += ": " + t
+		}
+		if f.value != nil {
+			code += " = " + g.expr(f.value)
+		}
+		g.emit(code)
+	}
+	separate := len(fields) > 0
+	for _, m := range childrenOf(cls, "body") {
+		switch {
+		case m.Kind == "PropertyDefinition" && strings.HasPrefix(m.Label, "static "):
+			g.emit(fmt.Sprintf("static var %s = %s", strings.TrimPrefix(m.Label, "static "), g.expr(child(m, "value"))))
+			continue
+		case m.Kind != "MethodDefinition":
+			continue
+		}
+		if separate {
+			g.emit("")
+		}
+		separate = true
+		g.line = m.Line
+		method, static := m.Label, ""
+		switch {
+		case strings.HasPrefix(method, "static "):
+			method, static = strings.TrimPrefix(method, "static "), "static "
+		case strings.HasPrefix(method, "get "):
+			method = strings.TrimPrefix(method, "get ")
+		case strings.HasPrefix(method, "set "):
+			method = "set_" + strings.TrimPrefix(method, "set ")
+		}
+		key := name + "." + method
+		if method == "constructor" {
+			key = name
+		}
+		g.function(key, child(m, "value"), static)
+	}
+	if len(childrenOf(cls, "body")) == 0 {
+		g.emit("pass")
+	}
+}
+
+// typeName is the GDScript type of a kind, "" to leave it dynamic
+func (g *gdGen) typeName(kind string) string {
+	switch {
+	case kind == kindInt || kind == kindIndex:
+		return "int"
+	case kind == kindFloat:
+		return "float"
+	case kind == kindString:
+		return "String"
+	case kind == kindBool:
+		return "bool"
+	case isArray(kind):
+		return "Array"
+	case kind == kindObject:
+		return "Dictionary"
+	case kind == kindFunc:
+		return "Callable"
+	case strings.HasPrefix(kind, kindClass):
+		return strings.TrimPrefix(kind, kindClass)
+	}
+	return ""
+}
+
+func (g *gdGen) block(body []*node) {
+	for _, s := range body {
+		g.stmt(s)
+	}
+}
+
+// body writes a statement nested one level deeper, in its own scope
+func (g *gdGen) body(s *node) {
+	g.depth++
+	g.push()
+	before := g.out.Len()
+	if s != nil && s.Kind == "BlockStatement" {
+		g.block(s.Children)
+	} else if s != nil {
+		g.stmt(s)
+	}
+	if g.out.Len() == before {
+		g.emit("pass")
+	}
+	g.pop()
+	g.depth--
+}
+
+func (g *gdGen) stmt(s *node) {
+	if s.Line > 0 {
+		g.line = s.Line
+	}
+	switch s.Kind {
+	case "VariableDeclaration":
+		g.declaration(s)
+	case "FunctionDeclaration":
+		// a nested function is a lambda held in a variable
+		g.declare(funcName(s), kindFunc)
+		g.emit(fmt.Sprintf("var %s = %s", funcName(s), g.lambda(s)))
+	case "ClassDeclaration":
+		g.unsupported("A class declared inside a function")
+	case "ExpressionStatement":
+		x := child(s, "expression")
+		if array, item, body, ok := forEachLoop(x); ok {
+			g.declare(item.Label, elemKind(g.kindOf(array)))
+			g.emit(fmt.Sprintf("for %s in %s:", item.Label, g.expr(array)))
+			g.body(&node{Kind: "BlockStatement", Children: body})
+			return
+		}
+		if x.Kind == "UpdateExpression" {
+			op := "+="
+			if strings.HasPrefix(x.Label, "--") {
+				op = "-="
+			}
+			g.emit(fmt.Sprintf("%s %s 1", g.expr(child(x, "argument")), op))
+			return
+		}
+		if g.logicalAssignment(x) {
+			return
+		}
+		if sw, ok := switchExpression(child(x, "right")); ok && x.Label == "=" {
+			g.switchStatement(assigningSwitch(sw, child(x, "left")))
+			return
+		}
+		g.emit(g.expr(x))
+	case "IfStatement":
+		g.emit(fmt.Sprintf("if %s:", g.expr(child(s, "test"))))
+		g.body(child(s, "consequent"))
+		alt := child(s, "alternate")
+		for alt != nil && alt.Kind == "IfStatement" {
+			g.emit(fmt.Sprintf("elif %s:", g.expr(child(alt, "test"))))
+			g.body(child(alt, "consequent"))
+			alt = child(alt, "alternate")
+		}
+		if alt != nil {
+			g.emit("else:")
+			g.body(alt)
+		}
+	case "ForStatement":
+		g.forStatement(s)
+	case "ForOfStatement":
+		left, right := child(s, "left"), child(s, "right")
+		g.declare(left.Label, elemKind(g.kindOf(right)))
+		g.emit(fmt.Sprintf("for %s in %s:", left.Label, g.expr(right)))
+		g.body(child(s, "body"))
+	case "ForInStatement":
+		left, right := child(s, "left"), child(s, "right")
+		if isArray(g.kindOf(right)) {
+			g.declare(left.Label, kindInt)
+			g.emit(fmt.Sprintf("for %s in range(%s.size()):", left.Label, g.operand(right, 150)))
+		} else {
+			g.emit(fmt.Sprintf("for %s in %s:", left.Label, g.expr(right)))
+		}
+		g.body(child(s, "body"))
+	case "WhileStatement":
+		g.emit(fmt.Sprintf("while %s:", g.expr(child(s, "test"))))
+		g.body(child(s, "body"))
+	case "DoWhileStatement":
+		g.emit("while true:")
+		g.body(child(s, "body"))
+		g.depth++
+		g.emit(fmt.Sprintf("if not (%s):", g.expr(child(s, "test"))))
+		g.emit(g.indent + "break")
+		g.depth--
+	case "BlockStatement":
+		g.block(s.Children)
+	case "ReturnStatement":
+		if x := child(s, "argument"); x != nil {
+			g.emit("return " + g.expr(x))
+		} else {
+			g.emit("return")
+		}
+	case "BreakStatement", "ContinueStatement":
+		if s.Label != "" {
+			g.unsupported("A labeled break or continue")
+		}
+		g.emit(strings.ToLower(strings.TrimSuffix(s.Kind, "Statement")))
+	case "ThrowStatement":
+		g.warn("GDScript has no exceptions; throw reports the error with push_error and returns")
+		g.emit(fmt.Sprintf("push_error(%s)", g.expr(errorMessage(child(s, "argument")))))
+		g.emit("return")
+	case "TryStatement":
+		g.warn("GDScript has no exceptions; the try block runs as plain code and the catch block is left out")
+		g.stmt(child(s, "block"))
+		if finalizer := child(s, "finalizer"); finalizer != nil {
+			g.stmt(finalizer)
+		}
+	case "SwitchStatement":
+		g.switchStatement(s)
+	case "LabeledStatement":
+		g.stmt(child(s, "body"))
+	case "EmptyStatement":
+	default:
+		g.unsupported(s.Kind)
+	}
+}
+
+func (g *gdGen) declaration(s *node) {
+	for _, d := range childrenOf(s, "declarations") {
+		id, init := child(d, "id"), child(d, "init")
+		if id.Kind != "Identifier" {
+			g.destructure(id, init)
+			continue
+		}
+		kind := g.kindOf(init)
+		if init == nil {
+			g.declare(id.Label, kind)
+			g.emit("var " + id.Label)
+			continue
+		}
+		if sw, ok := switchExpression(init); ok {
+			// match is a statement in GDScript, so each branch assigns
+			g.declare(id.Label, kind)
+			g.emit("var " + id.Label)
+			g.switchStatement(assigningSwitch(sw, id))
+			continue
+		}
+		value := g.expr(init)
+		g.declare(id.Label, kind)
+		keyword := "var "
+		if s.Label == "const" && init.Kind == "Literal" {
+			keyword = "const "
+		}
+		if t := g.letType(init, kind); t != "" {
+			g.emit(fmt.Sprintf("%s%s: %s = %s", keyword, id.Label, t, value))
+		} else {
+			g.emit(fmt.Sprintf("%s%s = %s", keyword, id.Label, value))
+		}
+	}
+}
+
+// letType is the type a variable is declared with: only values whose
+// type the initializer spells out are typed
+func (g *gdGen) letType(init *node, kind string) string {
+	switch init.Kind {
+	case "Literal", "TemplateLiteral", "ArrayExpression", "ObjectExpression", "BinaryExpression", "NewExpression":
+		return g.typeName(kind)
+	}
+	return ""
+}
+
+// destructure writes a destructuring declaration as a variable per name
+func (g *gdGen) destructure(pattern, init *node) {
+	source := g.expr(init)
+	if init.Kind != "Identifier" {
+		g.destructured++
+		name := "destructured"
+		if g.destructured > 1 {
+			name += strconv.Itoa(g.destructured)
+		}
+		g.emit(fmt.Sprintf("var %s = %s", name, source))
+		source = name
+	}
+	switch pattern.Kind {
+	case "ArrayPattern":
+		for i, e := range childrenOf(pattern, "elements") {
+			name, def := param(e)
+			g.declare(name, elemKind(g.kindOf(init)))
+			switch {
+			case e.Kind == "Elision":
+			case e.Kind == "RestElement":
+				g.emit(fmt.Sprintf("var %s = %s.slice(%d)", name, source, i))
+			case def != nil:
+				g.emit(fmt.Sprintf("var %s = %s[%d] if %s.size() > %d else %s", name, source, i, source, i, g.expr(def)))
+			default:
+				g.emit(fmt.Sprintf("var %s = %s[%d]", name, source, i))
+			}
+		}
+	case "ObjectPattern":
+		for _, p := range childrenOf(pattern, "properties") {
+			name, def := param(child(p, "value"))
+			if p.Kind == "RestElement" || name == "" {
+				g.unsupported("An object rest or nested pattern")
+				continue
+			}
+			g.declare(name, "")
+			if def != nil {
+				g.emit(fmt.Sprintf("var %s = %s.get(%s, %s)", name, source, quote(p.Label), g.expr(def)))
+			} else {
+				g.emit(fmt.Sprintf("var %s = %s.%s", name, source, p.Label))
+			}
+		}
+	}
+}
+
+func (g *gdGen) forStatement(s *node) {
+	if c, ok := countingLoop(s); ok {
+		start, end := g.expr(c.start), g.expr(c.end)
+		// range's end is exclusive, one past the last value either way
+		switch {
+		case c.inclusive && !c.down:
+			end = g.offset(c.end, 1)
+		case c.inclusive:
+			end = g.offset(c.end, -1)
+		}
+		args := []string{start, end}
+		switch {
+		case c.step != nil && c.down:
+			args = append(args, "-"+g.expr(c.step))
+		case c.step != nil:
+			args = append(args, g.expr(c.step))
+		case c.down:
+			args = append(args, "-1")
+		case start == "0":
+			args = args[1:]
+		}
+		g.declare(c.name, kindInt)
+		g.emit(fmt.Sprintf("for %s in range(%s):", c.name, strings.Join(args, ", ")))
+		g.body(child(s, "body"))
+		return
+	}
+
+	// any other for loop is its init and a while loop
+	if init := child(s, "init"); init != nil {
+		g.stmt(init)
+	}
+	test := "true"
+	if t := child(s, "test"); t != nil {
+		test = g.expr(t)
+	}
+	update := child(s, "update")
+	if update != nil && containsContinue(child(s, "body")) {
+		g.warn("continue skips the update of a for loop written as a while loop")
+	}
+	g.emit(fmt.Sprintf("while %s:", test))
+	body := []*node{child(s, "body")}
+	if update != nil {
+		body = append(body, &node{Kind: "ExpressionStatement", Children: []*node{update}})
+	}
+	g.body(&node{Kind: "BlockStatement", Children: body})
+}
+
+// offset writes n + by, folding it into n when n is a literal
+func (g *gdGen) offset(n *node, by int64) string {
+	if v, ok := integer(n); ok {
+		return strconv.FormatInt(v+by, 10)
+	}
+	if by < 0 {
+		return fmt.Sprintf("%s - %d", g.operand(n, 110), -by)
+	}
+	return fmt.Sprintf("%s + %d", g.operand(n, 110), by)
+}
+
+// switchStatement writes a switch as a match. Cases without a body
+// share the next case's branch; a case that falls into the next after
+// running its own body can't.
+func (g *gdGen) switchStatement(s *node) {
+	g.emit(fmt.Sprintf("match %s:", g.expr(child(s, "discriminant"))))
+	g.depth++
+	var patterns []string
+	cases := childrenOf(s, "cases")
+	for i, c := range cases {
+		if test := child(c, "test"); test == nil {
+			patterns = append(patterns, "_")
+		} else {
+			patterns = append(patterns, g.expr(test))
+		}
+		body := childrenOf(c, "consequent")
+		if len(body) == 0 && i < len(cases)-1 {
+			continue
+		}
+		if !endsAbruptly(body) && i < len(cases)-1 {
+			g.warn("GDScript match branches don't fall through into the next case")
+		}
+		branch := strings.Join(patterns, ", ")
+		for _, p := range patterns {
+			if p == "_" {
+				branch = "_"
+			}
+		}
+		patterns = nil
+		g.emit(branch + ":")
+		g.body(&node{Kind: "BlockStatement", Children: caseBody(c)})
+	}
+	g.depth--
+}
+
+// operand writes n, parenthesized when it binds less tightly than prec.
+// not binds less tightly in GDScript than comparisons do.
+func (g *gdGen) operand(n *node, prec int) string {
+	code := g.expr(n)
+	p := precedence(n)
+	if n.Kind == "UnaryExpression" && n.Label == "!" {
+		p = 45
+	}
+	if p < prec {
+		return "(" + code + ")"
+	}
+	return code
+}
+
+// gdOperators are the JavaScript operators GDScript spells differently
+var gdOperators = map[string]string{
+	"===": "==", "!==": "!=", "&&": "and", "||": "or", "instanceof": "is",
+}
+
+// logicalAssignment writes a ??=, ||= or &&= statement as an if that
+// assigns only when the target is null, falsy or truthy, reporting
+// whether x was one
+func (g *gdGen) logicalAssignment(x *node) bool {
+	if x.Kind != "AssignmentExpression" {
+		return false
+	}
+	l, r := child(x, "left"), child(x, "right")
+	switch x.Label {
+	case "??=":
+		g.emit(fmt.Sprintf("if %s == null:", g.operand(l, 81)))
+	case "||=":
+		g.emit(fmt.Sprintf("if not %s:", g.operand(l, 140)))
+	case "&&=":
+		g.emit(fmt.Sprintf("if %s:", g.expr(l)))
+	default:
+		return false
+	}
+	g.depth++
+	g.emit(g.expr(l) + " = " + g.expr(r))
+	g.depth--
+	return true
+}
+
+func (g *gdGen) expr(n *node) string {
+	if n == nil {
+		return ""
+	}
+	switch n.Kind {
+	case "Literal":
+		if s, ok := stringValue(n); ok {
+			return quote(s)
+		}
+		return n.Label
+	case "Identifier":
+		switch n.Label {
+		case "undefined":
+			return "null"
+		case "NaN":
+			return "NAN"
+		case "Infinity":
+			return "INF"
+		}
+		return n.Label
+	case "ThisExpression":
+		return "self"
+	case "Super":
+		return "super"
+	case "TemplateLiteral":
+		parts, exprs := templateParts(n), childrenOf(n, "expressions")
+		if len(exprs) == 0 {
+			return quote(parts[0])
+		}
+		args := make([]string, 0, len(exprs))
+		for _, x := range exprs {
+			args = append(args, g.expr(x))
+		}
+		for i := range parts {
+			parts[i] = strings.ReplaceAll(parts[i], "%", "%%")
+		}
+		return fmt.Sprintf("%s %% [%s]", quote(strings.Join(parts, "%s")), strings.Join(args, ", "))
+	case "ArrayExpression":
+		elems := childrenOf(n, "elements")
+		list := make([]string, 0, len(elems))
+		for _, e := range elems {
+			if e.Kind == "SpreadElement" {
+				g.unsupported("Spreading into an array literal")
+			}
+			list = append(list, g.expr(e))
+		}
+		return "[" + strings.Join(list, ", ") + "]"
+	case "ObjectExpression":
+		var entries []string
+		for _, p := range childrenOf(n, "properties") {
+			if p.Kind == "SpreadElement" {
+				g.unsupported("Spreading into an object literal")
+				continue
+			}
+			key := quote(p.Label)
+			if computed := child(p, "key"); computed != nil {
+				key = g.expr(computed)
+			}
+			entries = append(entries, key+": "+g.expr(child(p, "value")))
+		}
+		return "{" + strings.Join(entries, ", ") + "}"
+	case "ArrowFunctionExpression", "FunctionExpression":
+		return g.lambda(n)
+	case "UnaryExpression":
+		arg := child(n, "argument")
+		switch n.Label {
+		case "!":
+			return "not " + g.operand(arg, 140)
+		case "-", "~":
+			return n.Label + g.operand(arg, 140)
+		case "+":
+			return "float(" + g.expr(arg) + ")"
+		case "typeof":
+			g.warn("GDScript's typeof returns a Variant.Type number, not a name")
+			return "typeof(" + g.expr(arg) + ")"
+		}
+		g.unsupported("The " + n.Label + " operator")
+		return g.expr(arg)
+	case "UpdateExpression":
+		g.unsupported("++ or -- inside an expression")
+		op := " + 1"
+		if strings.HasPrefix(n.Label, "--") {
+			op = " - 1"
+		}
+		return g.operand(child(n, "argument"), 110) + op
+	case "BinaryExpression":
+		return g.binary(n)
+	case "LogicalExpression":
+		l, r := child(n, "left"), child(n, "right")
+		if n.Label == "??" {
+			left := g.operand(l, 150)
+			return fmt.Sprintf("%s if %s != null else %s", left, left, g.operand(r, 30))
+		}
+		prec := precedence(n)
+		return fmt.Sprintf("%s %s %s", g.operand(l, prec), gdOperators[n.Label], g.operand(r, prec+1))
+	case "ConditionalExpression":
+		return fmt.Sprintf("%s if %s else %s", g.operand(child(n, "consequent"), 30), g.operand(child(n, "test"), 30), g.operand(child(n, "alternate"), 20))
+	case "AssignmentExpression":
+		l, r := child(n, "left"), child(n, "right")
+		if object, prop, ok := member(l); ok && n.Label == "=" && g.accessor(object, prop, "set") {
+			return fmt.Sprintf("%s.set_%s(%s)", g.operand(object, 150), prop, g.expr(r))
+		}
+		switch n.Label {
+		case "**=":
+			return fmt.Sprintf("%s = %s ** %s", g.expr(l), g.operand(l, 130), g.operand(r, 131))
+		case "??=", "||=", "&&=":
+			// a statement is written as an if by logicalAssignment
+			g.unsupported("The " + n.Label + " operator inside an expression")
+			return g.expr(l) + " = " + g.expr(r)
+		case ">>>=":
+			g.fail(">>>= shifts the number as an unsigned 32-bit integer, which GDScript can't")
+			return g.expr(l)
+		case "+=":
+			if g.kindOf(l) == kindString && g.kindOf(r) != kindString {
+				return fmt.Sprintf("%s += str(%s)", g.expr(l), g.expr(r))
+			}
+		}
+		return g.expr(l) + " " + n.Label + " " + g.expr(r)
+	case "CallExpression":
+		return g.call(n)
+	case "NewExpression":
+		return g.newExpr(n)
+	case "MemberExpression":
+		return g.memberExpr(n)
+	case "AwaitExpression":
+		return "await " + g.operand(child(n, "argument"), 140)
+	case "SpreadElement":
+		g.unsupported("Spreading arguments")
+		return g.expr(child(n, "argument"))
+	case "SequenceExpression":
+		g.unsupported("The comma operator")
+		list := childrenOf(n, "expressions")
+		return g.expr(list[len(list)-1])
+	}
+	g.unsupported("A " + n.Kind)
+	return "null"
+}
+
+func (g *gdGen) binary(n *node) string {
+	l, r := child(n, "left"), child(n, "right")
+	lk, rk := g.kindOf(l), g.kindOf(r)
+	prec := precedence(n)
+	left, right := g.operand(l, prec), g.operand(r, prec+1)
+	switch n.Label {
+	case "+":
+		// GDScript doesn't convert to string when adding one
+		if lk == kindString && rk != kindString {
+			right = "str(" + g.expr(r) + ")"
+		} else if rk == kindString && lk != kindString {
+			left = "str(" + g.expr(l) + ")"
+		}
+	case "/":
+		// dividing two ints is integer division in GDScript
+		if lk != kindFloat && rk != kindFloat {
+			if _, ok := integer(l); ok {
+				left = number(l.Label)
+			} else {
+				left = "float(" + g.expr(l) + ")"
+			}
+		}
+	case "%":
+		if lk == kindFloat || rk == kindFloat {
+			return fmt.Sprintf("fmod(%s, %s)", g.expr(l), g.expr(r))
+		}
+	case ">>>":
+		g.unsupported("The >>> operator")
+		return left + " >> " + right
+	case "**":
+		// ** binds tighter than a sign in GDScript, so (-a) ** 2 keeps
+		// its parentheses
+		if l.Kind == "UnaryExpression" {
+			left = "(" + g.expr(l) + ")"
+		}
+	}
+	op := n.Label
+	if spelled, ok := gdOperators[op]; ok {
+		op = spelled
+	}
+	return left + " " + op + " " + right
+}
+
+// lambda writes a function expression as a lambda; a lambda whose body
+// is more than one statement spans lines, so it has to end the line
+// it's on
+func (g *gdGen) lambda(fn *node) string {
+	params, body, expr := function(fn)
+	g.push()
+	defer g.pop()
+	list := g.params("", params, body, expr)
+	head := "func(" + strings.Join(list, ", ") + "):"
+	switch {
+	case expr != nil && isConsoleCall(expr):
+		return head + " " + g.expr(expr)
+	case expr != nil:
+		return head + " return " + g.expr(expr)
+	case len(body) == 1 && body[0].Kind == "ReturnStatement" && child(body[0], "argument") != nil:
+		return head + " return " + g.expr(child(body[0], "argument"))
+	case len(body) == 1 && body[0].Kind == "ExpressionStatement":
+		return head + " " + g.expr(child(body[0], "expression"))
+	}
+	inner := g.capture(func() {
+		g.depth++
+		g.block(body)
+		if len(body) == 0 {
+			g.emit("pass")
+		}
+		g.depth--
+	})
+	return head + "\n" + strings.TrimSuffix(inner, "\n")
+}
+
+// isConsoleCall reports whether x is console.log or one of its kind,
+// whose GDScript equivalents return nothing to return
+func isConsoleCall(x *node) bool {
+	if x.Kind != "CallExpression" {
+		return false
+	}
+	object, _, ok := member(child(x, "callee"))
+	return ok && isIdent(object, "console")
+}
+
+func (g *gdGen) memberExpr(n *node) string {
+	object, prop, ok := member(n)
+	if strings.HasPrefix(n.Label, "?") {
+		g.warn("GDScript has no optional chaining; ?. is written as plain access")
+	}
+	if !ok {
+		return fmt.Sprintf("%s[%s]", g.operand(child(n, "object"), 150), g.expr(child(n, "property")))
+	}
+	if object.Kind == "Identifier" && object.Label == "Math" {
+		switch prop {
+		case "PI":
+			return "PI"
+		case "E":
+			return "exp(1.0)"
+		}
+	}
+	if prop == "length" {
+		if g.kindOf(object) == kindString {
+			return g.operand(object, 150) + ".length()"
+		}
+		return g.operand(object, 150) + ".size()"
+	}
+	if g.accessor(object, prop, "get") {
+		return g.operand(object, 150) + "." + prop + "()"
+	}
+	return g.operand(object, 150) + "." + prop
+}
+
+// gdMathFunctions are the Math functions GDScript has as globals, by
+// their GDScript name
+var gdMathFunctions = map[string]string{
+	"floor": "floor", "ceil": "ceil", "round": "round", "abs": "abs", "sqrt": "sqrt",
+	"sin": "sin", "cos": "cos", "tan": "tan", "log": "log", "exp": "exp", "pow": "pow",
+	"min": "min", "max": "max", "sign": "sign", "atan2": "atan2", "trunc": "int",
+}
+
+// gdMethods are the JavaScript string and array methods whose GDScript
+// equivalent differs only in name
+var gdMethods = map[string]string{
+	"push": "append", "pop": "pop_back", "shift": "pop_front", "unshift": "push_front",
+	"indexOf": "find", "toUpperCase": "to_upper", "toLowerCase": "to_lower", "trim": "strip_edges",
+	"startsWith": "begins_with", "endsWith": "ends_with", "some": "any", "every": "all",
+	"map": "map", "filter": "filter", "reduce": "reduce", "slice": "slice", "split": "split",
+	"replace": "replace", "reverse": "reverse", "sort": "sort",
+}
+
+func (g *gdGen) call(n *node) string {
+	callee, args := child(n, "callee"), childrenOf(n, "arguments")
+	if n.Label == "?." {
+		g.warn("GDScript has no optional chaining; ?.() is written as a plain call")
+	}
+	written := make([]string, 0, len(args))
+	for _, arg := range args {
+		written = append(written, g.expr(arg))
+	}
+	list := strings.Join(written, ", ")
+
+	if callee.Kind == "Identifier" {
+		switch callee.Label {
+		case "String":
+			return "str(" + list + ")"
+		case "Number", "parseFloat":
+			return "float(" + list + ")"
+		case "parseInt":
+			return "int(" + list + ")"
+		case "EmojiFetch":
+			g.warn("Godot makes HTTP requests with an HTTPRequest node; 🌐 has no GDScript definition")
+		}
+		if g.funcs[callee.Label] == nil && g.kindOf(callee) == kindFunc {
+			return callee.Label + ".call(" + list + ")"
+		}
+		return callee.Label + "(" + list + ")"
+	}
+	object, prop, ok := member(callee)
+	if !ok {
+		return g.operand(callee, 150) + ".call(" + list + ")"
+	}
+	if object.Kind == "Identifier" {
+		switch object.Label {
+		case "console":
+			switch {
+			case prop == "error" || prop == "warn":
+				return "printerr(" + list + ")"
+			case len(args) > 1:
+				// prints puts spaces between its arguments, as console.log does
+				return "prints(" + list + ")"
+			}
+			return "print(" + list + ")"
+		case "JSON":
+			// Godot's JSON indents with a string rather than a count
+			if prop == "stringify" && len(args) > 2 {
+				if n, ok := integer(args[2]); ok {
+					return fmt.Sprintf("JSON.stringify(%s, %s)", written[0], quote(strings.Repeat(" ", int(n))))
+				}
+				return fmt.Sprintf("JSON.stringify(%s, %s)", written[0], written[2])
+			}
+			if prop == "stringify" && len(args) > 0 {
+				return "JSON.stringify(" + written[0] + ")"
+			}
+			if prop == "parse" {
+				return "JSON.parse_string(" + list + ")"
+			}
+		case "Math":
+			if prop == "random" {
+				return "randf()"
+			}
+			if name, found := gdMathFunctions[prop]; found {
+				return name + "(" + list + ")"
+			}
+		}
+	}
+	receiver := g.operand(object, 150)
+	switch prop {
+	case "includes":
+		if g.kindOf(object) == kindString {
+			return receiver + ".contains(" + list + ")"
+		}
+		return receiver + ".has(" + list + ")"
+	case "join":
+		separator := `","`
+		if len(args) > 0 {
+			separator = g.operand(args[0], 150)
+		}
+		return separator + ".join(" + receiver + ")"
+	case "toString":
+		return "str(" + receiver + ")"
+	case "toFixed":
+		if digits, ok := integer(firstArg(args)); ok {
+			return fmt.Sprintf(`"%%.%df" %% %s`, digits, receiver)
+		}
+	case "forEach":
+		g.unsupported("forEach inside an expression")
+		return receiver + ".map(" + list + ")"
+	}
+	if name, found := gdMethods[prop]; found {
+		return receiver + "." + name + "(" + list + ")"
+	}
+	return receiver + "." + prop + "(" + list + ")"
+}
+
+func firstArg(args []*node) *node {
+	if len(args) == 0 {
+		return nil
+	}
+	return args[0]
+}
+
+func (g *gdGen) newExpr(n *node) string {
+	callee, args := child(n, "callee"), childrenOf(n, "arguments")
+	written := make([]string, 0, len(args))
+	for _, arg := range args {
+		written = append(written, g.expr(arg))
+	}
+	switch name := callee.Label; {
+	case callee.Kind != "Identifier":
+		g.unsupported("new with a computed class")
+	case name == "Map" || name == "Object":
+		return "{}"
+	case name == "Set":
+		g.warn("GDScript has no sets; new Set() is written as a Dictionary")
+		return "{}"
+	case name == "Array":
+		return "[]"
+	case strings.HasSuffix(name, "Error") && len(args) > 0:
+		return written[0]
+	case name == "Date":
+		g.warn("GDScript has no Date; new Date() is written as the Unix time in milliseconds")
+		return "Time.get_unix_time_from_system() * 1000.0"
+	}
+	return g.expr(callee) + ".new(" + strings.Join(written, ", ") + ")"
+}
@@ -0,0 +1,1704 @@
+package codegen
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+
+	"emojiscript-backend/pkg/transpiler"
+)
+
+// pyGen writes a program as a Python 3.10 script. Top-level statements
+// run in order, as they do in JavaScript, after the function
+// declarations JavaScript hoists; classes are classes, with their getters
+// as properties. Functions are annotated with the types that are known,
+// and a function that assigns a top-level variable declares it global.
+type pyGen struct {
+	*generator
+	// imports are the modules the program needs an import for, or a
+	// from ... import statement for a name from one
+	imports map[string]bool
+	// locals are the names each function being written binds, innermost
+	// last, for its global and nonlocal declarations
+	locals []map[string]bool
+	// callbacks counts the functions hoisted out of expressions, which a
+	// lambda can't hold, to name them apart
+	callbacks int
+	// sets are the variables holding a Set, which is a set rather than
+	// the dict a Map is
+	sets map[string]bool
+}
+
+// kindError is a caught exception, whose message is str(e)
+const kindError = "error"
+
+// pyImports writes a program's import statements as Python's
+func pyImports(imports []jsImport) ([]string, error) {
+	var python []string
+	for _, i := range imports {
+		statements, err := transpiler.PythonImport(i.module, i.specifiers, i.defaultName, i.namespace)
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %v", i.line, err)
+		}
+		python = append(python, statements...)
+	}
+	return python, nil
+}
+
+// pyBuiltins are the builtins and modules the Python a program is written
+// as may use, which its own names mustn't hide
+var pyBuiltins = map[string]bool{
+	"all": true, "any": true, "bool": true, "dict": true, "float": true, "format": true,
+	"input": true, "int": true, "isinstance": true, "len": true, "list": true, "map": true,
+	"max": true, "min": true, "next": true, "print": true, "range": true, "set": true,
+	"sorted": true, "str": true, "sum": true, "super": true, "type": true, "self": true,
+	"asyncio": true, "datetime": true, "functools": true, "math": true, "random": true, "sys": true,
+}
+
+// pyRename renames the names a program declares that are Python keywords
+// or builtins, as the transpiler renames reserved words: each becomes the
+// word with a '_' suffix
+func pyRename(root *node) {
+	declared := map[string]bool{}
+	var names func(n *node)
+	names = func(n *node) {
+		switch n.Kind {
+		case "Identifier":
+			declared[n.Label] = true
+		case "AssignmentPattern":
+			// its default value isn't declared
+			names(child(n, "left"))
+		default:
+			for _, c := range n.Children {
+				if c.Role != "key" {
+					names(c)
+				}
+			}
+		}
+	}
+	walk(root, func(n *node) bool {
+		switch n.Kind {
+		case "VariableDeclarator":
+			names(child(n, "id"))
+		case "FunctionDeclaration", "FunctionExpression", "ArrowFunctionExpression":
+			declared[funcName(n)] = true
+			for _, p := range childrenOf(n, "params") {
+				names(p)
+			}
+		case "ClassDeclaration":
+			declared[n.Label] = true
+		case "CatchClause":
+			if p := child(n, "param"); p != nil {
+				names(p)
+			}
+		}
+		return true
+	})
+	renamed := func(name string) bool {
+		return declared[name] && (transpiler.ReservedWord(name, "python") || pyBuiltins[name])
+	}
+	walk(root, func(n *node) bool {
+		switch {
+		case n.Kind == "Identifier" && renamed(n.Label):
+			n.Label += "_"
+		case (n.Kind == "FunctionDeclaration" || n.Kind == "ClassDeclaration") && renamed(funcName(n)):
+			n.Label += "_"
+		}
+		return true
+	})
+}
+
+// program writes the program, returning the imports it needs apart, as
+// they go ahead of any builtin definitions
+func (g *pyGen) program(root *node) (string, string) {
+	for _, s := range root.Children {
+		if s.Kind == "FunctionDeclaration" {
+			g.line = s.Line
+			g.function(funcName(s), s, "")
+			g.emit("")
+			g.emit("")
+		}
+	}
+	top := g.topLevelAwait(root)
+	if top {
+		g.imports["asyncio"] = true
+		g.emit("async def main():")
+		g.depth++
+		if names := g.globals(root); len(names) > 0 {
+			g.emit("global " + strings.Join(names, ", "))
+		}
+	}
+	before := g.out.Len()
+	for i, s := range root.Children {
+		g.line = s.Line
+		switch {
+		case isStdlibDefinition(s), s.Kind == "FunctionDeclaration":
+		case s.Kind == "ClassDeclaration" || isFunctionConst(s):
+			if i > 0 && g.out.Len() > before {
+				g.emit("")
+				g.emit("")
+			}
+			g.stmt(s)
+			if i < len(root.Children)-1 {
+				g.emit("")
+				g.emit("")
+			}
+			before = g.out.Len()
+		default:
+			g.stmt(s)
+		}
+	}
+	if top {
+		g.depth--
+		g.emit("")
+		g.emit("")
+		g.emit("asyncio.run(main())")
+	}
+
+	var header strings.Builder
+	modules := make([]string, 0, len(g.imports))
+	for module := range g.imports {
+		modules = append(modules, module)
+	}
+	sort.Strings(modules)
+	for _, module := range modules {
+		if strings.HasPrefix(module, "from ") {
+			// a name imported from a module rather than the module
+			header.WriteString(module + "\n")
+			continue
+		}
+		fmt.Fprintf(&header, "import %s\n", module)
+	}
+	code := strings.TrimRight(g.out.String(), "\n")
+	if code != "" {
+		code += "\n"
+	}
+	return header.String(), code
+}
+
+// topLevelAwait reports whether the program awaits outside a function,
+// which Python only allows inside a coroutine
+func (g *pyGen) topLevelAwait(root *node) bool {
+	found := false
+	for _, s := range root.Children {
+		walk(s, func(n *node) bool {
+			switch n.Kind {
+			case "FunctionDeclaration", "FunctionExpression", "ArrowFunctionExpression", "ClassDeclaration", "ClassExpression":
+				return false
+			case "AwaitExpression":
+				found = true
+			}
+			return !found
+		})
+	}
+	return found
+}
+
+// globals are the top-level variables main assigns when the top-level
+// statements run in a coroutine, sorted
+func (g *pyGen) globals(root *node) []string {
+	var names []string
+	for name := range g.scopes[0] {
+		if g.shared[name] && !transpiler.IsStdlib(name) {
+			names = append(names, name)
+		}
+	}
+	for name := range g.classes {
+		if g.shared[name] {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	return names
+}
+
+// function writes fn as a def; key names it in calls, "Class.method" for
+// a method, and receiver is self for a method and "" otherwise
+func (g *pyGen) function(key string, fn *node, receiver string) {
+	name := key[strings.LastIndex(key, ".")+1:]
+	if key == g.class {
+		name = "__init__"
+	}
+	params, body, expr := function(fn)
+	result := ""
+	if expr != nil || hasReturnValue(body) {
+		result = g.resultKind(key, fn)
+	}
+	g.push()
+	defer g.pop()
+	list, defaults := g.params(key, params, body, expr)
+	if receiver != "" {
+		list = append([]string{receiver}, list...)
+	}
+	prefix := "def "
+	if isAsync(fn) {
+		prefix = "async def "
+	}
+	signature := fmt.Sprintf("%s%s(%s)", prefix, name, strings.Join(list, ", "))
+	if t := g.typeName(result); t != "" && name != "__init__" {
+		signature += " -> " + t
+	}
+	g.emit(signature + ":")
+	g.depth++
+	g.enter(params, body)
+	for _, d := range defaults {
+		g.emit(d)
+	}
+	if key == g.class {
+		g.fieldValues(body)
+	}
+	switch {
+	case expr != nil && isConsoleCall(expr):
+		g.emit(g.expr(expr))
+	case expr != nil:
+		g.emit("return " + g.expr(expr))
+	default:
+		before := g.out.Len()
+		g.block(body)
+		if g.out.Len() == before {
+			g.emit("pass")
+		}
+	}
+	g.locals = g.locals[:len(g.locals)-1]
+	g.depth--
+}
+
+// params declares and writes a function's parameters. A list or dict
+// default is made each call, as JavaScript does, rather than shared, so
+// it defaults to None and defaults holds the statements replacing it.
+func (g *pyGen) params(key string, params, body []*node, expr *node) (list, defaults []string) {
+	for i, p := range params {
+		name, def := param(p)
+		if name == "" {
+			g.unsupported("A destructuring parameter")
+			name = fmt.Sprintf("arg%d", i)
+		}
+		// a lambda's parameters are left unannotated, as the elements
+		// of the list it's usually given may be any type
+		kind := ""
+		if key != "" {
+			kind = g.paramKind(key, i, p, body, expr)
+		}
+		g.declare(name, kind)
+		code := name
+		if p.Kind == "RestElement" {
+			code = "*" + name
+		} else if t := g.typeName(kind); t != "" && key != "" {
+			code += ": " + t
+		}
+		switch {
+		case def == nil:
+		case def.Kind == "ArrayExpression" || def.Kind == "ObjectExpression":
+			code += "=None"
+			if strings.Contains(code, ": ") {
+				code = strings.Replace(code, "=None", " = None", 1)
+			}
+			defaults = append(defaults, fmt.Sprintf("if %s is None:", name), fmt.Sprintf("%s%s = %s", g.indent, name, g.expr(def)))
+		case strings.Contains(code, ": "):
+			code += " = " + g.expr(def)
+		default:
+			code += "=" + g.expr(def)
+		}
+		list = append(list, code)
+	}
+	return list, defaults
+}
+
+// enter starts a function's scope of names, writing the global and
+// nonlocal declarations for the names it assigns without binding
+func (g *pyGen) enter(params, body []*node) {
+	bound := map[string]bool{}
+	for _, p := range params {
+		if name, _ := param(p); name != "" {
+			bound[name] = true
+		}
+	}
+	var assigned []string
+	seen := map[string]bool{}
+	for _, s := range body {
+		walk(s, func(n *node) bool {
+			switch n.Kind {
+			case "FunctionDeclaration":
+				bound[funcName(n)] = true
+				return false
+			case "ClassDeclaration":
+				bound[n.Label] = true
+				return false
+			case "FunctionExpression", "ArrowFunctionExpression", "ClassExpression":
+				return false
+			case "VariableDeclaration":
+				for _, d := range childrenOf(n, "declarations") {
+					walk(child(d, "id"), func(id *node) bool {
+						if id.Kind == "Identifier" {
+							bound[id.Label] = true
+						}
+						return true
+					})
+				}
+			case "CatchClause":
+				if p := child(n, "param"); p != nil && p.Kind == "Identifier" {
+					bound[p.Label] = true
+				}
+			case "AssignmentExpression", "UpdateExpression":
+				target := child(n, "left")
+				if n.Kind == "UpdateExpression" {
+					target = child(n, "argument")
+				}
+				if target.Kind == "Identifier" && !seen[target.Label] {
+					seen[target.Label] = true
+					assigned = append(assigned, target.Label)
+				}
+			}
+			return true
+		})
+	}
+
+	var globals, nonlocals []string
+	for _, name := range assigned {
+		switch {
+		case bound[name]:
+		case g.enclosingLocal(name):
+			nonlocals = append(nonlocals, name)
+		case g.scopes[0][name] != "" || g.isTopLevel(name):
+			globals = append(globals, name)
+		}
+	}
+	if len(globals) > 0 {
+		g.emit("global " + strings.Join(globals, ", "))
+	}
+	if len(nonlocals) > 0 {
+		g.emit("nonlocal " + strings.Join(nonlocals, ", "))
+	}
+	g.locals = append(g.locals, bound)
+}
+
+// enclosingLocal reports whether an enclosing function binds name
+func (g *pyGen) enclosingLocal(name string) bool {
+	for _, bound := range g.locals {
+		if bound[name] {
+			return true
+		}
+	}
+	return false
+}
+
+// isTopLevel reports whether name is a top-level variable
+func (g *pyGen) isTopLevel(name string) bool {
+	_, ok := g.scopes[0][name]
+	return ok
+}
+
+// fieldValues sets the fields a class declares with an initializer, which
+// JavaScript sets before the constructor's body runs
+func (g *pyGen) fieldValues(body []*node) {
+	for _, f := range g.classFields(g.class) {
+		if f.value != nil {
+			g.emit(fmt.Sprintf("self.%s = %s", pyName(f.name), g.expr(f.value)))
+		}
+	}
+}
+
+// classDeclaration writes a class, with its constructor as __init__, its
+// static methods as staticmethods and its getters and setters as a
+// property
+func (g *pyGen) classDeclaration(cls *node) {
+	name := cls.Label
+	head := "class " + name
+	super := child(cls, "superClass")
+	if super != nil {
+		head += "(" + g.expr(super) + ")"
+	}
+	saved := g.class
+	g.class = name
+	defer func() { g.class = saved }()
+
+	if g.records[name] {
+		g.dataclass(name)
+		return
+	}
+	g.emit(head + ":")
+	g.depth++
+	defer func() { g.depth-- }()
+	members := childrenOf(cls, "body")
+	written := false
+	separate := func() {
+		if written {
+			g.emit("")
+		}
+		written = true
+	}
+	for _, m := range members {
+		if m.Kind == "PropertyDefinition" && strings.HasPrefix(m.Label, "static ") {
+			g.emit(fmt.Sprintf("%s = %s", pyName(strings.TrimPrefix(m.Label, "static ")), g.expr(child(m, "value"))))
+			written = true
+		}
+	}
+
+	hasInit := false
+	fieldsToSet := false
+	for _, f := range g.classFields(name) {
+		fieldsToSet = fieldsToSet || f.value != nil
+	}
+	for _, m := range members {
+		if m.Kind != "MethodDefinition" {
+			continue
+		}
+		separate()
+		g.line = m.Line
+		method := m.Label
+		switch {
+		case method == "constructor":
+			hasInit = true
+			g.function(name, child(m, "value"), "self")
+			continue
+		case strings.HasPrefix(method, "static "):
+			method = strings.TrimPrefix(method, "static ")
+			g.emit("@staticmethod")
+			g.function(name+"."+pyName(method), child(m, "value"), "")
+			continue
+		case strings.HasPrefix(method, "get "):
+			method = strings.TrimPrefix(method, "get ")
+			g.emit("@property")
+		case strings.HasPrefix(method, "set "):
+			method = strings.TrimPrefix(method, "set ")
+			g.emit("@" + pyName(method) + ".setter")
+		}
+		g.function(name+"."+pyName(method), child(m, "value"), "self")
+	}
+	if !hasInit && fieldsToSet {
+		separate()
+		if super != nil {
+			g.emit("def __init__(self, *args):")
+			g.depth++
+			g.emit("super().__init__(*args)")
+		} else {
+			g.emit("def __init__(self):")
+			g.depth++
+		}
+		g.fieldValues(nil)
+		g.depth--
+	}
+	if !written {
+		g.emit("pass")
+	}
+}
+
+// dataclass writes a record as a dataclass, which compares by value
+// with ==, so it has no equals method. A field whose type couldn't be
+// inferred is annotated float, since records mostly hold numbers.
+func (g *pyGen) dataclass(name string) {
+	g.imports["from dataclasses import dataclass"] = true
+	g.emit("@dataclass")
+	g.emit(fmt.Sprintf("class %s:", name))
+	g.depth++
+	defer func() { g.depth-- }()
+	fields := g.classFields(name)
+	if len(fields) == 0 {
+		g.emit("pass")
+	}
+	for _, f := range fields {
+		t := g.typeName(f.kind)
+		if t == "" {
+			t = "float"
+		}
+		g.emit(fmt.Sprintf("%s: %s", f.name, t))
+	}
+}
+
+// pyName is a name as Python spells it: a private #name is _name
+func pyName(name string) string {
+	return strings.Replace(name, "#", "_", 1)
+}
+
+// typeName is the annotation for a kind, "" to leave it out. Classes are
+// named in a string, as a method can return its own class before the
+// class is defined.
+func (g *pyGen) typeName(kind string) string {
+	switch {
+	case kind == kindInt || kind == kindIndex:
+		return "int"
+	case kind == kindFloat:
+		return "float"
+	case kind == kindString:
+		return "str"
+	case kind == kindBool:
+		return "bool"
+	case isArray(kind):
+		if elem := g.typeName(elemKind(kind)); elem != "" && !strings.HasPrefix(elem, `"`) {
+			return "list[" + elem + "]"
+		}
+		return "list"
+	case kind == kindObject:
+		return "dict"
+	case strings.HasPrefix(kind, kindClass):
+		return quote(strings.TrimPrefix(kind, kindClass))
+	}
+	return ""
+}
+
+func (g *pyGen) block(body []*node) {
+	for _, s := range body {
+		g.stmt(s)
+	}
+}
+
+// body writes a statement nested one level deeper, in its own scope
+func (g *pyGen) body(s *node) {
+	g.depth++
+	g.push()
+	before := g.out.Len()
+	if s != nil && s.Kind == "BlockStatement" {
+		g.block(s.Children)
+	} else if s != nil {
+		g.stmt(s)
+	}
+	if g.out.Len() == before {
+		g.emit("pass")
+	}
+	g.pop()
+	g.depth--
+}
+
+func (g *pyGen) stmt(s *node) {
+	if s.Line > 0 {
+		g.line = s.Line
+	}
+	switch s.Kind {
+	case "VariableDeclaration":
+		if name, fn, ok := functionConst(s); ok {
+			g.declare(name, kindFunc)
+			g.def(name, fn)
+			return
+		}
+		g.declaration(s)
+	case "FunctionDeclaration":
+		g.declare(funcName(s), kindFunc)
+		g.def(funcName(s), s)
+	case "ClassDeclaration":
+		g.classDeclaration(s)
+	case "ExpressionStatement":
+		g.expressionStatement(child(s, "expression"))
+	case "IfStatement":
+		g.emit(fmt.Sprintf("if %s:", g.expr(child(s, "test"))))
+		g.body(child(s, "consequent"))
+		alt := child(s, "alternate")
+		for alt != nil && alt.Kind == "IfStatement" {
+			g.emit(fmt.Sprintf("elif %s:", g.expr(child(alt, "test"))))
+			g.body(child(alt, "consequent"))
+			alt = child(alt, "alternate")
+		}
+		if alt != nil {
+			g.emit("else:")
+			g.body(alt)
+		}
+	case "ForStatement":
+		g.forStatement(s)
+	case "ForOfStatement":
+		left, right := child(s, "left"), child(s, "right")
+		g.declare(left.Label, elemKind(g.kindOf(right)))
+		source := g.expr(right)
+		if left.Kind == "ArrayPattern" && g.kindOf(right) == kindObject && !g.isSet(right) {
+			// a Map iterates its entries, and a dict its keys
+			source = g.operand(right, 150) + ".items()"
+		}
+		g.emit(fmt.Sprintf("for %s in %s:", g.target(left), source))
+		g.body(child(s, "body"))
+	case "ForInStatement":
+		left, right := child(s, "left"), child(s, "right")
+		if isArray(g.kindOf(right)) {
+			g.declare(left.Label, kindInt)
+			g.emit(fmt.Sprintf("for %s in range(len(%s)):", left.Label, g.expr(right)))
+		} else {
+			g.declare(left.Label, kindString)
+			g.emit(fmt.Sprintf("for %s in %s:", left.Label, g.expr(right)))
+		}
+		g.body(child(s, "body"))
+	case "WhileStatement":
+		g.emit(fmt.Sprintf("while %s:", g.expr(child(s, "test"))))
+		g.body(child(s, "body"))
+	case "DoWhileStatement":
+		g.emit("while True:")
+		g.body(child(s, "body"))
+		g.depth++
+		g.emit(fmt.Sprintf("if not %s:", g.operand(child(s, "test"), 45)))
+		g.emit(g.indent + "break")
+		g.depth--
+	case "BlockStatement":
+		g.block(s.Children)
+	case "ReturnStatement":
+		if x := child(s, "argument"); x != nil {
+			g.emit("return " + g.expr(x))
+		} else {
+			g.emit("return")
+		}
+	case "BreakStatement", "ContinueStatement":
+		if s.Label != "" {
+			g.unsupported("A labeled break or continue")
+		}
+		g.emit(strings.ToLower(strings.TrimSuffix(s.Kind, "Statement")))
+	case "ThrowStatement":
+		g.emit("raise " + g.exception(child(s, "argument")))
+	case "TryStatement":
+		g.emit("try:")
+		g.body(child(s, "block"))
+		if handler := child(s, "handler"); handler != nil {
+			if p := child(handler, "param"); p != nil && p.Kind == "Identifier" {
+				g.emit(fmt.Sprintf("except Exception as %s:", p.Label))
+				g.depth++
+				g.push()
+				g.declare(p.Label, kindError)
+				g.depth--
+				g.body(child(handler, "body"))
+				g.pop()
+			} else {
+				g.emit("except Exception:")
+				g.body(child(handler, "body"))
+			}
+		}
+		if finalizer := child(s, "finalizer"); finalizer != nil {
+			g.emit("finally:")
+			g.body(finalizer)
+		}
+	case "SwitchStatement":
+		g.switchStatement(s)
+	case "LabeledStatement":
+		g.stmt(child(s, "body"))
+	case "EmptyStatement":
+	default:
+		g.unsupported(s.Kind)
+	}
+}
+
+// def writes a function bound to a name inside a block, which Python
+// declares with def like any other
+func (g *pyGen) def(name string, fn *node) {
+	saved := g.class
+	g.class = ""
+	g.function(name, fn, "")
+	g.class = saved
+}
+
+// expressionStatement writes an expression evaluated for its effect
+func (g *pyGen) expressionStatement(x *node) {
+	if array, item, body, ok := forEachLoop(x); ok {
+		g.declare(item.Label, elemKind(g.kindOf(array)))
+		g.emit(fmt.Sprintf("for %s in %s:", item.Label, g.expr(array)))
+		g.body(&node{Kind: "BlockStatement", Children: body})
+		return
+	}
+	switch x.Kind {
+	case "UpdateExpression":
+		op := "+="
+		if strings.HasPrefix(x.Label, "--") {
+			op = "-="
+		}
+		g.emit(fmt.Sprintf("%s %s 1", g.expr(child(x, "argument")), op))
+		return
+	case "AssignmentExpression":
+		l, r := child(x, "left"), child(x, "right")
+		// the logical assignments assign only when the target is
+		// nullish, falsy or truthy
+		var test string
+		switch x.Label {
+		case "??=":
+			test = g.operand(l, 50) + " is None"
+		case "||=":
+			test = "not " + g.operand(l, 45)
+		case "&&=":
+			test = g.expr(l)
+		}
+		if test != "" {
+			g.emit(fmt.Sprintf("if %s:", test))
+			g.depth++
+			g.emit(g.expr(l) + " = " + g.expr(r))
+			g.depth--
+			return
+		}
+		if sw, ok := switchExpression(r); ok && x.Label == "=" {
+			g.switchStatement(assigningSwitch(sw, l))
+			return
+		}
+		if x.Label == "=" && r.Kind == "AssignmentExpression" && r.Label == "=" {
+			// a = b = value chains the same way in Python
+			targets := []string{g.expr(l)}
+			for r.Kind == "AssignmentExpression" && r.Label == "=" {
+				targets = append(targets, g.expr(child(r, "left")))
+				r = child(r, "right")
+			}
+			g.emit(strings.Join(targets, " = ") + " = " + g.expr(r))
+			return
+		}
+	case "CallExpression":
+		object, prop, ok := member(child(x, "callee"))
+		args := childrenOf(x, "arguments")
+		switch {
+		case !ok:
+		case (prop == "sort" || prop == "reverse") && !isString(g.kindOf(object)):
+			// sort and reverse sort the list in place, as JavaScript's do
+			g.emit(g.sortCall(object, prop, args, true))
+			return
+		case prop == "set" && len(args) == 2 && g.kindOf(object) == kindObject:
+			g.emit(fmt.Sprintf("%s[%s] = %s", g.operand(object, 150), g.expr(args[0]), g.expr(args[1])))
+			return
+		}
+	}
+	g.emit(g.expr(x))
+}
+
+func isString(kind string) bool {
+	return kind == kindString
+}
+
+// target writes the variable a for...of loop binds, which destructures
+// a pair such as [key, value]
+func (g *pyGen) target(left *node) string {
+	if left.Kind != "ArrayPattern" {
+		return g.expr(left)
+	}
+	var names []string
+	for _, e := range childrenOf(left, "elements") {
+		name, _ := param(e)
+		if e.Kind == "Elision" {
+			name = "_"
+		}
+		g.declare(name, "")
+		names = append(names, name)
+	}
+	return strings.Join(names, ", ")
+}
+
+func (g *pyGen) declaration(s *node) {
+	for _, d := range childrenOf(s, "declarations") {
+		id, init := child(d, "id"), child(d, "init")
+		if id.Kind != "Identifier" {
+			g.destructure(id, init)
+			continue
+		}
+		if init == nil {
+			g.declare(id.Label, "")
+			g.emit(id.Label + " = None")
+			continue
+		}
+		if sw, ok := switchExpression(init); ok {
+			// match is a statement in Python, so each case assigns
+			g.declare(id.Label, g.kindOf(init))
+			g.switchStatement(assigningSwitch(sw, id))
+			continue
+		}
+		value := g.expr(init)
+		g.declare(id.Label, g.kindOf(init))
+		if init.Kind == "NewExpression" && isIdent(child(init, "callee"), "Set") {
+			g.sets[id.Label] = true
+		}
+		g.emit(id.Label + " = " + value)
+	}
+}
+
+// isParsed reports whether x is parsed JSON, which is a dict in Python
+func isParsed(x *node) bool {
+	if x.Kind == "AwaitExpression" {
+		x = child(x, "argument")
+	}
+	if x.Kind != "CallExpression" {
+		return false
+	}
+	object, prop, ok := member(child(x, "callee"))
+	return ok && (prop == "json" || prop == "parse" && isIdent(object, "JSON"))
+}
+
+// destructure writes a destructuring declaration: an array pattern
+// without defaults unpacks, anything else is a variable per name
+func (g *pyGen) destructure(pattern, init *node) {
+	source := g.expr(init)
+	if pattern.Kind == "ArrayPattern" {
+		var names []string
+		simple := true
+		for _, e := range childrenOf(pattern, "elements") {
+			name, def := param(e)
+			g.declare(name, elemKind(g.kindOf(init)))
+			if def != nil {
+				simple = false
+			}
+			switch e.Kind {
+			case "Elision":
+				name = "_"
+			case "RestElement":
+				name = "*" + name
+			}
+			names = append(names, name)
+		}
+		if simple {
+			if n := len(names); n > 0 && !strings.HasPrefix(names[n-1], "*") {
+				// JavaScript ignores the elements past the pattern's
+				names = append(names, "*_")
+			}
+			g.emit(strings.Join(names, ", ") + " = " + source)
+			return
+		}
+	}
+	if init.Kind != "Identifier" {
+		g.emit("destructured = " + source)
+		source = "destructured"
+	}
+	switch pattern.Kind {
+	case "ArrayPattern":
+		for i, e := range childrenOf(pattern, "elements") {
+			name, def := param(e)
+			switch {
+			case e.Kind == "Elision":
+			case e.Kind == "RestElement":
+				g.emit(fmt.Sprintf("%s = %s[%d:]", name, source, i))
+			case def != nil:
+				g.emit(fmt.Sprintf("%s = %s[%d] if len(%s) > %d else %s", name, source, i, source, i, g.expr(def)))
+			default:
+				g.emit(fmt.Sprintf("%s = %s[%d]", name, source, i))
+			}
+		}
+	case "ObjectPattern":
+		for _, p := range childrenOf(pattern, "properties") {
+			name, def := param(child(p, "value"))
+			if p.Kind == "RestElement" || name == "" {
+				g.unsupported("An object rest or nested pattern")
+				continue
+			}
+			g.declare(name, "")
+			if def != nil {
+				g.emit(fmt.Sprintf("%s = %s.get(%s, %s)", name, source, quote(p.Label), g.expr(def)))
+			} else {
+				g.emit(fmt.Sprintf("%s = %s[%s]", name, source, quote(p.Label)))
+			}
+		}
+	}
+}
+
+func (g *pyGen) forStatement(s *node) {
+	if c, ok := countingLoop(s); ok {
+		start, end := g.expr(c.start), g.expr(c.end)
+		// range's end is exclusive, one past the last value either way
+		switch {
+		case c.inclusive && !c.down:
+			end = g.offset(c.end, 1)
+		case c.inclusive:
+			end = g.offset(c.end, -1)
+		}
+		args := []string{start, end}
+		switch {
+		case c.step != nil && c.down:
+			args = append(args, "-"+g.expr(c.step))
+		case c.step != nil:
+			args = append(args, g.expr(c.step))
+		case c.down:
+			args = append(args, "-1")
+		case start == "0":
+			args = args[1:]
+		}
+		g.declare(c.name, kindInt)
+		g.emit(fmt.Sprintf("for %s in range(%s):", c.name, strings.Join(args, ", ")))
+		g.body(child(s, "body"))
+		return
+	}
+
+	// any other for loop is its init and a while loop
+	if init := child(s, "init"); init != nil {
+		if isStatement(init) {
+			g.stmt(init)
+		} else {
+			g.expressionStatement(init)
+		}
+	}
+	test := "True"
+	if t := child(s, "test"); t != nil {
+		test = g.expr(t)
+	}
+	update := child(s, "update")
+	if update != nil && containsContinue(child(s, "body")) {
+		g.warn("continue skips the update of a for loop written as a while loop")
+	}
+	g.emit(fmt.Sprintf("while %s:", test))
+	body := []*node{child(s, "body")}
+	if update != nil {
+		body = append(body, &node{Kind: "ExpressionStatement", Children: []*node{{Kind: update.Kind, Label: update.Label, Role: "expression", Children: update.Children}}})
+	}
+	g.body(&node{Kind: "BlockStatement", Children: body})
+}
+
+// offset writes n + by, folding it into n when n is a literal
+func (g *pyGen) offset(n *node, by int64) string {
+	if v, ok := integer(n); ok {
+		return strconv.FormatInt(v+by, 10)
+	}
+	if by < 0 {
+		return fmt.Sprintf("%s - %d", g.operand(n, 110), -by)
+	}
+	return fmt.Sprintf("%s + %d", g.operand(n, 110), by)
+}
+
+// switchStatement writes a switch as a match. Literal cases are literal
+// patterns; any other case value would be a capture pattern in Python,
+// so it's compared in a guard. Cases without a body share the next
+// case's branch; a case that falls into the next after running its own
+// body can't.
+func (g *pyGen) switchStatement(s *node) {
+	g.emit(fmt.Sprintf("match %s:", g.expr(child(s, "discriminant"))))
+	g.depth++
+	var patterns, guards []string
+	cases := childrenOf(s, "cases")
+	for i, c := range cases {
+		switch test := child(c, "test"); {
+		case test == nil:
+			patterns = append(patterns, "_")
+		case g.isLiteralPattern(test):
+			patterns = append(patterns, g.expr(test))
+		default:
+			guards = append(guards, "value == "+g.operand(test, 51))
+		}
+		body := childrenOf(c, "consequent")
+		if len(body) == 0 && i < len(cases)-1 {
+			continue
+		}
+		if !endsAbruptly(body) && i < len(cases)-1 {
+			g.warn("Python match cases don't fall through into the next case")
+		}
+		branch := strings.Join(patterns, " | ")
+		for _, p := range patterns {
+			if p == "_" {
+				branch, guards = "_", nil
+			}
+		}
+		if len(guards) > 0 {
+			if branch != "" {
+				guards = append(guards, "value in ("+strings.ReplaceAll(branch, " | ", ", ")+",)")
+			}
+			branch = "value if " + strings.Join(guards, " or ")
+		}
+		patterns, guards = nil, nil
+		g.emit("case " + branch + ":")
+		g.body(&node{Kind: "BlockStatement", Children: caseBody(c)})
+	}
+	g.depth--
+}
+
+// isLiteralPattern reports whether a case value is a literal Python can
+// match against as a pattern
+func (g *pyGen) isLiteralPattern(test *node) bool {
+	switch test.Kind {
+	case "Literal":
+		return true
+	case "UnaryExpression":
+		_, ok := numberValue(child(test, "argument"))
+		return test.Label == "-" && ok
+	}
+	return false
+}
+
+// pyPrecedence orders operators the way Python does: its comparisons
+// bind less tightly than its bitwise operators, and not less tightly
+// than comparisons
+func pyPrecedence(n *node) int {
+	switch n.Kind {
+	case "ArrowFunctionExpression", "FunctionExpression":
+		return 5
+	case "AssignmentExpression":
+		return 10
+	case "ConditionalExpression":
+		return 20
+	case "BinaryExpression", "LogicalExpression":
+		switch n.Label {
+		case "??":
+			return 20
+		case "||":
+			return 30
+		case "&&":
+			return 40
+		case "==", "!=", "===", "!==", "<", ">", "<=", ">=", "in":
+			return 50
+		case "|":
+			return 60
+		case "^":
+			return 70
+		case "&":
+			return 80
+		case "<<", ">>", ">>>":
+			return 100
+		case "+", "-":
+			return 110
+		case "*", "/", "%":
+			return 120
+		case "**":
+			return 130
+		}
+		return 200
+	case "UnaryExpression":
+		if n.Label == "!" {
+			return 45
+		}
+		return 125
+	case "AwaitExpression":
+		return 135
+	}
+	return 200
+}
+
+// operand writes n, parenthesized when it binds less tightly than prec
+func (g *pyGen) operand(n *node, prec int) string {
+	code := g.expr(n)
+	p := pyPrecedence(n)
+	if _, _, ok := g.recordEquals(n); ok {
+		p = 50
+	}
+	if p < prec {
+		return "(" + code + ")"
+	}
+	return code
+}
+
+// pyOperators are the JavaScript operators Python spells differently
+var pyOperators = map[string]string{
+	"===": "==", "!==": "!=", "&&": "and", "||": "or",
+}
+
+func (g *pyGen) expr(n *node) string {
+	if n == nil {
+		return ""
+	}
+	switch n.Kind {
+	case "Literal":
+		if s, ok := stringValue(n); ok {
+			return quote(s)
+		}
+		switch n.Label {
+		case "true":
+			return "True"
+		case "false":
+			return "False"
+		case "null":
+			return "None"
+		}
+		return n.Label
+	case "Identifier":
+		switch n.Label {
+		case "undefined":
+			return "None"
+		case "NaN":
+			g.imports["math"] = true
+			return "math.nan"
+		case "Infinity":
+			g.imports["math"] = true
+			return "math.inf"
+		}
+		return n.Label
+	case "ThisExpression":
+		return "self"
+	case "Super":
+		return "super()"
+	case "TemplateLiteral":
+		return g.template(n)
+	case "ArrayExpression":
+		elems := childrenOf(n, "elements")
+		list := make([]string, 0, len(elems))
+		for _, e := range elems {
+			list = append(list, g.expr(e))
+		}
+		return "[" + strings.Join(list, ", ") + "]"
+	case "ObjectExpression":
+		var entries []string
+		for _, p := range childrenOf(n, "properties") {
+			if p.Kind == "SpreadElement" {
+				entries = append(entries, "**"+g.operand(child(p, "argument"), 150))
+				continue
+			}
+			key := quote(p.Label)
+			if computed := child(p, "key"); computed != nil {
+				key = g.expr(computed)
+			}
+			entries = append(entries, key+": "+g.expr(child(p, "value")))
+		}
+		return "{" + strings.Join(entries, ", ") + "}"
+	case "ArrowFunctionExpression", "FunctionExpression":
+		return g.lambda(n)
+	case "UnaryExpression":
+		arg := child(n, "argument")
+		switch n.Label {
+		case "!":
+			return "not " + g.operand(arg, 45)
+		case "-", "~":
+			return n.Label + g.operand(arg, 125)
+		case "+":
+			return "float(" + g.expr(arg) + ")"
+		case "typeof":
+			g.warn("Python's type names differ from typeof's; typeof is written as the type's name")
+			return "type(" + g.expr(arg) + ").__name__"
+		case "delete":
+			g.unsupported("delete inside an expression")
+			return g.expr(arg)
+		}
+		g.unsupported("The " + n.Label + " operator")
+		return g.expr(arg)
+	case "UpdateExpression":
+		g.unsupported("++ or -- inside an expression")
+		op := " + 1"
+		if strings.HasPrefix(n.Label, "--") {
+			op = " - 1"
+		}
+		return g.operand(child(n, "argument"), 110) + op
+	case "BinaryExpression":
+		return g.binary(n)
+	case "LogicalExpression":
+		l, r := child(n, "left"), child(n, "right")
+		if n.Label == "??" {
+			left := g.operand(l, 200)
+			return fmt.Sprintf("%s if %s is not None else %s", left, left, g.operand(r, 20))
+		}
+		prec := pyPrecedence(n)
+		return fmt.Sprintf("%s %s %s", g.operand(l, prec), pyOperators[n.Label], g.operand(r, prec+1))
+	case "ConditionalExpression":
+		return fmt.Sprintf("%s if %s else %s", g.operand(child(n, "consequent"), 30), g.operand(child(n, "test"), 30), g.operand(child(n, "alternate"), 20))
+	case "AssignmentExpression":
+		return g.assignment(n)
+	case "CallExpression":
+		if a, b, ok := g.recordEquals(n); ok {
+			return g.operand(a, 51) + " == " + g.operand(b, 51)
+		}
+		return g.call(n)
+	case "NewExpression":
+		return g.newExpr(n)
+	case "MemberExpression":
+		return g.memberExpr(n)
+	case "AwaitExpression":
+		return "await " + g.operand(child(n, "argument"), 150)
+	case "SpreadElement":
+		return "*" + g.operand(child(n, "argument"), 150)
+	case "SequenceExpression":
+		g.unsupported("The comma operator")
+		list := childrenOf(n, "expressions")
+		return g.expr(list[len(list)-1])
+	case "ClassExpression":
+		g.unsupported("A class expression")
+		return "None"
+	}
+	g.unsupported("A " + n.Kind)
+	return "None"
+}
+
+// template writes a template literal as an f-string, or with format when
+// an expression has quotes or backslashes, which an f-string can't hold
+// before Python 3.12
+func (g *pyGen) template(n *node) string {
+	parts, exprs := templateParts(n), childrenOf(n, "expressions")
+	escaped := make([]string, len(parts))
+	for i, part := range parts {
+		escaped[i] = strings.NewReplacer("{", "{{", "}", "}}").Replace(part)
+	}
+	if len(exprs) == 0 {
+		return quote(parts[0])
+	}
+	args := make([]string, 0, len(exprs))
+	inline := true
+	for _, x := range exprs {
+		code := g.expr(x)
+		inline = inline && !strings.ContainsAny(code, "\"\\\n") && x.Kind != "ConditionalExpression" && !isFunction(x)
+		args = append(args, code)
+	}
+	if !inline {
+		return fmt.Sprintf("%s.format(%s)", quote(strings.Join(escaped, "{}")), strings.Join(args, ", "))
+	}
+	var b strings.Builder
+	for i, part := range escaped {
+		b.WriteString(part)
+		if i < len(args) {
+			b.WriteString("{" + args[i] + "}")
+		}
+	}
+	return "f" + quote(b.String())
+}
+
+func (g *pyGen) binary(n *node) string {
+	l, r := child(n, "left"), child(n, "right")
+	lk, rk := g.kindOf(l), g.kindOf(r)
+	prec := pyPrecedence(n)
+	left, right := g.operand(l, prec), g.operand(r, prec+1)
+	switch n.Label {
+	case "+":
+		// Python doesn't convert to string when adding one
+		if lk == kindString && rk != kindString {
+			right = "str(" + g.expr(r) + ")"
+		} else if rk == kindString && lk != kindString {
+			left = "str(" + g.expr(l) + ")"
+		}
+	case "**":
+		// ** groups to the right
+		left, right = g.operand(l, prec+1), g.operand(r, prec)
+	case "==", "!=", "===", "!==", "<", ">", "<=", ">=":
+		// comparisons chain in Python, so a comparison operand is
+		// parenthesized on either side
+		left = g.operand(l, prec+1)
+	case "instanceof":
+		return fmt.Sprintf("isinstance(%s, %s)", g.expr(l), g.expr(r))
+	case "in":
+		left = g.operand(l, prec+1)
+	case ">>>":
+		// the unsigned shift shifts the number's low 32 bits, which
+		// Python's integers, having no width, take with a mask
+		return fmt.Sprintf("(%s & 0xFFFFFFFF) >> %s", g.operand(l, 80), right)
+	}
+	op := n.Label
+	if spelled, ok := pyOperators[op]; ok {
+		op = spelled
+	}
+	// null and undefined are both None, which is compared with is
+	if isNone(l) || isNone(r) {
+		switch op {
+		case "==":
+			op = "is"
+		case "!=":
+			op = "is not"
+		}
+	}
+	return left + " " + op + " " + right
+}
+
+// isNone reports whether x is null or undefined
+func isNone(x *node) bool {
+	return x.Kind == "Literal" && x.Label == "null" || isIdent(x, "undefined")
+}
+
+// assignment writes an assignment inside an expression as Python's :=,
+// which only binds a name; assignments that are statements are written
+// by expressionStatement
+func (g *pyGen) assignment(n *node) string {
+	l, r := child(n, "left"), child(n, "right")
+	switch n.Label {
+	case "??=", "||=", "&&=":
+		g.unsupported("The " + n.Label + " operator inside an expression")
+	case ">>>=":
+		return fmt.Sprintf("%s = (%s & 0xFFFFFFFF) >> %s", g.expr(l), g.operand(l, 80), g.operand(r, 101))
+	case "+=":
+		if g.kindOf(l) == kindString && g.kindOf(r) != kindString {
+			return fmt.Sprintf("%s += str(%s)", g.expr(l), g.expr(r))
+		}
+	}
+	if n.Label == "=" || n.Label == "??=" || n.Label == "||=" || n.Label == "&&=" {
+		return g.expr(l) + " = " + g.expr(r)
+	}
+	return g.expr(l) + " " + n.Label + " " + g.expr(r)
+}
+
+// lambda writes a function expression as a lambda. A lambda holds one
+// expression, so a function with statements is written as a def ahead of
+// the statement using it, and named there.
+func (g *pyGen) lambda(fn *node) string {
+	params, body, expr := function(fn)
+	if expr == nil && len(body) == 1 && body[0].Kind == "ReturnStatement" && child(body[0], "argument") != nil {
+		expr = child(body[0], "argument")
+	} else if expr == nil && len(body) == 1 && body[0].Kind == "ExpressionStatement" && !isAssignment(child(body[0], "expression")) {
+		expr = child(body[0], "expression")
+	}
+	if isAsync(fn) || (expr == nil && len(body) > 0) || isAssignment(expr) {
+		g.callbacks++
+		name := "callback"
+		if g.callbacks > 1 {
+			name += strconv.Itoa(g.callbacks)
+		}
+		g.def(name, fn)
+		return name
+	}
+	g.push()
+	defer g.pop()
+	list, _ := g.params("", params, body, expr)
+	head := "lambda"
+	if len(list) > 0 {
+		head += " " + strings.Join(list, ", ")
+	}
+	if expr == nil {
+		return head + ": None"
+	}
+	return head + ": " + g.expr(expr)
+}
+
+func isAssignment(x *node) bool {
+	return x != nil && (x.Kind == "AssignmentExpression" || x.Kind == "UpdateExpression")
+}
+
+func (g *pyGen) memberExpr(n *node) string {
+	object, prop, ok := member(n)
+	if strings.HasPrefix(n.Label, "?") {
+		g.warn("Python has no optional chaining; ?. is written as plain access")
+	}
+	if !ok {
+		return fmt.Sprintf("%s[%s]", g.operand(child(n, "object"), 150), g.expr(child(n, "property")))
+	}
+	kind := g.kindOf(object)
+	if object.Kind == "Identifier" && object.Label == "Math" {
+		g.imports["math"] = true
+		switch prop {
+		case "PI":
+			return "math.pi"
+		case "E":
+			return "math.e"
+		}
+		return "math." + strings.ToLower(prop)
+	}
+	switch {
+	case prop == "length" || prop == "size":
+		return "len(" + g.expr(object) + ")"
+	case prop == "message" && kind == kindError:
+		return "str(" + g.expr(object) + ")"
+	case kind == kindObject:
+		return fmt.Sprintf("%s[%s]", g.operand(object, 150), quote(prop))
+	}
+	return g.operand(object, 150) + "." + pyName(prop)
+}
+
+// pyMathFunctions are the Math functions Python has as builtins, by
+// their Python name; the others are in the math module
+var pyMathFunctions = map[string]string{
+	"abs": "abs", "min": "min", "max": "max", "pow": "pow", "round": "round",
+}
+
+// pyMethods are the JavaScript string and list methods whose Python
+// equivalent differs only in name
+var pyMethods = map[string]string{
+	"push": "append", "toUpperCase": "upper", "toLowerCase": "lower", "trim": "strip",
+	"trimStart": "lstrip", "trimEnd": "rstrip", "startsWith": "startswith", "endsWith": "endswith",
+	"padStart": "rjust", "padEnd": "ljust", "replaceAll": "replace",
+}
+
+func (g *pyGen) call(n *node) string {
+	callee, args := child(n, "callee"), childrenOf(n, "arguments")
+	if n.Label == "?." {
+		g.warn("Python has no optional chaining; ?.() is written as a plain call")
+	}
+	// a callback is written once, as writing one may hoist a def
+	if object, prop, ok := member(callee); ok && len(args) > 0 && isFunction(args[0]) {
+		switch prop {
+		case "map", "filter", "some", "every", "find":
+			if len(args) == 1 {
+				return g.comprehension(object, prop, args[0])
+			}
+		case "sort":
+			return g.sortCall(object, prop, args, false)
+		case "forEach":
+			g.unsupported("forEach inside an expression")
+			return "[" + g.callFunction(args[0], "item") + " for item in " + g.expr(object) + "]"
+		}
+	}
+	written := make([]string, 0, len(args))
+	for _, arg := range args {
+		written = append(written, g.expr(arg))
+	}
+	list := strings.Join(written, ", ")
+
+	if callee.Kind == "Identifier" {
+		switch callee.Label {
+		case "String":
+			return "str(" + list + ")"
+		case "Number", "parseFloat":
+			return "float(" + list + ")"
+		case "parseInt":
+			return "int(" + list + ")"
+		case "Boolean":
+			return "bool(" + list + ")"
+		case "isNaN":
+			g.imports["math"] = true
+			return "math.isnan(" + list + ")"
+		case "prompt":
+			return "input(" + list + ")"
+		}
+		return callee.Label + "(" + list + ")"
+	}
+	if callee.Kind == "Super" {
+		return "super().__init__(" + list + ")"
+	}
+	object, prop, ok := member(callee)
+	if !ok && isFunction(callee) {
+		// a function called where it's written is written as a def,
+		// or a lambda, which needs parentheses
+		if name := g.expr(callee); !strings.HasPrefix(name, "lambda") {
+			return name + "(" + list + ")"
+		}
+	}
+	if !ok {
+		return g.operand(callee, 150) + "(" + list + ")"
+	}
+	if object.Kind == "Identifier" {
+		switch object.Label {
+		case "console":
+			if prop == "error" || prop == "warn" {
+				g.imports["sys"] = true
+				return "print(" + strings.Join(append(written, "file=sys.stderr"), ", ") + ")"
+			}
+			return "print(" + list + ")"
+		case "Math":
+			switch prop {
+			case "random":
+				g.imports["random"] = true
+				return "random.random()"
+			case "sign":
+				g.imports["math"] = true
+				return fmt.Sprintf("math.copysign(1, %s) if %s else 0", list, list)
+			}
+			if name, found := pyMathFunctions[prop]; found {
+				return name + "(" + list + ")"
+			}
+			g.imports["math"] = true
+			return "math." + prop + "(" + list + ")"
+		case "Object":
+			switch prop {
+			case "keys":
+				return "list(" + list + ")"
+			case "values":
+				return "list(" + g.operand(args[0], 150) + ".values())"
+			case "entries":
+				return "list(" + g.operand(args[0], 150) + ".items())"
+			}
+		case "Array":
+			if prop == "isArray" {
+				return "isinstance(" + list + ", list)"
+			}
+		case "Number":
+			if prop == "isInteger" {
+				return "float(" + list + ").is_integer()"
+			}
+		}
+	}
+	if object.Kind == "Super" {
+		return "super()." + pyName(prop) + "(" + list + ")"
+	}
+
+	kind := g.kindOf(object)
+	receiver := g.operand(object, 150)
+	switch prop {
+	case "includes", "has":
+		return g.operand(firstArg(args), 51) + " in " + g.operand(object, 51)
+	case "indexOf":
+		if kind == kindString {
+			return receiver + ".find(" + list + ")"
+		}
+		g.warn("list.index raises ValueError where indexOf returns -1")
+		return receiver + ".index(" + list + ")"
+	case "pop":
+		return receiver + ".pop()"
+	case "shift":
+		return receiver + ".pop(0)"
+	case "unshift":
+		return receiver + ".insert(0, " + list + ")"
+	case "join":
+		separator := `","`
+		if len(args) > 0 {
+			separator = g.operand(args[0], 150)
+		}
+		if elemKind(kind) == kindString {
+			return separator + ".join(" + g.expr(object) + ")"
+		}
+		return separator + ".join(map(str, " + g.expr(object) + "))"
+	case "toString":
+		return "str(" + g.expr(object) + ")"
+	case "toFixed":
+		digits := "0"
+		if len(args) > 0 {
+			digits = written[0]
+		}
+		if _, ok := integer(firstArg(args)); ok || len(args) == 0 {
+			return fmt.Sprintf(`format(%s, ".%sf")`, g.expr(object), digits)
+		}
+		return fmt.Sprintf(`format(%s, f".{%s}f")`, g.expr(object), digits)
+	case "charAt":
+		return receiver + "[" + list + "]"
+	case "slice", "substring":
+		for len(written) < 2 {
+			written = append(written, "")
+		}
+		return receiver + "[" + strings.Join(written, ":") + "]"
+	case "concat":
+		parts := []string{g.operand(object, 111)}
+		for _, arg := range args {
+			parts = append(parts, g.operand(arg, 111))
+		}
+		return strings.Join(parts, " + ")
+	case "repeat":
+		return g.operand(object, 120) + " * " + g.operand(firstArg(args), 121)
+	case "replace":
+		if len(args) == 2 {
+			return receiver + ".replace(" + list + ", 1)"
+		}
+	case "split":
+		if len(args) == 1 {
+			if sep, ok := stringValue(args[0]); ok && sep == "" {
+				return "list(" + g.expr(object) + ")"
+			}
+		}
+	case "reduce":
+		// Python takes the initial value after the list
+		g.imports["functools"] = true
+		return "functools.reduce(" + strings.Join(append([]string{written[0], g.expr(object)}, written[1:]...), ", ") + ")"
+	case "sort", "reverse":
+		return g.sortCall(object, prop, args, false)
+	case "set":
+		if kind == kindObject && len(args) == 2 {
+			g.unsupported("Map.set inside an expression")
+			return fmt.Sprintf("%s.update({%s: %s})", receiver, written[0], written[1])
+		}
+	case "delete":
+		if g.isSet(object) {
+			return receiver + ".discard(" + list + ")"
+		}
+		if kind == kindObject && len(args) == 1 {
+			return fmt.Sprintf("%s.pop(%s, None)", receiver, written[0])
+		}
+	case "entries":
+		if kind == kindObject {
+			return receiver + ".items()"
+		}
+	case "values":
+		if g.isSet(object) {
+			return g.expr(object)
+		}
+	case "then":
+		g.unsupported("then on a promise")
+	}
+	if name, found := pyMethods[prop]; found {
+		return receiver + "." + name + "(" + list + ")"
+	}
+	if kind == kindObject && !pyDictMethods[prop] {
+		// a function kept in an object
+		return fmt.Sprintf("%s[%s](%s)", receiver, quote(prop), list)
+	}
+	return receiver + "." + pyName(prop) + "(" + list + ")"
+}
+
+// pyDictMethods are the methods of a Map and a Set that a dict and a set
+// have by the same name
+var pyDictMethods = map[string]bool{"get": true, "keys": true, "values": true, "add": true, "clear": true}
+
+// kindOf is generator's kindOf, but for the builtins, which are objects
+// in JavaScript and classes in Python, and parsed JSON, which is a dict
+func (g *pyGen) kindOf(n *node) string {
+	switch {
+	case n != nil && n.Kind == "Identifier" && transpiler.IsStdlib(n.Label):
+		return ""
+	case n != nil && isParsed(n):
+		return kindObject
+	}
+	return g.generator.kindOf(n)
+}
+
+// isSet reports whether x is a variable holding a Set
+func (g *pyGen) isSet(x *node) bool {
+	return x.Kind == "Identifier" && g.sets[x.Label]
+}
+
+// comprehension writes map, filter, some, every and find on a list as a
+// comprehension over it, or a generator expression where one will do
+func (g *pyGen) comprehension(object *node, prop string, fn *node) string {
+	item := "item"
+	if isFunction(fn) {
+		if params, _, _ := function(fn); len(params) > 0 && params[0].Kind == "Identifier" {
+			item = params[0].Label
+		}
+	}
+	g.push()
+	defer g.pop()
+	g.declare(item, elemKind(g.kindOf(object)))
+	value := g.callFunction(fn, item)
+	source := g.expr(object)
+	switch prop {
+	case "map":
+		return fmt.Sprintf("[%s for %s in %s]", value, item, source)
+	case "filter":
+		return fmt.Sprintf("[%s for %s in %s if %s]", item, item, source, value)
+	case "some":
+		return fmt.Sprintf("any(%s for %s in %s)", value, item, source)
+	case "every":
+		return fmt.Sprintf("all(%s for %s in %s)", value, item, source)
+	}
+	return fmt.Sprintf("next((%s for %s in %s if %s), None)", item, item, source, value)
+}
+
+// callFunction writes fn called with item: the body of a one-parameter
+// arrow function with item for its parameter, or a call of anything else
+func (g *pyGen) callFunction(fn *node, item string) string {
+	if isFunction(fn) && !isAsync(fn) {
+		params, body, expr := function(fn)
+		if expr == nil && len(body) == 1 && body[0].Kind == "ReturnStatement" {
+			expr = child(body[0], "argument")
+		}
+		if expr != nil && len(params) <= 1 && (len(params) == 0 || params[0].Kind == "Identifier") && !isAssignment(expr) {
+			return g.operand(expr, 21)
+		}
+		if name := g.expr(fn); !strings.HasPrefix(name, "lambda") {
+			return name + "(" + item + ")"
+		}
+	}
+	return g.operand(fn, 150) + "(" + item + ")"
+}
+
+// sortCall writes sort or reverse: in place as a statement, and on a copy
+// inside an expression, as Python's sort returns None. A comparator
+// becomes a key through functools.cmp_to_key.
+func (g *pyGen) sortCall(object *node, prop string, args []*node, statement bool) string {
+	var options []string
+	if prop == "sort" && len(args) > 0 {
+		g.imports["functools"] = true
+		options = append(options, "key=functools.cmp_to_key("+g.expr(args[0])+")")
+	}
+	source := g.expr(object)
+	switch {
+	case statement:
+		return g.operand(object, 150) + "." + prop + "(" + strings.Join(options, ", ") + ")"
+	case prop == "reverse":
+		return source + "[::-1]"
+	}
+	return "sorted(" + strings.Join(append([]string{source}, options...), ", ") + ")"
+}
+
+// exception writes the value a throw raises: an Error's message as an
+// Exception, and anything else wrapped in one
+func (g *pyGen) exception(x *node) string {
+	if x.Kind == "NewExpression" {
+		if callee := child(x, "callee"); callee.Kind == "Identifier" && strings.HasSuffix(callee.Label, "Error") && g.classes[callee.Label] == nil {
+			return g.newExpr(x)
+		}
+	}
+	if g.kindOf(x) == kindError || strings.HasPrefix(g.kindOf(x), kindClass) {
+		return g.expr(x)
+	}
+	return "Exception(" + g.expr(x) + ")"
+}
+
+// pyErrors are the Python exceptions for JavaScript's error classes
+var pyErrors = map[string]string{
+	"Error": "Exception", "TypeError": "TypeError", "RangeError": "ValueError",
+	"SyntaxError": "SyntaxError", "ReferenceError": "NameError",
+}
+
+func (g *pyGen) newExpr(n *node) string {
+	callee, args := child(n, "callee"), childrenOf(n, "arguments")
+	written := make([]string, 0, len(args))
+	for _, arg := range args {
+		written = append(written, g.expr(arg))
+	}
+	list := strings.Join(written, ", ")
+	switch name := callee.Label; {
+	case callee.Kind != "Identifier":
+		g.unsupported("new with a computed class")
+	case name == "Map" || name == "Object":
+		if len(args) > 0 {
+			return "dict(" + list + ")"
+		}
+		return "{}"
+	case name == "Set":
+		return "set(" + list + ")"
+	case name == "Array":
+		return "[]"
+	case pyErrors[name] != "" && g.classes[name] == nil:
+		return pyErrors[name] + "(" + list + ")"
+	case name == "Date":
+		g.imports["datetime"] = true
+		if len(args) > 0 {
+			g.warn("new Date(...) is written as the current time; Python parses dates with datetime")
+		}
+		return "datetime.datetime.now()"
+	}
+	return g.expr(callee) + "(" + list + ")"
+}
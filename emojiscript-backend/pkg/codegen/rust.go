@@ -0,0 +1,1457 @@
+package codegen
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+
+	"emojiscript-backend/pkg/transpiler"
+)
+
+// rustGen writes a program as a Rust crate's main.rs: functions, and
+// classes as a struct with an impl, are items, and the other top-level
+// statements make up main. Numbers are f64 apart from range loop
+// counters, strings are &str until they're built, and arrays are Vecs.
+type rustGen struct {
+	*generator
+	// uses are the std paths the program needs a use declaration for
+	uses map[string]bool
+	// this is what this is written as: self in a method, or the value a
+	// constructor builds
+	this string
+	// assigned are the values assigned to each name with = and ??=, and
+	// defaulted the names assigned with ??=
+	assigned  map[string][]*node
+	defaulted map[string]bool
+}
+
+// program writes the program, returning the use declarations it needs
+// apart, as they go ahead of any builtin definitions
+func (g *rustGen) program(root *node) (string, string) {
+	walk(root, func(n *node) bool {
+		if left := child(n, "left"); n.Kind == "AssignmentExpression" && left.Kind == "Identifier" && (n.Label == "=" || n.Label == "??=") {
+			g.assigned[left.Label] = append(g.assigned[left.Label], child(n, "right"))
+			g.defaulted[left.Label] = g.defaulted[left.Label] || n.Label == "??="
+		}
+		return true
+	})
+	var main []*node
+	for _, s := range root.Children {
+		g.line = s.Line
+		switch {
+		case isStdlibDefinition(s):
+		case s.Kind == "FunctionDeclaration":
+			g.function(funcName(s), s, "")
+			g.emit("")
+		case s.Kind == "ClassDeclaration":
+			g.classDeclaration(s)
+			g.emit("")
+		case isFunctionConst(s):
+			name, fn, _ := functionConst(s)
+			g.function(name, fn, "")
+			g.emit("")
+		case g.constItem(s):
+			g.emit("")
+		default:
+			main = append(main, s)
+		}
+	}
+	g.emit("fn main() {")
+	g.depth++
+	g.block(main)
+	g.depth--
+	g.emit("}")
+
+	var header strings.Builder
+	uses := make([]string, 0, len(g.uses))
+	for path := range g.uses {
+		uses = append(uses, path)
+	}
+	sort.Strings(uses)
+	for _, path := range uses {
+		fmt.Fprintf(&header, "use %s;\n", path)
+	}
+	return header.String(), g.out.String()
+}
+
+// constItem writes a top-level const with a literal value that functions
+// read as a Rust const, which they can see, unlike main's variables
+func (g *rustGen) constItem(s *node) bool {
+	if s.Kind != "VariableDeclaration" || s.Label != "const" {
+		return false
+	}
+	for _, d := range childrenOf(s, "declarations") {
+		id, init := child(d, "id"), child(d, "init")
+		if id.Kind != "Identifier" || !g.shared[id.Label] || init == nil || init.Kind != "Literal" || g.kindOf(init) == "" {
+			return false
+		}
+	}
+	for _, d := range childrenOf(s, "declarations") {
+		id, init := child(d, "id"), child(d, "init")
+		kind := g.kindOf(init)
+		g.declare(id.Label, kind)
+		g.emit(fmt.Sprintf("const %s: %s = %s;", id.Label, g.letType(init, kind), g.expr(init)))
+	}
+	return true
+}
+
+// function writes fn as a fn; key names it in calls, "Class.method" for
+// a method, whose receiver is its self parameter
+func (g *rustGen) function(key string, fn *node, receiver string) {
+	name := key[strings.LastIndex(key, ".")+1:]
+	if isAsync(fn) {
+		g.warn("async functions have no direct equivalent in Rust without an async runtime; %s is a plain fn", name)
+	}
+	params, body, expr := function(fn)
+	result := ""
+	hasResult := expr != nil || hasReturnValue(body)
+	if hasResult {
+		result = g.resultKind(key, fn)
+	}
+
+	g.push()
+	var list []string
+	if receiver != "" {
+		list = append(list, receiver)
+	}
+	for i, p := range params {
+		pname, def := param(p)
+		if pname == "" {
+			g.unsupported("A destructuring parameter")
+			pname = fmt.Sprintf("arg%d", i)
+		}
+		if def != nil {
+			g.warn("Rust has no default parameter values; callers of %s must pass %s", name, pname)
+		}
+		kind := g.paramKind(key, i, p, body, expr)
+		g.declare(pname, kind)
+		list = append(list, pname+": "+g.typeName(kind, "parameter "+pname, true))
+	}
+	signature := fmt.Sprintf("fn %s(%s)", name, strings.Join(list, ", "))
+	if hasResult {
+		signature += " -> " + g.typeName(result, "the value "+name+" returns", false)
+	}
+
+	saved := g.result
+	g.result = result
+	g.emit(signature + " {")
+	g.depth++
+	switch n := len(body); {
+	case expr != nil:
+		g.emit(g.owned(expr, result))
+	case n > 0 && body[n-1].Kind == "ReturnStatement" && child(body[n-1], "argument") != nil:
+		// the last return is the fn's tail expression
+		g.block(body[:n-1])
+		g.line = body[n-1].Line
+		g.emit(g.owned(child(body[n-1], "argument"), result))
+	default:
+		g.block(body)
+	}
+	g.depth--
+	g.emit("}")
+	g.result = saved
+	g.pop()
+}
+
+// classDeclaration writes a class as a struct of its fields and an impl of its
+// constructor, as new, and its methods
+func (g *rustGen) classDeclaration(cls *node) {
+	name := cls.Label
+	if super := child(cls, "superClass"); super != nil {
+		g.warn("Rust has no inheritance; %s doesn't extend %s", name, g.expr(super))
+	}
+	saved := g.class
+	g.class = name
+	defer func() { g.class = saved }()
+
+	fields := g.classFields(name)
+	if g.records[name] {
+		// a record compares by value, which == does once it derives
+		// PartialEq, so it has no equals method
+		g.emit("#[derive(Debug, Clone, PartialEq)]")
+	}
+	g.emit(fmt.Sprintf("struct %s {", name))
+	g.depth++
+	for _, f := range fields {
+		g.emit(fmt.Sprintf("%s: %s,", f.name, g.typeName(f.kind, "field "+f.name, false)))
+	}
+	g.depth--
+	g.emit("}")
+	g.emit("")
+	g.emit(fmt.Sprintf("impl %s {", name))
+	g.depth++
+	first := true
+	separate := func() {
+		if !first {
+			g.emit("")
+		}
+		first = false
+	}
+	if ctor := g.method(name, "constructor"); ctor != nil || len(fields) > 0 {
+		separate()
+		g.constructor(name, ctor, fields)
+	}
+	for _, m := range childrenOf(cls, "body") {
+		if m.Kind != "MethodDefinition" || m.Label == "constructor" || g.records[name] && m.Label == "equals" {
+			continue
+		}
+		separate()
+		g.line = m.Line
+		fn := child(m, "value")
+		method, receiver := m.Label, "&self"
+		switch {
+		case strings.HasPrefix(method, "static "):
+			method, receiver = strings.TrimPrefix(method, "static "), ""
+		case strings.HasPrefix(method, "get "):
+			method = strings.TrimPrefix(method, "get ")
+		case strings.HasPrefix(method, "set "):
+			method = "set_" + strings.TrimPrefix(method, "set ")
+		}
+		if _, body, _ := function(fn); receiver != "" && mutatesThis(body) {
+			receiver = "&mut self"
+		}
+		savedThis := g.this
+		g.this = "self"
+		g.function(name+"."+method, fn, receiver)
+		g.this = savedThis
+	}
+	g.depth--
+	g.emit("}")
+}
+
+// constructor writes new. A constructor that only assigns fields from
+// values that don't read this builds Self directly; any other builds a
+// value with default fields and runs its body on that.
+func (g *rustGen) constructor(class string, ctor *node, fields []field) {
+	var params, body []*node
+	if ctor != nil {
+		g.line = ctor.Line
+		params, body, _ = function(ctor)
+	}
+	g.push()
+	defer g.pop()
+	var list []string
+	for i, p := range params {
+		pname, _ := param(p)
+		if pname == "" {
+			g.unsupported("A destructuring parameter")
+			pname = fmt.Sprintf("arg%d", i)
+		}
+		kind := g.paramKind(class, i, p, body, nil)
+		g.declare(pname, kind)
+		list = append(list, pname+": "+g.typeName(kind, "parameter "+pname, true))
+	}
+	g.emit(fmt.Sprintf("fn new(%s) -> Self {", strings.Join(list, ", ")))
+	g.depth++
+	defer func() {
+		g.depth--
+		g.emit("}")
+	}()
+
+	values := map[string]*node{}
+	direct := true
+	for _, s := range body {
+		name, value, ok := thisAssignment(s)
+		if !ok || readsThis(value) {
+			direct = false
+			break
+		}
+		values[name] = value
+	}
+	for _, f := range fields {
+		if f.value != nil && readsThis(f.value) {
+			direct = false
+		}
+	}
+
+	initializers := make([]string, 0, len(fields))
+	for _, f := range fields {
+		value := "Default::default()"
+		switch {
+		case direct && values[f.name] != nil:
+			value = g.owned(values[f.name], f.kind)
+		case f.value != nil:
+			value = g.owned(f.value, f.kind)
+		}
+		if value == f.name {
+			initializers = append(initializers, f.name)
+		} else {
+			initializers = append(initializers, f.name+": "+value)
+		}
+	}
+	if direct {
+		g.emit(fmt.Sprintf("Self { %s }", strings.Join(initializers, ", ")))
+		return
+	}
+	savedThis := g.this
+	g.this = "this"
+	defer func() { g.this = savedThis }()
+	g.emit(fmt.Sprintf("let mut this = Self { %s };", strings.Join(initializers, ", ")))
+	g.block(body)
+	g.emit("this")
+}
+
+// readsThis reports whether n uses this
+func readsThis(n *node) bool {
+	found := false
+	walk(n, func(n *node) bool {
+		found = found || n.Kind == "ThisExpression"
+		return !found
+	})
+	return found
+}
+
+// typeName is the Rust type of a kind; what names the value for the
+// warning when the kind isn't known. Parameters take strings as &str.
+func (g *rustGen) typeName(kind, what string, parameter bool) string {
+	switch {
+	case isNumber(kind):
+		return "f64"
+	case kind == kindString && parameter:
+		return "&str"
+	case kind == kindString:
+		return "String"
+	case kind == kindBool:
+		return "bool"
+	case isArray(kind):
+		elem := elemKind(kind)
+		if elem == "" {
+			g.warn("couldn't infer the element type of %s; assumed f64", what)
+			return "Vec<f64>"
+		}
+		if elem == kindString {
+			return "Vec<&str>"
+		}
+		return "Vec<" + g.typeName(elem, what, false) + ">"
+	case strings.HasPrefix(kind, kindClass):
+		return strings.TrimPrefix(kind, kindClass)
+	case kind == kindObject:
+		g.uses["std::collections::HashMap"] = true
+		return "HashMap<&str, f64>"
+	}
+	g.warn("couldn't infer the type of %s; assumed f64", what)
+	return "f64"
+}
+
+// letType is the type a let binding is annotated with: only values
+// whose type the initializer spells out are
+func (g *rustGen) letType(init *node, kind string) string {
+	switch init.Kind {
+	case "Literal", "TemplateLiteral", "ArrayExpression", "BinaryExpression":
+	default:
+		return ""
+	}
+	switch {
+	case isNumber(kind) && kind != kindIndex:
+		return "f64"
+	case kind == kindString && init.Kind == "Literal":
+		return "&str"
+	case kind == kindString:
+		return "String"
+	case kind == kindBool:
+		return "bool"
+	case isArray(kind) && elemKind(kind) != "":
+		return g.typeName(kind, "", false)
+	}
+	return ""
+}
+
+// owned writes n where a value of kind is owned: a String from a
+// string literal or a borrowed string
+func (g *rustGen) owned(n *node, kind string) string {
+	code := g.expr(n)
+	if kind == kindString && (n.Kind == "Literal" || n.Kind == "Identifier" || n.Kind == "MemberExpression") {
+		code += ".to_string()"
+	}
+	return code
+}
+
+func (g *rustGen) block(body []*node) {
+	for _, s := range body {
+		g.stmt(s)
+	}
+}
+
+// body writes a statement nested one level deeper, in its own scope
+func (g *rustGen) body(s *node) {
+	g.depth++
+	g.push()
+	if s != nil && s.Kind == "BlockStatement" {
+		g.block(s.Children)
+	} else if s != nil {
+		g.stmt(s)
+	}
+	g.pop()
+	g.depth--
+}
+
+// loopLabel returns the label a loop statement starts with
+func (g *rustGen) loopLabel() string {
+	label := g.label
+	g.label = ""
+	if label == "" {
+		return ""
+	}
+	return "'" + label + ": "
+}
+
+func (g *rustGen) stmt(s *node) {
+	if s.Line > 0 {
+		g.line = s.Line
+	}
+	switch s.Kind {
+	case "VariableDeclaration":
+		g.declaration(s)
+	case "FunctionDeclaration":
+		g.function(funcName(s), s, "")
+	case "ClassDeclaration":
+		g.classDeclaration(s)
+	case "ExpressionStatement":
+		x := child(s, "expression")
+		if array, item, body, ok := forEachLoop(x); ok {
+			g.emit(fmt.Sprintf("for %s in %s {", g.loopItem(item.Label, array), g.iterate(array)))
+			g.body(&node{Kind: "BlockStatement", Children: body})
+			g.emit("}")
+			return
+		}
+		if x.Kind == "UpdateExpression" {
+			op := "+="
+			if strings.HasPrefix(x.Label, "--") {
+				op = "-="
+			}
+			target := child(x, "argument")
+			one := "1.0"
+			if g.kindOf(target) == kindIndex {
+				one = "1"
+			}
+			g.emit(fmt.Sprintf("%s %s %s;", g.expr(target), op, one))
+			return
+		}
+		code := g.expr(x)
+		if x.Kind == "AssignmentExpression" && strings.HasPrefix(code, "if ") {
+			// a logical assignment is an if, which needs no semicolon
+			g.emit(code)
+			return
+		}
+		g.emit(code + ";")
+	case "IfStatement":
+		g.emit(fmt.Sprintf("if %s {", g.condition(child(s, "test"))))
+		g.body(child(s, "consequent"))
+		alt := child(s, "alternate")
+		for alt != nil && alt.Kind == "IfStatement" {
+			g.emit(fmt.Sprintf("} else if %s {", g.condition(child(alt, "test"))))
+			g.body(child(alt, "consequent"))
+			alt = child(alt, "alternate")
+		}
+		if alt != nil {
+			g.emit("} else {")
+			g.body(alt)
+		}
+		g.emit("}")
+	case "ForStatement":
+		g.forStatement(s)
+	case "ForOfStatement":
+		left, right := child(s, "left"), child(s, "right")
+		g.emit(fmt.Sprintf("%sfor %s in %s {", g.loopLabel(), g.loopItem(left.Label, right), g.iterate(right)))
+		g.body(child(s, "body"))
+		g.emit("}")
+	case "ForInStatement":
+		left, right := child(s, "left"), child(s, "right")
+		if !isArray(g.kindOf(right)) {
+			g.unsupported("for…in over an object's keys")
+		}
+		g.push()
+		g.declare(left.Label, kindIndex)
+		g.emit(fmt.Sprintf("%sfor %s in 0..%s.len() {", g.loopLabel(), left.Label, g.operand(right, 150)))
+		g.body(child(s, "body"))
+		g.emit("}")
+		g.pop()
+	case "WhileStatement":
+		g.emit(fmt.Sprintf("%swhile %s {", g.loopLabel(), g.condition(child(s, "test"))))
+		g.body(child(s, "body"))
+		g.emit("}")
+	case "DoWhileStatement":
+		g.emit(g.loopLabel() + "loop {")
+		g.body(child(s, "body"))
+		g.depth++
+		g.emit(fmt.Sprintf("if !(%s) {", g.condition(child(s, "test"))))
+		g.emit(g.indent + "break;")
+		g.emit("}")
+		g.depth--
+		g.emit("}")
+	case "BlockStatement":
+		g.emit("{")
+		g.body(s)
+		g.emit("}")
+	case "ReturnStatement":
+		if x := child(s, "argument"); x != nil {
+			g.emit(fmt.Sprintf("return %s;", g.owned(x, g.result)))
+		} else {
+			g.emit("return;")
+		}
+	case "BreakStatement", "ContinueStatement":
+		keyword := strings.ToLower(strings.TrimSuffix(s.Kind, "Statement"))
+		if s.Label != "" {
+			keyword += " '" + s.Label
+		}
+		g.emit(keyword + ";")
+	case "ThrowStatement":
+		g.warn("Rust has no exceptions; throw is a panic")
+		g.emit(fmt.Sprintf(`panic!("{}", %s);`, g.expr(errorMessage(child(s, "argument")))))
+	case "TryStatement":
+		g.warn("Rust has no exceptions; the try block runs as a plain block and the catch block is left out")
+		g.stmt(child(s, "block"))
+		if finalizer := child(s, "finalizer"); finalizer != nil {
+			g.stmt(finalizer)
+		}
+	case "SwitchStatement":
+		g.switchStatement(s)
+	case "LabeledStatement":
+		g.label = s.Label
+		g.stmt(child(s, "body"))
+		g.label = ""
+	case "EmptyStatement":
+	default:
+		g.unsupported(s.Kind)
+	}
+}
+
+// errorMessage is what a thrown value says: new Error(message) throws
+// message
+func errorMessage(x *node) *node {
+	if x.Kind == "NewExpression" {
+		if callee := child(x, "callee"); callee.Kind == "Identifier" && strings.HasSuffix(callee.Label, "Error") {
+			if args := childrenOf(x, "arguments"); len(args) > 0 {
+				return args[0]
+			}
+		}
+	}
+	return x
+}
+
+func (g *rustGen) declaration(s *node) {
+	keyword := "let mut "
+	if s.Label == "const" {
+		keyword = "let "
+	}
+	for _, d := range childrenOf(s, "declarations") {
+		id, init := child(d, "id"), child(d, "init")
+		if id.Kind != "Identifier" {
+			g.destructure(keyword, id, init)
+			continue
+		}
+		kind := g.kindOf(init)
+		if isNullish(init) || init == nil && g.defaulted[id.Label] {
+			// a variable that can be null is an Option, unwrapped where
+			// it's read
+			kind = g.optionKind(id.Label)
+			g.declare(id.Label, kindOption+kind)
+			g.emit(fmt.Sprintf("%s%s: Option<%s> = None;", keyword, id.Label, g.typeName(kind, id.Label, false)))
+			continue
+		}
+		if init == nil {
+			g.declare(id.Label, kind)
+			g.emit(keyword + id.Label + ";")
+			continue
+		}
+		value := g.expr(init)
+		g.declare(id.Label, kind)
+		if t := g.letType(init, kind); t != "" {
+			g.emit(fmt.Sprintf("%s%s: %s = %s;", keyword, id.Label, t, value))
+		} else {
+			g.emit(fmt.Sprintf("%s%s = %s;", keyword, id.Label, value))
+		}
+	}
+}
+
+// isNullish reports whether n is null or undefined
+func isNullish(n *node) bool {
+	return n != nil && (n.Kind == "Literal" && n.Label == "null" || isIdent(n, "undefined"))
+}
+
+// optionKind is the kind of the value an Option declared as name holds:
+// that of the first value the program assigns it whose kind is known
+func (g *rustGen) optionKind(name string) string {
+	for _, v := range g.assigned[name] {
+		if kind := g.kindOf(v); kind != "" {
+			return kind
+		}
+	}
+	return ""
+}
+
+// unwrap calls method on the value of the Option variable n, which is
+// cloned first unless it holds a number or a bool
+func (g *rustGen) unwrap(n *node, method string) string {
+	if kind := g.kindOf(n); isNumber(kind) || kind == kindBool {
+		return n.Label + "." + method
+	}
+	return n.Label + ".clone()." + method
+}
+
+// option reports whether n is a variable declared as an Option
+func (g *rustGen) option(n *node) bool {
+	return n.Kind == "Identifier" && strings.HasPrefix(g.lookup(n.Label), kindOption)
+}
+
+// destructure writes a destructuring declaration as a binding per name
+func (g *rustGen) destructure(keyword string, pattern, init *node) {
+	source := g.expr(init)
+	if init.Kind != "Identifier" {
+		g.emit(fmt.Sprintf("let destructured = %s;", source))
+		source = "destructured"
+	}
+	elem := elemKind(g.kindOf(init))
+	switch pattern.Kind {
+	case "ArrayPattern":
+		for i, e := range childrenOf(pattern, "elements") {
+			name, _ := param(e)
+			if e.Kind == "Elision" {
+				continue
+			}
+			g.declare(name, elem)
+			if e.Kind == "RestElement" {
+				g.emit(fmt.Sprintf("%s%s = %s[%d..].to_vec();", keyword, name, source, i))
+				continue
+			}
+			value := fmt.Sprintf("%s[%d]", source, i)
+			if !isNumber(elem) && elem != kindBool {
+				value += ".clone()"
+			}
+			g.emit(fmt.Sprintf("%s%s = %s;", keyword, name, value))
+		}
+	case "ObjectPattern":
+		for _, p := range childrenOf(pattern, "properties") {
+			name, _ := param(child(p, "value"))
+			if p.Kind == "RestElement" || name == "" {
+				g.unsupported("An object rest or nested pattern")
+				continue
+			}
+			g.declare(name, "")
+			value := fmt.Sprintf("%s[%s]", source, rustQuote(p.Label))
+			if strings.HasPrefix(g.kindOf(init), kindClass) {
+				value = source + "." + p.Label
+			}
+			g.emit(fmt.Sprintf("%s%s = %s.clone();", keyword, name, value))
+		}
+	}
+}
+
+// loopItem declares a for loop's item, an element of array
+func (g *rustGen) loopItem(name string, array *node) string {
+	g.declare(name, elemKind(g.kindOf(array)))
+	return name
+}
+
+// iterate is what a for loop over array iterates: copies of numbers,
+// booleans and string slices, references otherwise
+func (g *rustGen) iterate(array *node) string {
+	code := g.operand(array, 150)
+	switch kind := g.kindOf(array); {
+	case kind == kindString:
+		return code + ".chars()"
+	case isNumber(elemKind(kind)), elemKind(kind) == kindBool, elemKind(kind) == kindString:
+		return code + ".iter().copied()"
+	}
+	return "&" + code
+}
+
+func (g *rustGen) forStatement(s *node) {
+	label := g.loopLabel()
+	if c, ok := countingLoop(s); ok {
+		start, end := g.integer(c.start), g.integer(c.end)
+		var r string
+		switch {
+		case !c.down && c.inclusive:
+			r = start + "..=" + end
+		case !c.down:
+			r = start + ".." + end
+		case c.inclusive:
+			r = "(" + end + "..=" + start + ").rev()"
+		default:
+			if n, ok := integer(c.end); ok {
+				end = strconv.FormatInt(n+1, 10)
+			} else {
+				end += " + 1"
+			}
+			r = "(" + end + "..=" + start + ").rev()"
+		}
+		if c.step != nil {
+			if !c.down {
+				r = "(" + r + ")"
+			}
+			r += ".step_by(" + g.integer(c.step) + ")"
+		}
+		g.push()
+		g.declare(c.name, kindIndex)
+		g.emit(fmt.Sprintf("%sfor %s in %s {", label, c.name, r))
+		g.body(child(s, "body"))
+		g.emit("}")
+		g.pop()
+		return
+	}
+
+	// any other for loop is its init and a while loop
+	g.emit("{")
+	g.depth++
+	g.push()
+	if init := child(s, "init"); init != nil {
+		g.stmt(init)
+	}
+	test := "true"
+	if t := child(s, "test"); t != nil {
+		test = g.condition(t)
+	}
+	update := child(s, "update")
+	if update != nil && containsContinue(child(s, "body")) {
+		g.warn("continue skips the update of a for loop written as a while loop")
+	}
+	g.emit(fmt.Sprintf("%swhile %s {", label, test))
+	g.body(child(s, "body"))
+	if update != nil {
+		g.depth++
+		g.stmt(&node{Kind: "ExpressionStatement", Children: []*node{update}})
+		g.depth--
+	}
+	g.emit("}")
+	g.pop()
+	g.depth--
+	g.emit("}")
+}
+
+// containsContinue reports whether a loop body continues the loop
+// itself, rather than one nested in it
+func containsContinue(body *node) bool {
+	found := false
+	walk(body, func(n *node) bool {
+		switch n.Kind {
+		case "ForStatement", "ForOfStatement", "ForInStatement", "WhileStatement", "DoWhileStatement", "FunctionExpression", "ArrowFunctionExpression", "FunctionDeclaration":
+			return false
+		case "ContinueStatement":
+			found = true
+		}
+		return !found
+	})
+	return found
+}
+
+// switchStatement writes a switch as a match. Cases without a body
+// share the next case's arm; a case that falls into the next after
+// running its own body can't.
+func (g *rustGen) switchStatement(s *node) {
+	g.emit(fmt.Sprintf("match %s {", g.matched(child(s, "discriminant"))))
+	g.depth++
+	var patterns []string
+	hasDefault := false
+	cases := childrenOf(s, "cases")
+	for i, c := range cases {
+		test := child(c, "test")
+		if test == nil {
+			hasDefault = true
+			patterns = append(patterns, "_")
+		} else {
+			patterns = append(patterns, g.pattern(test))
+		}
+		body := childrenOf(c, "consequent")
+		if len(body) == 0 && i < len(cases)-1 {
+			continue
+		}
+		if !endsAbruptly(body) && i < len(cases)-1 {
+			g.warn("Rust match arms don't fall through into the next case")
+		}
+		arm := strings.Join(patterns, " | ")
+		for _, p := range patterns {
+			if p == "_" {
+				arm = "_"
+			}
+		}
+		patterns = nil
+		g.emit(arm + " => {")
+		g.body(&node{Kind: "BlockStatement", Children: caseBody(c)})
+		g.emit("}")
+	}
+	if !hasDefault {
+		g.emit("_ => {}")
+	}
+	g.depth--
+	g.emit("}")
+}
+
+// matched writes the value a switch matches
+func (g *rustGen) matched(disc *node) string {
+	if kind := g.kindOf(disc); isNumber(kind) && kind != kindIndex {
+		// numbers are f64, which patterns can't match, and case tests
+		// are mostly whole
+		return g.operand(disc, 140) + " as i64"
+	}
+	return g.expr(disc)
+}
+
+// matchExpression writes a switch expression (see switchExpression) as
+// a match whose arms are the cases' values
+func (g *rustGen) matchExpression(s *node) string {
+	inner := strings.Repeat(g.indent, g.depth+1)
+	b := &strings.Builder{}
+	fmt.Fprintf(b, "match %s {\n", g.matched(child(s, "discriminant")))
+	hasDefault := false
+	for _, c := range childrenOf(s, "cases") {
+		pattern := "_"
+		if test := child(c, "test"); test != nil {
+			pattern = g.pattern(test)
+		} else {
+			hasDefault = true
+		}
+		fmt.Fprintf(b, "%s%s => %s,\n", inner, pattern, g.expr(caseValue(c)))
+	}
+	if !hasDefault {
+		g.warn("A Rust match has to cover every value; the switch expression's missing default arm is written as the type's default value")
+		fmt.Fprintf(b, "%s_ => Default::default(),\n", inner)
+	}
+	return b.String() + strings.Repeat(g.indent, g.depth) + "}"
+}
+
+// pattern writes a case test as a match pattern; tests that aren't
+// literals become a guard
+func (g *rustGen) pattern(test *node) string {
+	if test.Kind == "Literal" {
+		if n, ok := integer(test); ok {
+			return strconv.FormatInt(n, 10)
+		}
+		if _, ok := numberValue(test); !ok {
+			return g.expr(test)
+		}
+	}
+	return "value if value == " + g.expr(test)
+}
+
+// condition writes a test, comparing numbers to zero and strings and
+// arrays to empty where JavaScript would convert them to a boolean
+func (g *rustGen) condition(test *node) string {
+	switch kind := g.kindOf(test); {
+	case kind == kindIndex:
+		return g.operand(test, 90) + " != 0"
+	case isNumber(kind):
+		return g.operand(test, 90) + " != 0.0"
+	case kind == kindString || isArray(kind):
+		return "!" + g.operand(test, 150) + ".is_empty()"
+	}
+	return g.expr(test)
+}
+
+// falsy writes the test that value is falsy, the negation of condition
+func (g *rustGen) falsy(value *node) string {
+	switch kind := g.kindOf(value); {
+	case kind == kindIndex:
+		return g.operand(value, 90) + " == 0"
+	case isNumber(kind):
+		return g.operand(value, 90) + " == 0.0"
+	case kind == kindString || isArray(kind):
+		return g.operand(value, 150) + ".is_empty()"
+	}
+	return "!" + g.operand(value, 140)
+}
+
+// integer writes n where Rust needs an integer: a range bound, index or
+// count
+func (g *rustGen) integer(n *node) string {
+	if v, ok := integer(n); ok {
+		return strconv.FormatInt(v, 10)
+	}
+	if g.kindOf(n) == kindIndex {
+		return g.expr(n)
+	}
+	return g.operand(n, 150) + " as usize"
+}
+
+// number writes a number literal as an f64
+func number(label string) string {
+	if strings.ContainsAny(label, ".eE") {
+		return label
+	}
+	return label + ".0"
+}
+
+// operand writes n, parenthesized when it binds less tightly than prec
+func (g *rustGen) operand(n *node, prec int) string {
+	code := g.expr(n)
+	p := precedence(n)
+	if _, _, ok := g.recordEquals(n); ok {
+		p = 80
+	}
+	if p < prec {
+		return "(" + code + ")"
+	}
+	return code
+}
+
+// numberOperand writes an operand of arithmetic with other, matching
+// its type: literals are written as integers next to an index, and an
+// index is cast next to anything else, which is an f64
+func (g *rustGen) numberOperand(n *node, prec int, other *node) string {
+	kind, otherKind := g.kindOf(n), g.kindOf(other)
+	_, literal := numberValue(other)
+	switch {
+	case n.Kind == "Literal" && otherKind == kindIndex:
+		if v, ok := integer(n); ok {
+			return strconv.FormatInt(v, 10)
+		}
+	case kind == kindIndex && otherKind != kindIndex && !literal:
+		// a cast has to be parenthesized before < reads as generics
+		if prec > 0 {
+			return "(" + g.expr(n) + " as f64)"
+		}
+		return g.expr(n) + " as f64"
+	}
+	return g.operand(n, prec)
+}
+
+func (g *rustGen) expr(n *node) string {
+	if n == nil {
+		return ""
+	}
+	switch n.Kind {
+	case "Literal":
+		if s, ok := stringValue(n); ok {
+			return rustQuote(s)
+		}
+		if n.Label == "null" {
+			g.warn("Rust has no null; it's written None, which needs an Option")
+			return "None"
+		}
+		if _, ok := numberValue(n); ok {
+			return number(n.Label)
+		}
+		return n.Label
+	case "Identifier":
+		switch n.Label {
+		case "undefined":
+			g.warn("Rust has no undefined; it's written None, which needs an Option")
+			return "None"
+		case "NaN":
+			return "f64::NAN"
+		case "Infinity":
+			return "f64::INFINITY"
+		}
+		if g.option(n) {
+			g.warn("%s can be null, so it's an Option, unwrapped where it's read, which panics while it's None", n.Label)
+			return g.unwrap(n, "unwrap()")
+		}
+		return n.Label
+	case "ThisExpression":
+		return g.this
+	case "TemplateLiteral":
+		return g.format("format!", templatePieces(n))
+	case "ArrayExpression":
+		elems := childrenOf(n, "elements")
+		list := make([]string, 0, len(elems))
+		for _, e := range elems {
+			if e.Kind == "SpreadElement" {
+				g.unsupported("Spreading into an array literal")
+			}
+			list = append(list, g.expr(e))
+		}
+		return "vec![" + strings.Join(list, ", ") + "]"
+	case "ObjectExpression":
+		g.warn("Rust has no object literals; they're written as a HashMap, whose values share one type")
+		g.uses["std::collections::HashMap"] = true
+		var entries []string
+		for _, p := range childrenOf(n, "properties") {
+			if p.Kind == "SpreadElement" || child(p, "key") != nil {
+				g.unsupported("A spread or computed key in an object literal")
+				continue
+			}
+			entries = append(entries, fmt.Sprintf("(%s, %s)", rustQuote(p.Label), g.expr(child(p, "value"))))
+		}
+		return "HashMap::from([" + strings.Join(entries, ", ") + "])"
+	case "ArrowFunctionExpression", "FunctionExpression":
+		return g.closure(n)
+	case "UnaryExpression":
+		arg := child(n, "argument")
+		switch n.Label {
+		case "!":
+			if kind := g.kindOf(arg); kind != kindBool && kind != "" {
+				return "!(" + g.condition(arg) + ")"
+			}
+			return "!" + g.operand(arg, 140)
+		case "-":
+			return "-" + g.operand(arg, 140)
+		case "+":
+			return g.operand(arg, 140)
+		}
+		g.unsupported("The " + n.Label + " operator")
+		return g.operand(arg, 140)
+	case "UpdateExpression":
+		target := g.expr(child(n, "argument"))
+		op := "+="
+		if strings.HasPrefix(n.Label, "--") {
+			op = "-="
+		}
+		one := "1.0"
+		if g.kindOf(child(n, "argument")) == kindIndex {
+			one = "1"
+		}
+		if strings.HasSuffix(n.Label, "(prefix)") {
+			return fmt.Sprintf("{ %s %s %s; %s }", target, op, one, target)
+		}
+		return fmt.Sprintf("{ let old = %s; %s %s %s; old }", target, target, op, one)
+	case "BinaryExpression":
+		return g.binary(n)
+	case "LogicalExpression":
+		l, r := child(n, "left"), child(n, "right")
+		if n.Label == "??" && g.option(l) {
+			return g.unwrap(l, "unwrap_or("+g.owned(r, g.kindOf(l))+")")
+		}
+		if n.Label == "??" {
+			g.warn("Rust has no ??; it's written unwrap_or, which needs an Option")
+			return fmt.Sprintf("%s.unwrap_or(%s)", g.operand(l, 150), g.expr(r))
+		}
+		prec := precedence(n)
+		return fmt.Sprintf("%s %s %s", g.operand(l, prec), n.Label, g.operand(r, prec+1))
+	case "ConditionalExpression":
+		return fmt.Sprintf("if %s { %s } else { %s }", g.condition(child(n, "test")), g.expr(child(n, "consequent")), g.expr(child(n, "alternate")))
+	case "AssignmentExpression":
+		return g.assignment(n)
+	case "CallExpression":
+		if s, ok := switchExpression(n); ok {
+			return g.matchExpression(s)
+		}
+		if a, b, ok := g.recordEquals(n); ok {
+			return g.operand(a, 81) + " == " + g.operand(b, 81)
+		}
+		return g.call(n)
+	case "NewExpression":
+		return g.newExpr(n)
+	case "MemberExpression":
+		return g.memberExpr(n)
+	case "AwaitExpression":
+		g.warn("Rust has no await outside an async runtime; the awaited value is used directly")
+		return g.expr(child(n, "argument"))
+	case "SpreadElement":
+		g.unsupported("Spreading arguments")
+		return g.expr(child(n, "argument"))
+	case "SequenceExpression":
+		g.unsupported("The comma operator")
+		list := childrenOf(n, "expressions")
+		return g.expr(list[len(list)-1])
+	}
+	g.unsupported("A " + n.Kind)
+	return "todo!()"
+}
+
+func (g *rustGen) binary(n *node) string {
+	l, r := child(n, "left"), child(n, "right")
+	lk, rk := g.kindOf(l), g.kindOf(r)
+	if n.Label == "+" && (lk == kindString || rk == kindString) {
+		return g.format("format!", g.concatenation(n))
+	}
+	if n.Label == "==" || n.Label == "===" || n.Label == "!=" || n.Label == "!==" {
+		// an Option is compared with null by whether it holds a value
+		option, other := l, r
+		if g.option(r) {
+			option, other = r, l
+		}
+		if g.option(option) && isNullish(other) {
+			if strings.HasPrefix(n.Label, "!") {
+				return option.Label + ".is_some()"
+			}
+			return option.Label + ".is_none()"
+		}
+	}
+	prec := precedence(n)
+	left, right := g.numberOperand(l, prec, r), g.numberOperand(r, prec+1, l)
+	switch n.Label {
+	case "===":
+		return left + " == " + right
+	case "!==":
+		return left + " != " + right
+	case "**":
+		return fmt.Sprintf("f64::powf(%s, %s)", g.numberOperand(l, 0, r), g.numberOperand(r, 0, l))
+	case "instanceof", "in", ">>>":
+		g.unsupported("The " + n.Label + " operator")
+	}
+	return left + " " + n.Label + " " + right
+}
+
+// concatenation flattens a chain of string + into its pieces
+func (g *rustGen) concatenation(n *node) []*node {
+	if n.Kind == "BinaryExpression" && n.Label == "+" && g.kindOf(n) == kindString {
+		return append(g.concatenation(child(n, "left")), g.concatenation(child(n, "right"))...)
+	}
+	if n.Kind == "TemplateLiteral" {
+		return templatePieces(n)
+	}
+	return []*node{n}
+}
+
+// templatePieces returns a template literal's text, as string literals,
+// and expressions in order
+func templatePieces(n *node) []*node {
+	parts, exprs := templateParts(n), childrenOf(n, "expressions")
+	var pieces []*node
+	for i, part := range parts {
+		if part != "" {
+			pieces = append(pieces, &node{Kind: "Literal", Label: `"` + strings.NewReplacer(`\`, `\\`, `"`, `\"`).Replace(part) + `"`})
+		}
+		if i < len(exprs) {
+			pieces = append(pieces, exprs[i])
+		}
+	}
+	return pieces
+}
+
+// format writes a call of a formatting macro that puts pieces together:
+// string literals go into the format string and everything else is an
+// argument
+func (g *rustGen) format(macro string, pieces []*node) string {
+	var text strings.Builder
+	var args []string
+	var flat []*node
+	for _, piece := range pieces {
+		flat = append(flat, g.concatenation(piece)...)
+	}
+	for _, piece := range flat {
+		if s, ok := stringValue(piece); ok {
+			text.WriteString(strings.NewReplacer("{", "{{", "}", "}}").Replace(s))
+			continue
+		}
+		if kind := g.kindOf(piece); isArray(kind) || kind == kindObject {
+			text.WriteString("{:?}")
+		} else {
+			text.WriteString("{}")
+		}
+		args = append(args, g.expr(piece))
+	}
+	if len(args) == 0 && macro == "format!" {
+		return rustQuote(text.String()) + ".to_string()"
+	}
+	return macro + "(" + strings.Join(append([]string{rustQuote(text.String())}, args...), ", ") + ")"
+}
+
+func (g *rustGen) assignment(n *node) string {
+	l, r := child(n, "left"), child(n, "right")
+	if object, prop, ok := member(l); ok && n.Label == "=" && g.accessor(object, prop, "set") {
+		return fmt.Sprintf("%s.set_%s(%s)", g.operand(object, 150), prop, g.expr(r))
+	}
+	if g.option(l) {
+		// an Option is assigned Some value, or None
+		value := "Some(" + g.owned(r, g.kindOf(l)) + ")"
+		if isNullish(r) {
+			value = "None"
+		}
+		switch n.Label {
+		case "=":
+			return l.Label + " = " + value
+		case "??=":
+			return fmt.Sprintf("if %s.is_none() { %s = %s; }", l.Label, l.Label, value)
+		}
+	}
+	target, lk := g.expr(l), g.kindOf(l)
+	switch n.Label {
+	case "=":
+		return target + " = " + g.owned(r, fieldKindOf(g, l))
+	case "+=":
+		if lk == kindString || g.kindOf(r) == kindString {
+			return target + " = " + g.format("format!", append([]*node{l}, g.concatenation(r)...))
+		}
+	case "**=":
+		return fmt.Sprintf("%s = f64::powf(%s, %s)", target, target, g.numberOperand(r, 0, l))
+	case "??=":
+		g.warn("Rust has no ??=; it's written as an is_none check, which needs an Option")
+		return fmt.Sprintf("if %s.is_none() { %s = Some(%s); }", target, target, g.expr(r))
+	case "||=":
+		return fmt.Sprintf("if %s { %s = %s; }", g.falsy(l), target, g.owned(r, fieldKindOf(g, l)))
+	case "&&=":
+		return fmt.Sprintf("if %s { %s = %s; }", g.condition(l), target, g.owned(r, fieldKindOf(g, l)))
+	case ">>>=":
+		g.fail(">>>= shifts the number as an unsigned 32-bit integer, which Rust's f64 can't")
+		return target
+	}
+	return target + " " + n.Label + " " + g.numberOperand(r, 0, l)
+}
+
+// fieldKindOf is the kind a field assignment stores, so strings stored
+// in fields are owned
+func fieldKindOf(g *rustGen, target *node) string {
+	if object, _, ok := member(target); ok && object.Kind == "ThisExpression" {
+		return g.kindOf(target)
+	}
+	return ""
+}
+
+// closure writes a function expression as a closure
+func (g *rustGen) closure(fn *node) string {
+	if isAsync(fn) {
+		g.warn("Rust closures can't be async without an async runtime; the closure is a plain one")
+	}
+	params, body, expr := function(fn)
+	g.push()
+	defer g.pop()
+	names := make([]string, 0, len(params))
+	for i, p := range params {
+		name, _ := param(p)
+		if name == "" {
+			g.unsupported("A destructuring parameter")
+			name = fmt.Sprintf("arg%d", i)
+		}
+		g.declare(name, "")
+		names = append(names, name)
+	}
+	head := "|" + strings.Join(names, ", ") + "| "
+	if expr != nil {
+		return head + g.expr(expr)
+	}
+	saved := g.result
+	g.result = ""
+	inner := g.capture(func() {
+		g.depth++
+		g.block(body)
+		g.depth--
+	})
+	g.result = saved
+	return head + "{\n" + inner + strings.Repeat(g.indent, g.depth) + "}"
+}
+
+func (g *rustGen) memberExpr(n *node) string {
+	object, prop, ok := member(n)
+	if strings.HasPrefix(n.Label, "?") {
+		g.warn("Rust has no optional chaining; ?. is written as plain access")
+	}
+	if !ok {
+		object = child(n, "object")
+		index := child(n, "property")
+		if _, isString := stringValue(index); isString {
+			return fmt.Sprintf("%s[%s]", g.operand(object, 150), g.expr(index))
+		}
+		return fmt.Sprintf("%s[%s]", g.operand(object, 150), g.integer(index))
+	}
+	if object.Kind == "Identifier" && object.Label == "Math" {
+		switch prop {
+		case "PI", "E", "LN2", "LN10", "SQRT2":
+			return "std::f64::consts::" + prop
+		}
+	}
+	if prop == "length" {
+		return g.operand(object, 150) + ".len()"
+	}
+	if object.Kind == "Identifier" && (g.classes[object.Label] != nil || transpiler.IsStdlib(object.Label)) {
+		return object.Label + "::" + prop
+	}
+	if g.accessor(object, prop, "get") {
+		return g.operand(object, 150) + "." + prop + "()"
+	}
+	return g.operand(object, 150) + "." + prop
+}
+
+// mathFunctions are the Math functions f64 has a method for
+var mathFunctions = map[string]string{
+	"floor": "floor", "ceil": "ceil", "round": "round", "trunc": "trunc", "abs": "abs",
+	"sqrt": "sqrt", "cbrt": "cbrt", "sin": "sin", "cos": "cos", "tan": "tan",
+	"log": "ln", "log2": "log2", "log10": "log10", "exp": "exp", "sign": "signum",
+	"min": "min", "max": "max", "pow": "powf", "atan2": "atan2", "hypot": "hypot",
+}
+
+// rustMethods are the JavaScript string and array methods whose Rust
+// equivalent differs only in name
+var rustMethods = map[string]string{
+	"toUpperCase": "to_uppercase", "toLowerCase": "to_lowercase", "trim": "trim",
+	"startsWith": "starts_with", "endsWith": "ends_with", "push": "push", "pop": "pop",
+	"join": "join", "toString": "to_string", "reverse": "reverse", "sort": "sort",
+}
+
+// iteratorMethods are the array methods Rust has on iterators, with
+// how their result is collected
+var iteratorMethods = map[string]string{
+	"map": "map(%s).collect::<Vec<_>>()", "filter": "filter(%s).collect::<Vec<_>>()",
+	"forEach": "for_each(%s)", "some": "any(%s)", "every": "all(%s)", "find": "find(%s)",
+}
+
+func (g *rustGen) call(n *node) string {
+	callee, args := child(n, "callee"), childrenOf(n, "arguments")
+	if n.Label == "?." {
+		g.warn("Rust has no optional chaining; ?.() is written as a plain call")
+	}
+	list := func(args []*node) string {
+		written := make([]string, 0, len(args))
+		for _, arg := range args {
+			written = append(written, g.expr(arg))
+		}
+		return strings.Join(written, ", ")
+	}
+
+	if callee.Kind == "Identifier" {
+		switch callee.Label {
+		case "String":
+			if len(args) == 1 {
+				return g.operand(args[0], 150) + ".to_string()"
+			}
+		case "Number", "parseFloat", "parseInt":
+			if len(args) == 1 {
+				if g.kindOf(args[0]) == kindString {
+					return g.operand(args[0], 150) + ".parse::<f64>().unwrap()"
+				}
+				return g.numberOperand(args[0], 150, nil)
+			}
+		case "EmojiFetch":
+			g.warn("Rust's standard library has no HTTP client; 🌐 needs the ureq crate, and makes GET requests only")
+			if len(args) > 0 {
+				return "EmojiFetch(" + g.expr(args[0]) + ")"
+			}
+		}
+		if g.funcs[callee.Label] != nil {
+			return callee.Label + "(" + g.arguments(callee.Label, args) + ")"
+		}
+		return callee.Label + "(" + list(args) + ")"
+	}
+
+	object, prop, ok := member(callee)
+	if !ok {
+		return g.operand(callee, 150) + "(" + list(args) + ")"
+	}
+	if object.Kind == "Identifier" {
+		switch object.Label {
+		case "console":
+			switch prop {
+			case "log", "info", "debug":
+				return g.format("println!", spaced(args))
+			case "error", "warn":
+				return g.format("eprintln!", spaced(args))
+			}
+		case "JSON":
+			if len(args) > 0 && (prop == "stringify" || prop == "parse") {
+				g.warn("Rust's standard library has no JSON; JSON.%s needs the serde_json crate", prop)
+			}
+			switch {
+			case prop == "stringify" && len(args) > 2:
+				return fmt.Sprintf("serde_json::to_string_pretty(&%s).unwrap()", g.expr(args[0]))
+			case prop == "stringify" && len(args) > 0:
+				return fmt.Sprintf("serde_json::to_string(&%s).unwrap()", g.expr(args[0]))
+			case prop == "parse" && len(args) > 0:
+				text := g.expr(args[0])
+				if args[0].Kind != "Literal" {
+					text = "&" + g.operand(args[0], 140)
+				}
+				return fmt.Sprintf("serde_json::from_str::<serde_json::Value>(%s).unwrap()", text)
+			}
+		case "Math":
+			if prop == "random" {
+				g.warn("Rust's standard library has no random numbers; Math.random needs the rand crate")
+				return "rand::random::<f64>()"
+			}
+			if method, found := mathFunctions[prop]; found && len(args) > 0 {
+				written := make([]string, 0, len(args))
+				for _, arg := range args {
+					written = append(written, g.numberOperand(arg, 0, nil))
+				}
+				// Math.min and Math.max take any number of arguments
+				code := fmt.Sprintf("f64::%s(%s)", method, strings.Join(written[:min(2, len(written))], ", "))
+				for _, arg := range written[min(2, len(written)):] {
+					code = fmt.Sprintf("f64::%s(%s, %s)", method, code, arg)
+				}
+				return code
+			}
+		}
+		if g.classes[object.Label] != nil || transpiler.IsStdlib(object.Label) {
+			return object.Label + "::" + prop + "(" + g.arguments(object.Label+"."+prop, args) + ")"
+		}
+	}
+
+	receiver := g.operand(object, 150)
+	if format, found := iteratorMethods[prop]; found && len(args) == 1 {
+		iter := ".iter().copied()"
+		if elem := elemKind(g.kindOf(object)); !isNumber(elem) && elem != kindString && elem != kindBool {
+			iter = ".iter()"
+		}
+		return receiver + iter + "." + fmt.Sprintf(format, g.expr(args[0]))
+	}
+	switch prop {
+	case "includes":
+		if len(args) == 1 {
+			if _, isString := stringValue(args[0]); isString && g.kindOf(object) == kindString {
+				return receiver + ".contains(" + g.expr(args[0]) + ")"
+			}
+			return receiver + ".contains(&" + g.operand(args[0], 150) + ")"
+		}
+	case "reduce":
+		if len(args) == 2 {
+			return fmt.Sprintf("%s.iter().copied().fold(%s, %s)", receiver, g.expr(args[1]), g.expr(args[0]))
+		}
+	case "toFixed":
+		digits := "0"
+		if len(args) == 1 {
+			digits = g.integer(args[0])
+		}
+		return fmt.Sprintf(`format!("{:.1$}", %s, %s)`, receiver, digits)
+	case "indexOf":
+		if len(args) == 1 {
+			return fmt.Sprintf("%s.iter().position(|item| *item == %s)", receiver, g.expr(args[0]))
+		}
+	}
+	if method, found := rustMethods[prop]; found {
+		return receiver + "." + method + "(" + list(args) + ")"
+	}
+	if class := strings.TrimPrefix(g.kindOf(object), kindClass); class != g.kindOf(object) {
+		return receiver + "." + prop + "(" + g.arguments(class+"."+prop, args) + ")"
+	}
+	if object.Kind == "ThisExpression" && g.class != "" {
+		return receiver + "." + prop + "(" + g.arguments(g.class+"."+prop, args) + ")"
+	}
+	return receiver + "." + prop + "(" + list(args) + ")"
+}
+
+// spaced puts the spaces console.log writes between its arguments
+func spaced(args []*node) []*node {
+	var pieces []*node
+	for i, arg := range args {
+		if i > 0 {
+			pieces = append(pieces, &node{Kind: "Literal", Label: `" "`})
+		}
+		pieces = append(pieces, arg)
+	}
+	return pieces
+}
+
+// arguments writes the arguments of a call of a function the program
+// defines, converted to its parameter types: indexes to f64, strings
+// borrowed and arrays cloned
+func (g *rustGen) arguments(key string, args []*node) string {
+	written := make([]string, 0, len(args))
+	for _, arg := range args {
+		kind := g.kindOf(arg)
+		code := g.expr(arg)
+		switch {
+		case kind == kindIndex:
+			code += " as f64"
+		case kind == kindString && arg.Kind != "Literal":
+			code = "&" + g.operand(arg, 140)
+		case isArray(kind) && arg.Kind == "Identifier":
+			code += ".clone()"
+		}
+		written = append(written, code)
+	}
+	return strings.Join(written, ", ")
+}
+
+func (g *rustGen) newExpr(n *node) string {
+	callee, args := child(n, "callee"), childrenOf(n, "arguments")
+	if callee.Kind != "Identifier" {
+		g.unsupported("new with a computed class")
+		return g.expr(callee)
+	}
+	switch name := callee.Label; {
+	case name == "Map":
+		g.uses["std::collections::HashMap"] = true
+		return "HashMap::new()"
+	case name == "Set":
+		g.uses["std::collections::HashSet"] = true
+		return "HashSet::new()"
+	case name == "Array":
+		return "Vec::new()"
+	case strings.HasSuffix(name, "Error") && len(args) > 0:
+		return g.expr(args[0])
+	case name == "Date":
+		g.warn("Rust's standard library has no dates; new Date() is written as SystemTime::now()")
+		return "std::time::SystemTime::now()"
+	}
+	return callee.Label + "::new(" + g.arguments(callee.Label, args) + ")"
+}
@@ -0,0 +1,236 @@
+// Package collab relays messages between the peers of a room, so two or
+// more people can edit the same snippet live. The server only passes
+// messages along: the clients keep the document, with whatever OT or CRDT
+// library they share, and the relay never reads what they send. It does
+// look after rooms, which open with their first peer and close with their
+// last, and the limits on them.
+package collab
+
+import (
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+
+	"emojiscript-backend/pkg/websocket"
+)
+
+const (
+	DefaultIdleTimeout = 10 * time.Minute
+	DefaultMaxRooms    = 128
+	DefaultMaxPeers    = 8
+	// DefaultMaxMessageSize bounds a relayed message, in bytes
+	DefaultMaxMessageSize = 64 << 10
+	// DefaultMessagesPerSecond bounds how fast a peer may send
+	DefaultMessagesPerSecond = 30
+)
+
+// outboxSize is how many messages may wait for a slow peer before it is
+// dropped
+const outboxSize = 256
+
+var roomPattern = regexp.MustCompile(`^[A-Za-z0-9_-]{1,64}$`)
+
+// ValidRoom reports whether name is an acceptable room name
+func ValidRoom(name string) bool {
+	return roomPattern.MatchString(name)
+}
+
+// Options configures New; zero values fall back to the defaults
+type Options struct {
+	// IdleTimeout disconnects a peer that has sent nothing for this long
+	IdleTimeout       time.Duration
+	MaxRooms          int
+	MaxPeers          int
+	MaxMessageSize    int
+	MessagesPerSecond int
+}
+
+// Event is a message from the relay:
+//
+//   - "welcome" greets a peer with its id and the peers already there
+//   - "join" and "leave" announce another peer arriving and going
+//   - "message" carries Data, exactly as the peer From sent it
+//   - "error" reports a limit; the connection is closed after it unless
+//     the error is about one message
+type Event struct {
+	Type  string   `json:"type"`
+	Peer  string   `json:"peer,omitempty"`
+	Peers []string `json:"peers,omitempty"`
+	From  string   `json:"from,omitempty"`
+	Data  string   `json:"data,omitempty"`
+	Error string   `json:"error,omitempty"`
+}
+
+// Relay runs rooms. It is safe for concurrent use.
+type Relay struct {
+	opts  Options
+	mu    sync.Mutex
+	rooms map[string]*room
+}
+
+type room struct {
+	peers []*peer
+	next  int
+}
+
+type peer struct {
+	id     string
+	conn   *websocket.Conn
+	outbox chan string
+	// done is closed once the peer has left, stopping its writer
+	done chan struct{}
+}
+
+// New creates a Relay
+func New(opts Options) *Relay {
+	if opts.IdleTimeout <= 0 {
+		opts.IdleTimeout = DefaultIdleTimeout
+	}
+	if opts.MaxRooms <= 0 {
+		opts.MaxRooms = DefaultMaxRooms
+	}
+	if opts.MaxPeers <= 0 {
+		opts.MaxPeers = DefaultMaxPeers
+	}
+	if opts.MaxMessageSize <= 0 {
+		opts.MaxMessageSize = DefaultMaxMessageSize
+	}
+	if opts.MessagesPerSecond <= 0 {
+		opts.MessagesPerSecond = DefaultMessagesPerSecond
+	}
+	return &Relay{opts: opts, rooms: map[string]*room{}}
+}
+
+// ServeConn joins conn to the room called name and relays its messages
+// until the peer leaves or goes idle, and then closes conn
+func (r *Relay) ServeConn(name string, conn *websocket.Conn) {
+	defer conn.Close()
+	p, err := r.join(name, conn)
+	if err != nil {
+		writeJSON(conn, Event{Type: "error", Error: err.Error()})
+		return
+	}
+	go p.write()
+	defer r.leave(name, p)
+
+	window, sent := time.Now(), 0
+	for {
+		conn.SetReadDeadline(time.Now().Add(r.opts.IdleTimeout))
+		message, err := conn.ReadMessage()
+		if err != nil {
+			return
+		}
+		if now := time.Now(); now.Sub(window) >= time.Second {
+			window, sent = now, 0
+		}
+		sent++
+		switch {
+		case sent > r.opts.MessagesPerSecond:
+			p.send(Event{Type: "error", Error: "too many messages; slow down"})
+		case len(message) > r.opts.MaxMessageSize:
+			p.send(Event{Type: "error", Error: fmt.Sprintf("message exceeds %d bytes", r.opts.MaxMessageSize)})
+		default:
+			r.broadcast(name, p, Event{Type: "message", From: p.id, Data: message})
+		}
+	}
+}
+
+// join adds a peer to the room, opening it if it isn't, and welcomes it
+// before anything else can be queued for it
+func (r *Relay) join(name string, conn *websocket.Conn) (*peer, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	rm, ok := r.rooms[name]
+	if !ok {
+		if len(r.rooms) >= r.opts.MaxRooms {
+			return nil, fmt.Errorf("too many rooms open; try again later")
+		}
+		rm = &room{}
+		r.rooms[name] = rm
+	}
+	if len(rm.peers) >= r.opts.MaxPeers {
+		return nil, fmt.Errorf("room is full (%d peers)", r.opts.MaxPeers)
+	}
+	rm.next++
+	p := &peer{id: fmt.Sprintf("peer-%d", rm.next), conn: conn, outbox: make(chan string, outboxSize), done: make(chan struct{})}
+	others := []string{}
+	for _, other := range rm.peers {
+		others = append(others, other.id)
+		other.send(Event{Type: "join", Peer: p.id})
+	}
+	p.send(Event{Type: "welcome", Peer: p.id, Peers: others})
+	rm.peers = append(rm.peers, p)
+	return p, nil
+}
+
+// leave removes a peer, closing the room once it is empty
+func (r *Relay) leave(name string, p *peer) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	close(p.done)
+	rm := r.rooms[name]
+	for i, other := range rm.peers {
+		if other == p {
+			rm.peers = append(rm.peers[:i], rm.peers[i+1:]...)
+			break
+		}
+	}
+	if len(rm.peers) == 0 {
+		delete(r.rooms, name)
+		return
+	}
+	for _, other := range rm.peers {
+		other.send(Event{Type: "leave", Peer: p.id})
+	}
+}
+
+// broadcast sends an event to every peer in the room but from
+func (r *Relay) broadcast(name string, from *peer, event Event) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for _, other := range r.rooms[name].peers {
+		if other != from {
+			other.send(event)
+		}
+	}
+}
+
+// send queues an event for the peer, disconnecting a peer too slow to
+// keep up rather than holding up the room
+func (p *peer) send(event Event) {
+	select {
+	case p.outbox <- encode(event):
+	default:
+		p.conn.Close()
+	}
+}
+
+// write sends the peer's queued events until it leaves
+func (p *peer) write() {
+	for {
+		select {
+		case message := <-p.outbox:
+			if p.conn.WriteText(message) != nil {
+				p.conn.Close()
+				return
+			}
+		case <-p.done:
+			return
+		}
+	}
+}
+
+func encode(v interface{}) string {
+	b := &strings.Builder{}
+	enc := json.NewEncoder(b)
+	enc.SetEscapeHTML(false)
+	enc.Encode(v)
+	return b.String()
+}
+
+func writeJSON(conn *websocket.Conn, v interface{}) {
+	conn.WriteText(encode(v))
+}
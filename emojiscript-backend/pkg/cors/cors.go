@@ -0,0 +1,237 @@
+// Package cors implements the cross-origin policy shared by the Fiber
+// server and the net/http handler.
+package cors
+
+import (
+	"net/http"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// DefaultOrigins are trusted when no origins are configured
+var DefaultOrigins = []string{"http://localhost:3000", "http://localhost:3001", "https://emoji-script.vercel.app"}
+
+// DefaultHeaders are the request headers browsers may send
+var DefaultHeaders = []string{"Origin", "Content-Type", "Accept", "X-Session-ID", "Authorization", "X-Service-Token", "X-API-Key", "Idempotency-Key", "X-Request-ID", "Cache-Control", "X-Bypass-Cache"}
+
+// DefaultExposedHeaders are the response headers browsers let pages read
+// beyond the always-readable ones
+var DefaultExposedHeaders = []string{"X-Request-ID", "X-Quota-Limit", "X-Quota-Remaining", "X-Chaos-Injected"}
+
+// Policy decides which origins may call the API and which methods each
+// route accepts.
+//
+// Origin patterns may be exact ("https://app.example.com"), wildcard
+// subdomains ("https://*.example.com" or "*.example.com" for any scheme),
+// a regular expression wrapped in slashes ("/^https://pr-\d+\.example\.dev$/"),
+// or "*" for any origin. A "*" match never carries credentials: browsers
+// reject credentialed responses with a wildcard origin, so only explicitly
+// listed origins are echoed back with Access-Control-Allow-Credentials.
+type Policy struct {
+	AllowCredentials bool
+	AllowHeaders     []string
+	ExposeHeaders    []string
+	MaxAge           time.Duration
+
+	any      bool
+	exact    map[string]bool
+	patterns []*regexp.Regexp
+	routes   []route
+}
+
+type route struct {
+	pattern *regexp.Regexp
+	methods map[string]bool
+}
+
+// New builds a policy from origin patterns; nil or empty falls back to
+// DefaultOrigins. Invalid regular expressions are ignored.
+func New(origins []string, allowCredentials bool) *Policy {
+	if len(origins) == 0 {
+		origins = DefaultOrigins
+	}
+	p := &Policy{
+		AllowCredentials: allowCredentials,
+		AllowHeaders:     DefaultHeaders,
+		ExposeHeaders:    DefaultExposedHeaders,
+		MaxAge:           time.Hour,
+		exact:            map[string]bool{},
+	}
+	for _, origin := range origins {
+		origin = strings.TrimSpace(origin)
+		switch {
+		case origin == "":
+		case origin == "*":
+			p.any = true
+		case len(origin) > 2 && strings.HasPrefix(origin, "/") && strings.HasSuffix(origin, "/"):
+			if re, err := regexp.Compile(origin[1 : len(origin)-1]); err == nil {
+				p.patterns = append(p.patterns, re)
+			}
+		case strings.Contains(origin, "*"):
+			p.patterns = append(p.patterns, wildcardPattern(origin))
+		default:
+			p.exact[strings.ToLower(strings.TrimSuffix(origin, "/"))] = true
+		}
+	}
+	return p
+}
+
+// ParseOrigins splits a comma-separated origin list such as the
+// ALLOWED_ORIGINS environment variable
+func ParseOrigins(list string) []string {
+	origins := []string{}
+	for _, origin := range strings.Split(list, ",") {
+		if origin = strings.TrimSpace(origin); origin != "" {
+			origins = append(origins, origin)
+		}
+	}
+	return origins
+}
+
+// wildcardPattern turns "https://*.example.com" into a regexp where "*"
+// matches one or more subdomain labels; a pattern without a scheme accepts
+// http and https
+func wildcardPattern(origin string) *regexp.Regexp {
+	scheme := `https?://`
+	if i := strings.Index(origin, "://"); i >= 0 {
+		scheme = regexp.QuoteMeta(origin[:i+3])
+		origin = origin[i+3:]
+	}
+	host := strings.ReplaceAll(regexp.QuoteMeta(strings.ToLower(origin)), `\*`, `[a-z0-9-]+(?:\.[a-z0-9-]+)*`)
+	return regexp.MustCompile(`^` + scheme + host + `(?::\d+)?$`)
+}
+
+// AllowRoute registers the methods a route accepts. Path parameters may be
+// written as ":id" or "{id}". OPTIONS is always allowed.
+func (p *Policy) AllowRoute(path string, methods ...string) {
+	segments := strings.Split(strings.Trim(path, "/"), "/")
+	for i, segment := range segments {
+		if strings.HasPrefix(segment, ":") || (strings.HasPrefix(segment, "{") && strings.HasSuffix(segment, "}")) {
+			segments[i] = `[^/]+`
+		} else {
+			segments[i] = regexp.QuoteMeta(segment)
+		}
+	}
+	pattern := regexp.MustCompile(`^/` + strings.Join(segments, "/") + `/?$`)
+
+	for i := range p.routes {
+		if p.routes[i].pattern.String() == pattern.String() {
+			for _, method := range methods {
+				p.routes[i].methods[strings.ToUpper(method)] = true
+			}
+			return
+		}
+	}
+	set := map[string]bool{http.MethodOptions: true}
+	for _, method := range methods {
+		set[strings.ToUpper(method)] = true
+	}
+	p.routes = append(p.routes, route{pattern: pattern, methods: set})
+}
+
+// Methods lists the methods registered for a path, or nil when the route
+// is unknown
+func (p *Policy) Methods(path string) []string {
+	set := map[string]bool{}
+	for _, r := range p.routes {
+		if r.pattern.MatchString(path) {
+			for method := range r.methods {
+				set[method] = true
+			}
+		}
+	}
+	if len(set) == 0 {
+		return nil
+	}
+	methods := make([]string, 0, len(set))
+	for method := range set {
+		methods = append(methods, method)
+	}
+	sort.Strings(methods)
+	return methods
+}
+
+// Allowed reports whether origin matches the policy and whether the
+// response may carry credentials
+func (p *Policy) Allowed(origin string) (allowed, credentials bool) {
+	if origin == "" {
+		return false, false
+	}
+	if p.listed(origin) {
+		return true, p.AllowCredentials
+	}
+	return p.any, false
+}
+
+// Apply writes the CORS response headers for a request and reports whether
+// it was a preflight, which the caller should answer with 204 and no body.
+// Preflights for a method the route doesn't accept get no allow headers,
+// so the browser blocks the actual request.
+func (p *Policy) Apply(header http.Header, origin, method, path, requestMethod string) (preflight bool) {
+	header.Add("Vary", "Origin")
+	preflight = method == http.MethodOptions && requestMethod != ""
+	if preflight {
+		header.Add("Vary", "Access-Control-Request-Method")
+		header.Add("Vary", "Access-Control-Request-Headers")
+	}
+
+	allowed, credentials := p.Allowed(origin)
+	if !allowed {
+		return preflight
+	}
+
+	methods := p.Methods(path)
+	if preflight && methods != nil && !contains(methods, strings.ToUpper(requestMethod)) {
+		return preflight
+	}
+
+	if credentials {
+		header.Set("Access-Control-Allow-Origin", origin)
+		header.Set("Access-Control-Allow-Credentials", "true")
+	} else if !p.listed(origin) {
+		header.Set("Access-Control-Allow-Origin", "*")
+	} else {
+		header.Set("Access-Control-Allow-Origin", origin)
+	}
+
+	if preflight {
+		if methods == nil {
+			methods = []string{http.MethodGet, http.MethodPost, http.MethodOptions}
+		}
+		header.Set("Access-Control-Allow-Methods", strings.Join(methods, ", "))
+		header.Set("Access-Control-Allow-Headers", strings.Join(p.AllowHeaders, ", "))
+		if p.MaxAge > 0 {
+			header.Set("Access-Control-Max-Age", strconv.Itoa(int(p.MaxAge.Seconds())))
+		}
+	} else if len(p.ExposeHeaders) > 0 {
+		header.Set("Access-Control-Expose-Headers", strings.Join(p.ExposeHeaders, ", "))
+	}
+	return preflight
+}
+
+// listed reports whether origin matches an explicit origin or pattern,
+// as opposed to only the "*" wildcard
+func (p *Policy) listed(origin string) bool {
+	normalized := strings.ToLower(origin)
+	if p.exact[normalized] {
+		return true
+	}
+	for _, re := range p.patterns {
+		if re.MatchString(normalized) {
+			return true
+		}
+	}
+	return false
+}
+
+func contains(list []string, s string) bool {
+	for _, item := range list {
+		if item == s {
+			return true
+		}
+	}
+	return false
+}
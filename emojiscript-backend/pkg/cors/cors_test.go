@@ -0,0 +1,107 @@
+package cors
+
+import (
+	"net/http"
+	"testing"
+)
+
+// TestAllowed checks each kind of origin pattern, and that only listed
+// origins carry credentials
+func TestAllowed(t *testing.T) {
+	p := New([]string{
+		"https://app.example.com/",
+		"https://*.example.dev",
+		"*.example.org",
+		`/^https://pr-\d+\.example\.net$/`,
+		"/[/",
+	}, true)
+	for _, tt := range []struct {
+		origin  string
+		allowed bool
+	}{
+		{"https://app.example.com", true},
+		{"HTTPS://APP.EXAMPLE.COM", true},
+		{"http://app.example.com", false},
+		{"https://evil.app.example.com", false},
+		{"https://a.example.dev", true},
+		{"https://a.b.example.dev:8443", true},
+		{"https://example.dev", false},
+		{"http://a.example.dev", false},
+		{"https://a.example.dev.evil.com", false},
+		{"http://a.example.org", true},
+		{"https://a.example.org", true},
+		{"ftp://a.example.org", false},
+		{"https://pr-42.example.net", true},
+		{"https://pr-x.example.net", false},
+		{"https://pr-42.example.net.evil.com", false},
+		{"[", false},
+		{"", false},
+	} {
+		allowed, credentials := p.Allowed(tt.origin)
+		if allowed != tt.allowed || credentials != tt.allowed {
+			t.Errorf("Allowed(%q) = %v, %v, want %v, %v", tt.origin, allowed, credentials, tt.allowed, tt.allowed)
+		}
+	}
+
+	open := New([]string{"*", "https://app.example.com"}, true)
+	if allowed, credentials := open.Allowed("https://other.com"); !allowed || credentials {
+		t.Errorf("* allowed https://other.com = %v with credentials %v, want it without", allowed, credentials)
+	}
+	if allowed, credentials := open.Allowed("https://app.example.com"); !allowed || !credentials {
+		t.Errorf("listed origin beside * = %v with credentials %v, want it with", allowed, credentials)
+	}
+	if allowed, _ := New(nil, false).Allowed(DefaultOrigins[0]); !allowed {
+		t.Errorf("no origins didn't fall back to DefaultOrigins")
+	}
+}
+
+// TestApply checks the headers written for plain requests and for
+// preflights of accepted and unaccepted methods
+func TestApply(t *testing.T) {
+	p := New([]string{"*", "https://app.example.com"}, true)
+	p.AllowRoute("/api/snippets/{id}", "GET")
+	p.AllowRoute("/api/snippets/:id", "delete")
+
+	for _, tt := range []struct {
+		name                          string
+		origin, method, requestMethod string
+		preflight                     bool
+		allowOrigin, credentials      string
+		allowMethods                  string
+	}{
+		{"listed", "https://app.example.com", "GET", "", false, "https://app.example.com", "true", ""},
+		{"wildcard", "https://other.com", "GET", "", false, "*", "", ""},
+		{"preflight", "https://app.example.com", "OPTIONS", "DELETE", true, "https://app.example.com", "true", "DELETE, GET, OPTIONS"},
+		{"preflight of an unaccepted method", "https://app.example.com", "OPTIONS", "PUT", true, "", "", ""},
+		{"OPTIONS without a preflight", "https://app.example.com", "OPTIONS", "", false, "https://app.example.com", "true", ""},
+	} {
+		header := http.Header{}
+		preflight := p.Apply(header, tt.origin, tt.method, "/api/snippets/abc", tt.requestMethod)
+		if preflight != tt.preflight {
+			t.Errorf("%s: preflight = %v, want %v", tt.name, preflight, tt.preflight)
+		}
+		for name, want := range map[string]string{
+			"Access-Control-Allow-Origin":      tt.allowOrigin,
+			"Access-Control-Allow-Credentials": tt.credentials,
+			"Access-Control-Allow-Methods":     tt.allowMethods,
+		} {
+			if got := header.Get(name); got != want {
+				t.Errorf("%s: %s = %q, want %q", tt.name, name, got, want)
+			}
+		}
+	}
+
+	header := http.Header{}
+	New([]string{"https://app.example.com"}, true).Apply(header, "https://other.com", "GET", "/", "")
+	if header.Get("Access-Control-Allow-Origin") != "" || header.Get("Vary") != "Origin" {
+		t.Errorf("unlisted origin got %v, want only Vary: Origin", header)
+	}
+}
+
+// TestParseOrigins checks that blank entries of a list are dropped
+func TestParseOrigins(t *testing.T) {
+	got := ParseOrigins(" https://a.com, ,*.b.com,")
+	if len(got) != 2 || got[0] != "https://a.com" || got[1] != "*.b.com" {
+		t.Errorf("ParseOrigins = %q", got)
+	}
+}
@@ -0,0 +1,142 @@
+// Package coverage aggregates emoji map coverage across transpiles, so
+// maintainers can see which emoji users reach for that the map lacks.
+package coverage
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"sync"
+
+	"emojiscript-backend/pkg/transpiler"
+)
+
+const (
+	// MaxTrackedEmoji bounds how many distinct unknown emoji are counted
+	// individually; later ones still count toward the totals
+	MaxTrackedEmoji = 1000
+	// TopUnknown is how many unknown emoji Summary lists
+	TopUnknown = 20
+)
+
+// buckets are the upper bounds of the per-transpile coverage histogram
+var buckets = []float64{50, 75, 90, 95, 99, 100}
+
+// EmojiCount is how often an unknown emoji was seen
+type EmojiCount struct {
+	Emoji string `json:"emoji"`
+	Count int64  `json:"count"`
+}
+
+// Summary is a snapshot of the aggregate for JSON metrics
+type Summary struct {
+	Transpiles int64 `json:"transpiles"`
+	Recognized int64 `json:"recognized"`
+	Unknown    int64 `json:"unknown"`
+	// Coverage is the percentage of all emoji seen that were recognized
+	Coverage   float64      `json:"coverage"`
+	TopUnknown []EmojiCount `json:"topUnknown"`
+}
+
+// Stats is safe for concurrent use
+type Stats struct {
+	mu         sync.Mutex
+	transpiles int64
+	recognized int64
+	unknown    int64
+	percentSum float64
+	buckets    []int64
+	emoji      map[string]int64
+}
+
+// New creates an empty aggregate
+func New() *Stats {
+	return &Stats{buckets: make([]int64, len(buckets)), emoji: map[string]int64{}}
+}
+
+// Record adds one transpile's coverage
+func (s *Stats) Record(c transpiler.Coverage) {
+	percent := c.Percent()
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.transpiles++
+	s.recognized += int64(c.Recognized)
+	s.unknown += int64(c.Unknown)
+	s.percentSum += percent
+	for i, bound := range buckets {
+		if percent <= bound {
+			s.buckets[i]++
+		}
+	}
+	for emoji, count := range c.UnknownEmoji {
+		if _, tracked := s.emoji[emoji]; tracked || len(s.emoji) < MaxTrackedEmoji {
+			s.emoji[emoji] += int64(count)
+		}
+	}
+}
+
+// Summary reports the totals and the most frequent unknown emoji
+func (s *Stats) Summary() Summary {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	summary := Summary{
+		Transpiles: s.transpiles,
+		Recognized: s.recognized,
+		Unknown:    s.unknown,
+		Coverage:   transpiler.Coverage{Recognized: int(s.recognized), Unknown: int(s.unknown)}.Percent(),
+		TopUnknown: s.sortedEmoji(),
+	}
+	if len(summary.TopUnknown) > TopUnknown {
+		summary.TopUnknown = summary.TopUnknown[:TopUnknown]
+	}
+	return summary
+}
+
+// sortedEmoji lists the tracked unknown emoji, most frequent first; the
+// caller holds mu
+func (s *Stats) sortedEmoji() []EmojiCount {
+	counts := make([]EmojiCount, 0, len(s.emoji))
+	for emoji, count := range s.emoji {
+		counts = append(counts, EmojiCount{Emoji: emoji, Count: count})
+	}
+	sort.Slice(counts, func(i, j int) bool {
+		if counts[i].Count != counts[j].Count {
+			return counts[i].Count > counts[j].Count
+		}
+		return counts[i].Emoji < counts[j].Emoji
+	})
+	return counts
+}
+
+// WritePrometheus writes the aggregate in the Prometheus text exposition
+// format
+func (s *Stats) WritePrometheus(w io.Writer) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	fmt.Fprintln(w, "# HELP emojiscript_emoji_tokens_total Emoji seen in transpiled programs, by whether the emoji map recognized them.")
+	fmt.Fprintln(w, "# TYPE emojiscript_emoji_tokens_total counter")
+	fmt.Fprintf(w, "emojiscript_emoji_tokens_total{status=\"recognized\"} %d\n", s.recognized)
+	fmt.Fprintf(w, "emojiscript_emoji_tokens_total{status=\"unknown\"} %d\n", s.unknown)
+
+	fmt.Fprintln(w, "# HELP emojiscript_unknown_emoji_total Occurrences of each emoji the emoji map passed through unknown.")
+	fmt.Fprintln(w, "# TYPE emojiscript_unknown_emoji_total counter")
+	for _, count := range s.sortedEmoji() {
+		fmt.Fprintf(w, "emojiscript_unknown_emoji_total{emoji=\"%s\"} %d\n", escapeLabel(count.Emoji), count.Count)
+	}
+
+	fmt.Fprintln(w, "# HELP emojiscript_transpile_coverage_percent Percentage of each transpiled program's emoji the emoji map recognized.")
+	fmt.Fprintln(w, "# TYPE emojiscript_transpile_coverage_percent histogram")
+	for i, bound := range buckets {
+		fmt.Fprintf(w, "emojiscript_transpile_coverage_percent_bucket{le=\"%g\"} %d\n", bound, s.buckets[i])
+	}
+	fmt.Fprintf(w, "emojiscript_transpile_coverage_percent_bucket{le=\"+Inf\"} %d\n", s.transpiles)
+	fmt.Fprintf(w, "emojiscript_transpile_coverage_percent_sum %g\n", s.percentSum)
+	fmt.Fprintf(w, "emojiscript_transpile_coverage_percent_count %d\n", s.transpiles)
+}
+
+// escapeLabel escapes a label value for the exposition format
+func escapeLabel(value string) string {
+	return strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`).Replace(value)
+}
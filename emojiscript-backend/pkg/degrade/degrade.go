@@ -0,0 +1,212 @@
+// Package degrade tracks the optional subsystems a deployment keeps
+// serving without: the remote store behind the transpile cache, the one
+// behind saved snippets, and the sandbox. A subsystem that fails is
+// marked down, so requests stop waiting on it and the server reports it
+// as degraded, while transpiling and validating go on as before. A failed
+// store is tried again after a while, and is back up once a call to it
+// succeeds.
+package degrade
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"emojiscript-backend/pkg/kvcache"
+)
+
+// Subsystems a Monitor tracks
+const (
+	// RemoteCache is the shared store behind the transpile cache; without
+	// it results are cached per instance
+	RemoteCache = "remoteCache"
+	// Snippets is the shared store behind saved snippets and their bans;
+	// without it an instance only has the snippets it has seen
+	Snippets = "snippets"
+	// Sandbox runs programs, for /run, /evaluate, /trace, grading and
+	// notebooks
+	Sandbox = "sandbox"
+)
+
+// DefaultRetryAfter is how long a failed store is left alone before it is
+// tried again
+const DefaultRetryAfter = 30 * time.Second
+
+// Feature is a subsystem that is down
+type Feature struct {
+	Name string `json:"name"`
+	// Reason is the error it failed with, or why it was turned off
+	Reason string    `json:"reason"`
+	Since  time.Time `json:"since"`
+}
+
+// Monitor records which subsystems are down. It is safe for concurrent
+// use, and a nil Monitor has nothing down.
+type Monitor struct {
+	retryAfter time.Duration
+
+	mu   sync.Mutex
+	down map[string]*outage
+}
+
+type outage struct {
+	Feature
+	// retry is when calls are let through again; zero for a subsystem
+	// turned off, which never comes back
+	retry time.Time
+}
+
+// New returns a Monitor that tries a failed store again after retryAfter,
+// DefaultRetryAfter when it is zero
+func New(retryAfter time.Duration) *Monitor {
+	if retryAfter <= 0 {
+		retryAfter = DefaultRetryAfter
+	}
+	return &Monitor{retryAfter: retryAfter, down: map[string]*outage{}}
+}
+
+// Fail marks name down after a call to it failed with err
+func (m *Monitor) Fail(name string, err error) {
+	if m == nil {
+		return
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	now := time.Now()
+	o, ok := m.down[name]
+	if !ok {
+		o = &outage{Feature: Feature{Name: name, Since: now.UTC()}}
+		m.down[name] = o
+	}
+	if ok && o.retry.IsZero() {
+		return
+	}
+	o.Reason = err.Error()
+	o.retry = now.Add(m.retryAfter)
+}
+
+// Succeed marks name up after a call to it succeeded
+func (m *Monitor) Succeed(name string) {
+	if m == nil {
+		return
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if o, ok := m.down[name]; ok && !o.retry.IsZero() {
+		delete(m.down, name)
+	}
+}
+
+// Disable turns name off for as long as the process runs
+func (m *Monitor) Disable(name, reason string) {
+	if m == nil {
+		return
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.down[name] = &outage{Feature: Feature{Name: name, Reason: reason, Since: time.Now().UTC()}}
+}
+
+// Down reports whether name is down, and so whether a caller should skip
+// it. A failed store stops being Down once it's due to be tried again,
+// though it stays Degraded until a call succeeds.
+func (m *Monitor) Down(name string) bool {
+	if m == nil {
+		return false
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	o, ok := m.down[name]
+	return ok && (o.retry.IsZero() || time.Now().Before(o.retry))
+}
+
+// Degraded reports whether name has failed, or been turned off, and not
+// come back
+func (m *Monitor) Degraded(name string) bool {
+	if m == nil {
+		return false
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	_, ok := m.down[name]
+	return ok
+}
+
+// Features lists the subsystems that are degraded, by name
+func (m *Monitor) Features() []Feature {
+	features := []Feature{}
+	if m == nil {
+		return features
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for _, o := range m.down {
+		features = append(features, o.Feature)
+	}
+	slices.SortFunc(features, func(a, b Feature) int { return strings.Compare(a.Name, b.Name) })
+	return features
+}
+
+// Header is the X-Degraded header's value: the names of the degraded
+// subsystems, or "" when there are none
+func (m *Monitor) Header() string {
+	var names []string
+	for _, feature := range m.Features() {
+		names = append(names, feature.Name)
+	}
+	return strings.Join(names, ", ")
+}
+
+// Store wraps a remote store so that its failures mark name down, and
+// calls while it is down are skipped: a Get finds nothing and a Set
+// stores nothing, without waiting on the store. A nil store stays nil.
+func Store(store kvcache.Store, m *Monitor, name string) kvcache.Store {
+	if store == nil || m == nil {
+		return store
+	}
+	return &monitored{store: store, monitor: m, name: name}
+}
+
+type monitored struct {
+	store   kvcache.Store
+	monitor *Monitor
+	name    string
+}
+
+func (s *monitored) Get(ctx context.Context, key string) ([]byte, bool, error) {
+	if s.monitor.Down(s.name) {
+		return nil, false, nil
+	}
+	value, found, err := s.store.Get(ctx, key)
+	s.record(err)
+	return value, found, err
+}
+
+func (s *monitored) Set(ctx context.Context, key string, value []byte, ttl time.Duration) error {
+	if s.monitor.Down(s.name) {
+		return nil
+	}
+	err := s.store.Set(ctx, key, value, ttl)
+	s.record(err)
+	return err
+}
+
+func (s *monitored) Name() string {
+	return s.store.Name()
+}
+
+// record marks the store down after a failed call, but not after one the
+// caller gave up on
+func (s *monitored) record(err error) {
+	if errors.Is(err, context.Canceled) {
+		return
+	}
+	if err != nil {
+		s.monitor.Fail(s.name, err)
+	} else {
+		s.monitor.Succeed(s.name)
+	}
+}
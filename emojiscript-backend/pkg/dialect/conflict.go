@@ -0,0 +1,161 @@
+package dialect
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"emojiscript-backend/pkg/transpiler"
+)
+
+// Conflict kinds reported by Check
+const (
+	// ConflictDuplicate is one emoji mapped twice, in one pack or across packs
+	ConflictDuplicate = "duplicate"
+	// ConflictShadow is a pack emoji that redefines a built-in emoji
+	ConflictShadow = "shadow"
+	// ConflictPrefix is a sequence that is a prefix of another, so which one
+	// matches depends on replacement order
+	ConflictPrefix = "prefix"
+)
+
+// Conflict is one ambiguity between mappings. Packs names the packs
+// involved; "builtin" stands for the base palette.
+type Conflict struct {
+	Kind    string   `json:"kind"`
+	Emoji   string   `json:"emoji"`
+	Other   string   `json:"other,omitempty"`
+	Packs   []string `json:"packs"`
+	Message string   `json:"message"`
+}
+
+// Builtin is the pack name conflicts use for the base palette
+const Builtin = "builtin"
+
+type mapping struct {
+	pack, emoji, canonical, keyword string
+}
+
+// Canonical normalizes an emoji sequence the way the transpiler matches it
+func Canonical(emoji string) string {
+	return transpiler.NormalizeVariants(strings.TrimSpace(emoji))
+}
+
+// Check finds ambiguous mappings in one or more packs as if they were
+// active together: emoji mapped twice (within a pack, or across packs with
+// different keywords), emoji shadowing the built-in palette, and sequences
+// that prefix one another. Mappings that aren't valid emoji are skipped;
+// Validate reports those.
+func Check(packs ...Pack) []Conflict {
+	base := map[string]string{}
+	for _, info := range transpiler.Palette() {
+		base[info.Emoji] = info.Keyword
+	}
+
+	conflicts := []Conflict{}
+	mappings := []mapping{}
+	seen := map[string]mapping{}
+	for _, pack := range packs {
+		for _, emoji := range sortedKeys(pack.Mappings) {
+			m := mapping{pack: pack.Name, emoji: emoji, canonical: Canonical(emoji), keyword: pack.Mappings[emoji]}
+			if m.canonical == "" || strings.IndexFunc(m.canonical, isIdentOrSpace) >= 0 {
+				continue
+			}
+
+			if previous, dup := seen[m.canonical]; dup {
+				switch {
+				case previous.pack == m.pack:
+					conflicts = append(conflicts, Conflict{
+						Kind: ConflictDuplicate, Emoji: emoji, Other: previous.emoji, Packs: []string{m.pack},
+						Message: fmt.Sprintf("'%s' is mapped twice ('%s' and '%s')", emoji, previous.keyword, m.keyword),
+					})
+				case previous.keyword != m.keyword:
+					conflicts = append(conflicts, Conflict{
+						Kind: ConflictDuplicate, Emoji: emoji, Other: previous.emoji, Packs: []string{previous.pack, m.pack},
+						Message: fmt.Sprintf("'%s' maps to '%s' in %s but '%s' in %s", emoji, previous.keyword, previous.pack, m.keyword, m.pack),
+					})
+				}
+				continue
+			}
+			if baseKeyword, ok := base[m.canonical]; ok && baseKeyword != m.keyword {
+				conflicts = append(conflicts, Conflict{
+					Kind: ConflictShadow, Emoji: emoji, Packs: []string{m.pack, Builtin},
+					Message: fmt.Sprintf("'%s' shadows the built-in mapping to '%s'", emoji, baseKeyword),
+				})
+			}
+			seen[m.canonical] = m
+			mappings = append(mappings, m)
+		}
+	}
+
+	builtinOnly := []string{}
+	for _, emoji := range sortedKeys(base) {
+		if _, ok := seen[emoji]; !ok {
+			builtinOnly = append(builtinOnly, emoji)
+		}
+	}
+
+	sort.SliceStable(mappings, func(i, j int) bool { return mappings[i].canonical < mappings[j].canonical })
+	for _, a := range mappings {
+		for _, b := range mappings {
+			if a.canonical != b.canonical && strings.HasPrefix(b.canonical, a.canonical) {
+				conflicts = append(conflicts, Conflict{
+					Kind: ConflictPrefix, Emoji: a.emoji, Other: b.emoji, Packs: packPair(a.pack, b.pack),
+					Message: fmt.Sprintf("'%s' is a prefix of '%s'%s", a.emoji, b.emoji, acrossPacks(a.pack, b.pack)),
+				})
+			}
+		}
+		for _, b := range builtinOnly {
+			switch {
+			case strings.HasPrefix(b, a.canonical):
+				conflicts = append(conflicts, Conflict{
+					Kind: ConflictPrefix, Emoji: a.emoji, Other: b, Packs: []string{a.pack, Builtin},
+					Message: fmt.Sprintf("'%s' is a prefix of '%s'", a.emoji, b),
+				})
+			case strings.HasPrefix(a.canonical, b):
+				conflicts = append(conflicts, Conflict{
+					Kind: ConflictPrefix, Emoji: a.emoji, Other: b, Packs: []string{a.pack, Builtin},
+					Message: fmt.Sprintf("'%s' starts with the built-in '%s'", a.emoji, b),
+				})
+			}
+		}
+	}
+	return conflicts
+}
+
+// CheckAgainst checks a pack against packs that are already installed,
+// returning only the conflicts that involve it. An earlier version of the
+// same pack is ignored.
+func CheckAgainst(pack Pack, installed []Pack) []Conflict {
+	packs := []Pack{}
+	for _, other := range installed {
+		if other.Name != pack.Name {
+			packs = append(packs, other)
+		}
+	}
+
+	conflicts := []Conflict{}
+	for _, conflict := range Check(append(packs, pack)...) {
+		for _, name := range conflict.Packs {
+			if name == pack.Name {
+				conflicts = append(conflicts, conflict)
+				break
+			}
+		}
+	}
+	return conflicts
+}
+
+func packPair(a, b string) []string {
+	if a == b {
+		return []string{a}
+	}
+	return []string{a, b}
+}
+
+func acrossPacks(a, b string) string {
+	if a == b {
+		return ""
+	}
+	return fmt.Sprintf(" (%s, %s)", a, b)
+}
@@ -0,0 +1,120 @@
+// Package dialect manages dialect packs: alternative emoji vocabularies
+// that map their own emoji onto EmojiScript keywords.
+package dialect
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+	"unicode"
+
+	"emojiscript-backend/pkg/transpiler"
+)
+
+const MaxMappings = 200
+
+var namePattern = regexp.MustCompile(`^[a-z0-9][a-z0-9_-]{0,63}$`)
+
+// Pack is a named emoji -> keyword vocabulary
+type Pack struct {
+	Name        string            `json:"name"`
+	Description string            `json:"description,omitempty"`
+	Mappings    map[string]string `json:"mappings"`
+	CreatedAt   time.Time         `json:"createdAt"`
+	UpdatedAt   time.Time         `json:"updatedAt"`
+}
+
+// ValidationError lists every problem found in a pack
+type ValidationError struct {
+	Problems []string
+}
+
+func (e *ValidationError) Error() string {
+	return "invalid dialect pack: " + strings.Join(e.Problems, "; ")
+}
+
+// ValidName reports whether name is an acceptable pack name
+func ValidName(name string) bool {
+	return namePattern.MatchString(name)
+}
+
+// Validate checks a pack on its own and against the base palette: every
+// keyword must exist, emoji may not contain identifier characters, and the
+// pack must have no conflicts (see Check).
+func (p Pack) Validate() error {
+	problems := []string{}
+	if !ValidName(p.Name) {
+		problems = append(problems, fmt.Sprintf("name '%s' must be 1-64 lowercase letters, digits, '-' or '_'", p.Name))
+	}
+	if len(p.Mappings) == 0 {
+		problems = append(problems, "pack has no mappings")
+	}
+	if len(p.Mappings) > MaxMappings {
+		problems = append(problems, fmt.Sprintf("pack has %d mappings (max %d)", len(p.Mappings), MaxMappings))
+	}
+
+	for _, emoji := range sortedKeys(p.Mappings) {
+		keyword := p.Mappings[emoji]
+		canonical := Canonical(emoji)
+		switch {
+		case canonical == "":
+			problems = append(problems, "empty emoji sequence")
+			continue
+		case strings.IndexFunc(canonical, isIdentOrSpace) >= 0:
+			problems = append(problems, fmt.Sprintf("'%s' contains letters, digits or spaces", emoji))
+			continue
+		}
+		if _, ok := transpiler.KeywordEmoji(keyword); !ok {
+			problems = append(problems, fmt.Sprintf("'%s' maps to unknown keyword '%s'", emoji, keyword))
+		}
+	}
+	for _, conflict := range Check(p) {
+		problems = append(problems, conflict.Message)
+	}
+
+	if len(problems) > 0 {
+		return &ValidationError{Problems: problems}
+	}
+	return nil
+}
+
+// ToBase maps the pack's emoji to the built-in emoji for the same keyword,
+// for rewriting dialect source before transpiling
+func (p Pack) ToBase() map[string]string {
+	aliases := map[string]string{}
+	for emoji, keyword := range p.Mappings {
+		if canonical, ok := transpiler.KeywordEmoji(keyword); ok {
+			aliases[emoji] = canonical
+		}
+	}
+	return aliases
+}
+
+// FromBase maps built-in emoji to the pack's emoji, so formatting
+// canonicalizes into the dialect. When several pack emoji share a keyword
+// the first in sort order wins.
+func (p Pack) FromBase() map[string]string {
+	aliases := map[string]string{}
+	for _, emoji := range sortedKeys(p.Mappings) {
+		canonical, ok := transpiler.KeywordEmoji(p.Mappings[emoji])
+		if _, taken := aliases[canonical]; ok && !taken {
+			aliases[canonical] = emoji
+		}
+	}
+	return aliases
+}
+
+func isIdentOrSpace(r rune) bool {
+	return r < unicode.MaxASCII && (unicode.IsLetter(r) || unicode.IsDigit(r) || unicode.IsSpace(r) || r == '_' || r == '$')
+}
+
+func sortedKeys(m map[string]string) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
@@ -0,0 +1,193 @@
+package dialect
+
+import (
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"emojiscript-backend/pkg/transpiler"
+)
+
+// Store holds dialect packs in memory, persisting them to a JSON file when
+// one is configured
+type Store struct {
+	mu    sync.RWMutex
+	path  string
+	packs map[string]Pack
+
+	// transpilers caches a Transpiler per pack and target language,
+	// keyed "name\x00target"; Put and Delete drop a pack's entries
+	transpilersMu sync.Mutex
+	transpilers   map[string]*transpiler.Transpiler
+}
+
+// NewStore opens a store backed by path, loading any packs already saved
+// there. An empty path keeps packs in memory only.
+func NewStore(path string) (*Store, error) {
+	s := &Store{path: path, packs: make(map[string]Pack), transpilers: make(map[string]*transpiler.Transpiler)}
+	if path == "" {
+		return s, nil
+	}
+
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return s, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var packs []Pack
+	if err := json.Unmarshal(data, &packs); err != nil {
+		return nil, err
+	}
+	for _, pack := range packs {
+		s.packs[pack.Name] = pack
+	}
+	return s, nil
+}
+
+// List returns every pack sorted by name
+func (s *Store) List() []Pack {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.listLocked()
+}
+
+// Get returns a pack by name
+func (s *Store) Get(name string) (Pack, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	pack, ok := s.packs[name]
+	return pack, ok
+}
+
+// Put validates and saves a pack, creating or replacing it. A pack that
+// maps an emoji differently from, or prefixes a sequence in, another
+// installed pack is rejected. It reports whether the pack is new.
+func (s *Store) Put(pack Pack) (bool, error) {
+	if err := pack.Validate(); err != nil {
+		return false, err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if conflicts := CheckAgainst(pack, s.listLocked()); len(conflicts) > 0 {
+		problems := make([]string, len(conflicts))
+		for i, conflict := range conflicts {
+			problems[i] = conflict.Message
+		}
+		return false, &ValidationError{Problems: problems}
+	}
+
+	now := time.Now().UTC()
+	previous, exists := s.packs[pack.Name]
+	pack.CreatedAt = now
+	if exists {
+		pack.CreatedAt = previous.CreatedAt
+	}
+	pack.UpdatedAt = now
+
+	s.packs[pack.Name] = pack
+	s.dropTranspilers(pack.Name)
+	if err := s.saveLocked(); err != nil {
+		if exists {
+			s.packs[pack.Name] = previous
+		} else {
+			delete(s.packs, pack.Name)
+		}
+		return false, err
+	}
+	return !exists, nil
+}
+
+// Delete removes a pack, reporting whether it existed
+func (s *Store) Delete(name string) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	previous, exists := s.packs[name]
+	if !exists {
+		return false, nil
+	}
+	delete(s.packs, name)
+	s.dropTranspilers(name)
+	if err := s.saveLocked(); err != nil {
+		s.packs[name] = previous
+		return false, err
+	}
+	return true, nil
+}
+
+// Transpiler returns a shared Transpiler for the named pack and target
+// language, building it on first use; "" names the built-in vocabulary.
+// It reports false when no such pack is installed.
+func (s *Store) Transpiler(name, targetLang string) (*transpiler.Transpiler, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	pack, ok := s.packs[name]
+	if !ok && name != "" {
+		return nil, false
+	}
+
+	s.transpilersMu.Lock()
+	defer s.transpilersMu.Unlock()
+	key := name + "\x00" + targetLang
+	t, ok := s.transpilers[key]
+	if !ok {
+		t = transpiler.New(transpiler.Options{TargetLanguage: targetLang, Aliases: pack.ToBase()})
+		s.transpilers[key] = t
+	}
+	return t, true
+}
+
+// dropTranspilers forgets the cached Transpilers of a pack; the caller
+// holds s.mu for writing
+func (s *Store) dropTranspilers(name string) {
+	s.transpilersMu.Lock()
+	defer s.transpilersMu.Unlock()
+	for key := range s.transpilers {
+		if strings.HasPrefix(key, name+"\x00") {
+			delete(s.transpilers, key)
+		}
+	}
+}
+
+func (s *Store) listLocked() []Pack {
+	packs := make([]Pack, 0, len(s.packs))
+	for _, pack := range s.packs {
+		packs = append(packs, pack)
+	}
+	sort.Slice(packs, func(i, j int) bool { return packs[i].Name < packs[j].Name })
+	return packs
+}
+
+// saveLocked writes the packs atomically via a temp file and rename
+func (s *Store) saveLocked() error {
+	if s.path == "" {
+		return nil
+	}
+	data, err := json.MarshalIndent(s.listLocked(), "", "  ")
+	if err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(s.path), ".dialects-*.json")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), s.path)
+}
@@ -0,0 +1,95 @@
+package emojiscriptapi
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strings"
+
+	"emojiscript-backend/pkg/dialect"
+)
+
+type DialectRequest struct {
+	Description string            `json:"description,omitempty"`
+	Mappings    map[string]string `json:"mappings"`
+}
+
+// requireAdmin wraps an admin route with bearer-token authentication; a
+// service token is accepted too. The admin API is disabled entirely when
+// no token is configured.
+func (h *handler) requireAdmin(fn http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if h.opts.AdminToken == "" && h.opts.ServiceTokens.Empty() {
+			writeJSON(w, http.StatusNotFound, errorBody{Error: "Admin API is disabled"})
+			return
+		}
+		if !h.isAdmin(r) {
+			w.Header().Set("WWW-Authenticate", `Bearer realm="emojiscript-admin"`)
+			writeJSON(w, http.StatusUnauthorized, errorBody{Error: "Invalid or missing admin token"})
+			return
+		}
+		fn(w, r)
+	}
+}
+
+// isAdmin reports whether r carries the admin token or a service token
+func (h *handler) isAdmin(r *http.Request) bool {
+	token := strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
+	admin := h.opts.AdminToken != "" && subtle.ConstantTimeCompare([]byte(token), []byte(h.opts.AdminToken)) == 1
+	_, service := h.opts.ServiceTokens.FromRequest(r)
+	return admin || service
+}
+
+func (h *handler) handleDialects(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, map[string]interface{}{"dialects": h.dialects.List()})
+}
+
+func (h *handler) handleDialect(w http.ResponseWriter, r *http.Request) {
+	pack, found := h.dialects.Get(r.PathValue("name"))
+	if !found {
+		writeJSON(w, http.StatusNotFound, errorBody{Error: "Dialect not found"})
+		return
+	}
+	writeJSON(w, http.StatusOK, pack)
+}
+
+func (h *handler) handlePutDialect(w http.ResponseWriter, r *http.Request) {
+	var req DialectRequest
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, int64(h.svc.MaxCodeLength()))).Decode(&req); err != nil {
+		writeJSON(w, http.StatusBadRequest, errorBody{Error: "Invalid request"})
+		return
+	}
+
+	pack := dialect.Pack{Name: r.PathValue("name"), Description: req.Description, Mappings: req.Mappings}
+	created, err := h.dialects.Put(pack)
+	var invalid *dialect.ValidationError
+	switch {
+	case errors.As(err, &invalid):
+		writeJSON(w, http.StatusUnprocessableEntity, map[string]interface{}{"success": false, "error": "Invalid dialect pack", "problems": invalid.Problems})
+		return
+	case err != nil:
+		writeJSON(w, http.StatusInternalServerError, errorBody{Error: "Failed to save dialect pack"})
+		return
+	}
+
+	saved, _ := h.dialects.Get(pack.Name)
+	status := http.StatusOK
+	if created {
+		status = http.StatusCreated
+	}
+	writeJSON(w, status, saved)
+}
+
+func (h *handler) handleDeleteDialect(w http.ResponseWriter, r *http.Request) {
+	deleted, err := h.dialects.Delete(r.PathValue("name"))
+	if err != nil {
+		writeJSON(w, http.StatusInternalServerError, errorBody{Error: "Failed to delete dialect pack"})
+		return
+	}
+	if !deleted {
+		writeJSON(w, http.StatusNotFound, errorBody{Error: "Dialect not found"})
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
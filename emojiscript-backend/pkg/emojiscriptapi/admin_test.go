@@ -0,0 +1,96 @@
+package emojiscriptapi
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"emojiscript-backend/pkg/servicetoken"
+)
+
+// TestAdminAuth checks that the admin routes want the admin token as a
+// bearer token, and are off when no token is configured
+func TestAdminAuth(t *testing.T) {
+	pack := `{"mappings": {"🦜": "console.log"}}`
+	for _, tt := range []struct {
+		token, auth string
+		want        int
+	}{
+		{"", "", http.StatusNotFound},
+		{"", "Bearer ", http.StatusNotFound},
+		{"secret", "", http.StatusUnauthorized},
+		{"secret", "Bearer wrong", http.StatusUnauthorized},
+		{"secret", "Bearer secret", http.StatusCreated},
+	} {
+		api := NewHandler(Options{AdminToken: tt.token})
+		req := httptest.NewRequest("PUT", DefaultPrefix+"/admin/dialects/parrot", strings.NewReader(pack))
+		if tt.auth != "" {
+			req.Header.Set("Authorization", tt.auth)
+		}
+		rec := httptest.NewRecorder()
+		api.ServeHTTP(rec, req)
+		if rec.Code != tt.want {
+			t.Errorf("token %q, Authorization %q: got %d, want %d: %s", tt.token, tt.auth, rec.Code, tt.want, rec.Body)
+		}
+		if tt.want == http.StatusUnauthorized && rec.Header().Get("WWW-Authenticate") == "" {
+			t.Errorf("token %q, Authorization %q: got no WWW-Authenticate", tt.token, tt.auth)
+		}
+	}
+}
+
+// TestAdminDialects checks that a pack put through the admin API is
+// served publicly until it's deleted
+func TestAdminDialects(t *testing.T) {
+	api := NewHandler(Options{AdminToken: "secret"})
+	do := func(method, path, body string) int {
+		req := httptest.NewRequest(method, DefaultPrefix+path, strings.NewReader(body))
+		req.Header.Set("Authorization", "Bearer secret")
+		rec := httptest.NewRecorder()
+		api.ServeHTTP(rec, req)
+		return rec.Code
+	}
+	for _, tt := range []struct {
+		method, path, body string
+		want               int
+	}{
+		{"GET", "/dialects/parrot", "", http.StatusNotFound},
+		{"PUT", "/admin/dialects/parrot", `{"mappings": {"🦜": "console.log"}}`, http.StatusCreated},
+		{"PUT", "/admin/dialects/parrot", `{"mappings": {"🦜": "console.log"}, "description": "birds"}`, http.StatusOK},
+		{"PUT", "/admin/dialects/parrot", `{"mappings": {"🦜": "not an emoji"}}`, http.StatusUnprocessableEntity},
+		{"PUT", "/admin/dialects/parrot", `{`, http.StatusBadRequest},
+		{"GET", "/dialects/parrot", "", http.StatusOK},
+		{"DELETE", "/admin/dialects/parrot", "", http.StatusNoContent},
+		{"DELETE", "/admin/dialects/parrot", "", http.StatusNotFound},
+		{"GET", "/dialects/parrot", "", http.StatusNotFound},
+	} {
+		if got := do(tt.method, tt.path, tt.body); got != tt.want {
+			t.Errorf("%s %s %s: got %d, want %d", tt.method, tt.path, tt.body, got, tt.want)
+		}
+	}
+}
+
+// TestAdminServiceToken checks that a service token opens the admin API
+// as the admin token does, and that either one alone configures it
+func TestAdminServiceToken(t *testing.T) {
+	for _, tt := range []struct {
+		admin, header string
+		want          int
+	}{
+		{"", "", http.StatusUnauthorized},
+		{"", "wrong", http.StatusUnauthorized},
+		{"", "svc-secret", http.StatusOK},
+		{"secret", "svc-secret", http.StatusOK},
+	} {
+		api := NewHandler(Options{AdminToken: tt.admin, ServiceTokens: servicetoken.Parse("frontend:svc-secret")})
+		req := httptest.NewRequest("GET", DefaultPrefix+"/admin/dialects", nil)
+		if tt.header != "" {
+			req.Header.Set(servicetoken.Header, tt.header)
+		}
+		rec := httptest.NewRecorder()
+		api.ServeHTTP(rec, req)
+		if rec.Code != tt.want {
+			t.Errorf("admin token %q, service token %q: got %d, want %d", tt.admin, tt.header, rec.Code, tt.want)
+		}
+	}
+}
@@ -0,0 +1,71 @@
+package emojiscriptapi
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"emojiscript-backend/pkg/apikey"
+	"emojiscript-backend/pkg/servicetoken"
+)
+
+// TestAPIKeyQuota checks that the handler counts keyed requests against
+// their quota, except for health checks, /usage and service callers
+func TestAPIKeyQuota(t *testing.T) {
+	keys, _ := apikey.Parse("alice:a1:free:2")
+	api := NewHandler(Options{Prefix: DefaultPrefix, APIKeys: keys, ServiceTokens: servicetoken.Parse("frontend:svc")})
+	for i, tt := range []struct {
+		path, key, service string
+		want               int
+	}{
+		{"/reference", "nope", "", http.StatusUnauthorized},
+		{"/reference", "", "", http.StatusOK},
+		{"/reference", "a1", "", http.StatusOK},
+		{"/health", "a1", "", http.StatusOK},
+		{"/usage", "a1", "", http.StatusOK},
+		{"/reference", "a1", "svc", http.StatusOK},
+		{"/reference", "a1", "", http.StatusOK},
+		{"/reference", "a1", "", http.StatusTooManyRequests},
+		{"/health", "a1", "", http.StatusOK},
+	} {
+		req := httptest.NewRequest("GET", DefaultPrefix+tt.path, nil)
+		req.Header.Set(apikey.Header, tt.key)
+		req.Header.Set(servicetoken.Header, tt.service)
+		rec := httptest.NewRecorder()
+		api.ServeHTTP(rec, req)
+		if rec.Code != tt.want {
+			t.Errorf("%d: %s with key %q: got %d, want %d: %s", i, tt.path, tt.key, rec.Code, tt.want, rec.Body)
+		}
+	}
+}
+
+// TestUsage checks that /usage reports on the caller's key without
+// counting itself
+func TestUsage(t *testing.T) {
+	keys, _ := apikey.Parse("alice:a1:classroom")
+	api := NewHandler(Options{Prefix: DefaultPrefix, APIKeys: keys})
+	get := func(path, key string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest("GET", DefaultPrefix+path, nil)
+		req.Header.Set(apikey.Header, key)
+		rec := httptest.NewRecorder()
+		api.ServeHTTP(rec, req)
+		return rec
+	}
+	if rec := get("/usage", ""); rec.Code != http.StatusBadRequest {
+		t.Errorf("no key: got %d, want 400", rec.Code)
+	}
+	get("/reference", "a1")
+	get("/usage", "a1")
+	rec := get("/usage", "a1")
+	var resp struct {
+		Usage     apikey.Usage
+		PerMinute int
+	}
+	if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil {
+		t.Fatal(err)
+	}
+	if resp.Usage.Used != 1 || resp.Usage.Tier != "classroom" || resp.PerMinute != 1000 || resp.Usage.Remaining == nil || *resp.Usage.Remaining != 49999 {
+		t.Errorf("got %s, want 1 request used on the classroom tier", rec.Body)
+	}
+}
@@ -0,0 +1,203 @@
+package emojiscriptapi
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"slices"
+	"strings"
+	"time"
+
+	"emojiscript-backend/pkg/apikey"
+	"emojiscript-backend/pkg/dialect"
+	"emojiscript-backend/pkg/transpiler"
+)
+
+// ArchiveFormat and ArchiveVersion identify an export; an import refuses
+// an archive of another format or a newer version
+const (
+	ArchiveFormat  = "emojiscript-archive"
+	ArchiveVersion = 1
+	// maxArchiveBytes bounds an import's body
+	maxArchiveBytes = 64 << 20
+)
+
+// Archive is the server state an admin moves from one deployment to
+// another: the snippets, the bans on snippets, the dialect packs, the
+// examples and the API keys. Examples are imported only by a server with
+// Storage; others serve their built-in ones.
+type Archive struct {
+	Format     string    `json:"format"`
+	Version    int       `json:"version"`
+	ExportedAt time.Time `json:"exportedAt"`
+	// ServerVersion is the transpiler version that made the archive
+	ServerVersion string         `json:"serverVersion"`
+	Snippets      []Snippet      `json:"snippets"`
+	SnippetBans   []SnippetBan   `json:"snippetBans"`
+	Dialects      []dialect.Pack `json:"dialects"`
+	Examples      []Example      `json:"examples"`
+	// APIKeys carry their values, so an archive is as secret as the
+	// API_KEYS setting
+	APIKeys []apikey.Entry `json:"apiKeys"`
+}
+
+// ImportCount reports what an import did with one kind of item. An item
+// already on the server is skipped unless the import overwrites.
+type ImportCount struct {
+	Imported int      `json:"imported"`
+	Skipped  int      `json:"skipped"`
+	Problems []string `json:"problems,omitempty"`
+}
+
+type ImportReport struct {
+	Snippets    ImportCount `json:"snippets"`
+	SnippetBans ImportCount `json:"snippetBans"`
+	Dialects    ImportCount `json:"dialects"`
+	Examples    ImportCount `json:"examples"`
+	APIKeys     ImportCount `json:"apiKeys"`
+	// APIKeysSetting is the API_KEYS value for every key the server now
+	// has, since imported keys last only until it restarts
+	APIKeysSetting string `json:"apiKeysSetting,omitempty"`
+}
+
+// handleExport answers with the server's state as an archive to download
+func (h *handler) handleExport(w http.ResponseWriter, r *http.Request) {
+	now := time.Now().UTC()
+	examples := slices.Concat(h.examples.list(r.Context(), "emoji"), h.examples.list(r.Context(), "markup"))
+	w.Header().Set("Content-Disposition", fmt.Sprintf(`attachment; filename="emojiscript-%s.json"`, now.Format("2006-01-02")))
+	writeJSON(w, http.StatusOK, Archive{
+		Format:        ArchiveFormat,
+		Version:       ArchiveVersion,
+		ExportedAt:    now,
+		ServerVersion: transpiler.Version,
+		Snippets:      h.snippets.all(r.Context()),
+		SnippetBans:   h.moderation.list(),
+		Dialects:      h.dialects.List(),
+		Examples:      examples,
+		APIKeys:       h.opts.APIKeys.Export(),
+	})
+}
+
+// handleImport loads an archive. Items are imported one by one, so a bad
+// one is reported and skipped rather than failing the rest; with
+// ?overwrite=true, items replace those of the same id or name.
+func (h *handler) handleImport(w http.ResponseWriter, r *http.Request) {
+	var archive Archive
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxArchiveBytes)).Decode(&archive); err != nil {
+		writeJSON(w, http.StatusBadRequest, errorBody{Error: "Invalid archive: " + err.Error()})
+		return
+	}
+	if archive.Format != ArchiveFormat {
+		writeJSON(w, http.StatusBadRequest, errorBody{Error: fmt.Sprintf("not an archive: format is %q, not %q", archive.Format, ArchiveFormat)})
+		return
+	}
+	if archive.Version < 1 || archive.Version > ArchiveVersion {
+		writeJSON(w, http.StatusBadRequest, errorBody{Error: fmt.Sprintf("archive version %d isn't supported; this server reads up to %d", archive.Version, ArchiveVersion)})
+		return
+	}
+	overwrite := r.URL.Query().Get("overwrite") == "true"
+	ctx := r.Context()
+	var report ImportReport
+
+	// bans go first, so a banned snippet in the same archive is refused
+	for _, ban := range archive.SnippetBans {
+		if ban.Hash == "" {
+			report.SnippetBans.Problems = append(report.SnippetBans.Problems, "a ban has no hash")
+			continue
+		}
+		if !overwrite && h.moderation.isBanned(ban.Hash) {
+			report.SnippetBans.Skipped++
+			continue
+		}
+		h.moderation.ban(ctx, ban)
+		report.SnippetBans.Imported++
+	}
+
+	now := time.Now()
+	for _, snippet := range archive.Snippets {
+		switch {
+		case snippet.ID == "":
+			report.Snippets.Problems = append(report.Snippets.Problems, "a snippet has no id")
+			continue
+		case snippet.expired(now):
+			report.Snippets.Skipped++
+			continue
+		case h.moderation.banned(ctx, snippet.Code):
+			report.Snippets.Problems = append(report.Snippets.Problems, fmt.Sprintf("snippet %s is banned", snippet.ID))
+			continue
+		}
+		if _, found := h.snippets.get(ctx, snippet.ID); found && !overwrite {
+			report.Snippets.Skipped++
+			continue
+		}
+		h.snippets.save(ctx, snippet)
+		report.Snippets.Imported++
+	}
+
+	for _, pack := range archive.Dialects {
+		if _, found := h.dialects.Get(pack.Name); found && !overwrite {
+			report.Dialects.Skipped++
+			continue
+		}
+		if _, err := h.dialects.Put(pack); err != nil {
+			var invalid *dialect.ValidationError
+			problem := err.Error()
+			if errors.As(err, &invalid) {
+				problem = strings.Join(invalid.Problems, "; ")
+			}
+			report.Dialects.Problems = append(report.Dialects.Problems, fmt.Sprintf("dialect %q: %s", pack.Name, problem))
+			continue
+		}
+		report.Dialects.Imported++
+	}
+
+	if len(archive.Examples) > 0 && h.examples.storage == nil {
+		report.Examples.Problems = append(report.Examples.Problems, "this server has no storage for examples")
+		archive.Examples = nil
+	}
+	for _, example := range archive.Examples {
+		if example.ID == "" || (example.Syntax != "emoji" && example.Syntax != "markup") {
+			report.Examples.Problems = append(report.Examples.Problems, fmt.Sprintf("example %q needs an id and an emoji or markup syntax", example.ID))
+			continue
+		}
+		found, err := h.examples.has(ctx, example)
+		if err == nil && found && !overwrite {
+			report.Examples.Skipped++
+			continue
+		}
+		if err == nil {
+			err = h.examples.put(ctx, example)
+		}
+		if err != nil {
+			report.Examples.Problems = append(report.Examples.Problems, fmt.Sprintf("example %q: %v", example.ID, err))
+			continue
+		}
+		report.Examples.Imported++
+	}
+
+	if len(archive.APIKeys) > 0 {
+		if h.opts.APIKeys == nil {
+			report.APIKeys.Problems = append(report.APIKeys.Problems, "this server has no API key store")
+		} else {
+			for _, entry := range archive.APIKeys {
+				added, err := h.opts.APIKeys.Add(entry, overwrite)
+				switch {
+				case err != nil:
+					report.APIKeys.Problems = append(report.APIKeys.Problems, err.Error())
+				case added:
+					report.APIKeys.Imported++
+				default:
+					report.APIKeys.Skipped++
+				}
+			}
+			entries := make([]string, 0, len(archive.APIKeys))
+			for _, entry := range h.opts.APIKeys.Export() {
+				entries = append(entries, entry.String())
+			}
+			report.APIKeysSetting = strings.Join(entries, ",")
+		}
+	}
+
+	writeJSON(w, http.StatusOK, report)
+}
@@ -0,0 +1,118 @@
+package emojiscriptapi
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"emojiscript-backend/pkg/apikey"
+)
+
+// TestArchive checks that an export imports into another server, which
+// then serves the same snippets, dialects, bans and keys, and that
+// importing it again skips what's already there
+func TestArchive(t *testing.T) {
+	admin := func(api http.Handler, method, path, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, DefaultPrefix+path, strings.NewReader(body))
+		req.Header.Set("Authorization", "Bearer secret")
+		rec := httptest.NewRecorder()
+		api.ServeHTTP(rec, req)
+		return rec
+	}
+
+	sourceKeys, _ := apikey.Parse("alice:a1:classroom")
+	source := NewHandler(Options{Prefix: DefaultPrefix, AdminToken: "secret", APIKeys: sourceKeys})
+	var kept, banned SnippetResponse
+	json.Unmarshal(admin(source, "POST", "/snippets", `{"code": "📝(\"kept\")"}`).Body.Bytes(), &kept)
+	json.Unmarshal(admin(source, "POST", "/snippets", `{"code": "📝(\"banned\")"}`).Body.Bytes(), &banned)
+	admin(source, "DELETE", "/admin/snippets/"+banned.ID, "")
+	admin(source, "PUT", "/admin/dialects/parrot", `{"mappings": {"🦜": "console.log"}}`)
+
+	exported := admin(source, "GET", "/admin/export", "")
+	var archive Archive
+	if err := json.Unmarshal(exported.Body.Bytes(), &archive); err != nil {
+		t.Fatal(err)
+	}
+	if archive.Format != ArchiveFormat || len(archive.Snippets) != 1 || len(archive.SnippetBans) != 1 || len(archive.Dialects) != 1 || len(archive.APIKeys) != 1 {
+		t.Fatalf("got archive %s, want one snippet, ban, dialect and key", exported.Body)
+	}
+	if !strings.HasPrefix(exported.Header().Get("Content-Disposition"), "attachment") {
+		t.Errorf("got Content-Disposition %q, want an attachment", exported.Header().Get("Content-Disposition"))
+	}
+
+	targetKeys, _ := apikey.Parse("")
+	target := NewHandler(Options{Prefix: DefaultPrefix, AdminToken: "secret", APIKeys: targetKeys})
+	var report ImportReport
+	json.Unmarshal(admin(target, "POST", "/admin/import", exported.Body.String()).Body.Bytes(), &report)
+	if report.Snippets.Imported != 1 || report.SnippetBans.Imported != 1 || report.Dialects.Imported != 1 || report.APIKeys.Imported != 1 {
+		t.Errorf("got report %+v, want everything imported", report)
+	}
+	if report.APIKeysSetting != "alice:a1:classroom:50000" {
+		t.Errorf("got API_KEYS setting %q", report.APIKeysSetting)
+	}
+	if len(report.Examples.Problems) != 1 {
+		t.Errorf("got examples %+v, want them refused by a server without storage", report.Examples)
+	}
+	for _, tt := range []struct {
+		method, path, body string
+		want               int
+	}{
+		{"GET", "/snippets/" + kept.ID, "", http.StatusOK},
+		{"GET", "/dialects/parrot", "", http.StatusOK},
+		{"POST", "/snippets", `{"code": "📝(\"banned\")"}`, http.StatusForbidden},
+	} {
+		req := httptest.NewRequest(tt.method, DefaultPrefix+tt.path, strings.NewReader(tt.body))
+		req.Header.Set(apikey.Header, "a1")
+		rec := httptest.NewRecorder()
+		target.ServeHTTP(rec, req)
+		if rec.Code != tt.want {
+			t.Errorf("imported %s %s: got %d, want %d: %s", tt.method, tt.path, rec.Code, tt.want, rec.Body)
+		}
+	}
+
+	report = ImportReport{}
+	json.Unmarshal(admin(target, "POST", "/admin/import", exported.Body.String()).Body.Bytes(), &report)
+	if report.Snippets.Skipped != 1 || report.SnippetBans.Skipped != 1 || report.Dialects.Skipped != 1 || report.APIKeys.Skipped != 1 {
+		t.Errorf("got report %+v on the second import, want everything skipped", report)
+	}
+}
+
+// TestImportRefused checks that an import refuses bodies that aren't a
+// supported archive, and reports items it can't take
+func TestImportRefused(t *testing.T) {
+	api := NewHandler(Options{Prefix: DefaultPrefix, AdminToken: "secret"})
+	post := func(body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest("POST", DefaultPrefix+"/admin/import", strings.NewReader(body))
+		req.Header.Set("Authorization", "Bearer secret")
+		rec := httptest.NewRecorder()
+		api.ServeHTTP(rec, req)
+		return rec
+	}
+	for _, body := range []string{
+		`{`,
+		`{"format": "zip", "version": 1}`,
+		`{"format": "emojiscript-archive", "version": 2}`,
+		`{"format": "emojiscript-archive"}`,
+	} {
+		if rec := post(body); rec.Code != http.StatusBadRequest {
+			t.Errorf("%s: got %d, want 400", body, rec.Code)
+		}
+	}
+
+	rec := post(`{"format": "emojiscript-archive", "version": 1,
+		"snippets": [{"code": "📝(1)"}],
+		"snippetBans": [{}],
+		"dialects": [{"name": "parrot", "mappings": {"🦜": "squawk"}}],
+		"apiKeys": [{"name": "alice", "key": "a1", "tier": "free"}]}`)
+	var report ImportReport
+	if err := json.Unmarshal(rec.Body.Bytes(), &report); err != nil || rec.Code != http.StatusOK {
+		t.Fatalf("got %d %s", rec.Code, rec.Body)
+	}
+	for name, count := range map[string]ImportCount{"snippets": report.Snippets, "bans": report.SnippetBans, "dialects": report.Dialects, "keys": report.APIKeys} {
+		if count.Imported != 0 || len(count.Problems) != 1 {
+			t.Errorf("%s: got %+v, want one problem", name, count)
+		}
+	}
+}
@@ -0,0 +1,105 @@
+package emojiscriptapi
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+
+	"emojiscript-backend/pkg/astviz"
+	"emojiscript-backend/pkg/hints"
+	"emojiscript-backend/pkg/sandbox"
+	"emojiscript-backend/pkg/service"
+	"emojiscript-backend/pkg/transpiler"
+)
+
+type ASTRequest struct {
+	Code      string `json:"code"`
+	UseMarkup bool   `json:"useMarkup,omitempty"`
+	Dialect   string `json:"dialect,omitempty"`
+	// Format is "json" (the default), "dot", "mermaid" or "markup", the
+	// last for the tag tree of a markup program itself
+	Format string `json:"format,omitempty"`
+}
+
+type ASTResponse struct {
+	Success    bool          `json:"success"`
+	Format     string        `json:"format,omitempty"`
+	JavaScript string        `json:"javascript,omitempty"`
+	Tree       *sandbox.Node `json:"tree,omitempty"`
+	// Graph is the DOT or Mermaid source for the tree
+	Graph string `json:"graph,omitempty"`
+	// Markup is the markup program's tag tree, untranspiled
+	Markup   []transpiler.MarkupTag `json:"markup,omitempty"`
+	Errors   []string               `json:"errors,omitempty"`
+	Warnings []string               `json:"warnings,omitempty"`
+	Hints    []hints.Hint           `json:"hints,omitempty"`
+}
+
+// handleAST transpiles the program and returns the syntax tree of the
+// output, as JSON or drawn as a DOT or Mermaid graph. The markup format
+// returns the tag tree of a markup program instead, before transpiling.
+func (h *handler) handleAST(w http.ResponseWriter, r *http.Request) {
+	var req ASTRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeJSON(w, http.StatusBadRequest, ASTResponse{Errors: []string{"Invalid request"}})
+		return
+	}
+	if req.Format == "" {
+		req.Format = "json"
+	}
+	if req.Format != "json" && req.Format != "markup" && req.Format != astviz.FormatDOT && req.Format != astviz.FormatMermaid {
+		writeJSON(w, http.StatusBadRequest, ASTResponse{Errors: []string{"format must be json, dot, mermaid or markup"}})
+		return
+	}
+	if err := h.svc.ValidateInput(req.Code); err != nil {
+		writeJSON(w, http.StatusBadRequest, ASTResponse{Errors: []string{err.Error()}, Hints: hints.For([]string{err.Error()}, req.Code)})
+		return
+	}
+
+	if req.Format == "markup" {
+		h.markupTree(w, req)
+		return
+	}
+
+	output, warnings, errs := h.compileJavaScript(r.Context(), req.Code, req.Dialect, req.UseMarkup)
+	if len(errs) > 0 {
+		writeJSON(w, http.StatusBadRequest, ASTResponse{Errors: errs, Warnings: warnings, Hints: hints.For(errs, req.Code)})
+		return
+	}
+	tree, err := sandbox.Tree(output)
+	if err != nil {
+		errs = []string{err.Error()}
+		writeJSON(w, http.StatusBadRequest, ASTResponse{JavaScript: output, Errors: errs, Warnings: warnings, Hints: hints.For(errs, req.Code)})
+		return
+	}
+
+	resp := ASTResponse{Success: true, Format: req.Format, JavaScript: output, Warnings: warnings}
+	if req.Format == "json" {
+		resp.Tree = tree
+	} else {
+		resp.Graph, _ = astviz.Render(req.Format, tree)
+	}
+	writeJSON(w, http.StatusOK, resp)
+}
+
+// markupTree answers /ast in the markup format. Tags that fail to parse
+// are left in the tree as nodes with their error, so the tree comes back
+// alongside the errors.
+func (h *handler) markupTree(w http.ResponseWriter, req ASTRequest) {
+	t, found := h.dialects.Transpiler(req.Dialect, "javascript")
+	if !found {
+		writeJSON(w, http.StatusBadRequest, ASTResponse{Errors: []string{fmt.Sprintf("Unknown dialect '%s'", req.Dialect)}})
+		return
+	}
+	if !req.UseMarkup && !service.DetectMarkupSyntax(t.ApplyAliases(req.Code)) {
+		writeJSON(w, http.StatusBadRequest, ASTResponse{Errors: []string{"the markup format needs a markup program"}})
+		return
+	}
+
+	tree, errs := t.ParseMarkup(req.Code)
+	if len(errs) > 0 {
+		writeJSON(w, http.StatusBadRequest, ASTResponse{Format: req.Format, Markup: tree, Errors: errs, Hints: hints.For(errs, req.Code)})
+		return
+	}
+	writeJSON(w, http.StatusOK, ASTResponse{Success: true, Format: req.Format, Markup: tree})
+}
@@ -0,0 +1,146 @@
+package emojiscriptapi
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"net/http"
+	"strings"
+	"sync"
+
+	"emojiscript-backend/pkg/badge"
+	"emojiscript-backend/pkg/sandbox"
+	"emojiscript-backend/pkg/transpiler"
+)
+
+// MaxBadgeRecords caps the verification results kept for ?hash= lookups;
+// the oldest are forgotten first
+const MaxBadgeRecords = 10000
+
+type BadgeRequest struct {
+	Code      string `json:"code"`
+	UseMarkup bool   `json:"useMarkup,omitempty"`
+	Dialect   string `json:"dialect,omitempty"`
+}
+
+type BadgeResponse struct {
+	Success  bool     `json:"success"`
+	Hash     string   `json:"hash,omitempty"`
+	Verified bool     `json:"verified"`
+	Version  string   `json:"version"`
+	BadgeURL string   `json:"badgeUrl,omitempty"`
+	Errors   []string `json:"errors,omitempty"`
+}
+
+// badgeStore remembers whether each snippet hash verified
+type badgeStore struct {
+	mu       sync.Mutex
+	verified map[string]bool
+	order    []string
+}
+
+func newBadgeStore() *badgeStore {
+	return &badgeStore{verified: map[string]bool{}}
+}
+
+func (s *badgeStore) record(hash string, verified bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.verified[hash]; !ok {
+		if len(s.order) >= MaxBadgeRecords {
+			delete(s.verified, s.order[0])
+			s.order = s.order[1:]
+		}
+		s.order = append(s.order, hash)
+	}
+	s.verified[hash] = verified
+}
+
+func (s *badgeStore) lookup(hash string) (verified, found bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	verified, found = s.verified[hash]
+	return verified, found
+}
+
+// verifySnippet transpiles code and checks the JavaScript parses; the
+// result is recorded under the code's SHA-256, the same hash history uses
+func (h *handler) verifySnippet(ctx context.Context, code, dialectName string, useMarkup bool) (hash string, errs []string) {
+	sum := sha256.Sum256([]byte(code))
+	hash = hex.EncodeToString(sum[:])
+	output, _, errs := h.compileJavaScript(ctx, code, dialectName, useMarkup)
+	if len(errs) == 0 {
+		if err := sandbox.Check(output); err != nil {
+			errs = []string{err.Error()}
+		}
+	}
+	h.badges.record(hash, len(errs) == 0)
+	return hash, errs
+}
+
+// handleVerifyBadge verifies a snippet and returns the URL of its badge
+func (h *handler) handleVerifyBadge(w http.ResponseWriter, r *http.Request) {
+	var req BadgeRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeJSON(w, http.StatusBadRequest, BadgeResponse{Version: transpiler.Version, Errors: []string{"Invalid request"}})
+		return
+	}
+	if err := h.svc.ValidateInput(req.Code); err != nil {
+		writeJSON(w, http.StatusBadRequest, BadgeResponse{Version: transpiler.Version, Errors: []string{err.Error()}})
+		return
+	}
+
+	hash, errs := h.verifySnippet(r.Context(), req.Code, req.Dialect, req.UseMarkup)
+	writeJSON(w, http.StatusOK, BadgeResponse{
+		Success:  true,
+		Hash:     hash,
+		Verified: len(errs) == 0,
+		Version:  transpiler.Version,
+		BadgeURL: h.opts.Prefix + "/badge?hash=" + hash,
+		Errors:   errs,
+	})
+}
+
+// handleBadge renders an SVG badge: the transpiler version by default,
+// or the verification status of ?hash= (recorded by POST /badge) or of
+// the snippet in ?code=
+func (h *handler) handleBadge(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	label := query.Get("label")
+	if !query.Has("label") {
+		label = "emojiscript"
+	}
+
+	message, color, cacheControl := "v"+transpiler.Version, "blue", "public, max-age=300"
+	status := func(verified bool) {
+		if verified {
+			message, color = "emoji-verified", "brightgreen"
+		} else {
+			message, color = "failing", "red"
+		}
+	}
+	switch {
+	case query.Get("code") != "":
+		code := query.Get("code")
+		if err := h.svc.ValidateInput(code); err != nil {
+			message, color = "invalid", "lightgrey"
+			break
+		}
+		_, errs := h.verifySnippet(r.Context(), code, query.Get("dialect"), query.Get("markup") == "true")
+		status(len(errs) == 0)
+	case query.Get("hash") != "":
+		verified, found := h.badges.lookup(strings.ToLower(query.Get("hash")))
+		if !found {
+			// the snippet may be verified later, so don't let caches keep this
+			message, color, cacheControl = "unknown", "lightgrey", "no-cache"
+			break
+		}
+		status(verified)
+	}
+
+	w.Header().Set("Content-Type", "image/svg+xml; charset=utf-8")
+	w.Header().Set("Cache-Control", cacheControl)
+	w.WriteHeader(http.StatusOK)
+	w.Write([]byte(badge.Render(label, message, color, query.Get("style"))))
+}
@@ -0,0 +1,48 @@
+package emojiscriptapi
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+
+	"emojiscript-backend/pkg/apikey"
+	"emojiscript-backend/pkg/canary"
+	"emojiscript-backend/pkg/metrics"
+)
+
+// TestCanary checks that the handler picks each transpile's pipeline by
+// its route and API key
+func TestCanary(t *testing.T) {
+	router, _ := canary.New(canary.Config{Keys: map[string]float64{"alice": 100}})
+	keys, _ := apikey.Parse("alice:a1,bob:b1")
+	api := NewHandler(Options{Prefix: DefaultPrefix, Canary: router, APIKeys: keys})
+	for i, key := range []string{"", "b1", "a1", "a1"} {
+		body := `{"code": "📝(` + strconv.Itoa(i) + `)"}`
+		req := httptest.NewRequest("POST", DefaultPrefix+"/transpile", strings.NewReader(body))
+		req.Header.Set(apikey.Header, key)
+		rec := httptest.NewRecorder()
+		api.ServeHTTP(rec, req)
+		if rec.Code != http.StatusOK || !strings.Contains(rec.Body.String(), "console.log("+strconv.Itoa(i)+")") {
+			t.Fatalf("key %q: got %d %s", key, rec.Code, rec.Body)
+		}
+	}
+
+	rec := httptest.NewRecorder()
+	api.ServeHTTP(rec, httptest.NewRequest("GET", DefaultPrefix+"/metrics?format=json", nil))
+	var summary struct{ Pipelines []metrics.PipelineCount }
+	if err := json.Unmarshal(rec.Body.Bytes(), &summary); err != nil {
+		t.Fatal(err)
+	}
+	counts := map[string]int64{}
+	for _, p := range summary.Pipelines {
+		if !p.Fallback {
+			counts[p.Pipeline] += p.Count
+		}
+	}
+	if counts[canary.Tree] != 2 || counts[canary.Replacer] != 2 {
+		t.Errorf("got pipelines %+v, want two transpiles on each", summary.Pipelines)
+	}
+}
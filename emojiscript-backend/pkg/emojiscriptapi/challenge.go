@@ -0,0 +1,214 @@
+package emojiscriptapi
+
+import (
+	"encoding/json"
+	"fmt"
+	"math/rand"
+	"net/http"
+	"strings"
+	"time"
+
+	"emojiscript-backend/pkg/sandbox"
+)
+
+// Challenge is a small exercise graded by its tests. Each test's input is
+// fed to the program as stdin, so challenges read what they work on with 🎤.
+type Challenge struct {
+	ID          string `json:"id"`
+	Title       string `json:"title"`
+	Description string `json:"description"`
+	StarterCode string `json:"starterCode"`
+	Syntax      string `json:"syntax"`
+	Difficulty  string `json:"difficulty"`
+	// Tests grade a submission; the hidden ones never leave the server
+	Tests []GradeTest `json:"-"`
+	// Solution passes every test, which CheckChallenges confirms
+	Solution string `json:"-"`
+}
+
+type ChallengeResponse struct {
+	Date      string    `json:"date"`
+	Challenge Challenge `json:"challenge"`
+	// Examples are the visible tests, input and expected output included
+	Examples    []GradeTest `json:"examples"`
+	HiddenTests int         `json:"hiddenTests"`
+}
+
+var challenges = []Challenge{
+	{
+		ID: "add-two", Title: "Add Two Numbers", Syntax: "emoji", Difficulty: "beginner",
+		Description: "Read two numbers, one per line, and print their sum.",
+		StarterCode: "📦 a = Number(🎤())\n📦 b = Number(🎤())\n📝(a)",
+		Solution:    "📦 a = Number(🎤())\n📦 b = Number(🎤())\n📝(a ➕ b)",
+		Tests: []GradeTest{
+			{Name: "small numbers", Input: "2\n3", ExpectedOutput: "5"},
+			{Input: "10\n-4", ExpectedOutput: "6", Hidden: true},
+			{Input: "0\n0", ExpectedOutput: "0", Hidden: true},
+		},
+	},
+	{
+		ID: "greeting", Title: "Greeting", Syntax: "emoji", Difficulty: "beginner",
+		Description: "Read a name and print \"Hello, <name>!\".",
+		StarterCode: "📦 name = 🎤()\n📝(\"Hello\")",
+		Solution:    "📦 name = 🎤()\n📝(\"Hello, \" ➕ name ➕ \"!\")",
+		Tests: []GradeTest{
+			{Name: "a name", Input: "Ada", ExpectedOutput: "Hello, Ada!"},
+			{Input: "Grace Hopper", ExpectedOutput: "Hello, Grace Hopper!", Hidden: true},
+		},
+	},
+	{
+		ID: "countdown", Title: "Countdown", Syntax: "emoji", Difficulty: "beginner",
+		Description: "Read a number n and count down from n to 1, one number per line, then print \"Liftoff!\".",
+		StarterCode: "🔢 n = Number(🎤())\n🔄 (n ⬆️ 0) {\n  📝(n)\n}",
+		Solution:    "🔢 n = Number(🎤())\n🔄 (n ⬆️ 0) {\n  📝(n)\n  n➖➖\n}\n📝(\"Liftoff!\")",
+		Tests: []GradeTest{
+			{Name: "from three", Input: "3", ExpectedOutput: "3\n2\n1\nLiftoff!"},
+			{Input: "1", ExpectedOutput: "1\nLiftoff!", Hidden: true},
+			{Input: "0", ExpectedOutput: "Liftoff!", Hidden: true},
+		},
+	},
+	{
+		ID: "fizzbuzz", Title: "FizzBuzz", Syntax: "emoji", Difficulty: "intermediate",
+		Description: "Read a number n and print 1 to n, but Fizz for multiples of 3, Buzz for multiples of 5 and FizzBuzz for both.",
+		StarterCode: "📦 n = Number(🎤())\n🔁 (🔢 i = 1; i 📉 n; i➕➕) {\n  📝(i)\n}",
+		Solution:    "📦 n = Number(🎤())\n🔁 (🔢 i = 1; i 📉 n; i➕➕) {\n  ❓ (i 🍰 15 🟰 0) {\n    📝(\"FizzBuzz\")\n  } ❌ ❓ (i 🍰 3 🟰 0) {\n    📝(\"Fizz\")\n  } ❌ ❓ (i 🍰 5 🟰 0) {\n    📝(\"Buzz\")\n  } ❌ {\n    📝(i)\n  }\n}",
+		Tests: []GradeTest{
+			{Name: "up to five", Input: "5", ExpectedOutput: "1\n2\nFizz\n4\nBuzz"},
+			{Input: "15", ExpectedOutput: "1\n2\nFizz\n4\nBuzz\nFizz\n7\n8\nFizz\nBuzz\n11\nFizz\n13\n14\nFizzBuzz", Hidden: true},
+		},
+	},
+	{
+		ID: "reverse-word", Title: "Reverse a Word", Syntax: "emoji", Difficulty: "intermediate",
+		Description: "Read a word and print it backwards.",
+		StarterCode: "📦 word = 🎤()\n🔢 reversed = \"\"\n📝(reversed)",
+		Solution:    "📦 word = 🎤()\n🔢 reversed = \"\"\n🔁 (🔢 i = word.length ➖ 1; i 📈 0; i➖➖) {\n  reversed ➕🟰 word[i]\n}\n📝(reversed)",
+		Tests: []GradeTest{
+			{Name: "emoji", Input: "emoji", ExpectedOutput: "ijome"},
+			{Input: "racecar", ExpectedOutput: "racecar", Hidden: true},
+			{Input: "ab", ExpectedOutput: "ba", Hidden: true},
+		},
+	},
+	{
+		ID: "count-vowels", Title: "Count the Vowels", Syntax: "emoji", Difficulty: "intermediate",
+		Description: "Read a line of lowercase text and print how many vowels (a, e, i, o, u) it has.",
+		StarterCode: "📦 text = 🎤()\n🔢 count = 0\n📝(count)",
+		Solution:    "📦 text = 🎤()\n🔢 count = 0\n🔁 (🔢 i = 0; i ⬇️ text.length; i➕➕) {\n  ❓ (\"aeiou\".includes(text[i])) {\n    count➕➕\n  }\n}\n📝(count)",
+		Tests: []GradeTest{
+			{Name: "hello world", Input: "hello world", ExpectedOutput: "3"},
+			{Input: "aeiou", ExpectedOutput: "5", Hidden: true},
+			{Input: "rhythm", ExpectedOutput: "0", Hidden: true},
+		},
+	},
+	{
+		ID: "largest", Title: "Largest Number", Syntax: "emoji", Difficulty: "advanced",
+		Description: "Read a line of numbers separated by spaces and print the largest.",
+		StarterCode: "📦 nums = 🎤().split(\" \").map(Number)\n📝(nums[0])",
+		Solution:    "📦 nums = 🎤().split(\" \").map(Number)\n📝(nums.reduce((a, b) ➡️ a ⬆️ b ? a : b))",
+		Tests: []GradeTest{
+			{Name: "three numbers", Input: "3 9 2", ExpectedOutput: "9"},
+			{Input: "-5 -2 -9", ExpectedOutput: "-2", Hidden: true},
+			{Input: "7", ExpectedOutput: "7", Hidden: true},
+		},
+	},
+}
+
+// challengeEpoch is the first day with a daily challenge
+var challengeEpoch = time.Date(2024, time.January, 1, 0, 0, 0, 0, time.UTC)
+
+// DailyChallenge picks the challenge for date's UTC day. The days are
+// dealt in rounds of one shuffle of the catalog, seeded by the round, so
+// everyone sees the same challenge on a given day and none repeats within
+// a round.
+func DailyChallenge(date time.Time) Challenge {
+	y, m, d := date.UTC().Date()
+	day := int64(time.Date(y, m, d, 0, 0, 0, 0, time.UTC).Sub(challengeEpoch).Hours() / 24)
+	n := int64(len(challenges))
+	round, index := day/n, day%n
+	if index < 0 {
+		round, index = round-1, index+n
+	}
+	return challenges[rand.New(rand.NewSource(round)).Perm(len(challenges))[index]]
+}
+
+func challengeByID(id string) (Challenge, bool) {
+	for _, challenge := range challenges {
+		if challenge.ID == id {
+			return challenge, true
+		}
+	}
+	return Challenge{}, false
+}
+
+// CheckChallenges grades each challenge's solution against its tests and
+// describes every one that doesn't pass them all
+func CheckChallenges() []string {
+	var problems []string
+	for _, challenge := range challenges {
+		output, errs := compileExample(Example{Code: challenge.Solution, Syntax: challenge.Syntax})
+		if len(errs) > 0 {
+			problems = append(problems, fmt.Sprintf("challenge %q's solution doesn't transpile: %s", challenge.ID, strings.Join(errs, "; ")))
+			continue
+		}
+		for i, test := range challenge.Tests {
+			result := sandbox.Run(output, sandbox.Options{Stdin: test.Input})
+			actual := strings.Join(result.Stdout, "\n")
+			switch {
+			case result.Error != "":
+				problems = append(problems, fmt.Sprintf("challenge %q's solution fails test %d: %s", challenge.ID, i+1, result.Error))
+			case normalizeOutput(actual) != normalizeOutput(test.ExpectedOutput):
+				problems = append(problems, fmt.Sprintf("challenge %q's solution prints %q for test %d, not %q", challenge.ID, actual, i+1, test.ExpectedOutput))
+			}
+		}
+	}
+	return problems
+}
+
+// handleChallengeToday returns today's challenge, or an earlier day's with
+// ?date=YYYY-MM-DD, with its visible tests as examples
+func (h *handler) handleChallengeToday(w http.ResponseWriter, r *http.Request) {
+	date := time.Now().UTC()
+	if param := r.URL.Query().Get("date"); param != "" {
+		parsed, err := time.Parse(time.DateOnly, param)
+		if err != nil {
+			writeJSON(w, http.StatusBadRequest, errorBody{Error: "date must be YYYY-MM-DD"})
+			return
+		}
+		if parsed.After(date) {
+			writeJSON(w, http.StatusBadRequest, errorBody{Error: "date can't be in the future"})
+			return
+		}
+		date = parsed
+	}
+
+	challenge := DailyChallenge(date)
+	resp := ChallengeResponse{Date: date.Format(time.DateOnly), Challenge: challenge, Examples: []GradeTest{}}
+	for _, test := range challenge.Tests {
+		if test.Hidden {
+			resp.HiddenTests++
+		} else {
+			resp.Examples = append(resp.Examples, test)
+		}
+	}
+	writeJSON(w, http.StatusOK, resp)
+}
+
+// handleChallengeGrade grades a submission against all of a challenge's
+// tests, hidden ones included
+func (h *handler) handleChallengeGrade(w http.ResponseWriter, r *http.Request) {
+	challenge, ok := challengeByID(r.PathValue("id"))
+	if !ok {
+		writeJSON(w, http.StatusNotFound, errorBody{Error: "challenge not found"})
+		return
+	}
+	var req GradeRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeJSON(w, http.StatusBadRequest, GradeResponse{Errors: []string{"Invalid request"}})
+		return
+	}
+	if err := h.svc.ValidateInput(req.Code); err != nil {
+		writeJSON(w, http.StatusBadRequest, GradeResponse{Errors: []string{err.Error()}})
+		return
+	}
+	status, resp := h.grade(r.Context(), req, challenge.Tests)
+	writeJSON(w, status, resp)
+}
@@ -0,0 +1,59 @@
+package emojiscriptapi
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+
+	"emojiscript-backend/pkg/badge"
+	"emojiscript-backend/pkg/service"
+	"emojiscript-backend/pkg/spec"
+)
+
+// Conformance runs the conformance suite (see package spec) against svc,
+// in the target languages it generates. Requests are made with privacy
+// mode strict, as SelfTest's are.
+func Conformance(svc *service.Service) spec.Report {
+	return spec.Run(spec.Func(func(input, syntax, targetLanguage string) (string, error) {
+		resp, err := svc.Transpile(service.TranspileRequest{
+			Code:           input,
+			Syntax:         syntax,
+			TargetLanguage: targetLanguage,
+			Privacy:        service.PrivacyStrict,
+		}, service.Caller{})
+		if err != nil && len(resp.Errors) > 0 {
+			return "", fmt.Errorf("%s", strings.Join(resp.Errors, "; "))
+		}
+		return resp.Output, err
+	}), service.Targets()...)
+}
+
+// handleConformance reports this server's results on the conformance
+// suite. They can't change while it runs, so the suite runs once.
+func (h *handler) handleConformance(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Cache-Control", "public, max-age=3600")
+	writeJSON(w, http.StatusOK, h.conformance())
+}
+
+// handleConformanceBadge renders the share of the conformance suite this
+// server passes as an SVG badge
+func (h *handler) handleConformanceBadge(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	label := query.Get("label")
+	if !query.Has("label") {
+		label = "conformance"
+	}
+	report := h.conformance()
+	color := "brightgreen"
+	switch {
+	case !report.Passed && report.Score >= 0.9:
+		color = "yellow"
+	case !report.Passed:
+		color = "red"
+	}
+
+	w.Header().Set("Content-Type", "image/svg+xml; charset=utf-8")
+	w.Header().Set("Cache-Control", "public, max-age=3600")
+	w.WriteHeader(http.StatusOK)
+	w.Write([]byte(badge.Render(label, fmt.Sprintf("%d%%", int(report.Score*100)), color, query.Get("style"))))
+}
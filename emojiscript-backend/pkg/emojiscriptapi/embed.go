@@ -0,0 +1,155 @@
+package emojiscriptapi
+
+import (
+	"bytes"
+	"html/template"
+	"net/http"
+	"regexp"
+	"strings"
+
+	"emojiscript-backend/pkg/degrade"
+)
+
+// embedThemes are the viewer's color schemes; auto follows the reader's
+// system setting
+var embedThemes = map[string]bool{"light": true, "dark": true, "auto": true}
+
+var hexColor = regexp.MustCompile(`^[0-9a-fA-F]{3}([0-9a-fA-F]{3})?$`)
+
+// embedPage is the data the viewer template renders
+type embedPage struct {
+	Snippet  Snippet
+	Output   string
+	Errors   []string
+	Theme    string
+	Accent   string
+	RunURL   string
+	Markup   bool
+	Language string
+	// PageURL and PreviewURL are absolute, for the Open Graph tags
+	PageURL    string
+	PreviewURL string
+}
+
+// handleEmbed serves a read-only viewer for a snippet, meant for an
+// iframe: its source, the JavaScript it transpiles to and a button that
+// runs it through /run. ?theme= is light (default), dark or auto, and
+// ?accent= a hex color without the '#'; unknown values fall back to the
+// defaults so a typo never breaks a page the viewer is embedded in.
+func (h *handler) handleEmbed(w http.ResponseWriter, r *http.Request) {
+	snippet, found := h.snippets.get(r.Context(), r.PathValue("id"))
+	if !found {
+		w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+		if h.svc.Health().Degraded(degrade.Snippets) {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			w.Write([]byte("Saved snippets are unavailable right now; try again shortly"))
+			return
+		}
+		w.WriteHeader(http.StatusNotFound)
+		w.Write([]byte("Snippet not found"))
+		return
+	}
+
+	query := r.URL.Query()
+	page := embedPage{Snippet: snippet, Theme: "light", Accent: "#7c3aed", RunURL: h.opts.Prefix + "/run", Language: "EmojiScript"}
+	if theme := strings.ToLower(query.Get("theme")); embedThemes[theme] {
+		page.Theme = theme
+	}
+	if accent := query.Get("accent"); hexColor.MatchString(accent) {
+		page.Accent = "#" + accent
+	}
+	if snippet.UseMarkup {
+		page.Language = "EmojiScript markup"
+	}
+	page.PageURL = absoluteURL(r, r.URL.RequestURI())
+	page.PreviewURL = absoluteURL(r, h.opts.Prefix+"/snippets/"+snippet.ID+"/preview")
+	if page.Theme == "dark" {
+		page.PreviewURL += "?theme=dark"
+	}
+	page.Output, _, page.Errors = h.compileJavaScript(r.Context(), snippet.Code, snippet.Dialect, snippet.UseMarkup)
+
+	var body bytes.Buffer
+	if err := embedTemplate.Execute(&body, page); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	// the viewer may be framed anywhere, but only talks to this API
+	w.Header().Set("Content-Security-Policy", "default-src 'none'; style-src 'unsafe-inline'; script-src 'unsafe-inline'; connect-src 'self'; frame-ancestors *")
+	w.Header().Set("Cache-Control", "public, max-age=300")
+	w.WriteHeader(http.StatusOK)
+	w.Write(body.Bytes())
+}
+
+var embedTemplate = template.Must(template.New("embed").Parse(`<!DOCTYPE html>
+<html lang="en" data-theme="{{.Theme}}">
+<head>
+<meta charset="utf-8">
+<meta name="viewport" content="width=device-width, initial-scale=1">
+<title>EmojiScript snippet {{.Snippet.ID}}</title>
+<meta property="og:type" content="website">
+<meta property="og:title" content="EmojiScript snippet {{.Snippet.ID}}">
+<meta property="og:description" content="{{.Language}} · open it to run it in the browser">
+<meta property="og:url" content="{{.PageURL}}">
+<meta property="og:image" content="{{.PreviewURL}}">
+<meta property="og:image:width" content="1200">
+<meta property="og:image:height" content="630">
+<meta name="twitter:card" content="summary_large_image">
+<meta name="twitter:image" content="{{.PreviewURL}}">
+<style>
+:root { --bg: #ffffff; --fg: #1f2328; --muted: #656d76; --panel: #f6f8fa; --border: #d0d7de; --error: #cf222e; --accent: {{.Accent}}; }
+[data-theme="dark"] { --bg: #0d1117; --fg: #e6edf3; --muted: #8d96a0; --panel: #161b22; --border: #30363d; --error: #f85149; }
+@media (prefers-color-scheme: dark) {
+  [data-theme="auto"] { --bg: #0d1117; --fg: #e6edf3; --muted: #8d96a0; --panel: #161b22; --border: #30363d; --error: #f85149; }
+}
+* { box-sizing: border-box; }
+body { margin: 0; background: var(--bg); color: var(--fg); font: 14px/1.5 system-ui, sans-serif; }
+header { display: flex; align-items: center; justify-content: space-between; padding: 8px 12px; border-bottom: 1px solid var(--border); }
+header span { color: var(--muted); font-size: 12px; }
+button { background: var(--accent); color: #fff; border: 0; border-radius: 6px; padding: 4px 14px; font: inherit; cursor: pointer; }
+button:disabled { opacity: .6; cursor: wait; }
+.panes { display: grid; grid-template-columns: repeat(auto-fit, minmax(260px, 1fr)); }
+section { border-bottom: 1px solid var(--border); min-width: 0; }
+h2 { margin: 0; padding: 6px 12px; font-size: 12px; font-weight: 600; color: var(--muted); text-transform: uppercase; letter-spacing: .04em; }
+pre { margin: 0; padding: 8px 12px 12px; background: var(--panel); overflow: auto; font: 13px/1.5 ui-monospace, SFMono-Regular, Menlo, monospace; white-space: pre; }
+.error { color: var(--error); }
+</style>
+</head>
+<body>
+<header>
+<span>{{.Language}}{{with .Snippet.Dialect}} · {{.}}{{end}}</span>
+<button id="run" type="button">▶ Run</button>
+</header>
+<div class="panes">
+<section><h2>Source</h2><pre>{{.Snippet.Code}}</pre></section>
+<section><h2>JavaScript</h2>{{if .Errors}}<pre class="error">{{range .Errors}}{{.}}
+{{end}}</pre>{{else}}<pre>{{.Output}}</pre>{{end}}</section>
+</div>
+<section id="result" hidden><h2>Output</h2><pre id="stdout"></pre></section>
+<script>
+const snippet = {code: {{.Snippet.Code}}, useMarkup: {{.Snippet.UseMarkup}}, dialect: {{.Snippet.Dialect}}};
+const button = document.getElementById("run");
+const stdout = document.getElementById("stdout");
+button.addEventListener("click", async () => {
+  button.disabled = true;
+  document.getElementById("result").hidden = false;
+  stdout.className = "";
+  stdout.textContent = "Running…";
+  try {
+    const response = await fetch({{.RunURL}}, {method: "POST", headers: {"Content-Type": "application/json"}, body: JSON.stringify(snippet)});
+    const result = await response.json();
+    const lines = result.stdout || [];
+    const error = result.error || (result.errors || []).join("\n");
+    stdout.textContent = lines.concat(error ? [error] : []).join("\n") || "(no output)";
+    stdout.className = error ? "error" : "";
+  } catch (err) {
+    stdout.textContent = "Could not run the snippet: " + err.message;
+    stdout.className = "error";
+  } finally {
+    button.disabled = false;
+  }
+});
+</script>
+</body>
+</html>
+`))
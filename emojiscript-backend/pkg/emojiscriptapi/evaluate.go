@@ -0,0 +1,78 @@
+package emojiscriptapi
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+
+	"emojiscript-backend/pkg/hints"
+	"emojiscript-backend/pkg/sandbox"
+	"emojiscript-backend/pkg/service"
+	"emojiscript-backend/pkg/usage"
+)
+
+type EvaluateRequest struct {
+	Code      string `json:"code"`
+	UseMarkup bool   `json:"useMarkup,omitempty"`
+	Dialect   string `json:"dialect,omitempty"`
+	// Stdin is fed to the program, one prompt() per line
+	Stdin string `json:"stdin,omitempty"`
+}
+
+type EvaluateResponse struct {
+	Success    bool   `json:"success"`
+	JavaScript string `json:"javascript,omitempty"`
+	// SourceLines is set when the values' lines are the program's own, as
+	// for emoji syntax, which transpiles line for line; otherwise they are
+	// lines of javascript
+	SourceLines bool                `json:"sourceLines"`
+	Values      []sandbox.LineValue `json:"values"`
+	Stdout      []string            `json:"stdout"`
+	Error       string              `json:"error,omitempty"`
+	ErrorLine   int                 `json:"errorLine,omitempty"`
+	Limit       string              `json:"limit,omitempty"`
+	Errors      []string            `json:"errors,omitempty"`
+	Warnings    []string            `json:"warnings,omitempty"`
+	Hints       []hints.Hint        `json:"hints,omitempty"`
+}
+
+// handleEvaluate runs the program in the sandbox like /run and reports
+// what each top-level statement evaluated to or printed, by line, so an
+// editor can show the results inline the way a notebook does
+func (h *handler) handleEvaluate(w http.ResponseWriter, r *http.Request) {
+	var req EvaluateRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeJSON(w, http.StatusBadRequest, EvaluateResponse{Values: []sandbox.LineValue{}, Stdout: []string{}, Errors: []string{"Invalid request"}})
+		return
+	}
+	if err := h.svc.ValidateInput(req.Code); err != nil {
+		writeJSON(w, http.StatusBadRequest, EvaluateResponse{Values: []sandbox.LineValue{}, Stdout: []string{}, Errors: []string{err.Error()}, Hints: hints.For([]string{err.Error()}, req.Code)})
+		return
+	}
+
+	output, warnings, errs := h.compileJavaScript(r.Context(), req.Code, req.Dialect, req.UseMarkup)
+	if len(errs) > 0 {
+		writeJSON(w, http.StatusBadRequest, EvaluateResponse{Values: []sandbox.LineValue{}, Stdout: []string{}, Errors: errs, Warnings: warnings, Hints: hints.For(errs, req.Code)})
+		return
+	}
+
+	result := sandbox.Run(output, sandbox.Options{Stdin: req.Stdin, Values: true})
+	usage.FromContext(r.Context()).Sandboxed(result.Duration)
+	values := result.Values
+	if values == nil {
+		values = []sandbox.LineValue{}
+	}
+	markup := req.UseMarkup || service.DetectMarkupSyntax(req.Code)
+	writeJSON(w, http.StatusOK, EvaluateResponse{
+		Success:     result.Error == "",
+		JavaScript:  output,
+		SourceLines: !markup && strings.Count(output, "\n") == strings.Count(req.Code, "\n"),
+		Values:      values,
+		Stdout:      result.Stdout,
+		Error:       result.Error,
+		ErrorLine:   result.ErrorLine,
+		Limit:       result.Limit,
+		Warnings:    warnings,
+		Hints:       runtimeHints(result, req.Code),
+	})
+}
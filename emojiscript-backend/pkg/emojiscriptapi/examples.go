@@ -0,0 +1,303 @@
+package emojiscriptapi
+
+import (
+	"cmp"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"slices"
+	"strings"
+
+	"emojiscript-backend/pkg/dialect"
+	"emojiscript-backend/pkg/requestid"
+	"emojiscript-backend/pkg/sandbox"
+	"emojiscript-backend/pkg/storage"
+	"emojiscript-backend/pkg/transpiler"
+)
+
+// Examples returns the built-in sample programs for a syntax ("emoji" or
+// "markup"), defaulting to emoji
+func Examples(syntax string) []Example {
+	if syntax == "markup" {
+		return markupExamples
+	}
+	return emojiExamples
+}
+
+// exampleStore serves the examples from the handler's Storage, which is
+// seeded with the built-in ones while it holds none, so a deployment can
+// add or replace examples by importing an archive. Without Storage, or
+// while it fails, the built-in examples are served.
+type exampleStore struct {
+	storage storage.Store
+}
+
+// exampleKey stores an example by syntax, its ID naming it only among
+// those of its syntax
+func exampleKey(example Example) string {
+	return example.Syntax + "/" + example.ID
+}
+
+// seed stores the built-in examples when the store has no examples yet
+func (s *exampleStore) seed(ctx context.Context) error {
+	records, err := s.storage.List(ctx, storage.Examples)
+	if err != nil || len(records) > 0 {
+		return err
+	}
+	for _, example := range slices.Concat(emojiExamples, markupExamples) {
+		if err := s.put(ctx, example); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *exampleStore) put(ctx context.Context, example Example) error {
+	value, _ := json.Marshal(example)
+	return s.storage.Put(ctx, storage.Examples, exampleKey(example), value, 0)
+}
+
+// list returns a syntax's examples by order
+func (s *exampleStore) list(ctx context.Context, syntax string) []Example {
+	if syntax != "markup" {
+		syntax = "emoji"
+	}
+	if s.storage == nil {
+		return Examples(syntax)
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, storage.Timeout)
+	defer cancel()
+	records, err := s.storage.List(ctx, storage.Examples)
+	if err != nil {
+		requestid.Printf(ctx, "examples: %v", err)
+		return Examples(syntax)
+	}
+	var examples []Example
+	for _, record := range records {
+		var example Example
+		if json.Unmarshal(record.Value, &example) == nil && example.Syntax == syntax {
+			examples = append(examples, example)
+		}
+	}
+	if len(examples) == 0 {
+		return Examples(syntax)
+	}
+	slices.SortStableFunc(examples, func(a, b Example) int {
+		return cmp.Or(cmp.Compare(a.Order, b.Order), strings.Compare(a.ID, b.ID))
+	})
+	return examples
+}
+
+// has reports whether the store holds an example with example's syntax
+// and ID
+func (s *exampleStore) has(ctx context.Context, example Example) (bool, error) {
+	ctx, cancel := context.WithTimeout(ctx, storage.Timeout)
+	defer cancel()
+	_, found, err := s.storage.Get(ctx, storage.Examples, exampleKey(example))
+	return found, err
+}
+
+// DialectExamples rewrites examples' emoji into a dialect's with the
+// formatter, so the examples a tenant using the dialect is shown are code
+// it can paste back. A nil pack leaves them as they are.
+func DialectExamples(examples []Example, pack *dialect.Pack) []Example {
+	if pack == nil {
+		return examples
+	}
+	aliases := pack.FromBase()
+	converted := make([]Example, len(examples))
+	for i, example := range examples {
+		example.Code = transpiler.Format(example.Code, transpiler.FormatOptions{Aliases: aliases})
+		converted[i] = example
+	}
+	return converted
+}
+
+// queryDialect resolves the pack a GET request names in ?dialect=,
+// answering 400 for one that isn't installed
+func (h *handler) queryDialect(w http.ResponseWriter, r *http.Request) (*dialect.Pack, bool) {
+	name := r.URL.Query().Get("dialect")
+	pack, found := h.svc.ResolveDialect(name)
+	if !found {
+		writeJSON(w, http.StatusBadRequest, errorBody{Error: "Unknown dialect '" + name + "'"})
+	}
+	return pack, found
+}
+
+// exampleDifficulties are the difficulties an example can have, easiest
+// first
+var exampleDifficulties = []string{"beginner", "intermediate", "advanced"}
+
+// ExamplePath returns a syntax's built-in examples in the order to learn
+// them (see examplePath)
+func ExamplePath(syntax string) []Example {
+	return examplePath(Examples(syntax))
+}
+
+// examplePath orders examples to learn them: each after its
+// prerequisites, and otherwise by order. A prerequisite that names no
+// example is ignored, and examples caught in a cycle of prerequisites are
+// left out.
+func examplePath(examples []Example) []Example {
+	waiting := map[string]int{}
+	unlocks := map[string][]int{}
+	for i, example := range examples {
+		for _, id := range example.Prerequisites {
+			if exampleIndex(examples, id) >= 0 {
+				waiting[example.ID]++
+				unlocks[id] = append(unlocks[id], i)
+			}
+		}
+	}
+
+	path := make([]Example, 0, len(examples))
+	done := make([]bool, len(examples))
+	for len(path) < len(examples) {
+		next := -1
+		for i, example := range examples {
+			if !done[i] && waiting[example.ID] == 0 && (next < 0 || example.Order < examples[next].Order) {
+				next = i
+			}
+		}
+		if next < 0 {
+			break
+		}
+		done[next] = true
+		path = append(path, examples[next])
+		for _, i := range unlocks[examples[next].ID] {
+			waiting[examples[i].ID]--
+		}
+	}
+	return path
+}
+
+// exampleIndex returns the index of the example with id, or -1
+func exampleIndex(examples []Example, id string) int {
+	for i, example := range examples {
+		if example.ID == id {
+			return i
+		}
+	}
+	return -1
+}
+
+func (h *handler) handleExamplePath(w http.ResponseWriter, r *http.Request) {
+	syntax := r.URL.Query().Get("syntax")
+	if syntax != "markup" {
+		syntax = "emoji"
+	}
+	pack, ok := h.queryDialect(w, r)
+	if !ok {
+		return
+	}
+	path := examplePath(h.examples.list(r.Context(), syntax))
+	writeJSON(w, http.StatusOK, map[string]interface{}{"syntax": syntax, "path": DialectExamples(path, pack)})
+}
+
+var emojiExamples = []Example{
+	{ID: "hello-world", Title: "Hello World", Description: "Print to console", Code: "📝(\"Hello, World!\")", Category: "basics", Syntax: "emoji", Order: 1, Difficulty: "beginner", Runnable: true, ExpectedOutput: "Hello, World!"},
+	{ID: "variables", Title: "Variables", Description: "Declare variables", Code: "📦 name = \"EmojiScript\"\n🔢 age = 25\n🔢 active = ✅", Category: "basics", Syntax: "emoji", Order: 2, Difficulty: "beginner", Prerequisites: []string{"hello-world"}, Runnable: true},
+	{ID: "if-else", Title: "If/Else", Description: "Conditional statement", Code: "📦 age = 20\n❓ (age ⬆️🟰 18) {\n  📝(\"Adult\")\n} ❌ {\n  📝(\"Minor\")\n}", Category: "control", Syntax: "emoji", Order: 3, Difficulty: "beginner", Prerequisites: []string{"variables"}, Runnable: true, ExpectedOutput: "Adult"},
+	{ID: "for-loop", Title: "For Loop", Description: "Loop through numbers", Code: "🔁 (🔢 i = 0; i ⬇️ 5; i➕➕) {\n  📝(i)\n}", Category: "loops", Syntax: "emoji", Order: 4, Difficulty: "beginner", Prerequisites: []string{"variables"}, Runnable: true, ExpectedOutput: "0\n1\n2\n3\n4"},
+	{ID: "while-loop", Title: "While Loop", Description: "Loop with condition", Code: "🔢 count = 0\n🔄 (count ⬇️ 3) {\n  📝(count)\n  count➕➕\n}", Category: "loops", Syntax: "emoji", Order: 5, Difficulty: "beginner", Prerequisites: []string{"for-loop"}, Runnable: true, ExpectedOutput: "0\n1\n2"},
+	{ID: "function", Title: "Function", Description: "Function with return", Code: "🎯 greet(name) {\n  🔙 \"Hello, \" ➕ name\n}\n📝(greet(\"World\"))", Category: "functions", Syntax: "emoji", Order: 6, Difficulty: "beginner", Prerequisites: []string{"variables"}, Runnable: true, ExpectedOutput: "Hello, World"},
+	{ID: "ask-a-name", Title: "Ask a Name", Description: "Read a line of input", Code: "📦 name = 🎤(\"What's your name? \")\n📝(\"Hello, \" ➕ name ➕ \"!\")", Category: "basics", Syntax: "emoji", Order: 7, Difficulty: "beginner", Prerequisites: []string{"variables"}},
+	{ID: "running-total", Title: "Running Total", Description: "Compound assignment", Code: "🔢 total = 0\n🔁 (🔢 i = 1; i ⬇️🟰 5; i➕➕) {\n  total ➕🟰 i\n}\n📝(total)", Category: "loops", Syntax: "emoji", Order: 8, Difficulty: "intermediate", Prerequisites: []string{"for-loop"}, Runnable: true, ExpectedOutput: "15"},
+	{ID: "arrow-function", Title: "Arrow Function", Description: "Arrow function", Code: "📦 add = (a, b) ➡️ a ➕ b\n📝(add(5, 3))", Category: "functions", Syntax: "emoji", Order: 9, Difficulty: "intermediate", Prerequisites: []string{"function"}, Runnable: true, ExpectedOutput: "8"},
+	{ID: "array-map", Title: "Array Map", Description: "Map over array", Code: "📦 nums = [1, 2, 3, 4, 5]\n📦 doubled = nums.map(n ➡️ n ✖️ 2)\n📝(doubled)", Category: "arrays", Syntax: "emoji", Order: 10, Difficulty: "intermediate", Prerequisites: []string{"arrow-function"}, Runnable: true, ExpectedOutput: "[ 2, 4, 6, 8, 10 ]"},
+	{ID: "array-filter", Title: "Array Filter", Description: "Filter array", Code: "📦 nums = [1, 2, 3, 4, 5]\n📦 evens = nums.filter(n ➡️ n 🍰 2 🟰🟰 0)\n📝(evens)", Category: "arrays", Syntax: "emoji", Order: 11, Difficulty: "intermediate", Prerequisites: []string{"array-map", "if-else"}, Runnable: true, ExpectedOutput: "[ 2, 4 ]"},
+	{ID: "current-time", Title: "Current Time", Description: "Print the date and time", Code: "📦 start = ⏰.now()\n📝(\"It is \" ➕ ⏰.format(start, \"HH:mm\") ➕ \" on \" ➕ ⏰.format(start, \"DD/MM/YYYY\"))", Category: "basics", Syntax: "emoji", Order: 12, Difficulty: "intermediate", Prerequisites: []string{"variables"}, Runnable: true},
+	{ID: "json", Title: "JSON", Description: "Turn data into JSON text and back", Code: "📦 pet = { name: \"Rex\", tricks: [\"sit\", \"roll\"] }\n📦 text = 🧾(pet)\n📝(text)\n📦 copy = 📂(text)\n📝(copy.tricks.length)", Category: "arrays", Syntax: "emoji", Order: 13, Difficulty: "intermediate", Prerequisites: []string{"variables"}, Runnable: true, ExpectedOutput: "{\"name\":\"Rex\",\"tricks\":[\"sit\",\"roll\"]}\n2"},
+	{ID: "class", Title: "Class", Description: "Create a class", Code: "🔐 Person {\n  🔧(name) {\n    🎭.name = name\n  }\n  greet() {\n    🔙 \"Hi, \" ➕ 🎭.name\n  }\n}\n📦 p = 🎁 Person(\"Alice\")\n📝(p.greet())", Category: "classes", Syntax: "emoji", Order: 14, Difficulty: "advanced", Prerequisites: []string{"function"}, Runnable: true, ExpectedOutput: "Hi, Alice"},
+	{ID: "async-function", Title: "Async Function", Description: "Async operation", Code: "⚡ 🎯 fetchData(url) {\n  📦 response = ⏳ 🌐(url)\n  🔙 response.json()\n}", Category: "async", Syntax: "emoji", Order: 15, Difficulty: "advanced", Prerequisites: []string{"function"}},
+}
+
+var markupExamples = []Example{
+	{ID: "hello-world", Title: "Hello World", Description: "Basic console output", Code: "<print>\"Hello, World!\"</print>", Category: "basics", Syntax: "markup", Order: 1, Difficulty: "beginner", Runnable: true, ExpectedOutput: "Hello, World!"},
+	{ID: "variables", Title: "Variables", Description: "Declare variables and constants", Code: "<const name=\"user\" value=\"'Alice'\"/>\n<let name=\"age\" value=\"25\"/>\n<let name=\"active\" value=\"true\"/>", Category: "basics", Syntax: "markup", Order: 2, Difficulty: "beginner", Prerequisites: []string{"hello-world"}, Runnable: true},
+	{ID: "if-else", Title: "If/Else", Description: "Conditional logic", Code: "<let name=\"age\" value=\"20\"/>\n<if condition=\"age >= 18\">\n  <print>\"Adult\"</print>\n</if>\n<else>\n  <print>\"Minor\"</print>\n</else>", Category: "control", Syntax: "markup", Order: 3, Difficulty: "beginner", Prerequisites: []string{"variables"}, Runnable: true, ExpectedOutput: "Adult"},
+	{ID: "for-loop", Title: "For Loop", Description: "Loop from 0 to 5", Code: "<loop var=\"i\" from=\"0\" to=\"5\">\n  <print>i</print>\n</loop>", Category: "loops", Syntax: "markup", Order: 4, Difficulty: "beginner", Prerequisites: []string{"variables"}, Runnable: true, ExpectedOutput: "0\n1\n2\n3\n4"},
+	{ID: "foreach-loop", Title: "ForEach Loop", Description: "Iterate over array", Code: "<const name=\"items\" value=\"['apple', 'banana', 'orange']\"/>\n<loop var=\"item\" in=\"items\">\n  <print>item</print>\n</loop>", Category: "loops", Syntax: "markup", Order: 5, Difficulty: "beginner", Prerequisites: []string{"for-loop"}, Runnable: true, ExpectedOutput: "apple\nbanana\norange"},
+	{ID: "while-loop", Title: "While Loop", Description: "Loop while condition is true", Code: "<let name=\"count\" value=\"0\"/>\n<while condition=\"count < 3\">\n  <print>count</print>\n  count++\n</while>", Category: "loops", Syntax: "markup", Order: 6, Difficulty: "beginner", Prerequisites: []string{"for-loop"}, Runnable: true, ExpectedOutput: "0\n1\n2"},
+	{ID: "function", Title: "Function", Description: "Function with parameters", Code: "<function name=\"greet\" params=\"name\">\n  <return>\"Hello, \" + name</return>\n</function>\n<print>greet(\"World\")</print>", Category: "functions", Syntax: "markup", Order: 7, Difficulty: "beginner", Prerequisites: []string{"variables"}, Runnable: true, ExpectedOutput: "Hello, World"},
+	{ID: "arrow-function", Title: "Arrow Function", Description: "Arrow function syntax", Code: "<const name=\"add\" value=\"(a, b) => a + b\"/>\n<print>add(5, 3)</print>", Category: "functions", Syntax: "markup", Order: 8, Difficulty: "intermediate", Prerequisites: []string{"function"}, Runnable: true, ExpectedOutput: "8"},
+	{ID: "array-map", Title: "Array Map", Description: "Transform array with map", Code: "<const name=\"nums\" value=\"[1, 2, 3, 4, 5]\"/>\n<const name=\"doubled\" value=\"nums.map(n => n * 2)\"/>\n<print>doubled</print>", Category: "arrays", Syntax: "markup", Order: 9, Difficulty: "intermediate", Prerequisites: []string{"arrow-function"}, Runnable: true, ExpectedOutput: "[ 2, 4, 6, 8, 10 ]"},
+	{ID: "array-filter", Title: "Array Filter", Description: "Filter array elements", Code: "<const name=\"nums\" value=\"[1, 2, 3, 4, 5]\"/>\n<const name=\"evens\" value=\"nums.filter(n => n % 2 === 0)\"/>\n<print>evens</print>", Category: "arrays", Syntax: "markup", Order: 10, Difficulty: "intermediate", Prerequisites: []string{"array-map", "if-else"}, Runnable: true, ExpectedOutput: "[ 2, 4 ]"},
+	{ID: "class", Title: "Class", Description: "Create a class with methods", Code: "<class name=\"Person\">\n  <method name=\"constructor\" params=\"name\">\n    this.name = name\n  </method>\n  <method name=\"greet\">\n    <return>\"Hi, \" + this.name</return>\n  </method>\n</class>\n<const name=\"p\" value=\"new Person('Alice')\"/>\n<print>p.greet()</print>", Category: "classes", Syntax: "markup", Order: 11, Difficulty: "advanced", Prerequisites: []string{"function"}, Runnable: true, ExpectedOutput: "Hi, Alice"},
+	{ID: "async-function", Title: "Async Function", Description: "Async/await pattern", Code: "<function name=\"fetchData\" params=\"url\" async=\"true\">\n  <const name=\"response\" value=\"await 🌐(url)\"/>\n  <return>response.json()</return>\n</function>", Category: "async", Syntax: "markup", Order: 12, Difficulty: "advanced", Prerequisites: []string{"function"}},
+}
+
+// CheckExamples transpiles every example and runs the runnable ones in
+// the sandbox, returning a problem for each that fails or prints other
+// than its expected output, and for learning path metadata that doesn't
+// hold together
+func CheckExamples() []string {
+	problems := checkExamplePaths()
+	for _, example := range append(Examples("emoji"), Examples("markup")...) {
+		name := fmt.Sprintf("%s example %q", example.Syntax, example.Title)
+		output, errs := compileExample(example)
+		if len(errs) > 0 {
+			problems = append(problems, fmt.Sprintf("%s doesn't transpile: %s", name, strings.Join(errs, "; ")))
+			continue
+		}
+		if !example.Runnable {
+			if example.ExpectedOutput != "" {
+				problems = append(problems, name+" has an expected output but isn't runnable")
+			}
+			continue
+		}
+		result := sandbox.Run(output, sandbox.Options{})
+		actual := strings.Join(result.Stdout, "\n")
+		switch {
+		case result.Error != "":
+			problems = append(problems, fmt.Sprintf("%s fails: %s", name, result.Error))
+		case example.ExpectedOutput != "" && normalizeOutput(actual) != normalizeOutput(example.ExpectedOutput):
+			problems = append(problems, fmt.Sprintf("%s prints %q, not %q", name, actual, example.ExpectedOutput))
+		}
+	}
+	return problems
+}
+
+// checkExamplePaths reports repeated IDs, unknown difficulties and
+// prerequisites, and examples a cycle of prerequisites keeps off the
+// learning path
+func checkExamplePaths() []string {
+	var problems []string
+	for _, syntax := range []string{"emoji", "markup"} {
+		examples := Examples(syntax)
+		for i, example := range examples {
+			name := fmt.Sprintf("%s example %q", syntax, example.Title)
+			if exampleIndex(examples, example.ID) != i {
+				problems = append(problems, fmt.Sprintf("%s repeats the ID %q", name, example.ID))
+			}
+			if !slices.Contains(exampleDifficulties, example.Difficulty) {
+				problems = append(problems, fmt.Sprintf("%s has difficulty %q, not one of %s", name, example.Difficulty, strings.Join(exampleDifficulties, ", ")))
+			}
+			for _, id := range example.Prerequisites {
+				if exampleIndex(examples, id) < 0 {
+					problems = append(problems, fmt.Sprintf("%s needs %q, which isn't an example", name, id))
+				}
+			}
+		}
+		if path := ExamplePath(syntax); len(path) < len(examples) {
+			problems = append(problems, fmt.Sprintf("%s examples: %d are left off the learning path by a cycle of prerequisites", syntax, len(examples)-len(path)))
+		}
+	}
+	return problems
+}
+
+// compileExample transpiles an example to JavaScript with the built-in
+// vocabulary
+func compileExample(example Example) (string, []string) {
+	t := transpiler.New(transpiler.Options{})
+	if example.Syntax == "markup" {
+		result, err := t.TranspileMarkup(example.Code, transpiler.MarkupOptions{})
+		if err != nil && len(result.Errors) == 0 {
+			return "", []string{err.Error()}
+		}
+		return result.Output, result.Errors
+	}
+	return t.TranspileEmoji(example.Code), t.CheckEmoji(example.Code)
+}
@@ -0,0 +1,92 @@
+package emojiscriptapi
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strings"
+	"time"
+
+	"emojiscript-backend/pkg/gist"
+)
+
+// gistTimeout bounds the call to GitHub
+const gistTimeout = 10 * time.Second
+
+type GistRequest struct {
+	// Public lists the gist on the user's profile; gists are secret
+	// (unlisted) by default
+	Public      bool   `json:"public,omitempty"`
+	Description string `json:"description,omitempty"`
+}
+
+type GistResponse struct {
+	Success bool   `json:"success"`
+	ID      string `json:"id"`
+	URL     string `json:"url"`
+	// Errors explains why the gist has no generated JavaScript
+	Errors []string `json:"errors,omitempty"`
+}
+
+// handleSnippetGist exports a snippet's source and the JavaScript it
+// transpiles to as a GitHub Gist. The caller authenticates with their own
+// GitHub OAuth token, with the gist scope, in the Authorization header;
+// the token is only passed on to GitHub. A snippet that doesn't
+// transpile is exported without its JavaScript.
+func (h *handler) handleSnippetGist(w http.ResponseWriter, r *http.Request) {
+	token := bearerToken(r)
+	if token == "" {
+		w.Header().Set("WWW-Authenticate", `Bearer realm="github"`)
+		writeJSON(w, http.StatusUnauthorized, errorBody{Error: "A GitHub token is required in the Authorization header"})
+		return
+	}
+	snippet, found := h.snippets.get(r.Context(), r.PathValue("id"))
+	if !found {
+		h.snippetMissing(w)
+		return
+	}
+	var req GistRequest
+	if r.ContentLength != 0 {
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			writeJSON(w, http.StatusBadRequest, errorBody{Error: "Invalid request"})
+			return
+		}
+	}
+
+	if req.Description == "" {
+		req.Description = snippetLanguage(snippet) + " snippet " + snippet.ID
+	}
+	source := "snippet-" + snippet.ID + ".emoji"
+	if snippet.UseMarkup {
+		source = "snippet-" + snippet.ID + ".emoji.xml"
+	}
+	files := map[string]string{source: snippet.Code}
+	output, _, errs := h.compileJavaScript(r.Context(), snippet.Code, snippet.Dialect, snippet.UseMarkup)
+	if len(errs) == 0 {
+		files["snippet-"+snippet.ID+".js"] = output
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), gistTimeout)
+	defer cancel()
+	created, err := h.gists.Create(ctx, token, gist.Gist{Description: req.Description, Public: req.Public, Files: files})
+	switch {
+	case errors.Is(err, gist.ErrUnauthorized):
+		writeJSON(w, http.StatusUnauthorized, errorBody{Error: err.Error()})
+		return
+	case err != nil:
+		writeJSON(w, http.StatusBadGateway, errorBody{Error: err.Error()})
+		return
+	}
+	writeJSON(w, http.StatusCreated, GistResponse{Success: true, ID: created.ID, URL: created.URL, Errors: errs})
+}
+
+// bearerToken reads the token from an "Authorization: Bearer" or
+// "Authorization: token" header, the two forms GitHub accepts
+func bearerToken(r *http.Request) string {
+	scheme, token, found := strings.Cut(r.Header.Get("Authorization"), " ")
+	if !found || (!strings.EqualFold(scheme, "bearer") && !strings.EqualFold(scheme, "token")) {
+		return ""
+	}
+	return strings.TrimSpace(token)
+}
@@ -0,0 +1,190 @@
+package emojiscriptapi
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"emojiscript-backend/pkg/hints"
+	"emojiscript-backend/pkg/sandbox"
+	"emojiscript-backend/pkg/usage"
+)
+
+// MaxGradeTests caps the tests a single /grade request may run
+const MaxGradeTests = 50
+
+type GradeTest struct {
+	Name string `json:"name,omitempty"`
+	// Input is fed to the program as stdin, one prompt() per line
+	Input          string `json:"input,omitempty"`
+	ExpectedOutput string `json:"expectedOutput"`
+	// Hidden tests only report whether they passed, so students can't
+	// read the answer off the response
+	Hidden bool `json:"hidden,omitempty"`
+}
+
+type GradeRequest struct {
+	Code      string `json:"code"`
+	UseMarkup bool   `json:"useMarkup,omitempty"`
+	Dialect   string `json:"dialect,omitempty"`
+	// ExpectedOutput is shorthand for a single visible test without input
+	ExpectedOutput *string     `json:"expectedOutput,omitempty"`
+	Tests          []GradeTest `json:"tests,omitempty"`
+}
+
+type GradeResult struct {
+	Name     string       `json:"name"`
+	Passed   bool         `json:"passed"`
+	Hidden   bool         `json:"hidden,omitempty"`
+	Expected string       `json:"expected,omitempty"`
+	Actual   string       `json:"actual,omitempty"`
+	Diff     []string     `json:"diff,omitempty"`
+	Error    string       `json:"error,omitempty"`
+	Limit    string       `json:"limit,omitempty"`
+	Hints    []hints.Hint `json:"hints,omitempty"`
+}
+
+type GradeResponse struct {
+	Success  bool          `json:"success"`
+	Passed   int           `json:"passed"`
+	Total    int           `json:"total"`
+	Results  []GradeResult `json:"results"`
+	Errors   []string      `json:"errors,omitempty"`
+	Warnings []string      `json:"warnings,omitempty"`
+	Hints    []hints.Hint  `json:"hints,omitempty"`
+}
+
+// handleGrade runs a student's program against each test's input and
+// compares what it printed with the expected output
+func (h *handler) handleGrade(w http.ResponseWriter, r *http.Request) {
+	var req GradeRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeJSON(w, http.StatusBadRequest, GradeResponse{Errors: []string{"Invalid request"}})
+		return
+	}
+	if err := h.svc.ValidateInput(req.Code); err != nil {
+		writeJSON(w, http.StatusBadRequest, GradeResponse{Errors: []string{err.Error()}})
+		return
+	}
+
+	tests := req.Tests
+	if req.ExpectedOutput != nil {
+		tests = append([]GradeTest{{ExpectedOutput: *req.ExpectedOutput}}, tests...)
+	}
+	if len(tests) == 0 {
+		writeJSON(w, http.StatusBadRequest, GradeResponse{Errors: []string{"expectedOutput or tests is required"}})
+		return
+	}
+	if len(tests) > MaxGradeTests {
+		writeJSON(w, http.StatusBadRequest, GradeResponse{Errors: []string{fmt.Sprintf("at most %d tests are allowed", MaxGradeTests)}})
+		return
+	}
+	status, resp := h.grade(r.Context(), req, tests)
+	writeJSON(w, status, resp)
+}
+
+// grade runs the request's program against each test, returning the
+// response with its status
+func (h *handler) grade(ctx context.Context, req GradeRequest, tests []GradeTest) (int, GradeResponse) {
+	output, warnings, errs := h.compileJavaScript(ctx, req.Code, req.Dialect, req.UseMarkup)
+	if len(errs) > 0 {
+		return http.StatusBadRequest, GradeResponse{Errors: errs, Warnings: warnings, Hints: hints.For(errs, req.Code)}
+	}
+
+	resp := GradeResponse{Success: true, Total: len(tests), Results: make([]GradeResult, len(tests)), Warnings: warnings}
+	for i, test := range tests {
+		result := sandbox.Run(output, sandbox.Options{Stdin: test.Input})
+		usage.FromContext(ctx).Sandboxed(result.Duration)
+		actual := strings.Join(result.Stdout, "\n")
+		matches := normalizeOutput(actual) == normalizeOutput(test.ExpectedOutput)
+		graded := GradeResult{
+			Name:   test.Name,
+			Hidden: test.Hidden,
+			Passed: result.Error == "" && matches,
+			Error:  result.Error,
+			Limit:  result.Limit,
+		}
+		if graded.Name == "" {
+			graded.Name = fmt.Sprintf("test %d", i+1)
+		}
+		if test.Hidden {
+			// the runtime error could echo the hidden input back
+			graded.Error = ""
+		} else {
+			graded.Hints = runtimeHints(result, req.Code)
+			graded.Expected = test.ExpectedOutput
+			graded.Actual = actual
+			if !matches {
+				graded.Diff = diffLines(normalizeOutput(test.ExpectedOutput), normalizeOutput(actual))
+			}
+		}
+		if graded.Passed {
+			resp.Passed++
+		}
+		resp.Results[i] = graded
+	}
+	return http.StatusOK, resp
+}
+
+// normalizeOutput ignores trailing whitespace and line ending style, which
+// students can't see in the playground
+func normalizeOutput(s string) string {
+	lines := strings.Split(strings.ReplaceAll(s, "\r\n", "\n"), "\n")
+	for i, line := range lines {
+		lines[i] = strings.TrimRight(line, " \t")
+	}
+	return strings.TrimRight(strings.Join(lines, "\n"), "\n")
+}
+
+// diffLines is a line diff of expected against actual: unchanged lines are
+// prefixed with "  ", missing ones with "- " and unexpected ones with "+ "
+func diffLines(expected, actual string) []string {
+	a, b := strings.Split(expected, "\n"), strings.Split(actual, "\n")
+	if len(a)*len(b) > 1000000 {
+		diff := make([]string, 0, len(a)+len(b))
+		for _, line := range a {
+			diff = append(diff, "- "+line)
+		}
+		for _, line := range b {
+			diff = append(diff, "+ "+line)
+		}
+		return diff
+	}
+
+	// lcs[i][j] is the longest common subsequence of a[i:] and b[j:]
+	lcs := make([][]int, len(a)+1)
+	for i := range lcs {
+		lcs[i] = make([]int, len(b)+1)
+	}
+	for i := len(a) - 1; i >= 0; i-- {
+		for j := len(b) - 1; j >= 0; j-- {
+			if a[i] == b[j] {
+				lcs[i][j] = lcs[i+1][j+1] + 1
+			} else if lcs[i+1][j] >= lcs[i][j+1] {
+				lcs[i][j] = lcs[i+1][j]
+			} else {
+				lcs[i][j] = lcs[i][j+1]
+			}
+		}
+	}
+
+	diff := []string{}
+	i, j := 0, 0
+	for i < len(a) || j < len(b) {
+		switch {
+		case i < len(a) && j < len(b) && a[i] == b[j]:
+			diff = append(diff, "  "+a[i])
+			i++
+			j++
+		case j == len(b) || i < len(a) && lcs[i+1][j] >= lcs[i][j+1]:
+			diff = append(diff, "- "+a[i])
+			i++
+		default:
+			diff = append(diff, "+ "+b[j])
+			j++
+		}
+	}
+	return diff
+}
@@ -0,0 +1,662 @@
+// Package emojiscriptapi exposes the EmojiScript HTTP API as a plain
+// net/http handler, so it can be mounted inside any Go server (std mux, chi,
+// echo, ...) or a serverless function.
+package emojiscriptapi
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"log"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"emojiscript-backend/pkg/apikey"
+	"emojiscript-backend/pkg/canary"
+	"emojiscript-backend/pkg/chaos"
+	"emojiscript-backend/pkg/cors"
+	"emojiscript-backend/pkg/coverage"
+	"emojiscript-backend/pkg/degrade"
+	"emojiscript-backend/pkg/dialect"
+	"emojiscript-backend/pkg/gist"
+	"emojiscript-backend/pkg/history"
+	"emojiscript-backend/pkg/idempotency"
+	"emojiscript-backend/pkg/jobs"
+	"emojiscript-backend/pkg/kvcache"
+	"emojiscript-backend/pkg/leaderboard"
+	"emojiscript-backend/pkg/metrics"
+	"emojiscript-backend/pkg/notebook"
+	"emojiscript-backend/pkg/ratelimit"
+	"emojiscript-backend/pkg/repl"
+	"emojiscript-backend/pkg/requestid"
+	"emojiscript-backend/pkg/scan"
+	"emojiscript-backend/pkg/service"
+	"emojiscript-backend/pkg/servicetoken"
+	"emojiscript-backend/pkg/spec"
+	"emojiscript-backend/pkg/storage"
+	"emojiscript-backend/pkg/usage"
+	"emojiscript-backend/pkg/workpool"
+)
+
+const (
+	DefaultPrefix            = "/api/v1"
+	DefaultMaxCodeLength     = service.DefaultMaxCodeLength
+	DefaultMaxCodeCharacters = service.DefaultMaxCodeCharacters
+	DefaultMaxOutputLength   = service.DefaultMaxOutputLength
+	DefaultComplexityBudget  = service.DefaultComplexityBudget
+	DefaultCacheSize         = service.DefaultCacheSize
+	DefaultCacheMaxBytes     = service.DefaultCacheMaxBytes
+	DefaultCacheTTL          = service.DefaultCacheTTL
+	DefaultFailureCacheTTL   = service.DefaultFailureCacheTTL
+)
+
+// Options configures NewHandler; zero values fall back to the defaults
+type Options struct {
+	// Prefix is the path the routes are mounted under, e.g. "/api/v1"
+	Prefix string
+	// AllowedOrigins are CORS origin patterns (see cors.Policy); ignored
+	// when CORS is set
+	AllowedOrigins []string
+	// CORS overrides the origin policy; the handler registers its routes'
+	// methods on it
+	CORS *cors.Policy
+	// DisableCORS skips CORS handling, for servers that apply their own
+	DisableCORS bool
+	// DisableRequestMetrics skips timing requests, for servers that time
+	// their own; requests still get an ID (see requestid.Middleware)
+	DisableRequestMetrics bool
+	// Service transpiles requests; when nil one is built from the code
+	// length, cache, history, dialect and coverage options below, which
+	// are otherwise ignored. Pass a server's own to share its cache.
+	Service *service.Service
+	// MaxCodeLength bounds a program in bytes and MaxCodeCharacters in
+	// characters, counting an emoji once
+	MaxCodeLength     int
+	MaxCodeCharacters int
+	// MaxOutputLength is the most output, in bytes, one transpile may
+	// generate
+	MaxOutputLength int
+	// ComplexityBudget is the most a program may cost to parse (see
+	// transpiler.MeasureComplexity)
+	ComplexityBudget int
+	CacheSize        int
+	// CacheMaxBytes bounds the transpile cache's approximate memory use
+	CacheMaxBytes int
+	CacheTTL      time.Duration
+	// FailureCacheTTL is how long parse failures stay cached
+	FailureCacheTTL time.Duration
+	// RemoteCache backs the transpile cache and saved snippets with a
+	// store shared across instances (see kvcache.FromEnv), so serverless
+	// cold starts keep them; both are in memory only when nil
+	RemoteCache kvcache.Store
+	// Storage keeps saved snippets and their flags, the results of async
+	// jobs and the API keys added by an import (see storage.FromEnv), in
+	// place of RemoteCache for snippets. With it a snippet, a job or a
+	// key outlives the process, and a job can be polled on any instance
+	// sharing it.
+	Storage storage.Store
+	// NormalizeCacheKeys keys the transpile cache on the normalized source
+	// (see transpiler.NormalizeSource) so programs differing only in
+	// layout or comments share an entry. A hit then returns the output of
+	// whichever equivalent program was cached first.
+	NormalizeCacheKeys bool
+	// History stores per-session transpile history; a private store is
+	// created when nil
+	History *history.Store
+	// Dialects holds the dialect packs; an in-memory store is created
+	// when nil
+	Dialects *dialect.Store
+	// AdminToken guards the /admin routes; they are disabled when empty
+	// and no ServiceTokens are configured
+	AdminToken string
+	// ServiceTokens authenticate first-party callers, which may use the
+	// admin API; servers also exempt them from rate limiting
+	ServiceTokens *servicetoken.Set
+	// APIKeys authenticate third-party callers by X-API-Key and count
+	// their requests against daily quotas (see apikey.Store.Check); keys
+	// are rejected as unknown when nil
+	APIKeys *apikey.Store
+	// DisableAPIKeyCheck leaves API keys to a server's own middleware;
+	// /usage still reports on them
+	DisableAPIKeyCheck bool
+	// Usage receives a usage event for each request sent with an API key
+	// (see usage.FromEnv); nothing is metered when nil. A server that
+	// checks keys itself meters them itself too, leaving the Meter in the
+	// request's context for the handlers to count on.
+	Usage *usage.Emitter
+	// DisableSandbox turns off the routes that run programs, such as /run
+	// and grading, e.g. while a problem with the sandbox is looked into.
+	// They answer 503, and the sandbox is reported as degraded, while
+	// transpiling and validating go on.
+	DisableSandbox bool
+	// Pool bounds concurrent transpile and sandbox work; a pool with the
+	// default size is created when nil. Share one pool to bound a whole
+	// server.
+	Pool *workpool.Pool
+	// Coverage aggregates emoji map coverage for /metrics; a private
+	// aggregate is created when nil
+	Coverage *coverage.Stats
+	// Metrics counts requests, transpiles and parse errors for /metrics;
+	// the Service's registry is used when nil
+	Metrics *metrics.Registry
+	// AsyncThreshold turns a /transpile request whose body is larger than
+	// this many bytes into a job polled at /jobs/{id}, so it isn't cut off
+	// by a serverless timeout; zero keeps every request synchronous. Jobs
+	// live in the process, so the poll must reach the same instance
+	// unless they're kept in Storage.
+	AsyncThreshold int
+	// GitHubAPIURL is where snippets are exported as gists; github.com's
+	// API when empty (see gist.DefaultAPIURL)
+	GitHubAPIURL string
+	// SourceHosts are the hosts a transpile request's sourceUrl may name;
+	// raw GitHub and Gist files when empty (see source.DefaultHosts)
+	SourceHosts []string
+	// Privacy is the default privacy mode (see service.PrivacyStrict)
+	Privacy string
+	// SnippetRateLimit is how many snippets one client may create a
+	// minute, apart from any limit on the other routes;
+	// DefaultSnippetRateLimit when zero, unlimited when negative
+	SnippetRateLimit int
+	// SnippetScans check a program before it's saved as a snippet,
+	// blocking it or flagging it for review (see scan.FromEnv); snippets
+	// aren't scanned when empty
+	SnippetScans []scan.Rule
+	// Leaderboard keeps the challenge leaderboards; an in-memory store is
+	// created when nil
+	Leaderboard *leaderboard.Store
+	// SubmissionRateLimit is how many challenge submissions one client may
+	// make a minute; DefaultSubmissionRateLimit when zero, unlimited when
+	// negative
+	SubmissionRateLimit int
+	// WebhookRateLimit is how many forum bot webhook requests one client
+	// may make a minute; DefaultWebhookRateLimit when zero, unlimited
+	// when negative
+	WebhookRateLimit int
+	// Commit is the git revision /meta reports, for builds the Go
+	// toolchain doesn't stamp with one, such as a serverless bundle
+	Commit string
+	// TrustProxy identifies clients by the X-Real-IP or X-Forwarded-For
+	// header rather than the connection, behind a proxy that sets them
+	TrustProxy bool
+	// Chaos injects faults for resilience testing (see chaos.FromEnv):
+	// the handler delays requests, and the Service built from these
+	// options fails parses and cache lookups. A Service passed in takes
+	// its own injector. Nothing is injected when nil.
+	Chaos *chaos.Injector
+	// Canary routes a percentage of plain emoji transpiles, per route or
+	// API key, to the syntax tree and the rest to the previous release's
+	// replacer (see canary.FromEnv). Every transpile takes the tree when
+	// nil.
+	Canary *canary.Router
+}
+
+type handler struct {
+	opts        Options
+	mux         *http.ServeMux
+	svc         *service.Service
+	history     *history.Store
+	dialects    *dialect.Store
+	badges      *badgeStore
+	idempotency *idempotency.Store
+	jobs        *jobs.Store
+	snippets    *snippetStore
+	examples    *exampleStore
+	moderation  *moderationStore
+	gists       *gist.Client
+	leaderboard *leaderboard.Store
+	notebooks   *notebook.Store
+	repl        *repl.Store
+	// snippetLimit limits snippet creation; nil when unlimited
+	snippetLimit *ratelimit.Limiter
+	// submissionLimit limits challenge submissions; nil when unlimited
+	submissionLimit *ratelimit.Limiter
+	// webhookLimit limits the forum bot webhook; nil when unlimited
+	webhookLimit *ratelimit.Limiter
+	// conformance runs the conformance suite the first time it's called
+	conformance func() spec.Report
+	// routes are the patterns registered, such as "GET /api/v1/snippets/{id}"
+	routes []string
+}
+
+// NewHandler returns an http.Handler serving every EmojiScript API route
+// under opts.Prefix
+func NewHandler(opts Options) http.Handler {
+	h := newHandler(opts)
+	return requestid.Middleware(h.opts.Chaos.Middleware(h))
+}
+
+func newHandler(opts Options) *handler {
+	if opts.Prefix == "" {
+		opts.Prefix = DefaultPrefix
+	}
+	opts.Prefix = "/" + strings.Trim(opts.Prefix, "/")
+	if opts.Prefix == "/" {
+		opts.Prefix = ""
+	}
+	if opts.CORS == nil {
+		opts.CORS = cors.New(opts.AllowedOrigins, true)
+	}
+	if opts.Pool == nil {
+		opts.Pool = workpool.New(0, 0, 0)
+	}
+	if opts.Coverage == nil {
+		opts.Coverage = coverage.New()
+	}
+	if opts.Service == nil {
+		opts.Service = service.New(service.Options{
+			MaxCodeLength:      opts.MaxCodeLength,
+			MaxCodeCharacters:  opts.MaxCodeCharacters,
+			MaxOutputLength:    opts.MaxOutputLength,
+			ComplexityBudget:   opts.ComplexityBudget,
+			CacheSize:          opts.CacheSize,
+			CacheMaxBytes:      opts.CacheMaxBytes,
+			CacheTTL:           opts.CacheTTL,
+			FailureCacheTTL:    opts.FailureCacheTTL,
+			RemoteCache:        opts.RemoteCache,
+			NormalizeCacheKeys: opts.NormalizeCacheKeys,
+			History:            opts.History,
+			Dialects:           opts.Dialects,
+			Coverage:           opts.Coverage,
+			Metrics:            opts.Metrics,
+			SourceHosts:        opts.SourceHosts,
+			Privacy:            opts.Privacy,
+			Chaos:              opts.Chaos,
+		})
+	}
+	if opts.Metrics == nil {
+		opts.Metrics = opts.Service.Metrics()
+	}
+	if opts.Leaderboard == nil {
+		opts.Leaderboard, _ = leaderboard.NewStore("")
+	}
+	if opts.SnippetRateLimit == 0 {
+		opts.SnippetRateLimit = DefaultSnippetRateLimit
+	}
+	if opts.SubmissionRateLimit == 0 {
+		opts.SubmissionRateLimit = DefaultSubmissionRateLimit
+	}
+	if opts.WebhookRateLimit == 0 {
+		opts.WebhookRateLimit = DefaultWebhookRateLimit
+	}
+
+	h := &handler{
+		opts:        opts,
+		mux:         http.NewServeMux(),
+		svc:         opts.Service,
+		history:     opts.Service.History(),
+		dialects:    opts.Service.Dialects(),
+		badges:      newBadgeStore(),
+		idempotency: idempotency.New(0, 0),
+		jobs:        jobs.New(0, 0),
+		snippets:    newSnippetStore(degrade.Store(snippetStorage(opts, storage.Snippets), opts.Service.Health(), degrade.Snippets)),
+		examples:    &exampleStore{},
+		moderation:  newModerationStore(degrade.Store(snippetStorage(opts, storage.Moderation), opts.Service.Health(), degrade.Snippets)),
+		gists:       gist.New(opts.GitHubAPIURL),
+		leaderboard: opts.Leaderboard,
+		notebooks:   notebook.New(0, 0),
+		repl:        repl.New(0, 0),
+	}
+	if opts.Storage != nil {
+		h.snippets.storage = opts.Storage
+		h.examples.storage = opts.Storage
+		h.jobs.Persist(opts.Storage)
+		ctx, cancel := context.WithTimeout(context.Background(), storage.Timeout)
+		if err := h.examples.seed(ctx); err != nil {
+			log.Printf("storage: examples: %v", err)
+		}
+		cancel()
+		if opts.APIKeys != nil {
+			ctx, cancel := context.WithTimeout(context.Background(), storage.Timeout)
+			if err := opts.APIKeys.Persist(ctx, opts.Storage); err != nil {
+				log.Printf("storage: API keys: %v", err)
+			}
+			cancel()
+		}
+	}
+	if opts.DisableSandbox {
+		h.svc.Health().Disable(degrade.Sandbox, "turned off by the operator")
+	}
+	h.conformance = sync.OnceValue(func() spec.Report { return Conformance(h.svc) })
+	if opts.SnippetRateLimit > 0 {
+		h.snippetLimit = ratelimit.New(opts.SnippetRateLimit, time.Minute)
+	}
+	if opts.SubmissionRateLimit > 0 {
+		h.submissionLimit = ratelimit.New(opts.SubmissionRateLimit, time.Minute)
+	}
+	if opts.WebhookRateLimit > 0 {
+		h.webhookLimit = ratelimit.New(opts.WebhookRateLimit, time.Minute)
+	}
+
+	h.route("GET", "/health", h.handleHealth)
+	h.route("GET", "/metrics", h.handleMetrics)
+	h.route("GET", "/usage", h.handleUsage)
+	h.route("GET", "/meta", h.handleMeta)
+	h.route("POST", "/transpile", h.unlessPrivate(1, h.idempotent(h.async(h.pooled(h.handleTranspile))), h.pooled(h.handleTranspile)))
+	h.route("POST", "/transpile/project", h.unlessPrivate(service.MaxProjectFiles, h.idempotent(h.pooled(h.handleTranspileProject)), h.pooled(h.handleTranspileProject)))
+	h.route("GET", "/jobs/{id}", h.handleJob)
+	h.route("POST", "/validate", h.pooled(h.handleValidate))
+	h.route("GET", "/examples", h.handleExamples)
+	h.route("GET", "/examples/path", h.handleExamplePath)
+	h.route("GET", "/lessons", h.handleLessons)
+	h.route("GET", "/lessons/{id}", h.handleLesson)
+	h.route("GET", "/quiz", h.handleQuiz)
+	h.route("POST", "/transcribe", h.pooled(h.handleTranscribe))
+	h.route("POST", "/format", h.pooled(h.handleFormat))
+	h.route("GET", "/reference", h.handleReference)
+	h.route("GET", "/grammar", h.handleGrammar)
+	h.route("GET", "/changelog", h.handleChangelog)
+	h.route("GET", "/history", h.handleHistory)
+	h.route("GET", "/history/{id}", h.handleHistoryEntry)
+	h.route("DELETE", "/history", h.handleHistoryClear)
+	h.route("GET", "/fixtures", h.handleFixtures)
+	h.route("GET", "/conformance", h.pooled(h.handleConformance))
+	h.route("GET", "/conformance/badge", h.pooled(h.handleConformanceBadge))
+	h.route("GET", "/dialects", h.handleDialects)
+	h.route("GET", "/dialects/{name}", h.handleDialect)
+	h.route("GET", "/mappings", h.handleMappings)
+	h.route("GET", "/mappings/{name}", h.handleMapping)
+	h.route("POST", "/trace", h.needsSandbox(h.pooled(h.handleTrace)))
+	h.route("POST", "/run", h.needsSandbox(h.pooled(h.handleRun)))
+	h.route("DELETE", "/run", h.handleResetSession)
+	h.route("POST", "/evaluate", h.needsSandbox(h.pooled(h.handleEvaluate)))
+	h.route("POST", "/ast", h.pooled(h.handleAST))
+	h.route("POST", "/tokenize", h.pooled(h.handleTokenize))
+	h.route("POST", "/symbols", h.pooled(h.handleSymbols))
+	h.route("POST", "/outline", h.pooled(h.handleOutline))
+	h.route("POST", "/refactor/rename", h.pooled(h.handleRename))
+	h.route("POST", "/refactor/extract", h.pooled(h.handleExtract))
+	h.route("POST", "/refactor/imports", h.pooled(h.handleOrganizeImports))
+	h.route("POST", "/grade", h.needsSandbox(h.pooled(h.handleGrade)))
+	h.route("GET", "/challenge/today", h.handleChallengeToday)
+	h.route("POST", "/challenge/{id}/grade", h.needsSandbox(h.pooled(h.handleChallengeGrade)))
+	h.route("POST", "/challenge/{id}/submit", h.needsSandbox(h.limitSubmissions(h.pooled(h.handleChallengeSubmit))))
+	h.route("GET", "/challenge/{id}/leaderboard", h.handleLeaderboard)
+	h.route("GET", "/badge", h.pooled(h.handleBadge))
+	h.route("POST", "/badge", h.idempotent(h.pooled(h.handleVerifyBadge)))
+	h.route("POST", "/snippets", h.limitSnippets(h.pooled(h.handleCreateSnippet)))
+	h.route("GET", "/snippets/export", h.handleSnippetProject)
+	h.route("GET", "/snippets/{id}", h.handleSnippet)
+	h.route("GET", "/snippets/{id}/preview", h.pooled(h.handleSnippetPreview))
+	h.route("POST", "/snippets/{id}/flag", h.limitSnippets(h.handleFlagSnippet))
+	h.route("POST", "/snippets/{id}/gist", h.idempotent(h.pooled(h.handleSnippetGist)))
+	h.route("GET", "/embed/{id}", h.pooled(h.handleEmbed))
+	h.route("POST", "/webhooks/bot", h.limitWebhooks(h.pooled(h.handleBotWebhook)))
+	h.route("POST", "/notebooks", h.handleCreateNotebook)
+	h.route("GET", "/notebooks/{id}", h.handleNotebook)
+	h.route("PUT", "/notebooks/{id}", h.handlePutNotebook)
+	h.route("DELETE", "/notebooks/{id}", h.handleDeleteNotebook)
+	h.route("POST", "/notebooks/{id}/restart", h.handleRestartNotebook)
+	h.route("POST", "/notebooks/{id}/cells/{cell}/transpile", h.pooled(h.handleTranspileCell))
+	h.route("POST", "/notebooks/{id}/cells/{cell}/run", h.needsSandbox(h.pooled(h.handleRunCell)))
+
+	h.route("GET", "/admin/dialects", h.requireAdmin(h.handleDialects))
+	h.route("PUT", "/admin/dialects/{name}", h.requireAdmin(h.handlePutDialect))
+	h.route("DELETE", "/admin/dialects/{name}", h.requireAdmin(h.handleDeleteDialect))
+	h.route("GET", "/admin/snippets/flagged", h.requireAdmin(h.handleFlaggedSnippets))
+	h.route("DELETE", "/admin/snippets/{id}/flags", h.requireAdmin(h.handleDismissFlags))
+	h.route("DELETE", "/admin/snippets/{id}", h.requireAdmin(h.handleTakedownSnippet))
+	h.route("GET", "/admin/snippet-bans", h.requireAdmin(h.handleSnippetBans))
+	h.route("DELETE", "/admin/snippet-bans/{hash}", h.requireAdmin(h.handleUnbanSnippet))
+	h.route("GET", "/admin/selftest", h.requireAdmin(h.pooled(h.handleSelfTest)))
+	h.route("GET", "/admin/export", h.requireAdmin(h.handleExport))
+	h.route("POST", "/admin/import", h.requireAdmin(h.handleImport))
+
+	return h
+}
+
+func (h *handler) route(method, path string, fn http.HandlerFunc) {
+	if !h.opts.DisableRequestMetrics {
+		fn = h.opts.Metrics.Middleware(fn, method, h.opts.Prefix+path).ServeHTTP
+	}
+	h.mux.HandleFunc(method+" "+h.opts.Prefix+path, fn)
+	h.routes = append(h.routes, method+" "+h.opts.Prefix+path)
+	h.opts.CORS.AllowRoute(h.opts.Prefix+path, method)
+}
+
+// maxBodyBytes bounds a JSON body carrying files programs of up to
+// maxCodeLength bytes each, leaving room for escapes and the request's
+// other fields
+func maxBodyBytes(files, maxCodeLength int) int64 {
+	return int64(files)*int64(maxCodeLength)*2 + 64<<10
+}
+
+// idempotent wraps a state-changing route so a retry carrying the same
+// Idempotency-Key gets the first response back instead of repeating it.
+// Keys are scoped to the caller (see idempotencyScope).
+func (h *handler) idempotent(fn http.HandlerFunc) http.HandlerFunc {
+	return h.idempotency.Middleware(fn, h.idempotencyScope).ServeHTTP
+}
+
+// idempotencyScope names who sent a request: its service token or API
+// key when it has one, otherwise its client address and session, so one
+// caller can't replay another's response by sending the same key and
+// session ID
+func (h *handler) idempotencyScope(r *http.Request) string {
+	if name, isService := h.opts.ServiceTokens.FromRequest(r); isService {
+		return "service:" + name
+	}
+	if key, ok := h.opts.APIKeys.FromRequest(r); ok {
+		return "key:" + key.Name
+	}
+	return "client:" + ratelimit.ClientIP(r, h.opts.TrustProxy) + " " + sessionID(r)
+}
+
+// pipeline picks the pipeline a transpile request's plain emoji is
+// compiled with, by its route and API key (see canary.Router)
+func (h *handler) pipeline(r *http.Request) string {
+	_, route, _ := strings.Cut(r.Pattern, " ")
+	key, _ := h.opts.APIKeys.FromRequest(r)
+	return h.opts.Canary.Pipeline(route, key.Name)
+}
+
+// async runs requests larger than AsyncThreshold as jobs, answering 202
+// with the job's URL
+func (h *handler) async(fn http.HandlerFunc) http.HandlerFunc {
+	if h.opts.AsyncThreshold <= 0 {
+		return fn
+	}
+	location := func(id string) string { return h.opts.Prefix + "/jobs/" + id }
+	return h.jobs.Middleware(fn, h.opts.AsyncThreshold, location).ServeHTTP
+}
+
+// unlessPrivate serves strict-privacy requests with plain rather than
+// wrapped, skipping the idempotent replays and async jobs that keep a
+// response in memory. The body it reads to tell is bounded by the
+// service's byte limit for each of the files programs it may carry.
+func (h *handler) unlessPrivate(files int, wrapped, plain http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		body, err := io.ReadAll(http.MaxBytesReader(w, r.Body, maxBodyBytes(files, h.svc.MaxCodeLength())))
+		if err != nil {
+			status := http.StatusBadRequest
+			var tooLarge *http.MaxBytesError
+			if errors.As(err, &tooLarge) {
+				status = http.StatusRequestEntityTooLarge
+			}
+			writeJSON(w, status, errorBody{Success: false, Error: err.Error()})
+			return
+		}
+		r.Body = io.NopCloser(bytes.NewReader(body))
+		if h.svc.PrivateRequest(body) {
+			plain(w, r)
+			return
+		}
+		wrapped(w, r)
+	}
+}
+
+// snippetStorage is where snippets, or their flags, are kept beyond
+// memory: a collection of the Storage, or else the RemoteCache
+func snippetStorage(opts Options, collection string) kvcache.Store {
+	if opts.Storage != nil {
+		return storage.KV(opts.Storage, collection)
+	}
+	return opts.RemoteCache
+}
+
+// needsSandbox answers 503 in place of fn while the sandbox is down
+func (h *handler) needsSandbox(fn http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if h.svc.Health().Down(degrade.Sandbox) {
+			writeJSON(w, http.StatusServiceUnavailable, errorBody{Error: "Running programs is unavailable right now; transpiling still works"})
+			return
+		}
+		fn(w, r)
+	}
+}
+
+// limitSnippets applies the snippet rate limit, when there is one
+func (h *handler) limitSnippets(fn http.HandlerFunc) http.HandlerFunc {
+	if h.snippetLimit == nil {
+		return fn
+	}
+	return h.snippetLimit.Middleware(fn, h.limitedClient).ServeHTTP
+}
+
+// limitSubmissions applies the challenge submission rate limit, when
+// there is one
+func (h *handler) limitSubmissions(fn http.HandlerFunc) http.HandlerFunc {
+	if h.submissionLimit == nil {
+		return fn
+	}
+	return h.submissionLimit.Middleware(fn, h.limitedClient).ServeHTTP
+}
+
+// limitWebhooks applies the webhook rate limit, when there is one
+func (h *handler) limitWebhooks(fn http.HandlerFunc) http.HandlerFunc {
+	if h.webhookLimit == nil {
+		return fn
+	}
+	return h.webhookLimit.Middleware(fn, h.limitedClient).ServeHTTP
+}
+
+// pooled runs a CPU-heavy route on the worker pool, answering 503 with
+// Retry-After when the pool is saturated
+func (h *handler) pooled(fn http.HandlerFunc) http.HandlerFunc {
+	return h.opts.Pool.Middleware(fn).ServeHTTP
+}
+
+func (h *handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if degraded := h.svc.Health().Header(); degraded != "" {
+		w.Header().Set("X-Degraded", degraded)
+	}
+	if !h.opts.DisableCORS {
+		preflight := h.opts.CORS.Apply(w.Header(), r.Header.Get("Origin"), r.Method, r.URL.Path, r.Header.Get("Access-Control-Request-Method"))
+		if preflight {
+			w.WriteHeader(http.StatusNoContent)
+			return
+		}
+	}
+
+	if !h.opts.DisableAPIKeyCheck && h.metered(r) {
+		key, ok, err := h.opts.APIKeys.Check(w.Header(), r.Header.Get(apikey.Header))
+		if err != nil {
+			writeJSON(w, apikey.Status(err), apikey.Rejection(w.Header(), err))
+			return
+		}
+		if ok && h.opts.Usage != nil {
+			h.meterUsage(w, r, key)
+			return
+		}
+	}
+
+	h.mux.ServeHTTP(w, r)
+}
+
+// meterUsage serves a request sent with key, counting what it uses and
+// emitting it as a usage event
+func (h *handler) meterUsage(w http.ResponseWriter, r *http.Request, key apikey.Key) {
+	meter := &usage.Meter{}
+	counter := &countingWriter{ResponseWriter: w}
+	r = r.WithContext(usage.NewContext(r.Context(), meter))
+	body := &countingReader{ReadCloser: r.Body}
+	r.Body = body
+	h.mux.ServeHTTP(counter, r)
+
+	if counter.status == 0 {
+		counter.status = http.StatusOK
+	}
+	endpoint := r.URL.Path
+	if r.Pattern != "" {
+		_, endpoint, _ = strings.Cut(r.Pattern, " ")
+	}
+	event := usage.Event{
+		Time:          time.Now().UTC(),
+		RequestID:     requestid.FromContext(r.Context()),
+		Key:           key.Name,
+		Tier:          key.Tier.Name,
+		Method:        r.Method,
+		Endpoint:      endpoint,
+		Status:        counter.status,
+		RequestBytes:  max(r.ContentLength, body.n),
+		ResponseBytes: counter.n,
+	}
+	meter.Fill(&event)
+	h.opts.Usage.Emit(event)
+}
+
+// countingWriter remembers the status a handler answered with and counts
+// the bytes of its body
+type countingWriter struct {
+	http.ResponseWriter
+	status int
+	n      int64
+}
+
+func (c *countingWriter) WriteHeader(status int) {
+	if c.status == 0 {
+		c.status = status
+	}
+	c.ResponseWriter.WriteHeader(status)
+}
+
+func (c *countingWriter) Write(b []byte) (int, error) {
+	if c.status == 0 {
+		c.status = http.StatusOK
+	}
+	n, err := c.ResponseWriter.Write(b)
+	c.n += int64(n)
+	return n, err
+}
+
+// Unwrap lets http.ResponseController reach the underlying writer
+func (c *countingWriter) Unwrap() http.ResponseWriter {
+	return c.ResponseWriter
+}
+
+// countingReader counts the bytes of a request body a handler reads
+type countingReader struct {
+	io.ReadCloser
+	n int64
+}
+
+func (c *countingReader) Read(b []byte) (int, error) {
+	n, err := c.ReadCloser.Read(b)
+	c.n += int64(n)
+	return n, err
+}
+
+// metered reports whether r counts against its API key's quota: service
+// tokens, health checks and metrics scrapes don't, nor does /usage
+// against the quota it reports
+func (h *handler) metered(r *http.Request) bool {
+	if _, isService := h.opts.ServiceTokens.FromRequest(r); isService {
+		return false
+	}
+	switch strings.TrimPrefix(r.URL.Path, h.opts.Prefix) {
+	case "/health", "/metrics", "/usage":
+		return false
+	}
+	return true
+}
+
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	enc := json.NewEncoder(w)
+	enc.SetEscapeHTML(false)
+	enc.Encode(v)
+}
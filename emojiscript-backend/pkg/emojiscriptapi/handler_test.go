@@ -0,0 +1,157 @@
+package emojiscriptapi
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// TestTranspileBodyLimit checks that /transpile stops reading a body
+// past the service's byte limit rather than holding all of it in memory
+func TestTranspileBodyLimit(t *testing.T) {
+	api := NewHandler(Options{Prefix: DefaultPrefix, MaxCodeLength: 1000})
+	for _, tt := range []struct {
+		size int
+		want int
+	}{
+		{100, http.StatusOK},
+		{int(maxBodyBytes(1, 1000)) + 1, http.StatusRequestEntityTooLarge},
+	} {
+		body := `{"code": "📝(1)", "padding": "` + strings.Repeat(" ", tt.size) + `"}`
+		rec := httptest.NewRecorder()
+		api.ServeHTTP(rec, httptest.NewRequest("POST", DefaultPrefix+"/transpile", strings.NewReader(body)))
+		if rec.Code != tt.want {
+			t.Errorf("%d-byte body: got %d, want %d: %s", len(body), rec.Code, tt.want, rec.Body)
+		}
+	}
+}
+
+// TestTranspileES5Exponent checks that the es5 target spells 🔺 and 🔺🟰
+// with Math.pow, which ES5 has in place of **
+func TestTranspileES5Exponent(t *testing.T) {
+	api := NewHandler(Options{Prefix: DefaultPrefix})
+	body := `{"code": "📦 r = 2\n📝(r 🔺 2 ✖️ Math.PI)\n🔢 n = 3\nn 🔺🟰 2", "targetLanguage": "es5"}`
+	rec := httptest.NewRecorder()
+	api.ServeHTTP(rec, httptest.NewRequest("POST", DefaultPrefix+"/transpile", strings.NewReader(body)))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("got %d: %s", rec.Code, rec.Body)
+	}
+	for _, want := range []string{`Math.pow(r, 2) * Math.PI`, `n = Math.pow(n, 2);`} {
+		if !strings.Contains(rec.Body.String(), want) {
+			t.Errorf("got %s, want it to contain %s", rec.Body, want)
+		}
+	}
+	if strings.Contains(rec.Body.String(), "**") {
+		t.Errorf("got %s, which has **", rec.Body)
+	}
+}
+
+// TestTranspileSyntaxError checks that /transpile fails emoji code that
+// parses to invalid JavaScript, with a positioned diagnostic
+func TestTranspileSyntaxError(t *testing.T) {
+	api := NewHandler(Options{Prefix: DefaultPrefix})
+	rec := httptest.NewRecorder()
+	api.ServeHTTP(rec, httptest.NewRequest("POST", DefaultPrefix+"/transpile", strings.NewReader(`{"code": "📝(1 ➕ )"}`)))
+	var resp struct {
+		Success     bool
+		Diagnostics []struct {
+			Line, Column int
+			Code         string
+		}
+	}
+	if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil {
+		t.Fatal(err)
+	}
+	if resp.Success || len(resp.Diagnostics) != 1 {
+		t.Fatalf("got %s, want one error", rec.Body)
+	}
+	if d := resp.Diagnostics[0]; d.Line != 1 || d.Column != 5 || d.Code != "missing-expression" {
+		t.Errorf("got %+v, want missing-expression at 1:5", d)
+	}
+}
+
+// TestRoutes checks that routes are served under the prefix, however it's
+// written, and answer 405 to a method they don't accept
+func TestRoutes(t *testing.T) {
+	for _, prefix := range []string{"/v2", "v2/", "/v2/"} {
+		api := NewHandler(Options{Prefix: prefix})
+		for _, tt := range []struct {
+			method, path string
+			want         int
+		}{
+			{"GET", "/v2/health", http.StatusOK},
+			{"GET", "/api/v1/health", http.StatusNotFound},
+			{"GET", "/v2/nothing", http.StatusNotFound},
+			{"DELETE", "/v2/health", http.StatusMethodNotAllowed},
+			{"GET", "/v2/transpile", http.StatusMethodNotAllowed},
+		} {
+			rec := httptest.NewRecorder()
+			api.ServeHTTP(rec, httptest.NewRequest(tt.method, tt.path, nil))
+			if rec.Code != tt.want {
+				t.Errorf("prefix %q: %s %s: got %d, want %d", prefix, tt.method, tt.path, rec.Code, tt.want)
+			}
+		}
+	}
+
+	rec := httptest.NewRecorder()
+	NewHandler(Options{Prefix: "/"}).ServeHTTP(rec, httptest.NewRequest("GET", "/health", nil))
+	var health HealthResponse
+	if err := json.Unmarshal(rec.Body.Bytes(), &health); err != nil || rec.Code != http.StatusOK || health.Status != "healthy" {
+		t.Errorf("prefix \"/\": got %d %s, want a healthy /health", rec.Code, rec.Body)
+	}
+	if rec.Header().Get("X-Request-ID") == "" {
+		t.Error("got no X-Request-ID")
+	}
+}
+
+// TestPreflight checks that the handler answers preflights itself with
+// the methods each route was registered with
+func TestPreflight(t *testing.T) {
+	api := NewHandler(Options{Prefix: DefaultPrefix, AllowedOrigins: []string{"https://*.example.com"}})
+	for _, tt := range []struct {
+		path, method, origin string
+		methods              string
+	}{
+		{"/transpile", "POST", "https://app.example.com", "OPTIONS, POST"},
+		{"/history", "DELETE", "https://app.example.com", "DELETE, GET, OPTIONS"},
+		{"/transpile", "DELETE", "https://app.example.com", ""},
+		{"/transpile", "POST", "https://example.com", ""},
+	} {
+		req := httptest.NewRequest("OPTIONS", DefaultPrefix+tt.path, nil)
+		req.Header.Set("Origin", tt.origin)
+		req.Header.Set("Access-Control-Request-Method", tt.method)
+		rec := httptest.NewRecorder()
+		api.ServeHTTP(rec, req)
+		if rec.Code != http.StatusNoContent || rec.Header().Get("Access-Control-Allow-Methods") != tt.methods {
+			t.Errorf("%s %s from %s: got %d with methods %q, want 204 with %q", tt.method, tt.path, tt.origin, rec.Code, rec.Header().Get("Access-Control-Allow-Methods"), tt.methods)
+		}
+	}
+}
+
+// TestTranspileIdempotent checks that /transpile replays a retry with the
+// same Idempotency-Key to the same client only
+func TestTranspileIdempotent(t *testing.T) {
+	api := NewHandler(Options{Prefix: DefaultPrefix})
+	for _, tt := range []struct {
+		session  string
+		replayed bool
+	}{
+		{"session-one", false},
+		{"session-one", true},
+		{"session-two", false},
+	} {
+		req := httptest.NewRequest("POST", DefaultPrefix+"/transpile", strings.NewReader(`{"code": "📝(1)"}`))
+		req.Header.Set("Idempotency-Key", "retry-me")
+		req.Header.Set("X-Session-ID", tt.session)
+		rec := httptest.NewRecorder()
+		api.ServeHTTP(rec, req)
+		if rec.Code != http.StatusOK {
+			t.Fatalf("%s: got %d: %s", tt.session, rec.Code, rec.Body)
+		}
+		if replayed := rec.Header().Get("Idempotent-Replayed") == "true"; replayed != tt.replayed {
+			t.Errorf("%s: replayed = %v, want %v", tt.session, replayed, tt.replayed)
+		}
+	}
+}
@@ -0,0 +1,22 @@
+package emojiscriptapi
+
+import (
+	"net/http"
+
+	"emojiscript-backend/pkg/jobs"
+)
+
+// handleJob reports a job started for a request over AsyncThreshold.
+// While it runs the reply carries Retry-After; once done, response holds
+// the body the request would have had and responseStatus its status.
+func (h *handler) handleJob(w http.ResponseWriter, r *http.Request) {
+	job, found := h.jobs.Get(r.Context(), r.PathValue("id"))
+	if !found {
+		writeJSON(w, http.StatusNotFound, errorBody{Error: "Job not found or expired"})
+		return
+	}
+	if job.Status == jobs.Pending || job.Status == jobs.Running {
+		w.Header().Set("Retry-After", "1")
+	}
+	writeJSON(w, http.StatusOK, job)
+}
@@ -0,0 +1,134 @@
+package emojiscriptapi
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"net/http"
+	"strconv"
+	"time"
+	"unicode"
+
+	"emojiscript-backend/pkg/leaderboard"
+	"emojiscript-backend/pkg/requestid"
+	"emojiscript-backend/pkg/transpiler"
+)
+
+const (
+	// DefaultSubmissionRateLimit is how many challenge submissions one
+	// client may make a minute
+	DefaultSubmissionRateLimit = 5
+	DefaultLeaderboardLimit    = 10
+)
+
+type SubmissionRequest struct {
+	// Name is who the submission is ranked as (see leaderboard.ValidName)
+	Name string `json:"name"`
+	GradeRequest
+}
+
+type SubmissionResponse struct {
+	GradeResponse
+	// Entry is the submission's score; it's ranked only when it passes a
+	// test, and only kept when it's the name's best
+	Entry *leaderboard.Entry `json:"entry,omitempty"`
+	// Rank is the name's place on the board, from 1; zero when it's not
+	// on it
+	Rank     int  `json:"rank"`
+	Improved bool `json:"improved"`
+}
+
+type LeaderboardResponse struct {
+	Challenge string              `json:"challenge"`
+	Entries   []leaderboard.Entry `json:"entries"`
+}
+
+// scoreSubmission scores a graded program: tests passed first, then the
+// emoji density and size that break ties
+func scoreSubmission(name, code string, graded GradeResponse) leaderboard.Entry {
+	size := 0
+	for _, r := range code {
+		if !unicode.IsSpace(r) {
+			size++
+		}
+	}
+	entry := leaderboard.Entry{Name: name, Passed: graded.Passed, Total: graded.Total, Size: size, SubmittedAt: time.Now().UTC()}
+	if size > 0 {
+		emoji := transpiler.MeasureCoverage(code).Recognized
+		entry.EmojiDensity = math.Round(float64(emoji)*1000/float64(size)) / 10
+	}
+	// programs differing only in layout or comments are the same program
+	sum := sha256.Sum256([]byte(transpiler.NormalizeSource(code)))
+	entry.CodeHash = hex.EncodeToString(sum[:])[:16]
+	return entry
+}
+
+// handleChallengeSubmit grades a submission like /challenge/{id}/grade and
+// puts its score on the challenge's leaderboard
+func (h *handler) handleChallengeSubmit(w http.ResponseWriter, r *http.Request) {
+	challenge, ok := challengeByID(r.PathValue("id"))
+	if !ok {
+		writeJSON(w, http.StatusNotFound, errorBody{Error: "challenge not found"})
+		return
+	}
+	var req SubmissionRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeJSON(w, http.StatusBadRequest, errorBody{Error: "Invalid request"})
+		return
+	}
+	if !leaderboard.ValidName(req.Name) {
+		writeJSON(w, http.StatusBadRequest, errorBody{Error: fmt.Sprintf("name must be 1 to %d letters, digits, spaces, _, . or -, starting with a letter or digit", leaderboard.MaxNameLength)})
+		return
+	}
+	if err := h.svc.ValidateInput(req.Code); err != nil {
+		writeJSON(w, http.StatusBadRequest, errorBody{Error: err.Error()})
+		return
+	}
+
+	status, graded := h.grade(r.Context(), req.GradeRequest, challenge.Tests)
+	if status != http.StatusOK {
+		writeJSON(w, status, SubmissionResponse{GradeResponse: graded})
+		return
+	}
+	resp := SubmissionResponse{GradeResponse: graded}
+	entry := scoreSubmission(req.Name, req.Code, graded)
+	resp.Entry = &entry
+	if entry.Passed > 0 {
+		rank, improved, err := h.leaderboard.Submit(challenge.ID, entry)
+		switch {
+		case errors.Is(err, leaderboard.ErrCopied):
+			writeJSON(w, http.StatusConflict, errorBody{Error: err.Error()})
+			return
+		case err != nil:
+			requestid.Printf(r.Context(), "leaderboard: %v", err)
+			writeJSON(w, http.StatusInternalServerError, errorBody{Error: "Failed to save the submission"})
+			return
+		}
+		resp.Rank, resp.Improved = rank, improved
+	}
+	writeJSON(w, http.StatusOK, resp)
+}
+
+// handleLeaderboard lists a challenge's best submissions, the top
+// DefaultLeaderboardLimit unless ?limit= asks for up to
+// leaderboard.MaxEntries
+func (h *handler) handleLeaderboard(w http.ResponseWriter, r *http.Request) {
+	challenge, ok := challengeByID(r.PathValue("id"))
+	if !ok {
+		writeJSON(w, http.StatusNotFound, errorBody{Error: "challenge not found"})
+		return
+	}
+	limit := DefaultLeaderboardLimit
+	if param := r.URL.Query().Get("limit"); param != "" {
+		n, err := strconv.Atoi(param)
+		if err != nil || n < 1 || n > leaderboard.MaxEntries {
+			writeJSON(w, http.StatusBadRequest, errorBody{Error: fmt.Sprintf("limit must be between 1 and %d", leaderboard.MaxEntries)})
+			return
+		}
+		limit = n
+	}
+	writeJSON(w, http.StatusOK, LeaderboardResponse{Challenge: challenge.ID, Entries: h.leaderboard.Top(challenge.ID, limit)})
+}
@@ -0,0 +1,186 @@
+package emojiscriptapi
+
+import (
+	"net/http"
+	"strings"
+
+	"emojiscript-backend/pkg/transpiler"
+)
+
+// Lesson is one tutorial unit: an explanation, code for the learner to
+// start from and the output their finished program should print
+type Lesson struct {
+	ID             string   `json:"id"`
+	Order          int      `json:"order"`
+	Unit           string   `json:"unit"`
+	Title          string   `json:"title"`
+	Explanation    string   `json:"explanation"`
+	StarterCode    string   `json:"starterCode"`
+	Solution       string   `json:"solution"`
+	ExpectedOutput string   `json:"expectedOutput"`
+	Hints          []string `json:"hints"`
+	Syntax         string   `json:"syntax"`
+	TargetLanguage string   `json:"targetLanguage"`
+}
+
+// Lessons returns the lessons in order, optionally filtered by target
+// language, which may be an alias such as js (see
+// transpiler.ResolveTarget), and syntax
+func Lessons(targetLanguage, syntax string) []Lesson {
+	if target, ok := transpiler.ResolveTarget(targetLanguage); ok {
+		targetLanguage = target
+	}
+	result := []Lesson{}
+	for _, lesson := range lessons {
+		if targetLanguage != "" && !strings.EqualFold(lesson.TargetLanguage, targetLanguage) {
+			continue
+		}
+		if syntax != "" && lesson.Syntax != syntax {
+			continue
+		}
+		result = append(result, lesson)
+	}
+	return result
+}
+
+// LessonByID looks up a lesson and its neighbours in the curriculum
+func LessonByID(id string) (lesson Lesson, previous, next string, found bool) {
+	for i, l := range lessons {
+		if l.ID != id {
+			continue
+		}
+		if i > 0 && lessons[i-1].Syntax == l.Syntax {
+			previous = lessons[i-1].ID
+		}
+		if i+1 < len(lessons) && lessons[i+1].Syntax == l.Syntax {
+			next = lessons[i+1].ID
+		}
+		return l, previous, next, true
+	}
+	return Lesson{}, "", "", false
+}
+
+func (h *handler) handleLessons(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	writeJSON(w, http.StatusOK, map[string]interface{}{"lessons": Lessons(query.Get("targetLanguage"), query.Get("syntax"))})
+}
+
+func (h *handler) handleLesson(w http.ResponseWriter, r *http.Request) {
+	lesson, previous, next, found := LessonByID(r.PathValue("id"))
+	if !found {
+		writeJSON(w, http.StatusNotFound, errorBody{Error: "Lesson not found"})
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]interface{}{"lesson": lesson, "previous": previous, "next": next})
+}
+
+var lessons = []Lesson{
+	{
+		ID: "hello-world", Order: 1, Unit: "Getting started", Title: "Hello, World!",
+		Explanation:    "📝 prints whatever you put between its parentheses. Text goes inside double quotes.",
+		StarterCode:    "📝(\"\")",
+		Solution:       "📝(\"Hello, World!\")",
+		ExpectedOutput: "Hello, World!",
+		Hints:          []string{"Put the words between the quotes.", "Capital letters and punctuation count: Hello, World!"},
+		Syntax:         "emoji", TargetLanguage: "javascript",
+	},
+	{
+		ID: "variables", Order: 2, Unit: "Getting started", Title: "Boxes for values",
+		Explanation:    "📦 makes a constant, a named box whose value never changes. 🔢 makes a variable you can give a new value later with =.",
+		StarterCode:    "📦 name = \"Ada\"\n🔢 age = 36\n\n📝(name)",
+		Solution:       "📦 name = \"Ada\"\n🔢 age = 36\nage = age ➕ 1\n📝(name)\n📝(age)",
+		ExpectedOutput: "Ada\n37",
+		Hints:          []string{"Give age a new value with age = ...", "➕ adds two numbers.", "Print both boxes, one 📝 each."},
+		Syntax:         "emoji", TargetLanguage: "javascript",
+	},
+	{
+		ID: "conditions", Order: 3, Unit: "Making decisions", Title: "If and else",
+		Explanation:    "❓ runs a block only when its condition is true; ❌ gives the block to run otherwise. 📈 means \"greater than or equal to\".",
+		StarterCode:    "📦 temperature = 25\n\n❓ (temperature 📈 20) {\n  \n}",
+		Solution:       "📦 temperature = 25\n\n❓ (temperature 📈 20) {\n  📝(\"Warm\")\n} ❌ {\n  📝(\"Cold\")\n}",
+		ExpectedOutput: "Warm",
+		Hints:          []string{"Print \"Warm\" inside the ❓ block.", "Add ❌ { ... } after the closing brace for the cold case."},
+		Syntax:         "emoji", TargetLanguage: "javascript",
+	},
+	{
+		ID: "for-loops", Order: 4, Unit: "Repeating yourself", Title: "Counting with 🔁",
+		Explanation:    "🔁 repeats a block. It takes three parts: where to start, when to keep going (⬇️ means \"less than\") and how to step.",
+		StarterCode:    "🔁 (🔢 i = 1; i ⬇️ 4; i➕➕) {\n  \n}",
+		Solution:       "🔁 (🔢 i = 1; i ⬇️ 4; i➕➕) {\n  📝(i)\n}",
+		ExpectedOutput: "1\n2\n3",
+		Hints:          []string{"The loop runs once for each value of i.", "Print i inside the braces."},
+		Syntax:         "emoji", TargetLanguage: "javascript",
+	},
+	{
+		ID: "while-loops", Order: 5, Unit: "Repeating yourself", Title: "Looping while 🔄",
+		Explanation:    "🔄 keeps running its block for as long as the condition stays true, so the block has to change something or it never stops.",
+		StarterCode:    "🔢 countdown = 3\n🔄 (countdown ⬆️ 0) {\n  📝(countdown)\n}\n📝(\"Liftoff!\")",
+		Solution:       "🔢 countdown = 3\n🔄 (countdown ⬆️ 0) {\n  📝(countdown)\n  countdown = countdown ➖ 1\n}\n📝(\"Liftoff!\")",
+		ExpectedOutput: "3\n2\n1\nLiftoff!",
+		Hints:          []string{"As written, countdown never changes, so the loop never ends.", "Subtract 1 from countdown at the end of the block."},
+		Syntax:         "emoji", TargetLanguage: "javascript",
+	},
+	{
+		ID: "functions", Order: 6, Unit: "Functions", Title: "Reusable recipes",
+		Explanation:    "🎯 defines a function: a named recipe that takes inputs in parentheses and hands a result back with 🔙.",
+		StarterCode:    "🎯 square(n) {\n  \n}\n\n📝(square(4))",
+		Solution:       "🎯 square(n) {\n  🔙 n ✖️ n\n}\n\n📝(square(4))",
+		ExpectedOutput: "16",
+		Hints:          []string{"✖️ multiplies.", "Use 🔙 to hand the answer back."},
+		Syntax:         "emoji", TargetLanguage: "javascript",
+	},
+	{
+		ID: "arrays", Order: 7, Unit: "Collections", Title: "Lists of things",
+		Explanation:    "Square brackets hold a list. .map builds a new list by running an arrow function (➡️) on every item.",
+		StarterCode:    "📦 prices = [2, 5, 10]\n📦 doubled = prices.map(p ➡️ p)\n📝(doubled)",
+		Solution:       "📦 prices = [2, 5, 10]\n📦 doubled = prices.map(p ➡️ p ✖️ 2)\n📝(doubled)",
+		ExpectedOutput: "[ 4, 10, 20 ]",
+		Hints:          []string{"The arrow function decides what each item becomes.", "Multiply p by 2."},
+		Syntax:         "emoji", TargetLanguage: "javascript",
+	},
+	{
+		ID: "classes", Order: 8, Unit: "Objects", Title: "Blueprints with 🔐",
+		Explanation:    "🔐 defines a class, a blueprint for objects. 🔧 sets up each new object, 🎭 is the object being built, and 🎁 makes one.",
+		StarterCode:    "🔐 Pet {\n  🔧(name) {\n    🎭.name = name\n  }\n  speak() {\n    🔙 \"...\"\n  }\n}\n\n📦 pet = 🎁 Pet(\"Rex\")\n📝(pet.speak())",
+		Solution:       "🔐 Pet {\n  🔧(name) {\n    🎭.name = name\n  }\n  speak() {\n    🔙 🎭.name ➕ \" says hi\"\n  }\n}\n\n📦 pet = 🎁 Pet(\"Rex\")\n📝(pet.speak())",
+		ExpectedOutput: "Rex says hi",
+		Hints:          []string{"Inside speak, 🎭.name is the pet's name.", "➕ joins text together."},
+		Syntax:         "emoji", TargetLanguage: "javascript",
+	},
+	{
+		ID: "markup-hello", Order: 1, Unit: "Getting started", Title: "Printing with tags",
+		Explanation:    "In markup syntax every statement is a tag. <print> prints the expression between its opening and closing tags.",
+		StarterCode:    "<print></print>",
+		Solution:       "<print>\"Hello, World!\"</print>",
+		ExpectedOutput: "Hello, World!",
+		Hints:          []string{"Text needs quotes inside the tag."},
+		Syntax:         "markup", TargetLanguage: "javascript",
+	},
+	{
+		ID: "markup-variables", Order: 2, Unit: "Getting started", Title: "Declaring values",
+		Explanation:    "<const> and <let> declare values with name and value attributes. The value attribute holds an expression, so text needs its own quotes.",
+		StarterCode:    "<const name=\"greeting\" value=\"'Hi'\"/>\n<let name=\"count\" value=\"2\"/>",
+		Solution:       "<const name=\"greeting\" value=\"'Hi'\"/>\n<let name=\"count\" value=\"2\"/>\n<print>greeting + \" x\" + count</print>",
+		ExpectedOutput: "Hi x2",
+		Hints:          []string{"Use <print> with an expression that joins the two values.", "+ joins text and numbers."},
+		Syntax:         "markup", TargetLanguage: "javascript",
+	},
+	{
+		ID: "markup-loops", Order: 3, Unit: "Repeating yourself", Title: "Loops as tags",
+		Explanation:    "<loop var=\"i\" from=\"0\" to=\"3\"> counts i from 0 up to, but not including, 3.",
+		StarterCode:    "<loop var=\"i\" from=\"0\" to=\"3\">\n</loop>",
+		Solution:       "<loop var=\"i\" from=\"0\" to=\"3\">\n  <print>i</print>\n</loop>",
+		ExpectedOutput: "0\n1\n2",
+		Hints:          []string{"Put a <print> inside the loop."},
+		Syntax:         "markup", TargetLanguage: "javascript",
+	},
+	{
+		ID: "markup-functions", Order: 4, Unit: "Functions", Title: "Function tags",
+		Explanation:    "<function> takes a name and a comma-separated params list; <return> hands a value back to the caller.",
+		StarterCode:    "<function name=\"add\" params=\"a, b\">\n</function>\n<print>add(2, 3)</print>",
+		Solution:       "<function name=\"add\" params=\"a, b\">\n  <return>a + b</return>\n</function>\n<print>add(2, 3)</print>",
+		ExpectedOutput: "5",
+		Hints:          []string{"Wrap the result in <return>...</return>."},
+		Syntax:         "markup", TargetLanguage: "javascript",
+	},
+}
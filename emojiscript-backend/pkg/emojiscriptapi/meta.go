@@ -0,0 +1,113 @@
+package emojiscriptapi
+
+import (
+	"net/http"
+	"runtime/debug"
+
+	"emojiscript-backend/pkg/apikey"
+	"emojiscript-backend/pkg/degrade"
+	"emojiscript-backend/pkg/service"
+	"emojiscript-backend/pkg/transpiler"
+)
+
+// MetaResponse describes what this deployment can do, so clients can
+// adapt to it rather than assume the defaults
+type MetaResponse struct {
+	Version string `json:"version"`
+	// Commit is the git revision the server was built from, when known
+	Commit string `json:"commit,omitempty"`
+	// Targets are the languages /transpile generates
+	Targets []string `json:"targets"`
+	// Flags name the optional behaviours this deployment turns on:
+	// strictPrivacy, normalizedCacheKeys, remoteCache, asyncJobs and
+	// snippetScans
+	Flags []string `json:"flags"`
+	// MaxCodeLength is the longest program accepted in bytes, and
+	// MaxCodeCharacters in characters, counting an emoji once
+	MaxCodeLength     int `json:"maxCodeLength"`
+	MaxCodeCharacters int `json:"maxCodeCharacters"`
+	// MaxOutputLength is the most output, in bytes, one transpile may
+	// generate; a request's outputLimit can only lower it
+	MaxOutputLength int `json:"maxOutputLength"`
+	// ComplexityBudget is the most a program may cost to parse
+	ComplexityBudget int `json:"complexityBudget"`
+	// AsyncThreshold is the /transpile body size, in bytes, above which a
+	// request becomes a job; zero when every request is synchronous
+	AsyncThreshold int            `json:"asyncThreshold"`
+	RateLimits     MetaRateLimits `json:"rateLimits"`
+	// Degraded lists the optional subsystems that are down: remoteCache,
+	// snippets or sandbox. Transpiling and validating work regardless.
+	Degraded []degrade.Feature `json:"degraded"`
+}
+
+// MetaRateLimits are the default request limits. A zero per-minute limit
+// is unlimited.
+type MetaRateLimits struct {
+	// Anonymous is the limit of clients without an API key, and Tiers
+	// those of the API key tiers
+	Anonymous            apikey.Tier   `json:"anonymous"`
+	Tiers                []apikey.Tier `json:"tiers"`
+	SnippetsPerMinute    int           `json:"snippetsPerMinute"`
+	SubmissionsPerMinute int           `json:"submissionsPerMinute"`
+	WebhooksPerMinute    int           `json:"webhooksPerMinute"`
+}
+
+// buildCommit is the revision the Go toolchain stamped the binary with,
+// marked "-dirty" for a tree with uncommitted changes, or "" when the
+// build wasn't made from a checkout
+func buildCommit() string {
+	info, ok := debug.ReadBuildInfo()
+	if !ok {
+		return ""
+	}
+	var revision, modified string
+	for _, setting := range info.Settings {
+		switch setting.Key {
+		case "vcs.revision":
+			revision = setting.Value
+		case "vcs.modified":
+			modified = setting.Value
+		}
+	}
+	if revision != "" && modified == "true" {
+		revision += "-dirty"
+	}
+	return revision
+}
+
+func (h *handler) handleMeta(w http.ResponseWriter, r *http.Request) {
+	commit := h.opts.Commit
+	if commit == "" {
+		commit = buildCommit()
+	}
+	flags := h.svc.Flags()
+	if h.opts.AsyncThreshold > 0 {
+		flags = append(flags, "asyncJobs")
+	}
+	if len(h.opts.SnippetScans) > 0 {
+		flags = append(flags, "snippetScans")
+	}
+	limits := MetaRateLimits{Anonymous: apikey.Anonymous, Tiers: apikey.Tiers}
+	if h.snippetLimit != nil {
+		limits.SnippetsPerMinute = h.opts.SnippetRateLimit
+	}
+	if h.submissionLimit != nil {
+		limits.SubmissionsPerMinute = h.opts.SubmissionRateLimit
+	}
+	if h.webhookLimit != nil {
+		limits.WebhooksPerMinute = h.opts.WebhookRateLimit
+	}
+	writeJSON(w, http.StatusOK, MetaResponse{
+		Version:           transpiler.Version,
+		Commit:            commit,
+		Targets:           service.Targets(),
+		Flags:             flags,
+		MaxCodeLength:     h.svc.MaxCodeLength(),
+		MaxCodeCharacters: h.svc.MaxCodeCharacters(),
+		MaxOutputLength:   h.svc.MaxOutputLength(),
+		ComplexityBudget:  h.svc.ComplexityBudget(),
+		AsyncThreshold:    h.opts.AsyncThreshold,
+		RateLimits:        limits,
+		Degraded:          h.svc.Health().Features(),
+	})
+}
@@ -0,0 +1,305 @@
+package emojiscriptapi
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"emojiscript-backend/pkg/kvcache"
+	"emojiscript-backend/pkg/requestid"
+	"emojiscript-backend/pkg/service"
+	"emojiscript-backend/pkg/transpiler"
+)
+
+const (
+	// MaxSnippetFlags caps the flags kept for one snippet
+	MaxSnippetFlags = 50
+	// MaxFlagNoteLength caps a flag's note, in bytes
+	MaxFlagNoteLength = 500
+	// SnippetBanTTL is how long a ban lasts in the remote store
+	SnippetBanTTL = 365 * 24 * time.Hour
+	// remoteBanPrefix namespaces bans in a shared store
+	remoteBanPrefix = "emojiscript:snippet-ban:"
+)
+
+// flagReasons are the reasons a snippet may be flagged for
+var flagReasons = map[string]bool{"spam": true, "abuse": true, "malicious": true, "other": true}
+
+// errReviewQueueFull refuses a flag for a new snippet once MaxSnippets
+// snippets are waiting for review
+var errReviewQueueFull = errors.New("the review queue is full, try again later")
+
+type FlagRequest struct {
+	// Reason is spam, abuse, malicious or other
+	Reason string `json:"reason"`
+	Note   string `json:"note,omitempty"`
+}
+
+// SnippetFlag is one report of a snippet, waiting for an admin's review
+type SnippetFlag struct {
+	Reason    string    `json:"reason"`
+	Note      string    `json:"note,omitempty"`
+	FlaggedAt time.Time `json:"flaggedAt"`
+	// client is who flagged it, so each client counts once
+	client string
+}
+
+type FlaggedSnippet struct {
+	ID string `json:"id"`
+	// Snippet is nil once the snippet has expired
+	Snippet *Snippet      `json:"snippet,omitempty"`
+	Flags   []SnippetFlag `json:"flags"`
+}
+
+// SnippetBan keeps a program from being saved as a snippet again. Hash is
+// of the normalized source, so layout and comments don't get around it.
+type SnippetBan struct {
+	Hash      string    `json:"hash"`
+	SnippetID string    `json:"snippetId,omitempty"`
+	Reason    string    `json:"reason,omitempty"`
+	BannedAt  time.Time `json:"bannedAt"`
+}
+
+type TakedownRequest struct {
+	Reason string `json:"reason,omitempty"`
+}
+
+// moderationStore keeps the flags waiting for review and the banned
+// programs. Flags are kept in memory, so each instance has its own review
+// queue; bans are also written to the handler's Storage or RemoteCache,
+// when it has one, so every instance refuses a banned program.
+type moderationStore struct {
+	mu     sync.Mutex
+	flags  map[string][]SnippetFlag
+	bans   map[string]SnippetBan
+	remote kvcache.Store
+}
+
+func newModerationStore(remote kvcache.Store) *moderationStore {
+	return &moderationStore{flags: map[string][]SnippetFlag{}, bans: map[string]SnippetBan{}, remote: remote}
+}
+
+// banHash identifies a program for the ban list
+func banHash(code string) string {
+	sum := sha256.Sum256([]byte(transpiler.NormalizeSource(code)))
+	return hex.EncodeToString(sum[:])
+}
+
+// flag records a report of the snippet id, once per client
+func (m *moderationStore) flag(id string, flag SnippetFlag) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	flags, queued := m.flags[id]
+	if !queued && len(m.flags) >= MaxSnippets {
+		return errReviewQueueFull
+	}
+	for _, existing := range flags {
+		if existing.client == flag.client {
+			return nil
+		}
+	}
+	if len(flags) < MaxSnippetFlags {
+		m.flags[id] = append(flags, flag)
+	}
+	return nil
+}
+
+// dismiss clears a snippet's flags, reporting whether it had any
+func (m *moderationStore) dismiss(id string) bool {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	_, queued := m.flags[id]
+	delete(m.flags, id)
+	return queued
+}
+
+// flagged returns the flags of each snippet waiting for review, by
+// snippet id
+func (m *moderationStore) flagged() map[string][]SnippetFlag {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	flagged := make(map[string][]SnippetFlag, len(m.flags))
+	for id, flags := range m.flags {
+		flagged[id] = append([]SnippetFlag{}, flags...)
+	}
+	return flagged
+}
+
+// ban adds a program to the ban list
+func (m *moderationStore) ban(ctx context.Context, ban SnippetBan) {
+	m.mu.Lock()
+	m.bans[ban.Hash] = ban
+	m.mu.Unlock()
+	m.saveBan(ctx, ban.Hash, ban)
+}
+
+// unban takes a program off the ban list, reporting whether this instance
+// knew of the ban
+func (m *moderationStore) unban(ctx context.Context, hash string) bool {
+	m.mu.Lock()
+	_, banned := m.bans[hash]
+	delete(m.bans, hash)
+	m.mu.Unlock()
+	// a ban without a hash lifts one another instance made
+	m.saveBan(ctx, hash, SnippetBan{})
+	return banned
+}
+
+func (m *moderationStore) saveBan(ctx context.Context, hash string, ban SnippetBan) {
+	if m.remote == nil {
+		return
+	}
+	value, _ := json.Marshal(ban)
+	ctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), service.RemoteTimeout)
+	defer cancel()
+	if err := m.remote.Set(ctx, remoteBanPrefix+hash, value, SnippetBanTTL); err != nil {
+		requestid.Printf(ctx, "moderation: %v", err)
+	}
+}
+
+// isBanned reports whether this instance knows of a ban with hash
+func (m *moderationStore) isBanned(hash string) bool {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	_, banned := m.bans[hash]
+	return banned
+}
+
+// banned reports whether code is on the ban list, asking the remote store
+// when this instance doesn't know of a ban
+func (m *moderationStore) banned(ctx context.Context, code string) bool {
+	hash := banHash(code)
+	m.mu.Lock()
+	_, banned := m.bans[hash]
+	m.mu.Unlock()
+	if banned || m.remote == nil {
+		return banned
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, service.RemoteTimeout)
+	defer cancel()
+	value, found, err := m.remote.Get(ctx, remoteBanPrefix+hash)
+	if err != nil {
+		requestid.Printf(ctx, "moderation: %v", err)
+	}
+	var ban SnippetBan
+	return found && json.Unmarshal(value, &ban) == nil && ban.Hash != ""
+}
+
+// list returns the bans this instance knows of, newest first
+func (m *moderationStore) list() []SnippetBan {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	bans := make([]SnippetBan, 0, len(m.bans))
+	for _, ban := range m.bans {
+		bans = append(bans, ban)
+	}
+	sort.Slice(bans, func(i, j int) bool { return bans[i].BannedAt.After(bans[j].BannedAt) })
+	return bans
+}
+
+// handleFlagSnippet reports a snippet for an admin to review
+func (h *handler) handleFlagSnippet(w http.ResponseWriter, r *http.Request) {
+	// the id is kept after the request, whose buffers a server like Fiber
+	// reuses
+	id := strings.Clone(r.PathValue("id"))
+	if _, found := h.snippets.get(r.Context(), id); !found {
+		h.snippetMissing(w)
+		return
+	}
+	var req FlagRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeJSON(w, http.StatusBadRequest, errorBody{Error: "Invalid request"})
+		return
+	}
+	if !flagReasons[req.Reason] {
+		writeJSON(w, http.StatusBadRequest, errorBody{Error: "reason must be spam, abuse, malicious or other"})
+		return
+	}
+	if len(req.Note) > MaxFlagNoteLength {
+		writeJSON(w, http.StatusBadRequest, errorBody{Error: fmt.Sprintf("note must be at most %d bytes", MaxFlagNoteLength)})
+		return
+	}
+
+	flag := SnippetFlag{Reason: req.Reason, Note: req.Note, FlaggedAt: time.Now().UTC(), client: h.limitedClient(r)}
+	if err := h.moderation.flag(id, flag); err != nil {
+		w.Header().Set("Retry-After", "60")
+		writeJSON(w, http.StatusServiceUnavailable, errorBody{Error: err.Error()})
+		return
+	}
+	writeJSON(w, http.StatusAccepted, map[string]interface{}{"success": true})
+}
+
+// handleFlaggedSnippets lists the flagged snippets for review, most
+// flagged first
+func (h *handler) handleFlaggedSnippets(w http.ResponseWriter, r *http.Request) {
+	queue := []FlaggedSnippet{}
+	for id, flags := range h.moderation.flagged() {
+		flagged := FlaggedSnippet{ID: id, Flags: flags}
+		if snippet, found := h.snippets.get(r.Context(), id); found {
+			flagged.Snippet = &snippet
+		}
+		queue = append(queue, flagged)
+	}
+	sort.Slice(queue, func(i, j int) bool {
+		if len(queue[i].Flags) != len(queue[j].Flags) {
+			return len(queue[i].Flags) > len(queue[j].Flags)
+		}
+		return queue[i].Flags[0].FlaggedAt.Before(queue[j].Flags[0].FlaggedAt)
+	})
+	writeJSON(w, http.StatusOK, map[string]interface{}{"snippets": queue})
+}
+
+// handleDismissFlags clears a snippet's flags once it has been reviewed
+// and kept
+func (h *handler) handleDismissFlags(w http.ResponseWriter, r *http.Request) {
+	if !h.moderation.dismiss(r.PathValue("id")) {
+		writeJSON(w, http.StatusNotFound, errorBody{Error: "Snippet has no flags"})
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// handleTakedownSnippet removes a snippet, clears its flags and bans its
+// program, so saving it again is refused
+func (h *handler) handleTakedownSnippet(w http.ResponseWriter, r *http.Request) {
+	id := strings.Clone(r.PathValue("id"))
+	snippet, found := h.snippets.get(r.Context(), id)
+	if !found {
+		writeJSON(w, http.StatusNotFound, errorBody{Error: "Snippet not found"})
+		return
+	}
+	// the reason is optional, so an empty body is fine
+	var req TakedownRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil && !errors.Is(err, io.EOF) {
+		writeJSON(w, http.StatusBadRequest, errorBody{Error: "Invalid request"})
+		return
+	}
+
+	ban := SnippetBan{Hash: banHash(snippet.Code), SnippetID: id, Reason: req.Reason, BannedAt: time.Now().UTC()}
+	h.snippets.remove(r.Context(), id)
+	h.moderation.dismiss(id)
+	h.moderation.ban(r.Context(), ban)
+	writeJSON(w, http.StatusOK, ban)
+}
+
+func (h *handler) handleSnippetBans(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, map[string]interface{}{"bans": h.moderation.list()})
+}
+
+func (h *handler) handleUnbanSnippet(w http.ResponseWriter, r *http.Request) {
+	if !h.moderation.unban(r.Context(), r.PathValue("hash")) && h.moderation.remote == nil {
+		writeJSON(w, http.StatusNotFound, errorBody{Error: "Ban not found"})
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,88 @@
+package emojiscriptapi
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// TestModeration walks a snippet through being flagged, reviewed and
+// taken down, and checks that its program can't be saved again until the
+// ban is lifted
+func TestModeration(t *testing.T) {
+	api := NewHandler(Options{Prefix: DefaultPrefix, AdminToken: "secret"})
+	call := func(method, path, client, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, DefaultPrefix+path, strings.NewReader(body))
+		req.RemoteAddr = client + ":1234"
+		if strings.HasPrefix(path, "/admin/") {
+			req.Header.Set("Authorization", "Bearer secret")
+		}
+		rec := httptest.NewRecorder()
+		api.ServeHTTP(rec, req)
+		return rec
+	}
+	var created SnippetResponse
+	rec := call("POST", "/snippets", "192.0.2.1", `{"code": "📝(\"spam\")"}`)
+	if err := json.Unmarshal(rec.Body.Bytes(), &created); err != nil || rec.Code != http.StatusCreated {
+		t.Fatalf("got %d %s, want the snippet saved", rec.Code, rec.Body)
+	}
+	id := created.ID
+
+	for _, tt := range []struct {
+		method, path, client, body string
+		want                       int
+	}{
+		{"POST", "/snippets/" + id + "/flag", "192.0.2.2", `{"reason": "rude"}`, http.StatusBadRequest},
+		{"POST", "/snippets/" + id + "/flag", "192.0.2.2", `{"reason": "other", "note": "` + strings.Repeat("x", MaxFlagNoteLength+1) + `"}`, http.StatusBadRequest},
+		{"POST", "/snippets/missing/flag", "192.0.2.2", `{"reason": "spam"}`, http.StatusNotFound},
+		{"POST", "/snippets/" + id + "/flag", "192.0.2.2", `{"reason": "spam"}`, http.StatusAccepted},
+		{"POST", "/snippets/" + id + "/flag", "192.0.2.2", `{"reason": "abuse"}`, http.StatusAccepted},
+		{"POST", "/snippets/" + id + "/flag", "192.0.2.3", `{"reason": "spam", "note": "ads"}`, http.StatusAccepted},
+	} {
+		if rec := call(tt.method, tt.path, tt.client, tt.body); rec.Code != tt.want {
+			t.Errorf("%s %s from %s: got %d, want %d: %s", tt.method, tt.path, tt.client, rec.Code, tt.want, rec.Body)
+		}
+	}
+
+	var queue struct{ Snippets []FlaggedSnippet }
+	json.Unmarshal(call("GET", "/admin/snippets/flagged", "", "").Body.Bytes(), &queue)
+	if len(queue.Snippets) != 1 || queue.Snippets[0].ID != id || len(queue.Snippets[0].Flags) != 2 || queue.Snippets[0].Snippet == nil {
+		t.Fatalf("got review queue %+v, want the snippet with one flag per client", queue.Snippets)
+	}
+
+	for _, tt := range []struct {
+		method, path, body string
+		want               int
+	}{
+		{"DELETE", "/admin/snippets/" + id + "/flags", "", http.StatusNoContent},
+		{"DELETE", "/admin/snippets/" + id + "/flags", "", http.StatusNotFound},
+		{"DELETE", "/admin/snippets/missing", "", http.StatusNotFound},
+		{"DELETE", "/admin/snippets/" + id, `{"reason": "spam"}`, http.StatusOK},
+		{"GET", "/snippets/" + id, "", http.StatusNotFound},
+		{"POST", "/snippets", `{"code": "📝(\"spam\")  // again"}`, http.StatusForbidden},
+	} {
+		if rec := call(tt.method, tt.path, "192.0.2.1", tt.body); rec.Code != tt.want {
+			t.Errorf("%s %s %s: got %d, want %d: %s", tt.method, tt.path, tt.body, rec.Code, tt.want, rec.Body)
+		}
+	}
+
+	var bans struct{ Bans []SnippetBan }
+	json.Unmarshal(call("GET", "/admin/snippet-bans", "", "").Body.Bytes(), &bans)
+	if len(bans.Bans) != 1 || bans.Bans[0].SnippetID != id || bans.Bans[0].Reason != "spam" {
+		t.Fatalf("got bans %+v, want the snippet's", bans.Bans)
+	}
+	for _, tt := range []struct {
+		method, path, body string
+		want               int
+	}{
+		{"DELETE", "/admin/snippet-bans/" + bans.Bans[0].Hash, "", http.StatusNoContent},
+		{"DELETE", "/admin/snippet-bans/" + bans.Bans[0].Hash, "", http.StatusNotFound},
+		{"POST", "/snippets", `{"code": "📝(\"spam\")"}`, http.StatusCreated},
+	} {
+		if rec := call(tt.method, tt.path, "192.0.2.1", tt.body); rec.Code != tt.want {
+			t.Errorf("%s %s %s: got %d, want %d: %s", tt.method, tt.path, tt.body, rec.Code, tt.want, rec.Body)
+		}
+	}
+}
@@ -0,0 +1,203 @@
+package emojiscriptapi
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+
+	"emojiscript-backend/pkg/hints"
+	"emojiscript-backend/pkg/notebook"
+	"emojiscript-backend/pkg/sandbox"
+	"emojiscript-backend/pkg/service"
+	"emojiscript-backend/pkg/usage"
+)
+
+type NotebookRequest struct {
+	Cells []notebook.Cell `json:"cells"`
+}
+
+type CellRequest struct {
+	// Source, when set, replaces the cell's source before it's transpiled
+	// or run, as an editor sends its latest text
+	Source *string `json:"source,omitempty"`
+	// TargetLanguage is what a transpile writes; javascript by default
+	TargetLanguage string `json:"targetLanguage,omitempty"`
+	// Stdin is fed to a run, one prompt() per line
+	Stdin string `json:"stdin,omitempty"`
+}
+
+type CellRunResponse struct {
+	Success    bool          `json:"success"`
+	Cell       notebook.Cell `json:"cell"`
+	JavaScript string        `json:"javascript,omitempty"`
+	Errors     []string      `json:"errors,omitempty"`
+	Warnings   []string      `json:"warnings,omitempty"`
+	Hints      []hints.Hint  `json:"hints,omitempty"`
+}
+
+// writeNotebookError answers a request the notebook store refused
+func writeNotebookError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, notebook.ErrNotFound), errors.Is(err, notebook.ErrCellNotFound):
+		writeJSON(w, http.StatusNotFound, errorBody{Error: err.Error()})
+	case errors.Is(err, notebook.ErrNotCode):
+		writeJSON(w, http.StatusBadRequest, errorBody{Error: err.Error()})
+	case errors.Is(err, notebook.ErrFull):
+		w.Header().Set("Retry-After", "60")
+		writeJSON(w, http.StatusServiceUnavailable, errorBody{Error: err.Error()})
+	default:
+		writeJSON(w, http.StatusInternalServerError, errorBody{Error: err.Error()})
+	}
+}
+
+// decodeCells reads and validates a notebook's cells
+func (h *handler) decodeCells(w http.ResponseWriter, r *http.Request) ([]notebook.Cell, bool) {
+	var req NotebookRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeJSON(w, http.StatusBadRequest, errorBody{Error: "Invalid request"})
+		return nil, false
+	}
+	cells, err := notebook.Validate(req.Cells)
+	if err != nil {
+		writeJSON(w, http.StatusBadRequest, errorBody{Error: err.Error()})
+		return nil, false
+	}
+	for _, cell := range cells {
+		if err := h.svc.CheckLength(cell.Source); err != nil {
+			writeJSON(w, http.StatusBadRequest, errorBody{Error: "cell " + cell.ID + ": " + err.Error()})
+			return nil, false
+		}
+	}
+	return cells, true
+}
+
+// handleCreateNotebook opens a notebook with its own sandbox session
+func (h *handler) handleCreateNotebook(w http.ResponseWriter, r *http.Request) {
+	cells, ok := h.decodeCells(w, r)
+	if !ok {
+		return
+	}
+	nb, err := h.notebooks.Create(cells)
+	if err != nil {
+		writeNotebookError(w, err)
+		return
+	}
+	w.Header().Set("Location", h.opts.Prefix+"/notebooks/"+nb.ID)
+	writeJSON(w, http.StatusCreated, nb)
+}
+
+func (h *handler) handleNotebook(w http.ResponseWriter, r *http.Request) {
+	nb, err := h.notebooks.Get(r.PathValue("id"))
+	if err != nil {
+		writeNotebookError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, nb)
+}
+
+// handlePutNotebook replaces a notebook's cells, as when cells are added,
+// removed or reordered, without restarting its session
+func (h *handler) handlePutNotebook(w http.ResponseWriter, r *http.Request) {
+	cells, ok := h.decodeCells(w, r)
+	if !ok {
+		return
+	}
+	nb, err := h.notebooks.Replace(r.PathValue("id"), cells)
+	if err != nil {
+		writeNotebookError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, nb)
+}
+
+func (h *handler) handleDeleteNotebook(w http.ResponseWriter, r *http.Request) {
+	if !h.notebooks.Delete(r.PathValue("id")) {
+		writeNotebookError(w, notebook.ErrNotFound)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// handleRestartNotebook starts the notebook's session over, forgetting
+// what its cells declared
+func (h *handler) handleRestartNotebook(w http.ResponseWriter, r *http.Request) {
+	nb, err := h.notebooks.Restart(r.PathValue("id"))
+	if err != nil {
+		writeNotebookError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, nb)
+}
+
+// cellRequest decodes a cell request and looks up its cell
+func (h *handler) cellRequest(w http.ResponseWriter, r *http.Request) (CellRequest, notebook.Cell, *sandbox.Session, bool) {
+	var req CellRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil && !errors.Is(err, io.EOF) {
+		writeJSON(w, http.StatusBadRequest, errorBody{Error: "Invalid request"})
+		return req, notebook.Cell{}, nil, false
+	}
+	cell, session, err := h.notebooks.Cell(r.PathValue("id"), r.PathValue("cell"), req.Source)
+	if err != nil {
+		writeNotebookError(w, err)
+		return req, notebook.Cell{}, nil, false
+	}
+	return req, cell, session, true
+}
+
+// handleTranspileCell transpiles one code cell like /transpile
+func (h *handler) handleTranspileCell(w http.ResponseWriter, r *http.Request) {
+	req, cell, _, ok := h.cellRequest(w, r)
+	if !ok {
+		return
+	}
+	resp, err := h.svc.Transpile(service.TranspileRequest{
+		Code:           cell.Source,
+		Syntax:         cell.Syntax,
+		TargetLanguage: req.TargetLanguage,
+	}, service.Caller{SessionID: sessionID(r), Pipeline: h.pipeline(r)})
+	usage.FromContext(r.Context()).Transpiled(1)
+	writeJSON(w, service.Status(err), resp)
+}
+
+// handleRunCell runs one code cell in the notebook's session and keeps
+// its output on the cell, numbered like a Jupyter cell's
+func (h *handler) handleRunCell(w http.ResponseWriter, r *http.Request) {
+	req, cell, session, ok := h.cellRequest(w, r)
+	if !ok {
+		return
+	}
+	if err := h.svc.ValidateInput(cell.Source); err != nil {
+		writeJSON(w, http.StatusBadRequest, CellRunResponse{Cell: cell, Errors: []string{err.Error()}, Hints: hints.For([]string{err.Error()}, cell.Source)})
+		return
+	}
+	output, warnings, errs := h.compileJavaScript(r.Context(), cell.Source, "", cell.Syntax == notebook.Markup)
+	if len(errs) > 0 {
+		writeJSON(w, http.StatusBadRequest, CellRunResponse{Cell: cell, Errors: errs, Warnings: warnings, Hints: hints.For(errs, cell.Source)})
+		return
+	}
+
+	result := session.Run(output, sandbox.Options{Stdin: req.Stdin, Values: true, MaxMemory: notebook.MaxSessionMemory})
+	usage.FromContext(r.Context()).Sandboxed(result.Duration)
+	values := result.Values
+	if values == nil {
+		values = []sandbox.LineValue{}
+	}
+	cell, err := h.notebooks.Record(r.PathValue("id"), cell.ID, session, notebook.Output{
+		Stdout:    result.Stdout,
+		Values:    values,
+		Error:     result.Error,
+		ErrorLine: result.ErrorLine,
+	})
+	if err != nil {
+		writeNotebookError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, CellRunResponse{
+		Success:    result.Error == "",
+		Cell:       cell,
+		JavaScript: output,
+		Warnings:   warnings,
+		Hints:      runtimeHints(result, cell.Source),
+	})
+}
@@ -0,0 +1,42 @@
+package emojiscriptapi
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"emojiscript-backend/pkg/service"
+	"emojiscript-backend/pkg/transpiler"
+)
+
+type OutlineRequest struct {
+	Code      string `json:"code"`
+	UseMarkup bool   `json:"useMarkup,omitempty"`
+}
+
+type OutlineResponse struct {
+	Success    bool                     `json:"success"`
+	UsedMarkup bool                     `json:"usedMarkup,omitempty"`
+	Outline    []transpiler.OutlineItem `json:"outline"`
+}
+
+// handleOutline returns a program's declarations as a tree with their
+// ranges, for outline panels and minimaps. Like /symbols it works on
+// programs with errors, outlining what it can parse.
+func (h *handler) handleOutline(w http.ResponseWriter, r *http.Request) {
+	var req OutlineRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeJSON(w, http.StatusBadRequest, errorBody{Error: "Invalid request"})
+		return
+	}
+	if err := h.svc.ValidateInput(req.Code); err != nil {
+		writeJSON(w, http.StatusBadRequest, errorBody{Error: err.Error()})
+		return
+	}
+
+	markup := req.UseMarkup || service.DetectMarkupSyntax(req.Code)
+	outline := transpiler.Outline(req.Code, markup)
+	if outline == nil {
+		outline = []transpiler.OutlineItem{}
+	}
+	writeJSON(w, http.StatusOK, OutlineResponse{Success: true, UsedMarkup: markup, Outline: outline})
+}
@@ -0,0 +1,73 @@
+package emojiscriptapi
+
+import (
+	"net/http"
+	"strings"
+
+	"emojiscript-backend/pkg/preview"
+)
+
+// handleSnippetPreview serves a snippet's social-preview card, the image
+// link unfurlers show for an embed URL. ?format= is png (the default,
+// which every unfurler accepts) or svg, and ?theme= and ?accent= work as
+// they do for the viewer.
+func (h *handler) handleSnippetPreview(w http.ResponseWriter, r *http.Request) {
+	snippet, found := h.snippets.get(r.Context(), r.PathValue("id"))
+	if !found {
+		h.snippetMissing(w)
+		return
+	}
+
+	query := r.URL.Query()
+	card := preview.Card{
+		Title:    "EmojiScript snippet " + snippet.ID,
+		Language: snippetLanguage(snippet),
+		Code:     snippet.Code,
+		Dark:     strings.ToLower(query.Get("theme")) == "dark",
+	}
+	if accent := query.Get("accent"); hexColor.MatchString(accent) {
+		card.Accent = accent
+	}
+
+	// snippets never change under an id, so cards can be cached for long
+	w.Header().Set("Cache-Control", "public, max-age=86400")
+	switch query.Get("format") {
+	case "", "png":
+		image, err := preview.PNG(card)
+		if err != nil {
+			writeJSON(w, http.StatusInternalServerError, errorBody{Error: "Failed to render preview"})
+			return
+		}
+		w.Header().Set("Content-Type", "image/png")
+		w.Write(image)
+	case "svg":
+		w.Header().Set("Content-Type", "image/svg+xml")
+		w.Write([]byte(preview.SVG(card)))
+	default:
+		writeJSON(w, http.StatusBadRequest, errorBody{Error: "format must be png or svg"})
+	}
+}
+
+// snippetLanguage labels a snippet's syntax and dialect
+func snippetLanguage(snippet Snippet) string {
+	language := "EmojiScript"
+	if snippet.UseMarkup {
+		language = "EmojiScript markup"
+	}
+	if snippet.Dialect != "" {
+		language += " · " + snippet.Dialect
+	}
+	return language
+}
+
+// absoluteURL makes path absolute on the host the request reached, since
+// unfurlers only follow absolute image URLs
+func absoluteURL(r *http.Request, path string) string {
+	scheme := "https"
+	if proto := r.Header.Get("X-Forwarded-Proto"); proto != "" {
+		scheme = proto
+	} else if r.TLS == nil {
+		scheme = "http"
+	}
+	return scheme + "://" + r.Host + path
+}
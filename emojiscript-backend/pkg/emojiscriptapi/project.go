@@ -0,0 +1,105 @@
+package emojiscriptapi
+
+import (
+	"archive/zip"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"slices"
+	"time"
+
+	"emojiscript-backend/pkg/apikey"
+	"emojiscript-backend/pkg/project"
+	"emojiscript-backend/pkg/requestid"
+	"emojiscript-backend/pkg/transpiler"
+)
+
+// handleSnippetProject answers with the snippets saved with the caller's
+// API key as a zip laid out as an emojic project, so they can be built
+// with `emojic build`: an emoji.config.json and each snippet as
+// src/<id>.emoji. emojic doesn't read dialects, so a snippet in one is
+// written in the built-in emoji. Like the admin export, it has only the
+// snippets this instance keeps in memory, unless the handler has Storage.
+func (h *handler) handleSnippetProject(w http.ResponseWriter, r *http.Request) {
+	if r.Header.Get(apikey.Header) == "" {
+		writeJSON(w, http.StatusBadRequest, errorBody{Success: false, Error: "Missing " + apikey.Header + " header"})
+		return
+	}
+	key, ok := h.opts.APIKeys.FromRequest(r)
+	if !ok {
+		writeJSON(w, http.StatusUnauthorized, errorBody{Success: false, Error: apikey.ErrInvalidKey.Error()})
+		return
+	}
+
+	var snippets []Snippet
+	for _, snippet := range h.snippets.all(r.Context()) {
+		if slices.Contains(snippet.Owners, key.Name) {
+			snippets = append(snippets, snippet)
+		}
+	}
+	config := snippetProjectConfig(key.Name, snippets)
+	encoded, _ := json.MarshalIndent(config, "", "  ")
+
+	now := time.Now().UTC()
+	w.Header().Set("Content-Type", "application/zip")
+	w.Header().Set("Content-Disposition", fmt.Sprintf(`attachment; filename="emojiscript-snippets-%s.zip"`, now.Format("2006-01-02")))
+	w.WriteHeader(http.StatusOK)
+	archive := zip.NewWriter(w)
+	write := func(name string, modified time.Time, content string) error {
+		file, err := archive.CreateHeader(&zip.FileHeader{Name: name, Method: zip.Deflate, Modified: modified})
+		if err != nil {
+			return err
+		}
+		_, err = file.Write([]byte(content))
+		return err
+	}
+	err := write(project.ConfigFile, now, string(encoded)+"\n")
+	for _, snippet := range snippets {
+		if err != nil {
+			break
+		}
+		err = write(project.DefaultSrc+"/"+snippet.ID+".emoji", snippet.CreatedAt, h.builtinEmoji(snippet))
+	}
+	if err == nil {
+		err = archive.Close()
+	}
+	if err != nil {
+		requestid.Printf(r.Context(), "snippet project: %v", err)
+	}
+}
+
+// snippetProjectConfig is the emoji.config.json of a project of
+// snippets. Its target is the one emojic builds that most of them were
+// saved with, and the snippets saved as markup are listed as such.
+func snippetProjectConfig(name string, snippets []Snippet) project.Config {
+	config := project.Config{Name: name, Target: "javascript", Src: project.DefaultSrc, Out: project.DefaultOut}
+	targets := map[string]int{}
+	for _, snippet := range snippets {
+		if _, ok := project.Extensions[snippet.TargetLanguage]; ok {
+			targets[snippet.TargetLanguage]++
+		}
+		if snippet.Syntax == "markup" {
+			config.Markup = append(config.Markup, snippet.ID+".emoji")
+		}
+	}
+	for target, count := range targets {
+		if count > targets[config.Target] {
+			config.Target = target
+		}
+	}
+	return config
+}
+
+// builtinEmoji is a snippet's code with its dialect's emoji replaced by
+// the built-in ones; the code is kept as it is when the dialect has since
+// been deleted
+func (h *handler) builtinEmoji(snippet Snippet) string {
+	if snippet.Dialect == "" {
+		return snippet.Code
+	}
+	pack, found := h.dialects.Get(snippet.Dialect)
+	if !found {
+		return snippet.Code
+	}
+	return transpiler.ApplyAliases(snippet.Code, pack.ToBase())
+}
@@ -0,0 +1,274 @@
+package emojiscriptapi
+
+import (
+	"fmt"
+	"math/rand"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"emojiscript-backend/pkg/transpiler"
+)
+
+const (
+	DefaultQuizQuestions = 10
+	MaxQuizQuestions     = 50
+	quizChoices          = 4
+	quizBlank            = "____"
+)
+
+const (
+	QuestionMeaning = "meaning"
+	QuestionEmoji   = "emoji"
+	QuestionFillIn  = "fill-in"
+)
+
+// QuizQuestion is one multiple-choice question; Answer indexes Choices
+type QuizQuestion struct {
+	ID          int      `json:"id"`
+	Type        string   `json:"type"`
+	Prompt      string   `json:"prompt"`
+	Code        string   `json:"code,omitempty"`
+	Choices     []string `json:"choices"`
+	Answer      *int     `json:"answer,omitempty"`
+	Explanation string   `json:"explanation,omitempty"`
+}
+
+type Quiz struct {
+	Seed      int64          `json:"seed"`
+	Questions []QuizQuestion `json:"questions"`
+}
+
+// QuizOptions selects what GenerateQuiz draws from
+type QuizOptions struct {
+	Seed  int64
+	Count int
+	// Types limits the question types; all are used when empty
+	Types []string
+	// Category limits questions to one palette category, e.g. "operators"
+	Category string
+	// HideAnswers leaves out answers and explanations, for handing the
+	// quiz to students; the same seed regenerates the answer key
+	HideAnswers bool
+}
+
+// keywordMeanings explains each keyword in a few words for quiz choices
+var keywordMeanings = map[string]string{
+	"const": "declares a constant", "let": "declares a variable that can change",
+	"true": "the value true", "false": "the value false", "null": "an intentionally empty value",
+	"undefined": "a value that hasn't been set", "??=": "assigns only if the value is null or undefined",
+	"function": "defines a function", "=>": "writes an arrow function", "return": "hands a value back from a function",
+	"async": "marks a function that can wait", "await": "waits for an async result", "get": "defines a computed property",
+	"if": "runs code only when a condition is true", "else": "runs code when the if condition is false",
+	"for": "repeats code a counted number of times", "while": "repeats code while a condition is true",
+	"switch": "picks a branch by matching a value", "case": "one branch of a switch", "break": "leaves a loop or switch",
+	"continue": "skips to the loop's next round", "throw": "raises an error", "try": "runs code that might fail",
+	"catch": "handles an error from try", "finally": "always runs after try and catch",
+	"+": "adds or joins", "-": "subtracts", "*": "multiplies", "/": "divides",
+	"===": "checks two values are equal", "!==": "checks two values are different",
+	">": "greater than", "<": "less than", ">=": "greater than or equal", "<=": "less than or equal",
+	"&&": "true when both sides are true", "||": "true when either side is true", "!": "flips true and false",
+	"typeof": "asks what type a value is", "in": "checks a property exists", "delete": "removes a property",
+	"console.log": "prints to the console", "import": "brings in code from a module", "export": "shares code with other modules",
+	"new": "creates an object from a class", "class": "defines a class", "extends": "makes a class build on another",
+	"static": "belongs to the class itself", "constructor": "sets up a new object", "this": "the current object",
+	"record": "declares a simple data class",
+}
+
+func (h *handler) handleQuiz(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	opts := QuizOptions{Category: query.Get("category"), HideAnswers: query.Get("answers") == "false"}
+
+	if seed := query.Get("seed"); seed != "" {
+		parsed, err := strconv.ParseInt(seed, 10, 64)
+		if err != nil {
+			writeJSON(w, http.StatusBadRequest, errorBody{Error: "seed must be an integer"})
+			return
+		}
+		opts.Seed = parsed
+	} else {
+		opts.Seed = time.Now().UnixNano() % 1000000000
+	}
+	if count := query.Get("count"); count != "" {
+		parsed, err := strconv.Atoi(count)
+		if err != nil || parsed < 1 || parsed > MaxQuizQuestions {
+			writeJSON(w, http.StatusBadRequest, errorBody{Error: fmt.Sprintf("count must be between 1 and %d", MaxQuizQuestions)})
+			return
+		}
+		opts.Count = parsed
+	}
+	if types := query.Get("types"); types != "" {
+		for _, t := range strings.Split(types, ",") {
+			switch t = strings.TrimSpace(t); t {
+			case QuestionMeaning, QuestionEmoji, QuestionFillIn:
+				opts.Types = append(opts.Types, t)
+			default:
+				writeJSON(w, http.StatusBadRequest, errorBody{Error: fmt.Sprintf("unknown question type '%s'", t)})
+				return
+			}
+		}
+	}
+
+	quiz := GenerateQuiz(opts)
+	if len(quiz.Questions) == 0 {
+		writeJSON(w, http.StatusBadRequest, errorBody{Error: "no questions match the filters"})
+		return
+	}
+	writeJSON(w, http.StatusOK, quiz)
+}
+
+// GenerateQuiz builds a quiz from the emoji palette and the emoji-syntax
+// lessons and examples. The same options always produce the same quiz.
+func GenerateQuiz(opts QuizOptions) Quiz {
+	if opts.Count <= 0 {
+		opts.Count = DefaultQuizQuestions
+	}
+	if len(opts.Types) == 0 {
+		opts.Types = []string{QuestionMeaning, QuestionEmoji, QuestionFillIn}
+	}
+	rng := rand.New(rand.NewSource(opts.Seed))
+
+	palette := []transpiler.EmojiInfo{}
+	for _, info := range transpiler.Palette() {
+		if keywordMeanings[info.Keyword] != "" && (opts.Category == "" || info.Category == opts.Category) {
+			palette = append(palette, info)
+		}
+	}
+
+	var pool []QuizQuestion
+	for _, t := range opts.Types {
+		switch t {
+		case QuestionMeaning:
+			for _, info := range palette {
+				pool = append(pool, meaningQuestion(rng, info))
+			}
+		case QuestionEmoji:
+			for _, info := range palette {
+				pool = append(pool, emojiQuestion(rng, info))
+			}
+		case QuestionFillIn:
+			pool = append(pool, fillInQuestions(rng, palette)...)
+		}
+	}
+	rng.Shuffle(len(pool), func(i, j int) { pool[i], pool[j] = pool[j], pool[i] })
+	if len(pool) > opts.Count {
+		pool = pool[:opts.Count]
+	}
+
+	for i := range pool {
+		pool[i].ID = i + 1
+		if opts.HideAnswers {
+			pool[i].Answer = nil
+			pool[i].Explanation = ""
+		}
+	}
+	if pool == nil {
+		pool = []QuizQuestion{}
+	}
+	return Quiz{Seed: opts.Seed, Questions: pool}
+}
+
+func meaningQuestion(rng *rand.Rand, info transpiler.EmojiInfo) QuizQuestion {
+	distractors := distractorsFor(rng, info, func(other transpiler.EmojiInfo) string { return keywordMeanings[other.Keyword] })
+	choices, answer := shuffleChoices(rng, keywordMeanings[info.Keyword], distractors)
+	return QuizQuestion{
+		Type:        QuestionMeaning,
+		Prompt:      fmt.Sprintf("What does %s do?", info.Emoji),
+		Choices:     choices,
+		Answer:      &answer,
+		Explanation: explainEmoji(info),
+	}
+}
+
+func emojiQuestion(rng *rand.Rand, info transpiler.EmojiInfo) QuizQuestion {
+	distractors := distractorsFor(rng, info, func(other transpiler.EmojiInfo) string { return other.Emoji })
+	choices, answer := shuffleChoices(rng, info.Emoji, distractors)
+	return QuizQuestion{
+		Type:        QuestionEmoji,
+		Prompt:      fmt.Sprintf("Which emoji writes `%s` (%s)?", info.Keyword, keywordMeanings[info.Keyword]),
+		Choices:     choices,
+		Answer:      &answer,
+		Explanation: fmt.Sprintf("`%s` is written %s.", info.Keyword, info.Emoji),
+	}
+}
+
+// fillInQuestions blanks out one keyword emoji in each sample program
+func fillInQuestions(rng *rand.Rand, palette []transpiler.EmojiInfo) []QuizQuestion {
+	samples := []string{}
+	for _, lesson := range Lessons("", "emoji") {
+		samples = append(samples, lesson.Solution)
+	}
+	for _, example := range Examples("emoji") {
+		samples = append(samples, example.Code)
+	}
+
+	questions := []QuizQuestion{}
+	for _, code := range samples {
+		// 🟰 reads as both assignment and comparison to beginners, so
+		// programs using it make ambiguous exercises
+		if strings.Contains(code, "🟰") {
+			continue
+		}
+		candidates := []transpiler.EmojiInfo{}
+		for _, info := range palette {
+			if strings.Contains(code, info.Emoji) {
+				candidates = append(candidates, info)
+			}
+		}
+		if len(candidates) == 0 {
+			continue
+		}
+		info := candidates[rng.Intn(len(candidates))]
+		distractors := distractorsFor(rng, info, func(other transpiler.EmojiInfo) string { return other.Emoji })
+		choices, answer := shuffleChoices(rng, info.Emoji, distractors)
+		questions = append(questions, QuizQuestion{
+			Type:        QuestionFillIn,
+			Prompt:      fmt.Sprintf("Which emoji goes in every %s in this program?", quizBlank),
+			Code:        strings.ReplaceAll(code, info.Emoji, quizBlank),
+			Choices:     choices,
+			Answer:      &answer,
+			Explanation: explainEmoji(info),
+		})
+	}
+	return questions
+}
+
+func explainEmoji(info transpiler.EmojiInfo) string {
+	return fmt.Sprintf("%s is `%s`: %s.", info.Emoji, info.Keyword, keywordMeanings[info.Keyword])
+}
+
+// distractorsFor picks wrong answers, preferring the same category so the
+// choices are plausible
+func distractorsFor(rng *rand.Rand, info transpiler.EmojiInfo, value func(transpiler.EmojiInfo) string) []string {
+	var same, other []string
+	for _, candidate := range transpiler.Palette() {
+		v := value(candidate)
+		if candidate.Emoji == info.Emoji || v == "" || v == value(info) {
+			continue
+		}
+		if candidate.Category == info.Category {
+			same = append(same, v)
+		} else {
+			other = append(other, v)
+		}
+	}
+	rng.Shuffle(len(same), func(i, j int) { same[i], same[j] = same[j], same[i] })
+	rng.Shuffle(len(other), func(i, j int) { other[i], other[j] = other[j], other[i] })
+	picked := append(same, other...)
+	if len(picked) > quizChoices-1 {
+		picked = picked[:quizChoices-1]
+	}
+	return picked
+}
+
+func shuffleChoices(rng *rand.Rand, correct string, distractors []string) ([]string, int) {
+	choices := append([]string{correct}, distractors...)
+	rng.Shuffle(len(choices), func(i, j int) { choices[i], choices[j] = choices[j], choices[i] })
+	for i, choice := range choices {
+		if choice == correct {
+			return choices, i
+		}
+	}
+	return choices, 0
+}
@@ -0,0 +1,223 @@
+package emojiscriptapi
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+
+	"emojiscript-backend/pkg/refactor"
+	"emojiscript-backend/pkg/service"
+)
+
+type RenameRequest struct {
+	Code string `json:"code,omitempty"`
+	// Files renames across a project instead of Code. The files share one
+	// global scope, as scripts on a page do.
+	Files []refactor.File `json:"files,omitempty"`
+	// File names the file Line and Column point into, in project mode
+	File      string `json:"file,omitempty"`
+	Line      int    `json:"line"`
+	Column    int    `json:"column"`
+	NewName   string `json:"newName"`
+	Dialect   string `json:"dialect,omitempty"`
+	UseMarkup bool   `json:"useMarkup,omitempty"`
+}
+
+type RenameResponse struct {
+	Success bool            `json:"success"`
+	OldName string          `json:"oldName,omitempty"`
+	NewName string          `json:"newName,omitempty"`
+	Edits   []refactor.Edit `json:"edits,omitempty"`
+	// Code is the renamed source, or Files the renamed project
+	Code   string          `json:"code,omitempty"`
+	Files  []refactor.File `json:"files,omitempty"`
+	Errors []string        `json:"errors,omitempty"`
+}
+
+// handleRename renames the variable at a position, everywhere it is used
+// and nowhere else
+func (h *handler) handleRename(w http.ResponseWriter, r *http.Request) {
+	var req RenameRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeJSON(w, http.StatusBadRequest, RenameResponse{Errors: []string{"Invalid request"}})
+		return
+	}
+	project := len(req.Files) > 0
+	files := req.Files
+	if !project {
+		files = []refactor.File{{Code: req.Code}}
+	}
+	for _, file := range files {
+		if err := h.svc.ValidateInput(file.Code); err != nil {
+			writeJSON(w, http.StatusBadRequest, RenameResponse{Errors: []string{err.Error()}})
+			return
+		}
+		if req.UseMarkup || service.DetectMarkupSyntax(file.Code) {
+			writeJSON(w, http.StatusBadRequest, RenameResponse{Errors: []string{"Renaming supports the emoji syntax only"}})
+			return
+		}
+	}
+	pack, found := h.svc.ResolveDialect(req.Dialect)
+	if !found {
+		writeJSON(w, http.StatusBadRequest, RenameResponse{Errors: []string{fmt.Sprintf("Unknown dialect '%s'", req.Dialect)}})
+		return
+	}
+	var aliases map[string]string
+	if pack != nil {
+		aliases = pack.ToBase()
+	}
+
+	oldName, edits, err := refactor.Rename(files, req.File, req.Line, req.Column, req.NewName, aliases)
+	if err != nil {
+		writeJSON(w, http.StatusUnprocessableEntity, RenameResponse{Errors: []string{err.Error()}})
+		return
+	}
+
+	resp := RenameResponse{Success: true, OldName: oldName, NewName: req.NewName, Edits: edits}
+	if !project {
+		resp.Code = refactor.Apply(req.Code, edits)
+	} else {
+		for _, file := range files {
+			var own []refactor.Edit
+			for _, edit := range edits {
+				if edit.File == file.Name {
+					own = append(own, edit)
+				}
+			}
+			resp.Files = append(resp.Files, refactor.File{Name: file.Name, Code: refactor.Apply(file.Code, own)})
+		}
+	}
+	writeJSON(w, http.StatusOK, resp)
+}
+
+type ExtractRequest struct {
+	Code string `json:"code"`
+	// StartLine and EndLine are the first and last lines to extract
+	StartLine int `json:"startLine"`
+	EndLine   int `json:"endLine"`
+	// Name names the new function, refactor.DefaultFunctionName by default
+	Name      string `json:"name,omitempty"`
+	Dialect   string `json:"dialect,omitempty"`
+	UseMarkup bool   `json:"useMarkup,omitempty"`
+}
+
+type ExtractResponse struct {
+	Success bool            `json:"success"`
+	Name    string          `json:"name,omitempty"`
+	Params  []string        `json:"params,omitempty"`
+	Returns []string        `json:"returns,omitempty"`
+	Edits   []refactor.Edit `json:"edits,omitempty"`
+	Code    string          `json:"code,omitempty"`
+	Errors  []string        `json:"errors,omitempty"`
+}
+
+// handleExtract moves a run of lines into a new function, in the syntax
+// the program is written in
+func (h *handler) handleExtract(w http.ResponseWriter, r *http.Request) {
+	var req ExtractRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeJSON(w, http.StatusBadRequest, ExtractResponse{Errors: []string{"Invalid request"}})
+		return
+	}
+	if err := h.svc.ValidateInput(req.Code); err != nil {
+		writeJSON(w, http.StatusBadRequest, ExtractResponse{Errors: []string{err.Error()}})
+		return
+	}
+	pack, found := h.svc.ResolveDialect(req.Dialect)
+	if !found {
+		writeJSON(w, http.StatusBadRequest, ExtractResponse{Errors: []string{fmt.Sprintf("Unknown dialect '%s'", req.Dialect)}})
+		return
+	}
+	var aliases map[string]string
+	if pack != nil {
+		aliases = pack.ToBase()
+	}
+
+	markup := req.UseMarkup || service.DetectMarkupSyntax(req.Code)
+	x, err := refactor.Extract(req.Code, markup, req.StartLine, req.EndLine, req.Name, aliases)
+	if err != nil {
+		writeJSON(w, http.StatusUnprocessableEntity, ExtractResponse{Errors: []string{err.Error()}})
+		return
+	}
+	writeJSON(w, http.StatusOK, ExtractResponse{
+		Success: true,
+		Name:    x.Name,
+		Params:  x.Params,
+		Returns: x.Returns,
+		Edits:   x.Edits,
+		Code:    refactor.Apply(req.Code, x.Edits),
+	})
+}
+
+type OrganizeImportsRequest struct {
+	Code string `json:"code,omitempty"`
+	// Files organizes each file of a project instead of Code
+	Files   []refactor.File `json:"files,omitempty"`
+	Dialect string          `json:"dialect,omitempty"`
+}
+
+type OrganizeImportsResponse struct {
+	Success bool                   `json:"success"`
+	Issues  []refactor.ImportIssue `json:"issues"`
+	Edits   []refactor.Edit        `json:"edits"`
+	// Code is the organized source, or Files the organized project
+	Code   string          `json:"code,omitempty"`
+	Files  []refactor.File `json:"files,omitempty"`
+	Errors []string        `json:"errors,omitempty"`
+}
+
+// handleOrganizeImports reports unused and repeated imports and removes
+// them
+func (h *handler) handleOrganizeImports(w http.ResponseWriter, r *http.Request) {
+	var req OrganizeImportsRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeJSON(w, http.StatusBadRequest, OrganizeImportsResponse{Errors: []string{"Invalid request"}})
+		return
+	}
+	project := len(req.Files) > 0
+	files := req.Files
+	if !project {
+		files = []refactor.File{{Code: req.Code}}
+	}
+	for _, file := range files {
+		if err := h.svc.ValidateInput(file.Code); err != nil {
+			writeJSON(w, http.StatusBadRequest, OrganizeImportsResponse{Errors: []string{err.Error()}})
+			return
+		}
+		if service.DetectMarkupSyntax(file.Code) {
+			writeJSON(w, http.StatusBadRequest, OrganizeImportsResponse{Errors: []string{"Organizing imports supports the emoji syntax only"}})
+			return
+		}
+	}
+	pack, found := h.svc.ResolveDialect(req.Dialect)
+	if !found {
+		writeJSON(w, http.StatusBadRequest, OrganizeImportsResponse{Errors: []string{fmt.Sprintf("Unknown dialect '%s'", req.Dialect)}})
+		return
+	}
+	var aliases map[string]string
+	if pack != nil {
+		aliases = pack.ToBase()
+	}
+
+	issues, edits, err := refactor.OrganizeImports(files, aliases)
+	if err != nil {
+		writeJSON(w, http.StatusUnprocessableEntity, OrganizeImportsResponse{Errors: []string{err.Error()}})
+		return
+	}
+
+	resp := OrganizeImportsResponse{Success: true, Issues: issues, Edits: edits}
+	if !project {
+		resp.Code = refactor.Apply(req.Code, edits)
+	} else {
+		for _, file := range files {
+			var own []refactor.Edit
+			for _, edit := range edits {
+				if edit.File == file.Name {
+					own = append(own, edit)
+				}
+			}
+			resp.Files = append(resp.Files, refactor.File{Name: file.Name, Code: refactor.Apply(file.Code, own)})
+		}
+	}
+	writeJSON(w, http.StatusOK, resp)
+}
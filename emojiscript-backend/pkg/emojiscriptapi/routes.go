@@ -0,0 +1,289 @@
+package emojiscriptapi
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+
+	"emojiscript-backend/pkg/apikey"
+	"emojiscript-backend/pkg/golden"
+	"emojiscript-backend/pkg/history"
+	"emojiscript-backend/pkg/service"
+	"emojiscript-backend/pkg/transpiler"
+)
+
+type errorBody struct {
+	Success bool   `json:"success"`
+	Error   string `json:"error"`
+}
+
+func (h *handler) handleHealth(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, HealthResponse{Status: "healthy", Version: transpiler.Version})
+}
+
+// handleMetrics reports server load so operators can see back-pressure
+// building before requests are turned away, how often the transpile cache
+// answers, how long each route takes, what is transpiled and which parse
+// errors programs hit, and emoji map coverage so maintainers can see which
+// gaps hurt users most. Prometheus scrapers,
+// and ?format=prometheus, get the text exposition format.
+func (h *handler) handleMetrics(w http.ResponseWriter, r *http.Request) {
+	if wantsPrometheus(r) {
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+		h.opts.Pool.Stats().WritePrometheus(w)
+		h.svc.CacheStats().WritePrometheus(w)
+		h.opts.Coverage.WritePrometheus(w)
+		h.opts.Metrics.WritePrometheus(w)
+		return
+	}
+	summary := h.opts.Metrics.Summary()
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"pool":        h.opts.Pool.Stats(),
+		"cache":       h.svc.CacheStats(),
+		"coverage":    h.opts.Coverage.Summary(),
+		"requests":    summary.Requests,
+		"transpiles":  summary.Transpiles,
+		"parseErrors": summary.ParseErrors,
+		"pipelines":   summary.Pipelines,
+	})
+}
+
+// handleUsage reports the caller's use of its API key's daily quota
+func (h *handler) handleUsage(w http.ResponseWriter, r *http.Request) {
+	if r.Header.Get(apikey.Header) == "" {
+		writeJSON(w, http.StatusBadRequest, errorBody{Success: false, Error: "Missing " + apikey.Header + " header"})
+		return
+	}
+	key, ok := h.opts.APIKeys.FromRequest(r)
+	if !ok {
+		writeJSON(w, http.StatusUnauthorized, errorBody{Success: false, Error: apikey.ErrInvalidKey.Error()})
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"success":   true,
+		"usage":     h.opts.APIKeys.Usage(key),
+		"perMinute": key.Tier.PerMinute,
+	})
+}
+
+// wantsPrometheus reports whether the caller asked for the text format,
+// by query or by the Accept header Prometheus sends
+func wantsPrometheus(r *http.Request) bool {
+	if format := r.URL.Query().Get("format"); format != "" {
+		return format == "prometheus"
+	}
+	accept := r.Header.Get("Accept")
+	return strings.Contains(accept, "text/plain") || strings.Contains(accept, "application/openmetrics-text")
+}
+
+// validateRequest is a program to validate, or with Files the files of a
+// project to validate together
+type validateRequest struct {
+	TranspileRequest
+	Files map[string]string `json:"files,omitempty"`
+}
+
+func (h *handler) handleValidate(w http.ResponseWriter, r *http.Request) {
+	var req validateRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeJSON(w, http.StatusBadRequest, ValidateResponse{Valid: false, Errors: []string{"Invalid request"}})
+		return
+	}
+
+	if req.Files != nil {
+		writeJSON(w, http.StatusOK, h.svc.ValidateProject(ProjectRequest{
+			Files:            req.Files,
+			TargetLanguage:   req.TargetLanguage,
+			UseMarkup:        req.UseMarkup,
+			Syntax:           req.Syntax,
+			Dialect:          req.Dialect,
+			StrictTags:       req.StrictTags,
+			StrictSchema:     req.StrictSchema,
+			ASCIIIdentifiers: req.ASCIIIdentifiers,
+		}))
+		return
+	}
+	writeJSON(w, http.StatusOK, h.svc.Validate(req.TranspileRequest))
+}
+
+func (h *handler) handleExamples(w http.ResponseWriter, r *http.Request) {
+	pack, ok := h.queryDialect(w, r)
+	if !ok {
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]interface{}{"examples": DialectExamples(h.examples.list(r.Context(), r.URL.Query().Get("syntax")), pack)})
+}
+
+func (h *handler) handleTranscribe(w http.ResponseWriter, r *http.Request) {
+	var req TranscribeRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeJSON(w, http.StatusBadRequest, errorBody{Error: "Invalid request"})
+		return
+	}
+	if err := h.svc.CheckLength(req.Code); err != nil {
+		writeJSON(w, http.StatusBadRequest, errorBody{Error: err.Error()})
+		return
+	}
+
+	switch req.Direction {
+	case "", "text":
+		writeJSON(w, http.StatusOK, map[string]interface{}{"success": true, "direction": "text", "output": transpiler.TranscribeToText(req.Code, req.Verbose)})
+	case "emoji":
+		output, err := transpiler.TranscribeFromText(req.Code)
+		if err != nil {
+			writeJSON(w, http.StatusBadRequest, errorBody{Error: err.Error()})
+			return
+		}
+		writeJSON(w, http.StatusOK, map[string]interface{}{"success": true, "direction": "emoji", "output": output})
+	default:
+		writeJSON(w, http.StatusBadRequest, errorBody{Error: "direction must be 'text' or 'emoji'"})
+	}
+}
+
+func (h *handler) handleFormat(w http.ResponseWriter, r *http.Request) {
+	var req FormatRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeJSON(w, http.StatusBadRequest, errorBody{Error: "Invalid request"})
+		return
+	}
+	if err := h.svc.ValidateInput(req.Code); err != nil {
+		writeJSON(w, http.StatusBadRequest, errorBody{Error: err.Error()})
+		return
+	}
+
+	pack, found := h.svc.ResolveDialect(req.Dialect)
+	if !found {
+		writeJSON(w, http.StatusBadRequest, errorBody{Error: "Unknown dialect '" + req.Dialect + "'"})
+		return
+	}
+	opts := transpiler.FormatOptions{Layout: true, Markup: req.UseMarkup || service.DetectMarkupSyntax(req.Code)}
+	if pack != nil {
+		opts.Aliases = pack.FromBase()
+	}
+
+	output := transpiler.Format(req.Code, opts)
+	writeJSON(w, http.StatusOK, map[string]interface{}{"success": true, "output": output, "changed": output != req.Code, "usedMarkup": opts.Markup})
+}
+
+// handleReference lists the emoji and their keywords, in a dialect's
+// emoji with ?dialect=
+func (h *handler) handleReference(w http.ResponseWriter, r *http.Request) {
+	pack, ok := h.queryDialect(w, r)
+	if !ok {
+		return
+	}
+	var fromBase map[string]string
+	if pack != nil {
+		fromBase = pack.FromBase()
+	}
+	palette := transpiler.DialectPalette(fromBase)
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"success":   true,
+		"reference": transpiler.PaletteReference(palette),
+		"palette":   palette,
+	})
+}
+
+// handleGrammar publishes the language grammar, generated from the
+// transpiler's tables, as JSON or, with ?format=, as EBNF text or a
+// TextMate or Monaco syntax definition for editors
+func (h *handler) handleGrammar(w http.ResponseWriter, r *http.Request) {
+	grammar := transpiler.BuildGrammar()
+	w.Header().Set("Cache-Control", "public, max-age=3600")
+	switch r.URL.Query().Get("format") {
+	case "", "json":
+		writeJSON(w, http.StatusOK, grammar)
+	case "ebnf":
+		w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+		w.Write([]byte(grammar.EBNF()))
+	case "textmate":
+		writeJSON(w, http.StatusOK, grammar.TextMate())
+	case "monaco":
+		writeJSON(w, http.StatusOK, grammar.Monarch())
+	default:
+		writeJSON(w, http.StatusBadRequest, errorBody{Success: false, Error: "format must be json, ebnf, textmate or monaco"})
+	}
+}
+
+// handleChangelog publishes the language changes by release from the
+// transpiler's version registry; ?since= keeps the releases after that
+// version
+func (h *handler) handleChangelog(w http.ResponseWriter, r *http.Request) {
+	since := r.URL.Query().Get("since")
+	if since != "" && !transpiler.ValidVersion(since) {
+		writeJSON(w, http.StatusBadRequest, errorBody{Success: false, Error: "since must be a version like 1.0.0"})
+		return
+	}
+	w.Header().Set("Cache-Control", "public, max-age=3600")
+	writeJSON(w, http.StatusOK, ChangelogResponse{
+		Success:      true,
+		Version:      transpiler.Version,
+		Releases:     transpiler.Changelog(since),
+		Deprecations: transpiler.Deprecations(),
+	})
+}
+
+// handleMappings lists the mapping profiles a transpile request can name
+// with mappingProfile
+func (h *handler) handleMappings(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, map[string]interface{}{"profiles": h.svc.Mappings().List()})
+}
+
+func (h *handler) handleMapping(w http.ResponseWriter, r *http.Request) {
+	profile, found := h.svc.Mappings().Get(r.PathValue("name"))
+	if !found {
+		writeJSON(w, http.StatusNotFound, errorBody{Error: "Mapping profile not found"})
+		return
+	}
+	writeJSON(w, http.StatusOK, profile)
+}
+
+// sessionID reads the session from the X-Session-ID header or the
+// ?session= query parameter
+func sessionID(r *http.Request) string {
+	if id := r.Header.Get("X-Session-ID"); id != "" {
+		return id
+	}
+	return r.URL.Query().Get("session")
+}
+
+func (h *handler) handleHistory(w http.ResponseWriter, r *http.Request) {
+	id := sessionID(r)
+	if !history.ValidSessionID(id) {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "Missing or invalid session ID"})
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]interface{}{"sessionId": id, "entries": h.history.Entries(id)})
+}
+
+func (h *handler) handleHistoryEntry(w http.ResponseWriter, r *http.Request) {
+	id := sessionID(r)
+	if !history.ValidSessionID(id) {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "Missing or invalid session ID"})
+		return
+	}
+	entry, found := h.history.Entry(id, r.PathValue("id"))
+	if !found {
+		writeJSON(w, http.StatusNotFound, map[string]string{"error": "History entry not found"})
+		return
+	}
+	writeJSON(w, http.StatusOK, entry)
+}
+
+func (h *handler) handleHistoryClear(w http.ResponseWriter, r *http.Request) {
+	id := sessionID(r)
+	if !history.ValidSessionID(id) {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "Missing or invalid session ID"})
+		return
+	}
+	h.history.Clear(id)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (h *handler) handleFixtures(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"fixtures": golden.Fixtures(query.Get("feature"), query.Get("syntax")),
+		"features": golden.Features(),
+	})
+}
@@ -0,0 +1,159 @@
+package emojiscriptapi
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+	"time"
+
+	"emojiscript-backend/pkg/hints"
+	"emojiscript-backend/pkg/history"
+	"emojiscript-backend/pkg/repl"
+	"emojiscript-backend/pkg/sandbox"
+	"emojiscript-backend/pkg/usage"
+)
+
+type RunRequest struct {
+	Code      string `json:"code"`
+	UseMarkup bool   `json:"useMarkup,omitempty"`
+	Dialect   string `json:"dialect,omitempty"`
+	// Stdin is fed to the program, one prompt() per line
+	Stdin string `json:"stdin,omitempty"`
+}
+
+// RunLimits are the sandbox limits a run was held to
+type RunLimits struct {
+	Statements   int   `json:"statements"`
+	Instructions int   `json:"instructions"`
+	TimeoutMs    int64 `json:"timeoutMs"`
+	OutputBytes  int   `json:"outputBytes"`
+	CallDepth    int   `json:"callDepth"`
+	MemoryBytes  int   `json:"memoryBytes"`
+}
+
+// RunResources reports what a run used
+type RunResources struct {
+	ExecutionTimeMs float64 `json:"executionTimeMs"`
+	// PeakMemoryBytes approximates the most the program's values held at
+	// once; it is for comparing programs, not sizing a process
+	PeakMemoryBytes int `json:"peakMemoryBytes"`
+	Statements      int `json:"statements"`
+	// Instructions counts the expressions evaluated
+	Instructions int `json:"instructions"`
+	// LimitsHit names the limits the run reached: steps, instructions,
+	// time, output, memory or depth
+	LimitsHit []string  `json:"limitsHit"`
+	Limits    RunLimits `json:"limits"`
+}
+
+// RunSession is the REPL session a run was made in
+type RunSession struct {
+	ID        string    `json:"id"`
+	ExpiresAt time.Time `json:"expiresAt"`
+	// Variables are what the session's runs have declared so far
+	Variables []sandbox.Variable `json:"variables"`
+}
+
+type RunResponse struct {
+	Success    bool          `json:"success"`
+	JavaScript string        `json:"javascript,omitempty"`
+	Stdout     []string      `json:"stdout"`
+	Error      string        `json:"error,omitempty"`
+	ErrorLine  int           `json:"errorLine,omitempty"`
+	Limit      string        `json:"limit,omitempty"`
+	Resources  *RunResources `json:"resources,omitempty"`
+	Session    *RunSession   `json:"session,omitempty"`
+	Errors     []string      `json:"errors,omitempty"`
+	Warnings   []string      `json:"warnings,omitempty"`
+	Hints      []hints.Hint  `json:"hints,omitempty"`
+}
+
+// handleRun transpiles the program, runs it in the sandbox and reports
+// its output along with the time, memory and statements it used. With
+// ?session=, it runs in that REPL session, where the variables earlier
+// runs declared are still defined.
+func (h *handler) handleRun(w http.ResponseWriter, r *http.Request) {
+	// the id outlives the request as a map key, so it mustn't share the
+	// request's memory, which fiber reuses
+	id := strings.Clone(r.URL.Query().Get("session"))
+	if id != "" && !history.ValidSessionID(id) {
+		writeJSON(w, http.StatusBadRequest, RunResponse{Stdout: []string{}, Errors: []string{"Invalid session ID"}})
+		return
+	}
+	var req RunRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeJSON(w, http.StatusBadRequest, RunResponse{Stdout: []string{}, Errors: []string{"Invalid request"}})
+		return
+	}
+	if err := h.svc.ValidateInput(req.Code); err != nil {
+		writeJSON(w, http.StatusBadRequest, RunResponse{Stdout: []string{}, Errors: []string{err.Error()}, Hints: hints.For([]string{err.Error()}, req.Code)})
+		return
+	}
+
+	output, warnings, errs := h.compileJavaScript(r.Context(), req.Code, req.Dialect, req.UseMarkup)
+	if len(errs) > 0 {
+		writeJSON(w, http.StatusBadRequest, RunResponse{Stdout: []string{}, Errors: errs, Warnings: warnings, Hints: hints.For(errs, req.Code)})
+		return
+	}
+
+	var result *sandbox.Result
+	var resources *RunResources
+	var runSession *RunSession
+	if id == "" {
+		result = sandbox.Run(output, sandbox.Options{Stdin: req.Stdin})
+		resources = runResources(result)
+	} else {
+		session, expires := h.repl.Session(id)
+		result = session.Run(output, sandbox.Options{Stdin: req.Stdin, MaxMemory: repl.MaxMemory})
+		resources = runResources(result)
+		resources.Limits.MemoryBytes = repl.MaxMemory
+		runSession = &RunSession{ID: id, ExpiresAt: expires, Variables: session.Globals()}
+	}
+	usage.FromContext(r.Context()).Sandboxed(result.Duration)
+	writeJSON(w, http.StatusOK, RunResponse{
+		Success:    result.Error == "",
+		JavaScript: output,
+		Stdout:     result.Stdout,
+		Error:      result.Error,
+		ErrorLine:  result.ErrorLine,
+		Limit:      result.Limit,
+		Resources:  resources,
+		Session:    runSession,
+		Warnings:   warnings,
+		Hints:      runtimeHints(result, req.Code),
+	})
+}
+
+// handleResetSession drops a REPL session, so the next run in it starts
+// with nothing defined
+func (h *handler) handleResetSession(w http.ResponseWriter, r *http.Request) {
+	id := r.URL.Query().Get("session")
+	if !history.ValidSessionID(id) {
+		writeJSON(w, http.StatusBadRequest, errorBody{Error: "Missing or invalid session ID"})
+		return
+	}
+	if !h.repl.Delete(id) {
+		writeJSON(w, http.StatusNotFound, errorBody{Error: "session not found or expired"})
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// runResources reports a run with the default sandbox limits
+func runResources(result *sandbox.Result) *RunResources {
+	return &RunResources{
+		ExecutionTimeMs: float64(result.Duration.Microseconds()) / 1000,
+		PeakMemoryBytes: result.PeakMemory,
+		Statements:      result.StepCount,
+		Instructions:    result.Instructions,
+		LimitsHit:       result.LimitsHit(),
+		Limits: RunLimits{
+			Statements:   sandbox.DefaultMaxSteps,
+			Instructions: sandbox.DefaultMaxInstructions,
+			TimeoutMs:    sandbox.DefaultTimeout.Milliseconds(),
+			OutputBytes:  sandbox.DefaultMaxOutput,
+			CallDepth:    sandbox.DefaultMaxDepth,
+			MemoryBytes:  sandbox.DefaultMaxMemory,
+		},
+	}
+}
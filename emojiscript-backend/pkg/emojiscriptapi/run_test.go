@@ -0,0 +1,40 @@
+package emojiscriptapi
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// TestRunComplexityBudget checks that /run turns away a program over the
+// complexity budget before the sandbox runs it, as /transpile does
+func TestRunComplexityBudget(t *testing.T) {
+	api := NewHandler(Options{Prefix: DefaultPrefix, ComplexityBudget: 1000})
+	nested := strings.Repeat("(", 100) + "1" + strings.Repeat(")", 100)
+	for _, tt := range []struct {
+		code string
+		want int
+	}{
+		{"📝(" + nested + ")", http.StatusBadRequest},
+		{"📝(1)", http.StatusOK},
+	} {
+		body, _ := json.Marshal(RunRequest{Code: tt.code})
+		rec := httptest.NewRecorder()
+		api.ServeHTTP(rec, httptest.NewRequest("POST", DefaultPrefix+"/run", strings.NewReader(string(body))))
+		if rec.Code != tt.want {
+			t.Fatalf("%.20s: got %d, want %d: %s", tt.code, rec.Code, tt.want, rec.Body)
+		}
+		var resp RunResponse
+		if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil {
+			t.Fatal(err)
+		}
+		if tt.want == http.StatusBadRequest && (len(resp.Errors) == 0 || !strings.Contains(resp.Errors[0], "too complex")) {
+			t.Errorf("got errors %v, want the complexity budget's", resp.Errors)
+		}
+		if tt.want == http.StatusOK && len(resp.Stdout) != 1 {
+			t.Errorf("got stdout %v, want the program's", resp.Stdout)
+		}
+	}
+}
@@ -0,0 +1,175 @@
+package emojiscriptapi
+
+import (
+	"fmt"
+	"net/http"
+	"regexp"
+	"slices"
+	"strings"
+
+	"emojiscript-backend/pkg/codegen"
+	"emojiscript-backend/pkg/degrade"
+	"emojiscript-backend/pkg/golden"
+	"emojiscript-backend/pkg/sandbox"
+	"emojiscript-backend/pkg/service"
+	"emojiscript-backend/pkg/transpiler"
+)
+
+// Self-test check statuses. A check is skipped when this deployment can't
+// run it, as for a fixture recorded for a target it doesn't generate.
+const (
+	SelfTestPass = "pass"
+	SelfTestFail = "fail"
+	SelfTestSkip = "skip"
+)
+
+// SelfTestCheck is one fixture put through one backend. Check is
+// "golden" for the fixture's recorded output, a target language for
+// transpiling to it, or "sandbox" for running its JavaScript.
+type SelfTestCheck struct {
+	Fixture string `json:"fixture"`
+	Check   string `json:"check"`
+	Status  string `json:"status"`
+	Message string `json:"message,omitempty"`
+}
+
+type SelfTestFeature struct {
+	Feature string          `json:"feature"`
+	Passed  bool            `json:"passed"`
+	Checks  []SelfTestCheck `json:"checks"`
+}
+
+type SelfTestReport struct {
+	Passed  bool     `json:"passed"`
+	Version string   `json:"version"`
+	Targets []string `json:"targets"`
+	// Failures counts the failed checks across every feature
+	Failures int               `json:"failures"`
+	Features []SelfTestFeature `json:"features"`
+}
+
+// undefinedName matches the sandbox's error for a name nothing declares
+var undefinedName = regexp.MustCompile(`ReferenceError: ([\w$]+) is not defined`)
+
+// SelfTest puts the golden corpus through svc: each fixture must
+// transpile to its recorded output, transpile without errors to every
+// target language, and run in the sandbox as JavaScript. Requests are
+// made with privacy mode strict, so the test leaves no trace in the
+// cache, history or statistics.
+func SelfTest(svc *service.Service) SelfTestReport {
+	targets := service.Targets()
+	report := SelfTestReport{Passed: true, Version: transpiler.Version, Targets: targets, Features: []SelfTestFeature{}}
+	for _, feature := range golden.Features() {
+		result := SelfTestFeature{Feature: feature, Passed: true}
+		for _, fixture := range golden.Fixtures(feature, "") {
+			checks := selfTestFixture(svc, fixture, targets)
+			for _, check := range checks {
+				if check.Status == SelfTestFail {
+					result.Passed = false
+					report.Failures++
+				}
+			}
+			result.Checks = append(result.Checks, checks...)
+		}
+		report.Passed = report.Passed && result.Passed
+		report.Features = append(report.Features, result)
+	}
+	return report
+}
+
+func selfTestFixture(svc *service.Service, fixture golden.Fixture, targets []string) []SelfTestCheck {
+	transpile := func(target string) (service.TranspileResponse, error) {
+		return svc.Transpile(service.TranspileRequest{
+			Code:           fixture.Input,
+			Syntax:         fixture.Syntax,
+			TargetLanguage: target,
+			Privacy:        service.PrivacyStrict,
+		}, service.Caller{})
+	}
+	failed := func(check string, resp service.TranspileResponse, err error) SelfTestCheck {
+		message := strings.Join(resp.Errors, "; ")
+		if message == "" {
+			message = err.Error()
+		}
+		return SelfTestCheck{Fixture: fixture.Name, Check: check, Status: SelfTestFail, Message: message}
+	}
+
+	recorded := SelfTestCheck{Fixture: fixture.Name, Check: "golden", Status: SelfTestPass}
+	if !slices.Contains(targets, fixture.TargetLanguage) {
+		recorded.Status = SelfTestSkip
+		recorded.Message = fmt.Sprintf("recorded for %s, which this deployment doesn't generate", fixture.TargetLanguage)
+	} else if resp, err := transpile(fixture.TargetLanguage); err != nil {
+		recorded = failed("golden", resp, err)
+	} else if resp.Output != fixture.Output {
+		recorded.Status = SelfTestFail
+		recorded.Message = fmt.Sprintf("%s output differs from the corpus: got %q, want %q", fixture.TargetLanguage, resp.Output, fixture.Output)
+	}
+	checks := []SelfTestCheck{recorded}
+
+	// the other targets are generated from the JavaScript, so they run
+	// first, and the ones codegen writes from the syntax tree the sandbox
+	// parses are skipped when it can't parse it, as with modules
+	resp, err := transpile("javascript")
+	if err != nil {
+		return append(checks, failed("javascript", resp, err))
+	}
+	javascript := resp.Output
+	parseErr := sandbox.Check(javascript)
+	checks = append(checks, SelfTestCheck{Fixture: fixture.Name, Check: "javascript", Status: SelfTestPass})
+	for _, target := range targets[1:] {
+		if codegen.Generates(target) && parseErr != nil {
+			checks = append(checks, SelfTestCheck{Fixture: fixture.Name, Check: target, Status: SelfTestSkip, Message: parseErr.Error()})
+			continue
+		}
+		if resp, err := transpile(target); err != nil {
+			checks = append(checks, failed(target, resp, err))
+			continue
+		}
+		checks = append(checks, SelfTestCheck{Fixture: fixture.Name, Check: target, Status: SelfTestPass})
+	}
+
+	run := SelfTestCheck{Fixture: fixture.Name, Check: "sandbox", Status: SelfTestSkip}
+	if svc.Health().Down(degrade.Sandbox) {
+		run.Message = "the sandbox is down"
+	} else if parseErr != nil {
+		run.Message = parseErr.Error()
+	} else {
+		run.Status, run.Message = sandboxFragment(javascript)
+	}
+	return append(checks, run)
+}
+
+// sandboxFragment runs a fixture's JavaScript. Fixtures are fragments
+// that may use names a surrounding program would declare, so stopping at
+// one of those passes; stopping at a name the fragment declares doesn't.
+func sandboxFragment(code string) (string, string) {
+	result := sandbox.Run(code, sandbox.Options{})
+	if result.Error == "" {
+		return SelfTestPass, ""
+	}
+	match := undefinedName.FindStringSubmatch(result.Error)
+	if match == nil || result.Limit != "" {
+		return SelfTestFail, result.Error
+	}
+	scopes, err := sandbox.Resolve(code)
+	if err != nil {
+		return SelfTestFail, err.Error()
+	}
+	for _, ref := range scopes.References {
+		if ref.Name == match[1] && ref.Declaration {
+			return SelfTestFail, result.Error
+		}
+	}
+	return SelfTestPass, fmt.Sprintf("stopped at %s, which the fragment leaves to its surroundings", match[1])
+}
+
+// handleSelfTest runs SelfTest, answering 200 when every check passes
+// and 503 otherwise, so a deploy script can act on the status alone
+func (h *handler) handleSelfTest(w http.ResponseWriter, r *http.Request) {
+	report := SelfTest(h.svc)
+	status := http.StatusOK
+	if !report.Passed {
+		status = http.StatusServiceUnavailable
+	}
+	writeJSON(w, status, report)
+}
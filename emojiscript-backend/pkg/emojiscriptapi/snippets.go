@@ -0,0 +1,350 @@
+package emojiscriptapi
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"slices"
+	"strconv"
+	"sync"
+	"time"
+
+	"emojiscript-backend/pkg/degrade"
+	"emojiscript-backend/pkg/kvcache"
+	"emojiscript-backend/pkg/ratelimit"
+	"emojiscript-backend/pkg/requestid"
+	"emojiscript-backend/pkg/scan"
+	"emojiscript-backend/pkg/service"
+	"emojiscript-backend/pkg/storage"
+	"emojiscript-backend/pkg/usage"
+)
+
+const (
+	// MaxSnippets caps the snippets kept in memory; the oldest are
+	// forgotten first
+	MaxSnippets = 10000
+	// SnippetTTL is how long a snippet lives in the remote store, and the
+	// longest expiry a snippet may ask for
+	SnippetTTL = 30 * 24 * time.Hour
+	// DefaultSnippetRateLimit is how many snippets one client may create
+	// a minute
+	DefaultSnippetRateLimit = 10
+	// snippetIDLength is the hex digits of the content hash an id keeps
+	snippetIDLength = 12
+	// remoteSnippetPrefix namespaces snippets in a shared store
+	remoteSnippetPrefix = "emojiscript:snippet:"
+)
+
+// Snippet is a saved program, addressed by a hash of its content so the
+// same program always gets the same id. It keeps what the program
+// transpiled to when it was saved: Output, or the Errors that stopped it.
+type Snippet struct {
+	ID             string    `json:"id"`
+	Code           string    `json:"code"`
+	UseMarkup      bool      `json:"useMarkup,omitempty"`
+	Dialect        string    `json:"dialect,omitempty"`
+	Syntax         string    `json:"syntax,omitempty"`
+	TargetLanguage string    `json:"targetLanguage,omitempty"`
+	Output         string    `json:"output,omitempty"`
+	Errors         []string  `json:"errors,omitempty"`
+	CreatedAt      time.Time `json:"createdAt"`
+	// ExpiresAt is when a snippet saved with an expiry is forgotten
+	ExpiresAt *time.Time `json:"expiresAt,omitempty"`
+	// Owners are the names of the API keys the snippet was saved with,
+	// whose exports include it. Ids are content hashes, so one snippet
+	// can have several.
+	Owners []string `json:"owners,omitempty"`
+}
+
+// expired reports whether the snippet's expiry has passed
+func (s Snippet) expired(now time.Time) bool {
+	return s.ExpiresAt != nil && !now.Before(*s.ExpiresAt)
+}
+
+type SnippetRequest struct {
+	Code           string `json:"code"`
+	UseMarkup      bool   `json:"useMarkup,omitempty"`
+	Dialect        string `json:"dialect,omitempty"`
+	TargetLanguage string `json:"targetLanguage,omitempty"`
+	// ExpiresIn forgets the snippet after this many seconds, up to
+	// SnippetTTL; snippets without it last as long as the store keeps them
+	ExpiresIn int `json:"expiresIn,omitempty"`
+}
+
+type SnippetResponse struct {
+	Success bool   `json:"success"`
+	ID      string `json:"id"`
+	// EmbedURL is the viewer to put in an iframe
+	EmbedURL  string     `json:"embedUrl"`
+	ExpiresAt *time.Time `json:"expiresAt,omitempty"`
+}
+
+// snippetStore keeps snippets in memory and, when the handler has
+// Storage or a RemoteCache, in that shared store so every instance can
+// serve them
+type snippetStore struct {
+	mu       sync.Mutex
+	snippets map[string]Snippet
+	order    []string
+	remote   kvcache.Store
+	// storage is the handler's Storage, which remote writes to when set;
+	// unlike a remote cache it can be listed
+	storage storage.Store
+}
+
+func newSnippetStore(remote kvcache.Store) *snippetStore {
+	return &snippetStore{snippets: map[string]Snippet{}, remote: remote}
+}
+
+// snippetID hashes what decides how a snippet runs, and its expiry, so a
+// program saved to expire never shares an id with one saved for good
+func snippetID(req SnippetRequest) string {
+	encoded, _ := json.Marshal(req)
+	sum := sha256.Sum256(encoded)
+	return hex.EncodeToString(sum[:])[:snippetIDLength]
+}
+
+func (s *snippetStore) save(ctx context.Context, snippet Snippet) {
+	s.remember(snippet)
+	if s.remote == nil {
+		return
+	}
+	ttl := SnippetTTL
+	if snippet.ExpiresAt != nil {
+		ttl = time.Until(*snippet.ExpiresAt)
+	}
+	value, _ := json.Marshal(snippet)
+	// the snippet is saved even if the client stops waiting
+	ctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), service.RemoteTimeout)
+	defer cancel()
+	if err := s.remote.Set(ctx, remoteSnippetPrefix+snippet.ID, value, ttl); err != nil {
+		requestid.Printf(ctx, "snippets: %v", err)
+	}
+}
+
+func (s *snippetStore) remember(snippet Snippet) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.snippets[snippet.ID]; !ok {
+		if len(s.order) >= MaxSnippets {
+			delete(s.snippets, s.order[0])
+			s.order = s.order[1:]
+		}
+		s.order = append(s.order, snippet.ID)
+	}
+	s.snippets[snippet.ID] = snippet
+}
+
+// all returns the unexpired snippets kept in memory, oldest first, then
+// those only in Storage. A remote cache can't be listed, so without
+// Storage snippets only another instance has seen aren't among them.
+func (s *snippetStore) all(ctx context.Context) []Snippet {
+	s.mu.Lock()
+	now := time.Now()
+	snippets := make([]Snippet, 0, len(s.order))
+	seen := map[string]bool{}
+	for _, id := range s.order {
+		if snippet := s.snippets[id]; !snippet.expired(now) {
+			snippets = append(snippets, snippet)
+		}
+		seen[id] = true
+	}
+	s.mu.Unlock()
+	if s.storage == nil {
+		return snippets
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, storage.Timeout)
+	defer cancel()
+	records, err := s.storage.List(ctx, storage.Snippets)
+	if err != nil {
+		requestid.Printf(ctx, "snippets: %v", err)
+	}
+	for _, record := range records {
+		var snippet Snippet
+		if json.Unmarshal(record.Value, &snippet) != nil || seen[snippet.ID] || snippet.expired(now) {
+			continue
+		}
+		snippets = append(snippets, snippet)
+	}
+	return snippets
+}
+
+// get looks a snippet up in memory and then in the remote store; an
+// expired snippet is not found
+func (s *snippetStore) get(ctx context.Context, id string) (Snippet, bool) {
+	s.mu.Lock()
+	snippet, found := s.snippets[id]
+	if found && snippet.expired(time.Now()) {
+		delete(s.snippets, id)
+		s.order = slices.DeleteFunc(s.order, func(kept string) bool { return kept == id })
+		s.mu.Unlock()
+		return Snippet{}, false
+	}
+	s.mu.Unlock()
+	if found || s.remote == nil {
+		return snippet, found
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, service.RemoteTimeout)
+	defer cancel()
+	value, found, err := s.remote.Get(ctx, remoteSnippetPrefix+id)
+	if err != nil {
+		requestid.Printf(ctx, "snippets: %v", err)
+	}
+	if !found || json.Unmarshal(value, &snippet) != nil || snippet.expired(time.Now()) {
+		return Snippet{}, false
+	}
+	s.remember(snippet)
+	return snippet, true
+}
+
+// remove forgets a snippet. The remote store can't delete, so the id is
+// overwritten there with a snippet that has already expired, which get
+// treats as missing.
+func (s *snippetStore) remove(ctx context.Context, id string) {
+	s.mu.Lock()
+	delete(s.snippets, id)
+	s.order = slices.DeleteFunc(s.order, func(kept string) bool { return kept == id })
+	s.mu.Unlock()
+	if s.remote == nil {
+		return
+	}
+	expired := time.Unix(0, 0).UTC()
+	value, _ := json.Marshal(Snippet{ID: id, ExpiresAt: &expired})
+	ctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), service.RemoteTimeout)
+	defer cancel()
+	if err := s.remote.Set(ctx, remoteSnippetPrefix+id, value, SnippetTTL); err != nil {
+		requestid.Printf(ctx, "snippets: %v", err)
+	}
+}
+
+// limitedClient names who is creating a snippet or submitting to a
+// challenge, for their rate limits; callers with a service token aren't
+// limited
+func (h *handler) limitedClient(r *http.Request) string {
+	if _, isService := h.opts.ServiceTokens.FromRequest(r); isService {
+		return ""
+	}
+	return ratelimit.ClientIP(r, h.opts.TrustProxy)
+}
+
+// handleCreateSnippet transpiles a program, saves it with its output and
+// returns its id and embed URL. Saving the same program again returns
+// the same id, and renews its expiry if it has one.
+func (h *handler) handleCreateSnippet(w http.ResponseWriter, r *http.Request) {
+	var req SnippetRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeJSON(w, http.StatusBadRequest, errorBody{Error: "Invalid request"})
+		return
+	}
+	if err := h.svc.ValidateInput(req.Code); err != nil {
+		writeJSON(w, http.StatusBadRequest, errorBody{Error: err.Error()})
+		return
+	}
+	if _, found := h.svc.ResolveDialect(req.Dialect); !found {
+		writeJSON(w, http.StatusBadRequest, errorBody{Error: fmt.Sprintf("Unknown dialect '%s'", req.Dialect)})
+		return
+	}
+	if h.moderation.banned(r.Context(), req.Code) {
+		writeJSON(w, http.StatusForbidden, errorBody{Error: "This program has been taken down and can't be shared again"})
+		return
+	}
+	lang, err := service.TargetLanguage(req.TargetLanguage)
+	if err != nil {
+		writeJSON(w, http.StatusBadRequest, errorBody{Error: err.Error()})
+		return
+	}
+	if req.ExpiresIn < 0 || time.Duration(req.ExpiresIn)*time.Second > SnippetTTL {
+		writeJSON(w, http.StatusBadRequest, errorBody{Error: fmt.Sprintf("expiresIn must be between 1 and %d seconds", int(SnippetTTL.Seconds()))})
+		return
+	}
+	// the default target is left out of the hash, so ids from before
+	// targetLanguage existed still match
+	req.TargetLanguage = lang
+	if lang == "javascript" {
+		req.TargetLanguage = ""
+	}
+
+	owner := ""
+	if key, ok := h.opts.APIKeys.FromRequest(r); ok {
+		owner = key.Name
+	}
+
+	id := snippetID(req)
+	existing, found := h.snippets.get(r.Context(), id)
+	if !found || req.ExpiresIn > 0 {
+		now := time.Now().UTC()
+		snippet := Snippet{ID: id, Code: req.Code, UseMarkup: req.UseMarkup, Dialect: req.Dialect, TargetLanguage: lang, CreatedAt: now}
+		if found {
+			snippet.CreatedAt = existing.CreatedAt
+			snippet.Owners = slices.Clone(existing.Owners)
+		}
+		if owner != "" && !slices.Contains(snippet.Owners, owner) {
+			snippet.Owners = append(snippet.Owners, owner)
+		}
+		if req.ExpiresIn > 0 {
+			expires := now.Add(time.Duration(req.ExpiresIn) * time.Second)
+			snippet.ExpiresAt = &expires
+		}
+		// a snippet without useMarkup has always had its syntax detected
+		syntax := service.SyntaxAuto
+		if req.UseMarkup {
+			syntax = service.SyntaxMarkup
+		}
+		resp, _ := h.svc.Transpile(service.TranspileRequest{Code: req.Code, Syntax: syntax, Dialect: req.Dialect, TargetLanguage: lang}, service.Caller{})
+		usage.FromContext(r.Context()).Transpiled(1)
+		snippet.Syntax = "emoji"
+		if resp.UsedMarkup {
+			snippet.Syntax = "markup"
+		}
+		if resp.Success {
+			snippet.Output = resp.Output
+		} else {
+			snippet.Errors = resp.Errors
+		}
+		blocked, flagged := scan.Check(h.opts.SnippetScans, scan.Input{Code: req.Code, Output: snippet.Output, Markup: resp.UsedMarkup})
+		if len(blocked) > 0 {
+			writeJSON(w, http.StatusUnprocessableEntity, map[string]interface{}{"success": false, "error": "This program can't be shared", "findings": blocked})
+			return
+		}
+		h.snippets.save(r.Context(), snippet)
+		for _, finding := range flagged {
+			// each finding is its own flag, where a client's flags count once
+			flag := SnippetFlag{Reason: finding.Reason, Note: finding.Message, FlaggedAt: now, client: "scan:" + finding.Scanner + ":" + finding.Message}
+			if err := h.moderation.flag(id, flag); err != nil {
+				requestid.Printf(r.Context(), "moderation: %v", err)
+			}
+		}
+		existing = snippet
+	} else if owner != "" && !slices.Contains(existing.Owners, owner) {
+		existing.Owners = append(existing.Owners, owner)
+		h.snippets.save(r.Context(), existing)
+	}
+	writeJSON(w, http.StatusCreated, SnippetResponse{Success: true, ID: id, EmbedURL: h.opts.Prefix + "/embed/" + id, ExpiresAt: existing.ExpiresAt})
+}
+
+// snippetMissing answers for a snippet that wasn't found: 404, or 503
+// while the snippet store is degraded, since the snippet may be in it
+func (h *handler) snippetMissing(w http.ResponseWriter) {
+	if h.svc.Health().Degraded(degrade.Snippets) {
+		w.Header().Set("Retry-After", strconv.Itoa(int(degrade.DefaultRetryAfter.Seconds())))
+		writeJSON(w, http.StatusServiceUnavailable, errorBody{Error: "Saved snippets are unavailable right now; try again shortly"})
+		return
+	}
+	writeJSON(w, http.StatusNotFound, errorBody{Error: "Snippet not found"})
+}
+
+func (h *handler) handleSnippet(w http.ResponseWriter, r *http.Request) {
+	snippet, found := h.snippets.get(r.Context(), r.PathValue("id"))
+	if !found {
+		h.snippetMissing(w)
+		return
+	}
+	// who saved a snippet is for their exports, not for whoever has its id
+	snippet.Owners = nil
+	writeJSON(w, http.StatusOK, snippet)
+}
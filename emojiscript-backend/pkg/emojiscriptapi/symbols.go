@@ -0,0 +1,42 @@
+package emojiscriptapi
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"emojiscript-backend/pkg/service"
+	"emojiscript-backend/pkg/transpiler"
+)
+
+type SymbolsRequest struct {
+	Code      string `json:"code"`
+	UseMarkup bool   `json:"useMarkup,omitempty"`
+}
+
+type SymbolsResponse struct {
+	Success    bool                `json:"success"`
+	UsedMarkup bool                `json:"usedMarkup,omitempty"`
+	Symbols    []transpiler.Symbol `json:"symbols"`
+}
+
+// handleSymbols indexes the functions, classes and methods a program
+// declares, for outline views and go-to-symbol. It works on programs with
+// errors too, indexing what it can parse.
+func (h *handler) handleSymbols(w http.ResponseWriter, r *http.Request) {
+	var req SymbolsRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeJSON(w, http.StatusBadRequest, errorBody{Error: "Invalid request"})
+		return
+	}
+	if err := h.svc.ValidateInput(req.Code); err != nil {
+		writeJSON(w, http.StatusBadRequest, errorBody{Error: err.Error()})
+		return
+	}
+
+	markup := req.UseMarkup || service.DetectMarkupSyntax(req.Code)
+	symbols := transpiler.Symbols(req.Code, markup)
+	if symbols == nil {
+		symbols = []transpiler.Symbol{}
+	}
+	writeJSON(w, http.StatusOK, SymbolsResponse{Success: true, UsedMarkup: markup, Symbols: symbols})
+}
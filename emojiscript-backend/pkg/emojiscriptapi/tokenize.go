@@ -0,0 +1,38 @@
+package emojiscriptapi
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"emojiscript-backend/pkg/service"
+	"emojiscript-backend/pkg/transpiler"
+)
+
+type TokenizeRequest struct {
+	Code      string `json:"code"`
+	UseMarkup bool   `json:"useMarkup,omitempty"`
+}
+
+type TokenizeResponse struct {
+	Success    bool                       `json:"success"`
+	UsedMarkup bool                       `json:"usedMarkup,omitempty"`
+	Tokens     []transpiler.SemanticToken `json:"tokens"`
+}
+
+// handleTokenize returns the program's tokens in source order, for
+// editors to highlight semantically. Unterminated strings and comments
+// still tokenize; /validate reports them.
+func (h *handler) handleTokenize(w http.ResponseWriter, r *http.Request) {
+	var req TokenizeRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeJSON(w, http.StatusBadRequest, errorBody{Error: "Invalid request"})
+		return
+	}
+	if err := h.svc.ValidateInput(req.Code); err != nil {
+		writeJSON(w, http.StatusBadRequest, errorBody{Error: err.Error()})
+		return
+	}
+
+	markup := req.UseMarkup || service.DetectMarkupSyntax(req.Code)
+	writeJSON(w, http.StatusOK, TokenizeResponse{Success: true, UsedMarkup: markup, Tokens: transpiler.Tokenize(req.Code, markup)})
+}
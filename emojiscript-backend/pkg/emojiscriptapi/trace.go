@@ -0,0 +1,153 @@
+package emojiscriptapi
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"emojiscript-backend/pkg/hints"
+	"emojiscript-backend/pkg/sandbox"
+	"emojiscript-backend/pkg/service"
+	"emojiscript-backend/pkg/transpiler"
+	"emojiscript-backend/pkg/usage"
+)
+
+// MaxTraceSteps caps the statements a /trace request may execute
+const MaxTraceSteps = 5000
+
+type TraceRequest struct {
+	Code      string `json:"code"`
+	UseMarkup bool   `json:"useMarkup,omitempty"`
+	Dialect   string `json:"dialect,omitempty"`
+	// MaxSteps lowers the number of steps recorded, up to MaxTraceSteps
+	MaxSteps int `json:"maxSteps,omitempty"`
+}
+
+type TraceResponse struct {
+	Success    bool           `json:"success"`
+	JavaScript string         `json:"javascript,omitempty"`
+	Steps      []sandbox.Step `json:"steps"`
+	Stdout     []string       `json:"stdout"`
+	StepCount  int            `json:"stepCount"`
+	Truncated  bool           `json:"truncated,omitempty"`
+	Error      string         `json:"error,omitempty"`
+	ErrorLine  int            `json:"errorLine,omitempty"`
+	Limit      string         `json:"limit,omitempty"`
+	Errors     []string       `json:"errors,omitempty"`
+	Warnings   []string       `json:"warnings,omitempty"`
+	Hints      []hints.Hint   `json:"hints,omitempty"`
+}
+
+// handleTrace transpiles the program and runs it in the sandbox, recording
+// every statement with the variables in scope so a playground can replay
+// the run step by step
+func (h *handler) handleTrace(w http.ResponseWriter, r *http.Request) {
+	var req TraceRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeJSON(w, http.StatusBadRequest, TraceResponse{Errors: []string{"Invalid request"}})
+		return
+	}
+	if err := h.svc.ValidateInput(req.Code); err != nil {
+		writeJSON(w, http.StatusBadRequest, TraceResponse{Errors: []string{err.Error()}, Hints: hints.For([]string{err.Error()}, req.Code)})
+		return
+	}
+
+	output, warnings, errs := h.compileJavaScript(r.Context(), req.Code, req.Dialect, req.UseMarkup)
+	if len(errs) > 0 {
+		writeJSON(w, http.StatusBadRequest, TraceResponse{Errors: errs, Warnings: warnings, Hints: hints.For(errs, req.Code)})
+		return
+	}
+
+	limit := MaxTraceSteps
+	if req.MaxSteps > 0 && req.MaxSteps < limit {
+		limit = req.MaxSteps
+	}
+	result := sandbox.Run(output, sandbox.Options{Trace: true, MaxTraceSteps: limit})
+	usage.FromContext(r.Context()).Sandboxed(result.Duration)
+	steps := result.Steps
+	if steps == nil {
+		steps = []sandbox.Step{}
+	}
+	writeJSON(w, http.StatusOK, TraceResponse{
+		Success:    result.Error == "",
+		JavaScript: output,
+		Steps:      steps,
+		Stdout:     result.Stdout,
+		StepCount:  result.StepCount,
+		Truncated:  result.Truncated,
+		Error:      result.Error,
+		ErrorLine:  result.ErrorLine,
+		Limit:      result.Limit,
+		Warnings:   warnings,
+		Hints:      runtimeHints(result, req.Code),
+	})
+}
+
+// runtimeHints explains a run's error, if any
+func runtimeHints(result *sandbox.Result, code string) []hints.Hint {
+	if result.Error == "" {
+		return nil
+	}
+	return hints.For([]string{result.Error}, code)
+}
+
+// fileBuiltinNames are how programs spell the builtins that read and
+// write files
+var fileBuiltinNames = map[string]string{
+	"EmojiReadFile":  "📖 (<readfile>)",
+	"EmojiWriteFile": "✍️ (<writefile>)",
+}
+
+// compileJavaScript transpiles code the way /transpile does, without the
+// cache or dependency resolution, for endpoints that go on to run it. It
+// rejects programs over the service's complexity budget, as /transpile
+// does, and programs that use files, which the sandbox doesn't have, and
+// warns about loops that look like they never end. The transpile counts
+// toward the request's usage.
+func (h *handler) compileJavaScript(ctx context.Context, code, dialectName string, useMarkup bool) (string, []string, []string) {
+	t, found := h.dialects.Transpiler(dialectName, "javascript")
+	if !found {
+		return "", nil, []string{fmt.Sprintf("Unknown dialect '%s'", dialectName)}
+	}
+	usage.FromContext(ctx).Transpiled(1)
+
+	var output string
+	var errs, warnings []string
+	markup := useMarkup || service.DetectMarkupSyntax(transpiler.HostCode(t.ApplyAliases(code)))
+	budget := h.svc.ComplexityBudget()
+	if c := t.MeasureComplexity(code, markup, budget); c.Exceeded {
+		return "", nil, []string{c.Diagnostic(budget).Message}
+	}
+	if transpiler.Islands(code) != nil {
+		result, err := t.TranspileMixed(code, markup, transpiler.MarkupOptions{})
+		output, errs, warnings = result.Output, result.Errors, result.Warnings
+		if err != nil {
+			errs = append(errs, err.Error())
+		}
+	} else if markup {
+		result, err := service.TranspileMarkup(t, code, TranspileRequest{})
+		output, errs, warnings = result.Output, result.Errors, result.Warnings
+		if err != nil {
+			errs = append(errs, err.Error())
+		}
+	} else {
+		output, errs = t.TranspileEmoji(code), t.CheckEmoji(code)
+	}
+	if len(errs) == 0 && strings.TrimSpace(output) == "" {
+		errs = []string{"Empty output"}
+	}
+	if files := transpiler.FileBuiltins(output); len(errs) == 0 && len(files) > 0 {
+		for i, name := range files {
+			files[i] = fileBuiltinNames[name]
+		}
+		errs = []string{fmt.Sprintf("%s can't run in the sandbox, which has no file system: build the program with emojic and run it with Node or Python instead", strings.Join(files, " and "))}
+	}
+	if len(errs) == 0 {
+		for _, loop := range sandbox.CheckLoops(output) {
+			warnings = append(warnings, loop.String())
+		}
+	}
+	return output, warnings, errs
+}
@@ -0,0 +1,52 @@
+package emojiscriptapi
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"emojiscript-backend/pkg/service"
+	"emojiscript-backend/pkg/usage"
+)
+
+func (h *handler) handleTranspile(w http.ResponseWriter, r *http.Request) {
+	var req TranspileRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeJSON(w, http.StatusBadRequest, TranspileResponse{
+			Success: false,
+			Errors:  []string{"Invalid request"},
+		})
+		return
+	}
+
+	bypass, err := service.CacheBypass(r.Header.Get("Cache-Control"), r.Header.Get(service.BypassCacheHeader), h.isAdmin(r), h.opts.Pool.Stats().Queued > 0)
+	if err != nil {
+		writeJSON(w, service.Status(err), TranspileResponse{Success: false, Errors: []string{err.Error()}})
+		return
+	}
+
+	_, isService := h.opts.ServiceTokens.FromRequest(r)
+	resp, err := h.svc.Transpile(req, service.Caller{
+		SessionID:   r.Header.Get("X-Session-ID"),
+		Service:     isService,
+		BypassCache: bypass,
+		Pipeline:    h.pipeline(r),
+	})
+	usage.FromContext(r.Context()).Transpiled(1)
+	writeJSON(w, service.Status(err), resp)
+}
+
+func (h *handler) handleTranspileProject(w http.ResponseWriter, r *http.Request) {
+	var req ProjectRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeJSON(w, http.StatusBadRequest, ProjectResponse{
+			Success: false,
+			Errors:  []string{"Invalid request"},
+		})
+		return
+	}
+
+	resp, err := h.svc.TranspileProject(req)
+	// each file of a project is transpiled in its own right
+	usage.FromContext(r.Context()).Transpiled(len(req.Files))
+	writeJSON(w, service.Status(err), resp)
+}
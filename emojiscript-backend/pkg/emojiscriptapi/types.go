@@ -0,0 +1,65 @@
+package emojiscriptapi
+
+import (
+	"emojiscript-backend/pkg/service"
+	"emojiscript-backend/pkg/transpiler"
+)
+
+// The transpile request and response types live in package service,
+// which both servers share
+type (
+	TranspileRequest  = service.TranspileRequest
+	TranspileResponse = service.TranspileResponse
+	ValidateResponse  = service.ValidateResponse
+	ProjectRequest    = service.ProjectRequest
+	ProjectResponse   = service.ProjectResponse
+)
+
+type TranscribeRequest struct {
+	Code      string `json:"code"`
+	Direction string `json:"direction,omitempty"`
+	Verbose   bool   `json:"verbose,omitempty"`
+}
+
+type FormatRequest struct {
+	Code      string `json:"code"`
+	Dialect   string `json:"dialect,omitempty"`
+	UseMarkup bool   `json:"useMarkup,omitempty"`
+}
+
+type HealthResponse struct {
+	Status  string `json:"status"`
+	Version string `json:"version"`
+}
+
+// ChangelogResponse lists language releases, newest first. Deprecations
+// are every deprecation still in effect, whichever release made it.
+type ChangelogResponse struct {
+	Success      bool                 `json:"success"`
+	Version      string               `json:"version"`
+	Releases     []transpiler.Release `json:"releases"`
+	Deprecations []transpiler.Change  `json:"deprecations"`
+}
+
+type Example struct {
+	// ID names the example among those of its syntax
+	ID             string `json:"id"`
+	Title          string `json:"title"`
+	Description    string `json:"description"`
+	Code           string `json:"code"`
+	Category       string `json:"category"`
+	Syntax         string `json:"syntax"`
+	TargetLanguage string `json:"targetLanguage,omitempty"`
+	// Order is the example's place in the learning path, from 1
+	Order int `json:"order"`
+	// Difficulty is beginner, intermediate or advanced
+	Difficulty string `json:"difficulty"`
+	// Prerequisites are the IDs of the examples to read first
+	Prerequisites []string `json:"prerequisites,omitempty"`
+	// Runnable is set for an example that runs in the sandbox as it is,
+	// without input or a network
+	Runnable bool `json:"runnable"`
+	// ExpectedOutput is what a runnable example prints, when that's the
+	// same every run; CheckExamples holds the examples to it
+	ExpectedOutput string `json:"expectedOutput,omitempty"`
+}
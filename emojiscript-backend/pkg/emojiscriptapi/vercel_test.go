@@ -0,0 +1,61 @@
+package emojiscriptapi
+
+import (
+	"encoding/json"
+	"os"
+	"strings"
+	"testing"
+)
+
+// TestVercelRewrites checks that vercel.json sends every route the
+// handler serves to the function, which answers 404 on Vercel for a path
+// nothing rewrites
+func TestVercelRewrites(t *testing.T) {
+	data, err := os.ReadFile("../../../vercel.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var config struct {
+		Rewrites []struct {
+			Source      string `json:"source"`
+			Destination string `json:"destination"`
+		} `json:"rewrites"`
+	}
+	if err := json.Unmarshal(data, &config); err != nil {
+		t.Fatal(err)
+	}
+
+	// rewritten reports whether a source, whose ":name" segments match
+	// any one segment, matches a pattern's path
+	rewritten := func(path string) bool {
+		segments := strings.Split(path, "/")
+		for _, rewrite := range config.Rewrites {
+			if rewrite.Destination != "/api/transpile" {
+				continue
+			}
+			source := strings.Split(rewrite.Source, "/")
+			if len(source) != len(segments) {
+				continue
+			}
+			matched := true
+			for i, segment := range source {
+				if !strings.HasPrefix(segment, ":") && segment != segments[i] {
+					matched = false
+					break
+				}
+			}
+			if matched {
+				return true
+			}
+		}
+		return false
+	}
+
+	h := newHandler(Options{})
+	for _, route := range h.routes {
+		_, path, _ := strings.Cut(route, " ")
+		if !rewritten(path) {
+			t.Errorf("%s has no rewrite in vercel.json", route)
+		}
+	}
+}
@@ -0,0 +1,169 @@
+package emojiscriptapi
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"regexp"
+	"strings"
+
+	"emojiscript-backend/pkg/hints"
+	"emojiscript-backend/pkg/service"
+	"emojiscript-backend/pkg/transpiler"
+	"emojiscript-backend/pkg/usage"
+)
+
+// DefaultWebhookRateLimit is how many webhook requests one client may make
+// a minute
+const DefaultWebhookRateLimit = 20
+
+// BotRequest is a forum post, or just its code, sent by a bot
+type BotRequest struct {
+	// Text is the post's Markdown; its code block is transpiled: the first
+	// fenced block tagged emoji or emojiscript, or else the first one
+	Text string `json:"text,omitempty"`
+	// Code is transpiled as is, for a bot that finds the block itself
+	Code           string `json:"code,omitempty"`
+	TargetLanguage string `json:"targetLanguage,omitempty"`
+	UseMarkup      *bool  `json:"useMarkup,omitempty"`
+	Syntax         string `json:"syntax,omitempty"`
+	Dialect        string `json:"dialect,omitempty"`
+}
+
+// BotReply is the reply for the bot to post. Reply is Markdown that
+// renders the same on Discourse and Reddit.
+type BotReply struct {
+	Success        bool   `json:"success"`
+	Reply          string `json:"reply"`
+	TargetLanguage string `json:"targetLanguage,omitempty"`
+	// Output is the transpiled code alone, for bots that format their own
+	// replies
+	Output string   `json:"output,omitempty"`
+	Errors []string `json:"errors,omitempty"`
+}
+
+// fencedBlock matches a fenced code block: its fence, info string and
+// body. The closing fence is checked separately, since it must repeat the
+// opening one.
+var fencedBlock = regexp.MustCompile("(?m)^ {0,3}(```+|~~~+)[ \t]*([^\\n`]*)\\n")
+
+// codeBlock finds the code block to transpile in a post's Markdown
+func codeBlock(text string) (string, bool) {
+	var first string
+	found := false
+	rest := text
+	for {
+		loc := fencedBlock.FindStringSubmatchIndex(rest)
+		if loc == nil {
+			return first, found
+		}
+		fence, info := rest[loc[2]:loc[3]], strings.TrimSpace(rest[loc[4]:loc[5]])
+		body := rest[loc[1]:]
+		end := strings.Index(body, "\n"+fence)
+		var code string
+		if end < 0 {
+			// an unclosed block runs to the end of the post
+			code, rest = body, ""
+		} else {
+			code, rest = body[:end], body[end+1+len(fence):]
+		}
+		lang, _, _ := strings.Cut(info, " ")
+		if strings.EqualFold(lang, "emoji") || strings.EqualFold(lang, "emojiscript") {
+			return code, true
+		}
+		if !found {
+			first, found = code, true
+		}
+	}
+}
+
+// fence picks a backtick fence longer than any run of backticks in code,
+// so the code can't close its block early
+func fence(code string) string {
+	longest, run := 0, 0
+	for _, r := range code {
+		if r == '`' {
+			run++
+			longest = max(longest, run)
+		} else {
+			run = 0
+		}
+	}
+	return strings.Repeat("`", max(3, longest+1))
+}
+
+// botReply formats a transpile response as a forum post
+func botReply(resp service.TranspileResponse, code string) string {
+	b := &strings.Builder{}
+	if resp.Success {
+		fmt.Fprintf(b, "Here it is in %s:\n\n", languageName(resp.TargetLanguage))
+		f := fence(resp.Output)
+		fmt.Fprintf(b, "%s%s\n%s\n%s\n", f, resp.TargetLanguage, strings.TrimRight(resp.Output, "\n"), f)
+		if len(resp.Warnings) > 0 {
+			b.WriteString("\nWarnings:\n\n")
+			for _, warning := range resp.Warnings {
+				fmt.Fprintf(b, "- %s\n", warning)
+			}
+		}
+	} else {
+		b.WriteString("That code didn't transpile:\n\n")
+		for _, err := range resp.Errors {
+			fmt.Fprintf(b, "- %s\n", err)
+		}
+		for _, hint := range hints.For(resp.Errors, code) {
+			fmt.Fprintf(b, "\n> %s\n", hint.Message)
+		}
+	}
+	fmt.Fprintf(b, "\n*EmojiScript %s*\n", transpiler.Version)
+	return b.String()
+}
+
+// languageName is how a reply names a target language
+func languageName(target string) string {
+	switch target {
+	case "javascript":
+		return "JavaScript"
+	case "typescript":
+		return "TypeScript"
+	case "gdscript":
+		return "GDScript"
+	case "rust":
+		return "Rust"
+	}
+	return target
+}
+
+// handleBotWebhook transpiles the code block of a forum post and answers
+// with a Markdown reply a bot can post as is
+func (h *handler) handleBotWebhook(w http.ResponseWriter, r *http.Request) {
+	var req BotRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeJSON(w, http.StatusBadRequest, BotReply{Errors: []string{"Invalid request"}})
+		return
+	}
+	code := req.Code
+	if code == "" {
+		block, found := codeBlock(req.Text)
+		if !found {
+			writeJSON(w, http.StatusUnprocessableEntity, BotReply{Errors: []string{"no code block found in text"}})
+			return
+		}
+		code = block
+	}
+
+	resp, err := h.svc.Transpile(service.TranspileRequest{
+		Code:           code,
+		UseMarkup:      req.UseMarkup,
+		Syntax:         req.Syntax,
+		Dialect:        req.Dialect,
+		TargetLanguage: req.TargetLanguage,
+	}, service.Caller{})
+	usage.FromContext(r.Context()).Transpiled(1)
+	writeJSON(w, service.Status(err), BotReply{
+		Success:        resp.Success,
+		Reply:          botReply(resp, code),
+		TargetLanguage: resp.TargetLanguage,
+		Output:         resp.Output,
+		Errors:         resp.Errors,
+	})
+}
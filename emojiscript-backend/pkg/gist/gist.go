@@ -0,0 +1,101 @@
+// Package gist creates GitHub Gists on behalf of a user, with the user's
+// own OAuth token; the server never stores the token.
+package gist
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+// DefaultAPIURL is github.com's REST API; GitHub Enterprise serves it
+// under https://<host>/api/v3
+const DefaultAPIURL = "https://api.github.com"
+
+// ErrUnauthorized is returned when GitHub rejects the token, or the
+// token lacks the gist scope
+var ErrUnauthorized = errors.New("github rejected the token; it needs the gist scope")
+
+// Gist is a gist to create; Files maps file names to their contents
+type Gist struct {
+	Description string
+	Public      bool
+	Files       map[string]string
+}
+
+// Created is a gist GitHub accepted
+type Created struct {
+	ID  string `json:"id"`
+	URL string `json:"url"`
+}
+
+// Client creates gists through a GitHub REST API
+type Client struct {
+	apiURL string
+	client *http.Client
+}
+
+// New creates a client for the API at apiURL, or DefaultAPIURL when empty
+func New(apiURL string) *Client {
+	if apiURL == "" {
+		apiURL = DefaultAPIURL
+	}
+	return &Client{apiURL: strings.TrimRight(apiURL, "/"), client: &http.Client{}}
+}
+
+// Create creates g as the user token authenticates
+func (c *Client) Create(ctx context.Context, token string, g Gist) (Created, error) {
+	files := make(map[string]map[string]string, len(g.Files))
+	for name, content := range g.Files {
+		files[name] = map[string]string{"content": content}
+	}
+	body, err := json.Marshal(map[string]interface{}{
+		"description": g.Description,
+		"public":      g.Public,
+		"files":       files,
+	})
+	if err != nil {
+		return Created{}, err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, c.apiURL+"/gists", bytes.NewReader(body))
+	if err != nil {
+		return Created{}, err
+	}
+	req.Header.Set("Authorization", "Bearer "+token)
+	req.Header.Set("Accept", "application/vnd.github+json")
+	req.Header.Set("X-GitHub-Api-Version", "2022-11-28")
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return Created{}, err
+	}
+	defer resp.Body.Close()
+
+	switch {
+	case resp.StatusCode == http.StatusUnauthorized, resp.StatusCode == http.StatusForbidden:
+		return Created{}, ErrUnauthorized
+	case resp.StatusCode != http.StatusCreated:
+		var reply struct {
+			Message string `json:"message"`
+		}
+		json.NewDecoder(resp.Body).Decode(&reply)
+		if reply.Message != "" {
+			return Created{}, fmt.Errorf("github: %s: %s", resp.Status, reply.Message)
+		}
+		return Created{}, fmt.Errorf("github: %s", resp.Status)
+	}
+
+	var reply struct {
+		ID      string `json:"id"`
+		HTMLURL string `json:"html_url"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&reply); err != nil {
+		return Created{}, fmt.Errorf("github: %v", err)
+	}
+	return Created{ID: reply.ID, URL: reply.HTMLURL}, nil
+}
@@ -0,0 +1,68 @@
+// Package golden holds the canonical input/output corpus for EmojiScript.
+// Every entry records the exact output the transpiler is expected to
+// produce, so clients can assert against the backend's source of truth.
+package golden
+
+import (
+	_ "embed"
+	"encoding/json"
+	"sort"
+	"sync"
+)
+
+//go:embed corpus.json
+var corpusJSON []byte
+
+// Fixture is a labeled input/output pair for a single language feature
+type Fixture struct {
+	Feature        string `json:"feature"`
+	Name           string `json:"name"`
+	Syntax         string `json:"syntax"`
+	TargetLanguage string `json:"targetLanguage"`
+	Input          string `json:"input"`
+	Output         string `json:"output"`
+}
+
+var (
+	loadOnce sync.Once
+	corpus   []Fixture
+)
+
+func load() []Fixture {
+	loadOnce.Do(func() {
+		if err := json.Unmarshal(corpusJSON, &corpus); err != nil {
+			panic("golden: invalid corpus.json: " + err.Error())
+		}
+	})
+	return corpus
+}
+
+// Fixtures returns every fixture, optionally filtered by feature and syntax.
+// Empty filters match everything.
+func Fixtures(feature, syntax string) []Fixture {
+	result := []Fixture{}
+	for _, f := range load() {
+		if feature != "" && f.Feature != feature {
+			continue
+		}
+		if syntax != "" && f.Syntax != syntax {
+			continue
+		}
+		result = append(result, f)
+	}
+	return result
+}
+
+// Features returns the sorted list of feature labels in the corpus
+func Features() []string {
+	seen := map[string]bool{}
+	features := []string{}
+	for _, f := range load() {
+		if !seen[f.Feature] {
+			seen[f.Feature] = true
+			features = append(features, f.Feature)
+		}
+	}
+	sort.Strings(features)
+	return features
+}
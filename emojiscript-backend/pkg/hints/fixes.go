@@ -0,0 +1,103 @@
+package hints
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+
+	"emojiscript-backend/pkg/refactor"
+	"emojiscript-backend/pkg/transpiler"
+)
+
+// closeTagFix adds the closing tag for the <tag> opened at line and
+// column: at the end of its line when its body starts there, otherwise on
+// a line of its own at the end of the program
+func closeTagFix(code, tag string, line, column int) *Fix {
+	lines := strings.Split(code, "\n")
+	if line < 1 || line > len(lines) {
+		return nil
+	}
+	title := fmt.Sprintf("Close <%s>", tag)
+	opening := []rune(lines[line-1])
+	if start := min(max(column-1, 0), len(opening)); start < len(opening) {
+		if end := strings.IndexRune(string(opening[start:]), '>'); end >= 0 {
+			rest := string(opening[start:])[end+1:]
+			if strings.TrimSpace(rest) != "" {
+				at := len(opening) + 1
+				return &Fix{Title: title, Edits: []refactor.Edit{{Line: line, Column: at, EndLine: line, EndColumn: at, NewText: "</" + tag + ">"}}}
+			}
+		}
+	}
+
+	last := len(lines)
+	for last > line && strings.TrimSpace(lines[last-1]) == "" {
+		last--
+	}
+	indent := lines[line-1][:len(lines[line-1])-len(strings.TrimLeft(lines[line-1], " \t"))]
+	at := len([]rune(lines[last-1])) + 1
+	return &Fix{Title: title, Edits: []refactor.Edit{{Line: last, Column: at, EndLine: last, EndColumn: at, NewText: "\n" + indent + "</" + tag + ">"}}}
+}
+
+// renameAttributeFix renames a markup name given as an attribute value,
+// e.g. name="if", everywhere it is given
+func renameAttributeFix(code, name, replacement string) *Fix {
+	replacement = freshName(code, replacement)
+	pattern := regexp.MustCompile(`[\w-]+\s*=\s*["'](` + regexp.QuoteMeta(name) + `)["']`)
+	var edits []refactor.Edit
+	for _, loc := range pattern.FindAllStringSubmatchIndex(code, -1) {
+		line, column := position(code, loc[2])
+		edits = append(edits, refactor.Edit{Line: line, Column: column, EndLine: line, EndColumn: column + len([]rune(name)), NewText: replacement})
+	}
+	if len(edits) == 0 {
+		return nil
+	}
+	return &Fix{Title: fmt.Sprintf("Rename '%s' to '%s'", name, replacement), Edits: edits}
+}
+
+// semicolonFix inserts a ';' where the JavaScript parser expected one, at
+// line and column of the transpiled output. Emoji source keeps its lines,
+// so the column is traced back to the source by transpiling ever longer
+// prefixes of the line until one produces the JavaScript before it.
+func semicolonFix(code string, line, column int) *Fix {
+	lines := strings.Split(code, "\n")
+	output := strings.Split(transpiler.TranspileEmoji(code, "javascript"), "\n")
+	if line < 1 || line > len(lines) || len(output) != len(lines) {
+		return nil
+	}
+	js := []rune(transpiler.TranspileEmoji(lines[line-1], "javascript"))
+	if string(js) != output[line-1] || column < 2 || column-1 > len(js) {
+		return nil
+	}
+	before := strings.TrimRight(string(js[:column-1]), " \t")
+
+	source := []rune(lines[line-1])
+	for k := 1; k <= len(source); k++ {
+		prefix := string(source[:k])
+		if strings.TrimRight(transpiler.TranspileEmoji(prefix, "javascript"), " \t") == before {
+			at := len([]rune(strings.TrimRight(prefix, " \t"))) + 1
+			return &Fix{Title: "Insert ';'", Edits: []refactor.Edit{{Line: line, Column: at, EndLine: line, EndColumn: at, NewText: ";"}}}
+		}
+	}
+	return nil
+}
+
+// freshName returns name, numbered if the source already uses it
+func freshName(code, name string) string {
+	used := map[string]bool{}
+	for _, word := range identifierPattern.FindAllString(code, -1) {
+		used[word] = true
+	}
+	candidate := name
+	for n := 2; used[candidate]; n++ {
+		candidate = fmt.Sprintf("%s%d", name, n)
+	}
+	return candidate
+}
+
+// position converts a byte offset in code to a line and a column counted
+// in characters, both from 1
+func position(code string, offset int) (int, int) {
+	before := code[:offset]
+	start := strings.LastIndex(before, "\n") + 1
+	return strings.Count(before, "\n") + 1, len([]rune(before[start:])) + 1
+}
@@ -0,0 +1,380 @@
+// Package hints turns diagnostics into advice aimed at beginners. Each rule
+// matches a diagnostic message and builds a hint from the match and the
+// program's source; cover a new message by adding a Rule to Rules. Rules
+// that know how to repair their diagnostic attach a Fix.
+package hints
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"emojiscript-backend/pkg/refactor"
+)
+
+// Hint is the advice for one diagnostic
+type Hint struct {
+	Rule       string `json:"rule"`
+	Diagnostic string `json:"diagnostic"`
+	Message    string `json:"message"`
+	Line       int    `json:"line,omitempty"`
+	Column     int    `json:"column,omitempty"`
+	Fix        *Fix   `json:"fix,omitempty"`
+}
+
+// Fix is a machine-applicable repair: applying Edits to the source with
+// refactor.Apply resolves the diagnostic
+type Fix struct {
+	Title string          `json:"title"`
+	Edits []refactor.Edit `json:"edits"`
+}
+
+// Rule matches diagnostics by Pattern. Hint receives the pattern's
+// submatches and the source and fills in at least Message. Fix, if set,
+// receives the located hint too and returns nil when it can't help.
+type Rule struct {
+	Name    string
+	Pattern *regexp.Regexp
+	Hint    func(match []string, code string) Hint
+	Fix     func(match []string, code string, hint Hint) *Fix
+}
+
+// Rules is consulted in order; the first rule matching a diagnostic wins
+var Rules = []Rule{
+	{
+		Name:    "unbalanced-braces",
+		Pattern: regexp.MustCompile(`(?i)unbalanced braces`),
+		Hint: func(match []string, code string) Hint {
+			return bracketHint(code, '{', '}')
+		},
+	},
+	{
+		Name:    "unbalanced-parentheses",
+		Pattern: regexp.MustCompile(`(?i)unbalanced parentheses`),
+		Hint: func(match []string, code string) Hint {
+			return bracketHint(code, '(', ')')
+		},
+	},
+	{
+		Name:    "reserved-keyword",
+		Pattern: regexp.MustCompile(`'(\w+)' is a reserved keyword`),
+		Hint: func(match []string, code string) Hint {
+			word := match[1]
+			return Hint{Message: fmt.Sprintf("'%s' already means something in the language, so it can't be used as a name. Try a more descriptive name such as '%sValue' or 'my%s'.", word, word, strings.ToUpper(word[:1])+word[1:])}
+		},
+		Fix: func(match []string, code string, hint Hint) *Fix {
+			return renameAttributeFix(code, match[1], match[1]+"Value")
+		},
+	},
+	{
+		Name:    "invalid-identifier",
+		Pattern: regexp.MustCompile(`invalid identifier: (.+)$`),
+		Hint: func(match []string, code string) Hint {
+			msg := "Names can only contain letters, digits, _ and $, and can't start with a digit."
+			if suggestion := identifierFrom(match[1]); suggestion != "" {
+				msg += fmt.Sprintf(" Try '%s'.", suggestion)
+			}
+			return Hint{Message: msg}
+		},
+	},
+	{
+		Name:    "empty-identifier",
+		Pattern: regexp.MustCompile(`empty identifier`),
+		Hint: func(match []string, code string) Hint {
+			return Hint{Message: "This tag needs a name attribute, e.g. name=\"total\"."}
+		},
+	},
+	{
+		Name:    "const-assignment",
+		Pattern: regexp.MustCompile(`'(\w+)' is a constant and can't be reassigned`),
+		Hint: func(match []string, code string) Hint {
+			return Hint{Message: fmt.Sprintf("'%s' was declared with const, so its value can't change. Declare it with let instead if it needs to.", match[1])}
+		},
+	},
+	{
+		Name:    "redeclared-variable",
+		Pattern: regexp.MustCompile(`'(\w+)' is already declared in this scope`),
+		Hint: func(match []string, code string) Hint {
+			return Hint{Message: fmt.Sprintf("'%s' already exists here. To change its value, assign to it without let or const; for a separate variable, pick another name.", match[1])}
+		},
+	},
+	{
+		Name:    "unclosed-tag",
+		Pattern: regexp.MustCompile(`unclosed tag <(\w+)>`),
+		Hint: func(match []string, code string) Hint {
+			return Hint{Message: fmt.Sprintf("Every <%s> needs a matching </%s> after its body, or write it self-closing as <%s ... />.", match[1], match[1], match[1])}
+		},
+		Fix: func(match []string, code string, hint Hint) *Fix {
+			return closeTagFix(code, match[1], hint.Line, hint.Column)
+		},
+	},
+	{
+		Name:    "mixed-block",
+		Pattern: regexp.MustCompile(`in <(\w+)> (?:is never closed before|closes a block opened outside)`),
+		Hint: func(match []string, code string) Hint {
+			return Hint{Message: fmt.Sprintf("A block in code has to open and close inside the same tag. Close it before </%s>, or write the whole block with a tag such as <if> or <loop>.", match[1])}
+		},
+	},
+	{
+		Name:    "missing-attribute",
+		Pattern: regexp.MustCompile(`missing required attribute '(\w+)' on <(\w+)>`),
+		Hint: func(match []string, code string) Hint {
+			return Hint{Message: fmt.Sprintf("<%s> needs a %s attribute, e.g. <%s %s=\"...\">.", match[2], match[1], match[2], match[1])}
+		},
+	},
+	{
+		Name:    "loop-configuration",
+		Pattern: regexp.MustCompile(`<(\w+)> at line \d+, column \d+ needs in, times or from and to`),
+		Hint: func(match []string, code string) Hint {
+			return Hint{Message: fmt.Sprintf("Tell <%s> what to repeat over: in=\"items\" visits each item, times=\"3\" repeats a number of times, and from=\"0\" to=\"10\" counts through a range.", match[1])}
+		},
+	},
+	{
+		Name:    "missing-angle",
+		Pattern: regexp.MustCompile(`expected '>'`),
+		Hint: func(match []string, code string) Hint {
+			return Hint{Message: "A tag is missing its closing '>'. Check for a stray quote in an attribute, which hides the '>' inside a string."}
+		},
+	},
+	{
+		Name:    "missing-semicolon",
+		Pattern: regexp.MustCompile(`expected ';' but found (.+?) \(line`),
+		Hint: func(match []string, code string) Hint {
+			return Hint{Message: fmt.Sprintf("Two statements run together before %s. Put each statement on its own line, or separate them with ';'.", match[1])}
+		},
+		Fix: func(match []string, code string, hint Hint) *Fix {
+			return semicolonFix(code, hint.Line, hint.Column)
+		},
+	},
+	{
+		Name:    "empty-code",
+		Pattern: regexp.MustCompile(`(?i)code cannot be empty|empty input`),
+		Hint: func(match []string, code string) Hint {
+			return Hint{Message: "There's no code yet. Start with a single line such as 📝(\"Hello!\")."}
+		},
+	},
+	{
+		Name:    "not-defined",
+		Pattern: regexp.MustCompile(`ReferenceError: ([\w$]+) is not defined`),
+		Hint: func(match []string, code string) Hint {
+			name := match[1]
+			msg := fmt.Sprintf("'%s' is used before it was created. Declare it first with 📦 (const) or 🔢 (let), or check the spelling.", name)
+			if guess := closestName(name, code); guess != "" {
+				msg = fmt.Sprintf("'%s' doesn't exist. Did you mean '%s'?", name, guess)
+			}
+			return withLocation(Hint{Message: msg}, code, name)
+		},
+	},
+	{
+		Name:    "assign-to-constant",
+		Pattern: regexp.MustCompile(`Assignment to constant variable`),
+		Hint: func(match []string, code string) Hint {
+			return Hint{Message: "A value declared with 📦 (const) can't change. Declare it with 🔢 (let) if you need to assign it again."}
+		},
+	},
+	{
+		Name:    "already-declared",
+		Pattern: regexp.MustCompile(`Identifier '([\w$]+)' has already been declared`),
+		Hint: func(match []string, code string) Hint {
+			return Hint{Message: fmt.Sprintf("'%s' is declared twice. Drop the 📦/🔢 on the second one to update the existing value, or pick a new name.", match[1])}
+		},
+	},
+	{
+		Name:    "not-a-function",
+		Pattern: regexp.MustCompile(`TypeError: (.+) is not a function`),
+		Hint: func(match []string, code string) Hint {
+			return Hint{Message: fmt.Sprintf("%s can't be called with (). Check the spelling of the function name and that it was defined with 🎯.", match[1])}
+		},
+	},
+	{
+		Name:    "property-of-nothing",
+		Pattern: regexp.MustCompile(`Cannot (?:read|set) properties of (undefined|null) \((?:reading|setting) '([^']*)'\)`),
+		Hint: func(match []string, code string) Hint {
+			return Hint{Message: fmt.Sprintf("The value before .%s is %s, so it has no properties. Make sure it was given a value before this line.", match[2], match[1])}
+		},
+	},
+	{
+		Name:    "infinite-loop",
+		Pattern: regexp.MustCompile(`step limit exceeded|instruction limit exceeded|time limit exceeded`),
+		Hint: func(match []string, code string) Hint {
+			return Hint{Message: "The program ran for too long, which usually means a loop never ends. Check that the loop's condition eventually becomes false, e.g. that its counter changes each time round."}
+		},
+	},
+	{
+		Name:    "runaway-recursion",
+		Pattern: regexp.MustCompile(`Maximum call stack size exceeded`),
+		Hint: func(match []string, code string) Hint {
+			return Hint{Message: "A function keeps calling itself forever. Give it a base case that 🔙 returns without calling itself again."}
+		},
+	},
+	{
+		Name:    "memory-limit",
+		Pattern: regexp.MustCompile(`memory limit exceeded`),
+		Hint: func(match []string, code string) Hint {
+			return Hint{Message: "The program kept more data than the sandbox allows. Check for a loop that keeps adding to an array or string without stopping, or build smaller values."}
+		},
+	},
+}
+
+var locationPattern = regexp.MustCompile(`line (\d+)(?:, column (\d+)|:(\d+))?`)
+
+// For returns a hint for each diagnostic a rule recognizes, dropping
+// repeats (a parser may report an error both alone and in a summary)
+func For(diagnostics []string, code string) []Hint {
+	hints := []Hint{}
+	seen := map[string]bool{}
+	for _, diagnostic := range diagnostics {
+		for _, rule := range Rules {
+			match := rule.Pattern.FindStringSubmatch(diagnostic)
+			if match == nil {
+				continue
+			}
+			hint := rule.Hint(match, code)
+			hint.Rule = rule.Name
+			hint.Diagnostic = diagnostic
+			if hint.Line == 0 {
+				if loc := locationPattern.FindStringSubmatch(diagnostic); loc != nil {
+					hint.Line, _ = strconv.Atoi(loc[1])
+					hint.Column, _ = strconv.Atoi(loc[2] + loc[3])
+				}
+			}
+			if rule.Fix != nil {
+				hint.Fix = rule.Fix(match, code, hint)
+			}
+			if !seen[hint.Message] {
+				seen[hint.Message] = true
+				hints = append(hints, hint)
+			}
+			break
+		}
+	}
+	return hints
+}
+
+// bracketHint points at the first bracket that is never closed, or the
+// first closing bracket with no opener. Strings and // comments are skipped.
+func bracketHint(code string, open, close rune) Hint {
+	type position struct{ line, column int }
+	stack := []position{}
+	line, column := 1, 0
+	var quote, prev rune
+	escaped, comment := false, false
+	for _, r := range code {
+		column++
+		switch {
+		case r == '\n':
+			line, column = line+1, 0
+			comment = false
+			if quote != '`' {
+				quote = 0
+			}
+		case comment:
+		case escaped:
+			escaped = false
+		case quote != 0:
+			if r == '\\' {
+				escaped = true
+			} else if r == quote {
+				quote = 0
+			}
+		case r == '"' || r == '\'' || r == '`':
+			quote = r
+		case r == '/' && prev == '/':
+			comment = true
+		case r == open:
+			stack = append(stack, position{line, column})
+		case r == close:
+			if len(stack) == 0 {
+				return Hint{
+					Message: fmt.Sprintf("This '%c' on line %d has no matching '%c' before it. Remove it or add the missing '%c'.", close, line, open, open),
+					Line:    line, Column: column,
+				}
+			}
+			stack = stack[:len(stack)-1]
+		}
+		prev = r
+	}
+	if len(stack) > 0 {
+		p := stack[0]
+		return Hint{
+			Message: fmt.Sprintf("The '%c' on line %d, column %d is never closed. Add a '%c' where its block ends.", open, p.line, p.column, close),
+			Line:    p.line, Column: p.column,
+		}
+	}
+	return Hint{Message: fmt.Sprintf("Every '%c' needs a matching '%c'.", open, close)}
+}
+
+// identifierFrom strips a name down to valid identifier characters
+func identifierFrom(name string) string {
+	var b strings.Builder
+	for _, r := range name {
+		switch {
+		case r >= 'a' && r <= 'z', r >= 'A' && r <= 'Z', r == '_', r == '$':
+			b.WriteRune(r)
+		case r >= '0' && r <= '9':
+			if b.Len() == 0 {
+				b.WriteRune('_')
+			}
+			b.WriteRune(r)
+		case r == '-' || r == ' ':
+			b.WriteRune('_')
+		}
+	}
+	return b.String()
+}
+
+var identifierPattern = regexp.MustCompile(`[A-Za-z_$][\w$]*`)
+
+// closestName finds a name in the source (or a common global) within two
+// edits of name
+func closestName(name, code string) string {
+	candidates := append(identifierPattern.FindAllString(code, -1), "console", "Math", "JSON", "Number", "String", "Array", "Object")
+	best, bestDistance := "", 3
+	for _, candidate := range candidates {
+		if candidate == name {
+			continue
+		}
+		if d := editDistance(strings.ToLower(name), strings.ToLower(candidate)); d < bestDistance {
+			best, bestDistance = candidate, d
+		}
+	}
+	return best
+}
+
+func editDistance(a, b string) int {
+	ra, rb := []rune(a), []rune(b)
+	prev := make([]int, len(rb)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+	for i := 1; i <= len(ra); i++ {
+		cur := make([]int, len(rb)+1)
+		cur[0] = i
+		for j := 1; j <= len(rb); j++ {
+			cost := 1
+			if ra[i-1] == rb[j-1] {
+				cost = 0
+			}
+			cur[j] = min(prev[j]+1, cur[j-1]+1, prev[j-1]+cost)
+		}
+		prev = cur
+	}
+	return prev[len(rb)]
+}
+
+// withLocation points the hint at the first use of name in the source
+func withLocation(h Hint, code, name string) Hint {
+	pattern := regexp.MustCompile(`(^|[^\w$])` + regexp.QuoteMeta(name) + `($|[^\w$])`)
+	for i, line := range strings.Split(code, "\n") {
+		if loc := pattern.FindStringIndex(line); loc != nil {
+			start := loc[0]
+			if line[start:start+len(name)] != name {
+				start++
+			}
+			h.Line, h.Column = i+1, len([]rune(line[:start]))+1
+			return h
+		}
+	}
+	return h
+}
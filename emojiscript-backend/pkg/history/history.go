@@ -0,0 +1,124 @@
+// Package history keeps bounded per-session transpile logs.
+package history
+
+import (
+	"regexp"
+	"sync"
+	"time"
+)
+
+const (
+	MaxEntries  = 50
+	MaxSessions = 1000
+	TTL         = 24 * time.Hour
+)
+
+var sessionIDPattern = regexp.MustCompile(`^[A-Za-z0-9_-]{1,128}$`)
+
+// Entry records one transpile made within a session
+type Entry struct {
+	ID             string    `json:"id"`
+	SourceHash     string    `json:"sourceHash"`
+	Timestamp      time.Time `json:"timestamp"`
+	TargetLanguage string    `json:"targetLanguage"`
+	UsedMarkup     bool      `json:"usedMarkup"`
+	Success        bool      `json:"success"`
+	CodeLength     int       `json:"codeLength"`
+	ErrorCount     int       `json:"errorCount"`
+	WarningCount   int       `json:"warningCount"`
+	Source         string    `json:"source,omitempty"`
+}
+
+type sessionHistory struct {
+	entries  []Entry
+	lastSeen time.Time
+}
+
+// Store keeps a bounded, per-session log of transpiles
+type Store struct {
+	mu       sync.Mutex
+	sessions map[string]*sessionHistory
+}
+
+// New creates an empty history store
+func New() *Store {
+	return &Store{sessions: make(map[string]*sessionHistory)}
+}
+
+// ValidSessionID reports whether id is an acceptable session identifier
+func ValidSessionID(id string) bool {
+	return sessionIDPattern.MatchString(id)
+}
+
+// Record appends an entry to the session, dropping the oldest entries and
+// the least recently seen sessions once the bounds are reached
+func (th *Store) Record(sessionID string, entry Entry) {
+	th.mu.Lock()
+	defer th.mu.Unlock()
+
+	session, exists := th.sessions[sessionID]
+	if !exists {
+		if len(th.sessions) >= MaxSessions {
+			th.evictLocked()
+		}
+		session = &sessionHistory{}
+		th.sessions[sessionID] = session
+	}
+
+	session.lastSeen = time.Now()
+	session.entries = append(session.entries, entry)
+	if len(session.entries) > MaxEntries {
+		session.entries = session.entries[len(session.entries)-MaxEntries:]
+	}
+}
+
+// Entries returns the session's history, newest first
+func (th *Store) Entries(sessionID string) []Entry {
+	th.mu.Lock()
+	defer th.mu.Unlock()
+
+	session, exists := th.sessions[sessionID]
+	if !exists || time.Since(session.lastSeen) > TTL {
+		return []Entry{}
+	}
+
+	entries := make([]Entry, len(session.entries))
+	for i, entry := range session.entries {
+		entries[len(entries)-1-i] = entry
+	}
+	return entries
+}
+
+// Entry returns a single history entry by ID
+func (th *Store) Entry(sessionID, id string) (Entry, bool) {
+	for _, entry := range th.Entries(sessionID) {
+		if entry.ID == id {
+			return entry, true
+		}
+	}
+	return Entry{}, false
+}
+
+// Clear forgets everything recorded for the session
+func (th *Store) Clear(sessionID string) {
+	th.mu.Lock()
+	defer th.mu.Unlock()
+	delete(th.sessions, sessionID)
+}
+
+func (th *Store) evictLocked() {
+	var oldestID string
+	var oldestTime time.Time
+	for id, session := range th.sessions {
+		if time.Since(session.lastSeen) > TTL {
+			delete(th.sessions, id)
+			continue
+		}
+		if oldestID == "" || session.lastSeen.Before(oldestTime) {
+			oldestID, oldestTime = id, session.lastSeen
+		}
+	}
+	if len(th.sessions) >= MaxSessions {
+		delete(th.sessions, oldestID)
+	}
+}
@@ -0,0 +1,240 @@
+// Package idempotency lets clients retry state-changing requests safely.
+// A request carrying an Idempotency-Key header runs once; retries with the
+// same key get the stored response back instead of repeating the work.
+package idempotency
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"sync"
+	"time"
+)
+
+const (
+	// Header is the request header holding the client's key
+	Header = "Idempotency-Key"
+	// ReplayedHeader is set on responses served from the store
+	ReplayedHeader = "Idempotent-Replayed"
+
+	DefaultTTL        = 24 * time.Hour
+	DefaultMaxEntries = 10000
+	MaxKeyLength      = 255
+	// MaxBody bounds the body of a request carrying a key; larger ones are
+	// refused rather than fingerprinted by a prefix
+	MaxBody = 1 << 20
+)
+
+var (
+	ErrInFlight = errors.New("a request with this Idempotency-Key is still in progress")
+	ErrMismatch = errors.New("this Idempotency-Key was already used for a different request")
+	ErrKey      = errors.New("Idempotency-Key must be 1 to 255 characters")
+	ErrTooLarge = errors.New("request body is too large for an Idempotency-Key")
+)
+
+// Response is a stored reply
+type Response struct {
+	Status int
+	Header http.Header
+	Body   []byte
+}
+
+type entry struct {
+	fingerprint string
+	done        bool
+	response    Response
+	expires     time.Time
+}
+
+// Store remembers responses by key until they expire. It is safe for
+// concurrent use.
+type Store struct {
+	mu         sync.Mutex
+	entries    map[string]*entry
+	order      []string
+	ttl        time.Duration
+	maxEntries int
+}
+
+// New creates a store; zero values pick DefaultTTL and DefaultMaxEntries
+func New(ttl time.Duration, maxEntries int) *Store {
+	if ttl <= 0 {
+		ttl = DefaultTTL
+	}
+	if maxEntries <= 0 {
+		maxEntries = DefaultMaxEntries
+	}
+	return &Store{entries: map[string]*entry{}, ttl: ttl, maxEntries: maxEntries}
+}
+
+// Fingerprint identifies a request so a key can't be reused for another
+func Fingerprint(method, path string, body []byte) string {
+	hash := sha256.New()
+	io.WriteString(hash, method+" "+path+"\n")
+	hash.Write(body)
+	return hex.EncodeToString(hash.Sum(nil))
+}
+
+// Begin claims key for a request. It returns the stored response when the
+// key has already completed, ErrInFlight while the first request is still
+// running and ErrMismatch when the key was used with another fingerprint.
+// A nil response and error mean the caller should run the request and then
+// call Complete or Abort.
+func (s *Store) Begin(key, fingerprint string) (*Response, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	now := time.Now()
+	if e, ok := s.entries[key]; ok && now.Before(e.expires) {
+		switch {
+		case e.fingerprint != fingerprint:
+			return nil, ErrMismatch
+		case !e.done:
+			return nil, ErrInFlight
+		}
+		response := e.response
+		return &response, nil
+	}
+
+	s.evict(now)
+	s.entries[key] = &entry{fingerprint: fingerprint, expires: now.Add(s.ttl)}
+	s.order = append(s.order, key)
+	return nil, nil
+}
+
+// Complete stores the response for a key claimed by Begin
+func (s *Store) Complete(key string, response Response) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if e, ok := s.entries[key]; ok {
+		e.done, e.response = true, response
+	}
+}
+
+// Abort releases a key without storing a response, so a retry runs again
+func (s *Store) Abort(key string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.entries, key)
+}
+
+// evict drops expired entries and, when full, the oldest ones
+func (s *Store) evict(now time.Time) {
+	kept := s.order[:0]
+	for _, key := range s.order {
+		e, ok := s.entries[key]
+		switch {
+		case !ok:
+		case now.After(e.expires) || len(s.entries) >= s.maxEntries:
+			delete(s.entries, key)
+		default:
+			kept = append(kept, key)
+		}
+	}
+	s.order = kept
+}
+
+// Scope namespaces a client's key, e.g. by session, so different clients
+// choosing the same key don't collide
+func Scope(scope, key string) string {
+	return scope + "\x00" + key
+}
+
+// Middleware runs next once per Idempotency-Key. Requests without the
+// header pass straight through; server errors are not stored, so they can
+// be retried, and bodies over MaxBody are refused with 413. scope picks the
+// key's namespace for a request and may be nil.
+func (s *Store) Middleware(next http.Handler, scope func(*http.Request) string) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		key := r.Header.Get(Header)
+		if key == "" {
+			next.ServeHTTP(w, r)
+			return
+		}
+		if len(key) > MaxKeyLength {
+			writeError(w, http.StatusBadRequest, ErrKey)
+			return
+		}
+		if scope != nil {
+			key = Scope(scope(r), key)
+		}
+
+		body, err := io.ReadAll(io.LimitReader(r.Body, MaxBody+1))
+		if err != nil {
+			writeError(w, http.StatusBadRequest, err)
+			return
+		}
+		// two bodies sharing their first MaxBody bytes would otherwise
+		// share a fingerprint
+		if len(body) > MaxBody {
+			writeError(w, http.StatusRequestEntityTooLarge, ErrTooLarge)
+			return
+		}
+		r.Body = io.NopCloser(bytes.NewReader(body))
+
+		stored, err := s.Begin(key, Fingerprint(r.Method, r.URL.Path, body))
+		switch {
+		case errors.Is(err, ErrInFlight):
+			w.Header().Set("Retry-After", "1")
+			writeError(w, http.StatusConflict, err)
+			return
+		case errors.Is(err, ErrMismatch):
+			writeError(w, http.StatusUnprocessableEntity, err)
+			return
+		case stored != nil:
+			// headers this request already has, such as CORS, are its own
+			for name, values := range stored.Header {
+				if _, set := w.Header()[name]; !set {
+					w.Header()[name] = values
+				}
+			}
+			w.Header().Set(ReplayedHeader, "true")
+			w.WriteHeader(stored.Status)
+			w.Write(stored.Body)
+			return
+		}
+
+		rec := &recorder{ResponseWriter: w, status: http.StatusOK}
+		defer func() {
+			if p := recover(); p != nil {
+				s.Abort(key)
+				panic(p)
+			}
+			if rec.status >= 500 {
+				s.Abort(key)
+				return
+			}
+			s.Complete(key, Response{Status: rec.status, Header: w.Header().Clone(), Body: rec.body.Bytes()})
+		}()
+		next.ServeHTTP(rec, r)
+	})
+}
+
+// recorder copies a response while it is written
+type recorder struct {
+	http.ResponseWriter
+	status int
+	body   bytes.Buffer
+}
+
+func (r *recorder) WriteHeader(status int) {
+	r.status = status
+	r.ResponseWriter.WriteHeader(status)
+}
+
+func (r *recorder) Write(b []byte) (int, error) {
+	r.body.Write(b)
+	return r.ResponseWriter.Write(b)
+}
+
+func writeError(w http.ResponseWriter, status int, err error) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(struct {
+		Success bool   `json:"success"`
+		Error   string `json:"error"`
+	}{false, err.Error()})
+}
@@ -0,0 +1,146 @@
+package idempotency
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// counter answers each request with how many it has served, failing with
+// status when it's set
+type counter struct {
+	n      atomic.Int32
+	status int
+}
+
+func (c *counter) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	n := c.n.Add(1)
+	if c.status != 0 {
+		w.WriteHeader(c.status)
+	}
+	w.Write([]byte(strconv.Itoa(int(n))))
+}
+
+func send(h http.Handler, key, body string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest("POST", "/jobs", strings.NewReader(body))
+	if key != "" {
+		req.Header.Set(Header, key)
+	}
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, req)
+	return rec
+}
+
+// TestMiddleware checks that a retry gets the first response back, and
+// that a key can't be reused for another request
+func TestMiddleware(t *testing.T) {
+	next := &counter{}
+	h := New(0, 0).Middleware(next, nil)
+	for _, tt := range []struct {
+		key, body string
+		status    int
+		want      string
+		replayed  bool
+	}{
+		{"a", "x", http.StatusOK, "1", false},
+		{"a", "x", http.StatusOK, "1", true},
+		{"a", "y", http.StatusUnprocessableEntity, "", false},
+		{"b", "y", http.StatusOK, "2", false},
+		{"", "x", http.StatusOK, "3", false},
+		{"", "x", http.StatusOK, "4", false},
+		{strings.Repeat("k", MaxKeyLength+1), "x", http.StatusBadRequest, "", false},
+	} {
+		rec := send(h, tt.key, tt.body)
+		if rec.Code != tt.status || (tt.want != "" && rec.Body.String() != tt.want) {
+			t.Errorf("key %.10q, body %q: got %d %s, want %d %s", tt.key, tt.body, rec.Code, rec.Body, tt.status, tt.want)
+		}
+		if replayed := rec.Header().Get(ReplayedHeader) == "true"; replayed != tt.replayed {
+			t.Errorf("key %.10q, body %q: replayed = %v, want %v", tt.key, tt.body, replayed, tt.replayed)
+		}
+	}
+	if rec := send(h, "c", strings.Repeat("x", MaxBody+1)); rec.Code != http.StatusRequestEntityTooLarge {
+		t.Errorf("oversized body: got %d, want 413", rec.Code)
+	}
+}
+
+// TestMiddlewareServerError checks that a failed request isn't stored, so
+// its retry runs again
+func TestMiddlewareServerError(t *testing.T) {
+	next := &counter{status: http.StatusInternalServerError}
+	h := New(0, 0).Middleware(next, nil)
+	send(h, "a", "x")
+	next.status = 0
+	if rec := send(h, "a", "x"); rec.Code != http.StatusOK || rec.Body.String() != "2" {
+		t.Errorf("retry after a 500: got %d %s, want the request run again", rec.Code, rec.Body)
+	}
+}
+
+// TestMiddlewareInFlight checks that a retry while the first request runs
+// is told to wait
+func TestMiddlewareInFlight(t *testing.T) {
+	started, release := make(chan bool), make(chan bool)
+	h := New(0, 0).Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		started <- true
+		<-release
+	}), nil)
+	done := make(chan bool)
+	go func() {
+		send(h, "a", "x")
+		done <- true
+	}()
+	<-started
+	rec := send(h, "a", "x")
+	close(release)
+	<-done
+	if rec.Code != http.StatusConflict || rec.Header().Get("Retry-After") == "" {
+		t.Errorf("got %d with Retry-After %q, want 409 with one", rec.Code, rec.Header().Get("Retry-After"))
+	}
+}
+
+// TestMiddlewareScope checks that clients choosing the same key don't get
+// each other's responses
+func TestMiddlewareScope(t *testing.T) {
+	next := &counter{}
+	h := New(0, 0).Middleware(next, func(r *http.Request) string { return r.Header.Get("X-Client") })
+	for i, client := range []string{"alice", "bob", "alice"} {
+		req := httptest.NewRequest("POST", "/jobs", strings.NewReader("x"))
+		req.Header.Set(Header, "a")
+		req.Header.Set("X-Client", client)
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, req)
+		if want := []string{"1", "2", "1"}[i]; rec.Body.String() != want {
+			t.Errorf("%s: got %s, want %s", client, rec.Body, want)
+		}
+	}
+}
+
+// TestStoreExpiry checks that keys are forgotten once they expire or
+// the store is full
+func TestStoreExpiry(t *testing.T) {
+	s := New(20*time.Millisecond, 0)
+	s.Begin("a", "f")
+	s.Complete("a", Response{Status: http.StatusOK})
+	if stored, _ := s.Begin("a", "f"); stored == nil {
+		t.Fatal("got no stored response before it expired")
+	}
+	time.Sleep(30 * time.Millisecond)
+	if stored, err := s.Begin("a", "f"); stored != nil || err != nil {
+		t.Errorf("got %v, %v after it expired, want the key claimed afresh", stored, err)
+	}
+
+	s = New(0, 2)
+	for _, key := range []string{"a", "b", "c"} {
+		s.Begin(key, "f")
+		s.Complete(key, Response{Status: http.StatusOK})
+	}
+	if stored, _ := s.Begin("c", "f"); stored == nil {
+		t.Error("the newest key was evicted")
+	}
+	if stored, _ := s.Begin("a", "f"); stored != nil {
+		t.Error("the oldest key outlived a full store")
+	}
+}
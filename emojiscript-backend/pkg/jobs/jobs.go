@@ -0,0 +1,287 @@
+// Package jobs answers requests too big to finish before a serverless
+// timeout. Such a request runs in the background as a job; the client
+// gets 202 with the job's URL and polls it for the response the request
+// would have had. Jobs live in memory, and, given a storage.Store, are
+// kept there too so any instance can answer for them.
+package jobs
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"sync"
+	"time"
+
+	"emojiscript-backend/pkg/storage"
+)
+
+const (
+	// DefaultTTL is how long a finished job's response is kept
+	DefaultTTL     = 15 * time.Minute
+	DefaultMaxJobs = 1000
+)
+
+// ErrFull is returned when every slot holds a job still running
+var ErrFull = errors.New("too many jobs in progress")
+
+// Status is where a job is in its life
+type Status string
+
+const (
+	Pending Status = "pending"
+	Running Status = "running"
+	// Done means the request finished, whatever its response status
+	Done Status = "done"
+	// Failed means the request panicked and has no response
+	Failed Status = "failed"
+)
+
+// Job is a request running in the background
+type Job struct {
+	ID         string     `json:"id"`
+	Status     Status     `json:"status"`
+	CreatedAt  time.Time  `json:"createdAt"`
+	FinishedAt *time.Time `json:"finishedAt,omitempty"`
+	// ResponseStatus and Response are the HTTP status and JSON body the
+	// request produced, once it is done
+	ResponseStatus int             `json:"responseStatus,omitempty"`
+	Response       json.RawMessage `json:"response,omitempty"`
+	Error          string          `json:"error,omitempty"`
+}
+
+func (j *Job) finished() bool {
+	return j.Status == Done || j.Status == Failed
+}
+
+// Store runs jobs and keeps their results until they expire. It is safe
+// for concurrent use.
+type Store struct {
+	mu      sync.Mutex
+	jobs    map[string]*Job
+	order   []string
+	ttl     time.Duration
+	maxJobs int
+	storage storage.Store
+}
+
+// New creates a store; zero values pick DefaultTTL and DefaultMaxJobs
+func New(ttl time.Duration, maxJobs int) *Store {
+	if ttl <= 0 {
+		ttl = DefaultTTL
+	}
+	if maxJobs <= 0 {
+		maxJobs = DefaultMaxJobs
+	}
+	return &Store{jobs: map[string]*Job{}, ttl: ttl, maxJobs: maxJobs}
+}
+
+// Persist keeps jobs in store as well as in memory, when they start and
+// when they finish, so a job can be polled on any instance sharing store
+// and its result outlives this one
+func (s *Store) Persist(store storage.Store) {
+	s.storage = store
+}
+
+// Start runs run in the background as a new job. run returns the status
+// and body of the response; a panic fails the job.
+func (s *Store) Start(run func() (int, []byte)) (Job, error) {
+	id, err := newID()
+	if err != nil {
+		return Job{}, err
+	}
+	s.mu.Lock()
+	s.evict(time.Now())
+	if len(s.jobs) >= s.maxJobs {
+		s.mu.Unlock()
+		return Job{}, ErrFull
+	}
+	job := &Job{ID: id, Status: Pending, CreatedAt: time.Now()}
+	s.jobs[id] = job
+	s.order = append(s.order, id)
+	snapshot := *job
+	s.mu.Unlock()
+	s.persist(snapshot)
+
+	go func() {
+		s.update(id, func(j *Job) { j.Status = Running })
+		defer func() {
+			if p := recover(); p != nil {
+				s.finish(id, func(j *Job) { j.Status, j.Error = Failed, fmt.Sprint(p) })
+			}
+		}()
+		status, body := run()
+		s.finish(id, func(j *Job) {
+			j.Status, j.ResponseStatus = Done, status
+			if json.Valid(body) {
+				j.Response = body
+			} else {
+				j.Response, _ = json.Marshal(string(body))
+			}
+		})
+	}()
+	return snapshot, nil
+}
+
+// Get returns a copy of the job with id, if it hasn't expired, looking it
+// up in the store once it isn't in memory
+func (s *Store) Get(ctx context.Context, id string) (Job, bool) {
+	s.mu.Lock()
+	job, ok := s.jobs[id]
+	if ok {
+		defer s.mu.Unlock()
+		if job.finished() && time.Since(*job.FinishedAt) > s.ttl {
+			return Job{}, false
+		}
+		return *job, true
+	}
+	s.mu.Unlock()
+	if s.storage == nil {
+		return Job{}, false
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, storage.Timeout)
+	defer cancel()
+	value, found, err := s.storage.Get(ctx, storage.Jobs, id)
+	if err != nil {
+		log.Printf("jobs: %v", err)
+	}
+	var stored Job
+	if !found || json.Unmarshal(value, &stored) != nil {
+		return Job{}, false
+	}
+	return stored, true
+}
+
+// persist writes job to the store, to be kept as long as it would be in
+// memory once finished
+func (s *Store) persist(job Job) {
+	if s.storage == nil {
+		return
+	}
+	value, _ := json.Marshal(job)
+	ctx, cancel := context.WithTimeout(context.Background(), storage.Timeout)
+	defer cancel()
+	if err := s.storage.Put(ctx, storage.Jobs, job.ID, value, s.ttl); err != nil {
+		log.Printf("jobs: %v", err)
+	}
+}
+
+func (s *Store) update(id string, change func(*Job)) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if job, ok := s.jobs[id]; ok {
+		change(job)
+	}
+}
+
+func (s *Store) finish(id string, change func(*Job)) {
+	var finished Job
+	s.update(id, func(j *Job) {
+		now := time.Now()
+		change(j)
+		j.FinishedAt = &now
+		finished = *j
+	})
+	if finished.ID != "" {
+		s.persist(finished)
+	}
+}
+
+// evict drops expired jobs and, when full, the oldest finished ones.
+// Jobs still running are never dropped.
+func (s *Store) evict(now time.Time) {
+	kept := s.order[:0]
+	for _, id := range s.order {
+		job, ok := s.jobs[id]
+		switch {
+		case !ok:
+		case job.finished() && (now.Sub(*job.FinishedAt) > s.ttl || len(s.jobs) >= s.maxJobs):
+			delete(s.jobs, id)
+		default:
+			kept = append(kept, id)
+		}
+	}
+	s.order = kept
+}
+
+func newID() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
+
+// Accepted is the reply to a request that became a job
+type Accepted struct {
+	Success bool   `json:"success"`
+	JobID   string `json:"jobId"`
+	Status  Status `json:"status"`
+	JobURL  string `json:"jobUrl"`
+}
+
+// Middleware runs requests whose body is larger than threshold bytes as
+// jobs, answering 202 with a Location header and the job's URL, which
+// location builds from its id. Smaller requests go straight to next. A
+// job's request keeps the original's values but not its cancellation,
+// since the client has its answer before the job ends.
+func (s *Store) Middleware(next http.Handler, threshold int, location func(id string) string) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, err := io.ReadAll(r.Body)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, err)
+			return
+		}
+		r.Body = io.NopCloser(bytes.NewReader(body))
+		if len(body) <= threshold {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		detached := r.Clone(context.WithoutCancel(r.Context()))
+		detached.Body = io.NopCloser(bytes.NewReader(body))
+		job, err := s.Start(func() (int, []byte) {
+			rec := &recorder{header: http.Header{}, status: http.StatusOK}
+			next.ServeHTTP(rec, detached)
+			return rec.status, rec.body.Bytes()
+		})
+		if err != nil {
+			w.Header().Set("Retry-After", "5")
+			writeError(w, http.StatusServiceUnavailable, err)
+			return
+		}
+
+		url := location(job.ID)
+		w.Header().Set("Location", url)
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusAccepted)
+		json.NewEncoder(w).Encode(Accepted{Success: true, JobID: job.ID, Status: job.Status, JobURL: url})
+	})
+}
+
+// recorder keeps a response written after the client has gone
+type recorder struct {
+	header http.Header
+	status int
+	body   bytes.Buffer
+}
+
+func (r *recorder) Header() http.Header         { return r.header }
+func (r *recorder) WriteHeader(status int)      { r.status = status }
+func (r *recorder) Write(b []byte) (int, error) { return r.body.Write(b) }
+
+func writeError(w http.ResponseWriter, status int, err error) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(struct {
+		Success bool   `json:"success"`
+		Error   string `json:"error"`
+	}{false, err.Error()})
+}
@@ -0,0 +1,49 @@
+// Package kvcache connects to a key-value cache outside the process, so
+// cached results outlive a serverless instance and are shared between
+// instances: Upstash Redis or Vercel KV over their REST API, or any Redis
+// server by URL.
+package kvcache
+
+import (
+	"context"
+	"fmt"
+	"time"
+)
+
+// Store is an external cache of byte values. Implementations are safe for
+// concurrent use.
+type Store interface {
+	// Get returns the value stored under key; a missing or expired key
+	// is not an error
+	Get(ctx context.Context, key string) ([]byte, bool, error)
+	// Set stores value under key for ttl
+	Set(ctx context.Context, key string, value []byte, ttl time.Duration) error
+	// Name says which backend the store talks to, for logs
+	Name() string
+}
+
+// FromEnv picks a store from the environment, read with getenv:
+// KV_REST_API_URL and KV_REST_API_TOKEN for Vercel KV,
+// UPSTASH_REDIS_REST_URL and UPSTASH_REDIS_REST_TOKEN for Upstash, or
+// REDIS_URL (redis:// or rediss://) for a Redis server, in that order. It
+// returns nil when none is set, leaving the caller with its in-memory
+// cache.
+func FromEnv(getenv func(string) string) (Store, error) {
+	if url := getenv("KV_REST_API_URL"); url != "" {
+		return newREST("vercel-kv", url, getenv("KV_REST_API_TOKEN"))
+	}
+	if url := getenv("UPSTASH_REDIS_REST_URL"); url != "" {
+		return newREST("upstash", url, getenv("UPSTASH_REDIS_REST_TOKEN"))
+	}
+	if url := getenv("REDIS_URL"); url != "" {
+		return NewRedis(url)
+	}
+	return nil, nil
+}
+
+func newREST(name, url, token string) (Store, error) {
+	if token == "" {
+		return nil, fmt.Errorf("%s: a REST URL is set without its token", name)
+	}
+	return NewREST(name, url, token), nil
+}
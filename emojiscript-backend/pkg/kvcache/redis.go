@@ -0,0 +1,195 @@
+package kvcache
+
+import (
+	"bufio"
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// dialTimeout bounds connecting when the caller's context has no deadline
+const dialTimeout = 5 * time.Second
+
+// Redis talks to a Redis server over one connection, speaking just enough
+// of the protocol for GET and SET. The connection is opened on first use
+// and reopened after an error.
+type Redis struct {
+	addr     string
+	tls      bool
+	username string
+	password string
+	db       int
+
+	mu     sync.Mutex
+	conn   net.Conn
+	reader *bufio.Reader
+}
+
+// NewRedis creates a store for a redis:// or rediss:// (TLS) URL, e.g.
+// redis://:password@host:6379/0
+func NewRedis(rawURL string) (*Redis, error) {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return nil, fmt.Errorf("redis: %v", err)
+	}
+	if u.Scheme != "redis" && u.Scheme != "rediss" {
+		return nil, fmt.Errorf("redis: unsupported scheme %q", u.Scheme)
+	}
+	s := &Redis{addr: u.Host, tls: u.Scheme == "rediss"}
+	if u.Port() == "" {
+		s.addr = net.JoinHostPort(u.Hostname(), "6379")
+	}
+	if u.User != nil {
+		s.username = u.User.Username()
+		s.password, _ = u.User.Password()
+	}
+	if db := strings.Trim(u.Path, "/"); db != "" {
+		if s.db, err = strconv.Atoi(db); err != nil {
+			return nil, fmt.Errorf("redis: invalid database %q", db)
+		}
+	}
+	return s, nil
+}
+
+func (s *Redis) Name() string { return "redis" }
+
+func (s *Redis) Get(ctx context.Context, key string) ([]byte, bool, error) {
+	reply, err := s.do(ctx, "GET", key)
+	if err != nil || reply == nil {
+		return nil, false, err
+	}
+	value, ok := reply.([]byte)
+	if !ok {
+		return nil, false, fmt.Errorf("redis: unexpected reply to GET: %v", reply)
+	}
+	return value, true, nil
+}
+
+func (s *Redis) Set(ctx context.Context, key string, value []byte, ttl time.Duration) error {
+	_, err := s.do(ctx, "SET", key, string(value), "PX", strconv.FormatInt(ttl.Milliseconds(), 10))
+	return err
+}
+
+// do sends a command and reads its reply: nil, a string status, an int64
+// or the bytes of a bulk string. The connection is dropped after any
+// failure, since its replies may no longer line up with commands.
+func (s *Redis) do(ctx context.Context, args ...string) (interface{}, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.conn == nil {
+		if err := s.connect(ctx); err != nil {
+			return nil, err
+		}
+	}
+	reply, err := s.roundTrip(ctx, args)
+	var redisErr redisError
+	if err != nil && !errors.As(err, &redisErr) {
+		s.conn.Close()
+		s.conn = nil
+	}
+	return reply, err
+}
+
+func (s *Redis) connect(ctx context.Context) error {
+	dialer := &net.Dialer{Timeout: dialTimeout}
+	conn, err := dialer.DialContext(ctx, "tcp", s.addr)
+	if err != nil {
+		return fmt.Errorf("redis: %v", err)
+	}
+	if s.tls {
+		host, _, _ := net.SplitHostPort(s.addr)
+		tlsConn := tls.Client(conn, &tls.Config{ServerName: host})
+		if err := tlsConn.HandshakeContext(ctx); err != nil {
+			conn.Close()
+			return fmt.Errorf("redis: %v", err)
+		}
+		conn = tlsConn
+	}
+	s.conn, s.reader = conn, bufio.NewReader(conn)
+
+	var setup [][]string
+	if s.password != "" {
+		if s.username != "" {
+			setup = append(setup, []string{"AUTH", s.username, s.password})
+		} else {
+			setup = append(setup, []string{"AUTH", s.password})
+		}
+	}
+	if s.db != 0 {
+		setup = append(setup, []string{"SELECT", strconv.Itoa(s.db)})
+	}
+	for _, args := range setup {
+		if _, err := s.roundTrip(ctx, args); err != nil {
+			conn.Close()
+			s.conn = nil
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *Redis) roundTrip(ctx context.Context, args []string) (interface{}, error) {
+	deadline, ok := ctx.Deadline()
+	if !ok {
+		deadline = time.Now().Add(dialTimeout)
+	}
+	s.conn.SetDeadline(deadline)
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "*%d\r\n", len(args))
+	for _, arg := range args {
+		fmt.Fprintf(&b, "$%d\r\n%s\r\n", len(arg), arg)
+	}
+	if _, err := io.WriteString(s.conn, b.String()); err != nil {
+		return nil, fmt.Errorf("redis: %v", err)
+	}
+	return s.readReply()
+}
+
+// redisError is an error reply from the server; the connection stays
+// usable after one
+type redisError string
+
+func (e redisError) Error() string { return "redis: " + string(e) }
+
+func (s *Redis) readReply() (interface{}, error) {
+	line, err := s.reader.ReadString('\n')
+	if err != nil {
+		return nil, fmt.Errorf("redis: %v", err)
+	}
+	line = strings.TrimSuffix(line, "\r\n")
+	if line == "" {
+		return nil, errors.New("redis: empty reply")
+	}
+	switch line[0] {
+	case '+':
+		return line[1:], nil
+	case '-':
+		return nil, redisError(line[1:])
+	case ':':
+		return strconv.ParseInt(line[1:], 10, 64)
+	case '$':
+		n, err := strconv.Atoi(line[1:])
+		if err != nil {
+			return nil, fmt.Errorf("redis: bad reply %q", line)
+		}
+		if n < 0 {
+			return nil, nil
+		}
+		value := make([]byte, n+2)
+		if _, err := io.ReadFull(s.reader, value); err != nil {
+			return nil, fmt.Errorf("redis: %v", err)
+		}
+		return value[:n], nil
+	}
+	return nil, fmt.Errorf("redis: unsupported reply %q", line)
+}
@@ -0,0 +1,84 @@
+package kvcache
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// REST talks to Upstash Redis or Vercel KV, which share Upstash's REST
+// API: a Redis command is POSTed as a JSON array and answered with its
+// result
+type REST struct {
+	name   string
+	url    string
+	token  string
+	client *http.Client
+}
+
+// NewREST creates a store for the REST endpoint url, authenticated with
+// token; name labels it in logs
+func NewREST(name, url, token string) *REST {
+	return &REST{name: name, url: strings.TrimRight(url, "/"), token: token, client: &http.Client{}}
+}
+
+func (s *REST) Name() string { return s.name }
+
+func (s *REST) Get(ctx context.Context, key string) ([]byte, bool, error) {
+	var value *string
+	if err := s.do(ctx, &value, "GET", key); err != nil {
+		return nil, false, err
+	}
+	if value == nil {
+		return nil, false, nil
+	}
+	return []byte(*value), true, nil
+}
+
+func (s *REST) Set(ctx context.Context, key string, value []byte, ttl time.Duration) error {
+	return s.do(ctx, nil, "SET", key, string(value), "PX", strconv.FormatInt(ttl.Milliseconds(), 10))
+}
+
+// do runs a command, decoding its result into result when it isn't nil
+func (s *REST) do(ctx context.Context, result interface{}, command ...string) error {
+	body, err := json.Marshal(command)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, s.url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Authorization", "Bearer "+s.token)
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	var reply struct {
+		Result json.RawMessage `json:"result"`
+		Error  string          `json:"error"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&reply); err != nil {
+		return fmt.Errorf("%s: %s: %v", s.name, resp.Status, err)
+	}
+	if reply.Error != "" {
+		return errors.New(s.name + ": " + reply.Error)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("%s: %s", s.name, resp.Status)
+	}
+	if result == nil {
+		return nil
+	}
+	return json.Unmarshal(reply.Result, result)
+}
@@ -0,0 +1,181 @@
+// Package leaderboard ranks scored challenge submissions, keeping each
+// challenge's board in memory and, optionally, in a JSON file.
+package leaderboard
+
+import (
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// MaxEntries caps each challenge's board; the lowest ranked entry
+	// drops off first
+	MaxEntries    = 100
+	MaxNameLength = 24
+)
+
+var namePattern = regexp.MustCompile(`^[\p{L}\p{N}][\p{L}\p{N} _.-]*$`)
+
+// ErrCopied rejects a program that's already on the board under another
+// name
+var ErrCopied = errors.New("this program is already on the leaderboard under another name")
+
+// Entry is one player's best submission to a challenge
+type Entry struct {
+	Name   string `json:"name"`
+	Passed int    `json:"passed"`
+	Total  int    `json:"total"`
+	// EmojiDensity is the recognized emoji per 100 characters of the
+	// program, not counting whitespace
+	EmojiDensity float64 `json:"emojiDensity"`
+	// Size is the program's length in characters, not counting whitespace
+	Size        int       `json:"size"`
+	SubmittedAt time.Time `json:"submittedAt"`
+	// CodeHash identifies the program, so a copy can't be ranked again
+	// under another name
+	CodeHash string `json:"codeHash"`
+}
+
+// Less reports whether a ranks above b: more tests passed, then the denser
+// emoji, then the smaller program, then the earlier submission
+func Less(a, b Entry) bool {
+	switch {
+	case a.Passed != b.Passed:
+		return a.Passed > b.Passed
+	case a.EmojiDensity != b.EmojiDensity:
+		return a.EmojiDensity > b.EmojiDensity
+	case a.Size != b.Size:
+		return a.Size < b.Size
+	}
+	return a.SubmittedAt.Before(b.SubmittedAt)
+}
+
+// ValidName reports whether name may appear on a board: up to
+// MaxNameLength letters, digits, spaces and _ . -, starting with a letter
+// or digit
+func ValidName(name string) bool {
+	return len([]rune(name)) <= MaxNameLength && namePattern.MatchString(name) && strings.TrimSpace(name) == name
+}
+
+// Store holds the boards, keyed by challenge id
+type Store struct {
+	mu     sync.Mutex
+	path   string
+	boards map[string][]Entry
+}
+
+// NewStore opens a store backed by path, loading any boards already saved
+// there. An empty path keeps boards in memory only.
+func NewStore(path string) (*Store, error) {
+	s := &Store{path: path, boards: make(map[string][]Entry)}
+	if path == "" {
+		return s, nil
+	}
+
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return s, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(data, &s.boards); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// Submit puts entry on challenge's board unless its name already has an
+// entry ranking at least as high; names match ignoring case. It returns
+// the rank of the name's best entry, from 1, or 0 when it didn't make the
+// board, and whether entry improved on it.
+func (s *Store) Submit(challenge string, entry Entry) (int, bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	previous := s.boards[challenge]
+	board := make([]Entry, 0, len(previous)+1)
+	improved := true
+	for _, existing := range previous {
+		if !strings.EqualFold(existing.Name, entry.Name) {
+			if existing.CodeHash == entry.CodeHash {
+				return 0, false, ErrCopied
+			}
+			board = append(board, existing)
+			continue
+		}
+		if !Less(entry, existing) {
+			improved = false
+			board = append(board, existing)
+		}
+	}
+	if !improved {
+		return rank(board, entry.Name), false, nil
+	}
+
+	board = append(board, entry)
+	sort.SliceStable(board, func(i, j int) bool { return Less(board[i], board[j]) })
+	if len(board) > MaxEntries {
+		board = board[:MaxEntries]
+	}
+	s.boards[challenge] = board
+	if err := s.saveLocked(); err != nil {
+		s.boards[challenge] = previous
+		return 0, false, err
+	}
+	position := rank(board, entry.Name)
+	return position, position > 0, nil
+}
+
+// Top returns the first limit entries of challenge's board, or all of
+// them when limit isn't positive
+func (s *Store) Top(challenge string, limit int) []Entry {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	board := s.boards[challenge]
+	if limit > 0 && limit < len(board) {
+		board = board[:limit]
+	}
+	return append([]Entry{}, board...)
+}
+
+// rank is name's position on board, from 1, or 0 when it isn't there
+func rank(board []Entry, name string) int {
+	for i, entry := range board {
+		if strings.EqualFold(entry.Name, name) {
+			return i + 1
+		}
+	}
+	return 0
+}
+
+// saveLocked writes the boards atomically via a temp file and rename
+func (s *Store) saveLocked() error {
+	if s.path == "" {
+		return nil
+	}
+	data, err := json.MarshalIndent(s.boards, "", "  ")
+	if err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(s.path), ".leaderboard-*.json")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), s.path)
+}
@@ -0,0 +1,410 @@
+// Package live runs the playground's live-transpile sessions. A client
+// streams its document over a WebSocket, as full text or as edits, and
+// gets the transpile result and diagnostics back once it stops typing, so
+// the editor doesn't send a POST, and spend a request of its rate limit,
+// on every keystroke. A client may open with a hello, to agree on a
+// protocol version and learn the server's limits; one that doesn't speaks
+// version 1, the protocol from before the handshake.
+package live
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf16"
+
+	"emojiscript-backend/pkg/service"
+	"emojiscript-backend/pkg/websocket"
+	"emojiscript-backend/pkg/workpool"
+)
+
+const (
+	// DefaultDebounce is how long a document must go unchanged before it
+	// is transpiled
+	DefaultDebounce    = 150 * time.Millisecond
+	DefaultIdleTimeout = 5 * time.Minute
+	DefaultMaxSessions = 256
+
+	// ProtocolVersion is the newest version of the protocol the server
+	// speaks. Version 2 added the hello handshake and the debounce a
+	// client asks for in it.
+	ProtocolVersion = 2
+
+	// MinDebounce and MaxDebounce bound the debounce a client may ask for
+	MinDebounce = 50 * time.Millisecond
+	MaxDebounce = 2 * time.Second
+)
+
+// clientMessageTypes and serverMessageTypes are the message types each
+// side sends, with the protocol version that introduced them. A client
+// may only send the types of the version its session speaks.
+var (
+	clientMessageTypes = map[string]int{"document": 1, "edit": 1, "options": 1, "hello": 2}
+	serverMessageTypes = map[string]int{"result": 1, "resync": 1, "error": 1, "capabilities": 2}
+)
+
+// messageTypes lists the types of a table that a version has, sorted
+func messageTypes(table map[string]int, protocol int) []string {
+	var types []string
+	for name, since := range table {
+		if since <= protocol {
+			types = append(types, name)
+		}
+	}
+	slices.Sort(types)
+	return types
+}
+
+// Options configures New; zero values fall back to the defaults
+type Options struct {
+	Debounce time.Duration
+	// IdleTimeout closes a session the client has sent nothing on for
+	// this long
+	IdleTimeout time.Duration
+	// MaxSessions bounds the sessions open at once
+	MaxSessions int
+	// Pool bounds transpile work across sessions and requests; live
+	// transpiles aren't bounded when nil
+	Pool *workpool.Pool
+}
+
+// Server runs sessions against one Service. It is safe for concurrent use.
+type Server struct {
+	svc      *service.Service
+	opts     Options
+	mu       sync.Mutex
+	sessions int
+}
+
+// New creates a Server transpiling with svc
+func New(svc *service.Service, opts Options) *Server {
+	if opts.Debounce <= 0 {
+		opts.Debounce = DefaultDebounce
+	}
+	if opts.IdleTimeout <= 0 {
+		opts.IdleTimeout = DefaultIdleTimeout
+	}
+	if opts.MaxSessions <= 0 {
+		opts.MaxSessions = DefaultMaxSessions
+	}
+	return &Server{svc: svc, opts: opts}
+}
+
+// Edit replaces Length UTF-16 code units at Offset with Text, as in a
+// Monaco content change; offsets count UTF-16 units because that is how
+// JavaScript indexes strings
+type Edit struct {
+	Offset int    `json:"offset"`
+	Length int    `json:"length"`
+	Text   string `json:"text"`
+}
+
+// ClientMessage is a message from the client:
+//
+//   - "document" replaces the whole document with Code
+//   - "edit" applies Edits, in order, to the document
+//   - "options" changes how the document is transpiled
+//   - "hello" asks for the session to speak Protocol, or the server's
+//     newest version if that's older, and is answered with Capabilities
+//
+// Version numbers the document the message leaves; an edit must follow
+// the version before it, or the client is asked to resync. Options is a
+// transpile request whose code, sourceUrl and privacy are ignored, and
+// may come with a document too.
+type ClientMessage struct {
+	Type    string                    `json:"type"`
+	Version int                       `json:"version"`
+	Code    string                    `json:"code,omitempty"`
+	Edits   []Edit                    `json:"edits,omitempty"`
+	Options *service.TranspileRequest `json:"options,omitempty"`
+	// Protocol is the newest version a hello's client speaks
+	Protocol int `json:"protocol,omitempty"`
+	// DebounceMs asks for the document to be transpiled after this long
+	// unchanged, instead of the server's debounce, within MinDebounce and
+	// MaxDebounce
+	DebounceMs int `json:"debounceMs,omitempty"`
+}
+
+// Capabilities answers a hello with what the session speaks and the
+// limits it works within
+type Capabilities struct {
+	Type string `json:"type"`
+	// Protocol is the version the session speaks from now on, and
+	// ServerProtocol the newest one the server speaks
+	Protocol       int `json:"protocol"`
+	ServerProtocol int `json:"serverProtocol"`
+	// MessageTypes are the types the client may send in the session, and
+	// ServerMessageTypes the ones it may receive
+	MessageTypes       []string `json:"messageTypes"`
+	ServerMessageTypes []string `json:"serverMessageTypes"`
+	// MaxPayload is the largest message the server reads, in bytes
+	MaxPayload        int `json:"maxPayload"`
+	MaxCodeLength     int `json:"maxCodeLength"`
+	MaxCodeCharacters int `json:"maxCodeCharacters"`
+	// DebounceMs is how long the document must go unchanged before it is
+	// transpiled, so a client can hold back edits for that long without
+	// delaying a result; MinDebounceMs and MaxDebounceMs bound what a
+	// hello may ask for
+	DebounceMs    int `json:"debounceMs"`
+	MinDebounceMs int `json:"minDebounceMs"`
+	MaxDebounceMs int `json:"maxDebounceMs"`
+	// IdleTimeoutSeconds is how long the session may go without a message
+	// before it's closed
+	IdleTimeoutSeconds int `json:"idleTimeoutSeconds"`
+}
+
+// Result is the transpile response for a version of the document
+type Result struct {
+	Type    string `json:"type"`
+	Version int    `json:"version"`
+	service.TranspileResponse
+}
+
+// Problem reports a message the server couldn't use. Type "resync" asks
+// for the whole document again, at Version or later; "error" reports
+// anything else.
+type Problem struct {
+	Type    string `json:"type"`
+	Error   string `json:"error"`
+	Version int    `json:"version,omitempty"`
+}
+
+// ServeConn runs a session on conn until the client leaves or goes idle,
+// and then closes conn
+func (s *Server) ServeConn(conn *websocket.Conn) {
+	defer conn.Close()
+	if !s.open() {
+		writeJSON(conn, Problem{Type: "error", Error: "too many live sessions; try again later"})
+		return
+	}
+	defer s.close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	sess := &session{server: s, conn: conn, ctx: ctx, protocol: 1, debounce: s.opts.Debounce}
+	defer sess.stop(cancel)
+
+	for {
+		conn.SetReadDeadline(time.Now().Add(s.opts.IdleTimeout))
+		raw, err := conn.ReadMessage()
+		if err != nil {
+			return
+		}
+		var message ClientMessage
+		if err := json.Unmarshal([]byte(raw), &message); err != nil {
+			writeJSON(conn, Problem{Type: "error", Error: "invalid message: " + err.Error()})
+			continue
+		}
+		if message.Type == "hello" {
+			if capabilities, problem := sess.hello(message); problem != nil {
+				writeJSON(conn, problem)
+			} else {
+				writeJSON(conn, capabilities)
+			}
+			continue
+		}
+		if problem := sess.receive(message); problem != nil {
+			writeJSON(conn, problem)
+		}
+	}
+}
+
+func (s *Server) open() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.sessions >= s.opts.MaxSessions {
+		return false
+	}
+	s.sessions++
+	return true
+}
+
+func (s *Server) close() {
+	s.mu.Lock()
+	s.sessions--
+	s.mu.Unlock()
+}
+
+// session is one client's document. Edits are applied as they arrive; a
+// timer transpiles the document once it has been quiet for the debounce,
+// and flushes run one at a time.
+type session struct {
+	server *Server
+	conn   *websocket.Conn
+	ctx    context.Context
+
+	mu      sync.Mutex
+	doc     []uint16
+	version int
+	// protocol is the version the session speaks, and debounce how long
+	// the document must go unchanged before it is transpiled
+	protocol int
+	debounce time.Duration
+	request  service.TranspileRequest
+	timer    *time.Timer
+	// changed is set until the document's latest state has been flushed
+	changed bool
+
+	flushing sync.Mutex
+}
+
+// hello agrees on the version the session speaks, the lower of the
+// client's and the server's, and on its debounce
+func (sess *session) hello(message ClientMessage) (*Capabilities, *Problem) {
+	if message.Protocol < 1 {
+		return nil, &Problem{Type: "error", Error: "hello without a protocol version"}
+	}
+	debounce := sess.server.opts.Debounce
+	if message.DebounceMs != 0 {
+		debounce = time.Duration(message.DebounceMs) * time.Millisecond
+		if debounce < MinDebounce || debounce > MaxDebounce {
+			return nil, &Problem{Type: "error", Error: fmt.Sprintf("debounceMs must be between %d and %d", MinDebounce.Milliseconds(), MaxDebounce.Milliseconds())}
+		}
+	}
+
+	sess.mu.Lock()
+	sess.protocol = min(message.Protocol, ProtocolVersion)
+	sess.debounce = debounce
+	protocol := sess.protocol
+	sess.mu.Unlock()
+
+	svc := sess.server.svc
+	return &Capabilities{
+		Type:               "capabilities",
+		Protocol:           protocol,
+		ServerProtocol:     ProtocolVersion,
+		MessageTypes:       messageTypes(clientMessageTypes, protocol),
+		ServerMessageTypes: messageTypes(serverMessageTypes, protocol),
+		MaxPayload:         websocket.MaxMessageSize,
+		MaxCodeLength:      svc.MaxCodeLength(),
+		MaxCodeCharacters:  svc.MaxCodeCharacters(),
+		DebounceMs:         int(debounce.Milliseconds()),
+		MinDebounceMs:      int(MinDebounce.Milliseconds()),
+		MaxDebounceMs:      int(MaxDebounce.Milliseconds()),
+		IdleTimeoutSeconds: int(sess.server.opts.IdleTimeout.Seconds()),
+	}, nil
+}
+
+// receive applies a message, returning the problem to report when it
+// can't be
+func (sess *session) receive(message ClientMessage) *Problem {
+	sess.mu.Lock()
+	defer sess.mu.Unlock()
+
+	if since, known := clientMessageTypes[message.Type]; known && since > sess.protocol {
+		return &Problem{Type: "error", Error: fmt.Sprintf("message type '%s' needs protocol version %d; send a hello first", message.Type, since)}
+	}
+
+	if message.Options != nil {
+		sess.request = *message.Options
+		sess.changed = true
+	}
+	switch message.Type {
+	case "document":
+		doc := utf16.Encode([]rune(message.Code))
+		if err := sess.server.svc.CheckLength(message.Code); err != nil {
+			return &Problem{Type: "error", Error: err.Error()}
+		}
+		sess.doc, sess.version, sess.changed = doc, message.Version, true
+	case "edit":
+		if message.Version != sess.version+1 {
+			return &Problem{Type: "resync", Error: "edit doesn't follow the server's version", Version: sess.version}
+		}
+		doc := slices.Clone(sess.doc)
+		for _, edit := range message.Edits {
+			if edit.Offset < 0 || edit.Length < 0 || edit.Offset+edit.Length > len(doc) {
+				return &Problem{Type: "resync", Error: "edit is outside the document", Version: sess.version}
+			}
+			doc = slices.Replace(doc, edit.Offset, edit.Offset+edit.Length, utf16.Encode([]rune(edit.Text))...)
+		}
+		if err := sess.server.svc.CheckLength(string(utf16.Decode(doc))); err != nil {
+			return &Problem{Type: "resync", Error: err.Error(), Version: sess.version}
+		}
+		sess.doc, sess.version, sess.changed = doc, message.Version, true
+	case "options":
+		if message.Options == nil {
+			return &Problem{Type: "error", Error: "options message without options"}
+		}
+	default:
+		return &Problem{Type: "error", Error: "unknown message type '" + message.Type + "'"}
+	}
+	sess.schedule(sess.debounce)
+	return nil
+}
+
+// schedule (re)starts the debounce timer; the caller holds mu
+func (sess *session) schedule(after time.Duration) {
+	if sess.timer == nil {
+		sess.timer = time.AfterFunc(after, sess.flush)
+		return
+	}
+	sess.timer.Reset(after)
+}
+
+// flush transpiles the document and sends the result, unless the
+// document changed again meanwhile and a newer flush is due
+func (sess *session) flush() {
+	sess.flushing.Lock()
+	defer sess.flushing.Unlock()
+
+	sess.mu.Lock()
+	if !sess.changed {
+		sess.mu.Unlock()
+		return
+	}
+	req, version := sess.request, sess.version
+	req.Code, req.SourceURL = string(utf16.Decode(sess.doc)), ""
+	// a draft per pause in typing would only push useful entries out of
+	// the cache and fill the history
+	req.Privacy = service.PrivacyStrict
+	sess.changed = false
+	sess.mu.Unlock()
+
+	if pool := sess.server.opts.Pool; pool != nil {
+		release, err := pool.Acquire(sess.ctx)
+		var rejection *workpool.Rejection
+		switch {
+		case errors.As(err, &rejection):
+			sess.mu.Lock()
+			sess.changed = true
+			sess.schedule(time.Duration(rejection.Seconds()) * time.Second)
+			sess.mu.Unlock()
+			return
+		case err != nil:
+			return
+		}
+		defer release()
+	}
+
+	resp, _ := sess.server.svc.Transpile(req, service.Caller{})
+
+	sess.mu.Lock()
+	stale := sess.version != version || sess.changed
+	sess.mu.Unlock()
+	if stale || sess.ctx.Err() != nil {
+		return
+	}
+	writeJSON(sess.conn, Result{Type: "result", Version: version, TranspileResponse: resp})
+}
+
+// stop cancels a pending flush once the client has gone
+func (sess *session) stop(cancel context.CancelFunc) {
+	cancel()
+	sess.mu.Lock()
+	if sess.timer != nil {
+		sess.timer.Stop()
+	}
+	sess.mu.Unlock()
+}
+
+func writeJSON(conn *websocket.Conn, v interface{}) {
+	b := &strings.Builder{}
+	enc := json.NewEncoder(b)
+	enc.SetEscapeHTML(false)
+	enc.Encode(v)
+	conn.WriteText(b.String())
+}
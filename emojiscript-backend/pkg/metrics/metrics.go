@@ -0,0 +1,328 @@
+// Package metrics counts how long requests take, what is transpiled and
+// which parse errors programs hit, for a server's /metrics route.
+package metrics
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"emojiscript-backend/pkg/requestid"
+)
+
+// DurationBuckets are the upper bounds, in seconds, of the request
+// duration histogram
+var DurationBuckets = []float64{0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10}
+
+// OtherError is the code a failed transpile is counted under when none of
+// its diagnostics has one
+const OtherError = "other"
+
+type requestKey struct {
+	method, route string
+	status        int
+}
+
+type histogram struct {
+	buckets []int64
+	count   int64
+	sum     float64
+}
+
+type transpileKey struct {
+	target, syntax, result string
+}
+
+type pipelineKey struct {
+	pipeline string
+	fallback bool
+}
+
+// Registry is safe for concurrent use
+type Registry struct {
+	mu          sync.Mutex
+	requests    map[requestKey]*histogram
+	transpiles  map[transpileKey]int64
+	parseErrors map[string]int64
+	pipelines   map[pipelineKey]int64
+}
+
+// New creates an empty registry
+func New() *Registry {
+	return &Registry{
+		requests:    map[requestKey]*histogram{},
+		transpiles:  map[transpileKey]int64{},
+		parseErrors: map[string]int64{},
+		pipelines:   map[pipelineKey]int64{},
+	}
+}
+
+// ObserveRequest records a request to route, the pattern it matched
+// rather than its path, so IDs in paths don't each get a series
+func (r *Registry) ObserveRequest(method, route string, status int, took time.Duration) {
+	seconds := took.Seconds()
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	key := requestKey{method: method, route: route, status: status}
+	h, ok := r.requests[key]
+	if !ok {
+		h = &histogram{buckets: make([]int64, len(DurationBuckets))}
+		r.requests[key] = h
+	}
+	h.count++
+	h.sum += seconds
+	for i, bound := range DurationBuckets {
+		if seconds <= bound {
+			h.buckets[i]++
+		}
+	}
+}
+
+// ObserveTranspile records one program transpiled for target in syntax
+// ("emoji" or "markup"). A failed transpile counts each of errorCodes, the
+// codes of its error diagnostics, as a parse error.
+func (r *Registry) ObserveTranspile(target, syntax string, success bool, errorCodes []string) {
+	result := "success"
+	if !success {
+		result = "error"
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.transpiles[transpileKey{target: target, syntax: syntax, result: result}]++
+	if success {
+		return
+	}
+	if len(errorCodes) == 0 {
+		errorCodes = []string{OtherError}
+	}
+	for _, code := range errorCodes {
+		r.parseErrors[code]++
+	}
+}
+
+// ObservePipeline records one plain emoji program compiled by pipeline
+// (see package canary); fallback is set when the tree pipeline failed and
+// the replacer compiled it instead
+func (r *Registry) ObservePipeline(pipeline string, fallback bool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.pipelines[pipelineKey{pipeline: pipeline, fallback: fallback}]++
+}
+
+// RouteStats is one route's requests answered with one status
+type RouteStats struct {
+	Method        string  `json:"method"`
+	Route         string  `json:"route"`
+	Status        int     `json:"status"`
+	Count         int64   `json:"count"`
+	AverageMillis float64 `json:"averageMillis"`
+}
+
+// TranspileCount is how many programs were transpiled for a target in a
+// syntax with a result
+type TranspileCount struct {
+	Target string `json:"target"`
+	Syntax string `json:"syntax"`
+	Result string `json:"result"`
+	Count  int64  `json:"count"`
+}
+
+// PipelineCount is how many plain emoji programs a pipeline compiled,
+// as a fallback or not
+type PipelineCount struct {
+	Pipeline string `json:"pipeline"`
+	Fallback bool   `json:"fallback"`
+	Count    int64  `json:"count"`
+}
+
+// Summary is a snapshot of the registry for JSON metrics
+type Summary struct {
+	Requests    []RouteStats     `json:"requests"`
+	Transpiles  []TranspileCount `json:"transpiles"`
+	ParseErrors map[string]int64 `json:"parseErrors"`
+	Pipelines   []PipelineCount  `json:"pipelines"`
+}
+
+// Summary reports the counts so far
+func (r *Registry) Summary() Summary {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	summary := Summary{
+		Requests:    []RouteStats{},
+		Transpiles:  []TranspileCount{},
+		ParseErrors: make(map[string]int64, len(r.parseErrors)),
+		Pipelines:   []PipelineCount{},
+	}
+	for _, key := range r.sortedRequests() {
+		h := r.requests[key]
+		summary.Requests = append(summary.Requests, RouteStats{
+			Method:        key.method,
+			Route:         key.route,
+			Status:        key.status,
+			Count:         h.count,
+			AverageMillis: h.sum / float64(h.count) * 1000,
+		})
+	}
+	for _, key := range r.sortedTranspiles() {
+		summary.Transpiles = append(summary.Transpiles, TranspileCount{Target: key.target, Syntax: key.syntax, Result: key.result, Count: r.transpiles[key]})
+	}
+	for code, count := range r.parseErrors {
+		summary.ParseErrors[code] = count
+	}
+	for _, key := range r.sortedPipelines() {
+		summary.Pipelines = append(summary.Pipelines, PipelineCount{Pipeline: key.pipeline, Fallback: key.fallback, Count: r.pipelines[key]})
+	}
+	return summary
+}
+
+// WritePrometheus writes the registry in the Prometheus text exposition
+// format
+func (r *Registry) WritePrometheus(w io.Writer) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	fmt.Fprintln(w, "# HELP emojiscript_http_request_duration_seconds Time taken to answer requests, by route and status.")
+	fmt.Fprintln(w, "# TYPE emojiscript_http_request_duration_seconds histogram")
+	for _, key := range r.sortedRequests() {
+		h := r.requests[key]
+		labels := fmt.Sprintf("method=\"%s\",route=\"%s\",status=\"%d\"", escapeLabel(key.method), escapeLabel(key.route), key.status)
+		for i, bound := range DurationBuckets {
+			fmt.Fprintf(w, "emojiscript_http_request_duration_seconds_bucket{%s,le=\"%g\"} %d\n", labels, bound, h.buckets[i])
+		}
+		fmt.Fprintf(w, "emojiscript_http_request_duration_seconds_bucket{%s,le=\"+Inf\"} %d\n", labels, h.count)
+		fmt.Fprintf(w, "emojiscript_http_request_duration_seconds_sum{%s} %g\n", labels, h.sum)
+		fmt.Fprintf(w, "emojiscript_http_request_duration_seconds_count{%s} %d\n", labels, h.count)
+	}
+
+	fmt.Fprintln(w, "# HELP emojiscript_transpiles_total Programs transpiled, by target language, syntax and result.")
+	fmt.Fprintln(w, "# TYPE emojiscript_transpiles_total counter")
+	for _, key := range r.sortedTranspiles() {
+		fmt.Fprintf(w, "emojiscript_transpiles_total{target=\"%s\",syntax=\"%s\",result=\"%s\"} %d\n", escapeLabel(key.target), escapeLabel(key.syntax), key.result, r.transpiles[key])
+	}
+
+	fmt.Fprintln(w, "# HELP emojiscript_parse_errors_total Errors failed transpiles reported, by diagnostic code.")
+	fmt.Fprintln(w, "# TYPE emojiscript_parse_errors_total counter")
+	codes := make([]string, 0, len(r.parseErrors))
+	for code := range r.parseErrors {
+		codes = append(codes, code)
+	}
+	sort.Strings(codes)
+	for _, code := range codes {
+		fmt.Fprintf(w, "emojiscript_parse_errors_total{code=\"%s\"} %d\n", escapeLabel(code), r.parseErrors[code])
+	}
+
+	fmt.Fprintln(w, "# HELP emojiscript_pipeline_compiles_total Plain emoji programs compiled, by pipeline and whether it was a fallback.")
+	fmt.Fprintln(w, "# TYPE emojiscript_pipeline_compiles_total counter")
+	for _, key := range r.sortedPipelines() {
+		fmt.Fprintf(w, "emojiscript_pipeline_compiles_total{pipeline=\"%s\",fallback=\"%t\"} %d\n", escapeLabel(key.pipeline), key.fallback, r.pipelines[key])
+	}
+}
+
+// sortedRequests orders the request series for stable output; the caller
+// holds mu
+func (r *Registry) sortedRequests() []requestKey {
+	keys := make([]requestKey, 0, len(r.requests))
+	for key := range r.requests {
+		keys = append(keys, key)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		a, b := keys[i], keys[j]
+		if a.route != b.route {
+			return a.route < b.route
+		}
+		if a.method != b.method {
+			return a.method < b.method
+		}
+		return a.status < b.status
+	})
+	return keys
+}
+
+// sortedTranspiles orders the transpile series for stable output; the
+// caller holds mu
+func (r *Registry) sortedTranspiles() []transpileKey {
+	keys := make([]transpileKey, 0, len(r.transpiles))
+	for key := range r.transpiles {
+		keys = append(keys, key)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		a, b := keys[i], keys[j]
+		if a.target != b.target {
+			return a.target < b.target
+		}
+		if a.syntax != b.syntax {
+			return a.syntax < b.syntax
+		}
+		return a.result < b.result
+	})
+	return keys
+}
+
+// sortedPipelines orders the pipeline series for stable output; the
+// caller holds mu
+func (r *Registry) sortedPipelines() []pipelineKey {
+	keys := make([]pipelineKey, 0, len(r.pipelines))
+	for key := range r.pipelines {
+		keys = append(keys, key)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		a, b := keys[i], keys[j]
+		if a.pipeline != b.pipeline {
+			return a.pipeline < b.pipeline
+		}
+		return !a.fallback && b.fallback
+	})
+	return keys
+}
+
+// escapeLabel escapes a label value for the exposition format
+func escapeLabel(value string) string {
+	return strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`).Replace(value)
+}
+
+// statusRecorder remembers the status a handler answered with
+type statusRecorder struct {
+	http.ResponseWriter
+	status int
+}
+
+func (s *statusRecorder) WriteHeader(status int) {
+	if s.status == 0 {
+		s.status = status
+	}
+	s.ResponseWriter.WriteHeader(status)
+}
+
+func (s *statusRecorder) Write(b []byte) (int, error) {
+	if s.status == 0 {
+		s.status = http.StatusOK
+	}
+	return s.ResponseWriter.Write(b)
+}
+
+// Unwrap lets http.ResponseController reach the underlying writer
+func (s *statusRecorder) Unwrap() http.ResponseWriter {
+	return s.ResponseWriter
+}
+
+// Middleware times requests to route and logs the ones answered with a
+// server error, with their request ID (see requestid.Middleware)
+func (r *Registry) Middleware(next http.Handler, method, route string) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		start := time.Now()
+		recorder := &statusRecorder{ResponseWriter: w}
+		next.ServeHTTP(recorder, req)
+		if recorder.status == 0 {
+			recorder.status = http.StatusOK
+		}
+		took := time.Since(start)
+		r.ObserveRequest(method, route, recorder.status, took)
+		if recorder.status >= http.StatusInternalServerError {
+			requestid.Printf(req.Context(), "%s %s: %d %s after %s", method, req.URL.Path, recorder.status, http.StatusText(recorder.status), took.Round(time.Millisecond))
+		}
+	})
+}
@@ -0,0 +1,303 @@
+// Package notebook keeps EmojiScript notebooks: documents of code and
+// markdown cells, in the manner of Jupyter's .ipynb, whose code cells run
+// one at a time in a sandbox session of the notebook's own, so a cell
+// sees what the cells run before it declared.
+package notebook
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"emojiscript-backend/pkg/sandbox"
+)
+
+const (
+	// DefaultTTL is how long a notebook is kept after it was last used
+	DefaultTTL          = 30 * time.Minute
+	DefaultMaxNotebooks = 200
+	MaxCells            = 100
+	// MaxSessionMemory bounds what a notebook's variables may hold at
+	// once, in bytes, across all its cells' runs
+	MaxSessionMemory = 8 << 20
+)
+
+// Cell types and code cell syntaxes
+const (
+	Code     = "code"
+	Markdown = "markdown"
+	Emoji    = "emoji"
+	Markup   = "markup"
+)
+
+var (
+	// ErrFull refuses a new notebook while every slot holds one in use
+	ErrFull = errors.New("too many notebooks open, try again later")
+	// ErrNotFound is returned for a notebook that doesn't exist or has
+	// expired
+	ErrNotFound = errors.New("notebook not found or expired")
+	// ErrCellNotFound is returned for a cell id a notebook doesn't have
+	ErrCellNotFound = errors.New("cell not found")
+	// ErrNotCode is returned for running a markdown cell
+	ErrNotCode = errors.New("only code cells can be transpiled or run")
+)
+
+type Cell struct {
+	ID   string `json:"id"`
+	Type string `json:"type"`
+	// Syntax is emoji or markup, for a code cell; emoji when empty
+	Syntax string `json:"syntax,omitempty"`
+	Source string `json:"source"`
+	// ExecutionCount numbers the cell's last run among the notebook's
+	// runs since its session started; zero when it hasn't run since
+	ExecutionCount int     `json:"executionCount,omitempty"`
+	Output         *Output `json:"output,omitempty"`
+}
+
+// Output is what a code cell's last run printed and evaluated to
+type Output struct {
+	Stdout    []string            `json:"stdout"`
+	Values    []sandbox.LineValue `json:"values"`
+	Error     string              `json:"error,omitempty"`
+	ErrorLine int                 `json:"errorLine,omitempty"`
+}
+
+type Notebook struct {
+	ID        string    `json:"id"`
+	Cells     []Cell    `json:"cells"`
+	CreatedAt time.Time `json:"createdAt"`
+	// ExpiresAt is when the notebook is dropped unless it's used again
+	ExpiresAt time.Time `json:"expiresAt"`
+}
+
+type entry struct {
+	notebook Notebook
+	session  *sandbox.Session
+	runs     int
+	used     time.Time
+}
+
+// Store keeps notebooks in memory until they go unused for its TTL. It is
+// safe for concurrent use.
+type Store struct {
+	mu           sync.Mutex
+	notebooks    map[string]*entry
+	ttl          time.Duration
+	maxNotebooks int
+}
+
+// New creates a store; zero values pick DefaultTTL and
+// DefaultMaxNotebooks
+func New(ttl time.Duration, maxNotebooks int) *Store {
+	if ttl <= 0 {
+		ttl = DefaultTTL
+	}
+	if maxNotebooks <= 0 {
+		maxNotebooks = DefaultMaxNotebooks
+	}
+	return &Store{notebooks: map[string]*entry{}, ttl: ttl, maxNotebooks: maxNotebooks}
+}
+
+// Validate checks cells for a notebook, giving an id to each cell without
+// one and emoji syntax to each code cell without a syntax
+func Validate(cells []Cell) ([]Cell, error) {
+	if len(cells) > MaxCells {
+		return nil, fmt.Errorf("a notebook can have at most %d cells", MaxCells)
+	}
+	checked := make([]Cell, len(cells))
+	seen := map[string]bool{}
+	for i, cell := range cells {
+		if cell.ID == "" {
+			cell.ID = fmt.Sprintf("cell-%d", i+1)
+		}
+		if seen[cell.ID] {
+			return nil, fmt.Errorf("cell id %q is used more than once", cell.ID)
+		}
+		seen[cell.ID] = true
+		switch cell.Type {
+		case Code:
+			if cell.Syntax == "" {
+				cell.Syntax = Emoji
+			}
+			if cell.Syntax != Emoji && cell.Syntax != Markup {
+				return nil, fmt.Errorf("cell %q: syntax must be %s or %s", cell.ID, Emoji, Markup)
+			}
+		case Markdown:
+			cell.Syntax = ""
+		default:
+			return nil, fmt.Errorf("cell %q: type must be %s or %s", cell.ID, Code, Markdown)
+		}
+		cell.ExecutionCount, cell.Output = 0, nil
+		checked[i] = cell
+	}
+	return checked, nil
+}
+
+// Create opens a notebook of cells, which must have passed Validate, with
+// a fresh session
+func (s *Store) Create(cells []Cell) (Notebook, error) {
+	id, err := newID()
+	if err != nil {
+		return Notebook{}, err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	now := time.Now()
+	s.evict(now)
+	if len(s.notebooks) >= s.maxNotebooks {
+		return Notebook{}, ErrFull
+	}
+	e := &entry{notebook: Notebook{ID: id, Cells: cells, CreatedAt: now.UTC()}, session: sandbox.NewSession(), used: now}
+	s.notebooks[id] = e
+	return s.snapshot(e), nil
+}
+
+// Get returns a copy of the notebook with id
+func (s *Store) Get(id string) (Notebook, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	e, err := s.lookup(id)
+	if err != nil {
+		return Notebook{}, err
+	}
+	return s.snapshot(e), nil
+}
+
+// Replace swaps a notebook's cells for cells, which must have passed
+// Validate, keeping its session and the output of each cell whose id and
+// source are unchanged
+func (s *Store) Replace(id string, cells []Cell) (Notebook, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	e, err := s.lookup(id)
+	if err != nil {
+		return Notebook{}, err
+	}
+	previous := map[string]Cell{}
+	for _, cell := range e.notebook.Cells {
+		previous[cell.ID] = cell
+	}
+	for i, cell := range cells {
+		if old, ok := previous[cell.ID]; ok && old.Source == cell.Source && old.Type == cell.Type && old.Syntax == cell.Syntax {
+			cells[i].ExecutionCount, cells[i].Output = old.ExecutionCount, old.Output
+		}
+	}
+	e.notebook.Cells = cells
+	return s.snapshot(e), nil
+}
+
+// Cell returns a notebook's code cell, first setting its source when
+// source isn't nil, and the notebook's session to run it in
+func (s *Store) Cell(id, cellID string, source *string) (Cell, *sandbox.Session, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	e, err := s.lookup(id)
+	if err != nil {
+		return Cell{}, nil, err
+	}
+	cell := e.cell(cellID)
+	if cell == nil {
+		return Cell{}, nil, ErrCellNotFound
+	}
+	if cell.Type != Code {
+		return Cell{}, nil, ErrNotCode
+	}
+	if source != nil && *source != cell.Source {
+		cell.Source = *source
+		cell.ExecutionCount, cell.Output = 0, nil
+	}
+	return *cell, e.session, nil
+}
+
+// Record keeps the output of a cell's run, numbering the run, and returns
+// the cell. A run in a session the notebook has since restarted isn't
+// kept.
+func (s *Store) Record(id, cellID string, session *sandbox.Session, output Output) (Cell, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	e, err := s.lookup(id)
+	if err != nil {
+		return Cell{}, err
+	}
+	cell := e.cell(cellID)
+	if cell == nil {
+		return Cell{}, ErrCellNotFound
+	}
+	if e.session == session {
+		e.runs++
+		cell.ExecutionCount, cell.Output = e.runs, &output
+	}
+	return *cell, nil
+}
+
+// Restart gives a notebook a fresh session, forgetting every variable its
+// cells declared, and clears their outputs
+func (s *Store) Restart(id string) (Notebook, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	e, err := s.lookup(id)
+	if err != nil {
+		return Notebook{}, err
+	}
+	e.session, e.runs = sandbox.NewSession(), 0
+	for i := range e.notebook.Cells {
+		e.notebook.Cells[i].ExecutionCount, e.notebook.Cells[i].Output = 0, nil
+	}
+	return s.snapshot(e), nil
+}
+
+// Delete drops a notebook, reporting whether there was one
+func (s *Store) Delete(id string) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	_, found := s.notebooks[id]
+	delete(s.notebooks, id)
+	return found
+}
+
+// lookup finds a notebook that hasn't expired and marks it used
+func (s *Store) lookup(id string) (*entry, error) {
+	e, ok := s.notebooks[id]
+	now := time.Now()
+	if !ok || now.Sub(e.used) > s.ttl {
+		return nil, ErrNotFound
+	}
+	e.used = now
+	return e, nil
+}
+
+func (s *Store) snapshot(e *entry) Notebook {
+	nb := e.notebook
+	nb.Cells = append([]Cell{}, e.notebook.Cells...)
+	nb.ExpiresAt = e.used.Add(s.ttl).UTC()
+	return nb
+}
+
+// evict drops the notebooks that have gone unused for the TTL
+func (s *Store) evict(now time.Time) {
+	for id, e := range s.notebooks {
+		if now.Sub(e.used) > s.ttl {
+			delete(s.notebooks, id)
+		}
+	}
+}
+
+func (e *entry) cell(id string) *Cell {
+	for i := range e.notebook.Cells {
+		if e.notebook.Cells[i].ID == id {
+			return &e.notebook.Cells[i]
+		}
+	}
+	return nil
+}
+
+func newID() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
@@ -0,0 +1,208 @@
+// Package preview renders social-preview cards for shared snippets: the
+// 1200x630 images Twitter, Discord and Open Graph readers show under a
+// link.
+package preview
+
+import (
+	"bytes"
+	"fmt"
+	"html"
+	"image"
+	"image/color"
+	"image/draw"
+	"image/png"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+const (
+	Width  = 1200
+	Height = 630
+	// MaxLines is how many lines of code a card shows
+	MaxLines = 12
+	// maxColumns truncates long lines so they don't run off the card
+	maxColumns = 56
+)
+
+// Card is what a preview shows
+type Card struct {
+	// Title names the snippet, e.g. its id
+	Title string
+	// Language labels the syntax, e.g. "EmojiScript markup"
+	Language string
+	Code     string
+	// Accent colors the title bar and keyword emoji; a #rrggbb value
+	Accent string
+	Dark   bool
+}
+
+type palette struct {
+	bg, panel, fg, muted, str color.RGBA
+}
+
+var (
+	light = palette{bg: rgb(0xffffff), panel: rgb(0xf6f8fa), fg: rgb(0x1f2328), muted: rgb(0x656d76), str: rgb(0x0a3069)}
+	dark  = palette{bg: rgb(0x0d1117), panel: rgb(0x161b22), fg: rgb(0xe6edf3), muted: rgb(0x8d96a0), str: rgb(0xa5d6ff)}
+	// defaultAccent matches the embed viewer's
+	defaultAccent = rgb(0x7c3aed)
+)
+
+func rgb(v uint32) color.RGBA {
+	return color.RGBA{R: uint8(v >> 16), G: uint8(v >> 8), B: uint8(v), A: 0xff}
+}
+
+func hex(c color.RGBA) string {
+	return fmt.Sprintf("#%02x%02x%02x", c.R, c.G, c.B)
+}
+
+// parseAccent reads a #rgb or #rrggbb color, falling back to the default
+func parseAccent(s string) color.RGBA {
+	s = strings.TrimPrefix(s, "#")
+	if len(s) == 3 {
+		s = string([]byte{s[0], s[0], s[1], s[1], s[2], s[2]})
+	}
+	var v uint32
+	if len(s) != 6 {
+		return defaultAccent
+	}
+	if _, err := fmt.Sscanf(s, "%06x", &v); err != nil {
+		return defaultAccent
+	}
+	return rgb(v)
+}
+
+func (c Card) palette() palette {
+	if c.Dark {
+		return dark
+	}
+	return light
+}
+
+// lines returns the code lines the card shows, tabs expanded and long
+// lines cut, with a final "…" line when the program is longer
+func (c Card) lines() []string {
+	lines := strings.Split(strings.TrimRight(strings.ReplaceAll(c.Code, "\r\n", "\n"), "\n"), "\n")
+	if len(lines) > MaxLines {
+		lines = append(lines[:MaxLines-1:MaxLines-1], "…")
+	}
+	out := make([]string, len(lines))
+	for i, line := range lines {
+		line = strings.ReplaceAll(line, "\t", "  ")
+		if utf8.RuneCountInString(line) > maxColumns {
+			line = string([]rune(line)[:maxColumns-1]) + "…"
+		}
+		out[i] = line
+	}
+	return out
+}
+
+// SVG renders the card as an SVG image, with the code as text
+func SVG(c Card) string {
+	p, accent := c.palette(), parseAccent(c.Accent)
+
+	var b strings.Builder
+	fmt.Fprintf(&b, `<svg xmlns="http://www.w3.org/2000/svg" width="%d" height="%d" viewBox="0 0 %d %d" role="img" aria-label="%s">`, Width, Height, Width, Height, html.EscapeString(c.Title))
+	fmt.Fprintf(&b, `<rect width="%d" height="%d" fill="%s"/>`, Width, Height, hex(p.bg))
+	fmt.Fprintf(&b, `<rect width="%d" height="12" fill="%s"/>`, Width, hex(accent))
+	fmt.Fprintf(&b, `<text x="64" y="92" fill="%s" font-family="system-ui,sans-serif" font-size="44" font-weight="600">%s</text>`, hex(p.fg), html.EscapeString(c.Title))
+	fmt.Fprintf(&b, `<text x="64" y="132" fill="%s" font-family="system-ui,sans-serif" font-size="26">%s</text>`, hex(p.muted), html.EscapeString(c.Language))
+	fmt.Fprintf(&b, `<rect x="48" y="164" width="%d" height="%d" rx="16" fill="%s"/>`, Width-96, Height-164-48, hex(p.panel))
+	fmt.Fprintf(&b, `<text fill="%s" font-family="ui-monospace,SFMono-Regular,Menlo,monospace,'Apple Color Emoji','Noto Color Emoji'" font-size="26" xml:space="preserve">`, hex(p.fg))
+	for i, line := range c.lines() {
+		fmt.Fprintf(&b, `<tspan x="80" y="%d">%s</tspan>`, 214+i*32, html.EscapeString(line))
+	}
+	b.WriteString(`</text></svg>`)
+	return b.String()
+}
+
+// PNG renders the card as a PNG. There is no font rasterizer in the
+// standard library, so the code is drawn as a silhouette: each run of
+// characters is a bar, colored like the syntax it stands for.
+func PNG(c Card) ([]byte, error) {
+	p, accent := c.palette(), parseAccent(c.Accent)
+	img := image.NewRGBA(image.Rect(0, 0, Width, Height))
+	fill := func(x0, y0, x1, y1 int, col color.RGBA) {
+		draw.Draw(img, image.Rect(x0, y0, x1, y1), &image.Uniform{C: col}, image.Point{}, draw.Src)
+	}
+
+	fill(0, 0, Width, Height, p.bg)
+	fill(0, 0, Width, 12, accent)
+	fill(64, 56, 64+min(18*utf8.RuneCountInString(c.Title), Width-128), 92, p.fg)
+	fill(64, 112, 64+min(12*utf8.RuneCountInString(c.Language), Width-128), 128, p.muted)
+	fill(48, 164, Width-48, Height-48, p.panel)
+
+	const x0, y0, cell, line = 80, 194, 18, 32
+	for row, text := range c.lines() {
+		col := 0
+		for _, seg := range runs(text) {
+			if seg.class != space {
+				shade := p.fg
+				switch seg.class {
+				case emoji:
+					shade = accent
+				case str:
+					shade = p.str
+				}
+				y := y0 + row*line
+				if right := min(x0+(col+seg.width)*cell-4, Width-64); right > x0+col*cell {
+					fill(x0+col*cell, y, right, y+18, shade)
+				}
+			}
+			col += seg.width
+		}
+	}
+
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, img); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+type runClass int
+
+const (
+	space runClass = iota
+	word
+	emoji
+	str
+)
+
+type run struct {
+	class runClass
+	// width is in monospace cells; an emoji takes two
+	width int
+}
+
+// runs splits a line into same-class runs for the silhouette
+func runs(line string) []run {
+	var out []run
+	var quote rune
+	for _, r := range line {
+		class := word
+		width := 1
+		switch {
+		case quote != 0:
+			class = str
+			if r == quote {
+				quote = 0
+			}
+		case r == '"' || r == '\'' || r == '`':
+			class, quote = str, r
+		case unicode.IsSpace(r):
+			class = space
+		case r == 0xfe0f || r == 0x200d:
+			// variation selectors and joiners belong to the emoji before
+			class, width = emoji, 0
+		case r >= 0x2190:
+			class, width = emoji, 2
+		}
+		if n := len(out); n > 0 && out[n-1].class == class {
+			out[n-1].width += width
+			continue
+		}
+		out = append(out, run{class: class, width: width})
+	}
+	return out
+}
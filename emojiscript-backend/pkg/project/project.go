@@ -0,0 +1,141 @@
+// Package project reads emoji.config.json, the file at the root of an
+// emojic project that says where its sources are and what they're built
+// to. `emojic build <dir>` builds a directory that has one, `emojic hooks`
+// checks it from Git hooks, and the server writes one into the archive of
+// a user's snippets.
+package project
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+)
+
+// ConfigFile is the name of a project's configuration, at its root
+const ConfigFile = "emoji.config.json"
+
+// Default directories of a project whose configuration leaves them out
+const (
+	DefaultSrc = "src"
+	DefaultOut = "dist"
+)
+
+// Extensions are the file extensions emojic writes for each target it
+// builds
+var Extensions = map[string]string{
+	"javascript": ".js",
+	"typescript": ".ts",
+	"es5":        ".js",
+	"python":     ".py",
+	"rust":       ".rs",
+	"gdscript":   ".gd",
+}
+
+// Config is a project's emoji.config.json
+type Config struct {
+	Name string `json:"name,omitempty"`
+	// Target is the language the sources are built to, javascript unless
+	// set
+	Target string `json:"target,omitempty"`
+	// Src is the directory of the .emoji sources and Out the one their
+	// outputs are written to, both relative to the project's root
+	Src string `json:"src,omitempty"`
+	Out string `json:"out,omitempty"`
+	// Markup lists the sources, relative to Src, to read as markup
+	// whether or not they look like it
+	Markup []string `json:"markup,omitempty"`
+	// Hooks are the checks of the Git hooks `emojic hooks install`
+	// writes, DefaultHooks unless set
+	Hooks *Hooks `json:"hooks,omitempty"`
+}
+
+// Checks a hook can run on a project's sources
+const (
+	// CheckFormat fails on a source emojic build -fmt would change
+	CheckFormat = "fmt"
+	// CheckLint fails on a source emojic lint reports problems in
+	CheckLint = "lint"
+	// CheckBuild builds the sources and fails on an error, or on an
+	// output that then differs from the one in the commit
+	CheckBuild = "build"
+)
+
+// Checks are the checks a hook can run, in the order they run
+var Checks = []string{CheckFormat, CheckLint, CheckBuild}
+
+// Hooks are the checks run before a commit and before a push. A hook
+// without checks isn't installed.
+type Hooks struct {
+	PreCommit []string `json:"preCommit,omitempty"`
+	PrePush   []string `json:"prePush,omitempty"`
+}
+
+// DefaultHooks check the sources before each commit and that the outputs
+// are up to date before each push
+var DefaultHooks = Hooks{
+	PreCommit: []string{CheckFormat, CheckLint},
+	PrePush:   []string{CheckBuild},
+}
+
+// Validate reports a check that isn't one of Checks
+func (h Hooks) Validate() error {
+	for _, check := range append(slices.Clone(h.PreCommit), h.PrePush...) {
+		if !slices.Contains(Checks, check) {
+			return fmt.Errorf("unknown hook check %q; valid values: %s", check, strings.Join(Checks, ", "))
+		}
+	}
+	return nil
+}
+
+// Sources returns the paths of the .emoji files of the project rooted at
+// dir
+func (c Config) Sources(dir string) ([]string, error) {
+	return filepath.Glob(filepath.Join(dir, c.Src, "*.emoji"))
+}
+
+// IsMarkup reports whether the configuration lists the source at path,
+// in the project rooted at dir, as markup
+func (c Config) IsMarkup(dir, path string) bool {
+	for _, name := range c.Markup {
+		if filepath.Join(dir, c.Src, name) == filepath.Clean(path) {
+			return true
+		}
+	}
+	return false
+}
+
+// Load reads the configuration of the project rooted at dir, filling in
+// the defaults. found is false when dir has no emoji.config.json.
+func Load(dir string) (config Config, found bool, err error) {
+	data, err := os.ReadFile(filepath.Join(dir, ConfigFile))
+	if errors.Is(err, fs.ErrNotExist) {
+		return Config{}, false, nil
+	}
+	if err != nil {
+		return Config{}, false, err
+	}
+	if err := json.Unmarshal(data, &config); err != nil {
+		return Config{}, true, fmt.Errorf("%s: %v", ConfigFile, err)
+	}
+	if config.Target == "" {
+		config.Target = "javascript"
+	}
+	if config.Src == "" {
+		config.Src = DefaultSrc
+	}
+	if config.Out == "" {
+		config.Out = DefaultOut
+	}
+	if config.Hooks == nil {
+		config.Hooks = &Hooks{PreCommit: slices.Clone(DefaultHooks.PreCommit), PrePush: slices.Clone(DefaultHooks.PrePush)}
+	}
+	if err := config.Hooks.Validate(); err != nil {
+		return Config{}, true, fmt.Errorf("%s: %v", ConfigFile, err)
+	}
+	return config, true, nil
+}
@@ -0,0 +1,125 @@
+// Package ratelimit counts requests per client in fixed windows, for
+// routes that need a limit of their own on top of a server's general one.
+package ratelimit
+
+import (
+	"encoding/json"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	DefaultWindow     = time.Minute
+	DefaultMaxClients = 10000
+)
+
+type window struct {
+	count int
+	ends  time.Time
+}
+
+// Limiter allows each client max requests per window. It is safe for
+// concurrent use.
+type Limiter struct {
+	mu      sync.Mutex
+	max     int
+	window  time.Duration
+	clients map[string]*window
+}
+
+// New creates a limiter allowing max requests per window; a zero window
+// picks DefaultWindow
+func New(max int, every time.Duration) *Limiter {
+	if every <= 0 {
+		every = DefaultWindow
+	}
+	return &Limiter{max: max, window: every, clients: map[string]*window{}}
+}
+
+// Allow counts a request from client. When the client is over its limit
+// it returns false and how long until its window ends.
+func (l *Limiter) Allow(client string) (bool, time.Duration) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	now := time.Now()
+	w, ok := l.clients[client]
+	if !ok || !now.Before(w.ends) {
+		if len(l.clients) >= DefaultMaxClients {
+			l.evict(now)
+		}
+		w = &window{ends: now.Add(l.window)}
+		l.clients[client] = w
+	}
+	if w.count >= l.max {
+		return false, w.ends.Sub(now)
+	}
+	w.count++
+	return true, 0
+}
+
+// evict drops the windows that have ended and, if that frees nothing,
+// every window, so a flood of clients can't grow the map without bound
+func (l *Limiter) evict(now time.Time) {
+	for client, w := range l.clients {
+		if !now.Before(w.ends) {
+			delete(l.clients, client)
+		}
+	}
+	if len(l.clients) >= DefaultMaxClients {
+		clear(l.clients)
+	}
+}
+
+// RejectionBody is the JSON reply to a request over the limit
+type RejectionBody struct {
+	Success    bool   `json:"success"`
+	Error      string `json:"error"`
+	RetryAfter int    `json:"retryAfter"`
+}
+
+// Middleware answers 429 with Retry-After once a client is over its
+// limit. client names the client sending a request; requests it returns
+// "" for aren't limited.
+func (l *Limiter) Middleware(next http.Handler, client func(*http.Request) string) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		key := client(r)
+		if key == "" {
+			next.ServeHTTP(w, r)
+			return
+		}
+		if ok, wait := l.Allow(key); !ok {
+			seconds := int((wait + time.Second - 1) / time.Second)
+			w.Header().Set("Retry-After", strconv.Itoa(seconds))
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(http.StatusTooManyRequests)
+			json.NewEncoder(w).Encode(RejectionBody{Error: "Rate limit exceeded. Please try again later.", RetryAfter: seconds})
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// ClientIP returns the address a request came from. Behind a proxy that
+// sets them, such as Vercel's, trustProxy reads X-Real-IP or the first
+// X-Forwarded-For entry instead, since the connection is the proxy's;
+// elsewhere clients could set those headers themselves.
+func ClientIP(r *http.Request, trustProxy bool) string {
+	if trustProxy {
+		if ip := strings.TrimSpace(r.Header.Get("X-Real-IP")); ip != "" {
+			return ip
+		}
+		if forwarded := r.Header.Get("X-Forwarded-For"); forwarded != "" {
+			first, _, _ := strings.Cut(forwarded, ",")
+			return strings.TrimSpace(first)
+		}
+	}
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
@@ -0,0 +1,225 @@
+package refactor
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"emojiscript-backend/pkg/sandbox"
+	"emojiscript-backend/pkg/transpiler"
+)
+
+// DefaultFunctionName names an extracted function when no name is given
+const DefaultFunctionName = "extracted"
+
+// Extraction is the result of extracting a function
+type Extraction struct {
+	Name string `json:"name"`
+	// Params are the variables the selection read from around it
+	Params []string `json:"params"`
+	// Returns are the variables the selection declared that later code uses
+	Returns []string `json:"returns"`
+	Edits   []Edit   `json:"edits"`
+}
+
+// Extract moves lines start to end of code into a new function at the end
+// of the program and calls it in their place. Local variables the lines
+// read become parameters; variables they declare that later lines use are
+// returned. markup selects the markup syntax for the new code.
+func Extract(code string, markup bool, start, end int, name string, aliases map[string]string) (*Extraction, error) {
+	lines := strings.Split(code, "\n")
+	if start < 1 || end < start || end > len(lines) {
+		return nil, fmt.Errorf("lines %d to %d aren't in the program", start, end)
+	}
+	selected := lines[start-1 : end]
+	if strings.TrimSpace(strings.Join(selected, "")) == "" {
+		return nil, errors.New("the selection is empty")
+	}
+	if name == "" {
+		name = DefaultFunctionName
+	}
+	if err := checkName(name); err != nil {
+		return nil, err
+	}
+	words := wordsByLine(code)
+	for _, lineWords := range words {
+		for _, w := range lineWords {
+			if w.text == name {
+				return nil, fmt.Errorf("'%s' is already used in the program", name)
+			}
+		}
+	}
+
+	compile := func(src string) (string, error) {
+		src = transpiler.ApplyAliases(src, aliases)
+		if markup {
+			return transpiler.NewMarkupParser(src, "javascript").Parse()
+		}
+		return transpiler.TranspileEmoji(src, "javascript"), nil
+	}
+	output, err := compile(code)
+	if err != nil {
+		return nil, err
+	}
+	whole, err := sandbox.Resolve(output)
+	if err != nil {
+		return nil, err
+	}
+	output, err = compile(strings.Join(selected, "\n"))
+	if err != nil {
+		return nil, fmt.Errorf("the selection isn't a run of whole statements: %w", err)
+	}
+	selection, err := sandbox.Resolve(output)
+	if err != nil {
+		return nil, fmt.Errorf("the selection isn't a run of whole statements: %w", err)
+	}
+
+	if len(selection.Escapes) > 0 {
+		return nil, fmt.Errorf("the selection's %s would jump out of the new function", selection.Escapes[0].Keyword)
+	}
+	for _, lineWords := range wordsByLine(output) {
+		for _, w := range lineWords {
+			if w.text == "this" || w.text == "super" {
+				return nil, fmt.Errorf("the selection uses '%s', which means something else inside a new function", w.text)
+			}
+		}
+	}
+
+	locals := map[string]bool{}
+	for _, ref := range whole.References {
+		if ref.Declaration && ref.Binding != 0 {
+			locals[ref.Name] = true
+		}
+	}
+	declared := map[string]bool{}
+	x := &Extraction{Name: name, Params: []string{}, Returns: []string{}}
+	for _, ref := range selection.References {
+		if ref.Declaration && ref.Binding == 0 && !declared[ref.Name] {
+			declared[ref.Name] = true
+			if usedAfter(words, end, ref.Name) {
+				x.Returns = append(x.Returns, ref.Name)
+			}
+		}
+	}
+	params := map[string]bool{}
+	for _, ref := range selection.References {
+		if ref.Binding != 0 || ref.Declaration || declared[ref.Name] || !locals[ref.Name] {
+			continue
+		}
+		if ref.Assigned {
+			return nil, fmt.Errorf("the selection assigns to '%s', which is declared outside it", ref.Name)
+		}
+		if !params[ref.Name] {
+			params[ref.Name] = true
+			x.Params = append(x.Params, ref.Name)
+		}
+	}
+
+	indent := leadingSpace(selected[0])
+	call := fmt.Sprintf("%s(%s)", name, strings.Join(x.Params, ", "))
+	switch {
+	case selection.Await && markup:
+		call = "await " + call
+	case selection.Await:
+		call = "⏳ " + call
+	}
+	result := ""
+	switch len(x.Returns) {
+	case 0:
+	case 1:
+		result = x.Returns[0]
+	default:
+		result = "{ " + strings.Join(x.Returns, ", ") + " }"
+	}
+
+	var fn strings.Builder
+	body := reindent(selected, "  ")
+	if markup {
+		fmt.Fprintf(&fn, "<function name=\"%s\"", name)
+		if len(x.Params) > 0 {
+			fmt.Fprintf(&fn, " params=\"%s\"", strings.Join(x.Params, ", "))
+		}
+		if selection.Await {
+			fn.WriteString(" async=\"true\"")
+		}
+		fn.WriteString(">\n" + body + "\n")
+		if result != "" {
+			fmt.Fprintf(&fn, "  <return>%s</return>\n", result)
+		}
+		fn.WriteString("</function>")
+		switch {
+		case len(x.Returns) == 1:
+			call = fmt.Sprintf("<let name=\"%s\" value=\"%s\" />", result, call)
+		case result != "":
+			call = fmt.Sprintf("let %s = %s", result, call)
+		}
+	} else {
+		if selection.Await {
+			fn.WriteString("⚡ ")
+		}
+		fmt.Fprintf(&fn, "🎯 %s(%s) {\n%s\n", name, strings.Join(x.Params, ", "), body)
+		if result != "" {
+			fmt.Fprintf(&fn, "  🔙 %s\n", result)
+		}
+		fn.WriteString("}")
+		if result != "" {
+			call = fmt.Sprintf("🔢 %s = %s", result, call)
+		}
+	}
+
+	// the function goes at the end, before the final newline if there is
+	// one
+	last := len(lines)
+	tail := len([]rune(lines[last-1])) + 1
+	insert := "\n\n" + fn.String()
+	if lines[last-1] == "" {
+		insert = "\n" + fn.String() + "\n"
+	}
+	x.Edits = []Edit{
+		{Line: start, Column: 1, EndLine: end, EndColumn: len([]rune(lines[end-1])) + 1, NewText: indent + call},
+		{Line: last, Column: tail, EndLine: last, EndColumn: tail, NewText: insert},
+	}
+	return x, nil
+}
+
+// usedAfter reports whether name appears after line
+func usedAfter(words map[int][]word, line int, name string) bool {
+	for l, lineWords := range words {
+		if l <= line {
+			continue
+		}
+		for _, w := range lineWords {
+			if w.text == name {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func leadingSpace(line string) string {
+	return line[:len(line)-len(strings.TrimLeft(line, " \t"))]
+}
+
+// reindent replaces the indentation lines share with indent
+func reindent(lines []string, indent string) string {
+	common := ""
+	first := true
+	for _, line := range lines {
+		if strings.TrimSpace(line) == "" {
+			continue
+		}
+		space := leadingSpace(line)
+		if first || len(space) < len(common) {
+			common, first = space, false
+		}
+	}
+	result := make([]string, len(lines))
+	for i, line := range lines {
+		if strings.TrimSpace(line) == "" {
+			continue
+		}
+		result[i] = indent + strings.TrimPrefix(line, common)
+	}
+	return strings.Join(result, "\n")
+}
@@ -0,0 +1,303 @@
+package refactor
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+
+	"emojiscript-backend/pkg/transpiler"
+)
+
+// ImportIssue is an unused or duplicate import
+type ImportIssue struct {
+	File string `json:"file,omitempty"`
+	Line int    `json:"line"`
+	// Kind is "unused" or "duplicate"
+	Kind    string   `json:"kind"`
+	Module  string   `json:"module"`
+	Names   []string `json:"names,omitempty"`
+	Message string   `json:"message"`
+}
+
+var (
+	// bareImport matches `import lodash`, which is what `📥 lodash` becomes
+	bareImport = regexp.MustCompile(`^\s*import\s+([A-Za-z_$@][\w$@./-]*)\s*;?\s*$`)
+	// clauseImport matches `import <bindings> from 'module'`
+	clauseImport    = regexp.MustCompile(`^\s*import\s+(.+?)\s+from\s+(['"])([^'"]+)['"]\s*;?\s*$`)
+	namespaceImport = regexp.MustCompile(`^\*\s*as\s+([A-Za-z_$][\w$]*)$`)
+	defaultImport   = regexp.MustCompile(`^[A-Za-z_$][\w$]*$`)
+)
+
+// importSpec is one name an import binds
+type importSpec struct {
+	// imported is the exported name, "default" or "*"
+	imported string
+	local    string
+}
+
+func (s importSpec) String() string {
+	if s.imported == s.local {
+		return s.local
+	}
+	return s.imported + " as " + s.local
+}
+
+// importStmt is a single-line import of a source file
+type importStmt struct {
+	line   int
+	module string
+	// prefix is the source up to and including the import emoji
+	prefix string
+	quote  string
+	bare   bool
+	specs  []importSpec
+}
+
+// render writes the import back as source
+func (s *importStmt) render() string {
+	var parts, named []string
+	for _, spec := range s.specs {
+		switch spec.imported {
+		case "default":
+			parts = append(parts, spec.local)
+		case "*":
+			parts = append(parts, "* as "+spec.local)
+		default:
+			named = append(named, spec.String())
+		}
+	}
+	if len(named) > 0 {
+		parts = append(parts, "{ "+strings.Join(named, ", ")+" }")
+	}
+	return fmt.Sprintf("%s %s from %s%s%s", s.prefix, strings.Join(parts, ", "), s.quote, s.module, s.quote)
+}
+
+// namespace reports whether the import binds a whole module object,
+// which can't share a statement with named imports
+func (s *importStmt) namespace() bool {
+	for _, spec := range s.specs {
+		if spec.imported == "*" {
+			return true
+		}
+	}
+	return false
+}
+
+// parseImport reads an import from a line of transpiled JavaScript, with
+// the source line it came from. Side-effect imports and imports spanning
+// lines are left alone.
+func parseImport(js, source string, line int) *importStmt {
+	trimmed := strings.TrimLeft(source, " \t")
+	end := strings.IndexAny(trimmed, " \t")
+	if end < 0 {
+		return nil
+	}
+	stmt := &importStmt{line: line, prefix: source[:len(source)-len(trimmed)] + trimmed[:end]}
+
+	if m := bareImport.FindStringSubmatch(js); m != nil {
+		stmt.module, stmt.bare = m[1], true
+		stmt.specs = []importSpec{{imported: "default", local: transpiler.ImportBinding(m[1])}}
+		return stmt
+	}
+	m := clauseImport.FindStringSubmatch(js)
+	if m == nil {
+		return nil
+	}
+	stmt.module, stmt.quote = m[3], m[2]
+	clause := strings.TrimSpace(m[1])
+	if open := strings.Index(clause, "{"); open >= 0 {
+		close := strings.LastIndex(clause, "}")
+		if close < open {
+			return nil
+		}
+		for _, part := range strings.Split(clause[open+1:close], ",") {
+			fields := strings.Fields(part)
+			switch {
+			case len(fields) == 1:
+				stmt.specs = append(stmt.specs, importSpec{fields[0], fields[0]})
+			case len(fields) == 3 && fields[1] == "as":
+				stmt.specs = append(stmt.specs, importSpec{fields[0], fields[2]})
+			case len(fields) != 0:
+				return nil
+			}
+		}
+		clause = strings.TrimSpace(strings.TrimSuffix(strings.TrimSpace(clause[:open]), ","))
+	}
+	for _, part := range strings.Split(clause, ",") {
+		part = strings.TrimSpace(part)
+		switch {
+		case part == "":
+		case namespaceImport.MatchString(part):
+			stmt.specs = append(stmt.specs, importSpec{"*", namespaceImport.FindStringSubmatch(part)[1]})
+		case defaultImport.MatchString(part):
+			stmt.specs = append(stmt.specs, importSpec{"default", part})
+		default:
+			return nil
+		}
+	}
+	return stmt
+}
+
+// OrganizeImports drops imports a file never uses and folds repeated
+// imports of a module into the first one. Each file is organized on its
+// own; it returns the issues found and the edits that fix them.
+func OrganizeImports(files []File, aliases map[string]string) ([]ImportIssue, []Edit, error) {
+	issues := []ImportIssue{}
+	edits := []Edit{}
+	for _, file := range files {
+		fileIssues, fileEdits, err := organizeFile(file, aliases)
+		if err != nil {
+			return nil, nil, (&program{file: file}).located(err, len(files))
+		}
+		for i := range fileIssues {
+			if len(files) > 1 {
+				fileIssues[i].File = file.Name
+			}
+		}
+		for i := range fileEdits {
+			if len(files) > 1 {
+				fileEdits[i].File = file.Name
+			}
+		}
+		issues = append(issues, fileIssues...)
+		edits = append(edits, fileEdits...)
+	}
+	return issues, edits, nil
+}
+
+func organizeFile(file File, aliases map[string]string) ([]ImportIssue, []Edit, error) {
+	output := transpiler.TranspileEmoji(transpiler.ApplyAliases(file.Code, aliases), "javascript")
+	jsLines := strings.Split(output, "\n")
+	lines := strings.Split(file.Code, "\n")
+	if len(jsLines) != len(lines) {
+		return nil, nil, ErrLayout
+	}
+
+	var imports []*importStmt
+	importLines := map[int]bool{}
+	for i, js := range jsLines {
+		if stmt := parseImport(js, lines[i], i+1); stmt != nil {
+			imports = append(imports, stmt)
+			importLines[i+1] = true
+		}
+	}
+	if len(imports) == 0 {
+		return []ImportIssue{}, []Edit{}, nil
+	}
+
+	used := map[string]bool{}
+	for line, words := range wordsByLine(file.Code) {
+		if importLines[line] {
+			continue
+		}
+		for _, w := range words {
+			used[w.text] = true
+		}
+	}
+
+	issues := []ImportIssue{}
+	changed := map[*importStmt]bool{}
+	removed := map[*importStmt]bool{}
+	bound := map[string]*importStmt{}
+	first := map[string]*importStmt{}
+	for _, stmt := range imports {
+		var kept, unused, repeated []importSpec
+		for _, spec := range stmt.specs {
+			if earlier, ok := bound[spec.local]; ok {
+				repeated = append(repeated, spec)
+				if earlier.module != stmt.module {
+					// the same name from two modules is a clash to fix by
+					// hand, not a repeat to drop
+					kept = append(kept, spec)
+				}
+				continue
+			}
+			bound[spec.local] = stmt
+			if !used[spec.local] {
+				unused = append(unused, spec)
+				continue
+			}
+			kept = append(kept, spec)
+		}
+		if len(unused) > 0 {
+			issues = append(issues, ImportIssue{Line: stmt.line, Kind: "unused", Module: stmt.module, Names: locals(unused),
+				Message: fmt.Sprintf("%s imported from '%s' but never used", describeNames(unused), stmt.module)})
+		}
+		if len(repeated) > 0 {
+			issues = append(issues, ImportIssue{Line: stmt.line, Kind: "duplicate", Module: stmt.module, Names: locals(repeated),
+				Message: fmt.Sprintf("%s already imported on line %d", describeNames(repeated), bound[repeated[0].local].line)})
+		}
+		if len(kept) != len(stmt.specs) {
+			stmt.specs = kept
+			changed[stmt] = true
+		}
+
+		target, seen := first[stmt.module]
+		switch {
+		case !seen:
+			first[stmt.module] = stmt
+		case len(stmt.specs) == 0:
+		case target.namespace() || stmt.namespace() || target.bare || stmt.bare || hasDefault(target) && hasDefault(stmt):
+		default:
+			issues = append(issues, ImportIssue{Line: stmt.line, Kind: "duplicate", Module: stmt.module, Names: locals(stmt.specs),
+				Message: fmt.Sprintf("'%s' is already imported on line %d; the imports can be merged", stmt.module, target.line)})
+			if hasDefault(stmt) {
+				target.specs = append(stmt.specs[:1:1], target.specs...)
+				stmt.specs = stmt.specs[1:]
+			}
+			target.specs = append(target.specs, stmt.specs...)
+			stmt.specs = nil
+			changed[target], changed[stmt] = true, true
+		}
+		if len(stmt.specs) == 0 {
+			removed[stmt] = true
+		}
+	}
+
+	edits := []Edit{}
+	for _, stmt := range imports {
+		switch {
+		case removed[stmt]:
+			edits = append(edits, deleteLine(lines, stmt.line))
+		case changed[stmt]:
+			edits = append(edits, Edit{Line: stmt.line, Column: 1, EndLine: stmt.line, EndColumn: len([]rune(lines[stmt.line-1])) + 1, NewText: stmt.render()})
+		}
+	}
+	return issues, edits, nil
+}
+
+// hasDefault reports whether an import starts with a default binding
+func hasDefault(stmt *importStmt) bool {
+	return len(stmt.specs) > 0 && stmt.specs[0].imported == "default"
+}
+
+// deleteLine removes a whole line along with its line break
+func deleteLine(lines []string, line int) Edit {
+	if line < len(lines) {
+		return Edit{Line: line, Column: 1, EndLine: line + 1, EndColumn: 1}
+	}
+	if line == 1 {
+		return Edit{Line: 1, Column: 1, EndLine: 1, EndColumn: len([]rune(lines[0])) + 1}
+	}
+	return Edit{Line: line - 1, Column: len([]rune(lines[line-2])) + 1, EndLine: line, EndColumn: len([]rune(lines[line-1])) + 1}
+}
+
+func locals(specs []importSpec) []string {
+	names := make([]string, len(specs))
+	for i, spec := range specs {
+		names[i] = spec.local
+	}
+	return names
+}
+
+func describeNames(specs []importSpec) string {
+	quoted := make([]string, len(specs))
+	for i, spec := range specs {
+		quoted[i] = "'" + spec.local + "'"
+	}
+	verb := "is"
+	if len(specs) > 1 {
+		verb = "are"
+	}
+	return strings.Join(quoted, ", ") + " " + verb
+}
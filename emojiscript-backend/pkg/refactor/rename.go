@@ -0,0 +1,117 @@
+package refactor
+
+import (
+	"errors"
+	"fmt"
+)
+
+// reserved are the words JavaScript doesn't allow as variable names
+var reserved = map[string]bool{
+	"break": true, "case": true, "catch": true, "class": true, "const": true,
+	"continue": true, "debugger": true, "default": true, "delete": true,
+	"do": true, "else": true, "enum": true, "export": true, "extends": true,
+	"false": true, "finally": true, "for": true, "function": true, "if": true,
+	"import": true, "in": true, "instanceof": true, "let": true, "new": true,
+	"null": true, "return": true, "static": true, "super": true, "switch": true,
+	"this": true, "throw": true, "true": true, "try": true, "typeof": true,
+	"var": true, "void": true, "while": true, "with": true, "yield": true,
+	"await": true, "undefined": true,
+}
+
+// ErrNoFiles is returned when a rename is given nothing to work on
+var ErrNoFiles = errors.New("no source to rename in")
+
+// Rename renames the variable at a line and column of one file, following
+// JavaScript's scoping so other variables with the same name are left
+// alone. Files share one global scope, as scripts on a page do, so
+// renaming a global renames it in every file. It returns the old name and
+// the edits, in file order.
+func Rename(files []File, target string, line, column int, newName string, aliases map[string]string) (string, []Edit, error) {
+	if len(files) == 0 {
+		return "", nil, ErrNoFiles
+	}
+	if err := checkName(newName); err != nil {
+		return "", nil, err
+	}
+
+	programs := make([]*program, len(files))
+	current := -1
+	for i, file := range files {
+		p, err := load(file, aliases)
+		if err != nil {
+			return "", nil, (&program{file: file}).located(err, len(files))
+		}
+		programs[i] = p
+		if file.Name == target || target == "" && len(files) == 1 {
+			current = i
+		}
+	}
+	if current < 0 {
+		return "", nil, fmt.Errorf("no file named '%s'", target)
+	}
+
+	w, ok := programs[current].wordAt(line, column)
+	if !ok {
+		return "", nil, fmt.Errorf("no variable at line %d, column %d", line, column)
+	}
+	ref, err := programs[current].reference(w)
+	if err != nil {
+		return "", nil, err
+	}
+	if newName == ref.Name {
+		return ref.Name, []Edit{}, nil
+	}
+
+	// a global is the same variable in every file; anything else lives in
+	// the file it was found in
+	affected := []*program{programs[current]}
+	if ref.Binding == 0 {
+		affected = programs
+	}
+	edits := []Edit{}
+	for _, p := range affected {
+		if err := p.scopes.RenameConflict(ref, newName); err != nil {
+			return "", nil, p.located(err, len(files))
+		}
+		for _, occurrence := range p.scopes.Occurrences(ref) {
+			source, err := p.sourceWord(occurrence)
+			if err != nil {
+				return "", nil, p.located(err, len(files))
+			}
+			edit := Edit{Line: source.line, Column: source.col, EndLine: source.line, EndColumn: source.col + len([]rune(source.text)), NewText: newName}
+			if occurrence.Shorthand {
+				edit.NewText = ref.Name + ": " + newName
+			}
+			if len(files) > 1 {
+				edit.File = p.file.Name
+			}
+			edits = append(edits, edit)
+		}
+	}
+	return ref.Name, edits, nil
+}
+
+// located prefixes an error with the file it is about, in projects with
+// more than one
+func (p *program) located(err error, files int) error {
+	if files > 1 {
+		return fmt.Errorf("%s: %w", p.file.Name, err)
+	}
+	return err
+}
+
+// checkName reports whether name can name a variable
+func checkName(name string) error {
+	if name == "" {
+		return errors.New("the new name is empty")
+	}
+	for i, r := range name {
+		if i == 0 && !isIdentStart(r) || !isIdentPart(r) {
+			return fmt.Errorf("'%s' isn't a valid identifier", name)
+		}
+	}
+	if reserved[name] {
+		return fmt.Errorf("'%s' is a reserved word", name)
+	}
+	return nil
+}
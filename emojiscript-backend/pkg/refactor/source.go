@@ -0,0 +1,266 @@
+// Package refactor implements editor refactorings. Source is transpiled
+// and analyzed as JavaScript; because the emoji syntax keeps identifiers
+// and lines where they are, each identifier in its JavaScript can be traced
+// back to the same word on the same source line.
+package refactor
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"unicode"
+
+	"emojiscript-backend/pkg/sandbox"
+	"emojiscript-backend/pkg/transpiler"
+)
+
+// File is one source file of a project
+type File struct {
+	Name string `json:"name"`
+	Code string `json:"code"`
+}
+
+// Edit replaces the text from one line and column to another, counted in
+// characters from 1. The end is exclusive.
+type Edit struct {
+	File      string `json:"file,omitempty"`
+	Line      int    `json:"line"`
+	Column    int    `json:"column"`
+	EndLine   int    `json:"endLine"`
+	EndColumn int    `json:"endColumn"`
+	NewText   string `json:"newText"`
+}
+
+// ErrLayout is returned when the generated JavaScript doesn't keep the
+// source's lines, as with records, getters and switch expressions
+var ErrLayout = errors.New("the program uses shorthands that move lines around when transpiled, so its JavaScript can't be matched to the source")
+
+// word is an identifier-like word of source text
+type word struct {
+	text string
+	line int
+	col  int
+}
+
+// program is a source file with its JavaScript and resolved scopes
+type program struct {
+	file   File
+	source map[int][]word
+	js     map[int][]word
+	scopes *sandbox.Scopes
+}
+
+// load transpiles and resolves a file. aliases maps a dialect's emoji to
+// the base ones.
+func load(file File, aliases map[string]string) (*program, error) {
+	output := transpiler.TranspileEmoji(transpiler.ApplyAliases(file.Code, aliases), "javascript")
+	if strings.Count(output, "\n") != strings.Count(file.Code, "\n") {
+		return nil, ErrLayout
+	}
+	scopes, err := sandbox.Resolve(output)
+	if err != nil {
+		return nil, err
+	}
+	return &program{file: file, source: wordsByLine(file.Code), js: wordsByLine(output), scopes: scopes}, nil
+}
+
+// wordAt returns the source word covering a line and column
+func (p *program) wordAt(line, column int) (word, bool) {
+	for _, w := range p.source[line] {
+		if column >= w.col && column < w.col+len([]rune(w.text)) {
+			return w, true
+		}
+	}
+	return word{}, false
+}
+
+// reference resolves a source word to the identifier it became
+func (p *program) reference(w word) (sandbox.Reference, error) {
+	counterpart, err := match(w, p.source[w.line], p.js[w.line])
+	if err != nil {
+		return sandbox.Reference{}, err
+	}
+	ref, ok := p.scopes.At(counterpart.line, counterpart.col)
+	if !ok || ref.Column != counterpart.col {
+		return sandbox.Reference{}, fmt.Errorf("'%s' on line %d isn't a variable", w.text, w.line)
+	}
+	return ref, nil
+}
+
+// sourceWord finds the source word an identifier came from
+func (p *program) sourceWord(ref sandbox.Reference) (word, error) {
+	return match(word{ref.Name, ref.Line, ref.Column}, p.js[ref.Line], p.source[ref.Line])
+}
+
+// match pairs the nth occurrence of w's text among from with the nth
+// among to
+func match(w word, from, to []word) (word, error) {
+	var before []word
+	for _, other := range from {
+		if other.text == w.text {
+			before = append(before, other)
+		}
+	}
+	var after []word
+	for _, other := range to {
+		if other.text == w.text {
+			after = append(after, other)
+		}
+	}
+	if len(before) != len(after) {
+		return word{}, fmt.Errorf("can't match '%s' on line %d with the generated JavaScript", w.text, w.line)
+	}
+	for i, other := range before {
+		if other.col == w.col {
+			return after[i], nil
+		}
+	}
+	return word{}, fmt.Errorf("can't match '%s' on line %d with the generated JavaScript", w.text, w.line)
+}
+
+// wordsByLine groups the identifier-like words of source by line,
+// skipping comments, strings and the text of template literals
+func wordsByLine(src string) map[int][]word {
+	result := map[int][]word{}
+	runes := []rune(src)
+	line, col := 1, 1
+	i := 0
+	advance := func() {
+		if runes[i] == '\n' {
+			line, col = line+1, 1
+		} else {
+			col++
+		}
+		i++
+	}
+	next := func() rune {
+		if i+1 < len(runes) {
+			return runes[i+1]
+		}
+		return 0
+	}
+
+	// holes holds the brace depth of each enclosing ${} hole
+	var holes []int
+	inTemplate := false
+	for i < len(runes) {
+		c := runes[i]
+		if inTemplate {
+			switch {
+			case c == '\\':
+				advance()
+				if i < len(runes) {
+					advance()
+				}
+			case c == '`':
+				inTemplate = false
+				advance()
+			case c == '$' && next() == '{':
+				advance()
+				advance()
+				holes = append(holes, 0)
+				inTemplate = false
+			default:
+				advance()
+			}
+			continue
+		}
+
+		switch {
+		case c == '/' && next() == '/':
+			for i < len(runes) && runes[i] != '\n' {
+				advance()
+			}
+		case c == '/' && next() == '*':
+			advance()
+			advance()
+			for i < len(runes) && !(runes[i] == '*' && next() == '/') {
+				advance()
+			}
+			if i < len(runes) {
+				advance()
+				advance()
+			}
+		case c == '"' || c == '\'':
+			advance()
+			for i < len(runes) && runes[i] != c && runes[i] != '\n' {
+				if runes[i] == '\\' {
+					advance()
+					if i >= len(runes) {
+						break
+					}
+				}
+				advance()
+			}
+			if i < len(runes) && runes[i] == c {
+				advance()
+			}
+		case c == '`':
+			inTemplate = true
+			advance()
+		case c == '{':
+			if len(holes) > 0 {
+				holes[len(holes)-1]++
+			}
+			advance()
+		case c == '}':
+			if len(holes) > 0 {
+				if holes[len(holes)-1] == 0 {
+					holes = holes[:len(holes)-1]
+					inTemplate = true
+				} else {
+					holes[len(holes)-1]--
+				}
+			}
+			advance()
+		case unicode.IsDigit(c):
+			for i < len(runes) && (isIdentPart(runes[i]) || runes[i] == '.') {
+				advance()
+			}
+		case isIdentStart(c):
+			start, startLine, startCol := i, line, col
+			for i < len(runes) && isIdentPart(runes[i]) {
+				advance()
+			}
+			result[startLine] = append(result[startLine], word{string(runes[start:i]), startLine, startCol})
+		default:
+			advance()
+		}
+	}
+	return result
+}
+
+func isIdentStart(r rune) bool {
+	return r == '_' || r == '$' || unicode.IsLetter(r)
+}
+
+func isIdentPart(r rune) bool {
+	return isIdentStart(r) || unicode.IsDigit(r)
+}
+
+// Apply makes edits to code. Edits must not overlap; their File is
+// ignored.
+func Apply(code string, edits []Edit) string {
+	sorted := append([]Edit(nil), edits...)
+	sort.Slice(sorted, func(i, j int) bool {
+		if sorted[i].Line != sorted[j].Line {
+			return sorted[i].Line > sorted[j].Line
+		}
+		return sorted[i].Column > sorted[j].Column
+	})
+	lines := strings.Split(code, "\n")
+	for _, edit := range sorted {
+		if edit.Line < 1 || edit.EndLine < edit.Line || edit.EndLine > len(lines) {
+			continue
+		}
+		first, last := []rune(lines[edit.Line-1]), []rune(lines[edit.EndLine-1])
+		start, end := edit.Column-1, edit.EndColumn-1
+		if start < 0 || start > len(first) || end < 0 || end > len(last) || edit.EndLine == edit.Line && end < start {
+			continue
+		}
+		replaced := strings.Split(string(first[:start])+edit.NewText+string(last[end:]), "\n")
+		lines = append(lines[:edit.Line-1], append(replaced, lines[edit.EndLine:]...)...)
+	}
+	return strings.Join(lines, "\n")
+}
@@ -0,0 +1,91 @@
+// Package repl keeps the playground's REPL sessions: sandbox sessions a
+// client names, so the variables one /run declares are there for the
+// next, until the session goes unused for its TTL.
+package repl
+
+import (
+	"sync"
+	"time"
+
+	"emojiscript-backend/pkg/sandbox"
+)
+
+const (
+	// DefaultTTL is how long a session is kept after its last run
+	DefaultTTL         = 15 * time.Minute
+	DefaultMaxSessions = 500
+	// MaxMemory bounds what a session's variables may hold at once, in
+	// bytes, across all its runs
+	MaxMemory = 4 << 20
+)
+
+type entry struct {
+	session *sandbox.Session
+	used    time.Time
+}
+
+// Store keeps sessions in memory, dropping those unused for its TTL and,
+// once it holds its maximum, the least recently used. It is safe for
+// concurrent use.
+type Store struct {
+	mu          sync.Mutex
+	sessions    map[string]*entry
+	ttl         time.Duration
+	maxSessions int
+}
+
+// New creates a store; zero values pick DefaultTTL and
+// DefaultMaxSessions
+func New(ttl time.Duration, maxSessions int) *Store {
+	if ttl <= 0 {
+		ttl = DefaultTTL
+	}
+	if maxSessions <= 0 {
+		maxSessions = DefaultMaxSessions
+	}
+	return &Store{sessions: map[string]*entry{}, ttl: ttl, maxSessions: maxSessions}
+}
+
+// Session returns the session named id, starting one if there is none,
+// and when it expires unless it's used again
+func (s *Store) Session(id string) (*sandbox.Session, time.Time) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	now := time.Now()
+	e, ok := s.sessions[id]
+	if !ok || now.Sub(e.used) > s.ttl {
+		s.evict(now)
+		e = &entry{session: sandbox.NewSession()}
+		s.sessions[id] = e
+	}
+	e.used = now
+	return e.session, now.Add(s.ttl).UTC()
+}
+
+// Delete drops the session named id, reporting whether there was one
+func (s *Store) Delete(id string) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	e, ok := s.sessions[id]
+	delete(s.sessions, id)
+	return ok && time.Since(e.used) <= s.ttl
+}
+
+// evict drops expired sessions, then the least recently used until
+// there's room for one more
+func (s *Store) evict(now time.Time) {
+	for id, e := range s.sessions {
+		if now.Sub(e.used) > s.ttl {
+			delete(s.sessions, id)
+		}
+	}
+	for len(s.sessions) >= s.maxSessions {
+		var oldest string
+		for id, e := range s.sessions {
+			if oldest == "" || e.used.Before(s.sessions[oldest].used) {
+				oldest = id
+			}
+		}
+		delete(s.sessions, oldest)
+	}
+}
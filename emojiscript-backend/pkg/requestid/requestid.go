@@ -0,0 +1,175 @@
+// Package requestid gives every request an ID, echoed in the X-Request-ID
+// response header and as the traceId of a JSON response, and prefixed to
+// the log lines written while serving it, so a failure a client reports
+// can be found in the logs. A request without an ID that is part of an
+// OpenTelemetry trace, sent with a traceparent header, takes the trace's
+// ID, so the logs and the trace can be matched too.
+package requestid
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"strings"
+)
+
+const (
+	// Header carries the ID on requests and responses
+	Header = "X-Request-ID"
+	// TraceParent is the W3C Trace Context header an OpenTelemetry client
+	// sends the trace a request is part of in
+	TraceParent = "traceparent"
+	// Field is the member of a JSON response object that carries the ID
+	Field = "traceId"
+	// MaxLength bounds an ID a client or proxy sends
+	MaxLength = 128
+)
+
+type contextKey struct{}
+
+// New returns a random ID, shaped like a W3C trace ID: 32 lowercase hex
+// digits
+func New() string {
+	b := make([]byte, 16)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+// Valid reports whether an ID sent with a request can be kept: 1 to
+// MaxLength letters, digits, '-', '_' or '.', so it can't forge a log line
+func Valid(id string) bool {
+	if id == "" || len(id) > MaxLength {
+		return false
+	}
+	for _, c := range id {
+		switch {
+		case c >= 'a' && c <= 'z', c >= 'A' && c <= 'Z', c >= '0' && c <= '9', c == '-', c == '_', c == '.':
+		default:
+			return false
+		}
+	}
+	return true
+}
+
+// FromRequest returns the ID a request was sent with, when it is valid,
+// then the ID of the trace its traceparent names, or else a new one
+func FromRequest(r *http.Request) string {
+	return FromHeader(r.Header.Get)
+}
+
+// FromHeader is FromRequest for a server whose request headers are read
+// with get
+func FromHeader(get func(string) string) string {
+	if id := get(Header); Valid(id) {
+		return id
+	}
+	if id, ok := traceID(get(TraceParent)); ok {
+		return id
+	}
+	return New()
+}
+
+// traceID returns the trace ID of a traceparent header,
+// version-traceid-parentid-flags, e.g.
+// 00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01
+func traceID(traceparent string) (string, bool) {
+	fields := strings.Split(strings.TrimSpace(traceparent), "-")
+	if len(fields) < 4 || len(fields[0]) != 2 || len(fields[1]) != 32 || len(fields[2]) != 16 {
+		return "", false
+	}
+	id := fields[1]
+	if _, err := hex.DecodeString(id); err != nil || strings.ToLower(id) != id || id == strings.Repeat("0", 32) {
+		return "", false
+	}
+	return id, true
+}
+
+// AddTraceID returns body with id as its first member, traceId, when it is
+// a JSON object that doesn't already start with one; any other body is
+// returned as it is
+func AddTraceID(body []byte, id string) []byte {
+	if !bytes.HasPrefix(body, []byte("{")) || bytes.HasPrefix(body, []byte(`{"`+Field+`":`)) || !Valid(id) {
+		return body
+	}
+	// a valid id needs no escaping
+	member := `{"` + Field + `":"` + id + `"`
+	rest := body[1:]
+	if !bytes.HasPrefix(bytes.TrimLeft(rest, " \t\r\n"), []byte("}")) {
+		member += ","
+	}
+	return append([]byte(member), rest...)
+}
+
+// WithID returns a context carrying id
+func WithID(ctx context.Context, id string) context.Context {
+	return context.WithValue(ctx, contextKey{}, id)
+}
+
+// FromContext returns the ID in ctx, or "" when there is none
+func FromContext(ctx context.Context) string {
+	id, _ := ctx.Value(contextKey{}).(string)
+	return id
+}
+
+// Printf logs like log.Printf, prefixed with the ID in ctx when there is
+// one
+func Printf(ctx context.Context, format string, args ...interface{}) {
+	message := fmt.Sprintf(format, args...)
+	if id := FromContext(ctx); id != "" {
+		message = "[" + id + "] " + message
+	}
+	log.Print(message)
+}
+
+// Middleware gives each request an ID, keeping a valid one it was sent
+// with. The ID is set on the response, as its header and the traceId of a
+// JSON object body, and on the request's context, and the request header
+// is set to it so handlers further down see the same ID.
+func Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id := FromRequest(r)
+		r.Header.Set(Header, id)
+		w.Header().Set(Header, id)
+		next.ServeHTTP(&tracedWriter{ResponseWriter: w, id: id}, r.WithContext(WithID(r.Context(), id)))
+	})
+}
+
+// tracedWriter adds the traceId to a JSON response. Handlers write a JSON
+// body in one call, so only the first write is looked at, leaving a
+// streamed response to stream.
+type tracedWriter struct {
+	http.ResponseWriter
+	id    string
+	wrote bool
+}
+
+func (t *tracedWriter) Write(b []byte) (int, error) {
+	if t.wrote || !strings.HasPrefix(t.Header().Get("Content-Type"), "application/json") {
+		t.wrote = true
+		return t.ResponseWriter.Write(b)
+	}
+	t.wrote = true
+	if _, err := t.ResponseWriter.Write(AddTraceID(b, t.id)); err != nil {
+		return 0, err
+	}
+	return len(b), nil
+}
+
+func (t *tracedWriter) Flush() {
+	http.NewResponseController(t.ResponseWriter).Flush()
+}
+
+func (t *tracedWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	return http.NewResponseController(t.ResponseWriter).Hijack()
+}
+
+// Unwrap lets http.ResponseController reach the underlying writer
+func (t *tracedWriter) Unwrap() http.ResponseWriter {
+	return t.ResponseWriter
+}
@@ -0,0 +1,256 @@
+package sandbox
+
+// The AST covers the JavaScript subset the transpiler emits. Statements
+// carry their source line so the interpreter can report steps.
+
+type stmt interface{ line() int }
+
+type expr interface{}
+
+type at struct{ ln int }
+
+func (a at) line() int { return a.ln }
+
+type declarator struct {
+	target expr // *ident or a destructuring pattern
+	init   expr
+}
+
+type varDecl struct {
+	at
+	kind  string
+	decls []declarator
+}
+
+type funcDecl struct {
+	at
+	fn *funcLit
+}
+
+type classDecl struct {
+	at
+	cls *classLit
+}
+
+type exprStmt struct {
+	at
+	x expr
+}
+
+type ifStmt struct {
+	at
+	test      expr
+	cons, alt stmt
+}
+
+type forStmt struct {
+	at
+	init   stmt
+	test   expr
+	update expr
+	body   stmt
+}
+
+type forInOf struct {
+	at
+	of       bool
+	declKind string
+	target   expr
+	iter     expr
+	body     stmt
+}
+
+type whileStmt struct {
+	at
+	test expr
+	body stmt
+	do   bool
+}
+
+type blockStmt struct {
+	at
+	body []stmt
+}
+
+type returnStmt struct {
+	at
+	x expr
+}
+
+type breakStmt struct {
+	at
+	label string
+}
+
+type continueStmt struct {
+	at
+	label string
+}
+
+type throwStmt struct {
+	at
+	x expr
+}
+
+type tryStmt struct {
+	at
+	block     *blockStmt
+	param     expr
+	handler   *blockStmt
+	finalizer *blockStmt
+}
+
+type switchCase struct {
+	test expr // nil for default
+	body []stmt
+}
+
+type switchStmt struct {
+	at
+	disc  expr
+	cases []switchCase
+}
+
+type labeledStmt struct {
+	at
+	label string
+	body  stmt
+}
+
+type emptyStmt struct{ at }
+
+// expressions
+
+type numLit struct{ v float64 }
+type strLit struct{ v string }
+type boolLit struct{ v bool }
+type nullLit struct{}
+type thisExpr struct{}
+type superExpr struct{}
+
+type ident struct {
+	name string
+	ln   int
+	col  int
+	// shorthand marks a name written once for both key and value, as in {x}
+	shorthand bool
+}
+
+type tmplLit struct {
+	parts []string
+	exprs []expr
+}
+
+type arrayLit struct{ elems []expr }
+
+type objProp struct {
+	kind     string // "init", "get", "set" or "spread"
+	method   bool
+	key      string
+	computed expr
+	value    expr
+}
+
+type objectLit struct{ props []objProp }
+
+type param struct {
+	target expr
+	def    expr
+	rest   bool
+}
+
+type funcLit struct {
+	name     string
+	params   []param
+	body     []stmt
+	exprBody expr
+	arrow    bool
+	async    bool
+	ln       int
+	nameAt   position // where a declared or named function's name is
+}
+
+type classMember struct {
+	name     string
+	computed expr
+	static   bool
+	kind     string // "method", "get", "set" or "field"
+	fn       *funcLit
+	value    expr
+}
+
+type classLit struct {
+	name    string
+	nameAt  position
+	super   expr
+	ctor    *funcLit
+	members []classMember
+}
+
+type unaryExpr struct {
+	op string
+	x  expr
+}
+
+type updateExpr struct {
+	op     string
+	prefix bool
+	x      expr
+}
+
+type binaryExpr struct {
+	op   string
+	l, r expr
+}
+
+type logicalExpr struct {
+	op   string
+	l, r expr
+}
+
+type condExpr struct{ test, cons, alt expr }
+
+type assignExpr struct {
+	op     string
+	target expr
+	value  expr
+}
+
+type callExpr struct {
+	callee   expr
+	args     []expr
+	optional bool
+}
+
+type newExpr struct {
+	callee expr
+	args   []expr
+}
+
+type memberExpr struct {
+	obj      expr
+	prop     string
+	computed expr
+	optional bool
+}
+
+type spreadExpr struct{ x expr }
+type seqExpr struct{ list []expr }
+type awaitExpr struct{ x expr }
+
+type patternElem struct {
+	key      string // object patterns
+	computed expr
+	target   expr
+	def      expr
+}
+
+type arrayPattern struct {
+	elems []*patternElem // nil entries are holes
+	rest  expr
+}
+
+type objectPattern struct {
+	props []patternElem
+	rest  expr
+}
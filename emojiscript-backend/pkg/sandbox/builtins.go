@@ -0,0 +1,1736 @@
+package sandbox
+
+import (
+	"bytes"
+	"encoding/json"
+	"math"
+	"math/rand"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+)
+
+type nativeFunc = func(in *interp, this Value, args []Value) (Value, error)
+
+func arg(args []Value, i int) Value {
+	if i < len(args) {
+		return args[i]
+	}
+	return undefined
+}
+
+func native(name string, fn nativeFunc) *function {
+	return &function{name: name, native: fn}
+}
+
+func def(o *object, name string, fn nativeFunc) {
+	o.set(name, native(name, fn))
+}
+
+// setupBuiltins creates the prototypes and global bindings a program sees
+func (in *interp) setupBuiltins() {
+	in.objectProto = newObject(nil)
+	in.functionProto = newObject(in.objectProto)
+	in.arrayProto = newObject(in.objectProto)
+	in.stringProto = newObject(in.objectProto)
+	in.numberProto = newObject(in.objectProto)
+	in.booleanProto = newObject(in.objectProto)
+	in.builtins = newEnv(nil, nil)
+	in.global = newEnv(in.builtins, nil)
+
+	global := func(name string, v Value) {
+		in.declare(in.builtins, name, "builtin", v)
+	}
+	global("undefined", undefined)
+	global("NaN", math.NaN())
+	global("Infinity", math.Inf(1))
+
+	in.setupObject(global)
+	in.setupFunction()
+	in.setupErrors(global)
+	in.setupArray(global)
+	in.setupString(global)
+	in.setupNumber(global)
+	in.setupCollections(global)
+	in.setupDate(global)
+
+	console := newObject(in.objectProto)
+	for _, name := range []string{"log", "info", "warn", "error", "debug"} {
+		def(console, name, func(in *interp, this Value, args []Value) (Value, error) {
+			return undefined, in.print(args)
+		})
+	}
+	global("console", console)
+
+	mathObj := newObject(in.objectProto)
+	mathObj.set("PI", math.Pi)
+	mathObj.set("E", math.E)
+	unary := map[string]func(float64) float64{
+		"abs": math.Abs, "floor": math.Floor, "ceil": math.Ceil, "trunc": math.Trunc,
+		"sqrt": math.Sqrt, "cbrt": math.Cbrt, "log": math.Log, "log2": math.Log2,
+		"log10": math.Log10, "exp": math.Exp, "sin": math.Sin, "cos": math.Cos,
+		"tan": math.Tan, "asin": math.Asin, "acos": math.Acos, "atan": math.Atan,
+		"round": func(x float64) float64 { return math.Floor(x + 0.5) },
+		"sign": func(x float64) float64 {
+			switch {
+			case x > 0:
+				return 1
+			case x < 0:
+				return -1
+			}
+			return x
+		},
+	}
+	names := make([]string, 0, len(unary))
+	for name := range unary {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		f := unary[name]
+		def(mathObj, name, func(in *interp, this Value, args []Value) (Value, error) {
+			n, err := in.toNumber(arg(args, 0))
+			return f(n), err
+		})
+	}
+	def(mathObj, "pow", func(in *interp, this Value, args []Value) (Value, error) {
+		a, _ := in.toNumber(arg(args, 0))
+		b, _ := in.toNumber(arg(args, 1))
+		return math.Pow(a, b), nil
+	})
+	def(mathObj, "atan2", func(in *interp, this Value, args []Value) (Value, error) {
+		a, _ := in.toNumber(arg(args, 0))
+		b, _ := in.toNumber(arg(args, 1))
+		return math.Atan2(a, b), nil
+	})
+	minMax := func(min bool) nativeFunc {
+		return func(in *interp, this Value, args []Value) (Value, error) {
+			result := math.Inf(1)
+			if !min {
+				result = math.Inf(-1)
+			}
+			for _, a := range args {
+				n, err := in.toNumber(a)
+				if err != nil {
+					return nil, err
+				}
+				if math.IsNaN(n) {
+					return math.NaN(), nil
+				}
+				if min && n < result || !min && n > result {
+					result = n
+				}
+			}
+			return result, nil
+		}
+	}
+	def(mathObj, "min", minMax(true))
+	def(mathObj, "max", minMax(false))
+	def(mathObj, "hypot", func(in *interp, this Value, args []Value) (Value, error) {
+		sum := 0.0
+		for _, a := range args {
+			n, _ := in.toNumber(a)
+			sum += n * n
+		}
+		return math.Sqrt(sum), nil
+	})
+	def(mathObj, "random", func(in *interp, this Value, args []Value) (Value, error) {
+		return rand.Float64(), nil
+	})
+	global("Math", mathObj)
+
+	jsonObj := newObject(in.objectProto)
+	def(jsonObj, "stringify", func(in *interp, this Value, args []Value) (Value, error) {
+		indent := ""
+		switch space := arg(args, 2).(type) {
+		case float64:
+			indent = strings.Repeat(" ", int(math.Min(10, math.Max(0, space))))
+		case string:
+			indent = space
+		}
+		var b strings.Builder
+		ok, err := in.jsonWrite(&b, arg(args, 0), indent, "", map[interface{}]bool{})
+		if err != nil || !ok {
+			return undefined, err
+		}
+		return b.String(), nil
+	})
+	def(jsonObj, "parse", func(in *interp, this Value, args []Value) (Value, error) {
+		text, err := in.toString(arg(args, 0))
+		if err != nil {
+			return nil, err
+		}
+		dec := json.NewDecoder(strings.NewReader(text))
+		dec.UseNumber()
+		v, err := in.jsonRead(dec)
+		if err == nil && dec.More() {
+			err = errJSON
+		}
+		if err != nil {
+			return nil, in.throwError("SyntaxError", "Unexpected token in JSON")
+		}
+		return v, nil
+	})
+	global("JSON", jsonObj)
+
+	global("parseInt", native("parseInt", func(in *interp, this Value, args []Value) (Value, error) {
+		s, err := in.toString(arg(args, 0))
+		if err != nil {
+			return nil, err
+		}
+		radix := 10
+		if r, ok := arg(args, 1).(float64); ok && r >= 2 && r <= 36 {
+			radix = int(r)
+		}
+		return parseIntPrefix(s, radix), nil
+	}))
+	global("parseFloat", native("parseFloat", func(in *interp, this Value, args []Value) (Value, error) {
+		s, err := in.toString(arg(args, 0))
+		if err != nil {
+			return nil, err
+		}
+		return parseFloatPrefix(s), nil
+	}))
+	global("isNaN", native("isNaN", func(in *interp, this Value, args []Value) (Value, error) {
+		n, err := in.toNumber(arg(args, 0))
+		return math.IsNaN(n), err
+	}))
+	global("isFinite", native("isFinite", func(in *interp, this Value, args []Value) (Value, error) {
+		n, err := in.toNumber(arg(args, 0))
+		return !math.IsNaN(n) && !math.IsInf(n, 0), err
+	}))
+	global("Boolean", native("Boolean", func(in *interp, this Value, args []Value) (Value, error) {
+		return truthy(arg(args, 0)), nil
+	}))
+
+	global("prompt", native("prompt", func(in *interp, this Value, args []Value) (Value, error) {
+		if len(in.stdin) == 0 {
+			return null, nil
+		}
+		line := strings.TrimSuffix(in.stdin[0], "\r")
+		in.stdin = in.stdin[1:]
+		return line, nil
+	}))
+	global("setTimeout", native("setTimeout", func(in *interp, this Value, args []Value) (Value, error) {
+		fn, ok := arg(args, 0).(*function)
+		if !ok {
+			return nil, in.throwError("TypeError", "The \"callback\" argument must be of type function")
+		}
+		delay, _ := in.toNumber(arg(args, 1))
+		if math.IsNaN(delay) {
+			delay = 0
+		}
+		in.timerSeq++
+		rest := []Value{}
+		if len(args) > 2 {
+			rest = args[2:]
+		}
+		in.timers = append(in.timers, timer{id: in.timerSeq, delay: in.clock + delay, fn: fn, args: rest})
+		return float64(in.timerSeq), nil
+	}))
+	global("clearTimeout", native("clearTimeout", func(in *interp, this Value, args []Value) (Value, error) {
+		id, _ := arg(args, 0).(float64)
+		for i, t := range in.timers {
+			if float64(t.id) == id {
+				in.timers = append(in.timers[:i], in.timers[i+1:]...)
+				break
+			}
+		}
+		return undefined, nil
+	}))
+	for _, name := range []string{"setInterval", "fetch", "require", "eval"} {
+		name := name
+		global(name, native(name, func(in *interp, this Value, args []Value) (Value, error) {
+			return nil, in.throwError("Error", "%s is not available in the sandbox", name)
+		}))
+	}
+}
+
+// print records one console call
+func (in *interp) print(args []Value) error {
+	parts := make([]string, len(args))
+	for i, a := range args {
+		parts[i] = inspect(a, 0, map[interface{}]bool{})
+	}
+	line := strings.Join(parts, " ")
+	in.outBytes += len(line) + 1
+	if in.outBytes > in.opts.MaxOutput {
+		return in.limit("output", "Execution stopped: output limit exceeded (%d bytes)", in.opts.MaxOutput)
+	}
+	in.stdout = append(in.stdout, line)
+	return nil
+}
+
+func (in *interp) setupObject(global func(string, Value)) {
+	def(in.objectProto, "hasOwnProperty", func(in *interp, this Value, args []Value) (Value, error) {
+		key := in.propertyKey(arg(args, 0))
+		switch o := this.(type) {
+		case *object:
+			_, ok := o.props[key]
+			return ok, nil
+		case *array:
+			i, ok := arrayIndex(key)
+			return ok && i < len(o.elems), nil
+		case *function:
+			if o.statics == nil {
+				return false, nil
+			}
+			_, ok := o.statics.props[key]
+			return ok, nil
+		}
+		return false, nil
+	})
+	def(in.objectProto, "toString", func(in *interp, this Value, args []Value) (Value, error) {
+		return toDisplayString(this), nil
+	})
+
+	objectCtor := native("Object", func(in *interp, this Value, args []Value) (Value, error) {
+		if v := arg(args, 0); !isNullish(v) {
+			return v, nil
+		}
+		return newObject(in.objectProto), nil
+	})
+	objectCtor.ctor = true
+	objectCtor.proto = in.objectProto
+	in.objectProto.set("constructor", objectCtor)
+	statics := in.staticsOf(objectCtor)
+
+	listing := func(name string, entry func(k string, v Value) Value) {
+		def(statics, name, func(in *interp, this Value, args []Value) (Value, error) {
+			target := arg(args, 0)
+			if isNullish(target) {
+				return nil, in.throwError("TypeError", "Cannot convert undefined or null to object")
+			}
+			items := []Value{}
+			for _, k := range in.enumerableKeys(target) {
+				v, err := in.getMember(target, k)
+				if err != nil {
+					return nil, err
+				}
+				items = append(items, entry(k, v))
+			}
+			return &array{elems: items}, nil
+		})
+	}
+	listing("keys", func(k string, v Value) Value { return k })
+	listing("values", func(k string, v Value) Value { return v })
+	listing("entries", func(k string, v Value) Value { return &array{elems: []Value{k, v}} })
+
+	def(statics, "assign", func(in *interp, this Value, args []Value) (Value, error) {
+		target := arg(args, 0)
+		for _, source := range args[1:] {
+			for _, k := range in.enumerableKeys(source) {
+				v, err := in.getMember(source, k)
+				if err != nil {
+					return nil, err
+				}
+				if err := in.setMember(target, k, v); err != nil {
+					return nil, err
+				}
+			}
+		}
+		return target, nil
+	})
+	def(statics, "fromEntries", func(in *interp, this Value, args []Value) (Value, error) {
+		items, err := in.iterate(arg(args, 0))
+		if err != nil {
+			return nil, err
+		}
+		obj := newObject(in.objectProto)
+		for _, item := range items {
+			k, _ := in.getMember(item, "0")
+			v, _ := in.getMember(item, "1")
+			obj.set(in.propertyKey(k), v)
+		}
+		return obj, nil
+	})
+	def(statics, "freeze", func(in *interp, this Value, args []Value) (Value, error) {
+		if o, ok := arg(args, 0).(*object); ok {
+			o.frozen = true
+		}
+		return arg(args, 0), nil
+	})
+	def(statics, "isFrozen", func(in *interp, this Value, args []Value) (Value, error) {
+		o, ok := arg(args, 0).(*object)
+		return !ok || o.frozen, nil
+	})
+	def(statics, "create", func(in *interp, this Value, args []Value) (Value, error) {
+		proto, _ := arg(args, 0).(*object)
+		return newObject(proto), nil
+	})
+	// defineProperty defines a value or a getter and setter; the
+	// sandbox's properties are all writable, enumerable and configurable
+	def(statics, "defineProperty", func(in *interp, this Value, args []Value) (Value, error) {
+		var target *object
+		switch o := arg(args, 0).(type) {
+		case *object:
+			target = o
+		case *function:
+			target = in.staticsOf(o)
+		default:
+			return nil, in.throwError("TypeError", "Object.defineProperty called on non-object")
+		}
+		key := in.propertyKey(arg(args, 1))
+		descriptor, ok := arg(args, 2).(*object)
+		if !ok {
+			return nil, in.throwError("TypeError", "Property description must be an object")
+		}
+		if get, ok := descriptor.props["get"].(*function); ok {
+			if target.getters == nil {
+				target.getters = map[string]*function{}
+			}
+			target.getters[key] = get
+		}
+		if set, ok := descriptor.props["set"].(*function); ok {
+			if target.setters == nil {
+				target.setters = map[string]*function{}
+			}
+			target.setters[key] = set
+		}
+		if v, ok := descriptor.props["value"]; ok {
+			target.set(key, v)
+		}
+		return arg(args, 0), nil
+	})
+	def(statics, "getPrototypeOf", func(in *interp, this Value, args []Value) (Value, error) {
+		if o, ok := arg(args, 0).(*object); ok && o.proto != nil {
+			return o.proto, nil
+		}
+		return null, nil
+	})
+	global("Object", objectCtor)
+}
+
+func (in *interp) setupFunction() {
+	def(in.functionProto, "call", func(in *interp, this Value, args []Value) (Value, error) {
+		rest := []Value{}
+		if len(args) > 1 {
+			rest = args[1:]
+		}
+		return in.call(this, arg(args, 0), rest)
+	})
+	def(in.functionProto, "apply", func(in *interp, this Value, args []Value) (Value, error) {
+		rest := []Value{}
+		if list, ok := arg(args, 1).(*array); ok {
+			rest = list.elems
+		}
+		return in.call(this, arg(args, 0), rest)
+	})
+	def(in.functionProto, "bind", func(in *interp, this Value, args []Value) (Value, error) {
+		target, ok := this.(*function)
+		if !ok {
+			return nil, in.throwError("TypeError", "Bind must be called on a function")
+		}
+		boundThis := arg(args, 0)
+		bound := []Value{}
+		if len(args) > 1 {
+			bound = append(bound, args[1:]...)
+		}
+		return native("bound "+target.name, func(in *interp, _ Value, args []Value) (Value, error) {
+			return in.call(target, boundThis, append(append([]Value{}, bound...), args...))
+		}), nil
+	})
+	def(in.functionProto, "toString", func(in *interp, this Value, args []Value) (Value, error) {
+		return toDisplayString(this), nil
+	})
+}
+
+func (in *interp) setupErrors(global func(string, Value)) {
+	in.errorProtos = map[string]*object{}
+	var base *object
+	for _, name := range []string{"Error", "TypeError", "RangeError", "ReferenceError", "SyntaxError"} {
+		proto := newObject(in.objectProto)
+		if base == nil {
+			base = proto
+			proto.internal = errorProtoMarker
+			def(proto, "toString", func(in *interp, this Value, args []Value) (Value, error) {
+				if o, ok := this.(*object); ok {
+					return errorString(o), nil
+				}
+				return "Error", nil
+			})
+		} else {
+			proto.proto = base
+		}
+		proto.set("name", name)
+		proto.set("message", "")
+		in.errorProtos[name] = proto
+
+		ctor := native(name, func(in *interp, this Value, args []Value) (Value, error) {
+			o, ok := this.(*object)
+			if !ok || !isError(o) {
+				o = newObject(proto)
+			}
+			if msg := arg(args, 0); !isNullish(msg) {
+				s, err := in.toString(msg)
+				if err != nil {
+					return nil, err
+				}
+				o.set("message", s)
+			}
+			return o, nil
+		})
+		ctor.ctor = true
+		ctor.proto = proto
+		proto.set("constructor", ctor)
+		global(name, ctor)
+	}
+}
+
+func thisArray(in *interp, this Value, method string) (*array, error) {
+	a, ok := this.(*array)
+	if !ok {
+		return nil, in.throwError("TypeError", "Array.prototype.%s called on non-array", method)
+	}
+	return a, nil
+}
+
+func (in *interp) callback(args []Value, method string) (*function, Value, error) {
+	fn, ok := arg(args, 0).(*function)
+	if !ok {
+		return nil, nil, in.throwError("TypeError", "%s is not a function", inspect(arg(args, 0), 1, map[interface{}]bool{}))
+	}
+	return fn, arg(args, 1), nil
+}
+
+// relativeIndex resolves slice-style indexes, where negatives count from
+// the end
+func relativeIndex(in *interp, v Value, length, fallback int) int {
+	if _, ok := v.(undefinedType); ok {
+		return fallback
+	}
+	n, _ := in.toNumber(v)
+	if math.IsNaN(n) {
+		return 0
+	}
+	i := int(math.Max(math.Min(math.Trunc(n), float64(length)), -float64(length)-1))
+	if i < 0 {
+		i += length
+		if i < 0 {
+			i = 0
+		}
+	}
+	return i
+}
+
+func (in *interp) setupArray(global func(string, Value)) {
+	p := in.arrayProto
+	iterating := func(name string, body func(in *interp, a *array, fn *function, thisArg Value) (Value, error)) {
+		def(p, name, func(in *interp, this Value, args []Value) (Value, error) {
+			a, err := thisArray(in, this, name)
+			if err != nil {
+				return nil, err
+			}
+			fn, thisArg, err := in.callback(args, name)
+			if err != nil {
+				return nil, err
+			}
+			return body(in, a, fn, thisArg)
+		})
+	}
+	each := func(in *interp, a *array, fn *function, thisArg Value, visit func(i int, v, result Value) bool) error {
+		for i := 0; i < len(a.elems); i++ {
+			v := a.elems[i]
+			result, err := in.call(fn, thisArg, []Value{v, float64(i), a})
+			if err != nil {
+				return err
+			}
+			if !visit(i, v, result) {
+				return nil
+			}
+		}
+		return nil
+	}
+
+	def(p, "push", func(in *interp, this Value, args []Value) (Value, error) {
+		a, err := thisArray(in, this, "push")
+		if err != nil {
+			return nil, err
+		}
+		if len(a.elems)+len(args) > maxArrayLength {
+			return nil, in.throwError("RangeError", "Invalid array length")
+		}
+		a.elems = append(a.elems, args...)
+		return float64(len(a.elems)), in.allocate(elementSize * len(args))
+	})
+	def(p, "pop", func(in *interp, this Value, args []Value) (Value, error) {
+		a, err := thisArray(in, this, "pop")
+		if err != nil || len(a.elems) == 0 {
+			return undefined, err
+		}
+		v := a.elems[len(a.elems)-1]
+		a.elems = a.elems[:len(a.elems)-1]
+		return v, nil
+	})
+	def(p, "shift", func(in *interp, this Value, args []Value) (Value, error) {
+		a, err := thisArray(in, this, "shift")
+		if err != nil || len(a.elems) == 0 {
+			return undefined, err
+		}
+		v := a.elems[0]
+		a.elems = append([]Value{}, a.elems[1:]...)
+		return v, nil
+	})
+	def(p, "unshift", func(in *interp, this Value, args []Value) (Value, error) {
+		a, err := thisArray(in, this, "unshift")
+		if err != nil {
+			return nil, err
+		}
+		a.elems = append(append([]Value{}, args...), a.elems...)
+		return float64(len(a.elems)), nil
+	})
+	def(p, "slice", func(in *interp, this Value, args []Value) (Value, error) {
+		a, err := thisArray(in, this, "slice")
+		if err != nil {
+			return nil, err
+		}
+		start := relativeIndex(in, arg(args, 0), len(a.elems), 0)
+		end := relativeIndex(in, arg(args, 1), len(a.elems), len(a.elems))
+		if end < start {
+			end = start
+		}
+		return &array{elems: append([]Value{}, a.elems[start:end]...)}, nil
+	})
+	def(p, "splice", func(in *interp, this Value, args []Value) (Value, error) {
+		a, err := thisArray(in, this, "splice")
+		if err != nil {
+			return nil, err
+		}
+		start := relativeIndex(in, arg(args, 0), len(a.elems), 0)
+		count := len(a.elems) - start
+		if len(args) > 1 {
+			n, _ := in.toNumber(args[1])
+			count = int(math.Max(0, math.Min(float64(count), math.Trunc(n))))
+		}
+		removed := append([]Value{}, a.elems[start:start+count]...)
+		insert := []Value{}
+		if len(args) > 2 {
+			insert = args[2:]
+		}
+		rest := append(append([]Value{}, insert...), a.elems[start+count:]...)
+		a.elems = append(a.elems[:start], rest...)
+		return &array{elems: removed}, nil
+	})
+	def(p, "concat", func(in *interp, this Value, args []Value) (Value, error) {
+		a, err := thisArray(in, this, "concat")
+		if err != nil {
+			return nil, err
+		}
+		elems := append([]Value{}, a.elems...)
+		for _, v := range args {
+			if other, ok := v.(*array); ok {
+				elems = append(elems, other.elems...)
+			} else {
+				elems = append(elems, v)
+			}
+		}
+		if len(elems) > maxArrayLength {
+			return nil, in.throwError("RangeError", "Invalid array length")
+		}
+		return &array{elems: elems}, in.allocate(elementSize * len(elems))
+	})
+	def(p, "join", func(in *interp, this Value, args []Value) (Value, error) {
+		a, err := thisArray(in, this, "join")
+		if err != nil {
+			return nil, err
+		}
+		sep := ","
+		if s, ok := arg(args, 0).(string); ok {
+			sep = s
+		}
+		parts := make([]string, len(a.elems))
+		for i, v := range a.elems {
+			if !isNullish(v) {
+				if parts[i], err = in.toString(v); err != nil {
+					return nil, err
+				}
+			}
+		}
+		joined := strings.Join(parts, sep)
+		if len(joined) > maxStringLength {
+			return nil, in.throwError("RangeError", "Invalid string length")
+		}
+		return joined, in.allocate(len(joined))
+	})
+	def(p, "toString", func(in *interp, this Value, args []Value) (Value, error) {
+		return in.toString(this)
+	})
+	def(p, "reverse", func(in *interp, this Value, args []Value) (Value, error) {
+		a, err := thisArray(in, this, "reverse")
+		if err != nil {
+			return nil, err
+		}
+		for i, j := 0, len(a.elems)-1; i < j; i, j = i+1, j-1 {
+			a.elems[i], a.elems[j] = a.elems[j], a.elems[i]
+		}
+		return a, nil
+	})
+	search := func(name string, strict, fromEnd bool, result func(i int) Value) {
+		def(p, name, func(in *interp, this Value, args []Value) (Value, error) {
+			a, err := thisArray(in, this, name)
+			if err != nil {
+				return nil, err
+			}
+			target := arg(args, 0)
+			for k := range a.elems {
+				i := k
+				if fromEnd {
+					i = len(a.elems) - 1 - k
+				}
+				if strict && strictEquals(a.elems[i], target) || !strict && sameValueZero(a.elems[i], target) {
+					return result(i), nil
+				}
+			}
+			return result(-1), nil
+		})
+	}
+	search("indexOf", true, false, func(i int) Value { return float64(i) })
+	search("lastIndexOf", true, true, func(i int) Value { return float64(i) })
+	search("includes", false, false, func(i int) Value { return i >= 0 })
+	def(p, "at", func(in *interp, this Value, args []Value) (Value, error) {
+		a, err := thisArray(in, this, "at")
+		if err != nil {
+			return nil, err
+		}
+		n, _ := in.toNumber(arg(args, 0))
+		i := int(math.Trunc(n))
+		if i < 0 {
+			i += len(a.elems)
+		}
+		if i < 0 || i >= len(a.elems) {
+			return undefined, nil
+		}
+		return a.elems[i], nil
+	})
+	def(p, "fill", func(in *interp, this Value, args []Value) (Value, error) {
+		a, err := thisArray(in, this, "fill")
+		if err != nil {
+			return nil, err
+		}
+		start := relativeIndex(in, arg(args, 1), len(a.elems), 0)
+		end := relativeIndex(in, arg(args, 2), len(a.elems), len(a.elems))
+		for i := start; i < end; i++ {
+			a.elems[i] = arg(args, 0)
+		}
+		return a, nil
+	})
+	def(p, "flat", func(in *interp, this Value, args []Value) (Value, error) {
+		a, err := thisArray(in, this, "flat")
+		if err != nil {
+			return nil, err
+		}
+		depth := 1.0
+		if d, ok := arg(args, 0).(float64); ok {
+			depth = d
+		}
+		return &array{elems: flatten(a.elems, depth)}, nil
+	})
+
+	iterating("forEach", func(in *interp, a *array, fn *function, thisArg Value) (Value, error) {
+		return undefined, each(in, a, fn, thisArg, func(int, Value, Value) bool { return true })
+	})
+	iterating("map", func(in *interp, a *array, fn *function, thisArg Value) (Value, error) {
+		out := make([]Value, 0, len(a.elems))
+		err := each(in, a, fn, thisArg, func(i int, v, result Value) bool {
+			out = append(out, result)
+			return true
+		})
+		return &array{elems: out}, err
+	})
+	iterating("filter", func(in *interp, a *array, fn *function, thisArg Value) (Value, error) {
+		out := []Value{}
+		err := each(in, a, fn, thisArg, func(i int, v, result Value) bool {
+			if truthy(result) {
+				out = append(out, v)
+			}
+			return true
+		})
+		return &array{elems: out}, err
+	})
+	iterating("flatMap", func(in *interp, a *array, fn *function, thisArg Value) (Value, error) {
+		out := []Value{}
+		err := each(in, a, fn, thisArg, func(i int, v, result Value) bool {
+			out = append(out, flatten([]Value{result}, 1)...)
+			return true
+		})
+		return &array{elems: out}, err
+	})
+	finder := func(name string, found func(i int, v Value) Value, missing Value) {
+		iterating(name, func(in *interp, a *array, fn *function, thisArg Value) (Value, error) {
+			var result Value = missing
+			err := each(in, a, fn, thisArg, func(i int, v, r Value) bool {
+				if truthy(r) {
+					result = found(i, v)
+					return false
+				}
+				return true
+			})
+			return result, err
+		})
+	}
+	finder("find", func(i int, v Value) Value { return v }, undefined)
+	finder("findIndex", func(i int, v Value) Value { return float64(i) }, -1.0)
+	finder("some", func(i int, v Value) Value { return true }, false)
+	iterating("every", func(in *interp, a *array, fn *function, thisArg Value) (Value, error) {
+		result := true
+		err := each(in, a, fn, thisArg, func(i int, v, r Value) bool {
+			result = truthy(r)
+			return result
+		})
+		return result, err
+	})
+	for _, name := range []string{"reduce", "reduceRight"} {
+		right := name == "reduceRight"
+		name := name
+		def(p, name, func(in *interp, this Value, args []Value) (Value, error) {
+			a, err := thisArray(in, this, name)
+			if err != nil {
+				return nil, err
+			}
+			fn, _, err := in.callback(args, name)
+			if err != nil {
+				return nil, err
+			}
+			order := make([]int, len(a.elems))
+			for i := range order {
+				order[i] = i
+				if right {
+					order[i] = len(a.elems) - 1 - i
+				}
+			}
+			var acc Value
+			if len(args) > 1 {
+				acc = args[1]
+			} else {
+				if len(order) == 0 {
+					return nil, in.throwError("TypeError", "Reduce of empty array with no initial value")
+				}
+				acc = a.elems[order[0]]
+				order = order[1:]
+			}
+			for _, i := range order {
+				if i >= len(a.elems) {
+					continue
+				}
+				if acc, err = in.call(fn, undefined, []Value{acc, a.elems[i], float64(i), a}); err != nil {
+					return nil, err
+				}
+			}
+			return acc, nil
+		})
+	}
+	def(p, "sort", func(in *interp, this Value, args []Value) (Value, error) {
+		a, err := thisArray(in, this, "sort")
+		if err != nil {
+			return nil, err
+		}
+		cmp, hasCmp := arg(args, 0).(*function)
+		var sortErr error
+		sort.SliceStable(a.elems, func(i, j int) bool {
+			if sortErr != nil {
+				return false
+			}
+			x, y := a.elems[i], a.elems[j]
+			if _, ok := x.(undefinedType); ok {
+				return false
+			}
+			if _, ok := y.(undefinedType); ok {
+				return true
+			}
+			if hasCmp {
+				r, err := in.call(cmp, undefined, []Value{x, y})
+				if err != nil {
+					sortErr = err
+					return false
+				}
+				n, _ := in.toNumber(r)
+				return n < 0
+			}
+			xs, err := in.toString(x)
+			if err != nil {
+				sortErr = err
+				return false
+			}
+			ys, err := in.toString(y)
+			if err != nil {
+				sortErr = err
+				return false
+			}
+			return xs < ys
+		})
+		return a, sortErr
+	})
+	for _, name := range []string{"keys", "values", "entries"} {
+		name := name
+		def(p, name, func(in *interp, this Value, args []Value) (Value, error) {
+			a, err := thisArray(in, this, name)
+			if err != nil {
+				return nil, err
+			}
+			out := make([]Value, len(a.elems))
+			for i, v := range a.elems {
+				switch name {
+				case "keys":
+					out[i] = float64(i)
+				case "values":
+					out[i] = v
+				default:
+					out[i] = &array{elems: []Value{float64(i), v}}
+				}
+			}
+			return &array{elems: out}, nil
+		})
+	}
+
+	arrayCtor := native("Array", func(in *interp, this Value, args []Value) (Value, error) {
+		if n, ok := arg(args, 0).(float64); ok && len(args) == 1 {
+			if n < 0 || n != math.Trunc(n) || n > maxArrayLength {
+				return nil, in.throwError("RangeError", "Invalid array length")
+			}
+			elems := make([]Value, int(n))
+			for i := range elems {
+				elems[i] = undefined
+			}
+			return &array{elems: elems}, in.allocate(elementSize * len(elems))
+		}
+		return &array{elems: append([]Value{}, args...)}, nil
+	})
+	arrayCtor.ctor = true
+	arrayCtor.proto = p
+	p.set("constructor", arrayCtor)
+	in.arrayCtor = arrayCtor
+	statics := in.staticsOf(arrayCtor)
+	def(statics, "isArray", func(in *interp, this Value, args []Value) (Value, error) {
+		_, ok := arg(args, 0).(*array)
+		return ok, nil
+	})
+	def(statics, "of", func(in *interp, this Value, args []Value) (Value, error) {
+		return &array{elems: append([]Value{}, args...)}, nil
+	})
+	def(statics, "from", func(in *interp, this Value, args []Value) (Value, error) {
+		source := arg(args, 0)
+		var items []Value
+		if o, ok := source.(*object); ok && o.internal == nil {
+			length, _ := in.getMember(o, "length")
+			n, _ := in.toNumber(length)
+			if math.IsNaN(n) || n < 0 {
+				n = 0
+			}
+			if n > maxArrayLength {
+				return nil, in.throwError("RangeError", "Invalid array length")
+			}
+			for i := 0; i < int(n); i++ {
+				v, err := in.getMember(o, strconv.Itoa(i))
+				if err != nil {
+					return nil, err
+				}
+				items = append(items, v)
+			}
+		} else {
+			var err error
+			if items, err = in.iterate(source); err != nil {
+				return nil, err
+			}
+		}
+		if fn, ok := arg(args, 1).(*function); ok {
+			for i, v := range items {
+				mapped, err := in.call(fn, undefined, []Value{v, float64(i)})
+				if err != nil {
+					return nil, err
+				}
+				items[i] = mapped
+			}
+		}
+		if items == nil {
+			items = []Value{}
+		}
+		return &array{elems: items}, nil
+	})
+	global("Array", arrayCtor)
+}
+
+func flatten(elems []Value, depth float64) []Value {
+	out := []Value{}
+	for _, v := range elems {
+		if inner, ok := v.(*array); ok && depth >= 1 {
+			out = append(out, flatten(inner.elems, depth-1)...)
+		} else {
+			out = append(out, v)
+		}
+	}
+	return out
+}
+
+func (in *interp) setupString(global func(string, Value)) {
+	p := in.stringProto
+	str := func(name string, body func(in *interp, s string, args []Value) (Value, error)) {
+		def(p, name, func(in *interp, this Value, args []Value) (Value, error) {
+			s, err := in.toString(this)
+			if err != nil {
+				return nil, err
+			}
+			return body(in, s, args)
+		})
+	}
+	strArg := func(in *interp, args []Value, i int) string {
+		s, _ := in.toString(arg(args, i))
+		return s
+	}
+
+	str("toUpperCase", func(in *interp, s string, args []Value) (Value, error) { return strings.ToUpper(s), nil })
+	str("toLowerCase", func(in *interp, s string, args []Value) (Value, error) { return strings.ToLower(s), nil })
+	str("trim", func(in *interp, s string, args []Value) (Value, error) { return strings.TrimSpace(s), nil })
+	str("trimStart", func(in *interp, s string, args []Value) (Value, error) {
+		return strings.TrimLeftFunc(s, unicode.IsSpace), nil
+	})
+	str("trimEnd", func(in *interp, s string, args []Value) (Value, error) {
+		return strings.TrimRightFunc(s, unicode.IsSpace), nil
+	})
+	str("toString", func(in *interp, s string, args []Value) (Value, error) { return s, nil })
+	str("includes", func(in *interp, s string, args []Value) (Value, error) {
+		return strings.Contains(s, strArg(in, args, 0)), nil
+	})
+	str("startsWith", func(in *interp, s string, args []Value) (Value, error) {
+		return strings.HasPrefix(s, strArg(in, args, 0)), nil
+	})
+	str("endsWith", func(in *interp, s string, args []Value) (Value, error) {
+		return strings.HasSuffix(s, strArg(in, args, 0)), nil
+	})
+	str("indexOf", func(in *interp, s string, args []Value) (Value, error) {
+		i := strings.Index(s, strArg(in, args, 0))
+		if i < 0 {
+			return -1.0, nil
+		}
+		return float64(len([]rune(s[:i]))), nil
+	})
+	str("split", func(in *interp, s string, args []Value) (Value, error) {
+		if _, ok := arg(args, 0).(undefinedType); ok {
+			return &array{elems: []Value{s}}, nil
+		}
+		sep := strArg(in, args, 0)
+		var parts []string
+		if sep == "" {
+			for _, r := range s {
+				parts = append(parts, string(r))
+			}
+		} else {
+			parts = strings.Split(s, sep)
+		}
+		out := make([]Value, len(parts))
+		for i, part := range parts {
+			out[i] = part
+		}
+		return &array{elems: out}, nil
+	})
+	sliceRunes := func(name string, clampNegative bool) {
+		str(name, func(in *interp, s string, args []Value) (Value, error) {
+			runes := []rune(s)
+			var start, end int
+			if clampNegative {
+				n, _ := in.toNumber(arg(args, 0))
+				start = clamp(n, len(runes))
+				end = len(runes)
+				if _, ok := arg(args, 1).(undefinedType); !ok {
+					n, _ := in.toNumber(arg(args, 1))
+					end = clamp(n, len(runes))
+				}
+				if start > end {
+					start, end = end, start
+				}
+			} else {
+				start = relativeIndex(in, arg(args, 0), len(runes), 0)
+				end = relativeIndex(in, arg(args, 1), len(runes), len(runes))
+				if end < start {
+					end = start
+				}
+			}
+			return string(runes[start:end]), nil
+		})
+	}
+	sliceRunes("slice", false)
+	sliceRunes("substring", true)
+	str("charAt", func(in *interp, s string, args []Value) (Value, error) {
+		runes := []rune(s)
+		n, _ := in.toNumber(arg(args, 0))
+		if i := int(n); i >= 0 && i < len(runes) {
+			return string(runes[i]), nil
+		}
+		return "", nil
+	})
+	// the sandbox's strings are characters rather than UTF-16 code units,
+	// so this is the character's code point
+	str("charCodeAt", func(in *interp, s string, args []Value) (Value, error) {
+		runes := []rune(s)
+		n, _ := in.toNumber(arg(args, 0))
+		if i := int(n); i >= 0 && i < len(runes) {
+			return float64(runes[i]), nil
+		}
+		return math.NaN(), nil
+	})
+	str("at", func(in *interp, s string, args []Value) (Value, error) {
+		runes := []rune(s)
+		n, _ := in.toNumber(arg(args, 0))
+		i := int(n)
+		if i < 0 {
+			i += len(runes)
+		}
+		if i < 0 || i >= len(runes) {
+			return undefined, nil
+		}
+		return string(runes[i]), nil
+	})
+	str("repeat", func(in *interp, s string, args []Value) (Value, error) {
+		n, _ := in.toNumber(arg(args, 0))
+		if n < 0 || math.IsInf(n, 0) {
+			return nil, in.throwError("RangeError", "Invalid count value: %s", numberToString(n))
+		}
+		if float64(len(s))*n > maxStringLength {
+			return nil, in.throwError("RangeError", "Invalid string length")
+		}
+		return strings.Repeat(s, int(n)), in.allocate(len(s) * int(n))
+	})
+	pad := func(name string, start bool) {
+		str(name, func(in *interp, s string, args []Value) (Value, error) {
+			n, _ := in.toNumber(arg(args, 0))
+			fill := " "
+			if _, ok := arg(args, 1).(undefinedType); !ok {
+				fill = strArg(in, args, 1)
+			}
+			length := len([]rune(s))
+			if int(n) <= length || fill == "" {
+				return s, nil
+			}
+			if n > maxStringLength {
+				return nil, in.throwError("RangeError", "Invalid string length")
+			}
+			padding := []rune(strings.Repeat(fill, int(n)))[:int(n)-length]
+			if err := in.allocate(len(s) + len(string(padding))); err != nil {
+				return nil, err
+			}
+			if start {
+				return string(padding) + s, nil
+			}
+			return s + string(padding), nil
+		})
+	}
+	pad("padStart", true)
+	pad("padEnd", false)
+	replace := func(name string, all bool) {
+		str(name, func(in *interp, s string, args []Value) (Value, error) {
+			pattern := strArg(in, args, 0)
+			count := 1
+			if all {
+				count = -1
+			}
+			if fn, ok := arg(args, 1).(*function); ok {
+				var b strings.Builder
+				rest := s
+				for count != 0 {
+					i := strings.Index(rest, pattern)
+					if i < 0 {
+						break
+					}
+					r, err := in.call(fn, undefined, []Value{pattern})
+					if err != nil {
+						return nil, err
+					}
+					rs, err := in.toString(r)
+					if err != nil {
+						return nil, err
+					}
+					b.WriteString(rest[:i] + rs)
+					rest = rest[i+len(pattern):]
+					count--
+					if pattern == "" {
+						break
+					}
+				}
+				return b.String() + rest, nil
+			}
+			return strings.Replace(s, pattern, strArg(in, args, 1), count), nil
+		})
+	}
+	replace("replace", false)
+	replace("replaceAll", true)
+	str("concat", func(in *interp, s string, args []Value) (Value, error) {
+		for i := range args {
+			s += strArg(in, args, i)
+		}
+		return s, nil
+	})
+
+	stringCtor := native("String", func(in *interp, this Value, args []Value) (Value, error) {
+		if len(args) == 0 {
+			return "", nil
+		}
+		return in.toString(args[0])
+	})
+	stringCtor.proto = p
+	p.set("constructor", stringCtor)
+	global("String", stringCtor)
+}
+
+func clamp(n float64, length int) int {
+	if math.IsNaN(n) || n < 0 {
+		return 0
+	}
+	if n > float64(length) {
+		return length
+	}
+	return int(n)
+}
+
+func (in *interp) setupNumber(global func(string, Value)) {
+	def(in.numberProto, "toFixed", func(in *interp, this Value, args []Value) (Value, error) {
+		n, _ := in.toNumber(this)
+		digits, _ := in.toNumber(arg(args, 0))
+		if digits < 0 || digits > 100 {
+			return nil, in.throwError("RangeError", "toFixed() digits argument must be between 0 and 100")
+		}
+		return strconv.FormatFloat(n, 'f', int(digits), 64), nil
+	})
+	def(in.numberProto, "toString", func(in *interp, this Value, args []Value) (Value, error) {
+		n, _ := in.toNumber(this)
+		if radix, ok := arg(args, 0).(float64); ok && radix != 10 && n == math.Trunc(n) {
+			if radix < 2 || radix > 36 {
+				return nil, in.throwError("RangeError", "toString() radix must be between 2 and 36")
+			}
+			return strconv.FormatInt(int64(n), int(radix)), nil
+		}
+		return numberToString(n), nil
+	})
+	def(in.booleanProto, "toString", func(in *interp, this Value, args []Value) (Value, error) {
+		return toDisplayString(this), nil
+	})
+
+	numberCtor := native("Number", func(in *interp, this Value, args []Value) (Value, error) {
+		if len(args) == 0 {
+			return 0.0, nil
+		}
+		return in.toNumber(args[0])
+	})
+	numberCtor.proto = in.numberProto
+	in.numberProto.set("constructor", numberCtor)
+	statics := in.staticsOf(numberCtor)
+	statics.set("MAX_SAFE_INTEGER", 9007199254740991.0)
+	statics.set("MIN_SAFE_INTEGER", -9007199254740991.0)
+	statics.set("EPSILON", math.Nextafter(1, 2)-1)
+	statics.set("MAX_VALUE", math.MaxFloat64)
+	def(statics, "isInteger", func(in *interp, this Value, args []Value) (Value, error) {
+		n, ok := arg(args, 0).(float64)
+		return ok && !math.IsInf(n, 0) && n == math.Trunc(n), nil
+	})
+	def(statics, "isFinite", func(in *interp, this Value, args []Value) (Value, error) {
+		n, ok := arg(args, 0).(float64)
+		return ok && !math.IsInf(n, 0) && !math.IsNaN(n), nil
+	})
+	def(statics, "isNaN", func(in *interp, this Value, args []Value) (Value, error) {
+		n, ok := arg(args, 0).(float64)
+		return ok && math.IsNaN(n), nil
+	})
+	global("Number", numberCtor)
+}
+
+func (in *interp) setupCollections(global func(string, Value)) {
+	for _, isSet := range []bool{false, true} {
+		isSet := isSet
+		name := "Map"
+		if isSet {
+			name = "Set"
+		}
+		proto := newObject(in.objectProto)
+		entries := func(this Value) (*orderedMap, error) {
+			if o, ok := this.(*object); ok {
+				if m, ok := o.internal.(*orderedMap); ok && m.isSet == isSet {
+					return m, nil
+				}
+			}
+			return nil, in.throwError("TypeError", "Method %s called on incompatible receiver", name)
+		}
+		method := func(method string, body func(in *interp, m *orderedMap, this Value, args []Value) (Value, error)) {
+			def(proto, method, func(in *interp, this Value, args []Value) (Value, error) {
+				m, err := entries(this)
+				if err != nil {
+					return nil, err
+				}
+				return body(in, m, this, args)
+			})
+		}
+		put := func(m *orderedMap, key, value Value) {
+			if i := m.find(key); i >= 0 {
+				m.entries[i].value = value
+			} else {
+				m.entries = append(m.entries, mapEntry{key: key, value: value})
+			}
+		}
+
+		if isSet {
+			method("add", func(in *interp, m *orderedMap, this Value, args []Value) (Value, error) {
+				put(m, arg(args, 0), arg(args, 0))
+				return this, nil
+			})
+		} else {
+			method("set", func(in *interp, m *orderedMap, this Value, args []Value) (Value, error) {
+				put(m, arg(args, 0), arg(args, 1))
+				return this, nil
+			})
+			method("get", func(in *interp, m *orderedMap, this Value, args []Value) (Value, error) {
+				if i := m.find(arg(args, 0)); i >= 0 {
+					return m.entries[i].value, nil
+				}
+				return undefined, nil
+			})
+		}
+		method("has", func(in *interp, m *orderedMap, this Value, args []Value) (Value, error) {
+			return m.find(arg(args, 0)) >= 0, nil
+		})
+		method("delete", func(in *interp, m *orderedMap, this Value, args []Value) (Value, error) {
+			i := m.find(arg(args, 0))
+			if i >= 0 {
+				m.entries = append(m.entries[:i], m.entries[i+1:]...)
+			}
+			return i >= 0, nil
+		})
+		method("clear", func(in *interp, m *orderedMap, this Value, args []Value) (Value, error) {
+			m.entries = nil
+			return undefined, nil
+		})
+		method("forEach", func(in *interp, m *orderedMap, this Value, args []Value) (Value, error) {
+			fn, thisArg, err := in.callback(args, "forEach")
+			if err != nil {
+				return nil, err
+			}
+			for _, e := range append([]mapEntry{}, m.entries...) {
+				if _, err := in.call(fn, thisArg, []Value{e.value, e.key, this}); err != nil {
+					return nil, err
+				}
+			}
+			return undefined, nil
+		})
+		for _, view := range []string{"keys", "values", "entries"} {
+			view := view
+			method(view, func(in *interp, m *orderedMap, this Value, args []Value) (Value, error) {
+				out := make([]Value, len(m.entries))
+				for i, e := range m.entries {
+					switch {
+					case view == "keys":
+						out[i] = e.key
+					case view == "values":
+						out[i] = e.value
+					default:
+						out[i] = &array{elems: []Value{e.key, e.value}}
+					}
+				}
+				return &array{elems: out}, nil
+			})
+		}
+		proto.getters = map[string]*function{"size": native("size", func(in *interp, this Value, args []Value) (Value, error) {
+			m, err := entries(this)
+			if err != nil {
+				return nil, err
+			}
+			return float64(len(m.entries)), nil
+		})}
+
+		ctor := native(name, func(in *interp, this Value, args []Value) (Value, error) {
+			o, ok := this.(*object)
+			if !ok {
+				return nil, in.throwError("TypeError", "Constructor %s requires 'new'", name)
+			}
+			m := &orderedMap{isSet: isSet}
+			o.internal = m
+			if source := arg(args, 0); !isNullish(source) {
+				items, err := in.iterate(source)
+				if err != nil {
+					return nil, err
+				}
+				for _, item := range items {
+					if isSet {
+						put(m, item, item)
+						continue
+					}
+					k, err := in.getMember(item, "0")
+					if err != nil {
+						return nil, err
+					}
+					v, err := in.getMember(item, "1")
+					if err != nil {
+						return nil, err
+					}
+					put(m, k, v)
+				}
+			}
+			return o, nil
+		})
+		ctor.ctor = true
+		ctor.proto = proto
+		proto.set("constructor", ctor)
+		global(name, ctor)
+	}
+}
+
+// date is a Date's internal state: milliseconds since the epoch, NaN
+// for an invalid date. Dates read the clock and zone of the host.
+type date float64
+
+func (d date) time() time.Time {
+	return time.UnixMilli(int64(d))
+}
+
+func (d date) String() string {
+	if math.IsNaN(float64(d)) {
+		return "Invalid Date"
+	}
+	return d.time().Format("Mon Jan 02 2006 15:04:05 GMT-0700 (MST)")
+}
+
+func (d date) iso() string {
+	return d.time().UTC().Format("2006-01-02T15:04:05.000Z")
+}
+
+func (in *interp) setupDate(global func(string, Value)) {
+	proto := newObject(in.objectProto)
+	thisDate := func(this Value) (date, error) {
+		if o, ok := this.(*object); ok {
+			if d, ok := o.internal.(date); ok {
+				return d, nil
+			}
+		}
+		return 0, in.throwError("TypeError", "this is not a Date object.")
+	}
+	method := func(name string, body func(d date) Value) {
+		def(proto, name, func(in *interp, this Value, args []Value) (Value, error) {
+			d, err := thisDate(this)
+			if err != nil {
+				return nil, err
+			}
+			return body(d), nil
+		})
+	}
+	method("getTime", func(d date) Value { return float64(d) })
+	method("valueOf", func(d date) Value { return float64(d) })
+	fields := map[string]func(t time.Time) int{
+		"getFullYear":     func(t time.Time) int { return t.Year() },
+		"getMonth":        func(t time.Time) int { return int(t.Month()) - 1 },
+		"getDate":         func(t time.Time) int { return t.Day() },
+		"getDay":          func(t time.Time) int { return int(t.Weekday()) },
+		"getHours":        func(t time.Time) int { return t.Hour() },
+		"getMinutes":      func(t time.Time) int { return t.Minute() },
+		"getSeconds":      func(t time.Time) int { return t.Second() },
+		"getMilliseconds": func(t time.Time) int { return t.Nanosecond() / int(time.Millisecond) },
+	}
+	for name, field := range fields {
+		field := field
+		method(name, func(d date) Value {
+			if math.IsNaN(float64(d)) {
+				return math.NaN()
+			}
+			return float64(field(d.time()))
+		})
+	}
+	def(proto, "toISOString", func(in *interp, this Value, args []Value) (Value, error) {
+		d, err := thisDate(this)
+		if err == nil && math.IsNaN(float64(d)) {
+			err = in.throwError("RangeError", "Invalid time value")
+		}
+		if err != nil {
+			return nil, err
+		}
+		return d.iso(), nil
+	})
+	method("toString", func(d date) Value { return d.String() })
+
+	ctor := native("Date", func(in *interp, this Value, args []Value) (Value, error) {
+		now := date(time.Now().UnixMilli())
+		o, ok := this.(*object)
+		if !ok {
+			// Date() called without new returns the time as a string
+			return now.String(), nil
+		}
+		d := now
+		switch v := arg(args, 0).(type) {
+		case undefinedType:
+		case string:
+			d = date(math.NaN())
+			for _, layout := range []string{time.RFC3339Nano, "2006-01-02T15:04:05", "2006-01-02"} {
+				if t, err := time.ParseInLocation(layout, v, time.UTC); err == nil {
+					d = date(t.UnixMilli())
+					break
+				}
+			}
+		case *object:
+			if other, ok := v.internal.(date); ok {
+				d = other
+				break
+			}
+			n, err := in.toNumber(v)
+			if err != nil {
+				return nil, err
+			}
+			d = date(n)
+		default:
+			n, err := in.toNumber(v)
+			if err != nil {
+				return nil, err
+			}
+			if len(args) == 1 {
+				d = date(math.Trunc(n))
+				break
+			}
+			// year, month and the rest in local time
+			parts := []int{int(n), 0, 1, 0, 0, 0, 0}
+			for i := 1; i < len(args) && i < len(parts); i++ {
+				part, err := in.toNumber(args[i])
+				if err != nil {
+					return nil, err
+				}
+				parts[i] = int(part)
+			}
+			t := time.Date(parts[0], time.Month(parts[1]+1), parts[2], parts[3], parts[4], parts[5], parts[6]*int(time.Millisecond), time.Local)
+			d = date(t.UnixMilli())
+		}
+		o.internal = d
+		return o, nil
+	})
+	ctor.ctor = true
+	ctor.proto = proto
+	proto.set("constructor", ctor)
+	def(in.staticsOf(ctor), "now", func(in *interp, this Value, args []Value) (Value, error) {
+		return float64(time.Now().UnixMilli()), nil
+	})
+	global("Date", ctor)
+}
+
+func parseIntPrefix(s string, radix int) Value {
+	s = strings.TrimSpace(s)
+	sign := 1.0
+	if strings.HasPrefix(s, "-") || strings.HasPrefix(s, "+") {
+		if s[0] == '-' {
+			sign = -1
+		}
+		s = s[1:]
+	}
+	if radix == 16 || radix == 10 && (strings.HasPrefix(s, "0x") || strings.HasPrefix(s, "0X")) {
+		s = strings.TrimPrefix(strings.TrimPrefix(s, "0x"), "0X")
+		radix = 16
+	}
+	end := 0
+	for end < len(s) {
+		d := digitValue(s[end])
+		if d < 0 || d >= radix {
+			break
+		}
+		end++
+	}
+	if end == 0 {
+		return math.NaN()
+	}
+	n := 0.0
+	for _, c := range []byte(s[:end]) {
+		n = n*float64(radix) + float64(digitValue(c))
+	}
+	return sign * n
+}
+
+func digitValue(c byte) int {
+	switch {
+	case c >= '0' && c <= '9':
+		return int(c - '0')
+	case c >= 'a' && c <= 'z':
+		return int(c-'a') + 10
+	case c >= 'A' && c <= 'Z':
+		return int(c-'A') + 10
+	}
+	return -1
+}
+
+func parseFloatPrefix(s string) Value {
+	s = strings.TrimSpace(s)
+	for _, inf := range []string{"Infinity", "+Infinity", "-Infinity"} {
+		if strings.HasPrefix(s, inf) {
+			if inf[0] == '-' {
+				return math.Inf(-1)
+			}
+			return math.Inf(1)
+		}
+	}
+	best := math.NaN()
+	for end := 1; end <= len(s); end++ {
+		if n, err := strconv.ParseFloat(s[:end], 64); err == nil && !strings.ContainsAny(s[:end], "xXpP_nN") {
+			best = n
+		} else if end > 1 && !strings.ContainsRune("eE+-.", rune(s[end-1])) {
+			break
+		}
+	}
+	return best
+}
+
+type jsonError struct{}
+
+func (jsonError) Error() string { return "invalid JSON" }
+
+var errJSON error = jsonError{}
+
+func (in *interp) jsonRead(dec *json.Decoder) (Value, error) {
+	tok, err := dec.Token()
+	if err != nil {
+		return nil, err
+	}
+	switch t := tok.(type) {
+	case json.Delim:
+		switch t {
+		case '[':
+			elems := []Value{}
+			for dec.More() {
+				v, err := in.jsonRead(dec)
+				if err != nil {
+					return nil, err
+				}
+				elems = append(elems, v)
+			}
+			if _, err := dec.Token(); err != nil {
+				return nil, err
+			}
+			return &array{elems: elems}, nil
+		case '{':
+			obj := newObject(in.objectProto)
+			for dec.More() {
+				keyTok, err := dec.Token()
+				if err != nil {
+					return nil, err
+				}
+				key, _ := keyTok.(string)
+				v, err := in.jsonRead(dec)
+				if err != nil {
+					return nil, err
+				}
+				obj.set(key, v)
+			}
+			if _, err := dec.Token(); err != nil {
+				return nil, err
+			}
+			return obj, nil
+		}
+		return nil, errJSON
+	case json.Number:
+		n, err := t.Float64()
+		return n, err
+	case string:
+		return t, nil
+	case bool:
+		return t, nil
+	case nil:
+		return null, nil
+	}
+	return nil, errJSON
+}
+
+// jsonWrite serializes v like JSON.stringify, reporting false for values
+// that have no JSON form (undefined and functions)
+func (in *interp) jsonWrite(b *strings.Builder, v Value, indent, prefix string, seen map[interface{}]bool) (bool, error) {
+	if b.Len() > maxStringLength {
+		return false, in.throwError("RangeError", "Invalid string length")
+	}
+	newline := func(level string) {
+		if indent != "" {
+			b.WriteString("\n" + level)
+		}
+	}
+	switch v := v.(type) {
+	case undefinedType, *function:
+		return false, nil
+	case nullType:
+		b.WriteString("null")
+	case bool:
+		b.WriteString(toDisplayString(v))
+	case float64:
+		if math.IsNaN(v) || math.IsInf(v, 0) {
+			b.WriteString("null")
+		} else {
+			b.WriteString(numberToString(v))
+		}
+	case string:
+		var buf bytes.Buffer
+		enc := json.NewEncoder(&buf)
+		enc.SetEscapeHTML(false)
+		enc.Encode(v)
+		b.WriteString(strings.TrimSuffix(buf.String(), "\n"))
+	case *array:
+		if seen[v] {
+			return false, in.throwError("TypeError", "Converting circular structure to JSON")
+		}
+		seen[v] = true
+		defer delete(seen, v)
+		if len(v.elems) == 0 {
+			b.WriteString("[]")
+			return true, nil
+		}
+		b.WriteString("[")
+		for i, e := range v.elems {
+			if i > 0 {
+				b.WriteString(",")
+			}
+			newline(prefix + indent)
+			ok, err := in.jsonWrite(b, e, indent, prefix+indent, seen)
+			if err != nil {
+				return false, err
+			}
+			if !ok {
+				b.WriteString("null")
+			}
+		}
+		newline(prefix)
+		b.WriteString("]")
+	case *object:
+		if seen[v] {
+			return false, in.throwError("TypeError", "Converting circular structure to JSON")
+		}
+		if toJSON, ok := lookup(v, "toJSON").(*function); ok {
+			r, err := in.call(toJSON, v, nil)
+			if err != nil {
+				return false, err
+			}
+			return in.jsonWrite(b, r, indent, prefix, seen)
+		}
+		seen[v] = true
+		defer delete(seen, v)
+		if m, ok := v.internal.(*orderedMap); ok {
+			_ = m
+			b.WriteString("{}")
+			return true, nil
+		}
+		b.WriteString("{")
+		wrote := false
+		for _, k := range v.ownKeys() {
+			mark := b.Len()
+			if wrote {
+				b.WriteString(",")
+			}
+			newline(prefix + indent)
+			in.jsonWrite(b, k, "", "", seen)
+			b.WriteString(":")
+			if indent != "" {
+				b.WriteString(" ")
+			}
+			ok, err := in.jsonWrite(b, v.props[k], indent, prefix+indent, seen)
+			if err != nil {
+				return false, err
+			}
+			if !ok {
+				// drop the key again
+				s := b.String()[:mark]
+				b.Reset()
+				b.WriteString(s)
+				continue
+			}
+			wrote = true
+		}
+		if wrote {
+			newline(prefix)
+		}
+		b.WriteString("}")
+	}
+	return true, nil
+}
@@ -0,0 +1,2051 @@
+package sandbox
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+	"time"
+)
+
+const (
+	maxArrayLength  = 1 << 20
+	maxStringLength = 1 << 22
+)
+
+type binding struct {
+	value Value
+	kind  string
+}
+
+// frame is the per-call state shared by a function's scopes
+type frame struct {
+	name  string
+	this  Value
+	arrow bool
+	home  *object
+	// class is set while running a class constructor, for super()
+	class *function
+}
+
+type env struct {
+	vars   map[string]*binding
+	names  []string
+	parent *env
+	frame  *frame
+}
+
+func newEnv(parent *env, f *frame) *env {
+	return &env{vars: map[string]*binding{}, parent: parent, frame: f}
+}
+
+func (e *env) resolve(name string) *binding {
+	for s := e; s != nil; s = s.parent {
+		if b, ok := s.vars[name]; ok {
+			return b
+		}
+	}
+	return nil
+}
+
+// functionScope is the nearest function (or global) scope, where var lives
+func (e *env) functionScope() *env {
+	s := e
+	for s.frame == nil && s.parent != nil && s.parent.parent != nil {
+		s = s.parent
+	}
+	return s
+}
+
+// thisFrame is the nearest non-arrow function frame
+func (e *env) thisFrame() *frame {
+	for s := e; s != nil; s = s.parent {
+		if s.frame != nil && !s.frame.arrow {
+			return s.frame
+		}
+	}
+	return nil
+}
+
+func (e *env) copyScope() *env {
+	c := newEnv(e.parent, e.frame)
+	for _, name := range e.names {
+		b := *e.vars[name]
+		c.vars[name] = &b
+		c.names = append(c.names, name)
+	}
+	return c
+}
+
+type ctlKind int
+
+const (
+	ctlNormal ctlKind = iota
+	ctlBreak
+	ctlContinue
+	ctlReturn
+)
+
+type ctl struct {
+	kind  ctlKind
+	label string
+	value Value
+}
+
+// thrown is a JavaScript exception in flight
+type thrown struct {
+	value Value
+	line  int
+}
+
+func (t *thrown) Error() string {
+	if o, ok := t.value.(*object); ok && isError(o) {
+		return "Uncaught " + errorString(o)
+	}
+	return "Uncaught " + inspect(t.value, 1, map[interface{}]bool{})
+}
+
+// LimitError stops execution when a resource limit is hit; scripts can't
+// catch it
+type LimitError struct {
+	Limit   string
+	Message string
+}
+
+func (e *LimitError) Error() string { return e.Message }
+
+type timer struct {
+	id    int
+	delay float64
+	fn    Value
+	args  []Value
+}
+
+type interp struct {
+	opts     Options
+	builtins *env
+	global   *env
+	started  time.Time
+	steps    int
+	depth    int
+	line     int
+	stdout   []string
+	outBytes int
+	stdin    []string
+
+	objectProto, functionProto, arrayProto, stringProto, numberProto, booleanProto *object
+	errorProtos                                                                    map[string]*object
+	arrayCtor                                                                      *function
+
+	timers    []timer
+	timerSeq  int
+	clock     float64
+	source    []string
+	trace     []Step
+	truncated bool
+	traceMark int
+
+	// stack holds the scope of each user function call in progress, for
+	// memory samples
+	stack         []*env
+	peakMemory    int
+	depthExceeded bool
+	// instructions counts evaluated expressions
+	instructions int
+	// allocated counts the bytes of strings and arrays built since the
+	// last memory sample; scope is the running statement's, for samples
+	// taken in the middle of one
+	allocated int
+	scope     *env
+	// completion is the value of the last expression statement run, and
+	// values the top-level statements' values (see Options.Values)
+	completion Value
+	values     []LineValue
+}
+
+func (in *interp) limit(limit, format string, args ...interface{}) error {
+	return &LimitError{Limit: limit, Message: fmt.Sprintf(format, args...)}
+}
+
+// throwError raises a new Error of the given kind, e.g. "TypeError"
+func (in *interp) throwError(kind, format string, args ...interface{}) error {
+	return &thrown{value: in.newError(kind, fmt.Sprintf(format, args...)), line: in.line}
+}
+
+func (in *interp) newError(kind, message string) *object {
+	proto, ok := in.errorProtos[kind]
+	if !ok {
+		proto = in.errorProtos["Error"]
+	}
+	o := newObject(proto)
+	o.set("message", message)
+	return o
+}
+
+// tick accounts for one executed statement and enforces the step and time
+// budgets
+func (in *interp) tick(line int) error {
+	in.steps++
+	in.line = line
+	if in.steps > in.opts.MaxSteps {
+		return in.limit("steps", "Execution stopped: step limit exceeded (%d statements)", in.opts.MaxSteps)
+	}
+	if in.steps%256 == 0 && time.Since(in.started) > in.opts.Timeout {
+		return in.limit("time", "Execution stopped: time limit exceeded (%s)", in.opts.Timeout)
+	}
+	return nil
+}
+
+// count accounts for one evaluated expression and enforces the
+// instruction budget. Callbacks with an expression body run without
+// statements, so the time budget is checked here too.
+func (in *interp) count() error {
+	in.instructions++
+	if in.instructions > in.opts.MaxInstructions {
+		return in.limit("instructions", "Execution stopped: instruction limit exceeded (%d operations)", in.opts.MaxInstructions)
+	}
+	if in.instructions%4096 == 0 && time.Since(in.started) > in.opts.Timeout {
+		return in.limit("time", "Execution stopped: time limit exceeded (%s)", in.opts.Timeout)
+	}
+	return nil
+}
+
+func (in *interp) declare(e *env, name, kind string, v Value) error {
+	if b, ok := e.vars[name]; ok {
+		if lexical(kind) || lexical(b.kind) {
+			return in.throwError("SyntaxError", "Identifier '%s' has already been declared", name)
+		}
+		b.value, b.kind = v, kind
+		return nil
+	}
+	e.vars[name] = &binding{value: v, kind: kind}
+	e.names = append(e.names, name)
+	return nil
+}
+
+func lexical(kind string) bool {
+	return kind == "let" || kind == "const" || kind == "class"
+}
+
+// hoist declares a scope's function declarations and, for function scopes,
+// every var declared anywhere in its body
+func (in *interp) hoist(body []stmt, e *env, vars bool) error {
+	for _, s := range body {
+		if fd, ok := s.(*funcDecl); ok {
+			if err := in.declare(e, fd.fn.name, "function", in.makeFunction(fd.fn, e, nil)); err != nil {
+				return err
+			}
+		}
+	}
+	if !vars {
+		return nil
+	}
+	var walk func(s stmt)
+	walk = func(s stmt) {
+		switch s := s.(type) {
+		case *varDecl:
+			if s.kind == "var" {
+				for _, d := range s.decls {
+					for _, name := range patternNames(d.target) {
+						if _, ok := e.vars[name]; !ok {
+							in.declare(e, name, "var", undefined)
+						}
+					}
+				}
+			}
+		case *blockStmt:
+			for _, c := range s.body {
+				walk(c)
+			}
+		case *ifStmt:
+			walk(s.cons)
+			if s.alt != nil {
+				walk(s.alt)
+			}
+		case *forStmt:
+			if s.init != nil {
+				walk(s.init)
+			}
+			walk(s.body)
+		case *forInOf:
+			if s.declKind == "var" {
+				for _, name := range patternNames(s.target) {
+					if _, ok := e.vars[name]; !ok {
+						in.declare(e, name, "var", undefined)
+					}
+				}
+			}
+			walk(s.body)
+		case *whileStmt:
+			walk(s.body)
+		case *labeledStmt:
+			walk(s.body)
+		case *tryStmt:
+			walk(s.block)
+			if s.handler != nil {
+				walk(s.handler)
+			}
+			if s.finalizer != nil {
+				walk(s.finalizer)
+			}
+		case *switchStmt:
+			for _, c := range s.cases {
+				for _, b := range c.body {
+					walk(b)
+				}
+			}
+		}
+	}
+	for _, s := range body {
+		walk(s)
+	}
+	return nil
+}
+
+func patternNames(target expr) []string {
+	switch t := target.(type) {
+	case *ident:
+		return []string{t.name}
+	case *arrayPattern:
+		names := []string{}
+		for _, elem := range t.elems {
+			if elem != nil {
+				names = append(names, patternNames(elem.target)...)
+			}
+		}
+		if t.rest != nil {
+			names = append(names, patternNames(t.rest)...)
+		}
+		return names
+	case *objectPattern:
+		names := []string{}
+		for _, elem := range t.props {
+			names = append(names, patternNames(elem.target)...)
+		}
+		if t.rest != nil {
+			names = append(names, patternNames(t.rest)...)
+		}
+		return names
+	}
+	return nil
+}
+
+func (in *interp) execBlock(body []stmt, e *env) (ctl, error) {
+	if err := in.hoist(body, e, false); err != nil {
+		return ctl{}, err
+	}
+	for _, s := range body {
+		c, err := in.exec(s, e)
+		if err != nil || c.kind != ctlNormal {
+			return c, err
+		}
+	}
+	return ctl{}, nil
+}
+
+func (in *interp) exec(s stmt, e *env) (ctl, error) {
+	if err := in.tick(s.line()); err != nil {
+		return ctl{}, err
+	}
+	in.scope = e
+	if in.steps%memorySampleSteps == 0 {
+		if err := in.sampleMemory(e); err != nil {
+			return ctl{}, err
+		}
+	}
+
+	switch s := s.(type) {
+	case *emptyStmt, *funcDecl:
+		return ctl{}, nil
+
+	case *exprStmt:
+		v, err := in.eval(s.x, e)
+		if err != nil {
+			return ctl{}, err
+		}
+		in.completion = v
+		in.step("statement", s.line(), e, nil)
+		return ctl{}, nil
+
+	case *varDecl:
+		for _, d := range s.decls {
+			if d.init == nil && s.kind == "var" {
+				continue
+			}
+			v := undefined
+			if d.init != nil {
+				var err error
+				if v, err = in.evalNamed(d.init, e, d.target); err != nil {
+					return ctl{}, err
+				}
+			}
+			if err := in.bind(d.target, v, s.kind, e); err != nil {
+				return ctl{}, err
+			}
+		}
+		in.step("statement", s.line(), e, nil)
+		return ctl{}, nil
+
+	case *classDecl:
+		cls, err := in.makeClass(s.cls, e)
+		if err != nil {
+			return ctl{}, err
+		}
+		if err := in.declare(e, s.cls.name, "class", cls); err != nil {
+			return ctl{}, err
+		}
+		in.step("statement", s.line(), e, nil)
+		return ctl{}, nil
+
+	case *blockStmt:
+		return in.execBlock(s.body, newEnv(e, nil))
+
+	case *ifStmt:
+		v, err := in.eval(s.test, e)
+		if err != nil {
+			return ctl{}, err
+		}
+		in.step("condition", s.line(), e, truthy(v))
+		if truthy(v) {
+			return in.exec(s.cons, e)
+		}
+		if s.alt != nil {
+			return in.exec(s.alt, e)
+		}
+		return ctl{}, nil
+
+	case *whileStmt:
+		return in.execWhile(s, e, "")
+	case *forStmt:
+		return in.execFor(s, e, "")
+	case *forInOf:
+		return in.execForInOf(s, e, "")
+
+	case *labeledStmt:
+		var c ctl
+		var err error
+		switch body := s.body.(type) {
+		case *whileStmt:
+			c, err = in.execWhile(body, e, s.label)
+		case *forStmt:
+			c, err = in.execFor(body, e, s.label)
+		case *forInOf:
+			c, err = in.execForInOf(body, e, s.label)
+		default:
+			c, err = in.exec(body, e)
+		}
+		if c.kind == ctlBreak && c.label == s.label {
+			return ctl{}, err
+		}
+		return c, err
+
+	case *returnStmt:
+		v := undefined
+		if s.x != nil {
+			var err error
+			if v, err = in.eval(s.x, e); err != nil {
+				return ctl{}, err
+			}
+		}
+		in.step("return", s.line(), e, v)
+		return ctl{kind: ctlReturn, value: v}, nil
+
+	case *breakStmt:
+		return ctl{kind: ctlBreak, label: s.label}, nil
+	case *continueStmt:
+		return ctl{kind: ctlContinue, label: s.label}, nil
+
+	case *throwStmt:
+		v, err := in.eval(s.x, e)
+		if err != nil {
+			return ctl{}, err
+		}
+		in.step("throw", s.line(), e, v)
+		return ctl{}, &thrown{value: v, line: s.line()}
+
+	case *tryStmt:
+		return in.execTry(s, e)
+
+	case *switchStmt:
+		return in.execSwitch(s, e)
+	}
+	return ctl{}, in.throwError("SyntaxError", "unsupported statement")
+}
+
+// loopCtl decides what a loop does with its body's completion: stop with
+// the returned ctl, or keep going
+func loopCtl(c ctl, label string) (ctl, bool) {
+	switch c.kind {
+	case ctlBreak:
+		if c.label == "" || c.label == label {
+			return ctl{}, true
+		}
+		return c, true
+	case ctlContinue:
+		if c.label == "" || c.label == label {
+			return ctl{}, false
+		}
+		return c, true
+	case ctlReturn:
+		return c, true
+	}
+	return ctl{}, false
+}
+
+func (in *interp) execWhile(s *whileStmt, e *env, label string) (ctl, error) {
+	first := s.do
+	for {
+		if !first {
+			v, err := in.eval(s.test, e)
+			if err != nil {
+				return ctl{}, err
+			}
+			in.step("condition", s.line(), e, truthy(v))
+			if !truthy(v) {
+				return ctl{}, nil
+			}
+		}
+		first = false
+		c, err := in.exec(s.body, e)
+		if err != nil {
+			return ctl{}, err
+		}
+		if out, stop := loopCtl(c, label); stop {
+			return out, nil
+		}
+		if err := in.tick(s.line()); err != nil {
+			return ctl{}, err
+		}
+	}
+}
+
+func (in *interp) execFor(s *forStmt, e *env, label string) (ctl, error) {
+	loopEnv := newEnv(e, nil)
+	perIteration := false
+	if s.init != nil {
+		if decl, ok := s.init.(*varDecl); ok && decl.kind != "var" {
+			perIteration = true
+		}
+		if _, err := in.exec(s.init, loopEnv); err != nil {
+			return ctl{}, err
+		}
+	}
+
+	iterEnv := loopEnv
+	if perIteration {
+		iterEnv = loopEnv.copyScope()
+	}
+	for {
+		if s.test != nil {
+			v, err := in.eval(s.test, iterEnv)
+			if err != nil {
+				return ctl{}, err
+			}
+			in.step("condition", s.line(), iterEnv, truthy(v))
+			if !truthy(v) {
+				return ctl{}, nil
+			}
+		}
+		c, err := in.exec(s.body, iterEnv)
+		if err != nil {
+			return ctl{}, err
+		}
+		if out, stop := loopCtl(c, label); stop {
+			return out, nil
+		}
+		if perIteration {
+			iterEnv = iterEnv.copyScope()
+		}
+		if s.update != nil {
+			if _, err := in.eval(s.update, iterEnv); err != nil {
+				return ctl{}, err
+			}
+		}
+		if err := in.tick(s.line()); err != nil {
+			return ctl{}, err
+		}
+	}
+}
+
+func (in *interp) execForInOf(s *forInOf, e *env, label string) (ctl, error) {
+	v, err := in.eval(s.iter, e)
+	if err != nil {
+		return ctl{}, err
+	}
+	var items []Value
+	if s.of {
+		if items, err = in.iterate(v); err != nil {
+			return ctl{}, err
+		}
+	} else {
+		for _, k := range in.enumerableKeys(v) {
+			items = append(items, k)
+		}
+	}
+
+	for _, item := range items {
+		iterEnv := newEnv(e, nil)
+		kind := s.declKind
+		if kind == "" {
+			kind = "assign"
+		}
+		if err := in.bind(s.target, item, kind, iterEnv); err != nil {
+			return ctl{}, err
+		}
+		in.step("iteration", s.line(), iterEnv, item)
+		c, err := in.exec(s.body, iterEnv)
+		if err != nil {
+			return ctl{}, err
+		}
+		if out, stop := loopCtl(c, label); stop {
+			return out, nil
+		}
+		if err := in.tick(s.line()); err != nil {
+			return ctl{}, err
+		}
+	}
+	return ctl{}, nil
+}
+
+func (in *interp) execTry(s *tryStmt, e *env) (ctl, error) {
+	c, err := in.execBlock(s.block.body, newEnv(e, nil))
+	if t, ok := err.(*thrown); ok && s.handler != nil {
+		catchEnv := newEnv(e, nil)
+		if s.param != nil {
+			if err := in.bind(s.param, t.value, "let", catchEnv); err != nil {
+				return ctl{}, err
+			}
+		}
+		in.step("catch", s.handler.line(), catchEnv, t.value)
+		c, err = in.execBlock(s.handler.body, catchEnv)
+	}
+	if s.finalizer != nil {
+		if _, limited := err.(*LimitError); limited {
+			return c, err
+		}
+		fc, ferr := in.execBlock(s.finalizer.body, newEnv(e, nil))
+		if ferr != nil || fc.kind != ctlNormal {
+			return fc, ferr
+		}
+	}
+	return c, err
+}
+
+func (in *interp) execSwitch(s *switchStmt, e *env) (ctl, error) {
+	disc, err := in.eval(s.disc, e)
+	if err != nil {
+		return ctl{}, err
+	}
+	in.step("condition", s.line(), e, disc)
+
+	scope := newEnv(e, nil)
+	for _, c := range s.cases {
+		if err := in.hoist(c.body, scope, false); err != nil {
+			return ctl{}, err
+		}
+	}
+	start := -1
+	for i, c := range s.cases {
+		if c.test == nil {
+			continue
+		}
+		v, err := in.eval(c.test, scope)
+		if err != nil {
+			return ctl{}, err
+		}
+		if strictEquals(disc, v) {
+			start = i
+			break
+		}
+	}
+	if start < 0 {
+		for i, c := range s.cases {
+			if c.test == nil {
+				start = i
+			}
+		}
+	}
+	if start < 0 {
+		return ctl{}, nil
+	}
+	for _, c := range s.cases[start:] {
+		for _, st := range c.body {
+			res, err := in.exec(st, scope)
+			if err != nil {
+				return ctl{}, err
+			}
+			if res.kind == ctlBreak && res.label == "" {
+				return ctl{}, nil
+			}
+			if res.kind != ctlNormal {
+				return res, nil
+			}
+		}
+	}
+	return ctl{}, nil
+}
+
+// bind assigns v to a binding target. kind is the declaration kind, or
+// "assign" for plain assignment to existing variables and properties.
+func (in *interp) bind(target expr, v Value, kind string, e *env) error {
+	switch t := target.(type) {
+	case *ident:
+		switch kind {
+		case "assign":
+			return in.assign(t.name, v, e)
+		case "var":
+			if b := e.functionScope().vars[t.name]; b != nil {
+				b.value = v
+				return nil
+			}
+			return in.declare(e.functionScope(), t.name, "var", v)
+		}
+		return in.declare(e, t.name, kind, v)
+
+	case *memberExpr:
+		obj, key, err := in.memberTarget(t, e)
+		if err != nil {
+			return err
+		}
+		return in.setMember(obj, key, v)
+
+	case *arrayPattern:
+		items, err := in.iterate(v)
+		if err != nil {
+			return err
+		}
+		for i, elem := range t.elems {
+			if elem == nil {
+				continue
+			}
+			item := undefined
+			if i < len(items) {
+				item = items[i]
+			}
+			if err := in.bindDefault(elem, item, kind, e); err != nil {
+				return err
+			}
+		}
+		if t.rest != nil {
+			rest := []Value{}
+			if len(t.elems) < len(items) {
+				rest = append(rest, items[len(t.elems):]...)
+			}
+			return in.bind(t.rest, &array{elems: rest}, kind, e)
+		}
+		return nil
+
+	case *objectPattern:
+		if isNullish(v) {
+			return in.throwError("TypeError", "Cannot destructure '%s' as it is %s.", toDisplayString(v), toDisplayString(v))
+		}
+		used := map[string]bool{}
+		for i := range t.props {
+			elem := &t.props[i]
+			key := elem.key
+			if elem.computed != nil {
+				kv, err := in.eval(elem.computed, e)
+				if err != nil {
+					return err
+				}
+				key = in.propertyKey(kv)
+			}
+			used[key] = true
+			item, err := in.getMember(v, key)
+			if err != nil {
+				return err
+			}
+			if err := in.bindDefault(elem, item, kind, e); err != nil {
+				return err
+			}
+		}
+		if t.rest != nil {
+			rest := newObject(in.objectProto)
+			for _, k := range in.enumerableKeys(v) {
+				if !used[k] {
+					item, err := in.getMember(v, k)
+					if err != nil {
+						return err
+					}
+					rest.set(k, item)
+				}
+			}
+			return in.bind(t.rest, rest, kind, e)
+		}
+		return nil
+	}
+	return in.throwError("SyntaxError", "invalid assignment target")
+}
+
+func (in *interp) bindDefault(elem *patternElem, v Value, kind string, e *env) error {
+	if _, isUndefined := v.(undefinedType); isUndefined && elem.def != nil {
+		var err error
+		if v, err = in.evalNamed(elem.def, e, elem.target); err != nil {
+			return err
+		}
+	}
+	return in.bind(elem.target, v, kind, e)
+}
+
+func (in *interp) assign(name string, v Value, e *env) error {
+	b := e.resolve(name)
+	if b == nil {
+		return in.throwError("ReferenceError", "%s is not defined", name)
+	}
+	switch b.kind {
+	case "const", "class":
+		return in.throwError("TypeError", "Assignment to constant variable.")
+	case "builtin":
+		// shadow the builtin in the global scope instead
+		return in.declare(in.global, name, "var", v)
+	}
+	b.value = v
+	return nil
+}
+
+// evalNamed evaluates x, naming an anonymous function or class after the
+// binding it's assigned to
+func (in *interp) evalNamed(x expr, e *env, target expr) (Value, error) {
+	v, err := in.eval(x, e)
+	if err != nil {
+		return nil, err
+	}
+	if id, ok := target.(*ident); ok {
+		if fn, ok := v.(*function); ok && fn.name == "" {
+			fn.name = id.name
+		}
+	}
+	return v, nil
+}
+
+func (in *interp) eval(x expr, e *env) (Value, error) {
+	if err := in.count(); err != nil {
+		return nil, err
+	}
+	switch x := x.(type) {
+	case *numLit:
+		return x.v, nil
+	case *strLit:
+		return x.v, nil
+	case *boolLit:
+		return x.v, nil
+	case *nullLit:
+		return null, nil
+
+	case *tmplLit:
+		var b strings.Builder
+		for i, part := range x.parts {
+			b.WriteString(part)
+			if i < len(x.exprs) {
+				v, err := in.eval(x.exprs[i], e)
+				if err != nil {
+					return nil, err
+				}
+				s, err := in.toString(v)
+				if err != nil {
+					return nil, err
+				}
+				b.WriteString(s)
+			}
+			if b.Len() > maxStringLength {
+				return nil, in.throwError("RangeError", "Invalid string length")
+			}
+		}
+		if err := in.allocate(b.Len()); err != nil {
+			return nil, err
+		}
+		return b.String(), nil
+
+	case *ident:
+		b := e.resolve(x.name)
+		if b == nil {
+			return nil, in.throwError("ReferenceError", "%s is not defined", x.name)
+		}
+		return b.value, nil
+
+	case *thisExpr:
+		if f := e.thisFrame(); f != nil {
+			return f.this, nil
+		}
+		return undefined, nil
+
+	case *arrayLit:
+		elems := []Value{}
+		for _, el := range x.elems {
+			switch el := el.(type) {
+			case nil:
+				elems = append(elems, undefined)
+			case *spreadExpr:
+				v, err := in.eval(el.x, e)
+				if err != nil {
+					return nil, err
+				}
+				items, err := in.iterate(v)
+				if err != nil {
+					return nil, err
+				}
+				elems = append(elems, items...)
+			default:
+				v, err := in.eval(el, e)
+				if err != nil {
+					return nil, err
+				}
+				elems = append(elems, v)
+			}
+			if len(elems) > maxArrayLength {
+				return nil, in.throwError("RangeError", "Invalid array length")
+			}
+		}
+		if err := in.allocate(elementSize * len(elems)); err != nil {
+			return nil, err
+		}
+		return &array{elems: elems}, nil
+
+	case *objectLit:
+		return in.evalObject(x, e)
+
+	case *funcLit:
+		return in.makeFunction(x, e, nil), nil
+
+	case *classLit:
+		return in.makeClass(x, e)
+
+	case *unaryExpr:
+		return in.evalUnary(x, e)
+
+	case *updateExpr:
+		old, err := in.eval(x.x, e)
+		if err != nil {
+			return nil, err
+		}
+		n, err := in.toNumber(old)
+		if err != nil {
+			return nil, err
+		}
+		updated := n + 1
+		if x.op == "--" {
+			updated = n - 1
+		}
+		if err := in.bind(x.x, updated, "assign", e); err != nil {
+			return nil, err
+		}
+		if x.prefix {
+			return updated, nil
+		}
+		return n, nil
+
+	case *binaryExpr:
+		l, err := in.eval(x.l, e)
+		if err != nil {
+			return nil, err
+		}
+		r, err := in.eval(x.r, e)
+		if err != nil {
+			return nil, err
+		}
+		return in.binary(x.op, l, r)
+
+	case *logicalExpr:
+		l, err := in.eval(x.l, e)
+		if err != nil {
+			return nil, err
+		}
+		switch {
+		case x.op == "&&" && !truthy(l), x.op == "||" && truthy(l), x.op == "??" && !isNullish(l):
+			return l, nil
+		}
+		return in.eval(x.r, e)
+
+	case *condExpr:
+		test, err := in.eval(x.test, e)
+		if err != nil {
+			return nil, err
+		}
+		if truthy(test) {
+			return in.eval(x.cons, e)
+		}
+		return in.eval(x.alt, e)
+
+	case *assignExpr:
+		return in.evalAssign(x, e)
+
+	case *callExpr:
+		return in.evalCall(x, e)
+
+	case *newExpr:
+		callee, err := in.eval(x.callee, e)
+		if err != nil {
+			return nil, err
+		}
+		args, err := in.evalArgs(x.args, e)
+		if err != nil {
+			return nil, err
+		}
+		if _, ok := callee.(*function); !ok {
+			return nil, in.throwError("TypeError", "%s is not a constructor", exprName(x.callee))
+		}
+		return in.construct(callee.(*function), args, x.callee)
+
+	case *memberExpr:
+		obj, key, err := in.memberTarget(x, e)
+		if err != nil {
+			return nil, err
+		}
+		if x.optional && isNullish(obj) {
+			return undefined, nil
+		}
+		if _, ok := x.obj.(*superExpr); ok {
+			return in.superMember(e, key)
+		}
+		if isNullish(obj) {
+			return nil, in.throwError("TypeError", "Cannot read properties of %s (reading '%s')", toDisplayString(obj), key)
+		}
+		return in.getMember(obj, key)
+
+	case *seqExpr:
+		var v Value = undefined
+		for _, item := range x.list {
+			var err error
+			if v, err = in.eval(item, e); err != nil {
+				return nil, err
+			}
+		}
+		return v, nil
+
+	case *awaitExpr:
+		return in.eval(x.x, e)
+
+	case *superExpr:
+		return nil, in.throwError("SyntaxError", "'super' keyword unexpected here")
+	case *spreadExpr:
+		return nil, in.throwError("SyntaxError", "unexpected spread")
+	}
+	return nil, in.throwError("SyntaxError", "unsupported expression")
+}
+
+func (in *interp) evalObject(x *objectLit, e *env) (Value, error) {
+	obj := newObject(in.objectProto)
+	for _, prop := range x.props {
+		if prop.kind == "spread" {
+			v, err := in.eval(prop.value, e)
+			if err != nil {
+				return nil, err
+			}
+			for _, k := range in.enumerableKeys(v) {
+				item, err := in.getMember(v, k)
+				if err != nil {
+					return nil, err
+				}
+				obj.set(k, item)
+			}
+			continue
+		}
+
+		key := prop.key
+		if prop.computed != nil {
+			kv, err := in.eval(prop.computed, e)
+			if err != nil {
+				return nil, err
+			}
+			key = in.propertyKey(kv)
+		}
+		if prop.method {
+			fn := in.makeFunction(prop.value.(*funcLit), e, obj)
+			fn.name = key
+			switch prop.kind {
+			case "get":
+				if obj.getters == nil {
+					obj.getters = map[string]*function{}
+				}
+				obj.getters[key] = fn
+			case "set":
+				if obj.setters == nil {
+					obj.setters = map[string]*function{}
+				}
+				obj.setters[key] = fn
+			default:
+				obj.set(key, fn)
+			}
+			continue
+		}
+		v, err := in.evalNamed(prop.value, e, &ident{name: key})
+		if err != nil {
+			return nil, err
+		}
+		obj.set(key, v)
+	}
+	return obj, nil
+}
+
+func (in *interp) evalUnary(x *unaryExpr, e *env) (Value, error) {
+	switch x.op {
+	case "typeof":
+		if id, ok := x.x.(*ident); ok && e.resolve(id.name) == nil {
+			return "undefined", nil
+		}
+	case "delete":
+		m, ok := x.x.(*memberExpr)
+		if !ok {
+			return true, nil
+		}
+		obj, key, err := in.memberTarget(m, e)
+		if err != nil {
+			return nil, err
+		}
+		switch o := obj.(type) {
+		case *object:
+			if !o.frozen {
+				o.delete(key)
+			}
+		case *array:
+			if i, ok := arrayIndex(key); ok && i < len(o.elems) {
+				o.elems[i] = undefined
+			}
+		}
+		return true, nil
+	}
+
+	v, err := in.eval(x.x, e)
+	if err != nil {
+		return nil, err
+	}
+	switch x.op {
+	case "typeof":
+		return typeOf(v), nil
+	case "void":
+		return undefined, nil
+	case "!":
+		return !truthy(v), nil
+	}
+	n, err := in.toNumber(v)
+	if err != nil {
+		return nil, err
+	}
+	switch x.op {
+	case "-":
+		return -n, nil
+	case "~":
+		return float64(^toInt32(n)), nil
+	}
+	return n, nil
+}
+
+func (in *interp) evalAssign(x *assignExpr, e *env) (Value, error) {
+	if x.op == "=" {
+		v, err := in.evalNamed(x.value, e, x.target)
+		if err != nil {
+			return nil, err
+		}
+		return v, in.bind(x.target, v, "assign", e)
+	}
+
+	old, err := in.eval(x.target, e)
+	if err != nil {
+		return nil, err
+	}
+	switch {
+	case x.op == "&&=" && !truthy(old), x.op == "||=" && truthy(old), x.op == "??=" && !isNullish(old):
+		return old, nil
+	case x.op == "&&=" || x.op == "||=" || x.op == "??=":
+		v, err := in.evalNamed(x.value, e, x.target)
+		if err != nil {
+			return nil, err
+		}
+		return v, in.bind(x.target, v, "assign", e)
+	}
+
+	r, err := in.eval(x.value, e)
+	if err != nil {
+		return nil, err
+	}
+	v, err := in.binary(strings.TrimSuffix(x.op, "="), old, r)
+	if err != nil {
+		return nil, err
+	}
+	return v, in.bind(x.target, v, "assign", e)
+}
+
+func (in *interp) evalArgs(args []expr, e *env) ([]Value, error) {
+	values := make([]Value, 0, len(args))
+	for _, arg := range args {
+		if spread, ok := arg.(*spreadExpr); ok {
+			v, err := in.eval(spread.x, e)
+			if err != nil {
+				return nil, err
+			}
+			items, err := in.iterate(v)
+			if err != nil {
+				return nil, err
+			}
+			values = append(values, items...)
+			continue
+		}
+		v, err := in.eval(arg, e)
+		if err != nil {
+			return nil, err
+		}
+		values = append(values, v)
+	}
+	return values, nil
+}
+
+func (in *interp) evalCall(x *callExpr, e *env) (Value, error) {
+	var fn, this Value = nil, undefined
+	switch callee := x.callee.(type) {
+	case *superExpr:
+		return in.superCall(x, e)
+	case *memberExpr:
+		obj, key, err := in.memberTarget(callee, e)
+		if err != nil {
+			return nil, err
+		}
+		if callee.optional && isNullish(obj) {
+			return undefined, nil
+		}
+		if _, isSuper := callee.obj.(*superExpr); isSuper {
+			if f := e.thisFrame(); f != nil {
+				this = f.this
+			}
+			if fn, err = in.superMember(e, key); err != nil {
+				return nil, err
+			}
+		} else {
+			if isNullish(obj) {
+				return nil, in.throwError("TypeError", "Cannot read properties of %s (reading '%s')", toDisplayString(obj), key)
+			}
+			this = obj
+			if fn, err = in.getMember(obj, key); err != nil {
+				return nil, err
+			}
+		}
+	default:
+		var err error
+		if fn, err = in.eval(x.callee, e); err != nil {
+			return nil, err
+		}
+	}
+
+	if x.optional && isNullish(fn) {
+		return undefined, nil
+	}
+	args, err := in.evalArgs(x.args, e)
+	if err != nil {
+		return nil, err
+	}
+	if _, ok := fn.(*function); !ok {
+		return nil, in.throwError("TypeError", "%s is not a function", exprName(x.callee))
+	}
+	return in.call(fn, this, args)
+}
+
+// memberTarget evaluates a member expression's object and property key
+func (in *interp) memberTarget(m *memberExpr, e *env) (Value, string, error) {
+	var obj Value = undefined
+	if _, isSuper := m.obj.(*superExpr); !isSuper {
+		var err error
+		if obj, err = in.eval(m.obj, e); err != nil {
+			return nil, "", err
+		}
+	}
+	if m.computed == nil {
+		return obj, m.prop, nil
+	}
+	kv, err := in.eval(m.computed, e)
+	if err != nil {
+		return nil, "", err
+	}
+	return obj, in.propertyKey(kv), nil
+}
+
+func (in *interp) propertyKey(v Value) string {
+	if s, ok := v.(string); ok {
+		return s
+	}
+	return toDisplayString(v)
+}
+
+// exprName renders a callee for error messages, e.g. "user.greet"
+func exprName(x expr) string {
+	switch x := x.(type) {
+	case *ident:
+		return x.name
+	case *thisExpr:
+		return "this"
+	case *memberExpr:
+		if x.computed != nil {
+			return exprName(x.obj) + "[...]"
+		}
+		return exprName(x.obj) + "." + x.prop
+	case *callExpr:
+		return exprName(x.callee) + "(...)"
+	case *superExpr:
+		return "super"
+	}
+	return "expression"
+}
+
+func (in *interp) makeFunction(lit *funcLit, e *env, home *object) *function {
+	return &function{name: lit.name, lit: lit, env: e, home: home}
+}
+
+func (in *interp) makeClass(lit *classLit, e *env) (Value, error) {
+	protoParent, staticsParent := in.objectProto, (*object)(nil)
+	var parent *function
+	if lit.super != nil {
+		sv, err := in.eval(lit.super, e)
+		if err != nil {
+			return nil, err
+		}
+		switch sv := sv.(type) {
+		case nullType:
+			protoParent = nil
+		case *function:
+			if sv.lit != nil && sv.lit.arrow || sv.native != nil && !sv.ctor {
+				return nil, in.throwError("TypeError", "Class extends value %s is not a constructor or null", inspect(sv, 1, map[interface{}]bool{}))
+			}
+			parent = sv
+			protoParent = in.prototypeOf(sv)
+			staticsParent = in.staticsOf(sv)
+		default:
+			return nil, in.throwError("TypeError", "Class extends value %s is not a constructor or null", inspect(sv, 1, map[interface{}]bool{}))
+		}
+	}
+
+	classEnv := newEnv(e, nil)
+	f := &function{
+		name:    lit.name,
+		proto:   newObject(protoParent),
+		statics: newObject(staticsParent),
+		cls:     &class{parent: parent, env: classEnv},
+	}
+	f.proto.set("constructor", f)
+	if lit.name != "" {
+		in.declare(classEnv, lit.name, "const", f)
+	}
+	if lit.ctor != nil {
+		f.cls.ctor = &function{name: lit.name, lit: lit.ctor, env: classEnv, home: f.proto}
+	}
+
+	for _, m := range lit.members {
+		key := m.name
+		if m.computed != nil {
+			kv, err := in.eval(m.computed, classEnv)
+			if err != nil {
+				return nil, err
+			}
+			key = in.propertyKey(kv)
+		}
+		target := f.proto
+		if m.static {
+			target = f.statics
+		}
+		switch m.kind {
+		case "field":
+			if !m.static {
+				f.cls.fields = append(f.cls.fields, fieldInit{key: key, value: m.value})
+				continue
+			}
+			v := undefined
+			if m.value != nil {
+				var err error
+				staticEnv := newEnv(classEnv, &frame{name: lit.name, this: f, home: f.statics})
+				if v, err = in.evalNamed(m.value, staticEnv, &ident{name: key}); err != nil {
+					return nil, err
+				}
+			}
+			f.statics.set(key, v)
+		case "get":
+			if target.getters == nil {
+				target.getters = map[string]*function{}
+			}
+			target.getters[key] = &function{name: key, lit: m.fn, env: classEnv, home: target}
+		case "set":
+			if target.setters == nil {
+				target.setters = map[string]*function{}
+			}
+			target.setters[key] = &function{name: key, lit: m.fn, env: classEnv, home: target}
+		default:
+			target.set(key, &function{name: key, lit: m.fn, env: classEnv, home: target})
+		}
+	}
+	return f, nil
+}
+
+func (in *interp) prototypeOf(f *function) *object {
+	if f.proto == nil {
+		f.proto = newObject(in.objectProto)
+		f.proto.set("constructor", f)
+	}
+	return f.proto
+}
+
+func (in *interp) staticsOf(f *function) *object {
+	if f.statics == nil {
+		f.statics = newObject(nil)
+	}
+	return f.statics
+}
+
+func (in *interp) call(fv Value, this Value, args []Value) (Value, error) {
+	f, ok := fv.(*function)
+	if !ok {
+		return nil, in.throwError("TypeError", "%s is not a function", inspect(fv, 1, map[interface{}]bool{}))
+	}
+	if f.native != nil {
+		return f.native(in, this, args)
+	}
+	if f.cls != nil {
+		return nil, in.throwError("TypeError", "Class constructor %s cannot be invoked without 'new'", f.name)
+	}
+	return in.callUser(f, &frame{name: f.name, this: this, arrow: f.lit.arrow, home: f.home}, args)
+}
+
+func (in *interp) callUser(f *function, fr *frame, args []Value) (Value, error) {
+	in.depth++
+	defer func() { in.depth-- }()
+	if in.depth > in.opts.MaxDepth {
+		if !in.depthExceeded {
+			in.depthExceeded = true
+			in.sampleMemory(f.env)
+		}
+		return nil, in.throwError("RangeError", "Maximum call stack size exceeded")
+	}
+
+	fe := newEnv(f.env, fr)
+	in.stack = append(in.stack, fe)
+	defer func() { in.stack = in.stack[:len(in.stack)-1] }()
+	for i, p := range f.lit.params {
+		if p.rest {
+			rest := []Value{}
+			if i < len(args) {
+				rest = append(rest, args[i:]...)
+			}
+			if err := in.bind(p.target, &array{elems: rest}, "param", fe); err != nil {
+				return nil, err
+			}
+			break
+		}
+		v := undefined
+		if i < len(args) {
+			v = args[i]
+		}
+		if err := in.bindDefault(&patternElem{target: p.target, def: p.def}, v, "param", fe); err != nil {
+			return nil, err
+		}
+	}
+	if err := in.hoist(f.lit.body, fe, true); err != nil {
+		return nil, err
+	}
+	// arguments is left out of the names a trace shows
+	if _, ok := fe.vars["arguments"]; !ok && !f.lit.arrow {
+		fe.vars["arguments"] = &binding{value: &array{elems: append([]Value{}, args...)}, kind: "var"}
+	}
+	in.step("call", f.lit.ln, fe, nil)
+
+	if f.lit.exprBody != nil {
+		return in.eval(f.lit.exprBody, fe)
+	}
+	for _, s := range f.lit.body {
+		c, err := in.exec(s, fe)
+		if err != nil {
+			return nil, err
+		}
+		switch c.kind {
+		case ctlReturn:
+			return c.value, nil
+		case ctlBreak, ctlContinue:
+			return nil, in.throwError("SyntaxError", "Illegal break or continue statement")
+		}
+	}
+	return undefined, nil
+}
+
+// construct implements `new`; callee names the constructor in errors
+func (in *interp) construct(f *function, args []Value, callee expr) (Value, error) {
+	if f.lit != nil && f.lit.arrow || f.native != nil && !f.ctor {
+		return nil, in.throwError("TypeError", "%s is not a constructor", exprName(callee))
+	}
+	obj := newObject(in.prototypeOf(f))
+	return in.initialize(f, obj, args)
+}
+
+// initialize runs f's constructor chain on obj, returning the constructed
+// value
+func (in *interp) initialize(f *function, obj *object, args []Value) (Value, error) {
+	switch {
+	case f.native != nil:
+		v, err := f.native(in, obj, args)
+		if err != nil {
+			return nil, err
+		}
+		switch v.(type) {
+		case *object, *array, *function:
+			return v, nil
+		}
+		return obj, nil
+
+	case f.cls != nil:
+		cls := f.cls
+		if cls.parent == nil {
+			if err := in.initFields(f, obj); err != nil {
+				return nil, err
+			}
+		}
+		if cls.ctor == nil {
+			if cls.parent != nil {
+				if _, err := in.initialize(cls.parent, obj, args); err != nil {
+					return nil, err
+				}
+				if err := in.initFields(f, obj); err != nil {
+					return nil, err
+				}
+			}
+			return obj, nil
+		}
+		v, err := in.callUser(cls.ctor, &frame{name: f.name, this: obj, home: f.proto, class: f}, args)
+		if err != nil {
+			return nil, err
+		}
+		if o, ok := v.(*object); ok {
+			return o, nil
+		}
+		return obj, nil
+	}
+
+	v, err := in.callUser(f, &frame{name: f.name, this: obj, home: f.home}, args)
+	if err != nil {
+		return nil, err
+	}
+	switch v.(type) {
+	case *object, *array, *function:
+		return v, nil
+	}
+	return obj, nil
+}
+
+func (in *interp) initFields(f *function, obj *object) error {
+	if len(f.cls.fields) == 0 {
+		return nil
+	}
+	fe := newEnv(f.cls.env, &frame{name: f.name, this: obj, home: f.proto})
+	for _, field := range f.cls.fields {
+		v := undefined
+		if field.value != nil {
+			var err error
+			if v, err = in.evalNamed(field.value, fe, &ident{name: field.key}); err != nil {
+				return err
+			}
+		}
+		obj.set(field.key, v)
+	}
+	return nil
+}
+
+func (in *interp) superCall(x *callExpr, e *env) (Value, error) {
+	fr := e.thisFrame()
+	if fr == nil || fr.class == nil || fr.class.cls.parent == nil {
+		return nil, in.throwError("SyntaxError", "'super' keyword unexpected here")
+	}
+	args, err := in.evalArgs(x.args, e)
+	if err != nil {
+		return nil, err
+	}
+	obj, ok := fr.this.(*object)
+	if !ok {
+		return nil, in.throwError("TypeError", "invalid super() call")
+	}
+	if _, err := in.initialize(fr.class.cls.parent, obj, args); err != nil {
+		return nil, err
+	}
+	return undefined, in.initFields(fr.class, obj)
+}
+
+func (in *interp) superMember(e *env, key string) (Value, error) {
+	fr := e.thisFrame()
+	if fr == nil || fr.home == nil {
+		return nil, in.throwError("SyntaxError", "'super' keyword unexpected here")
+	}
+	if fr.home.proto == nil {
+		return undefined, nil
+	}
+	return in.getProp(fr.home.proto, key, fr.this)
+}
+
+func arrayIndex(key string) (int, bool) {
+	if !isArrayIndex(key) || len(key) > 9 {
+		return 0, false
+	}
+	n := 0
+	for _, c := range key {
+		n = n*10 + int(c-'0')
+	}
+	return n, true
+}
+
+func (in *interp) getProp(o *object, key string, this Value) (Value, error) {
+	for p := o; p != nil; p = p.proto {
+		if g, ok := p.getters[key]; ok {
+			return in.call(g, this, nil)
+		}
+		if _, ok := p.setters[key]; ok {
+			return undefined, nil
+		}
+		if v, ok := p.props[key]; ok {
+			return v, nil
+		}
+	}
+	return undefined, nil
+}
+
+func (in *interp) getMember(v Value, key string) (Value, error) {
+	switch o := v.(type) {
+	case undefinedType, nullType:
+		return nil, in.throwError("TypeError", "Cannot read properties of %s (reading '%s')", toDisplayString(v), key)
+	case string:
+		runes := []rune(o)
+		if key == "length" {
+			return float64(len(runes)), nil
+		}
+		if i, ok := arrayIndex(key); ok {
+			if i < len(runes) {
+				return string(runes[i]), nil
+			}
+			return undefined, nil
+		}
+		return in.getProp(in.stringProto, key, o)
+	case float64:
+		return in.getProp(in.numberProto, key, o)
+	case bool:
+		return in.getProp(in.booleanProto, key, o)
+	case *array:
+		if key == "length" {
+			return float64(len(o.elems)), nil
+		}
+		if i, ok := arrayIndex(key); ok {
+			if i < len(o.elems) {
+				return o.elems[i], nil
+			}
+			return undefined, nil
+		}
+		return in.getProp(in.arrayProto, key, o)
+	case *object:
+		return in.getProp(o, key, o)
+	case *function:
+		switch key {
+		case "prototype":
+			if o.native == nil || o.ctor {
+				return in.prototypeOf(o), nil
+			}
+		case "name":
+			return o.name, nil
+		case "length":
+			if o.lit != nil {
+				return float64(len(o.lit.params)), nil
+			}
+			return 0.0, nil
+		}
+		if o.statics != nil {
+			if v, err := in.getProp(o.statics, key, o); err != nil || v != undefined {
+				return v, err
+			}
+		}
+		return in.getProp(in.functionProto, key, o)
+	}
+	return undefined, nil
+}
+
+func (in *interp) setMember(v Value, key string, value Value) error {
+	switch o := v.(type) {
+	case undefinedType, nullType:
+		return in.throwError("TypeError", "Cannot set properties of %s (setting '%s')", toDisplayString(v), key)
+	case *array:
+		if key == "length" {
+			n, err := in.toNumber(value)
+			if err != nil {
+				return err
+			}
+			if n < 0 || n != math.Trunc(n) || n > maxArrayLength {
+				return in.throwError("RangeError", "Invalid array length")
+			}
+			for len(o.elems) < int(n) {
+				o.elems = append(o.elems, undefined)
+			}
+			o.elems = o.elems[:int(n)]
+			return nil
+		}
+		if i, ok := arrayIndex(key); ok {
+			if i >= maxArrayLength {
+				return in.throwError("RangeError", "Invalid array length")
+			}
+			for len(o.elems) <= i {
+				o.elems = append(o.elems, undefined)
+			}
+			o.elems[i] = value
+		}
+		return nil
+	case *object:
+		if o.frozen {
+			return nil
+		}
+		for p := o; p != nil; p = p.proto {
+			if s, ok := p.setters[key]; ok {
+				_, err := in.call(s, o, []Value{value})
+				return err
+			}
+			if _, ok := p.getters[key]; ok {
+				return nil
+			}
+			if _, ok := p.props[key]; ok {
+				break
+			}
+		}
+		o.set(key, value)
+		return nil
+	case *function:
+		// assigning a constructor's prototype, as ES5 subclasses do,
+		// makes it the prototype of what it constructs
+		if p, ok := value.(*object); ok && key == "prototype" && (o.native == nil || o.ctor) {
+			o.proto = p
+			return nil
+		}
+		in.staticsOf(o).set(key, value)
+		return nil
+	}
+	return nil
+}
+
+// enumerableKeys lists the keys for-in and object spread visit
+func (in *interp) enumerableKeys(v Value) []string {
+	switch o := v.(type) {
+	case *object:
+		if _, ok := o.internal.(*orderedMap); ok {
+			return nil
+		}
+		return o.ownKeys()
+	case *array:
+		keys := make([]string, len(o.elems))
+		for i := range o.elems {
+			keys[i] = numberToString(float64(i))
+		}
+		return keys
+	case string:
+		keys := []string{}
+		for i := range []rune(o) {
+			keys = append(keys, numberToString(float64(i)))
+		}
+		return keys
+	case *function:
+		if o.statics != nil {
+			return o.statics.ownKeys()
+		}
+	}
+	return nil
+}
+
+// iterate lists the values for-of and spread visit
+func (in *interp) iterate(v Value) ([]Value, error) {
+	switch o := v.(type) {
+	case *array:
+		return append([]Value(nil), o.elems...), nil
+	case string:
+		items := []Value{}
+		for _, r := range o {
+			items = append(items, string(r))
+		}
+		return items, nil
+	case *object:
+		if m, ok := o.internal.(*orderedMap); ok {
+			items := make([]Value, len(m.entries))
+			for i, entry := range m.entries {
+				if m.isSet {
+					items[i] = entry.key
+				} else {
+					items[i] = &array{elems: []Value{entry.key, entry.value}}
+				}
+			}
+			return items, nil
+		}
+	}
+	return nil, in.throwError("TypeError", "%s is not iterable", inspect(v, 1, map[interface{}]bool{}))
+}
+
+// toPrimitive converts objects using a user-defined valueOf or toString
+func (in *interp) toPrimitive(v Value) (Value, error) {
+	o, ok := v.(*object)
+	if !ok {
+		switch v := v.(type) {
+		case *array:
+			parts := make([]string, len(v.elems))
+			for i, e := range v.elems {
+				if !isNullish(e) {
+					s, err := in.toString(e)
+					if err != nil {
+						return nil, err
+					}
+					parts[i] = s
+				}
+			}
+			return strings.Join(parts, ","), nil
+		case *function:
+			return toDisplayString(v), nil
+		}
+		return v, nil
+	}
+	for _, name := range []string{"valueOf", "toString"} {
+		method, err := in.getProp(o, name, o)
+		if err != nil {
+			return nil, err
+		}
+		if fn, ok := method.(*function); ok && fn.native == nil {
+			result, err := in.call(fn, o, nil)
+			if err != nil {
+				return nil, err
+			}
+			switch result.(type) {
+			case *object, *array, *function:
+				continue
+			}
+			return result, nil
+		}
+	}
+	return toDisplayString(o), nil
+}
+
+func (in *interp) toString(v Value) (string, error) {
+	p, err := in.toPrimitive(v)
+	if err != nil {
+		return "", err
+	}
+	return toDisplayString(p), nil
+}
+
+func (in *interp) toNumber(v Value) (float64, error) {
+	switch v := v.(type) {
+	case float64:
+		return v, nil
+	case undefinedType:
+		return math.NaN(), nil
+	case nullType:
+		return 0, nil
+	case bool:
+		if v {
+			return 1, nil
+		}
+		return 0, nil
+	case string:
+		return stringToNumber(v), nil
+	case *object:
+		// a Date converts to its time, unlike other objects
+		if d, ok := v.internal.(date); ok {
+			return float64(d), nil
+		}
+	}
+	p, err := in.toPrimitive(v)
+	if err != nil {
+		return 0, err
+	}
+	return in.toNumber(p)
+}
+
+func (in *interp) binary(op string, l, r Value) (Value, error) {
+	switch op {
+	case "===":
+		return strictEquals(l, r), nil
+	case "!==":
+		return !strictEquals(l, r), nil
+	case "==", "!=":
+		eq, err := in.looseEquals(l, r)
+		if op == "!=" {
+			eq = !eq
+		}
+		return eq, err
+	case "instanceof":
+		f, ok := r.(*function)
+		if !ok {
+			return nil, in.throwError("TypeError", "Right-hand side of 'instanceof' is not callable")
+		}
+		return in.instanceOf(l, f), nil
+	case "in":
+		switch o := r.(type) {
+		case *object:
+			key := in.propertyKey(l)
+			for p := o; p != nil; p = p.proto {
+				_, has := p.props[key]
+				_, getter := p.getters[key]
+				if has || getter {
+					return true, nil
+				}
+			}
+			return false, nil
+		case *array:
+			key := in.propertyKey(l)
+			i, ok := arrayIndex(key)
+			return ok && i < len(o.elems) || key == "length", nil
+		}
+		return nil, in.throwError("TypeError", "Cannot use 'in' operator to search for '%s' in %s", in.propertyKey(l), toDisplayString(r))
+	}
+
+	if op == "+" {
+		lp, err := in.toPrimitive(l)
+		if err != nil {
+			return nil, err
+		}
+		rp, err := in.toPrimitive(r)
+		if err != nil {
+			return nil, err
+		}
+		_, ls := lp.(string)
+		_, rs := rp.(string)
+		if ls || rs {
+			s := toDisplayString(lp) + toDisplayString(rp)
+			if len(s) > maxStringLength {
+				return nil, in.throwError("RangeError", "Invalid string length")
+			}
+			return s, in.allocate(len(s))
+		}
+		l, r = lp, rp
+	}
+
+	switch op {
+	case "<", ">", "<=", ">=":
+		lp, err := in.toPrimitive(l)
+		if err != nil {
+			return nil, err
+		}
+		rp, err := in.toPrimitive(r)
+		if err != nil {
+			return nil, err
+		}
+		if ls, ok := lp.(string); ok {
+			if rs, ok := rp.(string); ok {
+				switch op {
+				case "<":
+					return ls < rs, nil
+				case ">":
+					return ls > rs, nil
+				case "<=":
+					return ls <= rs, nil
+				}
+				return ls >= rs, nil
+			}
+		}
+		l, r = lp, rp
+	}
+
+	a, err := in.toNumber(l)
+	if err != nil {
+		return nil, err
+	}
+	b, err := in.toNumber(r)
+	if err != nil {
+		return nil, err
+	}
+	switch op {
+	case "+":
+		return a + b, nil
+	case "-":
+		return a - b, nil
+	case "*":
+		return a * b, nil
+	case "/":
+		return a / b, nil
+	case "%":
+		if b == 0 || math.IsInf(a, 0) {
+			return math.NaN(), nil
+		}
+		return math.Mod(a, b), nil
+	case "**":
+		return math.Pow(a, b), nil
+	case "<":
+		return a < b, nil
+	case ">":
+		return a > b, nil
+	case "<=":
+		return a <= b, nil
+	case ">=":
+		return a >= b, nil
+	case "&":
+		return float64(toInt32(a) & toInt32(b)), nil
+	case "|":
+		return float64(toInt32(a) | toInt32(b)), nil
+	case "^":
+		return float64(toInt32(a) ^ toInt32(b)), nil
+	case "<<":
+		return float64(toInt32(a) << (uint32(toInt32(b)) & 31)), nil
+	case ">>":
+		return float64(toInt32(a) >> (uint32(toInt32(b)) & 31)), nil
+	case ">>>":
+		return float64(uint32(toInt32(a)) >> (uint32(toInt32(b)) & 31)), nil
+	}
+	return nil, in.throwError("SyntaxError", "unsupported operator %s", op)
+}
+
+func (in *interp) looseEquals(l, r Value) (bool, error) {
+	if isNullish(l) || isNullish(r) {
+		return isNullish(l) && isNullish(r), nil
+	}
+	if typeOf(l) == typeOf(r) {
+		return strictEquals(l, r), nil
+	}
+	lObj, rObj := typeOf(l) == "object" || typeOf(l) == "function", typeOf(r) == "object" || typeOf(r) == "function"
+	if lObj && rObj {
+		return l == r, nil
+	}
+	if lObj {
+		p, err := in.toPrimitive(l)
+		if err != nil {
+			return false, err
+		}
+		return in.looseEquals(p, r)
+	}
+	if rObj {
+		p, err := in.toPrimitive(r)
+		if err != nil {
+			return false, err
+		}
+		return in.looseEquals(l, p)
+	}
+	a, _ := in.toNumber(l)
+	b, _ := in.toNumber(r)
+	return a == b, nil
+}
+
+func (in *interp) instanceOf(v Value, f *function) bool {
+	if _, ok := v.(*array); ok {
+		return f == in.arrayCtor || in.prototypeOf(f) == in.objectProto
+	}
+	var proto *object
+	switch o := v.(type) {
+	case *object:
+		proto = o.proto
+	case *function:
+		proto = in.functionProto
+	default:
+		return false
+	}
+	target := in.prototypeOf(f)
+	for p := proto; p != nil; p = p.proto {
+		if p == target {
+			return true
+		}
+	}
+	return false
+}
+
+// runTimers drains setTimeout callbacks in delay order once the program
+// has finished
+func (in *interp) runTimers() error {
+	for len(in.timers) > 0 {
+		sort.SliceStable(in.timers, func(i, j int) bool { return in.timers[i].delay < in.timers[j].delay })
+		t := in.timers[0]
+		in.timers = in.timers[1:]
+		in.clock = t.delay
+		if _, err := in.call(t.fn, undefined, t.args); err != nil {
+			return err
+		}
+		if err := in.tick(in.line); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,373 @@
+package sandbox
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+type tokenKind int
+
+const (
+	tokEOF tokenKind = iota
+	tokIdent
+	tokKeyword
+	tokNumber
+	tokString
+	tokTemplate
+	tokPunct
+)
+
+// token is one lexeme. nl records a line break before it, which drives
+// automatic semicolon insertion.
+type token struct {
+	kind  tokenKind
+	value string
+	num   float64
+	parts []string   // template literal: raw chunks around the ${} holes
+	exprs []string   // template literal: the hole sources
+	holes []position // template literal: where each hole source starts
+	line  int
+	col   int
+	nl    bool
+}
+
+var keywords = map[string]bool{
+	"var": true, "let": true, "const": true, "function": true, "return": true,
+	"if": true, "else": true, "for": true, "while": true, "do": true,
+	"break": true, "continue": true, "new": true, "this": true, "class": true,
+	"extends": true, "super": true, "null": true, "undefined": true,
+	"true": true, "false": true, "typeof": true, "instanceof": true, "in": true,
+	"of": true, "throw": true, "try": true, "catch": true, "finally": true,
+	"switch": true, "case": true, "default": true, "delete": true, "void": true,
+	"async": true, "await": true, "import": true, "export": true, "static": true,
+	"get": true, "set": true, "from": true,
+}
+
+// contextual keywords may also be used as identifiers
+var contextual = map[string]bool{
+	"of": true, "async": true, "await": true, "static": true, "get": true,
+	"set": true, "from": true, "undefined": true,
+}
+
+var puncts = []string{
+	">>>=", "...", "===", "!==", "**=", "<<=", ">>=", ">>>", "??=", "&&=", "||=",
+	"=>", "==", "!=", "<=", ">=", "&&", "||", "??", "?.", "++", "--", "+=", "-=",
+	"*=", "/=", "%=", "&=", "|=", "^=", "**", "<<", ">>",
+	"{", "}", "(", ")", "[", "]", ";", ",", "<", ">", "+", "-", "*", "/", "%",
+	"&", "|", "^", "!", "~", "?", ":", "=", ".", "@", "#",
+}
+
+// SyntaxError is a parse failure at a source position
+type SyntaxError struct {
+	Line    int
+	Column  int
+	Message string
+}
+
+func (e *SyntaxError) Error() string {
+	return fmt.Sprintf("SyntaxError: %s (line %d:%d)", e.Message, e.Line, e.Column)
+}
+
+// position is a line and column in the source
+type position struct{ line, col int }
+
+type lexer struct {
+	src  string
+	pos  int
+	line int
+	col  int
+	prev *token
+}
+
+func tokenize(src string) ([]token, error) {
+	lx := &lexer{src: src, line: 1, col: 1}
+	tokens := []token{}
+	for {
+		tok, err := lx.next()
+		if err != nil {
+			return nil, err
+		}
+		tokens = append(tokens, tok)
+		if tok.kind == tokEOF {
+			return tokens, nil
+		}
+		lx.prev = &tokens[len(tokens)-1]
+	}
+}
+
+func (lx *lexer) errorf(format string, args ...interface{}) error {
+	return &SyntaxError{Line: lx.line, Column: lx.col, Message: fmt.Sprintf(format, args...)}
+}
+
+func (lx *lexer) advance(n int) {
+	for i := 0; i < n && lx.pos < len(lx.src); {
+		r, size := utf8.DecodeRuneInString(lx.src[lx.pos:])
+		lx.pos += size
+		i += size
+		if r == '\n' {
+			lx.line++
+			lx.col = 1
+		} else {
+			lx.col++
+		}
+	}
+}
+
+func (lx *lexer) next() (token, error) {
+	nl := false
+	for lx.pos < len(lx.src) {
+		c := lx.src[lx.pos]
+		switch {
+		case c == '\n':
+			nl = true
+			lx.advance(1)
+		case c == ' ' || c == '\t' || c == '\r':
+			lx.advance(1)
+		case strings.HasPrefix(lx.src[lx.pos:], "//"):
+			end := strings.IndexByte(lx.src[lx.pos:], '\n')
+			if end < 0 {
+				end = len(lx.src) - lx.pos
+			}
+			lx.advance(end)
+		case strings.HasPrefix(lx.src[lx.pos:], "/*"):
+			end := strings.Index(lx.src[lx.pos+2:], "*/")
+			if end < 0 {
+				return token{}, lx.errorf("unterminated comment")
+			}
+			if strings.Contains(lx.src[lx.pos:lx.pos+end+4], "\n") {
+				nl = true
+			}
+			lx.advance(end + 4)
+		default:
+			r, _ := utf8.DecodeRuneInString(lx.src[lx.pos:])
+			if unicode.IsSpace(r) {
+				lx.advance(1)
+				continue
+			}
+			goto scan
+		}
+	}
+scan:
+	tok := token{line: lx.line, col: lx.col, nl: nl}
+	if lx.pos >= len(lx.src) {
+		tok.kind = tokEOF
+		return tok, nil
+	}
+
+	rest := lx.src[lx.pos:]
+	r, _ := utf8.DecodeRuneInString(rest)
+	switch {
+	case isIdentStart(r):
+		end := 0
+		for end < len(rest) {
+			r, size := utf8.DecodeRuneInString(rest[end:])
+			if !isIdentPart(r) {
+				break
+			}
+			end += size
+		}
+		tok.value = rest[:end]
+		tok.kind = tokIdent
+		if keywords[tok.value] {
+			tok.kind = tokKeyword
+		}
+		lx.advance(end)
+	case r >= '0' && r <= '9' || r == '.' && len(rest) > 1 && rest[1] >= '0' && rest[1] <= '9':
+		return lx.number(tok)
+	case r == '"' || r == '\'':
+		value, err := lx.quoted(byte(r))
+		if err != nil {
+			return tok, err
+		}
+		tok.kind, tok.value = tokString, value
+	case r == '`':
+		return lx.template(tok)
+	default:
+		for _, p := range puncts {
+			if strings.HasPrefix(rest, p) {
+				tok.kind, tok.value = tokPunct, p
+				lx.advance(len(p))
+				return tok, nil
+			}
+		}
+		return tok, lx.errorf("unexpected character %q", r)
+	}
+	return tok, nil
+}
+
+func (lx *lexer) number(tok token) (token, error) {
+	rest := lx.src[lx.pos:]
+	end := 0
+	if len(rest) > 1 && rest[0] == '0' && strings.ContainsRune("xXbBoO", rune(rest[1])) {
+		end = 2
+		for end < len(rest) && (isHexDigit(rest[end]) || rest[end] == '_') {
+			end++
+		}
+		text := strings.ReplaceAll(rest[:end], "_", "")
+		n, err := strconv.ParseInt(text[2:], map[byte]int{'x': 16, 'X': 16, 'b': 2, 'B': 2, 'o': 8, 'O': 8}[text[1]], 64)
+		if err != nil {
+			return tok, lx.errorf("invalid number %s", rest[:end])
+		}
+		tok.kind, tok.num, tok.value = tokNumber, float64(n), rest[:end]
+		lx.advance(end)
+		return tok, nil
+	}
+	for end < len(rest) && (rest[end] >= '0' && rest[end] <= '9' || rest[end] == '.' || rest[end] == '_') {
+		end++
+	}
+	if end < len(rest) && (rest[end] == 'e' || rest[end] == 'E') {
+		end++
+		if end < len(rest) && (rest[end] == '+' || rest[end] == '-') {
+			end++
+		}
+		for end < len(rest) && rest[end] >= '0' && rest[end] <= '9' {
+			end++
+		}
+	}
+	n, err := strconv.ParseFloat(strings.ReplaceAll(rest[:end], "_", ""), 64)
+	if err != nil {
+		return tok, lx.errorf("invalid number %s", rest[:end])
+	}
+	tok.kind, tok.num, tok.value = tokNumber, n, rest[:end]
+	lx.advance(end)
+	if end < len(rest) && rest[end] == 'n' {
+		lx.advance(1)
+	}
+	return tok, nil
+}
+
+func (lx *lexer) quoted(quote byte) (string, error) {
+	var b strings.Builder
+	lx.advance(1)
+	for lx.pos < len(lx.src) {
+		c := lx.src[lx.pos]
+		switch {
+		case c == quote:
+			lx.advance(1)
+			return b.String(), nil
+		case c == '\n':
+			return "", lx.errorf("unterminated string")
+		case c == '\\':
+			if err := lx.escape(&b); err != nil {
+				return "", err
+			}
+		default:
+			r, size := utf8.DecodeRuneInString(lx.src[lx.pos:])
+			b.WriteRune(r)
+			lx.advance(size)
+		}
+	}
+	return "", lx.errorf("unterminated string")
+}
+
+func (lx *lexer) escape(b *strings.Builder) error {
+	lx.advance(1)
+	if lx.pos >= len(lx.src) {
+		return lx.errorf("unterminated string")
+	}
+	c := lx.src[lx.pos]
+	simple := map[byte]string{'n': "\n", 't': "\t", 'r': "\r", 'b': "\b", 'f': "\f", 'v': "\v", '0': "\x00"}
+	switch {
+	case simple[c] != "":
+		b.WriteString(simple[c])
+		lx.advance(1)
+	case c == '\n':
+		lx.advance(1)
+	case c == 'u' || c == 'x':
+		digits := 2
+		start := lx.pos + 1
+		if c == 'u' {
+			digits = 4
+			if start < len(lx.src) && lx.src[start] == '{' {
+				end := strings.IndexByte(lx.src[start:], '}')
+				if end < 0 {
+					return lx.errorf("invalid unicode escape")
+				}
+				n, err := strconv.ParseUint(lx.src[start+1:start+end], 16, 32)
+				if err != nil {
+					return lx.errorf("invalid unicode escape")
+				}
+				b.WriteRune(rune(n))
+				lx.advance(end + 2)
+				return nil
+			}
+		}
+		if start+digits > len(lx.src) {
+			return lx.errorf("invalid escape")
+		}
+		n, err := strconv.ParseUint(lx.src[start:start+digits], 16, 32)
+		if err != nil {
+			return lx.errorf("invalid escape")
+		}
+		b.WriteRune(rune(n))
+		lx.advance(digits + 1)
+	default:
+		r, size := utf8.DecodeRuneInString(lx.src[lx.pos:])
+		b.WriteRune(r)
+		lx.advance(size)
+	}
+	return nil
+}
+
+// template scans a template literal into its string chunks and the source
+// of each ${} hole; holes are parsed later as expressions
+func (lx *lexer) template(tok token) (token, error) {
+	tok.kind = tokTemplate
+	var b strings.Builder
+	lx.advance(1)
+	for lx.pos < len(lx.src) {
+		c := lx.src[lx.pos]
+		switch {
+		case c == '`':
+			lx.advance(1)
+			tok.parts = append(tok.parts, b.String())
+			return tok, nil
+		case c == '\\':
+			if err := lx.escape(&b); err != nil {
+				return tok, err
+			}
+		case c == '$' && lx.pos+1 < len(lx.src) && lx.src[lx.pos+1] == '{':
+			tok.parts = append(tok.parts, b.String())
+			b.Reset()
+			lx.advance(2)
+			depth, start := 1, lx.pos
+			tok.holes = append(tok.holes, position{lx.line, lx.col})
+			for lx.pos < len(lx.src) && depth > 0 {
+				switch lx.src[lx.pos] {
+				case '{':
+					depth++
+				case '}':
+					depth--
+				}
+				if depth > 0 {
+					lx.advance(1)
+				}
+			}
+			if depth > 0 {
+				return tok, lx.errorf("unterminated template literal")
+			}
+			tok.exprs = append(tok.exprs, lx.src[start:lx.pos])
+			lx.advance(1)
+		default:
+			r, size := utf8.DecodeRuneInString(lx.src[lx.pos:])
+			b.WriteRune(r)
+			lx.advance(size)
+		}
+	}
+	return tok, lx.errorf("unterminated template literal")
+}
+
+func isIdentStart(r rune) bool {
+	return r == '_' || r == '$' || unicode.IsLetter(r)
+}
+
+func isIdentPart(r rune) bool {
+	return isIdentStart(r) || unicode.IsDigit(r) || r == '\u200c' || r == '\u200d'
+}
+
+func isHexDigit(c byte) bool {
+	return c >= '0' && c <= '9' || c >= 'a' && c <= 'f' || c >= 'A' && c <= 'F'
+}
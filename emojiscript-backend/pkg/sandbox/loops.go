@@ -0,0 +1,234 @@
+package sandbox
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// LoopWarning is a loop that looks like it never ends
+type LoopWarning struct {
+	Line    int    `json:"line"`
+	Message string `json:"message"`
+}
+
+func (w LoopWarning) String() string {
+	return fmt.Sprintf("Line %d: %s", w.Line, w.Message)
+}
+
+// CheckLoops looks for loops that obviously never end without running
+// them: a loop whose condition is always true and that nothing in it
+// leaves, and a loop whose condition reads only variables nothing in it
+// changes. It is a heuristic that stays quiet when unsure, e.g. when the
+// loop calls a function that might change the variables. Code that
+// doesn't parse has no warnings.
+func CheckLoops(code string) []LoopWarning {
+	tree, err := Tree(code)
+	if err != nil {
+		return nil
+	}
+	var warnings []LoopWarning
+	var walk func(n *Node, label string)
+	walk = func(n *Node, label string) {
+		switch n.Kind {
+		case "WhileStatement", "DoWhileStatement", "ForStatement":
+			if message := checkLoop(n, label); message != "" {
+				warnings = append(warnings, LoopWarning{Line: n.Line, Message: message})
+			}
+		case "LabeledStatement":
+			for _, child := range n.Children {
+				walk(child, n.Label)
+			}
+			return
+		}
+		for _, child := range n.Children {
+			walk(child, "")
+		}
+	}
+	walk(tree, "")
+	return warnings
+}
+
+// checkLoop describes why loop never ends, or returns "". label is the
+// loop's own label, if it has one.
+func checkLoop(loop *Node, label string) string {
+	test, body, update := child(loop, "test"), child(loop, "body"), child(loop, "update")
+	if body != nil && leaves(body, label, 0) {
+		return ""
+	}
+	if alwaysTrue(test) {
+		return "this loop never ends: its condition is always true and nothing in it breaks out"
+	}
+
+	read := map[string]bool{}
+	if !readsOnly(test, read, false) || len(read) == 0 {
+		return ""
+	}
+	assigned, mutated, sure := map[string]bool{}, map[string]bool{}, true
+	for _, n := range []*Node{body, update} {
+		if n != nil {
+			sure = changes(n, assigned, mutated) && sure
+		}
+	}
+	if !sure {
+		return ""
+	}
+	var unchanged []string
+	for name, throughProperty := range read {
+		if assigned[name] || throughProperty && mutated[name] {
+			return ""
+		}
+		unchanged = append(unchanged, name)
+	}
+	sort.Strings(unchanged)
+	return fmt.Sprintf("this loop may never end: nothing in it changes %s, which its condition reads", strings.Join(unchanged, ", "))
+}
+
+// child returns n's child in role, or nil
+func child(n *Node, role string) *Node {
+	for _, c := range n.Children {
+		if c.Role == role {
+			return c
+		}
+	}
+	return nil
+}
+
+// alwaysTrue reports whether a loop condition is a truthy literal; a
+// missing condition, as in for (;;), is true
+func alwaysTrue(test *Node) bool {
+	if test == nil {
+		return true
+	}
+	if test.Kind != "Literal" {
+		return false
+	}
+	switch test.Label {
+	case "false", "null", "0", "NaN", `""`, "''":
+		return false
+	}
+	return true
+}
+
+// leaves reports whether n can leave the loop labeled label: a return or
+// throw, a break out of it, or a break or continue to another label,
+// which may be an outer one. depth counts the loops and switches inside
+// the loop that n is in, which an unlabeled break only leaves. Nested
+// functions are skipped.
+func leaves(n *Node, label string, depth int) bool {
+	switch n.Kind {
+	case "ReturnStatement", "ThrowStatement":
+		return true
+	case "BreakStatement":
+		return n.Label != "" || depth == 0
+	case "ContinueStatement":
+		return n.Label != "" && n.Label != label
+	case "FunctionDeclaration", "FunctionExpression", "ArrowFunctionExpression", "ClassDeclaration", "ClassExpression":
+		return false
+	case "WhileStatement", "DoWhileStatement", "ForStatement", "ForInStatement", "ForOfStatement", "SwitchStatement":
+		depth++
+	}
+	for _, c := range n.Children {
+		if leaves(c, label, depth) {
+			return true
+		}
+	}
+	return false
+}
+
+// readsOnly collects the variables a loop condition reads, true for
+// those it reads a property of, reporting false when the condition could
+// change something itself, by assigning or calling
+func readsOnly(n *Node, read map[string]bool, throughProperty bool) bool {
+	switch n.Kind {
+	case "Identifier":
+		if n.Label != "undefined" {
+			read[n.Label] = read[n.Label] || throughProperty
+		}
+		return true
+	case "Literal", "ThisExpression":
+		return true
+	case "MemberExpression":
+		for _, c := range n.Children {
+			if !readsOnly(c, read, c.Role == "object") {
+				return false
+			}
+		}
+		return true
+	case "BinaryExpression", "LogicalExpression", "ConditionalExpression":
+	case "UnaryExpression":
+		if n.Label == "delete" {
+			return false
+		}
+	default:
+		return false
+	}
+	for _, c := range n.Children {
+		if !readsOnly(c, read, false) {
+			return false
+		}
+	}
+	return true
+}
+
+// changes collects the variables n assigns, and those whose contents it
+// may change: targets of property assignments, receivers of method calls
+// and arguments passed to calls. It reports false when it can't tell,
+// because n calls a function by name (which may assign the variables it
+// closes over) or awaits.
+func changes(n *Node, assigned, mutated map[string]bool) bool {
+	switch n.Kind {
+	case "AssignmentExpression", "UpdateExpression":
+		markTarget(n.Children[0], assigned, mutated)
+	case "ForInStatement", "ForOfStatement":
+		markTarget(child(n, "left"), assigned, mutated)
+	case "CallExpression", "NewExpression":
+		callee := child(n, "callee")
+		if callee.Kind != "MemberExpression" && !pureBuiltins[callee.Label] {
+			return false
+		}
+		if callee.Kind == "MemberExpression" {
+			markTarget(child(callee, "object"), mutated, mutated)
+		}
+		for _, arg := range n.Children {
+			if arg.Role == "arguments" {
+				markTarget(arg, mutated, mutated)
+			}
+		}
+	case "AwaitExpression":
+		return false
+	}
+	sure := true
+	for _, c := range n.Children {
+		sure = changes(c, assigned, mutated) && sure
+	}
+	return sure
+}
+
+// pureBuiltins are global functions that change none of the program's
+// variables
+var pureBuiltins = map[string]bool{
+	"Number": true, "String": true, "Boolean": true, "parseInt": true, "parseFloat": true,
+	"isNaN": true, "isFinite": true, "prompt": true, "Array": true, "Object": true,
+}
+
+// markTarget marks the variables an assignment target changes: a name
+// or every name in a destructuring pattern in assigned, and the root of
+// a property such as a.b or a[i].c in mutated
+func markTarget(n *Node, assigned, mutated map[string]bool) {
+	if n == nil {
+		return
+	}
+	switch n.Kind {
+	case "Identifier":
+		assigned[n.Label] = true
+	case "MemberExpression":
+		markTarget(child(n, "object"), mutated, mutated)
+	case "ArrayPattern", "ObjectPattern", "Property", "RestElement", "AssignmentPattern", "VariableDeclaration", "VariableDeclarator":
+		for _, c := range n.Children {
+			if c.Role != "key" && c.Role != "right" && c.Role != "init" {
+				markTarget(c, assigned, mutated)
+			}
+		}
+	}
+}
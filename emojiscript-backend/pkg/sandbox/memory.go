@@ -0,0 +1,147 @@
+package sandbox
+
+// memorySampleSteps is how often, in statements, a run measures the
+// memory its values hold
+const memorySampleSteps = 1024
+
+// memorySampleBytes is how much a run may build in strings and arrays
+// between samples, so a few statements that make large values can't run
+// far past MaxMemory before it is measured
+const memorySampleBytes = 1 << 20
+
+// Rough sizes, in bytes, of the interpreter's structures. They are meant
+// to rank programs against each other, not to match the Go heap.
+const (
+	wordSize     = 8
+	stringSize   = 16
+	objectSize   = 64
+	propertySize = 32
+	arraySize    = 24
+	elementSize  = 16
+	functionSize = 64
+	envSize      = 48
+	bindingSize  = 48
+)
+
+// allocate accounts for a new string or array of about size bytes,
+// measuring memory once enough has been built since the last sample
+func (in *interp) allocate(size int) error {
+	in.allocated += size
+	if in.allocated < memorySampleBytes {
+		return nil
+	}
+	return in.sampleMemory(in.scope)
+}
+
+// sampleMemory measures what the running program can reach from e, the
+// call stack and the globals, and keeps the largest size seen. It stops
+// the run when that is over MaxMemory.
+func (in *interp) sampleMemory(e *env) error {
+	in.allocated = 0
+	m := heapMeter{seen: map[interface{}]bool{in.builtins: true}}
+	// the built-in prototypes are the same for every program
+	for _, proto := range []*object{in.objectProto, in.functionProto, in.arrayProto, in.stringProto, in.numberProto, in.booleanProto} {
+		m.seen[proto] = true
+	}
+	for _, proto := range in.errorProtos {
+		m.seen[proto] = true
+	}
+
+	if e != nil {
+		m.env(e)
+	}
+	for _, scope := range in.stack {
+		m.env(scope)
+	}
+	m.env(in.global)
+	for _, t := range in.timers {
+		m.value(t.fn)
+		for _, arg := range t.args {
+			m.value(arg)
+		}
+	}
+	if m.bytes > in.peakMemory {
+		in.peakMemory = m.bytes
+	}
+	if m.bytes > in.opts.MaxMemory {
+		return in.limit("memory", "Execution stopped: memory limit exceeded (%d bytes)", in.opts.MaxMemory)
+	}
+	return nil
+}
+
+// heapMeter adds up the approximate size of a graph of values, counting
+// each object, array, function and scope once
+type heapMeter struct {
+	seen  map[interface{}]bool
+	bytes int
+}
+
+func (m *heapMeter) visit(ref interface{}) bool {
+	if m.seen[ref] {
+		return false
+	}
+	m.seen[ref] = true
+	return true
+}
+
+func (m *heapMeter) env(e *env) {
+	for ; e != nil && m.visit(e); e = e.parent {
+		m.bytes += envSize
+		for name, b := range e.vars {
+			m.bytes += bindingSize + len(name)
+			m.value(b.value)
+		}
+		if e.frame != nil {
+			m.value(e.frame.this)
+		}
+	}
+}
+
+func (m *heapMeter) value(v Value) {
+	switch v := v.(type) {
+	case string:
+		m.bytes += stringSize + len(v)
+	case *object:
+		m.object(v)
+	case *array:
+		if !m.visit(v) {
+			return
+		}
+		m.bytes += arraySize + elementSize*cap(v.elems)
+		for _, elem := range v.elems {
+			m.value(elem)
+		}
+	case *function:
+		if !m.visit(v) {
+			return
+		}
+		m.bytes += functionSize
+		m.env(v.env)
+		m.object(v.proto)
+		m.object(v.statics)
+		if v.cls != nil {
+			m.env(v.cls.env)
+		}
+	default:
+		m.bytes += wordSize
+	}
+}
+
+func (m *heapMeter) object(o *object) {
+	if o == nil || !m.visit(o) {
+		return
+	}
+	m.bytes += objectSize
+	for key, v := range o.props {
+		m.bytes += propertySize + len(key)
+		m.value(v)
+	}
+	if entries, ok := o.internal.(*orderedMap); ok {
+		for _, entry := range entries.entries {
+			m.bytes += elementSize
+			m.value(entry.key)
+			m.value(entry.value)
+		}
+	}
+	m.object(o.proto)
+}
@@ -0,0 +1,1034 @@
+package sandbox
+
+import (
+	"fmt"
+)
+
+type parser struct {
+	toks []token
+	i    int
+}
+
+// parse turns a program into statements, reporting the first syntax error
+func parse(src string) (body []stmt, err error) {
+	toks, err := tokenize(src)
+	if err != nil {
+		return nil, err
+	}
+	p := &parser{toks: toks}
+	defer p.recover(&err)
+	for p.cur().kind != tokEOF {
+		body = append(body, p.statement())
+	}
+	return body, nil
+}
+
+// parseExpression parses a standalone expression, e.g. a template hole
+// starting at pos
+func parseExpression(src string, pos position) (x expr, err error) {
+	toks, err := tokenize(src)
+	if err != nil {
+		return nil, err
+	}
+	for i := range toks {
+		if toks[i].line == 1 {
+			toks[i].col += pos.col - 1
+		}
+		toks[i].line += pos.line - 1
+	}
+	p := &parser{toks: toks}
+	defer p.recover(&err)
+	x = p.expression(false)
+	if p.cur().kind != tokEOF {
+		p.fail("unexpected %s", describe(p.cur()))
+	}
+	return x, nil
+}
+
+func (p *parser) recover(err *error) {
+	if r := recover(); r != nil {
+		syntaxErr, ok := r.(*SyntaxError)
+		if !ok {
+			panic(r)
+		}
+		*err = syntaxErr
+	}
+}
+
+func (p *parser) fail(format string, args ...interface{}) {
+	tok := p.cur()
+	panic(&SyntaxError{Line: tok.line, Column: tok.col, Message: fmt.Sprintf(format, args...)})
+}
+
+func (p *parser) cur() token { return p.toks[p.i] }
+
+func (p *parser) peek(n int) token {
+	if p.i+n < len(p.toks) {
+		return p.toks[p.i+n]
+	}
+	return p.toks[len(p.toks)-1]
+}
+
+func (p *parser) next() token {
+	tok := p.toks[p.i]
+	if p.i < len(p.toks)-1 {
+		p.i++
+	}
+	return tok
+}
+
+// is reports whether the current token is the punctuator or keyword v
+func (p *parser) is(v string) bool {
+	tok := p.cur()
+	return (tok.kind == tokPunct || tok.kind == tokKeyword) && tok.value == v
+}
+
+func (p *parser) eat(v string) bool {
+	if p.is(v) {
+		p.next()
+		return true
+	}
+	return false
+}
+
+func (p *parser) expect(v string) token {
+	if !p.is(v) {
+		p.fail("expected '%s' but found %s", v, describe(p.cur()))
+	}
+	return p.next()
+}
+
+func describe(tok token) string {
+	switch tok.kind {
+	case tokEOF:
+		return "end of input"
+	case tokString:
+		return "string"
+	case tokTemplate:
+		return "template literal"
+	}
+	return fmt.Sprintf("'%s'", tok.value)
+}
+
+// semicolon consumes a statement terminator, applying automatic semicolon
+// insertion before '}', end of input or a line break
+func (p *parser) semicolon() {
+	if p.eat(";") || p.is("}") || p.cur().kind == tokEOF || p.cur().nl {
+		return
+	}
+	p.fail("expected ';' but found %s", describe(p.cur()))
+}
+
+func (p *parser) isBindingIdent() bool {
+	tok := p.cur()
+	return tok.kind == tokIdent || tok.kind == tokKeyword && contextual[tok.value]
+}
+
+func (p *parser) bindingIdent() *ident {
+	if !p.isBindingIdent() {
+		p.fail("expected identifier but found %s", describe(p.cur()))
+	}
+	tok := p.next()
+	return &ident{name: tok.value, ln: tok.line, col: tok.col}
+}
+
+// identName accepts any identifier or keyword, as in property names
+func (p *parser) identName() string {
+	tok := p.cur()
+	if tok.kind != tokIdent && tok.kind != tokKeyword {
+		p.fail("expected property name but found %s", describe(tok))
+	}
+	p.next()
+	return tok.value
+}
+
+// skipType skips a TypeScript annotation after ':' up to one of the stop
+// punctuators at nesting depth zero
+func (p *parser) skipType(stops ...string) {
+	p.expect(":")
+	depth := 0
+	first := true
+	for p.cur().kind != tokEOF {
+		if depth == 0 && !first {
+			if p.cur().nl {
+				return
+			}
+			for _, stop := range stops {
+				if p.is(stop) {
+					return
+				}
+			}
+		}
+		switch {
+		case p.is("(") || p.is("[") || p.is("{") || p.is("<"):
+			depth++
+		case p.is(")") || p.is("]") || p.is("}") || p.is(">"):
+			depth--
+		case p.is("=>") && depth == 0 && !first:
+			return
+		}
+		first = false
+		p.next()
+	}
+}
+
+func (p *parser) statement() stmt {
+	tok := p.cur()
+	ln := at{tok.line}
+	switch {
+	case p.is("{"):
+		return p.block()
+	case p.eat(";"):
+		return &emptyStmt{ln}
+	case p.is("var") || p.is("let") || p.is("const"):
+		decl := p.varDecl(false)
+		p.semicolon()
+		return decl
+	case p.is("function"):
+		return &funcDecl{ln, p.function(false)}
+	case p.is("async") && p.peek(1).value == "function" && !p.peek(1).nl:
+		p.next()
+		return &funcDecl{ln, p.function(true)}
+	case p.is("class"):
+		return &classDecl{ln, p.class()}
+	case p.eat("if"):
+		p.expect("(")
+		test := p.expression(false)
+		p.expect(")")
+		s := &ifStmt{at: ln, test: test, cons: p.statement()}
+		if p.eat("else") {
+			s.alt = p.statement()
+		}
+		return s
+	case p.is("for"):
+		return p.forStatement()
+	case p.eat("while"):
+		p.expect("(")
+		test := p.expression(false)
+		p.expect(")")
+		return &whileStmt{at: ln, test: test, body: p.statement()}
+	case p.eat("do"):
+		body := p.statement()
+		p.expect("while")
+		p.expect("(")
+		test := p.expression(false)
+		p.expect(")")
+		p.eat(";")
+		return &whileStmt{at: ln, test: test, body: body, do: true}
+	case p.eat("return"):
+		s := &returnStmt{at: ln}
+		if !p.is(";") && !p.is("}") && p.cur().kind != tokEOF && !p.cur().nl {
+			s.x = p.expression(false)
+		}
+		p.semicolon()
+		return s
+	case p.eat("break"):
+		s := &breakStmt{at: ln}
+		if p.isBindingIdent() && !p.cur().nl {
+			s.label = p.next().value
+		}
+		p.semicolon()
+		return s
+	case p.eat("continue"):
+		s := &continueStmt{at: ln}
+		if p.isBindingIdent() && !p.cur().nl {
+			s.label = p.next().value
+		}
+		p.semicolon()
+		return s
+	case p.eat("throw"):
+		s := &throwStmt{at: ln, x: p.expression(false)}
+		p.semicolon()
+		return s
+	case p.is("try"):
+		return p.tryStatement()
+	case p.is("switch"):
+		return p.switchStatement()
+	case p.is("import"):
+		p.fail("import statements are not supported in the sandbox")
+	case p.eat("export"):
+		if p.eat("default") {
+			if p.is("function") || p.is("class") || p.is("async") {
+				return p.statement()
+			}
+			s := &exprStmt{at: ln, x: p.assignment(false)}
+			p.semicolon()
+			return s
+		}
+		if p.is("{") || p.is("*") {
+			for !p.is("}") && !p.is("*") && p.cur().kind != tokEOF {
+				p.next()
+			}
+			p.next()
+			if p.eat("from") {
+				p.next()
+			}
+			p.semicolon()
+			return &emptyStmt{ln}
+		}
+		return p.statement()
+	case p.isBindingIdent() && p.peek(1).kind == tokPunct && p.peek(1).value == ":":
+		label := p.next().value
+		p.next()
+		return &labeledStmt{at: ln, label: label, body: p.statement()}
+	}
+
+	s := &exprStmt{at: ln, x: p.expression(false)}
+	p.semicolon()
+	return s
+}
+
+func (p *parser) block() *blockStmt {
+	b := &blockStmt{at: at{p.expect("{").line}}
+	for !p.is("}") {
+		if p.cur().kind == tokEOF {
+			p.fail("unexpected end of input, expected '}'")
+		}
+		b.body = append(b.body, p.statement())
+	}
+	p.next()
+	return b
+}
+
+func (p *parser) varDecl(noIn bool) *varDecl {
+	tok := p.next()
+	decl := &varDecl{at: at{tok.line}, kind: tok.value}
+	for {
+		d := declarator{target: p.bindingTarget()}
+		if p.is(":") {
+			p.skipType("=", ",", ";", ")")
+		}
+		if p.eat("=") {
+			d.init = p.assignment(noIn)
+		} else if decl.kind == "const" && !p.is("of") && !p.is("in") {
+			p.fail("missing initializer in const declaration")
+		}
+		decl.decls = append(decl.decls, d)
+		if !p.eat(",") {
+			return decl
+		}
+	}
+}
+
+// bindingTarget parses an identifier or destructuring pattern
+func (p *parser) bindingTarget() expr {
+	switch {
+	case p.eat("["):
+		pat := &arrayPattern{}
+		for !p.eat("]") {
+			if p.eat(",") {
+				pat.elems = append(pat.elems, nil)
+				continue
+			}
+			if p.eat("...") {
+				pat.rest = p.bindingTarget()
+				p.eat(",")
+				continue
+			}
+			elem := &patternElem{target: p.bindingTarget()}
+			if p.eat("=") {
+				elem.def = p.assignment(false)
+			}
+			pat.elems = append(pat.elems, elem)
+			if !p.is("]") {
+				p.expect(",")
+			}
+		}
+		return pat
+	case p.eat("{"):
+		pat := &objectPattern{}
+		for !p.eat("}") {
+			if p.eat("...") {
+				pat.rest = p.bindingIdent()
+				p.eat(",")
+				continue
+			}
+			elem := patternElem{}
+			key := p.cur()
+			if p.eat("[") {
+				elem.computed = p.assignment(false)
+				p.expect("]")
+			} else {
+				elem.key = p.propertyKey()
+			}
+			if p.eat(":") {
+				elem.target = p.bindingTarget()
+			} else {
+				elem.target = &ident{name: elem.key, ln: key.line, col: key.col, shorthand: true}
+			}
+			if p.eat("=") {
+				elem.def = p.assignment(false)
+			}
+			pat.props = append(pat.props, elem)
+			if !p.is("}") {
+				p.expect(",")
+			}
+		}
+		return pat
+	}
+	return p.bindingIdent()
+}
+
+func (p *parser) propertyKey() string {
+	tok := p.cur()
+	switch tok.kind {
+	case tokString:
+		p.next()
+		return tok.value
+	case tokNumber:
+		p.next()
+		return numberToString(tok.num)
+	}
+	return p.identName()
+}
+
+func (p *parser) forStatement() stmt {
+	ln := at{p.expect("for").line}
+	if p.is("await") {
+		p.fail("for await is not supported in the sandbox")
+	}
+	p.expect("(")
+
+	var init stmt
+	switch {
+	case p.is(";"):
+	case p.is("var") || p.is("let") || p.is("const"):
+		kind := p.cur().value
+		decl := p.varDecl(true)
+		if (p.is("of") || p.is("in")) && len(decl.decls) == 1 && decl.decls[0].init == nil {
+			return p.forInOfRest(ln, kind, decl.decls[0].target)
+		}
+		init = decl
+	default:
+		x := p.expression(true)
+		if p.is("of") || p.is("in") {
+			return p.forInOfRest(ln, "", x)
+		}
+		init = &exprStmt{at: ln, x: x}
+	}
+	p.expect(";")
+
+	s := &forStmt{at: ln, init: init}
+	if !p.is(";") {
+		s.test = p.expression(false)
+	}
+	p.expect(";")
+	if !p.is(")") {
+		s.update = p.expression(false)
+	}
+	p.expect(")")
+	s.body = p.statement()
+	return s
+}
+
+func (p *parser) forInOfRest(ln at, kind string, target expr) stmt {
+	of := p.next().value == "of"
+	var iter expr
+	if of {
+		iter = p.assignment(false)
+	} else {
+		iter = p.expression(false)
+	}
+	p.expect(")")
+	return &forInOf{at: ln, of: of, declKind: kind, target: target, iter: iter, body: p.statement()}
+}
+
+func (p *parser) tryStatement() stmt {
+	s := &tryStmt{at: at{p.expect("try").line}}
+	s.block = p.block()
+	if p.eat("catch") {
+		if p.eat("(") {
+			s.param = p.bindingTarget()
+			if p.is(":") {
+				p.skipType(")")
+			}
+			p.expect(")")
+		}
+		s.handler = p.block()
+	}
+	if p.eat("finally") {
+		s.finalizer = p.block()
+	}
+	if s.handler == nil && s.finalizer == nil {
+		p.fail("missing catch or finally after try")
+	}
+	return s
+}
+
+func (p *parser) switchStatement() stmt {
+	s := &switchStmt{at: at{p.expect("switch").line}}
+	p.expect("(")
+	s.disc = p.expression(false)
+	p.expect(")")
+	p.expect("{")
+	for !p.eat("}") {
+		var c switchCase
+		if p.eat("default") {
+			p.expect(":")
+		} else {
+			p.expect("case")
+			c.test = p.expression(false)
+			p.expect(":")
+		}
+		for !p.is("case") && !p.is("default") && !p.is("}") {
+			if p.cur().kind == tokEOF {
+				p.fail("unexpected end of input in switch")
+			}
+			c.body = append(c.body, p.statement())
+		}
+		s.cases = append(s.cases, c)
+	}
+	return s
+}
+
+// function parses `function name(params) { body }`
+func (p *parser) function(async bool) *funcLit {
+	fn := &funcLit{async: async, ln: p.expect("function").line}
+	if p.eat("*") {
+		p.fail("generator functions are not supported in the sandbox")
+	}
+	if p.isBindingIdent() {
+		tok := p.next()
+		fn.name, fn.nameAt = tok.value, position{tok.line, tok.col}
+	}
+	p.functionRest(fn)
+	return fn
+}
+
+func (p *parser) functionRest(fn *funcLit) {
+	fn.params = p.params()
+	if p.is(":") {
+		p.skipType("{")
+	}
+	fn.body = p.block().body
+}
+
+func (p *parser) params() []param {
+	p.expect("(")
+	params := []param{}
+	for !p.eat(")") {
+		prm := param{rest: p.eat("...")}
+		prm.target = p.bindingTarget()
+		p.eat("?")
+		if p.is(":") {
+			p.skipType(",", ")", "=")
+		}
+		if p.eat("=") {
+			prm.def = p.assignment(false)
+		}
+		params = append(params, prm)
+		if !p.is(")") {
+			p.expect(",")
+		}
+	}
+	return params
+}
+
+func (p *parser) class() *classLit {
+	p.expect("class")
+	cls := &classLit{}
+	if p.isBindingIdent() {
+		tok := p.next()
+		cls.name, cls.nameAt = tok.value, position{tok.line, tok.col}
+	}
+	if p.eat("extends") {
+		cls.super = p.callMember(false)
+	}
+	p.expect("{")
+	for !p.eat("}") {
+		if p.eat(";") {
+			continue
+		}
+		m := classMember{kind: "method"}
+		if p.is("static") && !p.nextIsOneOf("(", "=", ";") {
+			p.next()
+			m.static = true
+		}
+		if (p.is("get") || p.is("set")) && !p.nextIsOneOf("(", "=", ";", "}") {
+			m.kind = p.next().value
+		}
+		async := false
+		if p.is("async") && !p.nextIsOneOf("(", "=", ";") && !p.peek(1).nl {
+			p.next()
+			async = true
+		}
+		switch {
+		case p.eat("["):
+			m.computed = p.assignment(false)
+			p.expect("]")
+		case p.eat("#"):
+			m.name = "#" + p.identName()
+		default:
+			m.name = p.propertyKey()
+		}
+
+		if p.is("(") {
+			m.fn = &funcLit{name: m.name, async: async, ln: p.cur().line}
+			p.functionRest(m.fn)
+			if m.name == "constructor" && !m.static && m.kind == "method" {
+				cls.ctor = m.fn
+				continue
+			}
+		} else {
+			m.kind = "field"
+			if p.is(":") {
+				p.skipType("=", ";", "}")
+			}
+			if p.eat("=") {
+				m.value = p.assignment(false)
+			}
+			p.semicolon()
+		}
+		cls.members = append(cls.members, m)
+	}
+	return cls
+}
+
+func (p *parser) nextIsOneOf(values ...string) bool {
+	next := p.peek(1)
+	for _, v := range values {
+		if next.kind == tokPunct && next.value == v {
+			return true
+		}
+	}
+	return false
+}
+
+func (p *parser) expression(noIn bool) expr {
+	x := p.assignment(noIn)
+	if !p.is(",") {
+		return x
+	}
+	seq := &seqExpr{list: []expr{x}}
+	for p.eat(",") {
+		seq.list = append(seq.list, p.assignment(noIn))
+	}
+	return seq
+}
+
+var assignOps = map[string]bool{
+	"=": true, "+=": true, "-=": true, "*=": true, "/=": true, "%=": true,
+	"**=": true, "<<=": true, ">>=": true, ">>>=": true, "&=": true, "|=": true,
+	"^=": true, "&&=": true, "||=": true, "??=": true,
+}
+
+func (p *parser) assignment(noIn bool) expr {
+	if p.arrowAhead(p.i) {
+		return p.arrow(false, noIn)
+	}
+	if p.is("async") && !p.peek(1).nl && p.arrowAhead(p.i+1) {
+		p.next()
+		return p.arrow(true, noIn)
+	}
+
+	left := p.conditional(noIn)
+	tok := p.cur()
+	if tok.kind != tokPunct || !assignOps[tok.value] {
+		return left
+	}
+	switch left.(type) {
+	case *ident, *memberExpr:
+	case *arrayLit, *objectLit:
+		if tok.value != "=" {
+			p.fail("invalid assignment target")
+		}
+		left = toPattern(p, left)
+	default:
+		p.fail("invalid assignment target")
+	}
+	p.next()
+	return &assignExpr{op: tok.value, target: left, value: p.assignment(noIn)}
+}
+
+// toPattern reinterprets an array or object literal on the left of '=' as a
+// destructuring pattern
+func toPattern(p *parser, x expr) expr {
+	switch x := x.(type) {
+	case *arrayLit:
+		pat := &arrayPattern{}
+		for _, elem := range x.elems {
+			switch elem := elem.(type) {
+			case nil:
+				pat.elems = append(pat.elems, nil)
+			case *spreadExpr:
+				pat.rest = toPattern(p, elem.x)
+			case *assignExpr:
+				pat.elems = append(pat.elems, &patternElem{target: toPattern(p, elem.target), def: elem.value})
+			default:
+				pat.elems = append(pat.elems, &patternElem{target: toPattern(p, elem)})
+			}
+		}
+		return pat
+	case *objectLit:
+		pat := &objectPattern{}
+		for _, prop := range x.props {
+			if prop.kind == "spread" {
+				pat.rest = toPattern(p, prop.value)
+				continue
+			}
+			elem := patternElem{key: prop.key, computed: prop.computed, target: prop.value}
+			if assign, ok := prop.value.(*assignExpr); ok && assign.op == "=" {
+				elem.target, elem.def = assign.target, assign.value
+			}
+			elem.target = toPattern(p, elem.target)
+			pat.props = append(pat.props, elem)
+		}
+		return pat
+	case *ident, *memberExpr, *arrayPattern, *objectPattern:
+		return x
+	}
+	p.fail("invalid destructuring target")
+	return nil
+}
+
+// arrowAhead reports whether the tokens from i start an arrow function's
+// parameter list
+func (p *parser) arrowAhead(i int) bool {
+	if i >= len(p.toks) {
+		return false
+	}
+	tok := p.toks[i]
+	if tok.kind == tokIdent || tok.kind == tokKeyword && contextual[tok.value] {
+		return i+1 < len(p.toks) && p.toks[i+1].kind == tokPunct && p.toks[i+1].value == "=>"
+	}
+	if tok.kind != tokPunct || tok.value != "(" {
+		return false
+	}
+	depth := 0
+	for j := i; j < len(p.toks); j++ {
+		t := p.toks[j]
+		if t.kind != tokPunct {
+			if t.kind == tokEOF {
+				return false
+			}
+			continue
+		}
+		switch t.value {
+		case "(", "[", "{":
+			depth++
+		case ")", "]", "}":
+			depth--
+			if depth == 0 {
+				if j+1 >= len(p.toks) {
+					return false
+				}
+				next := p.toks[j+1]
+				if next.kind == tokPunct && next.value == ":" {
+					// return type annotation: look for => before the body
+					for k := j + 2; k < len(p.toks) && p.toks[k].kind != tokEOF; k++ {
+						if p.toks[k].kind == tokPunct && (p.toks[k].value == "=>" || p.toks[k].value == ";" || p.toks[k].value == "{") {
+							return p.toks[k].value == "=>"
+						}
+					}
+					return false
+				}
+				return next.kind == tokPunct && next.value == "=>" && !next.nl
+			}
+		}
+	}
+	return false
+}
+
+func (p *parser) arrow(async bool, noIn bool) expr {
+	fn := &funcLit{arrow: true, async: async, ln: p.cur().line}
+	if p.is("(") {
+		fn.params = p.params()
+		if p.is(":") {
+			p.skipType("=>")
+		}
+	} else {
+		fn.params = []param{{target: p.bindingIdent()}}
+	}
+	p.expect("=>")
+	if p.is("{") {
+		fn.body = p.block().body
+	} else {
+		fn.exprBody = p.assignment(noIn)
+	}
+	return fn
+}
+
+func (p *parser) conditional(noIn bool) expr {
+	test := p.binary(0, noIn)
+	if !p.eat("?") {
+		return test
+	}
+	cons := p.assignment(false)
+	p.expect(":")
+	return &condExpr{test: test, cons: cons, alt: p.assignment(noIn)}
+}
+
+var binaryPrec = map[string]int{
+	"??": 1, "||": 2, "&&": 3, "|": 4, "^": 5, "&": 6,
+	"==": 7, "!=": 7, "===": 7, "!==": 7,
+	"<": 8, ">": 8, "<=": 8, ">=": 8, "instanceof": 8, "in": 8,
+	"<<": 9, ">>": 9, ">>>": 9,
+	"+": 10, "-": 10, "*": 11, "/": 11, "%": 11, "**": 12,
+}
+
+func (p *parser) binary(minPrec int, noIn bool) expr {
+	left := p.unary()
+	for {
+		tok := p.cur()
+		if tok.kind != tokPunct && tok.kind != tokKeyword || noIn && tok.value == "in" {
+			return left
+		}
+		prec := binaryPrec[tok.value]
+		if prec == 0 || prec <= minPrec {
+			return left
+		}
+		p.next()
+		var right expr
+		if tok.value == "**" {
+			right = p.binary(prec-1, noIn)
+		} else {
+			right = p.binary(prec, noIn)
+		}
+		switch tok.value {
+		case "&&", "||", "??":
+			left = &logicalExpr{op: tok.value, l: left, r: right}
+		default:
+			left = &binaryExpr{op: tok.value, l: left, r: right}
+		}
+	}
+}
+
+func (p *parser) unary() expr {
+	tok := p.cur()
+	if tok.kind == tokPunct || tok.kind == tokKeyword {
+		switch tok.value {
+		case "!", "-", "+", "~", "typeof", "void", "delete":
+			p.next()
+			return &unaryExpr{op: tok.value, x: p.unary()}
+		case "++", "--":
+			p.next()
+			x := p.unary()
+			p.checkUpdateTarget(x)
+			return &updateExpr{op: tok.value, prefix: true, x: x}
+		case "await":
+			if !p.nextIsOneOf(")", ";", ",", "=") {
+				p.next()
+				return &awaitExpr{x: p.unary()}
+			}
+		}
+	}
+
+	x := p.callMember(true)
+	if (p.is("++") || p.is("--")) && !p.cur().nl {
+		p.checkUpdateTarget(x)
+		return &updateExpr{op: p.next().value, x: x}
+	}
+	return x
+}
+
+func (p *parser) checkUpdateTarget(x expr) {
+	switch x.(type) {
+	case *ident, *memberExpr:
+	default:
+		p.fail("invalid increment/decrement target")
+	}
+}
+
+// callMember parses member accesses and (when calls is set) calls
+func (p *parser) callMember(calls bool) expr {
+	var x expr
+	if p.is("new") {
+		x = p.newExpression()
+	} else {
+		x = p.primary()
+	}
+	for {
+		switch {
+		case p.eat("."):
+			if p.eat("#") {
+				x = &memberExpr{obj: x, prop: "#" + p.identName()}
+			} else {
+				x = &memberExpr{obj: x, prop: p.identName()}
+			}
+		case p.is("?."):
+			p.next()
+			switch {
+			case p.is("("):
+				x = &callExpr{callee: x, args: p.arguments(), optional: true}
+			case p.eat("["):
+				computed := p.expression(false)
+				p.expect("]")
+				x = &memberExpr{obj: x, computed: computed, optional: true}
+			default:
+				x = &memberExpr{obj: x, prop: p.identName(), optional: true}
+			}
+		case p.eat("["):
+			computed := p.expression(false)
+			p.expect("]")
+			x = &memberExpr{obj: x, computed: computed}
+		case calls && p.is("("):
+			x = &callExpr{callee: x, args: p.arguments()}
+		case p.cur().kind == tokTemplate && !p.cur().nl:
+			p.fail("tagged templates are not supported in the sandbox")
+		default:
+			return x
+		}
+	}
+}
+
+func (p *parser) newExpression() expr {
+	p.expect("new")
+	if p.eat(".") {
+		p.fail("new.target is not supported in the sandbox")
+	}
+	callee := p.callMember(false)
+	n := &newExpr{callee: callee}
+	if p.is("(") {
+		n.args = p.arguments()
+	}
+	return n
+}
+
+func (p *parser) arguments() []expr {
+	p.expect("(")
+	args := []expr{}
+	for !p.eat(")") {
+		if p.eat("...") {
+			args = append(args, &spreadExpr{x: p.assignment(false)})
+		} else {
+			args = append(args, p.assignment(false))
+		}
+		if !p.is(")") {
+			p.expect(",")
+		}
+	}
+	return args
+}
+
+func (p *parser) primary() expr {
+	tok := p.cur()
+	switch tok.kind {
+	case tokNumber:
+		p.next()
+		return &numLit{v: tok.num}
+	case tokString:
+		p.next()
+		return &strLit{v: tok.value}
+	case tokTemplate:
+		p.next()
+		t := &tmplLit{parts: tok.parts}
+		for i, src := range tok.exprs {
+			x, err := parseExpression(src, tok.holes[i])
+			if err != nil {
+				panic(err)
+			}
+			t.exprs = append(t.exprs, x)
+		}
+		return t
+	case tokIdent:
+		p.next()
+		return &ident{name: tok.value, ln: tok.line, col: tok.col}
+	case tokEOF:
+		p.fail("unexpected end of input")
+	}
+
+	switch {
+	case p.eat("this"):
+		return &thisExpr{}
+	case p.eat("super"):
+		return &superExpr{}
+	case p.eat("null"):
+		return &nullLit{}
+	case p.eat("true"):
+		return &boolLit{v: true}
+	case p.eat("false"):
+		return &boolLit{v: false}
+	case p.is("function"):
+		return p.function(false)
+	case p.is("async") && p.peek(1).value == "function":
+		p.next()
+		return p.function(true)
+	case p.is("class"):
+		return p.class()
+	case tok.kind == tokKeyword && contextual[tok.value]:
+		p.next()
+		return &ident{name: tok.value, ln: tok.line, col: tok.col}
+	case p.eat("("):
+		x := p.expression(false)
+		p.expect(")")
+		return x
+	case p.eat("["):
+		arr := &arrayLit{}
+		for !p.eat("]") {
+			switch {
+			case p.is(","):
+				arr.elems = append(arr.elems, nil)
+			case p.eat("..."):
+				arr.elems = append(arr.elems, &spreadExpr{x: p.assignment(false)})
+			default:
+				arr.elems = append(arr.elems, p.assignment(false))
+			}
+			if !p.is("]") {
+				p.expect(",")
+			}
+		}
+		return arr
+	case p.is("{"):
+		return p.objectLiteral()
+	}
+	p.fail("unexpected %s", describe(tok))
+	return nil
+}
+
+func (p *parser) objectLiteral() expr {
+	p.expect("{")
+	obj := &objectLit{}
+	for !p.eat("}") {
+		prop := objProp{kind: "init"}
+		if p.eat("...") {
+			prop.kind, prop.value = "spread", p.assignment(false)
+			obj.props = append(obj.props, prop)
+			if !p.is("}") {
+				p.expect(",")
+			}
+			continue
+		}
+		if (p.is("get") || p.is("set")) && !p.nextIsOneOf(":", "(", ",", "}") {
+			prop.kind = p.next().value
+		}
+		async := false
+		if p.is("async") && !p.nextIsOneOf(":", "(", ",", "}") {
+			p.next()
+			async = true
+		}
+		shorthand := p.isBindingIdent()
+		line, col := p.cur().line, p.cur().col
+		if p.eat("[") {
+			prop.computed = p.assignment(false)
+			p.expect("]")
+			shorthand = false
+		} else {
+			prop.key = p.propertyKey()
+		}
+
+		switch {
+		case p.is("("):
+			fn := &funcLit{name: prop.key, async: async, ln: line}
+			p.functionRest(fn)
+			prop.value, prop.method = fn, true
+		case prop.kind != "init":
+			p.fail("expected '(' after %s accessor name", prop.kind)
+		case p.eat(":"):
+			prop.value = p.assignment(false)
+		case shorthand:
+			prop.value = &ident{name: prop.key, ln: line, col: col, shorthand: true}
+			if p.is("=") {
+				// only valid as a destructuring default; toPattern unpacks it
+				p.next()
+				prop.value = &assignExpr{op: "=", target: prop.value, value: p.assignment(false)}
+			}
+		default:
+			p.fail("expected ':' after property name")
+		}
+		obj.props = append(obj.props, prop)
+		if !p.is("}") {
+			p.expect(",")
+		}
+	}
+	return obj
+}
@@ -0,0 +1,307 @@
+// Package sandbox interprets the JavaScript the transpiler emits without
+// handing it to a real engine. Programs get console, Math, JSON, Date and
+// the common Array/String/Map/Set methods but no I/O, and every run is
+// bounded by step, instruction, time, output, memory and recursion limits.
+package sandbox
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+// Options bounds a run. Zero values pick the defaults below.
+type Options struct {
+	MaxSteps  int
+	Timeout   time.Duration
+	MaxOutput int
+	MaxDepth  int
+	// MaxInstructions bounds the expressions evaluated, which catches
+	// work that runs no statements, such as expression-bodied callbacks
+	MaxInstructions int
+	// MaxMemory bounds, in bytes, what the program's values may hold at
+	// once, as PeakMemory measures it
+	MaxMemory int
+	// Trace records a Step for every statement executed
+	Trace         bool
+	MaxTraceSteps int
+	// Stdin is read a line at a time by prompt()
+	Stdin string
+	// Values records a LineValue for each top-level statement, for
+	// showing results inline beside the code
+	Values bool
+}
+
+const (
+	DefaultMaxSteps        = 100000
+	DefaultMaxInstructions = 2000000
+	DefaultTimeout         = 2 * time.Second
+	DefaultMaxOutput       = 64 * 1024
+	DefaultMaxDepth        = 256
+	DefaultMaxMemory       = 32 << 20
+	DefaultMaxTraceSteps   = 1000
+)
+
+func (o Options) withDefaults() Options {
+	if o.MaxSteps <= 0 {
+		o.MaxSteps = DefaultMaxSteps
+	}
+	if o.MaxInstructions <= 0 {
+		o.MaxInstructions = DefaultMaxInstructions
+	}
+	if o.Timeout <= 0 {
+		o.Timeout = DefaultTimeout
+	}
+	if o.MaxOutput <= 0 {
+		o.MaxOutput = DefaultMaxOutput
+	}
+	if o.MaxDepth <= 0 {
+		o.MaxDepth = DefaultMaxDepth
+	}
+	if o.MaxMemory <= 0 {
+		o.MaxMemory = DefaultMaxMemory
+	}
+	if o.MaxTraceSteps <= 0 {
+		o.MaxTraceSteps = DefaultMaxTraceSteps
+	}
+	return o
+}
+
+// Variable is one binding in a step snapshot
+type Variable struct {
+	Name  string `json:"name"`
+	Value string `json:"value"`
+	Type  string `json:"type"`
+}
+
+// Step is one point in an execution trace
+type Step struct {
+	Step  int    `json:"step"`
+	Line  int    `json:"line"`
+	Event string `json:"event"`
+	// Source is the trimmed line of code being executed
+	Source   string `json:"source"`
+	Function string `json:"function,omitempty"`
+	Depth    int    `json:"depth"`
+	// Value is the event's value: a condition's outcome, a returned or
+	// thrown value, or the current loop item
+	Value   string     `json:"value,omitempty"`
+	Locals  []Variable `json:"locals"`
+	Globals []Variable `json:"globals"`
+	// Stdout holds console output produced since the previous step
+	Stdout []string `json:"stdout,omitempty"`
+}
+
+// Result is the outcome of a run
+type Result struct {
+	Stdout    []string `json:"stdout"`
+	Steps     []Step   `json:"steps,omitempty"`
+	StepCount int      `json:"stepCount"`
+	// Instructions counts the expressions evaluated
+	Instructions int `json:"instructions"`
+	// Truncated is set when the trace stopped recording at MaxTraceSteps
+	Truncated bool   `json:"truncated,omitempty"`
+	Error     string `json:"error,omitempty"`
+	ErrorLine int    `json:"errorLine,omitempty"`
+	// Limit names the resource limit that stopped the run, if any
+	Limit    string        `json:"limit,omitempty"`
+	Duration time.Duration `json:"-"`
+	// PeakMemory approximates, in bytes, the most the program's values
+	// held at once, sampled every 1024 statements, after every megabyte of
+	// strings and arrays built, and at the end
+	PeakMemory int `json:"peakMemory"`
+	// DepthExceeded is set when a call went deeper than MaxDepth. The
+	// program sees a RangeError it may catch, so the run can still end
+	// normally.
+	DepthExceeded bool `json:"depthExceeded,omitempty"`
+	// Values holds, with Options.Values, what each top-level statement
+	// evaluated to or printed
+	Values []LineValue `json:"values,omitempty"`
+}
+
+// LimitsHit names every limit the run reached: "steps", "instructions",
+// "time", "output" or "memory" when one stopped it, and "depth" when a
+// call went too deep
+func (r *Result) LimitsHit() []string {
+	limits := []string{}
+	if r.Limit != "" {
+		limits = append(limits, r.Limit)
+	}
+	if r.DepthExceeded {
+		limits = append(limits, "depth")
+	}
+	return limits
+}
+
+// Run parses and executes code, returning its console output and, with
+// opts.Trace, the recorded steps. Script errors are reported in the
+// result rather than returned.
+func Run(code string, opts Options) *Result {
+	return (&interp{}).run(code, opts)
+}
+
+// run executes code in the interpreter's global scope, which the first
+// run sets up and later ones, in a Session, share
+func (in *interp) run(code string, opts Options) (res *Result) {
+	in.opts = opts.withDefaults()
+	in.started = time.Now()
+	in.source = strings.Split(code, "\n")
+	in.stdin, in.stdout, in.outBytes = nil, nil, 0
+	in.steps, in.instructions, in.line, in.depth = 0, 0, 0, 0
+	in.trace, in.truncated, in.traceMark, in.values = nil, false, 0, nil
+	in.timers, in.stack, in.allocated = nil, nil, 0
+	in.peakMemory, in.depthExceeded = 0, false
+	if opts.Stdin != "" {
+		in.stdin = strings.Split(strings.TrimSuffix(opts.Stdin, "\n"), "\n")
+	}
+	res = &Result{}
+	defer func() {
+		if r := recover(); r != nil {
+			res.Error = fmt.Sprintf("InternalError: %v", r)
+		}
+		res.Stdout = in.stdout
+		if res.Stdout == nil {
+			res.Stdout = []string{}
+		}
+		if in.global != nil {
+			if err := in.sampleMemory(nil); err != nil && res.Error == "" {
+				res.fail(err)
+			}
+		}
+		res.PeakMemory = in.peakMemory
+		res.DepthExceeded = in.depthExceeded
+		res.Steps = in.trace
+		res.Values = in.values
+		res.StepCount = in.steps
+		res.Instructions = in.instructions
+		res.Truncated = in.truncated
+		if res.Limit != "" && res.ErrorLine == 0 {
+			res.ErrorLine = in.line
+		}
+		res.Duration = time.Since(in.started)
+	}()
+
+	program, err := parse(code)
+	if err != nil {
+		res.fail(err)
+		return res
+	}
+	if in.global == nil {
+		in.setupBuiltins()
+	} else {
+		// a run in a session may declare a name again, as when a cell
+		// is edited and rerun; the new declaration replaces the old
+		for _, name := range declaredNames(program) {
+			in.global.forget(name)
+		}
+	}
+	if err := in.hoist(program, in.global, true); err != nil {
+		res.fail(err)
+		return res
+	}
+	for _, s := range program {
+		printed := len(in.stdout)
+		if _, err := in.exec(s, in.global); err != nil {
+			res.fail(err)
+			return res
+		}
+		if opts.Values {
+			in.recordValue(s, printed)
+		}
+	}
+	if err := in.runTimers(); err != nil {
+		res.fail(err)
+	}
+	return res
+}
+
+// Check parses code without running it and returns the first syntax error
+func Check(code string) error {
+	_, err := parse(code)
+	return err
+}
+
+func (r *Result) fail(err error) {
+	r.Error = err.Error()
+	switch err := err.(type) {
+	case *SyntaxError:
+		r.ErrorLine = err.Line
+	case *thrown:
+		r.ErrorLine = err.line
+	case *LimitError:
+		r.Limit = err.Limit
+	}
+}
+
+// maxSnapshotValue caps how much of a value a step snapshot shows
+const maxSnapshotValue = 200
+
+func snapshot(v Value) string {
+	s := inspect(v, 1, map[interface{}]bool{})
+	if runes := []rune(s); len(runes) > maxSnapshotValue {
+		s = string(runes[:maxSnapshotValue-1]) + "…"
+	}
+	return s
+}
+
+func variables(e *env, seen map[string]bool) []Variable {
+	vars := []Variable{}
+	for _, name := range e.names {
+		if seen[name] {
+			continue
+		}
+		seen[name] = true
+		b := e.vars[name]
+		if f, ok := b.value.(*function); ok && b.kind == "function" && f.lit != nil && f.cls == nil {
+			// hoisted function declarations are noise in a beginner's view
+			continue
+		}
+		vars = append(vars, Variable{Name: name, Value: snapshot(b.value), Type: typeOf(b.value)})
+	}
+	return vars
+}
+
+// step records a trace event when tracing is on
+func (in *interp) step(event string, line int, e *env, value Value) {
+	if !in.opts.Trace {
+		return
+	}
+	if len(in.trace) >= in.opts.MaxTraceSteps {
+		in.truncated = true
+		return
+	}
+	s := Step{Step: len(in.trace) + 1, Line: line, Event: event, Depth: in.depth}
+	if line > 0 && line <= len(in.source) {
+		s.Source = strings.TrimSpace(in.source[line-1])
+	}
+	if value != nil {
+		s.Value = snapshot(value)
+	}
+	if f := e.thisFrameOrArrow(); f != nil {
+		s.Function = f.name
+		if s.Function == "" {
+			s.Function = "(anonymous)"
+		}
+	}
+	seen := map[string]bool{}
+	s.Locals = []Variable{}
+	for scope := e; scope != nil && scope != in.global; scope = scope.parent {
+		s.Locals = append(s.Locals, variables(scope, seen)...)
+	}
+	s.Globals = variables(in.global, seen)
+	if in.traceMark < len(in.stdout) {
+		s.Stdout = append([]string{}, in.stdout[in.traceMark:]...)
+		in.traceMark = len(in.stdout)
+	}
+	in.trace = append(in.trace, s)
+}
+
+// thisFrameOrArrow is the nearest function frame, arrow or not
+func (e *env) thisFrameOrArrow() *frame {
+	for s := e; s != nil; s = s.parent {
+		if s.frame != nil {
+			return s.frame
+		}
+	}
+	return nil
+}
@@ -0,0 +1,489 @@
+package sandbox
+
+import (
+	"fmt"
+	"unicode/utf8"
+)
+
+// Reference is one identifier in a program, resolved to the variable it
+// names
+type Reference struct {
+	Name   string
+	Line   int
+	Column int
+	// Binding numbers the variable the identifier names; identifiers with
+	// the same Binding name the same variable. Zero is a global: a name
+	// declared at the top level or never declared at all.
+	Binding     int
+	Declaration bool
+	// Assigned marks a name being assigned or updated, as in x = 1 or x++
+	Assigned bool
+	// Shorthand marks a name standing for both key and value, as in {x}
+	Shorthand bool
+	scope     int
+}
+
+// Escape is a return, break or continue that jumps out of the code being
+// analyzed, as when it is a fragment cut from a larger program
+type Escape struct {
+	Keyword string
+	Line    int
+}
+
+// Scopes is every identifier of a program resolved through its scopes
+type Scopes struct {
+	References []Reference
+	Escapes    []Escape
+	// Await reports an await outside any function
+	Await  bool
+	scopes []scope
+	// bindings maps a binding to the scope declaring it
+	bindings []int
+}
+
+type scope struct {
+	parent   int
+	function bool
+	// names maps each declared name to its binding
+	names map[string]int
+}
+
+// Resolve parses code and resolves every identifier in it. Scoping follows
+// JavaScript: var and parameters belong to the enclosing function, let,
+// const, class and function declarations to the enclosing block.
+func Resolve(code string) (*Scopes, error) {
+	program, err := parse(code)
+	if err != nil {
+		return nil, err
+	}
+	r := &resolver{s: &Scopes{bindings: []int{0}}}
+	r.push(true)
+	r.statements(program)
+
+	s := r.s
+	for i := range s.References {
+		ref := &s.References[i]
+		for sc := ref.scope; ; sc = s.scopes[sc].parent {
+			if binding, ok := s.scopes[sc].names[ref.Name]; ok {
+				ref.Binding = binding
+				break
+			}
+			if sc == 0 {
+				break
+			}
+		}
+	}
+	return s, nil
+}
+
+// At returns the identifier covering a line and column
+func (s *Scopes) At(line, column int) (Reference, bool) {
+	for _, ref := range s.References {
+		if ref.Line == line && column >= ref.Column && column < ref.Column+utf8.RuneCountInString(ref.Name) {
+			return ref, true
+		}
+	}
+	return Reference{}, false
+}
+
+// Occurrences lists every identifier naming the same variable as ref
+func (s *Scopes) Occurrences(ref Reference) []Reference {
+	var result []Reference
+	for _, other := range s.References {
+		if other.Binding == ref.Binding && (ref.Binding != 0 || other.Name == ref.Name) {
+			result = append(result, other)
+		}
+	}
+	return result
+}
+
+// RenameConflict reports why the variable ref names can't be renamed to
+// name without changing what some identifier refers to, or nil if it can
+func (s *Scopes) RenameConflict(ref Reference, name string) error {
+	home := s.bindings[ref.Binding]
+	if ref.Binding == 0 {
+		for _, other := range s.References {
+			if other.Binding == 0 && other.Name == name {
+				return fmt.Errorf("'%s' is already a global (line %d)", name, other.Line)
+			}
+		}
+	} else if _, ok := s.scopes[home].names[name]; ok {
+		return fmt.Errorf("'%s' is already declared in the same scope", name)
+	}
+
+	for _, occurrence := range s.Occurrences(ref) {
+		for sc := occurrence.scope; sc != home; sc = s.scopes[sc].parent {
+			if _, ok := s.scopes[sc].names[name]; ok {
+				return fmt.Errorf("the '%s' on line %d would be shadowed by another '%s'", ref.Name, occurrence.Line, name)
+			}
+		}
+	}
+	for _, other := range s.References {
+		if other.Name != name || !s.encloses(home, other.scope) {
+			continue
+		}
+		if declared := s.bindings[other.Binding]; declared != home && s.encloses(declared, home) {
+			return fmt.Errorf("the '%s' on line %d would refer to the renamed variable instead", name, other.Line)
+		}
+	}
+	return nil
+}
+
+// encloses reports whether scope outer is inner or one of its ancestors
+func (s *Scopes) encloses(outer, inner int) bool {
+	for {
+		if inner == outer {
+			return true
+		}
+		if inner == 0 {
+			return false
+		}
+		inner = s.scopes[inner].parent
+	}
+}
+
+type resolver struct {
+	s   *Scopes
+	cur int
+	// jumps tracks what break and continue may target in the current
+	// function
+	jumps jumpTargets
+	// functions counts the functions enclosing the current node
+	functions int
+}
+
+type jumpTargets struct {
+	loops, breakable int
+	labels           []string
+}
+
+func (j jumpTargets) labeled(label string) bool {
+	for _, l := range j.labels {
+		if l == label {
+			return true
+		}
+	}
+	return false
+}
+
+func (r *resolver) push(function bool) {
+	r.s.scopes = append(r.s.scopes, scope{parent: r.cur, function: function, names: map[string]int{}})
+	r.cur = len(r.s.scopes) - 1
+}
+
+func (r *resolver) pop() {
+	r.cur = r.s.scopes[r.cur].parent
+}
+
+// declare records a declaration of id; hoisted declarations (var) go to
+// the enclosing function scope
+func (r *resolver) declare(id *ident, hoist bool) {
+	sc := r.cur
+	for hoist && !r.s.scopes[sc].function {
+		sc = r.s.scopes[sc].parent
+	}
+	if _, ok := r.s.scopes[sc].names[id.name]; !ok {
+		binding := 0
+		if sc != 0 {
+			binding = len(r.s.bindings)
+			r.s.bindings = append(r.s.bindings, sc)
+		}
+		r.s.scopes[sc].names[id.name] = binding
+	}
+	r.s.References = append(r.s.References, Reference{Name: id.name, Line: id.ln, Column: id.col, Declaration: true, Shorthand: id.shorthand, scope: sc})
+}
+
+func (r *resolver) use(id *ident) {
+	r.s.References = append(r.s.References, Reference{Name: id.name, Line: id.ln, Column: id.col, Shorthand: id.shorthand, scope: r.cur})
+}
+
+// assign resolves the target of an assignment or update
+func (r *resolver) assign(x expr) {
+	switch x := x.(type) {
+	case *ident:
+		r.use(x)
+		r.s.References[len(r.s.References)-1].Assigned = true
+	case *arrayPattern:
+		for _, elem := range x.elems {
+			if elem != nil {
+				r.assign(elem.target)
+				r.expr(elem.def)
+			}
+		}
+		r.assign(x.rest)
+	case *objectPattern:
+		for i := range x.props {
+			r.expr(x.props[i].computed)
+			r.assign(x.props[i].target)
+			r.expr(x.props[i].def)
+		}
+		r.assign(x.rest)
+	default:
+		r.expr(x)
+	}
+}
+
+// loop resolves a loop body, where break and continue stay inside
+func (r *resolver) loop(body stmt) {
+	r.jumps.loops++
+	r.jumps.breakable++
+	r.statement(body)
+	r.jumps.loops--
+	r.jumps.breakable--
+}
+
+func (r *resolver) escape(keyword string, ln int) {
+	r.s.Escapes = append(r.s.Escapes, Escape{Keyword: keyword, Line: ln})
+}
+
+func (r *resolver) statements(body []stmt) {
+	for _, s := range body {
+		r.statement(s)
+	}
+}
+
+func (r *resolver) statement(s stmt) {
+	switch s := s.(type) {
+	case *varDecl:
+		for _, d := range s.decls {
+			r.pattern(d.target, s.kind == "var")
+			r.expr(d.init)
+		}
+	case *funcDecl:
+		if s.fn.name != "" {
+			r.declare(&ident{name: s.fn.name, ln: s.fn.nameAt.line, col: s.fn.nameAt.col}, false)
+		}
+		r.function(s.fn, false)
+	case *classDecl:
+		if s.cls.name != "" {
+			r.declare(&ident{name: s.cls.name, ln: s.cls.nameAt.line, col: s.cls.nameAt.col}, false)
+		}
+		r.class(s.cls, false)
+	case *exprStmt:
+		r.expr(s.x)
+	case *ifStmt:
+		r.expr(s.test)
+		r.statement(s.cons)
+		r.statement(s.alt)
+	case *forStmt:
+		r.push(false)
+		r.statement(s.init)
+		r.expr(s.test)
+		r.expr(s.update)
+		r.loop(s.body)
+		r.pop()
+	case *forInOf:
+		r.push(false)
+		if s.declKind != "" {
+			r.pattern(s.target, s.declKind == "var")
+		} else {
+			r.assign(s.target)
+		}
+		r.expr(s.iter)
+		r.loop(s.body)
+		r.pop()
+	case *whileStmt:
+		r.expr(s.test)
+		r.loop(s.body)
+	case *blockStmt:
+		r.push(false)
+		r.statements(s.body)
+		r.pop()
+	case *returnStmt:
+		if r.functions == 0 {
+			r.escape("return", s.ln)
+		}
+		r.expr(s.x)
+	case *breakStmt:
+		if s.label == "" && r.jumps.breakable == 0 || s.label != "" && !r.jumps.labeled(s.label) {
+			r.escape("break", s.ln)
+		}
+	case *continueStmt:
+		if s.label == "" && r.jumps.loops == 0 || s.label != "" && !r.jumps.labeled(s.label) {
+			r.escape("continue", s.ln)
+		}
+	case *throwStmt:
+		r.expr(s.x)
+	case *tryStmt:
+		r.statement(s.block)
+		if s.handler != nil {
+			r.push(false)
+			if s.param != nil {
+				r.pattern(s.param, false)
+			}
+			r.statements(s.handler.body)
+			r.pop()
+		}
+		if s.finalizer != nil {
+			r.statement(s.finalizer)
+		}
+	case *switchStmt:
+		r.expr(s.disc)
+		r.push(false)
+		r.jumps.breakable++
+		for _, c := range s.cases {
+			r.expr(c.test)
+			r.statements(c.body)
+		}
+		r.jumps.breakable--
+		r.pop()
+	case *labeledStmt:
+		r.jumps.labels = append(r.jumps.labels, s.label)
+		r.statement(s.body)
+		r.jumps.labels = r.jumps.labels[:len(r.jumps.labels)-1]
+	}
+}
+
+// pattern declares every name a binding target introduces
+func (r *resolver) pattern(x expr, hoist bool) {
+	switch x := x.(type) {
+	case *ident:
+		r.declare(x, hoist)
+	case *arrayPattern:
+		for _, elem := range x.elems {
+			if elem != nil {
+				r.pattern(elem.target, hoist)
+				r.expr(elem.def)
+			}
+		}
+		if x.rest != nil {
+			r.pattern(x.rest, hoist)
+		}
+	case *objectPattern:
+		for i := range x.props {
+			r.expr(x.props[i].computed)
+			r.pattern(x.props[i].target, hoist)
+			r.expr(x.props[i].def)
+		}
+		if x.rest != nil {
+			r.pattern(x.rest, hoist)
+		}
+	default:
+		r.expr(x)
+	}
+}
+
+// function resolves a function in its own scope; named function
+// expressions can see their own name
+func (r *resolver) function(fn *funcLit, expression bool) {
+	outer := r.jumps
+	r.jumps = jumpTargets{}
+	r.functions++
+	defer func() {
+		r.jumps = outer
+		r.functions--
+	}()
+	r.push(true)
+	if expression && fn.name != "" && fn.nameAt.line > 0 {
+		r.declare(&ident{name: fn.name, ln: fn.nameAt.line, col: fn.nameAt.col}, false)
+	}
+	for _, p := range fn.params {
+		r.pattern(p.target, false)
+		r.expr(p.def)
+	}
+	if fn.exprBody != nil {
+		r.expr(fn.exprBody)
+	} else {
+		r.statements(fn.body)
+	}
+	r.pop()
+}
+
+func (r *resolver) class(cls *classLit, expression bool) {
+	if expression && cls.name != "" {
+		r.push(false)
+		defer r.pop()
+		r.declare(&ident{name: cls.name, ln: cls.nameAt.line, col: cls.nameAt.col}, false)
+	}
+	r.expr(cls.super)
+	if cls.ctor != nil {
+		r.function(cls.ctor, false)
+	}
+	for _, m := range cls.members {
+		r.expr(m.computed)
+		if m.fn != nil {
+			r.function(m.fn, false)
+		}
+		r.expr(m.value)
+	}
+}
+
+func (r *resolver) expr(x expr) {
+	switch x := x.(type) {
+	case *ident:
+		r.use(x)
+	case *tmplLit:
+		r.exprs(x.exprs)
+	case *arrayLit:
+		r.exprs(x.elems)
+	case *objectLit:
+		for _, p := range x.props {
+			r.expr(p.computed)
+			if fn, ok := p.value.(*funcLit); ok && p.method {
+				r.function(fn, false)
+				continue
+			}
+			r.expr(p.value)
+		}
+	case *funcLit:
+		r.function(x, true)
+	case *classLit:
+		r.class(x, true)
+	case *unaryExpr:
+		r.expr(x.x)
+	case *updateExpr:
+		r.assign(x.x)
+	case *binaryExpr:
+		r.expr(x.l)
+		r.expr(x.r)
+	case *logicalExpr:
+		r.expr(x.l)
+		r.expr(x.r)
+	case *condExpr:
+		r.expr(x.test)
+		r.expr(x.cons)
+		r.expr(x.alt)
+	case *assignExpr:
+		r.assign(x.target)
+		r.expr(x.value)
+	case *callExpr:
+		r.expr(x.callee)
+		r.exprs(x.args)
+	case *newExpr:
+		r.expr(x.callee)
+		r.exprs(x.args)
+	case *memberExpr:
+		r.expr(x.obj)
+		r.expr(x.computed)
+	case *spreadExpr:
+		r.expr(x.x)
+	case *seqExpr:
+		r.exprs(x.list)
+	case *awaitExpr:
+		if r.functions == 0 {
+			r.s.Await = true
+		}
+		r.expr(x.x)
+	case *arrayPattern:
+		for _, elem := range x.elems {
+			if elem != nil {
+				r.expr(elem.target)
+				r.expr(elem.def)
+			}
+		}
+		r.expr(x.rest)
+	case *objectPattern:
+		for i := range x.props {
+			r.expr(x.props[i].computed)
+			r.expr(x.props[i].target)
+			r.expr(x.props[i].def)
+		}
+		r.expr(x.rest)
+	}
+}
+
+func (r *resolver) exprs(list []expr) {
+	for _, x := range list {
+		r.expr(x)
+	}
+}
@@ -0,0 +1,68 @@
+package sandbox
+
+import (
+	"slices"
+	"sync"
+)
+
+// Session runs programs one after another in one global scope, so each
+// sees the variables, functions and classes the ones before it declared,
+// as in a REPL or a notebook. It is safe for concurrent use; runs take
+// turns.
+type Session struct {
+	mu sync.Mutex
+	in *interp
+}
+
+func NewSession() *Session {
+	return &Session{in: &interp{}}
+}
+
+// Run runs code like the package's Run, in the session's global scope.
+// The limits in opts apply to this run alone, except MaxMemory, which
+// bounds everything the session's values hold, earlier runs' included.
+// A top-level declaration replaces an earlier one of the same name, so a
+// program can be edited and run again.
+func (s *Session) Run(code string, opts Options) *Result {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.in.run(code, opts)
+}
+
+// Globals returns the variables the session's runs have declared, in the
+// order they were first declared
+func (s *Session) Globals() []Variable {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.in.global == nil {
+		return []Variable{}
+	}
+	return variables(s.in.global, map[string]bool{})
+}
+
+// declaredNames are the names program declares at its top level
+func declaredNames(program []stmt) []string {
+	var names []string
+	for _, s := range program {
+		switch s := s.(type) {
+		case *varDecl:
+			for _, d := range s.decls {
+				names = append(names, patternNames(d.target)...)
+			}
+		case *funcDecl:
+			names = append(names, s.fn.name)
+		case *classDecl:
+			names = append(names, s.cls.name)
+		}
+	}
+	return names
+}
+
+// forget removes a name declared in e
+func (e *env) forget(name string) {
+	if _, ok := e.vars[name]; !ok {
+		return
+	}
+	delete(e.vars, name)
+	e.names = slices.DeleteFunc(e.names, func(n string) bool { return n == name })
+}
@@ -0,0 +1,300 @@
+package sandbox
+
+import "strings"
+
+// Node is a syntax tree node in a form other packages can walk, e.g. to
+// visualize program structure. Kinds follow ESTree names.
+type Node struct {
+	Kind  string `json:"kind"`
+	Label string `json:"label,omitempty"`
+	Line  int    `json:"line,omitempty"`
+	// Role is the node's relation to its parent, such as "test" or "body"
+	Role     string  `json:"role,omitempty"`
+	Children []*Node `json:"children,omitempty"`
+}
+
+// Tree parses code and returns its syntax tree, rooted at a Program node
+func Tree(code string) (*Node, error) {
+	program, err := parse(code)
+	if err != nil {
+		return nil, err
+	}
+	return newNode("Program", "", 0, statements("body", program)...), nil
+}
+
+func newNode(kind, label string, line int, children ...*Node) *Node {
+	n := &Node{Kind: kind, Label: label, Line: line}
+	for _, c := range children {
+		if c != nil {
+			n.Children = append(n.Children, c)
+		}
+	}
+	return n
+}
+
+// role tags n with its relation to its parent
+func role(name string, n *Node) *Node {
+	if n != nil {
+		n.Role = name
+	}
+	return n
+}
+
+func statements(name string, body []stmt) []*Node {
+	nodes := make([]*Node, 0, len(body))
+	for _, s := range body {
+		nodes = append(nodes, role(name, stmtNode(s)))
+	}
+	return nodes
+}
+
+func expressions(name string, list []expr) []*Node {
+	nodes := make([]*Node, 0, len(list))
+	for _, x := range list {
+		nodes = append(nodes, role(name, exprNode(x)))
+	}
+	return nodes
+}
+
+func stmtNode(s stmt) *Node {
+	switch s := s.(type) {
+	case nil:
+		return nil
+	case *varDecl:
+		decls := make([]*Node, 0, len(s.decls))
+		for _, d := range s.decls {
+			decls = append(decls, role("declarations", newNode("VariableDeclarator", "", s.ln, role("id", exprNode(d.target)), role("init", exprNode(d.init)))))
+		}
+		return newNode("VariableDeclaration", s.kind, s.ln, decls...)
+	case *funcDecl:
+		n := funcNode(s.fn)
+		n.Kind, n.Line = "FunctionDeclaration", s.ln
+		return n
+	case *classDecl:
+		n := classNode(s.cls)
+		n.Kind, n.Line = "ClassDeclaration", s.ln
+		return n
+	case *exprStmt:
+		return newNode("ExpressionStatement", "", s.ln, role("expression", exprNode(s.x)))
+	case *ifStmt:
+		return newNode("IfStatement", "", s.ln, role("test", exprNode(s.test)), role("consequent", stmtNode(s.cons)), role("alternate", stmtNode(s.alt)))
+	case *forStmt:
+		return newNode("ForStatement", "", s.ln, role("init", stmtNode(s.init)), role("test", exprNode(s.test)), role("update", exprNode(s.update)), role("body", stmtNode(s.body)))
+	case *forInOf:
+		kind := "ForInStatement"
+		if s.of {
+			kind = "ForOfStatement"
+		}
+		return newNode(kind, s.declKind, s.ln, role("left", exprNode(s.target)), role("right", exprNode(s.iter)), role("body", stmtNode(s.body)))
+	case *whileStmt:
+		kind := "WhileStatement"
+		if s.do {
+			kind = "DoWhileStatement"
+		}
+		return newNode(kind, "", s.ln, role("test", exprNode(s.test)), role("body", stmtNode(s.body)))
+	case *blockStmt:
+		return newNode("BlockStatement", "", s.ln, statements("body", s.body)...)
+	case *returnStmt:
+		return newNode("ReturnStatement", "", s.ln, role("argument", exprNode(s.x)))
+	case *breakStmt:
+		return newNode("BreakStatement", s.label, s.ln)
+	case *continueStmt:
+		return newNode("ContinueStatement", s.label, s.ln)
+	case *throwStmt:
+		return newNode("ThrowStatement", "", s.ln, role("argument", exprNode(s.x)))
+	case *tryStmt:
+		var handler *Node
+		if s.handler != nil {
+			handler = newNode("CatchClause", "", s.handler.ln, role("param", exprNode(s.param)), role("body", stmtNode(s.handler)))
+		}
+		var finalizer *Node
+		if s.finalizer != nil {
+			finalizer = stmtNode(s.finalizer)
+		}
+		return newNode("TryStatement", "", s.ln, role("block", stmtNode(s.block)), role("handler", handler), role("finalizer", finalizer))
+	case *switchStmt:
+		cases := []*Node{role("discriminant", exprNode(s.disc))}
+		for _, c := range s.cases {
+			label := ""
+			if c.test == nil {
+				label = "default"
+			}
+			children := append([]*Node{role("test", exprNode(c.test))}, statements("consequent", c.body)...)
+			cases = append(cases, role("cases", newNode("SwitchCase", label, s.ln, children...)))
+		}
+		return newNode("SwitchStatement", "", s.ln, cases...)
+	case *labeledStmt:
+		return newNode("LabeledStatement", s.label, s.ln, role("body", stmtNode(s.body)))
+	case *emptyStmt:
+		return newNode("EmptyStatement", "", s.ln)
+	}
+	return newNode("Unknown", "", s.line())
+}
+
+func exprNode(x expr) *Node {
+	switch x := x.(type) {
+	case nil:
+		return nil
+	case *numLit:
+		return newNode("Literal", numberToString(x.v), 0)
+	case *strLit:
+		return newNode("Literal", quoteString(x.v), 0)
+	case *boolLit:
+		if x.v {
+			return newNode("Literal", "true", 0)
+		}
+		return newNode("Literal", "false", 0)
+	case *nullLit:
+		return newNode("Literal", "null", 0)
+	case *thisExpr:
+		return newNode("ThisExpression", "", 0)
+	case *superExpr:
+		return newNode("Super", "", 0)
+	case *ident:
+		return newNode("Identifier", x.name, x.ln)
+	case *tmplLit:
+		return newNode("TemplateLiteral", "`"+strings.Join(x.parts, "${…}")+"`", 0, expressions("expressions", x.exprs)...)
+	case *arrayLit:
+		return newNode("ArrayExpression", "", 0, expressions("elements", x.elems)...)
+	case *objectLit:
+		props := make([]*Node, 0, len(x.props))
+		for _, p := range x.props {
+			if p.kind == "spread" {
+				props = append(props, role("properties", newNode("SpreadElement", "", 0, role("argument", exprNode(p.value)))))
+				continue
+			}
+			label := p.key
+			if p.kind != "init" {
+				label = p.kind + " " + label
+			}
+			props = append(props, role("properties", newNode("Property", label, 0, role("key", exprNode(p.computed)), role("value", exprNode(p.value)))))
+		}
+		return newNode("ObjectExpression", "", 0, props...)
+	case *funcLit:
+		return funcNode(x)
+	case *classLit:
+		return classNode(x)
+	case *unaryExpr:
+		return newNode("UnaryExpression", x.op, 0, role("argument", exprNode(x.x)))
+	case *updateExpr:
+		label := x.op + " (postfix)"
+		if x.prefix {
+			label = x.op + " (prefix)"
+		}
+		return newNode("UpdateExpression", label, 0, role("argument", exprNode(x.x)))
+	case *binaryExpr:
+		return newNode("BinaryExpression", x.op, 0, role("left", exprNode(x.l)), role("right", exprNode(x.r)))
+	case *logicalExpr:
+		return newNode("LogicalExpression", x.op, 0, role("left", exprNode(x.l)), role("right", exprNode(x.r)))
+	case *condExpr:
+		return newNode("ConditionalExpression", "", 0, role("test", exprNode(x.test)), role("consequent", exprNode(x.cons)), role("alternate", exprNode(x.alt)))
+	case *assignExpr:
+		return newNode("AssignmentExpression", x.op, 0, role("left", exprNode(x.target)), role("right", exprNode(x.value)))
+	case *callExpr:
+		label := ""
+		if x.optional {
+			label = "?."
+		}
+		return newNode("CallExpression", label, 0, append([]*Node{role("callee", exprNode(x.callee))}, expressions("arguments", x.args)...)...)
+	case *newExpr:
+		return newNode("NewExpression", "", 0, append([]*Node{role("callee", exprNode(x.callee))}, expressions("arguments", x.args)...)...)
+	case *memberExpr:
+		label := "." + x.prop
+		if x.computed != nil {
+			label = "[ ]"
+		}
+		if x.optional {
+			label = "?" + label
+		}
+		return newNode("MemberExpression", label, 0, role("object", exprNode(x.obj)), role("property", exprNode(x.computed)))
+	case *spreadExpr:
+		return newNode("SpreadElement", "", 0, role("argument", exprNode(x.x)))
+	case *seqExpr:
+		return newNode("SequenceExpression", "", 0, expressions("expressions", x.list)...)
+	case *awaitExpr:
+		return newNode("AwaitExpression", "", 0, role("argument", exprNode(x.x)))
+	case *arrayPattern:
+		elems := make([]*Node, 0, len(x.elems)+1)
+		for _, elem := range x.elems {
+			if elem == nil {
+				// a hole keeps the elements after it at their indexes
+				elems = append(elems, role("elements", newNode("Elision", "", 0)))
+				continue
+			}
+			elems = append(elems, role("elements", patternNode(elem)))
+		}
+		if x.rest != nil {
+			elems = append(elems, role("elements", newNode("RestElement", "", 0, role("argument", exprNode(x.rest)))))
+		}
+		return newNode("ArrayPattern", "", 0, elems...)
+	case *objectPattern:
+		props := make([]*Node, 0, len(x.props)+1)
+		for i := range x.props {
+			prop := newNode("Property", x.props[i].key, 0, role("key", exprNode(x.props[i].computed)), role("value", patternNode(&x.props[i])))
+			props = append(props, role("properties", prop))
+		}
+		if x.rest != nil {
+			props = append(props, role("properties", newNode("RestElement", "", 0, role("argument", exprNode(x.rest)))))
+		}
+		return newNode("ObjectPattern", "", 0, props...)
+	}
+	return newNode("Unknown", "", 0)
+}
+
+// patternNode is a destructuring target, wrapped when it has a default
+func patternNode(elem *patternElem) *Node {
+	if elem.def == nil {
+		return exprNode(elem.target)
+	}
+	return newNode("AssignmentPattern", "", 0, role("left", exprNode(elem.target)), role("right", exprNode(elem.def)))
+}
+
+func funcNode(fn *funcLit) *Node {
+	kind := "FunctionExpression"
+	if fn.arrow {
+		kind = "ArrowFunctionExpression"
+	}
+	label := fn.name
+	if fn.async {
+		label = strings.TrimSpace("async " + label)
+	}
+	var children []*Node
+	for _, p := range fn.params {
+		param := exprNode(p.target)
+		switch {
+		case p.rest:
+			param = newNode("RestElement", "", 0, role("argument", param))
+		case p.def != nil:
+			param = newNode("AssignmentPattern", "", 0, role("left", param), role("right", exprNode(p.def)))
+		}
+		children = append(children, role("params", param))
+	}
+	if fn.exprBody != nil {
+		children = append(children, role("body", exprNode(fn.exprBody)))
+	} else {
+		children = append(children, statements("body", fn.body)...)
+	}
+	return newNode(kind, label, fn.ln, children...)
+}
+
+func classNode(cls *classLit) *Node {
+	children := []*Node{role("superClass", exprNode(cls.super))}
+	if cls.ctor != nil {
+		children = append(children, role("body", newNode("MethodDefinition", "constructor", cls.ctor.ln, role("value", funcNode(cls.ctor)))))
+	}
+	for _, m := range cls.members {
+		label := m.name
+		if m.kind == "get" || m.kind == "set" {
+			label = m.kind + " " + label
+		}
+		if m.static {
+			label = "static " + label
+		}
+		if m.kind == "field" {
+			children = append(children, role("body", newNode("PropertyDefinition", label, 0, role("key", exprNode(m.computed)), role("value", exprNode(m.value)))))
+			continue
+		}
+		children = append(children, role("body", newNode("MethodDefinition", label, m.fn.ln, role("key", exprNode(m.computed)), role("value", funcNode(m.fn)))))
+	}
+	return newNode("ClassExpression", cls.name, 0, children...)
+}
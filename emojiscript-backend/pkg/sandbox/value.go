@@ -0,0 +1,483 @@
+package sandbox
+
+import (
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Value is a JavaScript value: undefinedType, nullType, float64, string,
+// bool, *object, *array or *function
+type Value interface{}
+
+type undefinedType struct{}
+type nullType struct{}
+
+var (
+	undefined Value = undefinedType{}
+	null      Value = nullType{}
+)
+
+type object struct {
+	props   map[string]Value
+	keys    []string
+	getters map[string]*function
+	setters map[string]*function
+	proto   *object
+	frozen  bool
+	// internal holds native state, e.g. a Map's entries
+	internal interface{}
+}
+
+func newObject(proto *object) *object {
+	return &object{props: map[string]Value{}, proto: proto}
+}
+
+func (o *object) set(key string, v Value) {
+	if _, ok := o.props[key]; !ok {
+		o.keys = append(o.keys, key)
+	}
+	o.props[key] = v
+}
+
+func (o *object) delete(key string) {
+	if _, ok := o.props[key]; !ok {
+		return
+	}
+	delete(o.props, key)
+	for i, k := range o.keys {
+		if k == key {
+			o.keys = append(o.keys[:i:i], o.keys[i+1:]...)
+			break
+		}
+	}
+}
+
+// ownKeys returns enumerable keys with integer keys first, as JS orders them
+func (o *object) ownKeys() []string {
+	ints, strs := []string{}, []string{}
+	for _, k := range o.keys {
+		if isArrayIndex(k) {
+			ints = append(ints, k)
+		} else {
+			strs = append(strs, k)
+		}
+	}
+	sort.Slice(ints, func(i, j int) bool {
+		a, _ := strconv.Atoi(ints[i])
+		b, _ := strconv.Atoi(ints[j])
+		return a < b
+	})
+	return append(ints, strs...)
+}
+
+type array struct {
+	elems []Value
+}
+
+type function struct {
+	name   string
+	lit    *funcLit
+	env    *env
+	native func(in *interp, this Value, args []Value) (Value, error)
+	// proto is the .prototype object given to instances
+	proto *object
+	// statics holds properties set on the function itself
+	statics *object
+	cls     *class
+	// home is the object a method was defined on, for super lookups
+	home *object
+	// ctor marks native functions that may be called with new
+	ctor bool
+}
+
+type class struct {
+	ctor   *function
+	parent *function
+	fields []fieldInit
+	env    *env
+}
+
+// fieldInit is an instance field, initialized on construction
+type fieldInit struct {
+	key   string
+	value expr
+}
+
+type mapEntry struct {
+	key, value Value
+}
+
+// orderedMap backs Map and Set, keeping insertion order
+type orderedMap struct {
+	entries []mapEntry
+	isSet   bool
+}
+
+func (m *orderedMap) find(key Value) int {
+	for i, e := range m.entries {
+		if sameValueZero(e.key, key) {
+			return i
+		}
+	}
+	return -1
+}
+
+func isArrayIndex(k string) bool {
+	if k == "" || len(k) > 1 && k[0] == '0' {
+		return false
+	}
+	for _, c := range k {
+		if c < '0' || c > '9' {
+			return false
+		}
+	}
+	return true
+}
+
+func typeOf(v Value) string {
+	switch v.(type) {
+	case undefinedType:
+		return "undefined"
+	case nullType:
+		return "object"
+	case float64:
+		return "number"
+	case string:
+		return "string"
+	case bool:
+		return "boolean"
+	case *function:
+		return "function"
+	}
+	return "object"
+}
+
+func truthy(v Value) bool {
+	switch v := v.(type) {
+	case undefinedType, nullType:
+		return false
+	case bool:
+		return v
+	case float64:
+		return v != 0 && !math.IsNaN(v)
+	case string:
+		return v != ""
+	}
+	return true
+}
+
+func numberToString(n float64) string {
+	switch {
+	case math.IsNaN(n):
+		return "NaN"
+	case math.IsInf(n, 1):
+		return "Infinity"
+	case math.IsInf(n, -1):
+		return "-Infinity"
+	case n == 0:
+		return "0"
+	}
+	abs := math.Abs(n)
+	if abs >= 1e21 || abs < 1e-6 {
+		s := strconv.FormatFloat(n, 'e', -1, 64)
+		mantissa, exp, _ := strings.Cut(s, "e")
+		exp = strings.TrimLeft(exp, "+")
+		sign := "+"
+		if strings.HasPrefix(exp, "-") {
+			sign, exp = "-", exp[1:]
+		}
+		return mantissa + "e" + sign + strings.TrimLeft(exp, "0")
+	}
+	return strconv.FormatFloat(n, 'f', -1, 64)
+}
+
+func stringToNumber(s string) float64 {
+	s = strings.TrimSpace(s)
+	if s == "" {
+		return 0
+	}
+	switch s {
+	case "Infinity", "+Infinity":
+		return math.Inf(1)
+	case "-Infinity":
+		return math.Inf(-1)
+	}
+	if len(s) > 2 && s[0] == '0' && strings.ContainsRune("xXbBoO", rune(s[1])) {
+		base := map[byte]int{'x': 16, 'X': 16, 'b': 2, 'B': 2, 'o': 8, 'O': 8}[s[1]]
+		n, err := strconv.ParseInt(s[2:], base, 64)
+		if err != nil {
+			return math.NaN()
+		}
+		return float64(n)
+	}
+	if strings.ContainsAny(s, "_xXpP") || strings.HasPrefix(strings.ToLower(strings.TrimLeft(s, "+-")), "inf") || strings.EqualFold(s, "nan") {
+		return math.NaN()
+	}
+	n, err := strconv.ParseFloat(s, 64)
+	if err != nil {
+		return math.NaN()
+	}
+	return n
+}
+
+func toInt32(n float64) int32 {
+	if math.IsNaN(n) || math.IsInf(n, 0) {
+		return 0
+	}
+	return int32(uint32(int64(math.Trunc(math.Mod(n, 4294967296)))))
+}
+
+func sameValueZero(a, b Value) bool {
+	if x, ok := a.(float64); ok {
+		if y, ok := b.(float64); ok && math.IsNaN(x) && math.IsNaN(y) {
+			return true
+		}
+	}
+	return strictEquals(a, b)
+}
+
+func strictEquals(a, b Value) bool {
+	switch x := a.(type) {
+	case undefinedType:
+		_, ok := b.(undefinedType)
+		return ok
+	case nullType:
+		_, ok := b.(nullType)
+		return ok
+	case float64:
+		y, ok := b.(float64)
+		return ok && x == y
+	case string:
+		y, ok := b.(string)
+		return ok && x == y
+	case bool:
+		y, ok := b.(bool)
+		return ok && x == y
+	}
+	return a == b
+}
+
+func isNullish(v Value) bool {
+	switch v.(type) {
+	case undefinedType, nullType:
+		return true
+	}
+	return false
+}
+
+// inspect formats a value the way Node's console.log does
+func inspect(v Value, depth int, seen map[interface{}]bool) string {
+	switch v := v.(type) {
+	case string:
+		if depth == 0 {
+			return v
+		}
+		return quoteString(v)
+	case *array:
+		if seen[v] {
+			return "[Circular]"
+		}
+		if len(v.elems) == 0 {
+			return "[]"
+		}
+		if depth > 2 {
+			return "[Array]"
+		}
+		seen[v] = true
+		defer delete(seen, v)
+		parts := make([]string, 0, len(v.elems))
+		for i, e := range v.elems {
+			if i == 100 {
+				parts = append(parts, "... "+strconv.Itoa(len(v.elems)-100)+" more items")
+				break
+			}
+			parts = append(parts, inspect(e, depth+1, seen))
+		}
+		return wrapList("[", parts, "]")
+	case *object:
+		if seen[v] {
+			return "[Circular]"
+		}
+		prefix := ""
+		if name := className(v); name != "" && name != "Object" {
+			prefix = name + " "
+		}
+		if entries, ok := v.internal.(*orderedMap); ok {
+			return strings.TrimSuffix(prefix, " ") + inspectMap(v, entries, depth, seen)
+		}
+		if d, ok := v.internal.(date); ok {
+			if math.IsNaN(float64(d)) {
+				return "Invalid Date"
+			}
+			return d.iso()
+		}
+		if isError(v) {
+			return errorString(v)
+		}
+		keys := v.ownKeys()
+		if len(keys) == 0 {
+			return prefix + "{}"
+		}
+		if depth > 2 {
+			return "[Object]"
+		}
+		seen[v] = true
+		defer delete(seen, v)
+		parts := make([]string, 0, len(keys))
+		for _, k := range keys {
+			parts = append(parts, propertyName(k)+": "+inspect(v.props[k], depth+1, seen))
+		}
+		return prefix + wrapList("{", parts, "}")
+	case *function:
+		if v.cls != nil {
+			if v.name == "" {
+				return "[class (anonymous)]"
+			}
+			return "[class " + v.name + "]"
+		}
+		if v.name == "" {
+			return "[Function (anonymous)]"
+		}
+		return "[Function: " + v.name + "]"
+	}
+	return toDisplayString(v)
+}
+
+func inspectMap(o *object, m *orderedMap, depth int, seen map[interface{}]bool) string {
+	isSet := m.isSet
+	parts := []string{}
+	seen[o] = true
+	defer delete(seen, o)
+	for _, e := range m.entries {
+		if isSet {
+			parts = append(parts, inspect(e.key, depth+1, seen))
+		} else {
+			parts = append(parts, inspect(e.key, depth+1, seen)+" => "+inspect(e.value, depth+1, seen))
+		}
+	}
+	return "(" + strconv.Itoa(len(m.entries)) + ") " + wrapList("{", parts, "}")
+}
+
+func wrapList(open string, parts []string, close string) string {
+	if len(parts) == 0 {
+		return open + close
+	}
+	line := open + " " + strings.Join(parts, ", ") + " " + close
+	if len(line) <= 72 && !strings.Contains(line, "\n") {
+		return line
+	}
+	return open + "\n  " + strings.ReplaceAll(strings.Join(parts, ",\n"), "\n", "\n  ") + "\n" + close
+}
+
+func propertyName(k string) string {
+	if k == "" {
+		return "''"
+	}
+	for i, r := range k {
+		if !(isIdentStart(r) || i > 0 && isIdentPart(r)) {
+			return quoteString(k)
+		}
+	}
+	return k
+}
+
+func quoteString(s string) string {
+	quote := "'"
+	if strings.Contains(s, "'") && !strings.Contains(s, `"`) {
+		quote = `"`
+	}
+	r := strings.NewReplacer(`\`, `\\`, "\n", `\n`, "\t", `\t`, quote, `\`+quote)
+	return quote + r.Replace(s) + quote
+}
+
+// toDisplayString is JavaScript's String(v) for primitives and the
+// fallbacks used when objects are concatenated
+func toDisplayString(v Value) string {
+	switch v := v.(type) {
+	case undefinedType:
+		return "undefined"
+	case nullType:
+		return "null"
+	case float64:
+		return numberToString(v)
+	case string:
+		return v
+	case bool:
+		if v {
+			return "true"
+		}
+		return "false"
+	case *array:
+		parts := make([]string, len(v.elems))
+		for i, e := range v.elems {
+			if !isNullish(e) {
+				parts[i] = toDisplayString(e)
+			}
+		}
+		return strings.Join(parts, ",")
+	case *object:
+		if isError(v) {
+			return errorString(v)
+		}
+		if d, ok := v.internal.(date); ok {
+			return d.String()
+		}
+		return "[object Object]"
+	case *function:
+		if v.cls != nil {
+			return "class " + v.name + " { }"
+		}
+		return "function " + v.name + "() { [code] }"
+	}
+	return ""
+}
+
+// className finds the constructor name on an object's prototype chain
+func className(o *object) string {
+	for p := o.proto; p != nil; p = p.proto {
+		if ctor, ok := p.props["constructor"].(*function); ok {
+			return ctor.name
+		}
+	}
+	return ""
+}
+
+func isError(o *object) bool {
+	for p := o.proto; p != nil; p = p.proto {
+		if p.internal == errorProtoMarker {
+			return true
+		}
+	}
+	return false
+}
+
+type protoMarker struct{}
+
+// errorProtoMarker tags Error.prototype so subclasses format as errors
+var errorProtoMarker = &protoMarker{}
+
+func errorString(o *object) string {
+	name, message := "Error", ""
+	if n, ok := lookup(o, "name").(string); ok {
+		name = n
+	}
+	if m, ok := lookup(o, "message").(string); ok {
+		message = m
+	}
+	if message == "" {
+		return name
+	}
+	return name + ": " + message
+}
+
+// lookup reads a data property along the prototype chain, ignoring getters
+func lookup(o *object, key string) Value {
+	for p := o; p != nil; p = p.proto {
+		if v, ok := p.props[key]; ok {
+			return v
+		}
+	}
+	return undefined
+}
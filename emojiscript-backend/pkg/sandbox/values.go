@@ -0,0 +1,48 @@
+package sandbox
+
+// LineValue is what one top-level statement produced, for an editor to
+// show at the end of its line: the value of an expression, the value each
+// name a declaration binds, and what the statement printed
+type LineValue struct {
+	Line int `json:"line"`
+	// Name is the variable a declaration bound; empty for an expression
+	Name string `json:"name,omitempty"`
+	// Value and Type are left out when the statement has no value to
+	// show: it declared nothing, or was an expression that came to
+	// undefined, such as a console.log call
+	Value  string   `json:"value,omitempty"`
+	Type   string   `json:"type,omitempty"`
+	Stdout []string `json:"stdout,omitempty"`
+}
+
+// recordValue notes what the top-level statement s produced, printed
+// being how many lines of output there were before it ran
+func (in *interp) recordValue(s stmt, printed int) {
+	var stdout []string
+	if printed < len(in.stdout) {
+		stdout = append([]string{}, in.stdout[printed:]...)
+	}
+	var values []LineValue
+	switch s := s.(type) {
+	case *exprStmt:
+		if in.completion != undefined {
+			values = append(values, LineValue{Line: s.line(), Value: snapshot(in.completion), Type: typeOf(in.completion)})
+		}
+	case *varDecl:
+		for _, d := range s.decls {
+			for _, name := range patternNames(d.target) {
+				if b, ok := in.global.vars[name]; ok {
+					values = append(values, LineValue{Line: s.line(), Name: name, Value: snapshot(b.value), Type: typeOf(b.value)})
+				}
+			}
+		}
+	}
+	if len(values) == 0 && stdout != nil {
+		values = []LineValue{{Line: s.line()}}
+	}
+	if len(values) > 0 {
+		// the output goes with the statement's first value
+		values[0].Stdout = stdout
+	}
+	in.values = append(in.values, values...)
+}
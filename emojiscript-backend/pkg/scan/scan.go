@@ -0,0 +1,235 @@
+// Package scan checks a program before it's published as a snippet: for
+// words on a profanity list, and for links in its strings that look like
+// malware. Each Rule pairs a Scanner with what to do about its findings.
+package scan
+
+import (
+	"fmt"
+	"net"
+	"net/url"
+	"os"
+	"path"
+	"regexp"
+	"strings"
+	"unicode"
+
+	"emojiscript-backend/pkg/transpiler"
+)
+
+const (
+	// ActionBlock refuses to save the snippet
+	ActionBlock = "block"
+	// ActionFlag saves the snippet and queues it for an admin's review
+	ActionFlag = "flag"
+)
+
+// Input is the program being scanned
+type Input struct {
+	Code string
+	// Output is what Code transpiled to; empty when it didn't
+	Output string
+	// Markup is whether Code is in the markup syntax
+	Markup bool
+}
+
+// literals returns the text of the string and template literals in the
+// program, with the line each starts on. Markup is scanned through its
+// JavaScript, as its strings sit in attributes and tag bodies.
+func (in Input) literals() ([]string, []int) {
+	source := in.Code
+	if in.Markup {
+		source = in.Output
+	}
+	tokens, _ := transpiler.Lex(source)
+	var texts []string
+	var lines []int
+	for _, token := range tokens {
+		if token.Kind == transpiler.TokenString || token.Kind == transpiler.TokenTemplate {
+			texts = append(texts, token.Text)
+			lines = append(lines, token.Line)
+		}
+	}
+	return texts, lines
+}
+
+// Finding is one thing a Scanner objects to
+type Finding struct {
+	Scanner string `json:"scanner"`
+	// Reason is the moderation reason a flagged snippet is queued with:
+	// abuse or malicious
+	Reason  string `json:"reason"`
+	Message string `json:"message"`
+	Line    int    `json:"line,omitempty"`
+}
+
+// Scanner checks a program for content that shouldn't be published
+type Scanner interface {
+	// Name identifies the scanner in findings and configuration
+	Name() string
+	Scan(in Input) []Finding
+}
+
+// Rule runs a Scanner and says what its findings do, ActionBlock or
+// ActionFlag
+type Rule struct {
+	Scanner Scanner
+	Action  string
+}
+
+// Check runs each rule over in, returning the findings that block the
+// snippet and those that flag it
+func Check(rules []Rule, in Input) (blocked, flagged []Finding) {
+	for _, rule := range rules {
+		findings := rule.Scanner.Scan(in)
+		if rule.Action == ActionBlock {
+			blocked = append(blocked, findings...)
+		} else {
+			flagged = append(flagged, findings...)
+		}
+	}
+	return blocked, flagged
+}
+
+// Profanity finds words from a list anywhere in a program, in names as
+// well as strings and comments, ignoring case
+type Profanity struct {
+	words map[string]bool
+}
+
+func NewProfanity(words []string) *Profanity {
+	p := &Profanity{words: map[string]bool{}}
+	for _, word := range words {
+		if word = strings.ToLower(strings.TrimSpace(word)); word != "" {
+			p.words[word] = true
+		}
+	}
+	return p
+}
+
+func (p *Profanity) Name() string { return "profanity" }
+
+func (p *Profanity) Scan(in Input) []Finding {
+	var findings []Finding
+	for i, line := range strings.Split(in.Code, "\n") {
+		words := strings.FieldsFunc(strings.ToLower(line), func(r rune) bool {
+			return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+		})
+		for _, word := range words {
+			if p.words[word] {
+				findings = append(findings, Finding{Scanner: p.Name(), Reason: "abuse", Message: fmt.Sprintf("uses the blocked word %q", word), Line: i + 1})
+			}
+		}
+	}
+	return findings
+}
+
+var urlPattern = regexp.MustCompile(`(?i)\b(?:https?|ftp)://[^\s"'` + "`" + `<>\\]+`)
+
+// executableExtensions are downloads that run code when opened
+var executableExtensions = map[string]bool{
+	".exe": true, ".scr": true, ".msi": true, ".bat": true, ".cmd": true, ".com": true, ".ps1": true,
+	".vbs": true, ".jar": true, ".apk": true, ".dmg": true, ".pkg": true, ".hta": true,
+}
+
+// URLs finds links in a program's strings that look like malware: to a
+// blocked host or its subdomains, to a bare IP address, to an executable
+// download, with credentials in front of the host to disguise it, or with
+// a punycode host that may imitate another
+type URLs struct {
+	blockedHosts []string
+}
+
+func NewURLs(blockedHosts []string) *URLs {
+	u := &URLs{}
+	for _, host := range blockedHosts {
+		if host = strings.ToLower(strings.TrimSpace(host)); host != "" {
+			u.blockedHosts = append(u.blockedHosts, host)
+		}
+	}
+	return u
+}
+
+func (u *URLs) Name() string { return "urls" }
+
+func (u *URLs) Scan(in Input) []Finding {
+	var findings []Finding
+	texts, lines := in.literals()
+	for i, text := range texts {
+		for _, link := range urlPattern.FindAllString(text, -1) {
+			if problem := u.check(link); problem != "" {
+				findings = append(findings, Finding{Scanner: u.Name(), Reason: "malicious", Message: fmt.Sprintf("links to %s, which %s", link, problem), Line: lines[i]})
+			}
+		}
+	}
+	return findings
+}
+
+// check describes what's wrong with link, or returns ""
+func (u *URLs) check(link string) string {
+	parsed, err := url.Parse(link)
+	if err != nil {
+		return "isn't a valid URL"
+	}
+	host := strings.ToLower(parsed.Hostname())
+	for _, blocked := range u.blockedHosts {
+		if host == blocked || strings.HasSuffix(host, "."+blocked) {
+			return "is on the blocked host list"
+		}
+	}
+	switch {
+	case parsed.User != nil:
+		return "hides its real host behind credentials"
+	case net.ParseIP(host) != nil:
+		return "is a bare IP address"
+	case strings.HasPrefix(host, "xn--") || strings.Contains(host, ".xn--"):
+		return "has a punycode host that may imitate another"
+	case executableExtensions[strings.ToLower(path.Ext(parsed.Path))]:
+		return "is an executable download"
+	}
+	return ""
+}
+
+// FromEnv builds the rules from the environment, read with getenv.
+// SNIPPET_SCAN_PROFANITY lists the words to look for, separated by
+// commas, or names a file of them, one a line, as "@path"; its findings
+// block unless SNIPPET_SCAN_PROFANITY_ACTION says flag. URLs are always
+// scanned, their findings flagging unless SNIPPET_SCAN_URLS_ACTION says
+// block, or off to skip them; SNIPPET_BLOCKED_HOSTS lists the hosts
+// to treat as malware, separated by commas.
+func FromEnv(getenv func(string) string) ([]Rule, error) {
+	var rules []Rule
+	if list := getenv("SNIPPET_SCAN_PROFANITY"); list != "" {
+		words := strings.Split(list, ",")
+		if file, ok := strings.CutPrefix(list, "@"); ok {
+			data, err := os.ReadFile(file)
+			if err != nil {
+				return nil, fmt.Errorf("profanity list: %w", err)
+			}
+			words = strings.Split(string(data), "\n")
+		}
+		action, err := parseAction(getenv("SNIPPET_SCAN_PROFANITY_ACTION"), ActionBlock)
+		if err != nil {
+			return nil, fmt.Errorf("SNIPPET_SCAN_PROFANITY_ACTION: %w", err)
+		}
+		rules = append(rules, Rule{Scanner: NewProfanity(words), Action: action})
+	}
+
+	if getenv("SNIPPET_SCAN_URLS_ACTION") != "off" {
+		action, err := parseAction(getenv("SNIPPET_SCAN_URLS_ACTION"), ActionFlag)
+		if err != nil {
+			return nil, fmt.Errorf("SNIPPET_SCAN_URLS_ACTION: %w", err)
+		}
+		rules = append(rules, Rule{Scanner: NewURLs(strings.Split(getenv("SNIPPET_BLOCKED_HOSTS"), ",")), Action: action})
+	}
+	return rules, nil
+}
+
+func parseAction(action, fallback string) (string, error) {
+	switch action {
+	case "":
+		return fallback, nil
+	case ActionBlock, ActionFlag:
+		return action, nil
+	}
+	return "", fmt.Errorf("unknown action %q, want block or flag", action)
+}
@@ -0,0 +1,268 @@
+package service
+
+import (
+	"container/list"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"sync"
+	"time"
+
+	"emojiscript-backend/pkg/chaos"
+	"emojiscript-backend/pkg/kvcache"
+)
+
+// cacheEntryOverhead approximates the map slot, entry struct and response
+// headers an entry costs on top of its serialized response
+const cacheEntryOverhead = 256
+
+const (
+	// remoteKeyPrefix namespaces transpile results in a shared store
+	remoteKeyPrefix = "emojiscript:transpile:"
+	// RemoteTimeout bounds each call to a remote store, so a slow store
+	// costs a miss rather than a slow response
+	RemoteTimeout = 300 * time.Millisecond
+)
+
+// TranspileCache is bounded by both entry count and an approximate byte
+// budget, since one large program can produce a response far bigger than
+// a typical one. When either is reached it evicts the least recently used
+// entry.
+type TranspileCache struct {
+	mu    sync.Mutex
+	cache map[string]*CacheEntry
+	// recent orders the entries from most to least recently used
+	recent   *list.List
+	maxSize  int
+	maxBytes int
+	bytes    int
+	ttl      time.Duration
+	// failureTTL is the shorter lifetime of cached parse failures
+	failureTTL time.Duration
+	// remote, when set, backs the in-memory entries with a store shared
+	// across instances
+	remote kvcache.Store
+	// chaos fails lookups and stores at random, for resilience testing
+	chaos *chaos.Injector
+
+	hits, remoteHits, misses, evictions int64
+}
+
+type CacheEntry struct {
+	key       string
+	result    *TranspileResponse
+	timestamp time.Time
+	ttl       time.Duration
+	size      int
+	element   *list.Element
+}
+
+func (e *CacheEntry) expired(now time.Time) bool {
+	return now.Sub(e.timestamp) >= e.ttl
+}
+
+func newTranspileCache(maxSize, maxBytes int, ttl, failureTTL time.Duration, remote kvcache.Store) *TranspileCache {
+	return &TranspileCache{cache: make(map[string]*CacheEntry), recent: list.New(), maxSize: maxSize, maxBytes: maxBytes, ttl: ttl, failureTTL: failureTTL, remote: remote}
+}
+
+// entrySize approximates an entry's memory by its serialized length
+func entrySize(key string, result *TranspileResponse) int {
+	encoded, err := json.Marshal(result)
+	if err != nil {
+		return cacheEntryOverhead + len(key) + len(result.Output) + len(result.JavaScript)
+	}
+	return cacheEntryOverhead + len(key) + len(encoded)
+}
+
+// Get returns a copy of a cached response, so callers can annotate its
+// metadata without touching the shared entry. A response missing from
+// memory is looked up in the remote store, if there is one, and kept in
+// memory once found. A nil cache holds nothing, for strict-privacy
+// requests.
+func (tc *TranspileCache) Get(key string) (*TranspileResponse, bool) {
+	if tc == nil {
+		return nil, false
+	}
+	if tc.chaos.CacheFailure() {
+		log.Print("transpile cache: chaos: injected cache failure")
+		tc.count(&tc.misses)
+		return nil, false
+	}
+	if result, found := tc.getLocal(key); found {
+		tc.count(&tc.hits)
+		return result, true
+	}
+	if tc.remote == nil {
+		tc.count(&tc.misses)
+		return nil, false
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), RemoteTimeout)
+	defer cancel()
+	value, found, err := tc.remote.Get(ctx, remoteKeyPrefix+key)
+	if err != nil {
+		log.Printf("transpile cache: %v", err)
+	}
+	var result TranspileResponse
+	if !found || json.Unmarshal(value, &result) != nil {
+		tc.count(&tc.misses)
+		return nil, false
+	}
+	tc.count(&tc.remoteHits)
+	if result.Metadata == nil {
+		result.Metadata = map[string]interface{}{}
+	}
+	ttl := tc.ttl
+	if !result.Success {
+		ttl = tc.failureTTL
+	}
+	tc.setLocal(key, &result, ttl)
+	return tc.getLocal(key)
+}
+
+func (tc *TranspileCache) getLocal(key string) (*TranspileResponse, bool) {
+	tc.mu.Lock()
+	defer tc.mu.Unlock()
+
+	entry, exists := tc.cache[key]
+	if !exists {
+		return nil, false
+	}
+	if entry.expired(time.Now()) {
+		tc.remove(entry)
+		return nil, false
+	}
+	tc.recent.MoveToFront(entry.element)
+
+	result := *entry.result
+	result.Metadata = make(map[string]interface{}, len(entry.result.Metadata))
+	for k, v := range entry.result.Metadata {
+		result.Metadata[k] = v
+	}
+	return &result, true
+}
+
+// Set stores a response, evicting the least recently used entries until
+// both the entry count and byte budget have room. Responses larger than
+// the whole budget aren't cached.
+func (tc *TranspileCache) Set(key string, result *TranspileResponse) {
+	if tc == nil {
+		return
+	}
+	tc.set(key, result, tc.ttl)
+}
+
+// SetFailure caches a parse failure for the shorter failure TTL, so a
+// broken program resubmitted while the user types isn't parsed again
+func (tc *TranspileCache) SetFailure(key string, result *TranspileResponse) {
+	if tc == nil {
+		return
+	}
+	tc.set(key, result, tc.failureTTL)
+}
+
+// set stores a response in memory and in the remote store, if there is
+// one
+func (tc *TranspileCache) set(key string, result *TranspileResponse, ttl time.Duration) {
+	if tc.chaos.CacheFailure() {
+		log.Print("transpile cache: chaos: injected cache failure")
+		return
+	}
+	tc.setLocal(key, result, ttl)
+	if tc.remote == nil {
+		return
+	}
+	value, err := json.Marshal(result)
+	if err != nil {
+		return
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), RemoteTimeout)
+	defer cancel()
+	if err := tc.remote.Set(ctx, remoteKeyPrefix+key, value, ttl); err != nil {
+		log.Printf("transpile cache: %v", err)
+	}
+}
+
+func (tc *TranspileCache) setLocal(key string, result *TranspileResponse, ttl time.Duration) {
+	size := entrySize(key, result)
+	if size > tc.maxBytes {
+		return
+	}
+
+	tc.mu.Lock()
+	defer tc.mu.Unlock()
+
+	if old, exists := tc.cache[key]; exists {
+		tc.remove(old)
+	}
+	for tc.recent.Len() > 0 && (len(tc.cache) >= tc.maxSize || tc.bytes+size > tc.maxBytes) {
+		tc.remove(tc.recent.Back().Value.(*CacheEntry))
+		tc.evictions++
+	}
+
+	entry := &CacheEntry{key: key, result: result, timestamp: time.Now(), ttl: ttl, size: size}
+	entry.element = tc.recent.PushFront(entry)
+	tc.cache[key] = entry
+	tc.bytes += size
+}
+
+func (tc *TranspileCache) remove(entry *CacheEntry) {
+	tc.recent.Remove(entry.element)
+	tc.bytes -= entry.size
+	delete(tc.cache, entry.key)
+}
+
+func (tc *TranspileCache) count(counter *int64) {
+	tc.mu.Lock()
+	*counter++
+	tc.mu.Unlock()
+}
+
+// CacheStats reports the transpile cache's size and how often it answers
+type CacheStats struct {
+	Entries int   `json:"entries"`
+	Bytes   int   `json:"bytes"`
+	Hits    int64 `json:"hits"`
+	// RemoteHits are lookups missing from memory that the remote store
+	// answered
+	RemoteHits int64 `json:"remoteHits"`
+	Misses     int64 `json:"misses"`
+	Evictions  int64 `json:"evictions"`
+	// Remote names the remote store, if there is one
+	Remote string `json:"remote,omitempty"`
+}
+
+// Stats reports the cache's current size and its counters so far
+func (tc *TranspileCache) Stats() CacheStats {
+	if tc == nil {
+		return CacheStats{}
+	}
+	tc.mu.Lock()
+	defer tc.mu.Unlock()
+	stats := CacheStats{Entries: len(tc.cache), Bytes: tc.bytes, Hits: tc.hits, RemoteHits: tc.remoteHits, Misses: tc.misses, Evictions: tc.evictions}
+	if tc.remote != nil {
+		stats.Remote = tc.remote.Name()
+	}
+	return stats
+}
+
+// WritePrometheus writes the snapshot in the Prometheus text exposition
+// format
+func (s CacheStats) WritePrometheus(w io.Writer) {
+	fmt.Fprintln(w, "# HELP emojiscript_cache_entries Responses in the in-memory transpile cache.")
+	fmt.Fprintln(w, "# TYPE emojiscript_cache_entries gauge")
+	fmt.Fprintf(w, "emojiscript_cache_entries %d\n", s.Entries)
+	fmt.Fprintln(w, "# HELP emojiscript_cache_bytes Approximate memory the in-memory transpile cache holds.")
+	fmt.Fprintln(w, "# TYPE emojiscript_cache_bytes gauge")
+	fmt.Fprintf(w, "emojiscript_cache_bytes %d\n", s.Bytes)
+	fmt.Fprintln(w, "# HELP emojiscript_cache_lookups_total Transpile cache lookups, by where they were answered.")
+	fmt.Fprintln(w, "# TYPE emojiscript_cache_lookups_total counter")
+	fmt.Fprintf(w, "emojiscript_cache_lookups_total{result=\"hit\"} %d\n", s.Hits)
+	fmt.Fprintf(w, "emojiscript_cache_lookups_total{result=\"remote_hit\"} %d\n", s.RemoteHits)
+	fmt.Fprintf(w, "emojiscript_cache_lookups_total{result=\"miss\"} %d\n", s.Misses)
+	fmt.Fprintln(w, "# HELP emojiscript_cache_evictions_total Entries evicted to make room in the transpile cache.")
+	fmt.Fprintln(w, "# TYPE emojiscript_cache_evictions_total counter")
+	fmt.Fprintf(w, "emojiscript_cache_evictions_total %d\n", s.Evictions)
+}
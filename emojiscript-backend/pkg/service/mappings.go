@@ -0,0 +1,61 @@
+package service
+
+import (
+	"fmt"
+	"strings"
+
+	"emojiscript-backend/pkg/codegen"
+	"emojiscript-backend/pkg/transpiler"
+)
+
+// requestTranspiler returns the Transpiler for a request's vocabulary and
+// lang: its mapping profile or custom mappings when it has them, its
+// dialect otherwise. Targets codegen generates are transpiled to
+// JavaScript first.
+func (s *Service) requestTranspiler(req TranspileRequest, lang string) (*transpiler.Transpiler, error) {
+	lang = transpilerLanguage(lang)
+	switch {
+	case req.MappingProfile == "" && req.Mappings == nil:
+		t, found := s.opts.Dialects.Transpiler(req.Dialect, lang)
+		if !found {
+			return nil, fmt.Errorf("Unknown dialect '%s'", req.Dialect)
+		}
+		return t, nil
+	case req.Dialect != "":
+		return nil, fmt.Errorf("dialect can't be combined with mappingProfile or mappings")
+	case req.MappingProfile != "" && req.Mappings != nil:
+		return nil, fmt.Errorf("set mappingProfile or mappings, not both")
+	case req.Mappings != nil:
+		if problems := transpiler.ValidateMappings(req.Mappings); len(problems) > 0 {
+			return nil, fmt.Errorf("invalid mappings: %s", strings.Join(problems, "; "))
+		}
+		return transpiler.New(transpiler.Options{TargetLanguage: lang, Aliases: transpiler.MappingAliases(req.Mappings)}), nil
+	}
+	t, found := s.opts.Mappings.Transpiler(req.MappingProfile, lang)
+	if !found {
+		return nil, fmt.Errorf("Unknown mapping profile '%s'", req.MappingProfile)
+	}
+	return t, nil
+}
+
+// mappingKey tells a request's vocabulary apart in cache keys; profiles
+// are keyed on their table, so a re-registered profile misses
+func (s *Service) mappingKey(req TranspileRequest) string {
+	switch {
+	case req.Mappings != nil:
+		return "+mappings=" + transpiler.MappingKey(req.Mappings)
+	case req.MappingProfile != "":
+		profile, _ := s.opts.Mappings.Get(req.MappingProfile)
+		return "+profile=" + profile.Name + ":" + transpiler.MappingKey(profile.Mappings)
+	}
+	return ""
+}
+
+// transpilerLanguage is the language the transpiler writes for target:
+// JavaScript for the targets codegen generates from it
+func transpilerLanguage(target string) string {
+	if codegen.Generates(target) {
+		return "javascript"
+	}
+	return target
+}
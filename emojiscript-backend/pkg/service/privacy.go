@@ -0,0 +1,41 @@
+package service
+
+import (
+	"encoding/json"
+	"fmt"
+)
+
+// Privacy modes. A strict request leaves nothing derived from its source
+// behind: it skips the transpile cache (local and remote), session
+// history and coverage statistics, and transports skip idempotent replays
+// and async jobs for it, which keep the response in memory.
+const (
+	PrivacyStandard = "standard"
+	PrivacyStrict   = "strict"
+)
+
+// private reports whether a request's privacy setting, or the service's
+// default, is strict. A request can't relax a strict default.
+func (s *Service) private(privacy string) (bool, error) {
+	switch privacy {
+	case "", PrivacyStandard:
+		return s.opts.Privacy == PrivacyStrict, nil
+	case PrivacyStrict:
+		return true, nil
+	}
+	return false, fmt.Errorf("privacy must be '%s' or '%s'", PrivacyStandard, PrivacyStrict)
+}
+
+// PrivateRequest reports whether a raw JSON request body asks for strict
+// privacy, or the service defaults to it, so transports can decide before
+// middleware that would keep the body or its response
+func (s *Service) PrivateRequest(body []byte) bool {
+	if s.opts.Privacy == PrivacyStrict {
+		return true
+	}
+	var req struct {
+		Privacy string `json:"privacy"`
+	}
+	json.Unmarshal(body, &req)
+	return req.Privacy == PrivacyStrict
+}
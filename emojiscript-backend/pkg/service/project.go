@@ -0,0 +1,264 @@
+package service
+
+import (
+	"fmt"
+	"net/http"
+	"path"
+	"sort"
+	"strings"
+	"time"
+
+	"emojiscript-backend/pkg/codegen"
+	"emojiscript-backend/pkg/hints"
+	"emojiscript-backend/pkg/transpiler"
+)
+
+// MaxProjectFiles bounds how many files one project request may hold;
+// together they may be as long as one program
+const MaxProjectFiles = 100
+
+// TranspileProject transpiles each file of a project and links their
+// imports to one another. With Bundle it also joins the files reachable
+// from the entry into one module, ordered so each file follows its
+// imports; an import cycle fails the bundle. Like Transpile, the response
+// is returned even when err is set.
+func (s *Service) TranspileProject(req ProjectRequest) (ProjectResponse, error) {
+	start := time.Now()
+
+	private, err := s.private(req.Privacy)
+	if err != nil {
+		return failProject(http.StatusBadRequest, ProjectResponse{Errors: []string{err.Error()}})
+	}
+	names, err := s.validateProject(req)
+	if err != nil {
+		return failProject(http.StatusBadRequest, ProjectResponse{Errors: []string{err.Error()}})
+	}
+	targets, err := requestTargets(TranspileRequest{TargetLanguage: req.TargetLanguage})
+	if err != nil {
+		return failProject(http.StatusBadRequest, ProjectResponse{Errors: []string{err.Error()}})
+	}
+	targetLang := targets[0]
+	if codegen.Generates(targetLang) {
+		// the files of a project import each other as JavaScript modules
+		return failProject(http.StatusBadRequest, ProjectResponse{Errors: []string{fmt.Sprintf("projects can't target %s yet", targetLang)}})
+	}
+	t, found := s.opts.Dialects.Transpiler(req.Dialect, targetLang)
+	if !found {
+		return failProject(http.StatusBadRequest, ProjectResponse{Errors: []string{fmt.Sprintf("Unknown dialect '%s'", req.Dialect)}})
+	}
+
+	resp := ProjectResponse{TargetLanguage: targetLang, Files: make(map[string]ProjectFile, len(names))}
+	outputs := make(map[string]string, len(names))
+	var profiles map[string]*transpiler.Profile
+	if req.Profile {
+		profiles = make(map[string]*transpiler.Profile, len(names))
+	}
+	for _, name := range names {
+		var profile *transpiler.Profile
+		if profiles != nil {
+			profile = &transpiler.Profile{}
+			profiles[name] = profile
+		}
+		file := s.transpileProjectFile(t, req, name, profile)
+		if !private {
+			s.observeTranspile(targetLang, file.UsedMarkup, len(file.Errors) == 0, file.Diagnostics)
+		}
+		if len(file.Errors) > 0 {
+			for _, err := range file.Errors {
+				resp.Errors = append(resp.Errors, name+": "+err)
+			}
+		}
+		outputs[name] = file.Output
+		resp.Files[name] = file
+	}
+	if len(resp.Errors) > 0 {
+		return failProject(http.StatusBadRequest, resp)
+	}
+
+	linked, links, errs := transpiler.LinkProject(outputs, targetLang)
+	if len(errs) > 0 {
+		resp.Errors = errs
+		return failProject(http.StatusBadRequest, resp)
+	}
+	for name, file := range resp.Files {
+		file.Output = linked[name]
+		file.Imports, file.External = links[name].Imports, links[name].External
+		resp.Files[name] = file
+	}
+
+	order, cycles := transpiler.OrderProject(links, req.Entry)
+	resp.Order = order
+	for _, cycle := range cycles {
+		message := "import cycle: " + strings.Join(cycle, " → ")
+		if req.Bundle {
+			resp.Errors = append(resp.Errors, message)
+		} else {
+			resp.Warnings = append(resp.Warnings, message)
+		}
+	}
+	if len(resp.Errors) > 0 {
+		return failProject(http.StatusBadRequest, resp)
+	}
+	if req.Bundle {
+		resp.Bundle = transpiler.BundleProject(outputs, order, req.Entry)
+	}
+
+	resp.Success = true
+	resp.Metadata = map[string]interface{}{
+		"transpileTime": time.Since(start).Milliseconds(),
+		"files":         len(names),
+	}
+	if profiles != nil {
+		var total transpiler.Profile
+		for _, profile := range profiles {
+			total.Add(*profile)
+		}
+		resp.Metadata["profile"] = map[string]interface{}{"total": total, "files": profiles}
+	}
+	return resp, nil
+}
+
+// ValidateProject checks a project's files together: each file as
+// Validate checks a program, and then the imports between them, for
+// files the project doesn't have and names the imported file doesn't
+// export. Entry and Bundle are ignored. The language server validates a
+// workspace this way.
+func (s *Service) ValidateProject(req ProjectRequest) ProjectValidateResponse {
+	req.Entry, req.Bundle = "", false
+	names, err := s.validateProject(req)
+	if err != nil {
+		return ProjectValidateResponse{Errors: []string{err.Error()}}
+	}
+	targets, err := requestTargets(TranspileRequest{TargetLanguage: req.TargetLanguage})
+	if err != nil {
+		return ProjectValidateResponse{Errors: []string{err.Error()}}
+	}
+	// codegen generates from the JavaScript, so a file checked as
+	// JavaScript is checked for every target
+	targetLang := targets[0]
+	if codegen.Generates(targetLang) {
+		targetLang = "javascript"
+	}
+	t, found := s.opts.Dialects.Transpiler(req.Dialect, targetLang)
+	if !found {
+		return ProjectValidateResponse{Errors: []string{fmt.Sprintf("Unknown dialect '%s'", req.Dialect)}}
+	}
+
+	resp := ProjectValidateResponse{Valid: true, Files: make(map[string]ValidateResponse, len(names))}
+	outputs := make(map[string]string, len(names))
+	for _, name := range names {
+		file := s.transpileProjectFile(t, req, name, nil)
+		outputs[name] = file.Output
+		resp.Files[name] = ValidateResponse{
+			Valid:       len(file.Errors) == 0,
+			Errors:      file.Errors,
+			Warnings:    file.Warnings,
+			Hints:       hints.For(file.Errors, req.Files[name]),
+			Diagnostics: file.Diagnostics,
+		}
+	}
+
+	for name, problems := range transpiler.CheckProjectImports(outputs, req.Files) {
+		file := resp.Files[name]
+		for _, problem := range problems {
+			message := problem.Message
+			if problem.Line > 0 {
+				message = fmt.Sprintf("line %d: %s", problem.Line, message)
+			}
+			file.Errors = append(file.Errors, message)
+		}
+		file.Valid = false
+		file.Diagnostics = append(file.Diagnostics, problems...)
+		resp.Files[name] = file
+	}
+	_, links, _ := transpiler.LinkProject(outputs, targetLang)
+	_, cycles := transpiler.OrderProject(links, "")
+	for _, cycle := range cycles {
+		resp.Warnings = append(resp.Warnings, "import cycle: "+strings.Join(cycle, " → "))
+	}
+	for _, file := range resp.Files {
+		resp.Valid = resp.Valid && file.Valid
+	}
+	return resp
+}
+
+// validateProject checks a project's file names and sizes, returning the
+// names sorted
+func (s *Service) validateProject(req ProjectRequest) ([]string, error) {
+	if len(req.Files) == 0 {
+		return nil, fmt.Errorf("files cannot be empty")
+	}
+	if len(req.Files) > MaxProjectFiles {
+		return nil, fmt.Errorf("a project can have at most %d files", MaxProjectFiles)
+	}
+	if _, _, err := ResolveSyntax(req.Syntax, req.UseMarkup, ""); err != nil {
+		return nil, err
+	}
+
+	names := make([]string, 0, len(req.Files))
+	total, characters := 0, 0
+	for name, code := range req.Files {
+		if name == "" || path.IsAbs(name) || strings.Contains(name, `\`) || path.Clean(name) != name || strings.HasPrefix(name, "../") {
+			return nil, fmt.Errorf("invalid file name '%s': use a relative path such as lib/utils.emoji", name)
+		}
+		if err := s.ValidateInput(code); err != nil {
+			return nil, fmt.Errorf("%s: %v", name, err)
+		}
+		total += len(code)
+		characters += transpiler.Characters(code)
+		names = append(names, name)
+	}
+	if total > s.opts.MaxCodeLength {
+		return nil, fmt.Errorf("project exceeds maximum length of %d bytes", s.opts.MaxCodeLength)
+	}
+	if characters > s.opts.MaxCodeCharacters {
+		return nil, fmt.Errorf("project exceeds maximum length of %d characters", s.opts.MaxCodeCharacters)
+	}
+	sort.Strings(names)
+
+	switch {
+	case req.Entry != "" && req.Files[req.Entry] == "":
+		return nil, fmt.Errorf("entry '%s' is not one of the files", req.Entry)
+	case req.Bundle && req.Entry == "" && len(names) > 1:
+		return nil, fmt.Errorf("entry is required to bundle more than one file")
+	}
+	return names, nil
+}
+
+// transpileProjectFile transpiles one file of a project, detecting markup
+// per file unless the request names the syntax
+func (s *Service) transpileProjectFile(t *transpiler.Transpiler, req ProjectRequest, name string, profile *transpiler.Profile) ProjectFile {
+	code := req.Files[name]
+	file := ProjectFile{OutputName: transpiler.OutputName(name, t.TargetLanguage())}
+	markup, detected, _ := ResolveSyntax(req.Syntax, req.UseMarkup, t.ApplyAliases(code))
+	file.UsedMarkup = markup
+	if d, ok := s.tooComplex(t, code, markup); ok {
+		file.Errors, file.Diagnostics = []string{d.Message}, []transpiler.Diagnostic{d}
+	} else if markup {
+		result, err := t.TranspileMarkup(code, transpiler.MarkupOptions{StrictTags: req.StrictTags, StrictSchema: req.StrictSchema, ASCIIIdentifiers: req.ASCIIIdentifiers, Profile: profile})
+		file.Output, file.Errors, file.Warnings, file.Diagnostics = result.Output, result.Errors, result.Warnings, result.Diagnostics
+		if err != nil && len(file.Errors) == 0 {
+			file.Errors = []string{err.Error()}
+		}
+	} else {
+		file.Output, file.Errors, file.Diagnostics = t.CompileEmoji(code, profile)
+	}
+	if detected {
+		file.Warnings = append(file.Warnings, DetectedMarkupWarning.Message)
+		file.Diagnostics = append(file.Diagnostics, DetectedMarkupWarning)
+	}
+	if len(file.Errors) > 0 {
+		file.Output = ""
+	}
+	return file
+}
+
+// failProject returns resp as the body of a failed project request
+func failProject(status int, resp ProjectResponse) (ProjectResponse, error) {
+	resp.Success = false
+	message := http.StatusText(status)
+	if len(resp.Errors) > 0 {
+		message = resp.Errors[0]
+	}
+	return resp, &Error{Status: status, Message: message}
+}
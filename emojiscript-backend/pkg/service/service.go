@@ -0,0 +1,392 @@
+// Package service is the transpile core behind every EmojiScript server.
+// The Fiber server and the net/http handler (and so the Vercel function)
+// decode requests their own way and then call the same Service, so input
+// validation, cache keys, markup detection and the emoji tables can't
+// drift between them.
+package service
+
+import (
+	"errors"
+	"net/http"
+	"strings"
+	"time"
+
+	"emojiscript-backend/pkg/chaos"
+	"emojiscript-backend/pkg/coverage"
+	"emojiscript-backend/pkg/degrade"
+	"emojiscript-backend/pkg/dialect"
+	"emojiscript-backend/pkg/hints"
+	"emojiscript-backend/pkg/history"
+	"emojiscript-backend/pkg/kvcache"
+	"emojiscript-backend/pkg/metrics"
+	"emojiscript-backend/pkg/source"
+	"emojiscript-backend/pkg/transpiler"
+)
+
+const (
+	// DefaultMaxCodeCharacters is the longest program accepted, counting
+	// each emoji as one character
+	DefaultMaxCodeCharacters = 100000
+	// DefaultMaxCodeLength bounds a program in bytes. An emoji-heavy
+	// program reaches it well before DefaultMaxCodeCharacters; a
+	// deployment that wants room for that many emoji raises it to 400000.
+	DefaultMaxCodeLength = 100000
+	// DefaultMaxOutputLength leaves room for the largest expansion a real
+	// program makes of the longest code accepted
+	DefaultMaxOutputLength = 10 << 20
+	// DefaultComplexityBudget is transpiler.DefaultComplexityBudget
+	DefaultComplexityBudget = transpiler.DefaultComplexityBudget
+	DefaultCacheSize        = 1000
+	DefaultCacheMaxBytes    = 64 << 20
+	DefaultCacheTTL         = time.Hour
+	// DefaultFailureCacheTTL is short because a failing program is
+	// usually mid-edit
+	DefaultFailureCacheTTL = time.Minute
+)
+
+// Options configures New; zero values fall back to the defaults
+type Options struct {
+	// MaxCodeCharacters is the longest program accepted, in characters
+	// as a reader counts them (see transpiler.Characters), and
+	// MaxCodeLength the longest in bytes
+	MaxCodeCharacters int
+	MaxCodeLength     int
+	// MaxOutputLength is the most output, in bytes, one transpile may
+	// generate, so a short program that expands pathologically fails
+	// instead of answering with gigabytes
+	MaxOutputLength int
+	// ComplexityBudget is the most a program may cost to parse (see
+	// transpiler.MeasureComplexity), so one crafted to make the parsers
+	// slow is turned away before they start
+	ComplexityBudget int
+	CacheSize        int
+	// CacheMaxBytes bounds the transpile cache's approximate memory use
+	CacheMaxBytes int
+	CacheTTL      time.Duration
+	// FailureCacheTTL is how long parse failures stay cached
+	FailureCacheTTL time.Duration
+	// RemoteCache backs the transpile cache with a store shared across
+	// instances (see kvcache.FromEnv); the cache is in memory only when nil
+	RemoteCache kvcache.Store
+	// Health records the optional subsystems that are down, starting with
+	// RemoteCache, which is skipped while it is; one is created when nil
+	Health *degrade.Monitor
+	// NormalizeCacheKeys keys the transpile cache on the normalized source
+	// (see transpiler.NormalizeSource) so programs differing only in
+	// layout or comments share an entry. A hit then returns the output of
+	// whichever equivalent program was cached first.
+	NormalizeCacheKeys bool
+	// History stores per-session transpile history; a private store is
+	// created when nil
+	History *history.Store
+	// Dialects holds the dialect packs; an in-memory store is created
+	// when nil
+	Dialects *dialect.Store
+	// Mappings holds the mapping profiles requests can name; the built-in
+	// profiles are used when nil
+	Mappings *transpiler.MappingRegistry
+	// Coverage aggregates emoji map coverage; a private aggregate is
+	// created when nil
+	Coverage *coverage.Stats
+	// Metrics counts transpiles by target and syntax and the parse errors
+	// they hit; a private registry is created when nil
+	Metrics *metrics.Registry
+	// SourceHosts are the hosts a request's sourceUrl may name;
+	// source.DefaultHosts (raw GitHub and Gist files) when empty
+	SourceHosts []string
+	// Privacy is the default privacy mode, PrivacyStandard when empty;
+	// with PrivacyStrict no request leaves source-derived data behind
+	Privacy string
+	// Chaos injects parse errors and cache failures for resilience
+	// testing (see chaos.FromEnv); nothing is injected when nil
+	Chaos *chaos.Injector
+}
+
+// Service transpiles requests. It is safe for concurrent use, and servers
+// share one so they share its cache and history.
+type Service struct {
+	opts    Options
+	cache   *TranspileCache
+	sources *source.Fetcher
+}
+
+// Caller is what the transport knows about who sent a request
+type Caller struct {
+	// SessionID, when valid, records the request in the session's history
+	SessionID string
+	// Service is set for callers presenting a service token
+	Service bool
+	// BypassCache transpiles afresh rather than answering from the cache,
+	// and replaces the cached entry (see CacheBypass)
+	BypassCache bool
+	// Pipeline is the one plain emoji is compiled with, canary.Tree when
+	// empty (see canary.Router)
+	Pipeline string
+}
+
+// BypassCacheHeader is the header an admin sets to "true" to force a
+// fresh transpile
+const BypassCacheHeader = "X-Bypass-Cache"
+
+// CacheBypass decides from a transpile request's Cache-Control and
+// X-Bypass-Cache headers whether it skips the cache. X-Bypass-Cache always
+// does, and is refused unless the caller is an admin. Anyone may ask with
+// Cache-Control: no-cache, which is honored unless the server is busy,
+// so it can't add work to a server that's already behind.
+func CacheBypass(cacheControl, bypass string, admin, busy bool) (bool, error) {
+	if bypass != "" {
+		if !admin {
+			return false, &Error{Status: http.StatusForbidden, Message: BypassCacheHeader + " needs an admin or service token"}
+		}
+		return bypass == "true", nil
+	}
+	for _, directive := range strings.Split(cacheControl, ",") {
+		if strings.EqualFold(strings.TrimSpace(directive), "no-cache") {
+			return !busy, nil
+		}
+	}
+	return false, nil
+}
+
+// Error is a request the service refused or failed, with the HTTP status
+// to answer it with
+type Error struct {
+	Status  int
+	Message string
+}
+
+func (e *Error) Error() string {
+	return e.Message
+}
+
+// Status returns the HTTP status for an error returned by the service:
+// 200 for nil and 500 for errors that aren't an *Error
+func Status(err error) int {
+	if err == nil {
+		return http.StatusOK
+	}
+	var e *Error
+	if errors.As(err, &e) {
+		return e.Status
+	}
+	return http.StatusInternalServerError
+}
+
+// fail returns resp as the body of a failed request
+func fail(status int, resp TranspileResponse) (TranspileResponse, error) {
+	message := http.StatusText(status)
+	if len(resp.Errors) > 0 {
+		message = resp.Errors[0]
+	}
+	return resp, &Error{Status: status, Message: message}
+}
+
+// New returns a Service configured by opts
+func New(opts Options) *Service {
+	if opts.MaxCodeLength <= 0 {
+		opts.MaxCodeLength = DefaultMaxCodeLength
+	}
+	if opts.MaxCodeCharacters <= 0 {
+		opts.MaxCodeCharacters = DefaultMaxCodeCharacters
+	}
+	if opts.MaxOutputLength <= 0 {
+		opts.MaxOutputLength = DefaultMaxOutputLength
+	}
+	if opts.ComplexityBudget <= 0 {
+		opts.ComplexityBudget = DefaultComplexityBudget
+	}
+	if opts.CacheSize <= 0 {
+		opts.CacheSize = DefaultCacheSize
+	}
+	if opts.CacheMaxBytes <= 0 {
+		opts.CacheMaxBytes = DefaultCacheMaxBytes
+	}
+	if opts.CacheTTL <= 0 {
+		opts.CacheTTL = DefaultCacheTTL
+	}
+	if opts.FailureCacheTTL <= 0 {
+		opts.FailureCacheTTL = DefaultFailureCacheTTL
+	}
+	if opts.History == nil {
+		opts.History = history.New()
+	}
+	if opts.Dialects == nil {
+		opts.Dialects, _ = dialect.NewStore("")
+	}
+	if opts.Mappings == nil {
+		opts.Mappings = transpiler.NewMappingRegistry()
+	}
+	if opts.Coverage == nil {
+		opts.Coverage = coverage.New()
+	}
+	if opts.Metrics == nil {
+		opts.Metrics = metrics.New()
+	}
+	if opts.Health == nil {
+		opts.Health = degrade.New(0)
+	}
+	remote := degrade.Store(opts.RemoteCache, opts.Health, degrade.RemoteCache)
+	cache := newTranspileCache(opts.CacheSize, opts.CacheMaxBytes, opts.CacheTTL, opts.FailureCacheTTL, remote)
+	cache.chaos = opts.Chaos
+	return &Service{
+		opts:    opts,
+		cache:   cache,
+		sources: source.New(opts.SourceHosts, opts.MaxCodeLength),
+	}
+}
+
+// MaxCodeLength is the longest program the service accepts, in bytes
+func (s *Service) MaxCodeLength() int {
+	return s.opts.MaxCodeLength
+}
+
+// MaxCodeCharacters is the longest program the service accepts, in
+// characters (see transpiler.Characters)
+func (s *Service) MaxCodeCharacters() int {
+	return s.opts.MaxCodeCharacters
+}
+
+// MaxOutputLength is the most output one transpile may generate
+func (s *Service) MaxOutputLength() int {
+	return s.opts.MaxOutputLength
+}
+
+// ComplexityBudget is the most a program may cost to parse
+func (s *Service) ComplexityBudget() int {
+	return s.opts.ComplexityBudget
+}
+
+// tooComplex measures what parsing code would cost, returning the
+// diagnostic for a program over the budget
+func (s *Service) tooComplex(t *transpiler.Transpiler, code string, markup bool) (transpiler.Diagnostic, bool) {
+	c := t.MeasureComplexity(code, markup, s.opts.ComplexityBudget)
+	if !c.Exceeded {
+		return transpiler.Diagnostic{}, false
+	}
+	return c.Diagnostic(s.opts.ComplexityBudget), true
+}
+
+// Health records the optional subsystems that are down
+func (s *Service) Health() *degrade.Monitor {
+	return s.opts.Health
+}
+
+// Flags names the optional behaviours the service was configured with:
+// strictPrivacy, normalizedCacheKeys, remoteCache and chaos
+func (s *Service) Flags() []string {
+	flags := []string{}
+	if s.opts.Privacy == PrivacyStrict {
+		flags = append(flags, "strictPrivacy")
+	}
+	if s.opts.NormalizeCacheKeys {
+		flags = append(flags, "normalizedCacheKeys")
+	}
+	if s.opts.RemoteCache != nil {
+		flags = append(flags, "remoteCache")
+	}
+	if s.opts.Chaos != nil {
+		flags = append(flags, "chaos")
+	}
+	return flags
+}
+
+// CacheStats reports the transpile cache's size, hits and misses
+func (s *Service) CacheStats() CacheStats {
+	return s.cache.Stats()
+}
+
+// Metrics is the registry transpiles are counted in
+func (s *Service) Metrics() *metrics.Registry {
+	return s.opts.Metrics
+}
+
+// History is the store transpiles are recorded in
+func (s *Service) History() *history.Store {
+	return s.opts.History
+}
+
+// Dialects is the store dialect packs are resolved from
+func (s *Service) Dialects() *dialect.Store {
+	return s.opts.Dialects
+}
+
+// Mappings is the registry mapping profiles are resolved from
+func (s *Service) Mappings() *transpiler.MappingRegistry {
+	return s.opts.Mappings
+}
+
+// ResolveDialect looks up the pack a request names; an empty name means
+// the built-in vocabulary
+func (s *Service) ResolveDialect(name string) (*dialect.Pack, bool) {
+	if name == "" {
+		return nil, true
+	}
+	pack, found := s.opts.Dialects.Get(name)
+	if !found {
+		return nil, false
+	}
+	return &pack, true
+}
+
+// Validate checks a request's syntax by running the parser without
+// generating output. Markup programs also get a warning for each name an
+// expression reads that the program never declares.
+func (s *Service) Validate(req TranspileRequest) ValidateResponse {
+	if req.Code == "" {
+		errors := []string{"Code cannot be empty"}
+		return ValidateResponse{Valid: false, Errors: errors, Hints: hints.For(errors, req.Code)}
+	}
+	targets, err := requestTargets(req)
+	if err != nil {
+		return ValidateResponse{Valid: false, Errors: []string{err.Error()}, Diagnostics: []transpiler.Diagnostic{err.(*TargetError).Diagnostic()}}
+	}
+	t, err := s.requestTranspiler(req, targets[0])
+	if err != nil {
+		return ValidateResponse{Valid: false, Errors: []string{err.Error()}}
+	}
+
+	markup, detected, err := ResolveSyntax(req.Syntax, req.UseMarkup, transpiler.HostCode(t.ApplyAliases(req.Code)))
+	if err != nil {
+		return ValidateResponse{Valid: false, Errors: []string{err.Error()}}
+	}
+
+	if d, ok := s.tooComplex(t, req.Code, markup); ok {
+		return ValidateResponse{Valid: false, Errors: []string{d.Message}, Diagnostics: []transpiler.Diagnostic{d}}
+	}
+
+	var errors, warnings []string
+	var diagnostics []transpiler.Diagnostic
+	if transpiler.Islands(req.Code) != nil {
+		result, err := t.TranspileMixed(req.Code, markup, transpiler.MarkupOptions{
+			StrictTags:       req.StrictTags,
+			StrictSchema:     req.StrictSchema,
+			ASCIIIdentifiers: req.ASCIIIdentifiers,
+			RenameReserved:   req.RenameReserved,
+			CheckOnly:        true,
+		})
+		errors, warnings, diagnostics = result.Errors, result.Warnings, result.Diagnostics
+		if err != nil && len(errors) == 0 {
+			errors = []string{err.Error()}
+		}
+	} else if markup {
+		result, err := t.TranspileMarkup(req.Code, transpiler.MarkupOptions{
+			StrictTags:       req.StrictTags,
+			StrictSchema:     req.StrictSchema,
+			ASCIIIdentifiers: req.ASCIIIdentifiers,
+			RenameReserved:   req.RenameReserved,
+			CheckOnly:        true,
+		})
+		errors, warnings, diagnostics = result.Errors, result.Warnings, result.Diagnostics
+		if err != nil && len(errors) == 0 {
+			errors = []string{err.Error()}
+		}
+	} else {
+		errors, diagnostics = t.CheckEmoji(req.Code), t.DiagnoseEmoji(req.Code)
+	}
+	if detected {
+		warnings = append(warnings, DetectedMarkupWarning.Message)
+		diagnostics = append(diagnostics, DetectedMarkupWarning)
+	}
+
+	return ValidateResponse{Valid: len(errors) == 0, Errors: errors, Warnings: warnings, Hints: hints.For(errors, req.Code), Diagnostics: diagnostics}
+}
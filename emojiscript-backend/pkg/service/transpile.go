@@ -0,0 +1,849 @@
+package service
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log"
+	"maps"
+	"net/http"
+	"slices"
+	"sort"
+	"strings"
+	"time"
+
+	"emojiscript-backend/pkg/canary"
+	"emojiscript-backend/pkg/chaos"
+	"emojiscript-backend/pkg/codegen"
+	"emojiscript-backend/pkg/hints"
+	"emojiscript-backend/pkg/history"
+	"emojiscript-backend/pkg/source"
+	"emojiscript-backend/pkg/transpiler"
+)
+
+// Transpile answers a transpile request: it validates the request,
+// serves it from the cache when it can and otherwise transpiles the code
+// for each target. The response is returned even when err is set, as the
+// body to answer with; Status(err) is its HTTP status.
+func (s *Service) Transpile(req TranspileRequest, caller Caller) (TranspileResponse, error) {
+	start := time.Now()
+
+	private, err := s.private(req.Privacy)
+	if err != nil {
+		return fail(http.StatusBadRequest, TranspileResponse{
+			Success: false,
+			Errors:  []string{err.Error()},
+		})
+	}
+
+	if req.SourceURL != "" {
+		if req.Code != "" {
+			return fail(http.StatusBadRequest, TranspileResponse{
+				Success: false,
+				Errors:  []string{"code and sourceUrl can't both be set"},
+			})
+		}
+		code, err := s.FetchSource(req.SourceURL)
+		if err != nil {
+			return fail(Status(err), TranspileResponse{Success: false, Errors: []string{err.Error()}})
+		}
+		req.Code = code
+	}
+
+	if err := s.ValidateInput(req.Code); err != nil {
+		return fail(http.StatusBadRequest, TranspileResponse{
+			Success: false,
+			Errors:  []string{err.Error()},
+			Hints:   hints.For([]string{err.Error()}, req.Code),
+		})
+	}
+
+	for module, value := range req.Dependencies {
+		if transpiler.IsURLSpecifier(value) {
+			continue
+		}
+		if err := s.ValidateInput(value); err != nil {
+			return fail(http.StatusBadRequest, TranspileResponse{
+				Success: false,
+				Errors:  []string{fmt.Sprintf("dependency '%s': %v", module, err)},
+			})
+		}
+	}
+
+	policy, err := transpiler.ParseSanitizePolicy(req.Sanitize)
+	if err != nil {
+		return fail(http.StatusBadRequest, TranspileResponse{
+			Success: false,
+			Errors:  []string{err.Error()},
+		})
+	}
+	if policy != transpiler.SanitizeRewrite && !caller.Service {
+		return fail(http.StatusForbidden, TranspileResponse{
+			Success: false,
+			Errors:  []string{fmt.Sprintf("sanitize policy '%s' requires a service token", policy)},
+		})
+	}
+
+	limit, err := s.outputLimit(req.OutputLimit)
+	if err != nil {
+		return fail(http.StatusBadRequest, TranspileResponse{
+			Success: false,
+			Errors:  []string{err.Error()},
+		})
+	}
+
+	targets, err := requestTargets(req)
+	if err != nil {
+		return fail(http.StatusBadRequest, TranspileResponse{
+			Success:     false,
+			Errors:      []string{err.Error()},
+			Diagnostics: []transpiler.Diagnostic{err.(*TargetError).Diagnostic()},
+		})
+	}
+	targetLang := targets[0]
+
+	pack, found := s.ResolveDialect(req.Dialect)
+	if !found {
+		return fail(http.StatusBadRequest, TranspileResponse{
+			Success: false,
+			Errors:  []string{fmt.Sprintf("Unknown dialect '%s'", req.Dialect)},
+		})
+	}
+	t, err := s.requestTranspiler(req, targetLang)
+	if err != nil {
+		return fail(http.StatusBadRequest, TranspileResponse{
+			Success: false,
+			Errors:  []string{err.Error()},
+		})
+	}
+	code, keyLang := t.ApplyAliases(req.Code), strings.Join(targets, ",")
+	if pack != nil {
+		keyLang += "@" + pack.Name + ":" + pack.UpdatedAt.Format(time.RFC3339Nano)
+	}
+	keyLang += s.mappingKey(req)
+	if req.Partial {
+		keyLang += "+partial"
+	}
+	if req.StrictTags {
+		keyLang += "+strict"
+	}
+	if req.StrictSchema {
+		keyLang += "+schema"
+	}
+	if req.ASCIIIdentifiers {
+		keyLang += "+ascii"
+	}
+	if req.RenameReserved {
+		keyLang += "+rename"
+	}
+	if req.Idiomatic {
+		keyLang += "+idiomatic"
+	}
+	if req.OutputLimit > 0 {
+		keyLang += fmt.Sprintf("+limit=%d", limit)
+	}
+	if policy != transpiler.SanitizeRewrite {
+		keyLang += "+sanitize=" + string(policy)
+	}
+
+	useMarkup, detected, err := ResolveSyntax(req.Syntax, req.UseMarkup, transpiler.HostCode(code))
+	if err != nil {
+		return fail(http.StatusBadRequest, TranspileResponse{
+			Success: false,
+			Errors:  []string{err.Error()},
+		})
+	}
+	// a detected syntax answers with a warning an explicit one doesn't
+	if detected {
+		keyLang += "+detected"
+	}
+	pipeline := caller.Pipeline
+	if pipeline == "" {
+		pipeline = canary.Tree
+	}
+	if !useMarkup && pipeline != canary.Tree {
+		keyLang += "+" + pipeline
+	}
+	keySource := code
+	if s.opts.NormalizeCacheKeys {
+		keySource = transpiler.NormalizeSource(code)
+	}
+	cacheKey := generateCacheKey(keySource, keyLang, useMarkup, req.Dependencies)
+
+	// coverage is only meaningful for the plain emoji syntax; markup
+	// rejects tags it doesn't know instead of passing them through
+	var emojiCoverage transpiler.Coverage
+	if !useMarkup {
+		emojiCoverage = transpiler.MeasureCoverage(code)
+		if !private {
+			s.opts.Coverage.Record(emojiCoverage)
+		}
+	}
+
+	respond := func(status int, resp TranspileResponse) (TranspileResponse, error) {
+		if !private {
+			s.observeTranspile(targetLang, useMarkup, resp.Success, resp.Diagnostics)
+		}
+		if !private && history.ValidSessionID(caller.SessionID) {
+			s.recordHistory(caller.SessionID, req, resp)
+		}
+		if status != http.StatusOK {
+			return fail(status, resp)
+		}
+		return resp, nil
+	}
+
+	cache := s.cache
+	// a profile times this transpile, so one is never served from the
+	// cache or kept in it
+	var profile *transpiler.Profile
+	if req.Profile {
+		profile = &transpiler.Profile{}
+	}
+	if private || req.Profile {
+		cache = nil
+	}
+	// a bypass still replaces the cached entry with its fresh result
+	if cached, found := cache.Get(cacheKey); found && !caller.BypassCache {
+		cached.Metadata["cached"] = true
+		status := http.StatusOK
+		if !cached.Success && !cached.Partial {
+			status = http.StatusBadRequest
+		}
+		return respond(status, *cached)
+	}
+
+	// tooLong fails a transpile whose output passed the limit, blaming
+	// the construct that generated most of it
+	tooLong := func() (TranspileResponse, error) {
+		d := t.OutputLimitDiagnostic(req.Code, useMarkup, limit)
+		failure := TranspileResponse{
+			Success:        false,
+			TargetLanguage: targetLang,
+			Errors:         []string{d.Message},
+			Diagnostics:    []transpiler.Diagnostic{d},
+			UsedMarkup:     useMarkup,
+		}
+		cache.SetFailure(cacheKey, &failure)
+		return respond(http.StatusBadRequest, failure)
+	}
+
+	if d, ok := s.tooComplex(t, req.Code, useMarkup); ok {
+		failure := TranspileResponse{
+			Success:        false,
+			TargetLanguage: targetLang,
+			Errors:         []string{d.Message},
+			Diagnostics:    []transpiler.Diagnostic{d},
+			UsedMarkup:     useMarkup,
+		}
+		cache.SetFailure(cacheKey, &failure)
+		return respond(http.StatusBadRequest, failure)
+	}
+
+	var output string
+	var errors, warnings []string
+	var diagnostics []transpiler.Diagnostic
+	var sanitizations []transpiler.Sanitization
+	var renames map[string]string
+	var symbols []transpiler.Symbol
+
+	opts := markupOptions(req)
+	opts.Profile = profile
+	if transpiler.Islands(req.Code) != nil {
+		// mixed programs have only the one pipeline
+		pipeline = canary.Tree
+		result, err := t.TranspileMixed(req.Code, useMarkup, opts)
+		output, errors, warnings = result.Output, result.Errors, result.Warnings
+		diagnostics, sanitizations, renames = result.Diagnostics, result.Sanitizations, result.Renames
+		symbols = result.Symbols
+		if err != nil {
+			errors = append(errors, err.Error())
+		}
+	} else if useMarkup {
+		result, err := t.TranspileMarkup(req.Code, opts)
+		output, errors, warnings = result.Output, result.Errors, result.Warnings
+		diagnostics, sanitizations, renames = result.Diagnostics, result.Sanitizations, result.Renames
+		symbols = result.Symbols
+		if err != nil {
+			errors = append(errors, err.Error())
+		}
+	} else {
+		var fallback bool
+		output, errors, diagnostics, fallback = compileEmoji(t, req.Code, profile, pipeline)
+		if fallback {
+			pipeline = canary.Replacer
+		}
+		if !private {
+			s.opts.Metrics.ObservePipeline(pipeline, fallback)
+		}
+		if pipeline == canary.Tree {
+			symbols = transpiler.Symbols(t.ApplyAliases(req.Code), false)
+		}
+	}
+	if detected {
+		warnings = append(warnings, DetectedMarkupWarning.Message)
+		diagnostics = append(diagnostics, DetectedMarkupWarning)
+	}
+	if len(output) > limit {
+		return tooLong()
+	}
+	injected := s.opts.Chaos.ParseError()
+	if injected {
+		errors = append(errors, chaos.ParseErrorMessage)
+	}
+	if len(errors) > 0 {
+		failure := TranspileResponse{
+			Success:        false,
+			TargetLanguage: targetLang,
+			Errors:         errors,
+			Warnings:       warnings,
+			Diagnostics:    diagnostics,
+			UsedMarkup:     useMarkup,
+			Hints:          hints.For(errors, code),
+			Sanitizations:  sanitizations,
+		}
+		status := http.StatusBadRequest
+		if req.Partial {
+			failure.Partial, failure.Output, failure.JavaScript = true, output, output
+			status = http.StatusOK
+		}
+		// an injected failure isn't the program's, so it isn't cached
+		if !injected {
+			cache.SetFailure(cacheKey, &failure)
+		}
+		return respond(status, failure)
+	}
+
+	if strings.TrimSpace(output) == "" {
+		return respond(http.StatusInternalServerError, TranspileResponse{
+			Success: false,
+			Errors:  []string{"Empty output"},
+		})
+	}
+
+	response := TranspileResponse{
+		Success:        true,
+		Output:         output,
+		TargetLanguage: targetLang,
+		UsedMarkup:     useMarkup,
+		Warnings:       warnings,
+		Diagnostics:    diagnostics,
+		Sanitizations:  sanitizations,
+		Renames:        renames,
+		Metadata: map[string]interface{}{
+			"transpileTime": time.Since(start).Milliseconds(),
+			"cached":        false,
+		},
+	}
+	if len(symbols) > 0 {
+		response.Metadata["symbols"] = symbols
+	}
+	if !useMarkup {
+		response.Metadata["pipeline"] = pipeline
+		response.Metadata["coverage"] = emojiCoverage.Percent()
+		if emojiCoverage.Unknown > 0 {
+			response.Metadata["unknownEmoji"] = emojiCoverage.UnknownList()
+		}
+	}
+
+	if output, imports, removed, importWarnings := resolveDependencies(t, output, req.Dependencies); len(imports) > 0 {
+		response.Output = output
+		response.Warnings = append(response.Warnings, importWarnings...)
+		response.Metadata["imports"] = imports
+		response.Metadata["treeShaken"] = removed
+	}
+
+	// the targets written from JavaScript share this one, and codegen's
+	// share its syntax tree
+	var javascript *jsOutput
+	if transpilerLanguage(targetLang) == "javascript" {
+		javascript = &jsOutput{code: response.Output}
+	}
+	generating := time.Now()
+	generated, generateWarnings, err := generate(targetLang, response.Output, javascript, req.Idiomatic)
+	profile.AddGenerate(time.Since(generating))
+	if err != nil {
+		failure := TranspileResponse{
+			Success:        false,
+			TargetLanguage: targetLang,
+			Errors:         []string{err.Error()},
+			UsedMarkup:     useMarkup,
+		}
+		cache.SetFailure(cacheKey, &failure)
+		return respond(http.StatusBadRequest, failure)
+	}
+	response.Output = generated
+	response.Warnings = append(response.Warnings, generateWarnings...)
+
+	if len(targets) > 1 {
+		generating := time.Now()
+		outputs, targetWarnings, errs := s.transpileTargets(req, useMarkup, pipeline, response.Output, javascript, targets)
+		profile.AddGenerate(time.Since(generating))
+		if len(errs) > 0 {
+			failure := TranspileResponse{
+				Success:        false,
+				TargetLanguage: targetLang,
+				Errors:         errs,
+				UsedMarkup:     useMarkup,
+				Hints:          hints.For(errs, code),
+			}
+			cache.SetFailure(cacheKey, &failure)
+			return respond(http.StatusBadRequest, failure)
+		}
+		response.Outputs = outputs
+		response.Warnings = append(response.Warnings, targetWarnings...)
+	}
+	for _, output := range append([]string{response.Output}, slices.Collect(maps.Values(response.Outputs))...) {
+		if len(output) > limit {
+			return tooLong()
+		}
+	}
+	setLanguageOutputs(&response)
+	if profile != nil {
+		response.Metadata["profile"] = *profile
+	}
+
+	cache.Set(cacheKey, &response)
+	return respond(http.StatusOK, response)
+}
+
+// observeTranspile counts a transpile in the metrics, with the codes of
+// its error diagnostics when it failed
+func (s *Service) observeTranspile(target string, useMarkup, success bool, diagnostics []transpiler.Diagnostic) {
+	syntax := "emoji"
+	if useMarkup {
+		syntax = "markup"
+	}
+	var codes []string
+	for _, d := range diagnostics {
+		if d.Severity == transpiler.SeverityError && d.Code != "" {
+			codes = append(codes, d.Code)
+		}
+	}
+	s.opts.Metrics.ObserveTranspile(target, syntax, success, codes)
+}
+
+// supportedTargets are the languages /transpile generates. The
+// transpiler writes JavaScript and TypeScript; the rest are generated
+// from its JavaScript by codegen.
+var supportedTargets = append([]string{"javascript", "typescript"}, codegen.Targets...)
+
+// Targets returns the languages /transpile generates, javascript first
+func Targets() []string {
+	return slices.Clone(supportedTargets)
+}
+
+// TargetLanguage resolves a requested target language, "" meaning
+// javascript, or explains why it isn't supported
+func TargetLanguage(name string) (string, error) {
+	targets, err := requestTargets(TranspileRequest{TargetLanguage: name})
+	if err != nil {
+		return "", err
+	}
+	return targets[0], nil
+}
+
+// TargetError is a target language a request can't have: one that isn't
+// a valid value, or, when Target is set, one that is but isn't generated
+type TargetError struct {
+	Name string
+	// Target is the canonical name Name resolved to
+	Target string
+}
+
+func (e *TargetError) Error() string {
+	valid := transpiler.DescribeTargets(supportedTargets)
+	if e.Target != "" && !strings.EqualFold(e.Name, e.Target) {
+		return fmt.Sprintf("Target language '%s' (%s) isn't generated here. Valid values: %s.", e.Name, e.Target, valid)
+	}
+	if e.Target != "" {
+		return fmt.Sprintf("Target language '%s' isn't generated here. Valid values: %s.", e.Name, valid)
+	}
+	return fmt.Sprintf("Unknown target language '%s'. Valid values: %s.", e.Name, valid)
+}
+
+// Diagnostic returns the error as a diagnostic without a position
+func (e *TargetError) Diagnostic() transpiler.Diagnostic {
+	return transpiler.Diagnostic{Message: e.Error(), Severity: transpiler.SeverityError, Code: transpiler.CodeUnknownTarget}
+}
+
+// requestTargets returns the request's target languages in order, without
+// repeats: targetLanguage (javascript by default) and then any others in
+// targetLanguages, each resolved to its canonical name (see
+// transpiler.ResolveTarget)
+func requestTargets(req TranspileRequest) ([]string, error) {
+	names := req.TargetLanguages
+	if req.TargetLanguage != "" || len(names) == 0 {
+		names = append([]string{req.TargetLanguage}, names...)
+	}
+	var targets []string
+	seen := map[string]bool{}
+	for _, name := range names {
+		lang, known := transpiler.ResolveTarget(name)
+		if strings.TrimSpace(name) == "" {
+			lang, known = "javascript", true
+		}
+		switch {
+		case !known:
+			return nil, &TargetError{Name: name}
+		case !slices.Contains(supportedTargets, lang):
+			return nil, &TargetError{Name: name, Target: lang}
+		}
+		if !seen[lang] {
+			seen[lang] = true
+			targets = append(targets, lang)
+		}
+	}
+	return targets, nil
+}
+
+// transpileTargets writes the targets after the first, whose output is
+// first, plain emoji with the same pipeline. TypeScript, which keeps
+// type annotations, is transpiled on its own. The others are written
+// from one JavaScript output, javascript when the first target has one,
+// which codegen's targets parse once.
+func (s *Service) transpileTargets(req TranspileRequest, useMarkup bool, pipeline, first string, javascript *jsOutput, targets []string) (map[string]string, []string, []string) {
+	outputs := map[string]string{targets[0]: first}
+	var warnings, errs []string
+	for _, lang := range targets[1:] {
+		var output string
+		var targetErrs []string
+		if language := transpilerLanguage(lang); language != "javascript" {
+			t, _ := s.requestTranspiler(req, language)
+			output, targetErrs = transpileTarget(t, req, useMarkup, pipeline)
+		} else {
+			if javascript == nil {
+				t, _ := s.requestTranspiler(req, language)
+				code, jsErrs := transpileTarget(t, req, useMarkup, pipeline)
+				javascript = &jsOutput{code: code, errs: jsErrs}
+			}
+			output, targetErrs = javascript.code, javascript.errs
+		}
+		if len(targetErrs) == 0 {
+			var targetWarnings []string
+			var err error
+			output, targetWarnings, err = generate(lang, output, javascript, req.Idiomatic)
+			if err != nil {
+				targetErrs = []string{err.Error()}
+			}
+			for _, warning := range targetWarnings {
+				warnings = append(warnings, lang+": "+warning)
+			}
+		}
+		for _, err := range targetErrs {
+			errs = append(errs, lang+": "+err)
+		}
+		outputs[lang] = output
+	}
+	return outputs, warnings, errs
+}
+
+// jsOutput is a request's JavaScript output, shared by the targets
+// written from it
+type jsOutput struct {
+	code string
+	errs []string
+	// program is code's syntax tree, parsed for the first target codegen
+	// generates
+	program  *codegen.Program
+	parseErr error
+	parsed   bool
+}
+
+// parse parses the output once for every target codegen generates
+func (j *jsOutput) parse() (*codegen.Program, error) {
+	if !j.parsed {
+		j.program, j.parseErr = codegen.Parse(j.code)
+		j.parsed = true
+	}
+	return j.program, j.parseErr
+}
+
+// generate writes a target codegen generates from javascript's syntax
+// tree, returning the output of any other target as it is. idiomatic
+// runs the target's idiom passes over the result.
+func generate(lang, output string, javascript *jsOutput, idiomatic bool) (string, []string, error) {
+	var warnings []string
+	if codegen.Generates(lang) {
+		program, err := javascript.parse()
+		if err != nil {
+			return "", nil, fmt.Errorf("%s: %v", lang, err)
+		}
+		if output, warnings, err = program.Generate(lang); err != nil {
+			return "", nil, err
+		}
+	}
+	if idiomatic {
+		output = transpiler.Idiomatic(output, lang)
+	}
+	return output, warnings, nil
+}
+
+// transpileTarget transpiles the request with t and resolves its
+// dependencies
+func transpileTarget(t *transpiler.Transpiler, req TranspileRequest, useMarkup bool, pipeline string) (string, []string) {
+	output := ""
+	if useMarkup {
+		result, err := TranspileMarkup(t, req.Code, req)
+		errs := result.Errors
+		if err != nil {
+			errs = append(errs, err.Error())
+		}
+		if len(errs) > 0 {
+			return "", errs
+		}
+		output = result.Output
+	} else {
+		var errs []string
+		if output, errs, _, _ = compileEmoji(t, req.Code, nil, pipeline); len(errs) > 0 {
+			return "", errs
+		}
+	}
+	if resolved, imports, _, _ := resolveDependencies(t, output, req.Dependencies); len(imports) > 0 {
+		output = resolved
+	}
+	return output, nil
+}
+
+// compileEmoji compiles plain emoji with pipeline, falling back to the
+// replacer when the syntax tree fails with an internal error; fallback
+// reports whether it did
+func compileEmoji(t *transpiler.Transpiler, code string, profile *transpiler.Profile, pipeline string) (output string, errors []string, diagnostics []transpiler.Diagnostic, fallback bool) {
+	if pipeline == canary.Replacer {
+		output, errors = t.ReplaceEmoji(code)
+		return output, errors, nil, false
+	}
+	defer func() {
+		if p := recover(); p != nil {
+			log.Printf("transpile: the syntax tree failed, falling back to the replacer: %v", p)
+			output, errors = t.ReplaceEmoji(code)
+			diagnostics, fallback = nil, true
+		}
+	}()
+	output, errors, diagnostics = t.CompileEmoji(code, profile)
+	return output, errors, diagnostics, false
+}
+
+// setLanguageOutputs fills the per-language output fields from the
+// response's outputs, or from output for a single target
+func setLanguageOutputs(resp *TranspileResponse) {
+	outputs := resp.Outputs
+	if outputs == nil {
+		outputs = map[string]string{resp.TargetLanguage: resp.Output}
+	}
+	resp.JavaScript = outputs["javascript"]
+	resp.TypeScript = outputs["typescript"]
+	resp.Rust = outputs["rust"]
+	resp.GDScript = outputs["gdscript"]
+	resp.Python = outputs["python"]
+}
+
+// FetchSource downloads the program a sourceUrl names. Its errors are
+// *Error: 400 for a URL that isn't allowed, 413 for a source over the
+// length limit and 502 when the host can't serve it.
+func (s *Service) FetchSource(rawURL string) (string, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), source.DefaultTimeout)
+	defer cancel()
+	code, err := s.sources.Fetch(ctx, rawURL)
+	switch {
+	case err == nil:
+		return code, nil
+	case errors.Is(err, source.ErrTooLarge):
+		return "", &Error{Status: http.StatusRequestEntityTooLarge, Message: fmt.Sprintf("sourceUrl: source exceeds maximum length of %d bytes", s.opts.MaxCodeLength)}
+	case errors.Is(err, source.ErrInvalidURL), errors.Is(err, source.ErrHostNotAllowed):
+		return "", &Error{Status: http.StatusBadRequest, Message: "sourceUrl: " + err.Error()}
+	}
+	return "", &Error{Status: http.StatusBadGateway, Message: "sourceUrl: " + err.Error()}
+}
+
+// CheckLength rejects code over either length limit, naming the one it
+// exceeds: MaxCodeCharacters, which counts characters as they're seen so
+// an emoji counts once, or MaxCodeLength, the bound in bytes
+func (s *Service) CheckLength(code string) error {
+	if len(code) > s.opts.MaxCodeLength {
+		return fmt.Errorf("code exceeds maximum length of %d bytes", s.opts.MaxCodeLength)
+	}
+	if characters := transpiler.Characters(code); characters > s.opts.MaxCodeCharacters {
+		return fmt.Errorf("code exceeds maximum length of %d characters (it has %d)", s.opts.MaxCodeCharacters, characters)
+	}
+	return nil
+}
+
+// ValidateInput rejects empty or oversized code and code containing
+// patterns that are never safe to transpile
+func (s *Service) ValidateInput(code string) error {
+	if len(code) == 0 {
+		return fmt.Errorf("code cannot be empty")
+	}
+	if err := s.CheckLength(code); err != nil {
+		return err
+	}
+
+	dangerousPatterns := []string{"eval(", "exec(", "__import__", "subprocess", "os.system"}
+	lower := strings.ToLower(code)
+	for _, pattern := range dangerousPatterns {
+		if strings.Contains(lower, pattern) {
+			return fmt.Errorf("unsafe pattern detected")
+		}
+	}
+	return nil
+}
+
+func (s *Service) recordHistory(sessionID string, req TranspileRequest, resp TranspileResponse) {
+	hash := sha256.Sum256([]byte(req.Code))
+	entry := history.Entry{
+		ID:             fmt.Sprintf("%x", time.Now().UnixNano()),
+		SourceHash:     hex.EncodeToString(hash[:]),
+		Timestamp:      time.Now(),
+		TargetLanguage: resp.TargetLanguage,
+		UsedMarkup:     resp.UsedMarkup,
+		Success:        resp.Success,
+		CodeLength:     len(req.Code),
+		ErrorCount:     len(resp.Errors),
+		WarningCount:   len(resp.Warnings),
+	}
+	if req.KeepSource {
+		entry.Source = req.Code
+	}
+	s.opts.History.Record(sessionID, entry)
+}
+
+// generateCacheKey hashes everything that shapes a transpile's output.
+// Keys are prefixed with the transpiler version, so a release never
+// serves output an older codegen produced; old entries age out with
+// their TTL.
+func generateCacheKey(code, lang string, markup bool, dependencies map[string]string) string {
+	modules := make([]string, 0, len(dependencies))
+	for module := range dependencies {
+		modules = append(modules, module)
+	}
+	sort.Strings(modules)
+	hash := sha256.New()
+	fmt.Fprintf(hash, "%s:%s:%t", code, lang, markup)
+	for _, module := range modules {
+		fmt.Fprintf(hash, "\x00%s=%s", module, dependencies[module])
+	}
+	return "v" + transpiler.Version + ":" + hex.EncodeToString(hash.Sum(nil))
+}
+
+// outputLimit is the most output a request may generate: the service's
+// MaxOutputLength, or less when the request asks for less
+func (s *Service) outputLimit(requested int) (int, error) {
+	switch {
+	case requested < 0:
+		return 0, fmt.Errorf("outputLimit can't be negative")
+	case requested > 0 && requested < s.opts.MaxOutputLength:
+		return requested, nil
+	}
+	return s.opts.MaxOutputLength, nil
+}
+
+// DetectMarkupSyntax reports whether code looks like the markup syntax
+// rather than the emoji syntax
+func DetectMarkupSyntax(code string) bool {
+	tags := []string{"<print", "<var", "<let", "<const", "<function", "<loop", "<if", "<class", "<record"}
+	lower := strings.ToLower(code)
+	for _, tag := range tags {
+		if strings.Contains(lower, tag) {
+			return true
+		}
+	}
+	return false
+}
+
+// The syntaxes a request can ask for with its syntax field
+const (
+	SyntaxEmoji  = "emoji"
+	SyntaxMarkup = "markup"
+	// SyntaxAuto detects markup by its tags, reading anything else as
+	// emoji
+	SyntaxAuto = "auto"
+)
+
+// DetectedMarkupWarning warns that code was read as markup only because
+// it looked like markup, which a string such as "<print" can set off
+var DetectedMarkupWarning = transpiler.Diagnostic{
+	Message:  `Read as markup because the code contains markup tags; send "syntax": "emoji" to read it as emoji`,
+	Severity: transpiler.SeverityWarning,
+	Code:     transpiler.CodeDetectedMarkup,
+}
+
+// ResolveSyntax decides whether a request's code is markup. An explicit
+// syntax is authoritative, then an explicit useMarkup, true or false;
+// with neither, or with syntax "auto", the syntax is detected.
+// detected reports that detection read the code as markup, for the
+// caller to warn that its emoji was taken for markup.
+func ResolveSyntax(syntax string, useMarkup *bool, code string) (markup, detected bool, err error) {
+	switch strings.ToLower(strings.TrimSpace(syntax)) {
+	case SyntaxEmoji:
+		return false, false, nil
+	case SyntaxMarkup:
+		return true, false, nil
+	case SyntaxAuto:
+	case "":
+		if useMarkup != nil {
+			return *useMarkup, false, nil
+		}
+	default:
+		return false, false, fmt.Errorf("Unknown syntax '%s'. Valid values: %s, %s, %s.", syntax, SyntaxEmoji, SyntaxMarkup, SyntaxAuto)
+	}
+	markup = DetectMarkupSyntax(code)
+	return markup, markup, nil
+}
+
+// TranspileMarkup runs the markup parser with the request's markup
+// options
+func TranspileMarkup(t *transpiler.Transpiler, code string, req TranspileRequest) (transpiler.MarkupResult, error) {
+	return t.TranspileMarkup(code, markupOptions(req))
+}
+
+// markupOptions are the request's markup options
+func markupOptions(req TranspileRequest) transpiler.MarkupOptions {
+	policy, _ := transpiler.ParseSanitizePolicy(req.Sanitize)
+	return transpiler.MarkupOptions{
+		Partial:          req.Partial,
+		StrictTags:       req.StrictTags,
+		StrictSchema:     req.StrictSchema,
+		Sanitize:         policy,
+		ASCIIIdentifiers: req.ASCIIIdentifiers,
+		RenameReserved:   req.RenameReserved,
+	}
+}
+
+// bundleEntry names the request's own program when tree-shaking inline
+// dependencies against it
+const bundleEntry = "\x00entry"
+
+// resolveDependencies resolves the output's imports against the request's
+// dependency map. Inline emoji sources are transpiled with t, in its
+// dialect, and tree-shaken so only the exports the program imports are
+// embedded.
+func resolveDependencies(t *transpiler.Transpiler, output string, dependencies map[string]string) (string, []transpiler.ImportResolution, []transpiler.RemovedExport, []string) {
+	modules := map[string]string{bundleEntry: output}
+	resolved := make(map[string]string, len(dependencies))
+	for module, value := range dependencies {
+		if transpiler.IsURLSpecifier(value) {
+			resolved[module] = value
+			continue
+		}
+		modules[module] = t.TranspileEmoji(value)
+	}
+
+	shaken, removed := transpiler.TreeShake(modules, bundleEntry)
+	for module, source := range shaken {
+		if module != bundleEntry {
+			resolved[module] = source
+		}
+	}
+
+	output, report := transpiler.ResolveImports(output, resolved)
+	warnings := []string{}
+	for _, imp := range report {
+		if imp.Kind == "unresolved" {
+			warnings = append(warnings, fmt.Sprintf("Line %d: unresolved import '%s' (add it to dependencies)", imp.Line, imp.Module))
+		}
+	}
+	return output, report, removed, warnings
+}
@@ -0,0 +1,171 @@
+package service
+
+import (
+	"emojiscript-backend/pkg/hints"
+	"emojiscript-backend/pkg/transpiler"
+)
+
+type TranspileRequest struct {
+	Code           string `json:"code"`
+	TargetLanguage string `json:"targetLanguage,omitempty"`
+	// UseMarkup, when sent, reads the code as markup or as emoji whatever
+	// it looks like; left out, the syntax is detected (see Syntax)
+	UseMarkup    *bool             `json:"useMarkup,omitempty"`
+	KeepSource   bool              `json:"keepSource,omitempty"`
+	Dependencies map[string]string `json:"dependencies,omitempty"`
+	Dialect      string            `json:"dialect,omitempty"`
+	// Syntax is "emoji", "markup" or "auto", which detects markup by its
+	// tags; it takes precedence over UseMarkup
+	Syntax string `json:"syntax,omitempty"`
+	// Partial returns best-effort output even when there are errors,
+	// with a placeholder comment where each error is
+	Partial bool `json:"partial,omitempty"`
+	// StrictTags matches markup tag names case-sensitively
+	StrictTags bool `json:"strictTags,omitempty"`
+	// StrictSchema checks a markup program against the tag schema and
+	// nesting rules before generating any code
+	StrictSchema bool `json:"strictSchema,omitempty"`
+	// ASCIIIdentifiers limits markup identifiers to ASCII letters, digits,
+	// '_' and '$', instead of the Unicode letters the target allows
+	ASCIIIdentifiers bool `json:"asciiIdentifiers,omitempty"`
+	// RenameReserved gives a markup name that is a reserved word, such as
+	// class, a '_' suffix instead of failing; the response's renames
+	// report each one
+	RenameReserved bool `json:"renameReserved,omitempty"`
+	// Sanitize is the policy for dangerous patterns in markup code:
+	// "rewrite" (the default), "report" or "off". Only callers with a
+	// service token may relax it.
+	Sanitize string `json:"sanitize,omitempty"`
+	// TargetLanguages asks for more than one output from one request;
+	// targetLanguage, when set, is the first of them
+	TargetLanguages []string `json:"targetLanguages,omitempty"`
+	// SourceURL names a raw GitHub or Gist file to transpile instead of
+	// code; the two can't both be set
+	SourceURL string `json:"sourceUrl,omitempty"`
+	// Privacy "strict" keeps the request out of the cache, history and
+	// statistics (see PrivacyStrict)
+	Privacy string `json:"privacy,omitempty"`
+	// MappingProfile names an emoji table from the mapping registry, such
+	// as "kid-friendly"; Mappings is a table of the request's own. Either
+	// rewrites its emoji to the built-in ones, so neither can be combined
+	// with a dialect.
+	MappingProfile string            `json:"mappingProfile,omitempty"`
+	Mappings       map[string]string `json:"mappings,omitempty"`
+	// Idiomatic runs the target's idiom passes over its output (see
+	// transpiler.Idiomatic), e.g. dropping a Rust let's mut when nothing
+	// changes the variable
+	Idiomatic bool `json:"idiomatic,omitempty"`
+	// Profile reports the time spent lexing, parsing, analyzing and
+	// generating in metadata.profile (see transpiler.Profile). A profiled
+	// request is never served from the cache.
+	Profile bool `json:"profile,omitempty"`
+	// OutputLimit lowers the most output, in bytes, the request may
+	// generate below the service's MaxOutputLength; it can't raise it
+	OutputLimit int `json:"outputLimit,omitempty"`
+}
+
+type TranspileResponse struct {
+	Success        bool                   `json:"success"`
+	JavaScript     string                 `json:"javascript,omitempty"`
+	TypeScript     string                 `json:"typescript,omitempty"`
+	Python         string                 `json:"python,omitempty"`
+	Rust           string                 `json:"rust,omitempty"`
+	GDScript       string                 `json:"gdscript,omitempty"`
+	TargetLanguage string                 `json:"targetLanguage"`
+	Output         string                 `json:"output"`
+	Errors         []string               `json:"errors,omitempty"`
+	Warnings       []string               `json:"warnings,omitempty"`
+	Metadata       map[string]interface{} `json:"metadata,omitempty"`
+	UsedMarkup     bool                   `json:"usedMarkup,omitempty"`
+	Hints          []hints.Hint           `json:"hints,omitempty"`
+	// Partial marks a failed response that still carries its output
+	Partial bool `json:"partial,omitempty"`
+	// Sanitizations lists the dangerous patterns found in markup code and
+	// what each was rewritten to
+	Sanitizations []transpiler.Sanitization `json:"sanitizations,omitempty"`
+	// Renames maps each reserved word renameReserved renamed to its new
+	// name
+	Renames map[string]string `json:"renames,omitempty"`
+	// Outputs holds each requested target's output when the request
+	// named several with targetLanguages; output is the first target's
+	Outputs map[string]string `json:"outputs,omitempty"`
+	// Diagnostics are the syntax errors and warnings with their line,
+	// column and length, for editors to mark; errors and warnings hold
+	// the same messages as plain strings
+	Diagnostics []transpiler.Diagnostic `json:"diagnostics,omitempty"`
+}
+
+type ValidateResponse struct {
+	Valid       bool                    `json:"valid"`
+	Errors      []string                `json:"errors,omitempty"`
+	Warnings    []string                `json:"warnings,omitempty"`
+	Hints       []hints.Hint            `json:"hints,omitempty"`
+	Diagnostics []transpiler.Diagnostic `json:"diagnostics,omitempty"`
+}
+
+// ProjectValidateResponse is the validation of a project's files,
+// checked together so that their imports of one another are checked too
+type ProjectValidateResponse struct {
+	Valid bool `json:"valid"`
+	// Files are each file's results, with the problems in its imports
+	Files map[string]ValidateResponse `json:"files,omitempty"`
+	// Errors are problems with the request as a whole, and Warnings the
+	// import cycles between files
+	Errors   []string `json:"errors,omitempty"`
+	Warnings []string `json:"warnings,omitempty"`
+}
+
+// ProjectRequest is a project of several files keyed by their path, e.g.
+// "main.emoji" and "lib/utils.emoji". Files import each other with
+// `<import from="./lib/utils"/>` or `📥 utils`.
+type ProjectRequest struct {
+	Files map[string]string `json:"files"`
+	// Entry is the file the bundle starts from; required to bundle more
+	// than one file
+	Entry          string `json:"entry,omitempty"`
+	TargetLanguage string `json:"targetLanguage,omitempty"`
+	// UseMarkup and Syntax are as for TranspileRequest, and apply to
+	// every file; each file's syntax is detected when neither is sent
+	UseMarkup        *bool  `json:"useMarkup,omitempty"`
+	Syntax           string `json:"syntax,omitempty"`
+	Dialect          string `json:"dialect,omitempty"`
+	StrictTags       bool   `json:"strictTags,omitempty"`
+	StrictSchema     bool   `json:"strictSchema,omitempty"`
+	ASCIIIdentifiers bool   `json:"asciiIdentifiers,omitempty"`
+	// Bundle joins the files into one module as well
+	Bundle bool `json:"bundle,omitempty"`
+	// Privacy is as for TranspileRequest; projects are never cached, so
+	// it only affects the transport
+	Privacy string `json:"privacy,omitempty"`
+	// Profile reports each file's phases in metadata.profile, as for
+	// TranspileRequest, with their total
+	Profile bool `json:"profile,omitempty"`
+}
+
+// ProjectFile is one file's output, with its imports linked to the other
+// files' outputs
+type ProjectFile struct {
+	Output string `json:"output,omitempty"`
+	// OutputName is the file's path with the target's extension; linked
+	// imports point at the other files' output names
+	OutputName  string                  `json:"outputName"`
+	UsedMarkup  bool                    `json:"usedMarkup,omitempty"`
+	Imports     []string                `json:"imports,omitempty"`
+	External    []string                `json:"external,omitempty"`
+	Errors      []string                `json:"errors,omitempty"`
+	Warnings    []string                `json:"warnings,omitempty"`
+	Diagnostics []transpiler.Diagnostic `json:"diagnostics,omitempty"`
+}
+
+type ProjectResponse struct {
+	Success        bool                   `json:"success"`
+	TargetLanguage string                 `json:"targetLanguage,omitempty"`
+	Files          map[string]ProjectFile `json:"files,omitempty"`
+	// Order lists the files so each follows the files it imports
+	Order  []string `json:"order,omitempty"`
+	Bundle string   `json:"bundle,omitempty"`
+	// Errors are prefixed with the file they're in
+	Errors   []string               `json:"errors,omitempty"`
+	Warnings []string               `json:"warnings,omitempty"`
+	Metadata map[string]interface{} `json:"metadata,omitempty"`
+}
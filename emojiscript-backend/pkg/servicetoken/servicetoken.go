@@ -0,0 +1,71 @@
+// Package servicetoken authenticates first-party callers, such as the
+// official frontend and internal batch jobs, which skip the public rate
+// limiter and may use the admin API. Service tokens are configured by the
+// operator and are separate from any per-user credentials.
+package servicetoken
+
+import (
+	"crypto/subtle"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// Header carries a service token on requests
+const Header = "X-Service-Token"
+
+// Set holds the configured tokens, each with a name for logs
+type Set struct {
+	tokens []token
+}
+
+type token struct {
+	name  string
+	value []byte
+}
+
+// Parse reads a comma-separated list such as the SERVICE_TOKENS environment
+// variable. Entries are "name:token" or a bare token, which is named
+// "service-N" after its position.
+func Parse(list string) *Set {
+	s := &Set{}
+	for i, entry := range strings.Split(list, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		name, value, found := strings.Cut(entry, ":")
+		if !found {
+			name, value = "service-"+strconv.Itoa(i+1), entry
+		}
+		if value = strings.TrimSpace(value); value != "" {
+			s.tokens = append(s.tokens, token{name: strings.TrimSpace(name), value: []byte(value)})
+		}
+	}
+	return s
+}
+
+// Empty reports whether no tokens are configured
+func (s *Set) Empty() bool {
+	return s == nil || len(s.tokens) == 0
+}
+
+// Match returns the name of the token equal to value. Every token is
+// compared in constant time so timing doesn't reveal which one is close.
+func (s *Set) Match(value string) (name string, ok bool) {
+	if s == nil || value == "" {
+		return "", false
+	}
+	for _, t := range s.tokens {
+		if subtle.ConstantTimeCompare([]byte(value), t.value) == 1 && !ok {
+			name, ok = t.name, true
+		}
+	}
+	return name, ok
+}
+
+// FromRequest returns the name of the service that sent r, if its
+// X-Service-Token header holds a configured token
+func (s *Set) FromRequest(r *http.Request) (name string, ok bool) {
+	return s.Match(r.Header.Get(Header))
+}
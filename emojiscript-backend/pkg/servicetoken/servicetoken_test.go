@@ -0,0 +1,30 @@
+package servicetoken
+
+import "testing"
+
+// TestParse checks that tokens are named by their entry or position and
+// matched only by their whole value
+func TestParse(t *testing.T) {
+	s := Parse(" frontend:abc , xyz,, batch: ,:def")
+	for _, tt := range []struct {
+		value, name string
+		ok          bool
+	}{
+		{"abc", "frontend", true},
+		{"xyz", "service-2", true},
+		{"def", "", true},
+		{"frontend:abc", "", false},
+		{"batch", "", false},
+		{"", "", false},
+	} {
+		if name, ok := s.Match(tt.value); name != tt.name || ok != tt.ok {
+			t.Errorf("Match(%q) = %q, %v, want %q, %v", tt.value, name, ok, tt.name, tt.ok)
+		}
+	}
+	if s.Empty() {
+		t.Error("got an empty set")
+	}
+	if !Parse(" , ").Empty() || !(*Set)(nil).Empty() {
+		t.Error("got a set of no tokens that isn't empty")
+	}
+}
@@ -0,0 +1,153 @@
+// Package source fetches programs from URLs, for transpile requests that
+// name a sourceUrl instead of sending code. Only https URLs on
+// allow-listed hosts are fetched, redirects must stay on them, and bodies
+// are capped, so the server can't be pointed at internal addresses or
+// made to download large files.
+package source
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// DefaultTimeout bounds one fetch, redirects included
+const DefaultTimeout = 5 * time.Second
+
+// DefaultHosts serve raw files from GitHub repositories and Gists
+var DefaultHosts = []string{"raw.githubusercontent.com", "gist.githubusercontent.com"}
+
+var (
+	// ErrInvalidURL is a URL that doesn't parse or isn't https
+	ErrInvalidURL = errors.New("invalid URL")
+	// ErrHostNotAllowed is a URL, or a redirect, to a host off the allow list
+	ErrHostNotAllowed = errors.New("host is not allowed")
+	// ErrTooLarge is a body longer than the fetcher's cap
+	ErrTooLarge = errors.New("source is too large")
+)
+
+// Fetcher fetches sources from allow-listed hosts
+type Fetcher struct {
+	hosts    map[string]bool
+	maxBytes int64
+	client   *http.Client
+}
+
+// New creates a fetcher for hosts (DefaultHosts when empty) that reads at
+// most maxBytes of a body
+func New(hosts []string, maxBytes int) *Fetcher {
+	if len(hosts) == 0 {
+		hosts = DefaultHosts
+	}
+	f := &Fetcher{hosts: make(map[string]bool, len(hosts)), maxBytes: int64(maxBytes)}
+	for _, host := range hosts {
+		if host = strings.ToLower(strings.TrimSpace(host)); host != "" {
+			f.hosts[host] = true
+		}
+	}
+	f.client = &http.Client{
+		Timeout: DefaultTimeout,
+		CheckRedirect: func(req *http.Request, via []*http.Request) error {
+			if len(via) >= 5 {
+				return errors.New("too many redirects")
+			}
+			return f.check(req.URL)
+		},
+	}
+	return f
+}
+
+// ParseHosts reads a comma-separated host list, e.g. from an environment
+// variable; an empty list keeps DefaultHosts
+func ParseHosts(s string) []string {
+	var hosts []string
+	for _, host := range strings.Split(s, ",") {
+		if host = strings.TrimSpace(host); host != "" {
+			hosts = append(hosts, host)
+		}
+	}
+	return hosts
+}
+
+// Raw rewrites a GitHub page URL to the raw file it shows:
+// github.com/{owner}/{repo}/blob/{ref}/{path} and
+// gist.github.com/{user}/{id}. Other URLs are returned unchanged.
+func Raw(u *url.URL) *url.URL {
+	parts := strings.Split(strings.Trim(u.Path, "/"), "/")
+	raw := *u
+	switch strings.ToLower(u.Hostname()) {
+	case "github.com":
+		if len(parts) < 5 || parts[2] != "blob" {
+			return u
+		}
+		raw.Host = "raw.githubusercontent.com"
+		raw.Path = "/" + strings.Join(append(parts[:2:2], parts[3:]...), "/")
+	case "gist.github.com":
+		if len(parts) != 2 {
+			return u
+		}
+		raw.Host = "gist.githubusercontent.com"
+		raw.Path = "/" + parts[0] + "/" + parts[1] + "/raw"
+	default:
+		return u
+	}
+	raw.RawQuery, raw.Fragment = "", ""
+	return &raw
+}
+
+func (f *Fetcher) check(u *url.URL) error {
+	if u.Scheme != "https" {
+		return fmt.Errorf("%w: only https URLs can be fetched", ErrInvalidURL)
+	}
+	if u.User != nil || u.Port() != "" || !f.hosts[strings.ToLower(u.Hostname())] {
+		return fmt.Errorf("%w: %s", ErrHostNotAllowed, u.Host)
+	}
+	return nil
+}
+
+// Fetch returns the body at rawURL, after rewriting GitHub page URLs with
+// Raw
+func (f *Fetcher) Fetch(ctx context.Context, rawURL string) (string, error) {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return "", fmt.Errorf("%w: %v", ErrInvalidURL, err)
+	}
+	u = Raw(u)
+	if err := f.check(u); err != nil {
+		return "", err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u.String(), nil)
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Accept", "text/plain")
+	resp, err := f.client.Do(req)
+	if err != nil {
+		if errors.Is(err, ErrHostNotAllowed) {
+			return "", fmt.Errorf("redirect: %w", ErrHostNotAllowed)
+		}
+		return "", err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("fetching %s: %s", u.Host, resp.Status)
+	}
+	if resp.ContentLength > f.maxBytes {
+		return "", ErrTooLarge
+	}
+
+	body, err := io.ReadAll(io.LimitReader(resp.Body, f.maxBytes+1))
+	if err != nil {
+		return "", err
+	}
+	if int64(len(body)) > f.maxBytes {
+		return "", ErrTooLarge
+	}
+	return string(body), nil
+}
@@ -0,0 +1,201 @@
+// Package spec is the EmojiScript conformance suite: the programs a
+// transpiler must translate as this one does, taken from the golden
+// corpus, and the ones it must reject, with a runner that holds any
+// implementation to them. A reimplementation, such as a transpiler
+// written in JavaScript, runs the suite against its own output with
+// `emojic spec -exec`, which drives it through Command; the server
+// reports its own results at /api/v1/conformance.
+package spec
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os/exec"
+	"slices"
+	"strings"
+	"time"
+
+	"emojiscript-backend/pkg/golden"
+	"emojiscript-backend/pkg/transpiler"
+)
+
+// Result statuses. A case passes when the output is the one recorded,
+// and is equivalent when it differs only in layout: indentation, blank
+// lines, trailing whitespace and the semicolons ending lines.
+const (
+	Pass       = "pass"
+	Equivalent = "equivalent"
+	Fail       = "fail"
+	Skip       = "skip"
+)
+
+// Case is one program of the suite
+type Case struct {
+	Name           string `json:"name"`
+	Feature        string `json:"feature"`
+	Syntax         string `json:"syntax"`
+	TargetLanguage string `json:"targetLanguage"`
+	Input          string `json:"input"`
+	// Output is what the program transpiles to; it is empty for a
+	// program that must be rejected
+	Output string `json:"output,omitempty"`
+	// Reject is set for a program that isn't valid EmojiScript, which an
+	// implementation must fail to transpile
+	Reject bool `json:"reject,omitempty"`
+}
+
+// rejections are programs every implementation must refuse
+var rejections = []Case{
+	{Name: "unterminated string", Feature: "strings", Syntax: "emoji", Input: "📝(\"Hello)"},
+	{Name: "unterminated template literal", Feature: "strings", Syntax: "emoji", Input: "📦 s = `a ${b"},
+	{Name: "unterminated comment", Feature: "comments", Syntax: "emoji", Input: "/* note"},
+	{Name: "unclosed brace", Feature: "functions", Syntax: "emoji", Input: "🎯 f() {\n  🔙 1\n"},
+	{Name: "unmatched parenthesis", Feature: "print", Syntax: "emoji", Input: "📝(1))"},
+	{Name: "unclosed tag", Feature: "print", Syntax: "markup", Input: "<print>\"Hello\""},
+	{Name: "unclosed loop", Feature: "loops", Syntax: "markup", Input: "<loop var=\"i\" from=\"0\" to=\"3\">\n<print>i</print>"},
+	{Name: "mismatched closing tag", Feature: "conditionals", Syntax: "markup", Input: "<if condition=\"x\">\n</loop>"},
+}
+
+// Cases returns the suite: every golden fixture, then the programs that
+// must be rejected, which are the same in every target language
+func Cases() []Case {
+	var cases []Case
+	for _, fixture := range golden.Fixtures("", "") {
+		cases = append(cases, Case{
+			Name:           fixture.Name,
+			Feature:        fixture.Feature,
+			Syntax:         fixture.Syntax,
+			TargetLanguage: fixture.TargetLanguage,
+			Input:          fixture.Input,
+			Output:         fixture.Output,
+		})
+	}
+	for _, rejection := range rejections {
+		rejection.Name = "rejects " + rejection.Name
+		rejection.TargetLanguage = "javascript"
+		rejection.Reject = true
+		cases = append(cases, rejection)
+	}
+	return cases
+}
+
+// Implementation is a transpiler under test. Transpile returns an error
+// for a program it rejects.
+type Implementation interface {
+	Transpile(input, syntax, targetLanguage string) (string, error)
+}
+
+// Func adapts a function to Implementation
+type Func func(input, syntax, targetLanguage string) (string, error)
+
+func (f Func) Transpile(input, syntax, targetLanguage string) (string, error) {
+	return f(input, syntax, targetLanguage)
+}
+
+// CommandTimeout bounds how long Command waits for one case
+const CommandTimeout = 10 * time.Second
+
+// Command runs an implementation as a program, once per case: the case
+// is written to its stdin as JSON, {"input", "syntax", "targetLanguage"},
+// and the output read from its stdout. Exiting non-zero rejects the
+// program, with stderr as the reason.
+func Command(name string, args ...string) Implementation {
+	return Func(func(input, syntax, targetLanguage string) (string, error) {
+		request, err := json.Marshal(map[string]string{"input": input, "syntax": syntax, "targetLanguage": targetLanguage})
+		if err != nil {
+			return "", err
+		}
+		ctx, cancel := context.WithTimeout(context.Background(), CommandTimeout)
+		defer cancel()
+		cmd := exec.CommandContext(ctx, name, args...)
+		cmd.Stdin = bytes.NewReader(request)
+		var stdout, stderr bytes.Buffer
+		cmd.Stdout, cmd.Stderr = &stdout, &stderr
+		if err := cmd.Run(); err != nil {
+			if reason := strings.TrimSpace(stderr.String()); reason != "" {
+				return "", errors.New(reason)
+			}
+			return "", err
+		}
+		return stdout.String(), nil
+	})
+}
+
+// Result is how an implementation did on one case
+type Result struct {
+	Case    string `json:"case"`
+	Feature string `json:"feature"`
+	Status  string `json:"status"`
+	Message string `json:"message,omitempty"`
+}
+
+// Report is an implementation's results on the suite
+type Report struct {
+	// Version is the version of the transpiler the suite was recorded
+	// with
+	Version string `json:"version"`
+	// Passed is set when no case failed
+	Passed bool `json:"passed"`
+	// Score is the share of the cases run that passed or were
+	// equivalent, from 0 to 1
+	Score   float64        `json:"score"`
+	Counts  map[string]int `json:"counts"`
+	Results []Result       `json:"results"`
+}
+
+// Run puts every case through impl. Cases recorded for a target language
+// outside targets are skipped; no targets runs them all.
+func Run(impl Implementation, targets ...string) Report {
+	report := Report{Version: transpiler.Version, Counts: map[string]int{Pass: 0, Equivalent: 0, Fail: 0, Skip: 0}, Results: []Result{}}
+	for _, c := range Cases() {
+		result := Result{Case: c.Name, Feature: c.Feature}
+		if len(targets) > 0 && !slices.Contains(targets, c.TargetLanguage) {
+			result.Status, result.Message = Skip, fmt.Sprintf("recorded for %s", c.TargetLanguage)
+		} else {
+			result.Status, result.Message = check(impl, c)
+		}
+		report.Counts[result.Status]++
+		report.Results = append(report.Results, result)
+	}
+	run := len(report.Results) - report.Counts[Skip]
+	if run > 0 {
+		report.Score = float64(report.Counts[Pass]+report.Counts[Equivalent]) / float64(run)
+	}
+	report.Passed = report.Counts[Fail] == 0
+	return report
+}
+
+// check runs one case, returning its status with the reason for anything
+// but a pass
+func check(impl Implementation, c Case) (string, string) {
+	output, err := impl.Transpile(c.Input, c.Syntax, c.TargetLanguage)
+	switch {
+	case c.Reject && err == nil:
+		return Fail, "transpiled a program that must be rejected"
+	case c.Reject:
+		return Pass, ""
+	case err != nil:
+		return Fail, err.Error()
+	case output == c.Output:
+		return Pass, ""
+	case layoutless(output) == layoutless(c.Output):
+		return Equivalent, "differs from the recorded output in layout only"
+	}
+	return Fail, fmt.Sprintf("got %q, want %q", output, c.Output)
+}
+
+// layoutless drops what Equivalent ignores: each line's indentation,
+// trailing whitespace and semicolon, and blank lines
+func layoutless(code string) string {
+	var lines []string
+	for _, line := range strings.Split(code, "\n") {
+		line = strings.TrimSuffix(strings.TrimSpace(line), ";")
+		if line != "" {
+			lines = append(lines, line)
+		}
+	}
+	return strings.Join(lines, "\n")
+}
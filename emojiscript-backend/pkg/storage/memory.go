@@ -0,0 +1,88 @@
+package storage
+
+import (
+	"context"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Memory is the memory driver: records kept in the process until it exits
+type Memory struct {
+	mu          sync.Mutex
+	collections map[string]map[string]entry
+}
+
+type entry struct {
+	value []byte
+	// expires is zero for a record kept until it is deleted
+	expires time.Time
+}
+
+func (e entry) expired(now time.Time) bool {
+	return !e.expires.IsZero() && !now.Before(e.expires)
+}
+
+// NewMemory returns an empty memory store
+func NewMemory() *Memory {
+	return &Memory{collections: map[string]map[string]entry{}}
+}
+
+func (m *Memory) Get(ctx context.Context, collection, key string) ([]byte, bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	e, ok := m.collections[collection][key]
+	if !ok || e.expired(time.Now()) {
+		return nil, false, nil
+	}
+	return slices.Clone(e.value), true, nil
+}
+
+func (m *Memory) Put(ctx context.Context, collection, key string, value []byte, ttl time.Duration) error {
+	e := entry{value: slices.Clone(value)}
+	if ttl > 0 {
+		e.expires = time.Now().Add(ttl)
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	records, ok := m.collections[collection]
+	if !ok {
+		records = map[string]entry{}
+		m.collections[collection] = records
+	}
+	records[key] = e
+	return nil
+}
+
+func (m *Memory) Delete(ctx context.Context, collection, key string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	delete(m.collections[collection], key)
+	return nil
+}
+
+// List also forgets the collection's expired records
+func (m *Memory) List(ctx context.Context, collection string) ([]Record, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	now := time.Now()
+	records := []Record{}
+	for key, e := range m.collections[collection] {
+		if e.expired(now) {
+			delete(m.collections[collection], key)
+			continue
+		}
+		records = append(records, Record{Key: key, Value: slices.Clone(e.value)})
+	}
+	slices.SortFunc(records, func(a, b Record) int { return strings.Compare(a.Key, b.Key) })
+	return records, nil
+}
+
+func (m *Memory) Driver() string {
+	return "memory"
+}
+
+func (m *Memory) Close() error {
+	return nil
+}
@@ -0,0 +1,167 @@
+package storage
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Dialect is a SQL database the sqlite and postgres drivers talk to
+type Dialect struct {
+	Name string
+	// DriverNames are the database/sql drivers that reach the database,
+	// in the order they're preferred; the first one linked is used
+	DriverNames []string
+	// blobType is the column type of values
+	blobType string
+	// numbered is set when placeholders are $1, $2, ... rather than ?
+	numbered bool
+}
+
+// The dialects of the sqlite and postgres drivers. Their database/sql
+// drivers are those of modernc.org/sqlite or github.com/mattn/go-sqlite3,
+// and github.com/jackc/pgx/v5/stdlib or github.com/lib/pq.
+var (
+	SQLite   = Dialect{Name: "sqlite", DriverNames: []string{"sqlite", "sqlite3"}, blobType: "BLOB"}
+	Postgres = Dialect{Name: "postgres", DriverNames: []string{"pgx", "postgres"}, blobType: "BYTEA", numbered: true}
+)
+
+// table holds every collection's records. expires_at is in Unix
+// milliseconds, zero for a record kept until it is deleted.
+const table = "emojiscript_records"
+
+// SQL is the sqlite and postgres drivers: records in one table of a SQL
+// database
+type SQL struct {
+	db      *sql.DB
+	dialect Dialect
+}
+
+// OpenSQL connects to a database of dialect with dsn, in the form its
+// database/sql driver reads, and creates the table if it's missing. The
+// program links the driver with a blank import of its package; cmd/server
+// does with the sqlite and postgres build tags.
+func OpenSQL(dialect Dialect, dsn string) (*SQL, error) {
+	var driver string
+	for _, name := range dialect.DriverNames {
+		if slices.Contains(sql.Drivers(), name) {
+			driver = name
+			break
+		}
+	}
+	if driver == "" {
+		return nil, fmt.Errorf("storage: %s: no database/sql driver is linked in; build with one registered as %s",
+			dialect.Name, strings.Join(dialect.DriverNames, " or "))
+	}
+	db, err := sql.Open(driver, dsn)
+	if err != nil {
+		return nil, fmt.Errorf("storage: %s: %v", dialect.Name, err)
+	}
+	s := &SQL{db: db, dialect: dialect}
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	_, err = db.ExecContext(ctx, fmt.Sprintf(`CREATE TABLE IF NOT EXISTS %s (
+	collection TEXT NOT NULL,
+	key TEXT NOT NULL,
+	value %s NOT NULL,
+	expires_at BIGINT NOT NULL DEFAULT 0,
+	PRIMARY KEY (collection, key)
+)`, table, dialect.blobType))
+	if err != nil {
+		db.Close()
+		return nil, fmt.Errorf("storage: %s: %v", dialect.Name, err)
+	}
+	return s, nil
+}
+
+// query rewrites a query's ? placeholders as the dialect numbers them
+func (s *SQL) query(query string) string {
+	if !s.dialect.numbered {
+		return query
+	}
+	var b strings.Builder
+	n := 0
+	for _, r := range query {
+		if r == '?' {
+			n++
+			b.WriteString("$" + strconv.Itoa(n))
+			continue
+		}
+		b.WriteRune(r)
+	}
+	return b.String()
+}
+
+func (s *SQL) Get(ctx context.Context, collection, key string) ([]byte, bool, error) {
+	var value []byte
+	err := s.db.QueryRowContext(ctx, s.query(`SELECT value FROM `+table+` WHERE collection = ? AND key = ? AND (expires_at = 0 OR expires_at > ?)`),
+		collection, key, time.Now().UnixMilli()).Scan(&value)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, false, nil
+	}
+	if err != nil {
+		return nil, false, fmt.Errorf("%s: %v", s.dialect.Name, err)
+	}
+	return value, true, nil
+}
+
+func (s *SQL) Put(ctx context.Context, collection, key string, value []byte, ttl time.Duration) error {
+	var expires int64
+	if ttl > 0 {
+		expires = time.Now().Add(ttl).UnixMilli()
+	}
+	_, err := s.db.ExecContext(ctx, s.query(`INSERT INTO `+table+` (collection, key, value, expires_at) VALUES (?, ?, ?, ?)
+ON CONFLICT (collection, key) DO UPDATE SET value = excluded.value, expires_at = excluded.expires_at`),
+		collection, key, value, expires)
+	if err != nil {
+		return fmt.Errorf("%s: %v", s.dialect.Name, err)
+	}
+	return nil
+}
+
+func (s *SQL) Delete(ctx context.Context, collection, key string) error {
+	_, err := s.db.ExecContext(ctx, s.query(`DELETE FROM `+table+` WHERE collection = ? AND key = ?`), collection, key)
+	if err != nil {
+		return fmt.Errorf("%s: %v", s.dialect.Name, err)
+	}
+	return nil
+}
+
+// List also deletes the collection's expired records
+func (s *SQL) List(ctx context.Context, collection string) ([]Record, error) {
+	now := time.Now().UnixMilli()
+	_, err := s.db.ExecContext(ctx, s.query(`DELETE FROM `+table+` WHERE collection = ? AND expires_at <> 0 AND expires_at <= ?`), collection, now)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v", s.dialect.Name, err)
+	}
+	rows, err := s.db.QueryContext(ctx, s.query(`SELECT key, value FROM `+table+` WHERE collection = ? ORDER BY key`), collection)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v", s.dialect.Name, err)
+	}
+	defer rows.Close()
+	records := []Record{}
+	for rows.Next() {
+		var record Record
+		if err := rows.Scan(&record.Key, &record.Value); err != nil {
+			return nil, fmt.Errorf("%s: %v", s.dialect.Name, err)
+		}
+		records = append(records, record)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("%s: %v", s.dialect.Name, err)
+	}
+	return records, nil
+}
+
+func (s *SQL) Driver() string {
+	return s.dialect.Name
+}
+
+func (s *SQL) Close() error {
+	return s.db.Close()
+}
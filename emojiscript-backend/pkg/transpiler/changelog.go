@@ -0,0 +1,136 @@
+package transpiler
+
+import (
+	"strconv"
+	"strings"
+)
+
+// ChangeKind is what a language change did
+type ChangeKind string
+
+const (
+	ChangeAddedEmoji  ChangeKind = "added-emoji"
+	ChangeAddedTag    ChangeKind = "added-tag"
+	ChangeChangedTag  ChangeKind = "changed-tag"
+	ChangeAddedSyntax ChangeKind = "added-syntax"
+	// ChangeChangedSyntax is existing source that now means or outputs
+	// something different
+	ChangeChangedSyntax ChangeKind = "changed-syntax"
+	// ChangeDeprecated still works, with Replacement to move to before
+	// the release named by RemovedIn
+	ChangeDeprecated ChangeKind = "deprecated"
+)
+
+// Change is one language change in a release
+type Change struct {
+	Kind ChangeKind `json:"kind"`
+	// Subject is the emoji, tag or form that changed, e.g. "🛟" or "<record>"
+	Subject string `json:"subject"`
+	Summary string `json:"summary"`
+	// Replacement is what to write instead of a deprecated subject
+	Replacement string `json:"replacement,omitempty"`
+	RemovedIn   string `json:"removedIn,omitempty"`
+}
+
+// Release is a language version and the changes it made
+type Release struct {
+	Version string `json:"version"`
+	// Date is when the release was cut, when it's known
+	Date    string   `json:"date,omitempty"`
+	Changes []Change `json:"changes"`
+}
+
+// releases is the version registry, newest first; the first entry's
+// version must be Version. Record each language change here when it
+// lands, so /changelog can tell frontends what's new.
+var releases = []Release{
+	{
+		Version: "1.1.0",
+		Date:    "2026-10-16",
+		Changes: []Change{
+			{Kind: ChangeAddedEmoji, Subject: "🛟", Summary: "nullish default assignment (??=), desugared for targets without it"},
+			{Kind: ChangeAddedEmoji, Subject: "🧱", Summary: "record types, the emoji form of <record>"},
+			{Kind: ChangeAddedEmoji, Subject: "🧲", Summary: "getters in emoji class bodies"},
+			{Kind: ChangeAddedSyntax, Subject: "🎪 switch expression", Summary: "a switch assigned to a variable, with 🔘 value ➡️ result arms"},
+			{Kind: ChangeAddedSyntax, Subject: ":shortcode:", Summary: "shortcodes such as :package: are accepted wherever their keyword emoji is"},
+			{Kind: ChangeAddedTag, Subject: "<elif>", Summary: "else-if branches; <if>, <elif> and <else> siblings transpile as one conditional"},
+			{Kind: ChangeAddedTag, Subject: "<record>", Summary: "record types with named, typed fields"},
+			{Kind: ChangeChangedTag, Subject: "<switch>", Summary: "an into attribute makes it a switch expression, with <case> and <default> holding its values"},
+			{Kind: ChangeChangedTag, Subject: "<method>", Summary: "method names are validated, constructors checked, and async and generator methods added"},
+			{Kind: ChangeChangedTag, Subject: "<export>", Summary: "export lists, re-exports and exported declarations"},
+			{Kind: ChangeChangedTag, Subject: "<import>", Summary: "default, namespace and side-effect imports, with Python output"},
+			{Kind: ChangeChangedTag, Subject: "<print>", Summary: "a text attribute prints an escaped string literal; variables take one too"},
+			{Kind: ChangeChangedTag, Subject: "identifiers", Summary: "markup names follow the target's rules: Unicode letters and $ for JavaScript, PEP 3131 for Python; asciiIdentifiers restricts them to ASCII"},
+			{Kind: ChangeChangedTag, Subject: "<break>", Summary: "tags without a body, such as <break>, no longer need their closing slash"},
+			{Kind: ChangeChangedSyntax, Subject: "emoji in strings and comments", Summary: "emoji programs are lexed, so emoji inside strings, comments, templates and regular expressions stay as written"},
+		},
+	},
+	{
+		Version: "1.0.0",
+		Changes: []Change{
+			{Kind: ChangeAddedSyntax, Subject: "emoji syntax", Summary: "keyword emoji transpiled to JavaScript"},
+			{Kind: ChangeAddedSyntax, Subject: "markup syntax", Summary: "HTML-like tags transpiled to JavaScript"},
+		},
+	},
+}
+
+// Changelog returns the releases newer than since, newest first; every
+// release when since is empty
+func Changelog(since string) []Release {
+	out := []Release{}
+	for _, release := range releases {
+		if since != "" && compareVersions(release.Version, since) <= 0 {
+			break
+		}
+		out = append(out, release)
+	}
+	return out
+}
+
+// Deprecations returns the deprecated changes still in effect at Version
+func Deprecations() []Change {
+	out := []Change{}
+	for _, release := range releases {
+		for _, change := range release.Changes {
+			if change.Kind == ChangeDeprecated && (change.RemovedIn == "" || compareVersions(Version, change.RemovedIn) < 0) {
+				out = append(out, change)
+			}
+		}
+	}
+	return out
+}
+
+// ValidVersion reports whether v is a major.minor.patch version
+func ValidVersion(v string) bool {
+	parts := strings.Split(v, ".")
+	if len(parts) != 3 {
+		return false
+	}
+	for _, part := range parts {
+		if _, err := strconv.Atoi(part); err != nil {
+			return false
+		}
+	}
+	return true
+}
+
+// compareVersions orders two major.minor.patch versions
+func compareVersions(a, b string) int {
+	as, bs := strings.Split(a, "."), strings.Split(b, ".")
+	for i := 0; i < 3; i++ {
+		var x, y int
+		if i < len(as) {
+			x, _ = strconv.Atoi(as[i])
+		}
+		if i < len(bs) {
+			y, _ = strconv.Atoi(bs[i])
+		}
+		if x != y {
+			if x < y {
+				return -1
+			}
+			return 1
+		}
+	}
+	return 0
+}
@@ -0,0 +1,23 @@
+package transpiler
+
+import "unicode"
+
+// Characters counts the characters of code as a reader sees them: an
+// emoji with its skin tone, keycap or zero-width-joined parts, a flag, a
+// letter with its combining marks and a CRLF line break each count once.
+// Its length in bytes counts most emoji four times or more.
+func Characters(code string) int {
+	runes := []rune(code)
+	count := 0
+	for i := 0; i < len(runes); count++ {
+		if runes[i] == '\r' && i+1 < len(runes) && runes[i+1] == '\n' {
+			i += 2
+			continue
+		}
+		i = emojiEnd(runes, i)
+		for i < len(runes) && unicode.In(runes[i], unicode.Mn, unicode.Me) {
+			i++
+		}
+	}
+	return count
+}
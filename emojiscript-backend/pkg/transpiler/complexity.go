@@ -0,0 +1,234 @@
+package transpiler
+
+import (
+	"fmt"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// DefaultComplexityBudget is the most a program may cost to parse (see
+// MeasureComplexity). Real programs at the longest the server accepts
+// cost well under a million; reaching it takes thousands of levels of
+// nesting, or nodes with tens of thousands of children.
+const DefaultComplexityBudget = 10_000_000
+
+// Costs of what the parsers do, in units of the budget. Walking a tree
+// visits each node's enclosing ones and scans its siblings, so deep
+// nesting and wide nodes cost more than their length suggests: a program
+// of nothing but opening brackets costs the square of its length.
+const (
+	// TokenCost is what each token costs
+	TokenCost = 1
+	// NestingCost is added to a token for each bracket, or markup tag,
+	// it is nested in
+	NestingCost = 1
+	// SiblingsPerCost is how many siblings before it make a node's
+	// child cost one more
+	SiblingsPerCost = 1000
+)
+
+// Complexity is what parsing a program costs, measured without parsing
+// it: the tokens are counted, along with how deep they nest and the most
+// children any node has.
+type Complexity struct {
+	Cost     int `json:"cost"`
+	Tokens   int `json:"tokens"`
+	Depth    int `json:"depth"`
+	Children int `json:"children"`
+	// Exceeded is set when the cost passed the budget, at Line and
+	// Column, where measuring stopped
+	Exceeded bool `json:"exceeded,omitempty"`
+	Line     int  `json:"line,omitempty"`
+	Column   int  `json:"column,omitempty"`
+}
+
+// complexityMeter adds up the cost of a program's tokens as they are read
+type complexityMeter struct {
+	Complexity
+	budget int
+	// children counts the children of each node still open, the
+	// program's first
+	children []int
+}
+
+func newComplexityMeter(budget int) *complexityMeter {
+	return &complexityMeter{budget: budget, children: []int{0}}
+}
+
+// add counts a token, or a tag, at line and column in the innermost open
+// node, reporting false once the budget is spent
+func (m *complexityMeter) add(line, column int) bool {
+	depth := len(m.children) - 1
+	siblings := m.children[depth]
+	m.children[depth]++
+	m.Tokens++
+	m.Depth = max(m.Depth, depth)
+	m.Children = max(m.Children, siblings+1)
+	m.Cost += TokenCost + depth*NestingCost + siblings/SiblingsPerCost
+	if m.budget > 0 && m.Cost > m.budget {
+		m.Exceeded, m.Line, m.Column = true, line, column
+		return false
+	}
+	return true
+}
+
+// open makes the token just added a node whose children follow
+func (m *complexityMeter) open() {
+	m.children = append(m.children, 0)
+}
+
+// close ends the innermost open node; a close with none open is ignored,
+// as the parsers report it
+func (m *complexityMeter) close() {
+	if len(m.children) > 1 {
+		m.children = m.children[:len(m.children)-1]
+	}
+}
+
+// MeasureComplexity measures what parsing code, written in the dialect,
+// would cost, stopping where it passes budget; a budget of zero measures
+// the whole program. It takes time in proportion to the program's length
+// whatever its shape, so it can turn away a program crafted to make the
+// parsers slow before they start.
+func (t *Transpiler) MeasureComplexity(code string, markup bool, budget int) Complexity {
+	if markup {
+		return measureMarkup(t.applyMarkupAliases(code), budget)
+	}
+	return measureEmoji(t.ApplyAliases(code), budget)
+}
+
+// measureEmoji counts the tokens of emoji syntax, nesting them in
+// brackets. A closing bracket only closes the innermost group, and only
+// when it matches; the parser's recovery from other brackets is left for
+// it to report.
+func measureEmoji(code string, budget int) Complexity {
+	tokens, _ := Lex(code)
+	m := newComplexityMeter(budget)
+	// open holds the closing bracket of each open group, innermost last
+	var open []string
+	for _, tok := range tokens {
+		if tok.Kind == TokenSpace || tok.Kind == TokenComment {
+			continue
+		}
+		if tok.Kind == TokenPunct && len(open) > 0 && tok.Text == open[len(open)-1] {
+			open = open[:len(open)-1]
+			m.close()
+			continue
+		}
+		if !m.add(tok.Line, tok.Column) {
+			break
+		}
+		if tok.Kind == TokenPunct && closers[tok.Text] != "" {
+			open = append(open, closers[tok.Text])
+			m.open()
+		}
+	}
+	return m.Complexity
+}
+
+// measureMarkup counts the tokens of markup syntax, each run of letters
+// and digits and each other character outside whitespace, nesting them in
+// the known tags that have a body. A closing tag closes the innermost
+// open tag when the names match.
+func measureMarkup(code string, budget int) Complexity {
+	parser := NewMarkupParser(code, "")
+	input := parser.convertEmojisToKeywords(parser.input)
+	m := newComplexityMeter(budget)
+	// open holds the names of the open tags, innermost last
+	var open []string
+	line, column := 1, 1
+	word := false
+	for i := 0; i < len(input); {
+		r, size := utf8.DecodeRuneInString(input[i:])
+		if r == '<' {
+			if name, closing, end, ok := markupTagAt(input, i); ok {
+				spec, known := markupTagIndex[strings.ToLower(name)]
+				switch {
+				case !known:
+				case closing:
+					if len(open) > 0 && open[len(open)-1] == strings.ToLower(name) {
+						open = open[:len(open)-1]
+						m.close()
+					}
+				default:
+					if !m.add(line, parser.sourcePosition(line, column)) {
+						return m.Complexity
+					}
+					if spec.content != "none" && !strings.HasSuffix(input[i:end], "/>") {
+						open = append(open, strings.ToLower(name))
+						m.open()
+					}
+				}
+				if known {
+					for _, r := range input[i:end] {
+						if r == '\n' {
+							line, column = line+1, 1
+						} else {
+							column++
+						}
+					}
+					i, word = end, false
+					continue
+				}
+			}
+		}
+
+		inWord := unicode.IsLetter(r) || unicode.IsDigit(r) || r == '_'
+		if !unicode.IsSpace(r) && !(inWord && word) {
+			if !m.add(line, parser.sourcePosition(line, column)) {
+				return m.Complexity
+			}
+		}
+		word = inWord
+		if r == '\n' {
+			line, column = line+1, 1
+		} else {
+			column++
+		}
+		i += size
+	}
+	return m.Complexity
+}
+
+// markupTagAt reads the tag starting at the '<' at offset i: its name,
+// whether it closes a tag and the offset just past its '>'. It stops at
+// the next '<', so the scan never goes back over the input; a tag with
+// '<' in an attribute value isn't counted, and one with '>' in it ends
+// early, leaving the rest of the value to be counted as tokens.
+func markupTagAt(input string, i int) (name string, closing bool, end int, ok bool) {
+	j := i + 1
+	if j < len(input) && input[j] == '/' {
+		closing = true
+		j++
+	}
+	start := j
+	for j < len(input) {
+		r, size := utf8.DecodeRuneInString(input[j:])
+		if !unicode.IsLetter(r) && !unicode.IsDigit(r) && r != '_' && r != '-' {
+			break
+		}
+		j += size
+	}
+	if j == start {
+		return "", false, 0, false
+	}
+	name = input[start:j]
+	if k := strings.IndexAny(input[j:], "<>"); k >= 0 && input[j+k] == '>' {
+		return name, closing, j + k + 1, true
+	}
+	return "", false, 0, false
+}
+
+// Diagnostic explains a program that passed budget, at the token where it
+// did
+func (c Complexity) Diagnostic(budget int) Diagnostic {
+	return Diagnostic{
+		Message:  fmt.Sprintf("Program too complex to parse: it passes the complexity budget of %d at line %d (%d tokens, nested up to %d deep)", budget, c.Line, c.Tokens, c.Depth),
+		Severity: SeverityError,
+		Line:     c.Line,
+		Column:   c.Column,
+		Length:   1,
+		Code:     CodeTooComplex,
+	}
+}
@@ -0,0 +1,137 @@
+package transpiler
+
+import (
+	"math"
+	"sort"
+)
+
+// Coverage counts the emoji of a program the emoji map recognizes against
+// those it passes through unchanged
+type Coverage struct {
+	Recognized int `json:"recognized"`
+	Unknown    int `json:"unknown"`
+	// UnknownEmoji counts each unrecognized emoji
+	UnknownEmoji map[string]int `json:"unknownEmoji,omitempty"`
+}
+
+// Percent is the share of emoji recognized, to one decimal place; a
+// program without emoji is fully covered
+func (c Coverage) Percent() float64 {
+	total := c.Recognized + c.Unknown
+	if total == 0 {
+		return 100
+	}
+	return math.Round(float64(c.Recognized)*1000/float64(total)) / 10
+}
+
+// UnknownList returns the unrecognized emoji, sorted
+func (c Coverage) UnknownList() []string {
+	list := make([]string, 0, len(c.UnknownEmoji))
+	for emoji := range c.UnknownEmoji {
+		list = append(list, emoji)
+	}
+	sort.Strings(list)
+	return list
+}
+
+// knownEmoji is every emoji the plain emoji syntax maps
+var knownEmoji = func() map[string]bool {
+	m := map[string]bool{}
+	for _, entry := range paletteTable {
+		m[entry.emoji] = true
+	}
+	for emoji := range emojiKeywords {
+		m[emoji] = true
+	}
+	return m
+}()
+
+// MeasureCoverage scans plain emoji syntax for emoji outside strings and
+// comments, after shortcodes and variants are canonicalized
+func MeasureCoverage(code string) Coverage {
+	var coverage Coverage
+	runes := []rune(CanonicalizeEmoji(code))
+	for i := 0; i < len(runes); i++ {
+		r := runes[i]
+		switch {
+		case r == '/' && i+1 < len(runes) && runes[i+1] == '/':
+			for i+1 < len(runes) && runes[i+1] != '\n' {
+				i++
+			}
+		case r == '/' && i+1 < len(runes) && runes[i+1] == '*':
+			end := indexFrom(runes, i+2, "*/")
+			if end < 0 {
+				end = len(runes) - 2
+			}
+			i = end + 1
+		case r == '"' || r == '\'' || r == '`':
+			i = closeQuote(runes, i, r)
+		case isEmojiBase(r):
+			end := emojiEnd(runes, i)
+			emoji := string(runes[i:end])
+			i = end - 1
+			if knownEmoji[emoji] {
+				coverage.Recognized++
+				continue
+			}
+			coverage.Unknown++
+			if coverage.UnknownEmoji == nil {
+				coverage.UnknownEmoji = map[string]int{}
+			}
+			coverage.UnknownEmoji[emoji]++
+		}
+	}
+	return coverage
+}
+
+// isEmojiBase reports whether r starts an emoji: pictographs, dingbats,
+// miscellaneous symbols and arrows, and regional indicators
+func isEmojiBase(r rune) bool {
+	switch {
+	case r >= 0x1F000 && r <= 0x1FAFF:
+		return !isEmojiModifier(r)
+	case r >= 0x2600 && r <= 0x27BF, r >= 0x2300 && r <= 0x23FF, r >= 0x2B00 && r <= 0x2BFF:
+		return true
+	}
+	return false
+}
+
+func isEmojiModifier(r rune) bool {
+	return r >= 0x1F3FB && r <= 0x1F3FF
+}
+
+// emojiEnd returns the index just past the emoji starting at start,
+// taking in variation selectors, skin tones, keycaps, tag sequences,
+// flag pairs and zero-width-joined sequences
+func emojiEnd(runes []rune, start int) int {
+	i := start + 1
+	if isRegionalIndicator(runes[start]) && i < len(runes) && isRegionalIndicator(runes[i]) {
+		return i + 1
+	}
+	for i < len(runes) && continuesCluster(runes, i) {
+		if runes[i] == '\u200D' {
+			i++
+		}
+		i++
+	}
+	return i
+}
+
+// continuesCluster reports whether runes[i] extends the emoji before it
+// rather than starting something new: a variation selector, skin tone,
+// keycap or tag, or a zero-width joiner followed by another emoji
+func continuesCluster(runes []rune, i int) bool {
+	switch r := runes[i]; {
+	case r == variationSelectorText, r == variationSelectorEmoji, r == '\u20E3', isEmojiModifier(r):
+		return true
+	case r >= 0xE0020 && r <= 0xE007F:
+		return true
+	case r == '\u200D':
+		return i+1 < len(runes) && isEmojiBase(runes[i+1])
+	}
+	return false
+}
+
+func isRegionalIndicator(r rune) bool {
+	return r >= 0x1F1E6 && r <= 0x1F1FF
+}
@@ -0,0 +1,109 @@
+package transpiler
+
+// Severity is how serious a Diagnostic is
+type Severity string
+
+const (
+	SeverityError   Severity = "error"
+	SeverityWarning Severity = "warning"
+)
+
+// Diagnostic codes name each kind of problem, so editors and hints can
+// match on them instead of on message text
+const (
+	CodeUnterminatedComment  = "unterminated-comment"
+	CodeUnterminatedString   = "unterminated-string"
+	CodeUnterminatedTemplate = "unterminated-template"
+	CodeUnterminatedRegex    = "unterminated-regex"
+	CodeUnbalancedBracket    = "unbalanced-bracket"
+	// CodeMissingExpression is an operator without its operand, or an
+	// expression left out where the syntax needs one
+	CodeMissingExpression = "missing-expression"
+	// CodeInvalidAssignment is an assignment, ++ or -- to something that
+	// isn't a variable, a property or a pattern to destructure into
+	CodeInvalidAssignment = "invalid-assignment"
+	// CodeUnexpectedToken is a token where the syntax doesn't allow one
+	CodeUnexpectedToken = "unexpected-token"
+	// CodeMarkupSyntax is a tag that couldn't be parsed
+	CodeMarkupSyntax     = "markup-syntax"
+	CodeUnknownTag       = "unknown-tag"
+	CodeUnknownAttribute = "unknown-attribute"
+	CodeInvalidAttribute = "invalid-attribute"
+	// CodeMisplacedTag is a tag nested where the schema doesn't allow it
+	CodeMisplacedTag = "misplaced-tag"
+	// CodeInvalidTag is a tag whose contents can't be generated
+	CodeInvalidTag = "invalid-tag"
+	CodeIgnoredTag = "ignored-tag"
+	// CodeUndefinedVariable is a name the program reads that nothing in
+	// scope declares
+	CodeUndefinedVariable = "undefined-variable"
+	// CodeUnusedVariable is a variable, function, class or import that
+	// nothing reads
+	CodeUnusedVariable = "unused-variable"
+	// CodeRenamedIdentifier is a reserved word used as a name and renamed
+	CodeRenamedIdentifier = "renamed-identifier"
+	// CodeRedeclaredVariable is a let, const, class or import declared
+	// again in the same scope
+	CodeRedeclaredVariable = "redeclared-variable"
+	// CodeConstAssignment is an assignment to a const or an import
+	CodeConstAssignment = "const-assignment"
+	// CodeInvalidExpression is an expression ParseExpression can't read
+	CodeInvalidExpression = "invalid-expression"
+	// CodeMixedBlock is a bracket in the code between tags that a tag's
+	// body doesn't close, or that closes a block opened outside it
+	CodeMixedBlock = "mixed-block"
+	// CodeUnknownTarget is a target language that isn't one of the valid
+	// values, or one the server doesn't generate
+	CodeUnknownTarget = "unknown-target"
+	// CodeDetectedMarkup is code read as markup because it has markup
+	// tags, when the request didn't say which syntax it's in
+	CodeDetectedMarkup = "detected-markup"
+	// CodeOutputLimit is output longer than the limit, at the construct
+	// that generates most of it
+	CodeOutputLimit = "output-limit"
+	// CodeTooComplex is a program that would cost more to parse than the
+	// complexity budget, at the token that passed it
+	CodeTooComplex = "too-complex"
+	// CodeMissingModule is an import of a project file the project
+	// doesn't have
+	CodeMissingModule = "missing-module"
+	// CodeMissingExport is a name imported from a project file that the
+	// file doesn't export
+	CodeMissingExport = "missing-export"
+)
+
+// Diagnostic is a problem in source, positioned for an editor to mark.
+// Line and Column are 1-based, counting columns in runes, and Length is
+// how many runes it spans; all three are 0 when the problem has no
+// position.
+type Diagnostic struct {
+	Message  string   `json:"message"`
+	Severity Severity `json:"severity"`
+	Line     int      `json:"line"`
+	Column   int      `json:"column"`
+	Length   int      `json:"length"`
+	Code     string   `json:"code"`
+}
+
+// Diagnostic returns the error as an error-severity diagnostic. Its
+// message is the error's, without the position prefix.
+func (e *SyntaxError) Diagnostic() Diagnostic {
+	return Diagnostic{Message: e.Message, Severity: SeverityError, Line: e.Line, Column: e.Column, Length: max(e.Length, 1), Code: e.Code}
+}
+
+// DiagnoseEmoji returns the syntax errors in plain emoji syntax as
+// diagnostics; they are the errors CheckEmoji describes. Source without
+// syntax errors is checked scope by scope as well, with warnings about
+// undeclared, redeclared and unused names and assignments to constants.
+func DiagnoseEmoji(code string) []Diagnostic {
+	tokens, lexErrors := lexEmoji(code)
+	_, errs := parseEmojiTokens(tokens, lexErrors)
+	if len(errs) == 0 {
+		return analyzeEmoji(tokens)
+	}
+	diagnostics := make([]Diagnostic, len(errs))
+	for i, err := range errs {
+		diagnostics[i] = err.Diagnostic()
+	}
+	return diagnostics
+}
@@ -0,0 +1,50 @@
+package transpiler
+
+import "strings"
+
+// emojiKeywords maps keyword emoji to their JavaScript spelling for the
+// plain emoji syntax
+var emojiKeywords = map[string]string{
+	"📦": "const", "🔢": "let", "🎯": "function", "➡️": "=>", "🔁": "for", "❓": "if",
+	"❌": "else", "✅": "true", "⛔": "false", "🔙": "return", "📝": "console.log",
+	"➕": "+", "➖": "-", "✖️": "*", "➗": "/", "🍰": "%", "🔺": "**", "🟰": "===", "❗": "!==",
+	"⬆️": ">", "⬇️": "<", "📈": ">=", "📉": "<=", "🔗": "&&", "🔀": "||",
+	"🚫": "!", "📥": "import", "📤": "export", "🔄": "while", "⚡": "async",
+	"⏳": "await", "🎁": "new", "🗑️": "delete", "📊": "typeof", "🔍": "in",
+	"🎪": "switch", "🔘": "case", "🏁": "break", "⏭️": "continue", "💥": "throw",
+	"🛡️": "try", "🚨": "catch", "🏆": "finally", "🔐": "class", "🎨": "extends",
+	"🌟": "static", "🔧": "constructor", "🎭": "this", "📍": "null", "❔": "undefined",
+	"🛟": "??=", "⏰": "EmojiTime", "🎤": "EmojiInput",
+	"🧾": "JSON.stringify", "📂": "JSON.parse", "📖": "EmojiReadFile", "✍️": "EmojiWriteFile",
+	"🌐": "EmojiFetch",
+}
+
+// TranspileEmoji converts plain emoji syntax to the target language,
+// generating it from the parsed program. It is lenient: source with
+// syntax errors (see CheckEmoji) still converts, as far as it goes.
+func TranspileEmoji(code, targetLang string) string {
+	program, _ := ParseEmoji(code)
+	return program.Generate(targetLang)
+}
+
+// ReplaceKeywordEmoji replaces the keyword emoji of the plain syntax in
+// canonical source (see CanonicalizeEmoji) with their JavaScript
+// spelling. Emoji in strings, comments and regular expressions are left
+// alone.
+func ReplaceKeywordEmoji(code string) string {
+	program, _ := ParseEmoji(code)
+	var b strings.Builder
+	generate(&b, program.Children)
+	return b.String()
+}
+
+// CheckEmoji returns the syntax errors in plain emoji syntax, positioned
+// in code as written
+func CheckEmoji(code string) []string {
+	_, errs := ParseEmoji(code)
+	messages := make([]string, len(errs))
+	for i, err := range errs {
+		messages[i] = err.Error()
+	}
+	return messages
+}
@@ -0,0 +1,80 @@
+package transpiler
+
+import (
+	"strings"
+	"testing"
+
+	"emojiscript-backend/pkg/golden"
+)
+
+// benchSize is about how many bytes of source each benchmark reads
+const benchSize = 64 << 10
+
+// benchInput repeats the corpus's emoji programs, canonicalized and with
+// records, switch expressions and getters expanded as they are before
+// substitution, until they fill about size bytes
+func benchInput(size int) string {
+	var programs []string
+	for _, fixture := range golden.Fixtures("", "emoji") {
+		code := ExpandRecords(CanonicalizeEmoji(fixture.Input), "javascript")
+		programs = append(programs, ExpandGetters(ExpandSwitchExpressions(code, "javascript")))
+	}
+	corpus := strings.Join(programs, "\n") + "\n"
+	return strings.Repeat(corpus, max(size/len(corpus), 1))
+}
+
+// replaceAll substitutes the keyword emoji with one ReplaceAll pass per
+// emoji, as the transpiler did before it had a lexer
+func replaceAll(code string) string {
+	for _, entry := range paletteTable {
+		code = strings.ReplaceAll(code, entry.emoji, entry.keyword)
+	}
+	return code
+}
+
+// TestSubstitutionsAgree checks that the benchmarks compare like with
+// like: the corpus has no emoji in strings or comments, which only the
+// lexer leaves alone
+func TestSubstitutionsAgree(t *testing.T) {
+	input := benchInput(benchSize)
+	if replaceAll(input) != ReplaceKeywordEmoji(input) {
+		t.Fatal("ReplaceAll and the lexer substitute the benchmark input differently")
+	}
+}
+
+func benchmarkSubstitution(b *testing.B, replace func(string) string) {
+	input := benchInput(benchSize)
+	b.SetBytes(int64(len(input)))
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		replace(input)
+	}
+}
+
+// BenchmarkReplaceAll is the baseline: a full pass over the source for
+// each keyword emoji
+func BenchmarkReplaceAll(b *testing.B) {
+	benchmarkSubstitution(b, replaceAll)
+}
+
+// BenchmarkReplaceKeywordEmoji lexes and parses the source once
+func BenchmarkReplaceKeywordEmoji(b *testing.B) {
+	benchmarkSubstitution(b, ReplaceKeywordEmoji)
+}
+
+// BenchmarkClusterReplacer matches every emoji in one scan, as dialect
+// aliases and markup are substituted
+func BenchmarkClusterReplacer(b *testing.B) {
+	pairs := map[string]string{}
+	for _, entry := range paletteTable {
+		pairs[entry.emoji] = entry.keyword
+	}
+	benchmarkSubstitution(b, emojiReplacer(pairs).Replace)
+}
+
+func BenchmarkTranspileEmoji(b *testing.B) {
+	benchmarkSubstitution(b, func(code string) string {
+		return TranspileEmoji(code, "javascript")
+	})
+}
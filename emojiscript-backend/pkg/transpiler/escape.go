@@ -0,0 +1,55 @@
+package transpiler
+
+import (
+	"fmt"
+	"strings"
+	"unicode/utf8"
+)
+
+// escapeString escapes s for the body of a string literal of the target
+// language delimited by quote. Backslashes, the quote and control
+// characters are escaped in every target; JavaScript and TypeScript also
+// escape U+2028 and U+2029, which end a line inside older engines'
+// literals. Other unicode is written as it is, and invalid UTF-8 becomes
+// U+FFFD.
+func escapeString(s string, quote rune, targetLang string) string {
+	b := &strings.Builder{}
+	for len(s) > 0 {
+		r, size := utf8.DecodeRuneInString(s)
+		s = s[size:]
+		switch {
+		case r == '\\' || r == quote:
+			b.WriteByte('\\')
+			b.WriteRune(r)
+		case r == '\n':
+			b.WriteString(`\n`)
+		case r == '\r':
+			b.WriteString(`\r`)
+		case r == '\t':
+			b.WriteString(`\t`)
+		case r < 0x20 || r == 0x7f:
+			fmt.Fprintf(b, `\x%02x`, r)
+		case (r == '\u2028' || r == '\u2029') && isJavaScriptTarget(targetLang):
+			fmt.Fprintf(b, `\u%04x`, r)
+		default:
+			b.WriteRune(r)
+		}
+	}
+	return b.String()
+}
+
+// quoteString returns s as a double-quoted string literal of the target
+// language
+func quoteString(s, targetLang string) string {
+	return `"` + escapeString(s, '"', targetLang) + `"`
+}
+
+// isJavaScriptTarget reports whether targetLang is JavaScript or one of
+// its dialects
+func isJavaScriptTarget(targetLang string) bool {
+	switch targetLang {
+	case "javascript", "typescript", "es5", "":
+		return true
+	}
+	return false
+}
@@ -0,0 +1,95 @@
+package transpiler
+
+import (
+	"strings"
+	"testing"
+
+	"emojiscript-backend/pkg/sandbox"
+)
+
+func TestEscapeString(t *testing.T) {
+	tests := []struct {
+		name   string
+		s      string
+		quote  rune
+		target string
+		want   string
+	}{
+		{"plain", "hello", '"', "javascript", `hello`},
+		{"double quotes", `She said "hi"`, '"', "javascript", `She said \"hi\"`},
+		{"other quote left alone", `it's "fine"`, '"', "javascript", `it's \"fine\"`},
+		{"single quotes", `it's "fine"`, '\'', "javascript", `it\'s "fine"`},
+		{"backslashes", `C:\temp\new`, '"', "javascript", `C:\\temp\\new`},
+		{"escaped quote", `\"`, '"', "javascript", `\\\"`},
+		{"newline", "a\nb", '"', "javascript", `a\nb`},
+		{"carriage return and tab", "a\r\tb", '"', "typescript", `a\r\tb`},
+		{"control characters", "a\x00b\x1bc\x7f", '"', "javascript", `a\x00b\x1bc\x7f`},
+		{"line separators in javascript", "a\u2028b\u2029c", '"', "javascript", `a\u2028b\u2029c`},
+		{"line separators in es5", "a\u2028b", '"', "es5", `a\u2028b`},
+		{"line separators elsewhere", "a\u2028b", '"', "python", "a\u2028b"},
+		{"unicode", "héllo 👋 wörld 日本", '"', "javascript", "héllo 👋 wörld 日本"},
+		{"emoji sequence", "👩🏽‍💻", '"', "javascript", "👩🏽‍💻"},
+		{"invalid utf-8", "a\xffb", '"', "javascript", "a\uFFFDb"},
+		{"empty", "", '"', "javascript", ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := escapeString(tt.s, tt.quote, tt.target); got != tt.want {
+				t.Errorf("escapeString(%q, %q, %s) = %q, want %q", tt.s, tt.quote, tt.target, got, tt.want)
+			}
+		})
+	}
+}
+
+// TestQuoteStringRoundTrip runs each quoted string in the sandbox, which
+// has to print it back as it was
+func TestQuoteStringRoundTrip(t *testing.T) {
+	for _, s := range []string{
+		`She said "hi"`,
+		`C:\temp\new`,
+		"tab\there",
+		"two\nlines",
+		"bell\x07 and escape\x1b",
+		"separators \u2028 and \u2029",
+		"héllo 👋 wörld",
+		`\"\\"`,
+	} {
+		result := sandbox.Run("console.log("+quoteString(s, "javascript")+")", sandbox.Options{})
+		if result.Error != "" {
+			t.Errorf("%q: %s", s, result.Error)
+			continue
+		}
+		if got := strings.Join(result.Stdout, "\n"); got != s {
+			t.Errorf("%s printed %q, want %q", quoteString(s, "javascript"), got, s)
+		}
+	}
+}
+
+// TestMarkupTextEscaping checks the markup attributes that write their
+// text as a string literal
+func TestMarkupTextEscaping(t *testing.T) {
+	tests := []struct {
+		name   string
+		target string
+		input  string
+		want   string
+	}{
+		{"print text", "javascript", `<print text="She said \"hi\" to C:\\temp"/>`, `console.log("She said \"hi\" to C:\\temp");`},
+		{"print text over lines", "javascript", "<print text=\"one\ntwo\"/>", `console.log("one\ntwo");`},
+		{"const text", "typescript", "<const name=\"greeting\" type=\"string\" text=\"héllo 👋\"/>", `const greeting: string = "héllo 👋";`},
+		{"let text", "javascript", "<let name=\"tab\" text=\"a\tb\"/>", `let tab = "a\tb";`},
+		{"line separator", "javascript", "<print text=\"a\u2028b\"/>", `console.log("a\u2028b");`},
+		{"read file path", "javascript", `<readfile var="data" path="C:\\data\\in.txt"/>`, `EmojiReadFile("C:\\data\\in.txt")`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result, err := New(Options{TargetLanguage: tt.target}).TranspileMarkup(tt.input, MarkupOptions{})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !strings.Contains(result.Output, tt.want) {
+				t.Errorf("got\n%s\nwant it to contain\n%s", result.Output, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,149 @@
+package transpiler
+
+import (
+	"sort"
+	"strings"
+	"unicode/utf8"
+)
+
+// FormatOptions controls how Format canonicalizes source
+type FormatOptions struct {
+	// Aliases maps alternate emoji (for example from an alias pack) to the
+	// canonical emoji of the active dialect
+	Aliases map[string]string
+	// Layout re-indents the source and spaces out its operators as well
+	// (see layout)
+	Layout bool
+	// Markup lays the source out as markup rather than emoji syntax
+	Markup bool
+}
+
+// Format rewrites emoji source into its canonical spelling: shortcodes and
+// alias emoji become the dialect's emoji, variant-selector forms are
+// normalized, line endings become LF and trailing whitespace is dropped.
+// With Layout, lines are also indented two spaces per level of nesting,
+// binary operator emoji get one space on each side and markup tags are
+// written canonically. Everything else is left as written so diffs stay
+// minimal, and the program means what it did: in emoji syntax, the emoji
+// in strings, templates and comments are left byte for byte.
+func Format(code string, opts FormatOptions) string {
+	code = NormalizeNewlines(code)
+	if opts.Markup {
+		code = expandMarkupShortcodes(code)
+	} else {
+		code = ExpandShortcodes(code)
+	}
+	if opts.Layout {
+		// laid out before aliasing, while the keywords are the base
+		// syntax's emoji the lexer knows
+		code = layout(formatEmoji(code, opts.Markup, NormalizeVariants), opts.Markup)
+	}
+	replacer := emojiReplacer(opts.Aliases)
+	code = formatEmoji(code, opts.Markup, func(emoji string) string {
+		emoji = NormalizeVariants(emoji)
+		if replacer != nil {
+			emoji = NormalizeVariants(replacer.Replace(emoji))
+		}
+		return emoji
+	})
+
+	lines := strings.Split(code, "\n")
+	for i, line := range lines {
+		lines[i] = strings.TrimRight(line, " \t")
+	}
+	return strings.Join(lines, "\n")
+}
+
+// formatEmoji rewrites the emoji of code with rewrite: in emoji syntax
+// those the lexer reads as code (see rewriteEmoji), in markup, whose
+// parser converts emoji wherever they are, all of them
+func formatEmoji(code string, markup bool, rewrite func(string) string) string {
+	if markup {
+		return rewrite(code)
+	}
+	return rewriteEmoji(code, rewrite)
+}
+
+// ApplyAliases replaces alias emoji in emoji syntax in a single pass,
+// preferring the longest alias so multi-code-point aliases aren't split
+// by shorter ones. Emoji in strings, templates and comments are left as
+// written.
+func ApplyAliases(code string, aliases map[string]string) string {
+	replacer := emojiReplacer(aliases)
+	if replacer == nil {
+		return code
+	}
+	return rewriteEmoji(code, func(emoji string) string {
+		return replacer.Replace(NormalizeVariants(emoji))
+	})
+}
+
+// emojiReplacer compiles emoji -> text pairs into a replacer that rewrites
+// a source in a single scan, or returns nil when there are no pairs
+func emojiReplacer(pairs map[string]string) *clusterReplacer {
+	if len(pairs) == 0 {
+		return nil
+	}
+	r := &clusterReplacer{pairs: map[string]string{}, byFirst: map[rune][]string{}}
+	for alias, canonical := range pairs {
+		alias = NormalizeVariants(alias)
+		if alias == "" {
+			continue
+		}
+		r.pairs[alias] = canonical
+		first, _ := utf8.DecodeRuneInString(alias)
+		r.byFirst[first] = append(r.byFirst[first], alias)
+	}
+	for _, keys := range r.byFirst {
+		sort.Slice(keys, func(i, j int) bool {
+			if len(keys[i]) != len(keys[j]) {
+				return len(keys[i]) > len(keys[j])
+			}
+			return keys[i] < keys[j]
+		})
+	}
+	return r
+}
+
+// clusterReplacer replaces emoji a whole grapheme cluster at a time,
+// preferring the longest match at each position: an alias for 👨 leaves
+// the 👨 in 👨‍💻 alone, as it does a tone-modified 👍🏽 when only 👍 is
+// mapped. It is safe for concurrent use.
+type clusterReplacer struct {
+	pairs map[string]string
+	// byFirst lists the pairs' emoji by first rune, longest first
+	byFirst map[rune][]string
+}
+
+// Replace rewrites the pairs' emoji in s
+func (r *clusterReplacer) Replace(s string) string {
+	runes := []rune(s)
+	offsets := make([]int, 0, len(runes))
+	for at := range s {
+		offsets = append(offsets, at)
+	}
+	b := &strings.Builder{}
+	for i := 0; i < len(runes); {
+		end := -1
+		for _, alias := range r.byFirst[runes[i]] {
+			if !strings.HasPrefix(s[offsets[i]:], alias) {
+				continue
+			}
+			if end = i + utf8.RuneCountInString(alias); end < len(runes) && continuesCluster(runes, end) {
+				end = -1
+				continue
+			}
+			b.WriteString(r.pairs[alias])
+			break
+		}
+		if end < 0 {
+			end = i + 1
+			if isEmojiBase(runes[i]) {
+				end = emojiEnd(runes, i)
+			}
+			b.WriteString(string(runes[i:end]))
+		}
+		i = end
+	}
+	return b.String()
+}
@@ -0,0 +1,21 @@
+package transpiler
+
+import "testing"
+
+// TestFormatKeepsStringsAndComments checks that Format rewrites the
+// keyword emoji of a dialect and their variant spellings only where
+// they're code, leaving strings, templates and comments byte for byte
+func TestFormatKeepsStringsAndComments(t *testing.T) {
+	opts := FormatOptions{Aliases: map[string]string{"📝": "🐍"}, Layout: true}
+	for _, tt := range []struct {
+		code, want string
+	}{
+		{`📝("✖ in string 📝") // ✖ 📝 comment`, `🐍("✖ in string 📝") // ✖ 📝 comment`},
+		{"📦 x = 2 ✖ 3 /* ✖ 📝 */\n📝(`📝 ${x ✖ 2}`)", "📦 x = 2 ✖️ 3 /* ✖ 📝 */\n🐍(`📝 ${x ✖️ 2}`)"},
+		{`📝(":package: ✖") // :package:`, `🐍(":package: ✖") // :package:`},
+	} {
+		if got := Format(tt.code, opts); got != tt.want {
+			t.Errorf("Format(%q) = %q, want %q", tt.code, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,33 @@
+package transpiler
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+var (
+	// getterBlockPattern matches the block getter form: 🎭.fullName 🧲 {
+	getterBlockPattern = regexp.MustCompile(`^(\s*)🎭\.([A-Za-z_$][A-Za-z0-9_$]*)\s*🧲\s*\{(.*)$`)
+	// getterExprPattern matches the shorthand form: 🎭.fullName 🧲 expression
+	getterExprPattern = regexp.MustCompile(`^(\s*)🎭\.([A-Za-z_$][A-Za-z0-9_$]*)\s*🧲\s*([^{].*?);?\s*$`)
+)
+
+// ExpandGetters rewrites the 🧲 getter sugar used inside class bodies into
+// `get name() { ... }` accessors. The shorthand form wraps the expression
+// in a return statement.
+func ExpandGetters(code string) string {
+	if !strings.Contains(code, "🧲") {
+		return code
+	}
+
+	lines := strings.Split(code, "\n")
+	for i, line := range lines {
+		if m := getterBlockPattern.FindStringSubmatch(line); m != nil {
+			lines[i] = fmt.Sprintf("%sget %s() {%s", m[1], m[2], m[3])
+		} else if m := getterExprPattern.FindStringSubmatch(line); m != nil {
+			lines[i] = fmt.Sprintf("%sget %s() { 🔙 %s; }", m[1], m[2], m[3])
+		}
+	}
+	return strings.Join(lines, "\n")
+}
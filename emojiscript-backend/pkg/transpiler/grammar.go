@@ -0,0 +1,243 @@
+package transpiler
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// Grammar is the language grammar generated from the transpiler's own
+// tables, for highlighters and other external tooling
+type Grammar struct {
+	Version string `json:"version"`
+	// EmojiTokens are the keyword emoji of the plain emoji syntax
+	EmojiTokens []GrammarToken `json:"emojiTokens"`
+	// MarkupEmoji are the emoji accepted inside markup
+	MarkupEmoji []GrammarToken `json:"markupEmoji"`
+	MarkupTags  []GrammarTag   `json:"markupTags"`
+	// Operators lists the operator emoji from tightest to loosest binding
+	Operators []GrammarOperator `json:"operators"`
+}
+
+// GrammarToken is an emoji and the keyword it stands for
+type GrammarToken struct {
+	Emoji    string `json:"emoji"`
+	Keyword  string `json:"keyword"`
+	Category string `json:"category,omitempty"`
+	// Variants are the spellings accepted for the emoji
+	Variants []string `json:"variants"`
+}
+
+// GrammarTag is a markup tag with its aliases and attributes
+type GrammarTag struct {
+	Name       string             `json:"name"`
+	Aliases    []string           `json:"aliases,omitempty"`
+	Attributes []GrammarAttribute `json:"attributes"`
+	// Content is "block" (statements), "expression", "text" or "none"
+	Content string `json:"content"`
+	// OneOf lists sets of attributes of which the tag needs one complete
+	// set, e.g. a loop's in, times, or from and to
+	OneOf [][]string `json:"oneOf,omitempty"`
+	// Parents are the tags the tag may only appear directly inside
+	Parents []string `json:"parents,omitempty"`
+	// Within are the tags one of which must enclose the tag at some depth
+	Within []string `json:"within,omitempty"`
+	// Follows are the tags the tag must come right after, continuing
+	// their statement, as <else> follows <if>
+	Follows []string `json:"follows,omitempty"`
+}
+
+// GrammarAttribute is an attribute a markup tag reads
+type GrammarAttribute struct {
+	Name     string `json:"name"`
+	Required bool   `json:"required"`
+	// Type is "identifier", "expression", "type", "boolean", "keyword"
+	// (one of Values) or "text"
+	Type   string   `json:"type"`
+	Values []string `json:"values,omitempty"`
+}
+
+// GrammarOperator is an operator emoji with its binding
+type GrammarOperator struct {
+	Emoji         string `json:"emoji"`
+	Keyword       string `json:"keyword"`
+	Precedence    int    `json:"precedence"`
+	Associativity string `json:"associativity"`
+	Unary         bool   `json:"unary,omitempty"`
+}
+
+// BuildGrammar assembles the grammar from the palette, the markup tag
+// table and the operator bindings
+func BuildGrammar() Grammar {
+	grammar := Grammar{Version: Version}
+	for _, entry := range paletteTable {
+		grammar.EmojiTokens = append(grammar.EmojiTokens, GrammarToken{Emoji: entry.emoji, Keyword: entry.keyword, Category: entry.category, Variants: variants(entry.emoji)})
+		if operator, ok := grammarOperator(entry.emoji, entry.keyword); ok {
+			grammar.Operators = append(grammar.Operators, operator)
+		}
+	}
+	for _, compound := range compoundOperators {
+		if operator, ok := grammarOperator(compound.emoji, compound.keyword); ok {
+			grammar.Operators = append(grammar.Operators, operator)
+		}
+	}
+	sort.SliceStable(grammar.Operators, func(i, j int) bool {
+		return grammar.Operators[i].Precedence > grammar.Operators[j].Precedence
+	})
+
+	for emoji, keyword := range markupEmoji {
+		grammar.MarkupEmoji = append(grammar.MarkupEmoji, GrammarToken{Emoji: emoji, Keyword: keyword, Variants: variants(emoji)})
+	}
+	sort.Slice(grammar.MarkupEmoji, func(i, j int) bool {
+		return grammar.MarkupEmoji[i].Keyword < grammar.MarkupEmoji[j].Keyword
+	})
+
+	for _, spec := range markupTags {
+		tag := GrammarTag{Name: spec.names[0], Aliases: spec.names[1:], Attributes: []GrammarAttribute{}, Content: spec.content, OneOf: markupAttributeGroups[spec.names[0]], Parents: markupParents[spec.names[0]], Within: markupAncestors[spec.names[0]], Follows: markupFollows[spec.names[0]]}
+		for _, attribute := range spec.attributes {
+			values := attribute.values
+			if attribute.kind == attrBoolean {
+				values = []string{"true", "false"}
+			}
+			tag.Attributes = append(tag.Attributes, GrammarAttribute{Name: attribute.name, Required: attribute.required, Type: attribute.kind, Values: values})
+		}
+		grammar.MarkupTags = append(grammar.MarkupTags, tag)
+	}
+	return grammar
+}
+
+// grammarOperator describes an operator emoji's binding from the
+// precedence table; ok is false for emoji that aren't operators
+func grammarOperator(emoji, keyword string) (GrammarOperator, bool) {
+	if keyword == "++" || keyword == "--" {
+		return GrammarOperator{Emoji: emoji, Keyword: keyword, Precedence: postfixPrecedence, Associativity: "left", Unary: true}, true
+	}
+	binding, ok := operatorBindings[keyword]
+	if !ok {
+		return GrammarOperator{}, false
+	}
+	operator := GrammarOperator{Emoji: emoji, Keyword: keyword, Precedence: binding.precedence, Associativity: "left", Unary: binding.unary}
+	if binding.right {
+		operator.Associativity = "right"
+	}
+	return operator, true
+}
+
+// EBNF renders the grammar in ISO 14977 EBNF. Productions for the host
+// language (expression, statement, ...) are JavaScript's and left
+// undefined.
+func (g Grammar) EBNF() string {
+	b := &strings.Builder{}
+	fmt.Fprintf(b, "(* EmojiScript %s grammar, generated from the transpiler tables *)\n\n", g.Version)
+
+	b.WriteString("program = { emoji-line | markup-element } ;\n\n")
+
+	b.WriteString("(* Plain emoji syntax: keyword emoji stand in for JavaScript tokens *)\n")
+	b.WriteString("emoji-line = { emoji-keyword | javascript-token } , newline ;\n")
+	var categories []string
+	byCategory := map[string][]GrammarToken{}
+	for _, token := range g.EmojiTokens {
+		if _, seen := byCategory[token.Category]; !seen {
+			categories = append(categories, token.Category)
+		}
+		byCategory[token.Category] = append(byCategory[token.Category], token)
+	}
+	names := make([]string, len(categories))
+	for i, category := range categories {
+		names[i] = ebnfName(category) + "-emoji"
+	}
+	fmt.Fprintf(b, "emoji-keyword = %s ;\n", strings.Join(names, " | "))
+	for i, category := range categories {
+		fmt.Fprintf(b, "%s = %s ;\n", names[i], ebnfTokens(byCategory[category]))
+	}
+
+	b.WriteString("\n(* Operators, tightest binding first *)\n")
+	var levels []int
+	byLevel := map[int][]GrammarOperator{}
+	for _, operator := range g.Operators {
+		if _, seen := byLevel[operator.Precedence]; !seen {
+			levels = append(levels, operator.Precedence)
+		}
+		byLevel[operator.Precedence] = append(byLevel[operator.Precedence], operator)
+	}
+	for _, level := range levels {
+		operators := byLevel[level]
+		alternatives := make([]string, len(operators))
+		for i, operator := range operators {
+			alternatives[i] = fmt.Sprintf("\"%s\" (* %s *)", operator.Emoji, operator.Keyword)
+		}
+		fmt.Fprintf(b, "operator-%d = %s ; (* %s-associative *)\n", level, strings.Join(alternatives, " | "), operators[0].Associativity)
+	}
+
+	b.WriteString("\n(* Markup syntax *)\n")
+	names = make([]string, len(g.MarkupTags))
+	for i, tag := range g.MarkupTags {
+		names[i] = ebnfName(tag.Name) + "-element"
+	}
+	fmt.Fprintf(b, "markup-element = %s | plugin-element ;\n", strings.Join(names, " | "))
+	for i, tag := range g.MarkupTags {
+		tagNames := make([]string, 0, len(tag.Aliases)+1)
+		for _, name := range append([]string{tag.Name}, tag.Aliases...) {
+			tagNames = append(tagNames, fmt.Sprintf("\"%s\"", name))
+		}
+		attributes := ""
+		if len(tag.Attributes) > 0 {
+			attributes = fmt.Sprintf(" , { %s-attribute }", ebnfName(tag.Name))
+		}
+		body := "markup-body"
+		switch tag.Content {
+		case "expression":
+			body = "expression"
+		case "text":
+			body = "text"
+		}
+		if tag.Content == "none" {
+			fmt.Fprintf(b, "%s = \"<\" , ( %s )%s , ( \"/>\" | \">\" , [ \"</\" , tag-name , \">\" ] ) ;\n", names[i], strings.Join(tagNames, " | "), attributes)
+		} else {
+			fmt.Fprintf(b, "%s = \"<\" , ( %s )%s , ( \"/>\" | \">\" , [ %s ] , \"</\" , tag-name , \">\" ) ;\n", names[i], strings.Join(tagNames, " | "), attributes, body)
+		}
+		if len(tag.Attributes) > 0 {
+			alternatives := make([]string, len(tag.Attributes))
+			var required []string
+			for j, attribute := range tag.Attributes {
+				alternatives[j] = fmt.Sprintf("\"%s\"", attribute.Name)
+				if attribute.Required {
+					required = append(required, attribute.Name)
+				}
+			}
+			fmt.Fprintf(b, "%s-attribute = ( %s ) , [ \"=\" , attribute-value ] ;", ebnfName(tag.Name), strings.Join(alternatives, " | "))
+			if len(required) > 0 {
+				fmt.Fprintf(b, " (* required: %s *)", strings.Join(required, ", "))
+			}
+			if len(tag.OneOf) > 0 {
+				groups := make([]string, len(tag.OneOf))
+				for j, group := range tag.OneOf {
+					groups[j] = strings.Join(group, " and ")
+				}
+				fmt.Fprintf(b, " (* needs one of: %s *)", strings.Join(groups, "; "))
+			}
+			b.WriteString("\n")
+		}
+	}
+	b.WriteString("markup-body = { markup-element | statement } ;\n")
+	b.WriteString("plugin-element = \"<\" , namespace , \":\" , tag-name , { tag-name , [ \"=\" , attribute-value ] } , ( \"/>\" | \">\" , [ markup-body ] , \"</\" , namespace , \":\" , tag-name , \">\" ) ; (* handled by the plugin registered for the namespace *)\n")
+	b.WriteString("namespace = tag-name ;\n")
+	b.WriteString("attribute-value = '\"' , { character - '\"' } , '\"' | \"'\" , { character - \"'\" } , \"'\" | { character - ( \">\" | whitespace ) } ;\n")
+	b.WriteString("tag-name = letter , { letter | digit | \"-\" | \"_\" } ;\n")
+	fmt.Fprintf(b, "markup-emoji = %s ;\n", ebnfTokens(g.MarkupEmoji))
+	return b.String()
+}
+
+// ebnfName turns a category or tag name into a production name
+func ebnfName(name string) string {
+	return strings.ReplaceAll(name, "_", "-")
+}
+
+// ebnfTokens renders tokens as alternatives, annotated with their keywords
+func ebnfTokens(tokens []GrammarToken) string {
+	alternatives := make([]string, len(tokens))
+	for i, token := range tokens {
+		alternatives[i] = fmt.Sprintf("\"%s\" (* %s *)", token.Emoji, token.Keyword)
+	}
+	return strings.Join(alternatives, " | ")
+}
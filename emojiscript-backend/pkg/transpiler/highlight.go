@@ -0,0 +1,260 @@
+package transpiler
+
+import (
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// ScopeName is the TextMate scope of EmojiScript sources
+const ScopeName = "source.emojiscript"
+
+// TextMateGrammar is a tmLanguage grammar, as loaded by VS Code and other
+// TextMate-compatible editors
+type TextMateGrammar struct {
+	Name       string                     `json:"name"`
+	ScopeName  string                     `json:"scopeName"`
+	FileTypes  []string                   `json:"fileTypes"`
+	Version    string                     `json:"version"`
+	Patterns   []TextMatePattern          `json:"patterns"`
+	Repository map[string]TextMatePattern `json:"repository"`
+}
+
+// TextMatePattern is a single match or begin/end rule
+type TextMatePattern struct {
+	Name          string                     `json:"name,omitempty"`
+	Match         string                     `json:"match,omitempty"`
+	Begin         string                     `json:"begin,omitempty"`
+	End           string                     `json:"end,omitempty"`
+	Include       string                     `json:"include,omitempty"`
+	Captures      map[string]TextMatePattern `json:"captures,omitempty"`
+	BeginCaptures map[string]TextMatePattern `json:"beginCaptures,omitempty"`
+	EndCaptures   map[string]TextMatePattern `json:"endCaptures,omitempty"`
+	Patterns      []TextMatePattern          `json:"patterns,omitempty"`
+}
+
+// MonarchLanguage is a Monaco editor Monarch definition, ready for
+// monaco.languages.setMonarchTokensProvider. Rules are [regex, action]
+// or [regex, action, next state] arrays.
+type MonarchLanguage struct {
+	TokenPostfix string                     `json:"tokenPostfix"`
+	Unicode      bool                       `json:"unicode"`
+	Version      string                     `json:"version"`
+	Tokenizer    map[string][][]interface{} `json:"tokenizer"`
+}
+
+// tokenClass is how a group of keyword emoji is highlighted
+type tokenClass struct {
+	// scope is the TextMate scope, without the language suffix
+	scope string
+	// token is the Monarch token
+	token string
+}
+
+// classify picks the highlighting for a keyword emoji
+func classify(token GrammarToken) tokenClass {
+	switch token.Keyword {
+	case "true", "false", "null", "undefined":
+		return tokenClass{"constant.language", "keyword"}
+	case "this":
+		return tokenClass{"variable.language", "keyword"}
+	}
+	switch token.Category {
+	case "control_flow":
+		return tokenClass{"keyword.control", "keyword"}
+	case "operators":
+		return tokenClass{"keyword.operator", "operator"}
+	case "functions":
+		return tokenClass{"storage.type.function", "keyword"}
+	case "io":
+		return tokenClass{"support.function", "predefined"}
+	case "data_structures":
+		return tokenClass{"storage.type.class", "keyword"}
+	}
+	return tokenClass{"storage.type", "keyword"}
+}
+
+// emojiGroup is the alternation matching every spelling of the emoji in
+// one token class
+type emojiGroup struct {
+	class   tokenClass
+	pattern string
+}
+
+// emojiGroups groups the keyword emoji, then the markup-only emoji, by
+// token class in a stable order
+func (g Grammar) emojiGroups() []emojiGroup {
+	var classes []tokenClass
+	spellings := map[tokenClass][]string{}
+	seen := map[string]bool{}
+	add := func(class tokenClass, token GrammarToken) {
+		if seen[token.Emoji] {
+			return
+		}
+		seen[token.Emoji] = true
+		if _, ok := spellings[class]; !ok {
+			classes = append(classes, class)
+		}
+		spellings[class] = append(spellings[class], token.Variants...)
+	}
+	for _, token := range g.EmojiTokens {
+		add(classify(token), token)
+	}
+	for _, token := range g.MarkupEmoji {
+		add(tokenClass{"storage.type", "keyword"}, token)
+	}
+
+	groups := make([]emojiGroup, 0, len(classes))
+	for _, class := range classes {
+		groups = append(groups, emojiGroup{class, alternation(spellings[class])})
+	}
+	return groups
+}
+
+// alternation builds a regular expression matching any of words, longest
+// first so a variation selector isn't left behind
+func alternation(words []string) string {
+	sorted := append([]string(nil), words...)
+	sort.SliceStable(sorted, func(i, j int) bool { return len(sorted[i]) > len(sorted[j]) })
+	quoted := make([]string, len(sorted))
+	for i, word := range sorted {
+		quoted[i] = regexp.QuoteMeta(word)
+	}
+	return "(?:" + strings.Join(quoted, "|") + ")"
+}
+
+// tagNames lists every markup tag name and alias
+func (g Grammar) tagNames() []string {
+	var names []string
+	for _, tag := range g.MarkupTags {
+		names = append(names, tag.Name)
+		names = append(names, tag.Aliases...)
+	}
+	return names
+}
+
+// attributeNames lists the distinct markup attribute names
+func (g Grammar) attributeNames() []string {
+	var names []string
+	seen := map[string]bool{}
+	for _, tag := range g.MarkupTags {
+		for _, attribute := range tag.Attributes {
+			if !seen[attribute.Name] {
+				seen[attribute.Name] = true
+				names = append(names, attribute.Name)
+			}
+		}
+	}
+	return names
+}
+
+const (
+	numberPattern       = `\b\d+(?:\.\d+)?\b`
+	doubleQuotedPattern = `"(?:[^"\\]|\\.)*"`
+	singleQuotedPattern = `'(?:[^'\\]|\\.)*'`
+)
+
+// TextMate renders the grammar as a tmLanguage definition
+func (g Grammar) TextMate() TextMateGrammar {
+	suffix := ".emojiscript"
+	scoped := func(name string) map[string]TextMatePattern {
+		return map[string]TextMatePattern{"1": {Name: name + suffix}}
+	}
+
+	var emoji []TextMatePattern
+	for _, group := range g.emojiGroups() {
+		emoji = append(emoji, TextMatePattern{Name: group.class.scope + suffix, Match: group.pattern})
+	}
+
+	tagName := `(</?)(` + strings.Join(g.tagNames(), "|") + `)\b`
+	return TextMateGrammar{
+		Name:      "EmojiScript",
+		ScopeName: ScopeName,
+		FileTypes: []string{"emoji", "emojiscript"},
+		Version:   g.Version,
+		Patterns: []TextMatePattern{
+			{Include: "#comments"},
+			{Include: "#strings"},
+			{Include: "#tags"},
+			{Include: "#emoji"},
+			{Name: "constant.numeric" + suffix, Match: numberPattern},
+		},
+		Repository: map[string]TextMatePattern{
+			"comments": {Patterns: []TextMatePattern{
+				{Name: "comment.line.double-slash" + suffix, Match: `//.*$`},
+				{Name: "comment.block" + suffix, Begin: `/\*`, End: `\*/`},
+				{Name: "comment.block.html" + suffix, Begin: `<!--`, End: `-->`},
+			}},
+			"strings": {Patterns: []TextMatePattern{
+				{Name: "string.quoted.double" + suffix, Match: doubleQuotedPattern},
+				{Name: "string.quoted.single" + suffix, Match: singleQuotedPattern},
+				{Name: "string.template" + suffix, Begin: "`", End: "`", Patterns: []TextMatePattern{
+					{Name: "constant.character.escape" + suffix, Match: `\\.`},
+				}},
+			}},
+			"tags": {
+				Begin: tagName,
+				BeginCaptures: map[string]TextMatePattern{
+					"1": {Name: "punctuation.definition.tag" + suffix},
+					"2": {Name: "entity.name.tag" + suffix},
+				},
+				End:         `(/?>)`,
+				EndCaptures: scoped("punctuation.definition.tag"),
+				Patterns: []TextMatePattern{
+					{Match: `\b(` + strings.Join(g.attributeNames(), "|") + `)\b`, Captures: scoped("entity.other.attribute-name")},
+					{Name: "string.quoted.double" + suffix, Match: doubleQuotedPattern},
+					{Name: "string.quoted.single" + suffix, Match: singleQuotedPattern},
+				},
+			},
+			"emoji": {Patterns: emoji},
+		},
+	}
+}
+
+// Monarch renders the grammar as a Monaco Monarch definition
+func (g Grammar) Monarch() MonarchLanguage {
+	root := [][]interface{}{
+		{`//.*$`, "comment"},
+		{`/\*`, "comment", "@comment"},
+		{`<!--`, "comment", "@markupComment"},
+		{doubleQuotedPattern, "string"},
+		{singleQuotedPattern, "string"},
+		{"`", "string", "@template"},
+		{`(</?)(` + strings.Join(g.tagNames(), "|") + `)\b`, []string{"delimiter", "tag"}, "@tag"},
+	}
+	for _, group := range g.emojiGroups() {
+		root = append(root, []interface{}{group.pattern, group.class.token})
+	}
+	root = append(root, []interface{}{numberPattern, "number"})
+
+	return MonarchLanguage{
+		TokenPostfix: ".emojiscript",
+		Unicode:      true,
+		Version:      g.Version,
+		Tokenizer: map[string][][]interface{}{
+			"root": root,
+			"comment": {
+				{`[^*]+`, "comment"},
+				{`\*/`, "comment", "@pop"},
+				{`\*`, "comment"},
+			},
+			"markupComment": {
+				{`-->`, "comment", "@pop"},
+				{`[^-]+`, "comment"},
+				{`-`, "comment"},
+			},
+			"template": {
+				{"[^`\\\\]+", "string"},
+				{`\\.`, "string.escape"},
+				{"`", "string", "@pop"},
+			},
+			"tag": {
+				{`/?>`, "delimiter", "@pop"},
+				{`\b(?:` + strings.Join(g.attributeNames(), "|") + `)\b`, "attribute.name"},
+				{`=`, "delimiter"},
+				{doubleQuotedPattern, "attribute.value"},
+				{singleQuotedPattern, "attribute.value"},
+			},
+		},
+	}
+}
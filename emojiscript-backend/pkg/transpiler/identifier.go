@@ -0,0 +1,61 @@
+package transpiler
+
+import "unicode"
+
+// ValidIdentifier reports whether name is an identifier in targetLang.
+// JavaScript and TypeScript take Unicode ID_Start and ID_Continue
+// characters plus '$' and '_' (and ZWNJ/ZWJ after the first character);
+// Python takes the same letters without '$', as PEP 3131 allows.
+// asciiOnly narrows either to ASCII letters, digits, '_' and, outside
+// Python, '$'.
+func ValidIdentifier(name, targetLang string, asciiOnly bool) bool {
+	if name == "" {
+		return false
+	}
+	python := targetLang == "python"
+	for i, r := range name {
+		switch {
+		case r == '_':
+		case r == '$':
+			if python {
+				return false
+			}
+		case asciiOnly:
+			if r >= unicode.MaxASCII || !unicode.IsLetter(r) && (i == 0 || !unicode.IsDigit(r)) {
+				return false
+			}
+		case i == 0:
+			if !isIDStart(r) {
+				return false
+			}
+		case r == '\u200c' || r == '\u200d':
+			if python {
+				return false
+			}
+		default:
+			if !isIDContinue(r) {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// isIDStart reports whether r has the Unicode ID_Start property
+func isIDStart(r rune) bool {
+	if unicode.In(r, unicode.Pattern_Syntax, unicode.Pattern_White_Space) {
+		return false
+	}
+	return unicode.In(r, unicode.L, unicode.Nl, unicode.Other_ID_Start)
+}
+
+// isIDContinue reports whether r has the Unicode ID_Continue property
+func isIDContinue(r rune) bool {
+	if isIDStart(r) {
+		return true
+	}
+	if unicode.In(r, unicode.Pattern_Syntax, unicode.Pattern_White_Space) {
+		return false
+	}
+	return unicode.In(r, unicode.Mn, unicode.Mc, unicode.Nd, unicode.Pc, unicode.Other_ID_Continue)
+}
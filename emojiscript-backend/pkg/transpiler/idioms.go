@@ -0,0 +1,337 @@
+package transpiler
+
+import "strings"
+
+// idiomPasses are the rewrites Idiomatic runs over each target's output,
+// in order. Each one works on the finished code's tokens and leaves
+// anything it isn't sure of as it is.
+var idiomPasses = map[string][]func([]Token) []Token{
+	"python": {pythonPrints},
+	"rust":   {rustImmutableLets},
+}
+
+// Idiomatic rewrites code, a program's output for targetLang, the way
+// someone writing the target by hand would: Python prints with
+// f-strings rather than concatenation, and Rust declares a variable mut
+// only when something changes it. It's optional, as the rewrites change
+// the output's shape; a target without passes is returned as it is.
+func Idiomatic(code, targetLang string) string {
+	passes := idiomPasses[targetLang]
+	if len(passes) == 0 {
+		return code
+	}
+	tokens, _ := Lex(code)
+	for _, pass := range passes {
+		tokens = pass(tokens)
+	}
+	var out strings.Builder
+	for _, token := range tokens {
+		out.WriteString(token.Text)
+	}
+	return out.String()
+}
+
+// nextToken returns the index of the first token from i that isn't space
+// or a comment, or len(tokens)
+func nextToken(tokens []Token, i int) int {
+	for i < len(tokens) && (tokens[i].Kind == TokenSpace || tokens[i].Kind == TokenComment) {
+		i++
+	}
+	return i
+}
+
+// prevToken returns the index of the last token before i that isn't
+// space or a comment, or -1
+func prevToken(tokens []Token, i int) int {
+	i--
+	for i >= 0 && (tokens[i].Kind == TokenSpace || tokens[i].Kind == TokenComment) {
+		i--
+	}
+	return i
+}
+
+// punctAt reports whether token i is the punctuation text
+func punctAt(tokens []Token, i int, text string) bool {
+	return i >= 0 && i < len(tokens) && tokens[i].Kind == TokenPunct && tokens[i].Text == text
+}
+
+// closeBracket returns the index of the bracket closing the one at open,
+// or len(tokens) when it's never closed
+func closeBracket(tokens []Token, open int) int {
+	depth := 0
+	for i := open; i < len(tokens); i++ {
+		if tokens[i].Kind != TokenPunct {
+			continue
+		}
+		switch tokens[i].Text {
+		case "(", "[", "{":
+			depth++
+		case ")", "]", "}":
+			depth--
+			if depth == 0 {
+				return i
+			}
+		}
+	}
+	return len(tokens)
+}
+
+// pythonPrints writes a print(...) whose single argument concatenates
+// strings with an f-string: print("Hi " + str(name) + "!") becomes
+// print(f"Hi {name}!")
+func pythonPrints(tokens []Token) []Token {
+	var out []Token
+	for i := 0; i < len(tokens); i++ {
+		open := nextToken(tokens, i+1)
+		if tokens[i].Kind != TokenIdent || tokens[i].Text != "print" || punctAt(tokens, prevToken(tokens, i), ".") || !punctAt(tokens, open, "(") {
+			out = append(out, tokens[i])
+			continue
+		}
+		end := closeBracket(tokens, open)
+		if end == len(tokens) {
+			out = append(out, tokens[i:]...)
+			break
+		}
+		args := tokens[open+1 : end]
+		if text, ok := fString(args); ok {
+			args = []Token{{Kind: TokenString, Text: text, Line: tokens[open].Line}}
+		}
+		out = append(out, tokens[i:open+1]...)
+		out = append(out, args...)
+		out = append(out, tokens[end])
+		i = end
+	}
+	return out
+}
+
+// fString writes an argument that concatenates strings as an f-string.
+// It has to be a chain of + whose first or second operand is a string
+// literal, so every + joins strings, and whose other operands are simple
+// enough to sit in braces: names, numbers, member accesses, calls and
+// the arithmetic that binds tighter than +.
+func fString(tokens []Token) (string, bool) {
+	var operands [][]Token
+	start, depth := 0, 0
+	for i, token := range tokens {
+		if token.Kind == TokenTemplate || token.Kind == TokenRegex || token.Kind == TokenComment {
+			return "", false
+		}
+		if token.Kind != TokenPunct {
+			continue
+		}
+		switch token.Text {
+		case "(", "[":
+			depth++
+			continue
+		case ")", "]":
+			depth--
+			continue
+		}
+		if depth > 0 {
+			if strings.ContainsAny(token.Text, `{}\`) {
+				return "", false
+			}
+			continue
+		}
+		switch {
+		case token.Text == "+" && !punctAt(tokens, i-1, "+") && !punctAt(tokens, i+1, "+") && !punctAt(tokens, i+1, "="):
+			operands = append(operands, tokens[start:i])
+			start = i + 1
+		case token.Text != "." && token.Text != "*" && token.Text != "/" && token.Text != "%":
+			return "", false
+		}
+	}
+	operands = append(operands, tokens[start:])
+	if len(operands) < 2 || (stringLiteral(operands[0]) == nil && stringLiteral(operands[1]) == nil) {
+		return "", false
+	}
+
+	var text strings.Builder
+	text.WriteString(`f"`)
+	for _, operand := range operands {
+		if literal := stringLiteral(operand); literal != nil {
+			text.WriteString(fStringText(literal.Text))
+			continue
+		}
+		// str(x) is how Python adds a value that isn't a string
+		if first, open := nextToken(operand, 0), nextToken(operand, nextToken(operand, 0)+1); first < len(operand) && operand[first].Text == "str" &&
+			punctAt(operand, open, "(") && nextToken(operand, closeBracket(operand, open)+1) == len(operand) {
+			operand = operand[open+1 : closeBracket(operand, open)]
+		}
+		var expr strings.Builder
+		for _, token := range operand {
+			if token.Kind == TokenString || strings.ContainsAny(token.Text, `{}\"'`) {
+				return "", false
+			}
+			expr.WriteString(token.Text)
+		}
+		if strings.TrimSpace(expr.String()) == "" {
+			return "", false
+		}
+		text.WriteString("{" + strings.TrimSpace(expr.String()) + "}")
+	}
+	text.WriteString(`"`)
+	return text.String(), true
+}
+
+// stringLiteral returns the one string token an operand is, or nil
+func stringLiteral(operand []Token) *Token {
+	i := nextToken(operand, 0)
+	if i < len(operand) && operand[i].Kind == TokenString && nextToken(operand, i+1) == len(operand) {
+		return &operand[i]
+	}
+	return nil
+}
+
+// fStringText is a string literal's text inside a double-quoted f-string:
+// its escapes carry over, while braces double and a bare double quote
+// from a single-quoted literal is escaped
+func fStringText(literal string) string {
+	body := literal[1 : len(literal)-1]
+	var text strings.Builder
+	for i := 0; i < len(body); i++ {
+		switch c := body[i]; {
+		case c == '\\' && i+1 < len(body):
+			text.WriteString(body[i : i+2])
+			i++
+		case c == '{' || c == '}':
+			text.WriteString(string(c) + string(c))
+		case c == '"':
+			text.WriteString(`\"`)
+		default:
+			text.WriteByte(c)
+		}
+	}
+	return text.String()
+}
+
+// rustMutatingMethods are the methods of Rust's strings and collections
+// that borrow their receiver mutably
+var rustMutatingMethods = map[string]bool{
+	"push": true, "push_str": true, "pop": true, "insert": true, "remove": true, "clear": true,
+	"truncate": true, "extend": true, "append": true, "retain": true, "drain": true, "dedup": true,
+	"sort": true, "sort_by": true, "sort_by_key": true, "sort_unstable": true, "reverse": true,
+	"swap": true, "fill": true, "resize": true, "iter_mut": true, "get_mut": true, "entry": true,
+	"get_or_insert_with": true,
+}
+
+// rustImmutableLets drops the mut from each `let mut name` that the
+// rest of its block never assigns, borrows mutably or calls a method
+// that changes on: one of rustMutatingMethods, or one of the program's
+// own methods that take &mut self
+func rustImmutableLets(tokens []Token) []Token {
+	mutating := map[string]bool{}
+	for name := range rustMutatingMethods {
+		mutating[name] = true
+	}
+	for i, token := range tokens {
+		if token.Kind != TokenIdent || token.Text != "fn" {
+			continue
+		}
+		name := nextToken(tokens, i+1)
+		open := nextToken(tokens, name+1)
+		amp := nextToken(tokens, open+1)
+		mut := nextToken(tokens, amp+1)
+		self := nextToken(tokens, mut+1)
+		if name < len(tokens) && punctAt(tokens, open, "(") && punctAt(tokens, amp, "&") && mut < len(tokens) && tokens[mut].Text == "mut" &&
+			self < len(tokens) && tokens[self].Text == "self" {
+			mutating[tokens[name].Text] = true
+		}
+	}
+
+	drop := map[int]bool{}
+	for i, token := range tokens {
+		if token.Kind != TokenIdent || token.Text != "let" {
+			continue
+		}
+		mut := nextToken(tokens, i+1)
+		name := nextToken(tokens, mut+1)
+		if mut >= len(tokens) || tokens[mut].Text != "mut" || name >= len(tokens) || tokens[name].Kind != TokenIdent {
+			continue
+		}
+		if !rustMutated(tokens, name, mutating) {
+			drop[mut] = true
+			drop[mut+1] = tokens[mut+1].Kind == TokenSpace
+		}
+	}
+	if len(drop) == 0 {
+		return tokens
+	}
+	out := make([]Token, 0, len(tokens))
+	for i, token := range tokens {
+		if !drop[i] {
+			out = append(out, token)
+		}
+	}
+	return out
+}
+
+// rustMutated reports whether the variable declared at tokens[decl] is
+// changed before its block closes
+func rustMutated(tokens []Token, decl int, mutating map[string]bool) bool {
+	name, depth := tokens[decl].Text, 0
+	for i := decl + 1; i < len(tokens); i++ {
+		token := tokens[i]
+		if token.Kind == TokenPunct {
+			switch token.Text {
+			case "{", "(", "[":
+				depth++
+			case "}", ")", "]":
+				if depth--; depth < 0 {
+					return false
+				}
+			}
+			continue
+		}
+		if token.Kind != TokenIdent || token.Text != name {
+			continue
+		}
+		before := prevToken(tokens, i)
+		if punctAt(tokens, before, ".") || punctAt(tokens, before, ":") {
+			continue
+		}
+		if before >= 0 && tokens[before].Text == "mut" && punctAt(tokens, prevToken(tokens, before), "&") {
+			return true
+		}
+		// indexes and fields, up to an assignment or a method call
+		j := nextToken(tokens, i+1)
+		for j < len(tokens) {
+			if punctAt(tokens, j, "[") {
+				j = nextToken(tokens, closeBracket(tokens, j)+1)
+				continue
+			}
+			field := nextToken(tokens, j+1)
+			if !punctAt(tokens, j, ".") || field >= len(tokens) || tokens[field].Kind != TokenIdent {
+				break
+			}
+			if punctAt(tokens, nextToken(tokens, field+1), "(") {
+				if mutating[tokens[field].Text] {
+					return true
+				}
+				break
+			}
+			j = nextToken(tokens, field+1)
+		}
+		if rustAssignment(tokens, j) {
+			return true
+		}
+	}
+	return false
+}
+
+// rustAssignment reports whether an assignment operator, plain or
+// compound, starts at tokens[i]
+func rustAssignment(tokens []Token, i int) bool {
+	if i >= len(tokens) || tokens[i].Kind != TokenPunct {
+		return false
+	}
+	switch tokens[i].Text {
+	case "=":
+		return !punctAt(tokens, i+1, "=") && !punctAt(tokens, i+1, ">")
+	case "+", "-", "*", "/", "%", "^", "&", "|":
+		return punctAt(tokens, i+1, "=")
+	case "<", ">":
+		return punctAt(tokens, i+1, tokens[i].Text) && punctAt(tokens, i+2, "=")
+	}
+	return false
+}
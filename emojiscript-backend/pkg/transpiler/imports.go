@@ -0,0 +1,104 @@
+package transpiler
+
+import (
+	"encoding/base64"
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// ImportResolution reports how one import in the output was resolved
+type ImportResolution struct {
+	Module    string `json:"module"`
+	Kind      string `json:"kind"`
+	Specifier string `json:"specifier,omitempty"`
+	Line      int    `json:"line"`
+}
+
+var (
+	// bareImportPattern matches `import lodash`, which is what `📥 lodash`
+	// becomes before resolution
+	bareImportPattern = regexp.MustCompile(`^(\s*)import\s+([A-Za-z_$@][\w$@./-]*)\s*;?\s*$`)
+	// fromImportPattern matches `import ... from 'x'` and `import 'x'`
+	fromImportPattern = regexp.MustCompile(`^(\s*import\s+(?:[^'"]*\s+from\s+)?)(['"])([^'"]+)(['"])(.*)$`)
+	urlSpecifier      = regexp.MustCompile(`^(https?:|data:|\.{0,2}/)`)
+)
+
+// IsURLSpecifier reports whether a dependency value is a URL or path rather
+// than inline source
+func IsURLSpecifier(value string) bool {
+	return urlSpecifier.MatchString(strings.TrimSpace(value))
+}
+
+// ResolveImports rewrites the imports in transpiled JavaScript against a
+// dependency map of module name -> URL or inline JavaScript source. Bare
+// `import name` lines become default imports; quoted specifiers that name a
+// dependency are replaced. Inline sources are embedded as data: URLs.
+func ResolveImports(code string, dependencies map[string]string) (string, []ImportResolution) {
+	report := []ImportResolution{}
+	lines := strings.Split(code, "\n")
+
+	for i, line := range lines {
+		if m := bareImportPattern.FindStringSubmatch(line); m != nil {
+			module := m[2]
+			specifier, kind := resolveSpecifier(module, dependencies)
+			if kind != "unresolved" {
+				lines[i] = fmt.Sprintf("%simport %s from '%s';", m[1], ImportBinding(module), specifier)
+			}
+			report = append(report, ImportResolution{Module: module, Kind: kind, Specifier: specifier, Line: i + 1})
+			continue
+		}
+
+		if m := fromImportPattern.FindStringSubmatch(line); m != nil {
+			module := m[3]
+			specifier, kind := resolveSpecifier(module, dependencies)
+			if kind != "unresolved" && kind != "relative" {
+				lines[i] = m[1] + m[2] + specifier + m[4] + m[5]
+			} else {
+				specifier = ""
+			}
+			report = append(report, ImportResolution{Module: module, Kind: kind, Specifier: specifier, Line: i + 1})
+		}
+	}
+
+	return strings.Join(lines, "\n"), report
+}
+
+// resolveSpecifier looks a module up in the dependency map
+func resolveSpecifier(module string, dependencies map[string]string) (string, string) {
+	value, ok := dependencies[module]
+	switch {
+	case ok && IsURLSpecifier(value):
+		return strings.TrimSpace(value), "url"
+	case ok:
+		return "data:text/javascript;base64," + base64.StdEncoding.EncodeToString([]byte(value)), "inline"
+	case IsURLSpecifier(module):
+		return module, "relative"
+	default:
+		return "", "unresolved"
+	}
+}
+
+// ImportBinding derives the local name a bare import of a package binds,
+// e.g. "lodash" -> lodash, "@scope/date-fns" -> dateFns
+func ImportBinding(module string) string {
+	name := module[strings.LastIndex(module, "/")+1:]
+	name = strings.TrimSuffix(name, ".js")
+	b := &strings.Builder{}
+	upper := false
+	for _, r := range name {
+		if !isIdentRune(r) {
+			upper = b.Len() > 0
+			continue
+		}
+		if upper {
+			r = []rune(strings.ToUpper(string(r)))[0]
+			upper = false
+		}
+		b.WriteRune(r)
+	}
+	if b.Len() == 0 || (b.String()[0] >= '0' && b.String()[0] <= '9') {
+		return "_" + b.String()
+	}
+	return b.String()
+}
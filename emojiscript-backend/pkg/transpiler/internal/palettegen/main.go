@@ -0,0 +1,75 @@
+// Command palettegen writes the transpiler's palette table from
+// palette.txt, naming each emoji by its base code point's name in the
+// Unicode Character Database. It is run by go generate in pkg/transpiler.
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"flag"
+	"fmt"
+	"go/format"
+	"log"
+	"os"
+	"strings"
+
+	"golang.org/x/text/unicode/runenames"
+)
+
+func main() {
+	in := flag.String("in", "palette.txt", "the language's keyword emoji")
+	out := flag.String("out", "palette_table.go", "the Go file to write")
+	flag.Parse()
+
+	source, err := os.Open(*in)
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer source.Close()
+
+	b := &bytes.Buffer{}
+	fmt.Fprintf(b, "// Code generated by palettegen from %s and the Unicode %s character names; DO NOT EDIT.\n\n", *in, runenames.UnicodeVersion)
+	fmt.Fprintln(b, "package transpiler")
+	fmt.Fprintln(b)
+	fmt.Fprintln(b, "var paletteTable = []paletteEntry{")
+	scanner := bufio.NewScanner(source)
+	rows, grouped := 0, false
+	for line := 1; scanner.Scan(); line++ {
+		text := scanner.Text()
+		if strings.HasPrefix(text, "#") {
+			continue
+		}
+		if text == "" {
+			// keep the table's grouping by category
+			grouped = rows > 0
+			continue
+		}
+		if grouped {
+			fmt.Fprintln(b)
+			grouped = false
+		}
+		rows++
+		fields := strings.Split(text, "\t")
+		if len(fields) != 4 {
+			log.Fatalf("%s:%d: want emoji, keyword, category and spoken phrase separated by tabs", *in, line)
+		}
+		emoji := fields[0]
+		name := runenames.Name([]rune(emoji)[0])
+		if name == "" || strings.HasPrefix(name, "<") {
+			log.Fatalf("%s:%d: %s has no name in the Unicode %s data", *in, line, emoji, runenames.UnicodeVersion)
+		}
+		fmt.Fprintf(b, "\t{%q, %q, %q, %q, %q},\n", emoji, fields[1], fields[2], name, fields[3])
+	}
+	if err := scanner.Err(); err != nil {
+		log.Fatal(err)
+	}
+	fmt.Fprintln(b, "}")
+
+	formatted, err := format.Source(b.Bytes())
+	if err != nil {
+		log.Fatal(err)
+	}
+	if err := os.WriteFile(*out, formatted, 0o644); err != nil {
+		log.Fatal(err)
+	}
+}
@@ -0,0 +1,193 @@
+package transpiler
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// Island is a run of a mixed document in one syntax. A mixed document is
+// a program in one syntax with fenced blocks in the other, as when an
+// example from each tab of the playground is pasted into one editor:
+//
+//	🔢 total = 0
+//	```markup
+//	<loop var="i" from="1" to="3">total += i</loop>
+//	```
+//	📝(total)
+type Island struct {
+	// Syntax is "emoji" or "markup" for a fenced block, and "" for the
+	// code around the blocks, which is in the document's own syntax
+	Syntax string
+	Code   string
+	// Line is the line of the document the island's code starts on
+	Line int
+}
+
+// islandFence matches the line opening a fenced block tagged with a
+// syntax: its fence and the tag
+var islandFence = regexp.MustCompile("^[ \t]*(```+|~~~+)[ \t]*(?i:(emoji|emojiscript|markup))[ \t]*$")
+
+// Islands splits a mixed document at its fenced blocks, returning nil
+// for a document without any. A block runs to the next line that repeats
+// its fence, or to the end of the document. The fence lines themselves
+// belong to no island.
+func Islands(code string) []Island {
+	lines := strings.Split(NormalizeNewlines(code), "\n")
+	var islands []Island
+	var current []string
+	start := 1
+	flush := func(syntax string, next int) {
+		if len(current) > 0 {
+			islands = append(islands, Island{Syntax: syntax, Code: strings.Join(current, "\n"), Line: start})
+		}
+		current, start = nil, next
+	}
+	fenced := false
+	for i := 0; i < len(lines); i++ {
+		match := islandFence.FindStringSubmatch(lines[i])
+		if match == nil {
+			current = append(current, lines[i])
+			continue
+		}
+		fenced = true
+		flush("", i+2)
+		syntax := "emoji"
+		if strings.EqualFold(match[2], "markup") {
+			syntax = "markup"
+		}
+		for i++; i < len(lines) && strings.TrimSpace(lines[i]) != match[1]; i++ {
+			current = append(current, lines[i])
+		}
+		flush(syntax, i+2)
+	}
+	if !fenced {
+		return nil
+	}
+	flush("", 0)
+	return islands
+}
+
+// HostCode returns the code around a mixed document's fenced blocks, for
+// telling which syntax the document itself is in; a document without
+// blocks is returned as it is
+func HostCode(code string) string {
+	islands := Islands(code)
+	if islands == nil {
+		return code
+	}
+	var host []string
+	for _, island := range islands {
+		if island.Syntax == "" {
+			host = append(host, island.Code)
+		}
+	}
+	return strings.Join(host, "\n")
+}
+
+// linePosition matches the line numbers in error messages, in both the
+// emoji syntax's "Line 2, column 5" and markup's "at line 2, column 5"
+var linePosition = regexp.MustCompile(`\b([Ll]ine )(\d+)`)
+
+// TranspileMixed transpiles a mixed document written in the dialect (see
+// Islands): each fenced block in its own syntax and the code around them
+// as markup when markup is set, joined in order with the definitions of
+// the builtins they use added once. Errors, diagnostics and symbols are
+// positioned in the document. Scope analysis stops at a block's edge,
+// so the warnings about undefined and unused names, which a name shared
+// between blocks would set off, are left out.
+func (t *Transpiler) TranspileMixed(code string, markup bool, opts MarkupOptions) (MarkupResult, error) {
+	var result MarkupResult
+	var outputs []string
+	for _, island := range Islands(code) {
+		if strings.TrimSpace(island.Code) == "" {
+			continue
+		}
+		var part MarkupResult
+		if island.Syntax == "markup" || island.Syntax == "" && markup {
+			parser := NewMarkupParser(t.applyMarkupAliases(island.Code), t.targetLang)
+			parser.SetPartial(opts.Partial)
+			parser.SetStrictTags(opts.StrictTags)
+			parser.SetStrictSchema(opts.StrictSchema)
+			parser.SetSanitizePolicy(opts.Sanitize)
+			parser.SetASCIIIdentifiers(opts.ASCIIIdentifiers)
+			parser.SetRenameReserved(opts.RenameReserved)
+			parser.SetCheckOnly(opts.CheckOnly)
+			parser.SetProfile(opts.Profile)
+			output, err := parser.Parse()
+			part = MarkupResult{
+				Output:        output,
+				Errors:        parser.GetErrors(),
+				Warnings:      parser.GetWarnings(),
+				Diagnostics:   parser.GetDiagnostics(),
+				Sanitizations: parser.Sanitizations(),
+				Renames:       parser.GetRenames(),
+				Symbols:       parser.GetSymbols(),
+			}
+			if err != nil && len(part.Errors) == 0 {
+				part.Errors = []string{err.Error()}
+			}
+		} else {
+			source := t.ApplyAliases(island.Code)
+			output, errors, diagnostics := compileEmoji(source, t.targetLang, opts.Profile)
+			part = MarkupResult{Output: output, Errors: errors, Diagnostics: diagnostics, Symbols: Symbols(source, false)}
+		}
+		result.merge(part, island.Line-1)
+		outputs = append(outputs, part.Output)
+	}
+	if !opts.CheckOnly {
+		result.Output = AddStdlib(strings.Join(outputs, "\n"), t.targetLang)
+	}
+	if len(result.Errors) > 0 {
+		return result, fmt.Errorf("parsing errors: %s", strings.Join(result.Errors, "; "))
+	}
+	return result, nil
+}
+
+// merge adds an island's results to the document's, moving their
+// positions down by offset lines
+func (r *MarkupResult) merge(part MarkupResult, offset int) {
+	shift := func(message string) string {
+		return linePosition.ReplaceAllStringFunc(message, func(match string) string {
+			groups := linePosition.FindStringSubmatch(match)
+			line, _ := strconv.Atoi(groups[2])
+			return groups[1] + strconv.Itoa(line+offset)
+		})
+	}
+	for _, message := range part.Errors {
+		r.Errors = append(r.Errors, shift(message))
+	}
+	dropped := map[string]bool{}
+	for _, d := range part.Diagnostics {
+		if d.Code == CodeUndefinedVariable || d.Code == CodeUnusedVariable {
+			dropped[d.Message] = true
+			continue
+		}
+		if d.Line > 0 {
+			d.Line += offset
+		}
+		d.Message = shift(d.Message)
+		r.Diagnostics = append(r.Diagnostics, d)
+	}
+	for _, message := range part.Warnings {
+		if !dropped[message] {
+			r.Warnings = append(r.Warnings, shift(message))
+		}
+	}
+	for _, s := range part.Sanitizations {
+		s.Line += offset
+		r.Sanitizations = append(r.Sanitizations, s)
+	}
+	for name, renamed := range part.Renames {
+		if r.Renames == nil {
+			r.Renames = map[string]string{}
+		}
+		r.Renames[name] = renamed
+	}
+	for _, s := range part.Symbols {
+		s.Line += offset
+		s.EndLine += offset
+		r.Symbols = append(r.Symbols, s)
+	}
+}
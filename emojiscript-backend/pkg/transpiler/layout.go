@@ -0,0 +1,385 @@
+package transpiler
+
+import (
+	"strings"
+	"unicode"
+)
+
+// formatIndent is one level of indentation in formatted source
+const formatIndent = "  "
+
+// layout re-indents source by its nesting and puts one space on each side
+// of binary operator emoji. Markup is indented by its tags as well, and
+// its tags are written canonically (see markupLayout). Only whitespace
+// between tokens changes, never a line break, and text inside strings,
+// template literals and comments is left alone, so the program's meaning
+// is kept.
+func layout(code string, markup bool) string {
+	w := &layoutWriter{lineStart: true}
+	if markup {
+		s := &markupLayout{runes: []rune(code), w: w}
+		s.scan()
+	} else {
+		w.code(code, 0)
+	}
+	return w.String()
+}
+
+// layoutWriter collects formatted source. Line breaks wait until the next
+// line's first text, which decides the line's indentation.
+type layoutWriter struct {
+	b         strings.Builder
+	breaks    int
+	lineStart bool
+}
+
+func (w *layoutWriter) lineBreaks(n int) {
+	w.breaks += n
+	w.lineStart = true
+}
+
+// write adds text, indented to depth if it starts a line
+func (w *layoutWriter) write(text string, depth int) {
+	if w.lineStart {
+		w.b.WriteString(strings.Repeat("\n", w.breaks))
+		w.b.WriteString(strings.Repeat(formatIndent, max(depth, 0)))
+		w.breaks, w.lineStart = 0, false
+	}
+	w.b.WriteString(text)
+}
+
+func (w *layoutWriter) String() string {
+	return w.b.String() + strings.Repeat("\n", w.breaks)
+}
+
+// code lays out a run of code nested depth levels deep, indenting each
+// line by the brackets open at its start. A line starting with closing
+// brackets is indented as the line that opened them.
+func (w *layoutWriter) code(code string, depth int) {
+	tokens, _ := Lex(code)
+	level := 0
+	for i, tok := range tokens {
+		if tok.Kind == TokenSpace {
+			switch {
+			case strings.Contains(tok.Text, "\n"):
+				w.lineBreaks(strings.Count(tok.Text, "\n"))
+			case w.lineStart:
+				// indentation is rewritten with the line's first token
+			case spacedOperator(tokens, i-1) || spacedOperator(tokens, i+1):
+				w.write(" ", 0)
+			default:
+				w.write(tok.Text, 0)
+			}
+			continue
+		}
+
+		spaced := spacedOperator(tokens, i)
+		if spaced && !w.lineStart && i > 0 && tokens[i-1].Kind != TokenSpace {
+			w.write(" ", 0)
+		}
+		indent := depth + level
+		if w.lineStart {
+			for j := i; j < len(tokens) && closesBracket(tokens[j]); j++ {
+				indent--
+			}
+		}
+		w.write(tok.Text, indent)
+		if closesBracket(tok) {
+			level = max(level-1, 0)
+		}
+		if opensBracket(tok) {
+			level++
+		}
+		if spaced && i+1 < len(tokens) && tokens[i+1].Kind != TokenSpace {
+			w.write(" ", 0)
+		}
+	}
+}
+
+func opensBracket(tok Token) bool {
+	return tok.Kind == TokenPunct && strings.Contains("([{", tok.Text) ||
+		tok.Kind == TokenTemplate && strings.HasSuffix(tok.Text, "${")
+}
+
+func closesBracket(tok Token) bool {
+	return tok.Kind == TokenPunct && strings.Contains(")]}", tok.Text) ||
+		tok.Kind == TokenTemplate && strings.HasPrefix(tok.Text, "}")
+}
+
+// spacedOperator reports whether tokens[i] is an emoji operator taking
+// an operand on each side, which formatting spaces out. ➕ and ➖ are
+// left alone where they are a sign, as is every prefix or postfix
+// operator.
+func spacedOperator(tokens []Token, i int) bool {
+	if i < 0 || i >= len(tokens) || tokens[i].Kind != TokenKeyword {
+		return false
+	}
+	keyword := tokens[i].Keyword
+	if binding, ok := operatorBindings[keyword]; !ok || binding.unary {
+		return false
+	}
+	if keyword == "+" || keyword == "-" {
+		return !operandExpected(tokens, i)
+	}
+	return true
+}
+
+// operandExpected reports whether an operand, rather than an operator,
+// is expected at tokens[i], judging by the token before it
+func operandExpected(tokens []Token, i int) bool {
+	j := i - 1
+	for j >= 0 && (tokens[j].Kind == TokenSpace || tokens[j].Kind == TokenComment) {
+		j--
+	}
+	if j < 0 {
+		return true
+	}
+	prev := tokens[j]
+	switch prev.Kind {
+	case TokenKeyword:
+		return regexAfterKeyword(prev.Keyword)
+	case TokenIdent:
+		return regexAfterKeyword(prev.Text)
+	case TokenPunct:
+		return !strings.Contains(")]}", prev.Text)
+	case TokenTemplate:
+		return strings.HasSuffix(prev.Text, "${")
+	}
+	return false
+}
+
+// markupLayout lays out markup: each tag is indented by the tags open
+// around it, and the code between tags by those and its own brackets.
+// Tags are written canonically: one space between attributes, values in
+// double quotes, and "/>" closing a self-closing tag. Text and comment
+// bodies are copied as written.
+type markupLayout struct {
+	runes []rune
+	pos   int
+	w     *layoutWriter
+	// open holds the names of the tags not yet closed, innermost last
+	open []string
+}
+
+func (s *markupLayout) scan() {
+	for s.pos < len(s.runes) {
+		switch {
+		case s.at("<!--"):
+			end := indexFrom(s.runes, s.pos+4, "-->")
+			if end < 0 {
+				end = len(s.runes)
+			} else {
+				end += 3
+			}
+			s.w.write(string(s.runes[s.pos:end]), len(s.open))
+			s.pos = end
+		case s.tagStart():
+			s.tag()
+		default:
+			s.text()
+		}
+	}
+}
+
+// text lays out the code up to the next tag or markup comment
+func (s *markupLayout) text() {
+	end := s.pos + 1
+	for end < len(s.runes) {
+		saved := s.pos
+		s.pos = end
+		stop := s.at("<!--") || s.tagStart()
+		s.pos = saved
+		if stop {
+			break
+		}
+		end++
+	}
+	text := string(s.runes[s.pos:end])
+	s.pos = end
+	if len(s.open) > 0 {
+		if spec, ok := markupTagIndex[strings.ToLower(s.open[len(s.open)-1])]; ok && spec.content == "text" {
+			s.w.write(text, len(s.open))
+			return
+		}
+	}
+	s.w.code(text, len(s.open))
+}
+
+// tag writes the tag at the scanner's position canonically. A tag the
+// parser would reject is copied as written, through its '>'.
+func (s *markupLayout) tag() {
+	start := s.pos
+	canonical, opens, ok := s.parseTag()
+	if !ok {
+		end := start
+		for end < len(s.runes) && s.runes[end] != '>' {
+			end++
+		}
+		s.pos = min(end+1, len(s.runes))
+		s.w.write(string(s.runes[start:s.pos]), len(s.open))
+		return
+	}
+	s.w.write(canonical, len(s.open))
+	if opens != "" {
+		s.open = append(s.open, opens)
+	}
+}
+
+// parseTag reads an opening or closing tag the way the markup parser
+// does, returning its canonical spelling. A closing tag closes its open
+// tag; the name of a tag that opens a body is returned for the caller to
+// push once the tag is written.
+func (s *markupLayout) parseTag() (canonical, opens string, ok bool) {
+	s.pos++ // '<'
+	closing := s.at("/")
+	if closing {
+		s.pos++
+	}
+	name := s.name()
+	if name == "" {
+		return "", "", false
+	}
+	if closing {
+		s.skipSpace()
+		if !s.at(">") {
+			return "", "", false
+		}
+		s.pos++
+		// a closing tag matching no open tag, such as the optional one
+		// after a void tag, leaves the indentation alone
+		for i := len(s.open) - 1; i >= 0; i-- {
+			if s.open[i] == name {
+				s.open = s.open[:i]
+				break
+			}
+		}
+		return "</" + name + ">", "", true
+	}
+
+	b := &strings.Builder{}
+	b.WriteString("<" + name)
+	for {
+		s.skipSpace()
+		if s.pos >= len(s.runes) {
+			return "", "", false
+		}
+		if s.at("/") {
+			if !s.at("/>") {
+				return "", "", false
+			}
+			s.pos += 2
+			return b.String() + "/>", "", true
+		}
+		if s.at(">") {
+			s.pos++
+			if spec, ok := markupTagIndex[strings.ToLower(name)]; ok && spec.content == "none" {
+				return b.String() + ">", "", true
+			}
+			return b.String() + ">", name, true
+		}
+		attribute := s.identifier()
+		if attribute == "" {
+			return "", "", false
+		}
+		b.WriteString(" " + attribute)
+		s.skipSpace()
+		if s.at("=") {
+			s.pos++
+			s.skipSpace()
+			b.WriteString("=" + s.value())
+		}
+	}
+}
+
+// value reads an attribute value and returns it in double quotes,
+// escaped so the parser reads the same value from it
+func (s *markupLayout) value() string {
+	b := &strings.Builder{}
+	b.WriteByte('"')
+	if quote := s.peek(); quote == '"' || quote == '\'' {
+		s.pos++
+		for s.pos < len(s.runes) && s.runes[s.pos] != quote {
+			r := s.runes[s.pos]
+			switch {
+			case r == '\\' && s.pos+1 < len(s.runes):
+				b.WriteRune(r)
+				s.pos++
+				b.WriteRune(s.runes[s.pos])
+			case r == '"':
+				b.WriteString(`\"`)
+			default:
+				b.WriteRune(r)
+			}
+			s.pos++
+		}
+		if s.pos < len(s.runes) {
+			s.pos++
+		}
+	} else {
+		// an unquoted value runs to whitespace or '>', and backslashes in
+		// it are literal
+		for s.pos < len(s.runes) && !strings.ContainsRune(" \t\r\n>", s.runes[s.pos]) {
+			if r := s.runes[s.pos]; r == '\\' || r == '"' {
+				b.WriteByte('\\')
+			}
+			b.WriteRune(s.runes[s.pos])
+			s.pos++
+		}
+	}
+	b.WriteByte('"')
+	return b.String()
+}
+
+// name reads a tag name, with its namespace if it has one
+func (s *markupLayout) name() string {
+	name := s.identifier()
+	if name != "" && s.at(":") {
+		s.pos++
+		name += ":" + s.identifier()
+	}
+	return name
+}
+
+// identifier reads a tag or attribute name as the parser does
+func (s *markupLayout) identifier() string {
+	start := s.pos
+	for s.pos < len(s.runes) {
+		r := s.runes[s.pos]
+		if !(r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9' || r == '-' || r == '_') {
+			break
+		}
+		s.pos++
+	}
+	return string(s.runes[start:s.pos])
+}
+
+func (s *markupLayout) tagStart() bool {
+	if s.peek() != '<' || s.pos+1 >= len(s.runes) {
+		return false
+	}
+	next := s.runes[s.pos+1]
+	return next == '/' || next < unicode.MaxASCII && unicode.IsLetter(next)
+}
+
+func (s *markupLayout) at(prefix string) bool {
+	for i, r := range []rune(prefix) {
+		if s.pos+i >= len(s.runes) || s.runes[s.pos+i] != r {
+			return false
+		}
+	}
+	return true
+}
+
+func (s *markupLayout) peek() rune {
+	if s.pos >= len(s.runes) {
+		return 0
+	}
+	return s.runes[s.pos]
+}
+
+// skipSpace skips the whitespace the parser skips inside tags
+func (s *markupLayout) skipSpace() {
+	for s.pos < len(s.runes) && strings.ContainsRune(" \t\r\n", s.runes[s.pos]) {
+		s.pos++
+	}
+}
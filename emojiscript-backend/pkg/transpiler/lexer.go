@@ -0,0 +1,292 @@
+package transpiler
+
+import (
+	"fmt"
+	"unicode"
+	"unicode/utf8"
+)
+
+// TokenKind classifies a token of the plain emoji syntax
+type TokenKind int
+
+const (
+	TokenSpace TokenKind = iota
+	TokenComment
+	// TokenKeyword is a keyword emoji; its Keyword is the JavaScript
+	// spelling
+	TokenKeyword
+	// TokenEmoji is any other emoji, such as one used in a name
+	TokenEmoji
+	TokenIdent
+	TokenNumber
+	TokenString
+	// TokenTemplate is a run of template literal text: from the opening
+	// backtick or the '}' closing a substitution to the closing backtick
+	// or the next "${"
+	TokenTemplate
+	TokenRegex
+	TokenPunct
+)
+
+var tokenKindNames = [...]string{"space", "comment", "keyword", "emoji", "identifier", "number", "string", "template", "regex", "punctuation"}
+
+func (k TokenKind) String() string {
+	return tokenKindNames[k]
+}
+
+// Token is a piece of emoji source. Line and Column are 1-based, counting
+// columns in runes.
+type Token struct {
+	Kind    TokenKind
+	Text    string
+	Keyword string
+	Line    int
+	Column  int
+}
+
+// SyntaxError is a problem in emoji source, at the position it starts
+type SyntaxError struct {
+	Line    int
+	Column  int
+	Message string
+	// Length is how many runes the problem spans from its position
+	Length int
+	// Code names the kind of problem (see Diagnostic)
+	Code string
+}
+
+func (e *SyntaxError) Error() string {
+	return fmt.Sprintf("Line %d, column %d: %s", e.Line, e.Column, e.Message)
+}
+
+// Lexer splits plain emoji syntax into tokens. Everything in the source
+// ends up in exactly one token, so concatenating the tokens' text gives
+// the source back, less a byte order mark and with LF line endings (see
+// NormalizeNewlines). Emoji in strings, comments, regular expressions and
+// template literal text are part of those tokens, never keywords.
+type Lexer struct {
+	source string
+	runes  []rune
+	pos    int
+	// offset is pos in bytes, so token text is sliced from source
+	offset int
+	line   int
+	column int
+	tokens []Token
+	errors []*SyntaxError
+	// templates holds the template substitutions being lexed, innermost
+	// last
+	templates []substitution
+	depth     int
+	// regexOK is whether a '/' here starts a regular expression
+	regexOK bool
+}
+
+// substitution is a template literal's "${" awaiting its '}'
+type substitution struct {
+	// depth is the brace depth the closing '}' returns to
+	depth int
+	// line and column are where the template literal starts
+	line, column int
+}
+
+// NewLexer prepares a lexer for code
+func NewLexer(code string) *Lexer {
+	code = NormalizeNewlines(code)
+	runes := []rune(code)
+	return &Lexer{source: code, runes: runes, tokens: make([]Token, 0, len(runes)/2), line: 1, column: 1, regexOK: true}
+}
+
+// Lex splits code into tokens, reporting unterminated strings, comments,
+// template literals and regular expressions
+func Lex(code string) ([]Token, []*SyntaxError) {
+	return NewLexer(code).Lex()
+}
+
+// Lex runs the lexer over its whole source
+func (l *Lexer) Lex() ([]Token, []*SyntaxError) {
+	for l.pos < len(l.runes) {
+		l.next()
+	}
+	for _, sub := range l.templates {
+		l.errors = append(l.errors, &SyntaxError{Line: sub.line, Column: sub.column, Message: "unterminated template literal", Length: 1, Code: CodeUnterminatedTemplate})
+	}
+	return l.tokens, l.errors
+}
+
+func (l *Lexer) next() {
+	runes, start := l.runes, l.pos
+	r := runes[start]
+	peek := func(i int) rune {
+		if i < len(runes) {
+			return runes[i]
+		}
+		return 0
+	}
+
+	switch {
+	case unicode.IsSpace(r):
+		end := start + 1
+		for end < len(runes) && unicode.IsSpace(runes[end]) {
+			end++
+		}
+		line := l.line
+		l.emit(TokenSpace, end)
+		if l.line > line {
+			// a statement may end at a line break, so a '/' may open a
+			// regular expression on the next line
+			l.regexOK = true
+		}
+	case r == '/' && peek(start+1) == '/':
+		end := start + 2
+		for end < len(runes) && runes[end] != '\n' {
+			end++
+		}
+		l.emit(TokenComment, end)
+	case r == '/' && peek(start+1) == '*':
+		end := indexFrom(runes, start+2, "*/")
+		if end < 0 {
+			l.fail(CodeUnterminatedComment, "unterminated comment")
+			l.emit(TokenComment, len(runes))
+			return
+		}
+		l.emit(TokenComment, end+2)
+	case r == '"' || r == '\'':
+		end := closeQuote(runes, start, r)
+		if runes[end] != r || end == start {
+			l.fail(CodeUnterminatedString, "unterminated string")
+			l.emit(TokenString, end+1)
+			return
+		}
+		l.emit(TokenString, end+1)
+		l.regexOK = false
+	case r == '`':
+		l.template(start+1, l.line, l.column)
+	case r == '}' && len(l.templates) > 0 && l.depth == l.templates[len(l.templates)-1].depth:
+		sub := l.templates[len(l.templates)-1]
+		l.templates = l.templates[:len(l.templates)-1]
+		l.template(start+1, sub.line, sub.column)
+	case r == '/' && l.regexOK:
+		end := closeRegex(runes, start)
+		if runes[end] != '/' || end == start {
+			l.fail(CodeUnterminatedRegex, "unterminated regular expression")
+			l.emit(TokenRegex, end+1)
+			return
+		}
+		end++
+		for end < len(runes) && isIdentRune(runes[end]) {
+			end++
+		}
+		l.emit(TokenRegex, end)
+		l.regexOK = false
+	case isEmojiBase(r):
+		end := emojiEnd(runes, start)
+		if compoundEnd, keyword := compoundOperator(runes, start, end); compoundEnd > end {
+			l.emit(TokenKeyword, compoundEnd)
+			l.tokens[len(l.tokens)-1].Keyword = keyword
+			l.regexOK = regexAfterKeyword(keyword)
+			return
+		}
+		cluster := string(runes[start:end])
+		keyword, ok := emojiKeywords[cluster]
+		if !ok {
+			keyword, ok = emojiKeywords[NormalizeVariants(cluster)]
+		}
+		if !ok {
+			l.emit(TokenEmoji, end)
+			l.regexOK = false
+			return
+		}
+		l.emit(TokenKeyword, end)
+		l.tokens[len(l.tokens)-1].Keyword = keyword
+		l.regexOK = regexAfterKeyword(keyword)
+	case isIdentRune(r):
+		end := start + 1
+		for end < len(runes) && isIdentRune(runes[end]) {
+			end++
+		}
+		kind := TokenIdent
+		if unicode.IsDigit(r) {
+			kind = TokenNumber
+			// a fraction or exponent, e.g. 1.5 or 2e-3
+			for end < len(runes) && (runes[end] == '.' || (runes[end] == '-' || runes[end] == '+') && (runes[end-1] == 'e' || runes[end-1] == 'E')) {
+				end++
+				for end < len(runes) && isIdentRune(runes[end]) {
+					end++
+				}
+			}
+		}
+		l.emit(kind, end)
+		l.regexOK = kind == TokenIdent && regexAfterKeyword(l.tokens[len(l.tokens)-1].Text)
+	default:
+		switch r {
+		case '{':
+			l.depth++
+		case '}':
+			l.depth--
+		}
+		l.emit(TokenPunct, start+1)
+		l.regexOK = regexAllowed(r, false)
+	}
+}
+
+// template lexes template literal text from start, up to and including
+// the closing backtick or the "${" opening a substitution. line and
+// column are where the template literal starts.
+func (l *Lexer) template(start, line, column int) {
+	runes := l.runes
+	for i := start; i < len(runes); i++ {
+		switch {
+		case runes[i] == '\\':
+			i++
+		case runes[i] == '`':
+			l.emit(TokenTemplate, i+1)
+			l.regexOK = false
+			return
+		case runes[i] == '$' && i+1 < len(runes) && runes[i+1] == '{':
+			l.emit(TokenTemplate, i+2)
+			l.templates = append(l.templates, substitution{depth: l.depth, line: line, column: column})
+			l.regexOK = true
+			return
+		}
+	}
+	l.errors = append(l.errors, &SyntaxError{Line: line, Column: column, Message: "unterminated template literal", Length: 1, Code: CodeUnterminatedTemplate})
+	l.emit(TokenTemplate, len(runes))
+}
+
+// emit adds the token running from the lexer's position to end and moves
+// past it
+func (l *Lexer) emit(kind TokenKind, end int) {
+	end = min(end, len(l.runes))
+	tok := Token{Kind: kind, Line: l.line, Column: l.column}
+	start := l.offset
+	for _, r := range l.runes[l.pos:end] {
+		if r == '\n' {
+			l.line, l.column = l.line+1, 1
+		} else {
+			l.column++
+		}
+		l.offset += utf8.RuneLen(r)
+	}
+	tok.Text = l.source[start:l.offset]
+	l.tokens = append(l.tokens, tok)
+	l.pos = end
+}
+
+// fail reports an error at the lexer's position, marking the character
+// that opened what was never closed
+func (l *Lexer) fail(code, message string) {
+	l.errors = append(l.errors, &SyntaxError{Line: l.line, Column: l.column, Message: message, Length: 1, Code: code})
+}
+
+// regexAfterKeyword reports whether a '/' after the word starts a regular
+// expression: after an operator word such as return or typeof it does,
+// after a value such as this or a name it divides
+func regexAfterKeyword(word string) bool {
+	switch word {
+	case "return", "typeof", "case", "do", "else", "in", "of", "new", "delete", "void", "throw", "await", "yield", "instanceof":
+		return true
+	}
+	last, _ := utf8.DecodeLastRuneInString(word)
+	return word != "" && !isIdentRune(last)
+}
@@ -0,0 +1,194 @@
+package transpiler
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"unicode"
+)
+
+// MaxMappings bounds the size of a mapping profile or a request's custom
+// mappings
+const MaxMappings = 200
+
+// DefaultProfile names the built-in emoji table
+const DefaultProfile = "default"
+
+// MappingProfile is a named emoji -> keyword table. A profile's emoji are
+// accepted on top of the built-in ones, and take precedence where they
+// reuse one for a different keyword.
+type MappingProfile struct {
+	Name        string            `json:"name"`
+	Description string            `json:"description"`
+	Mappings    map[string]string `json:"mappings"`
+}
+
+// builtinProfiles are the profiles every registry starts with; the
+// default profile is filled from the palette by NewMappingRegistry
+var builtinProfiles = []MappingProfile{
+	{
+		Name:        "classic",
+		Description: "The emoji markup accepts (🔒 const, 💾 let, ⚡ function, ❌ false), so a program reads the same in either syntax",
+		Mappings: map[string]string{
+			"🔒": "const", "💾": "let", "⚡": "function", "❌": "false",
+			"🚪": "else", "🚀": "async",
+		},
+	},
+	{
+		Name:        "kid-friendly",
+		Description: "Everyday emoji for first programs: 💬 says something, 🤔 asks, 👍 and 👎 answer",
+		Mappings: map[string]string{
+			"🎒": "const", "🧸": "let", "🪄": "function", "🏠": "return",
+			"💬": "console.log", "🤔": "if", "🙅": "else", "👍": "true",
+			"👎": "false", "🎠": "for", "🎡": "while", "🛑": "break",
+			"🐣": "new", "🏰": "class", "🙋": "this", "👻": "null",
+		},
+	},
+}
+
+// MappingRegistry holds the mapping profiles a request can name. It is
+// safe for concurrent use.
+type MappingRegistry struct {
+	mu          sync.RWMutex
+	profiles    map[string]MappingProfile
+	transpilers map[string]*Transpiler
+}
+
+// NewMappingRegistry returns a registry with the built-in profiles:
+// default, classic and kid-friendly
+func NewMappingRegistry() *MappingRegistry {
+	r := &MappingRegistry{profiles: map[string]MappingProfile{}, transpilers: map[string]*Transpiler{}}
+	defaults := make(map[string]string, len(paletteTable))
+	for _, entry := range paletteTable {
+		defaults[entry.emoji] = entry.keyword
+	}
+	r.profiles[DefaultProfile] = MappingProfile{Name: DefaultProfile, Description: "The built-in emoji table", Mappings: defaults}
+	for _, profile := range builtinProfiles {
+		r.profiles[profile.Name] = profile
+	}
+	return r
+}
+
+// Register adds or replaces a profile after validating its mappings
+func (r *MappingRegistry) Register(profile MappingProfile) error {
+	if profile.Name == "" {
+		return fmt.Errorf("profile name cannot be empty")
+	}
+	if problems := ValidateMappings(profile.Mappings); len(problems) > 0 {
+		return fmt.Errorf("invalid mapping profile '%s': %s", profile.Name, strings.Join(problems, "; "))
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.profiles[profile.Name] = profile
+	for key := range r.transpilers {
+		if strings.HasPrefix(key, profile.Name+"\x00") {
+			delete(r.transpilers, key)
+		}
+	}
+	return nil
+}
+
+// List returns the profiles sorted by name, the default first
+func (r *MappingRegistry) List() []MappingProfile {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	profiles := make([]MappingProfile, 0, len(r.profiles))
+	for _, profile := range r.profiles {
+		profiles = append(profiles, profile)
+	}
+	sort.Slice(profiles, func(i, j int) bool {
+		if (profiles[i].Name == DefaultProfile) != (profiles[j].Name == DefaultProfile) {
+			return profiles[i].Name == DefaultProfile
+		}
+		return profiles[i].Name < profiles[j].Name
+	})
+	return profiles
+}
+
+// Get returns the named profile
+func (r *MappingRegistry) Get(name string) (MappingProfile, bool) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	profile, ok := r.profiles[name]
+	return profile, ok
+}
+
+// Transpiler returns a shared Transpiler for the named profile and target
+// language, building it on first use. It reports false when there is no
+// such profile.
+func (r *MappingRegistry) Transpiler(name, targetLang string) (*Transpiler, bool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	profile, ok := r.profiles[name]
+	if !ok {
+		return nil, false
+	}
+	key := name + "\x00" + targetLang
+	t, ok := r.transpilers[key]
+	if !ok {
+		t = New(Options{TargetLanguage: targetLang, Aliases: MappingAliases(profile.Mappings)})
+		r.transpilers[key] = t
+	}
+	return t, true
+}
+
+// ValidateMappings returns the problems with an emoji -> keyword table:
+// every keyword must be one the language has, and emoji may not contain
+// letters, digits or spaces
+func ValidateMappings(mappings map[string]string) []string {
+	var problems []string
+	if len(mappings) == 0 {
+		problems = append(problems, "mappings cannot be empty")
+	}
+	if len(mappings) > MaxMappings {
+		problems = append(problems, fmt.Sprintf("%d mappings (max %d)", len(mappings), MaxMappings))
+	}
+	emojis := make([]string, 0, len(mappings))
+	for emoji := range mappings {
+		emojis = append(emojis, emoji)
+	}
+	sort.Strings(emojis)
+	for _, emoji := range emojis {
+		canonical := NormalizeVariants(strings.TrimSpace(emoji))
+		switch {
+		case canonical == "":
+			problems = append(problems, "empty emoji sequence")
+		case strings.IndexFunc(canonical, isMappingIdentRune) >= 0:
+			problems = append(problems, fmt.Sprintf("'%s' contains letters, digits or spaces", emoji))
+		default:
+			if _, ok := KeywordEmoji(mappings[emoji]); !ok {
+				problems = append(problems, fmt.Sprintf("'%s' maps to unknown keyword '%s'", emoji, mappings[emoji]))
+			}
+		}
+	}
+	return problems
+}
+
+// MappingAliases maps the emoji of a table to the built-in emoji for the
+// same keyword, the form Options.Aliases takes. Emoji that already are
+// the built-in ones are left out.
+func MappingAliases(mappings map[string]string) map[string]string {
+	aliases := map[string]string{}
+	for emoji, keyword := range mappings {
+		canonical, ok := KeywordEmoji(keyword)
+		if emoji = NormalizeVariants(strings.TrimSpace(emoji)); ok && emoji != canonical {
+			aliases[emoji] = canonical
+		}
+	}
+	return aliases
+}
+
+// MappingKey identifies a table for cache keys: its pairs, sorted
+func MappingKey(mappings map[string]string) string {
+	pairs := make([]string, 0, len(mappings))
+	for emoji, keyword := range mappings {
+		pairs = append(pairs, emoji+"="+keyword)
+	}
+	sort.Strings(pairs)
+	return strings.Join(pairs, ",")
+}
+
+func isMappingIdentRune(r rune) bool {
+	return r < unicode.MaxASCII && (unicode.IsLetter(r) || unicode.IsDigit(r) || unicode.IsSpace(r) || r == '_' || r == '$')
+}
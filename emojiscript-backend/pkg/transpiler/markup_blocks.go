@@ -0,0 +1,69 @@
+package transpiler
+
+import "fmt"
+
+// blockTracker pairs the brackets in the code between tags, a run at a
+// time, across one tag's body or the top level of a document. Code may
+// open a block around tags, as in "if (ready) {" <print> "}", but the
+// block has to close in code of the same body: a closing tag can't close
+// it, and code inside a tag can't close a block opened outside the tag,
+// or the output's blocks would nest differently from the tags.
+type blockTracker struct {
+	in       *MarkupTag // the tag whose body is tracked; nil at the top level
+	open     []Token    // brackets not closed yet, positioned in the source
+	problems []Diagnostic
+}
+
+// track pairs the brackets in a run of code starting at line and column
+func (b *blockTracker) track(code string, line, column int) {
+	tokens, _ := Lex(code)
+	for _, token := range tokens {
+		if token.Kind != TokenPunct || bracketNames[token.Text] == "" {
+			continue
+		}
+		if token.Line == 1 {
+			token.Column += column - 1
+		}
+		token.Line += line - 1
+		if _, ok := closers[token.Text]; ok {
+			b.open = append(b.open, token)
+			continue
+		}
+		match := len(b.open) - 1
+		for match >= 0 && closers[b.open[match].Text] != token.Text {
+			match--
+		}
+		if match < 0 {
+			if b.in != nil {
+				b.problem(token, CodeMixedBlock, fmt.Sprintf("'%s' in <%s> closes a block opened outside it", token.Text, b.in.Name))
+			} else {
+				b.problem(token, CodeUnbalancedBracket, fmt.Sprintf("unbalanced %s: '%s' has no matching '%s'", bracketNames[token.Text], token.Text, opener(token.Text)))
+			}
+			continue
+		}
+		b.unclosed(b.open[match+1:])
+		b.open = b.open[:match]
+	}
+}
+
+// done reports the brackets still open at the end of the body, and
+// returns every problem found
+func (b *blockTracker) done() []Diagnostic {
+	b.unclosed(b.open)
+	b.open = nil
+	return b.problems
+}
+
+func (b *blockTracker) unclosed(open []Token) {
+	for _, token := range open {
+		if b.in != nil {
+			b.problem(token, CodeMixedBlock, fmt.Sprintf("'%s' opened in <%s> is never closed before </%s>", token.Text, b.in.Name, b.in.Name))
+		} else {
+			b.problem(token, CodeUnbalancedBracket, fmt.Sprintf("unbalanced %s: '%s' is never closed", bracketNames[token.Text], token.Text))
+		}
+	}
+}
+
+func (b *blockTracker) problem(token Token, code, message string) {
+	b.problems = append(b.problems, Diagnostic{Message: message, Severity: SeverityError, Line: token.Line, Column: token.Column, Length: 1, Code: code})
+}
@@ -0,0 +1,627 @@
+package transpiler
+
+import (
+	"fmt"
+	"strings"
+	"unicode/utf8"
+)
+
+// declScope is a block of markup or code and the names declared in it,
+// each with the keyword that declared it: "let", "const", "var",
+// "function", "class", "import" or "param"
+type declScope struct {
+	parent *declScope
+	names  map[string]string
+	// classBody is a class's braces, where "name = value" is a field
+	classBody bool
+	// symbols are the names declared here that the program should read
+	symbols map[string]*symbol
+	table   *symbolTable
+}
+
+func newDeclScope(parent *declScope) *declScope {
+	s := &declScope{parent: parent, names: map[string]string{}, symbols: map[string]*symbol{}, table: &symbolTable{}}
+	if parent != nil {
+		s.table = parent.table
+	}
+	return s
+}
+
+// lookup returns the keyword of the innermost declaration of name
+func (s *declScope) lookup(name string) string {
+	for ; s != nil; s = s.parent {
+		if keyword, ok := s.names[name]; ok {
+			return keyword
+		}
+	}
+	return ""
+}
+
+// redeclarable are the keywords whose names may be declared again in the
+// same scope, by each other
+var redeclarable = map[string]bool{"var": true, "function": true, "param": true}
+
+// declare adds name to the scope, reporting false if the scope already
+// declares it in a way JavaScript rejects
+func (s *declScope) declare(name, keyword string) bool {
+	if name == "" {
+		return true
+	}
+	if previous, ok := s.names[name]; ok {
+		return redeclarable[previous] && redeclarable[keyword]
+	}
+	s.names[name] = keyword
+	return true
+}
+
+// pendingName is a name declared in parentheses, which belongs to the
+// block after them: a parameter, or a for loop's variable. A name in
+// parentheses that turn out to hold arguments is read in scope instead.
+type pendingName struct {
+	name, keyword string
+	at            Diagnostic
+	scope         *declScope
+	// used is whether the parentheses read the name, as in "i < 10"
+	used bool
+}
+
+// declarePending declares name in the block it belongs to
+func (s *declScope) declarePending(name pendingName) {
+	if name.keyword == "param" {
+		s.declare(name.name, name.keyword)
+		return
+	}
+	s.declareSymbol(name.name, name.keyword, name.at)
+	if name.used {
+		s.read(name.name, false, false, name.at)
+	}
+}
+
+// assignOperators are the operators that assign to the name before them,
+// longest first
+var assignOperators = []string{">>>=", "**=", "<<=", ">>=", "&&=", "||=", "??=", "+=", "-=", "*=", "/=", "%=", "&=", "|=", "^=", "="}
+
+// checkDeclarations reports a let, const, class or import declared twice
+// in one scope, and an assignment to a const or an import: mistakes the
+// output would only reveal when it runs. The document is read as a tree,
+// as validateDocument reads it, with a scope for each block tag and for
+// each pair of braces in the code between tags.
+func (p *MarkupParser) checkDeclarations() {
+	tree := NewMarkupParser(p.input, p.targetLang)
+	tree.strictTags = p.strictTags
+
+	// the tree's syntax errors are left to the transpiling pass
+	var tags, runs []*MarkupTag
+	nodes := tree.parseDocument()
+	for i := range nodes {
+		if nodes[i].Name == "" {
+			runs = append(runs, &nodes[i])
+		} else {
+			tags = append(tags, &nodes[i])
+		}
+	}
+
+	scope := newDeclScope(nil)
+	p.declareTags(scope, tags)
+	for _, r := range runs {
+		at := func(token Token) Diagnostic {
+			column := token.Column
+			if token.Line == 1 {
+				column += r.Column - 1
+			}
+			return Diagnostic{Line: r.Line + token.Line - 1, Column: column, Length: utf8.RuneCountInString(token.Text)}
+		}
+		checkCode(scope, codeTokens(r.Content), at, p.reportError)
+		p.checkExponents(r.Content, at)
+	}
+	for _, tag := range tags {
+		p.checkTag(scope, tag)
+	}
+	scope.table.resolve(p.report)
+}
+
+// reportError records d as an error
+func (p *MarkupParser) reportError(d Diagnostic) {
+	d.Severity = SeverityError
+	p.report(d)
+}
+
+// declareTags declares the names tags add to the scope they are in
+func (p *MarkupParser) declareTags(scope *declScope, tags []*MarkupTag) {
+	for _, tag := range tags {
+		spec, ok := p.lookupTag(tag.Name)
+		if !ok {
+			continue
+		}
+		var names []string
+		keyword := ""
+		switch spec.names[0] {
+		case "var":
+			keyword = "let"
+			if name := strings.ToLower(tag.Name); name == "const" || name == "var" {
+				keyword = name
+			}
+			names = []string{variableName(tag)}
+		case "function":
+			keyword, names = "function", []string{tag.Attributes["name"]}
+		case "extend", "record":
+			keyword, names = "class", []string{tag.Attributes["name"]}
+		case "import":
+			keyword = "import"
+			names = append(listNames(tag.Attributes["items"]), tag.Attributes["default"], tag.Attributes["as"])
+		case "switch", "readfile":
+			keyword = tag.Attributes["keyword"]
+			if keyword == "" {
+				keyword = "const"
+			}
+			names = []string{tag.Attributes["into"], tag.Attributes["var"]}
+		}
+		for _, name := range names {
+			if !scope.declareSymbol(name, keyword, tagDiagnostic(tag, "", "")) {
+				p.tagError(tag, CodeRedeclaredVariable, fmt.Sprintf("'%s' is already declared in this scope", name))
+			}
+		}
+		p.readTag(scope, tag)
+	}
+}
+
+// readTag records the names tag's expressions read in scope: its
+// expression attributes, its value if it declares a variable, and what
+// it prints, returns, awaits or writes
+func (p *MarkupParser) readTag(scope *declScope, tag *MarkupTag) {
+	spec, ok := p.lookupTag(tag.Name)
+	if !ok {
+		return
+	}
+	at := func(Token) Diagnostic {
+		return tagDiagnostic(tag, "", "")
+	}
+	read := func(expression string) {
+		checkCode(scope, codeTokens(expression), at, p.reportError)
+		p.checkExponents(expression, at)
+	}
+	for _, attr := range spec.attributes {
+		value, ok := tag.Attributes[attr.name]
+		switch {
+		case !ok:
+		case attr.kind == attrExpression, attr.kind == attrIdentifier && spec.names[0] == "export":
+			read(value)
+		case attr.name == "names" && spec.names[0] == "export":
+			// "name" or "name as alias"
+			for _, entry := range strings.Split(value, ",") {
+				if fields := strings.Fields(entry); len(fields) > 0 {
+					read(fields[0])
+				}
+			}
+		}
+	}
+	switch spec.names[0] {
+	case "print", "return", "await", "writefile":
+		read(tag.Content)
+	case "var":
+		value := tag.Content
+		if _, after, ok := strings.Cut(value, "="); ok && tag.Attributes["name"] == "" {
+			value = after
+		}
+		read(value)
+	}
+}
+
+// variableName returns the name a variable tag declares, from its name
+// attribute or its "name = value" body
+func variableName(tag *MarkupTag) string {
+	name := tag.Attributes["name"]
+	if before, _, ok := strings.Cut(tag.Content, "="); name == "" && ok {
+		name = strings.TrimSpace(before)
+	}
+	return name
+}
+
+// checkTag checks a block tag's code and children in a scope of its own,
+// then its branches
+func (p *MarkupParser) checkTag(scope *declScope, tag *MarkupTag) {
+	defer func() {
+		for i := range tag.Branches {
+			p.readTag(scope, &tag.Branches[i])
+			p.checkTag(scope, &tag.Branches[i])
+		}
+	}()
+	spec, ok := p.lookupTag(tag.Name)
+	if !ok || spec.content != "block" {
+		return
+	}
+
+	inner := newDeclScope(scope)
+	switch spec.names[0] {
+	case "loop":
+		// the loop variable lives in the loop's head; the body may
+		// shadow it
+		variable, keyword := tag.Attributes["var"], "let"
+		if _, ok := tag.Attributes["in"]; ok {
+			keyword = "const"
+			if variable == "" {
+				variable = "item"
+			}
+		} else if variable == "" {
+			variable = "i"
+		}
+		inner.declare(variable, keyword)
+		inner = newDeclScope(inner)
+	case "function", "method":
+		for _, name := range listNames(tag.Attributes["params"]) {
+			inner.declare(name, "param")
+		}
+	case "catch":
+		name := tag.Attributes["error"]
+		if name == "" {
+			name = "e"
+		}
+		inner.declare(name, "param")
+	case "extend":
+		inner.classBody = true
+	}
+
+	children := make([]*MarkupTag, len(tag.Children))
+	for i := range tag.Children {
+		children[i] = &tag.Children[i]
+	}
+	p.declareTags(inner, children)
+	at := func(Token) Diagnostic {
+		return tagDiagnostic(tag, "", "")
+	}
+	checkCode(inner, codeTokens(tag.Content), at, p.reportError)
+	p.checkExponents(tag.Content, at)
+	for _, child := range children {
+		p.checkTag(inner, child)
+	}
+}
+
+// checkExponents reports the prefix operators before ** in code, which
+// JavaScript rejects (see checkExponents), positioned by at. Code's
+// brackets may close in other code, so those errors are left to the
+// transpiling pass.
+func (p *MarkupParser) checkExponents(code string, at func(Token) Diagnostic) {
+	_, errs := ParseEmoji(code)
+	for _, err := range errs {
+		if err.Code != CodeInvalidExpression {
+			continue
+		}
+		d := at(Token{Kind: TokenPunct, Line: err.Line, Column: err.Column})
+		d.Message, d.Code = err.Message, err.Code
+		p.reportError(d)
+	}
+}
+
+// checkCode declares the names tokens declare in scope, with a scope for
+// each pair of braces and each arrow function's expression body, and
+// records the names they read in the scope's symbol table. What declaring
+// or assigning a name gets wrong is reported through report, positioned
+// by at.
+func checkCode(scope *declScope, tokens []Token, at func(Token) Diagnostic, report func(Diagnostic)) {
+	scopes := []*declScope{scope}
+	var open []string          // the brackets open, innermost last
+	var groups [][]pendingName // the names declared in each open '('
+	var params []bool          // whether each open '(' may be a parameter list
+	var pending []pendingName  // names the next '{' block declares
+	var arrows []int           // how many brackets were open at each arrow's expression body
+	declaring, declaringDepth := "", 0
+	exporting, classNext := false, false
+
+	text := func(i int) string {
+		if i < 0 || i >= len(tokens) {
+			return ""
+		}
+		return tokens[i].Text
+	}
+	problem := func(token Token, code, message string) {
+		d := at(token)
+		d.Code, d.Message = code, message
+		report(d)
+	}
+	declare := func(token Token, keyword string) {
+		if len(open) > 0 && open[len(open)-1] == "(" {
+			groups[len(groups)-1] = append(groups[len(groups)-1], pendingName{name: token.Text, keyword: keyword, at: at(token)})
+			return
+		}
+		declared := scopes[len(scopes)-1].declare
+		if !exporting {
+			declared = func(name, keyword string) bool {
+				return scopes[len(scopes)-1].declareSymbol(name, keyword, at(token))
+			}
+		}
+		if !declared(token.Text, keyword) {
+			problem(token, CodeRedeclaredVariable, fmt.Sprintf("'%s' is already declared in this scope", token.Text))
+		}
+	}
+	// declarePattern declares the name or destructuring pattern at i and
+	// returns the index of its last token
+	declarePattern := func(i int, keyword string) int {
+		if tokens[i].Kind == TokenIdent {
+			declare(tokens[i], keyword)
+			return i
+		}
+		if closer, ok := closers[tokens[i].Text]; ok && tokens[i].Text != "(" {
+			depth := 0
+			for j := i; j < len(tokens); j++ {
+				switch {
+				case tokens[j].Text == tokens[i].Text:
+					depth++
+				case tokens[j].Text == closer:
+					if depth--; depth == 0 {
+						return j
+					}
+				case tokens[j].Kind == TokenIdent && text(j+1) != ":" && text(j-1) != "." && !strings.HasPrefix(text(j-1), "="):
+					declare(tokens[j], keyword)
+				}
+			}
+		}
+		return i - 1
+	}
+	// declareImports declares the names the import statement after i
+	// brings in and returns the index of its last token
+	declareImports := func(i int) int {
+		for ; i < len(tokens) && tokens[i].Kind != TokenString && tokens[i].Text != ";"; i++ {
+			if tokens[i].Kind == TokenIdent && !scopeKeywords[tokens[i].Text] && text(i+1) != "as" {
+				declare(tokens[i], "import")
+			}
+		}
+		return i
+	}
+	// exported reports whether the declaration keyword at i follows
+	// "export", as in "export default async function"
+	exported := func(i int) bool {
+		for i--; text(i) == "async" || text(i) == "default"; i-- {
+		}
+		return text(i) == "export"
+	}
+	// property reports whether the name at i is a property or method
+	// being defined, or a label, rather than a variable being read
+	property := func(i int) bool {
+		prev, next := text(i-1), text(i+1)
+		switch {
+		case next == ":" && (prev == "" || strings.Contains("{,;}", prev)):
+			return true
+		case prev == "break" || prev == "continue":
+			return true
+		case next == "(":
+			// "name(params) {" defines a method
+			depth := 0
+			for j := i + 1; j < len(tokens); j++ {
+				switch tokens[j].Text {
+				case "(":
+					depth++
+				case ")":
+					if depth--; depth == 0 {
+						return text(j+1) == "{"
+					}
+				}
+			}
+		}
+		return false
+	}
+
+	for i := 0; i < len(tokens); i++ {
+		token := tokens[i]
+		for len(arrows) > 0 && (len(open) < arrows[len(arrows)-1] || len(open) == arrows[len(arrows)-1] && endsArrow(token)) {
+			arrows, scopes = arrows[:len(arrows)-1], scopes[:len(scopes)-1]
+		}
+		switch {
+		case token.Kind == TokenIdent && text(i-1) != ".":
+			switch token.Text {
+			case "let", "const", "var":
+				if i+1 < len(tokens) {
+					declaring, declaringDepth = token.Text, len(open)
+					exporting = exported(i)
+					i = declarePattern(i+1, token.Text)
+				}
+				continue
+			case "function", "class":
+				classNext = token.Text == "class"
+				if i+1 < len(tokens) && tokens[i+1].Kind == TokenIdent && !scopeKeywords[tokens[i+1].Text] {
+					exporting = exported(i)
+					i++
+					declare(tokens[i], token.Text)
+					exporting = false
+				}
+				continue
+			case "import":
+				if next := text(i + 1); next != "(" && next != "." {
+					i = declareImports(i + 1)
+				}
+				continue
+			}
+			if strings.HasPrefix(text(i+1), "=>") {
+				pending = []pendingName{{name: token.Text, keyword: "param"}}
+				continue
+			}
+			if len(params) > 0 && params[len(params)-1] && open[len(open)-1] == "(" {
+				// a parameter, or an argument: either way not assigned
+				groups[len(groups)-1] = append(groups[len(groups)-1], pendingName{name: token.Text, keyword: "param", at: at(token), scope: scopes[len(scopes)-1]})
+				continue
+			}
+			if scopeKeywords[token.Text] || scopes[len(scopes)-1].classBody || property(i) {
+				continue
+			}
+			before := text(i - 2)
+			if i >= 2 && tokens[i-1].Line > tokens[i-2].Line {
+				// "++" or "--" can't end a line's expression
+				before = ""
+			}
+			write := assigns(text(i+1)) || prefixUpdate(text(i-1), before)
+			if write {
+				switch lookupPending(groups, token.Text, scopes[len(scopes)-1]) {
+				case "const":
+					problem(token, CodeConstAssignment, fmt.Sprintf("'%s' is a constant and can't be reassigned", token.Text))
+				case "import":
+					problem(token, CodeConstAssignment, fmt.Sprintf("'%s' is an import and can't be reassigned", token.Text))
+				}
+			}
+			if !usePending(groups, token.Text) {
+				scopes[len(scopes)-1].read(token.Text, write, true, at(token))
+			}
+		case token.Kind != TokenPunct:
+		case token.Text == "(":
+			open = append(open, "(")
+			groups = append(groups, nil)
+			switch text(i - 1) {
+			case "if", "while", "for", "switch", "with":
+				params = append(params, false)
+			default:
+				params = append(params, true)
+			}
+		case token.Text == ")" && len(open) > 0 && open[len(open)-1] == "(":
+			group, isParams := groups[len(groups)-1], params[len(params)-1]
+			open, groups, params = open[:len(open)-1], groups[:len(groups)-1], params[:len(params)-1]
+			next := text(i + 1)
+			if next != "{" && !strings.HasPrefix(next, "=>") {
+				// the parentheses held arguments or an expression
+				for _, name := range group {
+					if name.keyword == "param" {
+						name.scope.read(name.name, false, true, name.at)
+					}
+				}
+				continue
+			}
+			pending = nil
+			for _, name := range group {
+				if isParams || name.keyword != "param" {
+					pending = append(pending, name)
+				}
+			}
+		case strings.HasPrefix(token.Text, "=>") && text(i+1) != "{":
+			body := newDeclScope(scopes[len(scopes)-1])
+			for _, name := range pending {
+				body.declarePending(name)
+			}
+			scopes, arrows = append(scopes, body), append(arrows, len(open))
+			pending = nil
+		case token.Text == "{":
+			open = append(open, "{")
+			block := newDeclScope(scopes[len(scopes)-1])
+			block.classBody = classNext
+			for _, name := range pending {
+				block.declarePending(name)
+			}
+			scopes = append(scopes, block)
+			pending, classNext = nil, false
+		case token.Text == "}" && len(open) > 0 && open[len(open)-1] == "{":
+			open, scopes = open[:len(open)-1], scopes[:len(scopes)-1]
+		case token.Text == "[":
+			open = append(open, "[")
+		case token.Text == "]" && len(open) > 0 && open[len(open)-1] == "[":
+			open = open[:len(open)-1]
+		case token.Text == "," && declaring != "" && len(open) == declaringDepth && i+1 < len(tokens):
+			i = declarePattern(i+1, declaring)
+		case token.Text == ";":
+			declaring, exporting = "", false
+		}
+		if len(open) < declaringDepth {
+			declaring, exporting = "", false
+		}
+	}
+}
+
+// statementKeywords start a statement, ending an arrow function's
+// expression body before them
+var statementKeywords = map[string]bool{
+	"let": true, "const": true, "var": true, "function": true, "class": true,
+	"if": true, "for": true, "while": true, "do": true, "return": true,
+	"switch": true, "try": true, "throw": true, "import": true, "export": true,
+}
+
+// endsArrow reports whether token ends an arrow function's expression
+// body when no bracket opened in the body is still open
+func endsArrow(token Token) bool {
+	switch token.Kind {
+	case TokenPunct:
+		return len(token.Text) == 1 && strings.Contains(",;)]}", token.Text)
+	case TokenIdent:
+		return statementKeywords[token.Text]
+	}
+	return false
+}
+
+// usePending marks name used if the open parentheses declare it, as a
+// for loop's head declares its variable, reporting whether they did
+func usePending(groups [][]pendingName, name string) bool {
+	for i := len(groups) - 1; i >= 0; i-- {
+		for j := range groups[i] {
+			if groups[i][j].name == name && groups[i][j].keyword != "param" {
+				groups[i][j].used = true
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// lookupPending returns the keyword of the innermost declaration of name,
+// looking in the open parentheses' names before scope
+func lookupPending(groups [][]pendingName, name string, scope *declScope) string {
+	for i := len(groups) - 1; i >= 0; i-- {
+		for _, pending := range groups[i] {
+			if pending.name == name {
+				return pending.keyword
+			}
+		}
+	}
+	return scope.lookup(name)
+}
+
+// codeTokens lexes code without spaces and comments, joining adjacent
+// operator characters into one token, as in "+=" or "=>"
+func codeTokens(code string) []Token {
+	lexed, _ := Lex(code)
+	return joinOperators(lexed)
+}
+
+// joinOperators drops the spaces and comments from lexed tokens and joins
+// adjacent operator characters
+func joinOperators(lexed []Token) []Token {
+	var tokens []Token
+	joinable := false
+	for _, token := range lexed {
+		switch {
+		case token.Kind == TokenSpace || token.Kind == TokenComment:
+			joinable = false
+			continue
+		case token.Kind == TokenPunct && strings.Contains("=+-*/%&|^<>!?~", token.Text):
+			if joinable {
+				tokens[len(tokens)-1].Text += token.Text
+				continue
+			}
+			joinable = true
+		default:
+			joinable = false
+		}
+		tokens = append(tokens, token)
+	}
+	return tokens
+}
+
+// assigns reports whether op, an operator after a name, assigns to it:
+// an assignment operator, possibly run together with a unary operator
+// as in "x=-1", or "++" or "--"
+func assigns(op string) bool {
+	if strings.HasPrefix(op, "++") || strings.HasPrefix(op, "--") {
+		return true
+	}
+	for _, assign := range assignOperators {
+		if rest, ok := strings.CutPrefix(op, assign); ok {
+			return strings.Trim(rest, "+-!~") == "" && !strings.HasPrefix(rest, "=") && !strings.HasPrefix(rest, ">")
+		}
+	}
+	return false
+}
+
+// prefixUpdate reports whether op, before a name, is a prefix "++" or
+// "--" rather than one ending the expression before it
+func prefixUpdate(op, before string) bool {
+	if !strings.HasSuffix(op, "++") && !strings.HasSuffix(op, "--") {
+		return false
+	}
+	if len(op) > 2 {
+		return true
+	}
+	return before == "" || strings.ContainsAny(before[len(before)-1:], "=(,;{}[:?&|!+-*/%<>")
+}
@@ -2,37 +2,67 @@ package transpiler
 
 import (
 	"fmt"
-	"regexp"
 	"strings"
+	"time"
+	"unicode/utf8"
 )
 
-// MarkupTag represents a parsed HTML-like tag
+// MarkupTag represents a parsed HTML-like tag. The tree also holds the
+// code between tags as nodes without a Name, whose Content is the code,
+// and, when parsing partially, a node with the Error of each top-level
+// tag that failed to parse.
 type MarkupTag struct {
-	Name       string
-	Attributes map[string]string
-	Content    string
-	Children   []MarkupTag
-	Line       int
-	Column     int
+	Name       string            `json:"name,omitempty"`
+	Attributes map[string]string `json:"attributes,omitempty"`
+	// Content is the code in the tag's body, without the tags nested in
+	// it. Transpiling the tag replaces it with the transpiled body.
+	Content string `json:"content,omitempty"`
+	// Children are the body's nested tags and the code between them, in
+	// order
+	Children []MarkupTag `json:"children,omitempty"`
+	// Branches are the <elif> and <else> tags chained to an <if>
+	Branches []MarkupTag `json:"branches,omitempty"`
+	Error    string      `json:"error,omitempty"`
+	// Line and Column are where a tag's attributes start, just past its
+	// name, and where code starts
+	Line    int               `json:"line"`
+	Column  int               `json:"column"`
+	chained bool              // a branch parseBranches attached to its <if>
+	valueAt map[string][2]int // where each attribute's value starts
 }
 
 // MarkupParser handles the parsing and transpilation of HTML-like markup syntax
 type MarkupParser struct {
-	input        string
-	position     int
-	line         int
-	column       int
-	errors       []string
-	warnings     []string
-	targetLang   string
-	indentLevel  int
-	scopeVars    map[string]bool // Track variable scope
+	input               string
+	position            int
+	line                int
+	column              int
+	errors              []string
+	warnings            []string
+	diagnostics         []Diagnostic // errors and warnings, positioned
+	at                  *MarkupTag   // the tag being transpiled, for positions
+	targetLang          string
+	indentLevel         int
+	scopeVars           map[string]bool       // Track variable scope
+	partial             bool                  // Keep going past errors, leaving placeholders
+	strictTags          bool                  // Match tag names case-sensitively
+	strictSchema        bool                  // Validate the whole document before generating code
+	sanitize            SanitizePolicy        // What to do with dangerous patterns in code
+	sanitized           []Sanitization        // Every dangerous pattern found
+	asciiIdentifiers    bool                  // Reject identifiers outside ASCII
+	checkOnly           bool                  // Report problems, including unbalanced brackets, without output
+	renameReservedWords bool                  // Rename reserved words used as names instead of failing
+	renames             map[string]string     // Reserved words renamed so far
+	symbols             []Symbol              // Functions and classes declared so far
+	doc                 string                // The last <comment>'s text, until something else comes
+	shifts              map[int][]columnShift // Words whose emoji conversion moved columns, by line
+	profile             *Profile              // Time spent in each phase, when profiled
 }
 
 // NewMarkupParser creates a new parser instance
 func NewMarkupParser(input, targetLang string) *MarkupParser {
 	return &MarkupParser{
-		input:      input,
+		input:      NormalizeNewlines(input),
 		targetLang: targetLang,
 		line:       1,
 		column:     1,
@@ -47,66 +77,179 @@ func (p *MarkupParser) Parse() (string, error) {
 	}
 
 	// First pass: Convert emojis to keywords if present
+	start := time.Now()
 	p.input = p.convertEmojisToKeywords(p.input)
+	start = p.profile.since(phaseLex, start)
+	if p.renameReservedWords {
+		p.collectRenames()
+	}
 
-	// Second pass: Parse markup tags
-	result := &strings.Builder{}
-	
+	if p.strictSchema {
+		if problems := p.validateDocument(); len(problems) > 0 {
+			messages := make([]string, len(problems))
+			for i, problem := range problems {
+				messages[i] = problem.Message
+				p.report(problem)
+			}
+			return "", fmt.Errorf("schema errors: %s", strings.Join(messages, "; "))
+		}
+	}
+	p.checkDeclarations()
+	start = p.profile.since(phaseAnalyze, start)
+
+	// Second pass: parse the document into its tree, then transpile it
+	nodes := p.parseDocument()
+	start = p.profile.since(phaseParse, start)
+	result := p.transpileDocument(nodes)
+	defer p.profile.since(phaseGenerate, start)
+
+	if p.checkOnly {
+		if len(p.errors) > 0 {
+			return "", fmt.Errorf("parsing errors: %s", strings.Join(p.errors, "; "))
+		}
+		return "", nil
+	}
+
+	output := result
+
+	if len(p.errors) > 0 {
+		return output, fmt.Errorf("parsing errors: %s", strings.Join(p.errors, "; "))
+	}
+
+	return output, nil
+}
+
+// ParseTree parses the document into its tree without transpiling it,
+// returning the top-level nodes in order (see MarkupTag). Emoji are
+// converted to keywords as Parse converts them, and positions are in the
+// source as written.
+func (p *MarkupParser) ParseTree() ([]MarkupTag, error) {
+	if strings.TrimSpace(p.input) == "" {
+		return nil, fmt.Errorf("empty input")
+	}
+	p.input = p.convertEmojisToKeywords(p.input)
+	nodes := p.parseDocument()
+	p.sourcePositions(nodes)
+	if len(p.errors) > 0 {
+		return nodes, fmt.Errorf("parsing errors: %s", strings.Join(p.errors, "; "))
+	}
+	return nodes, nil
+}
+
+// parseDocument parses the whole document into its top-level nodes. A
+// tag that fails to parse is reported; the parser moves on a character
+// later, or when parsing partially at the next line, leaving a node with
+// the error in its place.
+func (p *MarkupParser) parseDocument() []MarkupTag {
+	var nodes []MarkupTag
 	for p.position < len(p.input) {
-		if p.peek() == '<' {
+		switch {
+		case p.peek() == '<':
+			start := p.Snapshot()
 			tag, err := p.parseTag()
 			if err != nil {
-				p.errors = append(p.errors, err.Error())
-				p.advance()
+				if !p.partial {
+					p.errorAt(start.line, start.column, 1, CodeMarkupSyntax, err.Error())
+					p.advance()
+					continue
+				}
+				// drop the rest of the line the broken tag starts on,
+				// with anything recorded while parsing it
+				p.Restore(start)
+				p.errorAt(start.line, start.column, 1, CodeMarkupSyntax, err.Error())
+				for p.position < len(p.input) && p.peek() != '\n' {
+					p.advance()
+				}
+				nodes = append(nodes, MarkupTag{Error: err.Error(), Line: start.line, Column: start.column})
 				continue
 			}
-			
-			transpiled := p.transpileTag(tag)
-			result.WriteString(transpiled)
-			result.WriteString("\n")
-		} else if !p.isWhitespace(p.peek()) {
-			// Handle raw code (non-markup)
-			rawCode := p.parseRawCode()
-			result.WriteString(rawCode)
-			result.WriteString("\n")
-		} else {
+			nodes = append(nodes, *tag)
+		case !p.isWhitespace(p.peek()):
+			raw := p.parseRawCode()
+			p.doc = ""
+			nodes = append(nodes, MarkupTag{Content: raw.code, Line: raw.line, Column: raw.column})
+		default:
 			p.advance()
 		}
 	}
+	return nodes
+}
 
-	if len(p.errors) > 0 {
-		return result.String(), fmt.Errorf("parsing errors: %s", strings.Join(p.errors, "; "))
+// transpileDocument transpiles the top-level nodes parseDocument returns
+func (p *MarkupParser) transpileDocument(nodes []MarkupTag) string {
+	result := &strings.Builder{}
+	blocks := &blockTracker{}
+	for i := range nodes {
+		node := &nodes[i]
+		switch {
+		case node.Error != "":
+			result.WriteString(ErrorPlaceholder(node.Error))
+		case node.Name == "":
+			blocks.track(node.Content, node.Line, node.Column)
+			code := p.sanitizeCode(node.Content, node.Line, node.Column)
+			p.declareIn(code)
+			result.WriteString(code)
+		default:
+			result.WriteString(p.transpileTag(node))
+		}
+		result.WriteString("\n")
 	}
+	for _, problem := range blocks.done() {
+		p.report(problem)
+	}
+	return result.String()
+}
 
-	return result.String(), nil
+// sourcePositions moves the nodes' columns from the input with emoji
+// converted back to the source as written
+func (p *MarkupParser) sourcePositions(nodes []MarkupTag) {
+	for i := range nodes {
+		nodes[i].Column = p.sourcePosition(nodes[i].Line, nodes[i].Column)
+		p.sourcePositions(nodes[i].Children)
+		p.sourcePositions(nodes[i].Branches)
+	}
 }
 
-// parseTag parses a single markup tag
+// parseTag parses a single markup tag, indexing the function or class it
+// declares
 func (p *MarkupParser) parseTag() (*MarkupTag, error) {
+	doc, nested := p.doc, len(p.symbols)
+	p.doc = ""
+	tag, err := p.parseTagBody()
+	if err == nil {
+		p.indexTag(tag, doc, nested)
+	}
+	return tag, err
+}
+
+// parseTagBody parses a tag and, unless it is void, its content up to the
+// closing tag
+func (p *MarkupParser) parseTagBody() (*MarkupTag, error) {
 	if p.peek() != '<' {
 		return nil, fmt.Errorf("expected '<' at line %d, column %d", p.line, p.column)
 	}
-	
+
 	p.advance() // consume '<'
-	
+
 	// Check for closing tag
 	if p.peek() == '/' {
 		return p.parseClosingTag()
 	}
-	
+
 	// Parse tag name
-	tagName := p.parseIdentifier()
+	tagName := p.parseTagName()
 	if tagName == "" {
 		return nil, fmt.Errorf("expected tag name at line %d, column %d", p.line, p.column)
 	}
-	
+
 	tag := &MarkupTag{
 		Name:       tagName,
 		Attributes: make(map[string]string),
 		Line:       p.line,
 		Column:     p.column,
+		valueAt:    make(map[string][2]int),
 	}
-	
+
 	// Parse attributes
 	p.skipWhitespace()
 	for p.peek() != '>' && p.peek() != '/' && p.position < len(p.input) {
@@ -114,19 +257,23 @@ func (p *MarkupParser) parseTag() (*MarkupTag, error) {
 		if attrName == "" {
 			break
 		}
-		
+
 		p.skipWhitespace()
 		if p.peek() == '=' {
 			p.advance()
 			p.skipWhitespace()
-			attrValue := p.parseAttributeValue()
-			tag.Attributes[attrName] = attrValue
+			line, column := p.line, p.column
+			if p.peek() == '"' || p.peek() == '\'' {
+				column++
+			}
+			tag.Attributes[attrName] = p.parseAttributeValue()
+			tag.valueAt[attrName] = [2]int{line, column}
 		} else {
 			tag.Attributes[attrName] = "true"
 		}
 		p.skipWhitespace()
 	}
-	
+
 	// Check for self-closing tag
 	if p.peek() == '/' {
 		p.advance()
@@ -136,29 +283,56 @@ func (p *MarkupParser) parseTag() (*MarkupTag, error) {
 		p.advance()
 		return tag, nil
 	}
-	
+
 	if p.peek() != '>' {
 		return nil, fmt.Errorf("expected '>' at line %d, column %d", p.line, p.column)
 	}
 	p.advance() // consume '>'
-	
-	// Parse content until closing tag, handling nested tags
-	content := &strings.Builder{}
-	startPos := p.position
-	
+
+	spec, known := p.lookupTag(tagName)
+	if known && spec.content == "none" {
+		// void tags such as <break> have no body, so a missing '/' is
+		// harmless; an optional closing tag right after is consumed
+		p.skipVoidClosingTag(tagName)
+		return tag, nil
+	}
+
+	// Parse content until closing tag, handling nested tags. The code
+	// between nested tags is kept in runs, positioned so that transpiling
+	// reports problems in it where they are in the source.
+	content := &bodyWriter{block: known && spec.content == "block"}
+	contentStart := p.Snapshot()
+	raw := &strings.Builder{}
+	rawLine, rawColumn := 0, 0
+	collect := func(ch rune) {
+		if raw.Len() == 0 {
+			rawLine, rawColumn = p.line, p.column
+		}
+		if !p.isWhitespace(ch) {
+			p.doc = ""
+		}
+		raw.WriteRune(ch)
+	}
+	flush := func() {
+		if raw.Len() == 0 {
+			return
+		}
+		content.code(raw.String())
+		tag.Children = append(tag.Children, MarkupTag{Content: raw.String(), Line: rawLine, Column: rawColumn})
+		raw.Reset()
+	}
+
 	for p.position < len(p.input) {
 		if p.peek() == '<' {
 			// Check if it's a closing tag
 			if p.peekNext() == '/' {
 				// Peek ahead to see if it's OUR closing tag
-				savedPos := p.position
-				savedLine := p.line
-				savedCol := p.column
-				
+				saved := p.Snapshot()
+
 				p.advance() // <
 				p.advance() // /
-				closingName := p.parseIdentifier()
-				
+				closingName := p.parseTagName()
+
 				if closingName == tagName {
 					// This is our closing tag
 					p.skipWhitespace()
@@ -166,166 +340,336 @@ func (p *MarkupParser) parseTag() (*MarkupTag, error) {
 						return nil, fmt.Errorf("expected '>' in closing tag at line %d", p.line)
 					}
 					p.advance() // consume '>'
-					
+
+					flush()
 					tag.Content = strings.TrimSpace(content.String())
+					if spec == markupTagIndex["if"] {
+						if err := p.parseBranches(tag); err != nil {
+							return nil, err
+						}
+					}
 					return tag, nil
 				} else {
 					// Not our closing tag, restore position and continue
-					p.position = savedPos
-					p.line = savedLine
-					p.column = savedCol
-					content.WriteByte(p.peek())
+					p.Restore(saved)
+					collect(p.peek())
 					p.advance()
 				}
 			} else {
 				// It's a nested opening tag - parse it recursively
+				flush()
 				nestedTag, err := p.parseTag()
 				if err != nil {
 					return nil, err
 				}
 				tag.Children = append(tag.Children, *nestedTag)
-				// Add the transpiled nested tag to content
-				content.WriteString(p.transpileTag(nestedTag))
+				content.tag("")
 			}
 		} else {
-			content.WriteByte(p.peek())
+			collect(p.peek())
 			p.advance()
 		}
 	}
-	
+
 	// If we reach here, no closing tag was found
-	p.position = startPos
+	p.Restore(contentStart)
 	return nil, fmt.Errorf("unclosed tag <%s> at line %d, column %d", tagName, tag.Line, tag.Column)
 }
 
+// skipVoidClosingTag consumes </tagName>, allowing whitespace before
+// it, if that is what comes next
+func (p *MarkupParser) skipVoidClosingTag(tagName string) {
+	saved := p.Snapshot()
+	p.skipWhitespace()
+	if p.peek() == '<' && p.peekNext() == '/' {
+		p.advance()
+		p.advance()
+		if p.sameTag(p.parseTagName(), tagName) {
+			p.skipWhitespace()
+			if p.peek() == '>' {
+				p.advance()
+				return
+			}
+		}
+	}
+	p.Restore(saved)
+}
+
+// parseBranches attaches the <elif> and <else> tags that follow an <if>,
+// with only whitespace between, to it as Branches, so the whole chain
+// transpiles as one statement. A chain ends at its <else>.
+func (p *MarkupParser) parseBranches(tag *MarkupTag) error {
+	for {
+		saved := p.Snapshot()
+		p.skipWhitespace()
+		spec := p.nextTagSpec()
+		if spec == nil || markupFollows[spec.names[0]] == nil {
+			p.Restore(saved)
+			return nil
+		}
+		branch, err := p.parseTag()
+		if err != nil {
+			return err
+		}
+		branch.chained = true
+		tag.Branches = append(tag.Branches, *branch)
+		if spec == markupTagIndex["else"] {
+			return nil
+		}
+	}
+}
+
+// nextTagSpec returns the spec of the opening tag at the parser's
+// position, or nil if there is none or it is unknown
+func (p *MarkupParser) nextTagSpec() *markupTagSpec {
+	if p.peek() != '<' || p.peekNext() == '/' {
+		return nil
+	}
+	saved := p.Snapshot()
+	p.advance()
+	name := p.parseTagName()
+	p.Restore(saved)
+	spec, _ := p.lookupTag(name)
+	return spec
+}
+
 // parseClosingTag parses a closing tag like </print>
 func (p *MarkupParser) parseClosingTag() (*MarkupTag, error) {
 	if p.peek() != '<' {
 		return nil, fmt.Errorf("expected '<'")
 	}
 	p.advance()
-	
+
 	if p.peek() != '/' {
 		return nil, fmt.Errorf("expected '/'")
 	}
 	p.advance()
-	
-	tagName := p.parseIdentifier()
+
+	tagName := p.parseTagName()
 	if tagName == "" {
 		return nil, fmt.Errorf("expected tag name in closing tag")
 	}
-	
+
 	p.skipWhitespace()
 	if p.peek() != '>' {
 		return nil, fmt.Errorf("expected '>' in closing tag")
 	}
 	p.advance()
-	
+
 	return &MarkupTag{Name: tagName}, nil
 }
 
+// parseTagName parses a tag name, with its namespace if it has one, as
+// in <es:print>
+func (p *MarkupParser) parseTagName() string {
+	name := p.parseIdentifier()
+	if name != "" && p.peek() == ':' {
+		p.advance()
+		name += ":" + p.parseIdentifier()
+	}
+	return name
+}
+
 // parseIdentifier parses an identifier (tag name or attribute name)
 func (p *MarkupParser) parseIdentifier() string {
 	result := &strings.Builder{}
-	
+
 	for p.position < len(p.input) {
 		ch := p.peek()
-		if (ch >= 'a' && ch <= 'z') || (ch >= 'A' && ch <= 'Z') || 
-		   (ch >= '0' && ch <= '9') || ch == '-' || ch == '_' {
-			result.WriteByte(ch)
+		if (ch >= 'a' && ch <= 'z') || (ch >= 'A' && ch <= 'Z') ||
+			(ch >= '0' && ch <= '9') || ch == '-' || ch == '_' {
+			result.WriteRune(ch)
 			p.advance()
 		} else {
 			break
 		}
 	}
-	
+
 	return result.String()
 }
 
 // parseAttributeValue parses an attribute value (quoted or unquoted)
 func (p *MarkupParser) parseAttributeValue() string {
 	p.skipWhitespace()
-	
+
 	if p.peek() == '"' || p.peek() == '\'' {
 		quote := p.peek()
 		p.advance()
-		
+
 		result := &strings.Builder{}
 		for p.position < len(p.input) && p.peek() != quote {
 			if p.peek() == '\\' {
 				p.advance()
 				if p.position < len(p.input) {
-					result.WriteByte(p.peek())
+					result.WriteRune(p.peek())
 					p.advance()
 				}
 			} else {
-				result.WriteByte(p.peek())
+				result.WriteRune(p.peek())
 				p.advance()
 			}
 		}
-		
+
 		if p.peek() == quote {
 			p.advance()
 		}
-		
+
 		return result.String()
 	}
-	
+
 	// Unquoted value
 	result := &strings.Builder{}
 	for p.position < len(p.input) {
 		ch := p.peek()
 		if ch != '>' && ch != ' ' && ch != '\t' && ch != '\n' && ch != '\r' {
-			result.WriteByte(ch)
+			result.WriteRune(ch)
 			p.advance()
 		} else {
 			break
 		}
 	}
-	
+
 	return result.String()
 }
 
-// parseRawCode parses code outside of markup tags
-func (p *MarkupParser) parseRawCode() string {
+// rawSegment is code outside markup tags, with the line and column it
+// starts at
+type rawSegment struct {
+	code         string
+	line, column int
+}
+
+// parseRawCode parses code outside of markup tags, starting at the
+// parser's position
+func (p *MarkupParser) parseRawCode() rawSegment {
+	segment := rawSegment{line: p.line, column: p.column}
 	result := &strings.Builder{}
-	
+
 	for p.position < len(p.input) && p.peek() != '<' {
-		result.WriteByte(p.peek())
+		result.WriteRune(p.peek())
 		p.advance()
 	}
-	
-	return strings.TrimSpace(result.String())
+
+	segment.code = strings.TrimSpace(result.String())
+	return segment
+}
+
+// ParserState is a snapshot of the parser's position and of what it has
+// recorded so far, taken with Snapshot
+type ParserState struct {
+	position, line, column int
+	indentLevel            int
+	errors, warnings       int
+	diagnostics            int
+	sanitized              int
+	symbols                int
+	doc                    string
+	scopeVars              map[string]bool
+}
+
+// Snapshot saves the parser's state so a lookahead can be undone with
+// Restore
+func (p *MarkupParser) Snapshot() ParserState {
+	scopeVars := make(map[string]bool, len(p.scopeVars))
+	for name := range p.scopeVars {
+		scopeVars[name] = true
+	}
+	return ParserState{
+		position:    p.position,
+		line:        p.line,
+		column:      p.column,
+		indentLevel: p.indentLevel,
+		errors:      len(p.errors),
+		warnings:    len(p.warnings),
+		diagnostics: len(p.diagnostics),
+		sanitized:   len(p.sanitized),
+		symbols:     len(p.symbols),
+		doc:         p.doc,
+		scopeVars:   scopeVars,
+	}
+}
+
+// Restore rewinds the parser to a snapshot taken from it, dropping the
+// errors, warnings, sanitizations and symbols recorded since
+func (p *MarkupParser) Restore(state ParserState) {
+	p.position, p.line, p.column = state.position, state.line, state.column
+	p.indentLevel = state.indentLevel
+	p.errors = p.errors[:min(state.errors, len(p.errors))]
+	p.warnings = p.warnings[:min(state.warnings, len(p.warnings))]
+	p.diagnostics = p.diagnostics[:min(state.diagnostics, len(p.diagnostics))]
+	p.sanitized = p.sanitized[:min(state.sanitized, len(p.sanitized))]
+	p.symbols = p.symbols[:min(state.symbols, len(p.symbols))]
+	p.doc = state.doc
+	p.scopeVars = make(map[string]bool, len(state.scopeVars))
+	for name := range state.scopeVars {
+		p.scopeVars[name] = true
+	}
+}
+
+// Position returns the parser's byte offset in the input and its line
+// and column, both from 1
+func (p *MarkupParser) Position() (offset, line, column int) {
+	return p.position, p.line, p.column
+}
+
+// NextTag skips raw code up to the next tag and parses it as a tree
+// without transpiling it: Content holds the tag's own text and Children
+// its nested tags and the code between them. It returns nil at the end
+// of the input. Emoji aren't converted as they are by Parse, so tools see
+// the source as written. Combined with Snapshot and Restore it lets tools
+// look ahead.
+func (p *MarkupParser) NextTag() (*MarkupTag, error) {
+	for p.position < len(p.input) && p.peek() != '<' {
+		if !p.isWhitespace(p.peek()) {
+			p.doc = ""
+		}
+		p.advance()
+	}
+	if p.position >= len(p.input) {
+		return nil, nil
+	}
+	return p.parseTag()
 }
 
 // Helper methods
-func (p *MarkupParser) peek() byte {
+// peek returns the rune at the parser's position, or 0 at the end. The
+// parser steps through the input a rune at a time so multi-byte
+// characters reach content whole and columns count runes, as in
+// Diagnostic.
+func (p *MarkupParser) peek() rune {
 	if p.position >= len(p.input) {
 		return 0
 	}
-	return p.input[p.position]
+	r, _ := utf8.DecodeRuneInString(p.input[p.position:])
+	return r
 }
 
-func (p *MarkupParser) peekNext() byte {
-	if p.position+1 >= len(p.input) {
+func (p *MarkupParser) peekNext() rune {
+	if p.position >= len(p.input) {
 		return 0
 	}
-	return p.input[p.position+1]
+	_, size := utf8.DecodeRuneInString(p.input[p.position:])
+	if p.position+size >= len(p.input) {
+		return 0
+	}
+	r, _ := utf8.DecodeRuneInString(p.input[p.position+size:])
+	return r
 }
 
 func (p *MarkupParser) advance() {
 	if p.position < len(p.input) {
-		if p.input[p.position] == '\n' {
+		r, size := utf8.DecodeRuneInString(p.input[p.position:])
+		if r == '\n' {
 			p.line++
 			p.column = 1
 		} else {
 			p.column++
 		}
-		p.position++
+		p.position += size
 	}
 }
 
-func (p *MarkupParser) isWhitespace(ch byte) bool {
+func (p *MarkupParser) isWhitespace(ch rune) bool {
 	return ch == ' ' || ch == '\t' || ch == '\n' || ch == '\r'
 }
 
@@ -335,32 +679,234 @@ func (p *MarkupParser) skipWhitespace() {
 	}
 }
 
-// convertEmojisToKeywords converts emoji syntax to keyword equivalents
+// markupEmoji maps the emoji accepted inside markup to the keywords they
+// stand for
+var markupEmoji = map[string]string{
+	"💾":   "var",
+	"🔒":   "const",
+	"📝":   "log",
+	"🔢":   "number",
+	"📊":   "array",
+	"📦":   "object",
+	"⚡":   "function",
+	"🔁":   "loop",
+	"❓":   "if",
+	"✅":   "true",
+	"❌":   "false",
+	"➕":   "+",
+	"➖":   "-",
+	"✖️":  "*",
+	"➗":   "/",
+	"➕🟰":  "+=",
+	"➖🟰":  "-=",
+	"✖️🟰": "*=",
+	"➗🟰":  "/=",
+	"🍰":   "%",
+	"🔺":   "**",
+	"🍰🟰":  "%=",
+	"🔺🟰":  "**=",
+	"➕➕":  "++",
+	"➖➖":  "--",
+	"🛟":   "??=",
+	"📤":   "export",
+	"⏰":   "EmojiTime",
+	"🎤":   "EmojiInput",
+	"🧾":   "JSON.stringify",
+	"📂":   "JSON.parse",
+	"📖":   "EmojiReadFile",
+	"✍️":  "EmojiWriteFile",
+	"🌐":   "EmojiFetch",
+}
+
+// markupEmojiReplacer substitutes markupEmoji, compiled once
+var markupEmojiReplacer = emojiReplacer(markupEmoji)
+
+// convertEmojisToKeywords converts emoji syntax to keyword equivalents.
+// No emoji or shortcode spans whitespace, so it converts a word at a
+// time, recording each word whose length changed: sourcePosition maps
+// positions in the converted input back to the source as written.
 func (p *MarkupParser) convertEmojisToKeywords(input string) string {
-	emojiMap := map[string]string{
-		"💾": "var",
-		"🔒": "const",
-		"📝": "log",
-		"🔢": "number",
-		"📊": "array",
-		"📦": "object",
-		"⚡": "function",
-		"🔁": "loop",
-		"❓": "if",
-		"✅": "true",
-		"❌": "false",
-		"➕": "+",
-		"➖": "-",
-		"✖️": "*",
-		"➗": "/",
-	}
-	
-	result := input
-	for emoji, keyword := range emojiMap {
-		result = strings.ReplaceAll(result, emoji, keyword)
-	}
-	
-	return result
+	b := &strings.Builder{}
+	line, column, converted := 1, 1, 1
+	for input != "" {
+		end := strings.IndexAny(input, " \t\r\n")
+		if end == 0 {
+			if input[0] == '\n' {
+				line, column, converted = line+1, 1, 1
+			} else {
+				column, converted = column+1, converted+1
+			}
+			b.WriteByte(input[0])
+			input = input[1:]
+			continue
+		}
+		if end < 0 {
+			end = len(input)
+		}
+		word := markupEmojiReplacer.Replace(NormalizeVariants(ExpandShortcodes(input[:end])))
+		b.WriteString(word)
+		length, convertedLength := utf8.RuneCountInString(input[:end]), utf8.RuneCountInString(word)
+		if length != convertedLength {
+			if p.shifts == nil {
+				p.shifts = map[int][]columnShift{}
+			}
+			p.shifts[line] = append(p.shifts[line], columnShift{converted, converted + convertedLength, column, column + length})
+		}
+		column, converted = column+length, converted+convertedLength
+		input = input[end:]
+	}
+	return b.String()
+}
+
+// columnShift is a word whose emoji conversion changed its length: it
+// spans columns from to to in the converted line, and source to
+// sourceTo as written
+type columnShift struct {
+	from, to, source, sourceTo int
+}
+
+// sourcePosition maps a column of a line in the converted input to the
+// source as written; a column inside a converted word maps inside the
+// word it came from
+func (p *MarkupParser) sourcePosition(line, column int) int {
+	shifts := p.shifts[line]
+	for i := len(shifts) - 1; i >= 0; i-- {
+		switch shift := shifts[i]; {
+		case column >= shift.to:
+			return shift.sourceTo + column - shift.to
+		case column >= shift.from:
+			return min(shift.source+column-shift.from, shift.sourceTo-1)
+		}
+	}
+	return column
+}
+
+// SetPartial makes Parse keep going past errors: code that fails to parse
+// or transpile is replaced with an ErrorPlaceholder, so the output stays
+// usable while the errors are fixed
+func (p *MarkupParser) SetPartial(partial bool) {
+	p.partial = partial
+}
+
+// SetCheckOnly makes Parse only report problems, with a warning for each
+// name an expression reads that nothing in the program declares; it
+// returns no output
+func (p *MarkupParser) SetCheckOnly(check bool) {
+	p.checkOnly = check
+}
+
+// SetRenameReserved makes a reserved word used as a variable, function,
+// class or parameter name a warning instead of an error: the name gets a
+// '_' suffix, in its declaration and in the expressions that read it, and
+// GetRenames reports the mapping
+func (p *MarkupParser) SetRenameReserved(rename bool) {
+	p.renameReservedWords = rename
+}
+
+// GetRenames maps each reserved word renamed by SetRenameReserved to its
+// new name
+func (p *MarkupParser) GetRenames() map[string]string {
+	return p.renames
+}
+
+// SetASCIIIdentifiers restricts identifiers to ASCII letters, digits, '_'
+// and '$', instead of the Unicode letters the target language allows
+func (p *MarkupParser) SetASCIIIdentifiers(ascii bool) {
+	p.asciiIdentifiers = ascii
+}
+
+// SetStrictTags makes tag names case-sensitive, so <Print> is an unknown
+// tag rather than <print>. Names are case-insensitive by default.
+func (p *MarkupParser) SetStrictTags(strict bool) {
+	p.strictTags = strict
+}
+
+// SetProfile times the phases of Parse in profile
+func (p *MarkupParser) SetProfile(profile *Profile) {
+	p.profile = profile
+}
+
+// SetStrictSchema makes Parse check the whole document against the tag
+// and attribute schema and the nesting rules first, and generate nothing
+// if it breaks them
+func (p *MarkupParser) SetStrictSchema(strict bool) {
+	p.strictSchema = strict
+}
+
+// lookupTag finds the spec for a core tag name
+func (p *MarkupParser) lookupTag(name string) (*markupTagSpec, bool) {
+	if !p.strictTags {
+		name = strings.ToLower(name)
+	}
+	spec, ok := markupTagIndex[name]
+	return spec, ok
+}
+
+// sameTag reports whether two tag names match
+func (p *MarkupParser) sameTag(a, b string) bool {
+	if p.strictTags {
+		return a == b
+	}
+	return strings.EqualFold(a, b)
+}
+
+// ErrorPlaceholder is the comment left in partial output where code
+// failed to transpile
+func ErrorPlaceholder(message string) string {
+	return "/* Error: " + strings.ReplaceAll(message, "*/", "* /") + " */"
+}
+
+// invalid records an error in the tag being transpiled and returns its
+// placeholder
+func (p *MarkupParser) invalid(message string) string {
+	p.tagError(p.at, CodeInvalidTag, message)
+	return p.indent() + ErrorPlaceholder(message)
+}
+
+// report records a diagnostic, and its message as an error or warning
+func (p *MarkupParser) report(d Diagnostic) {
+	if d.Line > 0 && p.shifts != nil {
+		end := p.sourcePosition(d.Line, d.Column+d.Length)
+		d.Column = p.sourcePosition(d.Line, d.Column)
+		d.Length = max(end-d.Column, 1)
+	}
+	if d.Severity == SeverityWarning {
+		p.warnings = append(p.warnings, d.Message)
+	} else {
+		p.errors = append(p.errors, d.Message)
+	}
+	p.diagnostics = append(p.diagnostics, d)
+}
+
+// errorAt records an error spanning length runes from line and column
+func (p *MarkupParser) errorAt(line, column, length int, code, message string) {
+	p.report(Diagnostic{Message: message, Severity: SeverityError, Line: line, Column: column, Length: length, Code: code})
+}
+
+// tagError records an error about tag, marking its opening "<name"; a nil
+// tag has no position
+func (p *MarkupParser) tagError(tag *MarkupTag, code, message string) {
+	d := tagDiagnostic(tag, code, message)
+	d.Severity = SeverityError
+	p.report(d)
+}
+
+// tagWarning records a warning about tag, marking its opening "<name"
+func (p *MarkupParser) tagWarning(tag *MarkupTag, code, message string) {
+	d := tagDiagnostic(tag, code, message)
+	d.Severity = SeverityWarning
+	p.report(d)
+}
+
+// tagDiagnostic positions a diagnostic on tag's "<name". A tag's Column
+// is where its name ends, so the span is counted back from there.
+func tagDiagnostic(tag *MarkupTag, code, message string) Diagnostic {
+	d := Diagnostic{Message: message, Code: code}
+	if tag != nil {
+		d.Length = utf8.RuneCountInString(tag.Name) + 1
+		d.Line, d.Column = tag.Line, max(tag.Column-d.Length, 1)
+	}
+	return d
 }
 
 // GetErrors returns all parsing errors
@@ -373,59 +919,33 @@ func (p *MarkupParser) GetWarnings() []string {
 	return p.warnings
 }
 
+// GetDiagnostics returns every error and warning with its position, in
+// the order they were found
+func (p *MarkupParser) GetDiagnostics() []Diagnostic {
+	return p.diagnostics
+}
+
 // indent returns the current indentation string
 func (p *MarkupParser) indent() string {
 	return strings.Repeat("  ", p.indentLevel)
 }
 
-// sanitizeExpression removes dangerous patterns
-func (p *MarkupParser) sanitizeExpression(expr string) string {
-	// Remove potentially dangerous patterns
-	dangerous := []string{
-		"eval(",
-		"Function(",
-		"__proto__",
-		"constructor",
-	}
-	
-	result := expr
-	for _, pattern := range dangerous {
-		if strings.Contains(strings.ToLower(result), strings.ToLower(pattern)) {
-			p.warnings = append(p.warnings, fmt.Sprintf("potentially unsafe pattern detected: %s", pattern))
-			result = strings.ReplaceAll(result, pattern, "/* UNSAFE: "+pattern+" */")
-		}
-	}
-	
-	return result
-}
-
-// escapeString properly escapes a string for the target language
-func (p *MarkupParser) escapeString(s string) string {
-	s = strings.ReplaceAll(s, "\\", "\\\\")
-	s = strings.ReplaceAll(s, "\"", "\\\"")
-	s = strings.ReplaceAll(s, "\n", "\\n")
-	s = strings.ReplaceAll(s, "\r", "\\r")
-	s = strings.ReplaceAll(s, "\t", "\\t")
-	return s
-}
-
-// validateIdentifier ensures an identifier is valid
+// validateIdentifier ensures an identifier is valid for the target
+// language (see ValidIdentifier)
 func (p *MarkupParser) validateIdentifier(name string) error {
 	if name == "" {
 		return fmt.Errorf("empty identifier")
 	}
-	
-	if matched, _ := regexp.MatchString("^[a-zA-Z_][a-zA-Z0-9_]*$", name); !matched {
+
+	if !ValidIdentifier(name, p.targetLang, p.asciiIdentifiers) {
 		return fmt.Errorf("invalid identifier: %s", name)
 	}
-	
-	// Check reserved words
-	reserved := []string{"if", "else", "for", "while", "function", "return", "const", "let", "var"}
-	for _, word := range reserved {
-		if name == word {
-			return fmt.Errorf("'%s' is a reserved keyword", name)
-		}
+
+	// renamed names were declared under their replacement, so a reserved
+	// word left by then is a method or field name, which may be one
+	if ReservedWord(name, p.targetLang) && !p.renameReservedWords {
+		return fmt.Errorf("'%s' is a reserved keyword", name)
 	}
-	
+
 	return nil
 }
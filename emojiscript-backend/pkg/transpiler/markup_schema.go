@@ -0,0 +1,223 @@
+package transpiler
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// checkAttributes checks a tag's attributes against its spec. It returns
+// an error for each missing or malformed attribute and warns about
+// attributes the tag doesn't read.
+func (p *MarkupParser) checkAttributes(spec *markupTagSpec, tag *MarkupTag) []string {
+	at := fmt.Sprintf("<%s> at line %d, column %d", tag.Name, tag.Line, tag.Column)
+	var problems []string
+
+	known := map[string]bool{}
+	for _, attribute := range spec.attributes {
+		known[attribute.name] = true
+		value, present := tag.Attributes[attribute.name]
+		if !present {
+			if attribute.required {
+				problems = append(problems, fmt.Sprintf("missing required attribute '%s' on %s", attribute.name, at))
+			}
+			continue
+		}
+		if problem := attributeProblem(p, attribute, value); problem != "" {
+			problems = append(problems, fmt.Sprintf("attribute '%s' on %s %s", attribute.name, at, problem))
+		}
+	}
+
+	var unknown []string
+	for name := range tag.Attributes {
+		if !known[name] {
+			unknown = append(unknown, name)
+		}
+	}
+	sort.Strings(unknown)
+	for _, name := range unknown {
+		p.tagWarning(tag, CodeUnknownAttribute, fmt.Sprintf("unknown attribute '%s' on %s", name, at))
+	}
+
+	if groups := markupAttributeGroups[spec.names[0]]; len(groups) > 0 {
+		if problem := groupProblem(groups, tag); problem != "" {
+			problems = append(problems, fmt.Sprintf("%s %s", at, problem))
+		}
+	}
+	return problems
+}
+
+// attributeProblem describes what is wrong with an attribute's value, or
+// returns ""
+func attributeProblem(p *MarkupParser, attribute markupAttribute, value string) string {
+	switch attribute.kind {
+	case attrIdentifier:
+		if err := p.validateIdentifier(value); err != nil {
+			return "must be a name: " + err.Error()
+		}
+	case attrBoolean:
+		if value != "true" && value != "false" {
+			return fmt.Sprintf("must be true or false, not '%s'", value)
+		}
+	case attrKeyword:
+		for _, allowed := range attribute.values {
+			if value == allowed {
+				return ""
+			}
+		}
+		return fmt.Sprintf("must be one of %s, not '%s'", strings.Join(attribute.values, ", "), value)
+	case attrExpression, attrType:
+		if strings.TrimSpace(value) == "" {
+			return "can't be empty"
+		}
+	}
+	return ""
+}
+
+// groupProblem checks that a tag has one complete group of attributes.
+// When a group is started but not finished, it names what is missing.
+func groupProblem(groups [][]string, tag *MarkupTag) string {
+	var started []string
+	for _, group := range groups {
+		var missing []string
+		for _, name := range group {
+			if _, ok := tag.Attributes[name]; !ok {
+				missing = append(missing, name)
+			}
+		}
+		if len(missing) == 0 {
+			return ""
+		}
+		if len(missing) < len(group) && started == nil {
+			started = missing
+		}
+	}
+	if started != nil {
+		return fmt.Sprintf("is missing attribute '%s'", strings.Join(started, "', '"))
+	}
+	alternatives := make([]string, len(groups))
+	for i, group := range groups {
+		alternatives[i] = strings.Join(group, " and ")
+	}
+	return fmt.Sprintf("needs %s", describeAlternatives(alternatives))
+}
+
+// describeAlternatives joins alternatives as "a, b or c"
+func describeAlternatives(alternatives []string) string {
+	if len(alternatives) == 1 {
+		return alternatives[0]
+	}
+	return strings.Join(alternatives[:len(alternatives)-1], ", ") + " or " + alternatives[len(alternatives)-1]
+}
+
+// markupParents lists, by canonical tag name, the tags a tag may only
+// appear directly inside
+var markupParents = map[string][]string{
+	"case":    {"switch"},
+	"default": {"switch"},
+	"method":  {"class"},
+}
+
+// markupFollows lists, by canonical tag name, the tags a tag must come
+// right after, as a branch of the same statement
+var markupFollows = map[string][]string{
+	"elif": {"if", "elif"},
+	"else": {"if", "elif"},
+}
+
+// markupAncestors lists, by canonical tag name, the tags one of which
+// must enclose a tag at some depth
+var markupAncestors = map[string][]string{
+	"break":    {"loop", "while", "switch"},
+	"continue": {"loop", "while"},
+	"return":   {"function", "method", "async"},
+}
+
+// validateDocument checks the whole document against the schema in strict
+// mode: every tag must be known, its attributes must match its spec (an
+// unread attribute is an error, not a warning) and it must be nested
+// where the language allows. It returns every problem found, errors
+// first, all with error severity.
+func (p *MarkupParser) validateDocument() []Diagnostic {
+	tree := NewMarkupParser(p.input, p.targetLang)
+	tree.strictTags = p.strictTags
+	tree.asciiIdentifiers = p.asciiIdentifiers
+	tree.renameReservedWords = p.renameReservedWords
+
+	nodes := tree.parseDocument()
+	for i := range nodes {
+		tree.validateTag(&nodes[i], nil)
+	}
+	var errors, warnings []Diagnostic
+	for _, d := range tree.diagnostics {
+		if d.Severity == SeverityWarning {
+			d.Severity = SeverityError
+			warnings = append(warnings, d)
+			continue
+		}
+		errors = append(errors, d)
+	}
+	return append(errors, warnings...)
+}
+
+// validateTag checks a tag and its children; ancestors holds the specs of
+// the enclosing tags, innermost last
+func (p *MarkupParser) validateTag(tag *MarkupTag, ancestors []*markupTagSpec) {
+	if tag.Name == "" {
+		// code between tags
+		return
+	}
+	at := fmt.Sprintf("<%s> at line %d, column %d", tag.Name, tag.Line, tag.Column)
+	if strings.Contains(tag.Name, ":") {
+		// plugin tags are checked by their handlers
+		for i := range tag.Children {
+			p.validateTag(&tag.Children[i], ancestors)
+		}
+		return
+	}
+	spec, ok := p.lookupTag(tag.Name)
+	if !ok {
+		p.tagError(tag, CodeUnknownTag, fmt.Sprintf("unknown tag %s", at))
+		return
+	}
+	for _, problem := range p.checkAttributes(spec, tag) {
+		p.tagError(tag, CodeInvalidAttribute, problem)
+	}
+
+	if parents, ok := markupParents[spec.names[0]]; ok {
+		if len(ancestors) == 0 || !specNamed(ancestors[len(ancestors)-1], parents) {
+			p.tagError(tag, CodeMisplacedTag, fmt.Sprintf("%s must be directly inside <%s>", at, strings.Join(parents, "> or <")))
+		}
+	}
+	if within, ok := markupAncestors[spec.names[0]]; ok {
+		enclosed := false
+		for _, ancestor := range ancestors {
+			enclosed = enclosed || specNamed(ancestor, within)
+		}
+		if !enclosed {
+			p.tagError(tag, CodeMisplacedTag, fmt.Sprintf("%s must be inside <%s>", at, strings.Join(within, ">, <")))
+		}
+	}
+
+	if follows, ok := markupFollows[spec.names[0]]; ok && !tag.chained {
+		p.tagError(tag, CodeMisplacedTag, fmt.Sprintf("%s must follow <%s>", at, strings.Join(follows, "> or <")))
+	}
+
+	for i := range tag.Children {
+		p.validateTag(&tag.Children[i], append(ancestors, spec))
+	}
+	for i := range tag.Branches {
+		p.validateTag(&tag.Branches[i], ancestors)
+	}
+}
+
+// specNamed reports whether spec is the tag one of names (or their
+// aliases) refers to
+func specNamed(spec *markupTagSpec, names []string) bool {
+	for _, name := range names {
+		if markupTagIndex[name] == spec {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,148 @@
+package transpiler
+
+import (
+	"fmt"
+	"strings"
+)
+
+// knownGlobals are names a program may read without declaring them
+var knownGlobals = map[string]bool{
+	"console": true, "Math": true, "JSON": true, "Object": true, "Array": true,
+	"String": true, "Number": true, "Boolean": true, "Date": true, "Promise": true,
+	"Map": true, "Set": true, "WeakMap": true, "WeakSet": true, "Symbol": true,
+	"BigInt": true, "RegExp": true, "Error": true, "TypeError": true,
+	"RangeError": true, "Intl": true, "Reflect": true, "Proxy": true,
+	"parseInt": true, "parseFloat": true, "isNaN": true, "isFinite": true,
+	"NaN": true, "Infinity": true, "globalThis": true, "window": true,
+	"document": true, "setTimeout": true, "setInterval": true,
+	"clearTimeout": true, "clearInterval": true, "fetch": true, "require": true,
+	"module": true, "exports": true, "process": true, "arguments": true,
+	"structuredClone": true, "queueMicrotask": true,
+}
+
+// scopeKeywords are words the lexer reads as identifiers that are never
+// variables
+var scopeKeywords = map[string]bool{
+	"true": true, "false": true, "null": true, "undefined": true, "this": true,
+	"super": true, "new": true, "typeof": true, "instanceof": true, "in": true,
+	"of": true, "void": true, "delete": true, "await": true, "async": true,
+	"function": true, "class": true, "return": true, "yield": true, "let": true,
+	"const": true, "var": true, "if": true, "else": true, "for": true,
+	"while": true, "do": true, "switch": true, "case": true, "default": true,
+	"break": true, "continue": true, "throw": true, "try": true, "catch": true,
+	"finally": true, "import": true, "export": true, "from": true, "as": true,
+	"extends": true, "static": true, "get": true, "set": true,
+}
+
+// declareKeywords introduce the name after them
+var declareKeywords = map[string]bool{"let": true, "const": true, "var": true, "function": true, "class": true}
+
+// trackScope records the names tag declares in scopeVars, so a reserved
+// word isn't renamed onto one of them, and checks its expressions'
+// brackets. The names are recorded as if markup were one scope; which
+// names are undeclared or unused is found scope by scope, by
+// checkDeclarations.
+func (p *MarkupParser) trackScope(spec *markupTagSpec, tag *MarkupTag) {
+	for _, attr := range spec.attributes {
+		value, ok := tag.Attributes[attr.name]
+		if !ok {
+			continue
+		}
+		switch {
+		case attr.name == "params" || spec.names[0] == "import" && attr.name == "items":
+			for _, name := range listNames(value) {
+				p.scopeVars[name] = true
+			}
+		case attr.kind == attrIdentifier && spec.names[0] == "export":
+			p.checkExpression(tag, value)
+		case attr.kind == attrIdentifier:
+			p.scopeVars[value] = true
+		case attr.kind == attrExpression:
+			p.checkExpression(tag, value)
+		}
+	}
+
+	switch spec.names[0] {
+	case "loop":
+		if tag.Attributes["var"] == "" {
+			p.scopeVars["i"], p.scopeVars["item"] = true, true
+		}
+	case "catch":
+		if tag.Attributes["error"] == "" {
+			p.scopeVars["e"] = true
+		}
+	case "print", "return", "await", "writefile":
+		p.checkExpression(tag, tag.Content)
+	}
+	if spec.content == "block" {
+		p.declareIn(tag.Content)
+	}
+}
+
+// listNames returns the names a parameter or import list declares:
+// "name: Type = default" declares name, and "a as b" declares b
+func listNames(list string) []string {
+	var names []string
+	for _, entry := range strings.Split(list, ",") {
+		fields := strings.Fields(strings.NewReplacer(":", " ", "=", " ").Replace(entry))
+		if len(fields) >= 3 && fields[1] == "as" {
+			fields = fields[2:]
+		}
+		if len(fields) > 0 {
+			names = append(names, strings.TrimPrefix(fields[0], "..."))
+		}
+	}
+	return names
+}
+
+// declareIn records the names raw code declares with let, const, var,
+// function or class
+func (p *MarkupParser) declareIn(code string) {
+	tokens, _ := Lex(code)
+	declare := false
+	for _, token := range tokens {
+		switch token.Kind {
+		case TokenSpace, TokenComment:
+			continue
+		case TokenIdent:
+			if declare {
+				p.scopeVars[token.Text] = true
+			}
+			declare = declareKeywords[token.Text]
+		default:
+			declare = false
+		}
+	}
+}
+
+// checkExpression reports an expression whose brackets don't pair up,
+// when checking
+func (p *MarkupParser) checkExpression(tag *MarkupTag, expression string) {
+	if p.checkOnly {
+		p.checkBrackets(tag, codeTokens(expression))
+	}
+}
+
+// checkBrackets reports an expression whose brackets don't pair up;
+// brackets in strings and comments were lexed away
+func (p *MarkupParser) checkBrackets(tag *MarkupTag, tokens []Token) {
+	var open []string
+	for _, token := range tokens {
+		if token.Kind != TokenPunct || bracketNames[token.Text] == "" {
+			continue
+		}
+		if _, ok := closers[token.Text]; ok {
+			open = append(open, token.Text)
+			continue
+		}
+		if len(open) == 0 || closers[open[len(open)-1]] != token.Text {
+			p.tagError(tag, CodeUnbalancedBracket, fmt.Sprintf("unbalanced %s in <%s>: unexpected '%s'", bracketNames[token.Text], tag.Name, token.Text))
+			return
+		}
+		open = open[:len(open)-1]
+	}
+	if len(open) > 0 {
+		opener := open[len(open)-1]
+		p.tagError(tag, CodeUnbalancedBracket, fmt.Sprintf("unbalanced %s in <%s>: '%s' is never closed", bracketNames[opener], tag.Name, opener))
+	}
+}
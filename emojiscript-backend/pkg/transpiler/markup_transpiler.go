@@ -2,72 +2,192 @@ package transpiler
 
 import (
 	"fmt"
+	"regexp"
 	"strings"
 )
 
+// markupAttribute is an attribute a markup tag reads. kind is what its
+// value holds: an attrIdentifier, attrExpression, attrType, attrBoolean,
+// attrKeyword (one of values) or attrText.
+type markupAttribute struct {
+	name     string
+	required bool
+	kind     string
+	values   []string
+}
+
+// attribute kinds
+const (
+	attrIdentifier = "identifier"
+	attrExpression = "expression"
+	attrType       = "type"
+	attrBoolean    = "boolean"
+	attrKeyword    = "keyword"
+	attrText       = "text"
+)
+
+// markupTagSpec describes a markup tag: its canonical name and aliases,
+// the attributes it reads, what its body holds, and its handler. The
+// table drives both transpilation and the published grammar.
+type markupTagSpec struct {
+	names      []string
+	attributes []markupAttribute
+	// content is "block" (statements), "expression", "text" or "none"
+	content   string
+	transpile func(*MarkupParser, *MarkupTag) string
+}
+
+var markupTags = []markupTagSpec{
+	{[]string{"print", "log", "console"}, []markupAttribute{{"text", false, attrText, nil}}, "expression", (*MarkupParser).transpilePrint},
+	{[]string{"var", "let", "const", "variable"}, []markupAttribute{{"name", false, attrIdentifier, nil}, {"value", false, attrExpression, nil}, {"type", false, attrType, nil}, {"text", false, attrText, nil}}, "expression", (*MarkupParser).transpileVariable},
+	{[]string{"function", "func", "fn"}, []markupAttribute{{"name", true, attrIdentifier, nil}, {"params", false, attrText, nil}, {"returns", false, attrType, nil}, {"async", false, attrBoolean, nil}}, "block", (*MarkupParser).transpileFunction},
+	{[]string{"loop", "for", "foreach", "repeat"}, []markupAttribute{{"var", false, attrIdentifier, nil}, {"from", false, attrExpression, nil}, {"to", false, attrExpression, nil}, {"step", false, attrExpression, nil}, {"in", false, attrExpression, nil}, {"times", false, attrExpression, nil}}, "block", (*MarkupParser).transpileLoop},
+	{[]string{"while"}, []markupAttribute{{"condition", false, attrExpression, nil}}, "block", (*MarkupParser).transpileWhile},
+	{[]string{"if", "condition"}, []markupAttribute{{"condition", false, attrExpression, nil}}, "block", (*MarkupParser).transpileIf},
+	{[]string{"elif", "elseif"}, []markupAttribute{{"condition", true, attrExpression, nil}}, "block", (*MarkupParser).transpileElif},
+	{[]string{"else"}, nil, "block", (*MarkupParser).transpileElse},
+	{[]string{"extend", "class"}, []markupAttribute{{"name", true, attrIdentifier, nil}, {"extends", false, attrExpression, nil}}, "block", (*MarkupParser).transpileClass},
+	{[]string{"method"}, []markupAttribute{{"name", true, attrIdentifier, nil}, {"params", false, attrText, nil}, {"returns", false, attrType, nil}, {"static", false, attrBoolean, nil}, {"async", false, attrBoolean, nil}, {"generator", false, attrBoolean, nil}}, "block", (*MarkupParser).transpileMethod},
+	{[]string{"record", "struct", "data"}, []markupAttribute{{"name", true, attrIdentifier, nil}, {"fields", false, attrText, nil}}, "none", (*MarkupParser).transpileRecord},
+	{[]string{"import", "require", "use"}, []markupAttribute{{"from", true, attrText, nil}, {"items", false, attrText, nil}, {"default", false, attrIdentifier, nil}, {"as", false, attrIdentifier, nil}}, "none", (*MarkupParser).transpileImport},
+	{[]string{"export"}, []markupAttribute{{"name", false, attrIdentifier, nil}, {"default", false, attrBoolean, nil}, {"names", false, attrText, nil}, {"from", false, attrText, nil}}, "expression", (*MarkupParser).transpileExport},
+	{[]string{"return"}, []markupAttribute{{"value", false, attrExpression, nil}}, "expression", (*MarkupParser).transpileReturn},
+	{[]string{"array", "list"}, []markupAttribute{{"items", false, attrExpression, nil}}, "none", (*MarkupParser).transpileArray},
+	{[]string{"object", "dict", "map"}, nil, "expression", (*MarkupParser).transpileObject},
+	{[]string{"try"}, nil, "block", (*MarkupParser).transpileTry},
+	{[]string{"catch"}, []markupAttribute{{"error", false, attrIdentifier, nil}}, "block", (*MarkupParser).transpileCatch},
+	{[]string{"comment"}, nil, "text", (*MarkupParser).transpileComment},
+	{[]string{"async"}, nil, "block", (*MarkupParser).transpileAsync},
+	{[]string{"await"}, nil, "expression", (*MarkupParser).transpileAwait},
+	{[]string{"switch", "match"}, []markupAttribute{{"on", false, attrExpression, nil}, {"into", false, attrIdentifier, nil}, {"keyword", false, attrKeyword, []string{"const", "let", "var"}}}, "block", (*MarkupParser).transpileSwitch},
+	{[]string{"case"}, []markupAttribute{{"value", true, attrExpression, nil}, {"result", false, attrExpression, nil}}, "block", (*MarkupParser).transpileCase},
+	{[]string{"default"}, []markupAttribute{{"result", false, attrExpression, nil}}, "block", (*MarkupParser).transpileDefault},
+	{[]string{"break"}, nil, "none", (*MarkupParser).transpileBreak},
+	{[]string{"continue"}, nil, "none", (*MarkupParser).transpileContinue},
+	{[]string{"readfile"}, []markupAttribute{{"path", true, attrText, nil}, {"var", true, attrIdentifier, nil}, {"keyword", false, attrKeyword, []string{"const", "let", "var"}}}, "none", (*MarkupParser).transpileReadFile},
+	{[]string{"writefile"}, []markupAttribute{{"path", true, attrText, nil}, {"text", false, attrText, nil}}, "expression", (*MarkupParser).transpileWriteFile},
+}
+
+// markupAttributeGroups lists, by canonical tag name, alternative sets of
+// attributes of which a tag needs one complete set
+var markupAttributeGroups = map[string][][]string{
+	"loop": {{"in"}, {"times"}, {"from", "to"}},
+}
+
+// markupTagIndex maps every tag name and alias to its spec
+var markupTagIndex = func() map[string]*markupTagSpec {
+	m := map[string]*markupTagSpec{}
+	for i := range markupTags {
+		for _, name := range markupTags[i].names {
+			m[name] = &markupTags[i]
+		}
+	}
+	return m
+}()
+
+// bodyWriter joins a tag's body from its code and its transpiled nested
+// tags. A block's lines are written without their source indentation:
+// nested tags are transpiled unindented too, and indentBlock then adds
+// one level per tag, so the output's indentation follows the tree's
+// depth.
+type bodyWriter struct {
+	strings.Builder
+	block   bool
+	midLine bool
+}
+
+func (w *bodyWriter) code(code string) {
+	for _, ch := range code {
+		if w.block && !w.midLine && (ch == ' ' || ch == '\t') {
+			continue
+		}
+		w.WriteRune(ch)
+		w.midLine = ch != '\n'
+	}
+}
+
+func (w *bodyWriter) tag(output string) {
+	w.WriteString(output)
+	w.midLine = true
+}
+
+// transpileBody transpiles a tag's body: its code, sanitized a run at a
+// time so reported positions point into the source, and its nested tags
+func (p *MarkupParser) transpileBody(tag *MarkupTag) string {
+	spec, known := p.lookupTag(tag.Name)
+	body := &bodyWriter{block: known && spec.content == "block"}
+	blocks := &blockTracker{in: tag}
+	for i := range tag.Children {
+		child := &tag.Children[i]
+		if child.Name != "" {
+			body.tag(p.transpileTag(child))
+			continue
+		}
+		code := child.Content
+		if body.block {
+			blocks.track(code, child.Line, child.Column)
+		}
+		if !known || spec.content != "text" {
+			code = p.sanitizeCode(code, child.Line, child.Column)
+		}
+		body.code(code)
+	}
+	for _, problem := range blocks.done() {
+		p.report(problem)
+	}
+	return strings.TrimSpace(body.String())
+}
+
 // transpileTag transpiles a single markup tag to the target language
 func (p *MarkupParser) transpileTag(tag *MarkupTag) string {
 	if tag == nil {
 		return ""
 	}
+	outer := p.at
+	p.at = tag
+	defer func() { p.at = outer }()
 
-	switch strings.ToLower(tag.Name) {
-	case "print", "log", "console":
-		return p.transpilePrint(tag)
-	case "var", "let", "const", "variable":
-		return p.transpileVariable(tag)
-	case "function", "func", "fn":
-		return p.transpileFunction(tag)
-	case "loop", "for", "foreach", "repeat":
-		return p.transpileLoop(tag)
-	case "while":
-		return p.transpileWhile(tag)
-	case "if", "condition":
-		return p.transpileIf(tag)
-	case "else":
-		return p.transpileElse(tag)
-	case "extend", "class":
-		return p.transpileClass(tag)
-	case "method":
-		return p.transpileMethod(tag)
-	case "import", "require", "use":
-		return p.transpileImport(tag)
-	case "export":
-		return p.transpileExport(tag)
-	case "return":
-		return p.transpileReturn(tag)
-	case "array", "list":
-		return p.transpileArray(tag)
-	case "object", "dict", "map":
-		return p.transpileObject(tag)
-	case "try":
-		return p.transpileTry(tag)
-	case "catch":
-		return p.transpileCatch(tag)
-	case "comment":
-		return p.transpileComment(tag)
-	case "async":
-		return p.transpileAsync(tag)
-	case "await":
-		return p.transpileAwait(tag)
-	case "switch", "match":
-		return p.transpileSwitch(tag)
-	case "case":
-		return p.transpileCase(tag)
-	case "break":
-		return p.transpileBreak(tag)
-	case "continue":
-		return p.transpileContinue(tag)
-	default:
-		p.warnings = append(p.warnings, fmt.Sprintf("unknown tag: <%s>", tag.Name))
-		return fmt.Sprintf("/* Unknown tag: <%s> */\n%s", tag.Name, tag.Content)
+	p.sanitizeAttributes(tag)
+	if len(tag.Children) > 0 {
+		tag.Content = p.transpileBody(tag)
+	}
+	if namespace, name, ok := strings.Cut(tag.Name, ":"); ok {
+		return p.transpilePluginTag(namespace, name, tag)
 	}
+	if spec, ok := p.lookupTag(tag.Name); ok {
+		if problems := p.checkAttributes(spec, tag); len(problems) > 0 {
+			for _, problem := range problems[1:] {
+				p.tagError(tag, CodeInvalidAttribute, problem)
+			}
+			p.tagError(tag, CodeInvalidAttribute, problems[0])
+			return p.indent() + ErrorPlaceholder(problems[0])
+		}
+		if p.renameReservedWords {
+			p.renameReserved(spec, tag)
+		}
+		p.trackScope(spec, tag)
+		output := spec.transpile(p, tag)
+		// an <if>'s branches continue its statement
+		for i := range tag.Branches {
+			output += " " + strings.TrimLeft(p.transpileTag(&tag.Branches[i]), " ")
+		}
+		return output
+	}
+	p.tagWarning(tag, CodeUnknownTag, fmt.Sprintf("unknown tag: <%s>", tag.Name))
+	return fmt.Sprintf("/* Unknown tag: <%s> */\n%s", tag.Name, tag.Content)
 }
 
-// transpilePrint handles <print>, <log>, <console> tags
+// transpilePrint handles <print>, <log>, <console> tags. The text
+// attribute prints a string as it is written.
 func (p *MarkupParser) transpilePrint(tag *MarkupTag) string {
 	content := strings.TrimSpace(tag.Content)
-	
+	if text, ok := tag.Attributes["text"]; ok {
+		if content != "" {
+			return p.invalid("print can't have both text and a body")
+		}
+		content = quoteString(text, p.targetLang)
+	}
+
 	return fmt.Sprintf("%sconsole.log(%s);", p.indent(), content)
 }
 
@@ -76,7 +196,7 @@ func (p *MarkupParser) transpileVariable(tag *MarkupTag) string {
 	name := tag.Attributes["name"]
 	value := tag.Attributes["value"]
 	varType := tag.Attributes["type"]
-	
+
 	if name == "" && tag.Content != "" {
 		// Try to parse from content: name = value
 		parts := strings.SplitN(tag.Content, "=", 2)
@@ -85,21 +205,26 @@ func (p *MarkupParser) transpileVariable(tag *MarkupTag) string {
 			value = strings.TrimSpace(parts[1])
 		}
 	}
-	
+
 	if err := p.validateIdentifier(name); err != nil {
-		p.errors = append(p.errors, err.Error())
-		return fmt.Sprintf("/* Invalid variable: %s */", err.Error())
+		return p.invalid(err.Error())
+	}
+	if text, ok := tag.Attributes["text"]; ok {
+		if value != "" {
+			return p.invalid(fmt.Sprintf("variable %s can't have both text and a value", name))
+		}
+		value = quoteString(text, p.targetLang)
 	}
-	
+
 	p.scopeVars[name] = true
-	
+
 	keyword := "let"
 	if tag.Name == "const" {
 		keyword = "const"
 	} else if tag.Name == "var" {
 		keyword = "var"
 	}
-	
+
 	switch p.targetLang {
 	case "typescript":
 		if varType != "" {
@@ -117,14 +242,13 @@ func (p *MarkupParser) transpileFunction(tag *MarkupTag) string {
 	params := tag.Attributes["params"]
 	returnType := tag.Attributes["returns"]
 	async := tag.Attributes["async"] == "true"
-	
+
 	if err := p.validateIdentifier(name); err != nil {
-		p.errors = append(p.errors, fmt.Sprintf("invalid function name: %s", err.Error()))
-		return fmt.Sprintf("/* Invalid function: %s */", err.Error())
+		return p.invalid(fmt.Sprintf("invalid function name: %s", err.Error()))
 	}
-	
+
 	body := strings.TrimSpace(tag.Content)
-	
+
 	switch p.targetLang {
 	case "typescript":
 		asyncKeyword := ""
@@ -132,17 +256,17 @@ func (p *MarkupParser) transpileFunction(tag *MarkupTag) string {
 			asyncKeyword = "async "
 		}
 		if returnType != "" {
-			return fmt.Sprintf("%s%sfunction %s(%s): %s {\n%s\n%s}", 
+			return fmt.Sprintf("%s%sfunction %s(%s): %s {\n%s\n%s}",
 				p.indent(), asyncKeyword, name, params, returnType, p.indentBlock(body), p.indent())
 		}
-		return fmt.Sprintf("%s%sfunction %s(%s) {\n%s\n%s}", 
+		return fmt.Sprintf("%s%sfunction %s(%s) {\n%s\n%s}",
 			p.indent(), asyncKeyword, name, params, p.indentBlock(body), p.indent())
 	default:
 		asyncKeyword := ""
 		if async {
 			asyncKeyword = "async "
 		}
-		return fmt.Sprintf("%s%sfunction %s(%s) {\n%s\n%s}", 
+		return fmt.Sprintf("%s%sfunction %s(%s) {\n%s\n%s}",
 			p.indent(), asyncKeyword, name, params, p.indentBlock(body), p.indent())
 	}
 }
@@ -155,14 +279,14 @@ func (p *MarkupParser) transpileLoop(tag *MarkupTag) string {
 	step := tag.Attributes["step"]
 	items := tag.Attributes["in"]
 	times := tag.Attributes["times"]
-	
+
 	body := strings.TrimSpace(tag.Content)
-	
+
 	// Default step is 1
 	if step == "" {
 		step = "1"
 	}
-	
+
 	switch p.targetLang {
 	case "typescript", "javascript":
 		if items != "" {
@@ -170,44 +294,44 @@ func (p *MarkupParser) transpileLoop(tag *MarkupTag) string {
 			if variable == "" {
 				variable = "item"
 			}
-			return fmt.Sprintf("%sfor (const %s of %s) {\n%s\n%s}", 
+			return fmt.Sprintf("%sfor (const %s of %s) {\n%s\n%s}",
 				p.indent(), variable, items, p.indentBlock(body), p.indent())
 		} else if times != "" {
 			// repeat n times
 			if variable == "" {
 				variable = "i"
 			}
-			return fmt.Sprintf("%sfor (let %s = 0; %s < %s; %s++) {\n%s\n%s}", 
+			return fmt.Sprintf("%sfor (let %s = 0; %s < %s; %s++) {\n%s\n%s}",
 				p.indent(), variable, variable, times, variable, p.indentBlock(body), p.indent())
 		} else if from != "" && to != "" {
 			// range loop
 			if variable == "" {
 				variable = "i"
 			}
-			return fmt.Sprintf("%sfor (let %s = %s; %s < %s; %s += %s) {\n%s\n%s}", 
+			return fmt.Sprintf("%sfor (let %s = %s; %s < %s; %s += %s) {\n%s\n%s}",
 				p.indent(), variable, from, variable, to, variable, step, p.indentBlock(body), p.indent())
 		}
 		return fmt.Sprintf("%s/* Invalid loop configuration */", p.indent())
-	
+
 	default:
 		// Default to JavaScript/TypeScript
 		if items != "" {
 			if variable == "" {
 				variable = "item"
 			}
-			return fmt.Sprintf("%sfor (const %s of %s) {\n%s\n%s}", 
+			return fmt.Sprintf("%sfor (const %s of %s) {\n%s\n%s}",
 				p.indent(), variable, items, p.indentBlock(body), p.indent())
 		} else if times != "" {
 			if variable == "" {
 				variable = "i"
 			}
-			return fmt.Sprintf("%sfor (let %s = 0; %s < %s; %s++) {\n%s\n%s}", 
+			return fmt.Sprintf("%sfor (let %s = 0; %s < %s; %s++) {\n%s\n%s}",
 				p.indent(), variable, variable, times, variable, p.indentBlock(body), p.indent())
 		} else if from != "" && to != "" {
 			if variable == "" {
 				variable = "i"
 			}
-			return fmt.Sprintf("%sfor (let %s = %s; %s < %s; %s += %s) {\n%s\n%s}", 
+			return fmt.Sprintf("%sfor (let %s = %s; %s < %s; %s += %s) {\n%s\n%s}",
 				p.indent(), variable, from, variable, to, variable, step, p.indentBlock(body), p.indent())
 		}
 		return fmt.Sprintf("%s/* Invalid loop configuration */", p.indent())
@@ -220,10 +344,10 @@ func (p *MarkupParser) transpileWhile(tag *MarkupTag) string {
 	if condition == "" {
 		condition = "true"
 	}
-	
+
 	body := strings.TrimSpace(tag.Content)
-	
-	return fmt.Sprintf("%swhile (%s) {\n%s\n%s}", 
+
+	return fmt.Sprintf("%swhile (%s) {\n%s\n%s}",
 		p.indent(), condition, p.indentBlock(body), p.indent())
 }
 
@@ -237,38 +361,63 @@ func (p *MarkupParser) transpileIf(tag *MarkupTag) string {
 			condition = strings.TrimSpace(parts[0])
 		}
 	}
-	
+
 	body := strings.TrimSpace(tag.Content)
-	
-	return fmt.Sprintf("%sif (%s) {\n%s\n%s}", 
+
+	return fmt.Sprintf("%sif (%s) {\n%s\n%s}",
 		p.indent(), condition, p.indentBlock(body), p.indent())
 }
 
-// transpileElse handles <else> tags
+// transpileElif handles <elif>, <elseif> tags, which transpileTag renders
+// after the <if> they follow
+func (p *MarkupParser) transpileElif(tag *MarkupTag) string {
+	if !tag.chained {
+		return p.invalid(fmt.Sprintf("<%s> must follow <if> or <elif>", tag.Name))
+	}
+	body := strings.TrimSpace(tag.Content)
+
+	return fmt.Sprintf("else if (%s) {\n%s\n%s}",
+		tag.Attributes["condition"], p.indentBlock(body), p.indent())
+}
+
+// transpileElse handles <else> tags, which transpileTag renders after the
+// <if> or <elif> they follow
 func (p *MarkupParser) transpileElse(tag *MarkupTag) string {
+	if !tag.chained {
+		return p.invalid(fmt.Sprintf("<%s> must follow <if> or <elif>", tag.Name))
+	}
 	body := strings.TrimSpace(tag.Content)
-	
-	return fmt.Sprintf("%selse {\n%s\n%s}", 
-		p.indent(), p.indentBlock(body), p.indent())
+
+	return fmt.Sprintf("else {\n%s\n%s}",
+		p.indentBlock(body), p.indent())
 }
 
 // transpileClass handles <extend>, <class> tags
 func (p *MarkupParser) transpileClass(tag *MarkupTag) string {
 	name := tag.Attributes["name"]
 	extends := tag.Attributes["extends"]
-	
+
 	if err := p.validateIdentifier(name); err != nil {
-		p.errors = append(p.errors, fmt.Sprintf("invalid class name: %s", err.Error()))
-		return fmt.Sprintf("/* Invalid class: %s */", err.Error())
+		return p.invalid(fmt.Sprintf("invalid class name: %s", err.Error()))
+	}
+
+	constructors := 0
+	for _, child := range tag.Children {
+		if strings.EqualFold(child.Name, "method") && isConstructor(&child) {
+			constructors++
+		}
+	}
+	if constructors > 1 {
+		return p.invalid(fmt.Sprintf("class %s has %d constructors; a class can only have one", name, constructors))
 	}
-	
+
 	body := strings.TrimSpace(tag.Content)
-	
+
 	if extends != "" {
-		return fmt.Sprintf("%sclass %s extends %s {\n%s\n%s}", 
+		return fmt.Sprintf("%sclass %s extends %s {\n%s\n%s}",
 			p.indent(), name, extends, p.indentBlock(body), p.indent())
 	}
-	return fmt.Sprintf("%sclass %s {\n%s\n%s}", 
+	return fmt.Sprintf("%sclass %s {\n%s\n%s}",
 		p.indent(), name, p.indentBlock(body), p.indent())
 }
 
@@ -278,32 +427,80 @@ func (p *MarkupParser) transpileMethod(tag *MarkupTag) string {
 	params := tag.Attributes["params"]
 	returnType := tag.Attributes["returns"]
 	static := tag.Attributes["static"] == "true"
-	
+	async := tag.Attributes["async"] == "true"
+	generator := tag.Attributes["generator"] == "true"
+
+	if err := p.validateIdentifier(name); err != nil {
+		return p.invalid(fmt.Sprintf("invalid method name: %s", err.Error()))
+	}
+
+	if isConstructor(tag) {
+		switch {
+		case async:
+			return p.invalid("a constructor can't be async")
+		case generator:
+			return p.invalid("a constructor can't be a generator")
+		case p.targetLang == "typescript" && returnType != "":
+			return p.invalid("a constructor can't declare a return type")
+		}
+	} else if static && name == "constructor" {
+		p.tagWarning(tag, CodeInvalidTag, fmt.Sprintf("static method 'constructor' at line %d is an ordinary method, not the class constructor", tag.Line))
+	}
+
 	body := strings.TrimSpace(tag.Content)
-	
-	staticKeyword := ""
+
+	modifiers := ""
 	if static {
-		staticKeyword = "static "
+		modifiers += "static "
+	}
+	if async {
+		modifiers += "async "
 	}
-	
+	if generator {
+		modifiers += "*"
+	}
+
 	if p.targetLang == "typescript" && returnType != "" {
-		return fmt.Sprintf("%s%s%s(%s): %s {\n%s\n%s}", 
-			p.indent(), staticKeyword, name, params, returnType, p.indentBlock(body), p.indent())
+		return fmt.Sprintf("%s%s%s(%s): %s {\n%s\n%s}",
+			p.indent(), modifiers, name, params, returnType, p.indentBlock(body), p.indent())
+	}
+
+	return fmt.Sprintf("%s%s%s(%s) {\n%s\n%s}",
+		p.indent(), modifiers, name, params, p.indentBlock(body), p.indent())
+}
+
+// isConstructor reports whether a <method> tag is its class's constructor;
+// a static method named constructor is an ordinary method
+func isConstructor(tag *MarkupTag) bool {
+	return tag.Attributes["name"] == "constructor" && tag.Attributes["static"] != "true"
+}
+
+// transpileRecord handles <record>, <struct>, <data> tags
+func (p *MarkupParser) transpileRecord(tag *MarkupTag) string {
+	name := tag.Attributes["name"]
+
+	if err := p.validateIdentifier(name); err != nil {
+		return p.invalid(fmt.Sprintf("invalid record name: %s", err.Error()))
+	}
+
+	fields := ParseRecordFields(tag.Attributes["fields"])
+	for _, field := range fields {
+		if err := p.validateIdentifier(field.Name); err != nil {
+			return p.invalid(fmt.Sprintf("invalid field in record %s: %s", name, err.Error()))
+		}
 	}
-	
-	return fmt.Sprintf("%s%s%s(%s) {\n%s\n%s}", 
-		p.indent(), staticKeyword, name, params, p.indentBlock(body), p.indent())
+
+	return RenderRecord(name, fields, p.targetLang, p.indent())
 }
 
-// indentBlock adds indentation to each line in a block
+// indentBlock indents each line of a block body one level deeper than
+// its tag. Bodies arrive unindented (see bodyWriter), so each line ends up
+// indented by its depth in the tree.
 func (p *MarkupParser) indentBlock(block string) string {
 	lines := strings.Split(block, "\n")
 	indented := make([]string, len(lines))
-	
-	p.indentLevel++
-	indent := p.indent()
-	p.indentLevel--
-	
+	indent := p.indent() + "  "
+
 	for i, line := range lines {
 		if strings.TrimSpace(line) != "" {
 			indented[i] = indent + line
@@ -311,34 +508,222 @@ func (p *MarkupParser) indentBlock(block string) string {
 			indented[i] = ""
 		}
 	}
-	
+
 	return strings.Join(indented, "\n")
 }
 
 // Additional transpilation methods continue...
+// transpileImport handles <import>, <require>, <use> tags: a module
+// imported for its side effects, its default export, a namespace object
+// or a list of names
 func (p *MarkupParser) transpileImport(tag *MarkupTag) string {
 	module := tag.Attributes["from"]
 	items := tag.Attributes["items"]
-	
+	defaultName := tag.Attributes["default"]
+	namespace := tag.Attributes["as"]
+
+	if items != "" && namespace != "" {
+		return p.invalid(fmt.Sprintf("import from '%s' can't have both items and as", module))
+	}
+	var specifiers string
 	if items != "" {
-		return fmt.Sprintf("%simport { %s } from '%s';", p.indent(), items, module)
+		var err error
+		if specifiers, err = p.moduleSpecifiers(items, "import", p.targetLang != "python"); err != nil {
+			return p.invalid(err.Error())
+		}
+	}
+
+	if p.targetLang == "python" {
+		return p.pythonImport(module, specifiers, defaultName, namespace)
+	}
+
+	var clauses []string
+	if defaultName != "" {
+		clauses = append(clauses, defaultName)
+	}
+	if namespace != "" {
+		clauses = append(clauses, "* as "+namespace)
+	}
+	if specifiers != "" {
+		clauses = append(clauses, "{ "+specifiers+" }")
 	}
-	return fmt.Sprintf("%simport '%s';", p.indent(), module)
+	if len(clauses) == 0 {
+		return fmt.Sprintf("%simport '%s';", p.indent(), escapeString(module, '\'', p.targetLang))
+	}
+	return fmt.Sprintf("%simport %s from '%s';", p.indent(), strings.Join(clauses, ", "), escapeString(module, '\'', p.targetLang))
+}
+
+// pythonImport renders an import for Python (see PythonImport)
+func (p *MarkupParser) pythonImport(module, specifiers, defaultName, namespace string) string {
+	lines, err := PythonImport(module, specifiers, defaultName, namespace)
+	if err != nil {
+		return p.invalid(err.Error())
+	}
+	for i, line := range lines {
+		lines[i] = p.indent() + line
+	}
+	return strings.Join(lines, "\n")
 }
 
+// PythonImport writes an import of module as Python's import lines.
+// Python has no default exports: the default name, like namespace, binds
+// the module itself. specifiers are the names imported from it, as
+// "name" or "name as alias" joined by commas.
+func PythonImport(module, specifiers, defaultName, namespace string) ([]string, error) {
+	if defaultName != "" && namespace != "" && defaultName != namespace {
+		return nil, fmt.Errorf("import from '%s' can't bind the module to both '%s' and '%s' in Python", module, defaultName, namespace)
+	}
+	if namespace == "" {
+		namespace = defaultName
+	}
+
+	module = pythonModule(module)
+	var lines []string
+	if namespace != "" || specifiers == "" {
+		parent, name, relative := splitPythonModule(module)
+		alias := ""
+		if namespace != "" && namespace != name {
+			alias = " as " + namespace
+		}
+		if relative {
+			lines = append(lines, fmt.Sprintf("from %s import %s%s", parent, name, alias))
+		} else {
+			lines = append(lines, fmt.Sprintf("import %s%s", module, alias))
+		}
+	}
+	if specifiers != "" {
+		lines = append(lines, fmt.Sprintf("from %s import %s", module, specifiers))
+	}
+	return lines, nil
+}
+
+// pythonModule converts a module path such as "./lib/utils.py" to Python's
+// dotted form, ".lib.utils"
+func pythonModule(module string) string {
+	dots := ""
+	if rest, ok := strings.CutPrefix(module, "./"); ok {
+		dots, module = ".", rest
+	}
+	for {
+		rest, ok := strings.CutPrefix(module, "../")
+		if !ok {
+			break
+		}
+		if dots == "" {
+			dots = "."
+		}
+		dots, module = dots+".", rest
+	}
+	module = strings.TrimSuffix(strings.TrimSuffix(module, ".py"), ".js")
+	return dots + strings.ReplaceAll(module, "/", ".")
+}
+
+// splitPythonModule splits a relative module into the package to import
+// from and the module's name; relative is false for absolute modules,
+// which `import` can name directly
+func splitPythonModule(module string) (parent, name string, relative bool) {
+	if !strings.HasPrefix(module, ".") {
+		return "", module, false
+	}
+	i := strings.LastIndex(module, ".")
+	parent, name = module[:i], module[i+1:]
+	if strings.Trim(parent, ".") == "" {
+		parent += "."
+	}
+	return parent, name, true
+}
+
+// transpileExport handles <export> tags: a list of names, possibly
+// re-exported from another module, or the declaration or expression in
+// the body
 func (p *MarkupParser) transpileExport(tag *MarkupTag) string {
 	name := tag.Attributes["name"]
+	names := tag.Attributes["names"]
+	module := tag.Attributes["from"]
 	isDefault := tag.Attributes["default"] == "true"
-	
+
 	body := strings.TrimSpace(tag.Content)
-	
-	if isDefault {
+
+	module = escapeString(module, '\'', p.targetLang)
+	if names != "" || module != "" {
+		if body != "" || name != "" || isDefault {
+			return p.invalid("an export with names or from can't also have a name, default or a body")
+		}
+		if names == "" {
+			return fmt.Sprintf("%sexport * from '%s';", p.indent(), module)
+		}
+		specifiers, err := p.moduleSpecifiers(names, "export", module != "")
+		if err != nil {
+			return p.invalid(err.Error())
+		}
+		if module == "" {
+			return fmt.Sprintf("%sexport { %s };", p.indent(), specifiers)
+		}
+		return fmt.Sprintf("%sexport { %s } from '%s';", p.indent(), specifiers, module)
+	}
+
+	if body == "" {
+		return p.invalid("nothing to export: give names, from or a body")
+	}
+	kind := declarationKind(body)
+	switch {
+	case isDefault && kind == "binding":
+		return p.invalid("a variable declaration can't be a default export; export its name instead")
+	case isDefault && kind != "":
 		return fmt.Sprintf("%sexport default %s", p.indent(), body)
+	case isDefault:
+		return fmt.Sprintf("%sexport default %s;", p.indent(), strings.TrimSuffix(body, ";"))
+	case name != "" && kind != "":
+		return p.invalid(fmt.Sprintf("export name '%s' given for a declaration, which is exported under its own name", name))
+	case name != "":
+		return fmt.Sprintf("%sexport const %s = %s;", p.indent(), name, strings.TrimSuffix(body, ";"))
+	case kind != "":
+		return fmt.Sprintf("%sexport %s", p.indent(), body)
+	}
+	return p.invalid("only a declaration can be exported as it is; give the export a name or make it the default")
+}
+
+// moduleSpecifiers validates a comma-separated list of names, each
+// optionally renamed with "as", and formats it for an import or export
+// clause. withDefault allows naming a module's default export.
+func (p *MarkupParser) moduleSpecifiers(names, what string, withDefault bool) (string, error) {
+	var specifiers []string
+	for _, specifier := range strings.Split(names, ",") {
+		parts := strings.Fields(specifier)
+		if len(parts) != 1 && (len(parts) != 3 || parts[1] != "as") {
+			return "", fmt.Errorf("invalid %s '%s': expected a name or 'name as alias'", what, strings.TrimSpace(specifier))
+		}
+		if !(withDefault && parts[0] == "default") {
+			if err := p.validateIdentifier(parts[0]); err != nil {
+				return "", fmt.Errorf("invalid %s: %s", what, err.Error())
+			}
+		}
+		if len(parts) == 3 {
+			if err := p.validateIdentifier(parts[2]); err != nil {
+				return "", fmt.Errorf("invalid %s alias: %s", what, err.Error())
+			}
+		}
+		specifiers = append(specifiers, strings.Join(parts, " "))
 	}
-	if name != "" {
-		return fmt.Sprintf("%sexport const %s = %s;", p.indent(), name, body)
+	return strings.Join(specifiers, ", "), nil
+}
+
+// declarationPattern matches the start of a declaration, capturing its
+// keyword
+var declarationPattern = regexp.MustCompile(`^(?:async\s+)?(function|class|interface|const|let|var|type|enum)\b`)
+
+// declarationKind returns "declaration" when code starts with a function,
+// class or interface, which may be a default export, "binding" when it
+// starts with any other declaration, and "" otherwise
+func declarationKind(code string) string {
+	match := declarationPattern.FindStringSubmatch(code)
+	switch {
+	case match == nil:
+		return ""
+	case match[1] == "function" || match[1] == "class" || match[1] == "interface":
+		return "declaration"
 	}
-	return fmt.Sprintf("%sexport %s", p.indent(), body)
+	return "binding"
 }
 
 func (p *MarkupParser) transpileReturn(tag *MarkupTag) string {
@@ -346,7 +731,7 @@ func (p *MarkupParser) transpileReturn(tag *MarkupTag) string {
 	if value == "" {
 		value = tag.Attributes["value"]
 	}
-	
+
 	return fmt.Sprintf("%sreturn %s;", p.indent(), value)
 }
 
@@ -370,14 +755,17 @@ func (p *MarkupParser) transpileCatch(tag *MarkupTag) string {
 	if errorVar == "" {
 		errorVar = "e"
 	}
-	
+
 	body := strings.TrimSpace(tag.Content)
 	return fmt.Sprintf("%scatch (%s) {\n%s\n%s}", p.indent(), errorVar, p.indentBlock(body), p.indent())
 }
 
 func (p *MarkupParser) transpileComment(tag *MarkupTag) string {
-	content := strings.TrimSpace(tag.Content)
-	return fmt.Sprintf("%s// %s", p.indent(), content)
+	lines := strings.Split(strings.TrimSpace(tag.Content), "\n")
+	for i, line := range lines {
+		lines[i] = strings.TrimRight(p.indent()+"// "+strings.TrimSpace(line), " ")
+	}
+	return strings.Join(lines, "\n")
 }
 
 func (p *MarkupParser) transpileAsync(tag *MarkupTag) string {
@@ -390,8 +778,42 @@ func (p *MarkupParser) transpileAwait(tag *MarkupTag) string {
 	return fmt.Sprintf("%sawait %s", p.indent(), expression)
 }
 
+// transpileReadFile handles <readfile path="notes.txt" var="notes"/>,
+// which declares var holding the file's text; see EmojiReadFile
+func (p *MarkupParser) transpileReadFile(tag *MarkupTag) string {
+	name := tag.Attributes["var"]
+	if err := p.validateIdentifier(name); err != nil {
+		return p.invalid(err.Error())
+	}
+	keyword := tag.Attributes["keyword"]
+	if keyword == "" {
+		keyword = "const"
+	}
+	return fmt.Sprintf("%s%s %s = EmojiReadFile(%s);", p.indent(), keyword, name, quoteString(tag.Attributes["path"], p.targetLang))
+}
+
+// transpileWriteFile handles <writefile path="out.txt">, which writes its
+// body, or its text attribute as it is written, to the file; see
+// EmojiWriteFile
+func (p *MarkupParser) transpileWriteFile(tag *MarkupTag) string {
+	content := strings.TrimSpace(tag.Content)
+	if text, ok := tag.Attributes["text"]; ok {
+		if content != "" {
+			return p.invalid("writefile can't have both text and a body")
+		}
+		content = quoteString(text, p.targetLang)
+	}
+	if content == "" {
+		return p.invalid("writefile needs a body or text to write")
+	}
+	return fmt.Sprintf("%sEmojiWriteFile(%s, %s);", p.indent(), quoteString(tag.Attributes["path"], p.targetLang), content)
+}
+
 func (p *MarkupParser) transpileSwitch(tag *MarkupTag) string {
 	expression := tag.Attributes["on"]
+	if into := tag.Attributes["into"]; into != "" {
+		return p.transpileSwitchExpression(tag, expression, into)
+	}
 	body := strings.TrimSpace(tag.Content)
 	return fmt.Sprintf("%sswitch (%s) {\n%s\n%s}", p.indent(), expression, p.indentBlock(body), p.indent())
 }
@@ -402,6 +824,49 @@ func (p *MarkupParser) transpileCase(tag *MarkupTag) string {
 	return fmt.Sprintf("%scase %s:\n%s", p.indent(), value, p.indentBlock(body))
 }
 
+// transpileSwitchExpression handles <switch into="name">, where each <case>
+// and <default> child holds the value the switch evaluates to
+func (p *MarkupParser) transpileSwitchExpression(tag *MarkupTag, subject, into string) string {
+	if err := p.validateIdentifier(into); err != nil {
+		return p.invalid(fmt.Sprintf("invalid switch target: %s", err.Error()))
+	}
+
+	keyword := tag.Attributes["keyword"]
+	if keyword == "" {
+		keyword = "const"
+	}
+
+	var arms []SwitchArm
+	for _, child := range tag.Children {
+		if child.Name == "" {
+			continue
+		}
+		result := strings.TrimSpace(child.Content)
+		if result == "" {
+			result = child.Attributes["result"]
+		}
+		kind := child.Name
+		if !p.strictTags {
+			kind = strings.ToLower(kind)
+		}
+		switch kind {
+		case "case":
+			arms = append(arms, SwitchArm{Value: child.Attributes["value"], Result: result})
+		case "default":
+			arms = append(arms, SwitchArm{Result: result, Default: true})
+		default:
+			p.tagWarning(&child, CodeIgnoredTag, fmt.Sprintf("<%s> ignored inside switch expression", child.Name))
+		}
+	}
+
+	return RenderSwitchExpression(keyword, into, subject, arms, p.targetLang, p.indent())
+}
+
+func (p *MarkupParser) transpileDefault(tag *MarkupTag) string {
+	body := strings.TrimSpace(tag.Content)
+	return fmt.Sprintf("%sdefault:\n%s", p.indent(), p.indentBlock(body))
+}
+
 func (p *MarkupParser) transpileBreak(tag *MarkupTag) string {
 	return fmt.Sprintf("%sbreak;", p.indent())
 }
@@ -0,0 +1,65 @@
+package transpiler
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+)
+
+// TagHandler transpiles a namespaced markup tag, given its name without
+// the namespace. The tag's Content holds its body, with any nested tags
+// already transpiled.
+type TagHandler func(name string, tag *MarkupTag, targetLang string) (string, error)
+
+var (
+	namespacesMu sync.RWMutex
+	namespaces   = map[string]TagHandler{}
+)
+
+// RegisterTagNamespace routes tags written <namespace:name> to handler.
+// Tags without a namespace belong to the core language, so the empty
+// namespace can't be registered.
+func RegisterTagNamespace(namespace string, handler TagHandler) error {
+	if namespace == "" {
+		return errors.New("the default namespace is reserved for the core language")
+	}
+	if handler == nil {
+		return errors.New("handler must not be nil")
+	}
+	namespacesMu.Lock()
+	defer namespacesMu.Unlock()
+	if _, taken := namespaces[namespace]; taken {
+		return fmt.Errorf("namespace '%s' is already registered", namespace)
+	}
+	namespaces[namespace] = handler
+	return nil
+}
+
+// TagNamespaces lists the registered namespaces in order
+func TagNamespaces() []string {
+	namespacesMu.RLock()
+	defer namespacesMu.RUnlock()
+	names := make([]string, 0, len(namespaces))
+	for namespace := range namespaces {
+		names = append(names, namespace)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// transpilePluginTag hands a namespaced tag to its namespace's handler
+func (p *MarkupParser) transpilePluginTag(namespace, name string, tag *MarkupTag) string {
+	namespacesMu.RLock()
+	handler, ok := namespaces[namespace]
+	namespacesMu.RUnlock()
+	at := fmt.Sprintf("<%s> at line %d, column %d", tag.Name, tag.Line, tag.Column)
+	if !ok {
+		return p.invalid(fmt.Sprintf("unknown namespace '%s' in %s", namespace, at))
+	}
+	output, err := handler(name, tag, p.targetLang)
+	if err != nil {
+		return p.invalid(fmt.Sprintf("%s: %v", at, err))
+	}
+	return p.indent() + output
+}
@@ -0,0 +1,21 @@
+package transpiler
+
+import "strings"
+
+// byteOrderMark is the UTF-8 byte order mark some Windows editors start a
+// file with
+const byteOrderMark = "\uFEFF"
+
+// NormalizeNewlines strips a leading byte order mark and turns CRLF line
+// endings into LF, so code saved on Windows lexes and parses as it would
+// anywhere else, with no '\r' left in strings or attribute values.
+// Positions are the same in the result as in code: a CR taken out only
+// ever ended a line, and the mark is invisible in editors, which don't
+// count it as a column.
+func NormalizeNewlines(code string) string {
+	code = strings.TrimPrefix(code, byteOrderMark)
+	if !strings.Contains(code, "\r\n") {
+		return code
+	}
+	return strings.ReplaceAll(code, "\r\n", "\n")
+}
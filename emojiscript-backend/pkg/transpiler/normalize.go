@@ -0,0 +1,145 @@
+package transpiler
+
+import (
+	"strings"
+	"unicode"
+)
+
+// NormalizeSource reduces a program to the token stream that decides its
+// meaning, so programs differing only in layout normalize alike: emoji are
+// canonicalized (see Format), comments and blank lines are dropped,
+// indentation is removed and runs of spaces become one. Strings, template
+// literals and regular expressions are kept verbatim, and line breaks
+// survive since JavaScript's semicolon insertion depends on them. A space
+// is never removed entirely, because the emoji syntax relies on spacing
+// ("🔢 i" and "🔢i" transpile differently).
+func NormalizeSource(code string) string {
+	code = Format(code, FormatOptions{})
+
+	var out strings.Builder
+	lineStart := true
+	pendingSpace := false
+	// last is the most recent significant rune, used to tell a regular
+	// expression from a division
+	var last rune
+	emit := func(s string) {
+		if pendingSpace && !lineStart {
+			out.WriteByte(' ')
+		}
+		pendingSpace, lineStart = false, false
+		out.WriteString(s)
+		for _, r := range s {
+			last = r
+		}
+	}
+	newline := func() {
+		if !lineStart {
+			out.WriteByte('\n')
+		}
+		pendingSpace, lineStart = false, true
+	}
+
+	runes := []rune(code)
+	for i := 0; i < len(runes); i++ {
+		r := runes[i]
+		switch {
+		case r == '\n':
+			newline()
+		case unicode.IsSpace(r):
+			pendingSpace = true
+		case r == '/' && i+1 < len(runes) && runes[i+1] == '/':
+			for i+1 < len(runes) && runes[i+1] != '\n' {
+				i++
+			}
+		case r == '/' && i+1 < len(runes) && runes[i+1] == '*':
+			end := indexFrom(runes, i+2, "*/")
+			if end < 0 {
+				end = len(runes) - 2
+			}
+			// a comment spanning lines still separates them
+			if strings.ContainsRune(string(runes[i:end+2]), '\n') {
+				newline()
+			} else {
+				pendingSpace = true
+			}
+			i = end + 1
+		case r == '<' && strings.HasPrefix(string(runes[i:min(i+4, len(runes))]), "<!--"):
+			end := indexFrom(runes, i+4, "-->")
+			if end < 0 {
+				end = len(runes) - 3
+			}
+			pendingSpace = true
+			i = end + 2
+		case r == '"' || r == '\'' || r == '`':
+			end := closeQuote(runes, i, r)
+			emit(string(runes[i : end+1]))
+			i = end
+		case r == '/' && regexAllowed(last, lineStart):
+			end := closeRegex(runes, i)
+			emit(string(runes[i : end+1]))
+			i = end
+		default:
+			emit(string(r))
+		}
+	}
+	return strings.TrimRight(out.String(), "\n")
+}
+
+// indexFrom finds marker in runes at or after start, or -1
+func indexFrom(runes []rune, start int, marker string) int {
+	m := []rune(marker)
+	for i := start; i+len(m) <= len(runes); i++ {
+		if string(runes[i:i+len(m)]) == marker {
+			return i
+		}
+	}
+	return -1
+}
+
+// closeQuote returns the index of the quote ending the string opened at
+// start, or the last index if it is never closed. Only template literals
+// may span lines.
+func closeQuote(runes []rune, start int, quote rune) int {
+	for i := start + 1; i < len(runes); i++ {
+		switch runes[i] {
+		case '\\':
+			i++
+		case quote:
+			return i
+		case '\n':
+			if quote != '`' {
+				return i - 1
+			}
+		}
+	}
+	return len(runes) - 1
+}
+
+// regexAllowed reports whether a '/' after last starts a regular
+// expression rather than dividing
+func regexAllowed(last rune, lineStart bool) bool {
+	return lineStart || last == 0 || strings.ContainsRune("(,=:[!&|?{};+-*%<>~^", last)
+}
+
+// closeRegex returns the index of the '/' ending the regular expression
+// opened at start, skipping escapes and character classes
+func closeRegex(runes []rune, start int) int {
+	inClass := false
+	for i := start + 1; i < len(runes); i++ {
+		switch runes[i] {
+		case '\\':
+			i++
+		case '[':
+			inClass = true
+		case ']':
+			inClass = false
+		case '/':
+			if !inClass {
+				return i
+			}
+		case '\n':
+			return i - 1
+		}
+	}
+	return len(runes) - 1
+}
@@ -0,0 +1,79 @@
+package transpiler
+
+// OutlineItem is a declaration in a program's outline, with the
+// declarations inside its range
+type OutlineItem struct {
+	Symbol
+	Children []OutlineItem `json:"children,omitempty"`
+}
+
+// Outline returns a program's structure for outline panels and minimaps:
+// its classes with their methods, its functions with what they nest, and
+// its top-level variables, in source order
+func Outline(code string, markup bool) []OutlineItem {
+	var symbols []Symbol
+	if markup {
+		parser := NewMarkupParser(code, "javascript")
+		top := map[[2]int]bool{}
+		for _, tag := range parser.indexAll() {
+			top[[2]int{tag.Line, tagStart(tag)}] = true
+		}
+		for _, symbol := range parser.symbols {
+			if symbol.Kind != SymbolVariable || top[[2]int{symbol.Line, symbol.Column}] {
+				symbols = append(symbols, symbol)
+			}
+		}
+	} else {
+		program, _ := ParseEmoji(code)
+		index := &symbolIndex{}
+		index.walk(program.Children, "", false)
+		symbols = append(index.symbols, topVariables(program.Children, index.symbols)...)
+	}
+	return nestSymbols(sortSymbols(symbols))
+}
+
+// nestSymbols turns symbols sorted by position into a tree, each holding
+// the symbols that start inside its range
+func nestSymbols(symbols []Symbol) []OutlineItem {
+	var items []OutlineItem
+	for i := 0; i < len(symbols); {
+		item := OutlineItem{Symbol: symbols[i]}
+		j := i + 1
+		for j < len(symbols) && (symbols[j].Line < item.EndLine || symbols[j].Line == item.EndLine && symbols[j].Column < item.EndColumn) {
+			j++
+		}
+		item.Children = nestSymbols(symbols[i+1 : j])
+		items = append(items, item)
+		i = j
+	}
+	return items
+}
+
+// topVariables returns the variables the top level of an emoji program
+// declares, leaving out those the functions among symbols are bound to
+func topVariables(nodes []Node, symbols []Symbol) []Symbol {
+	functions := map[[2]int]bool{}
+	for _, symbol := range symbols {
+		functions[[2]int{symbol.Line, symbol.Column}] = true
+	}
+	var variables []Symbol
+	for i := range nodes {
+		switch nodeWord(nodes[i]) {
+		case "const", "let", "var":
+		default:
+			continue
+		}
+		name := nextNode(nodes, i)
+		if !isIdent(nodes, name) {
+			continue
+		}
+		token := nodes[name].(*Leaf).Token
+		if functions[[2]int{token.Line, token.Column}] {
+			continue
+		}
+		variable := Symbol{Kind: SymbolVariable, Name: token.Text, Line: token.Line, Column: token.Column, Doc: docBefore(nodes, i)}
+		variable.EndLine, variable.EndColumn = statementEnd(nodes, name)
+		variables = append(variables, variable)
+	}
+	return variables
+}
@@ -0,0 +1,104 @@
+package transpiler
+
+import (
+	"fmt"
+	"strings"
+	"unicode/utf8"
+)
+
+// OutputLimitDiagnostic explains output longer than limit bytes, blaming
+// the top-level statement or tag of the program that generates the most
+// of it: a short program can only expand that far through one construct.
+// Each is transpiled on its own to measure it, so this is only worth
+// calling once the limit is exceeded.
+func (t *Transpiler) OutputLimitDiagnostic(code string, markup bool, limit int) Diagnostic {
+	var c construct
+	if markup {
+		c = t.largestTag(t.applyMarkupAliases(code))
+	} else {
+		c = t.largestStatement(t.ApplyAliases(code))
+	}
+	d := Diagnostic{Severity: SeverityError, Line: c.line, Column: c.column, Length: c.length, Code: CodeOutputLimit}
+	d.Message = fmt.Sprintf("Output exceeds the limit of %d bytes", limit)
+	if c.line > 0 {
+		d.Message += fmt.Sprintf("; %s at line %d generates %d bytes of it", c.name, c.line, c.size)
+	}
+	return d
+}
+
+// construct is a top-level statement or tag and the bytes it generates
+type construct struct {
+	name                 string
+	line, column, length int
+	size                 int
+}
+
+// largestStatement finds the emoji statement generating the most output.
+// Statements are split at the line breaks outside brackets, so a block
+// belongs to the statement that opens it.
+func (t *Transpiler) largestStatement(code string) construct {
+	program, _ := ParseEmoji(code)
+	lines := strings.Split(code, "\n")
+	var largest construct
+	var current *construct
+	end := func(next int) {
+		if current == nil {
+			return
+		}
+		source := strings.Join(lines[current.line-1:next-1], "\n")
+		current.size = len(TranspileEmoji(source, t.targetLang))
+		if current.size > largest.size {
+			largest = *current
+		}
+		current = nil
+	}
+	for _, node := range program.Children {
+		if leaf, ok := node.(*Leaf); ok && (leaf.Token.Kind == TokenSpace || leaf.Token.Kind == TokenComment) {
+			if strings.Contains(leaf.Token.Text, "\n") {
+				end(leaf.Token.Line + strings.Count(leaf.Token.Text, "\n"))
+			}
+			continue
+		}
+		if current != nil {
+			continue
+		}
+		line, column := node.Pos()
+		name := "this statement"
+		if leaf, ok := node.(*Leaf); ok {
+			name = "'" + leaf.Token.Text + "'"
+		}
+		current = &construct{name: name, line: line, column: column, length: max(utf8.RuneCountInString(lines[line-1])-column+1, 1)}
+	}
+	end(len(lines) + 1)
+	return largest
+}
+
+// largestTag finds the top-level markup tag, or run of code between tags,
+// generating the most output
+func (t *Transpiler) largestTag(code string) construct {
+	parser := NewMarkupParser(code, t.targetLang)
+	parser.SetPartial(true)
+	parser.input = parser.convertEmojisToKeywords(parser.input)
+	nodes := parser.parseDocument()
+	var largest construct
+	for i := range nodes {
+		node := &nodes[i]
+		c := construct{line: node.Line, column: parser.sourcePosition(node.Line, node.Column)}
+		switch {
+		case node.Error != "":
+			continue
+		case node.Name == "":
+			c.name, c.length, c.size = "the code", 1, len(node.Content)
+		default:
+			// a tag's column is just past its name; the diagnostic marks
+			// '<' and the name
+			c.name, c.length = "<"+node.Name+">", utf8.RuneCountInString(node.Name)+1
+			c.column -= c.length
+			c.size = len(parser.transpileTag(node))
+		}
+		if c.size > largest.size {
+			largest = c
+		}
+	}
+	return largest
+}
@@ -0,0 +1,168 @@
+package transpiler
+
+import (
+	"fmt"
+	"strings"
+)
+
+const (
+	variationSelectorText  = '\uFE0E'
+	variationSelectorEmoji = '\uFE0F'
+)
+
+// EmojiInfo describes a mapped emoji for palettes, input methods and
+// accessibility tools
+type EmojiInfo struct {
+	Emoji      string   `json:"emoji"`
+	Keyword    string   `json:"keyword"`
+	Category   string   `json:"category"`
+	Name       string   `json:"name"`
+	Spoken     string   `json:"spoken"`
+	Codepoints []string `json:"codepoints"`
+	Variants   []string `json:"variants"`
+	Shortcodes []string `json:"shortcodes"`
+	// SkinTones reports whether the emoji accepts Fitzpatrick modifiers;
+	// none of the keyword emoji currently do
+	SkinTones bool `json:"skinTones"`
+}
+
+// paletteEntry is a row of the palette table, which is generated from
+// palette.txt; names are the official Unicode character names of the base
+// code point, and spoken is what the emoji does, as transcription reads it
+type paletteEntry struct {
+	emoji, keyword, category, name, spoken string
+}
+
+//go:generate go run ./internal/palettegen -in palette.txt -out palette_table.go
+
+// Palette returns metadata for every mapped emoji, in reference order
+func Palette() []EmojiInfo {
+	return DialectPalette(nil)
+}
+
+// DialectPalette returns the palette of a dialect, whose emoji fromBase
+// maps the built-in ones to (see dialect.Pack.FromBase). A keyword the
+// dialect has no emoji for keeps the built-in one; one it has is
+// described by the dialect's emoji, without the Unicode name of the
+// built-in one.
+func DialectPalette(fromBase map[string]string) []EmojiInfo {
+	palette := make([]EmojiInfo, 0, len(paletteTable))
+	for _, entry := range paletteTable {
+		emoji, name := entry.emoji, entry.name
+		if alias, ok := fromBase[emoji]; ok {
+			emoji, name = alias, ""
+		}
+		palette = append(palette, EmojiInfo{
+			Emoji:      emoji,
+			Keyword:    entry.keyword,
+			Category:   entry.category,
+			Name:       name,
+			Spoken:     entry.spoken,
+			Codepoints: codepoints(emoji),
+			Variants:   variants(emoji),
+			Shortcodes: Shortcodes(emoji),
+		})
+	}
+	return palette
+}
+
+// Reference groups the palette by category as emoji -> keyword maps
+func Reference() map[string]map[string]string {
+	return PaletteReference(Palette())
+}
+
+// PaletteReference groups a palette, such as a dialect's, by category as
+// emoji -> keyword maps
+func PaletteReference(palette []EmojiInfo) map[string]map[string]string {
+	reference := map[string]map[string]string{}
+	for _, info := range palette {
+		if reference[info.Category] == nil {
+			reference[info.Category] = map[string]string{}
+		}
+		reference[info.Category][info.Emoji] = info.Keyword
+	}
+	return reference
+}
+
+// KeywordEmoji returns the canonical emoji for a keyword
+func KeywordEmoji(keyword string) (string, bool) {
+	for _, entry := range paletteTable {
+		if entry.keyword == keyword {
+			return entry.emoji, true
+		}
+	}
+	return "", false
+}
+
+// NormalizeVariants rewrites the accepted variant spellings of mapped emoji
+// (with or without variation selectors) into their canonical form. A
+// mapped emoji that is part of a longer sequence, joined with U+200D or
+// carrying a skin tone, is a different emoji and is left as written.
+func NormalizeVariants(code string) string {
+	runes := []rune(code)
+	b := &strings.Builder{}
+	for i := 0; i < len(runes); i++ {
+		r := runes[i]
+		end := i + 1
+		if end < len(runes) && (runes[end] == variationSelectorText || runes[end] == variationSelectorEmoji) {
+			end++
+		}
+
+		wantsSelector, mapped := canonicalSelector[r]
+		joined := i > 0 && runes[i-1] == '\u200D' || end < len(runes) && continuesCluster(runes, end)
+		if !mapped || joined {
+			b.WriteRune(r)
+			continue
+		}
+
+		b.WriteRune(r)
+		i = end - 1
+		if wantsSelector {
+			b.WriteRune(variationSelectorEmoji)
+		}
+	}
+	return b.String()
+}
+
+// canonicalSelector maps the base rune of every single-code-point mapped
+// emoji to whether its canonical form carries U+FE0F
+var canonicalSelector = func() map[rune]bool {
+	m := map[rune]bool{}
+	for _, entry := range paletteTable {
+		runes := []rune(entry.emoji)
+		switch {
+		case len(runes) == 1:
+			m[runes[0]] = false
+		case len(runes) == 2 && runes[1] == variationSelectorEmoji:
+			m[runes[0]] = true
+		}
+	}
+	return m
+}()
+
+func codepoints(emoji string) []string {
+	result := []string{}
+	for _, r := range emoji {
+		result = append(result, fmt.Sprintf("U+%04X", r))
+	}
+	return result
+}
+
+// variants lists the spellings accepted for an emoji: the canonical form,
+// the bare base code point, and the explicit emoji/text presentations
+func variants(emoji string) []string {
+	base := strings.TrimSuffix(emoji, string(variationSelectorEmoji))
+	forms := []string{emoji}
+	for _, form := range []string{base, base + string(variationSelectorEmoji), base + string(variationSelectorText)} {
+		duplicate := false
+		for _, existing := range forms {
+			if existing == form {
+				duplicate = true
+			}
+		}
+		if !duplicate {
+			forms = append(forms, form)
+		}
+	}
+	return forms
+}
@@ -0,0 +1,71 @@
+// Code generated by palettegen from palette.txt and the Unicode 15.0.0 character names; DO NOT EDIT.
+
+package transpiler
+
+var paletteTable = []paletteEntry{
+	{"📦", "const", "variables", "PACKAGE", "constant"},
+	{"🔢", "let", "variables", "INPUT SYMBOL FOR NUMBERS", "variable"},
+	{"✅", "true", "variables", "WHITE HEAVY CHECK MARK", "true"},
+	{"⛔", "false", "variables", "NO ENTRY", "false"},
+	{"📍", "null", "variables", "ROUND PUSHPIN", "null"},
+	{"❔", "undefined", "variables", "WHITE QUESTION MARK ORNAMENT", "undefined"},
+	{"🛟", "??=", "variables", "RING BUOY", "defaults to"},
+
+	{"🎯", "function", "functions", "DIRECT HIT", "function"},
+	{"➡️", "=>", "functions", "BLACK RIGHTWARDS ARROW", "arrow to"},
+	{"🔙", "return", "functions", "BACK WITH LEFTWARDS ARROW ABOVE", "return"},
+	{"⚡", "async", "functions", "HIGH VOLTAGE SIGN", "async"},
+	{"⏳", "await", "functions", "HOURGLASS WITH FLOWING SAND", "await"},
+	{"🧲", "get", "functions", "MAGNET", "getter"},
+
+	{"❓", "if", "control_flow", "BLACK QUESTION MARK ORNAMENT", "if"},
+	{"❌", "else", "control_flow", "CROSS MARK", "else"},
+	{"🔁", "for", "control_flow", "CLOCKWISE RIGHTWARDS AND LEFTWARDS OPEN CIRCLE ARROWS", "for"},
+	{"🔄", "while", "control_flow", "ANTICLOCKWISE DOWNWARDS AND UPWARDS OPEN CIRCLE ARROWS", "while"},
+	{"🎪", "switch", "control_flow", "CIRCUS TENT", "switch"},
+	{"🔘", "case", "control_flow", "RADIO BUTTON", "case"},
+	{"🏁", "break", "control_flow", "CHEQUERED FLAG", "break"},
+	{"⏭️", "continue", "control_flow", "BLACK RIGHT-POINTING DOUBLE TRIANGLE WITH VERTICAL BAR", "continue"},
+	{"💥", "throw", "control_flow", "COLLISION SYMBOL", "throw"},
+	{"🛡️", "try", "control_flow", "SHIELD", "try"},
+	{"🚨", "catch", "control_flow", "POLICE CARS REVOLVING LIGHT", "catch"},
+	{"🏆", "finally", "control_flow", "TROPHY", "finally"},
+
+	{"➕", "+", "operators", "HEAVY PLUS SIGN", "plus"},
+	{"➖", "-", "operators", "HEAVY MINUS SIGN", "minus"},
+	{"✖️", "*", "operators", "HEAVY MULTIPLICATION X", "times"},
+	{"➗", "/", "operators", "HEAVY DIVISION SIGN", "divided by"},
+	{"🍰", "%", "operators", "SHORTCAKE", "modulo"},
+	{"🔺", "**", "operators", "UP-POINTING RED TRIANGLE", "to the power of"},
+	{"🟰", "===", "operators", "HEAVY EQUALS SIGN", "is equal to"},
+	{"❗", "!==", "operators", "HEAVY EXCLAMATION MARK SYMBOL", "is not equal to"},
+	{"⬆️", ">", "operators", "UPWARDS BLACK ARROW", "is greater than"},
+	{"⬇️", "<", "operators", "DOWNWARDS BLACK ARROW", "is less than"},
+	{"📈", ">=", "operators", "CHART WITH UPWARDS TREND", "is at least"},
+	{"📉", "<=", "operators", "CHART WITH DOWNWARDS TREND", "is at most"},
+	{"🔗", "&&", "operators", "LINK SYMBOL", "and"},
+	{"🔀", "||", "operators", "TWISTED RIGHTWARDS ARROWS", "or"},
+	{"🚫", "!", "operators", "NO ENTRY SIGN", "not"},
+	{"📊", "typeof", "operators", "BAR CHART", "type of"},
+	{"🔍", "in", "operators", "LEFT-POINTING MAGNIFYING GLASS", "in"},
+	{"🗑️", "delete", "operators", "WASTEBASKET", "delete"},
+
+	{"📝", "console.log", "io", "MEMO", "print"},
+	{"📥", "import", "io", "INBOX TRAY", "import"},
+	{"📤", "export", "io", "OUTBOX TRAY", "export"},
+	{"⏰", "EmojiTime", "io", "ALARM CLOCK", "time"},
+	{"🎤", "EmojiInput", "io", "MICROPHONE", "input"},
+	{"🧾", "JSON.stringify", "io", "RECEIPT", "to JSON"},
+	{"📂", "JSON.parse", "io", "OPEN FILE FOLDER", "parse JSON"},
+	{"📖", "EmojiReadFile", "io", "OPEN BOOK", "read file"},
+	{"✍️", "EmojiWriteFile", "io", "WRITING HAND", "write file"},
+	{"🌐", "EmojiFetch", "io", "GLOBE WITH MERIDIANS", "fetch"},
+
+	{"🎁", "new", "data_structures", "WRAPPED PRESENT", "new"},
+	{"🔐", "class", "data_structures", "CLOSED LOCK WITH KEY", "class"},
+	{"🎨", "extends", "data_structures", "ARTIST PALETTE", "extends"},
+	{"🌟", "static", "data_structures", "GLOWING STAR", "static"},
+	{"🔧", "constructor", "data_structures", "WRENCH", "constructor"},
+	{"🎭", "this", "data_structures", "PERFORMING ARTS", "this"},
+	{"🧱", "record", "data_structures", "BRICK", "record"},
+}
@@ -0,0 +1,293 @@
+package transpiler
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// Node is a node of an emoji program's syntax tree: a Leaf or a Group
+type Node interface {
+	// Pos returns the line and column the node starts at
+	Pos() (line, column int)
+}
+
+// Leaf is a single token
+type Leaf struct {
+	Token Token
+}
+
+func (n *Leaf) Pos() (int, int) { return n.Token.Line, n.Token.Column }
+
+// Group is a bracketed part of the program, '(' ')', '[' ']' or '{' '}',
+// with what lies between. Close is nil when the group is never closed.
+type Group struct {
+	Open     Token
+	Close    *Token
+	Children []Node
+}
+
+func (n *Group) Pos() (int, int) { return n.Open.Line, n.Open.Column }
+
+// Program is the root of the tree. Children nests its brackets and Body
+// holds its statements; generation writes the program from its tokens.
+type Program struct {
+	Children []Node
+	Body     []*Syntax
+	tokens   []Token
+	// sugar holds the records, getters and switch expressions, by the
+	// index of their first token
+	sugar map[int]*sugar
+}
+
+func (n *Program) Pos() (int, int) { return 1, 1 }
+
+// closers maps each opening bracket to its closing one
+var closers = map[string]string{"(": ")", "[": "]", "{": "}"}
+
+// bracketNames name brackets in errors the way hints recognizes them
+var bracketNames = map[string]string{
+	"(": "parentheses", ")": "parentheses",
+	"[": "brackets", "]": "brackets",
+	"{": "braces", "}": "braces",
+}
+
+// Parser builds the syntax tree of plain emoji syntax from its tokens:
+// the nesting of its brackets, which keeps every token, and its
+// statements and expressions (see Syntax). It recovers from errors, so a
+// tree is built for any source.
+type Parser struct {
+	tokens []Token
+	errors []*SyntaxError
+	// unterminated is set when the tokens end in a string, comment or
+	// other token that was never closed
+	unterminated bool
+}
+
+// NewParser prepares a parser for tokens from a Lexer
+func NewParser(tokens []Token) *Parser {
+	return &Parser{tokens: tokens}
+}
+
+// ParseEmoji lexes and parses code, returning its tree along with every
+// syntax error found, in source order
+func ParseEmoji(code string) (*Program, []*SyntaxError) {
+	return parseEmojiTokens(lexEmoji(code))
+}
+
+// parseEmojiTokens parses the tokens of lexEmoji, returning the tree and
+// every syntax error, the lexer's included, in source order
+func parseEmojiTokens(tokens []Token, lexErrors []*SyntaxError) (*Program, []*SyntaxError) {
+	parser := NewParser(tokens)
+	parser.unterminated = len(lexErrors) > 0
+	program, parseErrors := parser.Parse()
+	errors := append(lexErrors, parseErrors...)
+	sortSyntaxErrors(errors)
+	return program, errors
+}
+
+// lexEmoji lexes plain emoji syntax with each shortcode read as the emoji
+// it names: one token at the shortcode's position, whose text is the
+// emoji. Emoji run together this way read as the compound operator they
+// spell, as they do written out.
+func lexEmoji(code string) ([]Token, []*SyntaxError) {
+	lexed, errors := Lex(code)
+	if !strings.Contains(code, ":") {
+		return lexed, errors
+	}
+	tokens := make([]Token, 0, len(lexed))
+	expanded := false
+	for i := 0; i < len(lexed); i++ {
+		token := lexed[i]
+		if emoji, end, ok := shortcodeAt(lexed, i); ok {
+			if shortcode, _ := Lex(emoji); len(shortcode) == 1 {
+				token.Kind, token.Text, token.Keyword = shortcode[0].Kind, shortcode[0].Text, shortcode[0].Keyword
+				i, expanded = end, true
+			}
+		}
+		tokens = append(tokens, token)
+	}
+	if !expanded {
+		return lexed, errors
+	}
+	joined := tokens[:0]
+	for i := 0; i < len(tokens); i++ {
+		token := tokens[i]
+		if isEmojiToken(token) {
+			text, end := NormalizeVariants(token.Text), i
+			for j := i + 1; j < i+maxCompoundEmoji && j < len(tokens) && isEmojiToken(tokens[j]); j++ {
+				text += NormalizeVariants(tokens[j].Text)
+				if keyword, ok := compoundKeywords[text]; ok {
+					token.Kind, token.Keyword, end = TokenKeyword, keyword, j
+				}
+			}
+			for _, next := range tokens[i+1 : end+1] {
+				token.Text += next.Text
+			}
+			i = end
+		}
+		joined = append(joined, token)
+	}
+	return joined, errors
+}
+
+// Parse nests the tokens into groups and reads the statements they make
+// up, reporting closing brackets without an opening one, groups that are
+// never closed, prefix operators before ** (see checkExponents) and
+// statements that aren't valid JavaScript: an operator missing its
+// operand, another expression left out, an assignment to something that
+// can't be assigned to or a token where none can go. Statements are only
+// checked when the brackets balance and every token was closed, since
+// otherwise their errors would only repeat that.
+func (p *Parser) Parse() (*Program, []*SyntaxError) {
+	program := &Program{}
+	// open holds the groups not yet closed, innermost last
+	var open []*Group
+	add := func(n Node) {
+		if len(open) > 0 {
+			top := open[len(open)-1]
+			top.Children = append(top.Children, n)
+		} else {
+			program.Children = append(program.Children, n)
+		}
+	}
+	unclosed := func(g *Group) {
+		p.fail(g.Open, fmt.Sprintf("unbalanced %s: '%s' is never closed", bracketNames[g.Open.Text], g.Open.Text))
+	}
+
+	leaves := make([]Leaf, len(p.tokens))
+	for i, tok := range p.tokens {
+		leaves[i].Token = tok
+		if tok.Kind != TokenPunct {
+			add(&leaves[i])
+			continue
+		}
+		if _, ok := closers[tok.Text]; ok {
+			g := &Group{Open: tok}
+			add(g)
+			open = append(open, g)
+			continue
+		}
+		if !strings.Contains(")]}", tok.Text) {
+			add(&leaves[i])
+			continue
+		}
+
+		// close the innermost group this bracket closes; groups inside it
+		// were left open
+		match := len(open) - 1
+		for match >= 0 && closers[open[match].Open.Text] != tok.Text {
+			match--
+		}
+		if match < 0 {
+			p.fail(tok, fmt.Sprintf("unbalanced %s: '%s' has no matching '%s'", bracketNames[tok.Text], tok.Text, opener(tok.Text)))
+			add(&leaves[i])
+			continue
+		}
+		for _, g := range open[match+1:] {
+			unclosed(g)
+		}
+		open[match].Close = &leaves[i].Token
+		open = open[:match]
+	}
+	for _, g := range open {
+		unclosed(g)
+	}
+	balanced := len(p.errors) == 0
+	p.errors = append(p.errors, checkExponents(program.Children)...)
+
+	syntax := newSyntaxParser(p.tokens)
+	program.Body = syntax.program()
+	program.tokens, program.sugar = p.tokens, syntax.sugar
+	if balanced && !p.unterminated {
+		p.errors = append(p.errors, syntax.errors...)
+	}
+	return program, p.errors
+}
+
+func (p *Parser) fail(at Token, message string) {
+	p.errors = append(p.errors, &SyntaxError{Line: at.Line, Column: at.Column, Message: message, Length: 1, Code: CodeUnbalancedBracket})
+}
+
+// opener returns the opening bracket for a closing one
+func opener(close string) string {
+	for open, c := range closers {
+		if c == close {
+			return open
+		}
+	}
+	return ""
+}
+
+func sortSyntaxErrors(errors []*SyntaxError) {
+	sort.SliceStable(errors, func(i, j int) bool {
+		a, b := errors[i], errors[j]
+		return a.Line < b.Line || a.Line == b.Line && a.Column < b.Column
+	})
+}
+
+// Generate writes the program in the target language, spelling each
+// keyword emoji out and copying every other token as it is. Records,
+// getters and switch expressions are written as the JavaScript they stand
+// for. JavaScript and TypeScript spell the keywords alike.
+func (n *Program) Generate(targetLang string) string {
+	return n.text([2]int{0, len(n.tokens) - 1}, targetLang)
+}
+
+// text writes a range of the program's tokens, first and last, in the
+// target language
+func (n *Program) text(span [2]int, targetLang string) string {
+	var b strings.Builder
+	for i := span[0]; i <= span[1]; i++ {
+		if s, ok := n.sugar[i]; ok && s.last <= span[1] {
+			indent := n.indent(i)
+			b.WriteString(strings.TrimPrefix(s.render(n, targetLang, indent), indent))
+			i = s.last
+			continue
+		}
+		writeToken(&b, n.tokens[i])
+	}
+	return b.String()
+}
+
+// indent returns the whitespace the line of token i starts with
+func (n *Program) indent(i int) string {
+	for j := i - 1; j >= 0; j-- {
+		token := n.tokens[j]
+		at := strings.LastIndex(token.Text, "\n")
+		if at < 0 && j > 0 {
+			continue
+		}
+		if token.Kind != TokenSpace {
+			return ""
+		}
+		return token.Text[at+1:]
+	}
+	return ""
+}
+
+func generate(b *strings.Builder, nodes []Node) {
+	for _, n := range nodes {
+		switch n := n.(type) {
+		case *Leaf:
+			writeToken(b, n.Token)
+		case *Group:
+			writeToken(b, n.Open)
+			generate(b, n.Children)
+			if n.Close != nil {
+				writeToken(b, *n.Close)
+			}
+		}
+	}
+}
+
+func writeToken(b *strings.Builder, tok Token) {
+	switch tok.Kind {
+	case TokenKeyword:
+		b.WriteString(tok.Keyword)
+	case TokenEmoji:
+		b.WriteString(NormalizeVariants(tok.Text))
+	default:
+		b.WriteString(tok.Text)
+	}
+}
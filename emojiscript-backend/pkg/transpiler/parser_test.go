@@ -0,0 +1,79 @@
+package transpiler
+
+import "testing"
+
+// TestParseErrors checks that parsing reports statements that aren't
+// valid JavaScript, at the token that makes them so
+func TestParseErrors(t *testing.T) {
+	for _, tt := range []struct {
+		code         string
+		line, column int
+		want         string
+	}{
+		{"📝(1 ➕ )", 1, 5, CodeMissingExpression},
+		{"📦 x =", 1, 5, CodeMissingExpression},
+		{"📦 y = ✖️ 2", 1, 7, CodeMissingExpression},
+		{"📦 x\n📝(x)", 1, 1, CodeMissingExpression},
+		{"🔢 n = 1\n1 = n", 2, 1, CodeInvalidAssignment},
+		{"📝(1) ➕➕", 1, 1, CodeInvalidAssignment},
+		{"for (1 of []) {}", 1, 6, CodeInvalidAssignment},
+		{"📝(\"a\") 📝(\"b\")", 1, 8, CodeUnexpectedToken},
+		{"❓ x ⬆️ 1 { }", 1, 3, CodeUnexpectedToken},
+		{"📝(🎪 (n) { 🔘 1 ➡️ 2 })", 1, 3, CodeUnexpectedToken},
+	} {
+		_, errs := ParseEmoji(tt.code)
+		if len(errs) != 1 || errs[0].Line != tt.line || errs[0].Column != tt.column || errs[0].Code != tt.want {
+			t.Errorf("ParseEmoji(%q) = %v, want a %s error at %d:%d", tt.code, errs, tt.want, tt.line, tt.column)
+		}
+	}
+}
+
+// TestParseRecovers checks that an error abandons only its own
+// statement, and that statements go unchecked while brackets don't
+// balance
+func TestParseRecovers(t *testing.T) {
+	_, errs := ParseEmoji("📦 a = 1 ➕ ✖️ 2\n📝(a)\n🎯 f() {\n  🔙 ✖️\n}\n📦 b = 2")
+	if len(errs) != 2 || errs[0].Line != 1 || errs[1].Line != 4 {
+		t.Errorf("got %v, want errors on lines 1 and 4", errs)
+	}
+	_, errs = ParseEmoji("📝(1 ➕ \n📝(2)")
+	if len(errs) != 1 || errs[0].Code != CodeUnbalancedBracket {
+		t.Errorf("got %v, want only the unbalanced bracket", errs)
+	}
+}
+
+// TestParseValid checks that valid programs parse without errors
+func TestParseValid(t *testing.T) {
+	for _, code := range []string{
+		"📦 [a, b] = [1, 2]\n🔢 {c, d: [e = 3]} = {c: a, d: [b]}\n[a, b] = [b, a]",
+		"⚡ 🎯 load(url, ...rest) {\n  📦 r = ⏳ 🌐(url)\n  🔙 r?.body ?? `none ${rest.length}`\n}",
+		"🔐 Dog 🎨 Animal {\n  🌟 #count = 0\n  🔧(name) { super(name) }\n  🎭.label 🧲 `dog ${🎭.name}`\n}",
+		"🛡️ { 💥 🎁 Error(\"x\") } 🚨 (e) { 📝(e) } 🏆 { }\nouter: 🔁 (🔢 i = 0; i ⬇️ 3; i➕➕) { ⏭️ outer }",
+		"📥 { a as b } from \"./m\"\n📤 📦 size = 🎪 (b) {\n  🔘 1 ➡️ \"one\"\n  🔘 _ ➡️ \"many\"\n}\n📤 🧱 Point(x: number, y: number)",
+		"📦 f = (x) ➡️ x 🔺 2\n📦 re = /a+/g.test(\"aa\") ? 1 : 2",
+	} {
+		if _, errs := ParseEmoji(code); len(errs) > 0 {
+			t.Errorf("ParseEmoji(%q) = %v", code, errs)
+		}
+	}
+}
+
+// TestGenerateSugar checks that records, getters and switch expressions
+// generate from the parsed program as the line-by-line expansions write
+// them
+func TestGenerateSugar(t *testing.T) {
+	for _, code := range []string{
+		"🧱 Point(x: number, y: number)\n📦 p = 🎁 Point(1, 2)",
+		"🎯 f() {\n  🧱 Pair(a, b);\n}",
+		"🔐 Person {\n  🎭.name 🧲 🎭.first ➕ \" \" ➕ 🎭.last\n  🎭.upper 🧲 {\n    🔙 🎭.name.toUpperCase()\n  }\n}",
+		"📦 size = 🎪 (n ➕ 1) {\n  🔘 1 ➡️ \"one\"\n  🔘 2 ➡️ \"two\",\n  🔘 _ ➡️ \"many\"\n}\n📝(size)",
+		"🔢 label\nlabel = 🎪 (code) {\n  🔘 200 ➡️ \"OK\"\n}",
+	} {
+		for _, target := range []string{"javascript", "typescript", "es5"} {
+			want := ReplaceKeywordEmoji(ExpandGetters(ExpandSwitchExpressions(ExpandRecords(code, target), target)))
+			if got := TranspileEmoji(code, target); got != want {
+				t.Errorf("%s: TranspileEmoji(%q) =\n%s\nwant\n%s", target, code, got, want)
+			}
+		}
+	}
+}
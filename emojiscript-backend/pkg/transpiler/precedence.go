@@ -0,0 +1,559 @@
+package transpiler
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// operatorBinding is how an operator binds. Emoji operators become their
+// JavaScript spelling, so they bind as JavaScript's do; the levels are
+// those of MDN's precedence table, higher binding tighter.
+type operatorBinding struct {
+	precedence int
+	// right groups a chain of the operator right to left, as in
+	// a ** b ** c or a = b = c
+	right bool
+	unary bool
+}
+
+// operatorBindings is the precedence table for every operator an
+// expression can use, whether written as an emoji or in JavaScript.
+// Prefix + and - are unary at their own level when nothing comes before
+// them; ++ and -- after an operand are postfix, binding tighter still.
+var operatorBindings = map[string]operatorBinding{
+	"!": {14, true, true}, "~": {14, true, true}, "typeof": {14, true, true}, "void": {14, true, true}, "delete": {14, true, true}, "await": {14, true, true},
+	"**": {13, true, false},
+	"*":  {12, false, false}, "/": {12, false, false}, "%": {12, false, false},
+	"+": {11, false, false}, "-": {11, false, false},
+	"<<": {10, false, false}, ">>": {10, false, false}, ">>>": {10, false, false},
+	"<": {9, false, false}, ">": {9, false, false}, "<=": {9, false, false}, ">=": {9, false, false}, "in": {9, false, false}, "instanceof": {9, false, false},
+	"==": {8, false, false}, "!=": {8, false, false}, "===": {8, false, false}, "!==": {8, false, false},
+	"&":  {7, false, false},
+	"^":  {6, false, false},
+	"|":  {5, false, false},
+	"&&": {4, false, false},
+	"||": {3, false, false}, "??": {3, false, false},
+	"=": {2, true, false}, "+=": {2, true, false}, "-=": {2, true, false}, "*=": {2, true, false}, "/=": {2, true, false}, "%=": {2, true, false}, "**=": {2, true, false},
+	"<<=": {2, true, false}, ">>=": {2, true, false}, ">>>=": {2, true, false}, "&=": {2, true, false}, "|=": {2, true, false}, "^=": {2, true, false},
+	"&&=": {2, true, false}, "||=": {2, true, false}, "??=": {2, true, false}, "=>": {2, true, false},
+}
+
+// postfixPrecedence is the level of ++ and -- after an operand, which
+// the table leaves out since they can be prefix operators too
+const postfixPrecedence = 15
+
+// compoundOperators are operators written as two or three operator emoji
+// with nothing between them; each is read as one operator rather than as
+// the operators of its parts, which wouldn't be valid JavaScript together.
+// Transcription reads each as its spoken phrase, so the text reads back
+// as the same operator and not as two.
+var compoundOperators = []struct {
+	emoji   string
+	keyword string
+	spoken  string
+}{
+	{"⬆️🟰", ">=", "is greater than or equal to"},
+	{"⬇️🟰", "<=", "is less than or equal to"},
+	{"🟰🟰", "===", "is strictly equal to"},
+	{"🟰🟰🟰", "===", "is identical to"},
+	{"❗🟰", "!==", "is not identical to"},
+	{"➕🟰", "+=", "increases by"},
+	{"➖🟰", "-=", "decreases by"},
+	{"✖️🟰", "*=", "is multiplied by"},
+	{"➗🟰", "/=", "is divided by"},
+	{"🍰🟰", "%=", "is reduced modulo"},
+	{"🔺🟰", "**=", "is raised to the power of"},
+	{"✖️✖️", "**", "raised to"},
+	{"✖️✖️🟰", "**=", "is raised to"},
+	{"➕➕", "++", "increment"},
+	{"➖➖", "--", "decrement"},
+}
+
+// compoundKeywords maps each compound operator, with its variation
+// selectors normalized, to its keyword
+var compoundKeywords = func() map[string]string {
+	keywords := map[string]string{}
+	for _, compound := range compoundOperators {
+		keywords[NormalizeVariants(compound.emoji)] = compound.keyword
+	}
+	return keywords
+}()
+
+// maxCompoundEmoji is the most emoji a compound operator is written with
+const maxCompoundEmoji = 3
+
+// compoundOperator returns the end of the longest compound operator
+// written from start, whose first emoji ends at end, and its keyword; the
+// end is unchanged when there is none
+func compoundOperator(runes []rune, start, end int) (int, string) {
+	text, best, keyword := NormalizeVariants(string(runes[start:end])), end, ""
+	for i := 1; i < maxCompoundEmoji && end < len(runes) && isEmojiBase(runes[end]); i++ {
+		next := emojiEnd(runes, end)
+		text += NormalizeVariants(string(runes[end:next]))
+		end = next
+		if k, ok := compoundKeywords[text]; ok {
+			best, keyword = end, k
+		}
+	}
+	return best, keyword
+}
+
+// punctOperators are the operators spelled in punctuation, longest first,
+// for reading runs of punctuation tokens greedily
+var punctOperators = func() []string {
+	var operators []string
+	for operator := range operatorBindings {
+		if !isIdentRune([]rune(operator)[0]) {
+			operators = append(operators, operator)
+		}
+	}
+	operators = append(operators, "++", "--")
+	sort.Slice(operators, func(i, j int) bool {
+		if len(operators[i]) != len(operators[j]) {
+			return len(operators[i]) > len(operators[j])
+		}
+		return operators[i] < operators[j]
+	})
+	return operators
+}()
+
+// Expression is an expression read by ParseExpression: an operand, or an
+// operator applied to its operands
+type Expression struct {
+	// Operator is empty for an operand
+	Operator string `json:"operator,omitempty"`
+	// Postfix marks ++ or -- written after its operand
+	Postfix  bool          `json:"postfix,omitempty"`
+	Operands []*Expression `json:"operands,omitempty"`
+	// Text is an operand's JavaScript: a name, a literal, a call, ...
+	Text string `json:"text,omitempty"`
+	// grouped marks an expression written in parentheses
+	grouped bool
+}
+
+// String writes the expression as JavaScript with every operator and its
+// operands in parentheses, so its grouping is explicit
+func (e *Expression) String() string {
+	switch {
+	case e.Operator == "":
+		return e.Text
+	case len(e.Operands) == 2:
+		return "(" + e.Operands[0].String() + " " + e.Operator + " " + e.Operands[1].String() + ")"
+	case e.Postfix:
+		return "(" + e.Operands[0].String() + e.Operator + ")"
+	case isIdentRune([]rune(e.Operator)[0]):
+		return "(" + e.Operator + " " + e.Operands[0].String() + ")"
+	}
+	return "(" + e.Operator + e.Operands[0].String() + ")"
+}
+
+// ParseExpression reads one expression in emoji syntax, or plain
+// JavaScript, grouping its operators by precedence climbing over the
+// precedence table. Calls, member accesses and array and object literals
+// are operands; the conditional and comma operators aren't supported.
+func ParseExpression(code string) (*Expression, error) {
+	tokens, errs := Lex(code)
+	if len(errs) > 0 {
+		return nil, errs[0]
+	}
+	p := &expressionParser{}
+	space := false
+	for _, token := range tokens {
+		if token.Kind == TokenSpace || token.Kind == TokenComment {
+			space = true
+			continue
+		}
+		p.tokens = append(p.tokens, token)
+		p.spaced = append(p.spaced, space && len(p.tokens) > 1)
+		space = false
+	}
+	if len(p.tokens) == 0 {
+		return nil, &SyntaxError{Line: 1, Column: 1, Message: "expected an expression", Length: 1, Code: CodeInvalidExpression}
+	}
+	expression, err := p.binary(0)
+	if err != nil {
+		return nil, err
+	}
+	if p.pos < len(p.tokens) {
+		return nil, p.fail("unexpected '%s'", p.tokens[p.pos].Text)
+	}
+	return expression, nil
+}
+
+// expressionParser reads an expression from its significant tokens
+type expressionParser struct {
+	tokens []Token
+	// spaced marks the tokens with space or a comment before them
+	spaced []bool
+	pos    int
+}
+
+// fail returns a syntax error at the current token, or at the last one
+// when the expression ended early
+func (p *expressionParser) fail(format string, args ...interface{}) error {
+	token := p.tokens[min(p.pos, len(p.tokens)-1)]
+	return &SyntaxError{Line: token.Line, Column: token.Column, Message: fmt.Sprintf(format, args...), Length: 1, Code: CodeInvalidExpression}
+}
+
+// text is a token's JavaScript
+func (p *expressionParser) text(token Token) string {
+	if token.Kind == TokenKeyword {
+		return token.Keyword
+	}
+	return token.Text
+}
+
+// operator reads the operator at the current position without consuming
+// it, returning it and how many tokens it spans
+func (p *expressionParser) operator() (string, int) {
+	if p.pos >= len(p.tokens) {
+		return "", 0
+	}
+	token := p.tokens[p.pos]
+	switch token.Kind {
+	case TokenKeyword, TokenIdent:
+		text := p.text(token)
+		if _, ok := operatorBindings[text]; ok || text == "++" || text == "--" {
+			return text, 1
+		}
+		return "", 0
+	case TokenPunct:
+		// punctuation comes a character at a time; an operator is the
+		// longest run of adjacent ones that spells one
+		run := ""
+		for i := p.pos; i < len(p.tokens) && p.tokens[i].Kind == TokenPunct && (i == p.pos || !p.spaced[i]); i++ {
+			run += p.tokens[i].Text
+		}
+		for _, operator := range punctOperators {
+			if strings.HasPrefix(run, operator) {
+				return operator, len([]rune(operator))
+			}
+		}
+	}
+	return "", 0
+}
+
+// binary reads operators binding at least as tightly as minPrecedence
+func (p *expressionParser) binary(minPrecedence int) (*Expression, error) {
+	left, err := p.unary()
+	if err != nil {
+		return nil, err
+	}
+	for {
+		operator, width := p.operator()
+		binding, ok := operatorBindings[operator]
+		if !ok || binding.unary || binding.precedence < minPrecedence {
+			return left, nil
+		}
+		// JavaScript won't guess whether -a ** b means (-a) ** b
+		if operator == "**" && len(left.Operands) == 1 && !left.Postfix && !left.grouped {
+			return nil, p.fail("the operand of '%s' before '**' needs parentheses", left.Operator)
+		}
+		p.pos += width
+		next := binding.precedence + 1
+		if binding.right {
+			next = binding.precedence
+		}
+		right, err := p.binary(next)
+		if err != nil {
+			return nil, err
+		}
+		left = &Expression{Operator: operator, Operands: []*Expression{left, right}}
+	}
+}
+
+// unary reads prefix operators, an operand and any postfix ++ or --
+func (p *expressionParser) unary() (*Expression, error) {
+	operator, width := p.operator()
+	if binding, ok := operatorBindings[operator]; ok && binding.unary || operator == "+" || operator == "-" || operator == "++" || operator == "--" {
+		p.pos += width
+		operand, err := p.unary()
+		if err != nil {
+			return nil, err
+		}
+		return &Expression{Operator: operator, Operands: []*Expression{operand}}, nil
+	}
+	operand, err := p.operand()
+	if err != nil {
+		return nil, err
+	}
+	for {
+		operator, width := p.operator()
+		if operator != "++" && operator != "--" {
+			return operand, nil
+		}
+		p.pos += width
+		operand = &Expression{Operator: operator, Postfix: true, Operands: []*Expression{operand}}
+	}
+}
+
+// operand reads a name, a literal, a group in parentheses or a bracketed
+// literal, with the calls, indexes and member accesses after it
+func (p *expressionParser) operand() (*Expression, error) {
+	if p.pos >= len(p.tokens) {
+		return nil, p.fail("expected an expression")
+	}
+	token := p.tokens[p.pos]
+	var operand *Expression
+	switch {
+	case token.Kind == TokenPunct && token.Text == "(":
+		p.pos++
+		inner, err := p.binary(0)
+		if err != nil {
+			return nil, err
+		}
+		if p.pos >= len(p.tokens) || p.tokens[p.pos].Text != ")" {
+			return nil, p.fail("expected ')'")
+		}
+		p.pos++
+		operand = inner
+		operand.grouped = true
+	case token.Kind == TokenPunct && (token.Text == "[" || token.Text == "{"):
+		text, err := p.bracketed()
+		if err != nil {
+			return nil, err
+		}
+		operand = &Expression{Text: text}
+	case token.Kind == TokenTemplate:
+		start := p.pos
+		for p.pos++; p.pos < len(p.tokens) && !(p.tokens[p.pos-1].Kind == TokenTemplate && strings.HasSuffix(p.tokens[p.pos-1].Text, "`") && (p.pos-1 > start || len(p.tokens[start].Text) > 1)); p.pos++ {
+		}
+		operand = &Expression{Text: p.join(start, p.pos)}
+	case token.Kind == TokenPunct, token.Kind == TokenKeyword && operatorBindings[token.Keyword] != (operatorBinding{}):
+		return nil, p.fail("unexpected '%s'", token.Text)
+	default:
+		p.pos++
+		operand = &Expression{Text: p.text(token)}
+	}
+
+	// calls, indexes and member accesses bind tightest of all
+	for p.pos < len(p.tokens) {
+		start := p.pos
+		switch text := p.tokens[p.pos].Text; {
+		case text == "(" || text == "[":
+			if _, err := p.bracketed(); err != nil {
+				return nil, err
+			}
+		case text == "." || text == "?" && p.pos+1 < len(p.tokens) && p.tokens[p.pos+1].Text == "." && !p.spaced[p.pos+1]:
+			if text == "?" {
+				p.pos++
+			}
+			p.pos++
+			if p.pos < len(p.tokens) && p.tokens[p.pos].Text != "(" && p.tokens[p.pos].Text != "[" {
+				p.pos++
+			}
+		default:
+			return operand, nil
+		}
+		suffix := p.join(start, p.pos)
+		if operand.Operator != "" {
+			operand = &Expression{Text: operand.String() + suffix}
+		} else {
+			operand = &Expression{Text: operand.Text + suffix}
+		}
+	}
+	return operand, nil
+}
+
+// bracketed consumes a bracket and everything up to its match, returning
+// their JavaScript
+func (p *expressionParser) bracketed() (string, error) {
+	start := p.pos
+	var open []string
+	for ; p.pos < len(p.tokens); p.pos++ {
+		token := p.tokens[p.pos]
+		if token.Kind != TokenPunct {
+			continue
+		}
+		if closer, ok := closers[token.Text]; ok {
+			open = append(open, closer)
+			continue
+		}
+		if len(open) > 0 && token.Text == open[len(open)-1] {
+			open = open[:len(open)-1]
+			if len(open) == 0 {
+				p.pos++
+				return p.join(start, p.pos), nil
+			}
+		}
+	}
+	p.pos = start
+	return "", p.fail("'%s' is never closed", p.tokens[start].Text)
+}
+
+// join writes tokens from start up to end as JavaScript, with a space
+// where the source had space
+func (p *expressionParser) join(start, end int) string {
+	b := &strings.Builder{}
+	for i := start; i < end; i++ {
+		if i > start && p.spaced[i] {
+			b.WriteByte(' ')
+		}
+		b.WriteString(p.text(p.tokens[i]))
+	}
+	return b.String()
+}
+
+// CheckPrecedence reports whether the JavaScript an emoji expression
+// transpiles to groups the way the expression does under the precedence
+// table, returning an error that shows both groupings when it doesn't
+func CheckPrecedence(code string) error {
+	intended, err := ParseExpression(code)
+	if err != nil {
+		return err
+	}
+	output := TranspileEmoji(code, "javascript")
+	generated, err := ParseExpression(output)
+	if err != nil {
+		return fmt.Errorf("%s transpiles to %s, which doesn't parse: %v", code, output, err)
+	}
+	if generated.String() != intended.String() {
+		return fmt.Errorf("%s transpiles to %s, which groups as %s instead of %s", code, output, generated, intended)
+	}
+	return nil
+}
+
+// prefixOperators are the unary operators JavaScript won't take as the
+// left operand of ** without parentheses
+var prefixOperators = map[string]bool{
+	"!": true, "~": true, "+": true, "-": true, "typeof": true, "void": true, "delete": true, "await": true,
+}
+
+// operandKeywords are the keywords that are operands on their own
+var operandKeywords = map[string]bool{
+	"this": true, "true": true, "false": true, "null": true, "undefined": true,
+}
+
+// checkExponents reports each ** (🔺 or ✖️✖️) whose left operand has a
+// prefix operator, as in -a ** 2, which JavaScript rejects as ambiguous;
+// the transpiler would otherwise copy it into a SyntaxError
+func checkExponents(nodes []Node) []*SyntaxError {
+	var errors []*SyntaxError
+	for i, n := range nodes {
+		if g, ok := n.(*Group); ok {
+			errors = append(errors, checkExponents(g.Children)...)
+			continue
+		}
+		if !isExponent(nodes, i) {
+			continue
+		}
+		start := i - 1
+		for start >= 0 && isSpace(nodes[start]) {
+			start--
+		}
+		end := start
+		for start >= 0 && isOperand(nodes[start]) {
+			start--
+		}
+		if start == end {
+			continue
+		}
+		for start >= 0 && isSpace(nodes[start]) {
+			start--
+		}
+		if start < 0 {
+			continue
+		}
+		if operator, ok := prefixOperator(nodes, start); ok {
+			at := nodes[start].(*Leaf).Token
+			errors = append(errors, &SyntaxError{Line: at.Line, Column: at.Column, Message: fmt.Sprintf("the operand of '%s' before '**' needs parentheses", operator), Length: 1, Code: CodeInvalidExpression})
+		}
+	}
+	return errors
+}
+
+// isExponent reports whether nodes[i] starts a ** operator: 🔺, ✖️✖️ or
+// two adjacent asterisks that aren't **=
+func isExponent(nodes []Node, i int) bool {
+	leaf, ok := nodes[i].(*Leaf)
+	switch {
+	case !ok:
+		return false
+	case leaf.Token.Kind == TokenKeyword:
+		return leaf.Token.Keyword == "**"
+	}
+	return isPunct(leaf, "*") && i+1 < len(nodes) && isPunct(nodes[i+1], "*") &&
+		(i == 0 || !isPunct(nodes[i-1], "*")) && (i+2 >= len(nodes) || !isPunct(nodes[i+2], "="))
+}
+
+// isOperand reports whether a node is part of an operand, with the
+// keywords that are operands on their own
+func isOperand(n Node) bool {
+	if leaf, ok := n.(*Leaf); ok && leaf.Token.Kind == TokenKeyword {
+		return operandKeywords[leaf.Token.Keyword]
+	}
+	return operandPart(n)
+}
+
+// prefixOperator returns the operator nodes[i] spells when it's a prefix
+// operator: + and - are prefix only where no operand comes before them,
+// and not when doubled into ++ or --, which JavaScript does allow
+func prefixOperator(nodes []Node, i int) (string, bool) {
+	leaf, ok := nodes[i].(*Leaf)
+	if !ok {
+		return "", false
+	}
+	text := leaf.Token.Text
+	switch leaf.Token.Kind {
+	case TokenKeyword:
+		text = leaf.Token.Keyword
+	case TokenIdent, TokenPunct:
+	default:
+		return "", false
+	}
+	if !prefixOperators[text] || leaf.Token.Kind == TokenIdent && (text == "+" || text == "-") {
+		return "", false
+	}
+	if text != "+" && text != "-" {
+		return text, true
+	}
+	if leaf.Token.Kind == TokenPunct && i > 0 && isPunct(nodes[i-1], text) {
+		return "", false
+	}
+	before := i - 1
+	for before >= 0 && isSpace(nodes[before]) {
+		before--
+	}
+	if before >= 0 && isOperand(nodes[before]) {
+		return "", false
+	}
+	return text, true
+}
+
+// operandPart reports whether a node can be part of a postfix expression
+// such as a.b[c](d): a name, literal, bracketed group or '.'
+func operandPart(n Node) bool {
+	switch n := n.(type) {
+	case *Group:
+		return n.Open.Text != "{"
+	case *Leaf:
+		switch n.Token.Kind {
+		case TokenIdent, TokenNumber, TokenString, TokenRegex, TokenEmoji:
+			return true
+		case TokenTemplate:
+			return strings.HasPrefix(n.Token.Text, "`") && strings.HasSuffix(n.Token.Text, "`") && len(n.Token.Text) > 1
+		case TokenPunct:
+			return n.Token.Text == "."
+		}
+	}
+	return false
+}
+
+func isPunct(n Node, texts ...string) bool {
+	leaf, ok := n.(*Leaf)
+	if !ok || leaf.Token.Kind != TokenPunct {
+		return false
+	}
+	for _, text := range texts {
+		if leaf.Token.Text == text {
+			return true
+		}
+	}
+	return false
+}
+
+func isSpace(n Node) bool {
+	leaf, ok := n.(*Leaf)
+	return ok && leaf.Token.Kind == TokenSpace
+}
@@ -0,0 +1,97 @@
+package transpiler
+
+import (
+	"math/rand"
+	"strconv"
+	"testing"
+)
+
+// randomExpressions generates n expressions over the operators that
+// combine numbers and booleans, as `emojic precedence -check` does
+func randomExpressions(seed int64, n int) []string {
+	var binary, prefix []string
+	for _, operator := range BuildGrammar().Operators {
+		if operator.Keyword == "!" || operator.Keyword == "-" {
+			prefix = append(prefix, operator.Emoji)
+		}
+		if !operator.Unary && operator.Precedence > 2 && operator.Keyword != "in" {
+			binary = append(binary, operator.Emoji)
+		}
+	}
+
+	rng := rand.New(rand.NewSource(seed))
+	var generate func(depth int) string
+	generate = func(depth int) string {
+		switch n := rng.Intn(10); {
+		case depth == 0 || n < 3:
+			return strconv.Itoa(rng.Intn(9) + 1)
+		case n == 3:
+			// spaced, so two minuses don't make ➖➖, a decrement
+			return prefix[rng.Intn(len(prefix))] + " " + generate(depth-1)
+		case n == 4:
+			return "(" + generate(depth-1) + ")"
+		}
+		return generate(depth-1) + " " + binary[rng.Intn(len(binary))] + " " + generate(depth-1)
+	}
+	expressions := make([]string, n)
+	for i := range expressions {
+		expressions[i] = generate(4)
+	}
+	return expressions
+}
+
+// TestTranspiledPrecedence checks that the JavaScript each expression
+// transpiles to groups as the precedence table says
+func TestTranspiledPrecedence(t *testing.T) {
+	for _, code := range randomExpressions(1, 2000) {
+		if _, err := ParseExpression(code); err != nil {
+			continue
+		}
+		if err := CheckPrecedence(code); err != nil {
+			t.Error(err)
+		}
+	}
+}
+
+// TestExponentOperands checks that transpiling rejects exactly the
+// expressions ParseExpression rejects for a prefix operator before **,
+// so none is copied into JavaScript that doesn't parse
+func TestExponentOperands(t *testing.T) {
+	for _, code := range randomExpressions(2, 2000) {
+		_, want := ParseExpression(code)
+		_, errs := ParseEmoji("📦 x = " + code)
+		if (want != nil) != (len(errs) > 0) {
+			t.Errorf("%s: ParseExpression says %v, ParseEmoji %v", code, want, errs)
+		}
+	}
+}
+
+func TestPrefixBeforeExponent(t *testing.T) {
+	tests := []struct {
+		code   string
+		column int
+	}{
+		{"📦 x = ➖ a 🔺 2", 7},
+		{"📦 x = 🚫 a.b(1) ✖️✖️ 2", 7},
+		{"const x = -a ** 2", 11},
+		{"🔙 ➖ a 🔺 2", 3},
+		{"📊 a 🔺 2", 1},
+		{"📦 x = (➖ a) 🔺 2", 0},
+		{"📦 x = b ➖ a 🔺 2", 0},
+		{"x = b - a ** 2; y = a++ ** 2; z = --a ** 2", 0},
+		{"📦 x = 🎭 🔺 2", 0},
+		{"📦 s = \"-a 🔺 2\" // -a ** 2", 0},
+		{"x **= -a", 0},
+	}
+	for _, tt := range tests {
+		_, errs := ParseEmoji(tt.code)
+		switch {
+		case tt.column == 0 && len(errs) > 0:
+			t.Errorf("%s: unexpected error %v", tt.code, errs[0])
+		case tt.column > 0 && len(errs) != 1:
+			t.Errorf("%s: got %d errors, want 1", tt.code, len(errs))
+		case tt.column > 0 && (errs[0].Column != tt.column || errs[0].Code != CodeInvalidExpression):
+			t.Errorf("%s: got %v (%s), want an %s at column %d", tt.code, errs[0], errs[0].Code, CodeInvalidExpression, tt.column)
+		}
+	}
+}
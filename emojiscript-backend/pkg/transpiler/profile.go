@@ -0,0 +1,123 @@
+package transpiler
+
+import (
+	"encoding/json"
+	"time"
+)
+
+// Profile is the time a transpile spent in each phase, for finding what
+// makes a large program slow. Lexing includes rewriting emoji to
+// keywords; generating includes the rewrites, such as records and
+// switch expressions, made just before the output is written. Its
+// methods do nothing on a nil Profile, so phases can be timed without
+// checking whether the transpile is profiled.
+type Profile struct {
+	Lex      time.Duration
+	Parse    time.Duration
+	Analyze  time.Duration
+	Generate time.Duration
+}
+
+// phases of a transpile, for Profile.since
+const (
+	phaseLex = iota
+	phaseParse
+	phaseAnalyze
+	phaseGenerate
+)
+
+// since adds the time since start to a phase, returning now as the start
+// of the next one
+func (p *Profile) since(phase int, start time.Time) time.Time {
+	now := time.Now()
+	if p == nil {
+		return now
+	}
+	spent := now.Sub(start)
+	switch phase {
+	case phaseLex:
+		p.Lex += spent
+	case phaseParse:
+		p.Parse += spent
+	case phaseAnalyze:
+		p.Analyze += spent
+	case phaseGenerate:
+		p.Generate += spent
+	}
+	return now
+}
+
+// AddGenerate counts time spent generating output outside the
+// transpiler, such as codegen's from its JavaScript
+func (p *Profile) AddGenerate(d time.Duration) {
+	if p != nil {
+		p.Generate += d
+	}
+}
+
+// Add adds another profile's phases to p, for totalling the files of a
+// project
+func (p *Profile) Add(other Profile) {
+	if p != nil {
+		p.Lex += other.Lex
+		p.Parse += other.Parse
+		p.Analyze += other.Analyze
+		p.Generate += other.Generate
+	}
+}
+
+// Total is the time spent in every phase
+func (p Profile) Total() time.Duration {
+	return p.Lex + p.Parse + p.Analyze + p.Generate
+}
+
+// MarshalJSON writes each phase in milliseconds, e.g.
+// {"lexMs":0.12,"parseMs":0.4,"analyzeMs":0.3,"generateMs":1.1,"totalMs":1.92}
+func (p Profile) MarshalJSON() ([]byte, error) {
+	ms := func(d time.Duration) float64 { return float64(d.Microseconds()) / 1000 }
+	return json.Marshal(struct {
+		Lex      float64 `json:"lexMs"`
+		Parse    float64 `json:"parseMs"`
+		Analyze  float64 `json:"analyzeMs"`
+		Generate float64 `json:"generateMs"`
+		Total    float64 `json:"totalMs"`
+	}{ms(p.Lex), ms(p.Parse), ms(p.Analyze), ms(p.Generate), ms(p.Total())})
+}
+
+// CompileEmoji transpiles plain emoji syntax written in the dialect as
+// TranspileEmoji does, returning its syntax errors and diagnostics as
+// CheckEmoji and DiagnoseEmoji do, with each phase timed in profile,
+// which may be nil
+func (t *Transpiler) CompileEmoji(code string, profile *Profile) (output string, errors []string, diagnostics []Diagnostic) {
+	output, errors, diagnostics = compileEmoji(t.ApplyAliases(code), t.targetLang, profile)
+	return AddStdlib(output, t.targetLang), errors, diagnostics
+}
+
+// compileEmoji is CompileEmoji for code with the dialect's aliases
+// applied, without the builtins' definitions
+func compileEmoji(code, targetLang string, profile *Profile) (output string, errors []string, diagnostics []Diagnostic) {
+	start := time.Now()
+	tokens, lexErrors := lexEmoji(code)
+	start = profile.since(phaseLex, start)
+
+	program, syntaxErrors := parseEmojiTokens(tokens, lexErrors)
+	errors = make([]string, len(syntaxErrors))
+	for i, err := range syntaxErrors {
+		errors[i] = err.Error()
+	}
+	start = profile.since(phaseParse, start)
+
+	if len(syntaxErrors) == 0 {
+		diagnostics = analyzeEmoji(tokens)
+	} else {
+		diagnostics = make([]Diagnostic, len(syntaxErrors))
+		for i, err := range syntaxErrors {
+			diagnostics[i] = err.Diagnostic()
+		}
+	}
+	start = profile.since(phaseAnalyze, start)
+
+	output = program.Generate(targetLang)
+	profile.since(phaseGenerate, start)
+	return output, errors, diagnostics
+}
@@ -0,0 +1,514 @@
+package transpiler
+
+import (
+	"fmt"
+	"path"
+	"regexp"
+	"slices"
+	"sort"
+	"strings"
+	"unicode/utf8"
+)
+
+var (
+	// importClausePattern splits the clause of `import <clause> from 'x'`
+	// into a default name, a namespace and a named list
+	importClausePattern = regexp.MustCompile(`^\s*(?:([A-Za-z_$][\w$]*)\s*,?\s*)?(?:\*\s*as\s+([A-Za-z_$][\w$]*))?\s*(?:\{([^}]*)\})?\s*$`)
+	// exportListPattern matches `export { a, b as c }`, optionally
+	// re-exported from a module
+	exportListPattern = regexp.MustCompile(`^(\s*)export\s*\{([^}]*)\}\s*(?:from\s*['"]([^'"]+)['"])?\s*;?\s*$`)
+	exportStarPattern = regexp.MustCompile(`^(\s*)export\s*\*\s*from\s*['"]([^'"]+)['"]\s*;?\s*$`)
+	// exportDefaultPattern matches `export default`, capturing a function
+	// or class name when it declares one
+	exportDefaultPattern = regexp.MustCompile(`^(\s*)export\s+default\s+(?:((?:async\s+)?function\*?|class)\s+([A-Za-z_$][\w$]*))?`)
+	exportLinePattern    = regexp.MustCompile(`^(\s*)export\s+((?:declare\s+)?(?:async\s+function\*?|function\*?|class|const|let|var|type|interface|enum|abstract\s+class))\s+([A-Za-z_$][\w$]*)`)
+)
+
+// ProjectLink is how one file of a project was linked to the others
+type ProjectLink struct {
+	// Imports are the project files the file imports, in source order
+	Imports []string `json:"imports,omitempty"`
+	// External are the modules imported from outside the project
+	External []string `json:"external,omitempty"`
+}
+
+// projectFiles resolves import specifiers against a project's files,
+// which are keyed by their path in the project, e.g. "lib/utils.emoji"
+type projectFiles struct {
+	keys map[string]string
+}
+
+func newProjectFiles(names []string) projectFiles {
+	keys := make(map[string]string, len(names))
+	for _, name := range names {
+		keys[moduleKey(name)] = name
+	}
+	return projectFiles{keys: keys}
+}
+
+// resolve finds the file specifier names when imported from from.
+// Relative specifiers resolve against from's directory, others against
+// the project root, so `📥 utils` finds utils.emoji.
+func (p projectFiles) resolve(from, specifier string) (string, bool) {
+	name, ok := p.keys[resolveModuleKey(from, specifier)]
+	return name, ok
+}
+
+func relativeSpecifier(specifier string) bool {
+	return strings.HasPrefix(specifier, "./") || strings.HasPrefix(specifier, "../")
+}
+
+// outputSpecifier is the import path from one output file to another
+func outputSpecifier(from, to string) string {
+	fromDir := strings.Split(path.Dir(from), "/")
+	toParts := strings.Split(to, "/")
+	if fromDir[0] == "." {
+		fromDir = nil
+	}
+	common := 0
+	for common < len(fromDir) && common < len(toParts)-1 && fromDir[common] == toParts[common] {
+		common++
+	}
+	rel := strings.Repeat("../", len(fromDir)-common) + strings.Join(toParts[common:], "/")
+	if !strings.HasPrefix(rel, "../") {
+		rel = "./" + rel
+	}
+	return rel
+}
+
+// OutputName is the file a project file's output is written to: its path
+// with the target's extension
+func OutputName(name, targetLang string) string {
+	ext := ".js"
+	if targetLang == "typescript" {
+		ext = ".ts"
+	}
+	return strings.TrimSuffix(name, path.Ext(name)) + ext
+}
+
+// LinkProject rewrites the imports between a project's transpiled files
+// to point at each other's outputs (see OutputName). A bare `import name`,
+// which is what `📥 name` becomes, binds the file's namespace. A relative
+// import of a file the project doesn't have is an error; other modules
+// are left to the runtime and reported as external.
+func LinkProject(outputs map[string]string, targetLang string) (map[string]string, map[string]ProjectLink, []string) {
+	names := make([]string, 0, len(outputs))
+	for name := range outputs {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	files := newProjectFiles(names)
+
+	linked := make(map[string]string, len(outputs))
+	links := make(map[string]ProjectLink, len(outputs))
+	var errs []string
+	for _, name := range names {
+		lines := strings.Split(outputs[name], "\n")
+		var link ProjectLink
+		for i, line := range lines {
+			module, rewrite := importSpecifier(line)
+			if module == "" {
+				continue
+			}
+			target, found := files.resolve(name, module)
+			switch {
+			case found:
+				link.Imports = appendUnique(link.Imports, target)
+				lines[i] = rewrite(outputSpecifier(OutputName(name, targetLang), OutputName(target, targetLang)))
+			case relativeSpecifier(module):
+				errs = append(errs, fmt.Sprintf("%s: line %d: imports '%s', which isn't in the project", name, i+1, module))
+			default:
+				link.External = appendUnique(link.External, module)
+			}
+		}
+		linked[name] = strings.Join(lines, "\n")
+		links[name] = link
+	}
+	return linked, links, errs
+}
+
+// CheckProjectImports checks the imports between a project's files,
+// returning diagnostics for each file that imports a project file that
+// isn't there, or a name the file it imports doesn't export. outputs are
+// the files as transpiled, before LinkProject; each problem is positioned
+// at the import in sources, found by the module it names. A file that
+// re-exports with `export *` may export any name, so imports from it
+// aren't checked.
+func CheckProjectImports(outputs, sources map[string]string) map[string][]Diagnostic {
+	names := make([]string, 0, len(outputs))
+	for name := range outputs {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	files := newProjectFiles(names)
+
+	problems := map[string][]Diagnostic{}
+	for _, name := range names {
+		for _, line := range strings.Split(outputs[name], "\n") {
+			module, _ := importSpecifier(line)
+			if module == "" {
+				continue
+			}
+			target, found := files.resolve(name, module)
+			if !found {
+				if relativeSpecifier(module) {
+					d := importDiagnostic(sources[name], module, "")
+					d.Message, d.Code = fmt.Sprintf("imports '%s', which isn't in the project", module), CodeMissingModule
+					problems[name] = append(problems[name], d)
+				}
+				continue
+			}
+			exports, known := projectExports(outputs[target])
+			if !known {
+				continue
+			}
+			for _, imported := range importedNames(line) {
+				if !slices.Contains(exports, imported) {
+					d := importDiagnostic(sources[name], module, imported)
+					d.Message, d.Code = fmt.Sprintf("'%s' doesn't export '%s'", module, imported), CodeMissingExport
+					problems[name] = append(problems[name], d)
+				}
+			}
+		}
+	}
+	return problems
+}
+
+// projectExports lists the names a transpiled file exports, "default"
+// among them for a default export; known is false when it re-exports a
+// whole module, whose names can't be listed
+func projectExports(output string) (names []string, known bool) {
+	var exports []string
+	for _, line := range strings.Split(output, "\n") {
+		if exportStarPattern.MatchString(line) {
+			return nil, false
+		}
+		if m := exportListPattern.FindStringSubmatch(line); m != nil && m[3] != "" {
+			for _, spec := range splitSpecifiers(m[2]) {
+				names = append(names, spec[1])
+			}
+			continue
+		}
+		_, exports = bundleExport(line, exports[:0])
+		for _, export := range exports {
+			name, _, _ := strings.Cut(export, ":")
+			names = append(names, name)
+		}
+	}
+	return names, true
+}
+
+// importedNames lists the names an import line takes from its module by
+// name, "default" for a default import; a namespace import takes none
+func importedNames(line string) []string {
+	m := fromImportPattern.FindStringSubmatch(line)
+	if m == nil {
+		return nil
+	}
+	clause := strings.TrimSpace(strings.TrimSuffix(strings.TrimPrefix(strings.TrimSpace(m[1]), "import"), "from"))
+	parts := importClausePattern.FindStringSubmatch(clause)
+	if clause == "" || parts == nil {
+		return nil
+	}
+	var names []string
+	if parts[1] != "" {
+		names = append(names, "default")
+	}
+	for _, spec := range splitSpecifiers(parts[3]) {
+		names = append(names, spec[0])
+	}
+	return names
+}
+
+// importDiagnostic is an error at the first line of source naming module:
+// at name in it when name is set and on the line, and otherwise at the
+// module. It has no position when no line names the module.
+func importDiagnostic(source, module, name string) Diagnostic {
+	d := Diagnostic{Severity: SeverityError}
+	word := regexp.MustCompile(`\b` + regexp.QuoteMeta(name) + `\b`)
+	for i, line := range strings.Split(source, "\n") {
+		at := strings.Index(line, module)
+		if at < 0 {
+			continue
+		}
+		length := utf8.RuneCountInString(module)
+		if name != "" {
+			if loc := word.FindStringIndex(line); loc != nil {
+				at, length = loc[0], utf8.RuneCountInString(name)
+			}
+		}
+		d.Line, d.Column, d.Length = i+1, utf8.RuneCountInString(line[:at])+1, length
+		break
+	}
+	return d
+}
+
+// importSpecifier returns the module an import or re-export line names,
+// with a function that rewrites the line to import it from another path
+func importSpecifier(line string) (string, func(string) string) {
+	if m := bareImportPattern.FindStringSubmatch(line); m != nil {
+		return m[2], func(specifier string) string {
+			return fmt.Sprintf("%simport * as %s from '%s';", m[1], ImportBinding(m[2]), specifier)
+		}
+	}
+	if m := fromImportPattern.FindStringSubmatch(line); m != nil {
+		return m[3], func(specifier string) string {
+			return m[1] + m[2] + specifier + m[4] + m[5]
+		}
+	}
+	if m := importFromPattern.FindStringSubmatchIndex(line); m != nil && line[m[2]:m[3]] == "export" {
+		return line[m[6]:m[7]], func(specifier string) string {
+			return line[:m[6]] + specifier + line[m[7]:]
+		}
+	}
+	return "", nil
+}
+
+func appendUnique(list []string, s string) []string {
+	if slices.Contains(list, s) {
+		return list
+	}
+	return append(list, s)
+}
+
+// OrderProject orders a project's files so each comes after the files it
+// imports, starting from entry, or from every file in name order when
+// entry is empty. Each import cycle is returned as the path around it,
+// e.g. [a b a].
+func OrderProject(links map[string]ProjectLink, entry string) ([]string, [][]string) {
+	const (
+		unvisited = iota
+		visiting
+		done
+	)
+	state := map[string]int{}
+	var order []string
+	var cycles [][]string
+	var stack []string
+
+	var visit func(name string)
+	visit = func(name string) {
+		switch state[name] {
+		case done:
+			return
+		case visiting:
+			for i := len(stack) - 1; i >= 0; i-- {
+				if stack[i] == name {
+					cycle := append(append([]string{}, stack[i:]...), name)
+					cycles = append(cycles, cycle)
+					break
+				}
+			}
+			return
+		}
+		state[name] = visiting
+		stack = append(stack, name)
+		for _, dep := range links[name].Imports {
+			visit(dep)
+		}
+		stack = stack[:len(stack)-1]
+		state[name] = done
+		order = append(order, name)
+	}
+
+	if entry != "" {
+		visit(entry)
+		return order, cycles
+	}
+	names := make([]string, 0, len(links))
+	for name := range links {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		visit(name)
+	}
+	return order, cycles
+}
+
+// BundleProject joins a project's transpiled files into one module, in
+// order (see OrderProject), which must not have cycles. Each file runs in
+// its own function scope and its exports become an object the files after
+// it import from. Imports from outside the project are hoisted to the top,
+// and the entry's exports are the bundle's. outputs are the files as
+// transpiled, before LinkProject.
+func BundleProject(outputs map[string]string, order []string, entry string) string {
+	files := newProjectFiles(order)
+	var hoisted []string
+	var body strings.Builder
+	var entryExports []string
+
+	for _, name := range order {
+		var exports, code []string
+		for _, line := range strings.Split(outputs[name], "\n") {
+			module, _ := importSpecifier(line)
+			if module == "" {
+				stripped, withExports := bundleExport(line, exports)
+				if stripped != "" || line == "" {
+					code = append(code, stripped)
+				}
+				exports = withExports
+				continue
+			}
+
+			ref := ""
+			if target, found := files.resolve(name, module); found {
+				ref = fmt.Sprintf("__modules[%q]", target)
+			} else if strings.HasPrefix(strings.TrimSpace(line), "export") {
+				// a re-export from outside the project
+				ref = "__external_" + ImportBinding(module)
+				hoisted = appendUnique(hoisted, fmt.Sprintf("import * as %s from '%s';", ref, module))
+			} else {
+				hoisted = appendUnique(hoisted, strings.TrimSpace(line))
+				continue
+			}
+			var bindings []string
+			bindings, exports = bundleImport(line, module, ref, exports)
+			code = append(code, bindings...)
+		}
+		if name == entry {
+			entryExports = exports
+		}
+
+		fmt.Fprintf(&body, "\n// %s\n__modules[%q] = (() => {\n", name, name)
+		for _, line := range code {
+			if line != "" {
+				body.WriteString("  " + line)
+			}
+			body.WriteString("\n")
+		}
+		if len(exports) == 0 {
+			body.WriteString("  return {};\n})();\n")
+		} else {
+			fmt.Fprintf(&body, "  return { %s };\n})();\n", strings.Join(exports, ", "))
+		}
+	}
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "// Bundled from %d file(s)\n", len(order))
+	for _, line := range hoisted {
+		b.WriteString(line + "\n")
+	}
+	b.WriteString("const __modules = {};\n")
+	b.WriteString(body.String())
+	b.WriteString(bundleEntryExports(entry, entryExports))
+	return b.String()
+}
+
+// bundleEntryExports re-exports the entry's exports from the bundle.
+// Names an `export *` brings in aren't known until it runs, so they stay
+// on the entry's module object.
+func bundleEntryExports(entry string, exports []string) string {
+	var names []string
+	hasDefault := false
+	for _, export := range exports {
+		name, _, _ := strings.Cut(export, ":")
+		switch {
+		case strings.HasPrefix(name, "..."):
+		case name == "default":
+			hasDefault = true
+		default:
+			names = append(names, name)
+		}
+	}
+	var b strings.Builder
+	if len(names) > 0 {
+		fmt.Fprintf(&b, "\nexport const { %s } = __modules[%q];\n", strings.Join(names, ", "), entry)
+	}
+	if hasDefault {
+		fmt.Fprintf(&b, "export default __modules[%q].default;\n", entry)
+	}
+	return b.String()
+}
+
+// bundleImport rewrites an import of a project file, or a re-export of
+// any module, as bindings to the module object named by ref
+func bundleImport(line, module, ref string, exports []string) ([]string, []string) {
+	indent := line[:len(line)-len(strings.TrimLeft(line, " \t"))]
+	if m := bareImportPattern.FindStringSubmatch(line); m != nil {
+		return []string{fmt.Sprintf("%sconst %s = %s;", indent, ImportBinding(module), ref)}, exports
+	}
+	if m := exportStarPattern.FindStringSubmatch(line); m != nil {
+		return nil, append(exports, "..."+ref)
+	}
+	if m := exportListPattern.FindStringSubmatch(line); m != nil {
+		for _, spec := range splitSpecifiers(m[2]) {
+			exports = append(exports, fmt.Sprintf("%s: %s.%s", spec[1], ref, spec[0]))
+		}
+		return nil, exports
+	}
+
+	m := fromImportPattern.FindStringSubmatch(line)
+	clause := strings.TrimSpace(strings.TrimSuffix(strings.TrimPrefix(strings.TrimSpace(m[1]), "import"), "from"))
+	if clause == "" {
+		return nil, exports
+	}
+	parts := importClausePattern.FindStringSubmatch(clause)
+	if parts == nil {
+		return []string{fmt.Sprintf("%s/* unsupported import: %s */", indent, strings.TrimSpace(line))}, exports
+	}
+	var out []string
+	if parts[1] != "" {
+		out = append(out, fmt.Sprintf("%sconst %s = %s.default;", indent, parts[1], ref))
+	}
+	if parts[2] != "" {
+		out = append(out, fmt.Sprintf("%sconst %s = %s;", indent, parts[2], ref))
+	}
+	if parts[3] != "" {
+		var names []string
+		for _, spec := range splitSpecifiers(parts[3]) {
+			if spec[0] == spec[1] {
+				names = append(names, spec[0])
+			} else {
+				names = append(names, spec[0]+": "+spec[1])
+			}
+		}
+		out = append(out, fmt.Sprintf("%sconst { %s } = %s;", indent, strings.Join(names, ", "), ref))
+	}
+	return out, exports
+}
+
+// bundleExport strips an export from a line, recording what it exports
+func bundleExport(line string, exports []string) (string, []string) {
+	if m := exportListPattern.FindStringSubmatch(line); m != nil && m[3] == "" {
+		for _, spec := range splitSpecifiers(m[2]) {
+			if spec[0] == spec[1] {
+				exports = append(exports, spec[0])
+			} else {
+				exports = append(exports, spec[1]+": "+spec[0])
+			}
+		}
+		return "", exports
+	}
+	if m := exportDefaultPattern.FindStringSubmatchIndex(line); m != nil {
+		indent := line[m[2]:m[3]]
+		if m[6] >= 0 {
+			name := line[m[6]:m[7]]
+			return indent + line[m[4]:], append(exports, "default: "+name)
+		}
+		return indent + "const __default = " + line[m[1]:], append(exports, "default: __default")
+	}
+	if m := exportLinePattern.FindStringSubmatchIndex(line); m != nil {
+		keyword, name := line[m[4]:m[5]], line[m[6]:m[7]]
+		line = line[m[2]:m[3]] + line[m[4]:]
+		if keyword != "type" && keyword != "interface" && !strings.HasPrefix(keyword, "declare") {
+			exports = append(exports, name)
+		}
+	}
+	return line, exports
+}
+
+// splitSpecifiers splits "a, b as c" into [name alias] pairs
+func splitSpecifiers(list string) [][2]string {
+	var out [][2]string
+	for _, spec := range strings.Split(list, ",") {
+		fields := strings.Fields(spec)
+		switch {
+		case len(fields) == 1:
+			out = append(out, [2]string{fields[0], fields[0]})
+		case len(fields) == 3 && fields[1] == "as":
+			out = append(out, [2]string{fields[0], fields[2]})
+		}
+	}
+	return out
+}
@@ -0,0 +1,109 @@
+package transpiler
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// RecordField is a single name:type pair of a record declaration
+type RecordField struct {
+	Name string
+	Type string
+}
+
+// recordPattern matches the emoji record form: 🧱 Point(x: number, y: number)
+var recordPattern = regexp.MustCompile(`^(\s*)🧱\s*([A-Za-z_][A-Za-z0-9_]*)\s*\(([^)]*)\)\s*;?\s*$`)
+
+// ParseRecordFields parses a field list like "x:number, y:number"
+func ParseRecordFields(fields string) []RecordField {
+	var result []RecordField
+	for _, part := range strings.Split(fields, ",") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+		field := RecordField{Name: part}
+		if idx := strings.Index(part, ":"); idx >= 0 {
+			field.Name = strings.TrimSpace(part[:idx])
+			field.Type = strings.TrimSpace(part[idx+1:])
+		}
+		result = append(result, field)
+	}
+	return result
+}
+
+// ExpandRecords rewrites emoji record declarations into target code
+func ExpandRecords(code, targetLang string) string {
+	if !strings.Contains(code, "🧱") {
+		return code
+	}
+
+	lines := strings.Split(code, "\n")
+	for i, line := range lines {
+		m := recordPattern.FindStringSubmatch(line)
+		if m == nil {
+			continue
+		}
+		lines[i] = RenderRecord(m[2], ParseRecordFields(m[3]), targetLang, m[1])
+	}
+	return strings.Join(lines, "\n")
+}
+
+// RenderRecord generates a record type: a class with a constructor and
+// equality. Rust and Python are generated from it by codegen, which
+// writes it as a struct that derives PartialEq and as a dataclass.
+func RenderRecord(name string, fields []RecordField, targetLang, indent string) string {
+	b := &strings.Builder{}
+
+	names := make([]string, len(fields))
+	params := make([]string, len(fields))
+	for i, f := range fields {
+		names[i] = f.Name
+		params[i] = f.Name
+		if targetLang == "typescript" {
+			params[i] = fmt.Sprintf("%s: %s", f.Name, recordFieldType(f.Type))
+		}
+	}
+
+	fmt.Fprintf(b, "%sclass %s {\n", indent, name)
+	if targetLang == "typescript" {
+		for _, param := range params {
+			fmt.Fprintf(b, "%s  readonly %s;\n", indent, param)
+		}
+		if len(fields) > 0 {
+			b.WriteString("\n")
+		}
+	}
+	fmt.Fprintf(b, "%s  constructor(%s) {\n", indent, strings.Join(params, ", "))
+	for _, n := range names {
+		fmt.Fprintf(b, "%s    this.%s = %s;\n", indent, n, n)
+	}
+	fmt.Fprintf(b, "%s  }\n\n", indent)
+
+	other := "other"
+	if targetLang == "typescript" {
+		other = "other: unknown"
+	}
+	checks := []string{fmt.Sprintf("other instanceof %s", name)}
+	for _, n := range names {
+		checks = append(checks, fmt.Sprintf("this.%s === other.%s", n, n))
+	}
+	fmt.Fprintf(b, "%s  equals(%s) {\n", indent, other)
+	fmt.Fprintf(b, "%s    return %s;\n", indent, strings.Join(checks, " && "))
+	fmt.Fprintf(b, "%s  }\n", indent)
+	fmt.Fprintf(b, "%s}", indent)
+
+	return b.String()
+}
+
+// recordFieldType maps an EmojiScript field type to TypeScript's spelling
+func recordFieldType(t string) string {
+	switch t {
+	case "bool":
+		return "boolean"
+	case "":
+		return "unknown"
+	}
+	return t
+}
@@ -0,0 +1,53 @@
+package transpiler
+
+// keywordReplacer substitutes the palette's keyword emoji and the
+// compound operators in one scan, as plain emoji was transpiled before
+// it was parsed into a tree
+var keywordReplacer = func() *clusterReplacer {
+	pairs := map[string]string{}
+	for _, entry := range paletteTable {
+		pairs[entry.emoji] = entry.keyword
+	}
+	for _, operator := range compoundOperators {
+		pairs[operator.emoji] = operator.keyword
+	}
+	return emojiReplacer(pairs)
+}()
+
+// ReplaceEmoji transpiles plain emoji syntax written in the dialect as
+// the release before the syntax tree did: keyword emoji are replaced in
+// one scan of the source, strings and comments included, and the only
+// errors are unbalanced braces and parentheses. It is the pipeline the
+// canary routes the rest of the traffic to (see package canary).
+func (t *Transpiler) ReplaceEmoji(code string) (output string, errors []string) {
+	code = ExpandRecords(CanonicalizeEmoji(t.ApplyAliases(code)), t.targetLang)
+	code = ExpandGetters(ExpandSwitchExpressions(code, t.targetLang))
+	output = keywordReplacer.Replace(code)
+	return AddStdlib(output, t.targetLang), countBrackets(code)
+}
+
+// countBrackets checks that braces and parentheses balance, counting
+// them wherever they are
+func countBrackets(code string) []string {
+	var errors []string
+	braces, parens := 0, 0
+	for _, char := range code {
+		switch char {
+		case '{':
+			braces++
+		case '}':
+			braces--
+		case '(':
+			parens++
+		case ')':
+			parens--
+		}
+	}
+	if braces != 0 {
+		errors = append(errors, "Unbalanced braces")
+	}
+	if parens != 0 {
+		errors = append(errors, "Unbalanced parentheses")
+	}
+	return errors
+}
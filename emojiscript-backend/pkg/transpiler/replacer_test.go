@@ -0,0 +1,43 @@
+package transpiler
+
+import (
+	"slices"
+	"testing"
+
+	"emojiscript-backend/pkg/golden"
+)
+
+// TestReplaceEmoji checks that the canary's fallback pipeline writes the
+// corpus's emoji programs as the syntax tree does
+func TestReplaceEmoji(t *testing.T) {
+	for _, target := range []string{"javascript", "typescript"} {
+		tr := New(Options{TargetLanguage: target})
+		for _, fixture := range golden.Fixtures("", "emoji") {
+			want, _, _ := tr.CompileEmoji(fixture.Input, nil)
+			got, errs := tr.ReplaceEmoji(fixture.Input)
+			if len(errs) > 0 {
+				t.Errorf("%s (%s): %v", fixture.Name, target, errs)
+			} else if got != want {
+				t.Errorf("%s (%s): got\n%s\nwant\n%s", fixture.Name, target, got, want)
+			}
+		}
+	}
+}
+
+func TestCountBrackets(t *testing.T) {
+	tests := []struct {
+		code string
+		want []string
+	}{
+		{"🎯 f(a) { 🔙 a }", nil},
+		{"🎯 f(a { 🔙 a }", []string{"Unbalanced parentheses"}},
+		{"❓ (a) { b", []string{"Unbalanced braces"}},
+		// they're counted, not matched
+		{")(", nil},
+	}
+	for _, tt := range tests {
+		if got := countBrackets(tt.code); !slices.Equal(got, tt.want) {
+			t.Errorf("countBrackets(%q) = %v, want %v", tt.code, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,177 @@
+package transpiler
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// reservedJavaScript are the words JavaScript and TypeScript won't take
+// as a variable name, strict mode included
+var reservedJavaScript = wordSet("await break case catch class const continue debugger default delete do else enum export extends false finally for function if implements import in instanceof interface let new null package private protected public return static super switch this throw true try typeof var void while with yield")
+
+// reservedPython are Python's keywords
+var reservedPython = wordSet("False None True and as assert async await break class continue def del elif else except finally for from global if import in is lambda nonlocal not or pass raise return try while with yield")
+
+func wordSet(words string) map[string]bool {
+	set := map[string]bool{}
+	for _, word := range strings.Fields(words) {
+		set[word] = true
+	}
+	return set
+}
+
+// ReservedWord reports whether name is a keyword targetLang won't take as
+// a variable name
+func ReservedWord(name, targetLang string) bool {
+	if targetLang == "python" {
+		return reservedPython[name]
+	}
+	return reservedJavaScript[name]
+}
+
+// collectRenames picks the replacement for every reserved name the input
+// declares before anything is transpiled: nested tags are transpiled
+// before their parent, so a <return> would otherwise read a parameter
+// its <function> hasn't renamed yet
+func (p *MarkupParser) collectRenames() {
+	tree := NewMarkupParser(p.input, p.targetLang)
+	for {
+		tag, err := tree.NextTag()
+		if err != nil {
+			// the transpiling pass reports it
+			tree.advance()
+			continue
+		}
+		if tag == nil {
+			return
+		}
+		p.renameTree(tag)
+	}
+}
+
+// renameTree renames the names a tag, its children and its branches
+// declare
+func (p *MarkupParser) renameTree(tag *MarkupTag) {
+	if spec, ok := p.lookupTag(tag.Name); ok {
+		p.renameDeclared(spec, tag)
+	}
+	for i := range tag.Children {
+		p.renameTree(&tag.Children[i])
+	}
+	for i := range tag.Branches {
+		p.renameTree(&tag.Branches[i])
+	}
+}
+
+// renameDeclared rewrites the reserved names a tag declares: each becomes
+// the word with a '_' suffix. Method and field names are left alone,
+// since callers reach them through '.'.
+func (p *MarkupParser) renameDeclared(spec *markupTagSpec, tag *MarkupTag) {
+	for _, attr := range spec.attributes {
+		value, ok := tag.Attributes[attr.name]
+		if !ok {
+			continue
+		}
+		switch {
+		case attr.name == "params" || spec.names[0] == "import" && attr.name == "items":
+			tag.Attributes[attr.name] = p.renameList(tag, value)
+		case attr.kind == attrIdentifier && spec.names[0] != "export" && spec.names[0] != "method":
+			tag.Attributes[attr.name] = p.declareRenamed(tag, value)
+		}
+	}
+	if spec.names[0] == "var" && tag.Attributes["name"] == "" {
+		// the "name = value" body form
+		if name, value, ok := strings.Cut(tag.Content, "="); ok {
+			tag.Content = p.declareRenamed(tag, strings.TrimSpace(name)) + " = " + strings.TrimSpace(value)
+		}
+	}
+}
+
+// renameReserved rewrites a tag's reserved names before it is transpiled,
+// when the parser renames them: the names it declares get their
+// replacements, and its expressions read the new names
+func (p *MarkupParser) renameReserved(spec *markupTagSpec, tag *MarkupTag) {
+	p.renameDeclared(spec, tag)
+	for _, attr := range spec.attributes {
+		value, ok := tag.Attributes[attr.name]
+		if !ok {
+			continue
+		}
+		if attr.kind == attrExpression || attr.kind == attrIdentifier && spec.names[0] == "export" {
+			tag.Attributes[attr.name] = p.applyRenames(value)
+		}
+	}
+
+	switch spec.names[0] {
+	case "print", "return", "await":
+		tag.Content = p.applyRenames(tag.Content)
+	case "var":
+		if name, value, ok := strings.Cut(tag.Content, "="); ok && tag.Attributes["name"] == "" {
+			tag.Content = name + "= " + p.applyRenames(strings.TrimSpace(value))
+		}
+	}
+}
+
+// renameList renames the names a parameter or import list declares: the
+// leading name of each entry, or the alias after "as"
+func (p *MarkupParser) renameList(tag *MarkupTag, list string) string {
+	entries := strings.Split(list, ",")
+	for i, entry := range entries {
+		start, end := 0, len(entry)
+		if at := strings.Index(entry, " as "); at >= 0 {
+			start = at + len(" as ")
+		} else if at := strings.IndexAny(entry, ":="); at >= 0 {
+			end = at
+		}
+		name := strings.TrimPrefix(strings.TrimSpace(entry[start:end]), "...")
+		if renamed := p.declareRenamed(tag, name); renamed != name {
+			at := start + strings.Index(entry[start:end], name)
+			entries[i] = entry[:at] + renamed + entry[at+len(name):]
+		}
+	}
+	return strings.Join(entries, ",")
+}
+
+// declareRenamed returns the name to declare for name: name itself, or
+// for a reserved word its replacement, picked and reported once
+func (p *MarkupParser) declareRenamed(tag *MarkupTag, name string) string {
+	if !ReservedWord(name, p.targetLang) {
+		return name
+	}
+	if renamed, ok := p.renames[name]; ok {
+		return renamed
+	}
+	renamed := name + "_"
+	for n := 2; p.scopeVars[renamed]; n++ {
+		renamed = name + "_" + strconv.Itoa(n)
+	}
+	if p.renames == nil {
+		p.renames = map[string]string{}
+	}
+	p.renames[name] = renamed
+	p.tagWarning(tag, CodeRenamedIdentifier, fmt.Sprintf("'%s' is a reserved keyword; renamed to '%s'", name, renamed))
+	return renamed
+}
+
+// applyRenames rewrites the renamed names an expression reads; property
+// names after '.' keep their spelling
+func (p *MarkupParser) applyRenames(expression string) string {
+	if len(p.renames) == 0 {
+		return expression
+	}
+	tokens, _ := Lex(expression)
+	b := &strings.Builder{}
+	prev := ""
+	for _, token := range tokens {
+		text := token.Text
+		if renamed, ok := p.renames[text]; ok && token.Kind == TokenIdent && prev != "." {
+			text = renamed
+		}
+		b.WriteString(text)
+		if token.Kind != TokenSpace && token.Kind != TokenComment {
+			prev = token.Text
+		}
+	}
+	return b.String()
+}
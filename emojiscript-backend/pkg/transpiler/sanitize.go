@@ -0,0 +1,145 @@
+package transpiler
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+	"unicode/utf8"
+)
+
+// SanitizePolicy decides what the markup parser does with code that
+// matches a dangerous pattern
+type SanitizePolicy string
+
+const (
+	// SanitizeRewrite neutralizes each match; it is the default
+	SanitizeRewrite SanitizePolicy = "rewrite"
+	// SanitizeReport reports matches but leaves the code as written
+	SanitizeReport SanitizePolicy = "report"
+	// SanitizeOff skips the check
+	SanitizeOff SanitizePolicy = "off"
+)
+
+// ParseSanitizePolicy reads a policy name; "" is SanitizeRewrite
+func ParseSanitizePolicy(name string) (SanitizePolicy, error) {
+	switch policy := SanitizePolicy(strings.ToLower(name)); policy {
+	case "":
+		return SanitizeRewrite, nil
+	case SanitizeRewrite, SanitizeReport, SanitizeOff:
+		return policy, nil
+	}
+	return "", fmt.Errorf("unknown sanitize policy '%s' (expected rewrite, report or off)", name)
+}
+
+// Sanitization is a dangerous pattern the sanitizer found in the source
+type Sanitization struct {
+	Pattern string `json:"pattern"`
+	Line    int    `json:"line"`
+	Column  int    `json:"column"`
+	// Original is the source text that matched
+	Original string `json:"original"`
+	// Replacement is what the match was rewritten to; it is empty when
+	// the policy only reports
+	Replacement string `json:"replacement,omitempty"`
+}
+
+// dangerousPatterns are the code patterns that can run arbitrary strings
+// as code or reach an object's prototype. The first group is the part a
+// rewrite replaces. A class's own constructor is fine; reaching Function
+// through constructor.constructor is not.
+var dangerousPatterns = []struct {
+	name    string
+	pattern *regexp.Regexp
+}{
+	{"eval", regexp.MustCompile(`\b(eval)\s*\(`)},
+	{"Function", regexp.MustCompile(`\b(Function)\s*\(`)},
+	{"__proto__", regexp.MustCompile(`\b(__proto__)\b`)},
+	{"constructor.constructor", regexp.MustCompile(`\bconstructor\s*\.\s*(constructor)\b`)},
+}
+
+// SetSanitizePolicy sets what happens to dangerous patterns in code
+func (p *MarkupParser) SetSanitizePolicy(policy SanitizePolicy) {
+	p.sanitize = policy
+}
+
+// Sanitizations returns every dangerous pattern found, in source order
+func (p *MarkupParser) Sanitizations() []Sanitization {
+	sort.SliceStable(p.sanitized, func(i, j int) bool {
+		a, b := p.sanitized[i], p.sanitized[j]
+		return a.Line < b.Line || a.Line == b.Line && a.Column < b.Column
+	})
+	return p.sanitized
+}
+
+// sanitizeCode applies the policy to code that starts at line and column
+// of the source. A rewritten match becomes undefined, so the code still
+// parses but can't reach what the pattern did.
+func (p *MarkupParser) sanitizeCode(code string, line, column int) string {
+	if p.sanitize == SanitizeOff {
+		return code
+	}
+
+	type match struct {
+		start, end int
+		pattern    string
+	}
+	var matches []match
+	for _, dangerous := range dangerousPatterns {
+		for _, loc := range dangerous.pattern.FindAllStringSubmatchIndex(code, -1) {
+			matches = append(matches, match{loc[2], loc[3], dangerous.name})
+		}
+	}
+	if len(matches) == 0 {
+		return code
+	}
+	sort.Slice(matches, func(i, j int) bool { return matches[i].start < matches[j].start })
+
+	b := &strings.Builder{}
+	last := 0
+	for _, m := range matches {
+		before := code[:m.start]
+		at := Sanitization{Pattern: m.pattern, Line: line + strings.Count(before, "\n"), Original: code[m.start:m.end]}
+		if newline := strings.LastIndex(before, "\n"); newline >= 0 {
+			at.Column = utf8.RuneCountInString(before[newline+1:]) + 1
+		} else {
+			at.Column = column + utf8.RuneCountInString(before)
+		}
+		if p.sanitize != SanitizeReport {
+			at.Replacement = "/* UNSAFE: " + at.Original + " */undefined"
+			b.WriteString(code[last:m.start])
+			b.WriteString(at.Replacement)
+			last = m.end
+		}
+		at.Column = p.sourcePosition(at.Line, at.Column)
+		p.sanitized = append(p.sanitized, at)
+	}
+	b.WriteString(code[last:])
+	return b.String()
+}
+
+// sanitizeAttributes applies the policy to the attributes a tag reads as
+// code
+func (p *MarkupParser) sanitizeAttributes(tag *MarkupTag) {
+	for name, value := range tag.Attributes {
+		if at, ok := tag.valueAt[name]; ok && p.isExpressionAttribute(tag.Name, name) {
+			tag.Attributes[name] = p.sanitizeCode(value, at[0], at[1])
+			delete(tag.valueAt, name)
+		}
+	}
+}
+
+// isExpressionAttribute reports whether the tag reads the attribute as
+// code
+func (p *MarkupParser) isExpressionAttribute(tagName, attribute string) bool {
+	spec, ok := p.lookupTag(tagName)
+	if !ok {
+		return false
+	}
+	for _, known := range spec.attributes {
+		if known.name == attribute {
+			return known.kind == attrExpression || known.kind == attrType
+		}
+	}
+	return false
+}
@@ -0,0 +1,175 @@
+package transpiler
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// symbol is a declared name the program is expected to read: a variable,
+// function, class or import. Parameters aren't symbols, nor are names
+// starting with '_', which mark a value as deliberately unused.
+type symbol struct {
+	name string
+	used bool
+	// at is where the name is declared
+	at Diagnostic
+}
+
+// symbolRead is a name read, or assigned when write is set, where scope
+// is the innermost scope. An undeclared name is reported at at when
+// check is set.
+type symbolRead struct {
+	name  string
+	scope *declScope
+	write bool
+	check bool
+	at    Diagnostic
+}
+
+// symbolTable holds a program's symbols and the names it reads, shared by
+// all its scopes. Reads are resolved once the whole program is declared,
+// so a function may call one declared after it.
+type symbolTable struct {
+	symbols []*symbol
+	reads   []symbolRead
+}
+
+// declareSymbol declares name as declare does, as a symbol declared at at
+func (s *declScope) declareSymbol(name, keyword string, at Diagnostic) bool {
+	_, known := s.names[name]
+	if !s.declare(name, keyword) {
+		return false
+	}
+	if !known && name != "" && !strings.HasPrefix(name, "_") {
+		sym := &symbol{name: name, at: at}
+		s.symbols[name] = sym
+		s.table.symbols = append(s.table.symbols, sym)
+	}
+	return true
+}
+
+// read records that name is read, or assigned, in s
+func (s *declScope) read(name string, write, check bool, at Diagnostic) {
+	s.table.reads = append(s.table.reads, symbolRead{name: name, scope: s, write: write, check: check, at: at})
+}
+
+// resolve finds the declaration each read refers to, marking its symbol
+// used unless the read only assigns it. It reports through report, as
+// warnings in source order, the first read of each name nothing declares
+// and the symbols nothing reads.
+func (t *symbolTable) resolve(report func(Diagnostic)) {
+	var warnings []Diagnostic
+	warn := func(at Diagnostic, code, message string) {
+		at.Severity, at.Code, at.Message = SeverityWarning, code, message
+		warnings = append(warnings, at)
+	}
+	undefined := map[string]bool{}
+	for _, r := range t.reads {
+		scope := r.scope
+		for ; scope != nil; scope = scope.parent {
+			if _, ok := scope.names[r.name]; ok {
+				break
+			}
+		}
+		switch {
+		case scope != nil:
+			if sym := scope.symbols[r.name]; sym != nil && !r.write {
+				sym.used = true
+			}
+		case r.check && !undefined[r.name] && !knownGlobals[r.name] && !scopeKeywords[r.name] && !IsStdlib(r.name):
+			undefined[r.name] = true
+			warn(r.at, CodeUndefinedVariable, fmt.Sprintf("'%s' is not defined", r.name))
+		}
+	}
+	for _, sym := range t.symbols {
+		if !sym.used {
+			warn(sym.at, CodeUnusedVariable, fmt.Sprintf("'%s' is declared but never used", sym.name))
+		}
+	}
+	sort.SliceStable(warnings, func(i, j int) bool {
+		if warnings[i].Line != warnings[j].Line {
+			return warnings[i].Line < warnings[j].Line
+		}
+		return warnings[i].Column < warnings[j].Column
+	})
+	for _, d := range warnings {
+		report(d)
+	}
+}
+
+// analyzeEmoji checks the names plain emoji syntax declares and reads,
+// scope by scope, as checkDeclarations checks markup. Everything it finds
+// is a warning: a name read but never declared, one declared twice in a
+// scope, an assignment to a constant and a variable never read.
+func analyzeEmoji(tokens []Token) []Diagnostic {
+	var diagnostics []Diagnostic
+	report := func(d Diagnostic) {
+		d.Severity = SeverityWarning
+		diagnostics = append(diagnostics, d)
+	}
+	scope := newDeclScope(nil)
+	checkCode(scope, emojiCodeTokens(tokens), func(token Token) Diagnostic {
+		return Diagnostic{Line: token.Line, Column: token.Column, Length: utf8.RuneCountInString(token.Text)}
+	}, report)
+	scope.table.resolve(report)
+	return diagnostics
+}
+
+// emojiCodeTokens reads the tokens of plain emoji syntax, from lexEmoji,
+// as codeTokens lexes code, with each keyword emoji read as its
+// JavaScript spelling: a word such as "const" as an identifier, and an
+// operator as punctuation. A builtin such as "console.log" is read as the
+// global it is a property of, and a record as the class it declares.
+// Positions stay those of the emoji.
+func emojiCodeTokens(lexed []Token) []Token {
+	tokens := make([]Token, 0, len(lexed))
+	for i := 0; i < len(lexed); i++ {
+		token := lexed[i]
+		if record, end, ok := recordAt(lexed, i); ok {
+			tokens = append(tokens, record...)
+			i = end
+			continue
+		}
+		if token.Kind == TokenKeyword {
+			token.Kind, token.Text = TokenPunct, token.Keyword
+			if first, _ := utf8.DecodeRuneInString(token.Keyword); unicode.IsLetter(first) {
+				token.Kind = TokenIdent
+				token.Text, _, _ = strings.Cut(token.Keyword, ".")
+			}
+		}
+		tokens = append(tokens, token)
+	}
+	return joinOperators(tokens)
+}
+
+// recordAt reads the record declaration at i, such as 🧱 Point(x:
+// number), as the class it declares: class Point {}, its field list the
+// braces of the body. end is the index of the list's ')'.
+func recordAt(lexed []Token, i int) (tokens []Token, end int, ok bool) {
+	next := func(j int) int {
+		for j++; j < len(lexed) && lexed[j].Kind == TokenSpace && !strings.Contains(lexed[j].Text, "\n"); j++ {
+		}
+		return j
+	}
+	name := next(i)
+	open := next(name)
+	if lexed[i].Text != "🧱" || open >= len(lexed) || lexed[name].Kind != TokenIdent || lexed[open].Text != "(" {
+		return nil, 0, false
+	}
+	for end = open; end < len(lexed) && lexed[end].Text != ")"; end++ {
+		if lexed[end].Kind == TokenSpace && strings.Contains(lexed[end].Text, "\n") {
+			return nil, 0, false
+		}
+	}
+	if end == len(lexed) {
+		return nil, 0, false
+	}
+	class := lexed[i]
+	class.Kind, class.Text = TokenIdent, "class"
+	body, closing := lexed[open], lexed[end]
+	body.Text, closing.Text = "{", "}"
+	return []Token{class, lexed[name], body, closing}, end, true
+}
@@ -0,0 +1,211 @@
+package transpiler
+
+import (
+	"regexp"
+	"sort"
+	"strings"
+	"unicode/utf8"
+)
+
+// shortcodePattern matches a GitHub-style :shortcode:
+var shortcodePattern = regexp.MustCompile(`:[a-z0-9_+-]+:`)
+
+// githubShortcodes are the GitHub/Slack names of the keyword emoji
+var githubShortcodes = map[string]string{
+	"📦": "package", "🔢": "1234", "✅": "white_check_mark", "⛔": "no_entry",
+	"📍": "round_pushpin", "❔": "grey_question", "🛟": "ring_buoy",
+	"🎯": "dart", "➡️": "arrow_right", "🔙": "back", "⚡": "zap",
+	"⏳": "hourglass_flowing_sand", "🧲": "magnet",
+	"❓": "question", "❌": "x", "🔁": "repeat", "🔄": "arrows_counterclockwise",
+	"🎪": "circus_tent", "🔘": "radio_button", "🏁": "checkered_flag",
+	"⏭️": "next_track_button", "💥": "boom", "🛡️": "shield", "🚨": "rotating_light",
+	"🏆": "trophy",
+	"➕": "heavy_plus_sign", "➖": "heavy_minus_sign", "✖️": "heavy_multiplication_x",
+	"➗": "heavy_division_sign", "🍰": "cake", "🔺": "small_red_triangle",
+	"🟰": "heavy_equals_sign", "❗": "exclamation",
+	"⬆️": "arrow_up", "⬇️": "arrow_down", "📈": "chart_with_upwards_trend",
+	"📉": "chart_with_downwards_trend", "🔗": "link", "🔀": "twisted_rightwards_arrows",
+	"🚫": "no_entry_sign", "📊": "bar_chart", "🔍": "mag", "🗑️": "wastebasket",
+	"📝": "memo", "📥": "inbox_tray", "📤": "outbox_tray", "⏰": "alarm_clock", "🎤": "microphone",
+	"🧾": "receipt", "📂": "open_file_folder", "📖": "book", "✍️": "writing_hand",
+	"🌐": "globe_with_meridians",
+	"🎁": "gift", "🔐": "closed_lock_with_key", "🎨": "art", "🌟": "star2",
+	"🔧": "wrench", "🎭": "performing_arts", "🧱": "bricks",
+}
+
+// keywordShortcodes are extra aliases named after what the emoji does, for
+// keywords whose JS spelling isn't a valid shortcode
+var keywordShortcodes = map[string][]string{
+	"📝":  {"print", "log"},
+	"⏰":  {"time", "clock"},
+	"🎤":  {"input", "ask"},
+	"🧾":  {"stringify", "to_json"},
+	"📂":  {"parse", "from_json"},
+	"📖":  {"read_file"},
+	"✍️": {"write_file"},
+	"🌐":  {"fetch", "http"},
+	"➡️": {"arrow"},
+	"🛟":  {"default"},
+	"➕":  {"plus"},
+	"➖":  {"minus"},
+	"✖️": {"times", "multiply"},
+	"➗":  {"divide"},
+	"🍰":  {"mod", "modulo"},
+	"🔺":  {"pow", "power"},
+	"🟰":  {"equals", "eq"},
+	"❗":  {"not_equals", "neq"},
+	"⬆️": {"gt"},
+	"⬇️": {"lt"},
+	"📈":  {"gte"},
+	"📉":  {"lte"},
+	"🔗":  {"and"},
+	"🔀":  {"or"},
+	"🚫":  {"not"},
+}
+
+// shortcodeToEmoji resolves every accepted shortcode name to its emoji
+var shortcodeToEmoji = func() map[string]string {
+	m := map[string]string{}
+	for _, entry := range paletteTable {
+		if isShortcodeName(entry.keyword) {
+			m[entry.keyword] = entry.emoji
+		}
+	}
+	for emoji, aliases := range keywordShortcodes {
+		for _, alias := range aliases {
+			m[alias] = emoji
+		}
+	}
+	// GitHub names win over keyword aliases when they collide
+	for emoji, name := range githubShortcodes {
+		m[name] = emoji
+	}
+	return m
+}()
+
+func isShortcodeName(name string) bool {
+	return shortcodePattern.MatchString(":" + name + ":")
+}
+
+// ExpandShortcodes replaces known :shortcode: spellings with their emoji so
+// programs typed without an emoji keyboard transpile identically. Only
+// shortcodes the lexer reads as code are expanded; one in a string,
+// template, regular expression or comment is left as written, as are
+// unknown shortcodes.
+func ExpandShortcodes(code string) string {
+	if !strings.Contains(code, ":") {
+		return code
+	}
+	lexed, _ := Lex(code)
+	b := &strings.Builder{}
+	b.Grow(len(code))
+	for i := 0; i < len(lexed); i++ {
+		if emoji, end, ok := shortcodeAt(lexed, i); ok {
+			b.WriteString(emoji)
+			i = end
+			continue
+		}
+		b.WriteString(lexed[i].Text)
+	}
+	return b.String()
+}
+
+// expandMarkupShortcodes expands the shortcodes in markup a word at a
+// time, as the markup parser reads them (see convertEmojisToKeywords):
+// the lexer can't read a whole document, whose tags it would take for
+// operators and regular expressions
+func expandMarkupShortcodes(code string) string {
+	b := &strings.Builder{}
+	for code != "" {
+		end := strings.IndexAny(code, " \t\r\n")
+		if end < 0 {
+			end = len(code)
+		}
+		b.WriteString(ExpandShortcodes(code[:end]))
+		space := len(code[end:]) - len(strings.TrimLeft(code[end:], " \t\r\n"))
+		b.WriteString(code[end : end+space])
+		code = code[end+space:]
+	}
+	return b.String()
+}
+
+// shortcodeAt returns the emoji of the known shortcode lexed from i, a ':'
+// followed by the tokens of its name and a ':' with nothing between them,
+// such as ":package:" or ":1234:", and the index of its closing ':'
+func shortcodeAt(lexed []Token, i int) (emoji string, end int, ok bool) {
+	if lexed[i].Kind != TokenPunct || lexed[i].Text != ":" {
+		return "", 0, false
+	}
+	name := ""
+	for end = i + 1; end < len(lexed); end++ {
+		token := lexed[end]
+		if token.Line != lexed[end-1].Line || token.Column != lexed[end-1].Column+utf8.RuneCountInString(lexed[end-1].Text) {
+			return "", 0, false
+		}
+		switch {
+		case token.Kind == TokenPunct && token.Text == ":":
+			emoji, ok = shortcodeToEmoji[name]
+			return emoji, end, ok && name != ""
+		case token.Kind == TokenIdent, token.Kind == TokenNumber, token.Kind == TokenPunct && (token.Text == "+" || token.Text == "-"):
+			name += token.Text
+		default:
+			return "", 0, false
+		}
+	}
+	return "", 0, false
+}
+
+// Shortcodes lists every accepted shortcode for an emoji, GitHub name first
+func Shortcodes(emoji string) []string {
+	result := []string{}
+	if name, ok := githubShortcodes[emoji]; ok {
+		result = append(result, ":"+name+":")
+	}
+	aliases := []string{}
+	for name, target := range shortcodeToEmoji {
+		if target == emoji && name != githubShortcodes[emoji] {
+			aliases = append(aliases, ":"+name+":")
+		}
+	}
+	sort.Strings(aliases)
+	return append(result, aliases...)
+}
+
+// CanonicalizeEmoji rewrites shortcodes and variant spellings into the
+// canonical emoji the transpiler matches against. Like shortcodes,
+// variants are only normalized where the lexer reads them as code: "✖"
+// in a string still prints ✖.
+func CanonicalizeEmoji(code string) string {
+	return rewriteEmoji(ExpandShortcodes(code), NormalizeVariants)
+}
+
+// rewriteEmoji rewrites each run of emoji tokens the lexer reads from
+// code, keywords or not, with rewrite, copying the rest as written:
+// emoji in strings, templates, regular expressions and comments are
+// left alone. A run is rewritten whole, so an emoji sequence the lexer
+// splits still matches as one.
+func rewriteEmoji(code string, rewrite func(string) string) string {
+	if !strings.ContainsFunc(code, isEmojiBase) {
+		return code
+	}
+	lexed, _ := Lex(code)
+	b := &strings.Builder{}
+	b.Grow(len(code))
+	for i := 0; i < len(lexed); i++ {
+		if !isEmojiToken(lexed[i]) {
+			b.WriteString(lexed[i].Text)
+			continue
+		}
+		run := lexed[i].Text
+		for i+1 < len(lexed) && isEmojiToken(lexed[i+1]) {
+			i++
+			run += lexed[i].Text
+		}
+		b.WriteString(rewrite(run))
+	}
+	return b.String()
+}
+
+func isEmojiToken(token Token) bool {
+	return token.Kind == TokenEmoji || token.Kind == TokenKeyword
+}
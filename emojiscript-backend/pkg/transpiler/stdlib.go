@@ -0,0 +1,430 @@
+package transpiler
+
+import "strings"
+
+// stdlibShim is a builtin the emoji spell as a global, with the
+// definition each target needs for it
+type stdlibShim struct {
+	name        string
+	definitions map[string]string
+	// files is set for a builtin that reads or writes files, which only
+	// a program run by Node or Python can; the sandbox has no file system
+	files bool
+}
+
+// stdlibShims are the builtins a program can use. ⏰ is EmojiTime, a
+// small time API that reads the same in every target:
+//
+//	⏰.now()                          the current date and time
+//	⏰.format(date, "YYYY-MM-DD")     YYYY, MM, DD, HH, mm and ss filled in
+//	⏰.diff(from, to, "s")            to - from in ms (the default), s, m, h or d
+//
+// 🎤 is EmojiInput: 🎤("Name? ") asks for a line of input and returns it
+// without its line ending, or null once there is no more input.
+//
+// 🧾 and 📂 are JSON.stringify and JSON.parse, which every JavaScript
+// target has built in; Python gets a JSON class over its json module.
+//
+// 📖 is EmojiReadFile: 📖("notes.txt") returns the file's text, read as
+// UTF-8. ✍️ is EmojiWriteFile: ✍️("out.txt", text) replaces the file's
+// contents with text. JavaScript reaches the file system through Node's
+// fs module, so neither works in a browser.
+//
+// 🌐 is EmojiFetch: ⏳ 🌐(url, options) makes an HTTP request, with the
+// method, headers and body fetch takes, and resolves to its response's
+// status, ok and text, and a json() that parses the text. GDScript has
+// no definition, since Godot makes requests with an HTTPRequest node.
+var stdlibShims = []stdlibShim{
+	{name: "EmojiTime", definitions: map[string]string{
+		"javascript": `const EmojiTime = {
+  units: { ms: 1, s: 1000, m: 60000, h: 3600000, d: 86400000 },
+  now: () => new Date(),
+  format: (date = new Date(), pattern = "YYYY-MM-DD HH:mm:ss") => {
+    const pad = (n) => String(n).padStart(2, "0");
+    const parts = [
+      ["YYYY", String(date.getFullYear())], ["MM", pad(date.getMonth() + 1)], ["DD", pad(date.getDate())],
+      ["HH", pad(date.getHours())], ["mm", pad(date.getMinutes())], ["ss", pad(date.getSeconds())],
+    ];
+    return parts.reduce((text, [token, value]) => text.split(token).join(value), pattern);
+  },
+  diff: (from, to, unit = "ms") => (to - from) / EmojiTime.units[unit],
+};`,
+		"typescript": `const EmojiTime = {
+  units: { ms: 1, s: 1000, m: 60000, h: 3600000, d: 86400000 } as Record<string, number>,
+  now: (): Date => new Date(),
+  format: (date: Date = new Date(), pattern: string = "YYYY-MM-DD HH:mm:ss"): string => {
+    const pad = (n: number): string => String(n).padStart(2, "0");
+    const parts: [string, string][] = [
+      ["YYYY", String(date.getFullYear())], ["MM", pad(date.getMonth() + 1)], ["DD", pad(date.getDate())],
+      ["HH", pad(date.getHours())], ["mm", pad(date.getMinutes())], ["ss", pad(date.getSeconds())],
+    ];
+    return parts.reduce((text, [token, value]) => text.split(token).join(value), pattern);
+  },
+  diff: (from: Date, to: Date, unit: string = "ms"): number => (to.getTime() - from.getTime()) / EmojiTime.units[unit],
+};`,
+		"es5": `var EmojiTime = {
+  units: { ms: 1, s: 1000, m: 60000, h: 3600000, d: 86400000 },
+  now: function () { return new Date(); },
+  format: function (date, pattern) {
+    date = date || new Date();
+    pattern = pattern || "YYYY-MM-DD HH:mm:ss";
+    function pad(n) { return (n < 10 ? "0" : "") + n; }
+    var parts = [
+      ["YYYY", String(date.getFullYear())], ["MM", pad(date.getMonth() + 1)], ["DD", pad(date.getDate())],
+      ["HH", pad(date.getHours())], ["mm", pad(date.getMinutes())], ["ss", pad(date.getSeconds())]
+    ];
+    for (var i = 0; i < parts.length; i++) {
+      pattern = pattern.split(parts[i][0]).join(parts[i][1]);
+    }
+    return pattern;
+  },
+  diff: function (from, to, unit) { return (to - from) / EmojiTime.units[unit || "ms"]; }
+};`,
+		"python": `import datetime as _datetime
+import re as _re
+
+
+class EmojiTime:
+    units = {"ms": 0.001, "s": 1, "m": 60, "h": 3600, "d": 86400}
+    codes = {"YYYY": "%Y", "MM": "%m", "DD": "%d", "HH": "%H", "mm": "%M", "ss": "%S"}
+
+    @staticmethod
+    def now():
+        return _datetime.datetime.now()
+
+    @staticmethod
+    def format(date=None, pattern="YYYY-MM-DD HH:mm:ss"):
+        date = date or _datetime.datetime.now()
+        return date.strftime(_re.sub("YYYY|MM|DD|HH|mm|ss", lambda m: EmojiTime.codes[m.group()], pattern))
+
+    @staticmethod
+    def diff(start, end, unit="ms"):
+        return (end - start).total_seconds() / EmojiTime.units[unit]`,
+		// Rust and GDScript keep dates as milliseconds since the Unix
+		// epoch, in UTC
+		"rust": `struct EmojiTime;
+
+impl EmojiTime {
+    fn now() -> f64 {
+        let since = std::time::SystemTime::now().duration_since(std::time::UNIX_EPOCH);
+        since.map(|d| d.as_millis() as f64).unwrap_or(0.0)
+    }
+
+    fn format(date: f64, pattern: &str) -> String {
+        let seconds = (date / 1000.0).floor() as i64;
+        let (days, time) = (seconds.div_euclid(86400), seconds.rem_euclid(86400));
+        // the civil date of a day count, after Howard Hinnant's days_from_civil
+        let z = days + 719468;
+        let era = z.div_euclid(146097);
+        let doe = z - era * 146097;
+        let yoe = (doe - doe / 1460 + doe / 36524 - doe / 146096) / 365;
+        let doy = doe - (365 * yoe + yoe / 4 - yoe / 100);
+        let mp = (5 * doy + 2) / 153;
+        let day = doy - (153 * mp + 2) / 5 + 1;
+        let month = if mp < 10 { mp + 3 } else { mp - 9 };
+        let year = yoe + era * 400 + if month <= 2 { 1 } else { 0 };
+        pattern
+            .replace("YYYY", &format!("{:04}", year))
+            .replace("MM", &format!("{:02}", month))
+            .replace("DD", &format!("{:02}", day))
+            .replace("HH", &format!("{:02}", time / 3600))
+            .replace("mm", &format!("{:02}", time % 3600 / 60))
+            .replace("ss", &format!("{:02}", time % 60))
+    }
+
+    fn diff(start: f64, end: f64, unit: &str) -> f64 {
+        let ms = match unit {
+            "s" => 1000.0,
+            "m" => 60000.0,
+            "h" => 3600000.0,
+            "d" => 86400000.0,
+            _ => 1.0,
+        };
+        (end - start) / ms
+    }
+}`,
+		"gdscript": `class EmojiTime:
+	const UNITS = {"ms": 1.0, "s": 1000.0, "m": 60000.0, "h": 3600000.0, "d": 86400000.0}
+
+	static func now() -> float:
+		return Time.get_unix_time_from_system() * 1000.0
+
+	static func format(date: float = -1.0, pattern: String = "YYYY-MM-DD HH:mm:ss") -> String:
+		if date < 0:
+			date = now()
+		var t := Time.get_datetime_dict_from_unix_time(int(date / 1000.0))
+		return pattern.replace("YYYY", "%04d" % t.year).replace("MM", "%02d" % t.month) \
+			.replace("DD", "%02d" % t.day).replace("HH", "%02d" % t.hour) \
+			.replace("mm", "%02d" % t.minute).replace("ss", "%02d" % t.second)
+
+	static func diff(start: float, end: float, unit: String = "ms") -> float:
+		return (end - start) / UNITS[unit]`,
+	}},
+	// browsers (and Deno) have prompt(), which the sandbox fills from the
+	// run's stdin; Node reads the line from stdin itself
+	{name: "EmojiInput", definitions: map[string]string{
+		"javascript": `const EmojiInput = (question = "") => {
+  if (typeof prompt === "function") {
+    return prompt(question);
+  }
+  const fs = process.getBuiltinModule("fs");
+  process.stdout.write(question);
+  const bytes = [];
+  const byte = Buffer.alloc(1);
+  let read = 0;
+  while ((read = fs.readSync(0, byte, 0, 1, null)) === 1 && byte[0] !== 10) {
+    bytes.push(byte[0]);
+  }
+  if (read === 0 && bytes.length === 0) {
+    return null;
+  }
+  const line = Buffer.from(bytes).toString("utf8");
+  return line.endsWith("\r") ? line.slice(0, -1) : line;
+};`,
+		"typescript": `const EmojiInput = (question: string = ""): string | null => {
+  if (typeof prompt === "function") {
+    return prompt(question);
+  }
+  const node = globalThis as any;
+  const fs = node.process.getBuiltinModule("fs");
+  node.process.stdout.write(question);
+  const bytes: number[] = [];
+  const byte = node.Buffer.alloc(1);
+  let read = 0;
+  while ((read = fs.readSync(0, byte, 0, 1, null)) === 1 && byte[0] !== 10) {
+    bytes.push(byte[0]);
+  }
+  if (read === 0 && bytes.length === 0) {
+    return null;
+  }
+  const line: string = node.Buffer.from(bytes).toString("utf8");
+  return line.endsWith("\r") ? line.slice(0, -1) : line;
+};`,
+		"es5": `var EmojiInput = function (question) {
+  question = question || "";
+  if (typeof prompt === "function") {
+    return prompt(question);
+  }
+  var fs = require("fs");
+  process.stdout.write(question);
+  var bytes = [];
+  var byte = Buffer.alloc(1);
+  var read = 0;
+  while ((read = fs.readSync(0, byte, 0, 1, null)) === 1 && byte[0] !== 10) {
+    bytes.push(byte[0]);
+  }
+  if (read === 0 && bytes.length === 0) {
+    return null;
+  }
+  var line = Buffer.from(bytes).toString("utf8");
+  return line.charAt(line.length - 1) === "\r" ? line.slice(0, -1) : line;
+};`,
+		"python": `def EmojiInput(question=""):
+    try:
+        return input(question)
+    except EOFError:
+        return None`,
+		"rust": `#[allow(non_snake_case)]
+fn EmojiInput(question: &str) -> String {
+    use std::io::Write;
+    print!("{}", question);
+    std::io::stdout().flush().ok();
+    let mut line = String::new();
+    std::io::stdin().read_line(&mut line).ok();
+    line.trim_end_matches(['\r', '\n']).to_string()
+}`,
+		"gdscript": `func EmojiInput(question: String = "") -> String:
+	printraw(question)
+	return OS.read_string_from_stdin().trim_suffix("\n").trim_suffix("\r")`,
+	}},
+	{name: "EmojiReadFile", files: true, definitions: map[string]string{
+		"javascript": `const EmojiReadFile = (path) => process.getBuiltinModule("fs").readFileSync(path, "utf8");`,
+		"typescript": `const EmojiReadFile = (path: string): string => (globalThis as any).process.getBuiltinModule("fs").readFileSync(path, "utf8");`,
+		"es5": `var EmojiReadFile = function (path) {
+  return require("fs").readFileSync(path, "utf8");
+};`,
+		"python": `def EmojiReadFile(path):
+    with open(path, encoding="utf-8") as file:
+        return file.read()`,
+		"rust": `#[allow(non_snake_case)]
+fn EmojiReadFile(path: impl AsRef<std::path::Path>) -> String {
+    let path = path.as_ref();
+    std::fs::read_to_string(path).unwrap_or_else(|err| panic!("can't read {}: {}", path.display(), err))
+}`,
+		"gdscript": `func EmojiReadFile(path: String) -> String:
+	return FileAccess.get_file_as_string(path)`,
+	}},
+	{name: "EmojiWriteFile", files: true, definitions: map[string]string{
+		"javascript": `const EmojiWriteFile = (path, text) => process.getBuiltinModule("fs").writeFileSync(path, String(text));`,
+		"typescript": `const EmojiWriteFile = (path: string, text: unknown): void => (globalThis as any).process.getBuiltinModule("fs").writeFileSync(path, String(text));`,
+		"es5": `var EmojiWriteFile = function (path, text) {
+  require("fs").writeFileSync(path, String(text));
+};`,
+		"python": `def EmojiWriteFile(path, text):
+    with open(path, "w", encoding="utf-8") as file:
+        file.write(str(text))`,
+		"rust": `#[allow(non_snake_case)]
+fn EmojiWriteFile(path: impl AsRef<std::path::Path>, text: impl std::fmt::Display) {
+    let path = path.as_ref();
+    std::fs::write(path, text.to_string()).unwrap_or_else(|err| panic!("can't write {}: {}", path.display(), err))
+}`,
+		"gdscript": `func EmojiWriteFile(path: String, text) -> void:
+	var file := FileAccess.open(path, FileAccess.WRITE)
+	file.store_string(str(text))`,
+	}},
+	// the response's body is read before EmojiFetch resolves, so text is
+	// a string and json() parses it without another await
+	{name: "EmojiFetch", definitions: map[string]string{
+		"javascript": `const EmojiFetch = async (url, options = {}) => {
+  const response = await fetch(url, options);
+  const text = await response.text();
+  return { status: response.status, ok: response.ok, text, json: () => JSON.parse(text) };
+};`,
+		"typescript": `interface EmojiResponse {
+  status: number;
+  ok: boolean;
+  text: string;
+  json: () => any;
+}
+
+const EmojiFetch = async (url: string, options: Record<string, any> = {}): Promise<EmojiResponse> => {
+  const response = await fetch(url, options);
+  const text = await response.text();
+  return { status: response.status, ok: response.ok, text, json: () => JSON.parse(text) };
+};`,
+		"es5": `var EmojiFetch = function (url, options) {
+  return fetch(url, options || {}).then(function (response) {
+    return response.text().then(function (text) {
+      return { status: response.status, ok: response.ok, text: text, json: function () { return JSON.parse(text); } };
+    });
+  });
+};`,
+		// urllib blocks, so the request runs on a worker thread and
+		// awaiting EmojiFetch waits for it as awaiting fetch would
+		"python": `import asyncio as _asyncio
+import json as _json
+import urllib.error as _urllib_error
+import urllib.request as _urllib_request
+
+
+class EmojiResponse:
+    def __init__(self, status, text):
+        self.status = status
+        self.ok = 200 <= status < 300
+        self.text = text
+
+    def json(self):
+        return _json.loads(self.text)
+
+
+async def EmojiFetch(url, options=None):
+    options = options or {}
+    body = options.get("body")
+    if isinstance(body, str):
+        body = body.encode("utf-8")
+    request = _urllib_request.Request(url, data=body, headers=options.get("headers", {}), method=options.get("method", "GET"))
+
+    def send():
+        try:
+            with _urllib_request.urlopen(request) as response:
+                return EmojiResponse(response.status, response.read().decode("utf-8"))
+        except _urllib_error.HTTPError as err:
+            return EmojiResponse(err.code, err.read().decode("utf-8"))
+
+    return await _asyncio.to_thread(send)`,
+		// Rust's standard library has no HTTP client, so this needs the
+		// ureq crate, and only makes GET requests
+		"rust": `struct EmojiResponse {
+    status: f64,
+    ok: bool,
+    text: String,
+}
+
+#[allow(non_snake_case)]
+fn EmojiFetch(url: impl AsRef<str>) -> EmojiResponse {
+    let url = url.as_ref();
+    let response = match ureq::get(url).call() {
+        Ok(response) | Err(ureq::Error::Status(_, response)) => response,
+        Err(err) => panic!("can't fetch {}: {}", url, err),
+    };
+    let status = response.status();
+    let text = response.into_string().unwrap_or_else(|err| panic!("can't read {}: {}", url, err));
+    EmojiResponse { status: status as f64, ok: (200..300).contains(&status), text }
+}`,
+	}},
+	{name: "JSON", definitions: map[string]string{
+		"python": `import json as _json
+
+
+class JSON:
+    @staticmethod
+    def stringify(value, replacer=None, space=None):
+        if space is None:
+            return _json.dumps(value, separators=(",", ":"), ensure_ascii=False)
+        return _json.dumps(value, indent=space, ensure_ascii=False)
+
+    @staticmethod
+    def parse(text):
+        return _json.loads(text)`,
+	}},
+}
+
+// IsStdlib reports whether name is one of the builtins AddStdlib defines
+func IsStdlib(name string) bool {
+	for _, shim := range stdlibShims {
+		if shim.name == name {
+			return true
+		}
+	}
+	return false
+}
+
+// FileBuiltins returns the builtins transpiled code uses that read or
+// write files, which code run in the sandbox can't
+func FileBuiltins(code string) []string {
+	used := usedStdlib(code)
+	var names []string
+	for _, shim := range stdlibShims {
+		if shim.files && used[shim.name] {
+			names = append(names, shim.name)
+		}
+	}
+	return names
+}
+
+// usedStdlib reports, for each builtin, whether code uses it. Only
+// identifiers count as uses, not strings or comments that mention one.
+func usedStdlib(code string) map[string]bool {
+	used := map[string]bool{}
+	for _, shim := range stdlibShims {
+		used[shim.name] = false
+	}
+	tokens, _ := Lex(code)
+	for _, token := range tokens {
+		if _, ok := used[token.Text]; ok && token.Kind == TokenIdent {
+			used[token.Text] = true
+		}
+	}
+	return used
+}
+
+// AddStdlib puts the definitions of the builtins transpiled code uses
+// ahead of it (see usedStdlib). A target without a definition for one
+// leaves the code as it is.
+func AddStdlib(code, targetLang string) string {
+	if targetLang == "" {
+		targetLang = "javascript"
+	}
+	used := usedStdlib(code)
+
+	var definitions []string
+	for _, shim := range stdlibShims {
+		if definition, ok := shim.definitions[targetLang]; ok && used[shim.name] {
+			definitions = append(definitions, definition)
+		}
+	}
+	if len(definitions) == 0 {
+		return code
+	}
+	return strings.Join(definitions, "\n\n") + "\n\n" + code
+}
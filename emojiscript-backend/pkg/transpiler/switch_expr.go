@@ -0,0 +1,95 @@
+package transpiler
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// SwitchArm is one arm of a switch expression; Default arms have no Value
+type SwitchArm struct {
+	Value   string
+	Result  string
+	Default bool
+}
+
+var (
+	// switchExprPattern matches the head of an emoji switch expression: 📦 label = 🎪 (code) {
+	switchExprPattern = regexp.MustCompile(`^(\s*)(📦|🔢)?\s*([A-Za-z_$][A-Za-z0-9_$]*)\s*=\s*🎪\s*\((.*)\)\s*\{\s*$`)
+	// switchArmPattern matches an arm inside it: 🔘 200 ➡️ "OK" (use _ for the default arm)
+	switchArmPattern = regexp.MustCompile(`^\s*🔘\s*(.+?)\s*➡️\s*(.+?)\s*[,;]?\s*$`)
+)
+
+// ExpandSwitchExpressions rewrites emoji switch expressions assigned to a
+// variable into an immediately-invoked switch for targetLang
+func ExpandSwitchExpressions(code, targetLang string) string {
+	if !strings.Contains(code, "🎪") {
+		return code
+	}
+
+	lines := strings.Split(code, "\n")
+	var out []string
+	for i := 0; i < len(lines); i++ {
+		m := switchExprPattern.FindStringSubmatch(lines[i])
+		if m == nil {
+			out = append(out, lines[i])
+			continue
+		}
+
+		var arms []SwitchArm
+		end := -1
+		for j := i + 1; j < len(lines); j++ {
+			if strings.TrimSpace(lines[j]) == "}" {
+				end = j
+				break
+			}
+			arm := switchArmPattern.FindStringSubmatch(lines[j])
+			if arm == nil {
+				break
+			}
+			if arm[1] == "_" {
+				arms = append(arms, SwitchArm{Result: arm[2], Default: true})
+			} else {
+				arms = append(arms, SwitchArm{Value: arm[1], Result: arm[2]})
+			}
+		}
+
+		// Leave anything we don't fully understand untouched
+		if end < 0 {
+			out = append(out, lines[i])
+			continue
+		}
+
+		out = append(out, RenderSwitchExpression(m[2], m[3], m[4], arms, targetLang, m[1]))
+		i = end
+	}
+	return strings.Join(out, "\n")
+}
+
+// RenderSwitchExpression emits a switch whose value is assigned to name,
+// as a switch in a function called where it's defined: an arrow function,
+// or a function expression for es5, which has no arrow functions. Rust,
+// GDScript and Python are generated from it by codegen, which writes it
+// as a match. An empty keyword assigns to an existing variable.
+func RenderSwitchExpression(keyword, name, subject string, arms []SwitchArm, targetLang, indent string) string {
+	b := &strings.Builder{}
+	if keyword != "" {
+		keyword += " "
+	}
+	function := "() =>"
+	if targetLang == "es5" {
+		function = "function ()"
+	}
+	fmt.Fprintf(b, "%s%s%s = (%s {\n", indent, keyword, name, function)
+	fmt.Fprintf(b, "%s  switch (%s) {\n", indent, subject)
+	for _, arm := range arms {
+		if arm.Default {
+			fmt.Fprintf(b, "%s    default: return %s;\n", indent, arm.Result)
+		} else {
+			fmt.Fprintf(b, "%s    case %s: return %s;\n", indent, arm.Value, arm.Result)
+		}
+	}
+	fmt.Fprintf(b, "%s  }\n", indent)
+	fmt.Fprintf(b, "%s})();", indent)
+	return b.String()
+}
@@ -0,0 +1,432 @@
+package transpiler
+
+import (
+	"sort"
+	"strings"
+	"unicode/utf8"
+)
+
+// Symbol kinds
+const (
+	SymbolFunction = "function"
+	SymbolClass    = "class"
+	SymbolMethod   = "method"
+	SymbolRecord   = "record"
+	// SymbolVariable is a top-level variable, which only Outline lists
+	SymbolVariable = "variable"
+)
+
+// Symbol is a function, class, method or record a program declares, for
+// outline views and go-to-symbol. Line and Column are 1-based and point
+// at the declaration: the tag in markup, the name in emoji syntax.
+// EndLine and EndColumn are just past its end: the closing tag, or the
+// end of its body.
+type Symbol struct {
+	Kind string `json:"kind"`
+	Name string `json:"name"`
+	// Container is the class a method belongs to, or the function or
+	// class a nested declaration is in
+	Container string   `json:"container,omitempty"`
+	Params    []string `json:"params,omitempty"`
+	Line      int      `json:"line"`
+	Column    int      `json:"column"`
+	EndLine   int      `json:"endLine"`
+	EndColumn int      `json:"endColumn"`
+	// Doc is the comment right before the declaration, without its
+	// comment markers
+	Doc string `json:"doc,omitempty"`
+}
+
+// Symbols indexes the functions and classes a program declares, in
+// source order
+func Symbols(code string, markup bool) []Symbol {
+	if !markup {
+		program, _ := ParseEmoji(code)
+		index := &symbolIndex{}
+		index.walk(program.Children, "", false)
+		return index.symbols
+	}
+	parser := NewMarkupParser(code, "javascript")
+	parser.indexAll()
+	return parser.GetSymbols()
+}
+
+// indexAll parses every tag in the input to index its symbols, and
+// returns the top-level ones
+func (p *MarkupParser) indexAll() []*MarkupTag {
+	var tags []*MarkupTag
+	for {
+		tag, err := p.NextTag()
+		if err != nil {
+			p.advance()
+			continue
+		}
+		if tag == nil {
+			return tags
+		}
+		tags = append(tags, tag)
+	}
+}
+
+// GetSymbols returns the functions, classes, methods and records the
+// tags parsed so far declare, in source order
+func (p *MarkupParser) GetSymbols() []Symbol {
+	var symbols []Symbol
+	for _, symbol := range sortSymbols(p.symbols) {
+		if symbol.Kind != SymbolVariable {
+			symbols = append(symbols, symbol)
+		}
+	}
+	return symbols
+}
+
+// sortSymbols sorts symbols by position
+func sortSymbols(symbols []Symbol) []Symbol {
+	sort.SliceStable(symbols, func(i, j int) bool {
+		a, b := symbols[i], symbols[j]
+		return a.Line < b.Line || a.Line == b.Line && a.Column < b.Column
+	})
+	return symbols
+}
+
+// indexTag records the symbol a parsed tag declares, with doc, the
+// <comment> before it; symbols from nested onward were declared inside
+// it. A <comment> becomes the doc of the tag after it. Variables are
+// recorded for Outline; GetSymbols leaves them out.
+func (p *MarkupParser) indexTag(tag *MarkupTag, doc string, nested int) {
+	spec, ok := p.lookupTag(tag.Name)
+	if !ok {
+		return
+	}
+	symbol := Symbol{Name: tag.Attributes["name"], Line: tag.Line, Column: p.sourcePosition(tag.Line, tagStart(tag)), EndLine: p.line, EndColumn: p.sourcePosition(p.line, p.column), Doc: doc}
+	switch spec.names[0] {
+	case "comment":
+		p.doc = strings.TrimSpace(tag.Content)
+		return
+	case "function", "method":
+		symbol.Kind = SymbolFunction
+		if spec.names[0] == "method" {
+			symbol.Kind = SymbolMethod
+		}
+		for _, param := range strings.Split(tag.Attributes["params"], ",") {
+			if param = strings.TrimSpace(param); param != "" {
+				symbol.Params = append(symbol.Params, param)
+			}
+		}
+	case "extend":
+		symbol.Kind = SymbolClass
+	case "record":
+		symbol.Kind = SymbolRecord
+	case "var":
+		symbol.Kind, symbol.Name = SymbolVariable, variableName(tag)
+	default:
+		return
+	}
+	if symbol.Name == "" {
+		return
+	}
+	for i := range p.symbols[nested:] {
+		if p.symbols[nested+i].Container == "" {
+			p.symbols[nested+i].Container = symbol.Name
+		}
+	}
+	p.symbols = append(p.symbols, symbol)
+}
+
+// tagStart returns the column of a tag's '<': a tag's Column is where
+// its attributes start
+func tagStart(tag *MarkupTag) int {
+	return max(tag.Column-utf8.RuneCountInString(tag.Name)-1, 1)
+}
+
+// symbolIndex collects the symbols of an emoji program's tree
+type symbolIndex struct {
+	symbols []Symbol
+}
+
+// walk indexes the declarations among nodes, which are in container;
+// inClass is whether nodes are a class body, where a name followed by
+// parameters is a method
+func (x *symbolIndex) walk(nodes []Node, container string, inClass bool) {
+	for i := 0; i < len(nodes); i++ {
+		if group, ok := nodes[i].(*Group); ok {
+			x.walk(group.Children, container, false)
+			continue
+		}
+		switch word := nodeWord(nodes[i]); {
+		case word == "function" || word == "class":
+			name := nextNode(nodes, i)
+			if !isIdent(nodes, name) {
+				continue
+			}
+			symbol := x.declare(nodes, i, name, container)
+			if word == "function" {
+				i = x.function(symbol, nodes, nextGroup(nodes, name, "("), SymbolFunction, i)
+				continue
+			}
+			symbol.Kind = SymbolClass
+			body := nextGroup(nodes, name, "{")
+			if body < 0 {
+				symbol.EndLine, symbol.EndColumn = nodeEnd(nodes[name])
+				x.add(symbol)
+				continue
+			}
+			symbol.EndLine, symbol.EndColumn = nodeEnd(nodes[body])
+			x.add(symbol)
+			x.walk(nodes[body].(*Group).Children, symbol.Name, true)
+			i = body
+		case word == "const" || word == "let" || word == "var":
+			// name = (params) => ..., name = param => ... or
+			// name = function (params) ...
+			name := nextNode(nodes, i)
+			eq := nextNode(nodes, name)
+			if !isIdent(nodes, name) || eq < 0 || nodeWord(nodes[eq]) != "=" {
+				continue
+			}
+			value := nextNode(nodes, eq)
+			if value >= 0 && nodeWord(nodes[value]) == "async" {
+				value = nextNode(nodes, value)
+			}
+			if value < 0 {
+				continue
+			}
+			symbol := x.declare(nodes, i, name, container)
+			arrow := nextNode(nodes, value)
+			switch {
+			case nodeWord(nodes[value]) == "function":
+				i = x.function(symbol, nodes, nextGroup(nodes, value, "("), SymbolFunction, i)
+			case arrow < 0 || !isArrow(nodes, arrow):
+			case isGroup(nodes, value, "("):
+				i = x.function(symbol, nodes, value, SymbolFunction, i)
+			case isIdent(nodes, value):
+				symbol.Kind, symbol.Params = SymbolFunction, []string{nodeWord(nodes[value])}
+				symbol.EndLine, symbol.EndColumn = statementEnd(nodes, arrow)
+				x.add(symbol)
+				i = arrow
+			}
+		case inClass && isIdent(nodes, i) && !scopeKeywords[word]:
+			// name(params) { ... }
+			if params := nextNode(nodes, i); isGroup(nodes, params, "(") {
+				i = x.function(x.declare(nodes, i, i, container), nodes, params, SymbolMethod, i)
+			}
+		}
+	}
+}
+
+// declare starts the symbol named by nodes[name], taking its doc from
+// the comments before nodes[start]
+func (x *symbolIndex) declare(nodes []Node, start, name int, container string) Symbol {
+	token := nodes[name].(*Leaf).Token
+	return Symbol{Name: token.Text, Container: container, Line: token.Line, Column: token.Column, Doc: docBefore(nodes, start)}
+}
+
+// function finishes a function or method symbol whose parameters are the
+// group at nodes[params], and indexes its body. It returns the index of
+// the last node it used, or at if there are no parameters.
+func (x *symbolIndex) function(symbol Symbol, nodes []Node, params int, kind string, at int) int {
+	if params < 0 {
+		return at
+	}
+	symbol.Kind = kind
+	symbol.Params = paramList(nodes[params].(*Group))
+	body := nextNode(nodes, params)
+	if body >= 0 && isArrow(nodes, body) {
+		if nodeWord(nodes[body]) == "=" {
+			body++
+		}
+		body = nextNode(nodes, body)
+	}
+	if !isGroup(nodes, body, "{") {
+		symbol.EndLine, symbol.EndColumn = statementEnd(nodes, params)
+		x.add(symbol)
+		return params
+	}
+	symbol.EndLine, symbol.EndColumn = nodeEnd(nodes[body])
+	x.add(symbol)
+	x.walk(nodes[body].(*Group).Children, symbol.Name, false)
+	return body
+}
+
+func (x *symbolIndex) add(symbol Symbol) {
+	x.symbols = append(x.symbols, symbol)
+}
+
+// nodeWord returns a leaf's keyword or name, or its punctuation; groups
+// and other tokens have none
+func nodeWord(n Node) string {
+	leaf, ok := n.(*Leaf)
+	if !ok {
+		return ""
+	}
+	switch leaf.Token.Kind {
+	case TokenKeyword:
+		return leaf.Token.Keyword
+	case TokenIdent, TokenPunct:
+		return leaf.Token.Text
+	}
+	return ""
+}
+
+// isIdent reports whether nodes[i] is a name
+func isIdent(nodes []Node, i int) bool {
+	if i < 0 {
+		return false
+	}
+	leaf, ok := nodes[i].(*Leaf)
+	return ok && leaf.Token.Kind == TokenIdent
+}
+
+// isGroup reports whether nodes[i] is a group opened with open
+func isGroup(nodes []Node, i int, open string) bool {
+	if i < 0 {
+		return false
+	}
+	group, ok := nodes[i].(*Group)
+	return ok && group.Open.Text == open
+}
+
+// nextNode returns the index of the first node after i that isn't space
+// or a comment, or -1
+func nextNode(nodes []Node, i int) int {
+	if i < 0 {
+		return -1
+	}
+	for j := i + 1; j < len(nodes); j++ {
+		if leaf, ok := nodes[j].(*Leaf); ok && (leaf.Token.Kind == TokenSpace || leaf.Token.Kind == TokenComment) {
+			continue
+		}
+		return j
+	}
+	return -1
+}
+
+// nextGroup returns the index of the first group opened with open after
+// i, before any ';', or -1
+func nextGroup(nodes []Node, i int, open string) int {
+	for j := nextNode(nodes, i); j >= 0; j = nextNode(nodes, j) {
+		if isGroup(nodes, j, open) {
+			return j
+		}
+		if nodeWord(nodes[j]) == ";" {
+			break
+		}
+	}
+	return -1
+}
+
+// isArrow reports whether "=>" starts at nodes[i], as a keyword emoji or
+// as '=' and '>'
+func isArrow(nodes []Node, i int) bool {
+	if nodeWord(nodes[i]) == "=>" {
+		return true
+	}
+	return nodeWord(nodes[i]) == "=" && i+1 < len(nodes) && nodeWord(nodes[i+1]) == ">"
+}
+
+// nodeEnd returns the position just past a node: past its closing
+// bracket for a group
+func nodeEnd(n Node) (int, int) {
+	switch n := n.(type) {
+	case *Group:
+		if n.Close != nil {
+			return n.Close.Line, n.Close.Column + 1
+		}
+		if len(n.Children) > 0 {
+			return nodeEnd(n.Children[len(n.Children)-1])
+		}
+		return n.Open.Line, n.Open.Column + 1
+	case *Leaf:
+		text := n.Token.Text
+		if newline := strings.LastIndex(text, "\n"); newline >= 0 {
+			return n.Token.Line + strings.Count(text, "\n"), utf8.RuneCountInString(text[newline+1:]) + 1
+		}
+		return n.Token.Line, n.Token.Column + utf8.RuneCountInString(text)
+	}
+	return n.Pos()
+}
+
+// statementEnd returns the position just past the statement nodes[i] is
+// part of: its last node before a ';' or a line break that doesn't follow
+// an operator
+func statementEnd(nodes []Node, i int) (int, int) {
+	last := i
+	for j := i + 1; j < len(nodes); j++ {
+		if leaf, ok := nodes[j].(*Leaf); ok {
+			if nodeWord(leaf) == ";" {
+				break
+			}
+			if leaf.Token.Kind == TokenSpace && strings.Contains(leaf.Token.Text, "\n") && !continuesLine(nodes[last]) {
+				break
+			}
+			if leaf.Token.Kind == TokenSpace || leaf.Token.Kind == TokenComment {
+				continue
+			}
+		}
+		last = j
+	}
+	return nodeEnd(nodes[last])
+}
+
+// continuesLine reports whether a statement goes on past a line break
+// after n: n is an operator or "=>"
+func continuesLine(n Node) bool {
+	leaf, ok := n.(*Leaf)
+	return ok && (leaf.Token.Kind == TokenPunct || leaf.Token.Kind == TokenKeyword && leaf.Token.Keyword == "=>")
+}
+
+// paramList returns a parameter list's parameters as JavaScript source
+func paramList(group *Group) []string {
+	var params []string
+	var b strings.Builder
+	flush := func() {
+		if param := strings.TrimSpace(b.String()); param != "" {
+			params = append(params, param)
+		}
+		b.Reset()
+	}
+	for _, n := range group.Children {
+		if nodeWord(n) == "," {
+			flush()
+			continue
+		}
+		generate(&b, []Node{n})
+	}
+	flush()
+	return params
+}
+
+// docBefore returns the comments right before nodes[i], with at most one
+// line break between them and the declaration, without their markers
+func docBefore(nodes []Node, i int) string {
+	var lines []string
+	for j := i - 1; j >= 0; j-- {
+		leaf, ok := nodes[j].(*Leaf)
+		if !ok {
+			break
+		}
+		if leaf.Token.Kind == TokenSpace {
+			if strings.Count(leaf.Token.Text, "\n") > 1 {
+				break
+			}
+			continue
+		}
+		if leaf.Token.Kind != TokenComment {
+			break
+		}
+		lines = append(commentLines(leaf.Token.Text), lines...)
+	}
+	return strings.TrimSpace(strings.Join(lines, "\n"))
+}
+
+// commentLines strips a comment's markers, line by line
+func commentLines(comment string) []string {
+	comment = strings.TrimPrefix(comment, "//")
+	comment = strings.TrimPrefix(comment, "/*")
+	comment = strings.TrimSuffix(comment, "*/")
+	lines := strings.Split(comment, "\n")
+	for i, line := range lines {
+		lines[i] = strings.TrimPrefix(strings.TrimSpace(line), "*")
+		lines[i] = strings.TrimSpace(lines[i])
+	}
+	return lines
+}
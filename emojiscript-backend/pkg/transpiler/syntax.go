@@ -0,0 +1,1720 @@
+package transpiler
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"unicode/utf8"
+)
+
+// Syntax is a statement or expression of an emoji program's syntax tree.
+// Kind is its ESTree type, such as "VariableDeclaration", "IfStatement"
+// or "BinaryExpression", with "RecordDeclaration" and "SwitchExpression"
+// for what emoji syntax adds to JavaScript. Label is what the node holds
+// besides its children, in its JavaScript spelling: an operator, a name,
+// a literal as written or a declaration's keyword.
+type Syntax struct {
+	Kind     string
+	Label    string
+	Line     int
+	Column   int
+	Children []*Syntax
+}
+
+// sugar is a construct emoji syntax adds to JavaScript: a record, a 🧲
+// getter or a switch expression. Generation writes it as the JavaScript
+// it stands for in place of its tokens.
+type sugar struct {
+	// last is the index of its last token
+	last int
+	// render writes it in the target language, each line indented with
+	// indent
+	render func(n *Program, targetLang, indent string) string
+}
+
+// tokenEnd is the kind of the token the statement parser reads after the
+// last one
+const tokenEnd TokenKind = -1
+
+// syntaxToken is a token as the statement parser reads it. Spaces and
+// comments are dropped, adjacent punctuation is read as the punctuator
+// it spells, and a keyword emoji as its JavaScript spelling: a word such
+// as "const" as an identifier, an operator as punctuation.
+type syntaxToken struct {
+	kind  TokenKind
+	value string
+	// first and last are the indices of the lexer's tokens it's read
+	// from
+	first, last int
+	// nl marks a token with a line break before it
+	nl bool
+	// depth is how many brackets are open around it; a bracket is at the
+	// depth of what's outside it
+	depth int
+}
+
+// syntaxPunctuators are the punctuators runs of punctuation are read as,
+// longest first
+var syntaxPunctuators = func() []string {
+	punctuators := append([]string{"...", "?."}, punctOperators...)
+	sort.SliceStable(punctuators, func(i, j int) bool {
+		return len(punctuators[i]) > len(punctuators[j])
+	})
+	return punctuators
+}()
+
+// reservedWords can't name a variable, function or parameter
+var reservedWords = map[string]bool{
+	"break": true, "case": true, "catch": true, "class": true, "const": true, "continue": true,
+	"debugger": true, "default": true, "delete": true, "do": true, "else": true, "enum": true,
+	"export": true, "extends": true, "false": true, "finally": true, "for": true, "function": true,
+	"if": true, "import": true, "in": true, "instanceof": true, "new": true, "null": true,
+	"return": true, "super": true, "switch": true, "this": true, "throw": true, "true": true,
+	"try": true, "typeof": true, "var": true, "void": true, "while": true, "with": true,
+}
+
+// statementWords are the words that can't start an expression
+var statementWords = map[string]bool{
+	"break": true, "case": true, "catch": true, "const": true, "continue": true, "debugger": true,
+	"default": true, "do": true, "else": true, "enum": true, "export": true, "extends": true,
+	"finally": true, "for": true, "if": true, "in": true, "instanceof": true, "return": true,
+	"throw": true, "try": true, "var": true, "while": true, "with": true,
+}
+
+// syntaxParser reads the statements and expressions of an emoji program
+// by recursive descent, as the sandbox parses JavaScript. A syntax error
+// abandons the statement it's in: the parser records it and carries on
+// from the next statement, so each statement reports its first error.
+type syntaxParser struct {
+	source []Token
+	toks   []syntaxToken
+	i      int
+	errors []*SyntaxError
+	// statementStart is the index of the token the innermost statement
+	// being parsed starts at
+	statementStart int
+	// sugar holds the records, getters and switch expressions read, by
+	// the index of their first token
+	sugar map[int]*sugar
+}
+
+func newSyntaxParser(tokens []Token) *syntaxParser {
+	p := &syntaxParser{source: tokens, sugar: map[int]*sugar{}}
+	nl, depth := false, 0
+	for i := 0; i < len(tokens); i++ {
+		token := tokens[i]
+		t := syntaxToken{kind: token.Kind, value: token.Text, first: i, last: i, nl: nl, depth: depth}
+		switch token.Kind {
+		case TokenSpace, TokenComment:
+			nl = nl || strings.Contains(token.Text, "\n")
+			continue
+		case TokenKeyword:
+			t.kind, t.value = TokenIdent, token.Keyword
+			if first, _ := utf8.DecodeRuneInString(token.Keyword); !isIdentRune(first) {
+				t.kind = TokenPunct
+				t.value, t.last = punctuator(tokens, i)
+			}
+		case TokenPunct:
+			t.value, t.last = punctuator(tokens, i)
+		case TokenTemplate:
+			// a substitution's '}' closes it, its "${" opens it
+			if strings.HasPrefix(token.Text, "}") {
+				depth--
+			}
+			t.depth = depth
+			if strings.HasSuffix(token.Text, "${") {
+				depth++
+			}
+		}
+		if t.kind == TokenPunct {
+			switch t.value {
+			case "(", "[", "{":
+				depth++
+			case ")", "]", "}":
+				depth--
+				t.depth = depth
+			}
+		}
+		p.toks = append(p.toks, t)
+		i, nl = t.last, false
+	}
+	p.toks = append(p.toks, syntaxToken{kind: tokenEnd, first: len(tokens), last: len(tokens) - 1, nl: true, depth: depth})
+	return p
+}
+
+// punctuator returns the longest punctuator the punctuation from i spells
+// along with the index of its last token. Operator emoji count as their
+// spelling, so ➕= reads as +=.
+func punctuator(tokens []Token, i int) (string, int) {
+	value, last, run := tokens[i].Text, i, ""
+	if tokens[i].Kind == TokenKeyword {
+		value = tokens[i].Keyword
+	}
+	for j := i; j < len(tokens) && len(run) < 4; j++ {
+		switch token := tokens[j]; {
+		case token.Kind == TokenPunct:
+			run += token.Text
+		case token.Kind == TokenKeyword && !isIdentRune([]rune(token.Keyword)[0]):
+			run += token.Keyword
+		default:
+			j = len(tokens)
+			continue
+		}
+		for _, punctuator := range syntaxPunctuators {
+			if run == punctuator && len(run) > 1 {
+				value, last = run, j
+			}
+		}
+	}
+	// ?. before a digit is ? and a number, as in a?.5:1
+	if value == "?." && last+1 < len(tokens) && tokens[last+1].Kind == TokenNumber {
+		return "?", i
+	}
+	return value, last
+}
+
+// program parses every statement
+func (p *syntaxParser) program() []*Syntax {
+	var body []*Syntax
+	for !p.atEnd() {
+		if s := p.recoverStatement(); s != nil {
+			body = append(body, s)
+		}
+	}
+	return body
+}
+
+// recoverStatement parses a statement. On a syntax error it records the
+// error, skips the rest of the statement and returns nil.
+func (p *syntaxParser) recoverStatement() (s *Syntax) {
+	start := p.i
+	defer func() {
+		r := recover()
+		if r == nil {
+			return
+		}
+		err, ok := r.(*SyntaxError)
+		if !ok {
+			panic(r)
+		}
+		p.errors = append(p.errors, err)
+		p.skip(start)
+		s = nil
+	}()
+	return p.statement()
+}
+
+// skip moves past the statement from start that failed to parse: to the
+// first token after it that starts a line or follows a ';' outside its
+// brackets, or to the bracket closing the block it's in
+func (p *syntaxParser) skip(start int) {
+	depth := p.toks[start].depth
+	i := max(p.i, start+1)
+	for ; i < len(p.toks)-1; i++ {
+		t, prev := p.toks[i], p.toks[i-1]
+		if t.depth < depth || t.depth == depth && (t.nl || prev.kind == TokenPunct && prev.value == ";") {
+			break
+		}
+	}
+	p.i = min(i, len(p.toks)-1)
+}
+
+func (p *syntaxParser) cur() syntaxToken { return p.toks[p.i] }
+
+func (p *syntaxParser) peek(n int) syntaxToken {
+	return p.toks[min(p.i+n, len(p.toks)-1)]
+}
+
+func (p *syntaxParser) next() syntaxToken {
+	t := p.toks[p.i]
+	if p.i < len(p.toks)-1 {
+		p.i++
+	}
+	return t
+}
+
+func (p *syntaxParser) atEnd() bool { return p.cur().kind == tokenEnd }
+
+// is reports whether the current token is the punctuator or word v
+func (p *syntaxParser) is(v string) bool {
+	return isWord(p.cur(), v)
+}
+
+func isWord(t syntaxToken, v string) bool {
+	return (t.kind == TokenPunct || t.kind == TokenIdent) && t.value == v
+}
+
+// nextIs reports whether the token after the current one is one of the
+// punctuators
+func (p *syntaxParser) nextIs(values ...string) bool {
+	next := p.peek(1)
+	for _, v := range values {
+		if next.kind == TokenPunct && next.value == v {
+			return true
+		}
+	}
+	return false
+}
+
+func (p *syntaxParser) eat(v string) bool {
+	if p.is(v) {
+		p.next()
+		return true
+	}
+	return false
+}
+
+func (p *syntaxParser) expect(v string) syntaxToken {
+	if !p.is(v) {
+		p.unexpected("expected %s but found %s", spell(v), p.describe(p.cur()))
+	}
+	return p.next()
+}
+
+// separator reads the ',' between the items of a list that close ends
+func (p *syntaxParser) separator(close string) {
+	if !p.is(close) && !p.eat(",") {
+		p.unexpected("expected ',' or '%s' but found %s", close, p.describe(p.cur()))
+	}
+}
+
+// semicolon reads the end of a statement: a ';', or nothing before a
+// line break, a '}' or the end of the program
+func (p *syntaxParser) semicolon() {
+	if p.eat(";") || p.is("}") || p.atEnd() || p.cur().nl {
+		return
+	}
+	p.unexpected("expected a line break or ';' before %s", p.describe(p.cur()))
+}
+
+// text returns the source t is read from
+func (p *syntaxParser) text(t syntaxToken) string {
+	b := &strings.Builder{}
+	for _, token := range p.source[max(t.first, 0) : t.last+1] {
+		b.WriteString(token.Text)
+	}
+	return b.String()
+}
+
+// describe quotes t as written, or names the end of the program
+func (p *syntaxParser) describe(t syntaxToken) string {
+	if t.kind == tokenEnd {
+		return "the end of the program"
+	}
+	return quote(p.text(t))
+}
+
+// quote quotes source for a message, shortened when it's long
+func quote(source string) string {
+	if runes := []rune(source); len(runes) > 24 {
+		source = string(runes[:23]) + "…"
+	}
+	return "'" + source + "'"
+}
+
+// spell quotes a keyword or punctuator as emoji syntax writes it: the
+// keyword's emoji where it has one
+func spell(v string) string {
+	if emoji, ok := KeywordEmoji(v); ok && (isIdentRune([]rune(v)[0]) || v == "=>") {
+		return "'" + emoji + "'"
+	}
+	return "'" + v + "'"
+}
+
+// position returns where t starts; the end of the program is placed at
+// the last token
+func (p *syntaxParser) position(t syntaxToken) (int, int) {
+	if t.kind == tokenEnd {
+		if len(p.toks) < 2 {
+			return 1, 1
+		}
+		t = p.toks[len(p.toks)-2]
+	}
+	token := p.source[t.first]
+	return token.Line, token.Column
+}
+
+// failAt abandons the statement being parsed with an error at t
+func (p *syntaxParser) failAt(t syntaxToken, code, format string, args ...interface{}) {
+	line, column := p.position(t)
+	length := utf8.RuneCountInString(p.text(t))
+	panic(&SyntaxError{Line: line, Column: column, Message: fmt.Sprintf(format, args...), Length: max(length, 1), Code: code})
+}
+
+// unexpected fails at the current token
+func (p *syntaxParser) unexpected(format string, args ...interface{}) {
+	p.failAt(p.cur(), CodeUnexpectedToken, format, args...)
+}
+
+// node returns a node of the kind starting at t, with the children that
+// are present
+func (p *syntaxParser) node(kind string, t syntaxToken, children ...*Syntax) *Syntax {
+	line, column := p.position(t)
+	n := &Syntax{Kind: kind, Line: line, Column: column}
+	for _, child := range children {
+		if child != nil {
+			n.Children = append(n.Children, child)
+		}
+	}
+	return n
+}
+
+// nodeAt returns a node of the kind starting where first does
+func nodeAt(kind, label string, first *Syntax, children ...*Syntax) *Syntax {
+	return &Syntax{Kind: kind, Label: label, Line: first.Line, Column: first.Column, Children: children}
+}
+
+// wrap returns a node of the kind holding x
+func wrap(kind string, x *Syntax) *Syntax {
+	return nodeAt(kind, "", x, x)
+}
+
+// startsExpression reports whether the token at i can start an
+// expression
+func (p *syntaxParser) startsExpression(i int) bool {
+	t := p.toks[min(i, len(p.toks)-1)]
+	switch t.kind {
+	case tokenEnd:
+		return false
+	case TokenIdent:
+		return !statementWords[t.value]
+	case TokenPunct:
+		switch t.value {
+		case "(", "[", "{", "!", "~", "+", "-", "++", "--", "#":
+			return true
+		case ".":
+			return p.toks[i+1].kind == TokenNumber
+		}
+		return false
+	case TokenTemplate:
+		return !strings.HasPrefix(t.value, "}")
+	}
+	return true
+}
+
+// isBinaryOperator reports whether t is an operator that only goes
+// between two operands
+func isBinaryOperator(t syntaxToken) bool {
+	binding, ok := operatorBindings[t.value]
+	return ok && t.kind == TokenPunct && !binding.unary && t.value != "=>" && t.value != "+" && t.value != "-"
+}
+
+// operand fails at op, which needs an operand after it, when what comes
+// next can't start one; a binary operator next is missing its left
+// operand instead
+func (p *syntaxParser) operand(op syntaxToken, format string) {
+	if p.startsExpression(p.i) {
+		return
+	}
+	if t := p.cur(); isBinaryOperator(t) {
+		p.failAt(t, CodeMissingExpression, "%s is missing its left operand", p.describe(t))
+	}
+	p.failAt(op, CodeMissingExpression, format, p.describe(op))
+}
+
+// isBindingIdent reports whether the current token can name a variable
+func (p *syntaxParser) isBindingIdent() bool {
+	return p.bindingAt(p.i)
+}
+
+func (p *syntaxParser) bindingAt(i int) bool {
+	t := p.toks[min(i, len(p.toks)-1)]
+	return t.kind == TokenEmoji || t.kind == TokenIdent && !reservedWords[t.value] && !strings.Contains(t.value, ".")
+}
+
+func (p *syntaxParser) bindingIdent() *Syntax {
+	t := p.cur()
+	if !p.isBindingIdent() {
+		if t.kind == TokenIdent && p.source[t.first].Kind == TokenKeyword || reservedWords[t.value] {
+			p.unexpected("%s is a keyword and can't be used as a name", p.describe(t))
+		}
+		p.unexpected("expected a name but found %s", p.describe(t))
+	}
+	p.next()
+	n := p.node("Identifier", t)
+	n.Label = t.value
+	return n
+}
+
+// skipType skips a TypeScript annotation after ':' up to one of the stop
+// punctuators outside its brackets
+func (p *syntaxParser) skipType(stops ...string) {
+	p.expect(":")
+	depth := 0
+	for first := true; !p.atEnd(); first = false {
+		if depth == 0 && !first {
+			if p.cur().nl {
+				return
+			}
+			for _, stop := range stops {
+				if p.is(stop) {
+					return
+				}
+			}
+			if p.is("=>") {
+				return
+			}
+		}
+		switch {
+		case p.is("(") || p.is("[") || p.is("{") || p.is("<"):
+			depth++
+		case p.is(")") || p.is("]") || p.is("}") || p.is(">"):
+			depth--
+		case p.is(">>"), p.is(">>>"):
+			depth -= len(p.cur().value)
+		}
+		p.next()
+	}
+}
+
+func (p *syntaxParser) statement() *Syntax {
+	t := p.cur()
+	p.statementStart = p.i
+	switch {
+	case p.is("{"):
+		return p.block()
+	case p.eat(";"):
+		return p.node("EmptyStatement", t)
+	case p.is("var") || p.is("let") || p.is("const"):
+		return p.declarationStatement()
+	case p.is("function"), p.is("async") && isWord(p.peek(1), "function") && !p.peek(1).nl:
+		return p.function("FunctionDeclaration")
+	case p.is("class"):
+		return p.class("ClassDeclaration")
+	case p.isRecord():
+		return p.record()
+	case p.eat("if"):
+		s := p.node("IfStatement", t, p.condition(), p.statement())
+		if p.eat("else") {
+			s.Children = append(s.Children, p.statement())
+		}
+		return s
+	case p.is("for"):
+		return p.forStatement()
+	case p.eat("while"):
+		return p.node("WhileStatement", t, p.condition(), p.statement())
+	case p.eat("do"):
+		body := p.statement()
+		p.expect("while")
+		s := p.node("DoWhileStatement", t, body, p.condition())
+		p.eat(";")
+		return s
+	case p.eat("return"), p.eat("throw"):
+		kind := map[string]string{"return": "ReturnStatement", "throw": "ThrowStatement"}[t.value]
+		s := p.node(kind, t)
+		if !p.is(";") && !p.is("}") && !p.atEnd() && !p.cur().nl {
+			s.Children = append(s.Children, p.expression(false))
+		} else if t.value == "throw" {
+			p.failAt(t, CodeMissingExpression, "%s is missing what it throws", p.describe(t))
+		}
+		p.semicolon()
+		return s
+	case p.eat("break"), p.eat("continue"):
+		kind := map[string]string{"break": "BreakStatement", "continue": "ContinueStatement"}[t.value]
+		s := p.node(kind, t)
+		if p.isBindingIdent() && !p.cur().nl {
+			s.Label = p.next().value
+		}
+		p.semicolon()
+		return s
+	case p.is("try"):
+		return p.tryStatement()
+	case p.is("switch"):
+		return p.switchStatement()
+	case p.is("import") && !p.nextIs("(", "."):
+		return p.importDeclaration()
+	case p.is("export"):
+		return p.exportDeclaration()
+	case p.eat("debugger"):
+		p.semicolon()
+		return p.node("DebuggerStatement", t)
+	case p.isBindingIdent() && p.nextIs(":"):
+		p.next()
+		p.next()
+		s := p.node("LabeledStatement", t, p.statement())
+		s.Label = t.value
+		return s
+	case p.isBindingIdent() && p.nextIs("=") && isWord(p.peek(2), "switch"):
+		// name = 🎪 (subject) { ... }
+		target := p.bindingIdent()
+		p.next()
+		x := p.switchExpression("", target.Label)
+		p.semicolon()
+		p.addSugar(t.first, x)
+		return p.node("ExpressionStatement", t, nodeAt("AssignmentExpression", "=", target, target, x.node))
+	}
+
+	s := p.node("ExpressionStatement", t, p.expression(false))
+	p.semicolon()
+	return s
+}
+
+// condition reads the parenthesized condition of an if or a loop
+func (p *syntaxParser) condition() *Syntax {
+	p.expect("(")
+	x := p.expression(false)
+	p.expect(")")
+	return x
+}
+
+func (p *syntaxParser) block() *Syntax {
+	open := p.expect("{")
+	b := p.node("BlockStatement", open)
+	for !p.is("}") {
+		if p.atEnd() {
+			p.unexpected("expected '}' but found %s", p.describe(p.cur()))
+		}
+		if s := p.recoverStatement(); s != nil {
+			b.Children = append(b.Children, s)
+		}
+	}
+	p.next()
+	return b
+}
+
+// declarationStatement reads a var, let or const statement, which may
+// declare a variable whose value is a switch expression
+func (p *syntaxParser) declarationStatement() *Syntax {
+	t := p.cur()
+	if isWord(p.peek(2), "=") && isWord(p.peek(3), "switch") && p.bindingAt(p.i+1) {
+		p.next()
+		target := p.bindingIdent()
+		p.next()
+		x := p.switchExpression(t.value, target.Label)
+		p.semicolon()
+		p.addSugar(t.first, x)
+		d := p.node("VariableDeclaration", t, nodeAt("VariableDeclarator", "", target, target, x.node))
+		d.Label = t.value
+		return d
+	}
+	d := p.declaration(false)
+	p.semicolon()
+	return d
+}
+
+// declaration reads the declarators of a var, let or const
+func (p *syntaxParser) declaration(noIn bool) *Syntax {
+	t := p.next()
+	d := p.node("VariableDeclaration", t)
+	d.Label = t.value
+	for {
+		target := p.bindingTarget()
+		declarator := nodeAt("VariableDeclarator", "", target, target)
+		if p.is(":") {
+			p.skipType("=", ",", ";", ")")
+		}
+		switch {
+		case p.is("="):
+			eq := p.next()
+			if p.is("switch") {
+				p.switchMisplaced()
+			}
+			p.operand(eq, "%s is missing the value it assigns")
+			declarator.Children = append(declarator.Children, p.assignment(noIn))
+		case p.is("of") || p.is("in"):
+		case target.Kind != "Identifier":
+			p.failAt(t, CodeMissingExpression, "%s is missing the value its pattern destructures", p.describe(t))
+		case t.value == "const":
+			p.failAt(t, CodeMissingExpression, "%s declares %s without a value", p.describe(t), quote(target.Label))
+		}
+		d.Children = append(d.Children, declarator)
+		if !p.eat(",") {
+			return d
+		}
+	}
+}
+
+// bindingTarget reads a name or a destructuring pattern
+func (p *syntaxParser) bindingTarget() *Syntax {
+	t := p.cur()
+	switch {
+	case p.eat("["):
+		pattern := p.node("ArrayPattern", t)
+		for !p.eat("]") {
+			switch {
+			case p.is(","):
+			case p.is("..."):
+				p.next()
+				pattern.Children = append(pattern.Children, wrap("RestElement", p.bindingTarget()))
+			default:
+				pattern.Children = append(pattern.Children, p.patternDefault(p.bindingTarget()))
+			}
+			p.separator("]")
+		}
+		return pattern
+	case p.eat("{"):
+		pattern := p.node("ObjectPattern", t)
+		for !p.eat("}") {
+			if p.eat("...") {
+				pattern.Children = append(pattern.Children, wrap("RestElement", p.bindingIdent()))
+				p.separator("}")
+				continue
+			}
+			shorthand := p.isBindingIdent()
+			key := p.propertyKey()
+			value := key
+			if p.eat(":") {
+				value = p.bindingTarget()
+			} else if !shorthand {
+				p.unexpected("expected ':' but found %s", p.describe(p.cur()))
+			}
+			pattern.Children = append(pattern.Children, nodeAt("Property", "", key, key, p.patternDefault(value)))
+			p.separator("}")
+		}
+		return pattern
+	}
+	return p.bindingIdent()
+}
+
+// patternDefault reads the default value of a target in a pattern or a
+// parameter list, if it has one
+func (p *syntaxParser) patternDefault(target *Syntax) *Syntax {
+	if !p.is("=") {
+		return target
+	}
+	eq := p.next()
+	p.operand(eq, "%s is missing the default value")
+	return nodeAt("AssignmentPattern", "", target, target, p.assignment(false))
+}
+
+// propertyKey reads the name of a property or class member: a name, a
+// string, a number, a computed [key] or a #private name
+func (p *syntaxParser) propertyKey() *Syntax {
+	t := p.cur()
+	switch {
+	case t.kind == TokenString || t.kind == TokenNumber:
+		p.next()
+		n := p.node("Literal", t)
+		n.Label = t.value
+		return n
+	case t.kind == TokenIdent || t.kind == TokenEmoji:
+		p.next()
+		n := p.node("Identifier", t)
+		n.Label = t.value
+		return n
+	case p.eat("["):
+		x := p.assignment(false)
+		p.expect("]")
+		return x
+	case p.eat("#"):
+		name := p.propertyName()
+		n := p.node("PrivateIdentifier", t)
+		n.Label = "#" + name
+		return n
+	}
+	p.unexpected("expected a property name but found %s", p.describe(t))
+	return nil
+}
+
+// propertyName reads a name after '.', which may be any word
+func (p *syntaxParser) propertyName() string {
+	t := p.cur()
+	if p.is("#") {
+		p.next()
+		return "#" + p.propertyName()
+	}
+	if t.kind != TokenIdent && t.kind != TokenEmoji {
+		prev := p.toks[p.i-1]
+		p.failAt(prev, CodeMissingExpression, "%s is missing the name that follows it", p.describe(prev))
+	}
+	p.next()
+	return t.value
+}
+
+func (p *syntaxParser) forStatement() *Syntax {
+	t := p.expect("for")
+	s := p.node("ForStatement", t)
+	if p.eat("await") {
+		s.Label = "await"
+	}
+	p.expect("(")
+	var init, test, update *Syntax
+	switch {
+	case p.is(";"):
+	case p.is("var") || p.is("let") || p.is("const"):
+		init = p.declaration(true)
+		if (p.is("of") || p.is("in")) && len(init.Children) == 1 && len(init.Children[0].Children) == 1 {
+			return p.forInOf(s, init)
+		}
+	default:
+		start := p.i
+		init = p.expression(true)
+		if p.is("of") || p.is("in") {
+			p.checkTarget(init, start, true)
+			return p.forInOf(s, init)
+		}
+	}
+	p.expect(";")
+	if !p.is(";") {
+		test = p.expression(false)
+	}
+	p.expect(";")
+	if !p.is(")") {
+		update = p.expression(false)
+	}
+	p.expect(")")
+	label := s.Label
+	s = p.node("ForStatement", t, init, test, update, p.statement())
+	s.Label = label
+	return s
+}
+
+func (p *syntaxParser) forInOf(s, left *Syntax) *Syntax {
+	op := p.next()
+	s.Kind = map[string]string{"of": "ForOfStatement", "in": "ForInStatement"}[op.value]
+	p.operand(op, "%s is missing what it loops over")
+	var right *Syntax
+	if op.value == "of" {
+		right = p.assignment(false)
+	} else {
+		right = p.expression(false)
+	}
+	p.expect(")")
+	s.Children = append(s.Children, left, right, p.statement())
+	return s
+}
+
+func (p *syntaxParser) tryStatement() *Syntax {
+	t := p.expect("try")
+	s := p.node("TryStatement", t, p.block())
+	if c := p.cur(); p.eat("catch") {
+		handler := p.node("CatchClause", c)
+		if p.eat("(") {
+			handler.Children = append(handler.Children, p.bindingTarget())
+			if p.is(":") {
+				p.skipType(")")
+			}
+			p.expect(")")
+		}
+		handler.Children = append(handler.Children, p.block())
+		s.Children = append(s.Children, handler)
+	}
+	if p.eat("finally") {
+		s.Children = append(s.Children, p.block())
+	}
+	if len(s.Children) == 1 {
+		p.unexpected("expected %s or %s after %s but found %s", spell("catch"), spell("finally"), p.describe(t), p.describe(p.cur()))
+	}
+	return s
+}
+
+func (p *syntaxParser) switchStatement() *Syntax {
+	t := p.expect("switch")
+	s := p.node("SwitchStatement", t, p.condition())
+	p.expect("{")
+	for !p.eat("}") {
+		c := p.node("SwitchCase", p.cur())
+		if !p.eat("default") {
+			p.expect("case")
+			p.operand(p.toks[p.i-1], "%s is missing the value it matches")
+			c.Children = append(c.Children, p.expression(false))
+		}
+		if p.is("=>") {
+			p.unexpected("%s arms belong in a switch expression, a variable's value as in 📦 size = 🎪 (n) { … }; a switch statement's cases end in ':'", spell("=>"))
+		}
+		p.expect(":")
+		for !p.is("case") && !p.is("default") && !p.is("}") {
+			if p.atEnd() {
+				p.unexpected("expected '}' but found %s", p.describe(p.cur()))
+			}
+			if statement := p.recoverStatement(); statement != nil {
+				c.Children = append(c.Children, statement)
+			}
+		}
+		s.Children = append(s.Children, c)
+	}
+	return s
+}
+
+// switchParts is a switch expression as read, with the ranges of tokens
+// generation writes it from
+type switchParts struct {
+	node          *Syntax
+	keyword, name string
+	// subject and the arms' values and results are ranges of tokens,
+	// first and last
+	subject [2]int
+	arms    []switchArmParts
+	// last is the index of its last token, the '}' or a ';' after it
+	last int
+}
+
+type switchArmParts struct {
+	value, result [2]int
+	isDefault     bool
+}
+
+// switchExpression reads a switch expression, the value of a variable
+// declared with keyword or of an assignment to name: 🎪 (subject) { 🔘
+// value ➡️ result ... }, with _ as the value of the default arm
+func (p *syntaxParser) switchExpression(keyword, name string) *switchParts {
+	t := p.expect("switch")
+	x := &switchParts{node: p.node("SwitchExpression", t), keyword: keyword, name: name}
+	p.expect("(")
+	start := p.i
+	subject := p.expression(false)
+	x.subject = p.span(start)
+	p.expect(")")
+	p.expect("{")
+	x.node.Children = append(x.node.Children, subject)
+	for !p.eat("}") {
+		arm := p.node("SwitchArm", p.cur())
+		parts := switchArmParts{}
+		p.expect("case")
+		if p.is("_") {
+			p.next()
+			arm.Label, parts.isDefault = "default", true
+		} else {
+			p.operand(p.toks[p.i-1], "%s is missing the value it matches")
+			start = p.i
+			arm.Children = append(arm.Children, p.conditional(false))
+			parts.value = p.span(start)
+		}
+		arrow := p.expect("=>")
+		p.operand(arrow, "%s is missing the arm's result")
+		start = p.i
+		arm.Children = append(arm.Children, p.assignment(false))
+		parts.result = p.span(start)
+		if !p.eat(",") {
+			p.eat(";")
+		}
+		x.node.Children = append(x.node.Children, arm)
+		x.arms = append(x.arms, parts)
+	}
+	x.last = p.toks[p.i-1].last
+	if p.is(";") {
+		x.last = p.cur().last
+	}
+	return x
+}
+
+// switchMisplaced fails at a switch written as an expression anywhere
+// but as a variable's value
+func (p *syntaxParser) switchMisplaced() {
+	p.unexpected("a %s switch expression can only be a variable's value, as in 📦 size = 🎪 (n) { … }", p.describe(p.cur()))
+}
+
+// span returns the range of tokens read since start, first and last
+func (p *syntaxParser) span(start int) [2]int {
+	return [2]int{p.toks[start].first, p.toks[p.i-1].last}
+}
+
+// addSugar records the switch expression x, starting at first, for
+// generation
+func (p *syntaxParser) addSugar(first int, x *switchParts) {
+	last := max(x.last, p.toks[p.i-1].last)
+	p.sugar[first] = &sugar{last: last, render: func(n *Program, targetLang, indent string) string {
+		arms := make([]SwitchArm, len(x.arms))
+		for i, arm := range x.arms {
+			arms[i] = SwitchArm{Result: n.text(arm.result, targetLang), Default: arm.isDefault}
+			if !arm.isDefault {
+				arms[i].Value = n.text(arm.value, targetLang)
+			}
+		}
+		return RenderSwitchExpression(x.keyword, x.name, n.text(x.subject, targetLang), arms, targetLang, indent)
+	}}
+}
+
+// isRecord reports whether a record declaration starts at the current
+// token: 🧱 Name( on one line
+func (p *syntaxParser) isRecord() bool {
+	t, name, open := p.cur(), p.peek(1), p.peek(2)
+	return t.kind == TokenEmoji && t.value == "🧱" && name.kind == TokenIdent && !name.nl && isWord(open, "(") && !open.nl
+}
+
+// record reads a record declaration, 🧱 Point(x: number, y: number)
+func (p *syntaxParser) record() *Syntax {
+	t := p.next()
+	name := p.bindingIdent()
+	r := p.node("RecordDeclaration", t)
+	r.Label = name.Label
+	p.expect("(")
+	var fields []RecordField
+	for !p.eat(")") {
+		field := p.bindingIdent()
+		f := RecordField{Name: field.Label}
+		if p.is(":") {
+			start := p.i + 1
+			p.skipType(",", ")")
+			f.Type = strings.TrimSpace(p.sourceText(p.span(start)))
+		}
+		r.Children = append(r.Children, field)
+		fields = append(fields, f)
+		p.separator(")")
+	}
+	p.semicolon()
+	p.sugar[t.first] = &sugar{last: p.toks[p.i-1].last, render: func(n *Program, targetLang, indent string) string {
+		return RenderRecord(r.Label, fields, targetLang, indent)
+	}}
+	return r
+}
+
+// sourceText returns the source of a range of tokens as written
+func (p *syntaxParser) sourceText(span [2]int) string {
+	b := &strings.Builder{}
+	for _, token := range p.source[span[0] : span[1]+1] {
+		b.WriteString(token.Text)
+	}
+	return b.String()
+}
+
+func (p *syntaxParser) importDeclaration() *Syntax {
+	t := p.expect("import")
+	d := p.node("ImportDeclaration", t)
+	if p.cur().kind != TokenString {
+		if p.isBindingIdent() {
+			d.Children = append(d.Children, wrap("ImportDefaultSpecifier", p.bindingIdent()))
+			if !p.eat(",") {
+				p.expectFrom()
+				return d
+			}
+		}
+		switch {
+		case p.eat("*"):
+			p.expect("as")
+			d.Children = append(d.Children, wrap("ImportNamespaceSpecifier", p.bindingIdent()))
+		case p.eat("{"):
+			for !p.eat("}") {
+				imported := p.moduleName()
+				local := imported
+				if p.eat("as") {
+					local = p.bindingIdent()
+				}
+				d.Children = append(d.Children, nodeAt("ImportSpecifier", "", imported, imported, local))
+				p.separator("}")
+			}
+		default:
+			p.unexpected("expected what to import but found %s", p.describe(p.cur()))
+		}
+		p.expectFrom()
+		return d
+	}
+	p.moduleSource()
+	p.semicolon()
+	return d
+}
+
+// expectFrom reads the end of an import or export that names its module:
+// from "module"
+func (p *syntaxParser) expectFrom() {
+	p.expect("from")
+	p.moduleSource()
+	p.semicolon()
+}
+
+// moduleSource reads the string naming a module, and its attributes
+func (p *syntaxParser) moduleSource() {
+	if p.cur().kind != TokenString {
+		p.unexpected("expected the module's name as a string but found %s", p.describe(p.cur()))
+	}
+	p.next()
+	if (p.is("with") || p.is("assert")) && !p.cur().nl {
+		p.next()
+		p.objectLiteral()
+	}
+}
+
+// moduleName reads a name imported or exported, which may be any word or
+// a string
+func (p *syntaxParser) moduleName() *Syntax {
+	t := p.cur()
+	if t.kind != TokenIdent && t.kind != TokenString && t.kind != TokenEmoji {
+		p.unexpected("expected a name but found %s", p.describe(t))
+	}
+	p.next()
+	n := p.node("Identifier", t)
+	n.Label = t.value
+	return n
+}
+
+func (p *syntaxParser) exportDeclaration() *Syntax {
+	t := p.expect("export")
+	d := p.node("ExportNamedDeclaration", t)
+	switch {
+	case p.eat("default"):
+		d.Kind = "ExportDefaultDeclaration"
+		switch {
+		case p.is("function"), p.is("async") && isWord(p.peek(1), "function"):
+			d.Children = append(d.Children, p.function("FunctionDeclaration"))
+		case p.is("class"):
+			d.Children = append(d.Children, p.class("ClassDeclaration"))
+		default:
+			p.operand(p.toks[p.i-1], "%s is missing what it exports")
+			d.Children = append(d.Children, p.assignment(false))
+			p.semicolon()
+		}
+	case p.eat("*"):
+		d.Kind = "ExportAllDeclaration"
+		if p.eat("as") {
+			d.Children = append(d.Children, p.moduleName())
+		}
+		p.expectFrom()
+	case p.eat("{"):
+		for !p.eat("}") {
+			local := p.moduleName()
+			exported := local
+			if p.eat("as") {
+				exported = p.moduleName()
+			}
+			d.Children = append(d.Children, nodeAt("ExportSpecifier", "", local, local, exported))
+			p.separator("}")
+		}
+		if p.is("from") {
+			p.expectFrom()
+		} else {
+			p.semicolon()
+		}
+	case p.is("var") || p.is("let") || p.is("const") || p.is("function") || p.is("async") || p.is("class") || p.isRecord():
+		d.Children = append(d.Children, p.statement())
+	default:
+		p.unexpected("expected what to export but found %s", p.describe(p.cur()))
+	}
+	return d
+}
+
+// function reads a function declaration or expression
+func (p *syntaxParser) function(kind string) *Syntax {
+	t := p.cur()
+	fn := p.node(kind, t)
+	if p.eat("async") {
+		fn.Label = "async "
+	}
+	p.expect("function")
+	if p.eat("*") {
+		fn.Label += "*"
+	}
+	if p.isBindingIdent() {
+		fn.Label += p.next().value
+	}
+	p.functionRest(fn)
+	return fn
+}
+
+// functionRest reads a function's parameters and body into fn
+func (p *syntaxParser) functionRest(fn *Syntax) {
+	fn.Children = append(fn.Children, p.params()...)
+	if p.is(":") {
+		p.skipType("{")
+	}
+	fn.Children = append(fn.Children, p.block())
+}
+
+func (p *syntaxParser) params() []*Syntax {
+	p.expect("(")
+	var params []*Syntax
+	for !p.eat(")") {
+		if p.eat("...") {
+			params = append(params, wrap("RestElement", p.bindingTarget()))
+		} else {
+			target := p.bindingTarget()
+			p.eat("?")
+			if p.is(":") {
+				p.skipType(",", ")", "=")
+			}
+			params = append(params, p.patternDefault(target))
+		}
+		p.separator(")")
+	}
+	return params
+}
+
+// class reads a class declaration or expression. In its body,
+// 🎭.name 🧲 declares a getter: 🎭.name 🧲 { body }, or 🎭.name 🧲 value
+// for one that returns value.
+func (p *syntaxParser) class(kind string) *Syntax {
+	t := p.expect("class")
+	c := p.node(kind, t)
+	if p.isBindingIdent() && !p.is("extends") {
+		c.Label = p.next().value
+	}
+	if e := p.cur(); p.eat("extends") {
+		p.operand(e, "%s is missing the class it extends")
+		c.Children = append(c.Children, p.callMember(true))
+	}
+	body := p.node("ClassBody", p.expect("{"))
+	for !p.eat("}") {
+		if p.atEnd() {
+			p.unexpected("expected '}' but found %s", p.describe(p.cur()))
+		}
+		if p.eat(";") {
+			continue
+		}
+		body.Children = append(body.Children, p.classMember())
+	}
+	c.Children = append(c.Children, body)
+	return c
+}
+
+func (p *syntaxParser) classMember() *Syntax {
+	t := p.cur()
+	if p.is("this") && p.nextIs(".") && p.peek(2).kind == TokenIdent && p.peek(3).kind == TokenEmoji && p.peek(3).value == "🧲" {
+		return p.getter()
+	}
+	m := p.node("MethodDefinition", t)
+	if p.is("static") && !p.nextIs("(", "=", ";", "}") {
+		p.next()
+		if p.is("{") {
+			return p.node("StaticBlock", t, p.block())
+		}
+		m.Label = "static "
+	}
+	if (p.is("get") || p.is("set")) && !p.nextIs("(", "=", ";", "}") {
+		m.Label += p.next().value + " "
+	}
+	if p.is("async") && !p.nextIs("(", "=", ";", "}") && !p.peek(1).nl {
+		m.Label += p.next().value + " "
+	}
+	if p.eat("*") {
+		m.Label += "*"
+	}
+	key := p.propertyKey()
+	m.Label += key.Label
+	if p.is("(") {
+		fn := p.node("FunctionExpression", p.cur())
+		p.functionRest(fn)
+		m.Children = append(m.Children, key, fn)
+		return m
+	}
+	m.Kind = "PropertyDefinition"
+	m.Children = append(m.Children, key)
+	if p.is("?") || p.is("!") {
+		p.next()
+	}
+	if p.is(":") {
+		p.skipType("=", ";", "}")
+	}
+	if eq := p.cur(); p.eat("=") {
+		p.operand(eq, "%s is missing the value it assigns")
+		m.Children = append(m.Children, p.assignment(false))
+	}
+	p.semicolon()
+	return m
+}
+
+// getter reads the 🧲 getter sugar of a class body
+func (p *syntaxParser) getter() *Syntax {
+	t := p.next()
+	p.next()
+	name := p.next().value
+	magnet := p.next()
+	m := p.node("MethodDefinition", t)
+	m.Label = "get " + name
+	if p.is("{") {
+		last := p.cur().first - 1
+		fn := p.node("FunctionExpression", p.cur(), p.block())
+		m.Children = append(m.Children, fn)
+		p.sugar[t.first] = &sugar{last: last, render: func(*Program, string, string) string {
+			return "get " + name + "() "
+		}}
+		return m
+	}
+	p.operand(magnet, "%s is missing the value it gets")
+	start := p.i
+	value := p.assignment(false)
+	span := p.span(start)
+	p.semicolon()
+	m.Children = append(m.Children, nodeAt("FunctionExpression", "", value, value))
+	p.sugar[t.first] = &sugar{last: p.toks[p.i-1].last, render: func(n *Program, targetLang, _ string) string {
+		return "get " + name + "() { return " + n.text(span, targetLang) + "; }"
+	}}
+	return m
+}
+
+func (p *syntaxParser) expression(noIn bool) *Syntax {
+	x := p.assignment(noIn)
+	if !p.is(",") {
+		return x
+	}
+	sequence := nodeAt("SequenceExpression", "", x, x)
+	for p.is(",") {
+		comma := p.next()
+		p.operand(comma, "%s is missing the expression after it")
+		sequence.Children = append(sequence.Children, p.assignment(noIn))
+	}
+	return sequence
+}
+
+// isAssignment reports whether op is an assignment operator
+func isAssignment(op syntaxToken) bool {
+	binding, ok := operatorBindings[op.value]
+	return op.kind == TokenPunct && ok && binding.precedence == 2 && op.value != "=>"
+}
+
+func (p *syntaxParser) assignment(noIn bool) *Syntax {
+	if p.arrowAhead(p.i) {
+		return p.arrow(noIn)
+	}
+	if p.is("async") && !p.peek(1).nl && p.arrowAhead(p.i+1) {
+		p.next()
+		return p.arrow(noIn)
+	}
+	if t := p.cur(); p.is("yield") && !p.peek(1).nl && (p.nextIs("*") || p.startsExpression(p.i+1)) {
+		p.next()
+		y := p.node("YieldExpression", t)
+		if p.eat("*") {
+			y.Label = "*"
+		}
+		y.Children = append(y.Children, p.assignment(noIn))
+		return y
+	}
+	if p.is("switch") {
+		p.switchMisplaced()
+	}
+
+	start := p.i
+	left := p.conditional(noIn)
+	op := p.cur()
+	if !isAssignment(op) {
+		return left
+	}
+	p.checkTarget(left, start, op.value == "=")
+	p.next()
+	p.operand(op, "%s is missing its right operand")
+	if p.is("switch") {
+		p.switchMisplaced()
+	}
+	return nodeAt("AssignmentExpression", op.value, left, left, p.assignment(noIn))
+}
+
+// checkTarget fails unless x, read from the token at start, can be
+// assigned to: a name or a property, or with pattern an array or object
+// to destructure into
+func (p *syntaxParser) checkTarget(x *Syntax, start int, pattern bool) {
+	if assignable(x, pattern) {
+		return
+	}
+	first, last := p.toks[start], p.toks[p.i-1]
+	line, column := p.position(first)
+	text := p.sourceText([2]int{first.first, last.last})
+	length := 1
+	if !strings.Contains(text, "\n") {
+		length = utf8.RuneCountInString(text)
+	}
+	panic(&SyntaxError{Line: line, Column: column, Message: fmt.Sprintf("can't assign to %s", quote(text)), Length: length, Code: CodeInvalidAssignment})
+}
+
+// assignable reports whether x can be assigned to, and with pattern
+// whether it can be destructured into
+func assignable(x *Syntax, pattern bool) bool {
+	switch x.Kind {
+	case "Identifier":
+		return true
+	case "MemberExpression":
+		return !optionalChain(x)
+	case "ArrayExpression":
+		for _, element := range x.Children {
+			if element.Kind == "SpreadElement" || element.Kind == "AssignmentExpression" && element.Label == "=" {
+				element = element.Children[0]
+			}
+			if !assignable(element, true) {
+				return false
+			}
+		}
+		return pattern
+	case "ObjectExpression":
+		for _, property := range x.Children {
+			value := property.Children[len(property.Children)-1]
+			if property.Kind == "Property" && property.Label != "" {
+				return false
+			}
+			if value.Kind == "AssignmentExpression" && value.Label == "=" {
+				value = value.Children[0]
+			}
+			if !assignable(value, true) {
+				return false
+			}
+		}
+		return pattern
+	}
+	return false
+}
+
+// optionalChain reports whether a member access or call reads through
+// ?.
+func optionalChain(x *Syntax) bool {
+	for ; x.Kind == "MemberExpression" || x.Kind == "CallExpression"; x = x.Children[0] {
+		if strings.HasPrefix(x.Label, "?.") {
+			return true
+		}
+	}
+	return false
+}
+
+// arrowAhead reports whether the tokens from i start an arrow function's
+// parameters
+func (p *syntaxParser) arrowAhead(i int) bool {
+	if i >= len(p.toks)-1 {
+		return false
+	}
+	if p.bindingAt(i) {
+		next := p.toks[i+1]
+		return isWord(next, "=>") && !next.nl
+	}
+	open := p.toks[i]
+	if !isWord(open, "(") {
+		return false
+	}
+	for j := i + 1; j < len(p.toks)-1; j++ {
+		t := p.toks[j]
+		if t.depth < open.depth {
+			return false
+		}
+		if t.depth > open.depth || !isWord(t, ")") {
+			continue
+		}
+		next := p.toks[j+1]
+		if isWord(next, ":") {
+			// a return type annotation: look for => before the body
+			for k := j + 2; k < len(p.toks)-1; k++ {
+				if t := p.toks[k]; isWord(t, "=>") || isWord(t, ";") || isWord(t, "{") {
+					return isWord(t, "=>")
+				}
+			}
+			return false
+		}
+		return isWord(next, "=>") && !next.nl
+	}
+	return false
+}
+
+func (p *syntaxParser) arrow(noIn bool) *Syntax {
+	fn := p.node("ArrowFunctionExpression", p.cur())
+	if p.is("(") {
+		fn.Children = p.params()
+		if p.is(":") {
+			p.skipType("=>")
+		}
+	} else {
+		fn.Children = []*Syntax{p.bindingIdent()}
+	}
+	arrow := p.expect("=>")
+	if p.is("{") {
+		fn.Children = append(fn.Children, p.block())
+		return fn
+	}
+	p.operand(arrow, "%s is missing the function's body")
+	fn.Children = append(fn.Children, p.assignment(noIn))
+	return fn
+}
+
+func (p *syntaxParser) conditional(noIn bool) *Syntax {
+	test := p.binary(0, noIn)
+	if !p.is("?") {
+		return test
+	}
+	q := p.next()
+	p.operand(q, "%s is missing the value when the condition holds")
+	consequent := p.assignment(false)
+	colon := p.expect(":")
+	p.operand(colon, "%s is missing the value when the condition doesn't hold")
+	return nodeAt("ConditionalExpression", "", test, test, consequent, p.assignment(noIn))
+}
+
+// binary reads the binary operators binding tighter than min by
+// precedence climbing over the precedence table
+func (p *syntaxParser) binary(min int, noIn bool) *Syntax {
+	left := p.unary()
+	for {
+		op := p.cur()
+		binding, ok := operatorBindings[op.value]
+		if op.kind != TokenPunct && op.kind != TokenIdent || !ok || binding.unary || binding.precedence <= 2 || binding.precedence <= min || noIn && op.value == "in" {
+			return left
+		}
+		p.next()
+		p.operand(op, "%s is missing its right operand")
+		next := binding.precedence
+		if binding.right {
+			next--
+		}
+		kind := "BinaryExpression"
+		if op.value == "&&" || op.value == "||" || op.value == "??" {
+			kind = "LogicalExpression"
+		}
+		left = nodeAt(kind, op.value, left, left, p.binary(next, noIn))
+	}
+}
+
+func (p *syntaxParser) unary() *Syntax {
+	t := p.cur()
+	if t.kind == TokenPunct || t.kind == TokenIdent {
+		switch t.value {
+		case "!", "-", "+", "~", "typeof", "void", "delete":
+			p.next()
+			p.operand(t, "%s is missing its operand")
+			x := p.node("UnaryExpression", t, p.unary())
+			x.Label = t.value
+			return x
+		case "++", "--":
+			p.next()
+			p.operand(t, "%s is missing its operand")
+			start := p.i
+			operand := p.unary()
+			p.checkUpdate(operand, start)
+			x := p.node("UpdateExpression", t, operand)
+			x.Label = t.value
+			return x
+		case "await":
+			if p.startsExpression(p.i + 1) {
+				p.next()
+				return p.node("AwaitExpression", t, p.unary())
+			}
+		}
+	}
+
+	start := p.i
+	x := p.callMember(true)
+	if (p.is("++") || p.is("--")) && !p.cur().nl {
+		p.checkUpdate(x, start)
+		return nodeAt("UpdateExpression", p.next().value, x, x)
+	}
+	return x
+}
+
+// checkUpdate fails unless x, read from the token at start, can be
+// incremented or decremented
+func (p *syntaxParser) checkUpdate(x *Syntax, start int) {
+	p.checkTarget(x, start, false)
+}
+
+// callMember reads member accesses, tagged templates and, with calls,
+// calls
+func (p *syntaxParser) callMember(calls bool) *Syntax {
+	var x *Syntax
+	if p.is("new") {
+		x = p.newExpression()
+	} else {
+		x = p.primary()
+	}
+	for {
+		t := p.cur()
+		switch {
+		case p.eat("."):
+			x = nodeAt("MemberExpression", "."+p.propertyName(), x, x)
+		case p.eat("?."):
+			switch {
+			case p.is("("):
+				x = nodeAt("CallExpression", "?.", x, append([]*Syntax{x}, p.arguments()...)...)
+			case p.eat("["):
+				x = nodeAt("MemberExpression", "?.[]", x, x, p.expression(false))
+				p.expect("]")
+			default:
+				x = nodeAt("MemberExpression", "?."+p.propertyName(), x, x)
+			}
+		case p.eat("["):
+			x = nodeAt("MemberExpression", "[]", x, x, p.expression(false))
+			p.expect("]")
+		case calls && p.is("("):
+			x = nodeAt("CallExpression", "", x, append([]*Syntax{x}, p.arguments()...)...)
+		case t.kind == TokenTemplate && !strings.HasPrefix(p.source[t.first].Text, "}"):
+			x = nodeAt("TaggedTemplateExpression", "", x, x, p.template())
+		default:
+			return x
+		}
+	}
+}
+
+func (p *syntaxParser) newExpression() *Syntax {
+	t := p.expect("new")
+	if p.eat(".") {
+		n := p.node("MetaProperty", t)
+		n.Label = "new." + p.propertyName()
+		return n
+	}
+	p.operand(t, "%s is missing the class it constructs")
+	n := p.node("NewExpression", t, p.callMember(false))
+	if p.is("(") {
+		n.Children = append(n.Children, p.arguments()...)
+	}
+	return n
+}
+
+func (p *syntaxParser) arguments() []*Syntax {
+	p.expect("(")
+	var args []*Syntax
+	for !p.eat(")") {
+		args = append(args, p.element())
+		p.separator(")")
+	}
+	return args
+}
+
+// element reads an argument or an array element, which may be spread
+func (p *syntaxParser) element() *Syntax {
+	t := p.cur()
+	if !p.eat("...") {
+		return p.assignment(false)
+	}
+	p.operand(t, "%s is missing what it spreads")
+	return p.node("SpreadElement", t, p.assignment(false))
+}
+
+// template reads a template literal and its substitutions
+func (p *syntaxParser) template() *Syntax {
+	t := p.next()
+	n := p.node("TemplateLiteral", t)
+	for text := p.source[t.first].Text; strings.HasSuffix(text, "${"); text = p.source[p.next().first].Text {
+		n.Children = append(n.Children, p.expression(false))
+		if p.cur().kind != TokenTemplate {
+			p.unexpected("expected '}' but found %s", p.describe(p.cur()))
+		}
+	}
+	return n
+}
+
+func (p *syntaxParser) primary() *Syntax {
+	t := p.cur()
+	switch t.kind {
+	case TokenNumber, TokenString, TokenRegex:
+		p.next()
+		n := p.node("Literal", t)
+		n.Label = t.value
+		return n
+	case TokenTemplate:
+		if !strings.HasPrefix(t.value, "}") {
+			return p.template()
+		}
+	case TokenEmoji:
+		p.next()
+		n := p.node("Identifier", t)
+		n.Label = t.value
+		return n
+	case TokenIdent:
+		switch t.value {
+		case "this", "super":
+			p.next()
+			return p.node(map[string]string{"this": "ThisExpression", "super": "Super"}[t.value], t)
+		case "null", "true", "false":
+			p.next()
+			n := p.node("Literal", t)
+			n.Label = t.value
+			return n
+		case "function":
+			return p.function("FunctionExpression")
+		case "async":
+			if isWord(p.peek(1), "function") && !p.peek(1).nl {
+				return p.function("FunctionExpression")
+			}
+		case "class":
+			return p.class("ClassExpression")
+		case "new":
+			return p.newExpression()
+		case "import":
+			p.next()
+			if p.eat(".") {
+				n := p.node("MetaProperty", t)
+				n.Label = "import." + p.propertyName()
+				return n
+			}
+			if !p.is("(") {
+				p.unexpected("expected '(' but found %s", p.describe(p.cur()))
+			}
+			return p.node("ImportExpression", t, p.arguments()...)
+		case "switch":
+			p.switchMisplaced()
+		}
+		if reservedWords[t.value] {
+			break
+		}
+		p.next()
+		n := p.node("Identifier", t)
+		n.Label = t.value
+		return n
+	case TokenPunct:
+		switch {
+		case p.eat("("):
+			x := p.expression(false)
+			p.expect(")")
+			return x
+		case p.is("["):
+			array := p.node("ArrayExpression", p.next())
+			for !p.eat("]") {
+				if !p.is(",") {
+					array.Children = append(array.Children, p.element())
+				}
+				p.separator("]")
+			}
+			return array
+		case p.is("{"):
+			return p.objectLiteral()
+		case p.eat("#"):
+			n := p.node("PrivateIdentifier", t)
+			n.Label = "#" + p.propertyName()
+			return n
+		case t.value == "." && p.peek(1).kind == TokenNumber:
+			p.next()
+			n := p.node("Literal", t)
+			n.Label = "." + p.next().value
+			return n
+		}
+	}
+	p.missing()
+	return nil
+}
+
+// missing fails where an expression should start but doesn't
+func (p *syntaxParser) missing() {
+	t := p.cur()
+	if isBinaryOperator(t) {
+		p.failAt(t, CodeMissingExpression, "%s is missing its left operand", p.describe(t))
+	}
+	if p.i > p.statementStart {
+		prev := p.toks[p.i-1]
+		if prev.kind == TokenPunct && !strings.Contains(")]};", prev.value) || prev.kind == TokenIdent && regexAfterKeyword(prev.value) {
+			p.failAt(prev, CodeMissingExpression, "expected an expression after %s but found %s", p.describe(prev), p.describe(t))
+		}
+	}
+	p.unexpected("unexpected %s", p.describe(t))
+}
+
+func (p *syntaxParser) objectLiteral() *Syntax {
+	object := p.node("ObjectExpression", p.expect("{"))
+	for !p.eat("}") {
+		t := p.cur()
+		if p.is("...") {
+			object.Children = append(object.Children, p.element())
+			p.separator("}")
+			continue
+		}
+		kind := ""
+		if (p.is("get") || p.is("set")) && !p.nextIs(":", "(", ",", "}", "=") {
+			kind = p.next().value
+		}
+		if p.is("async") && !p.nextIs(":", "(", ",", "}", "=") && !p.peek(1).nl {
+			p.next()
+			kind = "method"
+		}
+		if p.eat("*") {
+			kind = "method"
+		}
+		shorthand := p.isBindingIdent() && kind == ""
+		key := p.propertyKey()
+		property := p.node("Property", t, key)
+		switch {
+		case p.is("("):
+			fn := p.node("FunctionExpression", p.cur())
+			p.functionRest(fn)
+			property.Label = kind
+			if kind == "" {
+				property.Label = "method"
+			}
+			property.Children = append(property.Children, fn)
+		case kind != "":
+			p.unexpected("expected '(' but found %s", p.describe(p.cur()))
+		case p.is(":"):
+			colon := p.next()
+			p.operand(colon, "%s is missing the property's value")
+			property.Children = append(property.Children, p.assignment(false))
+		case shorthand:
+			// only valid destructured, as the target of an assignment
+			property.Children = append(property.Children, p.patternDefault(key))
+			if last := property.Children[1]; last.Kind == "AssignmentPattern" {
+				last.Kind, last.Label = "AssignmentExpression", "="
+			}
+		default:
+			p.unexpected("expected ':' but found %s", p.describe(p.cur()))
+		}
+		object.Children = append(object.Children, property)
+		p.separator("}")
+	}
+	return object
+}
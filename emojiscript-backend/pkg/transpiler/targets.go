@@ -0,0 +1,62 @@
+package transpiler
+
+import (
+	"regexp"
+	"slices"
+	"strings"
+)
+
+// Targets are the canonical names of the languages programs can be
+// written in: the transpiler's own and those codegen generates from its
+// JavaScript. es5 is JavaScript without the syntax ES2015 added.
+var Targets = []string{"javascript", "typescript", "python", "rust", "gdscript", "es5"}
+
+// targetAliases are the other names each target goes by
+var targetAliases = map[string][]string{
+	"javascript": {"js", "node", "nodejs", "ecmascript", "es6", "esnext"},
+	"typescript": {"ts"},
+	"python":     {"py", "py3", "python3"},
+	"rust":       {"rs"},
+	"gdscript":   {"gd", "godot"},
+}
+
+// esEdition matches the ECMAScript editions from ES2015 on, which the
+// JavaScript target writes
+var esEdition = regexp.MustCompile(`^es20[1-9][0-9]$`)
+
+// ResolveTarget returns the canonical name of a target language however
+// it's written: in any case, by an alias such as js, ts, py or node, or as
+// an ECMAScript edition such as es2020. ok is false for a name it doesn't
+// know.
+func ResolveTarget(name string) (target string, ok bool) {
+	name = strings.ToLower(strings.TrimSpace(name))
+	if slices.Contains(Targets, name) {
+		return name, true
+	}
+	for target, aliases := range targetAliases {
+		if slices.Contains(aliases, name) {
+			return target, true
+		}
+	}
+	if esEdition.MatchString(name) {
+		return "javascript", true
+	}
+	return "", false
+}
+
+// DescribeTargets lists targets with their aliases, for a message naming
+// the valid values, e.g. "javascript (js, node, es2015 and later)"
+func DescribeTargets(targets []string) string {
+	described := make([]string, len(targets))
+	for i, target := range targets {
+		aliases := slices.Clone(targetAliases[target])
+		if target == "javascript" {
+			aliases = append(aliases, "es2015 and later")
+		}
+		described[i] = target
+		if len(aliases) > 0 {
+			described[i] += " (" + strings.Join(aliases, ", ") + ")"
+		}
+	}
+	return strings.Join(described, ", ")
+}
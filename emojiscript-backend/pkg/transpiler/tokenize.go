@@ -0,0 +1,225 @@
+package transpiler
+
+import (
+	"unicode"
+	"unicode/utf8"
+)
+
+// Semantic token types, beyond the emoji syntax's TokenKind names
+const (
+	SemanticTag       = "tag"
+	SemanticAttribute = "attribute"
+)
+
+// SemanticToken is a span of source for an editor to highlight. Line and
+// Column are 1-based and Length counts runes, as in Token.
+type SemanticToken struct {
+	// Type is a TokenKind name ("keyword", "string", ...), or for markup
+	// SemanticTag or SemanticAttribute
+	Type   string `json:"type"`
+	Lexeme string `json:"lexeme"`
+	Line   int    `json:"line"`
+	Column int    `json:"column"`
+	Length int    `json:"length"`
+}
+
+// Tokenize splits a program into the tokens an editor highlights, in
+// source order and without whitespace. Emoji syntax comes from the lexer,
+// so emoji in strings and comments are never keywords. Markup adds tags,
+// attribute names and attribute values (as strings), and lexes the text
+// between tags the same way, counting the emoji markup accepts as
+// keywords.
+func Tokenize(code string, markup bool) []SemanticToken {
+	if !markup {
+		return lexTokens(code, 1, 1, nil)
+	}
+	s := &markupScanner{runes: []rune(code), line: 1, column: 1}
+	s.scan()
+	return s.tokens
+}
+
+// lexTokens lexes code that starts at line and column, treating the
+// emoji in extra as keywords too
+func lexTokens(code string, line, column int, extra map[string]string) []SemanticToken {
+	lexed, _ := Lex(code)
+	tokens := make([]SemanticToken, 0, len(lexed))
+	for _, token := range lexed {
+		kind := token.Kind
+		switch {
+		case kind == TokenSpace:
+			continue
+		case kind == TokenEmoji && extra[NormalizeVariants(token.Text)] != "":
+			kind = TokenKeyword
+		}
+		t := SemanticToken{Type: kind.String(), Lexeme: token.Text, Line: line + token.Line - 1, Column: token.Column, Length: utf8.RuneCountInString(token.Text)}
+		if token.Line == 1 {
+			t.Column += column - 1
+		}
+		tokens = append(tokens, t)
+	}
+	return tokens
+}
+
+// markupScanner splits markup into tags and the text between them
+type markupScanner struct {
+	runes        []rune
+	pos          int
+	line, column int
+	tokens       []SemanticToken
+}
+
+func (s *markupScanner) scan() {
+	for s.pos < len(s.runes) {
+		switch {
+		case s.at("<!--"):
+			end := indexFrom(s.runes, s.pos+4, "-->")
+			if end < 0 {
+				s.emit(TokenComment.String(), len(s.runes))
+			} else {
+				s.emit(TokenComment.String(), end+3)
+			}
+		case s.tagStart():
+			s.tag()
+		default:
+			s.text()
+		}
+	}
+}
+
+// text lexes the code up to the next tag or markup comment
+func (s *markupScanner) text() {
+	end := s.pos + 1
+	for end < len(s.runes) {
+		saved := s.pos
+		s.pos = end
+		stop := s.at("<!--") || s.tagStart()
+		s.pos = saved
+		if stop {
+			break
+		}
+		end++
+	}
+	s.tokens = append(s.tokens, lexTokens(string(s.runes[s.pos:end]), s.line, s.column, markupEmoji)...)
+	s.advance(end)
+}
+
+// tag scans an opening or closing tag: its name, attributes and values
+func (s *markupScanner) tag() {
+	if s.at("</") {
+		s.emit(TokenPunct.String(), s.pos+2)
+	} else {
+		s.emit(TokenPunct.String(), s.pos+1)
+	}
+	s.emit(SemanticTag, s.name(s.pos, true))
+	for s.pos < len(s.runes) {
+		s.advance(s.skipSpace(s.pos))
+		switch {
+		case s.pos >= len(s.runes):
+			return
+		case s.at("/>"):
+			s.emit(TokenPunct.String(), s.pos+2)
+			return
+		case s.runes[s.pos] == '>':
+			s.emit(TokenPunct.String(), s.pos+1)
+			return
+		case s.runes[s.pos] == '=':
+			s.emit(TokenPunct.String(), s.pos+1)
+			s.advance(s.skipSpace(s.pos))
+			s.value()
+		case isMarkupNameRune(s.runes[s.pos]):
+			s.emit(SemanticAttribute, s.name(s.pos, false))
+		default:
+			// stray text inside a tag; the parser reports it
+			return
+		}
+	}
+}
+
+// value scans an attribute value, quoted or not
+func (s *markupScanner) value() {
+	if s.pos >= len(s.runes) {
+		return
+	}
+	end := s.pos
+	if quote := s.runes[s.pos]; quote == '"' || quote == '\'' {
+		end++
+		for end < len(s.runes) && s.runes[end] != quote {
+			if s.runes[end] == '\\' {
+				end++
+			}
+			end++
+		}
+		end = min(end+1, len(s.runes))
+	} else {
+		for end < len(s.runes) && !unicode.IsSpace(s.runes[end]) && s.runes[end] != '>' && !(s.runes[end] == '/' && end+1 < len(s.runes) && s.runes[end+1] == '>') {
+			end++
+		}
+	}
+	if end > s.pos {
+		s.emit(TokenString.String(), end)
+	}
+}
+
+// name returns the end of the tag or attribute name at start; tag names
+// may have a namespace, as in <ui:alert>
+func (s *markupScanner) name(start int, tag bool) int {
+	end := start
+	for end < len(s.runes) && isMarkupNameRune(s.runes[end]) {
+		end++
+	}
+	if tag && end < len(s.runes) && s.runes[end] == ':' {
+		return s.name(end+1, false)
+	}
+	return end
+}
+
+// tagStart reports whether a tag opens at the scanner's position: '<'
+// followed by a name or by "/"
+func (s *markupScanner) tagStart() bool {
+	if s.runes[s.pos] != '<' || s.pos+1 >= len(s.runes) {
+		return false
+	}
+	next := s.runes[s.pos+1]
+	return next == '/' || next < unicode.MaxASCII && unicode.IsLetter(next)
+}
+
+func (s *markupScanner) at(prefix string) bool {
+	for i, r := range []rune(prefix) {
+		if s.pos+i >= len(s.runes) || s.runes[s.pos+i] != r {
+			return false
+		}
+	}
+	return true
+}
+
+func (s *markupScanner) skipSpace(pos int) int {
+	for pos < len(s.runes) && unicode.IsSpace(s.runes[pos]) {
+		pos++
+	}
+	return pos
+}
+
+// emit adds a token running from the scanner's position to end
+func (s *markupScanner) emit(kind string, end int) {
+	if end <= s.pos {
+		return
+	}
+	text := string(s.runes[s.pos:end])
+	s.tokens = append(s.tokens, SemanticToken{Type: kind, Lexeme: text, Line: s.line, Column: s.column, Length: end - s.pos})
+	s.advance(end)
+}
+
+// advance moves to end, keeping the line and column
+func (s *markupScanner) advance(end int) {
+	for ; s.pos < end; s.pos++ {
+		if s.runes[s.pos] == '\n' {
+			s.line, s.column = s.line+1, 1
+		} else {
+			s.column++
+		}
+	}
+}
+
+func isMarkupNameRune(r rune) bool {
+	return r < unicode.MaxASCII && (unicode.IsLetter(r) || unicode.IsDigit(r)) || r == '-' || r == '_'
+}
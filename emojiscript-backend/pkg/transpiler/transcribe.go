@@ -0,0 +1,284 @@
+package transpiler
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"unicode"
+)
+
+// spokenNames are the screen-reader phrases for each keyword emoji, which
+// say what it does: the palette's spoken phrases, and those of the
+// compound operators
+var spokenNames = func() map[string]string {
+	names := map[string]string{}
+	for _, entry := range paletteTable {
+		names[entry.emoji] = entry.spoken
+	}
+	for _, compound := range compoundOperators {
+		names[compound.emoji] = compound.spoken
+	}
+	return names
+}()
+
+// spokenPunctuation names the ASCII symbols that appear in programs
+var spokenPunctuation = map[string]string{
+	"(": "open paren", ")": "close paren", "{": "open brace", "}": "close brace",
+	"[": "open bracket", "]": "close bracket", ",": "comma", ";": "semicolon",
+	".": "dot", ":": "colon", "=": "equals", "%": "percent", "+": "plus sign",
+	"-": "minus sign", "*": "asterisk", "/": "slash", "<": "less than",
+	">": "greater than", "!": "bang", "&": "ampersand", "|": "pipe",
+	"?": "question", "$": "dollar", "#": "hash", "@": "at sign", "^": "caret",
+	"~": "tilde", "\\": "backslash",
+}
+
+var (
+	// phraseToSymbol is the reverse lookup used when reading text back
+	phraseToSymbol = map[string]string{}
+	// spokenVocabulary holds every word used by a phrase, so identifiers
+	// that collide with one can be marked explicitly
+	spokenVocabulary = map[string]bool{"string": true, "identifier": true}
+	maxPhraseWords   = 1
+	emojiByLength    []string
+)
+
+func init() {
+	for symbol, phrase := range spokenNames {
+		registerPhrase(symbol, phrase)
+		emojiByLength = append(emojiByLength, symbol)
+	}
+	for symbol, phrase := range spokenPunctuation {
+		registerPhrase(symbol, phrase)
+	}
+	sort.Slice(emojiByLength, func(i, j int) bool {
+		return len(emojiByLength[i]) > len(emojiByLength[j])
+	})
+}
+
+func registerPhrase(symbol, phrase string) {
+	if other, ok := phraseToSymbol[phrase]; ok && other != symbol {
+		panic(fmt.Sprintf("transcribe: %s and %s are both read as %q", other, symbol, phrase))
+	}
+	phraseToSymbol[phrase] = symbol
+	words := strings.Fields(phrase)
+	if len(words) > maxPhraseWords {
+		maxPhraseWords = len(words)
+	}
+	for _, word := range words {
+		spokenVocabulary[word] = true
+	}
+}
+
+// SpokenName returns the screen-reader phrase for a keyword emoji
+func SpokenName(emoji string) string {
+	return spokenNames[emoji]
+}
+
+// TranscribeToText converts emoji source into a screen-reader-friendly
+// textual form, one output line per source line. In verbose mode each emoji
+// phrase is followed by the keyword it stands for; verbose output is meant
+// for listening and can't be read back with TranscribeFromText.
+func TranscribeToText(code string, verbose bool) string {
+	keywords := map[string]string{}
+	if verbose {
+		for _, entry := range paletteTable {
+			keywords[entry.emoji] = entry.keyword
+		}
+		for _, compound := range compoundOperators {
+			keywords[compound.emoji] = compound.keyword
+		}
+	}
+
+	lines := strings.Split(strings.ReplaceAll(CanonicalizeEmoji(code), "\r\n", "\n"), "\n")
+	for i, line := range lines {
+		trimmed := strings.TrimLeft(line, " \t")
+		indent := line[:len(line)-len(trimmed)]
+		words := []string{}
+
+		for pos := 0; pos < len(trimmed); {
+			rest := trimmed[pos:]
+			r := []rune(rest)[0]
+
+			switch {
+			case r == ' ' || r == '\t':
+				pos++
+
+			case r == '"' || r == '\'' || r == '`':
+				literal := scanQuoted(rest)
+				words = append(words, "string "+literal)
+				pos += len(literal)
+
+			case unicode.IsLetter(r) || r == '_' || r == '$' && len(rest) > 1 && isIdentRune([]rune(rest)[1]):
+				word := scanWhile(rest, isIdentRune)
+				pos += len(word)
+				if spokenVocabulary[strings.ToLower(word)] {
+					word = "identifier " + word
+				}
+				words = append(words, word)
+
+			case unicode.IsDigit(r):
+				number := scanWhile(rest, func(r rune) bool { return unicode.IsDigit(r) || r == '.' || r == '_' })
+				words = append(words, number)
+				pos += len(number)
+
+			default:
+				matched := false
+				for _, emoji := range emojiByLength {
+					if strings.HasPrefix(rest, emoji) {
+						phrase := spokenNames[emoji]
+						if verbose {
+							phrase = fmt.Sprintf("%s (%s)", phrase, keywords[emoji])
+						}
+						words = append(words, phrase)
+						pos += len(emoji)
+						matched = true
+						break
+					}
+				}
+				if matched {
+					continue
+				}
+				symbol := string(r)
+				if phrase, ok := spokenPunctuation[symbol]; ok {
+					words = append(words, phrase)
+				} else {
+					words = append(words, symbol)
+				}
+				pos += len(symbol)
+			}
+		}
+
+		lines[i] = indent + strings.Join(words, " ")
+	}
+
+	return strings.Join(lines, "\n")
+}
+
+// TranscribeFromText reads the textual form produced by TranscribeToText
+// back into emoji source
+func TranscribeFromText(text string) (string, error) {
+	lines := strings.Split(strings.ReplaceAll(text, "\r\n", "\n"), "\n")
+	for n, line := range lines {
+		trimmed := strings.TrimLeft(line, " \t")
+		indent := line[:len(line)-len(trimmed)]
+
+		tokens, err := splitSpokenLine(trimmed)
+		if err != nil {
+			return "", fmt.Errorf("line %d: %v", n+1, err)
+		}
+
+		symbols := []string{}
+		for i := 0; i < len(tokens); {
+			token := tokens[i]
+
+			if token == "string" && i+1 < len(tokens) && isQuoted(tokens[i+1]) {
+				symbols = append(symbols, tokens[i+1])
+				i += 2
+				continue
+			}
+			if token == "identifier" && i+1 < len(tokens) {
+				symbols = append(symbols, tokens[i+1])
+				i += 2
+				continue
+			}
+
+			matched := false
+			for size := maxPhraseWords; size >= 1; size-- {
+				if i+size > len(tokens) {
+					continue
+				}
+				if symbol, ok := phraseToSymbol[strings.ToLower(strings.Join(tokens[i:i+size], " "))]; ok {
+					symbols = append(symbols, symbol)
+					i += size
+					matched = true
+					break
+				}
+			}
+			if !matched {
+				symbols = append(symbols, token)
+				i++
+			}
+		}
+
+		lines[n] = indent + joinSymbols(symbols)
+	}
+
+	return strings.Join(lines, "\n"), nil
+}
+
+// splitSpokenLine splits a line into words, keeping quoted literals whole
+func splitSpokenLine(line string) ([]string, error) {
+	tokens := []string{}
+	for pos := 0; pos < len(line); {
+		switch ch := line[pos]; {
+		case ch == ' ' || ch == '\t':
+			pos++
+		case ch == '"' || ch == '\'' || ch == '`':
+			literal := scanQuoted(line[pos:])
+			if len(literal) < 2 || literal[len(literal)-1] != ch {
+				return nil, fmt.Errorf("unterminated string literal")
+			}
+			tokens = append(tokens, literal)
+			pos += len(literal)
+		default:
+			end := strings.IndexAny(line[pos:], " \t")
+			if end < 0 {
+				end = len(line) - pos
+			}
+			tokens = append(tokens, line[pos:pos+end])
+			pos += end
+		}
+	}
+	return tokens, nil
+}
+
+// joinSymbols lays symbols out with conventional spacing around brackets
+// and separators
+func joinSymbols(symbols []string) string {
+	b := &strings.Builder{}
+	for i, symbol := range symbols {
+		if i > 0 {
+			prev := symbols[i-1]
+			tight := prev == "(" || prev == "[" || prev == "." ||
+				symbol == ")" || symbol == "]" || symbol == "," || symbol == ";" ||
+				symbol == "." || symbol == ":" ||
+				(symbol == "(" && spokenPunctuation[prev] == "")
+			if !tight {
+				b.WriteByte(' ')
+			}
+		}
+		b.WriteString(symbol)
+	}
+	return b.String()
+}
+
+// scanQuoted returns the quoted literal at the start of s, honoring escapes
+func scanQuoted(s string) string {
+	quote := s[0]
+	for i := 1; i < len(s); i++ {
+		switch s[i] {
+		case '\\':
+			i++
+		case quote:
+			return s[:i+1]
+		}
+	}
+	return s
+}
+
+func scanWhile(s string, ok func(rune) bool) string {
+	for i, r := range s {
+		if !ok(r) {
+			return s[:i]
+		}
+	}
+	return s
+}
+
+func isIdentRune(r rune) bool {
+	return unicode.IsLetter(r) || unicode.IsDigit(r) || r == '_' || r == '$'
+}
+
+func isQuoted(token string) bool {
+	return len(token) >= 2 && strings.ContainsRune("\"'`", rune(token[0])) && token[len(token)-1] == token[0]
+}
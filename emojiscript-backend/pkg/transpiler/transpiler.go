@@ -0,0 +1,148 @@
+package transpiler
+
+// Options configures a Transpiler
+type Options struct {
+	// TargetLanguage defaults to "javascript"
+	TargetLanguage string
+	// Aliases maps a dialect's emoji to the built-in emoji for the same
+	// keyword (see dialect.Pack.ToBase); source is rewritten with them
+	// before it is transpiled (see Transpiler.ApplyAliases)
+	Aliases map[string]string
+}
+
+// MarkupOptions are the markup parser's settings for one call
+type MarkupOptions struct {
+	// Partial keeps going past errors, leaving a placeholder for each
+	Partial bool
+	// StrictTags matches tag names case-sensitively
+	StrictTags bool
+	// StrictSchema validates the whole document before generating code
+	StrictSchema bool
+	// Sanitize is the policy for dangerous patterns; "" is SanitizeRewrite
+	Sanitize SanitizePolicy
+	// ASCIIIdentifiers rejects identifiers outside ASCII
+	ASCIIIdentifiers bool
+	// RenameReserved renames reserved words used as names instead of
+	// failing (see MarkupParser.SetRenameReserved)
+	RenameReserved bool
+	// CheckOnly reports problems, warning about undefined names too,
+	// without generating output
+	CheckOnly bool
+	// Profile, when set, times the phases of the transpile
+	Profile *Profile
+}
+
+// MarkupResult is what one markup call produced. Output is set even when
+// there are errors, for partial mode.
+type MarkupResult struct {
+	Output   string
+	Errors   []string
+	Warnings []string
+	// Diagnostics are the errors and warnings with their positions
+	Diagnostics   []Diagnostic
+	Sanitizations []Sanitization
+	// Renames maps each reserved word RenameReserved renamed to its new
+	// name
+	Renames map[string]string
+	// Symbols indexes the functions and classes the markup declares
+	Symbols []Symbol
+}
+
+// Transpiler transpiles source for one target language and dialect. Its
+// configuration is fixed by New and each call keeps its own state, so a
+// Transpiler built once can serve any number of goroutines.
+type Transpiler struct {
+	targetLang string
+	// aliases is nil without a dialect; a clusterReplacer is safe for
+	// concurrent use
+	aliases *clusterReplacer
+}
+
+// New builds a Transpiler, preparing the dialect's aliases once
+func New(opts Options) *Transpiler {
+	t := &Transpiler{targetLang: opts.TargetLanguage, aliases: emojiReplacer(opts.Aliases)}
+	if t.targetLang == "" {
+		t.targetLang = "javascript"
+	}
+	return t
+}
+
+// TargetLanguage returns the language the Transpiler generates
+func (t *Transpiler) TargetLanguage() string {
+	return t.targetLang
+}
+
+// ApplyAliases rewrites the dialect's emoji in emoji syntax to the
+// built-in ones. Only emoji the lexer reads as code are rewritten, so
+// strings and comments print and read as they were written.
+func (t *Transpiler) ApplyAliases(code string) string {
+	if t.aliases == nil {
+		return code
+	}
+	return rewriteEmoji(code, func(emoji string) string {
+		return t.aliases.Replace(NormalizeVariants(emoji))
+	})
+}
+
+// applyMarkupAliases rewrites the dialect's emoji in markup, which the
+// lexer can't read; like the markup parser's own emoji (see
+// convertEmojisToKeywords), they're rewritten wherever they are
+func (t *Transpiler) applyMarkupAliases(code string) string {
+	if t.aliases == nil {
+		return code
+	}
+	return t.aliases.Replace(NormalizeVariants(code))
+}
+
+// TranspileEmoji converts plain emoji syntax written in the dialect,
+// with the definitions of the builtins it uses (see AddStdlib)
+func (t *Transpiler) TranspileEmoji(code string) string {
+	return AddStdlib(TranspileEmoji(t.ApplyAliases(code), t.targetLang), t.targetLang)
+}
+
+// CheckEmoji returns the syntax errors in plain emoji syntax written in
+// the dialect
+func (t *Transpiler) CheckEmoji(code string) []string {
+	return CheckEmoji(t.ApplyAliases(code))
+}
+
+// DiagnoseEmoji returns the syntax errors and warnings in plain emoji
+// syntax written in the dialect as diagnostics
+func (t *Transpiler) DiagnoseEmoji(code string) []Diagnostic {
+	return DiagnoseEmoji(t.ApplyAliases(code))
+}
+
+// ParseMarkup parses markup syntax written in the dialect into its tag
+// tree without transpiling it, parsing partially so a document with
+// errors still has a tree; see MarkupParser.ParseTree
+func (t *Transpiler) ParseMarkup(code string) ([]MarkupTag, []string) {
+	parser := NewMarkupParser(t.applyMarkupAliases(code), t.targetLang)
+	parser.SetPartial(true)
+	tree, _ := parser.ParseTree()
+	return tree, parser.GetErrors()
+}
+
+// TranspileMarkup parses and converts markup syntax written in the
+// dialect, with a parser of its own for the call. Like TranspileEmoji it
+// adds the definitions of the builtins the output uses.
+func (t *Transpiler) TranspileMarkup(code string, opts MarkupOptions) (MarkupResult, error) {
+	parser := NewMarkupParser(t.applyMarkupAliases(code), t.targetLang)
+	parser.SetPartial(opts.Partial)
+	parser.SetStrictTags(opts.StrictTags)
+	parser.SetStrictSchema(opts.StrictSchema)
+	parser.SetSanitizePolicy(opts.Sanitize)
+	parser.SetASCIIIdentifiers(opts.ASCIIIdentifiers)
+	parser.SetRenameReserved(opts.RenameReserved)
+	parser.SetCheckOnly(opts.CheckOnly)
+	parser.SetProfile(opts.Profile)
+	output, err := parser.Parse()
+	return MarkupResult{
+		Output:        AddStdlib(output, t.targetLang),
+		Errors:        parser.GetErrors(),
+		Warnings:      parser.GetWarnings(),
+		Diagnostics:   parser.GetDiagnostics(),
+		Sanitizations: parser.Sanitizations(),
+		Renames:       parser.GetRenames(),
+		Symbols:       parser.GetSymbols(),
+	}, err
+}
@@ -0,0 +1,26 @@
+package transpiler
+
+import (
+	"strings"
+	"testing"
+)
+
+// TestApplyAliases checks that a dialect's emoji and variant spellings
+// are rewritten where they're code, and left as written in strings,
+// templates and comments
+func TestApplyAliases(t *testing.T) {
+	tr := New(Options{Aliases: map[string]string{"🐍": "📝"}})
+	tests := []struct {
+		code, want string
+	}{
+		{`🐍("I love 🐍") // 🐍`, `console.log("I love 🐍") // 🐍`},
+		{"🐍(`🐍 ${🐍}`) /* 🐍 */", "console.log(`🐍 ${console.log}`) /* 🐍 */"},
+		{`📝("✖")`, `console.log("✖")`},
+		{`📝(2 ✖ 3, "✖")`, `console.log(2 * 3, "✖")`},
+	}
+	for _, tt := range tests {
+		if got := strings.TrimSpace(tr.TranspileEmoji(tt.code)); got != tt.want {
+			t.Errorf("TranspileEmoji(%q) = %q, want %q", tt.code, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,173 @@
+package transpiler
+
+import (
+	"path"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// RemovedExport reports an export dropped by TreeShake
+type RemovedExport struct {
+	Module string `json:"module"`
+	Name   string `json:"name"`
+	Kind   string `json:"kind"`
+	// Local is set when the declaration is still used inside its own
+	// module, so only the export keyword was dropped
+	Local bool `json:"local,omitempty"`
+}
+
+var (
+	exportDeclPattern = regexp.MustCompile(`(?m)^[ \t]*export[ \t]+(async[ \t]+function\*?|function\*?|class|const|let|var)[ \t]+([A-Za-z_$][\w$]*)`)
+	importFromPattern = regexp.MustCompile(`(?m)^[ \t]*(import|export)[ \t]+([^'";]*?)[ \t]*from[ \t]*['"]([^'"]+)['"]`)
+	dynamicImport     = regexp.MustCompile(`\bimport\(\s*['"]([^'"]+)['"]\s*\)`)
+	namedBindings     = regexp.MustCompile(`\{([^}]*)\}`)
+)
+
+// TreeShake drops exported functions, classes and variables that no other
+// module imports. Modules are transpiled JavaScript keyed by file name; the
+// entry module keeps all its exports. Namespace imports, export-star and
+// dynamic imports keep every export of their target. A declaration that
+// its own module still uses stays in place without the export keyword.
+func TreeShake(modules map[string]string, entry string) (map[string]string, []RemovedExport) {
+	names := map[string]string{}
+	for name := range modules {
+		names[moduleKey(name)] = name
+	}
+
+	used := map[string]map[string]bool{}
+	keepAll := map[string]bool{names[moduleKey(entry)]: true}
+
+	for from, code := range modules {
+		for _, m := range importFromPattern.FindAllStringSubmatch(code, -1) {
+			target, ok := names[resolveModuleKey(from, m[3])]
+			if !ok {
+				continue
+			}
+			clause := m[2]
+			if strings.Contains(clause, "*") {
+				keepAll[target] = true
+				continue
+			}
+			if used[target] == nil {
+				used[target] = map[string]bool{}
+			}
+			if b := namedBindings.FindStringSubmatch(clause); b != nil {
+				for _, spec := range strings.Split(b[1], ",") {
+					if fields := strings.Fields(spec); len(fields) > 0 {
+						used[target][fields[0]] = true
+					}
+				}
+			}
+		}
+		for _, m := range dynamicImport.FindAllStringSubmatch(code, -1) {
+			if target, ok := names[resolveModuleKey(from, m[1])]; ok {
+				keepAll[target] = true
+			}
+		}
+	}
+
+	result := make(map[string]string, len(modules))
+	removed := []RemovedExport{}
+	for name, code := range modules {
+		if keepAll[name] {
+			result[name] = code
+			continue
+		}
+
+		matches := exportDeclPattern.FindAllStringSubmatchIndex(code, -1)
+		for i := len(matches) - 1; i >= 0; i-- {
+			m := matches[i]
+			kind, ident := code[m[2]:m[3]], code[m[4]:m[5]]
+			if used[name][ident] {
+				continue
+			}
+
+			report := RemovedExport{Module: name, Name: ident, Kind: declKind(kind)}
+			end := declarationEnd(code, m[1], report.Kind)
+			rest := code[:m[0]] + code[end:]
+			if regexp.MustCompile(`(^|[^\w$.])` + regexp.QuoteMeta(ident) + `($|[^\w$])`).MatchString(rest) {
+				report.Local = true
+				exportAt := m[0] + strings.Index(code[m[0]:], "export")
+				code = code[:exportAt] + strings.TrimLeft(code[exportAt+len("export"):], " \t")
+			} else {
+				code = rest
+			}
+			removed = append(removed, report)
+		}
+		result[name] = code
+	}
+
+	sort.Slice(removed, func(i, j int) bool {
+		if removed[i].Module != removed[j].Module {
+			return removed[i].Module < removed[j].Module
+		}
+		return removed[i].Name < removed[j].Name
+	})
+	return result, removed
+}
+
+func declKind(keyword string) string {
+	switch {
+	case strings.Contains(keyword, "function"):
+		return "function"
+	case keyword == "class":
+		return "class"
+	default:
+		return "variable"
+	}
+}
+
+// declarationEnd finds where the declaration starting before pos ends,
+// including its trailing newline. Functions and classes end at their
+// closing brace; variables at the first top-level ';' or newline.
+func declarationEnd(code string, pos int, kind string) int {
+	depth := 0
+	seenBody := false
+	for i := pos; i < len(code); i++ {
+		switch ch := code[i]; ch {
+		case '"', '\'', '`':
+			i += len(scanQuoted(code[i:])) - 1
+		case '{', '(', '[':
+			depth++
+			if ch == '{' {
+				seenBody = true
+			}
+		case '}', ')', ']':
+			depth--
+			if depth == 0 && ch == '}' && kind != "variable" && seenBody {
+				return skipLineEnd(code, i+1)
+			}
+		case ';', '\n':
+			if depth == 0 && kind == "variable" {
+				return skipLineEnd(code, i+1)
+			}
+		}
+	}
+	return len(code)
+}
+
+func skipLineEnd(code string, i int) int {
+	for i < len(code) && (code[i] == ' ' || code[i] == '\t' || code[i] == ';') {
+		i++
+	}
+	if i < len(code) && code[i] == '\n' {
+		i++
+	}
+	return i
+}
+
+// moduleKey normalizes a module file name for matching import specifiers
+func moduleKey(name string) string {
+	name = path.Clean(strings.TrimPrefix(name, "./"))
+	return strings.TrimSuffix(name, path.Ext(name))
+}
+
+// resolveModuleKey resolves an import specifier relative to the importing
+// module
+func resolveModuleKey(from, specifier string) string {
+	if strings.HasPrefix(specifier, "./") || strings.HasPrefix(specifier, "../") {
+		specifier = path.Join(path.Dir(from), specifier)
+	}
+	return moduleKey(specifier)
+}
@@ -0,0 +1,5 @@
+package transpiler
+
+// Version is the transpiler release reported by /health and status badges;
+// it is the newest release in the changelog
+const Version = "1.1.0"
@@ -0,0 +1,166 @@
+package usage
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+)
+
+// SignatureHeader carries a webhook batch's HMAC-SHA256, in hex, when the
+// sink has a secret
+const SignatureHeader = "X-Usage-Signature"
+
+// FromEnv picks a sink from USAGE_SINK, read with getenv:
+//
+//   - file:<path> appends events to a file, one JSON object a line
+//   - webhook:<url> POSTs each batch as {"events": [...]}, signed with
+//     USAGE_WEBHOOK_SECRET when it's set
+//   - kafka:<url> produces events through a Kafka REST Proxy, where url is
+//     a topic's, like http://proxy:8082/topics/usage
+//
+// It returns nil when USAGE_SINK isn't set, leaving usage unmetered.
+func FromEnv(getenv func(string) string) (Sink, error) {
+	setting := getenv("USAGE_SINK")
+	if setting == "" {
+		return nil, nil
+	}
+	kind, target, _ := strings.Cut(setting, ":")
+	if target == "" {
+		return nil, fmt.Errorf("USAGE_SINK %q: expected file:<path>, webhook:<url> or kafka:<url>", setting)
+	}
+	switch kind {
+	case "file":
+		return NewFile(target)
+	case "webhook":
+		return NewWebhook(target, getenv("USAGE_WEBHOOK_SECRET")), nil
+	case "kafka":
+		return NewKafka(target), nil
+	}
+	return nil, fmt.Errorf("USAGE_SINK %q: unknown sink %q; expected file, webhook or kafka", setting, kind)
+}
+
+// File appends events to a file as JSON lines
+type File struct {
+	mu   sync.Mutex
+	file *os.File
+}
+
+// NewFile opens path for appending, creating it if need be
+func NewFile(path string) (*File, error) {
+	file, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0o644)
+	if err != nil {
+		return nil, err
+	}
+	return &File{file: file}, nil
+}
+
+func (s *File) Name() string { return "file " + s.file.Name() }
+
+func (s *File) Send(_ context.Context, events []Event) error {
+	var b bytes.Buffer
+	enc := json.NewEncoder(&b)
+	for _, event := range events {
+		if err := enc.Encode(event); err != nil {
+			return err
+		}
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	_, err := s.file.Write(b.Bytes())
+	return err
+}
+
+// Webhook POSTs each batch of events to a URL
+type Webhook struct {
+	url    string
+	secret string
+	client *http.Client
+}
+
+// NewWebhook creates a sink for url; with a secret, each batch is signed
+// in SignatureHeader so the receiver can tell it came from this server
+func NewWebhook(url, secret string) *Webhook {
+	return &Webhook{url: url, secret: secret, client: &http.Client{}}
+}
+
+func (s *Webhook) Name() string { return "webhook " + s.url }
+
+func (s *Webhook) Send(ctx context.Context, events []Event) error {
+	body, err := json.Marshal(struct {
+		Events []Event `json:"events"`
+	}{events})
+	if err != nil {
+		return err
+	}
+	header := http.Header{"Content-Type": {"application/json"}}
+	if s.secret != "" {
+		mac := hmac.New(sha256.New, []byte(s.secret))
+		mac.Write(body)
+		header.Set(SignatureHeader, hex.EncodeToString(mac.Sum(nil)))
+	}
+	return post(ctx, s.client, s.url, header, body)
+}
+
+// Kafka produces events to a topic through a Kafka REST Proxy, keyed by
+// API key so each key's events stay in order on one partition
+type Kafka struct {
+	url    string
+	client *http.Client
+}
+
+// NewKafka creates a sink for the REST Proxy topic URL url
+func NewKafka(url string) *Kafka {
+	return &Kafka{url: strings.TrimRight(url, "/"), client: &http.Client{}}
+}
+
+func (s *Kafka) Name() string { return "kafka " + s.url }
+
+func (s *Kafka) Send(ctx context.Context, events []Event) error {
+	type record struct {
+		Key   string `json:"key"`
+		Value Event  `json:"value"`
+	}
+	records := make([]record, len(events))
+	for i, event := range events {
+		records[i] = record{Key: event.Key, Value: event}
+	}
+	body, err := json.Marshal(struct {
+		Records []record `json:"records"`
+	}{records})
+	if err != nil {
+		return err
+	}
+	header := http.Header{
+		"Content-Type": {"application/vnd.kafka.json.v2+json"},
+		"Accept":       {"application/vnd.kafka.v2+json"},
+	}
+	return post(ctx, s.client, s.url, header, body)
+}
+
+// post sends body to url, failing on any status but 2xx
+func post(ctx context.Context, client *http.Client, url string, header http.Header, body []byte) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header = header
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, io.LimitReader(resp.Body, 64<<10))
+	if resp.StatusCode/100 != 2 {
+		return fmt.Errorf("%s answered %s", url, resp.Status)
+	}
+	return nil
+}
@@ -0,0 +1,203 @@
+// Package usage meters what the requests sent with each API key cost:
+// the transpiles they make, the bytes they send and receive, and the time
+// their programs spend in the sandbox. Each request becomes an Event, and
+// an Emitter sends the events in batches to a Sink — a file, a webhook or
+// Kafka — so operators running paid tiers can bill from the stream
+// instead of scraping logs.
+package usage
+
+import (
+	"context"
+	"log"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	// DefaultBatchSize is how many events an Emitter sends at once
+	DefaultBatchSize = 100
+	// DefaultFlushInterval is the longest an event waits to be sent
+	DefaultFlushInterval = 5 * time.Second
+	// DefaultBufferSize is how many events may wait to be sent before
+	// new ones are dropped
+	DefaultBufferSize = 10000
+)
+
+// Event is the usage of one request sent with an API key
+type Event struct {
+	Time      time.Time `json:"time"`
+	RequestID string    `json:"requestId,omitempty"`
+	// Key is the API key's name, never its value
+	Key      string `json:"key"`
+	Tier     string `json:"tier"`
+	Method   string `json:"method"`
+	Endpoint string `json:"endpoint"`
+	Status   int    `json:"status"`
+	// RequestBytes and ResponseBytes are the sizes of the bodies
+	RequestBytes  int64 `json:"requestBytes"`
+	ResponseBytes int64 `json:"responseBytes"`
+	// Transpiles counts the programs the request transpiled, cached or
+	// not
+	Transpiles int `json:"transpiles"`
+	// SandboxSeconds is the time its programs ran in the sandbox
+	SandboxSeconds float64 `json:"sandboxSeconds"`
+}
+
+// Meter counts a request's transpiles and sandbox time as it's served.
+// Its methods do nothing on a nil Meter, so handlers can count without
+// checking whether the request is metered. It is safe for concurrent use.
+type Meter struct {
+	transpiles atomic.Int64
+	sandbox    atomic.Int64
+}
+
+// Transpiled counts n transpiles
+func (m *Meter) Transpiled(n int) {
+	if m != nil {
+		m.transpiles.Add(int64(n))
+	}
+}
+
+// Sandboxed adds d to the time spent in the sandbox
+func (m *Meter) Sandboxed(d time.Duration) {
+	if m != nil {
+		m.sandbox.Add(int64(d))
+	}
+}
+
+// Fill sets the event's counts from the meter
+func (m *Meter) Fill(e *Event) {
+	if m != nil {
+		e.Transpiles = int(m.transpiles.Load())
+		e.SandboxSeconds = time.Duration(m.sandbox.Load()).Seconds()
+	}
+}
+
+type contextKey struct{}
+
+// ContextKey is the key a request's Meter is kept under in its context.
+// Servers that can't wrap the request's context, like Fiber, store the
+// Meter under it as a request value instead.
+var ContextKey interface{} = contextKey{}
+
+// NewContext returns a context carrying m
+func NewContext(ctx context.Context, m *Meter) context.Context {
+	return context.WithValue(ctx, ContextKey, m)
+}
+
+// FromContext returns the Meter in ctx, or nil for a request that isn't
+// metered
+func FromContext(ctx context.Context) *Meter {
+	m, _ := ctx.Value(ContextKey).(*Meter)
+	return m
+}
+
+// Sink receives events in batches
+type Sink interface {
+	Send(ctx context.Context, events []Event) error
+	// Name says where the sink sends events, for logs
+	Name() string
+}
+
+// Emitter queues events and sends them to its sink from the background,
+// so a slow sink never holds up a request. When the queue is full new
+// events are dropped and counted. It is safe for concurrent use.
+type Emitter struct {
+	sink          Sink
+	events        chan Event
+	batchSize     int
+	flushInterval time.Duration
+	dropped       atomic.Int64
+	closeOnce     sync.Once
+	done          chan struct{}
+}
+
+// NewEmitter starts an emitter sending to sink; zero values pick
+// DefaultBatchSize and DefaultFlushInterval
+func NewEmitter(sink Sink, batchSize int, flushInterval time.Duration) *Emitter {
+	if batchSize <= 0 {
+		batchSize = DefaultBatchSize
+	}
+	if flushInterval <= 0 {
+		flushInterval = DefaultFlushInterval
+	}
+	e := &Emitter{
+		sink:          sink,
+		events:        make(chan Event, DefaultBufferSize),
+		batchSize:     batchSize,
+		flushInterval: flushInterval,
+		done:          make(chan struct{}),
+	}
+	go e.run()
+	return e
+}
+
+// Emit queues an event; a nil Emitter drops it
+func (e *Emitter) Emit(event Event) {
+	if e == nil {
+		return
+	}
+	select {
+	case e.events <- event:
+	default:
+		if e.dropped.Add(1)%1000 == 1 {
+			log.Printf("usage: %s is falling behind; %d events dropped", e.sink.Name(), e.dropped.Load())
+		}
+	}
+}
+
+// Dropped is how many events were dropped because the queue was full
+func (e *Emitter) Dropped() int64 {
+	if e == nil {
+		return 0
+	}
+	return e.dropped.Load()
+}
+
+// Close sends the queued events and stops the emitter. Emit must not be
+// called after it.
+func (e *Emitter) Close() {
+	e.closeOnce.Do(func() {
+		close(e.events)
+		<-e.done
+	})
+}
+
+// run sends a batch once it's full, and whatever has queued at each
+// flush interval
+func (e *Emitter) run() {
+	defer close(e.done)
+	ticker := time.NewTicker(e.flushInterval)
+	defer ticker.Stop()
+	batch := make([]Event, 0, e.batchSize)
+	for {
+		select {
+		case event, ok := <-e.events:
+			if !ok {
+				e.send(batch)
+				return
+			}
+			batch = append(batch, event)
+			if len(batch) >= e.batchSize {
+				e.send(batch)
+				batch = batch[:0]
+			}
+		case <-ticker.C:
+			e.send(batch)
+			batch = batch[:0]
+		}
+	}
+}
+
+// send hands a batch to the sink, logging the events a failure loses
+func (e *Emitter) send(batch []Event) {
+	if len(batch) == 0 {
+		return
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	if err := e.sink.Send(ctx, batch); err != nil {
+		log.Printf("usage: %d events not sent to %s: %v", len(batch), e.sink.Name(), err)
+	}
+}
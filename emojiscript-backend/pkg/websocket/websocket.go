@@ -0,0 +1,255 @@
+// Package websocket is a minimal RFC 6455 server implementation, enough for
+// pushing text messages to browsers without pulling in a dependency.
+package websocket
+
+import (
+	"bufio"
+	"crypto/sha1"
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+const acceptGUID = "258EAFA5-E914-47DA-95CA-C5AB0DC85B11"
+
+// MaxMessageSize bounds frames read from clients
+const MaxMessageSize = 1 << 20
+
+const (
+	opContinuation = 0x0
+	opText         = 0x1
+	opBinary       = 0x2
+	opClose        = 0x8
+	opPing         = 0x9
+	opPong         = 0xA
+)
+
+var (
+	// ErrClosed is returned once the peer has closed the connection
+	ErrClosed     = errors.New("websocket: connection closed")
+	ErrNotUpgrade = errors.New("websocket: not an upgrade request")
+	ErrVersion    = errors.New("websocket: missing key or unsupported version")
+)
+
+// Conn is a server-side WebSocket connection
+type Conn struct {
+	conn   net.Conn
+	rw     *bufio.ReadWriter
+	mu     sync.Mutex
+	closed bool
+}
+
+// IsUpgrade reports whether the request asks for a WebSocket upgrade
+func IsUpgrade(r *http.Request) bool {
+	return isUpgrade(r.Header)
+}
+
+func isUpgrade(header http.Header) bool {
+	return headerContains(header.Get("Connection"), "upgrade") &&
+		strings.EqualFold(header.Get("Upgrade"), "websocket")
+}
+
+// Handshake checks an upgrade request's headers and returns the
+// Sec-WebSocket-Accept value to answer with. Servers that take over the
+// connection themselves, such as fasthttp's, answer 101 with it and wrap
+// the connection with NewConn.
+func Handshake(header http.Header) (string, error) {
+	if !isUpgrade(header) {
+		return "", ErrNotUpgrade
+	}
+	key := header.Get("Sec-WebSocket-Key")
+	if key == "" || header.Get("Sec-WebSocket-Version") != "13" {
+		return "", ErrVersion
+	}
+	return AcceptKey(key), nil
+}
+
+// AcceptKey computes the Sec-WebSocket-Accept value for a client key
+func AcceptKey(key string) string {
+	hash := sha1.Sum([]byte(key + acceptGUID))
+	return base64.StdEncoding.EncodeToString(hash[:])
+}
+
+// Upgrade completes the handshake on a net/http request and takes over the
+// underlying connection
+func Upgrade(w http.ResponseWriter, r *http.Request) (*Conn, error) {
+	accept, err := Handshake(r.Header)
+	switch {
+	case errors.Is(err, ErrNotUpgrade):
+		http.Error(w, "Expected WebSocket upgrade", http.StatusBadRequest)
+		return nil, err
+	case err != nil:
+		http.Error(w, "Unsupported WebSocket version", http.StatusBadRequest)
+		return nil, err
+	}
+
+	hijacker, ok := w.(http.Hijacker)
+	if !ok {
+		http.Error(w, "WebSocket not supported", http.StatusInternalServerError)
+		return nil, fmt.Errorf("websocket: response does not support hijacking")
+	}
+	conn, rw, err := hijacker.Hijack()
+	if err != nil {
+		return nil, err
+	}
+
+	fmt.Fprintf(rw, "HTTP/1.1 101 Switching Protocols\r\nUpgrade: websocket\r\nConnection: Upgrade\r\nSec-WebSocket-Accept: %s\r\n\r\n", accept)
+	if err := rw.Flush(); err != nil {
+		conn.Close()
+		return nil, err
+	}
+	return NewConn(conn, rw), nil
+}
+
+// NewConn wraps a connection whose handshake has already been completed
+func NewConn(conn net.Conn, rw *bufio.ReadWriter) *Conn {
+	if rw == nil {
+		rw = bufio.NewReadWriter(bufio.NewReader(conn), bufio.NewWriter(conn))
+	}
+	return &Conn{conn: conn, rw: rw}
+}
+
+// WriteText sends a text message
+func (c *Conn) WriteText(message string) error {
+	return c.writeFrame(opText, []byte(message))
+}
+
+// ReadMessage returns the next text or binary message, answering pings and
+// close frames along the way
+func (c *Conn) ReadMessage() (string, error) {
+	var message []byte
+	for {
+		fin, opcode, payload, err := c.readFrame()
+		if err != nil {
+			return "", err
+		}
+		switch opcode {
+		case opPing:
+			if err := c.writeFrame(opPong, payload); err != nil {
+				return "", err
+			}
+		case opPong:
+		case opClose:
+			c.writeFrame(opClose, payload)
+			c.Close()
+			return "", ErrClosed
+		case opText, opBinary, opContinuation:
+			message = append(message, payload...)
+			if len(message) > MaxMessageSize {
+				c.Close()
+				return "", fmt.Errorf("websocket: message exceeds %d bytes", MaxMessageSize)
+			}
+			if fin {
+				return string(message), nil
+			}
+		default:
+			c.Close()
+			return "", fmt.Errorf("websocket: unknown opcode %d", opcode)
+		}
+	}
+}
+
+// SetReadDeadline bounds how long ReadMessage waits; the zero time waits
+// forever
+func (c *Conn) SetReadDeadline(t time.Time) error {
+	return c.conn.SetReadDeadline(t)
+}
+
+// Close closes the underlying connection
+func (c *Conn) Close() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.closed {
+		return nil
+	}
+	c.closed = true
+	return c.conn.Close()
+}
+
+func (c *Conn) writeFrame(opcode byte, payload []byte) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.closed {
+		return ErrClosed
+	}
+
+	header := []byte{0x80 | opcode}
+	switch n := len(payload); {
+	case n < 126:
+		header = append(header, byte(n))
+	case n <= 0xFFFF:
+		header = append(header, 126, byte(n>>8), byte(n))
+	default:
+		header = append(header, 127)
+		header = binary.BigEndian.AppendUint64(header, uint64(n))
+	}
+
+	if _, err := c.rw.Write(header); err != nil {
+		return err
+	}
+	if _, err := c.rw.Write(payload); err != nil {
+		return err
+	}
+	return c.rw.Flush()
+}
+
+func (c *Conn) readFrame() (bool, byte, []byte, error) {
+	var head [2]byte
+	if _, err := io.ReadFull(c.rw, head[:]); err != nil {
+		return false, 0, nil, err
+	}
+	fin := head[0]&0x80 != 0
+	opcode := head[0] & 0x0F
+	masked := head[1]&0x80 != 0
+	length := uint64(head[1] & 0x7F)
+
+	switch length {
+	case 126:
+		var ext [2]byte
+		if _, err := io.ReadFull(c.rw, ext[:]); err != nil {
+			return false, 0, nil, err
+		}
+		length = uint64(binary.BigEndian.Uint16(ext[:]))
+	case 127:
+		var ext [8]byte
+		if _, err := io.ReadFull(c.rw, ext[:]); err != nil {
+			return false, 0, nil, err
+		}
+		length = binary.BigEndian.Uint64(ext[:])
+	}
+	if length > MaxMessageSize {
+		return false, 0, nil, fmt.Errorf("websocket: frame exceeds %d bytes", MaxMessageSize)
+	}
+	if !masked {
+		return false, 0, nil, fmt.Errorf("websocket: client frames must be masked")
+	}
+
+	var mask [4]byte
+	if _, err := io.ReadFull(c.rw, mask[:]); err != nil {
+		return false, 0, nil, err
+	}
+	payload := make([]byte, length)
+	if _, err := io.ReadFull(c.rw, payload); err != nil {
+		return false, 0, nil, err
+	}
+	for i := range payload {
+		payload[i] ^= mask[i%4]
+	}
+	return fin, opcode, payload, nil
+}
+
+func headerContains(header, token string) bool {
+	for _, part := range strings.Split(header, ",") {
+		if strings.EqualFold(strings.TrimSpace(part), token) {
+			return true
+		}
+	}
+	return false
+}
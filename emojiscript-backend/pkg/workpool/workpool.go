@@ -0,0 +1,232 @@
+// Package workpool bounds how many requests do CPU-heavy work at once.
+// Requests beyond the worker count wait in a fixed-size queue; when the
+// queue is full, or a request has waited too long, it is turned away with
+// a Rejection so servers can answer 503 with Retry-After instead of
+// letting requests pile up until they time out.
+package workpool
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"runtime"
+	"strconv"
+	"sync"
+	"time"
+)
+
+const (
+	DefaultQueueSize = 64
+	DefaultMaxWait   = 2 * time.Second
+	// maxRetryAfter caps the Retry-After estimate
+	maxRetryAfter = 60 * time.Second
+)
+
+// DefaultWorkers is one worker per CPU
+var DefaultWorkers = runtime.NumCPU()
+
+// Rejection reasons
+const (
+	ReasonQueueFull   = "queue_full"
+	ReasonWaitTimeout = "wait_timeout"
+)
+
+// Rejection is returned by Acquire when the pool can't take the work
+type Rejection struct {
+	Reason     string
+	RetryAfter time.Duration
+}
+
+func (r *Rejection) Error() string {
+	return "server busy: " + r.Reason
+}
+
+// Seconds rounds RetryAfter up to whole seconds for the Retry-After header
+func (r *Rejection) Seconds() int {
+	return int(math.Ceil(r.RetryAfter.Seconds()))
+}
+
+// RejectionBody is the JSON reply to a rejected request
+type RejectionBody struct {
+	Success    bool   `json:"success"`
+	Error      string `json:"error"`
+	Reason     string `json:"reason"`
+	RetryAfter int    `json:"retryAfter"`
+}
+
+// Body builds the JSON reply for the rejection
+func (r *Rejection) Body() RejectionBody {
+	return RejectionBody{Error: "Server is busy, please retry later", Reason: r.Reason, RetryAfter: r.Seconds()}
+}
+
+// Stats is a snapshot of the pool for metrics
+type Stats struct {
+	Workers       int   `json:"workers"`
+	Busy          int   `json:"busy"`
+	Queued        int   `json:"queued"`
+	QueueCapacity int   `json:"queueCapacity"`
+	Completed     int64 `json:"completed"`
+	Rejected      int64 `json:"rejected"`
+	// AverageMillis is the moving average time a job holds a worker
+	AverageMillis float64 `json:"averageMillis"`
+}
+
+// Pool is safe for concurrent use
+type Pool struct {
+	slots   chan struct{}
+	queue   chan struct{}
+	maxWait time.Duration
+
+	mu        sync.Mutex
+	completed int64
+	rejected  int64
+	average   time.Duration
+}
+
+// New creates a pool; zero values pick the defaults
+func New(workers, queueSize int, maxWait time.Duration) *Pool {
+	if workers <= 0 {
+		workers = DefaultWorkers
+	}
+	if queueSize <= 0 {
+		queueSize = DefaultQueueSize
+	}
+	if maxWait <= 0 {
+		maxWait = DefaultMaxWait
+	}
+	return &Pool{slots: make(chan struct{}, workers), queue: make(chan struct{}, queueSize), maxWait: maxWait}
+}
+
+// Acquire takes a worker, waiting in the queue if all are busy. The
+// returned release must be called when the work is done. The error is a
+// *Rejection when the pool is saturated, or ctx's error if it ends first.
+func (p *Pool) Acquire(ctx context.Context) (release func(), err error) {
+	select {
+	case p.slots <- struct{}{}:
+		return p.releaser(), nil
+	default:
+	}
+
+	select {
+	case p.queue <- struct{}{}:
+	default:
+		return nil, p.reject(ReasonQueueFull)
+	}
+	defer func() { <-p.queue }()
+
+	timer := time.NewTimer(p.maxWait)
+	defer timer.Stop()
+	select {
+	case p.slots <- struct{}{}:
+		return p.releaser(), nil
+	case <-timer.C:
+		return nil, p.reject(ReasonWaitTimeout)
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+func (p *Pool) releaser() func() {
+	started := time.Now()
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			<-p.slots
+			p.mu.Lock()
+			defer p.mu.Unlock()
+			p.completed++
+			// exponential moving average, weighting recent jobs
+			elapsed := time.Since(started)
+			if p.average == 0 {
+				p.average = elapsed
+			} else {
+				p.average = (p.average*7 + elapsed) / 8
+			}
+		})
+	}
+}
+
+func (p *Pool) reject(reason string) *Rejection {
+	p.mu.Lock()
+	p.rejected++
+	p.mu.Unlock()
+	return &Rejection{Reason: reason, RetryAfter: p.retryAfter()}
+}
+
+// retryAfter estimates how long the queue ahead takes to drain, at least
+// one second
+func (p *Pool) retryAfter() time.Duration {
+	p.mu.Lock()
+	average := p.average
+	p.mu.Unlock()
+	waiting := float64(len(p.queue) + len(p.slots))
+	estimate := time.Duration(float64(average) * waiting / float64(cap(p.slots)))
+	return max(time.Second, min(estimate, maxRetryAfter))
+}
+
+// Stats reports the pool's current load
+func (p *Pool) Stats() Stats {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return Stats{
+		Workers:       cap(p.slots),
+		Busy:          len(p.slots),
+		Queued:        len(p.queue),
+		QueueCapacity: cap(p.queue),
+		Completed:     p.completed,
+		Rejected:      p.rejected,
+		AverageMillis: float64(p.average) / float64(time.Millisecond),
+	}
+}
+
+// WritePrometheus writes the snapshot in the Prometheus text exposition
+// format
+func (s Stats) WritePrometheus(w io.Writer) {
+	gauges := []struct {
+		name, help string
+		value      float64
+	}{
+		{"workers", "Workers in the pool.", float64(s.Workers)},
+		{"busy", "Workers currently running a job.", float64(s.Busy)},
+		{"queued", "Requests waiting for a worker.", float64(s.Queued)},
+		{"queue_capacity", "Requests that may wait before new ones are rejected.", float64(s.QueueCapacity)},
+		{"average_milliseconds", "Moving average time a job holds a worker.", s.AverageMillis},
+	}
+	for _, gauge := range gauges {
+		fmt.Fprintf(w, "# HELP emojiscript_pool_%s %s\n", gauge.name, gauge.help)
+		fmt.Fprintf(w, "# TYPE emojiscript_pool_%s gauge\n", gauge.name)
+		fmt.Fprintf(w, "emojiscript_pool_%s %g\n", gauge.name, gauge.value)
+	}
+	fmt.Fprintln(w, "# HELP emojiscript_pool_completed_total Jobs the pool has finished.")
+	fmt.Fprintln(w, "# TYPE emojiscript_pool_completed_total counter")
+	fmt.Fprintf(w, "emojiscript_pool_completed_total %d\n", s.Completed)
+	fmt.Fprintln(w, "# HELP emojiscript_pool_rejected_total Requests turned away because the pool was saturated.")
+	fmt.Fprintln(w, "# TYPE emojiscript_pool_rejected_total counter")
+	fmt.Fprintf(w, "emojiscript_pool_rejected_total %d\n", s.Rejected)
+}
+
+// Middleware runs next on a pool worker, answering 503 with Retry-After
+// when the pool is saturated
+func (p *Pool) Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		release, err := p.Acquire(r.Context())
+		var rejection *Rejection
+		switch {
+		case errors.As(err, &rejection):
+			w.Header().Set("Retry-After", strconv.Itoa(rejection.Seconds()))
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(http.StatusServiceUnavailable)
+			json.NewEncoder(w).Encode(rejection.Body())
+			return
+		case err != nil:
+			// the client went away while queued
+			return
+		}
+		defer release()
+		next.ServeHTTP(w, r)
+	})
+}
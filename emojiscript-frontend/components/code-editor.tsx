@@ -3,13 +3,31 @@
 import { useEffect, useRef } from "react";
 import Editor, { OnMount } from "@monaco-editor/react";
 import { useEditorStore, useSettingsStore, useThemeStore } from "@/lib/store";
-import { apiClient } from "@/lib/api";
+import { apiClient, TranspileResponse } from "@/lib/api";
+import { LiveSession } from "@/lib/live";
 import { SuggestionEngine } from "@/lib/suggestions";
 import * as monaco from "monaco-editor";
 import { Card } from "@/components/ui/card";
 import { Badge } from "@/components/ui/badge";
 import { Code2 } from "lucide-react";
 
+// Says which mode to switch to when code is written in the other syntax
+function syntaxMismatch(code: string, syntaxMode: string): string | null {
+  const hasMarkupTags = /<[a-z]+[^>]*>/i.test(code);
+  const hasEmojis =
+    /[\u{1F300}-\u{1F9FF}]|[\u{2600}-\u{26FF}]|[\u{2700}-\u{27BF}]/u.test(
+      code
+    );
+
+  if (syntaxMode === "markup" && hasEmojis && !hasMarkupTags) {
+    return "Emoji syntax detected. Switch to Emoji mode to use emoji-based programming.";
+  }
+  if (syntaxMode === "emoji" && hasMarkupTags && !hasEmojis) {
+    return "Markup syntax detected. Switch to Markup mode to use tag-based programming.";
+  }
+  return null;
+}
+
 export default function CodeEditor() {
   const {
     code,
@@ -25,6 +43,7 @@ export default function CodeEditor() {
   const editorRef = useRef<monaco.editor.IStandaloneCodeEditor | null>(null);
   const debounceTimer = useRef<NodeJS.Timeout | undefined>(undefined);
   const suggestionEngineRef = useRef<SuggestionEngine | null>(null);
+  const liveRef = useRef<LiveSession | null>(null);
 
   useEffect(() => {
     if (!suggestionEngineRef.current) {
@@ -32,9 +51,66 @@ export default function CodeEditor() {
     }
   }, []);
 
+  const showResult = (result: TranspileResponse) => {
+    if (result.success && result.output) {
+      setOutput(result.output);
+    } else {
+      setError(result.errors?.join("\n") || "Transpilation failed");
+      setOutput("");
+    }
+  };
+
+  // While auto-transpile is on, edits stream over the live channel and
+  // results come back as typing pauses
+  useEffect(() => {
+    if (!autoTranspile) return;
+    const { targetLanguage, syntaxMode } = useEditorStore.getState();
+    const live = new LiveSession(
+      () => editorRef.current?.getValue() ?? useEditorStore.getState().code,
+      { targetLanguage, useMarkup: syntaxMode === "markup" },
+      (result) => {
+        const current = editorRef.current?.getValue() ?? "";
+        const mismatch = syntaxMismatch(
+          current,
+          useEditorStore.getState().syntaxMode
+        );
+        setIsTranspiling(false);
+        if (!current.trim() || mismatch) {
+          setError(mismatch);
+          setOutput("");
+          return;
+        }
+        setError(null);
+        showResult(result);
+      }
+    );
+    liveRef.current = live;
+    return () => {
+      live.close();
+      liveRef.current = null;
+    };
+  }, [autoTranspile]);
+
+  useEffect(() => {
+    liveRef.current?.setOptions({
+      targetLanguage,
+      useMarkup: syntaxMode === "markup",
+    });
+  }, [targetLanguage, syntaxMode]);
+
   const handleEditorDidMount: OnMount = (editor, monacoInstance) => {
     editorRef.current = editor;
 
+    editor.onDidChangeModelContent((event) => {
+      liveRef.current?.edit(
+        event.changes.map((change) => ({
+          offset: change.rangeOffset,
+          length: change.rangeLength,
+          text: change.text,
+        }))
+      );
+    });
+
     editor.updateOptions({
       minimap: { enabled: true },
       fontSize,
@@ -46,6 +122,28 @@ export default function CodeEditor() {
       quickSuggestions: showSuggestions,
     });
 
+    // Highlighting rules come from the server so they match the grammar
+    // of the transpiler it runs; the editor keeps XML highlighting if
+    // they can't be loaded
+    apiClient
+      .getSyntaxDefinition("monaco")
+      .then((definition) => {
+        if (
+          !monacoInstance.languages
+            .getLanguages()
+            .some((language) => language.id === "emojiscript")
+        ) {
+          monacoInstance.languages.register({ id: "emojiscript" });
+        }
+        monacoInstance.languages.setMonarchTokensProvider(
+          "emojiscript",
+          definition as monaco.languages.IMonarchLanguage
+        );
+        const model = editor.getModel();
+        if (model) monacoInstance.editor.setModelLanguage(model, "emojiscript");
+      })
+      .catch(() => {});
+
     if (showSuggestions && suggestionEngineRef.current) {
       const provider = monacoInstance.languages.registerCompletionItemProvider(
         "plaintext",
@@ -102,25 +200,9 @@ export default function CodeEditor() {
       return;
     }
 
-    const hasMarkupTags = /<[a-z]+[^>]*>/i.test(codeToTranspile);
-    const hasEmojis =
-      /[\u{1F300}-\u{1F9FF}]|[\u{2600}-\u{26FF}]|[\u{2700}-\u{27BF}]/u.test(
-        codeToTranspile
-      );
-
-    if (syntaxMode === "markup" && hasEmojis && !hasMarkupTags) {
-      setError(
-        "Emoji syntax detected. Switch to Emoji mode to use emoji-based programming."
-      );
-      setOutput("");
-      setIsTranspiling(false);
-      return;
-    }
-
-    if (syntaxMode === "emoji" && hasMarkupTags && !hasEmojis) {
-      setError(
-        "Markup syntax detected. Switch to Markup mode to use tag-based programming."
-      );
+    const mismatch = syntaxMismatch(codeToTranspile, syntaxMode);
+    if (mismatch) {
+      setError(mismatch);
       setOutput("");
       setIsTranspiling(false);
       return;
@@ -135,12 +217,7 @@ export default function CodeEditor() {
         targetLanguage,
         syntaxMode === "markup"
       );
-      if (result.success && result.output) {
-        setOutput(result.output);
-      } else {
-        setError(result.errors?.join("\n") || "Transpilation failed");
-        setOutput("");
-      }
+      showResult(result);
     } catch (error: unknown) {
       const errorMessage =
         error instanceof Error ? error.message : "Failed to transpile";
@@ -161,6 +238,11 @@ export default function CodeEditor() {
 
     if (autoTranspile) {
       if (debounceTimer.current) clearTimeout(debounceTimer.current);
+      // the live session has the edit already
+      if (liveRef.current?.connected) {
+        setIsTranspiling(true);
+        return;
+      }
       debounceTimer.current = setTimeout(() => transpileCode(newCode), 500);
     }
   };
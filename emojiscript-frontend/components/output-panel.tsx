@@ -11,7 +11,8 @@ import { Badge } from "@/components/ui/badge";
 import { Tabs, TabsContent, TabsList, TabsTrigger } from "@/components/ui/tabs";
 
 const LANGUAGE_MAP = {
-  javascript: { monaco: "javascript", label: "JavaScript", icon: "🟨" },
+  javascript: { monaco: "javascript", label: "JavaScript", icon: "🟨", comment: "//" },
+  python: { monaco: "python", label: "Python", icon: "🐍", comment: "#" },
 } as const;
 
 export default function OutputPanel() {
@@ -93,7 +94,7 @@ export default function OutputPanel() {
             language={currentLanguage.monaco}
             value={
               output ||
-              `// Your transpiled ${currentLanguage.label} will appear here`
+              `${currentLanguage.comment} Your transpiled ${currentLanguage.label} will appear here`
             }
             theme={theme === "dark" ? "vs-dark" : "vs-light"}
             options={{
@@ -139,6 +139,14 @@ function ExampleItem({
       <pre className="text-xs bg-muted p-2 rounded overflow-x-auto max-h-24">
         <code>{example.code}</code>
       </pre>
+      {example.expectedOutput && (
+        <div className="mt-2">
+          <p className="text-xs text-muted-foreground mb-1">Expected output</p>
+          <pre className="text-xs bg-muted p-2 rounded overflow-x-auto max-h-24">
+            <code>{example.expectedOutput}</code>
+          </pre>
+        </div>
+      )}
     </Card>
   );
 }
@@ -1,6 +1,13 @@
 "use client";
 
-import { Play, Code2, Settings2, Download, Sparkles } from "lucide-react";
+import {
+  Play,
+  Code2,
+  Settings2,
+  Download,
+  Sparkles,
+  WandSparkles,
+} from "lucide-react";
 import { Button } from "@/components/ui/button";
 import {
   Select,
@@ -29,6 +36,7 @@ import { apiClient, type TargetLanguage, type SyntaxMode } from "@/lib/api";
 
 const SUPPORTED_LANGUAGES = [
   { value: "javascript" as const, label: "JavaScript", icon: "🟨" },
+  { value: "python" as const, label: "Python", icon: "🐍" },
 ];
 
 export default function Toolbar() {
@@ -38,6 +46,7 @@ export default function Toolbar() {
     syntaxMode,
     setTargetLanguage,
     setSyntaxMode,
+    setCode,
     setOutput,
     setError,
     setIsTranspiling,
@@ -85,6 +94,21 @@ export default function Toolbar() {
     }
   };
 
+  const handleFormat = async () => {
+    if (!code.trim()) return;
+    try {
+      const formatted = await apiClient.format(code, syntaxMode === "markup");
+      if (formatted === code) {
+        toast.info("Code is already formatted");
+        return;
+      }
+      setCode(formatted);
+      toast.success("Code formatted");
+    } catch (error: any) {
+      toast.error(error.message || "Failed to format code");
+    }
+  };
+
   const handleExport = () => {
     const extension = syntaxMode === "markup" ? "xml" : "ejs";
     const blob = new Blob([code], { type: "text/plain" });
@@ -160,6 +184,15 @@ export default function Toolbar() {
         </Button>
 
         <Separator orientation="vertical" className="h-6" />
+        <Button
+          variant="outline"
+          size="sm"
+          onClick={handleFormat}
+          className="h-9"
+        >
+          <WandSparkles className="w-4 h-4 mr-2" />
+          Format
+        </Button>
         <Button
           variant="outline"
           size="sm"
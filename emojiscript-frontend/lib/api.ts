@@ -5,27 +5,167 @@ const API_BASE_URL = process.env.NEXT_PUBLIC_API_URL || "/api/v1";
 const MAX_RETRIES = 2;
 const RETRY_DELAY = 1000;
 const REQUEST_TIMEOUT = 30000;
+// Cap, in seconds, on how long a Retry-After can delay a retry
+const MAX_RETRY_AFTER = 10;
+// Cap on how long to poll a job a large request was turned into
+const JOB_TIMEOUT = 5 * 60 * 1000;
 
-export type TargetLanguage = "javascript";
+export type TargetLanguage = "javascript" | "typescript" | "python";
 
 export type SyntaxMode = "emoji" | "markup";
 
 export interface Example {
+  id?: string;
   title: string;
   description: string;
   code: string;
   category: string;
   syntax?: SyntaxMode;
   targetLanguage?: TargetLanguage;
+  // place in the learning path, with the ids of the examples to read first
+  order?: number;
+  difficulty?: "beginner" | "intermediate" | "advanced";
+  prerequisites?: string[];
+  // runs in the sandbox as it is, without input or a network
+  runnable?: boolean;
+  // what a runnable example prints, when it's the same every run
+  expectedOutput?: string;
+}
+
+export interface Lesson {
+  id: string;
+  order: number;
+  unit: string;
+  title: string;
+  explanation: string;
+  starterCode: string;
+  solution: string;
+  expectedOutput: string;
+  hints: string[];
+  syntax: SyntaxMode;
+  targetLanguage: TargetLanguage;
+}
+
+export interface QuizQuestion {
+  id: number;
+  type: "meaning" | "emoji" | "fill-in";
+  prompt: string;
+  code?: string;
+  choices: string[];
+  answer?: number;
+  explanation?: string;
+}
+
+export interface Quiz {
+  seed: number;
+  questions: QuizQuestion[];
 }
 
 export interface TranspileRequest {
   code: string;
   targetLanguage?: TargetLanguage;
+  // an explicit useMarkup or syntax is never overridden; "auto", or
+  // sending neither, detects markup by its tags and warns when it does
+  useMarkup?: boolean;
+  syntax?: SyntaxMode | "auto";
+  // only ASCII names in markup, instead of the Unicode letters the target allows
+  asciiIdentifiers?: boolean;
+  // rename reserved words used as markup names (class -> class_) instead of failing
+  renameReserved?: boolean;
+  // rewrite the output the way the target is written by hand (Rust: mut only when needed)
+  idiomatic?: boolean;
+  // a raw GitHub or Gist file to transpile instead of code
+  sourceUrl?: string;
+  // "strict" keeps the program out of the server's cache, history and stats
+  privacy?: "standard" | "strict";
+  // an emoji table from getMappingProfiles, or one of the caller's own
+  // (emoji -> keyword); neither combines with a dialect
+  mappingProfile?: string;
+  mappings?: Record<string, string>;
+  // time each phase into metadata.profile; never served from the cache
+  profile?: boolean;
+  // bytes of output to allow, below the server's maxOutputLength
+  outputLimit?: number;
+}
+
+export interface ProjectRequest {
+  // file path -> source, e.g. "lib/utils.emoji"
+  files: Record<string, string>;
+  entry?: string;
+  targetLanguage?: TargetLanguage;
   useMarkup?: boolean;
+  syntax?: SyntaxMode | "auto";
+  bundle?: boolean;
+  privacy?: "standard" | "strict";
+  profile?: boolean;
+}
+
+export interface ProjectFile {
+  output?: string;
+  outputName: string;
+  usedMarkup?: boolean;
+  imports?: string[];
+  external?: string[];
+  errors?: string[];
+  warnings?: string[];
+  diagnostics?: Diagnostic[];
+}
+
+export interface ProjectResponse {
+  success: boolean;
+  targetLanguage?: TargetLanguage;
+  files?: Record<string, ProjectFile>;
+  order?: string[];
+  bundle?: string;
+  errors?: string[];
+  warnings?: string[];
+}
+
+// a project's files validated together, with the problems in their
+// imports of one another in each file's results
+export interface ProjectValidateResponse {
+  valid: boolean;
+  files?: Record<
+    string,
+    { valid: boolean; errors?: string[]; warnings?: string[]; hints?: Hint[]; diagnostics?: Diagnostic[] }
+  >;
+  errors?: string[];
+  // import cycles
+  warnings?: string[];
+}
+
+export interface Hint {
+  rule: string;
+  diagnostic: string;
+  message: string;
+  line?: number;
+  column?: number;
+  fix?: { title: string; edits: TextEdit[] };
+}
+
+export interface Sanitization {
+  pattern: string;
+  line: number;
+  column: number;
+  original: string;
+  replacement?: string;
+}
+
+// A problem in the source, positioned for the editor to underline.
+// line and column are 1-based; all three positions are 0 when unknown.
+export interface Diagnostic {
+  message: string;
+  severity: "error" | "warning";
+  line: number;
+  column: number;
+  length: number;
+  code: string;
 }
 
 export interface TranspileResponse {
+  // names the request in the server's logs and traces; quote it when
+  // reporting a problem
+  traceId?: string;
   success: boolean;
   output: string;
   targetLanguage: string;
@@ -33,6 +173,466 @@ export interface TranspileResponse {
   warnings?: string[];
   metadata?: Record<string, unknown>;
   usedMarkup?: boolean;
+  hints?: Hint[];
+  partial?: boolean;
+  sanitizations?: Sanitization[];
+  // One output per target when the request named targetLanguages
+  outputs?: Partial<Record<TargetLanguage, string>>;
+  diagnostics?: Diagnostic[];
+  // reserved word -> the name renameReserved gave it
+  renames?: Record<string, string>;
+}
+
+export interface TraceVariable {
+  name: string;
+  value: string;
+  type: string;
+}
+
+export interface TraceStep {
+  step: number;
+  line: number;
+  event: "statement" | "condition" | "iteration" | "call" | "return" | "throw" | "catch";
+  source: string;
+  function?: string;
+  depth: number;
+  value?: string;
+  locals: TraceVariable[];
+  globals: TraceVariable[];
+  stdout?: string[];
+}
+
+export interface TraceResponse {
+  success: boolean;
+  javascript?: string;
+  steps: TraceStep[];
+  stdout: string[];
+  stepCount: number;
+  truncated?: boolean;
+  error?: string;
+  errorLine?: number;
+  limit?: string;
+  errors?: string[];
+  warnings?: string[];
+  hints?: Hint[];
+}
+
+export interface RunResources {
+  executionTimeMs: number;
+  peakMemoryBytes: number;
+  statements: number;
+  instructions: number;
+  limitsHit: ("steps" | "instructions" | "time" | "output" | "memory" | "depth")[];
+  limits: {
+    statements: number;
+    instructions: number;
+    timeoutMs: number;
+    outputBytes: number;
+    callDepth: number;
+    memoryBytes: number;
+  };
+}
+
+export interface RunResponse {
+  success: boolean;
+  javascript?: string;
+  stdout: string[];
+  error?: string;
+  errorLine?: number;
+  limit?: string;
+  resources?: RunResources;
+  // the REPL session the run was made in, when it named one
+  session?: {
+    id: string;
+    expiresAt: string;
+    variables: { name: string; value: string; type: string }[];
+  };
+  errors?: string[];
+  warnings?: string[];
+  hints?: Hint[];
+}
+
+// what one top-level statement evaluated to or printed
+export interface LineValue {
+  line: number;
+  // the variable a declaration bound
+  name?: string;
+  // absent when there's nothing to show, e.g. for a console.log call
+  value?: string;
+  type?: string;
+  stdout?: string[];
+}
+
+export interface EvaluateResponse {
+  success: boolean;
+  javascript?: string;
+  // whether values' lines are the program's own, or else the javascript's
+  sourceLines: boolean;
+  values: LineValue[];
+  stdout: string[];
+  error?: string;
+  errorLine?: number;
+  limit?: string;
+  errors?: string[];
+  warnings?: string[];
+  hints?: Hint[];
+}
+
+export interface NotebookCellOutput {
+  stdout: string[];
+  values: LineValue[];
+  error?: string;
+  errorLine?: number;
+}
+
+export interface NotebookCell {
+  id?: string;
+  type: "code" | "markdown";
+  syntax?: "emoji" | "markup";
+  source: string;
+  // numbers the cell's last run since the notebook's session started
+  executionCount?: number;
+  output?: NotebookCellOutput;
+}
+
+export interface Notebook {
+  id: string;
+  cells: NotebookCell[];
+  createdAt: string;
+  expiresAt: string;
+}
+
+export interface CellRunResponse {
+  success: boolean;
+  cell: NotebookCell;
+  javascript?: string;
+  errors?: string[];
+  warnings?: string[];
+  hints?: Hint[];
+}
+
+export interface SourceFile {
+  name: string;
+  code: string;
+}
+
+export interface TextEdit {
+  file?: string;
+  line: number;
+  column: number;
+  endLine: number;
+  endColumn: number;
+  newText: string;
+}
+
+export interface RenameResponse {
+  success: boolean;
+  oldName?: string;
+  newName?: string;
+  edits?: TextEdit[];
+  code?: string;
+  files?: SourceFile[];
+  errors?: string[];
+}
+
+export interface ExtractResponse {
+  success: boolean;
+  name?: string;
+  params?: string[];
+  returns?: string[];
+  edits?: TextEdit[];
+  code?: string;
+  errors?: string[];
+}
+
+export interface ImportIssue {
+  file?: string;
+  line: number;
+  kind: "unused" | "duplicate";
+  module: string;
+  names?: string[];
+  message: string;
+}
+
+export interface OrganizeImportsResponse {
+  success: boolean;
+  issues: ImportIssue[];
+  edits: TextEdit[];
+  code?: string;
+  files?: { name: string; code: string }[];
+  errors?: string[];
+}
+
+export interface ASTNode {
+  kind: string;
+  label?: string;
+  line?: number;
+  role?: string;
+  children?: ASTNode[];
+}
+
+// A markup tag, or the code between tags when it has no name
+export interface MarkupNode {
+  name?: string;
+  attributes?: Record<string, string>;
+  content?: string;
+  children?: MarkupNode[];
+  // the <elif> and <else> tags chained to an <if>
+  branches?: MarkupNode[];
+  error?: string;
+  line: number;
+  column: number;
+}
+
+export interface ASTResponse {
+  success: boolean;
+  format?: "json" | "dot" | "mermaid" | "markup";
+  javascript?: string;
+  tree?: ASTNode;
+  graph?: string;
+  markup?: MarkupNode[];
+  errors?: string[];
+  warnings?: string[];
+  hints?: Hint[];
+}
+
+export interface SemanticToken {
+  // "keyword", "emoji", "identifier", "number", "string", "template",
+  // "regex", "comment", "punctuation", or for markup "tag" and "attribute"
+  type: string;
+  lexeme: string;
+  line: number;
+  column: number;
+  // in code points, not UTF-16 units
+  length: number;
+}
+
+export interface ProgramSymbol {
+  kind: "function" | "class" | "method" | "record";
+  name: string;
+  // the class or function it is declared in
+  container?: string;
+  params?: string[];
+  line: number;
+  column: number;
+  // just past the end of the declaration
+  endLine: number;
+  endColumn: number;
+  // the comment right before the declaration
+  doc?: string;
+}
+
+export interface OutlineItem extends Omit<ProgramSymbol, "kind"> {
+  kind: ProgramSymbol["kind"] | "variable";
+  // the declarations inside this one's range
+  children?: OutlineItem[];
+}
+
+export interface GradeTest {
+  name?: string;
+  input?: string;
+  expectedOutput: string;
+  hidden?: boolean;
+}
+
+export interface GradeResult {
+  name: string;
+  passed: boolean;
+  hidden?: boolean;
+  expected?: string;
+  actual?: string;
+  diff?: string[];
+  error?: string;
+  limit?: string;
+  hints?: Hint[];
+}
+
+export interface GradeResponse {
+  success: boolean;
+  passed: number;
+  total: number;
+  results: GradeResult[];
+  errors?: string[];
+  warnings?: string[];
+}
+
+export interface Challenge {
+  id: string;
+  title: string;
+  description: string;
+  starterCode: string;
+  syntax: SyntaxMode;
+  difficulty: string;
+}
+
+export interface DailyChallenge {
+  date: string;
+  challenge: Challenge;
+  // the visible tests; hiddenTests more are run when grading
+  examples: GradeTest[];
+  hiddenTests: number;
+}
+
+export interface RateLimitTier {
+  name: string;
+  perMinute: number;
+  // no daily quota when absent
+  perDay?: number;
+}
+
+// what a deployment can do, from /meta
+export interface DeploymentMeta {
+  version: string;
+  commit?: string;
+  targets: string[];
+  // strictPrivacy, normalizedCacheKeys, remoteCache, asyncJobs,
+  // snippetScans, chaos
+  flags: string[];
+  maxCodeLength: number;
+  maxCodeCharacters: number;
+  maxOutputLength: number;
+  complexityBudget: number;
+  // zero when every transpile is synchronous
+  asyncThreshold: number;
+  rateLimits: {
+    anonymous: RateLimitTier;
+    tiers: RateLimitTier[];
+    // zero is unlimited
+    snippetsPerMinute: number;
+    submissionsPerMinute: number;
+    webhooksPerMinute: number;
+  };
+  // optional subsystems that are down; transpiling works regardless
+  degraded: DegradedFeature[];
+}
+
+export interface DegradedFeature {
+  name: "remoteCache" | "snippets" | "sandbox";
+  reason: string;
+  since: string;
+}
+
+export interface LeaderboardEntry {
+  name: string;
+  passed: number;
+  total: number;
+  // recognized emoji per 100 characters, whitespace not counted
+  emojiDensity: number;
+  size: number;
+  submittedAt: string;
+  codeHash: string;
+}
+
+export interface SubmissionResponse extends GradeResponse {
+  entry?: LeaderboardEntry;
+  // the name's place on the board, from 1; 0 when it's not on it
+  rank: number;
+  improved: boolean;
+}
+
+export interface BadgeResponse {
+  success: boolean;
+  hash?: string;
+  verified: boolean;
+  version: string;
+  badgeUrl?: string;
+  errors?: string[];
+}
+
+export type BadgeStyle = "flat" | "flat-square" | "for-the-badge";
+
+export type ConformanceStatus = "pass" | "equivalent" | "fail" | "skip";
+
+export interface ConformanceReport {
+  version: string;
+  // set when no case failed
+  passed: boolean;
+  // the share of the cases run that passed or were equivalent, from 0 to 1
+  score: number;
+  counts: Record<ConformanceStatus, number>;
+  results: {
+    case: string;
+    feature: string;
+    status: ConformanceStatus;
+    message?: string;
+  }[];
+}
+
+export interface SnippetResponse {
+  success: boolean;
+  id: string;
+  embedUrl: string;
+  expiresAt?: string;
+}
+
+export interface SnippetOptions {
+  targetLanguage?: string;
+  // seconds until the link stops working, up to 30 days
+  expiresIn?: number;
+}
+
+export type SnippetFlagReason = "spam" | "abuse" | "malicious" | "other";
+
+export type EmbedTheme = "light" | "dark" | "auto";
+
+export interface LanguageChange {
+  kind:
+    | "added-emoji"
+    | "added-tag"
+    | "changed-tag"
+    | "added-syntax"
+    | "changed-syntax"
+    | "deprecated";
+  subject: string;
+  summary: string;
+  replacement?: string;
+  removedIn?: string;
+}
+
+export interface Changelog {
+  success: boolean;
+  version: string;
+  // newest first
+  releases: Array<{ version: string; date?: string; changes: LanguageChange[] }>;
+  deprecations: LanguageChange[];
+}
+
+export interface MappingProfile {
+  name: string;
+  description: string;
+  // emoji -> keyword
+  mappings: Record<string, string>;
+}
+
+export interface GrammarToken {
+  emoji: string;
+  keyword: string;
+  category?: string;
+}
+
+export interface Grammar {
+  version: string;
+  emojiTokens: GrammarToken[];
+  markupEmoji: GrammarToken[];
+  markupTags: Array<{
+    name: string;
+    aliases?: string[];
+    attributes: Array<{
+      name: string;
+      required: boolean;
+      type: "identifier" | "expression" | "type" | "boolean" | "keyword" | "text";
+      values?: string[];
+    }>;
+    content: "block" | "expression" | "text" | "none";
+    oneOf?: string[][];
+  }>;
+  operators: Array<{
+    emoji: string;
+    keyword: string;
+    precedence: number;
+    associativity: "left" | "right";
+    unary?: boolean;
+  }>;
 }
 
 export interface SuggestionRequest {
@@ -76,6 +676,14 @@ class APIClient {
     options: RequestInit = {},
     retries = MAX_RETRIES
   ): Promise<Response> {
+    // One key per logical request, reused by its retries, so a POST whose
+    // response was lost isn't recorded twice
+    if (options.method === "POST" && retries === MAX_RETRIES) {
+      options = {
+        ...options,
+        headers: { "Idempotency-Key": crypto.randomUUID(), ...options.headers },
+      };
+    }
     try {
       this.abortController = new AbortController();
       const timeoutId = setTimeout(
@@ -93,6 +701,14 @@ class APIClient {
       });
 
       clearTimeout(timeoutId);
+      // The server sheds load with 503 and says when to come back
+      if (response.status === 503 && retries > 0) {
+        const retryAfter = Number(response.headers.get("Retry-After")) || 1;
+        await new Promise((resolve) =>
+          setTimeout(resolve, Math.min(retryAfter, MAX_RETRY_AFTER) * 1000)
+        );
+        return this.fetchWithRetry(url, options, retries - 1);
+      }
       return response;
     } catch (error) {
       if (error instanceof Error && error.name === "AbortError") {
@@ -114,29 +730,581 @@ class APIClient {
     this.abortController?.abort();
   }
 
+  // Reads a /transpile response. A large program comes back as 202 with
+  // a job to poll until the server has finished it
+  private async transpileResult(
+    response: Response
+  ): Promise<TranspileResponse> {
+    let status = response.status;
+    let body = await response
+      .json()
+      .catch(() => ({ error: "Backend unavailable" }));
+
+    if (status === 202 && body.jobId) {
+      const deadline = Date.now() + JOB_TIMEOUT;
+      for (;;) {
+        const poll = await this.fetchWithRetry(
+          `${this.baseURL}/jobs/${body.jobId}`
+        );
+        const job = await poll.json().catch(() => ({}));
+        if (!poll.ok || job.status === "failed") {
+          throw new Error(job.error || "Transpilation failed");
+        }
+        if (job.status === "done") {
+          status = job.responseStatus;
+          body = job.response;
+          break;
+        }
+        if (Date.now() > deadline) {
+          throw new Error("Transpilation is taking too long");
+        }
+        const retryAfter = Number(poll.headers.get("Retry-After")) || 1;
+        await new Promise((resolve) =>
+          setTimeout(resolve, Math.min(retryAfter, MAX_RETRY_AFTER) * 1000)
+        );
+      }
+    }
+
+    if (status < 200 || status >= 300) {
+      const message =
+        body.error || body.errors?.join("\n") || "Transpilation failed";
+      // A server error's trace ID finds it in the server's logs
+      const traceId =
+        status >= 500
+          ? body.traceId || response.headers.get("X-Request-ID")
+          : null;
+      throw new Error(traceId ? `${message} (trace ${traceId})` : message);
+    }
+    return body;
+  }
+
   async transpile(
     code: string,
     targetLanguage: TargetLanguage = "javascript",
+    useMarkup?: boolean,
+    partial?: boolean
+  ): Promise<TranspileResponse> {
+    const response = await this.fetchWithRetry(`${this.baseURL}/transpile`, {
+      method: "POST",
+      body: JSON.stringify({ code, targetLanguage, useMarkup, partial }),
+    });
+
+    return this.transpileResult(response);
+  }
+
+  async transpileTargets(
+    code: string,
+    targetLanguages: TargetLanguage[],
     useMarkup?: boolean
   ): Promise<TranspileResponse> {
     const response = await this.fetchWithRetry(`${this.baseURL}/transpile`, {
       method: "POST",
-      body: JSON.stringify({ code, targetLanguage, useMarkup }),
+      body: JSON.stringify({ code, targetLanguages, useMarkup }),
+    });
+
+    return this.transpileResult(response);
+  }
+
+  // Failed projects resolve too, so per-file errors can be shown
+  async transpileProject(request: ProjectRequest): Promise<ProjectResponse> {
+    const response = await this.fetchWithRetry(`${this.baseURL}/transpile/project`, {
+      method: "POST",
+      body: JSON.stringify(request),
+    });
+    return response
+      .json()
+      .catch(() => ({ success: false, errors: ["Backend unavailable"] }));
+  }
+
+  async trace(code: string, useMarkup?: boolean): Promise<TraceResponse> {
+    const response = await this.fetchWithRetry(`${this.baseURL}/trace`, {
+      method: "POST",
+      body: JSON.stringify({ code, useMarkup }),
+    });
+
+    if (!response.ok) {
+      const error = await response
+        .json()
+        .catch(() => ({ error: "Backend unavailable" }));
+      throw new Error(error.errors?.join("\n") || "Trace failed");
+    }
+
+    return response.json();
+  }
+
+  // With a session, the run keeps the variables earlier runs in that
+  // session declared, as in a REPL
+  async run(
+    code: string,
+    useMarkup?: boolean,
+    stdin?: string,
+    session?: string
+  ): Promise<RunResponse> {
+    const query = session ? `?session=${encodeURIComponent(session)}` : "";
+    const response = await this.fetchWithRetry(`${this.baseURL}/run${query}`, {
+      method: "POST",
+      body: JSON.stringify({ code, useMarkup, stdin }),
     });
 
     if (!response.ok) {
       const error = await response
         .json()
         .catch(() => ({ error: "Backend unavailable" }));
-      throw new Error(error.error || "Transpilation failed");
+      throw new Error(error.errors?.join("\n") || "Run failed");
     }
 
     return response.json();
   }
 
+  // Forgets everything a REPL session's runs declared
+  async resetSession(session: string): Promise<void> {
+    const response = await this.fetchWithRetry(
+      `${this.baseURL}/run?session=${encodeURIComponent(session)}`,
+      { method: "DELETE" }
+    );
+    if (!response.ok && response.status !== 404) {
+      throw new Error("Failed to reset session");
+    }
+  }
+
+  async evaluate(
+    code: string,
+    useMarkup?: boolean,
+    stdin?: string
+  ): Promise<EvaluateResponse> {
+    const response = await this.fetchWithRetry(`${this.baseURL}/evaluate`, {
+      method: "POST",
+      body: JSON.stringify({ code, useMarkup, stdin }),
+    });
+
+    if (!response.ok) {
+      const error = await response
+        .json()
+        .catch(() => ({ error: "Backend unavailable" }));
+      throw new Error(error.errors?.join("\n") || "Evaluation failed");
+    }
+
+    return response.json();
+  }
+
+  // Notebooks keep their cells, and the variables their code cells
+  // declare, on the server until they go unused for 30 minutes
+  async createNotebook(cells: NotebookCell[]): Promise<Notebook> {
+    return this.notebookRequest("/notebooks", "POST", { cells });
+  }
+
+  async getNotebook(id: string): Promise<Notebook> {
+    return this.notebookRequest(`/notebooks/${id}`, "GET");
+  }
+
+  async updateNotebook(id: string, cells: NotebookCell[]): Promise<Notebook> {
+    return this.notebookRequest(`/notebooks/${id}`, "PUT", { cells });
+  }
+
+  // Forgets every variable the notebook's cells declared
+  async restartNotebook(id: string): Promise<Notebook> {
+    return this.notebookRequest(`/notebooks/${id}/restart`, "POST");
+  }
+
+  async deleteNotebook(id: string): Promise<void> {
+    const response = await this.fetchWithRetry(
+      `${this.baseURL}/notebooks/${id}`,
+      { method: "DELETE" }
+    );
+    if (!response.ok && response.status !== 404) {
+      throw new Error("Failed to delete notebook");
+    }
+  }
+
+  // Runs a code cell in the notebook's session, sending its latest source
+  async runCell(
+    id: string,
+    cellId: string,
+    source?: string,
+    stdin?: string
+  ): Promise<CellRunResponse> {
+    const response = await this.fetchWithRetry(
+      `${this.baseURL}/notebooks/${id}/cells/${cellId}/run`,
+      { method: "POST", body: JSON.stringify({ source, stdin }) }
+    );
+
+    if (!response.ok && response.status !== 400) {
+      const error = await response
+        .json()
+        .catch(() => ({ error: "Backend unavailable" }));
+      throw new Error(error.error || "Cell run failed");
+    }
+
+    return response.json();
+  }
+
+  private async notebookRequest(
+    path: string,
+    method: string,
+    body?: unknown
+  ): Promise<Notebook> {
+    const response = await this.fetchWithRetry(`${this.baseURL}${path}`, {
+      method,
+      body: body === undefined ? undefined : JSON.stringify(body),
+    });
+
+    if (!response.ok) {
+      const error = await response
+        .json()
+        .catch(() => ({ error: "Backend unavailable" }));
+      throw new Error(error.error || "Notebook request failed");
+    }
+
+    return response.json();
+  }
+
+  async ast(
+    code: string,
+    format: "json" | "dot" | "mermaid" | "markup" = "json",
+    useMarkup?: boolean
+  ): Promise<ASTResponse> {
+    const response = await this.fetchWithRetry(`${this.baseURL}/ast`, {
+      method: "POST",
+      body: JSON.stringify({ code, format, useMarkup }),
+    });
+
+    if (!response.ok) {
+      const error = await response
+        .json()
+        .catch(() => ({ error: "Backend unavailable" }));
+      throw new Error(error.errors?.join("\n") || "Failed to build syntax tree");
+    }
+
+    return response.json();
+  }
+
+  // Tokens in source order, for semantic highlighting in the editor
+  async tokenize(code: string, useMarkup?: boolean): Promise<SemanticToken[]> {
+    const response = await this.fetchWithRetry(`${this.baseURL}/tokenize`, {
+      method: "POST",
+      body: JSON.stringify({ code, useMarkup }),
+    });
+
+    if (!response.ok) {
+      const error = await response
+        .json()
+        .catch(() => ({ error: "Backend unavailable" }));
+      throw new Error(error.error || "Failed to tokenize");
+    }
+
+    const data = await response.json();
+    return data.tokens;
+  }
+
+  // Re-indents a program and normalizes its spelling and spacing without
+  // changing what it does
+  async format(code: string, useMarkup?: boolean): Promise<string> {
+    const response = await this.fetchWithRetry(`${this.baseURL}/format`, {
+      method: "POST",
+      body: JSON.stringify({ code, useMarkup }),
+    });
+
+    if (!response.ok) {
+      const error = await response
+        .json()
+        .catch(() => ({ error: "Backend unavailable" }));
+      throw new Error(error.error || "Failed to format code");
+    }
+
+    const data = await response.json();
+    return data.output;
+  }
+
+  // Indexes the functions, classes and methods a program declares, for
+  // outline views and go-to-symbol
+  async symbols(code: string, useMarkup?: boolean): Promise<ProgramSymbol[]> {
+    const response = await this.fetchWithRetry(`${this.baseURL}/symbols`, {
+      method: "POST",
+      body: JSON.stringify({ code, useMarkup }),
+    });
+
+    if (!response.ok) {
+      const error = await response
+        .json()
+        .catch(() => ({ error: "Backend unavailable" }));
+      throw new Error(error.error || "Failed to index symbols");
+    }
+
+    const data = await response.json();
+    return data.symbols;
+  }
+
+  // Returns a program's declarations as a tree with their ranges, for
+  // the outline panel and minimap
+  async outline(code: string, useMarkup?: boolean): Promise<OutlineItem[]> {
+    const response = await this.fetchWithRetry(`${this.baseURL}/outline`, {
+      method: "POST",
+      body: JSON.stringify({ code, useMarkup }),
+    });
+
+    if (!response.ok) {
+      const error = await response
+        .json()
+        .catch(() => ({ error: "Backend unavailable" }));
+      throw new Error(error.error || "Failed to outline program");
+    }
+
+    const data = await response.json();
+    return data.outline;
+  }
+
+  // Renames the variable at a position. Pass files (and the file the
+  // position is in) to rename across a project instead of a single program
+  async rename(
+    code: string,
+    line: number,
+    column: number,
+    newName: string,
+    project?: { files: SourceFile[]; file: string }
+  ): Promise<RenameResponse> {
+    const response = await this.fetchWithRetry(
+      `${this.baseURL}/refactor/rename`,
+      {
+        method: "POST",
+        body: JSON.stringify({
+          code: project ? undefined : code,
+          files: project?.files,
+          file: project?.file,
+          line,
+          column,
+          newName,
+        }),
+      }
+    );
+
+    if (!response.ok) {
+      const error = await response
+        .json()
+        .catch(() => ({ error: "Backend unavailable" }));
+      throw new Error(error.errors?.join("\n") || "Rename failed");
+    }
+
+    return response.json();
+  }
+
+  // Moves lines startLine to endLine into a new function
+  async extractFunction(
+    code: string,
+    startLine: number,
+    endLine: number,
+    name?: string,
+    useMarkup?: boolean
+  ): Promise<ExtractResponse> {
+    const response = await this.fetchWithRetry(
+      `${this.baseURL}/refactor/extract`,
+      {
+        method: "POST",
+        body: JSON.stringify({ code, startLine, endLine, name, useMarkup }),
+      }
+    );
+
+    if (!response.ok) {
+      const error = await response
+        .json()
+        .catch(() => ({ error: "Backend unavailable" }));
+      throw new Error(error.errors?.join("\n") || "Extract function failed");
+    }
+
+    return response.json();
+  }
+
+  // Removes unused and repeated imports
+  async organizeImports(code: string): Promise<OrganizeImportsResponse> {
+    const response = await this.fetchWithRetry(
+      `${this.baseURL}/refactor/imports`,
+      {
+        method: "POST",
+        body: JSON.stringify({ code }),
+      }
+    );
+
+    if (!response.ok) {
+      const error = await response
+        .json()
+        .catch(() => ({ error: "Backend unavailable" }));
+      throw new Error(error.errors?.join("\n") || "Organize imports failed");
+    }
+
+    return response.json();
+  }
+
+  async grade(code: string, tests: GradeTest[], useMarkup?: boolean): Promise<GradeResponse> {
+    const response = await this.fetchWithRetry(`${this.baseURL}/grade`, {
+      method: "POST",
+      body: JSON.stringify({ code, tests, useMarkup }),
+    });
+
+    if (!response.ok) {
+      const error = await response
+        .json()
+        .catch(() => ({ error: "Backend unavailable" }));
+      throw new Error(error.errors?.join("\n") || "Grading failed");
+    }
+
+    return response.json();
+  }
+
+  // date, YYYY-MM-DD, picks an earlier day's challenge
+  async getDailyChallenge(date?: string): Promise<DailyChallenge> {
+    const query = date ? `?date=${encodeURIComponent(date)}` : "";
+    const response = await this.fetchWithRetry(`${this.baseURL}/challenge/today${query}`);
+
+    if (!response.ok) {
+      const error = await response
+        .json()
+        .catch(() => ({ error: "Backend unavailable" }));
+      throw new Error(error.error || "Failed to get the daily challenge");
+    }
+
+    return response.json();
+  }
+
+  async gradeChallenge(id: string, code: string, useMarkup?: boolean): Promise<GradeResponse> {
+    const response = await this.fetchWithRetry(`${this.baseURL}/challenge/${encodeURIComponent(id)}/grade`, {
+      method: "POST",
+      body: JSON.stringify({ code, useMarkup }),
+    });
+
+    if (!response.ok) {
+      const error = await response
+        .json()
+        .catch(() => ({ error: "Backend unavailable" }));
+      throw new Error(error.errors?.join("\n") || error.error || "Grading failed");
+    }
+
+    return response.json();
+  }
+
+  async submitChallenge(id: string, name: string, code: string, useMarkup?: boolean): Promise<SubmissionResponse> {
+    const response = await this.fetchWithRetry(`${this.baseURL}/challenge/${encodeURIComponent(id)}/submit`, {
+      method: "POST",
+      body: JSON.stringify({ name, code, useMarkup }),
+    });
+
+    if (!response.ok) {
+      const error = await response
+        .json()
+        .catch(() => ({ error: "Backend unavailable" }));
+      throw new Error(error.errors?.join("\n") || error.error || "Submission failed");
+    }
+
+    return response.json();
+  }
+
+  async getLeaderboard(id: string, limit?: number): Promise<LeaderboardEntry[]> {
+    const query = limit ? `?limit=${limit}` : "";
+    const response = await this.fetchWithRetry(`${this.baseURL}/challenge/${encodeURIComponent(id)}/leaderboard${query}`);
+
+    if (!response.ok) {
+      const error = await response
+        .json()
+        .catch(() => ({ error: "Backend unavailable" }));
+      throw new Error(error.error || "Failed to get the leaderboard");
+    }
+
+    const data = await response.json();
+    return Array.isArray(data.entries) ? data.entries : [];
+  }
+
+  async verifyBadge(code: string, useMarkup?: boolean): Promise<BadgeResponse> {
+    const response = await this.fetchWithRetry(`${this.baseURL}/badge`, {
+      method: "POST",
+      body: JSON.stringify({ code, useMarkup }),
+    });
+
+    if (!response.ok) {
+      const error = await response
+        .json()
+        .catch(() => ({ error: "Backend unavailable" }));
+      throw new Error(error.errors?.join("\n") || "Verification failed");
+    }
+
+    return response.json();
+  }
+
+  badgeURL(hash?: string, style?: BadgeStyle): string {
+    const params = new URLSearchParams();
+    if (hash) params.set("hash", hash);
+    if (style) params.set("style", style);
+    const query = params.toString();
+    return `${this.baseURL}/badge${query ? `?${query}` : ""}`;
+  }
+
+  async getConformance(): Promise<ConformanceReport> {
+    const response = await this.fetchWithRetry(`${this.baseURL}/conformance`);
+
+    if (!response.ok) {
+      const error = await response
+        .json()
+        .catch(() => ({ error: "Backend unavailable" }));
+      throw new Error(error.error || "Failed to get the conformance results");
+    }
+
+    return response.json();
+  }
+
+  conformanceBadgeURL(style?: BadgeStyle): string {
+    return `${this.baseURL}/conformance/badge${style ? `?style=${style}` : ""}`;
+  }
+
+  async createSnippet(
+    code: string,
+    useMarkup?: boolean,
+    options: SnippetOptions = {}
+  ): Promise<SnippetResponse> {
+    const response = await this.fetchWithRetry(`${this.baseURL}/snippets`, {
+      method: "POST",
+      body: JSON.stringify({ code, useMarkup, ...options }),
+    });
+
+    if (!response.ok) {
+      const error = await response
+        .json()
+        .catch(() => ({ error: "Backend unavailable" }));
+      throw new Error(error.error || "Saving the snippet failed");
+    }
+
+    return response.json();
+  }
+
+  // reports a snippet for an admin to review
+  async flagSnippet(id: string, reason: SnippetFlagReason, note?: string): Promise<void> {
+    const response = await this.fetchWithRetry(`${this.baseURL}/snippets/${encodeURIComponent(id)}/flag`, {
+      method: "POST",
+      body: JSON.stringify({ reason, note }),
+    });
+
+    if (!response.ok) {
+      const error = await response
+        .json()
+        .catch(() => ({ error: "Backend unavailable" }));
+      throw new Error(error.error || "Reporting the snippet failed");
+    }
+  }
+
+  // The iframe src for a snippet's viewer. accent is a hex color without
+  // the '#'
+  embedURL(id: string, theme?: EmbedTheme, accent?: string): string {
+    const params = new URLSearchParams();
+    if (theme) params.set("theme", theme);
+    if (accent) params.set("accent", accent);
+    const query = params.toString();
+    return `${this.baseURL}/embed/${encodeURIComponent(id)}${query ? `?${query}` : ""}`;
+  }
+
   async validate(
     code: string
-  ): Promise<{ valid: boolean; errors: string[]; warnings: string[] }> {
+  ): Promise<{
+    valid: boolean;
+    errors: string[];
+    warnings: string[];
+    hints?: Hint[];
+  }> {
     const response = await this.fetchWithRetry(`${this.baseURL}/validate`, {
       method: "POST",
       body: JSON.stringify({ code }),
@@ -146,6 +1314,17 @@ class APIClient {
     return response.json();
   }
 
+  // entry and bundle are ignored
+  async validateProject(request: ProjectRequest): Promise<ProjectValidateResponse> {
+    const response = await this.fetchWithRetry(`${this.baseURL}/validate`, {
+      method: "POST",
+      body: JSON.stringify(request),
+    });
+
+    if (!response.ok) throw new Error("Validation failed");
+    return response.json();
+  }
+
   async getSuggestions(
     context: string,
     cursor: number
@@ -159,12 +1338,47 @@ class APIClient {
     return response.json();
   }
 
-  async getReference(): Promise<EmojiReference> {
-    const response = await this.fetchWithRetry(`${this.baseURL}/reference`);
+  // the emoji in a dialect's spelling when one is given
+  async getReference(dialect?: string): Promise<EmojiReference> {
+    const query = dialect ? `?dialect=${encodeURIComponent(dialect)}` : "";
+    const response = await this.fetchWithRetry(`${this.baseURL}/reference${query}`);
     if (!response.ok) throw new Error("Failed to get reference");
     return response.json();
   }
 
+  async getGrammar(): Promise<Grammar> {
+    const response = await this.fetchWithRetry(`${this.baseURL}/grammar`);
+    if (!response.ok) throw new Error("Failed to get grammar");
+    return response.json();
+  }
+
+  // Language releases after since, for a "what's new" panel
+  async getChangelog(since?: string): Promise<Changelog> {
+    const query = since ? `?since=${encodeURIComponent(since)}` : "";
+    const response = await this.fetchWithRetry(`${this.baseURL}/changelog${query}`);
+    if (!response.ok) throw new Error("Failed to get changelog");
+    return response.json();
+  }
+
+  async getMappingProfiles(): Promise<MappingProfile[]> {
+    const response = await this.fetchWithRetry(`${this.baseURL}/mappings`);
+    if (!response.ok) throw new Error("Failed to get mapping profiles");
+    const data = await response.json();
+    return data.profiles;
+  }
+
+  // Editor syntax definitions generated from the server's grammar, so
+  // highlighting matches the transpiler version in use
+  async getSyntaxDefinition(
+    format: "monaco" | "textmate"
+  ): Promise<Record<string, unknown>> {
+    const response = await this.fetchWithRetry(
+      `${this.baseURL}/grammar?format=${format}`
+    );
+    if (!response.ok) throw new Error("Failed to get syntax definition");
+    return response.json();
+  }
+
   async healthCheck(): Promise<{
     status: string;
     version: string;
@@ -174,10 +1388,48 @@ class APIClient {
     return response.json();
   }
 
-  async getExamples(syntaxType: SyntaxMode = "emoji"): Promise<Example[]> {
+  async getMeta(): Promise<DeploymentMeta> {
+    const response = await this.fetchWithRetry(`${this.baseURL}/meta`);
+    if (!response.ok) throw new Error("Failed to get deployment info");
+    return response.json();
+  }
+
+  async getLessons(syntax?: SyntaxMode): Promise<Lesson[]> {
+    const query = syntax ? `?syntax=${syntax}` : "";
+    const response = await this.fetchWithRetry(`${this.baseURL}/lessons${query}`);
+    if (!response.ok) throw new Error("Failed to get lessons");
+    const data = await response.json();
+    return data.lessons;
+  }
+
+  async getLesson(
+    id: string
+  ): Promise<{ lesson: Lesson; previous: string; next: string }> {
+    const response = await this.fetchWithRetry(
+      `${this.baseURL}/lessons/${encodeURIComponent(id)}`
+    );
+    if (!response.ok) throw new Error("Lesson not found");
+    return response.json();
+  }
+
+  async getQuiz(
+    options: { seed?: number; count?: number; category?: string } = {}
+  ): Promise<Quiz> {
+    const params = new URLSearchParams();
+    Object.entries(options).forEach(([key, value]) => {
+      if (value !== undefined) params.set(key, String(value));
+    });
+    const response = await this.fetchWithRetry(`${this.baseURL}/quiz?${params}`);
+    if (!response.ok) throw new Error("Failed to generate quiz");
+    return response.json();
+  }
+
+  // a dialect rewrites the examples' emoji into its own
+  async getExamples(syntaxType: SyntaxMode = "emoji", dialect?: string): Promise<Example[]> {
     try {
+      const query = dialect ? `&dialect=${encodeURIComponent(dialect)}` : "";
       const response = await this.fetchWithRetry(
-        `${this.baseURL}/examples?syntax=${syntaxType}`
+        `${this.baseURL}/examples?syntax=${syntaxType}${query}`
       );
 
       if (!response.ok) throw new Error("Failed to get examples");
@@ -189,18 +1441,44 @@ class APIClient {
         return [];
       }
 
-      return examples.map((item: any) => ({
-        title: item.title || item.name || "Untitled",
-        description: item.description || "",
-        code: item.code || "",
-        category: item.category || "general",
-        syntax: item.syntax || syntaxType,
-        targetLanguage: item.targetLanguage,
-      }));
+      return examples.map(toExample(syntaxType));
     } catch (error) {
       return [];
     }
   }
+
+  // the examples in the order to learn them, each after its prerequisites
+  async getExamplePath(syntaxType: SyntaxMode = "emoji", dialect?: string): Promise<Example[]> {
+    try {
+      const query = dialect ? `&dialect=${encodeURIComponent(dialect)}` : "";
+      const response = await this.fetchWithRetry(
+        `${this.baseURL}/examples/path?syntax=${syntaxType}${query}`
+      );
+      if (!response.ok) throw new Error("Failed to get the example path");
+      const data = await response.json();
+      return Array.isArray(data.path) ? data.path.map(toExample(syntaxType)) : [];
+    } catch (error) {
+      return [];
+    }
+  }
+}
+
+// toExample fills in what an example from the API may leave out
+function toExample(syntaxType: SyntaxMode) {
+  return (item: any): Example => ({
+    id: item.id,
+    title: item.title || item.name || "Untitled",
+    description: item.description || "",
+    code: item.code || "",
+    category: item.category || "general",
+    syntax: item.syntax || syntaxType,
+    targetLanguage: item.targetLanguage,
+    order: item.order,
+    difficulty: item.difficulty,
+    prerequisites: item.prerequisites,
+    runnable: item.runnable,
+    expectedOutput: item.expectedOutput,
+  });
 }
 
 export const apiClient = new APIClient();
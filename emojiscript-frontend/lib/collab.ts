@@ -0,0 +1,72 @@
+// Pair programming over the server's collaboration relay. The relay only
+// passes messages between the peers of a room; keeping the document in
+// step, with OT or a CRDT, is up to the editor, which sends and receives
+// its own updates as strings. Only the Fiber server offers the relay, and
+// only when it's turned on with COLLAB_RELAY=true.
+
+const API_BASE_URL = process.env.NEXT_PUBLIC_API_URL || "/api/v1";
+
+export type CollabEvent =
+  | { type: "welcome"; peer: string; peers?: string[] }
+  | { type: "join" | "leave"; peer: string }
+  | { type: "message"; from: string; data: string }
+  | { type: "error"; error: string };
+
+function collabURL(room: string): string {
+  const url = new URL(
+    `${API_BASE_URL}/collab/${encodeURIComponent(room)}`,
+    window.location.href
+  );
+  url.protocol = url.protocol === "https:" ? "wss:" : "ws:";
+  return url.toString();
+}
+
+export class CollabRoom {
+  private socket: WebSocket;
+  // this client's id in the room, once the relay has welcomed it
+  peer: string | null = null;
+  peers = new Set<string>();
+
+  constructor(
+    room: string,
+    private onMessage: (data: string, from: string) => void,
+    private onPeersChange?: (peers: string[]) => void,
+    private onError?: (error: string) => void
+  ) {
+    this.socket = new WebSocket(collabURL(room));
+    this.socket.onmessage = (event) => this.receive(JSON.parse(event.data));
+  }
+
+  // Sends an update to every other peer in the room
+  send(data: string) {
+    if (this.socket.readyState === WebSocket.OPEN) {
+      this.socket.send(data);
+    }
+  }
+
+  close() {
+    this.socket.close();
+  }
+
+  private receive(event: CollabEvent) {
+    switch (event.type) {
+      case "welcome":
+        this.peer = event.peer;
+        this.peers = new Set(event.peers ?? []);
+        break;
+      case "join":
+        this.peers.add(event.peer);
+        break;
+      case "leave":
+        this.peers.delete(event.peer);
+        break;
+      case "message":
+        this.onMessage(event.data, event.from);
+        return;
+      case "error":
+        this.onError?.(event.error);
+        return;
+    }
+    this.onPeersChange?.([...this.peers]);
+  }
+}
@@ -24,6 +24,8 @@ export const EMOJI_SYNTAX = {
     { emoji: "➖", js: "-", desc: "Subtraction" },
     { emoji: "✖️", js: "*", desc: "Multiplication" },
     { emoji: "➗", js: "/", desc: "Division" },
+    { emoji: "🍰", js: "%", desc: "Remainder" },
+    { emoji: "🔺", js: "**", desc: "Exponent" },
     { emoji: "🟰", js: "===", desc: "Strict equality" },
     { emoji: "❗", js: "!==", desc: "Strict inequality" },
     { emoji: "⬆️", js: ">", desc: "Greater than" },
@@ -33,6 +35,15 @@ export const EMOJI_SYNTAX = {
     { emoji: "🔗", js: "&&", desc: "Logical AND" },
     { emoji: "🔀", js: "||", desc: "Logical OR" },
     { emoji: "🚫", js: "!", desc: "Logical NOT" },
+    { emoji: "🛟", js: "??=", desc: "Assign if null/undefined" },
+    { emoji: "➕🟰", js: "+=", desc: "Add and assign" },
+    { emoji: "➖🟰", js: "-=", desc: "Subtract and assign" },
+    { emoji: "✖️🟰", js: "*=", desc: "Multiply and assign" },
+    { emoji: "➗🟰", js: "/=", desc: "Divide and assign" },
+    { emoji: "🍰🟰", js: "%=", desc: "Remainder and assign" },
+    { emoji: "🔺🟰", js: "**=", desc: "Exponent and assign" },
+    { emoji: "➕➕", js: "++", desc: "Increment" },
+    { emoji: "➖➖", js: "--", desc: "Decrement" },
   ],
   values: [
     { emoji: "✅", js: "true", desc: "Boolean true" },
@@ -44,6 +55,13 @@ export const EMOJI_SYNTAX = {
     { emoji: "📝", js: "console.log", desc: "Console log" },
     { emoji: "📥", js: "import", desc: "Import statement" },
     { emoji: "📤", js: "export", desc: "Export statement" },
+    { emoji: "⏰", js: "EmojiTime", desc: "Time: ⏰.now(), ⏰.format(date), ⏰.diff(a, b)" },
+    { emoji: "🎤", js: "EmojiInput", desc: "Input: 🎤(\"Name? \") reads a line" },
+    { emoji: "🧾", js: "JSON.stringify", desc: "Value to JSON text" },
+    { emoji: "📂", js: "JSON.parse", desc: "JSON text to value" },
+    { emoji: "📖", js: "EmojiReadFile", desc: "Read a file: 📖(\"notes.txt\") (Node and Python only)" },
+    { emoji: "✍️", js: "EmojiWriteFile", desc: "Write a file: ✍️(\"out.txt\", text) (Node and Python only)" },
+    { emoji: "🌐", js: "EmojiFetch", desc: "HTTP request: ⏳ 🌐(url) gives status, ok, text and json()" },
   ],
   async: [
     { emoji: "⚡", js: "async", desc: "Async function" },
@@ -59,6 +77,7 @@ export const EMOJI_SYNTAX = {
     { emoji: "🌟", js: "static", desc: "Static method" },
     { emoji: "🔧", js: "constructor", desc: "Constructor method" },
     { emoji: "🎭", js: "this", desc: "This keyword" },
+    { emoji: "🧲", js: "get", desc: "Getter (🎭.name 🧲 { ... })" },
   ],
   error: [
     { emoji: "💥", js: "throw", desc: "Throw error" },
@@ -77,7 +96,7 @@ export const EXAMPLES = [
   {
     title: "Variables",
     description: "Declare constants and variables",
-    code: '📦 name 🟰 "EmojiScript"\n🔢 version 🟰 1.0\n📝(name, version)',
+    code: '📦 name = "EmojiScript"\n🔢 version = 1.0\n📝(name, version)',
   },
   {
     title: "Function",
@@ -87,26 +106,26 @@ export const EXAMPLES = [
   {
     title: "Conditional",
     description: "If-else statement",
-    code: '📦 age 🟰 25\n❓ (age ⬆️ 18) {\n  📝("Adult")\n} ❌ {\n  📝("Minor")\n}',
+    code: '📦 age = 25\n❓ (age ⬆️ 18) {\n  📝("Adult")\n} ❌ {\n  📝("Minor")\n}',
   },
   {
     title: "Loop",
     description: "For loop example",
-    code: "🔁 (🔢 i 🟰 0; i ⬇️ 5; i➕➕) {\n  📝(i)\n}",
+    code: "🔁 (🔢 i = 0; i ⬇️ 5; i➕➕) {\n  📝(i)\n}",
   },
   {
     title: "Arrow Function",
     description: "Modern function syntax",
-    code: "📦 square 🟰 (x) ➡️ x ✖️ x\n📝(square(5))",
+    code: "📦 square = (x) ➡️ x ✖️ x\n📝(square(5))",
   },
   {
     title: "Array Operations",
     description: "Working with arrays",
-    code: "📦 numbers 🟰 [1, 2, 3, 4, 5]\n📦 doubled 🟰 numbers.map(n ➡️ n ✖️ 2)\n📝(doubled)",
+    code: "📦 numbers = [1, 2, 3, 4, 5]\n📦 doubled = numbers.map(n ➡️ n ✖️ 2)\n📝(doubled)",
   },
   {
     title: "Class",
     description: "Object-oriented programming",
-    code: '🔐 Person {\n  🔧(name, age) {\n    🎭.name 🟰 name\n    🎭.age 🟰 age\n  }\n  \n  greet() {\n    🔙 `Hi, I\'m ${🎭.name}`\n  }\n}\n\n📦 person 🟰 🎁 Person("Alice", 30)\n📝(person.greet())',
+    code: '🔐 Person {\n  🔧(name, age) {\n    🎭.name = name\n    🎭.age = age\n  }\n  \n  greet() {\n    🔙 `Hi, I\'m ${🎭.name}`\n  }\n}\n\n📦 person = 🎁 Person("Alice", 30)\n📝(person.greet())',
   },
 ];
@@ -0,0 +1,143 @@
+// Live transpiling over the server's /ws channel. Edits are streamed as
+// they happen and the server answers once typing pauses, instead of a POST
+// per pause. Only the Fiber server offers the channel; while a session
+// isn't connected the editor falls back to POSTing /transpile.
+
+import type { TargetLanguage, TranspileResponse } from "./api";
+
+const API_BASE_URL = process.env.NEXT_PUBLIC_API_URL || "/api/v1";
+const RECONNECT_DELAY = 5000;
+// Stop trying after this many connections fail without ever opening
+const MAX_FAILED_CONNECTS = 3;
+// The newest version of the /ws protocol this client speaks. A server
+// from before the handshake answers the hello with an error, which is
+// ignored, and the session carries on as version 1.
+const PROTOCOL_VERSION = 2;
+
+// A Monaco content change: replace length UTF-16 units at offset
+export interface LiveEdit {
+  offset: number;
+  length: number;
+  text: string;
+}
+
+// The server's answer to the hello that opens a session
+export interface LiveCapabilities {
+  protocol: number;
+  serverProtocol: number;
+  messageTypes: string[];
+  serverMessageTypes: string[];
+  maxPayload: number;
+  maxCodeLength: number;
+  maxCodeCharacters: number;
+  debounceMs: number;
+  minDebounceMs: number;
+  maxDebounceMs: number;
+  idleTimeoutSeconds: number;
+}
+
+export interface LiveOptions {
+  targetLanguage: TargetLanguage;
+  useMarkup: boolean;
+}
+
+function liveURL(): string {
+  const url = new URL(`${API_BASE_URL}/ws`, window.location.href);
+  url.protocol = url.protocol === "https:" ? "wss:" : "ws:";
+  return url.toString();
+}
+
+export class LiveSession {
+  private socket: WebSocket | null = null;
+  private version = 0;
+  private failedConnects = 0;
+  private reconnectTimer: ReturnType<typeof setTimeout> | undefined;
+  private closed = false;
+  // set once the server has answered the hello; null for a server from
+  // before the handshake
+  capabilities: LiveCapabilities | null = null;
+
+  // document reads the editor's text, sent whole when the session
+  // (re)connects or the server asks for a resync
+  constructor(
+    private document: () => string,
+    private options: LiveOptions,
+    private onResult: (result: TranspileResponse) => void
+  ) {
+    this.connect();
+  }
+
+  get connected(): boolean {
+    return this.socket?.readyState === WebSocket.OPEN;
+  }
+
+  setOptions(options: LiveOptions) {
+    this.options = options;
+    if (this.connected) {
+      this.send({ type: "options", version: this.version, options });
+    }
+  }
+
+  // Sends one editor change event's edits, which Monaco orders so they
+  // apply in sequence
+  edit(edits: LiveEdit[]) {
+    if (!this.connected) return;
+    this.version++;
+    this.send({ type: "edit", version: this.version, edits });
+  }
+
+  close() {
+    this.closed = true;
+    clearTimeout(this.reconnectTimer);
+    this.socket?.close();
+    this.socket = null;
+  }
+
+  private connect() {
+    let socket: WebSocket;
+    try {
+      socket = new WebSocket(liveURL());
+    } catch {
+      return;
+    }
+    let opened = false;
+    socket.onopen = () => {
+      opened = true;
+      this.failedConnects = 0;
+      this.capabilities = null;
+      this.send({ type: "hello", protocol: PROTOCOL_VERSION });
+      this.sendDocument();
+    };
+    socket.onmessage = (event) => {
+      const message = JSON.parse(event.data);
+      if (message.type === "result" && message.version === this.version) {
+        this.onResult(message);
+      } else if (message.type === "resync") {
+        this.sendDocument();
+      } else if (message.type === "capabilities") {
+        this.capabilities = message;
+      }
+    };
+    socket.onclose = () => {
+      if (this.socket === socket) this.socket = null;
+      if (!opened) this.failedConnects++;
+      if (this.closed || this.failedConnects >= MAX_FAILED_CONNECTS) return;
+      this.reconnectTimer = setTimeout(() => this.connect(), RECONNECT_DELAY);
+    };
+    this.socket = socket;
+  }
+
+  private sendDocument() {
+    this.version++;
+    this.send({
+      type: "document",
+      version: this.version,
+      code: this.document(),
+      options: this.options,
+    });
+  }
+
+  private send(message: object) {
+    this.socket?.send(JSON.stringify(message));
+  }
+}
@@ -1,7 +1,7 @@
 import { create } from "zustand";
 import { persist } from "zustand/middleware";
 
-type TargetLanguage = "javascript";
+type TargetLanguage = "javascript" | "python";
 
 type SyntaxMode = "emoji" | "markup";
 
@@ -228,9 +228,23 @@ export const MARKUP_TAGS: MarkupTagInfo[] = [
     example: '<if condition="age >= 18">\n  <print>"Adult"</print>\n</if>',
     category: "conditional",
   },
+  {
+    tag: "elif",
+    description: "Else-if block (follows if or elif)",
+    attributes: [
+      {
+        name: "condition",
+        required: true,
+        type: "boolean",
+        description: "Condition to test when the ones before were false",
+      },
+    ],
+    example: '<elif condition="age >= 13">\n  <print>"Teen"</print>\n</elif>',
+    category: "conditional",
+  },
   {
     tag: "else",
-    description: "Else block (follows if)",
+    description: "Else block (follows if or elif)",
     attributes: [],
     example: '<else>\n  <print>"Minor"</print>\n</else>',
     category: "conditional",
@@ -470,6 +484,40 @@ export const MARKUP_TAGS: MarkupTagInfo[] = [
     example: "<comment>This is a helpful comment</comment>",
     category: "io",
   },
+  {
+    tag: "readfile",
+    description: "Read a file's text into a variable (Node and Python only)",
+    attributes: [
+      {
+        name: "path",
+        required: true,
+        type: "string",
+        description: "File to read",
+      },
+      {
+        name: "var",
+        required: true,
+        type: "string",
+        description: "Variable to declare",
+      },
+    ],
+    example: '<readfile path="notes.txt" var="notes"/>',
+    category: "io",
+  },
+  {
+    tag: "writefile",
+    description: "Write text to a file (Node and Python only)",
+    attributes: [
+      {
+        name: "path",
+        required: true,
+        type: "string",
+        description: "File to write",
+      },
+    ],
+    example: '<writefile path="out.txt">notes.toUpperCase()</writefile>',
+    category: "io",
+  },
 ];
 
 // Emoji reference for suggestions
@@ -501,6 +549,8 @@ export const EMOJI_REFERENCE = {
     "➖": "subtraction",
     "✖️": "multiplication",
     "➗": "division",
+    "🍰": "remainder (%)",
+    "🔺": "exponent (**)",
     "🟰": "equals (===)",
     "❗": "not equals (!==)",
     "⬆️": "greater than",
@@ -513,6 +563,13 @@ export const EMOJI_REFERENCE = {
     "📺": "console.log/display",
     "📥": "import/input",
     "📤": "export/output",
+    "⏰": "time (now, format, diff)",
+    "🎤": "input (prompt/readline)",
+    "🧾": "JSON.stringify",
+    "📂": "JSON.parse",
+    "📖": "read file",
+    "✍️": "write file",
+    "🌐": "fetch (HTTP request)",
   },
   dataStructures: {
     "📊": "array",
@@ -639,6 +696,14 @@ export class SuggestionEngine {
     // Check if after an if statement
     const hasIf = textBeforeCursor.includes("</if>");
     if (hasIf && !textBeforeCursor.includes("<else>")) {
+      suggestions.push({
+        label: "<elif>",
+        detail: "Else-if block",
+        documentation: "Another condition to test when the if condition is false",
+        insertText: '<elif condition="$1">\n  $2\n</elif>',
+        category: "conditional",
+        confidence: 0.8,
+      });
       suggestions.push({
         label: "<else>",
         detail: "Else block",